@@ -0,0 +1,87 @@
+// Command backfill-recordings adds recordings made before the recordings
+// catalog existed to it. It can be run again safely.
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/VanCannon/openpam/gateway/internal/database"
+	"github.com/VanCannon/openpam/gateway/internal/recordings"
+	"github.com/VanCannon/openpam/gateway/internal/repository"
+)
+
+func main() {
+	var (
+		dir      = flag.String("dir", "./recordings", "Recordings directory")
+		host     = flag.String("host", getEnv("DB_HOST", "localhost"), "Database host")
+		port     = flag.Int("port", getEnvInt("DB_PORT", 5432), "Database port")
+		user     = flag.String("user", getEnv("DB_USER", "openpam"), "Database user")
+		password = flag.String("password", getEnv("DB_PASSWORD", "openpam"), "Database password")
+		dbname   = flag.String("dbname", getEnv("DB_NAME", "openpam"), "Database name")
+		sslmode  = flag.String("sslmode", getEnv("DB_SSLMODE", "disable"), "SSL mode")
+	)
+
+	flag.Parse()
+
+	cfg := database.Config{
+		Host:            *host,
+		Port:            *port,
+		User:            *user,
+		Password:        *password,
+		Database:        *dbname,
+		SSLMode:         *sslmode,
+		MaxOpenConns:    2,
+		MaxIdleConns:    1,
+		ConnMaxLifetime: 5 * time.Minute,
+		ConnMaxIdleTime: 1 * time.Minute,
+	}
+
+	db, err := database.New(cfg)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to connect to database: %v\n", err)
+		os.Exit(1)
+	}
+	defer db.Close()
+
+	storage, err := recordings.NewLocal(*dir)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to open recordings directory: %v\n", err)
+		os.Exit(1)
+	}
+
+	result, err := recordings.Backfill(context.Background(), storage, repository.NewRecordingRepository(db))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Backfill failed: %v\n", err)
+		os.Exit(1)
+	}
+
+	fmt.Printf("Catalogued recordings: %d\n", result.Catalogued)
+	fmt.Printf("Skipped files: %d\n", result.Skipped)
+	for _, failure := range result.Failed {
+		fmt.Fprintf(os.Stderr, "Failed: %s\n", failure)
+	}
+	if len(result.Failed) > 0 {
+		os.Exit(1)
+	}
+}
+
+func getEnv(key, defaultValue string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return defaultValue
+}
+
+func getEnvInt(key string, defaultValue int) int {
+	if value := os.Getenv(key); value != "" {
+		var intValue int
+		if _, err := fmt.Sscanf(value, "%d", &intValue); err == nil {
+			return intValue
+		}
+	}
+	return defaultValue
+}
@@ -0,0 +1,203 @@
+// Command loadtest opens concurrent recorded sessions through the gateway to
+// measure its capacity. Each session types into its target at a fixed
+// interval and times how long the echo takes to come back.
+//
+// It is meant for the synthetic targets of a gateway running with
+// TEST_HARNESS_ENABLED, and finds them itself unless -target is given.
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+func main() {
+	var (
+		gateway  = flag.String("gateway", getEnv("OPENPAM_URL", "http://localhost:8080"), "Gateway base URL")
+		token    = flag.String("token", os.Getenv("OPENPAM_TOKEN"), "API key or session token of an admin")
+		protocol = flag.String("protocol", "ssh", "Session protocol: ssh or rdp")
+		targetID = flag.String("target", "", "Target ID (default: the synthetic target of the protocol)")
+		sessions = flag.Int("sessions", 10, "Concurrent sessions")
+		ramp     = flag.Duration("ramp", 5*time.Second, "Time over which sessions are opened")
+		duration = flag.Duration("duration", 30*time.Second, "How long each session runs once opened")
+		interval = flag.Duration("interval", 200*time.Millisecond, "Time between keystrokes in each session")
+		insecure = flag.Bool("insecure", false, "Skip TLS certificate verification")
+	)
+	flag.Parse()
+
+	if *token == "" {
+		fatalf("An admin token is required: set -token or OPENPAM_TOKEN")
+	}
+	if *protocol != "ssh" && *protocol != "rdp" {
+		fatalf("Unsupported protocol %q", *protocol)
+	}
+	if *sessions < 1 {
+		fatalf("-sessions must be at least 1")
+	}
+
+	base, err := url.Parse(strings.TrimSuffix(*gateway, "/"))
+	if err != nil {
+		fatalf("Invalid gateway URL: %v", err)
+	}
+	client := &client{
+		base:  base,
+		token: *token,
+		http:  &http.Client{Timeout: 10 * time.Second},
+	}
+	if *insecure {
+		tlsConfig := &tls.Config{InsecureSkipVerify: true}
+		client.http.Transport = &http.Transport{TLSClientConfig: tlsConfig}
+		client.tls = tlsConfig
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	if *targetID == "" {
+		*targetID, err = client.syntheticTarget(ctx, *protocol)
+		if err != nil {
+			fatalf("%v", err)
+		}
+	}
+
+	fmt.Printf("Opening %d %s sessions to %s over %s, each for %s\n", *sessions, *protocol, *targetID, *ramp, *duration)
+
+	results := &results{}
+	sampler := newSampler(client)
+	go sampler.run(ctx)
+
+	started := time.Now()
+	var wg sync.WaitGroup
+	for i := 0; i < *sessions; i++ {
+		delay := time.Duration(0)
+		if *sessions > 1 {
+			delay = *ramp * time.Duration(i) / time.Duration(*sessions-1)
+		}
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(delay):
+			}
+			run := &session{client: client, protocol: *protocol, targetID: *targetID, interval: *interval, results: results}
+			run.run(ctx, *duration)
+		}()
+	}
+	wg.Wait()
+	sampler.stop()
+
+	results.print(os.Stdout, time.Since(started))
+	sampler.print(os.Stdout)
+
+	if results.failed > 0 {
+		os.Exit(1)
+	}
+}
+
+// client calls the gateway's API
+type client struct {
+	base  *url.URL
+	token string
+	http  *http.Client
+	tls   *tls.Config
+}
+
+// getJSON decodes the response of an authenticated GET into v
+func (c *client) getJSON(ctx context.Context, path string, v interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.base.String()+path, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+c.token)
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("GET %s: %s", path, resp.Status)
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+// syntheticTarget finds the ID of the harness's synthetic target for protocol
+func (c *client) syntheticTarget(ctx context.Context, protocol string) (string, error) {
+	var resp struct {
+		Targets []struct {
+			ID       string `json:"id"`
+			Name     string `json:"name"`
+			Protocol string `json:"protocol"`
+		} `json:"targets"`
+	}
+	if err := c.getJSON(ctx, "/api/v1/targets?label="+url.QueryEscape("synthetic=true"), &resp); err != nil {
+		return "", fmt.Errorf("failed to look up synthetic targets: %w", err)
+	}
+
+	for _, t := range resp.Targets {
+		if t.Protocol == protocol {
+			return t.ID, nil
+		}
+	}
+	return "", fmt.Errorf("no synthetic %s target found; is the gateway running with TEST_HARNESS_ENABLED?", protocol)
+}
+
+// dial opens a session WebSocket to the target
+func (c *client) dial(ctx context.Context, protocol, targetID string) (*websocket.Conn, error) {
+	u := *c.base
+	switch u.Scheme {
+	case "https":
+		u.Scheme = "wss"
+	default:
+		u.Scheme = "ws"
+	}
+	u.Path = fmt.Sprintf("/api/ws/connect/%s/%s", protocol, targetID)
+
+	dialer := websocket.Dialer{
+		HandshakeTimeout: 10 * time.Second,
+		TLSClientConfig:  c.tls,
+	}
+	if protocol == "rdp" {
+		dialer.Subprotocols = []string{"guacamole"}
+	}
+
+	header := http.Header{}
+	header.Set("Authorization", "Bearer "+c.token)
+
+	conn, resp, err := dialer.DialContext(ctx, u.String(), header)
+	if err != nil {
+		if resp != nil {
+			return nil, fmt.Errorf("%s", resp.Status)
+		}
+		return nil, err
+	}
+	return conn, nil
+}
+
+func getEnv(key, defaultValue string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return defaultValue
+}
+
+func fatalf(format string, args ...interface{}) {
+	fmt.Fprintf(os.Stderr, format+"\n", args...)
+	os.Exit(1)
+}
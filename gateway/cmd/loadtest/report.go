@@ -0,0 +1,176 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"runtime"
+	"sort"
+	"sync"
+	"time"
+)
+
+// results collects what the sessions measured
+type results struct {
+	mu         sync.Mutex
+	succeeded  int
+	failed     int
+	errors     map[string]int
+	connects   []time.Duration
+	roundTrips []time.Duration
+}
+
+func (r *results) opened(latency time.Duration) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.succeeded++
+	r.connects = append(r.connects, latency)
+}
+
+func (r *results) echoed(latency time.Duration) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.roundTrips = append(r.roundTrips, latency)
+}
+
+func (r *results) fail(stage string, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.failed++
+	if r.errors == nil {
+		r.errors = make(map[string]int)
+	}
+	r.errors[stage+": "+err.Error()]++
+}
+
+func (r *results) print(w io.Writer, elapsed time.Duration) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	fmt.Fprintf(w, "\nSessions: %d opened, %d failed in %s\n", r.succeeded, r.failed, elapsed.Round(time.Millisecond))
+	for msg, n := range r.errors {
+		fmt.Fprintf(w, "  %dx %s\n", n, msg)
+	}
+	printLatencies(w, "Connect", r.connects)
+	printLatencies(w, "Round trip", r.roundTrips)
+	if secs := elapsed.Seconds(); secs > 0 {
+		fmt.Fprintf(w, "Keystrokes: %d (%.1f/s)\n", len(r.roundTrips), float64(len(r.roundTrips))/secs)
+	}
+}
+
+func printLatencies(w io.Writer, name string, d []time.Duration) {
+	if len(d) == 0 {
+		fmt.Fprintf(w, "%s latency: no samples\n", name)
+		return
+	}
+	sort.Slice(d, func(i, j int) bool { return d[i] < d[j] })
+	fmt.Fprintf(w, "%s latency: p50 %s  p90 %s  p99 %s  max %s  (%d samples)\n", name,
+		percentile(d, 50), percentile(d, 90), percentile(d, 99), d[len(d)-1], len(d))
+}
+
+// percentile returns the p-th percentile of sorted durations, by nearest rank
+func percentile(sorted []time.Duration, p int) time.Duration {
+	rank := (p*len(sorted) + 99) / 100
+	if rank < 1 {
+		rank = 1
+	}
+	return sorted[rank-1].Round(time.Microsecond)
+}
+
+// gatewayStats is the gateway's resource usage from the harness stats endpoint
+type gatewayStats struct {
+	Sessions   int    `json:"sessions"`
+	Goroutines int    `json:"goroutines"`
+	HeapAlloc  uint64 `json:"heap_alloc_bytes"`
+	GCRuns     uint32 `json:"gc_runs"`
+	GCPauseNs  uint64 `json:"gc_pause_ns"`
+}
+
+// sampler polls the gateway's and the load generator's own resource usage
+// and keeps the peaks
+type sampler struct {
+	client *client
+	done   chan struct{}
+	exited chan struct{}
+
+	mu          sync.Mutex
+	err         error
+	first, last gatewayStats
+	peak        gatewayStats
+	samples     int
+	localPeak   gatewayStats
+}
+
+func newSampler(c *client) *sampler {
+	return &sampler{client: c, done: make(chan struct{}), exited: make(chan struct{})}
+}
+
+func (s *sampler) run(ctx context.Context) {
+	defer close(s.exited)
+
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+
+	for {
+		s.sample(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-s.done:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (s *sampler) sample(ctx context.Context) {
+	var mem runtime.MemStats
+	runtime.ReadMemStats(&mem)
+	local := gatewayStats{Goroutines: runtime.NumGoroutine(), HeapAlloc: mem.HeapAlloc}
+
+	var stats gatewayStats
+	err := s.client.getJSON(ctx, "/api/v1/harness/stats", &stats)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.localPeak.Goroutines = max(s.localPeak.Goroutines, local.Goroutines)
+	s.localPeak.HeapAlloc = max(s.localPeak.HeapAlloc, local.HeapAlloc)
+
+	if err != nil {
+		s.err = err
+		return
+	}
+	if s.samples == 0 {
+		s.first = stats
+	}
+	s.samples++
+	s.last = stats
+	s.peak.Sessions = max(s.peak.Sessions, stats.Sessions)
+	s.peak.Goroutines = max(s.peak.Goroutines, stats.Goroutines)
+	s.peak.HeapAlloc = max(s.peak.HeapAlloc, stats.HeapAlloc)
+}
+
+func (s *sampler) stop() {
+	close(s.done)
+	<-s.exited
+}
+
+func (s *sampler) print(w io.Writer) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.samples == 0 {
+		fmt.Fprintf(w, "Gateway resources: unavailable (%v)\n", s.err)
+	} else {
+		fmt.Fprintf(w, "Gateway peak: %d sessions, %d goroutines, %.1f MiB heap\n",
+			s.peak.Sessions, s.peak.Goroutines, mib(s.peak.HeapAlloc))
+		fmt.Fprintf(w, "Gateway GC: %d runs, %s paused\n",
+			s.last.GCRuns-s.first.GCRuns, time.Duration(s.last.GCPauseNs-s.first.GCPauseNs).Round(time.Microsecond))
+	}
+	fmt.Fprintf(w, "Load generator peak: %d goroutines, %.1f MiB heap\n", s.localPeak.Goroutines, mib(s.localPeak.HeapAlloc))
+}
+
+func mib(bytes uint64) float64 {
+	return float64(bytes) / (1 << 20)
+}
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// echoTimeout is how long a keystroke may go unanswered before the session fails
+const echoTimeout = 10 * time.Second
+
+// session is one simulated user typing into a target
+type session struct {
+	client   *client
+	protocol string
+	targetID string
+	interval time.Duration
+	results  *results
+
+	conn *websocket.Conn
+}
+
+// run opens the session, types into it for duration and closes it
+func (s *session) run(ctx context.Context, duration time.Duration) {
+	start := time.Now()
+	conn, err := s.client.dial(ctx, s.protocol, s.targetID)
+	if err != nil {
+		s.results.fail("connect", err)
+		return
+	}
+	s.conn = conn
+	defer conn.Close()
+
+	if err := s.waitReady(); err != nil {
+		s.results.fail("ready", err)
+		return
+	}
+	s.results.opened(time.Since(start))
+
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+	deadline := time.After(duration)
+
+	for i := 0; ; i++ {
+		select {
+		case <-ctx.Done():
+			s.close()
+			return
+		case <-deadline:
+			s.close()
+			return
+		case <-ticker.C:
+		}
+
+		key := 'a' + rune(i%26)
+		sent := time.Now()
+		if err := s.keystroke(key); err != nil {
+			s.results.fail("keystroke", err)
+			return
+		}
+		s.results.echoed(time.Since(sent))
+	}
+}
+
+// waitReady waits for the target's first output: the shell banner over SSH,
+// or the ready instruction over RDP
+func (s *session) waitReady() error {
+	s.conn.SetReadDeadline(time.Now().Add(echoTimeout))
+	for {
+		_, data, err := s.conn.ReadMessage()
+		if err != nil {
+			return closeErr(err)
+		}
+		if s.protocol == "ssh" || bytes.Contains(data, []byte("5.ready,")) {
+			return nil
+		}
+	}
+}
+
+// keystroke sends a keystroke and waits for the target's answer: the echoed
+// character over SSH, or the next frame over RDP
+func (s *session) keystroke(key rune) error {
+	var input []byte
+	if s.protocol == "ssh" {
+		input = []byte(string(key))
+	} else {
+		keysym := fmt.Sprint(int(key))
+		input = []byte(instruction("key", keysym, "1") + instruction("key", keysym, "0"))
+	}
+	if err := s.conn.WriteMessage(websocket.TextMessage, input); err != nil {
+		return err
+	}
+
+	s.conn.SetReadDeadline(time.Now().Add(echoTimeout))
+	for {
+		_, data, err := s.conn.ReadMessage()
+		if err != nil {
+			return closeErr(err)
+		}
+
+		if s.protocol == "ssh" {
+			if bytes.ContainsRune(data, key) {
+				return nil
+			}
+			continue
+		}
+
+		// Acknowledge frames like a browser does, so the gateway doesn't
+		// lower the session's quality
+		syncs := frames(string(data))
+		for _, sync := range syncs {
+			if err := s.conn.WriteMessage(websocket.TextMessage, []byte(sync)); err != nil {
+				return err
+			}
+		}
+		if len(syncs) > 0 {
+			return nil
+		}
+	}
+}
+
+// close ends the session the way a user closing the tab does
+func (s *session) close() {
+	msg := websocket.FormatCloseMessage(websocket.CloseNormalClosure, "")
+	s.conn.WriteControl(websocket.CloseMessage, msg, time.Now().Add(time.Second))
+}
+
+// frames returns the sync instructions in a Guacamole message
+func frames(data string) []string {
+	var syncs []string
+	for _, instr := range strings.SplitAfter(data, ";") {
+		if strings.HasPrefix(instr, "4.sync,") {
+			syncs = append(syncs, instr)
+		}
+	}
+	return syncs
+}
+
+// instruction encodes a Guacamole instruction
+func instruction(opcode string, args ...string) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%d.%s", len(opcode), opcode)
+	for _, arg := range args {
+		fmt.Fprintf(&b, ",%d.%s", len(arg), arg)
+	}
+	b.WriteString(";")
+	return b.String()
+}
+
+// closeErr turns the gateway's close frame into an error carrying its reason
+func closeErr(err error) error {
+	var ce *websocket.CloseError
+	if errors.As(err, &ce) && ce.Text != "" {
+		return fmt.Errorf("closed by gateway (%d): %s", ce.Code, ce.Text)
+	}
+	return err
+}
@@ -0,0 +1,115 @@
+// Command migrate-recordings moves recordings from a local directory into the
+// storage configured with RECORDINGS_STORAGE, pointing their catalog entries
+// at the copies. It can be run again safely.
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/VanCannon/openpam/gateway/internal/database"
+	"github.com/VanCannon/openpam/gateway/internal/recordings"
+	"github.com/VanCannon/openpam/gateway/internal/repository"
+)
+
+func main() {
+	var (
+		dir      = flag.String("dir", "./recordings", "Local recordings directory to migrate")
+		remove   = flag.Bool("remove", false, "Remove local recordings once copied and catalogued")
+		host     = flag.String("host", getEnv("DB_HOST", "localhost"), "Database host")
+		port     = flag.Int("port", getEnvInt("DB_PORT", 5432), "Database port")
+		user     = flag.String("user", getEnv("DB_USER", "openpam"), "Database user")
+		password = flag.String("password", getEnv("DB_PASSWORD", "openpam"), "Database password")
+		dbname   = flag.String("dbname", getEnv("DB_NAME", "openpam"), "Database name")
+		sslmode  = flag.String("sslmode", getEnv("DB_SSLMODE", "disable"), "SSL mode")
+	)
+
+	flag.Parse()
+
+	// The destination is configured like the gateway's
+	dest := recordings.Config{
+		Backend:   getEnv("RECORDINGS_STORAGE", recordings.BackendLocal),
+		Dir:       getEnv("RECORDINGS_DIR", "./recordings"),
+		Bucket:    getEnv("RECORDINGS_BUCKET", ""),
+		Prefix:    getEnv("RECORDINGS_PREFIX", ""),
+		Endpoint:  getEnv("RECORDINGS_ENDPOINT", ""),
+		Region:    getEnv("RECORDINGS_REGION", ""),
+		AccessKey: getEnv("RECORDINGS_ACCESS_KEY", ""),
+		SecretKey: getEnv("RECORDINGS_SECRET_KEY", ""),
+		SASToken:  getEnv("RECORDINGS_AZURE_SAS_TOKEN", ""),
+		PartSize:  getEnvInt("RECORDINGS_PART_SIZE", 8<<20),
+	}
+	if dest.Backend == recordings.BackendLocal {
+		fmt.Fprintf(os.Stderr, "RECORDINGS_STORAGE is local; set it to the storage to migrate to\n")
+		os.Exit(1)
+	}
+
+	to, err := recordings.New(dest)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Invalid RECORDINGS settings: %v\n", err)
+		os.Exit(1)
+	}
+	from, err := recordings.NewLocal(*dir)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to open recordings directory: %v\n", err)
+		os.Exit(1)
+	}
+
+	cfg := database.Config{
+		Host:            *host,
+		Port:            *port,
+		User:            *user,
+		Password:        *password,
+		Database:        *dbname,
+		SSLMode:         *sslmode,
+		MaxOpenConns:    2,
+		MaxIdleConns:    1,
+		ConnMaxLifetime: 5 * time.Minute,
+		ConnMaxIdleTime: 1 * time.Minute,
+	}
+
+	db, err := database.New(cfg)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to connect to database: %v\n", err)
+		os.Exit(1)
+	}
+	defer db.Close()
+
+	result, err := recordings.Migrate(context.Background(), from, to, repository.NewRecordingRepository(db), *remove)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Migration failed: %v\n", err)
+		os.Exit(1)
+	}
+
+	fmt.Printf("Copied files: %d\n", result.Copied)
+	fmt.Printf("Already copied: %d\n", result.Skipped)
+	if *remove {
+		fmt.Printf("Removed originals: %d\n", result.Removed)
+	}
+	for _, failure := range result.Failed {
+		fmt.Fprintf(os.Stderr, "Failed: %s\n", failure)
+	}
+	if len(result.Failed) > 0 {
+		os.Exit(1)
+	}
+}
+
+func getEnv(key, defaultValue string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return defaultValue
+}
+
+func getEnvInt(key string, defaultValue int) int {
+	if value := os.Getenv(key); value != "" {
+		var intValue int
+		if _, err := fmt.Sscanf(value, "%d", &intValue); err == nil {
+			return intValue
+		}
+	}
+	return defaultValue
+}
@@ -0,0 +1,175 @@
+// Command querybench times the audit and schedule queries on the gateway's
+// hot paths against an existing database, to compare index changes. Run it
+// against a copy of production data before and after migrating:
+//
+//	go run ./cmd/querybench > before.txt
+//	go run ./cmd/migrate -action=up
+//	go run ./cmd/querybench > after.txt
+//
+// It only reads. The user and target queried are the ones with the most
+// sessions, so their listings are the largest.
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/VanCannon/openpam/gateway/internal/database"
+	"github.com/VanCannon/openpam/gateway/internal/repository"
+	"github.com/google/uuid"
+)
+
+func main() {
+	var (
+		runs     = flag.Int("runs", 50, "Times each query is run")
+		host     = flag.String("host", getEnv("DB_HOST", "localhost"), "Database host")
+		port     = flag.Int("port", getEnvInt("DB_PORT", 5432), "Database port")
+		user     = flag.String("user", getEnv("DB_USER", "openpam"), "Database user")
+		password = flag.String("password", getEnv("DB_PASSWORD", "openpam"), "Database password")
+		dbname   = flag.String("dbname", getEnv("DB_NAME", "openpam"), "Database name")
+		sslmode  = flag.String("sslmode", getEnv("DB_SSLMODE", "disable"), "SSL mode")
+	)
+
+	flag.Parse()
+
+	cfg := database.Config{
+		Host:            *host,
+		Port:            *port,
+		User:            *user,
+		Password:        *password,
+		Database:        *dbname,
+		SSLMode:         *sslmode,
+		MaxOpenConns:    2,
+		MaxIdleConns:    1,
+		ConnMaxLifetime: 5 * time.Minute,
+		ConnMaxIdleTime: 1 * time.Minute,
+	}
+
+	db, err := database.New(cfg)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to connect to database: %v\n", err)
+		os.Exit(1)
+	}
+	defer db.Close()
+
+	ctx := context.Background()
+
+	var sample struct {
+		Sessions  int       `db:"sessions"`
+		Schedules int       `db:"schedules"`
+		UserID    uuid.UUID `db:"user_id"`
+		TargetID  uuid.UUID `db:"target_id"`
+	}
+	err = db.GetContext(ctx, &sample, `
+		SELECT (SELECT COUNT(*) FROM audit_logs) AS sessions,
+		       (SELECT COUNT(*) FROM schedules) AS schedules,
+		       (SELECT user_id FROM audit_logs GROUP BY user_id ORDER BY COUNT(*) DESC LIMIT 1) AS user_id,
+		       (SELECT target_id FROM audit_logs GROUP BY target_id ORDER BY COUNT(*) DESC LIMIT 1) AS target_id
+	`)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to pick a user and target, are there any sessions? %v\n", err)
+		os.Exit(1)
+	}
+
+	auditRepo := repository.NewAuditLogRepository(db)
+	scheduleRepo := repository.NewScheduleRepository(db)
+
+	benchmarks := []struct {
+		name string
+		run  func() error
+	}{
+		{"audit: list by user", func() error {
+			_, err := auditRepo.ListByUser(ctx, sample.UserID, 50, 0)
+			return err
+		}},
+		{"audit: list by target", func() error {
+			_, err := auditRepo.ListByTarget(ctx, sample.TargetID, 50, 0)
+			return err
+		}},
+		{"audit: search by status", func() error {
+			_, err := auditRepo.Search(ctx, repository.AuditLogFilter{Status: "failed", Limit: 50})
+			return err
+		}},
+		{"audit: active sessions", func() error {
+			_, err := auditRepo.ListActive(ctx)
+			return err
+		}},
+		{"audit: last by targets", func() error {
+			_, err := auditRepo.LastByTargets(ctx, []uuid.UUID{sample.TargetID})
+			return err
+		}},
+		{"schedules: active window", func() error {
+			_, err := scheduleRepo.ActiveWindowEnd(ctx, sample.UserID, sample.TargetID, time.Now())
+			return err
+		}},
+		{"schedules: started", func() error {
+			_, err := scheduleRepo.ListStarted(ctx, time.Now())
+			return err
+		}},
+	}
+
+	fmt.Printf("%d sessions, %d schedules; %d runs each\n\n", sample.Sessions, sample.Schedules, *runs)
+	fmt.Printf("%-26s %10s %10s %10s\n", "Query", "p50", "p95", "max")
+
+	failed := false
+	for _, b := range benchmarks {
+		// The first run warms the cache and isn't counted
+		if err := b.run(); err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %v\n", b.name, err)
+			failed = true
+			continue
+		}
+
+		timings := make([]time.Duration, 0, *runs)
+		for i := 0; i < *runs; i++ {
+			start := time.Now()
+			if err := b.run(); err != nil {
+				fmt.Fprintf(os.Stderr, "%s: %v\n", b.name, err)
+				failed = true
+				break
+			}
+			timings = append(timings, time.Since(start))
+		}
+		if len(timings) == 0 {
+			continue
+		}
+
+		sort.Slice(timings, func(i, j int) bool { return timings[i] < timings[j] })
+		fmt.Printf("%-26s %10s %10s %10s\n", b.name,
+			percentile(timings, 50), percentile(timings, 95), timings[len(timings)-1].Round(time.Microsecond))
+	}
+
+	if failed {
+		os.Exit(1)
+	}
+}
+
+// percentile returns the p-th percentile of sorted durations by nearest rank
+func percentile(sorted []time.Duration, p int) time.Duration {
+	rank := (p*len(sorted) + 99) / 100
+	if rank < 1 {
+		rank = 1
+	}
+	return sorted[rank-1].Round(time.Microsecond)
+}
+
+func getEnv(key, defaultValue string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return defaultValue
+}
+
+func getEnvInt(key string, defaultValue int) int {
+	if value := os.Getenv(key); value != "" {
+		var intValue int
+		if _, err := fmt.Sscanf(value, "%d", &intValue); err == nil {
+			return intValue
+		}
+	}
+	return defaultValue
+}
@@ -0,0 +1,143 @@
+// Command seed-demo fills the database with demo data for evaluating the
+// gateway: zones, targets pointing at the bundled SSH and RDP test hosts
+// (docker compose --profile demo), users in each role, schedules, a month of
+// sessions and sample recordings. With -remove it deletes all of it again.
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/VanCannon/openpam/gateway/internal/database"
+	"github.com/VanCannon/openpam/gateway/internal/demo"
+	"github.com/VanCannon/openpam/gateway/internal/recordings"
+	"github.com/VanCannon/openpam/gateway/internal/repository"
+)
+
+func main() {
+	var (
+		remove     = flag.Bool("remove", false, "Remove the demo data instead of seeding it")
+		sshAddress = flag.String("ssh-address", getEnv("DEMO_SSH_ADDRESS", "127.0.0.1:2201"), "SSH test host, as the gateway reaches it")
+		rdpAddress = flag.String("rdp-address", getEnv("DEMO_RDP_ADDRESS", "openpam-demo-rdp:3389"), "RDP test host, as guacd reaches it")
+		username   = flag.String("username", getEnv("DEMO_USERNAME", "demo"), "Account on the test hosts")
+		password   = flag.String("demo-password", getEnv("DEMO_PASSWORD", "demo"), "Password of the account on the test hosts")
+		host       = flag.String("host", getEnv("DB_HOST", "localhost"), "Database host")
+		port       = flag.Int("port", getEnvInt("DB_PORT", 5432), "Database port")
+		user       = flag.String("user", getEnv("DB_USER", "openpam"), "Database user")
+		dbPassword = flag.String("password", getEnv("DB_PASSWORD", "openpam"), "Database password")
+		dbname     = flag.String("dbname", getEnv("DB_NAME", "openpam"), "Database name")
+		sslmode    = flag.String("sslmode", getEnv("DB_SSLMODE", "disable"), "SSL mode")
+	)
+
+	flag.Parse()
+
+	// Sample recordings go where the gateway plays them back from
+	storage, err := recordings.New(recordings.Config{
+		Backend:   getEnv("RECORDINGS_STORAGE", recordings.BackendLocal),
+		Dir:       getEnv("RECORDINGS_DIR", "./recordings"),
+		Bucket:    getEnv("RECORDINGS_BUCKET", ""),
+		Prefix:    getEnv("RECORDINGS_PREFIX", ""),
+		Endpoint:  getEnv("RECORDINGS_ENDPOINT", ""),
+		Region:    getEnv("RECORDINGS_REGION", ""),
+		AccessKey: getEnv("RECORDINGS_ACCESS_KEY", ""),
+		SecretKey: getEnv("RECORDINGS_SECRET_KEY", ""),
+		SASToken:  getEnv("RECORDINGS_AZURE_SAS_TOKEN", ""),
+		PartSize:  getEnvInt("RECORDINGS_PART_SIZE", 8<<20),
+	})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Invalid RECORDINGS settings: %v\n", err)
+		os.Exit(1)
+	}
+
+	cfg := database.Config{
+		Host:            *host,
+		Port:            *port,
+		User:            *user,
+		Password:        *dbPassword,
+		Database:        *dbname,
+		SSLMode:         *sslmode,
+		MaxOpenConns:    2,
+		MaxIdleConns:    1,
+		ConnMaxLifetime: 5 * time.Minute,
+		ConnMaxIdleTime: 1 * time.Minute,
+	}
+
+	db, err := database.New(cfg)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to connect to database: %v\n", err)
+		os.Exit(1)
+	}
+	defer db.Close()
+
+	seeder := demo.New(demo.Stores{
+		Zones:       repository.NewZoneRepository(db),
+		Targets:     repository.NewTargetRepository(db),
+		Credentials: repository.NewCredentialRepository(db),
+		Users:       repository.NewUserRepository(db),
+		Schedules:   repository.NewScheduleRepository(db),
+		Audit:       repository.NewAuditLogRepository(db),
+		Recordings:  repository.NewRecordingRepository(db),
+		Records:     repository.NewDemoRepository(db),
+	}, storage, demo.Config{
+		SSHAddress: *sshAddress,
+		RDPAddress: *rdpAddress,
+		Username:   *username,
+		Password:   *password,
+	})
+
+	if *remove {
+		removed, err := seeder.Remove(context.Background())
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to remove demo data: %v\n", err)
+			os.Exit(1)
+		}
+		tables := make([]string, 0, len(removed))
+		for table := range removed {
+			tables = append(tables, table)
+		}
+		sort.Strings(tables)
+		for _, table := range tables {
+			fmt.Printf("Removed %s: %d\n", table, removed[table])
+		}
+		return
+	}
+
+	summary, err := seeder.Seed(context.Background())
+	if errors.Is(err, demo.ErrSeeded) {
+		fmt.Println("Demo data is already seeded; remove it first with -remove to seed it again")
+		return
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to seed demo data: %v\n", err)
+		os.Exit(1)
+	}
+
+	fmt.Printf("Zones: %d\n", summary.Zones)
+	fmt.Printf("Targets: %d\n", summary.Targets)
+	fmt.Printf("Users: %d\n", summary.Users)
+	fmt.Printf("Schedules: %d\n", summary.Schedules)
+	fmt.Printf("Sessions: %d\n", summary.Sessions)
+	fmt.Printf("Recordings: %d\n", summary.Recordings)
+}
+
+func getEnv(key, defaultValue string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return defaultValue
+}
+
+func getEnvInt(key string, defaultValue int) int {
+	if value := os.Getenv(key); value != "" {
+		var intValue int
+		if _, err := fmt.Sscanf(value, "%d", &intValue); err == nil {
+			return intValue
+		}
+	}
+	return defaultValue
+}
@@ -11,11 +11,14 @@ import (
 	"syscall"
 	"time"
 
+	"github.com/VanCannon/openpam/gateway/internal/auth"
+	"github.com/VanCannon/openpam/gateway/internal/build"
 	"github.com/VanCannon/openpam/gateway/internal/config"
 	"github.com/VanCannon/openpam/gateway/internal/database"
-	"github.com/VanCannon/openpam/gateway/internal/logger"
+	"github.com/VanCannon/openpam/gateway/internal/keys"
 	"github.com/VanCannon/openpam/gateway/internal/server"
 	"github.com/VanCannon/openpam/gateway/internal/vault"
+	"github.com/VanCannon/openpam/pkg/logger"
 )
 
 // filteringWriter filters out harmless WebSocket library log messages
@@ -54,7 +57,7 @@ func run() error {
 	// Initialize logger
 	log := logger.New(logger.LevelInfo, os.Stdout)
 	log.Info("Starting OpenPAM Gateway", map[string]interface{}{
-		"version":   "0.1.0",
+		"version":   build.Version,
 		"zone_type": cfg.Zone.Type,
 		"zone_name": cfg.Zone.Name,
 	})
@@ -78,6 +81,7 @@ func run() error {
 		return fmt.Errorf("failed to connect to database: %w", err)
 	}
 	defer db.Close()
+	db.LogSlowQueries(log, cfg.Database.SlowQuery)
 
 	log.Info("Connected to database", map[string]interface{}{
 		"host": cfg.Database.Host,
@@ -117,8 +121,33 @@ func run() error {
 		log.Info("Started Vault token renewal")
 	}
 
+	// Open the signing keys; HSM and KMS keys are contacted for their public key
+	keyCtx, keyCancel := context.WithTimeout(context.Background(), 30*time.Second)
+	signingKeys, err := keys.Load(keyCtx, cfg.SigningKeys())
+	keyCancel()
+	if err != nil {
+		return fmt.Errorf("failed to load signing keys: %w", err)
+	}
+
+	log.Info("Loaded signing keys", map[string]interface{}{
+		"active":   signingKeys.Active().ID(),
+		"provider": signingKeys.Active().Provider(),
+		"keys":     len(signingKeys.Keys()),
+	})
+
+	// Open the stores logins are kept in; Redis shares them across restarts and replicas
+	stores, err := auth.OpenStores(context.Background(), cfg.SessionStores(), 15*time.Minute)
+	if err != nil {
+		return fmt.Errorf("failed to open session store: %w", err)
+	}
+	defer stores.Close()
+
+	log.Info("Opened session store", map[string]interface{}{
+		"store": cfg.Session.Store,
+	})
+
 	// Create and start server
-	srv := server.New(cfg, db, vaultClient, log)
+	srv := server.New(cfg, db, vaultClient, signingKeys, stores, log)
 
 	// Channel to listen for errors from the server
 	serverErrors := make(chan error, 1)
@@ -0,0 +1,70 @@
+// Package actor carries who a request is made by from the HTTP middleware down
+// to the repositories, so the records they write say who created and last
+// changed them without each handler passing it along.
+package actor
+
+import (
+	"context"
+
+	"github.com/google/uuid"
+)
+
+// Actor is the caller a change is made for
+type Actor struct {
+	UserID    *uuid.UUID // Nil for background jobs and callers without a user
+	Role      string
+	IP        string
+	RequestID string
+
+	// Set for non-admins on routes that enforce zone scoping, see ZoneScope
+	ZoneScoped bool
+	Zones      []uuid.UUID // Zones the user is an admin of
+}
+
+type contextKey struct{}
+
+// WithActor returns a context for changes made by a
+func WithActor(ctx context.Context, a *Actor) context.Context {
+	return context.WithValue(ctx, contextKey{}, a)
+}
+
+// FromContext returns the actor of a request, or nil outside of one
+func FromContext(ctx context.Context) *Actor {
+	a, _ := ctx.Value(contextKey{}).(*Actor)
+	return a
+}
+
+// UserID returns the user a change is made by, for created_by and updated_by
+// columns. It is nil when no user is behind the change.
+func UserID(ctx context.Context) *uuid.UUID {
+	if a := FromContext(ctx); a != nil {
+		return a.UserID
+	}
+	return nil
+}
+
+// ZoneScope returns the zones whose targets, credentials and schedules the
+// actor may change, and false when it may change every zone: for admins, for
+// background jobs, and for requests authorized otherwise, such as by an
+// approval link.
+func ZoneScope(ctx context.Context) ([]uuid.UUID, bool) {
+	a := FromContext(ctx)
+	if a == nil || !a.ZoneScoped {
+		return nil, false
+	}
+	return a.Zones, true
+}
+
+// ManagesZone reports whether the actor may change what is in a zone
+func ManagesZone(ctx context.Context, zoneID uuid.UUID) bool {
+	zones, scoped := ZoneScope(ctx)
+	if !scoped {
+		return true
+	}
+	for _, z := range zones {
+		if z == zoneID {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,89 @@
+package adaccounts
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// TokenSource creates the service tokens the identity service is called with
+type TokenSource interface {
+	GenerateServiceToken() (string, error)
+}
+
+// Account is an AD user in one of the identity service's account reports
+type Account struct {
+	ID                string     `json:"id"`
+	SAMAccountName    string     `json:"sam_account_name"`
+	DisplayName       string     `json:"display_name"`
+	Mail              string     `json:"mail"`
+	PasswordExpiresAt *time.Time `json:"password_expires_at"`
+	LastLogonAt       *time.Time `json:"last_logon_at"`
+	WhenCreated       *time.Time `json:"when_created"`
+}
+
+// IdentityReports reads the account reports of the identity service
+type IdentityReports struct {
+	url    string
+	tokens TokenSource
+	client *http.Client
+}
+
+// NewIdentityReports creates a reader of the reports of the identity service
+// at baseURL
+func NewIdentityReports(baseURL string, tokens TokenSource) *IdentityReports {
+	return &IdentityReports{
+		url:    strings.TrimSuffix(baseURL, "/"),
+		tokens: tokens,
+		client: &http.Client{Timeout: time.Minute},
+	}
+}
+
+// PasswordsExpiring returns the enabled accounts whose password expires
+// within days days
+func (r *IdentityReports) PasswordsExpiring(ctx context.Context, days int) ([]Account, error) {
+	return r.report(ctx, "password-expiry", days)
+}
+
+// StaleAccounts returns the enabled accounts that haven't logged on for days
+// days
+func (r *IdentityReports) StaleAccounts(ctx context.Context, days int) ([]Account, error) {
+	return r.report(ctx, "stale-accounts", days)
+}
+
+func (r *IdentityReports) report(ctx context.Context, name string, days int) ([]Account, error) {
+	token, err := r.tokens.GenerateServiceToken()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create service token: %w", err)
+	}
+
+	query := url.Values{"days": {strconv.Itoa(days)}}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, r.url+"/api/v1/ad-reports/"+name+"?"+query.Encode(), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to call identity service: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("identity service returned %s", resp.Status)
+	}
+
+	var result struct {
+		Users []Account `json:"users"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("failed to decode %s report: %w", name, err)
+	}
+	return result.Users, nil
+}
@@ -0,0 +1,255 @@
+// Package adaccounts alerts on Active Directory accounts that need attention:
+// passwords about to expire, and enabled accounts nobody has logged on to for
+// a long time. The accounts come from the identity service's reports.
+package adaccounts
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/VanCannon/openpam/gateway/internal/models"
+	"github.com/VanCannon/openpam/gateway/internal/notify"
+	"github.com/VanCannon/openpam/gateway/internal/worker"
+	"github.com/VanCannon/openpam/pkg/logger"
+	"github.com/google/uuid"
+)
+
+// Kinds of alert
+const (
+	KindPasswordExpiring = "password_expiring"
+	KindStale            = "stale"
+)
+
+// Source reports the accounts to alert on
+type Source interface {
+	PasswordsExpiring(ctx context.Context, days int) ([]Account, error)
+	StaleAccounts(ctx context.Context, days int) ([]Account, error)
+}
+
+// AlertStore remembers which accounts were alerted on, and about what time
+type AlertStore interface {
+	ListADAccountAlerts(ctx context.Context, kind string) (map[string]time.Time, error)
+	MarkADAccountAlerted(ctx context.Context, kind, adUserID string, since, at time.Time) error
+}
+
+// AuditStore records the alerts in the system audit log
+type AuditStore interface {
+	CreateSimple(ctx context.Context, eventType string, userID *uuid.UUID, action string, status string, ipAddress *string, details map[string]interface{}) error
+}
+
+// Config holds when and to whom account alerts are sent
+type Config struct {
+	Interval           time.Duration // How often the reports are checked
+	PasswordExpiryDays int           // How many days before a password expires it is alerted on
+	StaleDays          int           // How many days without a logon make an account stale
+	AlertRecipients    []string      // Emailed about the accounts; audited only when empty
+}
+
+// Monitor periodically alerts on expiring passwords and stale accounts. Each
+// password expiry is alerted on once, and each account once per stale spell.
+type Monitor struct {
+	source   Source
+	alerts   AlertStore
+	audit    AuditStore
+	notifier notify.Notifier
+	config   Config
+	logger   *logger.Logger
+
+	loop worker.Loop
+}
+
+// NewMonitor creates a new AD account monitor
+func NewMonitor(source Source, alerts AlertStore, audit AuditStore, notifier notify.Notifier, cfg Config, log *logger.Logger) *Monitor {
+	if cfg.Interval <= 0 {
+		cfg.Interval = 6 * time.Hour
+	}
+
+	return &Monitor{
+		source:   source,
+		alerts:   alerts,
+		audit:    audit,
+		notifier: notifier,
+		config:   cfg,
+		logger:   log,
+	}
+}
+
+// Start runs the monitor in the background until Stop is called
+func (m *Monitor) Start() {
+	m.loop.Start(m.run)
+}
+
+// Stop stops the monitor and waits for an in-progress check to finish.
+// It is safe to call even if the monitor was never started.
+func (m *Monitor) Stop() {
+	m.loop.Stop()
+}
+
+func (m *Monitor) run() {
+	ticker := time.NewTicker(m.config.Interval)
+	defer ticker.Stop()
+
+	for {
+		m.Check(time.Now())
+
+		select {
+		case <-m.loop.Stopping():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// alert is an account to alert on, and the time it is about
+type alert struct {
+	kind    string
+	account Account
+	since   time.Time
+}
+
+// Check alerts on the accounts reported that weren't alerted on yet
+func (m *Monitor) Check(now time.Time) {
+	ctx, cancel := context.WithTimeout(context.Background(), m.config.Interval)
+	defer cancel()
+
+	var alerts []alert
+	expiring, err := m.source.PasswordsExpiring(ctx, m.config.PasswordExpiryDays)
+	if err != nil {
+		m.logger.Error("Failed to get expiring AD passwords", map[string]interface{}{
+			"error": err.Error(),
+		})
+	} else {
+		alerts = append(alerts, m.unalerted(ctx, KindPasswordExpiring, expiring)...)
+	}
+	stale, err := m.source.StaleAccounts(ctx, m.config.StaleDays)
+	if err != nil {
+		m.logger.Error("Failed to get stale AD accounts", map[string]interface{}{
+			"error": err.Error(),
+		})
+	} else {
+		alerts = append(alerts, m.unalerted(ctx, KindStale, stale)...)
+	}
+	if len(alerts) == 0 {
+		return
+	}
+
+	var expiringLines, staleLines []string
+	for _, a := range alerts {
+		details := map[string]interface{}{
+			"ad_user_id":       a.account.ID,
+			"sam_account_name": a.account.SAMAccountName,
+			"display_name":     a.account.DisplayName,
+		}
+
+		eventType, action := models.EventTypeADPasswordExpiring, "expiry_alert"
+		if a.kind == KindStale {
+			eventType, action = models.EventTypeADAccountStale, "stale_alert"
+			details["last_logon_at"] = a.account.LastLogonAt
+			days := int(now.Sub(a.since).Hours() / 24)
+			details["inactive_days"] = days
+			staleLines = append(staleLines, fmt.Sprintf("  %s: %s", accountName(a.account), inactivity(a.account, days)))
+		} else {
+			details["password_expires_at"] = a.since
+			expiringLines = append(expiringLines, fmt.Sprintf("  %s: expires %s", accountName(a.account), a.since.UTC().Format(time.RFC3339)))
+		}
+
+		m.logger.Warn("AD account needs attention", map[string]interface{}{
+			"kind":       a.kind,
+			"ad_user_id": a.account.ID,
+			"username":   a.account.SAMAccountName,
+		})
+		if err := m.audit.CreateSimple(ctx, eventType, nil, action, models.AuditStatusSuccess, nil, details); err != nil {
+			m.logger.Error("Failed to create system audit log", map[string]interface{}{
+				"error": err.Error(),
+			})
+		}
+	}
+
+	if len(m.config.AlertRecipients) > 0 {
+		var sections []string
+		if len(expiringLines) > 0 {
+			sections = append(sections, fmt.Sprintf("These passwords expire within %d days:\n\n%s", m.config.PasswordExpiryDays, strings.Join(expiringLines, "\n")))
+		}
+		if len(staleLines) > 0 {
+			sections = append(sections, fmt.Sprintf("These enabled accounts haven't been logged on to for %d days or more:\n\n%s\n\n"+
+				"Disable the accounts that are no longer needed.", m.config.StaleDays, strings.Join(staleLines, "\n")))
+		}
+
+		msg := &notify.Message{
+			To:      m.config.AlertRecipients,
+			Subject: fmt.Sprintf("OpenPAM: %d Active Directory account(s) need attention", len(alerts)),
+			Body:    strings.Join(sections, "\n\n"),
+		}
+		if err := m.notifier.Send(ctx, msg); err != nil {
+			m.logger.Error("Failed to send AD account alert", map[string]interface{}{
+				"error": err.Error(),
+			})
+		}
+	}
+
+	for _, a := range alerts {
+		if err := m.alerts.MarkADAccountAlerted(ctx, a.kind, a.account.ID, a.since, now); err != nil {
+			m.logger.Error("Failed to mark AD account alerted", map[string]interface{}{
+				"ad_user_id": a.account.ID,
+				"error":      err.Error(),
+			})
+		}
+	}
+}
+
+// unalerted returns the accounts not yet alerted on about the time they are
+// reported for
+func (m *Monitor) unalerted(ctx context.Context, kind string, accounts []Account) []alert {
+	if len(accounts) == 0 {
+		return nil
+	}
+
+	alerted, err := m.alerts.ListADAccountAlerts(ctx, kind)
+	if err != nil {
+		m.logger.Error("Failed to list AD account alerts", map[string]interface{}{
+			"error": err.Error(),
+		})
+		return nil
+	}
+
+	var alerts []alert
+	for _, account := range accounts {
+		since := alertTime(kind, account)
+		if since == nil {
+			continue
+		}
+		if last, ok := alerted[account.ID]; ok && last.Equal(*since) {
+			continue
+		}
+		alerts = append(alerts, alert{kind: kind, account: account, since: *since})
+	}
+	return alerts
+}
+
+// alertTime returns the time an alert of kind on account is about: when its
+// password expires, or when it was last logged on to or else created
+func alertTime(kind string, account Account) *time.Time {
+	if kind == KindPasswordExpiring {
+		return account.PasswordExpiresAt
+	}
+	if account.LastLogonAt != nil {
+		return account.LastLogonAt
+	}
+	return account.WhenCreated
+}
+
+func accountName(account Account) string {
+	if account.DisplayName == "" {
+		return account.SAMAccountName
+	}
+	return fmt.Sprintf("%s (%s)", account.SAMAccountName, account.DisplayName)
+}
+
+func inactivity(account Account, days int) string {
+	if account.LastLogonAt == nil {
+		return fmt.Sprintf("never logged on, created %d days ago", days)
+	}
+	return fmt.Sprintf("last logon %d days ago", days)
+}
@@ -0,0 +1,146 @@
+package adaccounts
+
+import (
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/VanCannon/openpam/gateway/internal/models"
+	"github.com/VanCannon/openpam/gateway/internal/notify"
+	"github.com/VanCannon/openpam/pkg/logger"
+	"github.com/google/uuid"
+)
+
+type fakeSource struct {
+	expiring, stale []Account
+	err             error
+	days            []int
+}
+
+func (s *fakeSource) PasswordsExpiring(ctx context.Context, days int) ([]Account, error) {
+	s.days = append(s.days, days)
+	return s.expiring, s.err
+}
+
+func (s *fakeSource) StaleAccounts(ctx context.Context, days int) ([]Account, error) {
+	s.days = append(s.days, days)
+	return s.stale, nil
+}
+
+type fakeAlerts struct {
+	alerted map[string]time.Time
+}
+
+func (a *fakeAlerts) ListADAccountAlerts(ctx context.Context, kind string) (map[string]time.Time, error) {
+	alerts := map[string]time.Time{}
+	for key, since := range a.alerted {
+		if k, id, _ := strings.Cut(key, "/"); k == kind {
+			alerts[id] = since
+		}
+	}
+	return alerts, nil
+}
+
+func (a *fakeAlerts) MarkADAccountAlerted(ctx context.Context, kind, adUserID string, since, at time.Time) error {
+	a.alerted[kind+"/"+adUserID] = since
+	return nil
+}
+
+type fakeAudit struct{ events []string }
+
+func (a *fakeAudit) CreateSimple(ctx context.Context, eventType string, userID *uuid.UUID, action string, status string, ipAddress *string, details map[string]interface{}) error {
+	a.events = append(a.events, eventType)
+	return nil
+}
+
+type fakeNotifier struct{ sent []*notify.Message }
+
+func (n *fakeNotifier) Send(ctx context.Context, msg *notify.Message) error {
+	n.sent = append(n.sent, msg)
+	return nil
+}
+
+func TestMonitor_Check(t *testing.T) {
+	now := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	expires := now.AddDate(0, 0, 5)
+	lastLogon := now.AddDate(0, 0, -120)
+	created := now.AddDate(0, 0, -200)
+
+	source := &fakeSource{
+		expiring: []Account{{ID: "alice", SAMAccountName: "alice", DisplayName: "Alice", PasswordExpiresAt: &expires}},
+		stale: []Account{
+			{ID: "bob", SAMAccountName: "bob", LastLogonAt: &lastLogon, WhenCreated: &created},
+			{ID: "svc", SAMAccountName: "svc-old", WhenCreated: &created},
+		},
+	}
+	alerts := &fakeAlerts{alerted: map[string]time.Time{}}
+	audit := &fakeAudit{}
+	notifier := &fakeNotifier{}
+	monitor := NewMonitor(source, alerts, audit, notifier, Config{
+		PasswordExpiryDays: 14,
+		StaleDays:          90,
+		AlertRecipients:    []string{"ad@example.com"},
+	}, logger.New(logger.LevelError, io.Discard))
+
+	monitor.Check(now)
+
+	if len(source.days) != 2 || source.days[0] != 14 || source.days[1] != 90 {
+		t.Errorf("reports asked for %v days, want 14 and 90", source.days)
+	}
+	if len(audit.events) != 3 || audit.events[0] != models.EventTypeADPasswordExpiring || audit.events[2] != models.EventTypeADAccountStale {
+		t.Errorf("audit events = %v", audit.events)
+	}
+	if len(notifier.sent) != 1 {
+		t.Fatalf("sent %d messages, want 1", len(notifier.sent))
+	}
+	body := notifier.sent[0].Body
+	for _, want := range []string{"alice (Alice): expires 2024-06-06", "bob: last logon 120 days ago", "svc-old: never logged on, created 200 days ago"} {
+		if !strings.Contains(body, want) {
+			t.Errorf("body lacks %q:\n%s", want, body)
+		}
+	}
+	if !alerts.alerted["stale/svc"].Equal(created) {
+		t.Errorf("svc alerted about %v, want its creation", alerts.alerted["stale/svc"])
+	}
+
+	// Nothing new is alerted on again
+	monitor.Check(now.Add(time.Hour))
+	if len(notifier.sent) != 1 || len(audit.events) != 3 {
+		t.Errorf("realerted: %d messages, %d events", len(notifier.sent), len(audit.events))
+	}
+
+	// A new expiry after the password changed is
+	renewed := expires.AddDate(0, 0, 90)
+	source.expiring[0].PasswordExpiresAt = &renewed
+	monitor.Check(renewed.AddDate(0, 0, -3))
+	if len(notifier.sent) != 2 || len(audit.events) != 4 {
+		t.Errorf("new expiry: %d messages, %d events", len(notifier.sent), len(audit.events))
+	}
+}
+
+func TestMonitor_CheckSourceFailure(t *testing.T) {
+	lastLogon := time.Now().AddDate(-1, 0, 0)
+	source := &fakeSource{
+		err:   errors.New("identity service unavailable"),
+		stale: []Account{{ID: "bob", SAMAccountName: "bob", LastLogonAt: &lastLogon}},
+	}
+	audit := &fakeAudit{}
+	notifier := &fakeNotifier{}
+	monitor := NewMonitor(source, &fakeAlerts{alerted: map[string]time.Time{}}, audit, notifier, Config{
+		PasswordExpiryDays: 14,
+		StaleDays:          90,
+	}, logger.New(logger.LevelError, io.Discard))
+
+	monitor.Check(time.Now())
+
+	// The stale report still counts, and nobody is emailed without recipients
+	if len(audit.events) != 1 || audit.events[0] != models.EventTypeADAccountStale {
+		t.Errorf("audit events = %v", audit.events)
+	}
+	if len(notifier.sent) != 0 {
+		t.Errorf("sent %d messages without recipients", len(notifier.sent))
+	}
+}
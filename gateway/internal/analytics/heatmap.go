@@ -0,0 +1,157 @@
+package analytics
+
+import (
+	"strings"
+	"time"
+
+	"github.com/VanCannon/openpam/gateway/internal/i18n"
+	"github.com/VanCannon/openpam/gateway/internal/models"
+)
+
+// WorkingHours are the hours of the working week in the viewer's time zone
+type WorkingHours struct {
+	Start int // First working hour, 0-23
+	End   int // Hour work ends, 1-24
+	Days  []time.Weekday
+}
+
+// DefaultWorkingHours are 09:00 to 17:00, Monday to Friday
+var DefaultWorkingHours = WorkingHours{
+	Start: 9,
+	End:   17,
+	Days:  []time.Weekday{time.Monday, time.Tuesday, time.Wednesday, time.Thursday, time.Friday},
+}
+
+// contains reports whether the hour starting at hour on day is a working hour
+func (w WorkingHours) contains(day time.Weekday, hour int) bool {
+	if hour < w.Start || hour >= w.End {
+		return false
+	}
+	for _, d := range w.Days {
+		if d == day {
+			return true
+		}
+	}
+	return false
+}
+
+// firstWeekday maps the locales whose week doesn't start on Monday to the day
+// it starts on
+var firstWeekday = map[string]time.Weekday{
+	"en": time.Sunday,
+}
+
+// FirstWeekday returns the day the week starts on in locale
+func FirstWeekday(locale string) time.Weekday {
+	if day, ok := firstWeekday[locale]; ok {
+		return day
+	}
+	return time.Monday
+}
+
+// weekdayName is the name of day in the API and the catalog, such as "monday"
+func weekdayName(day time.Weekday) string {
+	return strings.ToLower(day.String())
+}
+
+// Cell is the session use of an hour of the week
+type Cell struct {
+	Sessions int   `json:"sessions"`
+	Seconds  int64 `json:"seconds"`
+}
+
+// Day is the session use of each hour of a day of the week
+type Day struct {
+	Weekday string   `json:"weekday"` // monday to sunday
+	Label   string   `json:"label"`   // The day's name in the viewer's language
+	Hours   [24]Cell `json:"hours"`
+}
+
+// Peak is the hour of the week with the most session time
+type Peak struct {
+	Weekday string `json:"weekday"`
+	Label   string `json:"label"`
+	Hour    int    `json:"hour"`
+	Seconds int64  `json:"seconds"`
+}
+
+// Heatmap is session use by hour of the week
+type Heatmap struct {
+	TimeZone          string  `json:"time_zone"`
+	Days              []Day   `json:"days"` // Seven, from the first day of the viewer's week
+	Sessions          int     `json:"sessions"`
+	Seconds           int64   `json:"seconds"`
+	AfterHoursSeconds int64   `json:"after_hours_seconds"` // Session time outside working hours
+	AfterHoursShare   float64 `json:"after_hours_share"`
+	Peak              *Peak   `json:"peak,omitempty"`
+}
+
+// NewHeatmap lays out the use of UTC hours over the hours of the week in loc,
+// with its days in the order and language of locale. In time zones whose
+// offset isn't whole hours, each UTC hour counts in the local hour it starts
+// in.
+func NewHeatmap(hours []models.UsageHour, loc *time.Location, locale string, working WorkingHours) *Heatmap {
+	var grid [7][24]Cell
+	m := &Heatmap{TimeZone: loc.String()}
+
+	for _, h := range hours {
+		local := h.Hour.In(loc)
+		cell := &grid[local.Weekday()][local.Hour()]
+		cell.Sessions += h.Sessions
+		cell.Seconds += h.Seconds
+
+		m.Sessions += h.Sessions
+		m.Seconds += h.Seconds
+		if !working.contains(local.Weekday(), local.Hour()) {
+			m.AfterHoursSeconds += h.Seconds
+		}
+	}
+	if m.Seconds > 0 {
+		m.AfterHoursShare = float64(m.AfterHoursSeconds) / float64(m.Seconds)
+	}
+
+	first := FirstWeekday(locale)
+	for i := 0; i < 7; i++ {
+		day := (first + time.Weekday(i)) % 7
+		name := weekdayName(day)
+		label := i18n.Text(locale, "weekday."+name)
+		m.Days = append(m.Days, Day{Weekday: name, Label: label, Hours: grid[day]})
+
+		for hour, cell := range grid[day] {
+			if cell.Seconds > 0 && (m.Peak == nil || cell.Seconds > m.Peak.Seconds) {
+				m.Peak = &Peak{Weekday: name, Label: label, Hour: hour, Seconds: cell.Seconds}
+			}
+		}
+	}
+
+	return m
+}
+
+// Team is how a group's members use targets, and when
+type Team struct {
+	models.GroupUsage
+	AfterHoursSeconds int64   `json:"after_hours_seconds"`
+	AfterHoursShare   float64 `json:"after_hours_share"`
+	Peak              *Peak   `json:"peak,omitempty"`
+}
+
+// Teams adds to the use of each group when its members use targets, from the
+// groups' use of UTC hours
+func Teams(groups []models.GroupUsage, hours []models.GroupUsageHour, loc *time.Location, locale string, working WorkingHours) []Team {
+	byGroup := make(map[string][]models.UsageHour)
+	for _, h := range hours {
+		byGroup[h.GroupID] = append(byGroup[h.GroupID], h.UsageHour)
+	}
+
+	teams := make([]Team, 0, len(groups))
+	for _, g := range groups {
+		m := NewHeatmap(byGroup[g.GroupID], loc, locale, working)
+		teams = append(teams, Team{
+			GroupUsage:        g,
+			AfterHoursSeconds: m.AfterHoursSeconds,
+			AfterHoursShare:   m.AfterHoursShare,
+			Peak:              m.Peak,
+		})
+	}
+	return teams
+}
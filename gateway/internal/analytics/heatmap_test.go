@@ -0,0 +1,135 @@
+package analytics
+
+import (
+	"testing"
+	"time"
+
+	"github.com/VanCannon/openpam/gateway/internal/models"
+)
+
+func mustLoad(t *testing.T, name string) *time.Location {
+	t.Helper()
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		t.Skipf("time zone %s unavailable: %v", name, err)
+	}
+	return loc
+}
+
+func TestNewHeatmap(t *testing.T) {
+	berlin := mustLoad(t, "Europe/Berlin")
+	hours := []models.UsageHour{
+		// Monday 09:00 in Berlin
+		{Hour: time.Date(2026, 3, 2, 8, 0, 0, 0, time.UTC), Sessions: 2, Seconds: 3600},
+		// Sunday 23:00 in Berlin
+		{Hour: time.Date(2026, 3, 1, 22, 0, 0, 0, time.UTC), Sessions: 1, Seconds: 1800},
+		// The next Monday 09:00 adds to the same cell
+		{Hour: time.Date(2026, 3, 9, 8, 0, 0, 0, time.UTC), Sessions: 0, Seconds: 600},
+	}
+
+	m := NewHeatmap(hours, berlin, "de", DefaultWorkingHours)
+
+	if m.TimeZone != "Europe/Berlin" || len(m.Days) != 7 {
+		t.Fatalf("heatmap = %s with %d days", m.TimeZone, len(m.Days))
+	}
+	if m.Days[0].Weekday != "monday" || m.Days[0].Label != "Montag" || m.Days[6].Weekday != "sunday" {
+		t.Errorf("days = %s (%s) to %s, want Monday to Sunday in German", m.Days[0].Weekday, m.Days[0].Label, m.Days[6].Weekday)
+	}
+	if cell := m.Days[0].Hours[9]; cell.Sessions != 2 || cell.Seconds != 4200 {
+		t.Errorf("Monday 09:00 = %+v, want 2 sessions and 4200s", cell)
+	}
+	if cell := m.Days[6].Hours[23]; cell.Sessions != 1 || cell.Seconds != 1800 {
+		t.Errorf("Sunday 23:00 = %+v, want 1 session and 1800s", cell)
+	}
+	if m.Sessions != 3 || m.Seconds != 6000 || m.AfterHoursSeconds != 1800 {
+		t.Errorf("totals = %d sessions, %ds, %ds after hours", m.Sessions, m.Seconds, m.AfterHoursSeconds)
+	}
+	if m.AfterHoursShare != 0.3 {
+		t.Errorf("after-hours share = %v, want 0.3", m.AfterHoursShare)
+	}
+	if m.Peak == nil || m.Peak.Weekday != "monday" || m.Peak.Hour != 9 || m.Peak.Label != "Montag" {
+		t.Errorf("peak = %+v, want Monday 09:00", m.Peak)
+	}
+}
+
+func TestNewHeatmap_Locale(t *testing.T) {
+	m := NewHeatmap(nil, time.UTC, "en", DefaultWorkingHours)
+
+	if m.Days[0].Weekday != "sunday" || m.Days[0].Label != "Sunday" || m.Days[1].Weekday != "monday" {
+		t.Errorf("English week starts with %s, want Sunday", m.Days[0].Weekday)
+	}
+	if m.Peak != nil || m.AfterHoursShare != 0 {
+		t.Errorf("empty heatmap has peak %+v and after-hours share %v", m.Peak, m.AfterHoursShare)
+	}
+}
+
+func TestNewHeatmap_HalfHourOffset(t *testing.T) {
+	kolkata := mustLoad(t, "Asia/Kolkata")
+	hours := []models.UsageHour{
+		// 08:30 to 09:30 on Monday in India counts at 08:00, before work
+		{Hour: time.Date(2026, 3, 2, 3, 0, 0, 0, time.UTC), Sessions: 1, Seconds: 3600},
+	}
+
+	m := NewHeatmap(hours, kolkata, "fr", DefaultWorkingHours)
+
+	if m.Days[0].Label != "Lundi" || m.Days[0].Hours[8].Seconds != 3600 {
+		t.Errorf("Monday = %s with %+v at 08:00", m.Days[0].Label, m.Days[0].Hours[8])
+	}
+	if m.AfterHoursSeconds != 3600 {
+		t.Errorf("after-hours seconds = %d, want 3600", m.AfterHoursSeconds)
+	}
+}
+
+func TestTeams(t *testing.T) {
+	groups := []models.GroupUsage{
+		{GroupID: "ops", GroupName: "Operations", Members: 3, Users: 2, Sessions: 2, Seconds: 7200},
+		{GroupID: "dba", GroupName: "Databases", Members: 1},
+	}
+	hours := []models.GroupUsageHour{
+		// Saturday 10:00
+		{GroupID: "ops", UsageHour: models.UsageHour{Hour: time.Date(2026, 3, 7, 10, 0, 0, 0, time.UTC), Sessions: 1, Seconds: 3600}},
+		// Tuesday 14:00
+		{GroupID: "ops", UsageHour: models.UsageHour{Hour: time.Date(2026, 3, 3, 14, 0, 0, 0, time.UTC), Sessions: 1, Seconds: 3600}},
+	}
+	working := WorkingHours{Start: 8, End: 18, Days: DefaultWorkingHours.Days}
+
+	teams := Teams(groups, hours, time.UTC, "es", working)
+
+	if len(teams) != 2 || teams[0].GroupName != "Operations" || teams[0].Members != 3 {
+		t.Fatalf("teams = %+v", teams)
+	}
+	if teams[0].AfterHoursSeconds != 3600 || teams[0].AfterHoursShare != 0.5 {
+		t.Errorf("ops after hours = %ds (%v), want the Saturday hour", teams[0].AfterHoursSeconds, teams[0].AfterHoursShare)
+	}
+	// Ties go to the earliest hour of the week
+	if p := teams[0].Peak; p == nil || p.Weekday != "tuesday" || p.Label != "Martes" || p.Hour != 14 {
+		t.Errorf("ops peak = %+v, want Tuesday 14:00", p)
+	}
+	if teams[1].Peak != nil || teams[1].AfterHoursShare != 0 {
+		t.Errorf("idle team = %+v", teams[1])
+	}
+}
+
+func TestSumTurnaround(t *testing.T) {
+	zones := []models.ApprovalTurnaround{
+		{ZoneName: "eu", Approved: 3, Rejected: 1, AverageSeconds: 600, MaxSeconds: 1200, Within15m: 4, Within1h: 4, Within4h: 4, Within1d: 4},
+		{ZoneName: "us", Approved: 1, AverageSeconds: 7200, MaxSeconds: 7200, Within4h: 1, Within1d: 1},
+	}
+
+	total := SumTurnaround(zones)
+
+	if total.Decided != 5 || total.Approved != 4 || total.Rejected != 1 {
+		t.Errorf("decisions = %+v", total)
+	}
+	if total.AverageSeconds != 1920 || total.MaxSeconds != 7200 {
+		t.Errorf("average = %ds, max = %ds, want 1920s and 7200s", total.AverageSeconds, total.MaxSeconds)
+	}
+	if total.Within["15m"] != 0.8 || total.Within["4h"] != 1 {
+		t.Errorf("within = %v", total.Within)
+	}
+
+	empty := SumTurnaround(nil)
+	if empty.Decided != 0 || empty.AverageSeconds != 0 || empty.Within["1d"] != 0 {
+		t.Errorf("no decisions = %+v", empty)
+	}
+}
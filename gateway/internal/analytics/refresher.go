@@ -0,0 +1,101 @@
+// Package analytics reports how privileged access is used: when targets are
+// in use over the hours of the week, how teams use them, and how long access
+// requests wait for a decision. Reports read materialized views that
+// aggregate the audit logs and schedules per hour and day; a Refresher brings
+// them up to date periodically, so dashboards never scan the raw tables.
+// Heatmaps are laid out in the viewer's time zone and week, with day names
+// in their language.
+package analytics
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/VanCannon/openpam/gateway/internal/models"
+	"github.com/VanCannon/openpam/gateway/internal/worker"
+	"github.com/VanCannon/openpam/pkg/logger"
+)
+
+// ErrRefreshing is returned when another replica is refreshing the views
+var ErrRefreshing = errors.New("analytics are being refreshed by another gateway")
+
+// Store refreshes the analytics views
+type Store interface {
+	Refresh(ctx context.Context) ([]models.AnalyticsRefresh, error)
+}
+
+// Refresher periodically refreshes the analytics views. With several
+// replicas, one refreshes them at a time.
+type Refresher struct {
+	store    Store
+	interval time.Duration
+	logger   *logger.Logger
+
+	loop worker.Loop
+}
+
+// NewRefresher creates a refresher that refreshes the views every interval
+func NewRefresher(store Store, interval time.Duration, log *logger.Logger) *Refresher {
+	if interval <= 0 {
+		interval = 15 * time.Minute
+	}
+
+	return &Refresher{
+		store:    store,
+		interval: interval,
+		logger:   log,
+	}
+}
+
+// Start runs the refresher in the background until Stop is called
+func (r *Refresher) Start() {
+	r.loop.Start(r.run)
+}
+
+// Stop stops the refresher and waits for an in-progress refresh to finish.
+// It is safe to call even if the refresher was never started.
+func (r *Refresher) Stop() {
+	r.loop.Stop()
+}
+
+func (r *Refresher) run() {
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+
+	for {
+		ctx, cancel := context.WithTimeout(context.Background(), r.interval)
+		if _, err := r.Refresh(ctx); err != nil && !errors.Is(err, ErrRefreshing) {
+			r.logger.Error("Failed to refresh analytics", map[string]interface{}{
+				"error": err.Error(),
+			})
+		}
+		cancel()
+
+		select {
+		case <-r.loop.Stopping():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Refresh refreshes the views now and returns how long each took. It returns
+// ErrRefreshing if another replica is at it.
+func (r *Refresher) Refresh(ctx context.Context) ([]models.AnalyticsRefresh, error) {
+	refreshes, err := r.store.Refresh(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if refreshes == nil {
+		return nil, ErrRefreshing
+	}
+
+	for _, refresh := range refreshes {
+		r.logger.Debug("Analytics view refreshed", map[string]interface{}{
+			"view":        refresh.View,
+			"duration_ms": refresh.DurationMS,
+		})
+	}
+	return refreshes, nil
+}
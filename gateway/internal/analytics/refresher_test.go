@@ -0,0 +1,56 @@
+package analytics
+
+import (
+	"context"
+	"errors"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/VanCannon/openpam/gateway/internal/models"
+	"github.com/VanCannon/openpam/pkg/logger"
+)
+
+type fakeStore struct {
+	refreshes []models.AnalyticsRefresh
+	err       error
+	calls     int
+}
+
+func (s *fakeStore) Refresh(ctx context.Context) ([]models.AnalyticsRefresh, error) {
+	s.calls++
+	return s.refreshes, s.err
+}
+
+func TestRefresh(t *testing.T) {
+	log := logger.New(logger.LevelError, io.Discard)
+
+	done := &fakeStore{refreshes: []models.AnalyticsRefresh{{View: models.AnalyticsViewSessionHours, RefreshedAt: time.Now()}}}
+	refreshes, err := NewRefresher(done, time.Minute, log).Refresh(context.Background())
+	if err != nil || len(refreshes) != 1 {
+		t.Errorf("Refresh() = %v, %v", refreshes, err)
+	}
+
+	// Another replica holds the lock
+	if _, err := NewRefresher(&fakeStore{}, time.Minute, log).Refresh(context.Background()); !errors.Is(err, ErrRefreshing) {
+		t.Errorf("Refresh() error = %v, want ErrRefreshing", err)
+	}
+
+	failing := &fakeStore{err: errors.New("database unavailable")}
+	if _, err := NewRefresher(failing, time.Minute, log).Refresh(context.Background()); err == nil || errors.Is(err, ErrRefreshing) {
+		t.Errorf("Refresh() error = %v, want the store's", err)
+	}
+}
+
+func TestRefresher_StartStop(t *testing.T) {
+	store := &fakeStore{}
+	r := NewRefresher(store, time.Hour, logger.New(logger.LevelError, io.Discard))
+
+	r.Start()
+	r.Stop()
+	r.Stop()
+
+	if store.calls != 1 {
+		t.Errorf("refreshed %d times, want once on start", store.calls)
+	}
+}
@@ -0,0 +1,49 @@
+package analytics
+
+import "github.com/VanCannon/openpam/gateway/internal/models"
+
+// Turnaround is how long decisions on access requests took across zones
+type Turnaround struct {
+	Decided        int   `json:"decided"`
+	Approved       int   `json:"approved"`
+	Rejected       int   `json:"rejected"`
+	AverageSeconds int64 `json:"average_seconds"`
+	MaxSeconds     int64 `json:"max_seconds"`
+
+	// Share of the decisions made within 15m, 1h, 4h and 1d of the request
+	Within map[string]float64 `json:"within"`
+}
+
+// SumTurnaround adds up the turnaround of zones
+func SumTurnaround(zones []models.ApprovalTurnaround) Turnaround {
+	var t Turnaround
+	var total int64
+	within := map[string]int{}
+
+	for _, z := range zones {
+		decided := z.Approved + z.Rejected
+		t.Decided += decided
+		t.Approved += z.Approved
+		t.Rejected += z.Rejected
+		total += z.AverageSeconds * int64(decided)
+		if z.MaxSeconds > t.MaxSeconds {
+			t.MaxSeconds = z.MaxSeconds
+		}
+		within["15m"] += z.Within15m
+		within["1h"] += z.Within1h
+		within["4h"] += z.Within4h
+		within["1d"] += z.Within1d
+	}
+
+	t.Within = make(map[string]float64, len(within))
+	for bucket, n := range within {
+		t.Within[bucket] = 0
+		if t.Decided > 0 {
+			t.Within[bucket] = float64(n) / float64(t.Decided)
+		}
+	}
+	if t.Decided > 0 {
+		t.AverageSeconds = total / int64(t.Decided)
+	}
+	return t
+}
@@ -0,0 +1,193 @@
+// Package approval sends approvers single-use links for deciding schedule
+// requests from their email or chat, without signing in first.
+package approval
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/VanCannon/openpam/gateway/internal/auth"
+	"github.com/VanCannon/openpam/gateway/internal/models"
+	"github.com/VanCannon/openpam/gateway/internal/notify"
+	"github.com/VanCannon/openpam/pkg/logger"
+	"github.com/google/uuid"
+)
+
+// ActionStore stores approval actions
+type ActionStore interface {
+	Create(ctx context.Context, action *models.ApprovalAction) error
+}
+
+// UserLookup finds the requester and the approvers of a schedule
+type UserLookup interface {
+	GetByID(ctx context.Context, id uuid.UUID) (*models.User, error)
+	ListEnabledByRole(ctx context.Context, role string) ([]*models.User, error)
+}
+
+// TargetLookup finds the target a schedule grants access to
+type TargetLookup interface {
+	GetByID(ctx context.Context, id uuid.UUID) (*models.Target, error)
+}
+
+// Notifier sends each approver a message per channel, each with its own link,
+// so the decision is attributed to the approver and channel it came through
+type Notifier struct {
+	actions     ActionStore
+	users       UserLookup
+	targets     TargetLookup
+	tokens      *auth.ApprovalTokens
+	channels    map[string]notify.Notifier
+	frontendURL string
+	ttl         time.Duration
+	logger      *logger.Logger
+}
+
+// NewNotifier creates an approval notifier. channels maps channel names, such
+// as models.ApprovalChannelEmail, to the notifier that delivers them; links
+// point to the approval page of the frontend and are valid for ttl.
+func NewNotifier(actions ActionStore, users UserLookup, targets TargetLookup, tokens *auth.ApprovalTokens, channels map[string]notify.Notifier, frontendURL string, ttl time.Duration, log *logger.Logger) *Notifier {
+	return &Notifier{
+		actions:     actions,
+		users:       users,
+		targets:     targets,
+		tokens:      tokens,
+		channels:    channels,
+		frontendURL: strings.TrimRight(frontendURL, "/"),
+		ttl:         ttl,
+		logger:      log,
+	}
+}
+
+// LinkURL returns the frontend page a token opens
+func (n *Notifier) LinkURL(token string) string {
+	return n.frontendURL + "/approvals/" + token
+}
+
+// NotifyApprovers sends approval links for a pending schedule to every admin
+// other than the requester. Channels that aren't configured are skipped.
+func (n *Notifier) NotifyApprovers(ctx context.Context, schedule *models.Schedule) error {
+	if len(n.channels) == 0 {
+		return nil
+	}
+
+	approvers, err := n.users.ListEnabledByRole(ctx, models.RoleAdmin)
+	if err != nil {
+		return err
+	}
+
+	requester := schedule.UserID.String()
+	if user, err := n.users.GetByID(ctx, schedule.UserID); err == nil {
+		requester = user.Email
+	}
+	target := schedule.TargetID.String()
+	if t, err := n.targets.GetByID(ctx, schedule.TargetID); err == nil {
+		target = fmt.Sprintf("%s (%s)", t.Name, t.Hostname)
+	}
+
+	var errs []error
+	for _, approver := range approvers {
+		// Requesters don't approve their own access
+		if approver.ID == schedule.UserID {
+			continue
+		}
+
+		for channel, notifier := range n.channels {
+			err := n.send(ctx, schedule, approver, channel, notifier, requester, target)
+			if errors.Is(err, notify.ErrNotConfigured) {
+				continue
+			}
+			if err != nil {
+				errs = append(errs, fmt.Errorf("%s via %s: %w", approver.Email, channel, err))
+			}
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// send creates an approval action for one approver and channel and delivers its link
+func (n *Notifier) send(ctx context.Context, schedule *models.Schedule, approver *models.User, channel string, notifier notify.Notifier, requester, target string) error {
+	action := &models.ApprovalAction{
+		ScheduleID: schedule.ID,
+		ApproverID: approver.ID,
+		Channel:    channel,
+		ExpiresAt:  time.Now().Add(n.ttl),
+	}
+	if err := n.actions.Create(ctx, action); err != nil {
+		return err
+	}
+
+	link := n.LinkURL(n.tokens.Sign(action.ID, action.ExpiresAt))
+	msg := &notify.Message{
+		To:      []string{approver.Email},
+		Subject: fmt.Sprintf("Access request from %s", requester),
+		Body: fmt.Sprintf("%s requests access to %s.\n\nFrom: %s\nUntil: %s\n%s\n"+
+			"The links below open the request for you to confirm. They can be used once and expire %s.\n",
+			requester, target,
+			schedule.StartTime.UTC().Format(time.RFC1123), schedule.EndTime.UTC().Format(time.RFC1123),
+			purposeLines(schedule), action.ExpiresAt.UTC().Format(time.RFC1123)),
+		Actions: []notify.Action{
+			{Label: "Approve", URL: link + "?action=approve", Style: "primary"},
+			{Label: "Reject", URL: link + "?action=reject", Style: "danger"},
+		},
+	}
+
+	return notifier.Send(ctx, msg)
+}
+
+// purposeLines describes the purpose the requester gave, or is empty
+func purposeLines(schedule *models.Schedule) string {
+	purpose, reason := schedule.Purpose()
+	if purpose == "" {
+		return ""
+	}
+	lines := "Purpose: " + purpose + "\n"
+	if reason != "" {
+		lines += "Reason: " + reason + "\n"
+	}
+	return lines
+}
+
+// NotifyWindowChanged tells the requester of a schedule that it was approved
+// for a different window than they asked for. Channels that aren't configured
+// are skipped.
+func (n *Notifier) NotifyWindowChanged(ctx context.Context, schedule *models.Schedule, requestedStart, requestedEnd time.Time) error {
+	if len(n.channels) == 0 {
+		return nil
+	}
+
+	requester, err := n.users.GetByID(ctx, schedule.UserID)
+	if err != nil {
+		return err
+	}
+	target := schedule.TargetID.String()
+	if t, err := n.targets.GetByID(ctx, schedule.TargetID); err == nil {
+		target = fmt.Sprintf("%s (%s)", t.Name, t.Hostname)
+	}
+
+	msg := &notify.Message{
+		To:      []string{requester.Email},
+		Subject: fmt.Sprintf("Access to %s approved for a different time", target),
+		Body: fmt.Sprintf("Your request for access to %s was approved, but for a different time than you asked for.\n\n"+
+			"Approved: %s to %s\nRequested: %s to %s\n",
+			target,
+			schedule.StartTime.UTC().Format(time.RFC1123), schedule.EndTime.UTC().Format(time.RFC1123),
+			requestedStart.UTC().Format(time.RFC1123), requestedEnd.UTC().Format(time.RFC1123)),
+	}
+
+	var errs []error
+	for channel, notifier := range n.channels {
+		err := notifier.Send(ctx, msg)
+		if errors.Is(err, notify.ErrNotConfigured) {
+			continue
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s via %s: %w", requester.Email, channel, err))
+		}
+	}
+
+	return errors.Join(errs...)
+}
@@ -0,0 +1,154 @@
+// Package auditpartition maintains the monthly partitions of the session and
+// system audit logs. Months are created ahead of time so inserts never land in
+// the default partition, and with a retention set, months past it are dropped
+// whole instead of being deleted row by row.
+package auditpartition
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"github.com/VanCannon/openpam/gateway/internal/models"
+	"github.com/VanCannon/openpam/gateway/internal/worker"
+	"github.com/VanCannon/openpam/pkg/logger"
+	"github.com/google/uuid"
+)
+
+// Store is the subset of the partition repository the manager needs
+type Store interface {
+	Maintain(ctx context.Context, table string, now, through, dropBefore time.Time) (*models.PartitionChanges, error)
+}
+
+// AuditStore records dropped months in the system audit log
+type AuditStore interface {
+	CreateSimple(ctx context.Context, eventType string, userID *uuid.UUID, action string, status string, ipAddress *string, details map[string]interface{}) error
+}
+
+// Config holds how far ahead partitions are created and how long they are kept
+type Config struct {
+	Interval  time.Duration // How often partitions are maintained
+	Ahead     int           // Months created after the current one
+	Retention int           // Months kept before the current one; 0 keeps everything
+}
+
+// Manager periodically creates upcoming partitions and drops expired ones.
+// With several replicas, one maintains the partitions at a time.
+type Manager struct {
+	store  Store
+	audit  AuditStore
+	config Config
+	logger *logger.Logger
+
+	loop worker.Loop
+}
+
+// NewManager creates a new partition manager
+func NewManager(store Store, audit AuditStore, cfg Config, log *logger.Logger) *Manager {
+	if cfg.Interval <= 0 {
+		cfg.Interval = 6 * time.Hour
+	}
+	if cfg.Ahead < 1 {
+		cfg.Ahead = 1
+	}
+
+	return &Manager{
+		store:  store,
+		audit:  audit,
+		config: cfg,
+		logger: log,
+	}
+}
+
+// Start runs the manager in the background until Stop is called
+func (m *Manager) Start() {
+	m.loop.Start(m.run)
+}
+
+// Stop stops the manager and waits for an in-progress pass to finish.
+// It is safe to call even if the manager was never started.
+func (m *Manager) Stop() {
+	m.loop.Stop()
+}
+
+func (m *Manager) run() {
+	ticker := time.NewTicker(m.config.Interval)
+	defer ticker.Stop()
+
+	for {
+		m.Maintain(time.Now())
+
+		select {
+		case <-m.loop.Stopping():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Maintain creates the partitions of the months up to Ahead after now's and,
+// with a retention, drops those more than Retention months before it
+func (m *Manager) Maintain(now time.Time) {
+	ctx, cancel := context.WithTimeout(context.Background(), m.config.Interval)
+	defer cancel()
+
+	through := now.AddDate(0, m.config.Ahead, 0)
+	var dropBefore time.Time
+	if m.config.Retention > 0 {
+		month := time.Date(now.UTC().Year(), now.UTC().Month(), 1, 0, 0, 0, 0, time.UTC)
+		dropBefore = month.AddDate(0, -m.config.Retention, 0)
+	}
+
+	tables := make([]string, 0, len(models.PartitionedTables))
+	for table := range models.PartitionedTables {
+		tables = append(tables, table)
+	}
+	sort.Strings(tables)
+
+	for _, table := range tables {
+		changes, err := m.store.Maintain(ctx, table, now, through, dropBefore)
+		if err != nil {
+			m.logger.Error("Failed to maintain audit partitions", map[string]interface{}{
+				"table": table,
+				"error": err.Error(),
+			})
+			continue
+		}
+		if changes == nil {
+			// Another replica is at it
+			continue
+		}
+
+		for _, month := range changes.Created {
+			m.logger.Info("Created audit partition", map[string]interface{}{
+				"table": table,
+				"month": month.Format("2006-01"),
+			})
+		}
+		if len(changes.Dropped) == 0 && changes.Purged == 0 {
+			continue
+		}
+
+		dropped := make([]string, len(changes.Dropped))
+		for i, month := range changes.Dropped {
+			dropped[i] = month.Format("2006-01")
+		}
+		m.logger.Info("Dropped audit partitions past retention", map[string]interface{}{
+			"table":  table,
+			"months": dropped,
+			"purged": changes.Purged,
+		})
+
+		details := map[string]interface{}{
+			"table":            table,
+			"months":           dropped,
+			"purged":           changes.Purged,
+			"retention_months": m.config.Retention,
+		}
+		if err := m.audit.CreateSimple(ctx, models.EventTypeAuditPartitionsDropped, nil, "retention", models.AuditStatusSuccess, nil, details); err != nil {
+			m.logger.Error("Failed to create system audit log", map[string]interface{}{
+				"error": err.Error(),
+			})
+		}
+	}
+}
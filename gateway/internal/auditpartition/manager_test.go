@@ -0,0 +1,106 @@
+package auditpartition
+
+import (
+	"context"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/VanCannon/openpam/gateway/internal/models"
+	"github.com/VanCannon/openpam/pkg/logger"
+	"github.com/google/uuid"
+)
+
+type maintainCall struct {
+	table               string
+	through, dropBefore time.Time
+}
+
+type fakeStore struct {
+	calls   []maintainCall
+	changes map[string]*models.PartitionChanges
+}
+
+func (f *fakeStore) Maintain(ctx context.Context, table string, now, through, dropBefore time.Time) (*models.PartitionChanges, error) {
+	f.calls = append(f.calls, maintainCall{table: table, through: through, dropBefore: dropBefore})
+	if c, ok := f.changes[table]; ok {
+		return c, nil
+	}
+	return &models.PartitionChanges{Table: table}, nil
+}
+
+type fakeAudit struct {
+	events []map[string]interface{}
+}
+
+func (f *fakeAudit) CreateSimple(ctx context.Context, eventType string, userID *uuid.UUID, action string, status string, ipAddress *string, details map[string]interface{}) error {
+	if eventType == models.EventTypeAuditPartitionsDropped {
+		f.events = append(f.events, details)
+	}
+	return nil
+}
+
+func TestManager_Maintain(t *testing.T) {
+	now := time.Date(2026, 10, 17, 9, 0, 0, 0, time.UTC)
+	store := &fakeStore{changes: map[string]*models.PartitionChanges{
+		"audit_logs": {
+			Table:   "audit_logs",
+			Dropped: []time.Time{time.Date(2025, 8, 1, 0, 0, 0, 0, time.UTC), time.Date(2025, 9, 1, 0, 0, 0, 0, time.UTC)},
+		},
+	}}
+	audit := &fakeAudit{}
+	m := NewManager(store, audit, Config{Ahead: 3, Retention: 12}, logger.New(logger.LevelError, io.Discard))
+
+	m.Maintain(now)
+
+	if len(store.calls) != 2 || store.calls[0].table != "audit_logs" || store.calls[1].table != "system_audit_logs" {
+		t.Fatalf("calls = %+v, want both audit tables", store.calls)
+	}
+	call := store.calls[0]
+	if want := time.Date(2027, 1, 17, 9, 0, 0, 0, time.UTC); !call.through.Equal(want) {
+		t.Errorf("through = %v, want %v", call.through, want)
+	}
+	if want := time.Date(2025, 10, 1, 0, 0, 0, 0, time.UTC); !call.dropBefore.Equal(want) {
+		t.Errorf("dropBefore = %v, want %v", call.dropBefore, want)
+	}
+
+	if len(audit.events) != 1 {
+		t.Fatalf("audited %d drops, want 1", len(audit.events))
+	}
+	if months := audit.events[0]["months"].([]string); len(months) != 2 || months[0] != "2025-08" {
+		t.Errorf("audited months = %v", months)
+	}
+}
+
+func TestManager_KeepsEverythingWithoutRetention(t *testing.T) {
+	store := &fakeStore{}
+	audit := &fakeAudit{}
+	m := NewManager(store, audit, Config{Ahead: 3}, logger.New(logger.LevelError, io.Discard))
+
+	m.Maintain(time.Now())
+
+	for _, call := range store.calls {
+		if !call.dropBefore.IsZero() {
+			t.Errorf("%s: dropBefore = %v, want zero", call.table, call.dropBefore)
+		}
+	}
+	if len(audit.events) != 0 {
+		t.Errorf("audited %d drops, want none", len(audit.events))
+	}
+}
+
+func TestManager_StopWithoutStart(t *testing.T) {
+	m := NewManager(&fakeStore{}, &fakeAudit{}, Config{}, logger.New(logger.LevelError, io.Discard))
+
+	done := make(chan struct{})
+	go func() {
+		m.Stop()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Stop blocked without Start")
+	}
+}
@@ -0,0 +1,80 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/VanCannon/openpam/gateway/internal/models"
+	"github.com/google/uuid"
+)
+
+// APIKeyPrefix marks a bearer token as an API key rather than a JWT
+const APIKeyPrefix = "opk_"
+
+// APIKeyStore looks up API keys by hash
+type APIKeyStore interface {
+	GetByHash(ctx context.Context, hash string) (*models.APIKey, error)
+	TouchLastUsed(ctx context.Context, id uuid.UUID) error
+}
+
+// APIKeyAuthenticator validates API keys presented as bearer tokens
+type APIKeyAuthenticator struct {
+	store APIKeyStore
+}
+
+// NewAPIKeyAuthenticator creates a new API key authenticator
+func NewAPIKeyAuthenticator(store APIKeyStore) *APIKeyAuthenticator {
+	return &APIKeyAuthenticator{store: store}
+}
+
+// IsAPIKey reports whether a bearer token looks like an API key
+func IsAPIKey(token string) bool {
+	return strings.HasPrefix(token, APIKeyPrefix)
+}
+
+// GenerateAPIKey returns a new random API key, its display prefix and its hash
+func GenerateAPIKey() (key, prefix, hash string, err error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", "", "", fmt.Errorf("failed to generate API key: %w", err)
+	}
+
+	key = APIKeyPrefix + base64.RawURLEncoding.EncodeToString(buf)
+	return key, key[:len(APIKeyPrefix)+8], HashAPIKey(key), nil
+}
+
+// HashAPIKey returns the hex SHA-256 hash under which a key is stored
+func HashAPIKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// Authenticate validates an API key and returns claims equivalent to a session token.
+// The email claim carries the key name so audit entries show which automation acted.
+func (a *APIKeyAuthenticator) Authenticate(ctx context.Context, key string) (*Claims, error) {
+	apiKey, err := a.store.GetByHash(ctx, HashAPIKey(key))
+	if err != nil {
+		return nil, fmt.Errorf("invalid API key: %w", err)
+	}
+
+	if !apiKey.Usable(time.Now()) {
+		return nil, fmt.Errorf("API key revoked or expired")
+	}
+
+	// Best effort; a failure here must not block the request
+	_ = a.store.TouchLastUsed(ctx, apiKey.ID)
+
+	return &Claims{
+		UserID:      apiKey.UserID.String(),
+		Email:       "apikey:" + apiKey.Name,
+		DisplayName: apiKey.Name,
+		Role:        apiKey.Role,
+		APIKeyID:    apiKey.ID.String(),
+	}, nil
+}
@@ -0,0 +1,72 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// ApprovalPrefix marks a token as an approval action token
+const ApprovalPrefix = "apt_"
+
+// Approval tokens hold the ID of the stored approval action and its expiry,
+// followed by an HMAC over them
+const approvalPayloadSize = 16 + 8
+
+// ApprovalTokens signs the tokens in approval links sent to approvers. The
+// signature only proves the gateway issued the token; the approval action it
+// names is stored, and is what makes the token single-use.
+type ApprovalTokens struct {
+	secret []byte
+}
+
+// NewApprovalTokens creates an approval token signer
+func NewApprovalTokens(secret string) *ApprovalTokens {
+	return &ApprovalTokens{secret: []byte(secret)}
+}
+
+// Sign returns the token for an approval action
+func (a *ApprovalTokens) Sign(actionID uuid.UUID, expires time.Time) string {
+	buf := make([]byte, approvalPayloadSize, approvalPayloadSize+sha256.Size)
+	copy(buf, actionID[:])
+	binary.BigEndian.PutUint64(buf[16:], uint64(expires.Unix()))
+	buf = append(buf, a.mac(buf)...)
+
+	return ApprovalPrefix + base64.RawURLEncoding.EncodeToString(buf)
+}
+
+// Verify checks a token's signature and expiry and returns its approval action ID
+func (a *ApprovalTokens) Verify(token string) (uuid.UUID, error) {
+	encoded, ok := strings.CutPrefix(token, ApprovalPrefix)
+	if !ok {
+		return uuid.Nil, fmt.Errorf("malformed approval token")
+	}
+	buf, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil || len(buf) != approvalPayloadSize+sha256.Size {
+		return uuid.Nil, fmt.Errorf("malformed approval token")
+	}
+	payload := buf[:approvalPayloadSize]
+	if !hmac.Equal(buf[approvalPayloadSize:], a.mac(payload)) {
+		return uuid.Nil, fmt.Errorf("invalid approval token")
+	}
+
+	if time.Now().Unix() > int64(binary.BigEndian.Uint64(payload[16:])) {
+		return uuid.Nil, fmt.Errorf("approval token expired")
+	}
+
+	id, _ := uuid.FromBytes(payload[:16])
+	return id, nil
+}
+
+func (a *ApprovalTokens) mac(payload []byte) []byte {
+	h := hmac.New(sha256.New, a.secret)
+	h.Write([]byte("openpam-approval\x00"))
+	h.Write(payload)
+	return h.Sum(nil)
+}
@@ -0,0 +1,54 @@
+package auth
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func TestApprovalTokens(t *testing.T) {
+	tokens := NewApprovalTokens("secret")
+	id := uuid.New()
+
+	token := tokens.Sign(id, time.Now().Add(time.Hour))
+	if !strings.HasPrefix(token, ApprovalPrefix) {
+		t.Errorf("token %q lacks the approval prefix", token)
+	}
+
+	got, err := NewApprovalTokens("secret").Verify(token)
+	if err != nil {
+		t.Fatalf("Verify() error = %v", err)
+	}
+	if got != id {
+		t.Errorf("Verify() = %s, want %s", got, id)
+	}
+
+	if _, err := NewApprovalTokens("other").Verify(token); err == nil {
+		t.Error("token accepted with a different secret")
+	}
+
+	expired := tokens.Sign(id, time.Now().Add(-time.Second))
+	if _, err := tokens.Verify(expired); err == nil {
+		t.Error("expired token accepted")
+	}
+
+	// Changing the action ID breaks the signature
+	forged := []byte(token)
+	i := len(ApprovalPrefix) + 2
+	if forged[i] == 'A' {
+		forged[i] = 'B'
+	} else {
+		forged[i] = 'A'
+	}
+	if _, err := tokens.Verify(string(forged)); err == nil {
+		t.Error("tampered token accepted")
+	}
+
+	for _, malformed := range []string{"", ApprovalPrefix, ApprovalPrefix + "!!", ReconnectPrefix + token[len(ApprovalPrefix):]} {
+		if _, err := tokens.Verify(malformed); err == nil {
+			t.Errorf("Verify(%q) accepted", malformed)
+		}
+	}
+}
@@ -0,0 +1,51 @@
+package auth
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func TestCalendarTokens(t *testing.T) {
+	tokens := NewCalendarTokens("secret")
+	id := uuid.New()
+
+	token := tokens.Sign(id)
+	if !strings.HasPrefix(token, CalendarPrefix) {
+		t.Errorf("token %q lacks the calendar prefix", token)
+	}
+
+	got, err := NewCalendarTokens("secret").Verify(token)
+	if err != nil {
+		t.Fatalf("Verify() error = %v", err)
+	}
+	if got != id {
+		t.Errorf("Verify() = %s, want %s", got, id)
+	}
+
+	if _, err := NewCalendarTokens("other").Verify(token); err == nil {
+		t.Error("token accepted with a different secret")
+	}
+
+	// Changing the feed ID breaks the signature
+	forged := []byte(token)
+	i := len(CalendarPrefix) + 2
+	if forged[i] == 'A' {
+		forged[i] = 'B'
+	} else {
+		forged[i] = 'A'
+	}
+	if _, err := tokens.Verify(string(forged)); err == nil {
+		t.Error("tampered token accepted")
+	}
+
+	// Other tokens signed with the same secret aren't calendar tokens
+	approval := NewApprovalTokens("secret").Sign(id, time.Now().Add(time.Hour))
+	for _, malformed := range []string{"", CalendarPrefix, CalendarPrefix + "!!", approval, CalendarPrefix + approval[len(ApprovalPrefix):]} {
+		if _, err := tokens.Verify(malformed); err == nil {
+			t.Errorf("Verify(%q) accepted", malformed)
+		}
+	}
+}
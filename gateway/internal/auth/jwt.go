@@ -1,9 +1,13 @@
 package auth
 
 import (
+	"context"
+	"encoding/json"
 	"fmt"
 	"time"
 
+	"github.com/VanCannon/openpam/gateway/internal/keys"
+	"github.com/VanCannon/openpam/pkg/servicetoken"
 	"github.com/golang-jwt/jwt/v5"
 	"github.com/google/uuid"
 )
@@ -14,23 +18,38 @@ type Claims struct {
 	Email       string `json:"email"`
 	DisplayName string `json:"display_name"`
 	Role        string `json:"role"`
+	APIKeyID    string `json:"-"` // Set when the request was authenticated with an API key
 	jwt.RegisteredClaims
 }
 
 // TokenManager handles JWT token creation and validation
 type TokenManager struct {
+	keys       *keys.Ring
 	secret     []byte
 	expiration time.Duration
 }
 
-// NewTokenManager creates a new token manager
+// NewTokenManager creates a new token manager signing with the secret
 func NewTokenManager(secret string, expiration time.Duration) *TokenManager {
+	return NewKeyedTokenManager(keys.NewRing(keys.NewSecretKey(secret)), secret, expiration)
+}
+
+// NewKeyedTokenManager creates a token manager signing session tokens with the
+// active key of ring. Service tokens are still signed with the secret, which
+// the other services share.
+func NewKeyedTokenManager(ring *keys.Ring, secret string, expiration time.Duration) *TokenManager {
 	return &TokenManager{
+		keys:       ring,
 		secret:     []byte(secret),
 		expiration: expiration,
 	}
 }
 
+// Keys returns the keys session tokens are signed and verified with
+func (tm *TokenManager) Keys() *keys.Ring {
+	return tm.keys
+}
+
 // GenerateToken creates a new JWT token for the user
 func (tm *TokenManager) GenerateToken(userID, email, displayName, role string) (string, error) {
 	now := time.Now()
@@ -50,9 +69,13 @@ func (tm *TokenManager) GenerateToken(userID, email, displayName, role string) (
 		},
 	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode token: %w", err)
+	}
 
-	tokenString, err := token.SignedString(tm.secret)
+	// The kid header names the signing key, so tokens outlive its rotation
+	tokenString, err := tm.keys.Sign(context.Background(), "JWT", payload)
 	if err != nil {
 		return "", fmt.Errorf("failed to sign token: %w", err)
 	}
@@ -63,11 +86,9 @@ func (tm *TokenManager) GenerateToken(userID, email, displayName, role string) (
 // ValidateToken validates a JWT token and returns the claims
 func (tm *TokenManager) ValidateToken(tokenString string) (*Claims, error) {
 	token, err := jwt.ParseWithClaims(tokenString, &Claims{}, func(token *jwt.Token) (interface{}, error) {
-		// Verify signing method
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
-		}
-		return tm.secret, nil
+		// Verify with the key the token names, which must sign with its method
+		kid, _ := token.Header["kid"].(string)
+		return tm.keys.KeyFor(kid, token.Method.Alg())
 	})
 
 	if err != nil {
@@ -86,6 +107,12 @@ func (tm *TokenManager) ValidateToken(tokenString string) (*Claims, error) {
 	return claims, nil
 }
 
+// GenerateServiceToken creates a short-lived token for the gateway to call
+// other OpenPAM services with
+func (tm *TokenManager) GenerateServiceToken() (string, error) {
+	return servicetoken.Issue(tm.secret, "gateway")
+}
+
 // RefreshToken creates a new token with extended expiration
 func (tm *TokenManager) RefreshToken(oldToken string) (string, error) {
 	claims, err := tm.ValidateToken(oldToken)
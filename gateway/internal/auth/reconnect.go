@@ -0,0 +1,135 @@
+package auth
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/VanCannon/openpam/gateway/internal/models"
+	"github.com/google/uuid"
+)
+
+// ReconnectPrefix marks a token as a WebSocket reconnect token
+const ReconnectPrefix = "rct_"
+
+// Reconnect tokens hold the user ID, expiry and a nonce, followed by a
+// truncated HMAC over them and the WebSocket path they are valid for. They are
+// kept short so they fit in a WebSocket close frame.
+const (
+	reconnectPayloadSize = 16 + 4 + 8
+	reconnectMACSize     = 16
+)
+
+// UserLookup loads the user a reconnect token was issued to
+type UserLookup interface {
+	GetByID(ctx context.Context, id uuid.UUID) (*models.User, error)
+}
+
+// ReconnectAuthenticator issues and redeems short-lived tokens that let a
+// client reopen a WebSocket on the same path without signing in again. Tokens
+// are signed with the session secret, so they survive a gateway restart, and
+// each can be used once.
+type ReconnectAuthenticator struct {
+	secret []byte
+	ttl    time.Duration
+	users  UserLookup
+
+	mu   sync.Mutex
+	used map[string]time.Time // Redeemed nonces until they expire
+}
+
+// NewReconnectAuthenticator creates a reconnect token authenticator
+func NewReconnectAuthenticator(secret string, ttl time.Duration, users UserLookup) *ReconnectAuthenticator {
+	return &ReconnectAuthenticator{
+		secret: []byte(secret),
+		ttl:    ttl,
+		users:  users,
+		used:   make(map[string]time.Time),
+	}
+}
+
+// IsReconnectToken reports whether a token looks like a reconnect token
+func IsReconnectToken(token string) bool {
+	return strings.HasPrefix(token, ReconnectPrefix)
+}
+
+// Issue returns a token that reopens the WebSocket at path for the user
+func (a *ReconnectAuthenticator) Issue(userID, path string) (string, error) {
+	id, err := uuid.Parse(userID)
+	if err != nil {
+		return "", fmt.Errorf("invalid user ID: %w", err)
+	}
+
+	buf := make([]byte, reconnectPayloadSize, reconnectPayloadSize+reconnectMACSize)
+	copy(buf, id[:])
+	binary.BigEndian.PutUint32(buf[16:], uint32(time.Now().Add(a.ttl).Unix()))
+	if _, err := rand.Read(buf[20:]); err != nil {
+		return "", fmt.Errorf("failed to generate reconnect token: %w", err)
+	}
+	buf = append(buf, a.mac(buf, path)...)
+
+	return ReconnectPrefix + base64.RawURLEncoding.EncodeToString(buf), nil
+}
+
+// Authenticate redeems a token presented on path and returns claims for its
+// user, loaded afresh so role changes and disabled accounts take effect
+func (a *ReconnectAuthenticator) Authenticate(ctx context.Context, token, path string) (*Claims, error) {
+	buf, err := base64.RawURLEncoding.DecodeString(strings.TrimPrefix(token, ReconnectPrefix))
+	if err != nil || len(buf) != reconnectPayloadSize+reconnectMACSize {
+		return nil, fmt.Errorf("malformed reconnect token")
+	}
+	payload := buf[:reconnectPayloadSize]
+	if !hmac.Equal(buf[reconnectPayloadSize:], a.mac(payload, path)) {
+		return nil, fmt.Errorf("invalid reconnect token")
+	}
+
+	now := time.Now()
+	expires := time.Unix(int64(binary.BigEndian.Uint32(payload[16:])), 0)
+	if now.After(expires) {
+		return nil, fmt.Errorf("reconnect token expired")
+	}
+
+	nonce := string(payload[20:])
+	a.mu.Lock()
+	for n, exp := range a.used {
+		if now.After(exp) {
+			delete(a.used, n)
+		}
+	}
+	if _, ok := a.used[nonce]; ok {
+		a.mu.Unlock()
+		return nil, fmt.Errorf("reconnect token already used")
+	}
+	a.used[nonce] = expires
+	a.mu.Unlock()
+
+	userID, _ := uuid.FromBytes(payload[:16])
+	user, err := a.users.GetByID(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load user: %w", err)
+	}
+	if !user.Enabled {
+		return nil, fmt.Errorf("user is disabled")
+	}
+
+	return &Claims{
+		UserID:      user.ID.String(),
+		Email:       user.Email,
+		DisplayName: user.DisplayName,
+		Role:        user.Role,
+	}, nil
+}
+
+func (a *ReconnectAuthenticator) mac(payload []byte, path string) []byte {
+	h := hmac.New(sha256.New, a.secret)
+	h.Write([]byte("openpam-reconnect\x00" + path + "\x00"))
+	h.Write(payload)
+	return h.Sum(nil)[:reconnectMACSize]
+}
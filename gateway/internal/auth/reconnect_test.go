@@ -0,0 +1,67 @@
+package auth
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/VanCannon/openpam/gateway/internal/models"
+	"github.com/google/uuid"
+)
+
+type fakeUsers map[uuid.UUID]*models.User
+
+func (f fakeUsers) GetByID(ctx context.Context, id uuid.UUID) (*models.User, error) {
+	if u, ok := f[id]; ok {
+		return u, nil
+	}
+	return nil, fmt.Errorf("user not found")
+}
+
+func TestReconnectAuthenticator(t *testing.T) {
+	user := &models.User{ID: uuid.New(), Email: "alice@example.com", Role: models.RoleUser, Enabled: true}
+	users := fakeUsers{user.ID: user}
+	a := NewReconnectAuthenticator("secret", time.Minute, users)
+	path := "/api/ws/connect/ssh/" + uuid.NewString()
+	ctx := context.Background()
+
+	token, err := a.Issue(user.ID.String(), path)
+	if err != nil {
+		t.Fatalf("Issue() error = %v", err)
+	}
+	if !IsReconnectToken(token) || len(token) > 64 {
+		t.Errorf("token %q should be a short reconnect token", token)
+	}
+
+	if _, err := a.Authenticate(ctx, token, "/api/ws/monitor/"+uuid.NewString()); err == nil {
+		t.Error("token accepted on a different path")
+	}
+	// Another gateway process with the same secret accepts it, as after a restart
+	restarted := NewReconnectAuthenticator("secret", time.Minute, users)
+	claims, err := restarted.Authenticate(ctx, token, path)
+	if err != nil {
+		t.Fatalf("Authenticate() error = %v", err)
+	}
+	if claims.UserID != user.ID.String() || claims.Email != user.Email || claims.Role != user.Role {
+		t.Errorf("claims = %+v", claims)
+	}
+	if _, err := restarted.Authenticate(ctx, token, path); err == nil {
+		t.Error("token accepted twice")
+	}
+
+	if _, err := NewReconnectAuthenticator("other", time.Minute, users).Authenticate(ctx, token, path); err == nil {
+		t.Error("token accepted with a different secret")
+	}
+
+	expired, _ := NewReconnectAuthenticator("secret", -time.Minute, users).Issue(user.ID.String(), path)
+	if _, err := a.Authenticate(ctx, expired, path); err == nil {
+		t.Error("expired token accepted")
+	}
+
+	user.Enabled = false
+	disabled, _ := a.Issue(user.ID.String(), path)
+	if _, err := a.Authenticate(ctx, disabled, path); err == nil {
+		t.Error("token accepted for a disabled user")
+	}
+}
@@ -0,0 +1,257 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Session store backends
+const (
+	StoreMemory = "memory"
+	StoreRedis  = "redis"
+)
+
+// StoreConfig selects where sessions and OAuth2 states are kept. Memory
+// stores lose them on restart and aren't shared between replicas; Redis
+// stores keep them for every gateway using the same Redis.
+type StoreConfig struct {
+	Backend   string // StoreMemory or StoreRedis
+	RedisURL  string // redis:// or rediss:// URL
+	KeyPrefix string // Prepended to every key, so gateways can share a Redis
+}
+
+// Validate checks the store settings
+func (c StoreConfig) Validate() error {
+	switch c.Backend {
+	case StoreMemory:
+		return nil
+	case StoreRedis:
+		if c.RedisURL == "" {
+			return errors.New("a redis session store requires REDIS_URL")
+		}
+		if _, err := redis.ParseURL(c.RedisURL); err != nil {
+			return fmt.Errorf("invalid REDIS_URL: %w", err)
+		}
+		return nil
+	default:
+		return fmt.Errorf("invalid SESSION_STORE: %s (must be 'memory' or 'redis')", c.Backend)
+	}
+}
+
+// Stores are the session and OAuth2 state stores logins are kept in
+type Stores struct {
+	Sessions SessionStore
+	States   StateStore
+	client   *redis.Client
+}
+
+// OpenStores opens the configured stores. Redis is pinged so an unreachable
+// server fails startup rather than the first login. Memory stores are cleaned
+// up every cleanupInterval until ctx is done; Redis expires keys itself.
+func OpenStores(ctx context.Context, cfg StoreConfig, cleanupInterval time.Duration) (*Stores, error) {
+	if cfg.Backend != StoreRedis {
+		sessions := NewMemorySessionStore()
+		states := NewMemoryStateStore()
+		sessions.StartCleanup(ctx, cleanupInterval)
+		states.StartCleanup(ctx, cleanupInterval)
+		return &Stores{Sessions: sessions, States: states}, nil
+	}
+
+	opts, err := redis.ParseURL(cfg.RedisURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid REDIS_URL: %w", err)
+	}
+	client := redis.NewClient(opts)
+
+	pingCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	if err := client.Ping(pingCtx).Err(); err != nil {
+		client.Close()
+		return nil, fmt.Errorf("failed to connect to redis: %w", err)
+	}
+
+	return &Stores{
+		Sessions: NewRedisSessionStore(client, cfg.KeyPrefix),
+		States:   NewRedisStateStore(client, cfg.KeyPrefix),
+		client:   client,
+	}, nil
+}
+
+// Close closes the connection to Redis, if any
+func (s *Stores) Close() error {
+	if s.client == nil {
+		return nil
+	}
+	return s.client.Close()
+}
+
+// RedisSessionStore keeps sessions in Redis, expiring with the session. Each
+// user's session IDs are also kept in a set so they can be deleted together.
+type RedisSessionStore struct {
+	client redis.Cmdable
+	prefix string
+}
+
+// NewRedisSessionStore creates a session store keeping sessions under prefix
+func NewRedisSessionStore(client redis.Cmdable, prefix string) *RedisSessionStore {
+	return &RedisSessionStore{client: client, prefix: prefix}
+}
+
+func (s *RedisSessionStore) sessionKey(sessionID string) string {
+	return s.prefix + "session:" + sessionID
+}
+
+func (s *RedisSessionStore) userKey(userID string) string {
+	return s.prefix + "user-sessions:" + userID
+}
+
+// Create creates a new session
+func (s *RedisSessionStore) Create(ctx context.Context, session *Session) error {
+	ttl := time.Until(session.ExpiresAt)
+	if ttl <= 0 {
+		return fmt.Errorf("session already expired")
+	}
+
+	data, err := json.Marshal(session)
+	if err != nil {
+		return fmt.Errorf("failed to encode session: %w", err)
+	}
+
+	// Sessions all last as long, so the user's set lives as long as their
+	// newest session
+	userKey := s.userKey(session.UserID)
+	_, err = s.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Set(ctx, s.sessionKey(session.ID), data, ttl)
+		pipe.SAdd(ctx, userKey, session.ID)
+		pipe.Expire(ctx, userKey, ttl)
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to store session: %w", err)
+	}
+	return nil
+}
+
+// Get retrieves a session by ID
+func (s *RedisSessionStore) Get(ctx context.Context, sessionID string) (*Session, error) {
+	data, err := s.client.Get(ctx, s.sessionKey(sessionID)).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return nil, fmt.Errorf("session not found")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get session: %w", err)
+	}
+
+	var session Session
+	if err := json.Unmarshal(data, &session); err != nil {
+		return nil, fmt.Errorf("failed to decode session: %w", err)
+	}
+
+	// Redis expires keys lazily to the millisecond; the session's own expiry decides
+	if time.Now().After(session.ExpiresAt) {
+		return nil, fmt.Errorf("session expired")
+	}
+
+	return &session, nil
+}
+
+// Delete deletes a session by ID
+func (s *RedisSessionStore) Delete(ctx context.Context, sessionID string) error {
+	session, err := s.Get(ctx, sessionID)
+	if err != nil {
+		// Already gone or expired; make sure of it
+		if err := s.client.Del(ctx, s.sessionKey(sessionID)).Err(); err != nil {
+			return fmt.Errorf("failed to delete session: %w", err)
+		}
+		return nil
+	}
+
+	_, err = s.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Del(ctx, s.sessionKey(sessionID))
+		pipe.SRem(ctx, s.userKey(session.UserID), sessionID)
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to delete session: %w", err)
+	}
+	return nil
+}
+
+// DeleteByUserID deletes all sessions for a user
+func (s *RedisSessionStore) DeleteByUserID(ctx context.Context, userID string) error {
+	userKey := s.userKey(userID)
+	ids, err := s.client.SMembers(ctx, userKey).Result()
+	if err != nil {
+		return fmt.Errorf("failed to list user sessions: %w", err)
+	}
+
+	keys := make([]string, 0, len(ids)+1)
+	for _, id := range ids {
+		keys = append(keys, s.sessionKey(id))
+	}
+	keys = append(keys, userKey)
+
+	if err := s.client.Del(ctx, keys...).Err(); err != nil {
+		return fmt.Errorf("failed to delete user sessions: %w", err)
+	}
+	return nil
+}
+
+// Cleanup does nothing: Redis expires sessions and the users' sets itself
+func (s *RedisSessionStore) Cleanup(ctx context.Context) error {
+	return nil
+}
+
+// RedisStateStore keeps OAuth2 states in Redis until they expire
+type RedisStateStore struct {
+	client redis.Cmdable
+	prefix string
+}
+
+// NewRedisStateStore creates a state store keeping states under prefix
+func NewRedisStateStore(client redis.Cmdable, prefix string) *RedisStateStore {
+	return &RedisStateStore{client: client, prefix: prefix}
+}
+
+func (s *RedisStateStore) key(state string) string {
+	return s.prefix + "oauth-state:" + state
+}
+
+// Create creates a new state
+func (s *RedisStateStore) Create(ctx context.Context, state string, expiresAt time.Time) error {
+	ttl := time.Until(expiresAt)
+	if ttl <= 0 {
+		return fmt.Errorf("state already expired")
+	}
+
+	if err := s.client.Set(ctx, s.key(state), expiresAt.Unix(), ttl).Err(); err != nil {
+		return fmt.Errorf("failed to store state: %w", err)
+	}
+	return nil
+}
+
+// Validate checks if a state is valid and uses it up. GETDEL does both at
+// once, so callbacks to different gateways can't both use the same state.
+func (s *RedisStateStore) Validate(ctx context.Context, state string) (bool, error) {
+	err := s.client.GetDel(ctx, s.key(state)).Err()
+	if errors.Is(err, redis.Nil) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to check state: %w", err)
+	}
+	return true, nil
+}
+
+// Delete deletes a state
+func (s *RedisStateStore) Delete(ctx context.Context, state string) error {
+	if err := s.client.Del(ctx, s.key(state)).Err(); err != nil {
+		return fmt.Errorf("failed to delete state: %w", err)
+	}
+	return nil
+}
@@ -132,7 +132,8 @@ func GenerateSessionID() (string, error) {
 	return base64.URLEncoding.EncodeToString(b), nil
 }
 
-// StateStore manages OAuth2 state parameters
+// StateStore manages OAuth2 state parameters. Validate uses a state up in the
+// same step, so a state can only be used once.
 type StateStore interface {
 	Create(ctx context.Context, state string, expiresAt time.Time) error
 	Validate(ctx context.Context, state string) (bool, error)
@@ -161,15 +162,16 @@ func (s *MemoryStateStore) Create(ctx context.Context, state string, expiresAt t
 	return nil
 }
 
-// Validate checks if a state is valid
+// Validate checks if a state is valid and uses it up
 func (s *MemoryStateStore) Validate(ctx context.Context, state string) (bool, error) {
-	s.mu.RLock()
-	defer s.mu.RUnlock()
+	s.mu.Lock()
+	defer s.mu.Unlock()
 
 	expiresAt, exists := s.states[state]
 	if !exists {
 		return false, nil
 	}
+	delete(s.states, state)
 
 	if time.Now().After(expiresAt) {
 		return false, nil
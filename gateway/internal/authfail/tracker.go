@@ -0,0 +1,136 @@
+// Package authfail tracks failed logons to targets with the credentials the
+// gateway injects. A streak of failures points at a stale secret or at someone
+// tampering with the target; it is alerted on and can quarantine the
+// credential until its secret is rotated.
+package authfail
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/VanCannon/openpam/gateway/internal/models"
+	"github.com/VanCannon/openpam/gateway/internal/notify"
+	"github.com/VanCannon/openpam/pkg/logger"
+	"github.com/google/uuid"
+)
+
+// CredentialStore is the subset of the credential repository the tracker needs
+type CredentialStore interface {
+	RecordAuthFailure(ctx context.Context, id uuid.UUID, message string, quarantineAfter int) (int, error)
+	ClearAuthFailures(ctx context.Context, id uuid.UUID) error
+}
+
+// AuditStore records the alerts in the system audit log
+type AuditStore interface {
+	CreateSimple(ctx context.Context, eventType string, userID *uuid.UUID, action string, status string, ipAddress *string, details map[string]interface{}) error
+}
+
+// Config holds when failure streaks are alerted on and credentials quarantined
+type Config struct {
+	AlertThreshold      int      // Consecutive failures that raise an alert; 0 disables alerts
+	QuarantineThreshold int      // Consecutive failures that quarantine the credential; 0 never quarantines
+	AlertRecipients     []string // Emailed about failure streaks; audited only when empty
+}
+
+// Tracker counts consecutive failed logons per credential. Each streak is
+// alerted on once when it reaches the alert threshold, and again if it
+// quarantines the credential.
+type Tracker struct {
+	store    CredentialStore
+	audit    AuditStore
+	notifier notify.Notifier
+	config   Config
+	logger   *logger.Logger
+}
+
+// NewTracker creates a new authentication failure tracker
+func NewTracker(store CredentialStore, audit AuditStore, notifier notify.Notifier, cfg Config, log *logger.Logger) *Tracker {
+	return &Tracker{
+		store:    store,
+		audit:    audit,
+		notifier: notifier,
+		config:   cfg,
+		logger:   log,
+	}
+}
+
+// Failed records that the target rejected cred in a session opened by userID
+func (t *Tracker) Failed(ctx context.Context, target *models.Target, cred *models.Credential, userID uuid.UUID, cause error) {
+	failures, err := t.store.RecordAuthFailure(ctx, cred.ID, cause.Error(), t.config.QuarantineThreshold)
+	if err != nil {
+		t.logger.Error("Failed to record authentication failure", map[string]interface{}{
+			"credential_id": cred.ID.String(),
+			"error":         err.Error(),
+		})
+		return
+	}
+
+	t.logger.Warn("Target rejected credential", map[string]interface{}{
+		"credential_id": cred.ID.String(),
+		"target_id":     target.ID.String(),
+		"username":      cred.Username,
+		"failures":      failures,
+	})
+
+	alert := t.config.AlertThreshold > 0 && failures == t.config.AlertThreshold
+	quarantined := t.config.QuarantineThreshold > 0 && failures == t.config.QuarantineThreshold
+	if !alert && !quarantined {
+		return
+	}
+
+	details := map[string]interface{}{
+		"credential_id": cred.ID.String(),
+		"target_id":     target.ID.String(),
+		"target":        target.Name,
+		"username":      cred.Username,
+		"failures":      failures,
+		"last_error":    cause.Error(),
+	}
+	eventType, action := models.EventTypeCredentialAuthFailures, "auth_failure_alert"
+	if quarantined {
+		eventType, action = models.EventTypeCredentialQuarantined, "quarantine"
+	}
+	if err := t.audit.CreateSimple(ctx, eventType, &userID, action, models.AuditStatusFailure, nil, details); err != nil {
+		t.logger.Error("Failed to create system audit log", map[string]interface{}{
+			"error": err.Error(),
+		})
+	}
+
+	if len(t.config.AlertRecipients) == 0 {
+		return
+	}
+
+	subject := fmt.Sprintf("OpenPAM: %d failed logons to %s as %s", failures, target.Name, cred.Username)
+	body := fmt.Sprintf("The last %d sessions to %s (%s) failed to log on as %s:\n\n  %s\n\n"+
+		"The secret in Vault may be out of date, or the account may have been changed on the target.",
+		failures, target.Name, target.Hostname, cred.Username, cause.Error())
+	if quarantined {
+		subject = fmt.Sprintf("OpenPAM: credential %s on %s quarantined", cred.Username, target.Name)
+		body += "\n\nThe credential is quarantined: no new sessions use it until its secret is rotated or an admin releases it."
+	}
+
+	msg := &notify.Message{
+		To:      t.config.AlertRecipients,
+		Subject: subject,
+		Body:    body,
+	}
+	if err := t.notifier.Send(ctx, msg); err != nil {
+		t.logger.Error("Failed to send authentication failure alert", map[string]interface{}{
+			"error": err.Error(),
+		})
+	}
+}
+
+// Succeeded ends cred's failure streak after the target accepted it
+func (t *Tracker) Succeeded(ctx context.Context, cred *models.Credential) {
+	if cred.AuthFailures == 0 {
+		return
+	}
+
+	if err := t.store.ClearAuthFailures(ctx, cred.ID); err != nil {
+		t.logger.Error("Failed to clear authentication failures", map[string]interface{}{
+			"credential_id": cred.ID.String(),
+			"error":         err.Error(),
+		})
+	}
+}
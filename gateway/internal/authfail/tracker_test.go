@@ -0,0 +1,95 @@
+package authfail
+
+import (
+	"context"
+	"errors"
+	"io"
+	"testing"
+
+	"github.com/VanCannon/openpam/gateway/internal/models"
+	"github.com/VanCannon/openpam/gateway/internal/notify"
+	"github.com/VanCannon/openpam/pkg/logger"
+	"github.com/google/uuid"
+)
+
+type fakeStore struct {
+	failures        int
+	quarantineAfter int
+	cleared         []uuid.UUID
+}
+
+func (s *fakeStore) RecordAuthFailure(ctx context.Context, id uuid.UUID, message string, quarantineAfter int) (int, error) {
+	s.failures++
+	s.quarantineAfter = quarantineAfter
+	return s.failures, nil
+}
+
+func (s *fakeStore) ClearAuthFailures(ctx context.Context, id uuid.UUID) error {
+	s.failures = 0
+	s.cleared = append(s.cleared, id)
+	return nil
+}
+
+type fakeAudit struct{ events []string }
+
+func (a *fakeAudit) CreateSimple(ctx context.Context, eventType string, userID *uuid.UUID, action string, status string, ipAddress *string, details map[string]interface{}) error {
+	a.events = append(a.events, eventType)
+	return nil
+}
+
+type fakeNotifier struct{ sent []*notify.Message }
+
+func (n *fakeNotifier) Send(ctx context.Context, msg *notify.Message) error {
+	n.sent = append(n.sent, msg)
+	return nil
+}
+
+func TestTracker_Failed(t *testing.T) {
+	store := &fakeStore{}
+	audit := &fakeAudit{}
+	notifier := &fakeNotifier{}
+	tracker := NewTracker(store, audit, notifier, Config{
+		AlertThreshold:      2,
+		QuarantineThreshold: 4,
+		AlertRecipients:     []string{"secops@example.com"},
+	}, logger.New(logger.LevelError, io.Discard))
+
+	target := &models.Target{ID: uuid.New(), Name: "db-01", Hostname: "10.0.0.5"}
+	cred := &models.Credential{ID: uuid.New(), TargetID: target.ID, Username: "postgres"}
+	cause := errors.New("SSH authentication failed")
+
+	// Alerted once when the streak reaches the alert threshold, then once more
+	// when it quarantines the credential
+	for i := 0; i < 5; i++ {
+		tracker.Failed(context.Background(), target, cred, uuid.New(), cause)
+	}
+
+	if store.quarantineAfter != 4 {
+		t.Errorf("quarantineAfter = %d, want 4", store.quarantineAfter)
+	}
+	want := []string{models.EventTypeCredentialAuthFailures, models.EventTypeCredentialQuarantined}
+	if len(audit.events) != len(want) || audit.events[0] != want[0] || audit.events[1] != want[1] {
+		t.Errorf("audit events = %v, want %v", audit.events, want)
+	}
+	if len(notifier.sent) != 2 || notifier.sent[1].To[0] != "secops@example.com" {
+		t.Errorf("sent = %v", notifier.sent)
+	}
+}
+
+func TestTracker_Succeeded(t *testing.T) {
+	store := &fakeStore{failures: 2}
+	tracker := NewTracker(store, &fakeAudit{}, &fakeNotifier{}, Config{AlertThreshold: 3}, logger.New(logger.LevelError, io.Discard))
+
+	// Credentials without a streak aren't written to
+	clean := &models.Credential{ID: uuid.New()}
+	tracker.Succeeded(context.Background(), clean)
+	if len(store.cleared) != 0 {
+		t.Fatalf("cleared = %v, want none", store.cleared)
+	}
+
+	failing := &models.Credential{ID: uuid.New(), AuthFailures: 2}
+	tracker.Succeeded(context.Background(), failing)
+	if len(store.cleared) != 1 || store.cleared[0] != failing.ID {
+		t.Errorf("cleared = %v, want [%v]", store.cleared, failing.ID)
+	}
+}
@@ -0,0 +1,7 @@
+// Package build describes the running gateway binary
+package build
+
+// Version is the gateway version, set at build time with
+//
+//	go build -ldflags "-X github.com/VanCannon/openpam/gateway/internal/build.Version=1.2.3"
+var Version = "0.1.0"
@@ -0,0 +1,178 @@
+package calendar
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/VanCannon/openpam/gateway/internal/models"
+	"github.com/google/uuid"
+)
+
+type fakeTargets map[uuid.UUID]*models.Target
+
+func (f fakeTargets) GetByID(ctx context.Context, id uuid.UUID) (*models.Target, error) {
+	if t, ok := f[id]; ok {
+		return t, nil
+	}
+	return nil, errors.New("target not found")
+}
+
+type fakeUsers map[uuid.UUID]*models.User
+
+func (f fakeUsers) GetByID(ctx context.Context, id uuid.UUID) (*models.User, error) {
+	if u, ok := f[id]; ok {
+		return u, nil
+	}
+	return nil, errors.New("user not found")
+}
+
+func TestWrite(t *testing.T) {
+	start := time.Date(2026, 3, 2, 9, 0, 0, 0, time.UTC)
+	events := []Event{{
+		UID:         "a@openpam",
+		Start:       start,
+		End:         start.Add(2 * time.Hour),
+		Stamp:       start.Add(-time.Hour),
+		Sequence:    3,
+		Status:      StatusConfirmed,
+		Summary:     "Access to db01, primary; replica",
+		Description: "Target: db01 (ssh)\nReason: " + strings.Repeat("é", 60),
+		Alarm:       15 * time.Minute,
+	}}
+
+	var buf bytes.Buffer
+	if err := Write(&buf, "OpenPAM access", time.Hour, events); err != nil {
+		t.Fatalf("Write() error = %v", err)
+	}
+	out := buf.String()
+
+	for _, want := range []string{
+		"BEGIN:VCALENDAR\r\n",
+		"REFRESH-INTERVAL;VALUE=DURATION:PT1H\r\n",
+		"DTSTART:20260302T090000Z\r\n",
+		"DTEND:20260302T110000Z\r\n",
+		"SEQUENCE:3\r\n",
+		`SUMMARY:Access to db01\, primary\; replica` + "\r\n",
+		"TRIGGER:-PT15M\r\n",
+		"END:VCALENDAR\r\n",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("calendar lacks %q:\n%s", want, out)
+		}
+	}
+
+	// Long lines are folded without splitting characters
+	for _, line := range strings.Split(strings.TrimSuffix(out, "\r\n"), "\r\n") {
+		if len(line) > maxLineOctets {
+			t.Errorf("line of %d octets: %q", len(line), line)
+		}
+		if !strings.ContainsRune(line, '\uFFFD') && !utf8Valid(line) {
+			t.Errorf("line splits a character: %q", line)
+		}
+	}
+	unfolded := strings.ReplaceAll(out, "\r\n ", "")
+	if !strings.Contains(unfolded, `DESCRIPTION:Target: db01 (ssh)\nReason: `+strings.Repeat("é", 60)+"\r\n") {
+		t.Errorf("description doesn't unfold to the original:\n%s", unfolded)
+	}
+}
+
+func utf8Valid(s string) bool {
+	return strings.ToValidUTF8(s, "\uFFFD") == s
+}
+
+func TestEvents(t *testing.T) {
+	now := time.Date(2026, 3, 2, 12, 0, 0, 0, time.UTC)
+	viewer, requester := uuid.New(), uuid.New()
+	target := &models.Target{ID: uuid.New(), Name: "web01", Hostname: "web01.example.com", Protocol: models.ProtocolSSH, Port: 22}
+	weekly := "FREQ=WEEKLY;BYDAY=MO;COUNT=4"
+
+	schedules := []models.Schedule{
+		{
+			// Own request awaiting approval
+			ID: uuid.New(), UserID: viewer, TargetID: target.ID,
+			StartTime: now.Add(48 * time.Hour), EndTime: now.Add(50 * time.Hour),
+			Timezone: "UTC", ApprovalStatus: models.ApprovalStatusPending, Version: 1,
+		},
+		{
+			// Own recurring window, Mondays 09:00-17:00 from 23 February; the
+			// first has ended, the second is running
+			ID: uuid.New(), UserID: viewer, TargetID: target.ID,
+			StartTime: time.Date(2026, 2, 23, 9, 0, 0, 0, time.UTC), EndTime: time.Date(2026, 2, 23, 17, 0, 0, 0, time.UTC),
+			RecurrenceRule: &weekly, Timezone: "UTC", ApprovalStatus: models.ApprovalStatusApproved, Version: 2,
+		},
+		{
+			// Someone else's request, for an approver
+			ID: uuid.New(), UserID: requester, TargetID: target.ID,
+			StartTime: now.Add(24 * time.Hour), EndTime: now.Add(26 * time.Hour),
+			Timezone: "UTC", ApprovalStatus: models.ApprovalStatusPending, Version: 1,
+			Metadata: models.JSONB{"purpose": "change", "reason": "CHG-42"},
+		},
+	}
+
+	b := NewBuilder(fakeTargets{target.ID: target}, fakeUsers{requester: {ID: requester, Email: "alice@example.com"}}, "https://pam.example.com/")
+	events := b.Events(context.Background(), viewer, schedules, now)
+
+	// Three weekly windows are left, then the request and the pending window
+	if len(events) != 5 {
+		t.Fatalf("got %d events, want 5: %+v", len(events), events)
+	}
+	for i := 1; i < len(events); i++ {
+		if events[i].Start.Before(events[i-1].Start) {
+			t.Errorf("events out of order at %d", i)
+		}
+	}
+
+	running := events[0]
+	if !running.Start.Equal(time.Date(2026, 3, 2, 9, 0, 0, 0, time.UTC)) || running.Status != StatusConfirmed || running.Alarm == 0 {
+		t.Errorf("running window = %+v, want the confirmed window of 2 March with a reminder", running)
+	}
+	if running.Summary != "Access to web01" || running.Location != "web01.example.com" || running.URL != "https://pam.example.com/schedules" {
+		t.Errorf("running window = %+v", running)
+	}
+	if !strings.Contains(running.Description, "Host: web01.example.com:22") {
+		t.Errorf("description = %q, want the target's host", running.Description)
+	}
+	uids := make(map[string]bool)
+	for _, e := range events {
+		if uids[e.UID] {
+			t.Errorf("UID %s used twice", e.UID)
+		}
+		uids[e.UID] = true
+	}
+
+	request := events[1]
+	if request.Summary != "Access request: alice@example.com to web01" || request.Status != StatusTentative || request.Alarm != 0 {
+		t.Errorf("request = %+v", request)
+	}
+	if !strings.Contains(request.Description, "Requested by: alice@example.com") || !strings.Contains(request.Description, "Reason: CHG-42") {
+		t.Errorf("request description = %q", request.Description)
+	}
+
+	pending := events[2]
+	if pending.Summary != "Access to web01 (awaiting approval)" || pending.Status != StatusTentative {
+		t.Errorf("pending = %+v", pending)
+	}
+}
+
+func TestEvents_Horizon(t *testing.T) {
+	now := time.Date(2026, 3, 2, 12, 0, 0, 0, time.UTC)
+	daily := "FREQ=DAILY"
+	schedules := []models.Schedule{{
+		ID: uuid.New(), UserID: uuid.New(), TargetID: uuid.New(),
+		StartTime: now.Add(time.Hour), EndTime: now.Add(2 * time.Hour),
+		RecurrenceRule: &daily, Timezone: "UTC", ApprovalStatus: models.ApprovalStatusApproved,
+	}}
+
+	events := NewBuilder(fakeTargets{}, fakeUsers{}, "").Events(context.Background(), schedules[0].UserID, schedules, now)
+
+	if len(events) != 90 {
+		t.Errorf("got %d windows of a daily schedule, want 90 up to the horizon", len(events))
+	}
+	if events[0].Summary != "Access to a deleted target" {
+		t.Errorf("summary = %q for a missing target", events[0].Summary)
+	}
+}
@@ -0,0 +1,175 @@
+// Package calendar serves users' access windows as iCalendar (RFC 5545) feeds,
+// so approved schedules show up in Outlook or Google Calendar next to the
+// rest of their day and windows aren't missed. Feeds can also show requests
+// awaiting approval: the user's own, and those the user can decide. Windows
+// of recurring schedules are listed one by one up to a horizon, in UTC, so
+// calendar apps don't need to know the schedule's time zone rules.
+package calendar
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/VanCannon/openpam/gateway/internal/models"
+	"github.com/google/uuid"
+)
+
+// Horizon is how far ahead the windows of recurring schedules are listed
+const Horizon = 90 * 24 * time.Hour
+
+// MaxWindows is the most windows of one recurring schedule a feed lists
+const MaxWindows = 100
+
+// Refresh is how often calendar apps are asked to fetch the feed again
+const Refresh = time.Hour
+
+// reminder is how long before an approved window the user is reminded
+const reminder = 15 * time.Minute
+
+// TargetLookup finds the targets schedules grant access to
+type TargetLookup interface {
+	GetByID(ctx context.Context, id uuid.UUID) (*models.Target, error)
+}
+
+// UserLookup finds the users who requested schedules
+type UserLookup interface {
+	GetByID(ctx context.Context, id uuid.UUID) (*models.User, error)
+}
+
+// Builder turns schedules into calendar events
+type Builder struct {
+	targets     TargetLookup
+	users       UserLookup
+	frontendURL string
+}
+
+// NewBuilder creates an event builder. Events link to the schedules page of
+// the frontend at frontendURL.
+func NewBuilder(targets TargetLookup, users UserLookup, frontendURL string) *Builder {
+	return &Builder{
+		targets:     targets,
+		users:       users,
+		frontendURL: strings.TrimRight(frontendURL, "/"),
+	}
+}
+
+// Events returns the events of viewer's feed for schedules: one per window
+// that ends after now, soonest first
+func (b *Builder) Events(ctx context.Context, viewer uuid.UUID, schedules []models.Schedule, now time.Time) []Event {
+	targets := make(map[uuid.UUID]*models.Target)
+	users := make(map[uuid.UUID]*models.User)
+
+	var events []Event
+	for i := range schedules {
+		s := &schedules[i]
+
+		target, ok := targets[s.TargetID]
+		if !ok {
+			target, _ = b.targets.GetByID(ctx, s.TargetID)
+			targets[s.TargetID] = target
+		}
+		var requester *models.User
+		if s.UserID != viewer {
+			if requester, ok = users[s.UserID]; !ok {
+				requester, _ = b.users.GetByID(ctx, s.UserID)
+				users[s.UserID] = requester
+			}
+		}
+
+		events = append(events, b.scheduleEvents(s, target, requester, now)...)
+	}
+
+	sort.SliceStable(events, func(i, j int) bool { return events[i].Start.Before(events[j].Start) })
+	return events
+}
+
+// scheduleEvents returns the events of a schedule's windows. requester is set
+// for requests the viewer can decide, and target is nil if it was deleted.
+func (b *Builder) scheduleEvents(s *models.Schedule, target *models.Target, requester *models.User, now time.Time) []Event {
+	base := Event{
+		Stamp:       s.UpdatedAt,
+		Sequence:    s.Version,
+		Status:      StatusConfirmed,
+		Summary:     summary(s, target, requester),
+		Description: description(s, target, requester),
+		URL:         b.frontendURL + "/schedules",
+	}
+	if target != nil {
+		base.Location = target.Hostname
+	}
+	if s.ApprovalStatus == models.ApprovalStatusPending {
+		base.Status = StatusTentative
+	} else {
+		base.Alarm = reminder
+	}
+
+	recurring := s.RecurrenceRule != nil && *s.RecurrenceRule != ""
+	horizon := now.Add(Horizon)
+
+	var events []Event
+	at := now
+	for len(events) < MaxWindows {
+		start, end, ok := s.NextWindow(at)
+		if !ok || (recurring && start.After(horizon)) {
+			break
+		}
+
+		e := base
+		e.Start, e.End = start, end
+		e.UID = s.ID.String() + "@openpam"
+		if recurring {
+			e.UID = fmt.Sprintf("%s-%s@openpam", s.ID, start.UTC().Format(utcFormat))
+		}
+		events = append(events, e)
+
+		if !recurring || !end.After(at) {
+			break
+		}
+		at = end
+	}
+	return events
+}
+
+// summary is the title of a schedule's events
+func summary(s *models.Schedule, target *models.Target, requester *models.User) string {
+	name := "a deleted target"
+	if target != nil {
+		name = target.Name
+	}
+
+	switch {
+	case requester != nil:
+		return fmt.Sprintf("Access request: %s to %s", requester.Email, name)
+	case s.ApprovalStatus == models.ApprovalStatusPending:
+		return fmt.Sprintf("Access to %s (awaiting approval)", name)
+	}
+	return "Access to " + name
+}
+
+// description lists the target's details and what the request says
+func description(s *models.Schedule, target *models.Target, requester *models.User) string {
+	var lines []string
+	if target != nil {
+		lines = append(lines, fmt.Sprintf("Target: %s (%s)", target.Name, target.Protocol))
+		if target.Protocol == models.ProtocolSSH || target.Protocol == models.ProtocolRDP {
+			lines = append(lines, fmt.Sprintf("Host: %s:%d", target.Hostname, target.Port))
+		}
+		if target.Environment != "" {
+			lines = append(lines, "Environment: "+target.Environment)
+		}
+	}
+	if requester != nil {
+		lines = append(lines, "Requested by: "+requester.Email)
+	}
+	if purpose, reason := s.Purpose(); purpose != "" {
+		lines = append(lines, "Purpose: "+purpose)
+		if reason != "" {
+			lines = append(lines, "Reason: "+reason)
+		}
+	}
+	lines = append(lines, "Approval: "+s.ApprovalStatus)
+	return strings.Join(lines, "\n")
+}
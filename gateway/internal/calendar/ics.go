@@ -0,0 +1,141 @@
+package calendar
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// Event statuses
+const (
+	StatusConfirmed = "CONFIRMED" // An approved window
+	StatusTentative = "TENTATIVE" // A request awaiting approval
+)
+
+// Event is an event of an iCalendar
+type Event struct {
+	UID         string
+	Start       time.Time
+	End         time.Time
+	Stamp       time.Time // When the event last changed
+	Sequence    int       // Bumped on each change, so calendar apps take the update
+	Status      string    // One of the Status constants
+	Summary     string
+	Description string
+	Location    string
+	URL         string
+	Alarm       time.Duration // How long before the start to remind the user (0 = no reminder)
+}
+
+// maxLineOctets is the longest content line RFC 5545 allows before folding
+const maxLineOctets = 75
+
+// utcFormat is the iCalendar form of a UTC date-time
+const utcFormat = "20060102T150405Z"
+
+// Write writes events as an iCalendar named name. Calendar apps are asked to
+// refresh it every refresh.
+func Write(w io.Writer, name string, refresh time.Duration, events []Event) error {
+	bw := bufio.NewWriter(w)
+	line := func(name, value string) {
+		writeFolded(bw, name+":"+value)
+	}
+
+	line("BEGIN", "VCALENDAR")
+	line("VERSION", "2.0")
+	line("PRODID", "-//OpenPAM//Access Schedules//EN")
+	line("CALSCALE", "GREGORIAN")
+	line("METHOD", "PUBLISH")
+	line("X-WR-CALNAME", escapeText(name))
+	line("REFRESH-INTERVAL;VALUE=DURATION", duration(refresh))
+	line("X-PUBLISHED-TTL", duration(refresh))
+
+	for _, e := range events {
+		line("BEGIN", "VEVENT")
+		line("UID", e.UID)
+		line("DTSTAMP", e.Stamp.UTC().Format(utcFormat))
+		line("DTSTART", e.Start.UTC().Format(utcFormat))
+		line("DTEND", e.End.UTC().Format(utcFormat))
+		line("SEQUENCE", fmt.Sprint(e.Sequence))
+		line("STATUS", e.Status)
+		line("SUMMARY", escapeText(e.Summary))
+		if e.Description != "" {
+			line("DESCRIPTION", escapeText(e.Description))
+		}
+		if e.Location != "" {
+			line("LOCATION", escapeText(e.Location))
+		}
+		if e.URL != "" {
+			line("URL", e.URL)
+		}
+		// Access windows don't make the user busy
+		line("TRANSP", "TRANSPARENT")
+		if e.Alarm > 0 {
+			line("BEGIN", "VALARM")
+			line("ACTION", "DISPLAY")
+			line("DESCRIPTION", escapeText(e.Summary))
+			line("TRIGGER", "-"+duration(e.Alarm))
+			line("END", "VALARM")
+		}
+		line("END", "VEVENT")
+	}
+
+	line("END", "VCALENDAR")
+	return bw.Flush()
+}
+
+// escapeText escapes a TEXT value
+func escapeText(s string) string {
+	return strings.NewReplacer(
+		`\`, `\\`,
+		";", `\;`,
+		",", `\,`,
+		"\r\n", `\n`,
+		"\n", `\n`,
+		"\r", "",
+	).Replace(s)
+}
+
+// writeFolded writes a content line, folding it into lines of at most
+// maxLineOctets octets without splitting a character
+func writeFolded(w *bufio.Writer, line string) {
+	limit := maxLineOctets
+	for len(line) > limit {
+		cut := limit
+		for cut > 0 && !utf8.RuneStart(line[cut]) {
+			cut--
+		}
+		w.WriteString(line[:cut])
+		w.WriteString("\r\n ")
+		line = line[cut:]
+		// Continuation lines start with the space
+		limit = maxLineOctets - 1
+	}
+	w.WriteString(line)
+	w.WriteString("\r\n")
+}
+
+// duration formats d as an iCalendar duration, such as PT1H or PT15M
+func duration(d time.Duration) string {
+	d = d.Round(time.Second)
+	if d <= 0 {
+		return "PT0S"
+	}
+	var b strings.Builder
+	b.WriteString("PT")
+	if h := d / time.Hour; h > 0 {
+		fmt.Fprintf(&b, "%dH", h)
+		d -= h * time.Hour
+	}
+	if m := d / time.Minute; m > 0 {
+		fmt.Fprintf(&b, "%dM", m)
+		d -= m * time.Minute
+	}
+	if s := d / time.Second; s > 0 {
+		fmt.Fprintf(&b, "%dS", s)
+	}
+	return b.String()
+}
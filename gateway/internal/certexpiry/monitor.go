@@ -0,0 +1,162 @@
+// Package certexpiry alerts on client certificates of smart card credentials
+// that are about to expire, so they can be renewed before logons start failing.
+package certexpiry
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/VanCannon/openpam/gateway/internal/models"
+	"github.com/VanCannon/openpam/gateway/internal/notify"
+	"github.com/VanCannon/openpam/gateway/internal/worker"
+	"github.com/VanCannon/openpam/pkg/logger"
+	"github.com/google/uuid"
+)
+
+// CredentialStore is the subset of the credential repository the monitor needs
+type CredentialStore interface {
+	ListCertificatesExpiring(ctx context.Context, before time.Time) ([]*models.Credential, error)
+	MarkCertificateAlerted(ctx context.Context, id uuid.UUID, at time.Time) error
+}
+
+// AuditStore records the alerts in the system audit log
+type AuditStore interface {
+	CreateSimple(ctx context.Context, eventType string, userID *uuid.UUID, action string, status string, ipAddress *string, details map[string]interface{}) error
+}
+
+// Config holds when and to whom expiry alerts are sent
+type Config struct {
+	Interval        time.Duration // How often certificates are checked
+	Warning         time.Duration // How long before expiry the alert is sent
+	AlertRecipients []string      // Emailed about expiring certificates; audited only when empty
+}
+
+// Monitor periodically looks for certificates expiring within the warning
+// period. Each certificate is alerted on once, until a new one is uploaded.
+type Monitor struct {
+	store    CredentialStore
+	audit    AuditStore
+	notifier notify.Notifier
+	config   Config
+	logger   *logger.Logger
+
+	loop worker.Loop
+}
+
+// NewMonitor creates a new certificate expiry monitor
+func NewMonitor(store CredentialStore, audit AuditStore, notifier notify.Notifier, cfg Config, log *logger.Logger) *Monitor {
+	if cfg.Interval <= 0 {
+		cfg.Interval = time.Hour
+	}
+
+	return &Monitor{
+		store:    store,
+		audit:    audit,
+		notifier: notifier,
+		config:   cfg,
+		logger:   log,
+	}
+}
+
+// Start runs the monitor in the background until Stop is called
+func (m *Monitor) Start() {
+	m.loop.Start(m.run)
+}
+
+// Stop stops the monitor and waits for an in-progress check to finish.
+// It is safe to call even if the monitor was never started.
+func (m *Monitor) Stop() {
+	m.loop.Stop()
+}
+
+func (m *Monitor) run() {
+	ticker := time.NewTicker(m.config.Interval)
+	defer ticker.Stop()
+
+	for {
+		m.Check(time.Now())
+
+		select {
+		case <-m.loop.Stopping():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Check alerts on the certificates expiring within the warning period of now
+func (m *Monitor) Check(now time.Time) {
+	ctx, cancel := context.WithTimeout(context.Background(), m.config.Interval)
+	defer cancel()
+
+	creds, err := m.store.ListCertificatesExpiring(ctx, now.Add(m.config.Warning))
+	if err != nil {
+		m.logger.Error("Failed to list expiring certificates", map[string]interface{}{
+			"error": err.Error(),
+		})
+		return
+	}
+	if len(creds) == 0 {
+		return
+	}
+
+	lines := make([]string, 0, len(creds))
+	for _, cred := range creds {
+		expiresAt := *cred.CertificateExpiresAt
+		subject := ""
+		if cred.CertificateSubject != nil {
+			subject = *cred.CertificateSubject
+		}
+
+		status := "expires"
+		if !now.Before(expiresAt) {
+			status = "expired"
+		}
+		m.logger.Warn("Credential certificate "+status, map[string]interface{}{
+			"credential_id": cred.ID.String(),
+			"username":      cred.Username,
+			"expires_at":    expiresAt,
+		})
+
+		details := map[string]interface{}{
+			"credential_id": cred.ID.String(),
+			"target_id":     cred.TargetID.String(),
+			"username":      cred.Username,
+			"subject":       subject,
+			"expires_at":    expiresAt,
+		}
+		if err := m.audit.CreateSimple(ctx, models.EventTypeCertificateExpiring, nil, "expiry_alert", models.AuditStatusSuccess, nil, details); err != nil {
+			m.logger.Error("Failed to create system audit log", map[string]interface{}{
+				"error": err.Error(),
+			})
+		}
+
+		lines = append(lines, fmt.Sprintf("  %s (%s): %s %s", cred.Username, subject, status, expiresAt.UTC().Format(time.RFC3339)))
+	}
+
+	if len(m.config.AlertRecipients) > 0 {
+		msg := &notify.Message{
+			To:      m.config.AlertRecipients,
+			Subject: fmt.Sprintf("OpenPAM: %d smart card certificate(s) expiring", len(creds)),
+			Body: fmt.Sprintf("These client certificates used for smart card logon expire soon:\n\n%s\n\n"+
+				"Upload renewed certificates to their credentials before they expire.",
+				strings.Join(lines, "\n")),
+		}
+		if err := m.notifier.Send(ctx, msg); err != nil {
+			m.logger.Error("Failed to send certificate expiry alert", map[string]interface{}{
+				"error": err.Error(),
+			})
+		}
+	}
+
+	for _, cred := range creds {
+		if err := m.store.MarkCertificateAlerted(ctx, cred.ID, now); err != nil {
+			m.logger.Error("Failed to mark certificate alerted", map[string]interface{}{
+				"credential_id": cred.ID.String(),
+				"error":         err.Error(),
+			})
+		}
+	}
+}
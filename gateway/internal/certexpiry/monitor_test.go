@@ -0,0 +1,73 @@
+package certexpiry
+
+import (
+	"context"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/VanCannon/openpam/gateway/internal/models"
+	"github.com/VanCannon/openpam/gateway/internal/notify"
+	"github.com/VanCannon/openpam/pkg/logger"
+	"github.com/google/uuid"
+)
+
+type fakeStore struct {
+	creds   []*models.Credential
+	before  time.Time
+	alerted []uuid.UUID
+}
+
+func (s *fakeStore) ListCertificatesExpiring(ctx context.Context, before time.Time) ([]*models.Credential, error) {
+	s.before = before
+	return s.creds, nil
+}
+
+func (s *fakeStore) MarkCertificateAlerted(ctx context.Context, id uuid.UUID, at time.Time) error {
+	s.alerted = append(s.alerted, id)
+	return nil
+}
+
+type fakeAudit struct{ events []string }
+
+func (a *fakeAudit) CreateSimple(ctx context.Context, eventType string, userID *uuid.UUID, action string, status string, ipAddress *string, details map[string]interface{}) error {
+	a.events = append(a.events, eventType)
+	return nil
+}
+
+type fakeNotifier struct{ sent []*notify.Message }
+
+func (n *fakeNotifier) Send(ctx context.Context, msg *notify.Message) error {
+	n.sent = append(n.sent, msg)
+	return nil
+}
+
+func TestMonitor_Check(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	expires := now.Add(7 * 24 * time.Hour)
+	subject := "CN=alice"
+	cred := &models.Credential{ID: uuid.New(), Username: "alice", CertificateSubject: &subject, CertificateExpiresAt: &expires}
+
+	store := &fakeStore{creds: []*models.Credential{cred}}
+	audit := &fakeAudit{}
+	notifier := &fakeNotifier{}
+	monitor := NewMonitor(store, audit, notifier, Config{
+		Warning:         30 * 24 * time.Hour,
+		AlertRecipients: []string{"pki@example.com"},
+	}, logger.New(logger.LevelError, io.Discard))
+
+	monitor.Check(now)
+
+	if want := now.Add(30 * 24 * time.Hour); !store.before.Equal(want) {
+		t.Errorf("listed certificates expiring before %v, want %v", store.before, want)
+	}
+	if len(audit.events) != 1 || audit.events[0] != models.EventTypeCertificateExpiring {
+		t.Errorf("audit events = %v", audit.events)
+	}
+	if len(notifier.sent) != 1 || notifier.sent[0].To[0] != "pki@example.com" {
+		t.Errorf("sent = %v", notifier.sent)
+	}
+	if len(store.alerted) != 1 || store.alerted[0] != cred.ID {
+		t.Errorf("alerted = %v, want [%v]", store.alerted, cred.ID)
+	}
+}
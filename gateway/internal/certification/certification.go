@@ -0,0 +1,101 @@
+// Package certification runs access certification campaigns: periodic reviews in
+// which reviewers certify or revoke each user's entitlements.
+package certification
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/VanCannon/openpam/gateway/internal/models"
+	"github.com/VanCannon/openpam/gateway/internal/reports"
+	"github.com/google/uuid"
+)
+
+// AssignReviewers assigns each item a reviewer. All items of one user go to the
+// same reviewer, and reviewers take users in turn so the work is spread evenly.
+// Nobody reviews their own entitlements: a user whose turn lands on themselves
+// goes to the next reviewer, then to fallback, and is left unassigned (any admin
+// may decide) if there is nobody else.
+func AssignReviewers(items []*models.CertificationItem, reviewers []uuid.UUID, fallback *uuid.UUID) {
+	assigned := make(map[uuid.UUID]*uuid.UUID)
+	next := 0
+
+	for _, item := range items {
+		reviewer, ok := assigned[item.UserID]
+		if !ok {
+			reviewer = pickReviewer(item.UserID, reviewers, next, fallback)
+			assigned[item.UserID] = reviewer
+			if len(reviewers) > 0 {
+				next = (next + 1) % len(reviewers)
+			}
+		}
+		item.ReviewerID = reviewer
+	}
+}
+
+func pickReviewer(userID uuid.UUID, reviewers []uuid.UUID, start int, fallback *uuid.UUID) *uuid.UUID {
+	for i := range reviewers {
+		candidate := reviewers[(start+i)%len(reviewers)]
+		if candidate != userID {
+			return &candidate
+		}
+	}
+	if fallback != nil && *fallback != userID {
+		reviewer := *fallback
+		return &reviewer
+	}
+	return nil
+}
+
+// EvidenceTable builds the evidence report of a campaign: every item with its
+// decision, who made it and when the revocation was applied
+func EvidenceTable(campaign *models.CertificationCampaign, items []*models.CertificationItem) *reports.Table {
+	subtitle := fmt.Sprintf("Status: %s | Launched: %s | Due: %s",
+		campaign.Status, formatTime(&campaign.CreatedAt), formatTime(&campaign.DueAt))
+	if campaign.CompletedAt != nil {
+		subtitle += " | Completed: " + formatTime(campaign.CompletedAt)
+	}
+
+	table := &reports.Table{
+		Title:    "Access Certification: " + campaign.Name,
+		Subtitle: subtitle,
+		Columns: []string{
+			"User", "Entitlement Type", "Entitlement", "Reviewer", "Decision",
+			"Decided By", "Decided At", "Revocation Applied At", "Comment",
+		},
+	}
+
+	for _, item := range items {
+		comment := ""
+		if item.Comment != nil {
+			comment = *item.Comment
+		}
+		table.Rows = append(table.Rows, []string{
+			item.UserEmail,
+			item.EntitlementType,
+			item.EntitlementDescription,
+			formatID(item.ReviewerID),
+			item.Decision,
+			formatID(item.DecidedBy),
+			formatTime(item.DecidedAt),
+			formatTime(item.ExecutedAt),
+			comment,
+		})
+	}
+
+	return table
+}
+
+func formatID(id *uuid.UUID) string {
+	if id == nil {
+		return ""
+	}
+	return id.String()
+}
+
+func formatTime(t *time.Time) string {
+	if t == nil {
+		return ""
+	}
+	return t.UTC().Format(time.RFC3339)
+}
@@ -0,0 +1,126 @@
+package certification
+
+import (
+	"context"
+	"errors"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/VanCannon/openpam/gateway/internal/models"
+	"github.com/VanCannon/openpam/pkg/logger"
+	"github.com/google/uuid"
+)
+
+func TestAssignReviewers_SpreadsUsersAndSkipsSelf(t *testing.T) {
+	alice, bob, carol := uuid.New(), uuid.New(), uuid.New()
+
+	items := []*models.CertificationItem{
+		{UserID: alice, EntitlementType: models.EntitlementTypeRole},
+		{UserID: alice, EntitlementType: models.EntitlementTypeCredentialRule},
+		{UserID: bob, EntitlementType: models.EntitlementTypeRole},
+		{UserID: carol, EntitlementType: models.EntitlementTypeSchedule},
+	}
+
+	// Alice is a reviewer but her turn lands on herself
+	AssignReviewers(items, []uuid.UUID{alice, bob}, nil)
+
+	want := []uuid.UUID{bob, bob, alice, alice}
+	for i, item := range items {
+		if item.ReviewerID == nil || *item.ReviewerID != want[i] {
+			t.Errorf("item %d reviewer = %v, want %v", i, item.ReviewerID, want[i])
+		}
+	}
+}
+
+func TestAssignReviewers_Fallback(t *testing.T) {
+	admin, other := uuid.New(), uuid.New()
+
+	items := []*models.CertificationItem{
+		{UserID: other},
+		{UserID: admin},
+	}
+
+	AssignReviewers(items, nil, &admin)
+
+	if items[0].ReviewerID == nil || *items[0].ReviewerID != admin {
+		t.Errorf("reviewer = %v, want fallback %v", items[0].ReviewerID, admin)
+	}
+	if items[1].ReviewerID != nil {
+		t.Errorf("fallback reviewer assigned their own entitlement")
+	}
+}
+
+type fakeStore struct {
+	overdue   []uuid.UUID
+	revoked   map[uuid.UUID][]*models.CertificationItem
+	completed []uuid.UUID
+}
+
+func (f *fakeStore) ListOverdue(ctx context.Context, now time.Time) ([]uuid.UUID, error) {
+	return f.overdue, nil
+}
+
+func (f *fakeStore) Complete(ctx context.Context, campaignID uuid.UUID) ([]*models.CertificationItem, error) {
+	for _, id := range f.completed {
+		if id == campaignID {
+			return nil, errors.New("active campaign not found")
+		}
+	}
+	f.completed = append(f.completed, campaignID)
+	return f.revoked[campaignID], nil
+}
+
+type fakeAudit struct {
+	events []string
+}
+
+func (f *fakeAudit) CreateSimple(ctx context.Context, eventType string, userID *uuid.UUID, action string, status string, ipAddress *string, details map[string]interface{}) error {
+	f.events = append(f.events, eventType)
+	return nil
+}
+
+func TestCloser_CloseOverdueRecordsRevocations(t *testing.T) {
+	campaignA, campaignB := uuid.New(), uuid.New()
+	store := &fakeStore{
+		overdue: []uuid.UUID{campaignA, campaignB},
+		revoked: map[uuid.UUID][]*models.CertificationItem{
+			campaignA: {
+				{ID: uuid.New(), CampaignID: campaignA, UserID: uuid.New(), EntitlementType: models.EntitlementTypeRole},
+			},
+		},
+	}
+	audit := &fakeAudit{}
+	closer := NewCloser(store, audit, time.Minute, logger.New(logger.LevelError, io.Discard))
+
+	closer.CloseOverdue(time.Now())
+
+	if len(store.completed) != 2 {
+		t.Fatalf("completed %d campaigns, want 2", len(store.completed))
+	}
+
+	want := []string{
+		models.EventTypeEntitlementRevoked,
+		models.EventTypeCertificationCompleted,
+		models.EventTypeCertificationCompleted,
+	}
+	if len(audit.events) != len(want) {
+		t.Fatalf("audit events = %v, want %v", audit.events, want)
+	}
+	for i := range want {
+		if audit.events[i] != want[i] {
+			t.Errorf("audit event %d = %s, want %s", i, audit.events[i], want[i])
+		}
+	}
+
+	// A second pass finds the campaigns already completed and records nothing
+	closer.CloseOverdue(time.Now())
+	if len(audit.events) != len(want) {
+		t.Errorf("second pass recorded %d more events", len(audit.events)-len(want))
+	}
+}
+
+func TestCloser_StopWithoutStart(t *testing.T) {
+	closer := NewCloser(&fakeStore{}, &fakeAudit{}, time.Minute, logger.New(logger.LevelError, io.Discard))
+	closer.Stop()
+}
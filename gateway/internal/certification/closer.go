@@ -0,0 +1,155 @@
+package certification
+
+import (
+	"context"
+	"time"
+
+	"github.com/VanCannon/openpam/gateway/internal/models"
+	"github.com/VanCannon/openpam/gateway/internal/worker"
+	"github.com/VanCannon/openpam/pkg/logger"
+	"github.com/google/uuid"
+)
+
+// Store is the subset of the certification repository the closer needs
+type Store interface {
+	ListOverdue(ctx context.Context, now time.Time) ([]uuid.UUID, error)
+	Complete(ctx context.Context, campaignID uuid.UUID) ([]*models.CertificationItem, error)
+}
+
+// AuditRecorder records system audit events
+type AuditRecorder interface {
+	CreateSimple(ctx context.Context, eventType string, userID *uuid.UUID, action string, status string, ipAddress *string, details map[string]interface{}) error
+}
+
+// Closer completes campaigns, either on request or once they are past due
+type Closer struct {
+	store    Store
+	audit    AuditRecorder
+	interval time.Duration
+	logger   *logger.Logger
+
+	loop worker.Loop
+}
+
+// NewCloser creates a closer that checks for overdue campaigns every interval
+func NewCloser(store Store, audit AuditRecorder, interval time.Duration, log *logger.Logger) *Closer {
+	if interval <= 0 {
+		interval = time.Minute
+	}
+
+	return &Closer{
+		store:    store,
+		audit:    audit,
+		interval: interval,
+		logger:   log,
+	}
+}
+
+// Start runs the closer in the background until Stop is called
+func (c *Closer) Start() {
+	c.loop.Start(c.run)
+}
+
+// Stop stops the closer and waits for an in-progress pass to finish.
+// It is safe to call even if the closer was never started.
+func (c *Closer) Stop() {
+	c.loop.Stop()
+}
+
+func (c *Closer) run() {
+	ticker := time.NewTicker(c.interval)
+	defer ticker.Stop()
+
+	for {
+		c.CloseOverdue(time.Now())
+
+		select {
+		case <-c.loop.Stopping():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// CloseOverdue completes every active campaign due at or before now
+func (c *Closer) CloseOverdue(now time.Time) {
+	ctx, cancel := context.WithTimeout(context.Background(), c.interval)
+	defer cancel()
+
+	ids, err := c.store.ListOverdue(ctx, now)
+	if err != nil {
+		c.logger.Error("Failed to list overdue certification campaigns", map[string]interface{}{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	for _, id := range ids {
+		if err := c.Complete(ctx, id, nil); err != nil {
+			c.logger.Error("Failed to complete overdue certification campaign", map[string]interface{}{
+				"campaign_id": id.String(),
+				"error":       err.Error(),
+			})
+		}
+	}
+}
+
+// Complete closes a campaign and records the revocations made on close. closedBy
+// is nil when the campaign closed because it was due.
+func (c *Closer) Complete(ctx context.Context, campaignID uuid.UUID, closedBy *uuid.UUID) error {
+	revoked, err := c.store.Complete(ctx, campaignID)
+	if err != nil {
+		return err
+	}
+
+	for _, item := range revoked {
+		c.RecordRevocation(ctx, item, nil)
+	}
+
+	reason := "due"
+	if closedBy != nil {
+		reason = "closed"
+	}
+
+	c.record(ctx, models.EventTypeCertificationCompleted, closedBy, "complete_campaign", map[string]interface{}{
+		"campaign_id":      campaignID.String(),
+		"reason":           reason,
+		"revoked_on_close": len(revoked),
+	})
+
+	c.logger.Info("Certification campaign completed", map[string]interface{}{
+		"campaign_id":      campaignID.String(),
+		"reason":           reason,
+		"revoked_on_close": len(revoked),
+	})
+
+	return nil
+}
+
+// RecordRevocation records an applied revocation in the system audit log.
+// revokedBy is nil for revocations made when a campaign closed.
+func (c *Closer) RecordRevocation(ctx context.Context, item *models.CertificationItem, revokedBy *uuid.UUID) {
+	details := map[string]interface{}{
+		"campaign_id":      item.CampaignID.String(),
+		"item_id":          item.ID.String(),
+		"user_id":          item.UserID.String(),
+		"user_email":       item.UserEmail,
+		"entitlement_type": item.EntitlementType,
+		"entitlement":      item.EntitlementDescription,
+	}
+	if item.EntitlementID != nil {
+		details["entitlement_id"] = item.EntitlementID.String()
+	}
+
+	c.record(ctx, models.EventTypeEntitlementRevoked, revokedBy, "revoke_entitlement", details)
+}
+
+func (c *Closer) record(ctx context.Context, eventType string, userID *uuid.UUID, action string, details map[string]interface{}) {
+	err := c.audit.CreateSimple(ctx, eventType, userID, action, "success", nil, details)
+	if err != nil {
+		c.logger.Error("Failed to record certification audit event", map[string]interface{}{
+			"event_type": eventType,
+			"error":      err.Error(),
+		})
+	}
+}
@@ -0,0 +1,170 @@
+package cloud
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/VanCannon/openpam/gateway/internal/awssig"
+)
+
+// assumeRoleResponse is the part of an STS AssumeRole response the broker reads
+type assumeRoleResponse struct {
+	Result struct {
+		AssumedRoleUser struct {
+			Arn           string `xml:"Arn"`
+			AssumedRoleID string `xml:"AssumedRoleId"`
+		} `xml:"AssumedRoleUser"`
+		Credentials struct {
+			AccessKeyID     string    `xml:"AccessKeyId"`
+			SecretAccessKey string    `xml:"SecretAccessKey"`
+			SessionToken    string    `xml:"SessionToken"`
+			Expiration      time.Time `xml:"Expiration"`
+		} `xml:"Credentials"`
+	} `xml:"AssumeRoleResult"`
+}
+
+// stsError is an STS error response
+type stsError struct {
+	Error struct {
+		Code    string `xml:"Code"`
+		Message string `xml:"Message"`
+	} `xml:"Error"`
+}
+
+// startAWS assumes the role and signs the user in to the console with the
+// temporary credentials
+func (b *Broker) startAWS(ctx context.Context, req Request) (*Grant, error) {
+	if !strings.HasPrefix(req.Role, "arn:aws") || !strings.Contains(req.Role, ":role/") {
+		return nil, ErrInvalidRole
+	}
+
+	name := SessionName(req.UserEmail)
+	creds, roleID, err := b.assumeRole(ctx, req, name)
+	if err != nil {
+		return nil, err
+	}
+
+	consoleURL, err := b.signinURLFor(ctx, creds)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Grant{
+		Provider:    req.Provider,
+		Role:        req.Role,
+		SessionName: name,
+		ExternalID:  roleID,
+		ConsoleURL:  consoleURL,
+		ExpiresAt:   creds.Expiration,
+		Credentials: creds,
+	}, nil
+}
+
+// assumeRole calls STS AssumeRole with the broker's access key. The session
+// name, and optionally the source identity, record the user in CloudTrail.
+func (b *Broker) assumeRole(ctx context.Context, req Request, name string) (*AWSCredentials, string, error) {
+	form := url.Values{}
+	form.Set("Action", "AssumeRole")
+	form.Set("Version", "2011-06-15")
+	form.Set("RoleArn", req.Role)
+	form.Set("RoleSessionName", name)
+	form.Set("DurationSeconds", strconv.Itoa(int(req.Duration/time.Second)))
+	if b.cfg.AWSSourceIdentity {
+		form.Set("SourceIdentity", name)
+	}
+	body := []byte(form.Encode())
+
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, b.stsURL, bytes.NewReader(body))
+	if err != nil {
+		return nil, "", err
+	}
+	httpReq.Header.Set("Content-Type", "application/x-www-form-urlencoded; charset=utf-8")
+	awssig.Sign(httpReq, body, req.Key, req.Secret, b.cfg.AWSRegion, "sts", time.Now())
+
+	resp, err := b.http.Do(httpReq)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to call STS: %w", err)
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to read STS response: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		var e stsError
+		if xml.Unmarshal(data, &e) == nil && e.Error.Code != "" {
+			return nil, "", fmt.Errorf("STS AssumeRole failed: %s: %s", e.Error.Code, e.Error.Message)
+		}
+		return nil, "", fmt.Errorf("STS AssumeRole failed: status %d", resp.StatusCode)
+	}
+
+	var out assumeRoleResponse
+	if err := xml.Unmarshal(data, &out); err != nil {
+		return nil, "", fmt.Errorf("failed to decode STS response: %w", err)
+	}
+	c := out.Result.Credentials
+	if c.AccessKeyID == "" || c.SessionToken == "" {
+		return nil, "", fmt.Errorf("STS response has no credentials")
+	}
+
+	return &AWSCredentials{
+		AccessKeyID:     c.AccessKeyID,
+		SecretAccessKey: c.SecretAccessKey,
+		SessionToken:    c.SessionToken,
+		Expiration:      c.Expiration,
+	}, out.Result.AssumedRoleUser.AssumedRoleID, nil
+}
+
+// signinURLFor exchanges temporary credentials for a sign-in token and returns
+// the federation URL that logs the user in to the console with it
+func (b *Broker) signinURLFor(ctx context.Context, creds *AWSCredentials) (string, error) {
+	session, err := json.Marshal(map[string]string{
+		"sessionId":    creds.AccessKeyID,
+		"sessionKey":   creds.SecretAccessKey,
+		"sessionToken": creds.SessionToken,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	query := url.Values{}
+	query.Set("Action", "getSigninToken")
+	query.Set("Session", string(session))
+
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodGet, b.signinURL+"?"+query.Encode(), nil)
+	if err != nil {
+		return "", err
+	}
+	resp, err := b.http.Do(httpReq)
+	if err != nil {
+		return "", fmt.Errorf("failed to get sign-in token: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("failed to get sign-in token: status %d", resp.StatusCode)
+	}
+	var token struct {
+		SigninToken string `json:"SigninToken"`
+	}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(&token); err != nil || token.SigninToken == "" {
+		return "", fmt.Errorf("failed to decode sign-in token response")
+	}
+
+	login := url.Values{}
+	login.Set("Action", "login")
+	login.Set("Issuer", b.cfg.Issuer)
+	login.Set("Destination", b.cfg.AWSConsoleURL)
+	login.Set("SigninToken", token.SigninToken)
+	return b.signinURL + "?" + login.Encode(), nil
+}
@@ -0,0 +1,207 @@
+package cloud
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/clientcredentials"
+)
+
+// azureRole is a role named by an Azure credential: a role definition and the
+// scope it is activated at
+type azureRole struct {
+	definition string
+	scope      string
+}
+
+// resource reports whether the role is an Azure resource role, activated
+// through Azure Resource Manager, rather than an Entra ID directory role,
+// activated through Microsoft Graph
+func (r azureRole) resource() bool {
+	return strings.HasPrefix(r.scope, "/subscriptions/") ||
+		strings.HasPrefix(r.scope, "/providers/Microsoft.Management/managementGroups/")
+}
+
+// parseAzureRole parses "<role definition ID>[@<scope>]". Directory roles
+// default to the whole directory. A resource role definition may be given as
+// its GUID alone.
+func parseAzureRole(s string) (azureRole, error) {
+	definition, scope, _ := strings.Cut(strings.TrimSpace(s), "@")
+	if definition == "" {
+		return azureRole{}, ErrInvalidRole
+	}
+	if scope == "" {
+		scope = "/"
+	}
+	if !strings.HasPrefix(scope, "/") {
+		return azureRole{}, ErrInvalidRole
+	}
+
+	role := azureRole{definition: definition, scope: strings.TrimRight(scope, "/")}
+	if role.scope == "" {
+		role.scope = "/"
+	}
+	if role.resource() && !strings.Contains(definition, "/") {
+		role.definition = role.scope + "/providers/Microsoft.Authorization/roleDefinitions/" + definition
+	}
+	return role, nil
+}
+
+// azureError is a Graph or Resource Manager error response
+type azureError struct {
+	Error struct {
+		Code    string `json:"code"`
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+// startAzure activates the role for the user as a PIM assignment that expires
+// when the session does
+func (b *Broker) startAzure(ctx context.Context, req Request) (*Grant, error) {
+	if req.PrincipalID == "" {
+		return nil, ErrNoPrincipal
+	}
+	role, err := parseAzureRole(req.Role)
+	if err != nil {
+		return nil, err
+	}
+
+	start := time.Now().UTC()
+	end := start.Add(req.Duration)
+	justification := req.Justification
+	if justification == "" {
+		justification = "OpenPAM session for " + req.UserEmail
+	}
+
+	var id, consoleURL string
+	if role.resource() {
+		id, err = b.activateResourceRole(ctx, req, role, justification, start, end)
+		consoleURL = fmt.Sprintf("%s/#@%s/resource%s", b.portalURL, url.PathEscape(req.Account), role.scope)
+	} else {
+		id, err = b.activateDirectoryRole(ctx, req, role, justification, start, end)
+		consoleURL = fmt.Sprintf("%s/#@%s", b.portalURL, url.PathEscape(req.Account))
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &Grant{
+		Provider:    req.Provider,
+		Role:        req.Role,
+		SessionName: SessionName(req.UserEmail),
+		ExternalID:  id,
+		ConsoleURL:  consoleURL,
+		ExpiresAt:   end,
+	}, nil
+}
+
+// activateDirectoryRole requests an Entra ID role assignment through Graph
+func (b *Broker) activateDirectoryRole(ctx context.Context, req Request, role azureRole, justification string, start, end time.Time) (string, error) {
+	body := map[string]interface{}{
+		"action":           "adminAssign",
+		"justification":    justification,
+		"roleDefinitionId": role.definition,
+		"directoryScopeId": role.scope,
+		"principalId":      req.PrincipalID,
+		"scheduleInfo":     scheduleInfo(start, end, "afterDateTime"),
+	}
+
+	var out struct {
+		ID string `json:"id"`
+	}
+	endpoint := b.graphURL + "/roleManagement/directory/roleAssignmentScheduleRequests"
+	if err := b.azureCall(ctx, req, "https://graph.microsoft.com/.default", http.MethodPost, endpoint, body, &out); err != nil {
+		return "", err
+	}
+	return out.ID, nil
+}
+
+// activateResourceRole requests an Azure resource role assignment through
+// Resource Manager
+func (b *Broker) activateResourceRole(ctx context.Context, req Request, role azureRole, justification string, start, end time.Time) (string, error) {
+	body := map[string]interface{}{
+		"properties": map[string]interface{}{
+			"principalId":      req.PrincipalID,
+			"roleDefinitionId": role.definition,
+			"requestType":      "AdminAssign",
+			"justification":    justification,
+			"scheduleInfo":     scheduleInfo(start, end, "AfterDateTime"),
+		},
+	}
+
+	var out struct {
+		Name string `json:"name"`
+	}
+	endpoint := fmt.Sprintf("%s%s/providers/Microsoft.Authorization/roleAssignmentScheduleRequests/%s?api-version=2020-10-01",
+		b.armURL, role.scope, uuid.NewString())
+	if err := b.azureCall(ctx, req, "https://management.azure.com/.default", http.MethodPut, endpoint, body, &out); err != nil {
+		return "", err
+	}
+	return out.Name, nil
+}
+
+// scheduleInfo is an assignment schedule from start to end. Graph and
+// Resource Manager spell the expiration type differently.
+func scheduleInfo(start, end time.Time, expirationType string) map[string]interface{} {
+	return map[string]interface{}{
+		"startDateTime": start.Format(time.RFC3339),
+		"expiration": map[string]string{
+			"type":        expirationType,
+			"endDateTime": end.Format(time.RFC3339),
+		},
+	}
+}
+
+// azureCall sends a request as the broker application, authenticated with a
+// client credentials token for scope from the target's tenant
+func (b *Broker) azureCall(ctx context.Context, req Request, scope, method, endpoint string, body, out interface{}) error {
+	tokens := &clientcredentials.Config{
+		ClientID:     req.Key,
+		ClientSecret: req.Secret,
+		TokenURL:     b.loginURL + "/" + url.PathEscape(req.Account) + "/oauth2/v2.0/token",
+		Scopes:       []string{scope},
+	}
+	client := tokens.Client(context.WithValue(ctx, oauth2.HTTPClient, b.http))
+
+	data, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	httpReq, err := http.NewRequestWithContext(ctx, method, endpoint, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+
+	resp, err := client.Do(httpReq)
+	if err != nil {
+		return fmt.Errorf("failed to activate Azure role: %w", err)
+	}
+	defer resp.Body.Close()
+
+	data, err = io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return fmt.Errorf("failed to read Azure response: %w", err)
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		var e azureError
+		if json.Unmarshal(data, &e) == nil && e.Error.Code != "" {
+			return fmt.Errorf("Azure role activation failed: %s: %s", e.Error.Code, e.Error.Message)
+		}
+		return fmt.Errorf("Azure role activation failed: status %d", resp.StatusCode)
+	}
+
+	if err := json.Unmarshal(data, out); err != nil {
+		return fmt.Errorf("failed to decode Azure response: %w", err)
+	}
+	return nil
+}
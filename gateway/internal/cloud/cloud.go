@@ -0,0 +1,175 @@
+// Package cloud brokers cloud console sessions. For an AWS target the gateway
+// assumes an IAM role with STS on behalf of the user and turns the temporary
+// credentials into a federated console sign-in URL; for an Azure target it
+// activates a PIM role for the user's Entra ID identity until the session ends.
+//
+// On cloud targets the target hostname is the AWS account ID or the Azure
+// tenant ID, and each credential names a role: its username is the IAM role
+// ARN, or an Azure role definition ID with an optional "@scope", and its Vault
+// secret holds the broker identity that grants the role (an IAM access key, or
+// an Entra ID application's client ID and secret).
+package cloud
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/VanCannon/openpam/gateway/internal/models"
+)
+
+// Shortest sessions the providers will grant
+const (
+	minAWSDuration   = 15 * time.Minute
+	minAzureDuration = 5 * time.Minute
+)
+
+var (
+	// ErrNotCloud is returned for targets that are not cloud consoles
+	ErrNotCloud = errors.New("target is not a cloud console")
+	// ErrNoPrincipal is returned when an Azure role is requested for a user
+	// without an Entra ID identity
+	ErrNoPrincipal = errors.New("user has no Entra ID identity to activate the role for")
+	// ErrInvalidRole is returned when a credential does not name a role the
+	// provider accepts
+	ErrInvalidRole = errors.New("credential does not name a valid role")
+	// ErrTooShort is returned when less time is left than the provider's
+	// shortest session
+	ErrTooShort = errors.New("too little time left for a session")
+)
+
+// Config configures the broker
+type Config struct {
+	SessionDuration   time.Duration // Default and longest session length
+	AWSRegion         string        // Region of the STS endpoint
+	AWSConsoleURL     string        // Where users land after signing in
+	AWSSourceIdentity bool          // Set the user as source identity; the role's trust policy must allow sts:SetSourceIdentity
+	Issuer            string        // Shown on AWS's sign-out page; the OpenPAM URL
+}
+
+// Validate checks the configuration
+func (c Config) Validate() error {
+	if c.SessionDuration < minAWSDuration || c.SessionDuration > 12*time.Hour {
+		return fmt.Errorf("CLOUD_SESSION_DURATION must be between 15m and 12h")
+	}
+	if c.AWSRegion == "" {
+		return fmt.Errorf("CLOUD_AWS_REGION is required")
+	}
+	return nil
+}
+
+// Request asks for a session on a cloud target
+type Request struct {
+	Provider      string        // Target protocol: aws or azure
+	Account       string        // AWS account ID or Azure tenant ID
+	Role          string        // The credential's username
+	Key           string        // Broker access key ID or client ID
+	Secret        string        // Broker secret access key or client secret
+	UserEmail     string        // Who the session is for
+	PrincipalID   string        // The user's Entra ID object ID (Azure)
+	Justification string        // Recorded with Azure role activations
+	Duration      time.Duration // How long the session lasts
+}
+
+// AWSCredentials are temporary STS credentials
+type AWSCredentials struct {
+	AccessKeyID     string    `json:"access_key_id"`
+	SecretAccessKey string    `json:"secret_access_key"`
+	SessionToken    string    `json:"session_token"`
+	Expiration      time.Time `json:"expiration"`
+}
+
+// Grant is a brokered session
+type Grant struct {
+	Provider    string          `json:"provider"`
+	Role        string          `json:"role"`
+	SessionName string          `json:"session_name"`
+	ExternalID  string          `json:"external_id,omitempty"` // Assumed role ID or PIM request ID
+	ConsoleURL  string          `json:"console_url"`
+	ExpiresAt   time.Time       `json:"expires_at"`
+	Credentials *AWSCredentials `json:"credentials,omitempty"`
+}
+
+// Broker grants cloud console sessions
+type Broker struct {
+	cfg  Config
+	http *http.Client
+
+	stsURL    string
+	signinURL string
+	loginURL  string
+	graphURL  string
+	armURL    string
+	portalURL string
+}
+
+// NewBroker creates a broker
+func NewBroker(cfg Config) *Broker {
+	if cfg.AWSConsoleURL == "" {
+		cfg.AWSConsoleURL = "https://console.aws.amazon.com/"
+	}
+	return &Broker{
+		cfg:       cfg,
+		http:      &http.Client{Timeout: 30 * time.Second},
+		stsURL:    fmt.Sprintf("https://sts.%s.amazonaws.com/", cfg.AWSRegion),
+		signinURL: "https://signin.aws.amazon.com/federation",
+		loginURL:  "https://login.microsoftonline.com",
+		graphURL:  "https://graph.microsoft.com/v1.0",
+		armURL:    "https://management.azure.com",
+		portalURL: "https://portal.azure.com",
+	}
+}
+
+// SessionDuration is the default and longest session length
+func (b *Broker) SessionDuration() time.Duration {
+	return b.cfg.SessionDuration
+}
+
+// MinDuration is the shortest session the provider grants
+func MinDuration(provider string) time.Duration {
+	if provider == models.ProtocolAzure {
+		return minAzureDuration
+	}
+	return minAWSDuration
+}
+
+// Start grants a session
+func (b *Broker) Start(ctx context.Context, req Request) (*Grant, error) {
+	if req.Duration < MinDuration(req.Provider) {
+		return nil, ErrTooShort
+	}
+
+	switch req.Provider {
+	case models.ProtocolAWS:
+		return b.startAWS(ctx, req)
+	case models.ProtocolAzure:
+		return b.startAzure(ctx, req)
+	default:
+		return nil, ErrNotCloud
+	}
+}
+
+// SessionName derives a provider-safe session name from the user's email: STS
+// accepts 2 to 64 characters of letters, digits and +=,.@-
+func SessionName(email string) string {
+	var b strings.Builder
+	for _, r := range email {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', strings.ContainsRune("_+=,.@-", r):
+			b.WriteRune(r)
+		default:
+			b.WriteByte('-')
+		}
+	}
+	name := b.String()
+	if len(name) > 64 {
+		name = name[:64]
+	}
+	for len(name) < 2 {
+		name += "-"
+	}
+	return name
+}
@@ -0,0 +1,208 @@
+package cloud
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/VanCannon/openpam/gateway/internal/models"
+)
+
+func TestSessionName(t *testing.T) {
+	tests := map[string]string{
+		"alice@example.com":     "alice@example.com",
+		"bob smith@example.com": "bob-smith@example.com",
+		"":                      "--",
+		strings.Repeat("a", 70): strings.Repeat("a", 64),
+	}
+	for email, want := range tests {
+		if got := SessionName(email); got != want {
+			t.Errorf("SessionName(%q) = %q, want %q", email, got, want)
+		}
+	}
+}
+
+func TestStartAWS(t *testing.T) {
+	var form url.Values
+	mux := http.NewServeMux()
+	mux.HandleFunc("/sts", func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256 Credential=AKIDBROKER/") {
+			t.Errorf("request not signed with the broker key: %s", r.Header.Get("Authorization"))
+		}
+		r.ParseForm()
+		form = r.PostForm
+		w.Write([]byte(`<AssumeRoleResponse xmlns="https://sts.amazonaws.com/doc/2011-06-15/">
+  <AssumeRoleResult>
+    <AssumedRoleUser>
+      <Arn>arn:aws:sts::123456789012:assumed-role/ReadOnly/alice@example.com</Arn>
+      <AssumedRoleId>AROA3XFRBF535PLBIFPI4:alice@example.com</AssumedRoleId>
+    </AssumedRoleUser>
+    <Credentials>
+      <AccessKeyId>ASIATEMP</AccessKeyId>
+      <SecretAccessKey>secret</SecretAccessKey>
+      <SessionToken>token</SessionToken>
+      <Expiration>2030-01-01T01:00:00Z</Expiration>
+    </Credentials>
+  </AssumeRoleResult>
+</AssumeRoleResponse>`))
+	})
+	mux.HandleFunc("/federation", func(w http.ResponseWriter, r *http.Request) {
+		var session map[string]string
+		json.Unmarshal([]byte(r.URL.Query().Get("Session")), &session)
+		if r.URL.Query().Get("Action") != "getSigninToken" || session["sessionId"] != "ASIATEMP" || session["sessionToken"] != "token" {
+			t.Errorf("unexpected sign-in token request: %s", r.URL.RawQuery)
+		}
+		w.Write([]byte(`{"SigninToken":"signin-token"}`))
+	})
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	b := NewBroker(Config{SessionDuration: time.Hour, AWSRegion: "us-east-1", Issuer: "https://pam.example.com"})
+	b.stsURL = srv.URL + "/sts"
+	b.signinURL = srv.URL + "/federation"
+
+	grant, err := b.Start(context.Background(), Request{
+		Provider:  models.ProtocolAWS,
+		Account:   "123456789012",
+		Role:      "arn:aws:iam::123456789012:role/ReadOnly",
+		Key:       "AKIDBROKER",
+		Secret:    "broker-secret",
+		UserEmail: "alice@example.com",
+		Duration:  30 * time.Minute,
+	})
+	if err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+
+	if form.Get("RoleArn") != "arn:aws:iam::123456789012:role/ReadOnly" || form.Get("RoleSessionName") != "alice@example.com" ||
+		form.Get("DurationSeconds") != "1800" || form.Get("SourceIdentity") != "" {
+		t.Errorf("AssumeRole form = %v", form)
+	}
+	if grant.ExternalID != "AROA3XFRBF535PLBIFPI4:alice@example.com" || grant.Credentials.AccessKeyID != "ASIATEMP" {
+		t.Errorf("grant = %+v", grant)
+	}
+	if !grant.ExpiresAt.Equal(time.Date(2030, 1, 1, 1, 0, 0, 0, time.UTC)) {
+		t.Errorf("ExpiresAt = %s", grant.ExpiresAt)
+	}
+
+	login, _ := url.Parse(grant.ConsoleURL)
+	q := login.Query()
+	if q.Get("Action") != "login" || q.Get("SigninToken") != "signin-token" ||
+		q.Get("Destination") != "https://console.aws.amazon.com/" || q.Get("Issuer") != "https://pam.example.com" {
+		t.Errorf("ConsoleURL = %s", grant.ConsoleURL)
+	}
+}
+
+func TestStartAWS_Denied(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusForbidden)
+		w.Write([]byte(`<ErrorResponse><Error><Type>Sender</Type><Code>AccessDenied</Code>` +
+			`<Message>not authorized to perform sts:AssumeRole</Message></Error></ErrorResponse>`))
+	}))
+	defer srv.Close()
+
+	b := NewBroker(Config{SessionDuration: time.Hour, AWSRegion: "us-east-1"})
+	b.stsURL = srv.URL
+
+	_, err := b.Start(context.Background(), Request{
+		Provider: models.ProtocolAWS,
+		Role:     "arn:aws:iam::123456789012:role/Admin",
+		Duration: time.Hour,
+	})
+	if err == nil || !strings.Contains(err.Error(), "AccessDenied") {
+		t.Errorf("err = %v, want AccessDenied", err)
+	}
+
+	_, err = b.Start(context.Background(), Request{Provider: models.ProtocolAWS, Role: "Admin", Duration: time.Hour})
+	if !errors.Is(err, ErrInvalidRole) {
+		t.Errorf("err = %v, want ErrInvalidRole", err)
+	}
+	_, err = b.Start(context.Background(), Request{Provider: models.ProtocolAWS, Role: "arn:aws:iam::1:role/A", Duration: time.Minute})
+	if !errors.Is(err, ErrTooShort) {
+		t.Errorf("err = %v, want ErrTooShort", err)
+	}
+}
+
+func TestStartAzure(t *testing.T) {
+	var paths []string
+	var bodies []map[string]interface{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, "/oauth2/v2.0/token") {
+			r.ParseForm()
+			if r.URL.Path != "/tenant-1/oauth2/v2.0/token" || r.Form.Get("grant_type") != "client_credentials" {
+				t.Errorf("unexpected token request: %s %v", r.URL.Path, r.Form)
+			}
+			w.Header().Set("Content-Type", "application/json")
+			w.Write([]byte(`{"access_token":"at","token_type":"Bearer","expires_in":3600}`))
+			return
+		}
+		if r.Header.Get("Authorization") != "Bearer at" {
+			t.Errorf("Authorization = %q", r.Header.Get("Authorization"))
+		}
+		var body map[string]interface{}
+		json.NewDecoder(r.Body).Decode(&body)
+		paths = append(paths, r.Method+" "+r.URL.Path)
+		bodies = append(bodies, body)
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte(`{"id":"graph-request","name":"arm-request"}`))
+	}))
+	defer srv.Close()
+
+	b := NewBroker(Config{SessionDuration: time.Hour, AWSRegion: "us-east-1"})
+	b.loginURL = srv.URL
+	b.graphURL = srv.URL + "/graph"
+	b.armURL = srv.URL + "/arm"
+	b.portalURL = "https://portal.example.com"
+
+	req := Request{
+		Provider:    models.ProtocolAzure,
+		Account:     "tenant-1",
+		Role:        "62e90394-69f5-4237-9190-012177145e10",
+		Key:         "client",
+		Secret:      "secret",
+		UserEmail:   "alice@example.com",
+		PrincipalID: "object-1",
+		Duration:    time.Hour,
+	}
+	grant, err := b.Start(context.Background(), req)
+	if err != nil {
+		t.Fatalf("Start directory role: %v", err)
+	}
+	if grant.ExternalID != "graph-request" || grant.ConsoleURL != "https://portal.example.com/#@tenant-1" {
+		t.Errorf("grant = %+v", grant)
+	}
+	if paths[0] != "POST /graph/roleManagement/directory/roleAssignmentScheduleRequests" {
+		t.Errorf("directory role request = %s", paths[0])
+	}
+	if bodies[0]["action"] != "adminAssign" || bodies[0]["principalId"] != "object-1" || bodies[0]["directoryScopeId"] != "/" {
+		t.Errorf("directory role body = %v", bodies[0])
+	}
+
+	req.Role = "acdd72a7-3385-48ef-bd42-f606fba81ae7@/subscriptions/sub-1"
+	grant, err = b.Start(context.Background(), req)
+	if err != nil {
+		t.Fatalf("Start resource role: %v", err)
+	}
+	if grant.ExternalID != "arm-request" || grant.ConsoleURL != "https://portal.example.com/#@tenant-1/resource/subscriptions/sub-1" {
+		t.Errorf("grant = %+v", grant)
+	}
+	if !strings.HasPrefix(paths[1], "PUT /arm/subscriptions/sub-1/providers/Microsoft.Authorization/roleAssignmentScheduleRequests/") {
+		t.Errorf("resource role request = %s", paths[1])
+	}
+	props := bodies[1]["properties"].(map[string]interface{})
+	if props["roleDefinitionId"] != "/subscriptions/sub-1/providers/Microsoft.Authorization/roleDefinitions/acdd72a7-3385-48ef-bd42-f606fba81ae7" ||
+		props["requestType"] != "AdminAssign" {
+		t.Errorf("resource role body = %v", props)
+	}
+
+	req.PrincipalID = ""
+	if _, err := b.Start(context.Background(), req); !errors.Is(err, ErrNoPrincipal) {
+		t.Errorf("err = %v, want ErrNoPrincipal", err)
+	}
+}
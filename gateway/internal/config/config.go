@@ -4,21 +4,78 @@ import (
 	"fmt"
 	"os"
 	"strconv"
+	"strings"
 	"time"
 
+	"github.com/VanCannon/openpam/gateway/internal/auth"
+	"github.com/VanCannon/openpam/gateway/internal/cloud"
+	"github.com/VanCannon/openpam/gateway/internal/demo"
+	"github.com/VanCannon/openpam/gateway/internal/discovery"
+	"github.com/VanCannon/openpam/gateway/internal/elevation"
+	"github.com/VanCannon/openpam/gateway/internal/evidence"
+	"github.com/VanCannon/openpam/gateway/internal/failover"
+	"github.com/VanCannon/openpam/gateway/internal/keys"
+	"github.com/VanCannon/openpam/gateway/internal/license"
+	"github.com/VanCannon/openpam/gateway/internal/models"
+	"github.com/VanCannon/openpam/gateway/internal/recordings"
+	"github.com/VanCannon/openpam/gateway/internal/remediation"
+	"github.com/VanCannon/openpam/gateway/internal/searchexport"
+	"github.com/VanCannon/openpam/gateway/internal/tunnel"
+	"github.com/VanCannon/openpam/gateway/internal/validate"
+	"github.com/VanCannon/openpam/pkg/logger"
+	"github.com/VanCannon/openpam/pkg/recovery"
+	"github.com/google/uuid"
 	"github.com/joho/godotenv"
 )
 
 // Config holds all application configuration
 type Config struct {
-	Server   ServerConfig
-	Database DatabaseConfig
-	Vault    VaultConfig
-	EntraID  EntraIDConfig
-	Session  SessionConfig
-	Zone     ZoneConfig
-	DevMode  bool // Enable development mode (bypasses EntraID auth)
-	Identity IdentityConfig
+	Server    ServerConfig
+	Database  DatabaseConfig
+	Vault     VaultConfig
+	EntraID   EntraIDConfig
+	Session   SessionConfig
+	Zone      ZoneConfig
+	WebSocket WebSocketConfig
+	Monitor   MonitorConfig
+	SSH       SSHConfig
+	Ephemeral EphemeralConfig
+	Events    EventsConfig
+	SMTP      SMTPConfig
+	Slack     SlackConfig
+	Approvals ApprovalsConfig
+	Elevation ElevationConfig
+	Dual      DualControlConfig
+	Schedules SchedulesConfig
+	OnCall    OnCallConfig
+	Reports   ReportsConfig
+	Tasks     TasksConfig
+	Evidence  EvidenceConfig
+	RDP       RDPConfig
+	Flight    FlightRecorderConfig
+	Errors    ErrorReportingConfig
+	Search    SearchExportConfig
+	AWX       AWXConfig
+	Watch     WatchConfig
+	Discovery DiscoveryConfig
+	AuthFail  AuthFailureConfig
+	Harness   HarnessConfig
+	Demo      DemoConfig
+	Audit     AuditConfig
+	Cloud     CloudConfig
+	GraphQL   GraphQLConfig
+	DevMode   bool // Enable development mode (bypasses EntraID auth)
+	Identity  IdentityConfig
+	License   LicenseConfig
+	Failover  FailoverConfig
+	Recording RecordingConfig
+	BodyLimit BodyLimitConfig
+	Idem      IdempotencyConfig
+	Usage     UsageConfig
+	Signing   SigningConfig
+	TargetLog TargetLogConfig
+	Analytics AnalyticsConfig
+	ADAlerts  ADAlertsConfig
 }
 
 // IdentityConfig holds Identity Service configuration
@@ -26,6 +83,98 @@ type IdentityConfig struct {
 	URL string
 }
 
+// LicenseConfig holds License Service configuration and what happens once the license expires
+type LicenseConfig struct {
+	URL              string        // License service; empty disables enforcement
+	GracePeriod      time.Duration // After expiry, until the gateway turns read-only
+	ExpiryWarning    time.Duration // Before expiry, when a warning banner is shown
+	RefreshInterval  time.Duration // How often the license is fetched
+	PremiumProtocols []string      // Protocols refused for new sessions during the grace period
+}
+
+// FailoverConfig holds the gateway's role in an active/standby pair
+type FailoverConfig struct {
+	Role          string        // primary or standby
+	Node          string        // Name of this gateway in the failover history; defaults to the host name
+	PrimaryURL    string        // Base URL of the primary, probed by the standby
+	ProbeInterval time.Duration // How often the standby probes the primary
+	Threshold     int           // Probes in a row that must fail to take over, or pass to hand back
+}
+
+// RecordingConfig holds where session recordings are stored
+type RecordingConfig struct {
+	Storage   string // local, s3, gcs or azure
+	Dir       string // Directory of local storage
+	Bucket    string // Bucket, or Azure container
+	Prefix    string // Prepended to object names, e.g. to keep zones apart in one bucket
+	Endpoint  string // S3-compatible endpoint such as MinIO, or Azure account URL
+	Region    string
+	AccessKey string // S3 access key or GCS HMAC key
+	SecretKey string
+	SASToken  string // Azure shared access signature
+	PartSize  int    // Bytes uploaded at a time while a session is recorded
+}
+
+// BodyLimitConfig caps the size of request bodies by route class
+type BodyLimitConfig struct {
+	Default int // Bytes allowed on most routes
+	Auth    int // Bytes allowed on sign-in and token routes
+	Bulk    int // Bytes allowed on bulk imports
+}
+
+// IdempotencyConfig holds how long create requests sent with an
+// Idempotency-Key header are remembered
+type IdempotencyConfig struct {
+	TTL time.Duration
+}
+
+// UsageConfig holds API usage metering configuration
+type UsageConfig struct {
+	FlushInterval   time.Duration // How often usage is stored and quotas reloaded
+	AlertRecipients []string      // Emailed, besides the user, when usage nears a quota
+}
+
+// TargetLogConfig holds the ingestion of targets' own logs, which are
+// attached to the sessions they were logged during
+type TargetLogConfig struct {
+	Token string        // Forwarders send it as a bearer token; empty disables ingestion
+	Grace time.Duration // How far outside a session a line from its target is still attached
+}
+
+// AnalyticsConfig holds the refresh of the analytics views and the working
+// hours their heatmaps tell apart
+type AnalyticsConfig struct {
+	RefreshInterval time.Duration // How often the views are refreshed
+	WorkStart       int           // First working hour, Monday to Friday, in the viewer's time zone
+	WorkEnd         int           // Hour work ends
+}
+
+// ADAlertsConfig holds the alerts on AD accounts read from the identity
+// service's reports
+type ADAlertsConfig struct {
+	Enabled            bool
+	Interval           time.Duration // How often the reports are checked
+	PasswordExpiryDays int           // How many days before a password expires it is alerted on
+	StaleDays          int           // How many days without a logon make an account stale
+	AlertRecipients    []string      // Emailed about the accounts; audited only when empty
+}
+
+// SigningConfig holds the keys session tokens and other issued artifacts are
+// signed with
+type SigningConfig struct {
+	Key       string   // Active key; empty signs with the session secret
+	Previous  []string // Keys rotated out, still trusted for verification
+	Responses bool     // Sign capabilities responses and policy bundles with a detached JWS
+
+	AWSAccessKey    string // For AWS KMS keys
+	AWSSecretKey    string
+	AWSSessionToken string
+
+	AzureTenantID     string // For Azure Key Vault keys
+	AzureClientID     string
+	AzureClientSecret string
+}
+
 // ServerConfig holds HTTP server configuration
 type ServerConfig struct {
 	Host         string
@@ -48,6 +197,7 @@ type DatabaseConfig struct {
 	MaxIdleConns    int
 	ConnMaxLifetime time.Duration
 	ConnMaxIdleTime time.Duration
+	SlowQuery       time.Duration // Queries taking longer are logged; 0 disables
 }
 
 // VaultConfig holds HashiCorp Vault configuration
@@ -70,6 +220,245 @@ type EntraIDConfig struct {
 type SessionConfig struct {
 	Secret  string
 	Timeout time.Duration
+
+	Store          string // Where logins are kept: memory, or redis to share them across restarts and replicas
+	RedisURL       string
+	RedisKeyPrefix string
+}
+
+// WebSocketConfig holds outbound WebSocket settings for proxied sessions
+type WebSocketConfig struct {
+	WriteTimeout  time.Duration // Deadline for each frame written to the client
+	PingInterval  time.Duration // Interval between pings to the client (0 disables)
+	PongTimeout   time.Duration // Grace period after a ping interval before the client is considered dead
+	QueueSize     int           // Pending messages allowed before a client is disconnected as too slow
+	MaxBatchBytes int           // Maximum bytes coalesced into a single frame
+	ReconnectTTL  time.Duration // Lifetime of the reconnect token sent when the gateway restarts
+
+	Compression          bool // Negotiate permessage-deflate with clients that offer it
+	CompressionLevel     int  // flate level, 1 (fastest) to 9 (smallest)
+	CompressionThreshold int  // Smallest frame compressed, in bytes
+}
+
+// MonitorConfig holds the scrollback sent to monitors that join a live session
+type MonitorConfig struct {
+	SSHScrollbackBytes int           // Terminal output kept per SSH session (0 disables)
+	SSHScrollbackAge   time.Duration // Oldest SSH output kept (0 keeps any age)
+	RDPScrollbackBytes int           // Guacamole instructions kept per RDP session (0 disables)
+	RDPScrollbackAge   time.Duration // Oldest RDP instructions kept (0 keeps any age)
+}
+
+// SSHConfig holds SSH proxy configuration
+type SSHConfig struct {
+	KeepaliveInterval  time.Duration // Default keep-alive interval for targets without their own (0 disables)
+	KeepaliveMaxMissed int           // Unanswered keep-alives before the target is considered unreachable
+}
+
+// EphemeralConfig holds settings for ephemeral targets
+type EphemeralConfig struct {
+	DefaultTTL time.Duration // TTL used when the request doesn't specify one
+	MaxTTL     time.Duration // Longest TTL a request may ask for
+	GCInterval time.Duration // How often expired targets are disabled and collected
+	Retention  time.Duration // How long an expired target stays visible before it is deleted
+}
+
+// EventsConfig holds settings for the live event stream
+type EventsConfig struct {
+	Retention time.Duration // How long events are kept for clients resuming with Last-Event-ID
+	Heartbeat time.Duration // Interval of keep-alive comments on idle streams
+}
+
+// SMTPConfig holds the mail server used for email notifications
+type SMTPConfig struct {
+	Host     string // Email notifications are disabled if empty
+	Port     int
+	Username string
+	Password string
+	From     string
+}
+
+// SlackConfig holds the Slack app notifications are sent through
+type SlackConfig struct {
+	BotToken string // Slack notifications are disabled if empty
+}
+
+// ApprovalsConfig holds settings for approving schedule requests from email or chat
+type ApprovalsConfig struct {
+	LinkTTL  time.Duration // How long an approval link can be used
+	StepUp   bool          // Require approvers to be signed in when using a link
+	Channels []string      // Channels links are sent through, "email" and "slack"; all configured ones if empty
+}
+
+// ElevationConfig holds settings for time-boxed role elevation
+type ElevationConfig struct {
+	EligibleRoles []string      // Roles that may request elevation, "user" and "auditor"; none disables it
+	AutoApprove   []string      // Elevated roles granted without an admin's approval
+	MaxDuration   time.Duration // Longest elevation that may be requested
+}
+
+// DualControlConfig holds settings for admin changes that need a second admin's approval
+type DualControlConfig struct {
+	Categories []string // Changes staged for approval: "credentials", "credential_rules" and "user_roles"; none disables it
+}
+
+// SchedulesConfig holds settings for scheduled access
+type SchedulesConfig struct {
+	ExtendAutoApprove int // Longest extension in minutes approved without an admin; 0 requires approval for all
+	ExtendMax         int // Longest extension in minutes that may be requested at once
+}
+
+// OnCallConfig holds the on-call providers access schedules are synced from
+type OnCallConfig struct {
+	PagerDutyToken string        // PagerDuty sync is disabled if empty
+	PagerDutyURL   string        // PagerDuty REST API base URL
+	OpsgenieKey    string        // Opsgenie sync is disabled if empty
+	OpsgenieURL    string        // Opsgenie API base URL, https://api.eu.opsgenie.com for the EU instance
+	SyncInterval   time.Duration // How often each mapping is synced
+	Lookahead      time.Duration // How far ahead shifts become schedules
+}
+
+// ReportsConfig holds settings for scheduled reports
+type ReportsConfig struct {
+	PollInterval    time.Duration // How often due reports are checked for
+	AlertRecipients []string      // Who is emailed when a report fails (defaults to the report's recipients)
+}
+
+// TasksConfig holds settings for privileged task execution
+type TasksConfig struct {
+	MaxTimeout              time.Duration // Upper bound on any task's timeout
+	MaxOutputBytes          int           // Output kept per execution; the rest is discarded
+	WinRMPort               int           // WinRM port of Windows (RDP) targets
+	WinRMHTTPS              bool
+	WinRMInsecureSkipVerify bool // Accept any WinRM certificate, e.g. self-signed ones
+}
+
+// RDPConfig holds settings for RDP sessions through guacd
+type RDPConfig struct {
+	KerberosKDCURL string // KDC or KDC proxy guacd authenticates Kerberos targets' sessions with (empty: DNS lookup)
+
+	CertificateCheckInterval   time.Duration // How often smart card certificates are checked for expiry
+	CertificateExpiryWarning   time.Duration // How long before a certificate expires it is alerted on
+	CertificateAlertRecipients []string      // Emailed about expiring certificates
+}
+
+// EvidenceConfig holds policy violation detection and evidence capture settings
+type EvidenceConfig struct {
+	CaptureBytes      int      // Latest terminal output or RDP display stream kept per session
+	EncryptionKey     string   // Base64 AES-256 key; without it violations are recorded without evidence
+	DLPRules          []string // name=regex rules matched against SSH terminal output
+	BlockRDPClipboard bool     // Refuse clipboard transfers in RDP sessions
+}
+
+// FlightRecorderConfig holds the opt-in recorder of recent API exchanges
+type FlightRecorderConfig struct {
+	Enabled bool
+	Size    int      // Exchanges kept
+	MaxBody int      // Bytes of each request and response body kept
+	DumpDir string   // Where the recorder is dumped on panic
+	Exclude []string // Path prefixes not recorded, besides health checks and sign-in
+}
+
+// ErrorReportingConfig holds where recovered panics are reported
+type ErrorReportingConfig struct {
+	SentryDSN   string // Sentry-compatible DSN; empty disables reporting
+	Environment string // Environment tag on reported events
+}
+
+// SearchExportConfig holds where audit data is indexed for centralized search
+type SearchExportConfig struct {
+	URLs        []string // Elasticsearch or OpenSearch endpoints; empty disables the export
+	Username    string
+	Password    string
+	APIKey      string
+	CAFile      string
+	IndexPrefix string
+	BatchSize   int
+	Interval    time.Duration
+	MaxRetries  int
+	Format      string // native, cef or ocsf
+}
+
+// AWXConfig holds the AWX or Ansible Tower job templates launched after sessions
+type AWXConfig struct {
+	URL                string // Empty disables remediation
+	Token              string
+	CAFile             string
+	SessionEndTemplate int // Launched when a session ends; 0 for none
+	ViolationTemplate  int // Launched on a policy violation; 0 for none
+	PollInterval       time.Duration
+}
+
+// WatchConfig holds how often watch rules are evaluated against new audit events
+type WatchConfig struct {
+	Interval time.Duration
+}
+
+// DiscoveryConfig holds settings for local account discovery and onboarding
+type DiscoveryConfig struct {
+	Interval       time.Duration // How often targets are scanned; 0 scans on request only
+	RotateEvery    time.Duration // Password age at which onboarded accounts are rotated; 0 for never
+	ScanTimeout    time.Duration
+	VaultPath      string // Where onboarded passwords are stored, one secret per target and account
+	PasswordLength int
+
+	// SSH key management, checked for drift by the same scans
+	KeyVaultPath    string   // Where managed private keys are stored, one secret per target and account
+	KeyFrom         string   // Optional from="" pattern added to deployed keys, e.g. the gateways' addresses
+	AlertRecipients []string // Emailed when a scan finds SSH key drift
+
+	// LAPS-style rotation of the built-in Administrator on Windows targets
+	LAPSRotateEvery          time.Duration
+	LAPSVaultPath            string        // Where LAPS passwords are stored, one secret per machine
+	LAPSRotateAfterRetrieval time.Duration // 0 leaves a retrieved password until its next scheduled rotation
+	LAPSOverdueGrace         time.Duration
+
+	FingerprintTimeout time.Duration // How long each port of a host is given to answer a probe
+}
+
+// AuthFailureConfig holds when failed logons to targets are alerted on and
+// credentials quarantined
+type AuthFailureConfig struct {
+	AlertThreshold      int      // Consecutive failed logons with a credential that raise an alert; 0 disables alerts
+	QuarantineThreshold int      // Consecutive failed logons that quarantine the credential until it is rotated; 0 never quarantines
+	AlertRecipients     []string // Emailed about failure streaks and quarantines
+}
+
+// HarnessConfig holds the synthetic targets of the test harness, for load
+// testing the gateway in development mode
+type HarnessConfig struct {
+	Enabled      bool
+	SSHAddress   string // Where the synthetic SSH echo server listens
+	GuacdAddress string // Where the guacd stand-in listens; all RDP sessions go to it while enabled
+}
+
+// DemoConfig holds the demo data seeded for evaluating the gateway in
+// development mode
+type DemoConfig struct {
+	Seed       bool   // Seed the demo data on start, unless it is there already
+	SSHAddress string // Bundled SSH test host, as the gateway reaches it
+	RDPAddress string // Bundled RDP test host, as guacd reaches it
+	Username   string // Account on the test hosts
+	Password   string
+}
+
+// AuditConfig holds the monthly partitions of the session and system audit logs
+type AuditConfig struct {
+	RetentionMonths int // Months kept before the current one; older months are dropped. 0 keeps everything
+	PartitionsAhead int // Months of partitions created in advance
+}
+
+// CloudConfig holds settings for brokered AWS and Azure console sessions
+type CloudConfig struct {
+	SessionDuration   time.Duration // Default and longest session; schedule windows and max_duration shorten it
+	AWSRegion         string
+	AWSConsoleURL     string
+	AWSSourceIdentity bool
+}
+
+// GraphQLConfig holds settings for the optional GraphQL query endpoint
+type GraphQLConfig struct {
+	Enabled  bool
+	MaxDepth int // Deepest nesting of selections a query may have
 }
 
 // ZoneConfig holds zone-specific configuration
@@ -78,6 +467,31 @@ type ZoneConfig struct {
 	Name       string
 	ID         string // Zone UUID
 	HubAddress string // For satellite mode: WebSocket URL of hub
+	Token      string // Shared secret satellites present to the hub
+
+	// Policy bundles let satellites authorize sessions while the hub is unreachable
+	PolicySigningKey   string        // Hub: base64 Ed25519 seed that signs bundles
+	PolicyVerifyKey    string        // Satellite: base64 Ed25519 public key that verifies bundles
+	HubJWKSURL         string        // Satellite: hub key set bundles must also carry a JWS by
+	PolicySyncInterval time.Duration // Hub: how often bundles are pushed
+	PolicyBundleTTL    time.Duration // Hub: how long a satellite may use a bundle
+	OfflinePolicy      string        // Satellite: "deny", "cached" or "scheduled"
+	PolicyCachePath    string        // Satellite: where the last bundle is kept
+	OfflineAuditDir    string        // Satellite: where sessions recorded offline wait for upload
+
+	// Configuration and builds pushed by the hub
+	SatelliteConfigPath string        // Satellite: where the pushed configuration is kept
+	UpdateStateDir      string        // Satellite: where the update in progress is tracked
+	UpdateHealthTimeout time.Duration // Satellite: how long an update has to reconnect before rollback
+	AutoUpdate          bool          // Satellite: whether builds pushed by the hub are installed
+
+	// Diagnostics satellites send to the hub
+	MetricsInterval      time.Duration // Satellite: how often metrics are sent; 0 disables them
+	LogForwardLevel      string        // Satellite: least severe level forwarded
+	LogForwardInterval   time.Duration // Satellite: how often buffered log messages are sent
+	LogForwardBatch      int           // Satellite: most messages sent per interval; 0 disables forwarding
+	LogForwardBuffer     int           // Satellite: most messages kept while offline
+	DiagnosticsRetention time.Duration // Hub: how long satellite metrics and logs are kept
 }
 
 // Load reads configuration from environment variables
@@ -85,6 +499,16 @@ func Load() (*Config, error) {
 	// Load .env file if it exists
 	_ = godotenv.Load()
 
+	// Configuration pushed by the hub overrides the satellite's environment
+	if getEnv("ZONE_TYPE", "hub") == "satellite" {
+		if err := tunnel.ApplyConfigOverrides(getEnv("SATELLITE_CONFIG_PATH", "./data/satellite-config.json")); err != nil {
+			return nil, fmt.Errorf("failed to apply satellite config: %w", err)
+		}
+	}
+
+	// Gateways name themselves in the failover history after their host
+	hostname, _ := os.Hostname()
+
 	cfg := &Config{
 		Server: ServerConfig{
 			Host:         getEnv("SERVER_HOST", "0.0.0.0"),
@@ -105,6 +529,7 @@ func Load() (*Config, error) {
 			MaxIdleConns:    getEnvInt("DB_MAX_IDLE_CONNS", 5),
 			ConnMaxLifetime: getEnvDuration("DB_CONN_MAX_LIFETIME", 5*time.Minute),
 			ConnMaxIdleTime: getEnvDuration("DB_CONN_MAX_IDLE_TIME", 1*time.Minute),
+			SlowQuery:       getEnvDuration("DB_SLOW_QUERY_THRESHOLD", 500*time.Millisecond),
 		},
 		Vault: VaultConfig{
 			Address:  getEnv("VAULT_ADDR", "http://localhost:8200"),
@@ -121,17 +546,283 @@ func Load() (*Config, error) {
 		Session: SessionConfig{
 			Secret:  getEnv("SESSION_SECRET", "change-me-in-production"),
 			Timeout: getEnvDuration("SESSION_TIMEOUT", 3600*time.Second),
+
+			Store:          getEnv("SESSION_STORE", auth.StoreMemory),
+			RedisURL:       getEnv("REDIS_URL", ""),
+			RedisKeyPrefix: getEnv("REDIS_KEY_PREFIX", "openpam:"),
 		},
 		Zone: ZoneConfig{
 			Type:       getEnv("ZONE_TYPE", "hub"),
 			Name:       getEnv("ZONE_NAME", "default"),
 			ID:         getEnv("ZONE_ID", ""),
 			HubAddress: getEnv("HUB_ADDRESS", ""),
+			Token:      getEnv("SATELLITE_TOKEN", ""),
+
+			PolicySigningKey:   getEnv("POLICY_SIGNING_KEY", ""),
+			PolicyVerifyKey:    getEnv("POLICY_VERIFY_KEY", ""),
+			HubJWKSURL:         getEnv("HUB_JWKS_URL", ""),
+			PolicySyncInterval: getEnvDuration("POLICY_SYNC_INTERVAL", 5*time.Minute),
+			PolicyBundleTTL:    getEnvDuration("POLICY_BUNDLE_TTL", 24*time.Hour),
+			OfflinePolicy:      getEnv("OFFLINE_POLICY", string(tunnel.OfflineDeny)),
+			PolicyCachePath:    getEnv("POLICY_CACHE_PATH", "./data/policy-bundle.json"),
+			OfflineAuditDir:    getEnv("OFFLINE_AUDIT_DIR", "./data/offline-audit"),
+
+			SatelliteConfigPath: getEnv("SATELLITE_CONFIG_PATH", "./data/satellite-config.json"),
+			UpdateStateDir:      getEnv("UPDATE_STATE_DIR", "./data/update"),
+			UpdateHealthTimeout: getEnvDuration("UPDATE_HEALTH_TIMEOUT", 2*time.Minute),
+			AutoUpdate:          getEnv("SATELLITE_AUTO_UPDATE", "false") == "true",
+
+			MetricsInterval:      getEnvDuration("SATELLITE_METRICS_INTERVAL", time.Minute),
+			LogForwardLevel:      getEnv("SATELLITE_LOG_LEVEL", "info"),
+			LogForwardInterval:   getEnvDuration("SATELLITE_LOG_INTERVAL", 10*time.Second),
+			LogForwardBatch:      getEnvInt("SATELLITE_LOG_BATCH", 200),
+			LogForwardBuffer:     getEnvInt("SATELLITE_LOG_BUFFER", 5000),
+			DiagnosticsRetention: getEnvDuration("SATELLITE_DIAGNOSTICS_RETENTION", 7*24*time.Hour),
+		},
+		WebSocket: WebSocketConfig{
+			WriteTimeout:  getEnvDuration("WS_WRITE_TIMEOUT", 10*time.Second),
+			PingInterval:  getEnvDuration("WS_PING_INTERVAL", 30*time.Second),
+			PongTimeout:   getEnvDuration("WS_PONG_TIMEOUT", 10*time.Second),
+			QueueSize:     getEnvInt("WS_WRITE_QUEUE_SIZE", 256),
+			MaxBatchBytes: getEnvInt("WS_MAX_BATCH_BYTES", 32*1024),
+			ReconnectTTL:  getEnvDuration("WS_RECONNECT_TOKEN_TTL", 2*time.Minute),
+
+			Compression:          getEnv("WS_COMPRESSION", "true") == "true",
+			CompressionLevel:     getEnvInt("WS_COMPRESSION_LEVEL", 1),
+			CompressionThreshold: getEnvInt("WS_COMPRESSION_THRESHOLD", 512),
+		},
+		Monitor: MonitorConfig{
+			SSHScrollbackBytes: getEnvInt("MONITOR_SSH_SCROLLBACK_BYTES", 64*1024),
+			SSHScrollbackAge:   getEnvDuration("MONITOR_SSH_SCROLLBACK_AGE", 15*time.Minute),
+			RDPScrollbackBytes: getEnvInt("MONITOR_RDP_SCROLLBACK_BYTES", 1<<20),
+			RDPScrollbackAge:   getEnvDuration("MONITOR_RDP_SCROLLBACK_AGE", 30*time.Second),
+		},
+		SSH: SSHConfig{
+			KeepaliveInterval:  getEnvDuration("SSH_KEEPALIVE_INTERVAL", 30*time.Second),
+			KeepaliveMaxMissed: getEnvInt("SSH_KEEPALIVE_MAX_MISSED", 3),
+		},
+		Ephemeral: EphemeralConfig{
+			DefaultTTL: getEnvDuration("EPHEMERAL_DEFAULT_TTL", 24*time.Hour),
+			MaxTTL:     getEnvDuration("EPHEMERAL_MAX_TTL", 7*24*time.Hour),
+			GCInterval: getEnvDuration("EPHEMERAL_GC_INTERVAL", time.Minute),
+			Retention:  getEnvDuration("EPHEMERAL_RETENTION", time.Hour),
+		},
+		Events: EventsConfig{
+			Retention: getEnvDuration("EVENTS_RETENTION", 24*time.Hour),
+			Heartbeat: getEnvDuration("EVENTS_HEARTBEAT_INTERVAL", 15*time.Second),
+		},
+		SMTP: SMTPConfig{
+			Host:     getEnv("SMTP_HOST", ""),
+			Port:     getEnvInt("SMTP_PORT", 587),
+			Username: getEnv("SMTP_USERNAME", ""),
+			Password: getEnv("SMTP_PASSWORD", ""),
+			From:     getEnv("SMTP_FROM", "openpam@localhost"),
+		},
+		Slack: SlackConfig{
+			BotToken: getEnv("SLACK_BOT_TOKEN", ""),
+		},
+		Approvals: ApprovalsConfig{
+			LinkTTL:  getEnvDuration("APPROVAL_LINK_TTL", 24*time.Hour),
+			StepUp:   getEnv("APPROVAL_LINK_STEP_UP", "false") == "true",
+			Channels: getEnvList("APPROVAL_LINK_CHANNELS"),
+		},
+		Elevation: ElevationConfig{
+			EligibleRoles: getEnvList("ELEVATION_ELIGIBLE_ROLES"),
+			AutoApprove:   getEnvList("ELEVATION_AUTO_APPROVE_ROLES"),
+			MaxDuration:   getEnvDuration("ELEVATION_MAX_DURATION", 8*time.Hour),
+		},
+		Dual: DualControlConfig{
+			Categories: getEnvList("DUAL_CONTROL_CATEGORIES"),
+		},
+		Schedules: SchedulesConfig{
+			ExtendAutoApprove: getEnvInt("SCHEDULE_EXTEND_AUTO_APPROVE_MINUTES", 30),
+			ExtendMax:         getEnvInt("SCHEDULE_EXTEND_MAX_MINUTES", 240),
+		},
+		OnCall: OnCallConfig{
+			PagerDutyToken: getEnv("PAGERDUTY_API_TOKEN", ""),
+			PagerDutyURL:   getEnv("PAGERDUTY_API_URL", "https://api.pagerduty.com"),
+			OpsgenieKey:    getEnv("OPSGENIE_API_KEY", ""),
+			OpsgenieURL:    getEnv("OPSGENIE_API_URL", "https://api.opsgenie.com"),
+			SyncInterval:   getEnvDuration("ONCALL_SYNC_INTERVAL", 5*time.Minute),
+			Lookahead:      getEnvDuration("ONCALL_LOOKAHEAD", 24*time.Hour),
+		},
+		Reports: ReportsConfig{
+			PollInterval:    getEnvDuration("REPORTS_POLL_INTERVAL", time.Minute),
+			AlertRecipients: getEnvList("REPORTS_ALERT_RECIPIENTS"),
+		},
+		Tasks: TasksConfig{
+			MaxTimeout:              getEnvDuration("TASKS_MAX_TIMEOUT", 10*time.Minute),
+			MaxOutputBytes:          getEnvInt("TASKS_MAX_OUTPUT_BYTES", 1<<20),
+			WinRMPort:               getEnvInt("TASKS_WINRM_PORT", 5986),
+			WinRMHTTPS:              getEnv("TASKS_WINRM_HTTPS", "true") == "true",
+			WinRMInsecureSkipVerify: getEnv("TASKS_WINRM_INSECURE_SKIP_VERIFY", "false") == "true",
+		},
+		Evidence: EvidenceConfig{
+			CaptureBytes:      getEnvInt("EVIDENCE_CAPTURE_BYTES", 64<<10),
+			EncryptionKey:     getEnv("EVIDENCE_ENCRYPTION_KEY", ""),
+			DLPRules:          getEnvListSep("DLP_RULES", ";"),
+			BlockRDPClipboard: getEnv("RDP_BLOCK_CLIPBOARD", "false") == "true",
+		},
+		RDP: RDPConfig{
+			KerberosKDCURL:             getEnv("RDP_KERBEROS_KDC_URL", ""),
+			CertificateCheckInterval:   getEnvDuration("RDP_CERT_CHECK_INTERVAL", time.Hour),
+			CertificateExpiryWarning:   getEnvDuration("RDP_CERT_EXPIRY_WARNING", 30*24*time.Hour),
+			CertificateAlertRecipients: getEnvList("RDP_CERT_ALERT_RECIPIENTS"),
+		},
+		Flight: FlightRecorderConfig{
+			Enabled: getEnv("FLIGHT_RECORDER_ENABLED", "false") == "true",
+			Size:    getEnvInt("FLIGHT_RECORDER_SIZE", 200),
+			MaxBody: getEnvInt("FLIGHT_RECORDER_MAX_BODY", 4096),
+			DumpDir: getEnv("FLIGHT_RECORDER_DUMP_DIR", "./data/flight-recorder"),
+			Exclude: getEnvList("FLIGHT_RECORDER_EXCLUDE"),
+		},
+		Errors: ErrorReportingConfig{
+			SentryDSN:   getEnv("SENTRY_DSN", ""),
+			Environment: getEnv("SENTRY_ENVIRONMENT", "production"),
+		},
+		Search: SearchExportConfig{
+			URLs:        getEnvList("SEARCH_EXPORT_URLS"),
+			Username:    getEnv("SEARCH_EXPORT_USERNAME", ""),
+			Password:    getEnv("SEARCH_EXPORT_PASSWORD", ""),
+			APIKey:      getEnv("SEARCH_EXPORT_API_KEY", ""),
+			CAFile:      getEnv("SEARCH_EXPORT_CA_FILE", ""),
+			IndexPrefix: getEnv("SEARCH_EXPORT_INDEX_PREFIX", "openpam"),
+			BatchSize:   getEnvInt("SEARCH_EXPORT_BATCH_SIZE", 500),
+			Interval:    getEnvDuration("SEARCH_EXPORT_INTERVAL", 10*time.Second),
+			MaxRetries:  getEnvInt("SEARCH_EXPORT_MAX_RETRIES", 5),
+			Format:      getEnv("SEARCH_EXPORT_FORMAT", "native"),
+		},
+		AWX: AWXConfig{
+			URL:                getEnv("AWX_URL", ""),
+			Token:              getEnv("AWX_TOKEN", ""),
+			CAFile:             getEnv("AWX_CA_FILE", ""),
+			SessionEndTemplate: getEnvInt("AWX_SESSION_END_TEMPLATE", 0),
+			ViolationTemplate:  getEnvInt("AWX_VIOLATION_TEMPLATE", 0),
+			PollInterval:       getEnvDuration("AWX_POLL_INTERVAL", 30*time.Second),
+		},
+		Watch: WatchConfig{
+			Interval: getEnvDuration("WATCH_INTERVAL", 5*time.Second),
+		},
+		Discovery: DiscoveryConfig{
+			Interval:                 getEnvDuration("DISCOVERY_INTERVAL", 0),
+			RotateEvery:              getEnvDuration("DISCOVERY_ROTATE_EVERY", 0),
+			ScanTimeout:              getEnvDuration("DISCOVERY_SCAN_TIMEOUT", 2*time.Minute),
+			VaultPath:                getEnv("DISCOVERY_VAULT_PATH", "secret/data/openpam/discovered"),
+			PasswordLength:           getEnvInt("DISCOVERY_PASSWORD_LENGTH", 24),
+			KeyVaultPath:             getEnv("SSH_KEYS_VAULT_PATH", "secret/data/openpam/ssh-keys"),
+			KeyFrom:                  getEnv("SSH_KEYS_FROM", ""),
+			AlertRecipients:          getEnvList("SSH_KEYS_ALERT_RECIPIENTS"),
+			LAPSRotateEvery:          getEnvDuration("LAPS_ROTATE_EVERY", 30*24*time.Hour),
+			LAPSVaultPath:            getEnv("LAPS_VAULT_PATH", "secret/data/openpam/laps"),
+			LAPSRotateAfterRetrieval: getEnvDuration("LAPS_ROTATE_AFTER_RETRIEVAL", 0),
+			LAPSOverdueGrace:         getEnvDuration("LAPS_OVERDUE_GRACE", 24*time.Hour),
+			FingerprintTimeout:       getEnvDuration("FINGERPRINT_TIMEOUT", 5*time.Second),
+		},
+		AuthFail: AuthFailureConfig{
+			AlertThreshold:      getEnvInt("AUTH_FAILURE_ALERT_THRESHOLD", 3),
+			QuarantineThreshold: getEnvInt("AUTH_FAILURE_QUARANTINE_THRESHOLD", 0),
+			AlertRecipients:     getEnvList("AUTH_FAILURE_ALERT_RECIPIENTS"),
+		},
+		Harness: HarnessConfig{
+			Enabled:      getEnv("TEST_HARNESS_ENABLED", "false") == "true",
+			SSHAddress:   getEnv("TEST_HARNESS_SSH_ADDRESS", "127.0.0.1:2222"),
+			GuacdAddress: getEnv("TEST_HARNESS_GUACD_ADDRESS", "127.0.0.1:4823"),
+		},
+		Demo: DemoConfig{
+			Seed:       getEnv("DEV_SEED", "false") == "true",
+			SSHAddress: getEnv("DEMO_SSH_ADDRESS", "127.0.0.1:2201"),
+			RDPAddress: getEnv("DEMO_RDP_ADDRESS", "openpam-demo-rdp:3389"),
+			Username:   getEnv("DEMO_USERNAME", "demo"),
+			Password:   getEnv("DEMO_PASSWORD", "demo"),
+		},
+		Audit: AuditConfig{
+			RetentionMonths: getEnvInt("AUDIT_RETENTION_MONTHS", 0),
+			PartitionsAhead: getEnvInt("AUDIT_PARTITIONS_AHEAD", 3),
+		},
+		Cloud: CloudConfig{
+			SessionDuration:   getEnvDuration("CLOUD_SESSION_DURATION", time.Hour),
+			AWSRegion:         getEnv("CLOUD_AWS_REGION", "us-east-1"),
+			AWSConsoleURL:     getEnv("CLOUD_AWS_CONSOLE_URL", "https://console.aws.amazon.com/"),
+			AWSSourceIdentity: getEnv("CLOUD_AWS_SOURCE_IDENTITY", "false") == "true",
+		},
+		GraphQL: GraphQLConfig{
+			Enabled:  getEnv("GRAPHQL_ENABLED", "false") == "true",
+			MaxDepth: getEnvInt("GRAPHQL_MAX_DEPTH", 6),
 		},
 		DevMode: getEnv("DEV_MODE", "false") == "true",
 		Identity: IdentityConfig{
 			URL: getEnv("IDENTITY_URL", "http://localhost:8082"),
 		},
+		License: LicenseConfig{
+			URL:              getEnv("LICENSE_URL", ""),
+			GracePeriod:      getEnvDuration("LICENSE_GRACE_PERIOD", 14*24*time.Hour),
+			ExpiryWarning:    getEnvDuration("LICENSE_EXPIRY_WARNING", 30*24*time.Hour),
+			RefreshInterval:  getEnvDuration("LICENSE_REFRESH_INTERVAL", 5*time.Minute),
+			PremiumProtocols: getEnvList("LICENSE_PREMIUM_PROTOCOLS"),
+		},
+		Failover: FailoverConfig{
+			Role:          getEnv("FAILOVER_ROLE", failover.RolePrimary),
+			Node:          getEnv("FAILOVER_NODE", hostname),
+			PrimaryURL:    getEnv("FAILOVER_PRIMARY_URL", ""),
+			ProbeInterval: getEnvDuration("FAILOVER_PROBE_INTERVAL", 10*time.Second),
+			Threshold:     getEnvInt("FAILOVER_THRESHOLD", 3),
+		},
+		Recording: RecordingConfig{
+			Storage:   getEnv("RECORDINGS_STORAGE", recordings.BackendLocal),
+			Dir:       getEnv("RECORDINGS_DIR", "./recordings"),
+			Bucket:    getEnv("RECORDINGS_BUCKET", ""),
+			Prefix:    getEnv("RECORDINGS_PREFIX", ""),
+			Endpoint:  getEnv("RECORDINGS_ENDPOINT", ""),
+			Region:    getEnv("RECORDINGS_REGION", ""),
+			AccessKey: getEnv("RECORDINGS_ACCESS_KEY", ""),
+			SecretKey: getEnv("RECORDINGS_SECRET_KEY", ""),
+			SASToken:  getEnv("RECORDINGS_AZURE_SAS_TOKEN", ""),
+			PartSize:  getEnvInt("RECORDINGS_PART_SIZE", 8<<20),
+		},
+		BodyLimit: BodyLimitConfig{
+			Default: getEnvInt("BODY_LIMIT_DEFAULT", 1<<20),
+			Auth:    getEnvInt("BODY_LIMIT_AUTH", 64<<10),
+			Bulk:    getEnvInt("BODY_LIMIT_BULK", 10<<20),
+		},
+		Idem: IdempotencyConfig{
+			TTL: getEnvDuration("IDEMPOTENCY_TTL", 24*time.Hour),
+		},
+		Usage: UsageConfig{
+			FlushInterval:   getEnvDuration("USAGE_FLUSH_INTERVAL", 30*time.Second),
+			AlertRecipients: getEnvList("USAGE_ALERT_RECIPIENTS"),
+		},
+		Signing: SigningConfig{
+			Key:               getEnv("SIGNING_KEY", ""),
+			Previous:          getEnvList("SIGNING_KEYS_PREVIOUS"),
+			Responses:         getEnv("SIGNED_RESPONSES", "false") == "true",
+			AWSAccessKey:      getEnv("SIGNING_AWS_ACCESS_KEY", ""),
+			AWSSecretKey:      getEnv("SIGNING_AWS_SECRET_KEY", ""),
+			AWSSessionToken:   getEnv("SIGNING_AWS_SESSION_TOKEN", ""),
+			AzureTenantID:     getEnv("SIGNING_AZURE_TENANT_ID", ""),
+			AzureClientID:     getEnv("SIGNING_AZURE_CLIENT_ID", ""),
+			AzureClientSecret: getEnv("SIGNING_AZURE_CLIENT_SECRET", ""),
+		},
+		TargetLog: TargetLogConfig{
+			Token: getEnv("TARGET_LOG_TOKEN", ""),
+			Grace: getEnvDuration("TARGET_LOG_GRACE", time.Minute),
+		},
+		Analytics: AnalyticsConfig{
+			RefreshInterval: getEnvDuration("ANALYTICS_REFRESH_INTERVAL", 15*time.Minute),
+			WorkStart:       getEnvInt("ANALYTICS_WORK_START", 9),
+			WorkEnd:         getEnvInt("ANALYTICS_WORK_END", 17),
+		},
+		ADAlerts: ADAlertsConfig{
+			Enabled:            getEnv("AD_ACCOUNT_ALERTS_ENABLED", "false") == "true",
+			Interval:           getEnvDuration("AD_ACCOUNT_CHECK_INTERVAL", 6*time.Hour),
+			PasswordExpiryDays: getEnvInt("AD_PASSWORD_EXPIRY_WARNING_DAYS", 14),
+			StaleDays:          getEnvInt("AD_STALE_ACCOUNT_DAYS", 90),
+			AlertRecipients:    getEnvList("AD_ACCOUNT_ALERT_RECIPIENTS"),
+		},
+	}
+
+	// RDP is the premium protocol unless configured otherwise
+	if os.Getenv("LICENSE_PREMIUM_PROTOCOLS") == "" {
+		cfg.License.PremiumProtocols = []string{models.ProtocolRDP}
 	}
 
 	if err := cfg.Validate(); err != nil {
@@ -151,7 +842,24 @@ func (c *Config) Validate() error {
 		return fmt.Errorf("zone name cannot be empty")
 	}
 
+	if _, err := recovery.NewReporter(c.Errors.SentryDSN, "gateway", c.Errors.Environment, ""); err != nil {
+		return fmt.Errorf("SENTRY_DSN: %w", err)
+	}
+
 	// Satellite-specific validation
+	if c.Audit.RetentionMonths < 0 {
+		return fmt.Errorf("AUDIT_RETENTION_MONTHS cannot be negative")
+	}
+	if c.Audit.PartitionsAhead < 1 {
+		return fmt.Errorf("AUDIT_PARTITIONS_AHEAD must be at least 1")
+	}
+	if c.Analytics.WorkStart < 0 || c.Analytics.WorkEnd > 24 || c.Analytics.WorkStart >= c.Analytics.WorkEnd {
+		return fmt.Errorf("ANALYTICS_WORK_START and ANALYTICS_WORK_END must be hours from 0 to 24, start before end")
+	}
+	if c.ADAlerts.Enabled && (c.ADAlerts.PasswordExpiryDays < 1 || c.ADAlerts.StaleDays < 1) {
+		return fmt.Errorf("AD_PASSWORD_EXPIRY_WARNING_DAYS and AD_STALE_ACCOUNT_DAYS must be at least 1")
+	}
+
 	if c.Zone.Type == "satellite" {
 		if c.Zone.HubAddress == "" {
 			return fmt.Errorf("satellite mode requires HUB_ADDRESS to be set")
@@ -159,6 +867,158 @@ func (c *Config) Validate() error {
 		if c.Zone.ID == "" {
 			return fmt.Errorf("satellite mode requires ZONE_ID to be set")
 		}
+		if _, err := uuid.Parse(c.Zone.ID); err != nil {
+			return fmt.Errorf("invalid ZONE_ID: %w", err)
+		}
+		if _, err := logger.ParseLevel(c.Zone.LogForwardLevel); err != nil {
+			return fmt.Errorf("invalid SATELLITE_LOG_LEVEL: %s (must be 'debug', 'info', 'warn' or 'error')", c.Zone.LogForwardLevel)
+		}
+		if !tunnel.ValidOfflinePolicy(tunnel.OfflinePolicy(c.Zone.OfflinePolicy)) {
+			return fmt.Errorf("invalid OFFLINE_POLICY: %s (must be 'deny', 'cached' or 'scheduled')", c.Zone.OfflinePolicy)
+		}
+		if c.Zone.PolicyVerifyKey != "" {
+			if _, err := tunnel.ParseVerifyKey(c.Zone.PolicyVerifyKey); err != nil {
+				return fmt.Errorf("invalid POLICY_VERIFY_KEY: %w", err)
+			}
+		} else if c.Zone.OfflinePolicy != string(tunnel.OfflineDeny) {
+			return fmt.Errorf("OFFLINE_POLICY %s requires POLICY_VERIFY_KEY to be set", c.Zone.OfflinePolicy)
+		}
+	}
+
+	if c.Zone.Type == "hub" && c.Zone.PolicySigningKey != "" {
+		if _, err := tunnel.ParseSigningKey(c.Zone.PolicySigningKey); err != nil {
+			return fmt.Errorf("invalid POLICY_SIGNING_KEY: %w", err)
+		}
+	}
+
+	if _, err := evidence.ParseRules(c.Evidence.DLPRules); err != nil {
+		return fmt.Errorf("invalid DLP_RULES: %w", err)
+	}
+	if c.Evidence.EncryptionKey != "" {
+		if _, err := evidence.ParseKey(c.Evidence.EncryptionKey); err != nil {
+			return fmt.Errorf("invalid EVIDENCE_ENCRYPTION_KEY: %w", err)
+		}
+	}
+
+	for _, channel := range c.Approvals.Channels {
+		if channel != models.ApprovalChannelEmail && channel != models.ApprovalChannelSlack {
+			return fmt.Errorf("invalid APPROVAL_LINK_CHANNELS entry: %s (must be 'email' or 'slack')", channel)
+		}
+	}
+
+	for _, role := range c.Elevation.EligibleRoles {
+		if role != models.RoleUser && role != models.RoleAuditor {
+			return fmt.Errorf("invalid ELEVATION_ELIGIBLE_ROLES entry: %s (must be 'user' or 'auditor')", role)
+		}
+	}
+	for _, role := range c.Elevation.AutoApprove {
+		if role != models.RoleAdmin && role != models.RoleAuditor {
+			return fmt.Errorf("invalid ELEVATION_AUTO_APPROVE_ROLES entry: %s (must be 'admin' or 'auditor')", role)
+		}
+	}
+	if c.Elevation.MaxDuration < time.Hour {
+		return fmt.Errorf("ELEVATION_MAX_DURATION must be at least 1h")
+	}
+
+	for _, category := range c.Dual.Categories {
+		switch category {
+		case models.ChangeCategoryCredentials, models.ChangeCategoryCredentialRules, models.ChangeCategoryUserRoles:
+		default:
+			return fmt.Errorf("invalid DUAL_CONTROL_CATEGORIES entry: %s (must be 'credentials', 'credential_rules' or 'user_roles')", category)
+		}
+	}
+
+	if c.Schedules.ExtendAutoApprove < 0 {
+		return fmt.Errorf("SCHEDULE_EXTEND_AUTO_APPROVE_MINUTES must not be negative")
+	}
+	if c.Schedules.ExtendMax < 1 {
+		return fmt.Errorf("SCHEDULE_EXTEND_MAX_MINUTES must be at least 1")
+	}
+
+	if c.OnCall.SyncInterval < time.Minute {
+		return fmt.Errorf("ONCALL_SYNC_INTERVAL must be at least 1m")
+	}
+	if c.OnCall.Lookahead < c.OnCall.SyncInterval {
+		return fmt.Errorf("ONCALL_LOOKAHEAD must not be shorter than ONCALL_SYNC_INTERVAL")
+	}
+
+	for _, protocol := range c.License.PremiumProtocols {
+		if protocol != models.ProtocolSSH && protocol != models.ProtocolRDP {
+			return fmt.Errorf("invalid LICENSE_PREMIUM_PROTOCOLS entry: %s (must be 'ssh' or 'rdp')", protocol)
+		}
+	}
+	if c.License.GracePeriod < 0 {
+		return fmt.Errorf("LICENSE_GRACE_PERIOD cannot be negative")
+	}
+
+	if err := c.SearchExport().Validate(); err != nil {
+		return fmt.Errorf("invalid SEARCH_EXPORT settings: %w", err)
+	}
+
+	if err := c.Remediation().Validate(); err != nil {
+		return fmt.Errorf("invalid AWX settings: %w", err)
+	}
+
+	if err := c.AccountDiscovery().Validate(); err != nil {
+		return fmt.Errorf("invalid DISCOVERY settings: %w", err)
+	}
+
+	if err := c.CloudSessions().Validate(); err != nil {
+		return fmt.Errorf("invalid CLOUD settings: %w", err)
+	}
+
+	if err := c.Standby().Validate(); err != nil {
+		return fmt.Errorf("invalid FAILOVER settings: %w", err)
+	}
+
+	if err := c.RecordingStorage().Validate(); err != nil {
+		return fmt.Errorf("invalid RECORDINGS settings: %w", err)
+	}
+
+	if err := c.BodyLimits().Validate(); err != nil {
+		return fmt.Errorf("invalid BODY_LIMIT settings: %w", err)
+	}
+
+	if c.Idem.TTL < time.Minute {
+		return fmt.Errorf("IDEMPOTENCY_TTL must be at least 1m")
+	}
+
+	if c.Usage.FlushInterval < time.Second {
+		return fmt.Errorf("USAGE_FLUSH_INTERVAL must be at least 1s")
+	}
+
+	if c.Discovery.FingerprintTimeout <= 0 {
+		return fmt.Errorf("FINGERPRINT_TIMEOUT must be positive")
+	}
+
+	if c.TargetLog.Grace < 0 {
+		return fmt.Errorf("TARGET_LOG_GRACE cannot be negative")
+	}
+
+	if err := c.SigningKeys().Validate(); err != nil {
+		return fmt.Errorf("invalid SIGNING settings: %w", err)
+	}
+
+	// Downstream components verify against the published keys, which never
+	// include the session secret
+	if c.Signing.Responses && (c.Signing.Key == "" || c.Signing.Key == keys.ProviderSecret) {
+		return fmt.Errorf("SIGNED_RESPONSES requires SIGNING_KEY to be a public key")
+	}
+
+	if c.GraphQL.MaxDepth < 1 {
+		return fmt.Errorf("GRAPHQL_MAX_DEPTH must be at least 1")
+	}
+
+	if c.Harness.Enabled && !c.DevMode {
+		return fmt.Errorf("TEST_HARNESS_ENABLED requires DEV_MODE")
+	}
+
+	if c.Demo.Seed && !c.DevMode {
+		return fmt.Errorf("DEV_SEED requires DEV_MODE")
+	}
+
+	if err := c.SessionStores().Validate(); err != nil {
+		return err
 	}
 
 	if c.Session.Secret == "change-me-in-production" {
@@ -181,6 +1041,155 @@ func (c *Config) Validate() error {
 	return nil
 }
 
+// ElevationPolicy returns the role elevation policy
+func (c *Config) ElevationPolicy() elevation.Policy {
+	return elevation.Policy{
+		EligibleRoles: c.Elevation.EligibleRoles,
+		AutoApprove:   c.Elevation.AutoApprove,
+		MaxDuration:   c.Elevation.MaxDuration,
+	}
+}
+
+// LicensePolicy returns the policy deciding what an expired license allows
+func (c *Config) LicensePolicy() license.Policy {
+	return license.Policy{
+		GracePeriod:   c.License.GracePeriod,
+		ExpiryWarning: c.License.ExpiryWarning,
+	}
+}
+
+// SearchExport returns the search exporter settings
+func (c *Config) SearchExport() searchexport.Config {
+	return searchexport.Config{
+		URLs:        c.Search.URLs,
+		Username:    c.Search.Username,
+		Password:    c.Search.Password,
+		APIKey:      c.Search.APIKey,
+		CAFile:      c.Search.CAFile,
+		IndexPrefix: c.Search.IndexPrefix,
+		BatchSize:   c.Search.BatchSize,
+		Interval:    c.Search.Interval,
+		MaxRetries:  c.Search.MaxRetries,
+		Zone:        c.Zone.Name,
+		Format:      c.Search.Format,
+	}
+}
+
+// Remediation returns the AWX remediation settings
+func (c *Config) Remediation() remediation.Config {
+	return remediation.Config{
+		URL:                c.AWX.URL,
+		Token:              c.AWX.Token,
+		CAFile:             c.AWX.CAFile,
+		SessionEndTemplate: c.AWX.SessionEndTemplate,
+		ViolationTemplate:  c.AWX.ViolationTemplate,
+		Interval:           c.AWX.PollInterval,
+	}
+}
+
+// AccountDiscovery returns the account discovery and onboarding settings
+func (c *Config) AccountDiscovery() discovery.Config {
+	return discovery.Config{
+		Interval:                 c.Discovery.Interval,
+		RotateEvery:              c.Discovery.RotateEvery,
+		ScanTimeout:              c.Discovery.ScanTimeout,
+		VaultPath:                c.Discovery.VaultPath,
+		PasswordLength:           c.Discovery.PasswordLength,
+		KeyVaultPath:             c.Discovery.KeyVaultPath,
+		KeyFrom:                  c.Discovery.KeyFrom,
+		AlertRecipients:          c.Discovery.AlertRecipients,
+		LAPSRotateEvery:          c.Discovery.LAPSRotateEvery,
+		LAPSVaultPath:            c.Discovery.LAPSVaultPath,
+		LAPSRotateAfterRetrieval: c.Discovery.LAPSRotateAfterRetrieval,
+		LAPSOverdueGrace:         c.Discovery.LAPSOverdueGrace,
+	}
+}
+
+// CloudSessions returns the cloud console session broker settings
+func (c *Config) CloudSessions() cloud.Config {
+	return cloud.Config{
+		SessionDuration:   c.Cloud.SessionDuration,
+		AWSRegion:         c.Cloud.AWSRegion,
+		AWSConsoleURL:     c.Cloud.AWSConsoleURL,
+		AWSSourceIdentity: c.Cloud.AWSSourceIdentity,
+		Issuer:            c.Server.FrontendURL,
+	}
+}
+
+// Standby returns the gateway's role in an active/standby pair and how a
+// standby watches the primary
+func (c *Config) Standby() failover.Config {
+	return failover.Config{
+		Role:       c.Failover.Role,
+		Node:       c.Failover.Node,
+		PrimaryURL: c.Failover.PrimaryURL,
+		Interval:   c.Failover.ProbeInterval,
+		Threshold:  c.Failover.Threshold,
+	}
+}
+
+// DemoSeed returns where the demo data's targets point
+func (c *Config) DemoSeed() demo.Config {
+	return demo.Config{
+		SSHAddress: c.Demo.SSHAddress,
+		RDPAddress: c.Demo.RDPAddress,
+		Username:   c.Demo.Username,
+		Password:   c.Demo.Password,
+	}
+}
+
+// RecordingStorage returns where session recordings are stored
+func (c *Config) RecordingStorage() recordings.Config {
+	return recordings.Config{
+		Backend:   c.Recording.Storage,
+		Dir:       c.Recording.Dir,
+		Bucket:    c.Recording.Bucket,
+		Prefix:    c.Recording.Prefix,
+		Endpoint:  c.Recording.Endpoint,
+		Region:    c.Recording.Region,
+		AccessKey: c.Recording.AccessKey,
+		SecretKey: c.Recording.SecretKey,
+		SASToken:  c.Recording.SASToken,
+		PartSize:  c.Recording.PartSize,
+	}
+}
+
+// SessionStores returns where sessions and OAuth2 states are kept
+func (c *Config) SessionStores() auth.StoreConfig {
+	return auth.StoreConfig{
+		Backend:   c.Session.Store,
+		RedisURL:  c.Session.RedisURL,
+		KeyPrefix: c.Session.RedisKeyPrefix,
+	}
+}
+
+// SigningKeys returns the keys issued artifacts are signed with
+func (c *Config) SigningKeys() keys.Config {
+	return keys.Config{
+		Key:               c.Signing.Key,
+		Previous:          c.Signing.Previous,
+		Secret:            c.Session.Secret,
+		AWSAccessKey:      c.Signing.AWSAccessKey,
+		AWSSecretKey:      c.Signing.AWSSecretKey,
+		AWSSessionToken:   c.Signing.AWSSessionToken,
+		AzureTenantID:     c.Signing.AzureTenantID,
+		AzureClientID:     c.Signing.AzureClientID,
+		AzureClientSecret: c.Signing.AzureClientSecret,
+	}
+}
+
+// BodyLimits returns the request body limit of each route class
+func (c *Config) BodyLimits() validate.Limits {
+	return validate.Limits{
+		Default: int64(c.BodyLimit.Default),
+		Routes: map[string]int64{
+			"/api/v1/auth/":          int64(c.BodyLimit.Auth),
+			"/api/v1/schedules/bulk": int64(c.BodyLimit.Bulk),
+			"/api/v1/target-logs":    int64(c.BodyLimit.Bulk),
+		},
+	}
+}
+
 // getEnv retrieves an environment variable or returns a default value
 func getEnv(key, defaultValue string) string {
 	if value := os.Getenv(key); value != "" {
@@ -199,6 +1208,22 @@ func getEnvInt(key string, defaultValue int) int {
 	return defaultValue
 }
 
+// getEnvList retrieves a comma-separated environment variable as a list
+func getEnvList(key string) []string {
+	return getEnvListSep(key, ",")
+}
+
+// getEnvListSep retrieves a list environment variable separated by sep
+func getEnvListSep(key, sep string) []string {
+	var values []string
+	for _, value := range strings.Split(os.Getenv(key), sep) {
+		if value = strings.TrimSpace(value); value != "" {
+			values = append(values, value)
+		}
+	}
+	return values
+}
+
 // getEnvDuration retrieves a duration environment variable or returns a default value
 func getEnvDuration(key string, defaultValue time.Duration) time.Duration {
 	if value := os.Getenv(key); value != "" {
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"time"
 
+	"github.com/VanCannon/openpam/pkg/logger"
 	"github.com/jmoiron/sqlx"
 	_ "github.com/lib/pq" // PostgreSQL driver
 )
@@ -26,6 +27,10 @@ type Config struct {
 // DB wraps sqlx.DB with additional functionality
 type DB struct {
 	*sqlx.DB
+	dsn string
+
+	logger    *logger.Logger
+	slowQuery time.Duration
 }
 
 // New creates a new database connection with the provided configuration
@@ -59,7 +64,13 @@ func New(cfg Config) (*DB, error) {
 		db.SetConnMaxIdleTime(cfg.ConnMaxIdleTime)
 	}
 
-	return &DB{DB: db}, nil
+	return &DB{DB: db, dsn: dsn}, nil
+}
+
+// DSN returns the connection string, for components that need a dedicated
+// connection outside the pool such as LISTEN/NOTIFY listeners
+func (db *DB) DSN() string {
+	return db.dsn
 }
 
 // Ping verifies the database connection is alive
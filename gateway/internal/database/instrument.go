@@ -0,0 +1,263 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"expvar"
+	"reflect"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/VanCannon/openpam/pkg/logger"
+	"github.com/jmoiron/sqlx"
+)
+
+// Query metrics, served with the other runtime metrics on /api/v1/admin/metrics.
+// Statements run inside a transaction are not counted.
+var (
+	queriesRun    = expvar.NewInt("db_queries")
+	queriesFailed = expvar.NewInt("db_queries_failed")
+	queriesSlow   = expvar.NewInt("db_queries_slow")
+	callerStats   = newQueryStats()
+)
+
+func init() {
+	expvar.Publish("db_queries_by_caller", callerStats)
+}
+
+// maxLoggedQuery is how much of a slow query's SQL is logged
+const maxLoggedQuery = 1000
+
+// Stack frames of this package and of sqlx, which calls back into it when a
+// repository passes the DB to an sqlx helper
+var skippedFrames = []string{
+	"github.com/VanCannon/openpam/gateway/internal/database.",
+	"github.com/jmoiron/sqlx.",
+}
+
+// LogSlowQueries logs every query that takes longer than threshold, with the
+// repository method that ran it. A zero threshold turns the log off.
+func (db *DB) LogSlowQueries(log *logger.Logger, threshold time.Duration) {
+	db.logger = log
+	db.slowQuery = threshold
+}
+
+// GetContext runs a query returning a single row into dest
+func (db *DB) GetContext(ctx context.Context, dest interface{}, query string, args ...interface{}) error {
+	start := time.Now()
+	err := db.DB.GetContext(ctx, dest, query, args...)
+	rows := int64(1)
+	if err != nil {
+		rows = 0
+	}
+	db.observe(query, start, rows, err)
+	return err
+}
+
+// SelectContext runs a query returning rows into the slice dest
+func (db *DB) SelectContext(ctx context.Context, dest interface{}, query string, args ...interface{}) error {
+	start := time.Now()
+	err := db.DB.SelectContext(ctx, dest, query, args...)
+	var rows int64
+	if v := reflect.Indirect(reflect.ValueOf(dest)); v.Kind() == reflect.Slice {
+		rows = int64(v.Len())
+	}
+	db.observe(query, start, rows, err)
+	return err
+}
+
+// ExecContext runs a statement, counting the rows it affected
+func (db *DB) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	start := time.Now()
+	result, err := db.DB.ExecContext(ctx, query, args...)
+	var rows int64
+	if err == nil {
+		rows, _ = result.RowsAffected()
+	}
+	db.observe(query, start, rows, err)
+	return result, err
+}
+
+// NamedExecContext runs a statement with named parameters
+func (db *DB) NamedExecContext(ctx context.Context, query string, arg interface{}) (sql.Result, error) {
+	start := time.Now()
+	result, err := db.DB.NamedExecContext(ctx, query, arg)
+	var rows int64
+	if err == nil {
+		rows, _ = result.RowsAffected()
+	}
+	db.observe(query, start, rows, err)
+	return result, err
+}
+
+// QueryContext runs a query. Only the time to the first row is measured.
+func (db *DB) QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+	start := time.Now()
+	rows, err := db.DB.QueryContext(ctx, query, args...)
+	db.observe(query, start, 0, err)
+	return rows, err
+}
+
+// QueryxContext runs a query. Only the time to the first row is measured.
+func (db *DB) QueryxContext(ctx context.Context, query string, args ...interface{}) (*sqlx.Rows, error) {
+	start := time.Now()
+	rows, err := db.DB.QueryxContext(ctx, query, args...)
+	db.observe(query, start, 0, err)
+	return rows, err
+}
+
+// QueryRowContext runs a query returning at most one row. Its error surfaces
+// on Scan, so only the time is measured.
+func (db *DB) QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row {
+	start := time.Now()
+	row := db.DB.QueryRowContext(ctx, query, args...)
+	db.observe(query, start, 1, row.Err())
+	return row
+}
+
+// QueryRowxContext runs a query returning at most one row
+func (db *DB) QueryRowxContext(ctx context.Context, query string, args ...interface{}) *sqlx.Row {
+	start := time.Now()
+	row := db.DB.QueryRowxContext(ctx, query, args...)
+	db.observe(query, start, 1, row.Err())
+	return row
+}
+
+// observe records a finished query and logs it if it was slow
+func (db *DB) observe(query string, start time.Time, rows int64, err error) {
+	elapsed := time.Since(start)
+	method := caller()
+
+	// No rows is an answer, not a failure
+	failed := err != nil && !errors.Is(err, sql.ErrNoRows)
+
+	queriesRun.Add(1)
+	if failed {
+		queriesFailed.Add(1)
+	}
+	callerStats.add(method, elapsed, rows, failed)
+
+	if db.slowQuery <= 0 || elapsed < db.slowQuery || db.logger == nil {
+		return
+	}
+	queriesSlow.Add(1)
+
+	fields := map[string]interface{}{
+		"caller":      method,
+		"duration_ms": elapsed.Milliseconds(),
+		"rows":        rows,
+		"query":       compactQuery(query),
+	}
+	if failed {
+		fields["error"] = err.Error()
+	}
+	db.logger.Warn("Slow query", fields)
+}
+
+// caller names the function that ran a query, such as
+// "AuditLogRepository.List", from the first frame outside this package and sqlx
+func caller() string {
+	var pcs [12]uintptr
+	n := runtime.Callers(3, pcs[:])
+	frames := runtime.CallersFrames(pcs[:n])
+	for {
+		frame, more := frames.Next()
+		if !skippedFrame(frame.Function) {
+			return shortFuncName(frame.Function)
+		}
+		if !more {
+			return "unknown"
+		}
+	}
+}
+
+func skippedFrame(function string) bool {
+	for _, prefix := range skippedFrames {
+		if strings.HasPrefix(function, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// shortFuncName drops the import path, the receiver's pointer and any
+// closure suffix from a function name, keeping the package of plain functions
+func shortFuncName(name string) string {
+	if i := strings.LastIndex(name, "/"); i >= 0 {
+		name = name[i+1:]
+	}
+	if i := strings.Index(name, ".func"); i >= 0 {
+		name = name[:i]
+	}
+	if i := strings.Index(name, ".("); i >= 0 {
+		name = strings.NewReplacer("(*", "", "(", "", ")", "").Replace(name[i+1:])
+	}
+	return name
+}
+
+// compactQuery collapses the whitespace of a query for the log
+func compactQuery(query string) string {
+	query = strings.Join(strings.Fields(query), " ")
+	if len(query) > maxLoggedQuery {
+		query = query[:maxLoggedQuery] + "..."
+	}
+	return query
+}
+
+// queryStats totals queries by the function that ran them
+type queryStats struct {
+	mu      sync.Mutex
+	callers map[string]*callerTotals
+}
+
+type callerTotals struct {
+	Calls         int64   `json:"calls"`
+	Errors        int64   `json:"errors"`
+	Rows          int64   `json:"rows"`
+	TotalMillis   float64 `json:"total_ms"`
+	MaxMillis     float64 `json:"max_ms"`
+	AverageMillis float64 `json:"avg_ms"`
+}
+
+func newQueryStats() *queryStats {
+	return &queryStats{callers: make(map[string]*callerTotals)}
+}
+
+func (s *queryStats) add(method string, elapsed time.Duration, rows int64, failed bool) {
+	ms := float64(elapsed.Microseconds()) / 1000
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	t := s.callers[method]
+	if t == nil {
+		t = &callerTotals{}
+		s.callers[method] = t
+	}
+	t.Calls++
+	t.Rows += rows
+	t.TotalMillis += ms
+	t.MaxMillis = max(t.MaxMillis, ms)
+	if failed {
+		t.Errors++
+	}
+}
+
+// String implements expvar.Var
+func (s *queryStats) String() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	out := make(map[string]callerTotals, len(s.callers))
+	for method, t := range s.callers {
+		c := *t
+		c.AverageMillis = c.TotalMillis / float64(c.Calls)
+		out[method] = c
+	}
+	data, _ := json.Marshal(out)
+	return string(data)
+}
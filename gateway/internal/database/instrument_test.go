@@ -0,0 +1,51 @@
+package database
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func TestShortFuncName(t *testing.T) {
+	tests := []struct {
+		name string
+		want string
+	}{
+		{"github.com/VanCannon/openpam/gateway/internal/repository.(*AuditLogRepository).List", "AuditLogRepository.List"},
+		{"github.com/VanCannon/openpam/gateway/internal/repository.(*ScheduleRepository).Approve.func1", "ScheduleRepository.Approve"},
+		{"github.com/VanCannon/openpam/gateway/internal/repository.versionMiss", "repository.versionMiss"},
+		{"github.com/VanCannon/openpam/gateway/internal/searchexport.exporter.run", "searchexport.exporter.run"},
+		{"main.run", "main.run"},
+	}
+	for _, tt := range tests {
+		if got := shortFuncName(tt.name); got != tt.want {
+			t.Errorf("shortFuncName(%q) = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestQueryStats(t *testing.T) {
+	s := newQueryStats()
+	s.add("AuditLogRepository.List", 10*time.Millisecond, 50, false)
+	s.add("AuditLogRepository.List", 30*time.Millisecond, 20, true)
+
+	var out map[string]callerTotals
+	if err := json.Unmarshal([]byte(s.String()), &out); err != nil {
+		t.Fatal(err)
+	}
+	got := out["AuditLogRepository.List"]
+	want := callerTotals{Calls: 2, Errors: 1, Rows: 70, TotalMillis: 40, MaxMillis: 30, AverageMillis: 20}
+	if got != want {
+		t.Errorf("stats = %+v, want %+v", got, want)
+	}
+}
+
+func TestCompactQuery(t *testing.T) {
+	got := compactQuery(`
+		SELECT id
+		FROM   audit_logs
+		WHERE  user_id = $1`)
+	if want := "SELECT id FROM audit_logs WHERE user_id = $1"; got != want {
+		t.Errorf("compactQuery() = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1 @@
+ALTER TABLE targets DROP COLUMN IF EXISTS keepalive_interval;
@@ -0,0 +1,2 @@
+-- Per-target SSH keep-alive interval in seconds (NULL uses the default, 0 disables)
+ALTER TABLE targets ADD COLUMN IF NOT EXISTS keepalive_interval INTEGER CHECK (keepalive_interval IS NULL OR keepalive_interval >= 0);
@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS idx_credentials_target_default;
+ALTER TABLE credentials DROP COLUMN IF EXISTS sort_order;
+ALTER TABLE credentials DROP COLUMN IF EXISTS is_default;
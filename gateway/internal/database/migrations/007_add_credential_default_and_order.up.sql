@@ -0,0 +1,6 @@
+-- Credential selection: an explicit default per target and a display/selection order
+ALTER TABLE credentials ADD COLUMN IF NOT EXISTS is_default BOOLEAN NOT NULL DEFAULT false;
+ALTER TABLE credentials ADD COLUMN IF NOT EXISTS sort_order INTEGER NOT NULL DEFAULT 0;
+
+-- At most one default credential per target
+CREATE UNIQUE INDEX IF NOT EXISTS idx_credentials_target_default ON credentials(target_id) WHERE is_default;
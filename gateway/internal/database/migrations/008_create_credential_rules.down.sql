@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS credential_rules;
+ALTER TABLE credentials DROP COLUMN IF EXISTS tags;
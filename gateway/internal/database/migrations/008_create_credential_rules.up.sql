@@ -0,0 +1,24 @@
+-- Free-form credential tags (e.g. 'privileged') that access rules can refer to
+ALTER TABLE credentials ADD COLUMN IF NOT EXISTS tags TEXT[] NOT NULL DEFAULT '{}';
+
+-- Credential access rules: who may (or may not) use which credential.
+-- A credential matched by any allow rule is restricted to the subjects of those rules;
+-- a matching deny rule always wins. Credentials matched by no rule stay usable by everyone.
+CREATE TABLE credential_rules (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    name VARCHAR(255) NOT NULL,
+    description TEXT,
+    effect VARCHAR(10) NOT NULL CHECK (effect IN ('allow', 'deny')),
+    user_id UUID REFERENCES users(id) ON DELETE CASCADE, -- Subject: a specific user (NULL = any user)
+    role VARCHAR(50) CHECK (role IS NULL OR role IN ('admin', 'user', 'auditor')), -- Subject: a role (NULL = any role)
+    target_id UUID REFERENCES targets(id) ON DELETE CASCADE, -- Scope: a specific target (NULL = all targets)
+    credential_id UUID REFERENCES credentials(id) ON DELETE CASCADE, -- Object: a specific credential
+    credential_tag VARCHAR(100), -- Object: every credential carrying this tag
+    enabled BOOLEAN NOT NULL DEFAULT true,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    CHECK (credential_id IS NOT NULL OR credential_tag IS NOT NULL)
+);
+
+CREATE INDEX idx_credential_rules_target_id ON credential_rules(target_id);
+CREATE INDEX idx_credential_rules_enabled ON credential_rules(enabled);
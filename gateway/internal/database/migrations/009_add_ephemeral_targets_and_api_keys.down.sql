@@ -0,0 +1,7 @@
+DROP TABLE IF EXISTS api_keys;
+DROP INDEX IF EXISTS idx_targets_deleted_at;
+DROP INDEX IF EXISTS idx_targets_expires_at;
+ALTER TABLE targets DROP CONSTRAINT IF EXISTS targets_ephemeral_expires_at;
+ALTER TABLE targets DROP COLUMN IF EXISTS deleted_at;
+ALTER TABLE targets DROP COLUMN IF EXISTS expires_at;
+ALTER TABLE targets DROP COLUMN IF EXISTS ephemeral;
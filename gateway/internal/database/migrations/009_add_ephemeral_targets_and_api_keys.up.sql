@@ -0,0 +1,26 @@
+-- Ephemeral targets: short-lived hosts registered by automation that expire on their own
+ALTER TABLE targets ADD COLUMN IF NOT EXISTS ephemeral BOOLEAN NOT NULL DEFAULT false;
+ALTER TABLE targets ADD COLUMN IF NOT EXISTS expires_at TIMESTAMP WITH TIME ZONE;
+ALTER TABLE targets ADD CONSTRAINT targets_ephemeral_expires_at CHECK (NOT ephemeral OR expires_at IS NOT NULL);
+
+-- Soft delete: audit_logs reference targets, so deleted targets are hidden rather than removed
+ALTER TABLE targets ADD COLUMN IF NOT EXISTS deleted_at TIMESTAMP WITH TIME ZONE;
+
+CREATE INDEX IF NOT EXISTS idx_targets_expires_at ON targets(expires_at) WHERE ephemeral AND deleted_at IS NULL;
+CREATE INDEX IF NOT EXISTS idx_targets_deleted_at ON targets(deleted_at);
+
+-- API keys for automation. Only a SHA-256 hash of the key is stored.
+CREATE TABLE api_keys (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    name VARCHAR(255) NOT NULL,
+    key_prefix VARCHAR(16) NOT NULL, -- First characters of the key, shown to identify it
+    key_hash VARCHAR(64) NOT NULL UNIQUE,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE, -- The user the key acts as
+    role VARCHAR(50) NOT NULL DEFAULT 'user' CHECK (role IN ('admin', 'user', 'auditor')),
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    expires_at TIMESTAMP WITH TIME ZONE,
+    last_used_at TIMESTAMP WITH TIME ZONE,
+    revoked_at TIMESTAMP WITH TIME ZONE
+);
+
+CREATE INDEX idx_api_keys_user_id ON api_keys(user_id);
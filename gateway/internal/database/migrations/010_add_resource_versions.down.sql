@@ -0,0 +1,5 @@
+ALTER TABLE schedules DROP COLUMN IF EXISTS version;
+ALTER TABLE users DROP COLUMN IF EXISTS version;
+ALTER TABLE credentials DROP COLUMN IF EXISTS version;
+ALTER TABLE zones DROP COLUMN IF EXISTS version;
+ALTER TABLE targets DROP COLUMN IF EXISTS version;
@@ -0,0 +1,11 @@
+-- Event log for live streaming: audit and system-audit changes are appended here in the
+-- same transaction and announced with NOTIFY, so every gateway replica can push them to
+-- its subscribers and clients can resume from the last event ID they saw
+CREATE TABLE events (
+    id BIGSERIAL PRIMARY KEY,
+    type VARCHAR(100) NOT NULL, -- e.g. 'audit.session_started', 'system.login_success'
+    payload JSONB NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX idx_events_created_at ON events(created_at);
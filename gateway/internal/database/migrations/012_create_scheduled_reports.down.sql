@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS report_runs;
+DROP TABLE IF EXISTS scheduled_reports;
@@ -0,0 +1,36 @@
+-- Scheduled reports: compliance reports (e.g. the weekly access review) rendered on a
+-- cron schedule and emailed to their recipients
+CREATE TABLE scheduled_reports (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    name VARCHAR(255) NOT NULL,
+    report_type VARCHAR(50) NOT NULL CHECK (report_type IN ('access_review', 'session_activity', 'system_audit')),
+    format VARCHAR(10) NOT NULL DEFAULT 'csv' CHECK (format IN ('csv', 'pdf')),
+    cron_expression VARCHAR(100) NOT NULL,
+    timezone VARCHAR(50) NOT NULL DEFAULT 'UTC',
+    filters JSONB NOT NULL DEFAULT '{}',
+    recipients TEXT[] NOT NULL,
+    enabled BOOLEAN NOT NULL DEFAULT true,
+    next_run_at TIMESTAMP WITH TIME ZONE,
+    last_run_at TIMESTAMP WITH TIME ZONE, -- Scheduled time of the last run; the next report covers activity since then
+    created_by UUID REFERENCES users(id) ON DELETE SET NULL,
+    version INTEGER NOT NULL DEFAULT 1,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX idx_scheduled_reports_next_run_at ON scheduled_reports(next_run_at) WHERE enabled;
+
+-- Run history, one row per attempt
+CREATE TABLE report_runs (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    report_id UUID NOT NULL REFERENCES scheduled_reports(id) ON DELETE CASCADE,
+    status VARCHAR(20) NOT NULL CHECK (status IN ('running', 'succeeded', 'failed')),
+    period_start TIMESTAMP WITH TIME ZONE NOT NULL,
+    period_end TIMESTAMP WITH TIME ZONE NOT NULL,
+    row_count INTEGER NOT NULL DEFAULT 0,
+    error_message TEXT,
+    started_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    finished_at TIMESTAMP WITH TIME ZONE
+);
+
+CREATE INDEX idx_report_runs_report_id ON report_runs(report_id, started_at DESC);
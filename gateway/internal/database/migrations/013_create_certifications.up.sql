@@ -0,0 +1,36 @@
+-- Access certification campaigns: periodic review of who holds which entitlement.
+-- Items are a snapshot of the entitlements in scope when the campaign was launched.
+CREATE TABLE certification_campaigns (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    name VARCHAR(255) NOT NULL,
+    description TEXT,
+    status VARCHAR(20) NOT NULL DEFAULT 'active' CHECK (status IN ('active', 'completed')),
+    scope JSONB NOT NULL DEFAULT '{}',
+    reviewer_ids UUID[] NOT NULL DEFAULT '{}',
+    revoke_undecided BOOLEAN NOT NULL DEFAULT false, -- Revoke items nobody reviewed when the campaign closes
+    due_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    created_by UUID REFERENCES users(id) ON DELETE SET NULL,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    completed_at TIMESTAMP WITH TIME ZONE
+);
+
+CREATE INDEX idx_certification_campaigns_due_at ON certification_campaigns(due_at) WHERE status = 'active';
+
+CREATE TABLE certification_items (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    campaign_id UUID NOT NULL REFERENCES certification_campaigns(id) ON DELETE CASCADE,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    entitlement_type VARCHAR(50) NOT NULL CHECK (entitlement_type IN ('role', 'credential_rule', 'schedule')),
+    entitlement_id UUID, -- Rule or schedule ID; NULL for roles
+    entitlement_description TEXT NOT NULL,
+    reviewer_id UUID REFERENCES users(id) ON DELETE SET NULL, -- NULL means any admin may decide
+    decision VARCHAR(20) NOT NULL DEFAULT 'pending' CHECK (decision IN ('pending', 'certified', 'revoked', 'not_reviewed')),
+    comment TEXT,
+    decided_by UUID REFERENCES users(id) ON DELETE SET NULL,
+    decided_at TIMESTAMP WITH TIME ZONE,
+    executed_at TIMESTAMP WITH TIME ZONE, -- When a revocation was applied
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX idx_certification_items_campaign_id ON certification_items(campaign_id);
+CREATE INDEX idx_certification_items_reviewer_id ON certification_items(reviewer_id) WHERE decision = 'pending';
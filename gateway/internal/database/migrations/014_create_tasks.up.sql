@@ -0,0 +1,44 @@
+-- Privileged tasks: pre-approved command templates that users can run on a target
+-- without an interactive session
+CREATE TABLE tasks (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    name VARCHAR(255) NOT NULL,
+    description TEXT,
+    target_id UUID NOT NULL REFERENCES targets(id) ON DELETE CASCADE,
+    credential_id UUID REFERENCES credentials(id) ON DELETE SET NULL, -- NULL selects the user's allowed credential
+    command_template TEXT NOT NULL,
+    parameters JSONB NOT NULL DEFAULT '[]',
+    timeout_seconds INTEGER NOT NULL DEFAULT 60 CHECK (timeout_seconds > 0),
+    require_schedule BOOLEAN NOT NULL DEFAULT true,
+    enabled BOOLEAN NOT NULL DEFAULT true,
+    created_by UUID REFERENCES users(id) ON DELETE SET NULL,
+    version INTEGER NOT NULL DEFAULT 1,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX idx_tasks_target_id ON tasks(target_id);
+
+-- Every execution with the exact command and its output, kept as an audit artifact.
+-- Executions outlive their task so the record stays intact.
+CREATE TABLE task_executions (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    task_id UUID REFERENCES tasks(id) ON DELETE SET NULL,
+    task_name VARCHAR(255) NOT NULL,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE RESTRICT,
+    target_id UUID NOT NULL REFERENCES targets(id) ON DELETE RESTRICT,
+    credential_id UUID REFERENCES credentials(id) ON DELETE SET NULL,
+    parameters JSONB NOT NULL DEFAULT '{}',
+    command TEXT NOT NULL,
+    status VARCHAR(20) NOT NULL CHECK (status IN ('running', 'succeeded', 'failed')),
+    exit_code INTEGER,
+    output TEXT NOT NULL DEFAULT '',
+    output_truncated BOOLEAN NOT NULL DEFAULT false,
+    error_message TEXT,
+    client_ip VARCHAR(255),
+    started_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    finished_at TIMESTAMP WITH TIME ZONE
+);
+
+CREATE INDEX idx_task_executions_task_id ON task_executions(task_id, started_at DESC);
+CREATE INDEX idx_task_executions_user_id ON task_executions(user_id, started_at DESC);
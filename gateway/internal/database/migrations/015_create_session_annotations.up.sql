@@ -0,0 +1,15 @@
+-- Auditor annotations and bookmarks on recorded sessions, positioned by their
+-- offset from the start of the recording
+CREATE TABLE session_annotations (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    audit_log_id UUID NOT NULL REFERENCES audit_logs(id) ON DELETE CASCADE,
+    author_id UUID REFERENCES users(id) ON DELETE SET NULL,
+    kind VARCHAR(20) NOT NULL CHECK (kind IN ('annotation', 'bookmark')),
+    offset_ms BIGINT NOT NULL CHECK (offset_ms >= 0),
+    label VARCHAR(255),
+    note TEXT,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX idx_session_annotations_audit_log_id ON session_annotations(audit_log_id, offset_ms);
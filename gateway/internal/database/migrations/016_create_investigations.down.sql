@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS investigation_items;
+DROP TABLE IF EXISTS investigations;
@@ -0,0 +1,40 @@
+-- Investigations: cases that group related sessions, system audit events,
+-- annotations and notes under an owner
+CREATE TABLE investigations (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    title VARCHAR(255) NOT NULL,
+    description TEXT,
+    status VARCHAR(20) NOT NULL DEFAULT 'open' CHECK (status IN ('open', 'in_progress', 'closed')),
+    owner_id UUID REFERENCES users(id) ON DELETE SET NULL,
+    created_by UUID REFERENCES users(id) ON DELETE SET NULL,
+    version INTEGER NOT NULL DEFAULT 1,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    closed_at TIMESTAMP WITH TIME ZONE
+);
+
+CREATE INDEX idx_investigations_status ON investigations(status);
+CREATE INDEX idx_investigations_owner_id ON investigations(owner_id);
+
+-- The evidence attached to a case. Exactly one reference column is set for the
+-- item type, or the note text for notes.
+CREATE TABLE investigation_items (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    investigation_id UUID NOT NULL REFERENCES investigations(id) ON DELETE CASCADE,
+    item_type VARCHAR(20) NOT NULL CHECK (item_type IN ('session', 'system_event', 'annotation', 'note')),
+    audit_log_id UUID REFERENCES audit_logs(id) ON DELETE CASCADE,
+    system_audit_log_id UUID REFERENCES system_audit_logs(id) ON DELETE CASCADE,
+    annotation_id UUID REFERENCES session_annotations(id) ON DELETE CASCADE,
+    note TEXT,
+    added_by UUID REFERENCES users(id) ON DELETE SET NULL,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    CHECK ((item_type = 'session') = (audit_log_id IS NOT NULL)),
+    CHECK ((item_type = 'system_event') = (system_audit_log_id IS NOT NULL)),
+    CHECK ((item_type = 'annotation') = (annotation_id IS NOT NULL)),
+    CHECK ((item_type = 'note') = (note IS NOT NULL))
+);
+
+CREATE INDEX idx_investigation_items_investigation_id ON investigation_items(investigation_id, created_at);
+CREATE UNIQUE INDEX idx_investigation_items_session ON investigation_items(investigation_id, audit_log_id) WHERE audit_log_id IS NOT NULL;
+CREATE UNIQUE INDEX idx_investigation_items_event ON investigation_items(investigation_id, system_audit_log_id) WHERE system_audit_log_id IS NOT NULL;
+CREATE UNIQUE INDEX idx_investigation_items_annotation ON investigation_items(investigation_id, annotation_id) WHERE annotation_id IS NOT NULL;
@@ -0,0 +1,18 @@
+-- Context captured when a policy violation fires in a session: the last terminal
+-- output or RDP display instructions, encrypted with the gateway's evidence key.
+-- Each row belongs to the policy_violation system audit event it was captured for.
+CREATE TABLE violation_evidence (
+    id UUID PRIMARY KEY,
+    system_audit_log_id UUID NOT NULL REFERENCES system_audit_logs(id) ON DELETE CASCADE,
+    audit_log_id UUID NOT NULL REFERENCES audit_logs(id) ON DELETE CASCADE,
+    violation_type VARCHAR(50) NOT NULL,
+    kind VARCHAR(50) NOT NULL,
+    content_type VARCHAR(100) NOT NULL,
+    size INTEGER NOT NULL,
+    sha256 CHAR(64) NOT NULL,
+    ciphertext BYTEA NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX idx_violation_evidence_audit_log_id ON violation_evidence(audit_log_id, created_at);
+CREATE INDEX idx_violation_evidence_system_audit_log_id ON violation_evidence(system_audit_log_id);
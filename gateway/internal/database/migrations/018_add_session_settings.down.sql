@@ -0,0 +1,3 @@
+ALTER TABLE credential_rules DROP COLUMN IF EXISTS settings;
+ALTER TABLE targets DROP COLUMN IF EXISTS settings;
+ALTER TABLE zones DROP COLUMN IF EXISTS settings;
@@ -0,0 +1,5 @@
+-- Session settings: zone defaults, overridden per target and then per credential rule.
+-- Unset keys inherit from the level above.
+ALTER TABLE zones ADD COLUMN IF NOT EXISTS settings JSONB NOT NULL DEFAULT '{}';
+ALTER TABLE targets ADD COLUMN IF NOT EXISTS settings JSONB NOT NULL DEFAULT '{}';
+ALTER TABLE credential_rules ADD COLUMN IF NOT EXISTS settings JSONB NOT NULL DEFAULT '{}';
@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS satellite_status;
+DROP TABLE IF EXISTS satellite_rollouts;
+DROP TABLE IF EXISTS satellite_configs;
@@ -0,0 +1,40 @@
+-- Configuration the hub pushes to a satellite zone. The values override the
+-- satellite's environment; revision increases with every change.
+CREATE TABLE satellite_configs (
+    zone_id UUID PRIMARY KEY REFERENCES zones(id) ON DELETE CASCADE,
+    revision INTEGER NOT NULL DEFAULT 1,
+    config_values JSONB NOT NULL DEFAULT '{}',
+    updated_by UUID REFERENCES users(id) ON DELETE SET NULL,
+    updated_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+-- Staged rollouts of a signed satellite build. Each stage is a list of zone
+-- IDs; the next stage starts once every satellite in the current one reports
+-- the new version healthy.
+CREATE TABLE satellite_rollouts (
+    id UUID PRIMARY KEY,
+    version VARCHAR(100) NOT NULL,
+    url TEXT NOT NULL,
+    sha256 CHAR(64) NOT NULL,
+    size BIGINT NOT NULL,
+    stages JSONB NOT NULL,
+    current_stage INTEGER NOT NULL DEFAULT 0,
+    status VARCHAR(20) NOT NULL DEFAULT 'active',
+    error TEXT,
+    created_by UUID REFERENCES users(id) ON DELETE SET NULL,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX idx_satellite_rollouts_status ON satellite_rollouts(status, created_at);
+
+-- Last status each satellite reported over the tunnel
+CREATE TABLE satellite_status (
+    zone_id UUID PRIMARY KEY REFERENCES zones(id) ON DELETE CASCADE,
+    version VARCHAR(100) NOT NULL,
+    config_revision INTEGER NOT NULL DEFAULT 0,
+    rollout_id UUID REFERENCES satellite_rollouts(id) ON DELETE SET NULL,
+    update_state VARCHAR(20),
+    update_error TEXT,
+    reported_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
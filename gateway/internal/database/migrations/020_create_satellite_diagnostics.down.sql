@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS satellite_logs;
+DROP TABLE IF EXISTS satellite_metrics;
@@ -0,0 +1,24 @@
+-- Runtime metrics snapshots satellites send over the tunnel
+CREATE TABLE satellite_metrics (
+    id BIGSERIAL PRIMARY KEY,
+    zone_id UUID NOT NULL REFERENCES zones(id) ON DELETE CASCADE,
+    metrics JSONB NOT NULL,
+    collected_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    received_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX idx_satellite_metrics_zone ON satellite_metrics(zone_id, collected_at);
+
+-- Log messages satellites forward over the tunnel, so operators can read them
+-- without reaching the satellite's network
+CREATE TABLE satellite_logs (
+    id BIGSERIAL PRIMARY KEY,
+    zone_id UUID NOT NULL REFERENCES zones(id) ON DELETE CASCADE,
+    logged_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    level VARCHAR(10) NOT NULL,
+    message TEXT NOT NULL,
+    fields JSONB NOT NULL DEFAULT '{}',
+    received_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX idx_satellite_logs_zone ON satellite_logs(zone_id, logged_at);
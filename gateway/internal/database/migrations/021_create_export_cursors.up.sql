@@ -0,0 +1,7 @@
+-- Position of each exporter that ships the event log to an external system,
+-- so an export resumes where it stopped after a restart or failover
+CREATE TABLE export_cursors (
+    name VARCHAR(100) PRIMARY KEY,
+    last_event_id BIGINT NOT NULL DEFAULT 0,
+    updated_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
@@ -0,0 +1,14 @@
+-- Single-use approval links sent to approvers by email or chat. The link holds
+-- a signed token naming the row; used_at makes it single-use.
+CREATE TABLE approval_actions (
+    id UUID PRIMARY KEY,
+    schedule_id UUID NOT NULL REFERENCES schedules(id) ON DELETE CASCADE,
+    approver_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    channel VARCHAR(20) NOT NULL,
+    expires_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    used_at TIMESTAMP WITH TIME ZONE,
+    decision VARCHAR(20),
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX idx_approval_actions_schedule ON approval_actions(schedule_id);
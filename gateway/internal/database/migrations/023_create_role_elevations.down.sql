@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS idx_system_audit_logs_elevation_id;
+ALTER TABLE system_audit_logs DROP COLUMN IF EXISTS elevation_id;
+DROP TABLE IF EXISTS role_elevations;
@@ -0,0 +1,27 @@
+-- Time-boxed role elevations: a user asks for a higher role for a few hours,
+-- and holds it while the row is active and not yet expired.
+CREATE TABLE role_elevations (
+    id UUID PRIMARY KEY,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    role VARCHAR(50) NOT NULL CHECK (role IN ('admin', 'auditor')),
+    justification TEXT NOT NULL,
+    duration_hours INTEGER NOT NULL CHECK (duration_hours > 0),
+    status VARCHAR(20) NOT NULL DEFAULT 'pending' CHECK (status IN ('pending', 'active', 'rejected', 'expired', 'revoked')),
+    decided_by UUID REFERENCES users(id) ON DELETE SET NULL,
+    decided_at TIMESTAMP WITH TIME ZONE,
+    rejection_reason TEXT,
+    starts_at TIMESTAMP WITH TIME ZONE,
+    expires_at TIMESTAMP WITH TIME ZONE, -- Set once approved
+    ended_by UUID REFERENCES users(id) ON DELETE SET NULL, -- Who revoked it; NULL when it expired
+    ended_at TIMESTAMP WITH TIME ZONE,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+-- A user has at most one open elevation
+CREATE UNIQUE INDEX idx_role_elevations_open ON role_elevations(user_id) WHERE status IN ('pending', 'active');
+CREATE INDEX idx_role_elevations_expires_at ON role_elevations(expires_at) WHERE status = 'active';
+CREATE INDEX idx_role_elevations_created_at ON role_elevations(created_at DESC);
+
+-- System audit events recorded while their actor held an elevated role
+ALTER TABLE system_audit_logs ADD COLUMN elevation_id UUID REFERENCES role_elevations(id) ON DELETE SET NULL;
+CREATE INDEX idx_system_audit_logs_elevation_id ON system_audit_logs(elevation_id) WHERE elevation_id IS NOT NULL;
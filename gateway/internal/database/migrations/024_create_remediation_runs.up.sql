@@ -0,0 +1,24 @@
+-- AWX/Ansible Tower job templates launched after a session ends or violates a
+-- policy, tracked against the session. One run per event of the event log, so
+-- replaying the log doesn't launch a playbook twice.
+CREATE TABLE remediation_runs (
+    id UUID PRIMARY KEY,
+    audit_log_id UUID NOT NULL REFERENCES audit_logs(id) ON DELETE CASCADE,
+    event_id BIGINT NOT NULL UNIQUE,
+    trigger_type VARCHAR(50) NOT NULL CHECK (trigger_type IN ('session_end', 'policy_violation')),
+    template_id INTEGER NOT NULL,
+    extra_vars JSONB NOT NULL DEFAULT '{}',
+    status VARCHAR(20) NOT NULL DEFAULT 'queued' CHECK (status IN ('queued', 'running', 'successful', 'failed', 'canceled')),
+    awx_job_id BIGINT,
+    job_url TEXT,
+    attempts INTEGER NOT NULL DEFAULT 0, -- Launch attempts
+    next_attempt_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    error TEXT,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    finished_at TIMESTAMP WITH TIME ZONE
+);
+
+CREATE INDEX idx_remediation_runs_audit_log_id ON remediation_runs(audit_log_id);
+CREATE INDEX idx_remediation_runs_queued ON remediation_runs(next_attempt_at) WHERE status = 'queued';
+CREATE INDEX idx_remediation_runs_running ON remediation_runs(updated_at) WHERE status = 'running';
@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS discovered_accounts;
+DROP TABLE IF EXISTS discovery_scans;
@@ -0,0 +1,45 @@
+-- Account discovery: scans that enumerate the local accounts of a target over
+-- SSH or WinRM, and the inventory of the accounts they found
+CREATE TABLE discovery_scans (
+    id UUID PRIMARY KEY,
+    target_id UUID NOT NULL REFERENCES targets(id) ON DELETE CASCADE,
+    credential_id UUID REFERENCES credentials(id) ON DELETE SET NULL, -- The account the scan logged in with
+    status VARCHAR(20) NOT NULL DEFAULT 'running' CHECK (status IN ('running', 'succeeded', 'failed')),
+    started_by UUID REFERENCES users(id) ON DELETE SET NULL, -- NULL for scheduled scans
+    accounts_found INTEGER NOT NULL DEFAULT 0,
+    unmanaged_privileged INTEGER NOT NULL DEFAULT 0,
+    warnings TEXT[] NOT NULL DEFAULT '{}',
+    error TEXT,
+    started_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    finished_at TIMESTAMP WITH TIME ZONE
+);
+
+-- A target is scanned by one replica at a time
+CREATE UNIQUE INDEX idx_discovery_scans_running ON discovery_scans(target_id) WHERE status = 'running';
+CREATE INDEX idx_discovery_scans_target_started ON discovery_scans(target_id, started_at DESC);
+
+CREATE TABLE discovered_accounts (
+    id UUID PRIMARY KEY,
+    target_id UUID NOT NULL REFERENCES targets(id) ON DELETE CASCADE,
+    username VARCHAR(255) NOT NULL,
+    uid VARCHAR(255) NOT NULL DEFAULT '', -- Numeric UID on Linux, SID on Windows
+    home TEXT NOT NULL DEFAULT '',
+    shell TEXT NOT NULL DEFAULT '',
+    groups TEXT[] NOT NULL DEFAULT '{}',
+    privileged BOOLEAN NOT NULL DEFAULT false,
+    privilege_reasons TEXT[] NOT NULL DEFAULT '{}',
+    sudo_rules TEXT[] NOT NULL DEFAULT '{}',
+    authorized_keys JSONB NOT NULL DEFAULT '[]',
+    login_enabled BOOLEAN NOT NULL DEFAULT true,
+    system_account BOOLEAN NOT NULL DEFAULT false, -- Service account of the OS that cannot log in
+    last_logon TIMESTAMP WITH TIME ZONE,
+    credential_id UUID REFERENCES credentials(id) ON DELETE SET NULL, -- Set while the account is managed
+    rotated_at TIMESTAMP WITH TIME ZONE, -- Last password change by OpenPAM, for onboarded accounts
+    last_scan_id UUID REFERENCES discovery_scans(id) ON DELETE SET NULL,
+    first_seen_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    last_seen_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    removed_at TIMESTAMP WITH TIME ZONE, -- Set when a later scan no longer found the account
+    UNIQUE (target_id, username)
+);
+
+CREATE INDEX idx_discovered_accounts_unmanaged ON discovered_accounts(target_id) WHERE privileged AND credential_id IS NULL AND removed_at IS NULL;
@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS ssh_key_drift;
+DROP TABLE IF EXISTS ssh_keys;
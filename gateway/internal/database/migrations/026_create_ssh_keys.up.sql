@@ -0,0 +1,38 @@
+-- SSH key management: the public keys OpenPAM deployed to, or approved on, the
+-- authorized_keys files of target accounts, and the drift scans found from them
+CREATE TABLE ssh_keys (
+    id UUID PRIMARY KEY,
+    target_id UUID NOT NULL REFERENCES targets(id) ON DELETE CASCADE,
+    username VARCHAR(255) NOT NULL,
+    key_type VARCHAR(50) NOT NULL,
+    fingerprint VARCHAR(100) NOT NULL,
+    public_key TEXT NOT NULL, -- The authorized_keys line, without options
+    source VARCHAR(20) NOT NULL CHECK (source IN ('managed', 'approved')), -- Generated by OpenPAM, or found on the target and approved
+    credential_id UUID REFERENCES credentials(id) ON DELETE SET NULL, -- Holds the private key of managed keys
+    status VARCHAR(20) NOT NULL DEFAULT 'active' CHECK (status IN ('active', 'removed')),
+    created_by UUID REFERENCES users(id) ON DELETE SET NULL,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    removed_at TIMESTAMP WITH TIME ZONE
+);
+
+CREATE UNIQUE INDEX idx_ssh_keys_active ON ssh_keys(target_id, username, fingerprint) WHERE status = 'active';
+
+CREATE TABLE ssh_key_drift (
+    id UUID PRIMARY KEY,
+    target_id UUID NOT NULL REFERENCES targets(id) ON DELETE CASCADE,
+    username VARCHAR(255) NOT NULL,
+    kind VARCHAR(20) NOT NULL CHECK (kind IN ('unauthorized', 'missing')),
+    key_type VARCHAR(50) NOT NULL,
+    fingerprint VARCHAR(100) NOT NULL,
+    public_key TEXT NOT NULL, -- Type and base64 key
+    comment TEXT NOT NULL DEFAULT '',
+    ssh_key_id UUID REFERENCES ssh_keys(id) ON DELETE CASCADE, -- The missing key
+    scan_id UUID REFERENCES discovery_scans(id) ON DELETE SET NULL, -- The scan that found it
+    detected_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    resolved_at TIMESTAMP WITH TIME ZONE,
+    resolution VARCHAR(20) CHECK (resolution IN ('approved', 'removed', 'redeployed', 'cleared')),
+    resolved_by UUID REFERENCES users(id) ON DELETE SET NULL -- NULL when a later scan cleared it
+);
+
+-- One open drift per key and kind; a scan that sees it again leaves it open
+CREATE UNIQUE INDEX idx_ssh_key_drift_open ON ssh_key_drift(target_id, username, fingerprint, kind) WHERE resolved_at IS NULL;
@@ -0,0 +1,19 @@
+-- LAPS-style management of the built-in Administrator password of Windows
+-- targets: one row per enrolled machine, with its rotation schedule
+CREATE TABLE laps_machines (
+    target_id UUID PRIMARY KEY REFERENCES targets(id) ON DELETE CASCADE,
+    account_name VARCHAR(255) NOT NULL DEFAULT '', -- The RID 500 account, which may have been renamed
+    credential_id UUID REFERENCES credentials(id) ON DELETE SET NULL,
+    vault_path TEXT NOT NULL,
+    enabled BOOLEAN NOT NULL DEFAULT true,
+    last_rotated_at TIMESTAMP WITH TIME ZONE,
+    next_rotation_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    last_attempt_at TIMESTAMP WITH TIME ZONE,
+    last_error TEXT,
+    failures INTEGER NOT NULL DEFAULT 0, -- Consecutive failed rotations
+    last_retrieved_at TIMESTAMP WITH TIME ZONE,
+    enrolled_by UUID REFERENCES users(id) ON DELETE SET NULL,
+    enrolled_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX idx_laps_machines_next_rotation ON laps_machines(next_rotation_at) WHERE enabled = true;
@@ -0,0 +1,6 @@
+DROP TABLE IF EXISTS cloud_sessions;
+
+DELETE FROM targets WHERE protocol IN ('aws', 'azure');
+ALTER TABLE targets DROP CONSTRAINT IF EXISTS targets_protocol_check;
+ALTER TABLE targets ADD CONSTRAINT targets_protocol_check
+    CHECK (protocol IN ('ssh', 'rdp'));
@@ -0,0 +1,25 @@
+-- Cloud console targets: sessions to them are short-lived AWS STS credentials
+-- or Azure PIM role activations brokered by the gateway
+ALTER TABLE targets DROP CONSTRAINT IF EXISTS targets_protocol_check;
+ALTER TABLE targets ADD CONSTRAINT targets_protocol_check
+    CHECK (protocol IN ('ssh', 'rdp', 'aws', 'azure'));
+
+CREATE TABLE cloud_sessions (
+    id UUID PRIMARY KEY,
+    target_id UUID REFERENCES targets(id) ON DELETE SET NULL,
+    credential_id UUID REFERENCES credentials(id) ON DELETE SET NULL,
+    user_id UUID REFERENCES users(id) ON DELETE SET NULL,
+    provider VARCHAR(20) NOT NULL CHECK (provider IN ('aws', 'azure')),
+    role TEXT NOT NULL,                -- Role ARN or Azure role definition (and scope)
+    session_name VARCHAR(64) NOT NULL, -- STS role session name, derived from the user
+    external_id TEXT,                  -- Assumed role ID or PIM request ID
+    justification TEXT,
+    status VARCHAR(20) NOT NULL CHECK (status IN ('granted', 'failed')),
+    error TEXT,
+    client_ip VARCHAR(45),
+    started_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    expires_at TIMESTAMP WITH TIME ZONE
+);
+
+CREATE INDEX idx_cloud_sessions_target ON cloud_sessions(target_id, started_at DESC);
+CREATE INDEX idx_cloud_sessions_user ON cloud_sessions(user_id, started_at DESC);
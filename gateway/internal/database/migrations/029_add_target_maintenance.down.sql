@@ -0,0 +1,6 @@
+DROP INDEX IF EXISTS idx_targets_maintenance;
+ALTER TABLE targets DROP CONSTRAINT IF EXISTS targets_maintenance_window;
+ALTER TABLE targets DROP COLUMN IF EXISTS maintenance_by;
+ALTER TABLE targets DROP COLUMN IF EXISTS maintenance_reason;
+ALTER TABLE targets DROP COLUMN IF EXISTS maintenance_end;
+ALTER TABLE targets DROP COLUMN IF EXISTS maintenance_start;
@@ -0,0 +1,11 @@
+-- Maintenance windows on targets: while one is in effect new sessions are
+-- refused (admins can override) and alerts about the target are held back.
+-- A window without an end lasts until it is cleared.
+ALTER TABLE targets ADD COLUMN IF NOT EXISTS maintenance_start TIMESTAMP WITH TIME ZONE;
+ALTER TABLE targets ADD COLUMN IF NOT EXISTS maintenance_end TIMESTAMP WITH TIME ZONE;
+ALTER TABLE targets ADD COLUMN IF NOT EXISTS maintenance_reason TEXT;
+ALTER TABLE targets ADD COLUMN IF NOT EXISTS maintenance_by UUID REFERENCES users(id) ON DELETE SET NULL;
+ALTER TABLE targets ADD CONSTRAINT targets_maintenance_window
+    CHECK (maintenance_end IS NULL OR (maintenance_start IS NOT NULL AND maintenance_end > maintenance_start));
+
+CREATE INDEX idx_targets_maintenance ON targets(maintenance_start) WHERE maintenance_start IS NOT NULL;
@@ -0,0 +1,18 @@
+ALTER TABLE satellite_rollouts DROP COLUMN IF EXISTS updated_by;
+ALTER TABLE investigations DROP COLUMN IF EXISTS updated_by;
+ALTER TABLE tasks DROP COLUMN IF EXISTS updated_by;
+ALTER TABLE scheduled_reports DROP COLUMN IF EXISTS updated_by;
+ALTER TABLE schedules DROP COLUMN IF EXISTS updated_by;
+
+ALTER TABLE session_annotations DROP COLUMN IF EXISTS updated_by;
+ALTER TABLE session_annotations DROP COLUMN IF EXISTS created_by;
+ALTER TABLE credential_rules DROP COLUMN IF EXISTS updated_by;
+ALTER TABLE credential_rules DROP COLUMN IF EXISTS created_by;
+ALTER TABLE users DROP COLUMN IF EXISTS updated_by;
+ALTER TABLE users DROP COLUMN IF EXISTS created_by;
+ALTER TABLE credentials DROP COLUMN IF EXISTS updated_by;
+ALTER TABLE credentials DROP COLUMN IF EXISTS created_by;
+ALTER TABLE targets DROP COLUMN IF EXISTS updated_by;
+ALTER TABLE targets DROP COLUMN IF EXISTS created_by;
+ALTER TABLE zones DROP COLUMN IF EXISTS updated_by;
+ALTER TABLE zones DROP COLUMN IF EXISTS created_by;
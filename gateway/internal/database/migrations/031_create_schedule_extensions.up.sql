@@ -0,0 +1,22 @@
+-- Requests to extend a running schedule's window. Approved rows move the
+-- schedule's end from previous_end_time to new_end_time, so a schedule's
+-- approved extensions, oldest first, are its extension chain.
+CREATE TABLE schedule_extensions (
+    id UUID PRIMARY KEY,
+    schedule_id UUID NOT NULL REFERENCES schedules(id) ON DELETE CASCADE,
+    requested_by UUID REFERENCES users(id) ON DELETE SET NULL,
+    minutes INTEGER NOT NULL CHECK (minutes > 0),
+    reason TEXT,
+    status VARCHAR(20) NOT NULL DEFAULT 'pending' CHECK (status IN ('pending', 'approved', 'rejected')),
+    auto_approved BOOLEAN NOT NULL DEFAULT false,
+    decided_by UUID REFERENCES users(id) ON DELETE SET NULL, -- NULL when approved by policy
+    decided_at TIMESTAMP WITH TIME ZONE,
+    rejection_reason TEXT,
+    previous_end_time TIMESTAMP WITH TIME ZONE, -- Set once approved
+    new_end_time TIMESTAMP WITH TIME ZONE,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+-- A schedule has at most one extension waiting for a decision
+CREATE UNIQUE INDEX idx_schedule_extensions_pending ON schedule_extensions(schedule_id) WHERE status = 'pending';
+CREATE INDEX idx_schedule_extensions_schedule_id ON schedule_extensions(schedule_id, created_at);
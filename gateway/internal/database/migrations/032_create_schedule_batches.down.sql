@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS idx_schedules_batch_id;
+ALTER TABLE schedules DROP COLUMN IF EXISTS batch_id;
+DROP TABLE IF EXISTS schedule_batches;
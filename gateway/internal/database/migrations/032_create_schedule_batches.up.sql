@@ -0,0 +1,12 @@
+-- Schedules created together in one bulk request, linked so the whole batch
+-- can be approved or revoked at once
+CREATE TABLE schedule_batches (
+    id UUID PRIMARY KEY,
+    name VARCHAR(255),
+    created_by UUID REFERENCES users(id) ON DELETE SET NULL,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+ALTER TABLE schedules ADD COLUMN batch_id UUID REFERENCES schedule_batches(id) ON DELETE SET NULL;
+
+CREATE INDEX idx_schedules_batch_id ON schedules(batch_id) WHERE batch_id IS NOT NULL;
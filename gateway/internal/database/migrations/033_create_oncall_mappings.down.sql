@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS idx_schedules_oncall_mapping;
+DROP TABLE IF EXISTS oncall_mappings;
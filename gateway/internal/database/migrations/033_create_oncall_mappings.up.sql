@@ -0,0 +1,27 @@
+-- External on-call schedules (PagerDuty, Opsgenie) whose engineers get access
+-- to a zone's targets while on call
+CREATE TABLE oncall_mappings (
+    id UUID PRIMARY KEY,
+    name VARCHAR(255) NOT NULL,
+    provider VARCHAR(50) NOT NULL CHECK (provider IN ('pagerduty', 'opsgenie')),
+    external_schedule_id VARCHAR(255) NOT NULL,
+    zone_id UUID NOT NULL REFERENCES zones(id) ON DELETE CASCADE,
+    enabled BOOLEAN NOT NULL DEFAULT true,
+    next_sync_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    last_synced_at TIMESTAMP WITH TIME ZONE,
+    last_sync_status VARCHAR(20),
+    last_sync_error TEXT,
+    last_sync_result JSONB,
+    created_by UUID REFERENCES users(id) ON DELETE SET NULL,
+    updated_by UUID REFERENCES users(id) ON DELETE SET NULL,
+    version INTEGER NOT NULL DEFAULT 1,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    UNIQUE (provider, external_schedule_id, zone_id)
+);
+
+CREATE INDEX idx_oncall_mappings_next_sync_at ON oncall_mappings(next_sync_at) WHERE enabled;
+
+-- Schedules maintained by an on-call mapping are found by its ID in their metadata
+CREATE INDEX idx_schedules_oncall_mapping ON schedules((metadata->>'oncall_mapping_id'))
+    WHERE metadata ? 'oncall_mapping_id';
@@ -0,0 +1,2 @@
+-- Connection parameters of RDP targets, such as Kerberos single sign-on
+ALTER TABLE targets ADD COLUMN IF NOT EXISTS rdp_settings JSONB NOT NULL DEFAULT '{}';
@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS idx_credentials_certificate_expires_at;
+ALTER TABLE credentials DROP COLUMN IF EXISTS certificate_alerted_at;
+ALTER TABLE credentials DROP COLUMN IF EXISTS certificate_expires_at;
+ALTER TABLE credentials DROP COLUMN IF EXISTS certificate_subject;
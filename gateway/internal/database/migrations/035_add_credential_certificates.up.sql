@@ -0,0 +1,9 @@
+-- Client certificates for smart card RDP logon. The certificate and its key are
+-- kept in Vault with the credential's secret; only what expiry tracking needs is
+-- stored here.
+ALTER TABLE credentials ADD COLUMN IF NOT EXISTS certificate_subject TEXT;
+ALTER TABLE credentials ADD COLUMN IF NOT EXISTS certificate_expires_at TIMESTAMP WITH TIME ZONE;
+ALTER TABLE credentials ADD COLUMN IF NOT EXISTS certificate_alerted_at TIMESTAMP WITH TIME ZONE;
+
+CREATE INDEX IF NOT EXISTS idx_credentials_certificate_expires_at ON credentials(certificate_expires_at)
+    WHERE certificate_expires_at IS NOT NULL;
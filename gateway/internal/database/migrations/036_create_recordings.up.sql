@@ -0,0 +1,18 @@
+-- Catalog of session recordings, so they can be found and searched without
+-- scanning the recordings directory. Filled in when a recorder finishes and,
+-- for recordings made before the catalog, by the backfill-recordings command.
+CREATE TABLE recordings (
+    id UUID PRIMARY KEY,
+    session_id UUID NOT NULL,
+    location TEXT NOT NULL UNIQUE,
+    format VARCHAR(20) NOT NULL CHECK (format IN ('ssh', 'guacamole')),
+    size BIGINT NOT NULL,
+    duration_ms BIGINT NOT NULL DEFAULT 0,
+    sha256 VARCHAR(64) NOT NULL,
+    encrypted BOOLEAN NOT NULL DEFAULT false,
+    started_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX idx_recordings_session_id ON recordings(session_id);
+CREATE INDEX idx_recordings_started_at ON recordings(started_at);
@@ -0,0 +1,2 @@
+-- Facts about a session beyond its status, such as the RDP quality it ran at
+ALTER TABLE audit_logs ADD COLUMN IF NOT EXISTS metadata JSONB NOT NULL DEFAULT '{}';
@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS idx_audit_logs_purpose;
+ALTER TABLE audit_logs DROP COLUMN IF EXISTS reason;
+ALTER TABLE audit_logs DROP COLUMN IF EXISTS purpose;
@@ -0,0 +1,6 @@
+-- The purpose a user gave a session when connecting, and why
+ALTER TABLE audit_logs ADD COLUMN IF NOT EXISTS purpose VARCHAR(50)
+    CHECK (purpose IN ('change', 'incident', 'maintenance', 'other'));
+ALTER TABLE audit_logs ADD COLUMN IF NOT EXISTS reason TEXT;
+
+CREATE INDEX IF NOT EXISTS idx_audit_logs_purpose ON audit_logs(purpose);
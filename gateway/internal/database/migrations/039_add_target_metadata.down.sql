@@ -0,0 +1,13 @@
+ALTER TABLE targets ADD COLUMN IF NOT EXISTS description TEXT;
+UPDATE targets SET description = connection_notes WHERE connection_notes <> '';
+
+DROP INDEX IF EXISTS idx_targets_labels;
+DROP INDEX IF EXISTS idx_targets_compliance_scope;
+DROP INDEX IF EXISTS idx_targets_environment;
+DROP INDEX IF EXISTS idx_targets_owner_team;
+
+ALTER TABLE targets DROP COLUMN IF EXISTS connection_notes;
+ALTER TABLE targets DROP COLUMN IF EXISTS labels;
+ALTER TABLE targets DROP COLUMN IF EXISTS compliance_scope;
+ALTER TABLE targets DROP COLUMN IF EXISTS environment;
+ALTER TABLE targets DROP COLUMN IF EXISTS owner_team;
@@ -0,0 +1,18 @@
+-- Who owns a target, where it runs, the compliance regimes it falls under,
+-- custom labels, and markdown notes shown to users before they connect. The
+-- notes take over the free-text description.
+ALTER TABLE targets ADD COLUMN IF NOT EXISTS owner_team VARCHAR(100) NOT NULL DEFAULT '';
+ALTER TABLE targets ADD COLUMN IF NOT EXISTS environment VARCHAR(63) NOT NULL DEFAULT '';
+ALTER TABLE targets ADD COLUMN IF NOT EXISTS compliance_scope TEXT[] NOT NULL DEFAULT '{}';
+ALTER TABLE targets ADD COLUMN IF NOT EXISTS labels JSONB NOT NULL DEFAULT '{}';
+ALTER TABLE targets ADD COLUMN IF NOT EXISTS connection_notes TEXT NOT NULL DEFAULT '';
+
+UPDATE targets SET connection_notes = description
+WHERE connection_notes = '' AND description IS NOT NULL;
+
+ALTER TABLE targets DROP COLUMN IF EXISTS description;
+
+CREATE INDEX IF NOT EXISTS idx_targets_owner_team ON targets(owner_team);
+CREATE INDEX IF NOT EXISTS idx_targets_environment ON targets(environment);
+CREATE INDEX IF NOT EXISTS idx_targets_compliance_scope ON targets USING GIN (compliance_scope);
+CREATE INDEX IF NOT EXISTS idx_targets_labels ON targets USING GIN (labels);
@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS idx_audit_logs_user_start_time;
+DROP TABLE IF EXISTS target_favorites;
@@ -0,0 +1,12 @@
+-- Targets a user has starred for their launcher
+CREATE TABLE target_favorites (
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    target_id UUID NOT NULL REFERENCES targets(id) ON DELETE CASCADE,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (user_id, target_id)
+);
+
+CREATE INDEX idx_target_favorites_user_created ON target_favorites(user_id, created_at DESC);
+
+-- Recently used targets are read from a user's latest sessions
+CREATE INDEX idx_audit_logs_user_start_time ON audit_logs(user_id, start_time DESC) INCLUDE (target_id);
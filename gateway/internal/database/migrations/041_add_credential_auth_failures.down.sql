@@ -0,0 +1,6 @@
+DROP INDEX IF EXISTS idx_credentials_quarantined_at;
+ALTER TABLE credentials
+    DROP COLUMN IF EXISTS auth_failures,
+    DROP COLUMN IF EXISTS last_auth_failure_at,
+    DROP COLUMN IF EXISTS last_auth_failure,
+    DROP COLUMN IF EXISTS quarantined_at;
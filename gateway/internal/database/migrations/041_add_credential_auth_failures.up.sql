@@ -0,0 +1,9 @@
+-- Streaks of failed logons to targets with a credential, and its quarantine
+-- once they pass the threshold
+ALTER TABLE credentials
+    ADD COLUMN auth_failures INTEGER NOT NULL DEFAULT 0,
+    ADD COLUMN last_auth_failure_at TIMESTAMP WITH TIME ZONE,
+    ADD COLUMN last_auth_failure TEXT,
+    ADD COLUMN quarantined_at TIMESTAMP WITH TIME ZONE;
+
+CREATE INDEX idx_credentials_quarantined_at ON credentials(quarantined_at) WHERE quarantined_at IS NOT NULL;
@@ -0,0 +1,9 @@
+DROP INDEX IF EXISTS idx_schedules_live;
+CREATE INDEX IF NOT EXISTS idx_schedules_user_id ON schedules(user_id);
+DROP INDEX IF EXISTS idx_schedules_user_target_window;
+DROP INDEX IF EXISTS idx_audit_logs_active;
+CREATE INDEX IF NOT EXISTS idx_audit_logs_status ON audit_logs(session_status);
+DROP INDEX IF EXISTS idx_audit_logs_status_start_time;
+CREATE INDEX IF NOT EXISTS idx_audit_logs_target_id ON audit_logs(target_id);
+DROP INDEX IF EXISTS idx_audit_logs_target_start_time;
+CREATE INDEX IF NOT EXISTS idx_audit_logs_user_id ON audit_logs(user_id);
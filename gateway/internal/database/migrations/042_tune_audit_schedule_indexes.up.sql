@@ -0,0 +1,28 @@
+-- Composite indexes for the audit and schedule hot paths. Session listings
+-- filter by user, target or status and sort by start_time; schedule window
+-- checks filter by user, target, status and time. Single-column indexes that
+-- are a prefix of a new composite are dropped, since the composite serves
+-- their queries too and every index slows inserts into audit_logs.
+
+-- audit_logs(user_id, start_time DESC) already exists as
+-- idx_audit_logs_user_start_time (040)
+DROP INDEX IF EXISTS idx_audit_logs_user_id;
+
+CREATE INDEX idx_audit_logs_target_start_time ON audit_logs(target_id, start_time DESC);
+DROP INDEX IF EXISTS idx_audit_logs_target_id;
+
+CREATE INDEX idx_audit_logs_status_start_time ON audit_logs(session_status, start_time DESC);
+DROP INDEX IF EXISTS idx_audit_logs_status;
+
+-- Active sessions are a handful among millions of finished ones
+CREATE INDEX idx_audit_logs_active ON audit_logs(start_time DESC) WHERE session_status = 'active';
+
+CREATE INDEX idx_schedules_user_target_window ON schedules(user_id, target_id, status, start_time, end_time);
+DROP INDEX IF EXISTS idx_schedules_user_id;
+
+-- Approved schedules still to start or running, polled by the status sweeper
+CREATE INDEX idx_schedules_live ON schedules(start_time)
+    WHERE approval_status = 'approved' AND status IN ('pending', 'active');
+
+ANALYZE audit_logs;
+ANALYZE schedules;
@@ -0,0 +1,45 @@
+ALTER TABLE audit_logs RENAME TO audit_logs_partitioned;
+CREATE TABLE audit_logs (LIKE audit_logs_partitioned INCLUDING DEFAULTS INCLUDING CONSTRAINTS);
+INSERT INTO audit_logs SELECT * FROM audit_logs_partitioned;
+DROP TABLE audit_logs_partitioned;
+
+ALTER TABLE audit_logs ADD PRIMARY KEY (id);
+ALTER TABLE audit_logs ADD FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE RESTRICT;
+ALTER TABLE audit_logs ADD FOREIGN KEY (target_id) REFERENCES targets(id) ON DELETE RESTRICT;
+ALTER TABLE audit_logs ADD FOREIGN KEY (credential_id) REFERENCES credentials(id) ON DELETE SET NULL;
+CREATE INDEX idx_audit_logs_start_time ON audit_logs(start_time DESC);
+CREATE INDEX idx_audit_logs_purpose ON audit_logs(purpose);
+CREATE INDEX idx_audit_logs_user_start_time ON audit_logs(user_id, start_time DESC) INCLUDE (target_id);
+CREATE INDEX idx_audit_logs_target_start_time ON audit_logs(target_id, start_time DESC);
+CREATE INDEX idx_audit_logs_status_start_time ON audit_logs(session_status, start_time DESC);
+CREATE INDEX idx_audit_logs_active ON audit_logs(start_time DESC) WHERE session_status = 'active';
+
+ALTER TABLE system_audit_logs RENAME TO system_audit_logs_partitioned;
+CREATE TABLE system_audit_logs (LIKE system_audit_logs_partitioned INCLUDING DEFAULTS INCLUDING CONSTRAINTS);
+INSERT INTO system_audit_logs SELECT * FROM system_audit_logs_partitioned;
+DROP TABLE system_audit_logs_partitioned;
+
+ALTER TABLE system_audit_logs ADD PRIMARY KEY (id);
+ALTER TABLE system_audit_logs ADD FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE SET NULL;
+ALTER TABLE system_audit_logs ADD FOREIGN KEY (target_user_id) REFERENCES users(id) ON DELETE SET NULL;
+ALTER TABLE system_audit_logs ADD FOREIGN KEY (elevation_id) REFERENCES role_elevations(id) ON DELETE SET NULL;
+CREATE INDEX idx_system_audit_logs_timestamp ON system_audit_logs(timestamp DESC);
+CREATE INDEX idx_system_audit_logs_event_type ON system_audit_logs(event_type);
+CREATE INDEX idx_system_audit_logs_user_id ON system_audit_logs(user_id);
+CREATE INDEX idx_system_audit_logs_target_user_id ON system_audit_logs(target_user_id);
+CREATE INDEX idx_system_audit_logs_resource_type ON system_audit_logs(resource_type);
+CREATE INDEX idx_system_audit_logs_resource_id ON system_audit_logs(resource_id);
+CREATE INDEX idx_system_audit_logs_status ON system_audit_logs(status);
+CREATE INDEX idx_system_audit_logs_elevation_id ON system_audit_logs(elevation_id) WHERE elevation_id IS NOT NULL;
+
+DROP FUNCTION IF EXISTS drop_audit_partition(TEXT, DATE);
+DROP FUNCTION IF EXISTS create_audit_partition(TEXT, DATE);
+DROP FUNCTION IF EXISTS delete_audit_dependents();
+DROP FUNCTION IF EXISTS audit_dependents(TEXT);
+
+ALTER TABLE session_annotations ADD FOREIGN KEY (audit_log_id) REFERENCES audit_logs(id) ON DELETE CASCADE NOT VALID;
+ALTER TABLE investigation_items ADD FOREIGN KEY (audit_log_id) REFERENCES audit_logs(id) ON DELETE CASCADE NOT VALID;
+ALTER TABLE investigation_items ADD FOREIGN KEY (system_audit_log_id) REFERENCES system_audit_logs(id) ON DELETE CASCADE NOT VALID;
+ALTER TABLE violation_evidence ADD FOREIGN KEY (audit_log_id) REFERENCES audit_logs(id) ON DELETE CASCADE NOT VALID;
+ALTER TABLE violation_evidence ADD FOREIGN KEY (system_audit_log_id) REFERENCES system_audit_logs(id) ON DELETE CASCADE NOT VALID;
+ALTER TABLE remediation_runs ADD FOREIGN KEY (audit_log_id) REFERENCES audit_logs(id) ON DELETE CASCADE NOT VALID;
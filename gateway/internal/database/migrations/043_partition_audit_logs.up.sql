@@ -0,0 +1,143 @@
+-- Session and system audit logs are partitioned by month, so retention drops
+-- whole months instead of deleting rows. A partitioned table's primary key has
+-- to include its partition key, and no foreign key can reference it, so the
+-- cascading deletes of what refers to audit rows are done by triggers, and by
+-- drop_audit_partition for whole months.
+
+ALTER TABLE session_annotations DROP CONSTRAINT IF EXISTS session_annotations_audit_log_id_fkey;
+ALTER TABLE investigation_items DROP CONSTRAINT IF EXISTS investigation_items_audit_log_id_fkey;
+ALTER TABLE investigation_items DROP CONSTRAINT IF EXISTS investigation_items_system_audit_log_id_fkey;
+ALTER TABLE violation_evidence DROP CONSTRAINT IF EXISTS violation_evidence_audit_log_id_fkey;
+ALTER TABLE violation_evidence DROP CONSTRAINT IF EXISTS violation_evidence_system_audit_log_id_fkey;
+ALTER TABLE remediation_runs DROP CONSTRAINT IF EXISTS remediation_runs_audit_log_id_fkey;
+
+-- The tables and columns referring to the rows of each audit table
+CREATE FUNCTION audit_dependents(parent TEXT)
+RETURNS TABLE (dependent TEXT, ref_column TEXT) AS $$
+    SELECT * FROM (VALUES
+        ('audit_logs', 'session_annotations', 'audit_log_id'),
+        ('audit_logs', 'investigation_items', 'audit_log_id'),
+        ('audit_logs', 'violation_evidence', 'audit_log_id'),
+        ('audit_logs', 'remediation_runs', 'audit_log_id'),
+        ('system_audit_logs', 'investigation_items', 'system_audit_log_id'),
+        ('system_audit_logs', 'violation_evidence', 'system_audit_log_id')
+    ) AS d (parent, dependent, ref_column)
+    WHERE d.parent = audit_dependents.parent;
+$$ LANGUAGE sql IMMUTABLE;
+
+CREATE FUNCTION delete_audit_dependents() RETURNS trigger AS $$
+DECLARE
+    d RECORD;
+BEGIN
+    FOR d IN SELECT * FROM audit_dependents(TG_ARGV[0]) LOOP
+        EXECUTE format('DELETE FROM %I WHERE %I = $1', d.dependent, d.ref_column) USING OLD.id;
+    END LOOP;
+    RETURN OLD;
+END;
+$$ LANGUAGE plpgsql;
+
+-- Partitions are named <table>_yYYYYmMM and hold a calendar month in UTC.
+-- Reports whether the partition was created.
+CREATE FUNCTION create_audit_partition(parent TEXT, month DATE) RETURNS BOOLEAN AS $$
+DECLARE
+    part TEXT := parent || '_' || to_char(month, '"y"YYYY"m"MM');
+BEGIN
+    IF to_regclass(part) IS NOT NULL THEN
+        RETURN FALSE;
+    END IF;
+    EXECUTE format('CREATE TABLE %I PARTITION OF %I FOR VALUES FROM (%L) TO (%L)',
+        part, parent,
+        date_trunc('month', month::timestamp) AT TIME ZONE 'UTC',
+        (date_trunc('month', month::timestamp) + INTERVAL '1 month') AT TIME ZONE 'UTC');
+    RETURN TRUE;
+END;
+$$ LANGUAGE plpgsql;
+
+-- Drops a month with the rows referring to it. Reports whether it existed.
+CREATE FUNCTION drop_audit_partition(parent TEXT, month DATE) RETURNS BOOLEAN AS $$
+DECLARE
+    part TEXT := parent || '_' || to_char(month, '"y"YYYY"m"MM');
+    d RECORD;
+BEGIN
+    IF to_regclass(part) IS NULL THEN
+        RETURN FALSE;
+    END IF;
+    FOR d IN SELECT * FROM audit_dependents(parent) LOOP
+        EXECUTE format('DELETE FROM %I WHERE %I IN (SELECT id FROM %I)', d.dependent, d.ref_column, part);
+    END LOOP;
+    EXECUTE format('ALTER TABLE %I DETACH PARTITION %I', parent, part);
+    EXECUTE format('DROP TABLE %I', part);
+    RETURN TRUE;
+END;
+$$ LANGUAGE plpgsql;
+
+-- Session audit logs, partitioned by start_time
+ALTER TABLE audit_logs RENAME TO audit_logs_unpartitioned;
+ALTER INDEX audit_logs_pkey RENAME TO audit_logs_unpartitioned_pkey;
+
+CREATE TABLE audit_logs (LIKE audit_logs_unpartitioned INCLUDING DEFAULTS INCLUDING CONSTRAINTS)
+    PARTITION BY RANGE (start_time);
+-- Catches rows outside every month, such as sessions a satellite recorded
+-- before the oldest partition
+CREATE TABLE audit_logs_default PARTITION OF audit_logs DEFAULT;
+
+SELECT create_audit_partition('audit_logs', month::date)
+FROM generate_series(
+    date_trunc('month', COALESCE((SELECT MIN(start_time) FROM audit_logs_unpartitioned), NOW()) AT TIME ZONE 'UTC'),
+    date_trunc('month', NOW() AT TIME ZONE 'UTC') + INTERVAL '3 months',
+    INTERVAL '1 month') AS month;
+
+INSERT INTO audit_logs SELECT * FROM audit_logs_unpartitioned;
+DROP TABLE audit_logs_unpartitioned;
+
+ALTER TABLE audit_logs ADD PRIMARY KEY (id, start_time);
+ALTER TABLE audit_logs ADD FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE RESTRICT;
+ALTER TABLE audit_logs ADD FOREIGN KEY (target_id) REFERENCES targets(id) ON DELETE RESTRICT;
+ALTER TABLE audit_logs ADD FOREIGN KEY (credential_id) REFERENCES credentials(id) ON DELETE SET NULL;
+
+CREATE INDEX idx_audit_logs_start_time ON audit_logs(start_time DESC);
+CREATE INDEX idx_audit_logs_purpose ON audit_logs(purpose);
+CREATE INDEX idx_audit_logs_user_start_time ON audit_logs(user_id, start_time DESC) INCLUDE (target_id);
+CREATE INDEX idx_audit_logs_target_start_time ON audit_logs(target_id, start_time DESC);
+CREATE INDEX idx_audit_logs_status_start_time ON audit_logs(session_status, start_time DESC);
+CREATE INDEX idx_audit_logs_active ON audit_logs(start_time DESC) WHERE session_status = 'active';
+
+CREATE TRIGGER audit_logs_delete_dependents AFTER DELETE ON audit_logs
+    FOR EACH ROW EXECUTE FUNCTION delete_audit_dependents('audit_logs');
+
+-- System audit logs, partitioned by timestamp
+ALTER TABLE system_audit_logs RENAME TO system_audit_logs_unpartitioned;
+ALTER INDEX system_audit_logs_pkey RENAME TO system_audit_logs_unpartitioned_pkey;
+
+CREATE TABLE system_audit_logs (LIKE system_audit_logs_unpartitioned INCLUDING DEFAULTS INCLUDING CONSTRAINTS)
+    PARTITION BY RANGE (timestamp);
+CREATE TABLE system_audit_logs_default PARTITION OF system_audit_logs DEFAULT;
+
+SELECT create_audit_partition('system_audit_logs', month::date)
+FROM generate_series(
+    date_trunc('month', COALESCE((SELECT MIN(timestamp) FROM system_audit_logs_unpartitioned), NOW()) AT TIME ZONE 'UTC'),
+    date_trunc('month', NOW() AT TIME ZONE 'UTC') + INTERVAL '3 months',
+    INTERVAL '1 month') AS month;
+
+INSERT INTO system_audit_logs SELECT * FROM system_audit_logs_unpartitioned;
+DROP TABLE system_audit_logs_unpartitioned;
+
+ALTER TABLE system_audit_logs ADD PRIMARY KEY (id, timestamp);
+ALTER TABLE system_audit_logs ADD FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE SET NULL;
+ALTER TABLE system_audit_logs ADD FOREIGN KEY (target_user_id) REFERENCES users(id) ON DELETE SET NULL;
+ALTER TABLE system_audit_logs ADD FOREIGN KEY (elevation_id) REFERENCES role_elevations(id) ON DELETE SET NULL;
+
+CREATE INDEX idx_system_audit_logs_timestamp ON system_audit_logs(timestamp DESC);
+CREATE INDEX idx_system_audit_logs_event_type ON system_audit_logs(event_type);
+CREATE INDEX idx_system_audit_logs_user_id ON system_audit_logs(user_id);
+CREATE INDEX idx_system_audit_logs_target_user_id ON system_audit_logs(target_user_id);
+CREATE INDEX idx_system_audit_logs_resource_type ON system_audit_logs(resource_type);
+CREATE INDEX idx_system_audit_logs_resource_id ON system_audit_logs(resource_id);
+CREATE INDEX idx_system_audit_logs_status ON system_audit_logs(status);
+CREATE INDEX idx_system_audit_logs_elevation_id ON system_audit_logs(elevation_id) WHERE elevation_id IS NOT NULL;
+
+CREATE TRIGGER system_audit_logs_delete_dependents AFTER DELETE ON system_audit_logs
+    FOR EACH ROW EXECUTE FUNCTION delete_audit_dependents('system_audit_logs');
+
+ANALYZE audit_logs;
+ANALYZE system_audit_logs;
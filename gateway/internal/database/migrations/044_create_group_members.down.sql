@@ -0,0 +1,3 @@
+ALTER TABLE credential_rules DROP COLUMN IF EXISTS group_id;
+
+DROP TABLE IF EXISTS group_members;
@@ -0,0 +1,25 @@
+-- Group membership. Members of local groups are managed in OpenPAM, members of
+-- Active Directory groups are written by the identity service's sync. Groups
+-- are shared with the identity service, which also creates the table.
+CREATE TABLE IF NOT EXISTS groups (
+    id TEXT PRIMARY KEY,
+    name TEXT NOT NULL,
+    dn TEXT,
+    description TEXT,
+    role TEXT DEFAULT 'user',
+    source TEXT DEFAULT 'active_directory',
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE group_members (
+    group_id TEXT NOT NULL REFERENCES groups(id) ON DELETE CASCADE,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    source VARCHAR(50) NOT NULL DEFAULT 'local', -- 'local' or 'active_directory'
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (group_id, user_id)
+);
+
+CREATE INDEX idx_group_members_user_id ON group_members(user_id);
+
+-- Credential rules can name a group as their subject
+ALTER TABLE credential_rules ADD COLUMN group_id TEXT REFERENCES groups(id) ON DELETE CASCADE;
@@ -0,0 +1,5 @@
+ALTER TABLE audit_logs
+    DROP COLUMN IF EXISTS banner_version,
+    DROP COLUMN IF EXISTS banner_acknowledged_at;
+
+DROP TABLE IF EXISTS banner_acknowledgments;
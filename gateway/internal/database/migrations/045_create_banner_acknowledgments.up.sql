@@ -0,0 +1,16 @@
+-- Acknowledgments of the pre-session banners set on zones and targets, and
+-- the banner each session was opened under
+CREATE TABLE banner_acknowledgments (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    target_id UUID NOT NULL REFERENCES targets(id) ON DELETE CASCADE,
+    banner_version VARCHAR(64) NOT NULL, -- Hash of the banner text that was shown
+    client_ip VARCHAR(45),
+    acknowledged_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX idx_banner_acknowledgments_user_target ON banner_acknowledgments(user_id, target_id, acknowledged_at DESC);
+
+ALTER TABLE audit_logs
+    ADD COLUMN banner_version VARCHAR(64),
+    ADD COLUMN banner_acknowledged_at TIMESTAMP WITH TIME ZONE;
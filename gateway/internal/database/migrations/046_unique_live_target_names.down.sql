@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS idx_targets_zone_id_name;
+-- Fails if live and deleted targets share a name; remove the deleted ones first
+ALTER TABLE targets ADD CONSTRAINT targets_zone_id_name_key UNIQUE (zone_id, name);
@@ -0,0 +1,4 @@
+-- Names only need to be unique among live targets, so a deleted target's name
+-- can be reused, such as when an ephemeral host registers again
+ALTER TABLE targets DROP CONSTRAINT IF EXISTS targets_zone_id_name_key;
+CREATE UNIQUE INDEX IF NOT EXISTS idx_targets_zone_id_name ON targets(zone_id, name) WHERE deleted_at IS NULL;
@@ -0,0 +1,8 @@
+UPDATE schedules
+SET metadata = COALESCE(metadata, '{}'::jsonb) || jsonb_build_object(
+        'requested_window', jsonb_build_object('start_time', requested_start_time, 'end_time', requested_end_time))
+WHERE requested_start_time IS NOT NULL;
+
+ALTER TABLE schedules
+    DROP COLUMN IF EXISTS requested_end_time,
+    DROP COLUMN IF EXISTS requested_start_time;
@@ -0,0 +1,11 @@
+-- The window a schedule was requested for, kept when an approver changes it.
+-- Moves the requested_window previously kept in the schedule's metadata.
+ALTER TABLE schedules
+    ADD COLUMN requested_start_time TIMESTAMP WITH TIME ZONE,
+    ADD COLUMN requested_end_time TIMESTAMP WITH TIME ZONE;
+
+UPDATE schedules
+SET requested_start_time = (metadata->'requested_window'->>'start_time')::timestamptz,
+    requested_end_time = (metadata->'requested_window'->>'end_time')::timestamptz,
+    metadata = metadata - 'requested_window'
+WHERE metadata ? 'requested_window';
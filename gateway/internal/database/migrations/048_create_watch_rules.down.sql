@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS watch_alerts;
+DROP TABLE IF EXISTS watch_hits;
+DROP TABLE IF EXISTS watch_rules;
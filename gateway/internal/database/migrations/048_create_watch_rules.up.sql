@@ -0,0 +1,53 @@
+-- Watch rules raise alerts on audit events matching their conditions, once
+-- they happen as often as the rule's threshold within its window
+CREATE TABLE watch_rules (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    name VARCHAR(255) NOT NULL,
+    description TEXT,
+    enabled BOOLEAN NOT NULL DEFAULT true,
+    event_types TEXT[] NOT NULL DEFAULT '{}', -- Stream event type patterns, e.g. system.login_failed or audit.session_*
+    user_id UUID REFERENCES users(id) ON DELETE CASCADE,
+    target_tag VARCHAR(255), -- Compliance scope or label (key or key=value) the event's target must carry
+    status VARCHAR(50), -- System audit status or session status the event must have
+    outside_hours JSONB, -- Only events outside these working hours match
+    threshold INTEGER NOT NULL DEFAULT 1,
+    window_seconds INTEGER NOT NULL DEFAULT 0,
+    group_by VARCHAR(20) NOT NULL DEFAULT '', -- Events are counted per 'user', 'ip' or 'target', or all together
+    actions TEXT[] NOT NULL DEFAULT '{}', -- 'notify', 'open_investigation' and/or 'disable_user'
+    recipients TEXT[] NOT NULL DEFAULT '{}',
+    created_by UUID REFERENCES users(id) ON DELETE SET NULL,
+    updated_by UUID REFERENCES users(id) ON DELETE SET NULL,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+-- Matching events counted towards a rule's threshold. They are cleared when
+-- the rule fires and pruned once they fall out of every window.
+CREATE TABLE watch_hits (
+    rule_id UUID NOT NULL REFERENCES watch_rules(id) ON DELETE CASCADE,
+    group_key VARCHAR(255) NOT NULL,
+    event_id BIGINT NOT NULL,
+    occurred_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    PRIMARY KEY (rule_id, group_key, event_id)
+);
+
+CREATE INDEX idx_watch_hits_occurred_at ON watch_hits(occurred_at);
+
+CREATE TABLE watch_alerts (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    rule_id UUID NOT NULL REFERENCES watch_rules(id) ON DELETE CASCADE,
+    rule_name VARCHAR(255) NOT NULL,
+    event_id BIGINT NOT NULL, -- Event that reached the threshold
+    event_type VARCHAR(100) NOT NULL,
+    group_key VARCHAR(255) NOT NULL DEFAULT '',
+    event_count INTEGER NOT NULL,
+    user_id UUID REFERENCES users(id) ON DELETE SET NULL,
+    target_id UUID REFERENCES targets(id) ON DELETE SET NULL,
+    investigation_id UUID REFERENCES investigations(id) ON DELETE SET NULL,
+    actions TEXT[] NOT NULL DEFAULT '{}', -- Actions that were carried out
+    errors TEXT[] NOT NULL DEFAULT '{}',
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX idx_watch_alerts_created_at ON watch_alerts(created_at DESC);
+CREATE INDEX idx_watch_alerts_rule_id ON watch_alerts(rule_id, created_at DESC);
@@ -0,0 +1,11 @@
+-- Zone admins manage the targets, credentials and schedules of the zones
+-- assigned to them, without being global admins
+CREATE TABLE zone_admins (
+    zone_id UUID NOT NULL REFERENCES zones(id) ON DELETE CASCADE,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    created_by UUID REFERENCES users(id) ON DELETE SET NULL,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (zone_id, user_id)
+);
+
+CREATE INDEX idx_zone_admins_user ON zone_admins(user_id);
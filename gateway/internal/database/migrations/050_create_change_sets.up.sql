@@ -0,0 +1,23 @@
+-- Change sets hold admin changes put under dual control: the request is staged
+-- with a diff against the current state, and replayed once a second admin
+-- approves it.
+CREATE TABLE change_sets (
+    id UUID PRIMARY KEY,
+    category VARCHAR(50) NOT NULL, -- 'credentials', 'credential_rules' or 'user_roles'
+    kind VARCHAR(50) NOT NULL, -- The change, e.g. credential_update
+    method VARCHAR(10) NOT NULL,
+    path TEXT NOT NULL, -- Request path and query the change is replayed against
+    body JSONB,
+    if_match VARCHAR(50),
+    before JSONB, -- State the change replaces; NULL for creations
+    diff JSONB NOT NULL DEFAULT '{}', -- Changed fields, each with its "from" and "to" value
+    status VARCHAR(20) NOT NULL DEFAULT 'pending' CHECK (status IN ('pending', 'approved', 'applied', 'rejected', 'failed')),
+    requested_by UUID REFERENCES users(id) ON DELETE SET NULL,
+    decided_by UUID REFERENCES users(id) ON DELETE SET NULL,
+    decided_at TIMESTAMP WITH TIME ZONE,
+    rejection_reason TEXT,
+    error TEXT, -- Why applying an approved change failed
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX idx_change_sets_status ON change_sets(status, created_at DESC);
@@ -0,0 +1,18 @@
+-- Policy drafts hold a complete proposed set of credential rules. Admins try
+-- them out with dry-run evaluations, then publish them to replace the live rules.
+CREATE TABLE policy_drafts (
+    id UUID PRIMARY KEY,
+    name VARCHAR(255) NOT NULL,
+    description TEXT,
+    rules JSONB NOT NULL DEFAULT '[]',
+    base_fingerprint VARCHAR(64) NOT NULL, -- Fingerprint of the live rules the draft started from
+    status VARCHAR(20) NOT NULL DEFAULT 'draft' CHECK (status IN ('draft', 'published', 'discarded')),
+    created_by UUID REFERENCES users(id) ON DELETE SET NULL,
+    updated_by UUID REFERENCES users(id) ON DELETE SET NULL,
+    published_by UUID REFERENCES users(id) ON DELETE SET NULL,
+    published_at TIMESTAMP WITH TIME ZONE,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX idx_policy_drafts_status ON policy_drafts(status, updated_at DESC);
@@ -0,0 +1 @@
+DROP TABLE IF EXISTS failover_events;
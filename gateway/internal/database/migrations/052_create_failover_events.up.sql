@@ -0,0 +1,13 @@
+-- Failover events record a standby gateway taking over from the primary or
+-- handing back to it. Both gateways share the table, so either shows the
+-- history.
+CREATE TABLE failover_events (
+    id UUID PRIMARY KEY,
+    node VARCHAR(255) NOT NULL, -- The standby that changed state
+    from_state VARCHAR(20) NOT NULL CHECK (from_state IN ('active', 'passive')),
+    to_state VARCHAR(20) NOT NULL CHECK (to_state IN ('active', 'passive')),
+    reason TEXT NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX idx_failover_events_created_at ON failover_events(created_at DESC);
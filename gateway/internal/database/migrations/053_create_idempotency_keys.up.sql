@@ -0,0 +1,18 @@
+-- Idempotency keys let clients retry create requests safely. The first
+-- request under a key is recorded with its response, which is replayed to
+-- retries until the key expires.
+CREATE TABLE idempotency_keys (
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    key VARCHAR(255) NOT NULL,
+    method VARCHAR(10) NOT NULL,
+    path TEXT NOT NULL,
+    request_hash VARCHAR(64) NOT NULL, -- SHA-256 of the method, path and body
+    status INTEGER NOT NULL DEFAULT 0, -- 0 while the first request is in progress
+    headers JSONB,
+    body BYTEA,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    expires_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    PRIMARY KEY (user_id, key)
+);
+
+CREATE INDEX idx_idempotency_keys_expires_at ON idempotency_keys(expires_at);
@@ -0,0 +1,31 @@
+-- Daily usage per user and API key: API calls, sessions started and bytes
+-- proxied. Use signed in, without an API key, is kept under the nil UUID.
+CREATE TABLE usage_daily (
+    day DATE NOT NULL,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    api_key_id UUID NOT NULL DEFAULT '00000000-0000-0000-0000-000000000000',
+    api_calls BIGINT NOT NULL DEFAULT 0,
+    sessions BIGINT NOT NULL DEFAULT 0,
+    bytes_sent BIGINT NOT NULL DEFAULT 0,
+    bytes_received BIGINT NOT NULL DEFAULT 0,
+    PRIMARY KEY (day, user_id, api_key_id)
+);
+
+CREATE INDEX idx_usage_daily_user_id ON usage_daily(user_id, day DESC);
+
+-- Quotas cap a user's daily usage of one metric, or one of their API keys'.
+-- Requests over the limit are refused until the next day (UTC), and an alert
+-- is sent once a day when usage reaches alert_percent of it.
+CREATE TABLE usage_quotas (
+    id UUID PRIMARY KEY,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    api_key_id UUID REFERENCES api_keys(id) ON DELETE CASCADE, -- NULL covers all of the user's usage
+    metric VARCHAR(20) NOT NULL CHECK (metric IN ('api_calls', 'sessions', 'bytes')),
+    daily_limit BIGINT NOT NULL CHECK (daily_limit > 0),
+    alert_percent INTEGER NOT NULL DEFAULT 80 CHECK (alert_percent BETWEEN 1 AND 100),
+    alerted_on DATE, -- The last day an alert was sent
+    created_by UUID REFERENCES users(id) ON DELETE SET NULL,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+CREATE UNIQUE INDEX idx_usage_quotas_scope ON usage_quotas(user_id, COALESCE(api_key_id, '00000000-0000-0000-0000-000000000000'), metric);
@@ -0,0 +1,8 @@
+-- Rows created by the demo data seeder, so the demo data can be told apart
+-- from real data and removed with one command
+CREATE TABLE demo_records (
+    table_name VARCHAR(64) NOT NULL,
+    record_id UUID NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (table_name, record_id)
+);
@@ -0,0 +1,14 @@
+CREATE OR REPLACE FUNCTION audit_dependents(parent TEXT)
+RETURNS TABLE (dependent TEXT, ref_column TEXT) AS $$
+    SELECT * FROM (VALUES
+        ('audit_logs', 'session_annotations', 'audit_log_id'),
+        ('audit_logs', 'investigation_items', 'audit_log_id'),
+        ('audit_logs', 'violation_evidence', 'audit_log_id'),
+        ('audit_logs', 'remediation_runs', 'audit_log_id'),
+        ('system_audit_logs', 'investigation_items', 'system_audit_log_id'),
+        ('system_audit_logs', 'violation_evidence', 'system_audit_log_id')
+    ) AS d (parent, dependent, ref_column)
+    WHERE d.parent = audit_dependents.parent;
+$$ LANGUAGE sql IMMUTABLE;
+
+DROP TABLE IF EXISTS session_target_logs;
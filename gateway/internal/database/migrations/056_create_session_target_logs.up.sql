@@ -0,0 +1,30 @@
+-- Lines of targets' own auth and audit logs, forwarded to the gateway and
+-- attached to the sessions they were matched to. A line matching several
+-- sessions is stored once for each.
+CREATE TABLE session_target_logs (
+    id UUID PRIMARY KEY,
+    audit_log_id UUID NOT NULL,
+    host VARCHAR(255) NOT NULL,
+    program VARCHAR(255),
+    message TEXT NOT NULL,
+    logged_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    received_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    matched_by VARCHAR(20) NOT NULL CHECK (matched_by IN ('session_id', 'client_name', 'source'))
+);
+
+CREATE INDEX idx_session_target_logs_audit_log_id ON session_target_logs(audit_log_id, logged_at);
+
+-- Deleted with their session, like the other rows referring to audit logs
+CREATE OR REPLACE FUNCTION audit_dependents(parent TEXT)
+RETURNS TABLE (dependent TEXT, ref_column TEXT) AS $$
+    SELECT * FROM (VALUES
+        ('audit_logs', 'session_annotations', 'audit_log_id'),
+        ('audit_logs', 'investigation_items', 'audit_log_id'),
+        ('audit_logs', 'violation_evidence', 'audit_log_id'),
+        ('audit_logs', 'remediation_runs', 'audit_log_id'),
+        ('audit_logs', 'session_target_logs', 'audit_log_id'),
+        ('system_audit_logs', 'investigation_items', 'system_audit_log_id'),
+        ('system_audit_logs', 'violation_evidence', 'system_audit_log_id')
+    ) AS d (parent, dependent, ref_column)
+    WHERE d.parent = audit_dependents.parent;
+$$ LANGUAGE sql IMMUTABLE;
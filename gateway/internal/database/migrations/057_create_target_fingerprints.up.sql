@@ -0,0 +1,15 @@
+-- The latest fingerprint of each target: the remote access services it
+-- answers on, the software behind them and its operating system, kept for
+-- reporting which targets run vulnerable versions
+CREATE TABLE target_fingerprints (
+    target_id UUID PRIMARY KEY REFERENCES targets(id) ON DELETE CASCADE,
+    host VARCHAR(255) NOT NULL,
+    services JSONB NOT NULL DEFAULT '[]',
+    os VARCHAR(255) NOT NULL DEFAULT '',
+    os_version VARCHAR(255) NOT NULL DEFAULT '',
+    os_family VARCHAR(20) NOT NULL DEFAULT '',
+    os_source VARCHAR(20) NOT NULL DEFAULT '',
+    suggested_protocol VARCHAR(20) NOT NULL DEFAULT '',
+    suggested_port INTEGER NOT NULL DEFAULT 0,
+    probed_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
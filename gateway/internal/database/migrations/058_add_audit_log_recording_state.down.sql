@@ -0,0 +1,2 @@
+ALTER TABLE audit_logs DROP COLUMN IF EXISTS recording_error;
+ALTER TABLE audit_logs DROP COLUMN IF EXISTS recording_state;
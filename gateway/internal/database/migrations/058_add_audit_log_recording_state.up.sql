@@ -0,0 +1,4 @@
+-- Whether each session's recording started, and why not if it didn't, so
+-- sessions missing their recording can be reported on
+ALTER TABLE audit_logs ADD COLUMN IF NOT EXISTS recording_state VARCHAR(20);
+ALTER TABLE audit_logs ADD COLUMN IF NOT EXISTS recording_error TEXT;
@@ -0,0 +1,9 @@
+-- Each user's iCalendar feed of their access windows. The feed URL holds a
+-- signed token naming feed_id; a new feed_id revokes the old URL.
+CREATE TABLE calendar_feeds (
+    user_id UUID PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+    feed_id UUID NOT NULL UNIQUE,
+    include_pending BOOLEAN NOT NULL DEFAULT FALSE,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    last_fetched_at TIMESTAMP WITH TIME ZONE
+);
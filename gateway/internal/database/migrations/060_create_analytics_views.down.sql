@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS analytics_refreshes;
+DROP MATERIALIZED VIEW IF EXISTS analytics_approval_days;
+DROP MATERIALIZED VIEW IF EXISTS analytics_session_hours;
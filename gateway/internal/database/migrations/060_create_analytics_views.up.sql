@@ -0,0 +1,52 @@
+-- Pre-aggregated analytics, so dashboards don't scan the audit logs and
+-- schedules. The gateway refreshes the views every ANALYTICS_REFRESH_INTERVAL;
+-- they are created empty and filled by the first refresh.
+
+-- Session time per UTC hour, target and user. A session counts in the hour it
+-- started, and its duration is split over the hours it spans. Sessions are
+-- added once they end.
+CREATE MATERIALIZED VIEW analytics_session_hours AS
+SELECT h.hour,
+       a.target_id,
+       a.user_id,
+       COUNT(*) FILTER (WHERE h.hour = date_trunc('hour', a.start_time, 'UTC'))::INT AS sessions,
+       SUM(EXTRACT(EPOCH FROM LEAST(a.end_time, h.hour + INTERVAL '1 hour') - GREATEST(a.start_time, h.hour)))::BIGINT AS seconds
+FROM audit_logs a
+CROSS JOIN LATERAL generate_series(date_trunc('hour', a.start_time, 'UTC'), a.end_time, INTERVAL '1 hour') AS h(hour)
+WHERE a.end_time IS NOT NULL
+GROUP BY h.hour, a.target_id, a.user_id
+WITH NO DATA;
+
+-- Refreshing concurrently needs a unique index
+CREATE UNIQUE INDEX idx_analytics_session_hours ON analytics_session_hours(hour, target_id, user_id);
+CREATE INDEX idx_analytics_session_hours_user ON analytics_session_hours(user_id, hour);
+
+-- Decisions on access requests per UTC day and zone, with how long they took.
+-- Requests decided by no one, such as those that expired, are left out.
+CREATE MATERIALIZED VIEW analytics_approval_days AS
+SELECT date_trunc('day', s.approved_at, 'UTC')::DATE AS day,
+       t.zone_id,
+       COUNT(*) FILTER (WHERE s.approval_status = 'approved')::INT AS approved,
+       COUNT(*) FILTER (WHERE s.approval_status = 'rejected')::INT AS rejected,
+       SUM(EXTRACT(EPOCH FROM s.approved_at - s.created_at))::BIGINT AS total_seconds,
+       MAX(EXTRACT(EPOCH FROM s.approved_at - s.created_at))::BIGINT AS max_seconds,
+       COUNT(*) FILTER (WHERE s.approved_at - s.created_at <= INTERVAL '15 minutes')::INT AS within_15m,
+       COUNT(*) FILTER (WHERE s.approved_at - s.created_at <= INTERVAL '1 hour')::INT AS within_1h,
+       COUNT(*) FILTER (WHERE s.approved_at - s.created_at <= INTERVAL '4 hours')::INT AS within_4h,
+       COUNT(*) FILTER (WHERE s.approved_at - s.created_at <= INTERVAL '1 day')::INT AS within_1d
+FROM schedules s
+JOIN targets t ON t.id = s.target_id
+WHERE s.approval_status IN ('approved', 'rejected')
+  AND s.approved_by IS NOT NULL
+  AND s.approved_at >= s.created_at
+GROUP BY 1, 2
+WITH NO DATA;
+
+CREATE UNIQUE INDEX idx_analytics_approval_days ON analytics_approval_days(day, zone_id);
+
+-- When each view was last refreshed
+CREATE TABLE analytics_refreshes (
+    view_name TEXT PRIMARY KEY,
+    refreshed_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    duration_ms INT NOT NULL
+);
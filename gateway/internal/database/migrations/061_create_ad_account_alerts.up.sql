@@ -0,0 +1,10 @@
+-- AD accounts alerted on by the account monitor. An account is alerted on
+-- again once the time the alert was about moves on: a new password expiry,
+-- or a logon that went stale again.
+CREATE TABLE ad_account_alerts (
+    kind VARCHAR(32) NOT NULL,
+    ad_user_id TEXT NOT NULL,
+    since TIMESTAMP WITH TIME ZONE NOT NULL,
+    alerted_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    PRIMARY KEY (kind, ad_user_id)
+);
@@ -0,0 +1,2 @@
+ALTER TABLE users DROP COLUMN IF EXISTS attributes;
+ALTER TABLE credential_rules DROP COLUMN IF EXISTS condition;
@@ -0,0 +1,6 @@
+-- Attribute conditions on credential rules: a CEL expression over the user,
+-- target, credential and time of a request, that must hold for the rule to
+-- apply. Users carry the attributes the expressions test, such as their
+-- department.
+ALTER TABLE credential_rules ADD COLUMN condition TEXT;
+ALTER TABLE users ADD COLUMN attributes JSONB NOT NULL DEFAULT '{}';
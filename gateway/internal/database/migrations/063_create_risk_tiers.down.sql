@@ -0,0 +1,5 @@
+DROP TABLE IF EXISTS schedule_approvals;
+ALTER TABLE schedules DROP COLUMN IF EXISTS risk_tier;
+DROP TABLE IF EXISTS approval_quorums;
+DROP TABLE IF EXISTS risk_tier_labels;
+ALTER TABLE targets DROP COLUMN IF EXISTS risk_tier;
@@ -0,0 +1,49 @@
+-- Risk tiers decide how many approvals a schedule request needs. A target's
+-- tier is set on the target, or else taken from the highest tier of the
+-- labels it carries; targets with neither are medium.
+ALTER TABLE targets ADD COLUMN risk_tier VARCHAR(16)
+    CHECK (risk_tier IN ('low', 'medium', 'high', 'critical'));
+
+-- Labels that put the targets carrying them in a tier. An empty value
+-- matches the label with any value.
+CREATE TABLE risk_tier_labels (
+    label_key VARCHAR(63) NOT NULL,
+    label_value VARCHAR(256) NOT NULL DEFAULT '',
+    tier VARCHAR(16) NOT NULL CHECK (tier IN ('low', 'medium', 'high', 'critical')),
+    created_by UUID REFERENCES users(id) ON DELETE SET NULL,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (label_key, label_value)
+);
+
+-- The approvals a request for a target of each tier needs: approvals from
+-- any approvers, plus group_approvals from members of group_id. Requests of
+-- auto-approved tiers are approved when they are made.
+CREATE TABLE approval_quorums (
+    tier VARCHAR(16) PRIMARY KEY CHECK (tier IN ('low', 'medium', 'high', 'critical')),
+    auto_approve BOOLEAN NOT NULL DEFAULT false,
+    approvals INTEGER NOT NULL DEFAULT 1 CHECK (approvals >= 0),
+    group_id TEXT REFERENCES groups(id) ON DELETE SET NULL,
+    group_approvals INTEGER NOT NULL DEFAULT 0 CHECK (group_approvals >= 0),
+    version INTEGER NOT NULL DEFAULT 1,
+    updated_by UUID REFERENCES users(id) ON DELETE SET NULL,
+    updated_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+INSERT INTO approval_quorums (tier, auto_approve, approvals) VALUES
+    ('low', true, 0),
+    ('medium', false, 1),
+    ('high', false, 2),
+    ('critical', false, 2);
+
+-- The tier of the target when the schedule was requested; unset for
+-- schedules from before tiers and those not requested, such as on-call ones
+ALTER TABLE schedules ADD COLUMN risk_tier VARCHAR(16);
+
+-- Approvals recorded towards a schedule's quorum
+CREATE TABLE schedule_approvals (
+    schedule_id UUID NOT NULL REFERENCES schedules(id) ON DELETE CASCADE,
+    approver_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    channel VARCHAR(16) NOT NULL,
+    approved_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (schedule_id, approver_id)
+);
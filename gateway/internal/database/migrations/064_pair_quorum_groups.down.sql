@@ -0,0 +1,5 @@
+ALTER TABLE approval_quorums
+    DROP CONSTRAINT IF EXISTS approval_quorums_group_check,
+    DROP CONSTRAINT approval_quorums_group_id_fkey,
+    ADD CONSTRAINT approval_quorums_group_id_fkey
+        FOREIGN KEY (group_id) REFERENCES groups(id) ON DELETE SET NULL;
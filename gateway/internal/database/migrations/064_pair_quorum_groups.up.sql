@@ -0,0 +1,13 @@
+-- A quorum's group approvals and group go together, and a group a quorum
+-- needs can't be deleted: with the group gone its approvals could never be
+-- counted, leaving the tier's pending requests unapprovable.
+
+-- Quorums whose group was already deleted stop asking for its approvals
+UPDATE approval_quorums SET group_approvals = 0 WHERE group_id IS NULL;
+
+ALTER TABLE approval_quorums
+    DROP CONSTRAINT approval_quorums_group_id_fkey,
+    ADD CONSTRAINT approval_quorums_group_id_fkey
+        FOREIGN KEY (group_id) REFERENCES groups(id) ON DELETE RESTRICT,
+    ADD CONSTRAINT approval_quorums_group_check
+        CHECK ((group_id IS NULL) = (group_approvals = 0));
@@ -0,0 +1,502 @@
+// Package demo seeds realistic demo data for evaluating the gateway: zones,
+// targets pointing at the bundled SSH and RDP test hosts, users in each role,
+// schedules in every state, historical sessions and sample recordings. Every
+// row seeded is recorded as demo data, so it is all removed with one command.
+package demo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/VanCannon/openpam/gateway/internal/models"
+	"github.com/VanCannon/openpam/gateway/internal/recordings"
+	"github.com/google/uuid"
+)
+
+// Label marks demo targets, and Source demo users
+const (
+	Label  = "demo"
+	Source = "demo"
+)
+
+// ErrSeeded is returned when the demo data is already there
+var ErrSeeded = errors.New("demo data already seeded")
+
+// ZoneStore is the subset of the zone repository seeding needs
+type ZoneStore interface {
+	Create(ctx context.Context, zone *models.Zone) error
+}
+
+// TargetStore is the subset of the target repository seeding needs
+type TargetStore interface {
+	Create(ctx context.Context, target *models.Target) error
+}
+
+// CredentialStore is the subset of the credential repository seeding needs
+type CredentialStore interface {
+	Create(ctx context.Context, cred *models.Credential) error
+}
+
+// UserStore is the subset of the user repository seeding needs
+type UserStore interface {
+	Create(ctx context.Context, user *models.User) error
+}
+
+// ScheduleStore is the subset of the schedule repository seeding needs
+type ScheduleStore interface {
+	Create(ctx context.Context, schedule *models.Schedule) error
+}
+
+// AuditStore stores sessions with their original times
+type AuditStore interface {
+	Import(ctx context.Context, log *models.AuditLog) (bool, error)
+}
+
+// RecordingStore is where the sample recordings are catalogued
+type RecordingStore interface {
+	Upsert(ctx context.Context, rec *models.Recording) error
+}
+
+// RecordStore keeps track of which rows are demo data
+type RecordStore interface {
+	Mark(ctx context.Context, table string, id uuid.UUID) error
+	IDs(ctx context.Context, table string) ([]uuid.UUID, error)
+	Count(ctx context.Context) (int, error)
+	Remove(ctx context.Context) (map[string]int64, error)
+}
+
+// Stores are the repositories demo data is seeded into
+type Stores struct {
+	Zones       ZoneStore
+	Targets     TargetStore
+	Credentials CredentialStore
+	Users       UserStore
+	Schedules   ScheduleStore
+	Audit       AuditStore
+	Recordings  RecordingStore
+	Records     RecordStore
+}
+
+// Config holds where the bundled test hosts are reached
+type Config struct {
+	SSHAddress string // SSH test host, as the gateway reaches it
+	RDPAddress string // RDP test host, as guacd reaches it
+	Username   string // Account on both test hosts
+	Password   string
+}
+
+// Summary is what was seeded
+type Summary struct {
+	Zones      int
+	Targets    int
+	Users      int
+	Schedules  int
+	Sessions   int
+	Recordings int
+}
+
+// Seeder seeds and removes the demo data
+type Seeder struct {
+	stores  Stores
+	storage recordings.Storage
+	config  Config
+	now     func() time.Time
+}
+
+// New creates a seeder writing sample recordings to storage
+func New(stores Stores, storage recordings.Storage, cfg Config) *Seeder {
+	return &Seeder{stores: stores, storage: storage, config: cfg, now: time.Now}
+}
+
+// seeded holds the rows created so far, to build the next ones on
+type seeded struct {
+	zones   map[string]*models.Zone
+	targets []*models.Target
+	creds   map[uuid.UUID]*models.Credential // By target
+	users   map[string]*models.User          // By name
+	summary Summary
+}
+
+// Seed creates the demo data, unless it is already there
+func (s *Seeder) Seed(ctx context.Context) (*Summary, error) {
+	count, err := s.stores.Records.Count(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if count > 0 {
+		return nil, ErrSeeded
+	}
+
+	data := &seeded{
+		zones: make(map[string]*models.Zone),
+		creds: make(map[uuid.UUID]*models.Credential),
+		users: make(map[string]*models.User),
+	}
+	for _, step := range []func(context.Context, *seeded) error{
+		s.seedZones,
+		s.seedTargets,
+		s.seedUsers,
+		s.seedSchedules,
+		s.seedSessions,
+	} {
+		if err := step(ctx, data); err != nil {
+			return nil, err
+		}
+	}
+	return &data.summary, nil
+}
+
+// Remove deletes the demo data and its recordings, and returns how many rows
+// were deleted from each table
+func (s *Seeder) Remove(ctx context.Context) (map[string]int64, error) {
+	sessions, err := s.stores.Records.IDs(ctx, "audit_logs")
+	if err != nil {
+		return nil, err
+	}
+
+	// Recordings and their timing files are named after their session
+	if len(sessions) > 0 {
+		demoSessions := make(map[string]bool, len(sessions))
+		for _, id := range sessions {
+			demoSessions[id.String()] = true
+		}
+		entries, err := s.storage.ReadDir(".")
+		if err != nil {
+			return nil, fmt.Errorf("failed to list recordings: %w", err)
+		}
+		for _, entry := range entries {
+			name := entry.Name()
+			if len(name) > 36 && demoSessions[name[:36]] {
+				if err := s.storage.Remove(ctx, name); err != nil {
+					return nil, fmt.Errorf("failed to remove recording %s: %w", name, err)
+				}
+			}
+		}
+	}
+
+	return s.stores.Records.Remove(ctx)
+}
+
+func (s *Seeder) seedZones(ctx context.Context, data *seeded) error {
+	for _, zone := range []*models.Zone{
+		{Name: "demo-headquarters", Type: models.ZoneTypeHub, Description: "Demo data: the main data center"},
+		{Name: "demo-branch-office", Type: models.ZoneTypeSatellite, Description: "Demo data: a branch office behind a satellite gateway"},
+	} {
+		if err := s.stores.Zones.Create(ctx, zone); err != nil {
+			return fmt.Errorf("failed to create demo zone: %w", err)
+		}
+		if err := s.stores.Records.Mark(ctx, "zones", zone.ID); err != nil {
+			return err
+		}
+		data.zones[zone.Name] = zone
+		data.summary.Zones++
+	}
+	return nil
+}
+
+func (s *Seeder) seedTargets(ctx context.Context, data *seeded) error {
+	sshHost, sshPort, err := splitAddress(s.config.SSHAddress)
+	if err != nil {
+		return err
+	}
+	rdpHost, rdpPort, err := splitAddress(s.config.RDPAddress)
+	if err != nil {
+		return err
+	}
+
+	hq, branch := data.zones["demo-headquarters"].ID, data.zones["demo-branch-office"].ID
+	wanted := []*models.Target{
+		{ZoneID: hq, Name: "demo-web-01", Protocol: models.ProtocolSSH, Hostname: sshHost, Port: sshPort,
+			OwnerTeam: "web", Environment: "production", ComplianceScope: []string{"pci-dss"}},
+		{ZoneID: hq, Name: "demo-db-01", Protocol: models.ProtocolSSH, Hostname: sshHost, Port: sshPort,
+			OwnerTeam: "dba", Environment: "production", ComplianceScope: []string{"pci-dss", "sox"}},
+		{ZoneID: hq, Name: "demo-jumpbox", Protocol: models.ProtocolRDP, Hostname: rdpHost, Port: rdpPort,
+			OwnerTeam: "it-ops", Environment: "production"},
+		{ZoneID: branch, Name: "demo-branch-fileserver", Protocol: models.ProtocolSSH, Hostname: sshHost, Port: sshPort,
+			OwnerTeam: "it-ops", Environment: "staging"},
+		{ZoneID: branch, Name: "demo-branch-desktop", Protocol: models.ProtocolRDP, Hostname: rdpHost, Port: rdpPort,
+			OwnerTeam: "it-ops", Environment: "staging"},
+	}
+
+	for _, target := range wanted {
+		target.Enabled = true
+		target.Labels = models.Labels{Label: "true"}
+		target.ConnectionNotes = "Demo target on a bundled test host. Remove all demo data with `make demo-remove`."
+		if err := s.stores.Targets.Create(ctx, target); err != nil {
+			return fmt.Errorf("failed to create demo target: %w", err)
+		}
+		if err := s.stores.Records.Mark(ctx, "targets", target.ID); err != nil {
+			return err
+		}
+
+		cred := &models.Credential{
+			TargetID:        target.ID,
+			Username:        s.config.Username,
+			VaultSecretPath: "raw:" + s.config.Password,
+			Description:     "Demo account of the bundled test host",
+			IsDefault:       true,
+		}
+		if err := s.stores.Credentials.Create(ctx, cred); err != nil {
+			return fmt.Errorf("failed to create demo credential: %w", err)
+		}
+		if err := s.stores.Records.Mark(ctx, "credentials", cred.ID); err != nil {
+			return err
+		}
+
+		data.targets = append(data.targets, target)
+		data.creds[target.ID] = cred
+		data.summary.Targets++
+	}
+	return nil
+}
+
+// demoUsers are the demo users, one or more in each role
+var demoUsers = []struct {
+	name, displayName, role string
+	enabled                 bool
+}{
+	{"alice", "Alice Admin", models.RoleAdmin, true},
+	{"bob", "Bob Operator", models.RoleUser, true},
+	{"carol", "Carol Developer", models.RoleUser, true},
+	{"dave", "Dave Auditor", models.RoleAuditor, true},
+	{"erin", "Erin Contractor", models.RoleUser, false},
+}
+
+func (s *Seeder) seedUsers(ctx context.Context, data *seeded) error {
+	for _, u := range demoUsers {
+		user := &models.User{
+			EntraID:     "demo-" + u.name,
+			Email:       u.name + "@demo.openpam.example",
+			DisplayName: u.displayName + " (demo)",
+			Enabled:     u.enabled,
+			Role:        u.role,
+			Source:      Source,
+		}
+		if err := s.stores.Users.Create(ctx, user); err != nil {
+			return fmt.Errorf("failed to create demo user: %w", err)
+		}
+		if err := s.stores.Records.Mark(ctx, "users", user.ID); err != nil {
+			return err
+		}
+		data.users[u.name] = user
+		data.summary.Users++
+	}
+	return nil
+}
+
+func (s *Seeder) seedSchedules(ctx context.Context, data *seeded) error {
+	now := s.now().UTC().Truncate(time.Minute)
+	admin := data.users["alice"].ID
+	reason := "Demo request"
+	rejected := "Use the staging host instead"
+
+	wanted := []struct {
+		user     string
+		target   int
+		start    time.Duration // From now
+		length   time.Duration
+		status   models.ScheduleStatus
+		approval string
+	}{
+		{"bob", 0, -time.Hour, 4 * time.Hour, models.ScheduleStatusActive, models.ApprovalStatusApproved},
+		{"carol", 1, 24 * time.Hour, 2 * time.Hour, models.ScheduleStatusPending, models.ApprovalStatusPending},
+		{"bob", 2, 48 * time.Hour, 8 * time.Hour, models.ScheduleStatusPending, models.ApprovalStatusApproved},
+		{"carol", 0, -72 * time.Hour, 2 * time.Hour, models.ScheduleStatusExpired, models.ApprovalStatusApproved},
+		{"erin", 1, 12 * time.Hour, time.Hour, models.ScheduleStatusCancelled, models.ApprovalStatusRejected},
+		{"bob", 3, -24 * time.Hour, 2 * time.Hour, models.ScheduleStatusCancelled, models.ApprovalStatusApproved},
+	}
+
+	for _, w := range wanted {
+		sched := &models.Schedule{
+			ID:             uuid.New(),
+			UserID:         data.users[w.user].ID,
+			TargetID:       data.targets[w.target].ID,
+			StartTime:      now.Add(w.start),
+			EndTime:        now.Add(w.start + w.length),
+			Timezone:       "UTC",
+			Status:         w.status,
+			CreatedBy:      &data.users[w.user].ID,
+			CreatedAt:      now.Add(w.start - 24*time.Hour),
+			UpdatedAt:      now,
+			ApprovalStatus: w.approval,
+		}
+		sched.SetPurpose(models.PurposeMaintenance, reason)
+		switch w.approval {
+		case models.ApprovalStatusApproved:
+			sched.ApprovedBy = &admin
+			sched.ApprovedAt = &sched.CreatedAt
+		case models.ApprovalStatusRejected:
+			sched.RejectionReason = &rejected
+		}
+		if err := s.stores.Schedules.Create(ctx, sched); err != nil {
+			return fmt.Errorf("failed to create demo schedule: %w", err)
+		}
+		if err := s.stores.Records.Mark(ctx, "schedules", sched.ID); err != nil {
+			return err
+		}
+		data.summary.Schedules++
+	}
+	return nil
+}
+
+// sessionDays is how far back the demo session history goes
+const sessionDays = 30
+
+// recordedSessions is how many of the most recent completed sessions get a
+// sample recording
+const recordedSessions = 6
+
+func (s *Seeder) seedSessions(ctx context.Context, data *seeded) error {
+	// A fixed seed gives every demo the same history
+	rng := rand.New(rand.NewSource(1))
+	now := s.now()
+	operators := []string{"alice", "bob", "carol", "erin"}
+	purposes := []string{models.PurposeChange, models.PurposeIncident, models.PurposeMaintenance, models.PurposeOther}
+
+	var sessions []*models.AuditLog
+	for day := sessionDays; day >= 1; day-- {
+		date := now.AddDate(0, 0, -day)
+		if date.Weekday() == time.Saturday || date.Weekday() == time.Sunday {
+			continue
+		}
+		for i := 0; i < 1+rng.Intn(4); i++ {
+			start := time.Date(date.Year(), date.Month(), date.Day(), 8+rng.Intn(9), rng.Intn(60), rng.Intn(60), 0, date.Location())
+			target := data.targets[rng.Intn(len(data.targets))]
+			user := data.users[operators[rng.Intn(len(operators))]]
+			cred := data.creds[target.ID]
+			purpose := purposes[rng.Intn(len(purposes))]
+			reason := fmt.Sprintf("CHG-%04d", 1000+rng.Intn(9000))
+			clientIP := fmt.Sprintf("10.20.%d.%d", rng.Intn(8), 10+rng.Intn(200))
+
+			session := &models.AuditLog{
+				ID:            uuid.New(),
+				UserID:        user.ID,
+				TargetID:      target.ID,
+				CredentialID:  uuid.NullUUID{UUID: cred.ID, Valid: true},
+				StartTime:     start,
+				SessionStatus: models.SessionStatusCompleted,
+				ClientIP:      &clientIP,
+				BytesSent:     int64(2_000 + rng.Intn(200_000)),
+				BytesReceived: int64(20_000 + rng.Intn(5_000_000)),
+				Protocol:      target.Protocol,
+				Purpose:       &purpose,
+				Reason:        &reason,
+				Metadata:      models.JSONB{Label: true},
+			}
+			end := start.Add(time.Duration(2+rng.Intn(90)) * time.Minute)
+			switch roll := rng.Intn(20); {
+			case roll == 0:
+				session.SessionStatus = models.SessionStatusFailed
+				message := "authentication failed"
+				session.ErrorMessage = &message
+				end = start.Add(3 * time.Second)
+				session.BytesSent, session.BytesReceived = 0, 0
+			case roll == 1:
+				session.SessionStatus = models.SessionStatusTerminated
+				message := "terminated by an administrator"
+				session.ErrorMessage = &message
+			}
+			session.EndTime.Time, session.EndTime.Valid = end, true
+			sessions = append(sessions, session)
+		}
+	}
+
+	// The most recent completed sessions get a recording to play back
+	hosts := make(map[uuid.UUID]string, len(data.targets))
+	for _, target := range data.targets {
+		hosts[target.ID] = target.Name
+	}
+	recorded := 0
+	for i := len(sessions) - 1; i >= 0 && recorded < recordedSessions; i-- {
+		session := sessions[i]
+		if session.SessionStatus != models.SessionStatusCompleted {
+			continue
+		}
+		location, err := s.record(ctx, session, hosts[session.TargetID])
+		if err != nil {
+			return err
+		}
+		session.RecordingPath = &location
+		recorded++
+		data.summary.Recordings++
+	}
+
+	for _, session := range sessions {
+		if _, err := s.stores.Audit.Import(ctx, session); err != nil {
+			return fmt.Errorf("failed to create demo session: %w", err)
+		}
+		if err := s.stores.Records.Mark(ctx, "audit_logs", session.ID); err != nil {
+			return err
+		}
+		data.summary.Sessions++
+	}
+	return nil
+}
+
+// record writes and catalogs the sample recording of session to host,
+// returning its location
+func (s *Seeder) record(ctx context.Context, session *models.AuditLog, host string) (string, error) {
+	ext, content, timing := "guac", rdpRecording(session), ""
+	if session.Protocol == models.ProtocolSSH {
+		ext = "log"
+		content, timing = sshRecording(session, host)
+	}
+	name := fmt.Sprintf("%s-%s.%s", session.ID, session.StartTime.Local().Format("20060102-150405"), ext)
+
+	file, err := recordings.Create(ctx, s.storage, name)
+	if err != nil {
+		return "", fmt.Errorf("failed to create demo recording: %w", err)
+	}
+	if _, err := file.WriteString(content); err != nil {
+		file.Close()
+		return "", fmt.Errorf("failed to write demo recording: %w", err)
+	}
+	if err := file.Close(); err != nil {
+		return "", fmt.Errorf("failed to write demo recording: %w", err)
+	}
+
+	if timing != "" {
+		upload, err := s.storage.Create(ctx, strings.TrimSuffix(name, ".log")+".timing")
+		if err != nil {
+			return "", fmt.Errorf("failed to create demo recording: %w", err)
+		}
+		if _, err := upload.Write([]byte(timing)); err != nil {
+			upload.Abort()
+			return "", fmt.Errorf("failed to write demo recording: %w", err)
+		}
+		if err := upload.Close(); err != nil {
+			return "", fmt.Errorf("failed to write demo recording: %w", err)
+		}
+	}
+
+	rec, err := file.Describe()
+	if err != nil {
+		return "", err
+	}
+	if err := s.stores.Recordings.Upsert(ctx, rec); err != nil {
+		return "", err
+	}
+	if err := s.stores.Records.Mark(ctx, "recordings", rec.ID); err != nil {
+		return "", err
+	}
+	return file.Location(), nil
+}
+
+// splitAddress splits a host:port address
+func splitAddress(address string) (string, int, error) {
+	host, portStr, err := net.SplitHostPort(address)
+	if err != nil {
+		return "", 0, fmt.Errorf("invalid address %q: %w", address, err)
+	}
+	port, err := strconv.Atoi(portStr)
+	if err != nil || host == "" {
+		return "", 0, fmt.Errorf("invalid address %q", address)
+	}
+	return host, port, nil
+}
@@ -0,0 +1,161 @@
+package demo
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/VanCannon/openpam/gateway/internal/models"
+	"github.com/VanCannon/openpam/gateway/internal/recordings"
+	"github.com/VanCannon/openpam/gateway/internal/transcript"
+	"github.com/google/uuid"
+)
+
+// fakeDB stands in for every store, keeping the demo records by table
+type fakeDB struct {
+	records    map[string][]uuid.UUID
+	sessions   []*models.AuditLog
+	recordings []*models.Recording
+}
+
+func newFakeDB() *fakeDB {
+	return &fakeDB{records: make(map[string][]uuid.UUID)}
+}
+
+func (f *fakeDB) stores() Stores {
+	return Stores{
+		Zones:       createFunc[models.Zone](func(z *models.Zone) { z.ID = uuid.New() }),
+		Targets:     createFunc[models.Target](func(t *models.Target) { t.ID = uuid.New() }),
+		Credentials: createFunc[models.Credential](func(c *models.Credential) { c.ID = uuid.New() }),
+		Users:       createFunc[models.User](func(u *models.User) { u.ID = uuid.New() }),
+		Schedules:   createFunc[models.Schedule](func(*models.Schedule) {}),
+		Audit:       f,
+		Recordings:  f,
+		Records:     f,
+	}
+}
+
+// createFunc is a store whose Create gives the row an ID
+type createFunc[T any] func(*T)
+
+func (c createFunc[T]) Create(ctx context.Context, row *T) error {
+	c(row)
+	return nil
+}
+
+func (f *fakeDB) Import(ctx context.Context, log *models.AuditLog) (bool, error) {
+	f.sessions = append(f.sessions, log)
+	return true, nil
+}
+
+func (f *fakeDB) Upsert(ctx context.Context, rec *models.Recording) error {
+	rec.ID = uuid.New()
+	f.recordings = append(f.recordings, rec)
+	return nil
+}
+
+func (f *fakeDB) Mark(ctx context.Context, table string, id uuid.UUID) error {
+	f.records[table] = append(f.records[table], id)
+	return nil
+}
+
+func (f *fakeDB) IDs(ctx context.Context, table string) ([]uuid.UUID, error) {
+	return f.records[table], nil
+}
+
+func (f *fakeDB) Count(ctx context.Context) (int, error) {
+	n := 0
+	for _, ids := range f.records {
+		n += len(ids)
+	}
+	return n, nil
+}
+
+func (f *fakeDB) Remove(ctx context.Context) (map[string]int64, error) {
+	removed := make(map[string]int64)
+	for table, ids := range f.records {
+		removed[table] = int64(len(ids))
+	}
+	f.records = make(map[string][]uuid.UUID)
+	return removed, nil
+}
+
+func TestSeeder(t *testing.T) {
+	ctx := context.Background()
+	storage, err := recordings.NewLocal(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	db := newFakeDB()
+	seeder := New(db.stores(), storage, Config{
+		SSHAddress: "127.0.0.1:2201",
+		RDPAddress: "openpam-demo-rdp:3389",
+		Username:   "demo",
+		Password:   "demo",
+	})
+	seeder.now = func() time.Time { return time.Date(2026, 3, 2, 12, 0, 0, 0, time.UTC) }
+
+	summary, err := seeder.Seed(ctx)
+	if err != nil {
+		t.Fatalf("Seed() error = %v", err)
+	}
+	if summary.Zones != 2 || summary.Targets != 5 || summary.Users != len(demoUsers) || summary.Schedules != 6 ||
+		summary.Recordings != recordedSessions || summary.Sessions < 20 {
+		t.Errorf("Seed() = %+v", summary)
+	}
+	for table, want := range map[string]int{
+		"zones":       summary.Zones,
+		"targets":     summary.Targets,
+		"credentials": summary.Targets,
+		"users":       summary.Users,
+		"schedules":   summary.Schedules,
+		"audit_logs":  summary.Sessions,
+		"recordings":  summary.Recordings,
+	} {
+		if got := len(db.records[table]); got != want {
+			t.Errorf("%d %s marked as demo data, want %d", got, table, want)
+		}
+	}
+
+	// Sessions are history, and the recordings play back
+	for _, session := range db.sessions {
+		if !session.EndTime.Valid || !session.StartTime.Before(seeder.now()) {
+			t.Errorf("session %s is not in the past", session.ID)
+		}
+	}
+	for _, rec := range db.recordings {
+		if rec.DurationMs == 0 {
+			t.Errorf("recording %s has no duration", rec.Location)
+		}
+		if rec.Format != models.RecordingFormatSSH {
+			continue
+		}
+		name := filepath.Base(rec.Location)
+		data, _ := fs.ReadFile(storage, name)
+		timing, _ := fs.ReadFile(storage, strings.TrimSuffix(name, ".log")+".timing")
+		tr, err := transcript.Render(data, timing)
+		if err != nil || !tr.Timed || len(tr.Lines) == 0 {
+			t.Errorf("transcript of %s = %+v, %v", name, tr, err)
+		}
+	}
+
+	if _, err := seeder.Seed(ctx); !errors.Is(err, ErrSeeded) {
+		t.Errorf("second Seed() error = %v, want ErrSeeded", err)
+	}
+
+	// Removing takes the recordings along
+	removed, err := seeder.Remove(ctx)
+	if err != nil {
+		t.Fatalf("Remove() error = %v", err)
+	}
+	if removed["audit_logs"] != int64(summary.Sessions) {
+		t.Errorf("Remove() = %v", removed)
+	}
+	if entries, _ := storage.ReadDir("."); len(entries) != 0 {
+		t.Errorf("%d recording files left after Remove()", len(entries))
+	}
+}
@@ -0,0 +1,99 @@
+package demo
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/VanCannon/openpam/gateway/internal/models"
+)
+
+// sshCommands is the shell session of the SSH sample recordings: each command
+// with its output
+var sshCommands = []struct{ command, output string }{
+	{"uptime", " 10:42:07 up 41 days,  3:12,  1 user,  load average: 0.08, 0.12, 0.09"},
+	{"df -h /var", "Filesystem      Size  Used Avail Use% Mounted on\r\n/dev/sda2        40G   37G  3.0G  93% /var"},
+	{"sudo journalctl --vacuum-time=14d", "Vacuuming done, freed 2.1G of archived journals from /var/log/journal."},
+	{"df -h /var", "Filesystem      Size  Used Avail Use% Mounted on\r\n/dev/sda2        40G   35G  5.1G  88% /var"},
+	{"sudo systemctl restart nginx", ""},
+	{"systemctl is-active nginx", "active"},
+	{"exit", "logout"},
+}
+
+// sshRecording renders an SSH recording of session to host in the recorder's
+// format, with its timing file
+func sshRecording(session *models.AuditLog, host string) (string, string) {
+	var body, timing strings.Builder
+	prompt := "demo@" + host + ":~$ "
+	offset := 500 * time.Millisecond
+
+	write := func(s string) {
+		body.WriteString(s)
+		fmt.Fprintf(&timing, "%d %d\n", offset.Milliseconds(), len(s))
+	}
+	write(prompt)
+	for _, c := range sshCommands {
+		// Typed a key at a time
+		for _, key := range c.command {
+			offset += 120 * time.Millisecond
+			write(string(key))
+		}
+		offset += 300 * time.Millisecond
+		write("\r\n")
+		if c.output != "" {
+			offset += 700 * time.Millisecond
+			write(c.output + "\r\n")
+		}
+		if c.command != "exit" {
+			write(prompt)
+		}
+		offset += 2 * time.Second
+	}
+
+	end := session.StartTime.Add(offset)
+	var recording strings.Builder
+	recording.WriteString("=== SSH Session Recording ===\n")
+	recording.WriteString("Session ID: " + session.ID.String() + "\n")
+	recording.WriteString("Start Time: " + session.StartTime.Format(time.RFC3339) + "\n")
+	recording.WriteString("=============================\n\n")
+	recording.WriteString(body.String())
+	recording.WriteString("\n=============================\n")
+	recording.WriteString("End Time: " + end.Format(time.RFC3339) + "\n")
+	recording.WriteString("Duration: " + offset.String() + "\n")
+	recording.WriteString("=============================\n")
+	return recording.String(), timing.String()
+}
+
+// rdpRecording renders a Guacamole recording of session: a desktop that
+// opens a window, one frame a second
+func rdpRecording(session *models.AuditLog) string {
+	var sb strings.Builder
+	instruction := func(ms int64, opcode string, args ...string) {
+		fmt.Fprintf(&sb, "%d,%d.%s", ms, len(opcode), opcode)
+		for _, arg := range args {
+			fmt.Fprintf(&sb, ",%d.%s", len(arg), arg)
+		}
+		sb.WriteString(";\n")
+	}
+	rect := func(ms int64, x, y, w, h int, r, g, b int) {
+		instruction(ms, "rect", "0", fmt.Sprint(x), fmt.Sprint(y), fmt.Sprint(w), fmt.Sprint(h))
+		instruction(ms, "cfill", "14", "0", fmt.Sprint(r), fmt.Sprint(g), fmt.Sprint(b), "255")
+	}
+
+	instruction(0, "size", "0", "1024", "768")
+	rect(0, 0, 0, 1024, 768, 0, 120, 215) // Desktop
+	rect(0, 0, 728, 1024, 40, 32, 32, 32) // Taskbar
+	instruction(0, "sync", "0")
+
+	for i := int64(1); i <= 30; i++ {
+		ms := i * 1000
+		// A window slides open, then a progress bar fills
+		width := min(int(i)*60, 600)
+		rect(ms, 212, 184, width, 400, 240, 240, 240)
+		if i > 10 {
+			rect(ms, 262, 500, int(i-10)*25, 24, 16, 124, 16)
+		}
+		instruction(ms, "sync", fmt.Sprint(session.StartTime.Add(time.Duration(ms)*time.Millisecond).UnixMilli()))
+	}
+	return sb.String()
+}
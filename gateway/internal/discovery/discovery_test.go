@@ -0,0 +1,751 @@
+package discovery
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/VanCannon/openpam/gateway/internal/models"
+	"github.com/VanCannon/openpam/gateway/internal/notify"
+	"github.com/VanCannon/openpam/gateway/internal/task"
+	"github.com/VanCannon/openpam/gateway/internal/vault"
+	"github.com/VanCannon/openpam/pkg/logger"
+	"github.com/google/uuid"
+	"golang.org/x/crypto/ssh"
+)
+
+func testKey(t *testing.T) (string, string) {
+	t.Helper()
+	pub, _, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := ssh.NewPublicKey(pub)
+	if err != nil {
+		t.Fatal(err)
+	}
+	line := strings.TrimSpace(string(ssh.MarshalAuthorizedKey(key)))
+	return line, ssh.FingerprintSHA256(key)
+}
+
+func findAccount(t *testing.T, accounts []*models.DiscoveredAccount, name string) *models.DiscoveredAccount {
+	t.Helper()
+	for _, a := range accounts {
+		if a.Username == name {
+			return a
+		}
+	}
+	t.Fatalf("account %s not found", name)
+	return nil
+}
+
+func TestParseLinux(t *testing.T) {
+	key, fingerprint := testKey(t)
+
+	output := strings.Join([]string{
+		"#openpam:passwd",
+		"root:x:0:0:root:/root:/bin/bash",
+		"daemon:x:1:1:daemon:/usr/sbin:/usr/sbin/nologin",
+		"alice:x:1000:1000:Alice:/home/alice:/bin/bash",
+		"bob:x:1001:1001:Bob:/home/bob:/bin/zsh",
+		"carol:x:1002:1002:Carol:/home/carol:/bin/bash",
+		"deploy:x:1003:27:Deploy:/home/deploy:/bin/sh",
+		"#openpam:group",
+		"root:x:0:",
+		"sudo:x:27:alice",
+		"ops:x:1100:carol",
+		"#openpam:sudoers /etc/sudoers",
+		"# User privilege specification",
+		"Defaults\tenv_reset",
+		"User_Alias ADMINS = bob, \\",
+		"  nobody",
+		"root\tALL=(ALL:ALL) ALL",
+		"ADMINS ALL=(ALL) NOPASSWD: ALL",
+		"#includedir /etc/sudoers.d",
+		"#openpam:sudoers /etc/sudoers.d/ops",
+		"%ops ALL=(root) /usr/bin/systemctl",
+		"#openpam:warning cannot read /home/carol/.ssh/authorized_keys",
+		"#openpam:keys alice /home/alice/.ssh/authorized_keys",
+		`from="10.0.0.0/8",no-pty ` + key + " alice@laptop",
+		"# a comment",
+		"not a key",
+	}, "\n")
+
+	accounts, warnings := parseLinux(output)
+
+	if len(accounts) != 6 {
+		t.Fatalf("got %d accounts, want 6", len(accounts))
+	}
+	if len(warnings) != 1 || !strings.Contains(warnings[0], "carol") {
+		t.Errorf("warnings = %v", warnings)
+	}
+
+	root := findAccount(t, accounts, "root")
+	if !root.Privileged || root.PrivilegeReasons[0] != "uid 0" || root.SystemAccount {
+		t.Errorf("root = %+v", root)
+	}
+
+	daemon := findAccount(t, accounts, "daemon")
+	if daemon.Privileged || !daemon.SystemAccount || daemon.LoginEnabled {
+		t.Errorf("daemon = %+v", daemon)
+	}
+
+	alice := findAccount(t, accounts, "alice")
+	if !alice.Privileged || alice.PrivilegeReasons[0] != "member of sudo" {
+		t.Errorf("alice = %+v", alice)
+	}
+	if len(alice.AuthorizedKeys) != 1 {
+		t.Fatalf("alice has %d keys, want 1", len(alice.AuthorizedKeys))
+	}
+	if k := alice.AuthorizedKeys[0]; k.Type != "ssh-ed25519" || k.Fingerprint != fingerprint || k.Comment != "alice@laptop" || !strings.Contains(k.Options, "no-pty") {
+		t.Errorf("alice's key = %+v", k)
+	}
+
+	bob := findAccount(t, accounts, "bob")
+	if !bob.Privileged || len(bob.SudoRules) != 1 || !strings.HasPrefix(bob.SudoRules[0], "ADMINS ") {
+		t.Errorf("bob = %+v", bob)
+	}
+
+	carol := findAccount(t, accounts, "carol")
+	if !carol.Privileged || len(carol.SudoRules) != 1 || !strings.HasPrefix(carol.SudoRules[0], "%ops ") {
+		t.Errorf("carol = %+v", carol)
+	}
+
+	// Primary group 27 is sudo
+	deploy := findAccount(t, accounts, "deploy")
+	if !deploy.Privileged || deploy.Groups[0] != "sudo" {
+		t.Errorf("deploy = %+v", deploy)
+	}
+}
+
+func TestParseWindows(t *testing.T) {
+	const domain = "S-1-5-21-1111-2222-3333"
+	output := strings.Join([]string{
+		"U\tAdministrator\t" + domain + "-500\tFalse\t",
+		"U\tGuest\t" + domain + "-501\tFalse\t",
+		"U\tsvc_backup\t" + domain + "-1001\tTrue\t2024-03-01T10:00:00Z",
+		"U\tjdoe\t" + domain + "-1002\tTrue\t",
+		"G\tAdministrators\tS-1-5-32-544\t" + domain + "-500",
+		"G\tAdministrators\tS-1-5-32-544\tS-1-5-21-9999-8888-7777-512",
+		"G\tBackup Operators\tS-1-5-32-551\t" + domain + "-1001",
+		"G\tUsers\tS-1-5-32-545\t" + domain + "-1002",
+		"#openpam:warning cannot list members of Remote Desktop Users",
+	}, "\r\n")
+
+	accounts, warnings := parseWindows(output)
+
+	if len(accounts) != 4 {
+		t.Fatalf("got %d accounts, want 4", len(accounts))
+	}
+	if len(warnings) != 1 {
+		t.Errorf("warnings = %v", warnings)
+	}
+
+	admin := findAccount(t, accounts, "Administrator")
+	if !admin.Privileged || admin.LoginEnabled || len(admin.PrivilegeReasons) != 2 {
+		t.Errorf("Administrator = %+v", admin)
+	}
+
+	guest := findAccount(t, accounts, "Guest")
+	if guest.Privileged || !guest.SystemAccount {
+		t.Errorf("Guest = %+v", guest)
+	}
+
+	backup := findAccount(t, accounts, "svc_backup")
+	if !backup.Privileged || backup.LastLogon == nil || backup.LastLogon.Year() != 2024 {
+		t.Errorf("svc_backup = %+v", backup)
+	}
+
+	jdoe := findAccount(t, accounts, "jdoe")
+	if jdoe.Privileged || len(jdoe.Groups) != 1 || jdoe.Groups[0] != "Users" {
+		t.Errorf("jdoe = %+v", jdoe)
+	}
+}
+
+func TestGeneratePassword(t *testing.T) {
+	for i := 0; i < 50; i++ {
+		password, err := generatePassword(20)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(password) != 20 {
+			t.Fatalf("password %q has length %d", password, len(password))
+		}
+		if _, err := task.CmdQuote(password); err != nil {
+			t.Fatalf("password %q can't be used on Windows: %v", password, err)
+		}
+		if strings.ContainsAny(password, "'\":\\$`") {
+			t.Fatalf("password %q has a character a shell or chpasswd interprets", password)
+		}
+	}
+}
+
+func TestPasswordCommand(t *testing.T) {
+	tests := []struct {
+		protocol, admin, want string
+	}{
+		{models.ProtocolSSH, "root", `printf '%s\n' 'svc:pw-1' | chpasswd`},
+		{models.ProtocolSSH, "ops", `printf '%s\n' 'svc:pw-1' | sudo -n chpasswd`},
+		{models.ProtocolRDP, "Administrator", `net user "svc" "pw-1"`},
+	}
+	for _, tt := range tests {
+		got, err := passwordCommand(tt.protocol, tt.admin, "svc", "pw-1")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != tt.want {
+			t.Errorf("passwordCommand(%s, %s) = %q, want %q", tt.protocol, tt.admin, got, tt.want)
+		}
+	}
+
+	if _, err := passwordCommand(models.ProtocolRDP, "Administrator", `svc" & whoami`, "pw"); err == nil {
+		t.Error("expected a username with cmd.exe metacharacters to be rejected")
+	}
+}
+
+// fakeStore is a Store holding a single account
+type fakeStore struct {
+	Store
+	account *models.DiscoveredAccount
+	rotated bool
+}
+
+func (f *fakeStore) GetAccount(ctx context.Context, id uuid.UUID) (*models.DiscoveredAccount, error) {
+	a := *f.account
+	return &a, nil
+}
+
+func (f *fakeStore) SetRotated(ctx context.Context, id, credentialID uuid.UUID) error {
+	f.account.CredentialID = &credentialID
+	f.rotated = true
+	return nil
+}
+
+type fakeTargets struct{ target *models.Target }
+
+func (f fakeTargets) GetByID(ctx context.Context, id uuid.UUID) (*models.Target, error) {
+	return f.target, nil
+}
+
+// fakeCredentials holds the target's admin credential and any created ones
+type fakeCredentials struct {
+	creds []*models.Credential
+}
+
+func (f *fakeCredentials) GetByID(ctx context.Context, id uuid.UUID) (*models.Credential, error) {
+	for _, c := range f.creds {
+		if c.ID == id {
+			return c, nil
+		}
+	}
+	return nil, fmt.Errorf("credential not found")
+}
+
+func (f *fakeCredentials) GetByTargetID(ctx context.Context, targetID uuid.UUID) ([]*models.Credential, error) {
+	return f.creds, nil
+}
+
+func (f *fakeCredentials) Create(ctx context.Context, cred *models.Credential) error {
+	cred.ID = uuid.New()
+	f.creds = append(f.creds, cred)
+	return nil
+}
+
+func (f *fakeCredentials) Update(ctx context.Context, cred *models.Credential) error {
+	return nil
+}
+
+func (f *fakeCredentials) Delete(ctx context.Context, id uuid.UUID) error {
+	for i, c := range f.creds {
+		if c.ID == id {
+			f.creds = append(f.creds[:i], f.creds[i+1:]...)
+			return nil
+		}
+	}
+	return fmt.Errorf("credential not found")
+}
+
+type fakeSecrets map[string]vault.Credentials
+
+func (f fakeSecrets) GetCredentials(ctx context.Context, path string) (*vault.Credentials, error) {
+	c, ok := f[path]
+	if !ok {
+		return nil, fmt.Errorf("secret not found at path: %s", path)
+	}
+	return &c, nil
+}
+
+func (f fakeSecrets) PutCredentials(ctx context.Context, path string, creds *vault.Credentials) error {
+	f[path] = *creds
+	return nil
+}
+
+// fakeRunner records commands and fails them with exitCode. Commands print
+// output, or a refusal if it is empty.
+type fakeRunner struct {
+	commands []string
+	as       []string
+	exitCode int
+	output   string
+}
+
+func (f *fakeRunner) Run(ctx context.Context, target *models.Target, creds *vault.Credentials, command string, timeout time.Duration) (*task.Result, error) {
+	f.commands = append(f.commands, command)
+	f.as = append(f.as, creds.Username)
+	output := f.output
+	if output == "" {
+		output = "chpasswd: permission denied"
+	}
+	return &task.Result{ExitCode: f.exitCode, Output: output}, nil
+}
+
+// fakeKeys is a KeyStore keeping keys and open drift in memory
+type fakeKeys struct {
+	KeyStore
+	keys  []*models.SSHKey
+	drift []*models.SSHKeyDrift
+}
+
+func (f *fakeKeys) CreateKey(ctx context.Context, key *models.SSHKey) error {
+	key.ID = uuid.New()
+	key.Status = models.SSHKeyActive
+	f.keys = append(f.keys, key)
+	return nil
+}
+
+func (f *fakeKeys) ListActiveKeys(ctx context.Context, targetID uuid.UUID) ([]*models.SSHKey, error) {
+	var active []*models.SSHKey
+	for _, k := range f.keys {
+		if k.Status == models.SSHKeyActive {
+			active = append(active, k)
+		}
+	}
+	return active, nil
+}
+
+func (f *fakeKeys) OpenDrift(ctx context.Context, drift *models.SSHKeyDrift) (bool, error) {
+	for _, d := range f.drift {
+		if d.Username == drift.Username && d.Fingerprint == drift.Fingerprint && d.Kind == drift.Kind {
+			d.ScanID = drift.ScanID
+			return false, nil
+		}
+	}
+	f.drift = append(f.drift, drift)
+	return true, nil
+}
+
+func (f *fakeKeys) ClearDrift(ctx context.Context, targetID, scanID uuid.UUID, unread []string) (int64, error) {
+	var open []*models.SSHKeyDrift
+	for _, d := range f.drift {
+		if *d.ScanID == scanID || contains(unread, d.Username) {
+			open = append(open, d)
+		}
+	}
+	cleared := len(f.drift) - len(open)
+	f.drift = open
+	return int64(cleared), nil
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// fakeLAPS is a LAPSStore holding enrolled machines in memory
+type fakeLAPS struct {
+	LAPSStore
+	machines  map[uuid.UUID]*models.LAPSMachine
+	failures  []string
+	retrieved []*time.Time
+}
+
+func (f *fakeLAPS) Enroll(ctx context.Context, machine *models.LAPSMachine) error {
+	m := *machine
+	m.Enabled = true
+	f.machines[m.TargetID] = &m
+	return nil
+}
+
+func (f *fakeLAPS) GetMachine(ctx context.Context, targetID uuid.UUID) (*models.LAPSMachine, error) {
+	m, ok := f.machines[targetID]
+	if !ok {
+		return nil, fmt.Errorf("LAPS machine not found")
+	}
+	c := *m
+	return &c, nil
+}
+
+func (f *fakeLAPS) RecordRotation(ctx context.Context, targetID uuid.UUID, accountName string, credentialID *uuid.UUID, next time.Time) error {
+	m := f.machines[targetID]
+	m.AccountName = accountName
+	m.NextRotationAt = next
+	return nil
+}
+
+func (f *fakeLAPS) RecordFailure(ctx context.Context, targetID uuid.UUID, message string) error {
+	f.failures = append(f.failures, message)
+	return nil
+}
+
+func (f *fakeLAPS) RecordRetrieval(ctx context.Context, targetID uuid.UUID, rotateBy *time.Time) error {
+	f.retrieved = append(f.retrieved, rotateBy)
+	return nil
+}
+
+type fakeNotifier struct{ sent []*notify.Message }
+
+func (f *fakeNotifier) Send(ctx context.Context, msg *notify.Message) error {
+	f.sent = append(f.sent, msg)
+	return nil
+}
+
+type fakeAudit struct{ events []string }
+
+func (f *fakeAudit) CreateSimple(ctx context.Context, eventType string, userID *uuid.UUID, action string, status string, ipAddress *string, details map[string]interface{}) error {
+	f.events = append(f.events, eventType+":"+status)
+	return nil
+}
+
+func newTestScanner(account *models.DiscoveredAccount, runner *fakeRunner) (*Scanner, *fakeStore, *fakeCredentials, fakeSecrets, *fakeAudit) {
+	target := &models.Target{ID: account.TargetID, Name: "web-1", Protocol: models.ProtocolSSH}
+	admin := &models.Credential{ID: uuid.New(), TargetID: target.ID, Username: "root", VaultSecretPath: "secret/data/web-1/root", IsDefault: true}
+
+	store := &fakeStore{account: account}
+	creds := &fakeCredentials{creds: []*models.Credential{admin}}
+	secrets := fakeSecrets{admin.VaultSecretPath: {Username: "root", Password: "admin-pw"}}
+	audit := &fakeAudit{}
+
+	cfg := Config{
+		ScanTimeout:     time.Minute,
+		VaultPath:       "secret/data/discovered/",
+		PasswordLength:  24,
+		KeyVaultPath:    "secret/data/ssh-keys",
+		AlertRecipients: []string{"secops@example.com"},
+		LAPSRotateEvery: 30 * 24 * time.Hour,
+		LAPSVaultPath:   "secret/data/laps",
+	}
+	laps := &fakeLAPS{machines: make(map[uuid.UUID]*models.LAPSMachine)}
+	s := NewScanner(cfg, store, &fakeKeys{}, laps, fakeTargets{target}, creds, secrets, runner, nil, audit, &fakeNotifier{}, logger.New(logger.LevelError, io.Discard))
+	return s, store, creds, secrets, audit
+}
+
+func TestOnboard(t *testing.T) {
+	account := &models.DiscoveredAccount{ID: uuid.New(), TargetID: uuid.New(), Username: "svc_app", Privileged: true}
+	runner := &fakeRunner{}
+	s, store, creds, secrets, audit := newTestScanner(account, runner)
+
+	cred, err := s.Onboard(context.Background(), account.ID, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	wantPath := "secret/data/discovered/" + account.TargetID.String() + "/svc_app"
+	if cred.VaultSecretPath != wantPath || !cred.HasTag(models.CredentialTagDiscovered) || len(creds.creds) != 2 {
+		t.Errorf("credential = %+v", cred)
+	}
+	stored, ok := secrets[wantPath]
+	if !ok || stored.Username != "svc_app" || len(stored.Password) != 24 {
+		t.Fatalf("stored secret = %+v", stored)
+	}
+	if len(runner.commands) != 1 || !strings.Contains(runner.commands[0], "svc_app:"+stored.Password) || runner.as[0] != "root" {
+		t.Errorf("commands = %v as %v", runner.commands, runner.as)
+	}
+	if !store.rotated || *store.account.CredentialID != cred.ID {
+		t.Error("account was not linked to the new credential")
+	}
+	if len(audit.events) != 1 || audit.events[0] != models.EventTypeAccountOnboarded+":success" {
+		t.Errorf("audit events = %v", audit.events)
+	}
+
+	if _, err := s.Onboard(context.Background(), account.ID, nil, nil); err != ErrAlreadyManaged {
+		t.Errorf("second onboarding: err = %v, want ErrAlreadyManaged", err)
+	}
+}
+
+func TestRotate_RestoresVaultWhenTargetRefuses(t *testing.T) {
+	account := &models.DiscoveredAccount{ID: uuid.New(), TargetID: uuid.New(), Username: "svc_app"}
+	runner := &fakeRunner{}
+	s, _, _, secrets, audit := newTestScanner(account, runner)
+
+	cred, err := s.Onboard(context.Background(), account.ID, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	onboarded := secrets[cred.VaultSecretPath]
+
+	runner.exitCode = 1
+	if _, err := s.Rotate(context.Background(), account.ID, nil, nil); err == nil || !strings.Contains(err.Error(), "permission denied") {
+		t.Fatalf("err = %v, want the target's refusal", err)
+	}
+	if secrets[cred.VaultSecretPath] != onboarded {
+		t.Error("Vault was left with a password the target refused")
+	}
+	if audit.events[len(audit.events)-1] != models.EventTypeAccountRotated+":failure" {
+		t.Errorf("audit events = %v", audit.events)
+	}
+
+	runner.exitCode = 0
+	if _, err := s.Rotate(context.Background(), account.ID, nil, nil); err != nil {
+		t.Fatal(err)
+	}
+	if secrets[cred.VaultSecretPath] == onboarded {
+		t.Error("password was not rotated")
+	}
+}
+
+func TestRotate_RefusesCredentialsNotOnboarded(t *testing.T) {
+	account := &models.DiscoveredAccount{ID: uuid.New(), TargetID: uuid.New(), Username: "root"}
+	s, store, creds, _, _ := newTestScanner(account, &fakeRunner{})
+
+	// root is managed by the hand-made admin credential
+	store.account.CredentialID = &creds.creds[0].ID
+	if _, err := s.Rotate(context.Background(), account.ID, nil, nil); err != ErrNotOnboarded {
+		t.Errorf("err = %v, want ErrNotOnboarded", err)
+	}
+}
+
+func TestKeyCommand(t *testing.T) {
+	key, _ := testKey(t)
+	blob := strings.Fields(key)[1]
+
+	got, err := keyCommand("root", addKeyScript, "alice", key+" openpam:alice", key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(got, "sh -c '") || !strings.HasSuffix(got, " 'openpam' 'alice' '"+key+" openpam:alice' '"+blob+"'") {
+		t.Errorf("keyCommand() = %q", got)
+	}
+
+	got, err = keyCommand("deploy", removeKeyScript, "alice", "", key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(got, "sudo -n sh -c '") {
+		t.Errorf("keyCommand() as a non-root admin = %q", got)
+	}
+
+	if _, err := keyCommand("root", addKeyScript, "alice", "", "garbage"); err == nil {
+		t.Error("expected an invalid public key to be rejected")
+	}
+}
+
+func TestDeployKey(t *testing.T) {
+	account := &models.DiscoveredAccount{ID: uuid.New(), TargetID: uuid.New(), Username: "alice"}
+	runner := &fakeRunner{}
+	s, _, creds, secrets, audit := newTestScanner(account, runner)
+	s.config.KeyFrom = "10.0.0.0/8"
+
+	key, err := s.DeployKey(context.Background(), account.TargetID, "alice", nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	wantPath := "secret/data/ssh-keys/" + account.TargetID.String() + "/alice"
+	stored, ok := secrets[wantPath]
+	if !ok || stored.Username != "alice" {
+		t.Fatalf("stored secret = %+v", stored)
+	}
+	signer, err := ssh.ParsePrivateKey([]byte(stored.PrivateKey))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ssh.FingerprintSHA256(signer.PublicKey()) != key.Fingerprint {
+		t.Error("stored private key does not match the deployed key")
+	}
+
+	cred, err := creds.GetByID(context.Background(), *key.CredentialID)
+	if err != nil || cred.VaultSecretPath != wantPath || !cred.HasTag(models.CredentialTagSSHKey) {
+		t.Errorf("credential = %+v, %v", cred, err)
+	}
+	if len(runner.commands) != 1 || !strings.Contains(runner.commands[0], `'from="10.0.0.0/8" `+key.PublicKey+" openpam:alice'") {
+		t.Errorf("commands = %v", runner.commands)
+	}
+	if len(audit.events) != 1 || audit.events[0] != models.EventTypeSSHKeyDeployed+":success" {
+		t.Errorf("audit events = %v", audit.events)
+	}
+
+	if _, err := s.DeployKey(context.Background(), account.TargetID, "alice", nil, nil); err != ErrKeyManaged {
+		t.Errorf("second deployment: err = %v, want ErrKeyManaged", err)
+	}
+}
+
+func TestCheckKeys(t *testing.T) {
+	tracked, trackedFingerprint := testKey(t)
+	rogue, rogueFingerprint := testKey(t)
+	gone, goneFingerprint := testKey(t)
+
+	account := &models.DiscoveredAccount{ID: uuid.New(), TargetID: uuid.New(), Username: "alice"}
+	s, _, _, _, audit := newTestScanner(account, &fakeRunner{})
+	keys := s.keys.(*fakeKeys)
+	notifier := s.notifier.(*fakeNotifier)
+	target := &models.Target{ID: account.TargetID, Name: "web-1", Protocol: models.ProtocolSSH}
+
+	for _, k := range []struct{ user, line, fingerprint string }{
+		{"alice", tracked, trackedFingerprint},
+		{"alice", gone, goneFingerprint},
+		{"carol", tracked, trackedFingerprint},
+	} {
+		keys.CreateKey(context.Background(), &models.SSHKey{
+			TargetID: target.ID, Username: k.user, PublicKey: k.line, Fingerprint: k.fingerprint, Source: models.SSHKeySourceApproved,
+		})
+	}
+
+	accounts := []*models.DiscoveredAccount{
+		{Username: "alice", Home: "/home/alice", AuthorizedKeys: models.AuthorizedKeys{
+			{Fingerprint: trackedFingerprint, Key: tracked},
+			{Fingerprint: rogueFingerprint, Key: rogue, Comment: "mallory@laptop"},
+		}},
+		// bob has keys, but none are tracked
+		{Username: "bob", Home: "/home/bob", AuthorizedKeys: models.AuthorizedKeys{{Fingerprint: rogueFingerprint, Key: rogue}}},
+		{Username: "carol", Home: "/home/carol"},
+	}
+	warnings := []string{"cannot read /home/carol/.ssh/authorized_keys"}
+
+	scan := &models.DiscoveryScan{ID: uuid.New()}
+	s.checkKeys(context.Background(), scan, target, accounts, warnings)
+
+	if len(keys.drift) != 2 {
+		t.Fatalf("drift = %+v, want 2", keys.drift)
+	}
+	for _, d := range keys.drift {
+		switch d.Kind {
+		case models.SSHKeyDriftUnauthorized:
+			if d.Username != "alice" || d.Fingerprint != rogueFingerprint || d.PublicKey != rogue {
+				t.Errorf("unauthorized drift = %+v", d)
+			}
+		case models.SSHKeyDriftMissing:
+			if d.Username != "alice" || d.Fingerprint != goneFingerprint || d.SSHKeyID == nil {
+				t.Errorf("missing drift = %+v", d)
+			}
+		}
+	}
+	if len(notifier.sent) != 1 || !strings.Contains(notifier.sent[0].Body, "mallory@laptop") {
+		t.Errorf("alerts = %+v", notifier.sent)
+	}
+	if len(audit.events) != 2 || audit.events[0] != models.EventTypeSSHKeyDrift+":failure" {
+		t.Errorf("audit events = %v", audit.events)
+	}
+
+	// Drift that is still there isn't alerted on again; drift that went away is cleared
+	accounts[0].AuthorizedKeys = accounts[0].AuthorizedKeys[:1]
+	s.checkKeys(context.Background(), &models.DiscoveryScan{ID: uuid.New()}, target, accounts, warnings)
+
+	if len(keys.drift) != 1 || keys.drift[0].Kind != models.SSHKeyDriftMissing {
+		t.Errorf("drift = %+v, want only the missing key", keys.drift)
+	}
+	if len(notifier.sent) != 1 {
+		t.Errorf("alerts = %d, want no new alert", len(notifier.sent))
+	}
+}
+
+func TestEnrollLAPS(t *testing.T) {
+	account := &models.DiscoveredAccount{ID: uuid.New(), TargetID: uuid.New(), Username: "admin"}
+	runner := &fakeRunner{output: "LocalAdmin\r\n"}
+	s, _, creds, secrets, audit := newTestScanner(account, runner)
+	s.targets.(fakeTargets).target.Protocol = models.ProtocolRDP
+
+	// An account onboarded by discovery is taken over
+	onboarded := &models.Credential{ID: uuid.New(), TargetID: account.TargetID, Username: "localadmin", Tags: []string{models.CredentialTagDiscovered, "tier0"}}
+	creds.creds = append(creds.creds, onboarded)
+
+	machine, err := s.EnrollLAPS(context.Background(), account.TargetID, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	wantPath := "secret/data/laps/" + account.TargetID.String()
+	if machine.AccountName != "LocalAdmin" || machine.VaultPath != wantPath || *machine.CredentialID != onboarded.ID {
+		t.Errorf("machine = %+v", machine)
+	}
+	if onboarded.VaultSecretPath != wantPath || onboarded.Username != "LocalAdmin" || onboarded.HasTag(models.CredentialTagDiscovered) ||
+		!onboarded.HasTag(models.CredentialTagLAPS) || !onboarded.HasTag("tier0") {
+		t.Errorf("credential = %+v", onboarded)
+	}
+	stored := secrets[wantPath]
+	if stored.Username != "LocalAdmin" || len(stored.Password) != 24 {
+		t.Errorf("stored secret = %+v", stored)
+	}
+	if len(runner.commands) != 2 || !strings.HasPrefix(runner.commands[1], "powershell ") || runner.as[1] != "root" {
+		t.Errorf("commands = %v as %v", runner.commands, runner.as)
+	}
+	if len(audit.events) != 1 || audit.events[0] != models.EventTypeLAPSEnrolled+":success" {
+		t.Errorf("audit events = %v", audit.events)
+	}
+}
+
+func TestRotateLAPS_RestoresVaultWhenTargetRefuses(t *testing.T) {
+	account := &models.DiscoveredAccount{ID: uuid.New(), TargetID: uuid.New()}
+	runner := &fakeRunner{output: "Administrator"}
+	s, _, _, secrets, _ := newTestScanner(account, runner)
+	s.targets.(fakeTargets).target.Protocol = models.ProtocolRDP
+	laps := s.laps.(*fakeLAPS)
+
+	machine, err := s.EnrollLAPS(context.Background(), account.TargetID, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	enrolled := secrets[machine.VaultPath]
+
+	runner.exitCode = 1
+	if _, err := s.RotateLAPS(context.Background(), account.TargetID, nil, nil); err == nil {
+		t.Fatal("expected the rotation to fail")
+	}
+	if secrets[machine.VaultPath] != enrolled {
+		t.Error("Vault was left with a password the target refused")
+	}
+	if len(laps.failures) != 1 {
+		t.Errorf("failures = %v", laps.failures)
+	}
+
+	// The account was renamed since enrollment
+	runner.exitCode, runner.output = 0, "Admin2"
+	rotated, err := s.RotateLAPS(context.Background(), account.TargetID, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if secrets[machine.VaultPath].Username != "Admin2" || secrets[machine.VaultPath].Password == enrolled.Password {
+		t.Errorf("stored secret = %+v", secrets[machine.VaultPath])
+	}
+	if rotated.AccountName != "Admin2" {
+		t.Errorf("account name = %q, want Admin2", rotated.AccountName)
+	}
+}
+
+func TestRetrieveLAPSPassword(t *testing.T) {
+	account := &models.DiscoveredAccount{ID: uuid.New(), TargetID: uuid.New()}
+	s, _, _, _, audit := newTestScanner(account, &fakeRunner{output: "Administrator"})
+	s.targets.(fakeTargets).target.Protocol = models.ProtocolRDP
+	s.config.LAPSRotateAfterRetrieval = 8 * time.Hour
+	laps := s.laps.(*fakeLAPS)
+
+	if _, err := s.EnrollLAPS(context.Background(), account.TargetID, nil, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := s.RetrieveLAPSPassword(context.Background(), account.TargetID, "  ", nil, nil); err != ErrReasonRequired {
+		t.Errorf("err = %v, want ErrReasonRequired", err)
+	}
+
+	password, err := s.RetrieveLAPSPassword(context.Background(), account.TargetID, "INC-1234 recovery", nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if password.AccountName != "Administrator" || password.Password == "" {
+		t.Errorf("password = %+v", password)
+	}
+	if time.Until(password.NextRotationAt) > 8*time.Hour || len(laps.retrieved) != 1 || laps.retrieved[0] == nil {
+		t.Errorf("rotation after retrieval was not scheduled: %v", password.NextRotationAt)
+	}
+	if audit.events[len(audit.events)-1] != models.EventTypeLAPSRetrieved+":success" {
+		t.Errorf("audit events = %v", audit.events)
+	}
+}
@@ -0,0 +1,678 @@
+package discovery
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/pem"
+	"errors"
+	"expvar"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/VanCannon/openpam/gateway/internal/models"
+	"github.com/VanCannon/openpam/gateway/internal/notify"
+	"github.com/VanCannon/openpam/gateway/internal/task"
+	"github.com/VanCannon/openpam/gateway/internal/vault"
+	"github.com/google/uuid"
+	"golang.org/x/crypto/ssh"
+)
+
+// Published at /api/v1/admin/metrics
+var (
+	keysDeployed = expvar.NewInt("ssh_keys_deployed")
+	keysRotated  = expvar.NewInt("ssh_keys_rotated")
+	keysRemoved  = expvar.NewInt("ssh_keys_removed")
+	driftFound   = expvar.NewInt("ssh_key_drift_found")
+)
+
+var (
+	// ErrNotSSH is returned when managing keys on a target that isn't an SSH target
+	ErrNotSSH = errors.New("SSH keys can only be managed on SSH targets")
+
+	// ErrKeyManaged is returned when deploying a key to an account that already has a managed key
+	ErrKeyManaged = errors.New("account already has a managed key; rotate it instead")
+
+	// ErrKeyNotManaged is returned when rotating a key OpenPAM didn't generate
+	ErrKeyNotManaged = errors.New("only managed keys can be rotated")
+
+	// ErrKeyRemoved is returned for keys that are no longer tracked
+	ErrKeyRemoved = errors.New("key was already removed")
+
+	// ErrDriftResolved is returned when acting on drift that was already resolved
+	ErrDriftResolved = errors.New("drift is already resolved")
+)
+
+// KeyStore is the subset of the SSH key repository the scanner needs
+type KeyStore interface {
+	CreateKey(ctx context.Context, key *models.SSHKey) error
+	ReplaceKey(ctx context.Context, oldID uuid.UUID, key *models.SSHKey) error
+	RemoveKey(ctx context.Context, id uuid.UUID) error
+	GetKey(ctx context.Context, id uuid.UUID) (*models.SSHKey, error)
+	ListActiveKeys(ctx context.Context, targetID uuid.UUID) ([]*models.SSHKey, error)
+	OpenDrift(ctx context.Context, drift *models.SSHKeyDrift) (bool, error)
+	ClearDrift(ctx context.Context, targetID, scanID uuid.UUID, unread []string) (int64, error)
+	GetDrift(ctx context.Context, id uuid.UUID) (*models.SSHKeyDrift, error)
+	ResolveDrift(ctx context.Context, id uuid.UUID, resolution string, resolvedBy *uuid.UUID) error
+}
+
+// DeployKey generates a key pair for an account on an SSH target, adds its
+// public key to the account's authorized_keys and stores the private key in
+// Vault behind a credential tagged "ssh-key", so the account can be logged in
+// to without a password. Like onboarding, this needs the target's default
+// credential to be root or to have passwordless sudo.
+func (s *Scanner) DeployKey(ctx context.Context, targetID uuid.UUID, username string, userID *uuid.UUID, ipAddress *string) (*models.SSHKey, error) {
+	target, err := s.targets.GetByID(ctx, targetID)
+	if err != nil {
+		return nil, err
+	}
+	if target.Protocol != models.ProtocolSSH {
+		return nil, ErrNotSSH
+	}
+
+	tracked, err := s.keys.ListActiveKeys(ctx, target.ID)
+	if err != nil {
+		return nil, err
+	}
+	for _, key := range tracked {
+		if key.Username == username && key.Source == models.SSHKeySourceManaged {
+			return nil, ErrKeyManaged
+		}
+	}
+
+	key, err := s.installKey(ctx, target, username)
+	if err != nil {
+		s.auditKey(ctx, models.EventTypeSSHKeyDeployed, "deploy_ssh_key", "failure", target, username, "", userID, ipAddress, err)
+		return nil, err
+	}
+	key.CreatedBy = userID
+
+	if err := s.keys.CreateKey(ctx, key); err != nil {
+		return nil, err
+	}
+
+	keysDeployed.Add(1)
+	s.auditKey(ctx, models.EventTypeSSHKeyDeployed, "deploy_ssh_key", "success", target, username, key.Fingerprint, userID, ipAddress, nil)
+
+	s.logger.Info("SSH key deployed", map[string]interface{}{
+		"key_id":      key.ID.String(),
+		"target":      target.Name,
+		"username":    username,
+		"fingerprint": key.Fingerprint,
+	})
+
+	key.TargetName = target.Name
+	return key, nil
+}
+
+// RotateKey replaces a managed key with a new one. The new key is added to the
+// target and stored in Vault before the old one is taken off the target, so
+// sessions can log in throughout.
+func (s *Scanner) RotateKey(ctx context.Context, keyID uuid.UUID, userID *uuid.UUID, ipAddress *string) (*models.SSHKey, error) {
+	old, err := s.keys.GetKey(ctx, keyID)
+	if err != nil {
+		return nil, err
+	}
+	if old.Status != models.SSHKeyActive {
+		return nil, ErrKeyRemoved
+	}
+	if old.Source != models.SSHKeySourceManaged {
+		return nil, ErrKeyNotManaged
+	}
+
+	target, err := s.targets.GetByID(ctx, old.TargetID)
+	if err != nil {
+		return nil, err
+	}
+
+	key, err := s.installKey(ctx, target, old.Username)
+	if err != nil {
+		s.auditKey(ctx, models.EventTypeSSHKeyRotated, "rotate_ssh_key", "failure", target, old.Username, old.Fingerprint, userID, ipAddress, err)
+		return nil, err
+	}
+	key.CreatedBy = userID
+
+	// The new key already works, so a leftover old key is reported as drift by
+	// the next scan rather than failing the rotation
+	if err := s.uninstallKey(ctx, target, old.Username, old.PublicKey); err != nil {
+		s.logger.Warn("Failed to remove rotated SSH key from target", map[string]interface{}{
+			"key_id":   old.ID.String(),
+			"target":   target.Name,
+			"username": old.Username,
+			"error":    err.Error(),
+		})
+	}
+
+	if err := s.keys.ReplaceKey(ctx, old.ID, key); err != nil {
+		return nil, err
+	}
+
+	keysRotated.Add(1)
+	s.auditKey(ctx, models.EventTypeSSHKeyRotated, "rotate_ssh_key", "success", target, old.Username, key.Fingerprint, userID, ipAddress, nil)
+
+	key.TargetName = target.Name
+	return key, nil
+}
+
+// RemoveKey takes a tracked key off the target and stops tracking it. The
+// credential holding a managed key's private key is deleted with it.
+func (s *Scanner) RemoveKey(ctx context.Context, keyID uuid.UUID, userID *uuid.UUID, ipAddress *string) error {
+	key, err := s.keys.GetKey(ctx, keyID)
+	if err != nil {
+		return err
+	}
+	if key.Status != models.SSHKeyActive {
+		return ErrKeyRemoved
+	}
+
+	target, err := s.targets.GetByID(ctx, key.TargetID)
+	if err != nil {
+		return err
+	}
+
+	if err := s.uninstallKey(ctx, target, key.Username, key.PublicKey); err != nil {
+		s.auditKey(ctx, models.EventTypeSSHKeyRemoved, "remove_ssh_key", "failure", target, key.Username, key.Fingerprint, userID, ipAddress, err)
+		return err
+	}
+	if err := s.keys.RemoveKey(ctx, key.ID); err != nil {
+		return err
+	}
+	if key.Source == models.SSHKeySourceManaged && key.CredentialID != nil {
+		if err := s.credentials.Delete(ctx, *key.CredentialID); err != nil {
+			s.logger.Error("Failed to delete SSH key credential", map[string]interface{}{
+				"credential_id": key.CredentialID.String(),
+				"error":         err.Error(),
+			})
+		}
+	}
+
+	keysRemoved.Add(1)
+	s.auditKey(ctx, models.EventTypeSSHKeyRemoved, "remove_ssh_key", "success", target, key.Username, key.Fingerprint, userID, ipAddress, nil)
+
+	return nil
+}
+
+// ApproveDrift accepts what a scan found on the target: an unauthorized key is
+// tracked as approved from then on, and a missing key is no longer tracked
+func (s *Scanner) ApproveDrift(ctx context.Context, driftID uuid.UUID, userID *uuid.UUID, ipAddress *string) (*models.SSHKeyDrift, error) {
+	drift, err := s.openDrift(ctx, driftID)
+	if err != nil {
+		return nil, err
+	}
+
+	switch drift.Kind {
+	case models.SSHKeyDriftUnauthorized:
+		key := &models.SSHKey{
+			TargetID:    drift.TargetID,
+			Username:    drift.Username,
+			KeyType:     drift.KeyType,
+			Fingerprint: drift.Fingerprint,
+			PublicKey:   drift.PublicKey,
+			Source:      models.SSHKeySourceApproved,
+			CreatedBy:   userID,
+		}
+		if err := s.keys.CreateKey(ctx, key); err != nil {
+			return nil, err
+		}
+	case models.SSHKeyDriftMissing:
+		if drift.SSHKeyID != nil {
+			if err := s.keys.RemoveKey(ctx, *drift.SSHKeyID); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return s.resolveDrift(ctx, drift, models.SSHKeyDriftApproved, models.EventTypeSSHKeyApproved, userID, ipAddress)
+}
+
+// RevertDrift restores what OpenPAM expects on the target: an unauthorized key
+// is removed from it, and a missing key is added back
+func (s *Scanner) RevertDrift(ctx context.Context, driftID uuid.UUID, userID *uuid.UUID, ipAddress *string) (*models.SSHKeyDrift, error) {
+	drift, err := s.openDrift(ctx, driftID)
+	if err != nil {
+		return nil, err
+	}
+
+	target, err := s.targets.GetByID(ctx, drift.TargetID)
+	if err != nil {
+		return nil, err
+	}
+
+	resolution, eventType := models.SSHKeyDriftRemoved, models.EventTypeSSHKeyRemoved
+	if drift.Kind == models.SSHKeyDriftMissing {
+		resolution, eventType = models.SSHKeyDriftRedeployed, models.EventTypeSSHKeyDeployed
+		line := drift.PublicKey
+		if drift.SSHKeyID != nil {
+			key, err := s.keys.GetKey(ctx, *drift.SSHKeyID)
+			if err != nil {
+				return nil, err
+			}
+			line = s.authorizedLine(key)
+		}
+		err = s.runKeyScript(ctx, target, addKeyScript, drift.Username, line, drift.PublicKey)
+	} else {
+		err = s.uninstallKey(ctx, target, drift.Username, drift.PublicKey)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return s.resolveDrift(ctx, drift, resolution, eventType, userID, ipAddress)
+}
+
+// openDrift loads drift that is still to be resolved
+func (s *Scanner) openDrift(ctx context.Context, id uuid.UUID) (*models.SSHKeyDrift, error) {
+	drift, err := s.keys.GetDrift(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if drift.ResolvedAt != nil {
+		return nil, ErrDriftResolved
+	}
+	return drift, nil
+}
+
+func (s *Scanner) resolveDrift(ctx context.Context, drift *models.SSHKeyDrift, resolution, eventType string, userID *uuid.UUID, ipAddress *string) (*models.SSHKeyDrift, error) {
+	if err := s.keys.ResolveDrift(ctx, drift.ID, resolution, userID); err != nil {
+		return nil, err
+	}
+
+	details := map[string]interface{}{
+		"drift_id":    drift.ID.String(),
+		"target_id":   drift.TargetID.String(),
+		"target":      drift.TargetName,
+		"username":    drift.Username,
+		"kind":        drift.Kind,
+		"fingerprint": drift.Fingerprint,
+		"resolution":  resolution,
+	}
+	if err := s.audit.CreateSimple(ctx, eventType, userID, "resolve_ssh_key_drift", "success", ipAddress, details); err != nil {
+		s.logger.Error("Failed to create system audit log", map[string]interface{}{
+			"error": err.Error(),
+		})
+	}
+
+	return s.keys.GetDrift(ctx, drift.ID)
+}
+
+// installKey generates a key pair, adds its public key to the account on the
+// target and stores its private key in Vault. The key is taken off the target
+// again if Vault can't be written, so no key is left that nobody holds.
+func (s *Scanner) installKey(ctx context.Context, target *models.Target, username string) (*models.SSHKey, error) {
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate key: %w", err)
+	}
+	publicKey, err := ssh.NewPublicKey(pub)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate key: %w", err)
+	}
+	block, err := ssh.MarshalPrivateKey(priv, "openpam@"+target.Name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode private key: %w", err)
+	}
+
+	key := &models.SSHKey{
+		TargetID:    target.ID,
+		Username:    username,
+		KeyType:     publicKey.Type(),
+		Fingerprint: ssh.FingerprintSHA256(publicKey),
+		PublicKey:   strings.TrimSpace(string(ssh.MarshalAuthorizedKey(publicKey))),
+		Source:      models.SSHKeySourceManaged,
+	}
+
+	if err := s.runKeyScript(ctx, target, addKeyScript, username, s.authorizedLine(key), key.PublicKey); err != nil {
+		return nil, err
+	}
+
+	path := s.keyVaultPath(target.ID, username)
+	secret := &vault.Credentials{Username: username, PrivateKey: string(pem.EncodeToMemory(block))}
+	if err := s.secrets.PutCredentials(ctx, path, secret); err != nil {
+		if removeErr := s.uninstallKey(context.Background(), target, username, key.PublicKey); removeErr != nil {
+			s.logger.Error("Failed to remove SSH key whose private key wasn't stored", map[string]interface{}{
+				"target":      target.Name,
+				"username":    username,
+				"fingerprint": key.Fingerprint,
+				"error":       removeErr.Error(),
+			})
+		}
+		return nil, fmt.Errorf("failed to store private key in Vault: %w", err)
+	}
+
+	cred, err := s.keyCredential(ctx, target, username, path)
+	if err != nil {
+		return nil, err
+	}
+	key.CredentialID = &cred.ID
+
+	return key, nil
+}
+
+// keyCredential returns the credential of the account's managed key, creating it if needed
+func (s *Scanner) keyCredential(ctx context.Context, target *models.Target, username, path string) (*models.Credential, error) {
+	creds, err := s.credentials.GetByTargetID(ctx, target.ID)
+	if err != nil {
+		return nil, err
+	}
+	for _, cred := range creds {
+		if cred.VaultSecretPath == path {
+			return cred, nil
+		}
+	}
+
+	cred := &models.Credential{
+		TargetID:        target.ID,
+		Username:        username,
+		VaultSecretPath: path,
+		Description:     "Managed SSH key",
+		Tags:            []string{models.CredentialTagSSHKey},
+	}
+	if err := s.credentials.Create(ctx, cred); err != nil {
+		return nil, err
+	}
+	return cred, nil
+}
+
+func (s *Scanner) uninstallKey(ctx context.Context, target *models.Target, username, publicKey string) error {
+	return s.runKeyScript(ctx, target, removeKeyScript, username, "", publicKey)
+}
+
+// authorizedLine returns the authorized_keys line a tracked key is deployed as
+func (s *Scanner) authorizedLine(key *models.SSHKey) string {
+	line := key.PublicKey
+	if key.Source == models.SSHKeySourceManaged {
+		line += " openpam:" + key.Username
+		if s.config.KeyFrom != "" {
+			line = `from="` + s.config.KeyFrom + `" ` + line
+		}
+	}
+	return line
+}
+
+// keyVaultPath returns where the private key of an account's managed key is stored
+func (s *Scanner) keyVaultPath(targetID uuid.UUID, username string) string {
+	return strings.TrimRight(s.config.KeyVaultPath, "/") + "/" + targetID.String() + "/" + username
+}
+
+// addKeyScript appends a line to an account's authorized_keys unless its key
+// is already there, creating the file with the modes sshd insists on
+const addKeyScript = `u=$1; line=$2; blob=$3
+h=$(getent passwd "$u" | cut -d: -f6)
+[ -n "$h" ] || { echo "no such user: $u" >&2; exit 2; }
+g=$(id -g "$u") || exit 1
+mkdir -p "$h/.ssh" && chown "$u:$g" "$h/.ssh" && chmod 700 "$h/.ssh" || exit 1
+f="$h/.ssh/authorized_keys"
+touch "$f" && chown "$u:$g" "$f" && chmod 600 "$f" || exit 1
+grep -qF "$blob" "$f" || printf "%s\n" "$line" >> "$f"
+`
+
+// removeKeyScript drops every line holding a key from an account's
+// authorized_keys files. The files are rewritten in place to keep their
+// owner and mode.
+const removeKeyScript = `u=$1; blob=$3
+h=$(getent passwd "$u" | cut -d: -f6)
+[ -n "$h" ] || exit 0
+for f in "$h/.ssh/authorized_keys" "$h/.ssh/authorized_keys2"; do
+	[ -f "$f" ] || continue
+	grep -vF "$blob" "$f" > "$f.openpam"
+	[ $? -le 1 ] || { rm -f "$f.openpam"; exit 1; }
+	cat "$f.openpam" > "$f" && rm -f "$f.openpam" || exit 1
+done
+`
+
+// runKeyScript runs a key script on the target with the target's default
+// credential, through sudo unless it logs in as root
+func (s *Scanner) runKeyScript(ctx context.Context, target *models.Target, script, username, line, publicKey string) error {
+	admin, err := s.loginCredential(ctx, target, nil)
+	if err != nil {
+		return err
+	}
+	adminCreds, err := s.resolve(ctx, admin)
+	if err != nil {
+		return fmt.Errorf("failed to retrieve credentials: %w", err)
+	}
+
+	command, err := keyCommand(adminCreds.Username, script, username, line, publicKey)
+	if err != nil {
+		return err
+	}
+
+	result, err := s.runner.Run(ctx, target, adminCreds, command, passwordTimeout)
+	if err == nil && result.ExitCode != 0 {
+		err = fmt.Errorf("authorized_keys update failed with exit code %d: %s", result.ExitCode, truncate(strings.TrimSpace(result.Output), 200))
+	}
+	return err
+}
+
+// keyCommand returns the command that runs a key script as root. Only the key
+// blob, without its type, is matched, since the same key may carry other
+// options or comments in the file.
+func keyCommand(admin, script, username, line, publicKey string) (string, error) {
+	fields := strings.Fields(publicKey)
+	if len(fields) < 2 {
+		return "", fmt.Errorf("invalid public key")
+	}
+
+	args := []string{script, "openpam", username, line, fields[1]}
+	quoted := make([]string, len(args))
+	for i, arg := range args {
+		q, err := task.ShellQuote(arg)
+		if err != nil {
+			return "", err
+		}
+		quoted[i] = q
+	}
+
+	command := "sh -c " + strings.Join(quoted, " ")
+	if admin != "root" {
+		command = "sudo -n " + command
+	}
+	return command, nil
+}
+
+// checkKeys compares the keys a scan found on an SSH target with the keys
+// tracked on it, records the differences as drift and alerts on new drift.
+// Only accounts with tracked keys are checked; keys of other accounts aren't
+// under management.
+func (s *Scanner) checkKeys(ctx context.Context, scan *models.DiscoveryScan, target *models.Target, accounts []*models.DiscoveredAccount, warnings []string) {
+	tracked, err := s.keys.ListActiveKeys(ctx, target.ID)
+	if err != nil {
+		s.logger.Error("Failed to list tracked SSH keys", map[string]interface{}{
+			"target": target.Name,
+			"error":  err.Error(),
+		})
+		return
+	}
+
+	byUser := make(map[string]map[string]*models.SSHKey)
+	for _, key := range tracked {
+		if byUser[key.Username] == nil {
+			byUser[key.Username] = make(map[string]*models.SSHKey)
+		}
+		byUser[key.Username][key.Fingerprint] = key
+	}
+
+	found := make(map[string]*models.DiscoveredAccount)
+	for _, account := range accounts {
+		found[account.Username] = account
+	}
+
+	var drift []*models.SSHKeyDrift
+	var unread []string
+	for username, keys := range byUser {
+		account := found[username]
+		if account != nil && unreadable(account, warnings) {
+			// Drift can't be told from a file the scan couldn't read
+			unread = append(unread, username)
+			continue
+		}
+
+		present := make(map[string]bool)
+		if account != nil {
+			for _, ak := range account.AuthorizedKeys {
+				present[ak.Fingerprint] = true
+				if keys[ak.Fingerprint] == nil {
+					drift = append(drift, &models.SSHKeyDrift{
+						TargetID:    target.ID,
+						Username:    username,
+						Kind:        models.SSHKeyDriftUnauthorized,
+						KeyType:     ak.Type,
+						Fingerprint: ak.Fingerprint,
+						PublicKey:   ak.Key,
+						Comment:     ak.Comment,
+						ScanID:      &scan.ID,
+					})
+				}
+			}
+		}
+		for fingerprint, key := range keys {
+			if !present[fingerprint] {
+				drift = append(drift, &models.SSHKeyDrift{
+					TargetID:    target.ID,
+					Username:    username,
+					Kind:        models.SSHKeyDriftMissing,
+					KeyType:     key.KeyType,
+					Fingerprint: key.Fingerprint,
+					PublicKey:   key.PublicKey,
+					SSHKeyID:    &key.ID,
+					ScanID:      &scan.ID,
+				})
+			}
+		}
+	}
+
+	var opened []*models.SSHKeyDrift
+	for _, d := range drift {
+		inserted, err := s.keys.OpenDrift(ctx, d)
+		if err != nil {
+			s.logger.Error("Failed to record SSH key drift", map[string]interface{}{
+				"target":   target.Name,
+				"username": d.Username,
+				"error":    err.Error(),
+			})
+			return
+		}
+		if inserted {
+			opened = append(opened, d)
+		}
+	}
+
+	if _, err := s.keys.ClearDrift(ctx, target.ID, scan.ID, unread); err != nil {
+		s.logger.Error("Failed to clear SSH key drift", map[string]interface{}{
+			"target": target.Name,
+			"error":  err.Error(),
+		})
+	}
+
+	if len(opened) > 0 {
+		driftFound.Add(int64(len(opened)))
+		s.alertDrift(ctx, target, opened)
+	}
+}
+
+// unreadable reports whether the scan warned that it couldn't read the account's keys
+func unreadable(account *models.DiscoveredAccount, warnings []string) bool {
+	if account.Home == "" {
+		return false
+	}
+	dir := strings.TrimRight(account.Home, "/") + "/.ssh/"
+	for _, w := range warnings {
+		if strings.Contains(w, dir) {
+			return true
+		}
+	}
+	return false
+}
+
+// alertDrift logs, audits and mails newly found drift
+func (s *Scanner) alertDrift(ctx context.Context, target *models.Target, drift []*models.SSHKeyDrift) {
+	sort.Slice(drift, func(i, j int) bool {
+		if drift[i].Username != drift[j].Username {
+			return drift[i].Username < drift[j].Username
+		}
+		return drift[i].Kind > drift[j].Kind
+	})
+
+	var lines []string
+	for _, d := range drift {
+		s.logger.Warn("SSH key drift detected", map[string]interface{}{
+			"target":      target.Name,
+			"username":    d.Username,
+			"kind":        d.Kind,
+			"fingerprint": d.Fingerprint,
+		})
+
+		details := map[string]interface{}{
+			"drift_id":    d.ID.String(),
+			"target_id":   target.ID.String(),
+			"target":      target.Name,
+			"username":    d.Username,
+			"kind":        d.Kind,
+			"fingerprint": d.Fingerprint,
+		}
+		if err := s.audit.CreateSimple(ctx, models.EventTypeSSHKeyDrift, nil, "ssh_key_drift", models.AuditStatusFailure, nil, details); err != nil {
+			s.logger.Error("Failed to create system audit log", map[string]interface{}{
+				"error": err.Error(),
+			})
+		}
+
+		what := "unauthorized key"
+		if d.Kind == models.SSHKeyDriftMissing {
+			what = "tracked key missing"
+		}
+		line := fmt.Sprintf("  %s: %s %s %s", d.Username, what, d.KeyType, d.Fingerprint)
+		if d.Comment != "" {
+			line += " (" + d.Comment + ")"
+		}
+		lines = append(lines, line)
+	}
+
+	if len(s.config.AlertRecipients) == 0 {
+		return
+	}
+	// Changes are expected while a target is under maintenance; the drift is
+	// still recorded for review
+	if target.InMaintenance(time.Now()) {
+		s.logger.Info("SSH key drift alert held back during maintenance", map[string]interface{}{
+			"target": target.Name,
+			"drift":  len(drift),
+		})
+		return
+	}
+
+	msg := &notify.Message{
+		To:      s.config.AlertRecipients,
+		Subject: fmt.Sprintf("OpenPAM: SSH key drift on %s", target.Name),
+		Body: fmt.Sprintf("A discovery scan of %s at %s found authorized_keys changes made outside OpenPAM:\n\n%s\n\n"+
+			"Approve or revert them under SSH key drift.",
+			target.Name, time.Now().UTC().Format(time.RFC3339), strings.Join(lines, "\n")),
+	}
+	if err := s.notifier.Send(ctx, msg); err != nil {
+		s.logger.Error("Failed to send SSH key drift alert", map[string]interface{}{
+			"target": target.Name,
+			"error":  err.Error(),
+		})
+	}
+}
+
+func (s *Scanner) auditKey(ctx context.Context, eventType, action, status string, target *models.Target, username, fingerprint string, userID *uuid.UUID, ipAddress *string, cause error) {
+	details := map[string]interface{}{
+		"target_id": target.ID.String(),
+		"target":    target.Name,
+		"username":  username,
+	}
+	if fingerprint != "" {
+		details["fingerprint"] = fingerprint
+	}
+	if cause != nil {
+		details["error"] = cause.Error()
+	}
+
+	if err := s.audit.CreateSimple(ctx, eventType, userID, action, status, ipAddress, details); err != nil {
+		s.logger.Error("Failed to create system audit log", map[string]interface{}{
+			"error": err.Error(),
+		})
+	}
+}
@@ -0,0 +1,498 @@
+package discovery
+
+import (
+	"context"
+	"errors"
+	"expvar"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/VanCannon/openpam/gateway/internal/models"
+	"github.com/VanCannon/openpam/gateway/internal/vault"
+	"github.com/google/uuid"
+)
+
+// lapsRetryAfter is how long a machine whose rotation failed waits before it is tried again
+const lapsRetryAfter = time.Hour
+
+// Published at /api/v1/admin/metrics
+var (
+	lapsRotated      = expvar.NewInt("laps_passwords_rotated")
+	lapsFailed       = expvar.NewInt("laps_rotations_failed")
+	lapsRetrieved    = expvar.NewInt("laps_passwords_retrieved")
+	lapsOverdueGauge = expvar.NewInt("laps_machines_overdue")
+)
+
+var (
+	errLAPSNoAccount  = errors.New("built-in Administrator account not found")
+	errLAPSNoPassword = errors.New("no LAPS password stored for the machine")
+
+	// ErrNotWindows is returned when enrolling a target that isn't a Windows (RDP) target
+	ErrNotWindows = errors.New("LAPS is only supported for RDP (Windows) targets")
+
+	// ErrNotEnrolled is returned for machines that aren't enrolled in LAPS
+	ErrNotEnrolled = errors.New("machine is not enrolled in LAPS")
+
+	// ErrReasonRequired is returned when a password is retrieved without a reason
+	ErrReasonRequired = errors.New("a reason is required to retrieve a LAPS password")
+)
+
+// LAPSStore is the subset of the LAPS repository the scanner needs
+type LAPSStore interface {
+	Enroll(ctx context.Context, machine *models.LAPSMachine) error
+	Unenroll(ctx context.Context, targetID uuid.UUID) error
+	GetMachine(ctx context.Context, targetID uuid.UUID) (*models.LAPSMachine, error)
+	ListMachines(ctx context.Context, overdueBefore *time.Time) ([]*models.LAPSMachine, error)
+	ListDueMachines(ctx context.Context, now, retryBefore time.Time, limit int) ([]*models.LAPSMachine, error)
+	RecordRotation(ctx context.Context, targetID uuid.UUID, accountName string, credentialID *uuid.UUID, next time.Time) error
+	RecordFailure(ctx context.Context, targetID uuid.UUID, message string) error
+	RecordRetrieval(ctx context.Context, targetID uuid.UUID, rotateBy *time.Time) error
+}
+
+// lapsAccountScript prints the name of the built-in Administrator, found by its
+// RID since it is often renamed
+const lapsAccountScript = `$ErrorActionPreference='Stop'
+$u=Get-LocalUser|Where-Object{$_.SID.Value -like 'S-1-5-21-*-500'}|Select-Object -First 1
+if(-not $u){exit 3}
+$u.Name
+`
+
+// lapsPasswordScript sets the password of the built-in Administrator and
+// prints its name. The password is formatted in single quotes; the password
+// alphabet has none.
+const lapsPasswordScript = `$ErrorActionPreference='Stop'
+$u=Get-LocalUser|Where-Object{$_.SID.Value -like 'S-1-5-21-*-500'}|Select-Object -First 1
+if(-not $u){exit 3}
+$u|Set-LocalUser -Password (ConvertTo-SecureString '%s' -AsPlainText -Force)
+$u.Name
+`
+
+// EnrollLAPS puts a Windows target's built-in Administrator under LAPS-style
+// management: its password is replaced with a generated one stored in Vault at
+// a path of its own, and rotated every LAPSRotateEvery from then on. An
+// existing credential for the account is taken over; otherwise one tagged
+// "laps" is created. The password is changed with the target's default
+// credential, which must be an administrator.
+func (s *Scanner) EnrollLAPS(ctx context.Context, targetID uuid.UUID, userID *uuid.UUID, ipAddress *string) (*models.LAPSMachine, error) {
+	target, err := s.targets.GetByID(ctx, targetID)
+	if err != nil {
+		return nil, err
+	}
+	if target.Protocol != models.ProtocolRDP {
+		return nil, ErrNotWindows
+	}
+
+	admin, err := s.loginCredential(ctx, target, nil)
+	if err != nil {
+		return nil, err
+	}
+	adminCreds, err := s.resolve(ctx, admin)
+	if err != nil {
+		return nil, fmt.Errorf("failed to retrieve credentials: %w", err)
+	}
+
+	account, err := s.runLAPSScript(ctx, target, adminCreds, lapsAccountScript)
+	if err != nil {
+		s.auditLAPS(ctx, models.EventTypeLAPSEnrolled, "enroll_laps", "failure", target, "", userID, ipAddress, nil, err)
+		return nil, err
+	}
+
+	machine := &models.LAPSMachine{
+		TargetID:    target.ID,
+		TargetName:  target.Name,
+		AccountName: account,
+		VaultPath:   s.lapsVaultPath(target.ID),
+		EnrolledBy:  userID,
+	}
+	if _, err := s.setLAPSPassword(ctx, target, adminCreds, machine, nil); err != nil {
+		s.auditLAPS(ctx, models.EventTypeLAPSEnrolled, "enroll_laps", "failure", target, account, userID, ipAddress, nil, err)
+		return nil, err
+	}
+
+	cred, err := s.lapsCredential(ctx, target, machine)
+	if err != nil {
+		return nil, err
+	}
+	machine.CredentialID = &cred.ID
+	machine.NextRotationAt = time.Now().Add(s.config.LAPSRotateEvery)
+
+	if err := s.laps.Enroll(ctx, machine); err != nil {
+		return nil, err
+	}
+
+	lapsRotated.Add(1)
+	s.auditLAPS(ctx, models.EventTypeLAPSEnrolled, "enroll_laps", "success", target, account, userID, ipAddress, nil, nil)
+
+	s.logger.Info("Machine enrolled in LAPS", map[string]interface{}{
+		"target":        target.Name,
+		"account":       account,
+		"credential_id": cred.ID.String(),
+	})
+
+	return machine, nil
+}
+
+// UnenrollLAPS stops rotating a machine's password. Its credential and the
+// password in Vault are kept, so the account stays usable.
+func (s *Scanner) UnenrollLAPS(ctx context.Context, targetID uuid.UUID, userID *uuid.UUID, ipAddress *string) error {
+	machine, err := s.laps.GetMachine(ctx, targetID)
+	if err != nil {
+		return err
+	}
+	if !machine.Enabled {
+		return ErrNotEnrolled
+	}
+	if err := s.laps.Unenroll(ctx, targetID); err != nil {
+		return err
+	}
+
+	target := &models.Target{ID: machine.TargetID, Name: machine.TargetName}
+	s.auditLAPS(ctx, models.EventTypeLAPSUnenrolled, "unenroll_laps", "success", target, machine.AccountName, userID, ipAddress, nil, nil)
+
+	return nil
+}
+
+// RotateLAPS rotates an enrolled machine's password now
+func (s *Scanner) RotateLAPS(ctx context.Context, targetID uuid.UUID, userID *uuid.UUID, ipAddress *string) (*models.LAPSMachine, error) {
+	machine, err := s.laps.GetMachine(ctx, targetID)
+	if err != nil {
+		return nil, err
+	}
+	if !machine.Enabled {
+		return nil, ErrNotEnrolled
+	}
+
+	if err := s.rotateLAPS(ctx, machine, userID, ipAddress); err != nil {
+		return nil, err
+	}
+
+	return s.LAPSMachine(ctx, targetID)
+}
+
+// RetrieveLAPSPassword reads an enrolled machine's current password. Every
+// retrieval is audited with its reason, and if LAPSRotateAfterRetrieval is set
+// the password is rotated that long after it was read.
+func (s *Scanner) RetrieveLAPSPassword(ctx context.Context, targetID uuid.UUID, reason string, userID *uuid.UUID, ipAddress *string) (*models.LAPSPassword, error) {
+	reason = strings.TrimSpace(reason)
+	if reason == "" {
+		return nil, ErrReasonRequired
+	}
+
+	machine, err := s.laps.GetMachine(ctx, targetID)
+	if err != nil {
+		return nil, err
+	}
+	target := &models.Target{ID: machine.TargetID, Name: machine.TargetName}
+
+	secret, err := s.secrets.GetCredentials(ctx, machine.VaultPath)
+	if err != nil || secret.Password == "" {
+		if err == nil {
+			err = errLAPSNoPassword
+		}
+		s.auditLAPS(ctx, models.EventTypeLAPSRetrieved, "retrieve_laps_password", "failure", target, machine.AccountName, userID, ipAddress, map[string]interface{}{"reason": reason}, err)
+		return nil, fmt.Errorf("failed to retrieve password: %w", err)
+	}
+
+	var rotateBy *time.Time
+	if s.config.LAPSRotateAfterRetrieval > 0 && machine.Enabled {
+		at := time.Now().Add(s.config.LAPSRotateAfterRetrieval)
+		rotateBy = &at
+		if at.Before(machine.NextRotationAt) {
+			machine.NextRotationAt = at
+		}
+	}
+	if err := s.laps.RecordRetrieval(ctx, targetID, rotateBy); err != nil {
+		return nil, err
+	}
+
+	lapsRetrieved.Add(1)
+	s.auditLAPS(ctx, models.EventTypeLAPSRetrieved, "retrieve_laps_password", "success", target, machine.AccountName, userID, ipAddress, map[string]interface{}{"reason": reason}, nil)
+
+	return &models.LAPSPassword{
+		TargetID:       machine.TargetID,
+		TargetName:     machine.TargetName,
+		AccountName:    secret.Username,
+		Password:       secret.Password,
+		RotatedAt:      machine.LastRotatedAt,
+		NextRotationAt: machine.NextRotationAt,
+	}, nil
+}
+
+// LAPSMachine retrieves an enrolled machine and whether its rotation is overdue
+func (s *Scanner) LAPSMachine(ctx context.Context, targetID uuid.UUID) (*models.LAPSMachine, error) {
+	machine, err := s.laps.GetMachine(ctx, targetID)
+	if err != nil {
+		return nil, err
+	}
+	machine.Overdue = s.lapsOverdue(machine, time.Now())
+	return machine, nil
+}
+
+// LAPSMachines lists the enrolled machines, or only those whose rotation is
+// overdue: still not done LAPSOverdueGrace after it was due
+func (s *Scanner) LAPSMachines(ctx context.Context, overdueOnly bool) ([]*models.LAPSMachine, error) {
+	now := time.Now()
+
+	var overdueBefore *time.Time
+	if overdueOnly {
+		before := now.Add(-s.config.LAPSOverdueGrace)
+		overdueBefore = &before
+	}
+
+	machines, err := s.laps.ListMachines(ctx, overdueBefore)
+	if err != nil {
+		return nil, err
+	}
+	for _, m := range machines {
+		m.Overdue = s.lapsOverdue(m, now)
+	}
+	return machines, nil
+}
+
+func (s *Scanner) lapsOverdue(machine *models.LAPSMachine, now time.Time) bool {
+	return machine.Enabled && machine.NextRotationAt.Before(now.Add(-s.config.LAPSOverdueGrace))
+}
+
+// pollLAPS rotates the passwords that are due and reports overdue machines
+func (s *Scanner) pollLAPS(now time.Time) {
+	machines, err := s.laps.ListDueMachines(s.ctx, now, now.Add(-lapsRetryAfter), batchSize)
+	if err != nil {
+		s.logger.Error("Failed to list LAPS machines due for rotation", map[string]interface{}{
+			"error": err.Error(),
+		})
+	}
+	for _, machine := range machines {
+		if s.stopping() {
+			return
+		}
+		if err := s.rotateLAPS(s.ctx, machine, nil, nil); err != nil {
+			s.logger.Error("Failed to rotate LAPS password", map[string]interface{}{
+				"target":   machine.TargetName,
+				"failures": machine.Failures + 1,
+				"error":    err.Error(),
+			})
+		}
+	}
+
+	overdue, err := s.LAPSMachines(s.ctx, true)
+	if err != nil {
+		s.logger.Error("Failed to list overdue LAPS machines", map[string]interface{}{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	// Logged when the number changes rather than on every poll
+	if int64(len(overdue)) != lapsOverdueGauge.Value() && len(overdue) > 0 {
+		names := make([]string, len(overdue))
+		for i, m := range overdue {
+			names[i] = m.TargetName
+		}
+		s.logger.Warn("LAPS password rotation overdue", map[string]interface{}{
+			"count":    len(overdue),
+			"machines": strings.Join(names, ", "),
+		})
+	}
+	lapsOverdueGauge.Set(int64(len(overdue)))
+}
+
+// rotateLAPS replaces an enrolled machine's password and schedules the next rotation
+func (s *Scanner) rotateLAPS(ctx context.Context, machine *models.LAPSMachine, userID *uuid.UUID, ipAddress *string) error {
+	err := s.rotateLAPSPassword(ctx, machine)
+
+	target := &models.Target{ID: machine.TargetID, Name: machine.TargetName}
+	if err != nil {
+		lapsFailed.Add(1)
+		if recordErr := s.laps.RecordFailure(context.Background(), machine.TargetID, err.Error()); recordErr != nil {
+			s.logger.Error("Failed to record LAPS failure", map[string]interface{}{
+				"target": machine.TargetName,
+				"error":  recordErr.Error(),
+			})
+		}
+		s.auditLAPS(ctx, models.EventTypeLAPSRotated, "rotate_laps", "failure", target, machine.AccountName, userID, ipAddress, nil, err)
+		return err
+	}
+
+	lapsRotated.Add(1)
+	s.auditLAPS(ctx, models.EventTypeLAPSRotated, "rotate_laps", "success", target, machine.AccountName, userID, ipAddress, nil, nil)
+	return nil
+}
+
+func (s *Scanner) rotateLAPSPassword(ctx context.Context, machine *models.LAPSMachine) error {
+	target, err := s.targets.GetByID(ctx, machine.TargetID)
+	if err != nil {
+		return err
+	}
+
+	admin, err := s.loginCredential(ctx, target, nil)
+	if err != nil {
+		return err
+	}
+	adminCreds, err := s.resolve(ctx, admin)
+	if err != nil {
+		return fmt.Errorf("failed to retrieve credentials: %w", err)
+	}
+
+	// Kept to restore Vault if the target refuses the new password. A machine
+	// whose password was lost is still rotated, to recover it.
+	previous, err := s.secrets.GetCredentials(ctx, machine.VaultPath)
+	if err != nil {
+		s.logger.Warn("No LAPS password to restore if the rotation fails", map[string]interface{}{
+			"target": machine.TargetName,
+			"error":  err.Error(),
+		})
+		previous = nil
+	}
+
+	renamed, err := s.setLAPSPassword(ctx, target, adminCreds, machine, previous)
+	if err != nil {
+		return err
+	}
+
+	if renamed && machine.CredentialID != nil {
+		if cred, err := s.credentials.GetByID(ctx, *machine.CredentialID); err == nil {
+			cred.Username = machine.AccountName
+			if err := s.credentials.Update(ctx, cred); err != nil {
+				s.logger.Error("Failed to rename LAPS credential", map[string]interface{}{
+					"credential_id": cred.ID.String(),
+					"error":         err.Error(),
+				})
+			}
+		}
+	}
+
+	return s.laps.RecordRotation(ctx, machine.TargetID, machine.AccountName, machine.CredentialID, time.Now().Add(s.config.LAPSRotateEvery))
+}
+
+// setLAPSPassword generates a password, stores it in Vault and sets it on the
+// built-in Administrator, in the same order as setPassword. It reports whether
+// the account turned out to have been renamed, in which case machine and Vault
+// are updated with its new name.
+func (s *Scanner) setLAPSPassword(ctx context.Context, target *models.Target, adminCreds *vault.Credentials, machine *models.LAPSMachine, previous *vault.Credentials) (bool, error) {
+	password, err := generatePassword(s.config.PasswordLength)
+	if err != nil {
+		return false, err
+	}
+
+	secret := &vault.Credentials{Username: machine.AccountName, Password: password}
+	if err := s.secrets.PutCredentials(ctx, machine.VaultPath, secret); err != nil {
+		return false, fmt.Errorf("failed to store password in Vault: %w", err)
+	}
+
+	account, err := s.runLAPSScript(ctx, target, adminCreds, fmt.Sprintf(lapsPasswordScript, password))
+	if err != nil {
+		if previous != nil {
+			if restoreErr := s.secrets.PutCredentials(context.Background(), machine.VaultPath, previous); restoreErr != nil {
+				s.logger.Error("Failed to restore previous password in Vault", map[string]interface{}{
+					"vault_path": machine.VaultPath,
+					"error":      restoreErr.Error(),
+				})
+			}
+		}
+		return false, err
+	}
+
+	if account == machine.AccountName {
+		return false, nil
+	}
+
+	machine.AccountName = account
+	secret.Username = account
+	if err := s.secrets.PutCredentials(ctx, machine.VaultPath, secret); err != nil {
+		return false, fmt.Errorf("failed to store password in Vault: %w", err)
+	}
+	return true, nil
+}
+
+// runLAPSScript runs a LAPS script and returns the Administrator's name it printed
+func (s *Scanner) runLAPSScript(ctx context.Context, target *models.Target, adminCreds *vault.Credentials, script string) (string, error) {
+	result, err := s.runner.Run(ctx, target, adminCreds, encodedPowerShell(script), passwordTimeout)
+	if err != nil {
+		return "", err
+	}
+
+	output := strings.TrimSpace(result.Output)
+	switch {
+	case result.ExitCode == 3:
+		return "", errLAPSNoAccount
+	case result.ExitCode != 0:
+		return "", fmt.Errorf("password change failed with exit code %d: %s", result.ExitCode, truncate(output, 200))
+	}
+
+	lines := strings.Split(output, "\n")
+	account := strings.TrimSpace(lines[len(lines)-1])
+	if account == "" {
+		return "", errLAPSNoAccount
+	}
+	return account, nil
+}
+
+// lapsCredential returns the credential of an enrolled machine's Administrator.
+// An existing credential for the account is pointed at the LAPS password; one
+// onboarded by discovery loses its tag, so only LAPS rotates it.
+func (s *Scanner) lapsCredential(ctx context.Context, target *models.Target, machine *models.LAPSMachine) (*models.Credential, error) {
+	creds, err := s.credentials.GetByTargetID(ctx, target.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, cred := range creds {
+		if !strings.EqualFold(cred.Username, machine.AccountName) {
+			continue
+		}
+
+		tags := []string{models.CredentialTagLAPS}
+		for _, tag := range cred.Tags {
+			if tag != models.CredentialTagDiscovered && tag != models.CredentialTagLAPS {
+				tags = append(tags, tag)
+			}
+		}
+		cred.Username = machine.AccountName
+		cred.VaultSecretPath = machine.VaultPath
+		cred.Tags = tags
+		if err := s.credentials.Update(ctx, cred); err != nil {
+			return nil, err
+		}
+		return cred, nil
+	}
+
+	cred := &models.Credential{
+		TargetID:        target.ID,
+		Username:        machine.AccountName,
+		VaultSecretPath: machine.VaultPath,
+		Description:     "Built-in Administrator, rotated by LAPS",
+		Tags:            []string{models.CredentialTagLAPS},
+	}
+	if err := s.credentials.Create(ctx, cred); err != nil {
+		return nil, err
+	}
+	return cred, nil
+}
+
+// lapsVaultPath returns where a machine's Administrator password is stored
+func (s *Scanner) lapsVaultPath(targetID uuid.UUID) string {
+	return strings.TrimRight(s.config.LAPSVaultPath, "/") + "/" + targetID.String()
+}
+
+func (s *Scanner) auditLAPS(ctx context.Context, eventType, action, status string, target *models.Target, account string, userID *uuid.UUID, ipAddress *string, extra map[string]interface{}, cause error) {
+	details := map[string]interface{}{
+		"target_id": target.ID.String(),
+		"target":    target.Name,
+	}
+	if account != "" {
+		details["account"] = account
+	}
+	for k, v := range extra {
+		details[k] = v
+	}
+	if cause != nil {
+		details["error"] = cause.Error()
+	}
+
+	if err := s.audit.CreateSimple(ctx, eventType, userID, action, status, ipAddress, details); err != nil {
+		s.logger.Error("Failed to create system audit log", map[string]interface{}{
+			"error": err.Error(),
+		})
+	}
+}
@@ -0,0 +1,301 @@
+package discovery
+
+import (
+	"bufio"
+	"strconv"
+	"strings"
+
+	"github.com/VanCannon/openpam/gateway/internal/models"
+	"golang.org/x/crypto/ssh"
+)
+
+// linuxScript prints the account database, sudoers and authorized_keys files of
+// a Linux or Unix target, each section headed by a "#openpam:" marker line.
+// Files the scanning account can't read are retried with passwordless sudo,
+// and reported as warnings if that fails too.
+const linuxScript = `
+echo "#openpam:passwd"; getent passwd 2>/dev/null || cat /etc/passwd
+echo "#openpam:group"; getent group 2>/dev/null || cat /etc/group
+for f in /etc/sudoers /etc/sudoers.d/*; do
+  [ -f "$f" ] || continue
+  if [ -r "$f" ]; then echo "#openpam:sudoers $f"; cat "$f"
+  elif sudo -n true 2>/dev/null; then echo "#openpam:sudoers $f"; sudo -n cat "$f"
+  else echo "#openpam:warning cannot read $f"; fi
+done
+(getent passwd 2>/dev/null || cat /etc/passwd) | while IFS=: read -r name _ _ _ _ home _; do
+  for f in "$home/.ssh/authorized_keys" "$home/.ssh/authorized_keys2"; do
+    if [ -r "$f" ]; then echo "#openpam:keys $name $f"; cat "$f"
+    elif sudo -n test -f "$f" 2>/dev/null; then echo "#openpam:keys $name $f"; sudo -n cat "$f"
+    elif [ -d "$home/.ssh" ] && [ ! -x "$home/.ssh" ]; then echo "#openpam:warning cannot read $f"; break
+    fi
+  done
+done
+`
+
+// privilegedGroups are the Linux groups whose members can administer the host
+var privilegedGroups = map[string]bool{
+	"root":  true,
+	"wheel": true,
+	"sudo":  true,
+	"admin": true,
+}
+
+// noLoginShells are shells that refuse interactive logins
+var noLoginShells = []string{"nologin", "false", "sync", "shutdown", "halt"}
+
+// parseLinux reads the output of linuxScript
+func parseLinux(output string) ([]*models.DiscoveredAccount, []string) {
+	var accounts []*models.DiscoveredAccount
+	var warnings []string
+	byName := make(map[string]*models.DiscoveredAccount)
+	primaryGID := make(map[string]string)
+	groupNames := make(map[string]string) // GID to name
+	var groupLines, sudoLines []string
+
+	section := ""
+	owner := ""
+	scanner := bufio.NewScanner(strings.NewReader(output))
+	scanner.Buffer(nil, 1<<20)
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+
+		if marker, ok := strings.CutPrefix(line, "#openpam:"); ok {
+			kind, arg, _ := strings.Cut(marker, " ")
+			section = kind
+			switch kind {
+			case "keys":
+				owner, _, _ = strings.Cut(arg, " ")
+			case "warning":
+				warnings = append(warnings, arg)
+			}
+			continue
+		}
+
+		switch section {
+		case "passwd":
+			fields := strings.Split(line, ":")
+			if len(fields) < 7 || fields[0] == "" || byName[fields[0]] != nil {
+				continue
+			}
+			account := &models.DiscoveredAccount{
+				Username:     fields[0],
+				UID:          fields[2],
+				Home:         fields[5],
+				Shell:        fields[6],
+				LoginEnabled: loginShell(fields[6]),
+			}
+			if uid, err := strconv.Atoi(fields[2]); err == nil && uid != 0 && uid < 1000 && !account.LoginEnabled {
+				account.SystemAccount = true
+			}
+			primaryGID[fields[0]] = fields[3]
+			byName[account.Username] = account
+			accounts = append(accounts, account)
+
+		case "group":
+			groupLines = append(groupLines, line)
+
+		case "sudoers":
+			sudoLines = append(sudoLines, line)
+
+		case "keys":
+			if account := byName[owner]; account != nil {
+				if key, ok := parseAuthorizedKey(line); ok {
+					account.AuthorizedKeys = append(account.AuthorizedKeys, key)
+				}
+			}
+		}
+	}
+
+	// Group membership, both supplementary and primary
+	for _, line := range groupLines {
+		fields := strings.Split(line, ":")
+		if len(fields) < 4 {
+			continue
+		}
+		groupNames[fields[2]] = fields[0]
+		for _, member := range strings.Split(fields[3], ",") {
+			if account := byName[strings.TrimSpace(member)]; account != nil {
+				addGroup(account, fields[0])
+			}
+		}
+	}
+	for name, gid := range primaryGID {
+		if group, ok := groupNames[gid]; ok {
+			addGroup(byName[name], group)
+		}
+	}
+
+	rules := parseSudoers(sudoLines)
+	for _, account := range accounts {
+		if account.UID == "0" {
+			addReason(account, "uid 0")
+		}
+		for _, group := range account.Groups {
+			if privilegedGroups[group] {
+				addReason(account, "member of "+group)
+			}
+		}
+		for _, rule := range rules {
+			if rule.matches(account) {
+				account.SudoRules = append(account.SudoRules, rule.text)
+			}
+		}
+		if len(account.SudoRules) > 0 {
+			addReason(account, "sudoers")
+		}
+	}
+
+	return accounts, warnings
+}
+
+func loginShell(shell string) bool {
+	for _, s := range noLoginShells {
+		if strings.HasSuffix(shell, "/"+s) {
+			return false
+		}
+	}
+	return shell != ""
+}
+
+func addGroup(account *models.DiscoveredAccount, group string) {
+	for _, g := range account.Groups {
+		if g == group {
+			return
+		}
+	}
+	account.Groups = append(account.Groups, group)
+}
+
+func addReason(account *models.DiscoveredAccount, reason string) {
+	for _, r := range account.PrivilegeReasons {
+		if r == reason {
+			return
+		}
+	}
+	account.Privileged = true
+	account.PrivilegeReasons = append(account.PrivilegeReasons, reason)
+}
+
+// sudoRule is a user specification of a sudoers file
+type sudoRule struct {
+	users []string // User names, and group names prefixed with "%"
+	text  string
+}
+
+func (r sudoRule) matches(account *models.DiscoveredAccount) bool {
+	for _, u := range r.users {
+		if u == "ALL" || u == account.Username || u == "#"+account.UID {
+			return true
+		}
+		if group, ok := strings.CutPrefix(u, "%"); ok {
+			for _, g := range account.Groups {
+				if g == group {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+// parseSudoers reads the user specifications of sudoers files, expanding
+// User_Alias definitions. Defaults, other aliases and comments are skipped.
+func parseSudoers(lines []string) []sudoRule {
+	// Join continuation lines, collapsing tabs and runs of spaces
+	var joined []string
+	var current strings.Builder
+	for _, line := range lines {
+		line = strings.Join(strings.Fields(line), " ")
+		if cont, ok := strings.CutSuffix(line, "\\"); ok {
+			current.WriteString(cont + " ")
+			continue
+		}
+		current.WriteString(line)
+		joined = append(joined, current.String())
+		current.Reset()
+	}
+
+	aliases := make(map[string][]string)
+	var specs []string
+	for _, line := range joined {
+		if line == "" || isSudoersComment(line) || strings.HasPrefix(line, "@include") || strings.HasPrefix(line, "Defaults") {
+			continue
+		}
+		if def, ok := strings.CutPrefix(line, "User_Alias"); ok {
+			for _, alias := range strings.Split(def, ":") {
+				name, members, ok := strings.Cut(alias, "=")
+				if ok {
+					aliases[strings.TrimSpace(name)] = splitList(members)
+				}
+			}
+			continue
+		}
+		if strings.HasPrefix(line, "Runas_Alias") || strings.HasPrefix(line, "Host_Alias") || strings.HasPrefix(line, "Cmnd_Alias") || strings.HasPrefix(line, "Cmd_Alias") {
+			continue
+		}
+		specs = append(specs, line)
+	}
+
+	var rules []sudoRule
+	for _, spec := range specs {
+		// The user list ends at the first whitespace followed by a host
+		users, _, ok := strings.Cut(spec, " ")
+		if !ok {
+			continue
+		}
+		// Users may be separated by ", " as well as ","
+		rest := strings.TrimSpace(spec[len(users):])
+		for strings.HasSuffix(users, ",") {
+			next, tail, _ := strings.Cut(rest, " ")
+			users += next
+			rest = strings.TrimSpace(tail)
+		}
+
+		var expanded []string
+		for _, u := range splitList(users) {
+			if members, ok := aliases[u]; ok {
+				expanded = append(expanded, members...)
+			} else {
+				expanded = append(expanded, u)
+			}
+		}
+		rules = append(rules, sudoRule{users: expanded, text: spec})
+	}
+	return rules
+}
+
+// isSudoersComment reports whether a line is a comment or #include directive.
+// "#1000 ALL=(ALL) ALL" is a user specification by UID, not a comment.
+func isSudoersComment(line string) bool {
+	rest, ok := strings.CutPrefix(line, "#")
+	return ok && (rest == "" || rest[0] < '0' || rest[0] > '9')
+}
+
+func splitList(s string) []string {
+	var items []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// parseAuthorizedKey reads a line of an authorized_keys file
+func parseAuthorizedKey(line string) (models.AuthorizedKey, bool) {
+	line = strings.TrimSpace(line)
+	if line == "" || strings.HasPrefix(line, "#") {
+		return models.AuthorizedKey{}, false
+	}
+	key, comment, options, _, err := ssh.ParseAuthorizedKey([]byte(line))
+	if err != nil {
+		return models.AuthorizedKey{}, false
+	}
+	return models.AuthorizedKey{
+		Type:        key.Type(),
+		Key:         strings.TrimSpace(string(ssh.MarshalAuthorizedKey(key))),
+		Fingerprint: ssh.FingerprintSHA256(key),
+		Comment:     comment,
+		Options:     strings.Join(options, ","),
+	}, true
+}
@@ -0,0 +1,265 @@
+package discovery
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+	"time"
+
+	"github.com/VanCannon/openpam/gateway/internal/models"
+	"github.com/VanCannon/openpam/gateway/internal/task"
+	"github.com/VanCannon/openpam/gateway/internal/vault"
+	"github.com/google/uuid"
+)
+
+var (
+	// ErrAlreadyManaged is returned when onboarding an account that has a credential
+	ErrAlreadyManaged = errors.New("account is already managed")
+
+	// ErrNotOnboarded is returned when rotating an account that wasn't onboarded
+	// by discovery; credentials created by hand are rotated by their owners
+	ErrNotOnboarded = errors.New("account was not onboarded by discovery")
+
+	// ErrAccountRemoved is returned for accounts the last scan no longer found
+	ErrAccountRemoved = errors.New("account no longer exists on the target")
+)
+
+// passwordAlphabet leaves out the characters cmd.exe or a shell could interpret
+const passwordAlphabet = "ABCDEFGHJKLMNPQRSTUVWXYZabcdefghijkmnopqrstuvwxyz23456789-_.+=@#"
+
+// passwordTimeout bounds a password change on a target
+const passwordTimeout = time.Minute
+
+// Onboard brings an unmanaged account under management: its password is
+// replaced with a generated one, stored in Vault, and a credential tagged
+// "discovered" is created for it. The password is changed with the target's
+// default credential, which must be allowed to change other accounts'
+// passwords: root or passwordless sudo on Linux, an administrator on Windows.
+func (s *Scanner) Onboard(ctx context.Context, accountID uuid.UUID, userID *uuid.UUID, ipAddress *string) (*models.Credential, error) {
+	account, err := s.store.GetAccount(ctx, accountID)
+	if err != nil {
+		return nil, err
+	}
+	if account.RemovedAt != nil {
+		return nil, ErrAccountRemoved
+	}
+	if account.CredentialID != nil {
+		return nil, ErrAlreadyManaged
+	}
+
+	target, err := s.targets.GetByID(ctx, account.TargetID)
+	if err != nil {
+		return nil, err
+	}
+
+	path := s.vaultPath(target.ID, account.Username)
+	if err := s.setPassword(ctx, target, account.Username, path, nil); err != nil {
+		s.auditAccount(ctx, models.EventTypeAccountOnboarded, "onboard_account", "failure", account, userID, ipAddress, err)
+		return nil, err
+	}
+
+	cred := &models.Credential{
+		TargetID:        target.ID,
+		Username:        account.Username,
+		VaultSecretPath: path,
+		Description:     "Onboarded by account discovery",
+		Tags:            []string{models.CredentialTagDiscovered},
+	}
+	if err := s.credentials.Create(ctx, cred); err != nil {
+		return nil, err
+	}
+	if err := s.store.SetRotated(ctx, account.ID, cred.ID); err != nil {
+		return nil, err
+	}
+
+	accountsOnboarded.Add(1)
+	s.auditAccount(ctx, models.EventTypeAccountOnboarded, "onboard_account", "success", account, userID, ipAddress, nil)
+
+	s.logger.Info("Discovered account onboarded", map[string]interface{}{
+		"account_id":    account.ID.String(),
+		"target":        target.Name,
+		"username":      account.Username,
+		"credential_id": cred.ID.String(),
+	})
+
+	return cred, nil
+}
+
+// Rotate replaces the password of an onboarded account with a new generated one
+func (s *Scanner) Rotate(ctx context.Context, accountID uuid.UUID, userID *uuid.UUID, ipAddress *string) (*models.DiscoveredAccount, error) {
+	account, err := s.store.GetAccount(ctx, accountID)
+	if err != nil {
+		return nil, err
+	}
+	return s.rotate(ctx, account, userID, ipAddress)
+}
+
+func (s *Scanner) rotate(ctx context.Context, account *models.DiscoveredAccount, userID *uuid.UUID, ipAddress *string) (*models.DiscoveredAccount, error) {
+	if account.RemovedAt != nil {
+		return nil, ErrAccountRemoved
+	}
+	if account.CredentialID == nil {
+		return nil, ErrNotOnboarded
+	}
+	cred, err := s.credentials.GetByID(ctx, *account.CredentialID)
+	if err != nil {
+		return nil, err
+	}
+	if !cred.HasTag(models.CredentialTagDiscovered) {
+		return nil, ErrNotOnboarded
+	}
+
+	target, err := s.targets.GetByID(ctx, account.TargetID)
+	if err != nil {
+		return nil, err
+	}
+
+	// Kept to restore Vault if the target refuses the new password
+	previous, err := s.secrets.GetCredentials(ctx, cred.VaultSecretPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to retrieve current password: %w", err)
+	}
+
+	if err := s.setPassword(ctx, target, account.Username, cred.VaultSecretPath, previous); err != nil {
+		rotationsFailed.Add(1)
+		s.auditAccount(ctx, models.EventTypeAccountRotated, "rotate_account", "failure", account, userID, ipAddress, err)
+		return nil, err
+	}
+	if err := s.store.SetRotated(ctx, account.ID, cred.ID); err != nil {
+		return nil, err
+	}
+
+	passwordsRotated.Add(1)
+	s.auditAccount(ctx, models.EventTypeAccountRotated, "rotate_account", "success", account, userID, ipAddress, nil)
+
+	return s.store.GetAccount(ctx, account.ID)
+}
+
+// setPassword generates a password, stores it in Vault at path and sets it on
+// the target. Vault is written first so a password set on the target is never
+// lost; if the target refuses it, the previous secret is written back, if any.
+func (s *Scanner) setPassword(ctx context.Context, target *models.Target, username, path string, previous *vault.Credentials) error {
+	admin, err := s.loginCredential(ctx, target, nil)
+	if err != nil {
+		return err
+	}
+	adminCreds, err := s.resolve(ctx, admin)
+	if err != nil {
+		return fmt.Errorf("failed to retrieve credentials: %w", err)
+	}
+
+	password, err := generatePassword(s.config.PasswordLength)
+	if err != nil {
+		return err
+	}
+	command, err := passwordCommand(target.Protocol, adminCreds.Username, username, password)
+	if err != nil {
+		return err
+	}
+
+	if err := s.secrets.PutCredentials(ctx, path, &vault.Credentials{Username: username, Password: password}); err != nil {
+		return fmt.Errorf("failed to store password in Vault: %w", err)
+	}
+
+	result, err := s.runner.Run(ctx, target, adminCreds, command, passwordTimeout)
+	if err == nil && result.ExitCode != 0 {
+		err = fmt.Errorf("password change failed with exit code %d: %s", result.ExitCode, truncate(strings.TrimSpace(result.Output), 200))
+	}
+	if err != nil {
+		if previous != nil {
+			if restoreErr := s.secrets.PutCredentials(context.Background(), path, previous); restoreErr != nil {
+				s.logger.Error("Failed to restore previous password in Vault", map[string]interface{}{
+					"vault_path": path,
+					"error":      restoreErr.Error(),
+				})
+			}
+		}
+		return err
+	}
+
+	return nil
+}
+
+// passwordCommand returns the command that sets an account's password, run as admin
+func passwordCommand(protocol, admin, username, password string) (string, error) {
+	if protocol == models.ProtocolRDP {
+		user, err := task.CmdQuote(username)
+		if err != nil {
+			return "", err
+		}
+		pass, err := task.CmdQuote(password)
+		if err != nil {
+			return "", err
+		}
+		return "net user " + user + " " + pass, nil
+	}
+
+	// printf is a shell builtin, so the password never appears in the process list
+	line, err := task.ShellQuote(username + ":" + password)
+	if err != nil {
+		return "", err
+	}
+	chpasswd := "chpasswd"
+	if admin != "root" {
+		chpasswd = "sudo -n chpasswd"
+	}
+	return `printf '%s\n' ` + line + " | " + chpasswd, nil
+}
+
+// generatePassword returns a random password with upper and lower case letters,
+// digits and symbols
+func generatePassword(length int) (string, error) {
+	size := big.NewInt(int64(len(passwordAlphabet)))
+	b := make([]byte, length)
+
+	for {
+		for i := range b {
+			n, err := rand.Int(rand.Reader, size)
+			if err != nil {
+				return "", fmt.Errorf("failed to generate password: %w", err)
+			}
+			b[i] = passwordAlphabet[n.Int64()]
+		}
+
+		password := string(b)
+		if strings.ContainsAny(password, "ABCDEFGHJKLMNPQRSTUVWXYZ") &&
+			strings.ContainsAny(password, "abcdefghijkmnopqrstuvwxyz") &&
+			strings.ContainsAny(password, "23456789") &&
+			strings.ContainsAny(password, "-_.+=@#") {
+			return password, nil
+		}
+	}
+}
+
+// vaultPath returns where the password of an onboarded account is stored
+func (s *Scanner) vaultPath(targetID uuid.UUID, username string) string {
+	return strings.TrimRight(s.config.VaultPath, "/") + "/" + targetID.String() + "/" + username
+}
+
+func (s *Scanner) auditAccount(ctx context.Context, eventType, action, status string, account *models.DiscoveredAccount, userID *uuid.UUID, ipAddress *string, cause error) {
+	details := map[string]interface{}{
+		"account_id": account.ID.String(),
+		"target_id":  account.TargetID.String(),
+		"target":     account.TargetName,
+		"username":   account.Username,
+	}
+	if cause != nil {
+		details["error"] = cause.Error()
+	}
+
+	if err := s.audit.CreateSimple(ctx, eventType, userID, action, status, ipAddress, details); err != nil {
+		s.logger.Error("Failed to create system audit log", map[string]interface{}{
+			"error": err.Error(),
+		})
+	}
+}
+
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	return s[:n] + "..."
+}
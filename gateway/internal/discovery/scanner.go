@@ -0,0 +1,519 @@
+// Package discovery finds the local accounts of targets and brings them under
+// management. A scan logs in to a target with one of its credentials, over SSH
+// or WinRM, and lists its accounts, groups, sudo rules and authorized keys; the
+// accounts found are kept as an inventory in which privileged accounts without
+// a credential stand out. Such an account can then be onboarded: its password
+// is replaced with a generated one stored in Vault, and a credential for it is
+// created so its password can be rotated from then on. Scans also fingerprint
+// their target, recording the versions of its SSH and RDP servers.
+//
+// On SSH targets the scanner also manages authorized keys: it deploys, rotates
+// and removes keys whose private keys are held in Vault, and each scan compares
+// the keys it found with the tracked ones, alerting on keys added or removed
+// out-of-band. On Windows targets enrolled in LAPS, it rotates the password of
+// the built-in Administrator on a schedule, in the manner of Microsoft LAPS.
+package discovery
+
+import (
+	"context"
+	"errors"
+	"expvar"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/VanCannon/openpam/gateway/internal/models"
+	"github.com/VanCannon/openpam/gateway/internal/notify"
+	"github.com/VanCannon/openpam/gateway/internal/task"
+	"github.com/VanCannon/openpam/gateway/internal/vault"
+	"github.com/VanCannon/openpam/gateway/internal/worker"
+	"github.com/VanCannon/openpam/pkg/logger"
+	"github.com/google/uuid"
+)
+
+const (
+	// pollInterval is how often the scanner looks for targets due for a scan
+	// and accounts due for rotation
+	pollInterval = time.Minute
+
+	// batchSize caps the scans and rotations started per poll
+	batchSize = 10
+)
+
+// Published at /api/v1/admin/metrics
+var (
+	scansCompleted    = expvar.NewInt("discovery_scans_completed")
+	scansFailed       = expvar.NewInt("discovery_scans_failed")
+	passwordsRotated  = expvar.NewInt("discovery_passwords_rotated")
+	rotationsFailed   = expvar.NewInt("discovery_rotations_failed")
+	accountsOnboarded = expvar.NewInt("discovery_accounts_onboarded")
+)
+
+// Config holds the discovery schedule and how onboarded accounts are managed
+type Config struct {
+	Interval       time.Duration // How often each target is scanned; 0 scans on request only
+	RotateEvery    time.Duration // Password age at which onboarded accounts are rotated; 0 for never
+	ScanTimeout    time.Duration
+	VaultPath      string // Prefix of the Vault paths onboarded passwords are stored at
+	PasswordLength int
+
+	KeyVaultPath    string   // Prefix of the Vault paths managed private keys are stored at
+	KeyFrom         string   // Optional from="" pattern restricting where managed keys are accepted from
+	AlertRecipients []string // Emailed when a scan finds SSH key drift
+
+	LAPSRotateEvery          time.Duration // Age at which LAPS passwords are rotated
+	LAPSVaultPath            string        // Prefix of the per-machine Vault paths LAPS passwords are stored at
+	LAPSRotateAfterRetrieval time.Duration // Rotate this long after a password is retrieved; 0 waits for the schedule
+	LAPSOverdueGrace         time.Duration // How late a rotation may be before the machine is reported overdue
+}
+
+// Validate checks the discovery settings
+func (c Config) Validate() error {
+	if c.Interval < 0 || c.RotateEvery < 0 {
+		return fmt.Errorf("intervals cannot be negative")
+	}
+	if c.ScanTimeout <= 0 {
+		return fmt.Errorf("scan timeout must be positive")
+	}
+	if strings.Trim(c.VaultPath, "/") == "" {
+		return fmt.Errorf("a Vault path is required")
+	}
+	if c.PasswordLength < 16 || c.PasswordLength > 128 {
+		return fmt.Errorf("password length must be between 16 and 128")
+	}
+	if strings.Trim(c.KeyVaultPath, "/") == "" {
+		return fmt.Errorf("a Vault path for SSH keys is required")
+	}
+	if strings.ContainsAny(c.KeyFrom, "\"\n ") {
+		return fmt.Errorf("invalid SSH key from pattern: %q", c.KeyFrom)
+	}
+	if c.LAPSRotateEvery <= 0 {
+		return fmt.Errorf("LAPS rotation interval must be positive")
+	}
+	if c.LAPSRotateAfterRetrieval < 0 || c.LAPSOverdueGrace < 0 {
+		return fmt.Errorf("LAPS durations cannot be negative")
+	}
+	if strings.Trim(c.LAPSVaultPath, "/") == "" {
+		return fmt.Errorf("a Vault path for LAPS is required")
+	}
+	return nil
+}
+
+// Store is the subset of the discovery repository the scanner needs
+type Store interface {
+	CreateScan(ctx context.Context, scan *models.DiscoveryScan) error
+	FinishScan(ctx context.Context, scan *models.DiscoveryScan) error
+	FailStaleScans(ctx context.Context, before time.Time) (int64, error)
+	ListDueTargets(ctx context.Context, before time.Time, limit int) ([]uuid.UUID, error)
+	SaveAccounts(ctx context.Context, scan *models.DiscoveryScan, accounts []*models.DiscoveredAccount) (int, error)
+	GetAccount(ctx context.Context, id uuid.UUID) (*models.DiscoveredAccount, error)
+	ListDueRotations(ctx context.Context, before time.Time, limit int) ([]*models.DiscoveredAccount, error)
+	SetRotated(ctx context.Context, id, credentialID uuid.UUID) error
+}
+
+// TargetLookup loads the target to scan
+type TargetLookup interface {
+	GetByID(ctx context.Context, id uuid.UUID) (*models.Target, error)
+}
+
+// CredentialStore loads the credentials to log in with and stores the ones
+// created by onboarding, key deployment and LAPS
+type CredentialStore interface {
+	GetByID(ctx context.Context, id uuid.UUID) (*models.Credential, error)
+	GetByTargetID(ctx context.Context, targetID uuid.UUID) ([]*models.Credential, error)
+	Create(ctx context.Context, cred *models.Credential) error
+	Update(ctx context.Context, cred *models.Credential) error
+	Delete(ctx context.Context, id uuid.UUID) error
+}
+
+// SecretStore reads and writes credential secrets
+type SecretStore interface {
+	GetCredentials(ctx context.Context, path string) (*vault.Credentials, error)
+	PutCredentials(ctx context.Context, path string, creds *vault.Credentials) error
+}
+
+// CommandRunner runs a command on a target
+type CommandRunner interface {
+	Run(ctx context.Context, target *models.Target, creds *vault.Credentials, command string, timeout time.Duration) (*task.Result, error)
+}
+
+// Fingerprinter probes a target's services and operating system and stores
+// what it found
+type Fingerprinter interface {
+	ProbeTarget(ctx context.Context, target *models.Target) (*models.Fingerprint, error)
+}
+
+// AuditLogger records scans, onboardings, rotations and key changes in the system audit log
+type AuditLogger interface {
+	CreateSimple(ctx context.Context, eventType string, userID *uuid.UUID, action string, status string, ipAddress *string, details map[string]interface{}) error
+}
+
+// Scanner runs discovery scans, on request and on a schedule, and onboards and
+// rotates discovered accounts.
+//
+// A target is scanned by one replica at a time; the database refuses a second
+// running scan. Scans left running by a replica that stopped are failed once
+// they're older than twice the scan timeout.
+type Scanner struct {
+	config      Config
+	store       Store
+	keys        KeyStore
+	laps        LAPSStore
+	targets     TargetLookup
+	credentials CredentialStore
+	secrets     SecretStore
+	runner      CommandRunner
+	fingerprint Fingerprinter // Nil to scan accounts only
+	audit       AuditLogger
+	notifier    notify.Notifier
+	logger      *logger.Logger
+
+	// ctx is cancelled on Stop to abandon scans started on request
+	ctx    context.Context
+	cancel context.CancelFunc
+	scans  sync.WaitGroup
+
+	loop worker.Loop
+}
+
+// NewScanner creates a scanner. Each scan also fingerprints its target with
+// fingerprint, if given.
+func NewScanner(cfg Config, store Store, keys KeyStore, laps LAPSStore, targets TargetLookup, credentials CredentialStore, secrets SecretStore, runner CommandRunner, fingerprint Fingerprinter, audit AuditLogger, notifier notify.Notifier, log *logger.Logger) *Scanner {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	return &Scanner{
+		config:      cfg,
+		store:       store,
+		keys:        keys,
+		laps:        laps,
+		targets:     targets,
+		credentials: credentials,
+		secrets:     secrets,
+		runner:      runner,
+		fingerprint: fingerprint,
+		audit:       audit,
+		notifier:    notifier,
+		logger:      log,
+		ctx:         ctx,
+		cancel:      cancel,
+	}
+}
+
+// Start runs scheduled scans and rotations in the background until Stop is called
+func (s *Scanner) Start() {
+	s.loop.Start(s.run)
+}
+
+// Stop stops the scanner, abandons the scans in progress and waits for them to
+// be recorded. It is safe to call even if the scanner was never started.
+func (s *Scanner) Stop() {
+	s.cancel()
+	s.loop.Stop()
+	s.scans.Wait()
+}
+
+func (s *Scanner) run() {
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+
+	for {
+		s.poll()
+
+		select {
+		case <-s.loop.Stopping():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// poll fails stale scans, then scans the targets and rotates the LAPS and
+// onboarded account passwords that are due
+func (s *Scanner) poll() {
+	now := time.Now()
+
+	if stale, err := s.store.FailStaleScans(s.ctx, now.Add(-2*s.config.ScanTimeout)); err != nil {
+		s.logger.Error("Failed to fail stale discovery scans", map[string]interface{}{
+			"error": err.Error(),
+		})
+	} else if stale > 0 {
+		s.logger.Warn("Failed interrupted discovery scans", map[string]interface{}{
+			"count": stale,
+		})
+	}
+
+	if s.config.Interval > 0 {
+		targets, err := s.store.ListDueTargets(s.ctx, now.Add(-s.config.Interval), batchSize)
+		if err != nil {
+			s.logger.Error("Failed to list targets due for discovery", map[string]interface{}{
+				"error": err.Error(),
+			})
+		}
+		for _, id := range targets {
+			if s.stopping() {
+				return
+			}
+			scan, target, cred, err := s.begin(s.ctx, id, nil, nil)
+			if err != nil {
+				if !errors.Is(err, ErrNoCredential) {
+					s.logger.Warn("Failed to start scheduled discovery scan", map[string]interface{}{
+						"target_id": id.String(),
+						"error":     err.Error(),
+					})
+				}
+				continue
+			}
+			s.scan(s.ctx, scan, target, cred)
+		}
+	}
+
+	if !s.stopping() {
+		s.pollLAPS(now)
+	}
+
+	if s.config.RotateEvery > 0 {
+		accounts, err := s.store.ListDueRotations(s.ctx, now.Add(-s.config.RotateEvery), batchSize)
+		if err != nil {
+			s.logger.Error("Failed to list accounts due for rotation", map[string]interface{}{
+				"error": err.Error(),
+			})
+		}
+		for _, account := range accounts {
+			if s.stopping() {
+				return
+			}
+			if _, err := s.rotate(s.ctx, account, nil, nil); err != nil {
+				s.logger.Error("Failed to rotate discovered account password", map[string]interface{}{
+					"account_id": account.ID.String(),
+					"target":     account.TargetName,
+					"username":   account.Username,
+					"error":      err.Error(),
+				})
+			}
+		}
+	}
+}
+
+func (s *Scanner) stopping() bool {
+	select {
+	case <-s.loop.Stopping():
+		return true
+	default:
+		return false
+	}
+}
+
+// ErrNoCredential is returned when a target has no credential to log in with
+var ErrNoCredential = errors.New("target has no credential to log in with")
+
+// ErrUnsupportedProtocol is returned for targets that can't be scanned
+var ErrUnsupportedProtocol = errors.New("discovery is only supported for SSH and RDP (Windows) targets")
+
+// StartScan starts scanning a target in the background and returns the running
+// scan. The scan logs in with the given credential, or with the target's
+// default credential if credentialID is nil.
+func (s *Scanner) StartScan(ctx context.Context, targetID uuid.UUID, credentialID, startedBy *uuid.UUID) (*models.DiscoveryScan, error) {
+	scan, target, cred, err := s.begin(ctx, targetID, credentialID, startedBy)
+	if err != nil {
+		return nil, err
+	}
+
+	s.scans.Add(1)
+	go func() {
+		defer s.scans.Done()
+		s.scan(s.ctx, scan, target, cred)
+	}()
+
+	return scan, nil
+}
+
+// begin loads the target and credential and records a running scan
+func (s *Scanner) begin(ctx context.Context, targetID uuid.UUID, credentialID, startedBy *uuid.UUID) (*models.DiscoveryScan, *models.Target, *models.Credential, error) {
+	target, err := s.targets.GetByID(ctx, targetID)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	if target.Protocol != models.ProtocolSSH && target.Protocol != models.ProtocolRDP {
+		return nil, nil, nil, ErrUnsupportedProtocol
+	}
+
+	cred, err := s.loginCredential(ctx, target, credentialID)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	scan := &models.DiscoveryScan{
+		TargetID:     target.ID,
+		CredentialID: &cred.ID,
+		StartedBy:    startedBy,
+	}
+	if err := s.store.CreateScan(ctx, scan); err != nil {
+		return nil, nil, nil, err
+	}
+
+	return scan, target, cred, nil
+}
+
+// loginCredential picks the credential to log in to a target with: the given
+// one, or else the target's default, or else its first
+func (s *Scanner) loginCredential(ctx context.Context, target *models.Target, credentialID *uuid.UUID) (*models.Credential, error) {
+	if credentialID != nil {
+		cred, err := s.credentials.GetByID(ctx, *credentialID)
+		if err != nil {
+			return nil, err
+		}
+		if cred.TargetID != target.ID {
+			return nil, fmt.Errorf("credential does not belong to the target")
+		}
+		return cred, nil
+	}
+
+	creds, err := s.credentials.GetByTargetID(ctx, target.ID)
+	if err != nil {
+		return nil, err
+	}
+	if len(creds) == 0 {
+		return nil, ErrNoCredential
+	}
+	for _, cred := range creds {
+		if cred.IsDefault {
+			return cred, nil
+		}
+	}
+	return creds[0], nil
+}
+
+// scan runs a recorded scan to completion and stores its outcome
+func (s *Scanner) scan(ctx context.Context, scan *models.DiscoveryScan, target *models.Target, cred *models.Credential) {
+	accounts, warnings, err := s.enumerate(ctx, target, cred)
+	if s.fingerprint != nil {
+		if _, fpErr := s.fingerprint.ProbeTarget(ctx, target); fpErr != nil {
+			warnings = append(warnings, "fingerprint failed: "+fpErr.Error())
+		}
+	}
+	scan.Warnings = warnings
+
+	if err == nil {
+		scan.AccountsFound = len(accounts)
+		scan.UnmanagedPrivileged, err = s.store.SaveAccounts(ctx, scan, accounts)
+	}
+	if err == nil && target.Protocol == models.ProtocolSSH {
+		s.checkKeys(ctx, scan, target, accounts, warnings)
+	}
+
+	status := "success"
+	if err != nil {
+		msg := err.Error()
+		scan.Status = models.DiscoveryScanFailed
+		scan.Error = &msg
+		status = "failure"
+		scansFailed.Add(1)
+	} else {
+		scan.Status = models.DiscoveryScanSucceeded
+		scansCompleted.Add(1)
+	}
+
+	// Record the outcome even if the scan was abandoned at shutdown
+	recordCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	if err := s.store.FinishScan(recordCtx, scan); err != nil {
+		s.logger.Error("Failed to record discovery scan", map[string]interface{}{
+			"scan_id": scan.ID.String(),
+			"error":   err.Error(),
+		})
+	}
+
+	details := map[string]interface{}{
+		"scan_id":              scan.ID.String(),
+		"target_id":            target.ID.String(),
+		"target":               target.Name,
+		"credential":           cred.Username,
+		"accounts_found":       scan.AccountsFound,
+		"unmanaged_privileged": scan.UnmanagedPrivileged,
+	}
+	if scan.Error != nil {
+		details["error"] = *scan.Error
+	}
+	if err := s.audit.CreateSimple(recordCtx, models.EventTypeDiscoveryScan, scan.StartedBy, "discovery_scan", status, nil, details); err != nil {
+		s.logger.Error("Failed to create system audit log", map[string]interface{}{
+			"error": err.Error(),
+		})
+	}
+
+	s.logger.Info("Discovery scan finished", map[string]interface{}{
+		"scan_id":              scan.ID.String(),
+		"target":               target.Name,
+		"status":               scan.Status,
+		"accounts_found":       scan.AccountsFound,
+		"unmanaged_privileged": scan.UnmanagedPrivileged,
+		"warnings":             len(scan.Warnings),
+	})
+}
+
+// enumerate lists the accounts of a target
+func (s *Scanner) enumerate(ctx context.Context, target *models.Target, cred *models.Credential) ([]*models.DiscoveredAccount, []string, error) {
+	creds, err := s.resolve(ctx, cred)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to retrieve credentials: %w", err)
+	}
+
+	command, err := scanCommand(target.Protocol)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	result, err := s.runner.Run(ctx, target, creds, command, s.config.ScanTimeout)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var accounts []*models.DiscoveredAccount
+	var warnings []string
+	if target.Protocol == models.ProtocolRDP {
+		accounts, warnings = parseWindows(result.Output)
+	} else {
+		accounts, warnings = parseLinux(result.Output)
+	}
+	if result.Truncated {
+		warnings = append(warnings, "output was truncated; some accounts may be missing")
+	}
+
+	// Unreadable files only produce warnings, so a scan that found nothing failed
+	if len(accounts) == 0 {
+		if len(warnings) > 0 {
+			return nil, warnings, fmt.Errorf("no accounts found (exit code %d): %s", result.ExitCode, warnings[0])
+		}
+		return nil, warnings, fmt.Errorf("no accounts found (exit code %d)", result.ExitCode)
+	}
+
+	return accounts, warnings, nil
+}
+
+// scanCommand returns the command that enumerates accounts on targets of the protocol
+func scanCommand(protocol string) (string, error) {
+	if protocol == models.ProtocolRDP {
+		return encodedPowerShell(windowsScript), nil
+	}
+
+	// The login shell may not be POSIX, so the script runs under sh
+	script, err := task.ShellQuote(linuxScript)
+	if err != nil {
+		return "", err
+	}
+	return "sh -c " + script, nil
+}
+
+// resolve retrieves the secret of a credential. A "raw:" path holds the
+// password itself, for development.
+func (s *Scanner) resolve(ctx context.Context, cred *models.Credential) (*vault.Credentials, error) {
+	if strings.HasPrefix(cred.VaultSecretPath, "raw:") {
+		return &vault.Credentials{
+			Username: cred.Username,
+			Password: strings.TrimPrefix(cred.VaultSecretPath, "raw:"),
+		}, nil
+	}
+
+	return s.secrets.GetCredentials(ctx, cred.VaultSecretPath)
+}
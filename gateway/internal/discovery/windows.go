@@ -0,0 +1,109 @@
+package discovery
+
+import (
+	"bufio"
+	"encoding/base64"
+	"strings"
+	"time"
+	"unicode/utf16"
+
+	"github.com/VanCannon/openpam/gateway/internal/models"
+)
+
+// windowsScript prints a line per local user and per local group member:
+//
+//	U <tab> name <tab> SID <tab> enabled <tab> last logon (RFC 3339, UTC)
+//	G <tab> group name <tab> group SID <tab> member SID
+//
+// Groups whose members can't be listed, e.g. because they hold orphaned SIDs,
+// are reported as warnings.
+const windowsScript = `$ErrorActionPreference='Stop'
+$t=[char]9
+try{$users=Get-LocalUser}catch{"#openpam:warning $($_.Exception.Message)";exit 1}
+foreach($u in $users){$l='';if($u.LastLogon){$l=$u.LastLogon.ToUniversalTime().ToString('yyyy-MM-ddTHH:mm:ssZ')};"U$t$($u.Name)$t$($u.SID.Value)$t$($u.Enabled)$t$l"}
+foreach($g in Get-LocalGroup){try{foreach($m in Get-LocalGroupMember -Group $g){"G$t$($g.Name)$t$($g.SID.Value)$t$($m.SID.Value)"}}catch{"#openpam:warning cannot list members of $($g.Name)"}}
+`
+
+// privilegedSIDs are the well-known SIDs of the builtin groups whose members can
+// administer a Windows host
+var privilegedSIDs = map[string]bool{
+	"S-1-5-32-544": true, // Administrators
+	"S-1-5-32-547": true, // Power Users
+	"S-1-5-32-548": true, // Account Operators
+	"S-1-5-32-549": true, // Server Operators
+	"S-1-5-32-551": true, // Backup Operators
+}
+
+// encodedPowerShell returns a cmd.exe command line running the script, encoded
+// so that none of its characters are interpreted by cmd.exe
+func encodedPowerShell(script string) string {
+	units := utf16.Encode([]rune(script))
+	b := make([]byte, 0, len(units)*2)
+	for _, u := range units {
+		b = append(b, byte(u), byte(u>>8))
+	}
+	return "powershell -NoProfile -NonInteractive -EncodedCommand " + base64.StdEncoding.EncodeToString(b)
+}
+
+// parseWindows reads the output of windowsScript
+func parseWindows(output string) ([]*models.DiscoveredAccount, []string) {
+	var accounts []*models.DiscoveredAccount
+	var warnings []string
+	bySID := make(map[string]*models.DiscoveredAccount)
+
+	type membership struct{ group, groupSID, memberSID string }
+	var memberships []membership
+
+	scanner := bufio.NewScanner(strings.NewReader(output))
+	scanner.Buffer(nil, 1<<20)
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+
+		if warning, ok := strings.CutPrefix(line, "#openpam:warning "); ok {
+			warnings = append(warnings, warning)
+			continue
+		}
+
+		fields := strings.Split(line, "\t")
+		switch {
+		case fields[0] == "U" && len(fields) >= 5:
+			account := &models.DiscoveredAccount{
+				Username:     fields[1],
+				UID:          fields[2],
+				LoginEnabled: strings.EqualFold(fields[3], "True"),
+			}
+			if t, err := time.Parse(time.RFC3339, fields[4]); err == nil {
+				account.LastLogon = &t
+			}
+			// Guest, DefaultAccount and WDAGUtilityAccount
+			for _, rid := range []string{"-501", "-503", "-504"} {
+				if strings.HasSuffix(account.UID, rid) {
+					account.SystemAccount = true
+				}
+			}
+			bySID[account.UID] = account
+			accounts = append(accounts, account)
+
+		case fields[0] == "G" && len(fields) >= 4:
+			memberships = append(memberships, membership{fields[1], fields[2], fields[3]})
+		}
+	}
+
+	for _, m := range memberships {
+		account := bySID[m.memberSID]
+		if account == nil {
+			continue // A domain account or group
+		}
+		addGroup(account, m.group)
+		if privilegedSIDs[m.groupSID] {
+			addReason(account, "member of "+m.group)
+		}
+	}
+	for _, account := range accounts {
+		if strings.HasPrefix(account.UID, "S-1-5-21-") && strings.HasSuffix(account.UID, "-500") {
+			addReason(account, "builtin administrator")
+		}
+	}
+
+	return accounts, warnings
+}
@@ -0,0 +1,274 @@
+// Package dualcontrol puts selected admin changes under dual control. A
+// guarded request from an admin or zone admin isn't applied: it is staged as a
+// change set holding the request and a diff against the state it would change,
+// and is replayed against the same handler once a second admin approves it.
+package dualcontrol
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"reflect"
+	"strings"
+
+	"github.com/VanCannon/openpam/gateway/internal/actor"
+	"github.com/VanCannon/openpam/gateway/internal/middleware"
+	"github.com/VanCannon/openpam/gateway/internal/models"
+	"github.com/VanCannon/openpam/pkg/logger"
+	"github.com/google/uuid"
+)
+
+// maxBody is the largest request body that can be staged
+const maxBody = 1 << 20
+
+// Store persists staged change sets
+type Store interface {
+	Create(ctx context.Context, cs *models.ChangeSet) error
+}
+
+// AuditStore records events in the system audit log
+type AuditStore interface {
+	CreateSimple(ctx context.Context, eventType string, userID *uuid.UUID, action string, status string, ipAddress *string, details map[string]interface{}) error
+}
+
+// CurrentFunc loads the state a request would change, so the change set can
+// show its diff. It returns nil for requests that create something.
+type CurrentFunc func(r *http.Request) (interface{}, error)
+
+// CheckFunc refuses a zone admin's request, with its body, that changes
+// something outside their zones. The change is replayed as the approving
+// admin, so it must be refused before it is staged.
+type CheckFunc func(r *http.Request, body []byte) error
+
+// Kind describes one change a guarded route makes: the method that makes it
+// (empty for any but GET), the category that puts it under dual control, how
+// to load what it changes and, for routes zone admins reach, how to check it
+// is in their zones
+type Kind struct {
+	Method   string
+	Category string
+	Name     string
+	Current  CurrentFunc
+	Check    CheckFunc
+}
+
+func (k Kind) matches(method string) bool {
+	if k.Method == "" {
+		return method != http.MethodGet && method != http.MethodHead
+	}
+	return method == k.Method
+}
+
+// Controller stages guarded changes and applies them once approved
+type Controller struct {
+	store      Store
+	audit      AuditStore
+	categories map[string]bool
+	replay     *http.ServeMux
+	logger     *logger.Logger
+}
+
+// New creates a controller holding changes of the given categories for approval
+func New(store Store, audit AuditStore, categories []string, log *logger.Logger) *Controller {
+	c := &Controller{
+		store:      store,
+		audit:      audit,
+		categories: make(map[string]bool),
+		replay:     http.NewServeMux(),
+		logger:     log,
+	}
+	for _, category := range categories {
+		c.categories[category] = true
+	}
+	return c
+}
+
+// Enabled reports whether changes of category need a second admin's approval
+func (c *Controller) Enabled(category string) bool {
+	return c.categories[category]
+}
+
+// Guard stages the changes h makes at pattern, for the kinds whose category is
+// under dual control. Admins' and zone admins' changes are staged: other
+// callers reach h, which refuses them. h is also registered to apply the change
+// sets of pattern once approved, whether or not their category is still enabled.
+func (c *Controller) Guard(pattern string, h http.HandlerFunc, kinds ...Kind) http.HandlerFunc {
+	c.replay.Handle(pattern, h)
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		for _, kind := range kinds {
+			if kind.matches(r.Method) && c.Enabled(kind.Category) && makesChanges(r.Context()) {
+				c.stage(w, r, kind)
+				return
+			}
+		}
+		h(w, r)
+	}
+}
+
+// makesChanges reports whether the caller is an admin, or a zone admin of at
+// least one zone
+func makesChanges(ctx context.Context) bool {
+	if middleware.GetUserRole(ctx) == models.RoleAdmin {
+		return true
+	}
+	zones, scoped := actor.ZoneScope(ctx)
+	return scoped && len(zones) > 0
+}
+
+// stage stores the request as a pending change set and responds with it
+func (c *Controller) stage(w http.ResponseWriter, r *http.Request, kind Kind) {
+	ctx := r.Context()
+
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxBody))
+	if err != nil || (len(body) > 0 && !json.Valid(body)) {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if _, scoped := actor.ZoneScope(ctx); scoped && kind.Check != nil {
+		if err := kind.Check(r, body); err != nil {
+			http.Error(w, "Forbidden: "+err.Error(), http.StatusForbidden)
+			return
+		}
+	}
+
+	var before []byte
+	if kind.Current != nil {
+		current, err := kind.Current(r)
+		if err != nil {
+			http.Error(w, "Not found", http.StatusNotFound)
+			return
+		}
+		if before, err = json.Marshal(current); err != nil {
+			http.Error(w, "Failed to stage change", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	cs := &models.ChangeSet{
+		Category: kind.Category,
+		Kind:     kind.Name,
+		Method:   r.Method,
+		Path:     r.URL.RequestURI(),
+		Body:     body,
+		Before:   before,
+		Diff:     Diff(before, body),
+	}
+	if ifMatch := r.Header.Get("If-Match"); ifMatch != "" {
+		cs.IfMatch = &ifMatch
+	}
+	if id, err := uuid.Parse(middleware.GetUserID(ctx)); err == nil {
+		cs.RequestedBy = &id
+	}
+
+	if err := c.store.Create(ctx, cs); err != nil {
+		c.logger.Error("Failed to stage change set", map[string]interface{}{
+			"kind":  kind.Name,
+			"error": err.Error(),
+		})
+		http.Error(w, "Failed to stage change", http.StatusInternalServerError)
+		return
+	}
+
+	ip := r.RemoteAddr
+	details := map[string]interface{}{
+		"change_set_id": cs.ID.String(),
+		"kind":          cs.Kind,
+		"path":          cs.Path,
+	}
+	if err := c.audit.CreateSimple(ctx, models.EventTypeChangeSetStaged, cs.RequestedBy, "stage_change", models.AuditStatusSuccess, &ip, details); err != nil {
+		c.logger.Error("Failed to create system audit log", map[string]interface{}{
+			"error": err.Error(),
+		})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(cs)
+}
+
+// Apply replays an approved change set against the handler registered for its
+// path, as the caller of r. It returns the handler's status and response body.
+func (c *Controller) Apply(r *http.Request, cs *models.ChangeSet) (int, []byte) {
+	req, err := http.NewRequestWithContext(r.Context(), cs.Method, cs.Path, bytes.NewReader(cs.Body))
+	if err != nil {
+		return http.StatusBadRequest, []byte(err.Error())
+	}
+	req.RemoteAddr = r.RemoteAddr
+	if len(cs.Body) > 0 {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if cs.IfMatch != nil {
+		req.Header.Set("If-Match", *cs.IfMatch)
+	}
+
+	rec := &recorder{header: make(http.Header)}
+	c.replay.ServeHTTP(rec, req)
+	if rec.status == 0 {
+		rec.status = http.StatusOK
+	}
+	return rec.status, rec.body.Bytes()
+}
+
+// recorder captures the response of a replayed request
+type recorder struct {
+	header http.Header
+	status int
+	body   bytes.Buffer
+}
+
+func (rec *recorder) Header() http.Header { return rec.header }
+
+func (rec *recorder) WriteHeader(status int) {
+	if rec.status == 0 {
+		rec.status = status
+	}
+}
+
+func (rec *recorder) Write(b []byte) (int, error) {
+	rec.WriteHeader(http.StatusOK)
+	return rec.body.Write(b)
+}
+
+// Diff compares a change's request body with the state it replaces, both JSON
+// objects. It lists the fields the body sets to a new value; with no body, as
+// for deletions, every field of before changes to null. The version fields
+// used for optimistic locking are left out.
+func Diff(before, body []byte) models.ChangeDiff {
+	var old, proposed map[string]interface{}
+	json.Unmarshal(before, &old)
+	json.Unmarshal(body, &proposed)
+
+	diff := make(models.ChangeDiff)
+	if len(bytes.TrimSpace(body)) == 0 {
+		for field, value := range old {
+			if field != "version" {
+				diff[field] = models.FieldChange{From: value}
+			}
+		}
+		return diff
+	}
+
+	for field, value := range proposed {
+		if field == "version" || reflect.DeepEqual(old[field], value) {
+			continue
+		}
+		diff[field] = models.FieldChange{From: old[field], To: value}
+	}
+	return diff
+}
+
+// ErrorText turns a failed replay's response body into a one-line error
+func ErrorText(body []byte) string {
+	text := strings.TrimSpace(string(body))
+	var conflict struct {
+		Error string `json:"error"`
+	}
+	if json.Unmarshal(body, &conflict) == nil && conflict.Error != "" {
+		text = conflict.Error
+	}
+	return text
+}
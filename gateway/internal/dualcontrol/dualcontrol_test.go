@@ -0,0 +1,250 @@
+package dualcontrol
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/VanCannon/openpam/gateway/internal/auth"
+	"github.com/VanCannon/openpam/gateway/internal/middleware"
+	"github.com/VanCannon/openpam/gateway/internal/models"
+	"github.com/VanCannon/openpam/pkg/logger"
+	"github.com/google/uuid"
+)
+
+type fakeStore struct {
+	staged []*models.ChangeSet
+}
+
+func (f *fakeStore) Create(ctx context.Context, cs *models.ChangeSet) error {
+	cs.ID = uuid.New()
+	cs.Status = models.ChangeSetStatusPending
+	f.staged = append(f.staged, cs)
+	return nil
+}
+
+type fakeAudit struct {
+	events []string
+}
+
+func (f *fakeAudit) CreateSimple(ctx context.Context, eventType string, userID *uuid.UUID, action string, status string, ipAddress *string, details map[string]interface{}) error {
+	f.events = append(f.events, eventType)
+	return nil
+}
+
+// roleUpdates records the role changes that reached the handler
+type roleUpdates struct {
+	applied []string
+}
+
+func (u *roleUpdates) handle(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Role string `json:"role"`
+	}
+	json.NewDecoder(r.Body).Decode(&req)
+	if r.Header.Get("If-Match") != `"3"` {
+		http.Error(w, "Version mismatch", http.StatusConflict)
+		return
+	}
+	u.applied = append(u.applied, r.PathValue("id")+"="+req.Role)
+	w.Write([]byte(`{}`))
+}
+
+func currentUser(r *http.Request) (interface{}, error) {
+	return &models.User{ID: uuid.MustParse(r.PathValue("id")), Email: "ann@example.com", Role: models.RoleUser, Version: 3}, nil
+}
+
+// setup guards the role route of updates with categories under dual control,
+// and returns it behind authentication with a token for each role
+func setup(t *testing.T, categories []string) (*Controller, *fakeStore, *roleUpdates, http.Handler, map[string]string) {
+	t.Helper()
+
+	store := &fakeStore{}
+	updates := &roleUpdates{}
+	c := New(store, &fakeAudit{}, categories, logger.New(logger.LevelError, io.Discard))
+
+	mux := http.NewServeMux()
+	mux.Handle("/api/v1/users/{id}/role", c.Guard("/api/v1/users/{id}/role", updates.handle,
+		Kind{Category: models.ChangeCategoryUserRoles, Name: models.ChangeKindUserRole, Current: currentUser}))
+
+	tokens := auth.NewTokenManager("test-secret", time.Hour)
+	issued := map[string]string{}
+	for _, role := range []string{models.RoleAdmin, models.RoleUser} {
+		token, err := tokens.GenerateToken(uuid.NewString(), role+"@example.com", role, role)
+		if err != nil {
+			t.Fatalf("GenerateToken() error = %v", err)
+		}
+		issued[role] = token
+	}
+	return c, store, updates, middleware.OptionalAuth(tokens)(mux), issued
+}
+
+func request(token, method, path, body string) *http.Request {
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("If-Match", `"3"`)
+	return req
+}
+
+func TestGuard_StagesAdminChanges(t *testing.T) {
+	_, store, updates, handler, tokens := setup(t, []string{models.ChangeCategoryUserRoles})
+	userID := uuid.NewString()
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, request(tokens[models.RoleAdmin], http.MethodPut, "/api/v1/users/"+userID+"/role", `{"role":"admin","version":3}`))
+
+	if rec.Code != http.StatusAccepted {
+		t.Fatalf("status = %d, want 202: %s", rec.Code, rec.Body)
+	}
+	if len(updates.applied) != 0 {
+		t.Errorf("change applied before approval: %v", updates.applied)
+	}
+	if len(store.staged) != 1 {
+		t.Fatalf("staged %d change sets, want 1", len(store.staged))
+	}
+
+	cs := store.staged[0]
+	if cs.Kind != models.ChangeKindUserRole || cs.Path != "/api/v1/users/"+userID+"/role" || cs.IfMatch == nil {
+		t.Errorf("staged %+v", cs)
+	}
+	if len(cs.Diff) != 1 || cs.Diff["role"].From != models.RoleUser || cs.Diff["role"].To != models.RoleAdmin {
+		t.Errorf("diff = %+v, want only role from user to admin", cs.Diff)
+	}
+}
+
+func TestGuard_PassesThrough(t *testing.T) {
+	tests := []struct {
+		name       string
+		categories []string
+		role       string
+		method     string
+	}{
+		{"category not under dual control", []string{models.ChangeCategoryCredentials}, models.RoleAdmin, http.MethodPut},
+		{"caller not an admin", []string{models.ChangeCategoryUserRoles}, models.RoleUser, http.MethodPut},
+		{"read", []string{models.ChangeCategoryUserRoles}, models.RoleAdmin, http.MethodGet},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, store, updates, handler, tokens := setup(t, tt.categories)
+
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, request(tokens[tt.role], tt.method, "/api/v1/users/"+uuid.NewString()+"/role", `{"role":"admin"}`))
+
+			if len(store.staged) != 0 || len(updates.applied) != 1 {
+				t.Errorf("staged %d and applied %d, want the request passed to the handler", len(store.staged), len(updates.applied))
+			}
+		})
+	}
+}
+
+func TestApply(t *testing.T) {
+	c, store, updates, handler, tokens := setup(t, []string{models.ChangeCategoryUserRoles})
+	userID := uuid.NewString()
+
+	handler.ServeHTTP(httptest.NewRecorder(), request(tokens[models.RoleAdmin], http.MethodPut, "/api/v1/users/"+userID+"/role", `{"role":"auditor"}`))
+	cs := store.staged[0]
+
+	approval := httptest.NewRequest(http.MethodPost, "/api/v1/change-sets/"+cs.ID.String()+"/approve", nil)
+	status, body := c.Apply(approval, cs)
+	if status != http.StatusOK {
+		t.Fatalf("Apply() status = %d: %s", status, body)
+	}
+	if len(updates.applied) != 1 || updates.applied[0] != userID+"=auditor" {
+		t.Errorf("applied %v, want the staged role change", updates.applied)
+	}
+
+	stale := "\"2\""
+	cs.IfMatch = &stale
+	status, body = c.Apply(approval, cs)
+	if status != http.StatusConflict || ErrorText(body) != "Version mismatch" {
+		t.Errorf("Apply() of a stale change = %d %q, want 409", status, ErrorText(body))
+	}
+}
+
+func TestDiff(t *testing.T) {
+	before := []byte(`{"name":"ops","enabled":true,"version":4}`)
+
+	update := Diff(before, []byte(`{"name":"ops","enabled":false,"version":4}`))
+	if len(update) != 1 || update["enabled"].From != true || update["enabled"].To != false {
+		t.Errorf("update diff = %+v", update)
+	}
+
+	create := Diff(nil, []byte(`{"name":"ops"}`))
+	if len(create) != 1 || create["name"].From != nil || create["name"].To != "ops" {
+		t.Errorf("create diff = %+v", create)
+	}
+
+	deletion := Diff(before, nil)
+	if len(deletion) != 2 || deletion["name"].From != "ops" || deletion["name"].To != nil {
+		t.Errorf("delete diff = %+v", deletion)
+	}
+}
+
+// zoneLookup makes every user a zone admin of zones
+type zoneLookup []uuid.UUID
+
+func (z zoneLookup) ZonesOf(ctx context.Context, userID uuid.UUID) ([]uuid.UUID, error) {
+	return z, nil
+}
+
+func TestGuard_StagesZoneAdminChanges(t *testing.T) {
+	store := &fakeStore{}
+	c := New(store, &fakeAudit{}, []string{models.ChangeCategoryCredentials}, logger.New(logger.LevelError, io.Discard))
+
+	ownCred, otherCred := uuid.NewString(), uuid.NewString()
+	applied := 0
+	update := func(w http.ResponseWriter, r *http.Request) {
+		applied++
+		w.Write([]byte(`{}`))
+	}
+	check := func(r *http.Request, body []byte) error {
+		if r.URL.Query().Get("id") != ownCred {
+			return errors.New("outside the zones you administer")
+		}
+		return nil
+	}
+	current := func(r *http.Request) (interface{}, error) {
+		return map[string]interface{}{"username": "svc", "version": 3}, nil
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle("/api/v1/credentials/update", c.Guard("/api/v1/credentials/update", update,
+		Kind{Method: http.MethodPut, Category: models.ChangeCategoryCredentials, Name: models.ChangeKindCredentialUpdate, Current: current, Check: check}))
+
+	tokens := auth.NewTokenManager("test-secret", time.Hour)
+	token, err := tokens.GenerateToken(uuid.NewString(), "zone@example.com", "Zone Admin", models.RoleUser)
+	if err != nil {
+		t.Fatalf("GenerateToken() error = %v", err)
+	}
+	zoneScoped := middleware.ZoneScope(zoneLookup{uuid.New()}, logger.New(logger.LevelError, io.Discard))
+	handler := middleware.OptionalAuth(tokens)(middleware.Actor(zoneScoped(mux)))
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, request(token, http.MethodPut, "/api/v1/credentials/update?id="+ownCred, `{"username":"svc-new","version":3}`))
+	if rec.Code != http.StatusAccepted {
+		t.Fatalf("status = %d, want 202: %s", rec.Code, rec.Body)
+	}
+	if applied != 0 {
+		t.Error("zone admin's change applied before approval")
+	}
+	if len(store.staged) != 1 || store.staged[0].Diff["username"].To != "svc-new" {
+		t.Fatalf("staged %+v, want the username change", store.staged)
+	}
+
+	// A change outside their zones is refused rather than staged for an admin to apply
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, request(token, http.MethodPut, "/api/v1/credentials/update?id="+otherCred, `{"username":"svc-new","version":3}`))
+	if rec.Code != http.StatusForbidden {
+		t.Errorf("status outside zones = %d, want 403", rec.Code)
+	}
+	if len(store.staged) != 1 || applied != 0 {
+		t.Errorf("staged %d and applied %d after a change outside the zones", len(store.staged), applied)
+	}
+}
@@ -0,0 +1,88 @@
+// Package elevation lets users hold a higher role for a limited time. It
+// decides who may ask for which role, carries the active elevation through
+// request contexts so the audit trail can tag what was done with it, and
+// expires elevations once their time is up.
+package elevation
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/VanCannon/openpam/gateway/internal/models"
+	"github.com/google/uuid"
+)
+
+var (
+	// ErrNotEligible is returned when the user's role may not be elevated
+	ErrNotEligible = errors.New("role is not eligible for elevation")
+
+	// ErrNotHigher is returned when the requested role grants nothing the user doesn't already have
+	ErrNotHigher = errors.New("requested role is not higher than the current role")
+
+	// ErrTooLong is returned when the requested duration exceeds the policy's maximum
+	ErrTooLong = errors.New("requested duration exceeds the maximum")
+)
+
+// rank orders roles by privilege
+var rank = map[string]int{
+	models.RoleUser:    0,
+	models.RoleAuditor: 1,
+	models.RoleAdmin:   2,
+}
+
+// Policy decides who may request an elevation and which ones need approval
+type Policy struct {
+	EligibleRoles []string      // Roles that may request an elevation
+	AutoApprove   []string      // Elevated roles granted without an admin's approval
+	MaxDuration   time.Duration // Longest elevation that may be requested
+}
+
+// Check validates a request by a user holding current to hold requested for hours
+func (p Policy) Check(current, requested string, hours int) error {
+	if !contains(p.EligibleRoles, current) {
+		return ErrNotEligible
+	}
+	want, ok := rank[requested]
+	if !ok || requested == models.RoleUser {
+		return fmt.Errorf("invalid role %q: must be 'admin' or 'auditor'", requested)
+	}
+	if want <= rank[current] {
+		return ErrNotHigher
+	}
+	if hours <= 0 {
+		return fmt.Errorf("duration must be at least one hour")
+	}
+	if time.Duration(hours)*time.Hour > p.MaxDuration {
+		return fmt.Errorf("%w of %s", ErrTooLong, p.MaxDuration)
+	}
+	return nil
+}
+
+// RequiresApproval reports whether an elevation to role must be approved by an admin
+func (p Policy) RequiresApproval(role string) bool {
+	return !contains(p.AutoApprove, role)
+}
+
+func contains(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+type contextKey struct{}
+
+// WithID returns a context for a request made under an active elevation
+func WithID(ctx context.Context, id uuid.UUID) context.Context {
+	return context.WithValue(ctx, contextKey{}, id)
+}
+
+// IDFromContext returns the elevation a request was made under, if any
+func IDFromContext(ctx context.Context) uuid.NullUUID {
+	id, ok := ctx.Value(contextKey{}).(uuid.UUID)
+	return uuid.NullUUID{UUID: id, Valid: ok}
+}
@@ -0,0 +1,115 @@
+package elevation
+
+import (
+	"context"
+	"errors"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/VanCannon/openpam/gateway/internal/models"
+	"github.com/VanCannon/openpam/pkg/logger"
+	"github.com/google/uuid"
+)
+
+func TestPolicy_Check(t *testing.T) {
+	p := Policy{
+		EligibleRoles: []string{models.RoleUser, models.RoleAuditor},
+		MaxDuration:   8 * time.Hour,
+	}
+
+	if err := p.Check(models.RoleUser, models.RoleAdmin, 4); err != nil {
+		t.Errorf("user to admin: %v", err)
+	}
+	if err := p.Check(models.RoleAuditor, models.RoleAdmin, 8); err != nil {
+		t.Errorf("auditor to admin: %v", err)
+	}
+
+	if err := p.Check(models.RoleAdmin, models.RoleAdmin, 1); !errors.Is(err, ErrNotEligible) {
+		t.Errorf("admin: got %v, want ErrNotEligible", err)
+	}
+	if err := p.Check(models.RoleAuditor, models.RoleAuditor, 1); !errors.Is(err, ErrNotHigher) {
+		t.Errorf("auditor to auditor: got %v, want ErrNotHigher", err)
+	}
+	if err := p.Check(models.RoleUser, models.RoleAdmin, 9); !errors.Is(err, ErrTooLong) {
+		t.Errorf("9 hours: got %v, want ErrTooLong", err)
+	}
+	for _, bad := range []struct {
+		role  string
+		hours int
+	}{{models.RoleUser, 1}, {"root", 1}, {models.RoleAdmin, 0}} {
+		if err := p.Check(models.RoleUser, bad.role, bad.hours); err == nil {
+			t.Errorf("%s for %d hours: expected an error", bad.role, bad.hours)
+		}
+	}
+}
+
+func TestPolicy_RequiresApproval(t *testing.T) {
+	p := Policy{AutoApprove: []string{models.RoleAuditor}}
+
+	if p.RequiresApproval(models.RoleAuditor) {
+		t.Error("auditor elevation should be granted without approval")
+	}
+	if !p.RequiresApproval(models.RoleAdmin) {
+		t.Error("admin elevation should require approval")
+	}
+}
+
+func TestIDFromContext(t *testing.T) {
+	if id := IDFromContext(context.Background()); id.Valid {
+		t.Errorf("plain context has elevation %v", id.UUID)
+	}
+
+	want := uuid.New()
+	if id := IDFromContext(WithID(context.Background(), want)); !id.Valid || id.UUID != want {
+		t.Errorf("IDFromContext = %v, want %v", id, want)
+	}
+}
+
+type fakeStore struct {
+	due []*models.RoleElevation
+}
+
+func (f *fakeStore) ExpireDue(ctx context.Context, now time.Time) ([]*models.RoleElevation, error) {
+	var expired []*models.RoleElevation
+	for _, el := range f.due {
+		if !el.ExpiresAt.After(now) {
+			expired = append(expired, el)
+		}
+	}
+	return expired, nil
+}
+
+type fakeAudit struct {
+	events []string
+	users  []uuid.UUID
+}
+
+func (f *fakeAudit) CreateSimple(ctx context.Context, eventType string, userID *uuid.UUID, action string, status string, ipAddress *string, details map[string]interface{}) error {
+	f.events = append(f.events, eventType)
+	f.users = append(f.users, *userID)
+	return nil
+}
+
+func TestExpirer_RecordsExpiredElevations(t *testing.T) {
+	now := time.Now()
+	past, future := now.Add(-time.Minute), now.Add(time.Hour)
+	due := &models.RoleElevation{ID: uuid.New(), UserID: uuid.New(), Role: models.RoleAdmin, ExpiresAt: &past}
+	store := &fakeStore{due: []*models.RoleElevation{
+		due,
+		{ID: uuid.New(), UserID: uuid.New(), Role: models.RoleAdmin, ExpiresAt: &future},
+	}}
+	audit := &fakeAudit{}
+
+	e := NewExpirer(store, audit, time.Minute, logger.New(logger.LevelError, io.Discard))
+	e.ExpireDue(now)
+
+	if len(audit.events) != 1 || audit.events[0] != models.EventTypeElevationExpired || audit.users[0] != due.UserID {
+		t.Errorf("recorded %v for %v", audit.events, audit.users)
+	}
+}
+
+func TestExpirer_StopWithoutStart(t *testing.T) {
+	e := NewExpirer(&fakeStore{}, &fakeAudit{}, time.Minute, logger.New(logger.LevelError, io.Discard))
+	e.Stop()
+}
@@ -0,0 +1,107 @@
+package elevation
+
+import (
+	"context"
+	"time"
+
+	"github.com/VanCannon/openpam/gateway/internal/models"
+	"github.com/VanCannon/openpam/gateway/internal/worker"
+	"github.com/VanCannon/openpam/pkg/logger"
+	"github.com/google/uuid"
+)
+
+// Store is the subset of the role elevation repository the expirer needs
+type Store interface {
+	ExpireDue(ctx context.Context, now time.Time) ([]*models.RoleElevation, error)
+}
+
+// AuditRecorder records system audit events
+type AuditRecorder interface {
+	CreateSimple(ctx context.Context, eventType string, userID *uuid.UUID, action string, status string, ipAddress *string, details map[string]interface{}) error
+}
+
+// Expirer marks elevations past their expiry as expired and records it. The
+// elevated role already stops applying at expiry; the expirer closes the
+// elevation so the user can request another and the audit trail shows its end.
+type Expirer struct {
+	store    Store
+	audit    AuditRecorder
+	interval time.Duration
+	logger   *logger.Logger
+
+	loop worker.Loop
+}
+
+// NewExpirer creates an expirer that checks for due elevations every interval
+func NewExpirer(store Store, audit AuditRecorder, interval time.Duration, log *logger.Logger) *Expirer {
+	if interval <= 0 {
+		interval = time.Minute
+	}
+
+	return &Expirer{
+		store:    store,
+		audit:    audit,
+		interval: interval,
+		logger:   log,
+	}
+}
+
+// Start runs the expirer in the background until Stop is called
+func (e *Expirer) Start() {
+	e.loop.Start(e.run)
+}
+
+// Stop stops the expirer and waits for an in-progress pass to finish.
+// It is safe to call even if the expirer was never started.
+func (e *Expirer) Stop() {
+	e.loop.Stop()
+}
+
+func (e *Expirer) run() {
+	ticker := time.NewTicker(e.interval)
+	defer ticker.Stop()
+
+	for {
+		e.ExpireDue(time.Now())
+
+		select {
+		case <-e.loop.Stopping():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// ExpireDue expires every active elevation due at or before now
+func (e *Expirer) ExpireDue(now time.Time) {
+	ctx, cancel := context.WithTimeout(context.Background(), e.interval)
+	defer cancel()
+
+	expired, err := e.store.ExpireDue(ctx, now)
+	if err != nil {
+		e.logger.Error("Failed to expire role elevations", map[string]interface{}{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	for _, el := range expired {
+		userID := el.UserID
+		err := e.audit.CreateSimple(ctx, models.EventTypeElevationExpired, &userID, "expire_elevation", "success", nil, map[string]interface{}{
+			"elevation_id": el.ID.String(),
+			"role":         el.Role,
+		})
+		if err != nil {
+			e.logger.Error("Failed to record role elevation expiry", map[string]interface{}{
+				"elevation_id": el.ID.String(),
+				"error":        err.Error(),
+			})
+		}
+
+		e.logger.Info("Role elevation expired", map[string]interface{}{
+			"elevation_id": el.ID.String(),
+			"user_id":      el.UserID.String(),
+			"role":         el.Role,
+		})
+	}
+}
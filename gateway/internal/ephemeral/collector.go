@@ -0,0 +1,100 @@
+package ephemeral
+
+import (
+	"context"
+	"time"
+
+	"github.com/VanCannon/openpam/gateway/internal/worker"
+	"github.com/VanCannon/openpam/pkg/logger"
+)
+
+// TargetStore is the subset of the target repository the collector needs
+type TargetStore interface {
+	DisableExpired(ctx context.Context, now time.Time) (int64, error)
+	DeleteExpired(ctx context.Context, cutoff time.Time) (int64, error)
+}
+
+// Collector periodically expires ephemeral targets.
+//
+// Targets are disabled as soon as their expiry time passes, so no new sessions can
+// start, and soft-deleted once the retention period has also elapsed. Soft deletion
+// keeps the row so audit logs that reference the target stay intact.
+type Collector struct {
+	store     TargetStore
+	interval  time.Duration
+	retention time.Duration
+	logger    *logger.Logger
+
+	loop worker.Loop
+}
+
+// NewCollector creates a collector that runs every interval
+func NewCollector(store TargetStore, interval, retention time.Duration, log *logger.Logger) *Collector {
+	if interval <= 0 {
+		interval = time.Minute
+	}
+	if retention < 0 {
+		retention = 0
+	}
+
+	return &Collector{
+		store:     store,
+		interval:  interval,
+		retention: retention,
+		logger:    log,
+	}
+}
+
+// Start runs the collector in the background until Stop is called
+func (c *Collector) Start() {
+	c.loop.Start(c.run)
+}
+
+// Stop stops the collector and waits for an in-progress pass to finish.
+// It is safe to call even if the collector was never started.
+func (c *Collector) Stop() {
+	c.loop.Stop()
+}
+
+func (c *Collector) run() {
+	ticker := time.NewTicker(c.interval)
+	defer ticker.Stop()
+
+	for {
+		c.Collect(time.Now())
+
+		select {
+		case <-c.loop.Stopping():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Collect performs a single pass as of now
+func (c *Collector) Collect(now time.Time) {
+	ctx, cancel := context.WithTimeout(context.Background(), c.interval)
+	defer cancel()
+
+	disabled, err := c.store.DisableExpired(ctx, now)
+	if err != nil {
+		c.logger.Error("Failed to disable expired ephemeral targets", map[string]interface{}{
+			"error": err.Error(),
+		})
+	} else if disabled > 0 {
+		c.logger.Info("Disabled expired ephemeral targets", map[string]interface{}{
+			"count": disabled,
+		})
+	}
+
+	deleted, err := c.store.DeleteExpired(ctx, now.Add(-c.retention))
+	if err != nil {
+		c.logger.Error("Failed to delete expired ephemeral targets", map[string]interface{}{
+			"error": err.Error(),
+		})
+	} else if deleted > 0 {
+		c.logger.Info("Deleted expired ephemeral targets", map[string]interface{}{
+			"count": deleted,
+		})
+	}
+}
@@ -0,0 +1,70 @@
+package ephemeral
+
+import (
+	"context"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/VanCannon/openpam/pkg/logger"
+)
+
+type recordingStore struct {
+	disabledAt []time.Time
+	cutoffs    []time.Time
+}
+
+func (s *recordingStore) DisableExpired(ctx context.Context, now time.Time) (int64, error) {
+	s.disabledAt = append(s.disabledAt, now)
+	return 1, nil
+}
+
+func (s *recordingStore) DeleteExpired(ctx context.Context, cutoff time.Time) (int64, error) {
+	s.cutoffs = append(s.cutoffs, cutoff)
+	return 0, nil
+}
+
+func TestCollector_CollectAppliesRetention(t *testing.T) {
+	store := &recordingStore{}
+	collector := NewCollector(store, time.Minute, time.Hour, logger.New(logger.LevelError, io.Discard))
+
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	collector.Collect(now)
+
+	if len(store.disabledAt) != 1 || !store.disabledAt[0].Equal(now) {
+		t.Errorf("DisableExpired called with %v, want [%v]", store.disabledAt, now)
+	}
+	if want := now.Add(-time.Hour); len(store.cutoffs) != 1 || !store.cutoffs[0].Equal(want) {
+		t.Errorf("DeleteExpired called with %v, want [%v]", store.cutoffs, want)
+	}
+}
+
+func TestCollector_StartStop(t *testing.T) {
+	store := &recordingStore{}
+	collector := NewCollector(store, time.Hour, 0, logger.New(logger.LevelError, io.Discard))
+
+	collector.Start()
+	collector.Stop()
+	collector.Stop() // Stopping twice is safe
+
+	// The first pass runs immediately on start
+	if len(store.disabledAt) != 1 {
+		t.Errorf("expected one collection pass, got %d", len(store.disabledAt))
+	}
+}
+
+func TestCollector_StopWithoutStart(t *testing.T) {
+	collector := NewCollector(&recordingStore{}, time.Hour, 0, logger.New(logger.LevelError, io.Discard))
+
+	stopped := make(chan struct{})
+	go func() {
+		collector.Stop()
+		close(stopped)
+	}()
+
+	select {
+	case <-stopped:
+	case <-time.After(time.Second):
+		t.Fatal("Stop blocked on a collector that was never started")
+	}
+}
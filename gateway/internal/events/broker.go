@@ -0,0 +1,333 @@
+package events
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/VanCannon/openpam/gateway/internal/models"
+	"github.com/VanCannon/openpam/gateway/internal/worker"
+	"github.com/VanCannon/openpam/pkg/logger"
+	"github.com/lib/pq"
+)
+
+const (
+	// subscriberBuffer is how many events a subscriber may fall behind before it is dropped
+	subscriberBuffer = 64
+
+	// replayPageSize is how many events are loaded per query when replaying
+	replayPageSize = 500
+
+	// maintenanceInterval is how often the listener connection is checked and old events pruned
+	maintenanceInterval = time.Minute
+)
+
+// Store is the subset of the event repository the broker needs
+type Store interface {
+	GetByID(ctx context.Context, id int64) (*models.Event, error)
+	ListSince(ctx context.Context, afterID int64, limit int) ([]*models.Event, error)
+	LatestID(ctx context.Context) (int64, error)
+	DeleteBefore(ctx context.Context, cutoff time.Time) (int64, error)
+}
+
+// Filter selects events by type. Each entry matches a type exactly, or as a
+// prefix when it ends in "*" (e.g. "audit.*"). An empty filter matches everything.
+type Filter []string
+
+// ParseFilter parses a comma-separated list of event type patterns
+func ParseFilter(s string) Filter {
+	var filter Filter
+	for _, part := range strings.Split(s, ",") {
+		if part = strings.TrimSpace(part); part != "" {
+			filter = append(filter, part)
+		}
+	}
+	return filter
+}
+
+// Match reports whether the event type is selected by the filter
+func (f Filter) Match(eventType string) bool {
+	if len(f) == 0 {
+		return true
+	}
+	for _, pattern := range f {
+		if prefix, ok := strings.CutSuffix(pattern, "*"); ok {
+			if strings.HasPrefix(eventType, prefix) {
+				return true
+			}
+		} else if pattern == eventType {
+			return true
+		}
+	}
+	return false
+}
+
+// Subscription receives live events matching its filter
+type Subscription struct {
+	ch     chan *models.Event
+	filter Filter
+	broker *Broker
+}
+
+// Events returns the channel events are delivered on. It is closed when the
+// subscription is closed, or when the subscriber fell too far behind; clients
+// are expected to reconnect and resume from the last event ID they saw.
+func (s *Subscription) Events() <-chan *models.Event {
+	return s.ch
+}
+
+// Close stops delivery to the subscription
+func (s *Subscription) Close() {
+	s.broker.unsubscribe(s)
+}
+
+// Broker fans out events to local subscribers.
+//
+// Events are written to the event log by the repositories, in the same transaction
+// as the audit record they describe, and announced with NOTIFY. Every gateway
+// replica listens on the channel, so subscribers see events regardless of which
+// replica produced them.
+type Broker struct {
+	store     Store
+	dsn       string
+	retention time.Duration
+	logger    *logger.Logger
+
+	mu          sync.Mutex
+	subscribers map[*Subscription]struct{}
+	lastID      int64 // Highest event ID delivered, to catch up after a reconnect
+
+	loop worker.Loop
+}
+
+// NewBroker creates a broker that listens using its own connection to dsn and
+// prunes events older than retention
+func NewBroker(store Store, dsn string, retention time.Duration, log *logger.Logger) *Broker {
+	return &Broker{
+		store:       store,
+		dsn:         dsn,
+		retention:   retention,
+		logger:      log,
+		subscribers: make(map[*Subscription]struct{}),
+	}
+}
+
+// Start begins listening for events in the background until Stop is called
+func (b *Broker) Start() {
+	b.loop.Start(func() {
+		listener := pq.NewListener(b.dsn, time.Second, time.Minute, func(ev pq.ListenerEventType, err error) {
+			if err != nil {
+				b.logger.Warn("Event listener connection problem", map[string]interface{}{
+					"error": err.Error(),
+				})
+			}
+		})
+
+		if err := listener.Listen(models.StreamEventChannel); err != nil {
+			b.logger.Error("Failed to listen for events", map[string]interface{}{
+				"error": err.Error(),
+			})
+		}
+
+		// Start from the newest event so a restart doesn't replay history to live subscribers
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		latest, err := b.store.LatestID(ctx)
+		cancel()
+		if err != nil {
+			b.logger.Warn("Failed to read latest event ID", map[string]interface{}{
+				"error": err.Error(),
+			})
+		}
+		b.mu.Lock()
+		b.lastID = latest
+		b.mu.Unlock()
+
+		defer listener.Close()
+		b.run(listener.Notify, listener.Ping)
+	})
+}
+
+// Stop stops listening and closes all subscriptions.
+// It is safe to call even if the broker was never started.
+func (b *Broker) Stop() {
+	b.loop.Stop()
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for sub := range b.subscribers {
+		delete(b.subscribers, sub)
+		close(sub.ch)
+	}
+}
+
+// Subscribe registers a subscriber for live events matching filter
+func (b *Broker) Subscribe(filter Filter) *Subscription {
+	sub := &Subscription{
+		ch:     make(chan *models.Event, subscriberBuffer),
+		filter: filter,
+		broker: b,
+	}
+
+	b.mu.Lock()
+	b.subscribers[sub] = struct{}{}
+	b.mu.Unlock()
+
+	return sub
+}
+
+func (b *Broker) unsubscribe(sub *Subscription) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if _, ok := b.subscribers[sub]; ok {
+		delete(b.subscribers, sub)
+		close(sub.ch)
+	}
+}
+
+// Replay calls fn, oldest first, for every stored event after afterID that matches
+// filter. It stops at the first error fn returns.
+func (b *Broker) Replay(ctx context.Context, afterID int64, filter Filter, fn func(*models.Event) error) error {
+	for {
+		events, err := b.store.ListSince(ctx, afterID, replayPageSize)
+		if err != nil {
+			return err
+		}
+
+		for _, event := range events {
+			afterID = event.ID
+			if !filter.Match(event.Type) {
+				continue
+			}
+			if err := fn(event); err != nil {
+				return err
+			}
+		}
+
+		if len(events) < replayPageSize {
+			return nil
+		}
+	}
+}
+
+// run delivers notified events until Stop is called. A nil notification means the
+// listener reconnected and may have missed some, so the broker catches up from
+// the last delivered ID.
+func (b *Broker) run(notify <-chan *pq.Notification, ping func() error) {
+	ticker := time.NewTicker(maintenanceInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-b.loop.Stopping():
+			return
+		case n, ok := <-notify:
+			if !ok {
+				return
+			}
+			if n == nil {
+				b.catchUp()
+				continue
+			}
+			b.deliverID(n.Extra)
+		case <-ticker.C:
+			if err := ping(); err != nil {
+				b.logger.Warn("Event listener ping failed", map[string]interface{}{
+					"error": err.Error(),
+				})
+			}
+			b.prune()
+		}
+	}
+}
+
+func (b *Broker) deliverID(extra string) {
+	id, err := strconv.ParseInt(extra, 10, 64)
+	if err != nil {
+		b.logger.Warn("Ignoring malformed event notification", map[string]interface{}{
+			"payload": extra,
+		})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	event, err := b.store.GetByID(ctx, id)
+	if err != nil {
+		b.logger.Error("Failed to load notified event", map[string]interface{}{
+			"event_id": id,
+			"error":    err.Error(),
+		})
+		return
+	}
+
+	b.deliver(event)
+}
+
+func (b *Broker) catchUp() {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	b.mu.Lock()
+	lastID := b.lastID
+	b.mu.Unlock()
+
+	err := b.Replay(ctx, lastID, nil, func(event *models.Event) error {
+		b.deliver(event)
+		return nil
+	})
+	if err != nil {
+		b.logger.Error("Failed to catch up on missed events", map[string]interface{}{
+			"error": err.Error(),
+		})
+	}
+}
+
+// deliver hands the event to every matching subscriber. Subscribers whose buffer
+// is full are dropped rather than allowed to hold up everyone else.
+func (b *Broker) deliver(event *models.Event) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if event.ID > b.lastID {
+		b.lastID = event.ID
+	}
+
+	for sub := range b.subscribers {
+		if !sub.filter.Match(event.Type) {
+			continue
+		}
+		select {
+		case sub.ch <- event:
+		default:
+			delete(b.subscribers, sub)
+			close(sub.ch)
+			b.logger.Warn("Dropped slow event subscriber", map[string]interface{}{
+				"event_id": event.ID,
+			})
+		}
+	}
+}
+
+func (b *Broker) prune() {
+	if b.retention <= 0 {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	deleted, err := b.store.DeleteBefore(ctx, time.Now().Add(-b.retention))
+	if err != nil {
+		b.logger.Error("Failed to prune old events", map[string]interface{}{
+			"error": err.Error(),
+		})
+	} else if deleted > 0 {
+		b.logger.Debug("Pruned old events", map[string]interface{}{
+			"count": deleted,
+		})
+	}
+}
@@ -0,0 +1,200 @@
+package events
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/VanCannon/openpam/gateway/internal/models"
+	"github.com/VanCannon/openpam/pkg/logger"
+	"github.com/lib/pq"
+)
+
+// memoryStore is a Store backed by a slice ordered by ID
+type memoryStore struct {
+	events []*models.Event
+}
+
+func (m *memoryStore) add(eventType string) *models.Event {
+	event := &models.Event{ID: int64(len(m.events) + 1), Type: eventType, CreatedAt: time.Now()}
+	m.events = append(m.events, event)
+	return event
+}
+
+func (m *memoryStore) GetByID(ctx context.Context, id int64) (*models.Event, error) {
+	for _, event := range m.events {
+		if event.ID == id {
+			return event, nil
+		}
+	}
+	return nil, fmt.Errorf("event not found")
+}
+
+func (m *memoryStore) ListSince(ctx context.Context, afterID int64, limit int) ([]*models.Event, error) {
+	var result []*models.Event
+	for _, event := range m.events {
+		if event.ID > afterID && len(result) < limit {
+			result = append(result, event)
+		}
+	}
+	return result, nil
+}
+
+func (m *memoryStore) LatestID(ctx context.Context) (int64, error) {
+	return int64(len(m.events)), nil
+}
+
+func (m *memoryStore) DeleteBefore(ctx context.Context, cutoff time.Time) (int64, error) {
+	return 0, nil
+}
+
+func TestFilter_Match(t *testing.T) {
+	tests := []struct {
+		filter    string
+		eventType string
+		want      bool
+	}{
+		{filter: "", eventType: "audit.session_started", want: true},
+		{filter: "audit.session_started", eventType: "audit.session_started", want: true},
+		{filter: "audit.session_started", eventType: "audit.session_completed", want: false},
+		{filter: "audit.*", eventType: "audit.session_failed", want: true},
+		{filter: "audit.*", eventType: "system.login_success", want: false},
+		{filter: "system.login_failed, audit.*", eventType: "system.login_failed", want: true},
+		{filter: " , ", eventType: "system.logout", want: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.filter+"/"+tt.eventType, func(t *testing.T) {
+			if got := ParseFilter(tt.filter).Match(tt.eventType); got != tt.want {
+				t.Errorf("Match() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBroker_DeliversMatchingEvents(t *testing.T) {
+	store := &memoryStore{}
+	broker := NewBroker(store, "", 0, logger.New(logger.LevelError, io.Discard))
+
+	audit := broker.Subscribe(ParseFilter("audit.*"))
+	all := broker.Subscribe(nil)
+
+	notify := make(chan *pq.Notification, 4)
+	startWith(broker, notify)
+	defer broker.Stop()
+
+	started := store.add(models.StreamEventSessionStarted)
+	login := store.add("system.login_success")
+	notify <- &pq.Notification{Extra: strconv.FormatInt(started.ID, 10)}
+	notify <- &pq.Notification{Extra: strconv.FormatInt(login.ID, 10)}
+
+	if got := receive(t, audit); got.ID != started.ID {
+		t.Errorf("audit subscriber got event %d, want %d", got.ID, started.ID)
+	}
+	if got := receive(t, all); got.ID != started.ID {
+		t.Errorf("first event = %d, want %d", got.ID, started.ID)
+	}
+	if got := receive(t, all); got.ID != login.ID {
+		t.Errorf("second event = %d, want %d", got.ID, login.ID)
+	}
+
+	select {
+	case event := <-audit.Events():
+		t.Errorf("audit subscriber got unexpected event %q", event.Type)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestBroker_CatchesUpAfterReconnect(t *testing.T) {
+	store := &memoryStore{}
+	broker := NewBroker(store, "", 0, logger.New(logger.LevelError, io.Discard))
+	sub := broker.Subscribe(nil)
+
+	notify := make(chan *pq.Notification)
+	startWith(broker, notify)
+	defer broker.Stop()
+
+	// Both events were committed while the listener was disconnected
+	store.add("system.login_success")
+	store.add("system.logout")
+	notify <- nil
+
+	for want := int64(1); want <= 2; want++ {
+		if got := receive(t, sub); got.ID != want {
+			t.Errorf("got event %d, want %d", got.ID, want)
+		}
+	}
+}
+
+func TestBroker_DropsSlowSubscriber(t *testing.T) {
+	store := &memoryStore{}
+	broker := NewBroker(store, "", 0, logger.New(logger.LevelError, io.Discard))
+	sub := broker.Subscribe(nil)
+
+	for i := 0; i <= subscriberBuffer; i++ {
+		broker.deliver(store.add("system.login_success"))
+	}
+
+	count := 0
+	for range sub.Events() {
+		count++
+	}
+	if count != subscriberBuffer {
+		t.Errorf("received %d events before the channel closed, want %d", count, subscriberBuffer)
+	}
+
+	// Closing an already dropped subscription must not panic
+	sub.Close()
+}
+
+func TestBroker_Replay(t *testing.T) {
+	store := &memoryStore{}
+	for i := 0; i < replayPageSize+10; i++ {
+		if i%2 == 0 {
+			store.add(models.StreamEventSessionStarted)
+		} else {
+			store.add("system.login_success")
+		}
+	}
+	broker := NewBroker(store, "", 0, logger.New(logger.LevelError, io.Discard))
+
+	var ids []int64
+	err := broker.Replay(context.Background(), 4, ParseFilter("audit.*"), func(event *models.Event) error {
+		ids = append(ids, event.ID)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Replay() error = %v", err)
+	}
+
+	if len(ids) != (replayPageSize+10-4)/2 {
+		t.Fatalf("replayed %d events, want %d", len(ids), (replayPageSize+10-4)/2)
+	}
+	if ids[0] != 5 {
+		t.Errorf("first replayed event = %d, want 5", ids[0])
+	}
+}
+
+// startWith runs the broker on a test notification channel instead of a database listener
+func startWith(broker *Broker, notify chan *pq.Notification) {
+	broker.loop.Start(func() {
+		broker.run(notify, func() error { return nil })
+	})
+}
+
+func receive(t *testing.T, sub *Subscription) *models.Event {
+	t.Helper()
+	select {
+	case event, ok := <-sub.Events():
+		if !ok {
+			t.Fatal("subscription closed")
+		}
+		return event
+	case <-time.After(time.Second):
+		t.Fatal("timed out waiting for event")
+		return nil
+	}
+}
@@ -0,0 +1,204 @@
+// Package evidence captures context when a policy violation fires in a session:
+// the last terminal output of an SSH session or the last display instructions of
+// an RDP session, encrypted at rest and linked to the violation's audit event.
+package evidence
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/VanCannon/openpam/gateway/internal/models"
+	"github.com/VanCannon/openpam/pkg/logger"
+	"github.com/google/uuid"
+)
+
+// reportTimeout bounds how long recording one violation may take
+const reportTimeout = 10 * time.Second
+
+// Store persists captured evidence
+type Store interface {
+	CreateEvidence(ctx context.Context, evidence *models.ViolationEvidence) error
+}
+
+// AuditRecorder records system audit events
+type AuditRecorder interface {
+	Create(ctx context.Context, log *models.SystemAuditLog) error
+}
+
+// Config holds what the proxies detect and how much they keep
+type Config struct {
+	CaptureBytes int    // Output kept per session for evidence
+	DLPRules     []Rule // Matched against SSH terminal output
+}
+
+// Violation is a policy violation detected in a session
+type Violation struct {
+	SessionID uuid.UUID // Audit log ID of the session
+	UserID    uuid.UUID
+	TargetID  uuid.UUID
+	Type      string // models.Violation*
+	Rule      string // The rule that fired, if any
+	Blocked   bool   // Whether the action was refused
+	Details   map[string]interface{}
+
+	EvidenceKind string // models.Evidence*
+	ContentType  string
+	Evidence     []byte
+}
+
+// Capturer records violations and the evidence captured with them
+type Capturer struct {
+	store  Store
+	audit  AuditRecorder
+	sealer *Sealer // nil records violations without evidence
+	config Config
+	logger *logger.Logger
+
+	wg sync.WaitGroup
+}
+
+// NewCapturer creates a capturer. Without a sealer violations are still
+// recorded, but no evidence is stored.
+func NewCapturer(store Store, audit AuditRecorder, sealer *Sealer, config Config, log *logger.Logger) *Capturer {
+	return &Capturer{
+		store:  store,
+		audit:  audit,
+		sealer: sealer,
+		config: config,
+		logger: log,
+	}
+}
+
+// NewTail returns a tail sized for evidence capture
+func (c *Capturer) NewTail() *Tail {
+	return NewTail(c.config.CaptureBytes)
+}
+
+// NewScanner returns a scanner for the DLP rules, or nil if there are none
+func (c *Capturer) NewScanner() *Scanner {
+	if len(c.config.DLPRules) == 0 {
+		return nil
+	}
+	return NewScanner(c.config.DLPRules)
+}
+
+// Report records a violation in the background so the session isn't held up
+func (c *Capturer) Report(v Violation) {
+	c.wg.Add(1)
+	go func() {
+		defer c.wg.Done()
+
+		ctx, cancel := context.WithTimeout(context.Background(), reportTimeout)
+		defer cancel()
+
+		if err := c.Record(ctx, v); err != nil {
+			c.logger.Error("Failed to record policy violation", map[string]interface{}{
+				"session_id": v.SessionID.String(),
+				"violation":  v.Type,
+				"error":      err.Error(),
+			})
+		}
+	}()
+}
+
+// Wait waits for reported violations to be recorded
+func (c *Capturer) Wait() {
+	c.wg.Wait()
+}
+
+// Record writes the violation's audit event and, if capture is enabled, its
+// encrypted evidence
+func (c *Capturer) Record(ctx context.Context, v Violation) error {
+	var evidence *models.ViolationEvidence
+	if c.sealer != nil && len(v.Evidence) > 0 {
+		sum := sha256.Sum256(v.Evidence)
+		evidence = &models.ViolationEvidence{
+			ID:            uuid.New(),
+			AuditLogID:    v.SessionID,
+			ViolationType: v.Type,
+			Kind:          v.EvidenceKind,
+			ContentType:   v.ContentType,
+			Size:          len(v.Evidence),
+			SHA256:        hex.EncodeToString(sum[:]),
+		}
+
+		sealed, err := c.sealer.Seal(v.Evidence, evidence.ID[:])
+		if err != nil {
+			return err
+		}
+		evidence.Ciphertext = sealed
+	}
+
+	details := map[string]interface{}{
+		"violation":  v.Type,
+		"session_id": v.SessionID.String(),
+		"target_id":  v.TargetID.String(),
+		"blocked":    v.Blocked,
+	}
+	if v.Rule != "" {
+		details["rule"] = v.Rule
+	}
+	if evidence != nil {
+		details["evidence_id"] = evidence.ID.String()
+	}
+	for k, val := range v.Details {
+		details[k] = val
+	}
+
+	detailsJSON, err := json.Marshal(details)
+	if err != nil {
+		return fmt.Errorf("failed to encode violation details: %w", err)
+	}
+	detailsStr := string(detailsJSON)
+
+	resourceType := "session"
+	status := "success"
+	if v.Blocked {
+		status = "failure"
+	}
+
+	event := &models.SystemAuditLog{
+		EventType:    models.EventTypePolicyViolation,
+		UserID:       uuid.NullUUID{UUID: v.UserID, Valid: true},
+		ResourceType: &resourceType,
+		ResourceID:   uuid.NullUUID{UUID: v.SessionID, Valid: true},
+		Action:       v.Type,
+		Status:       status,
+		Details:      &detailsStr,
+	}
+	if err := c.audit.Create(ctx, event); err != nil {
+		return err
+	}
+
+	c.logger.Warn("Policy violation", map[string]interface{}{
+		"session_id": v.SessionID.String(),
+		"violation":  v.Type,
+		"rule":       v.Rule,
+		"blocked":    v.Blocked,
+	})
+
+	if evidence == nil {
+		return nil
+	}
+
+	evidence.SystemAuditLogID = event.ID
+	return c.store.CreateEvidence(ctx, evidence)
+}
+
+// Open decrypts stored evidence
+func (c *Capturer) Open(evidence *models.ViolationEvidence) ([]byte, error) {
+	if c.sealer == nil {
+		return nil, fmt.Errorf("evidence encryption key not configured")
+	}
+	return c.sealer.Open(evidence.Ciphertext, evidence.ID[:])
+}
+
+// CanOpen reports whether stored evidence can be decrypted
+func (c *Capturer) CanOpen() bool {
+	return c.sealer != nil
+}
@@ -0,0 +1,85 @@
+package evidence
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+)
+
+const (
+	// scanOverlap is how much of the previous output a scan looks back at, so a
+	// match split across two reads is still found
+	scanOverlap = 512
+
+	// ruleCooldown keeps a rule from firing more than once in this interval, so
+	// e.g. a dumped key file is one violation and not hundreds
+	ruleCooldown = 30 * time.Second
+)
+
+// Rule is a DLP rule matched against terminal output
+type Rule struct {
+	Name    string
+	Pattern *regexp.Regexp
+}
+
+// ParseRules parses rules given as "name=regex"
+func ParseRules(specs []string) ([]Rule, error) {
+	rules := make([]Rule, 0, len(specs))
+	for _, spec := range specs {
+		name, expr, ok := strings.Cut(spec, "=")
+		name = strings.TrimSpace(name)
+		if !ok || name == "" || expr == "" {
+			return nil, fmt.Errorf("invalid DLP rule %q: expected name=regex", spec)
+		}
+		pattern, err := regexp.Compile(expr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid DLP rule %q: %w", name, err)
+		}
+		rules = append(rules, Rule{Name: name, Pattern: pattern})
+	}
+	return rules, nil
+}
+
+// Scanner matches rules against a stream written in chunks. It is not safe for
+// concurrent use.
+type Scanner struct {
+	rules []Rule
+	prev  []byte
+	fired map[string]time.Time
+	now   func() time.Time
+}
+
+// NewScanner creates a scanner for rules
+func NewScanner(rules []Rule) *Scanner {
+	return &Scanner{rules: rules, fired: make(map[string]time.Time), now: time.Now}
+}
+
+// Scan returns the rules with a match that ends in chunk. Matches found by an
+// earlier call are not reported again, and a rule that fired within the
+// cooldown is skipped.
+func (s *Scanner) Scan(chunk []byte) []Rule {
+	if len(s.rules) == 0 {
+		return nil
+	}
+
+	now := s.now()
+	window := append(s.prev, chunk...)
+	var matched []Rule
+	for _, rule := range s.rules {
+		if last, ok := s.fired[rule.Name]; ok && now.Sub(last) < ruleCooldown {
+			continue
+		}
+		for _, loc := range rule.Pattern.FindAllIndex(window, -1) {
+			if loc[1] > len(s.prev) {
+				matched = append(matched, rule)
+				s.fired[rule.Name] = now
+				break
+			}
+		}
+	}
+
+	keep := min(len(window), scanOverlap)
+	s.prev = append(s.prev[:0], window[len(window)-keep:]...)
+	return matched
+}
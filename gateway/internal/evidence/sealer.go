@@ -0,0 +1,63 @@
+package evidence
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+)
+
+// Sealer encrypts evidence at rest with AES-256-GCM
+type Sealer struct {
+	aead cipher.AEAD
+}
+
+// ParseKey decodes a base64 encoded 32-byte key
+func ParseKey(encoded string) ([]byte, error) {
+	key, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, fmt.Errorf("evidence key is not valid base64: %w", err)
+	}
+	if len(key) != 32 {
+		return nil, fmt.Errorf("evidence key must be 32 bytes, got %d", len(key))
+	}
+	return key, nil
+}
+
+// NewSealer creates a sealer from a 32-byte key
+func NewSealer(key []byte) (*Sealer, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create cipher: %w", err)
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create GCM: %w", err)
+	}
+	return &Sealer{aead: aead}, nil
+}
+
+// Seal encrypts plaintext, prefixing the random nonce. The additional data is
+// authenticated but not stored; the same value must be given to Open.
+func (s *Sealer) Seal(plaintext, additional []byte) ([]byte, error) {
+	nonce := make([]byte, s.aead.NonceSize(), s.aead.NonceSize()+len(plaintext)+s.aead.Overhead())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, fmt.Errorf("failed to generate nonce: %w", err)
+	}
+	return s.aead.Seal(nonce, nonce, plaintext, additional), nil
+}
+
+// Open decrypts what Seal produced
+func (s *Sealer) Open(sealed, additional []byte) ([]byte, error) {
+	if len(sealed) < s.aead.NonceSize() {
+		return nil, errors.New("sealed evidence is too short")
+	}
+	nonce, ciphertext := sealed[:s.aead.NonceSize()], sealed[s.aead.NonceSize():]
+	plaintext, err := s.aead.Open(nil, nonce, ciphertext, additional)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt evidence: %w", err)
+	}
+	return plaintext, nil
+}
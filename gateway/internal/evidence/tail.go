@@ -0,0 +1,59 @@
+package evidence
+
+import "sync"
+
+// Tail keeps the last bytes written to it, so the context of a violation is at
+// hand without reading the recording back
+type Tail struct {
+	mu   sync.Mutex
+	buf  []byte
+	pos  int
+	full bool
+}
+
+// NewTail creates a tail that keeps the last size bytes
+func NewTail(size int) *Tail {
+	return &Tail{buf: make([]byte, size)}
+}
+
+// Write implements io.Writer. It never fails.
+func (t *Tail) Write(p []byte) (int, error) {
+	n := len(p)
+	if len(t.buf) == 0 {
+		return n, nil
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if len(p) >= len(t.buf) {
+		copy(t.buf, p[len(p)-len(t.buf):])
+		t.pos = 0
+		t.full = true
+		return n, nil
+	}
+
+	for len(p) > 0 {
+		c := copy(t.buf[t.pos:], p)
+		p = p[c:]
+		t.pos += c
+		if t.pos == len(t.buf) {
+			t.pos = 0
+			t.full = true
+		}
+	}
+	return n, nil
+}
+
+// Bytes returns a copy of the kept bytes, oldest first
+func (t *Tail) Bytes() []byte {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if !t.full {
+		return append([]byte(nil), t.buf[:t.pos]...)
+	}
+	out := make([]byte, 0, len(t.buf))
+	out = append(out, t.buf[t.pos:]...)
+	return append(out, t.buf[:t.pos]...)
+}
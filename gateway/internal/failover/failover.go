@@ -0,0 +1,342 @@
+// Package failover runs a gateway as the standby of an active/standby pair.
+// The standby probes the primary and stays passive while it is healthy,
+// refusing new sessions and changes. Once the primary has failed enough
+// probes in a row the standby takes over, and once it has passed as many
+// again the standby hands back. Both gateways share the database, so the
+// standby serves the same users, targets and sessions as the primary did.
+package failover
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/VanCannon/openpam/gateway/internal/models"
+	"github.com/VanCannon/openpam/gateway/internal/worker"
+	"github.com/VanCannon/openpam/pkg/logger"
+	"github.com/google/uuid"
+)
+
+// Roles of a gateway in the pair
+const (
+	RolePrimary = "primary"
+	RoleStandby = "standby"
+)
+
+// States of a gateway. Primaries are always active.
+const (
+	StateActive  = "active"
+	StatePassive = "passive"
+)
+
+// Store records state changes, so both gateways show the same history
+type Store interface {
+	Record(ctx context.Context, event *models.FailoverEvent) error
+}
+
+// AuditStore records state changes in the system audit log
+type AuditStore interface {
+	CreateSimple(ctx context.Context, eventType string, userID *uuid.UUID, action string, status string, ipAddress *string, details map[string]interface{}) error
+}
+
+// Config holds the gateway's role and how a standby watches the primary
+type Config struct {
+	Role       string        // primary or standby
+	Node       string        // Name of this gateway in the history
+	PrimaryURL string        // Base URL of the primary, probed by a standby
+	Interval   time.Duration // How often the primary is probed
+	Threshold  int           // Probes in a row that must fail to take over, or pass to hand back
+}
+
+// Validate checks the settings of a standby
+func (c Config) Validate() error {
+	switch c.Role {
+	case RolePrimary:
+		return nil
+	case RoleStandby:
+	default:
+		return fmt.Errorf("invalid role: %s (must be 'primary' or 'standby')", c.Role)
+	}
+
+	if c.PrimaryURL == "" {
+		return fmt.Errorf("a standby requires the primary's URL")
+	}
+	if c.Interval < time.Second {
+		return fmt.Errorf("probe interval must be at least 1s")
+	}
+	if c.Threshold < 1 {
+		return fmt.Errorf("threshold must be at least 1")
+	}
+	return nil
+}
+
+// Status is a gateway's role and state, with the last probe of the primary
+type Status struct {
+	Role                string     `json:"role"`
+	Node                string     `json:"node"`
+	State               string     `json:"state"`
+	PrimaryURL          string     `json:"primary_url,omitempty"`
+	ChangedAt           *time.Time `json:"changed_at,omitempty"`
+	LastProbeAt         *time.Time `json:"last_probe_at,omitempty"`
+	LastProbeError      string     `json:"last_probe_error,omitempty"`
+	ConsecutiveFailures int        `json:"consecutive_failures"`
+}
+
+// Monitor keeps track of the gateway's state. On a primary it does nothing
+// and the gateway is always active.
+type Monitor struct {
+	config Config
+	store  Store
+	audit  AuditStore
+	client *http.Client
+	logger *logger.Logger
+
+	mu        sync.RWMutex
+	state     string
+	changedAt *time.Time
+	probedAt  *time.Time
+	probeErr  string
+	failures  int // Failed probes in a row
+	passes    int // Passed probes in a row
+
+	loop worker.Loop
+}
+
+// New creates a monitor. A standby starts passive.
+func New(cfg Config, store Store, audit AuditStore, log *logger.Logger) *Monitor {
+	state := StateActive
+	if cfg.Role == RoleStandby {
+		state = StatePassive
+	}
+
+	return &Monitor{
+		config: cfg,
+		store:  store,
+		audit:  audit,
+		client: &http.Client{Timeout: cfg.Interval},
+		logger: log,
+		state:  state,
+	}
+}
+
+// Enabled reports whether the gateway is a standby watching a primary
+func (m *Monitor) Enabled() bool {
+	return m.config.Role == RoleStandby
+}
+
+// Active reports whether the gateway accepts new sessions and changes
+func (m *Monitor) Active() bool {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.state == StateActive
+}
+
+// Status returns the gateway's role and state
+func (m *Monitor) Status() Status {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	status := Status{
+		Role:                m.config.Role,
+		Node:                m.config.Node,
+		State:               m.state,
+		ChangedAt:           m.changedAt,
+		LastProbeAt:         m.probedAt,
+		LastProbeError:      m.probeErr,
+		ConsecutiveFailures: m.failures,
+	}
+	if m.Enabled() {
+		status.PrimaryURL = m.config.PrimaryURL
+	}
+	return status
+}
+
+// Start probes the primary in the background until Stop is called
+func (m *Monitor) Start() {
+	if !m.Enabled() {
+		return
+	}
+	m.loop.Start(m.run)
+}
+
+// Stop stops probing. It is safe to call even if the monitor was never started.
+func (m *Monitor) Stop() {
+	m.loop.Stop()
+}
+
+func (m *Monitor) run() {
+	ticker := time.NewTicker(m.config.Interval)
+	defer ticker.Stop()
+
+	for {
+		ctx, cancel := context.WithTimeout(context.Background(), m.config.Interval)
+		m.Observe(ctx, m.probe(ctx), time.Now())
+		cancel()
+
+		select {
+		case <-m.loop.Stopping():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// probe checks whether the primary is ready to serve
+func (m *Monitor) probe(ctx context.Context) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, strings.TrimRight(m.config.PrimaryURL, "/")+"/ready", nil)
+	if err != nil {
+		return fmt.Errorf("failed to build probe request: %w", err)
+	}
+
+	resp, err := m.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to reach primary: %w", err)
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("primary returned status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// Observe records the outcome of a probe of the primary at now, nil if it
+// passed, and takes over or hands back once enough probes agree
+func (m *Monitor) Observe(ctx context.Context, probeErr error, now time.Time) {
+	m.mu.Lock()
+	m.probedAt = &now
+	if probeErr != nil {
+		m.failures++
+		m.passes = 0
+		m.probeErr = probeErr.Error()
+	} else {
+		m.failures = 0
+		m.passes++
+		m.probeErr = ""
+	}
+
+	from, to, reason := m.state, m.state, ""
+	switch {
+	case m.state == StatePassive && m.failures >= m.config.Threshold:
+		to = StateActive
+		reason = fmt.Sprintf("primary failed %d probes in a row: %s", m.failures, m.probeErr)
+	case m.state == StateActive && m.passes >= m.config.Threshold:
+		to = StatePassive
+		reason = fmt.Sprintf("primary passed %d probes in a row", m.passes)
+	}
+	if to != from {
+		m.state = to
+		m.changedAt = &now
+	}
+	m.mu.Unlock()
+
+	if to != from {
+		m.record(ctx, from, to, reason, now)
+	}
+}
+
+// record logs and audits a state change and adds it to the history
+func (m *Monitor) record(ctx context.Context, from, to, reason string, now time.Time) {
+	fields := map[string]interface{}{
+		"node":   m.config.Node,
+		"from":   from,
+		"to":     to,
+		"reason": reason,
+	}
+	if to == StateActive {
+		m.logger.Warn("Standby took over from the primary", fields)
+	} else {
+		m.logger.Info("Standby handed back to the primary", fields)
+	}
+
+	event := &models.FailoverEvent{
+		ID:        uuid.New(),
+		Node:      m.config.Node,
+		FromState: from,
+		ToState:   to,
+		Reason:    reason,
+		CreatedAt: now,
+	}
+	if err := m.store.Record(ctx, event); err != nil {
+		m.logger.Error("Failed to record failover event", map[string]interface{}{
+			"error": err.Error(),
+		})
+	}
+
+	details := map[string]interface{}{
+		"node":   m.config.Node,
+		"from":   from,
+		"to":     to,
+		"reason": reason,
+	}
+	if err := m.audit.CreateSimple(ctx, models.EventTypeFailover, nil, to, models.AuditStatusSuccess, nil, details); err != nil {
+		m.logger.Error("Failed to create system audit log", map[string]interface{}{
+			"error": err.Error(),
+		})
+	}
+}
+
+// connectPrefix is where sessions are opened: /api/ws/connect/{protocol}/{target_id}
+const connectPrefix = "/api/ws/connect/"
+
+// alwaysAllowed are paths that keep working while passive, so users can still
+// sign in and out
+var alwaysAllowed = []string{
+	"/api/v1/auth/",
+}
+
+// Middleware returns a middleware refusing new sessions and every change
+// while the gateway is passive. Reads keep working, so admins can check on
+// the standby.
+func (m *Monitor) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if m.Active() {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if strings.HasPrefix(r.URL.Path, connectPrefix) {
+			m.refuse(w, r, "This gateway is the standby; connect through the primary")
+			return
+		}
+		if !isSafeMethod(r.Method) && !isAlwaysAllowed(r.URL.Path) {
+			m.refuse(w, r, "This gateway is the standby and doesn't accept changes; use the primary")
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// refuse writes a 503 naming the failover state, so clients and load
+// balancers can tell it apart from an outage
+func (m *Monitor) refuse(w http.ResponseWriter, r *http.Request, message string) {
+	m.logger.Debug("Request refused by passive standby", map[string]interface{}{
+		"method": r.Method,
+		"path":   r.URL.Path,
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusServiceUnavailable)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"error":          message,
+		"failover_state": StatePassive,
+	})
+}
+
+func isSafeMethod(method string) bool {
+	return method == http.MethodGet || method == http.MethodHead || method == http.MethodOptions
+}
+
+func isAlwaysAllowed(path string) bool {
+	for _, prefix := range alwaysAllowed {
+		if strings.HasPrefix(path, prefix) {
+			return true
+		}
+	}
+	return false
+}
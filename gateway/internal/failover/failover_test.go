@@ -0,0 +1,174 @@
+package failover
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/VanCannon/openpam/gateway/internal/models"
+	"github.com/VanCannon/openpam/pkg/logger"
+	"github.com/google/uuid"
+)
+
+type fakeStore struct {
+	events []*models.FailoverEvent
+}
+
+func (f *fakeStore) Record(ctx context.Context, event *models.FailoverEvent) error {
+	f.events = append(f.events, event)
+	return nil
+}
+
+type fakeAudit struct {
+	events []string
+}
+
+func (f *fakeAudit) CreateSimple(ctx context.Context, eventType string, userID *uuid.UUID, action string, status string, ipAddress *string, details map[string]interface{}) error {
+	f.events = append(f.events, eventType+":"+action)
+	return nil
+}
+
+func newStandby(store Store, audit AuditStore) *Monitor {
+	cfg := Config{Role: RoleStandby, Node: "gw-b", PrimaryURL: "http://gw-a", Interval: time.Second, Threshold: 3}
+	return New(cfg, store, audit, logger.New(logger.LevelError, io.Discard))
+}
+
+func TestConfig_Validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		cfg     Config
+		wantErr bool
+	}{
+		{"primary", Config{Role: RolePrimary}, false},
+		{"standby", Config{Role: RoleStandby, PrimaryURL: "http://gw-a", Interval: 10 * time.Second, Threshold: 3}, false},
+		{"unknown role", Config{Role: "replica"}, true},
+		{"standby without primary", Config{Role: RoleStandby, Interval: 10 * time.Second, Threshold: 3}, true},
+		{"probing too often", Config{Role: RoleStandby, PrimaryURL: "http://gw-a", Interval: time.Millisecond, Threshold: 3}, true},
+		{"no threshold", Config{Role: RoleStandby, PrimaryURL: "http://gw-a", Interval: 10 * time.Second}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.cfg.Validate(); (err != nil) != tt.wantErr {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestMonitor_Observe(t *testing.T) {
+	store := &fakeStore{}
+	audit := &fakeAudit{}
+	m := newStandby(store, audit)
+	ctx := context.Background()
+	now := time.Now()
+	down := errors.New("connection refused")
+
+	if m.Active() {
+		t.Fatal("standby started active")
+	}
+
+	// A passing probe resets the count of failures
+	m.Observe(ctx, down, now)
+	m.Observe(ctx, down, now)
+	m.Observe(ctx, nil, now)
+	m.Observe(ctx, down, now)
+	m.Observe(ctx, down, now)
+	if m.Active() {
+		t.Fatal("took over before three failures in a row")
+	}
+
+	m.Observe(ctx, down, now)
+	if !m.Active() {
+		t.Fatal("didn't take over after three failures in a row")
+	}
+	if status := m.Status(); status.ConsecutiveFailures != 3 || status.LastProbeError != "connection refused" || status.ChangedAt == nil {
+		t.Errorf("status = %+v, want the failures recorded", status)
+	}
+
+	m.Observe(ctx, nil, now)
+	m.Observe(ctx, nil, now)
+	m.Observe(ctx, nil, now)
+	if m.Active() {
+		t.Fatal("didn't hand back after the primary recovered")
+	}
+
+	if len(store.events) != 2 || store.events[0].ToState != StateActive || store.events[1].ToState != StatePassive {
+		t.Errorf("history = %+v, want a takeover and a handback", store.events)
+	}
+	if len(audit.events) != 2 || audit.events[0] != models.EventTypeFailover+":"+StateActive {
+		t.Errorf("audit = %v, want both changes audited", audit.events)
+	}
+}
+
+func TestMonitor_Primary(t *testing.T) {
+	m := New(Config{Role: RolePrimary}, &fakeStore{}, &fakeAudit{}, logger.New(logger.LevelError, io.Discard))
+	if m.Enabled() || !m.Active() {
+		t.Errorf("primary: enabled %v, active %v; want a disabled, active monitor", m.Enabled(), m.Active())
+	}
+	m.Start()
+	m.Stop()
+}
+
+func TestMonitor_Probe(t *testing.T) {
+	ready := true
+	primary := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/ready" || !ready {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer primary.Close()
+
+	m := newStandby(&fakeStore{}, &fakeAudit{})
+	m.config.PrimaryURL = primary.URL + "/"
+
+	if err := m.probe(context.Background()); err != nil {
+		t.Errorf("probe of a ready primary: %v", err)
+	}
+	ready = false
+	if err := m.probe(context.Background()); err == nil {
+		t.Error("probe of an unready primary passed")
+	}
+}
+
+func TestMonitor_Middleware(t *testing.T) {
+	m := newStandby(&fakeStore{}, &fakeAudit{})
+	handler := m.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	tests := []struct {
+		method, path string
+		passive      int
+	}{
+		{http.MethodGet, "/api/v1/targets", http.StatusOK},
+		{http.MethodPost, "/api/v1/targets", http.StatusServiceUnavailable},
+		{http.MethodGet, "/api/ws/connect/ssh/" + uuid.NewString(), http.StatusServiceUnavailable},
+		{http.MethodPost, "/api/v1/auth/login", http.StatusOK},
+	}
+
+	serve := func(method, path string) int {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(method, path, nil))
+		return rec.Code
+	}
+
+	for _, tt := range tests {
+		if code := serve(tt.method, tt.path); code != tt.passive {
+			t.Errorf("passive %s %s = %d, want %d", tt.method, tt.path, code, tt.passive)
+		}
+	}
+
+	for i := 0; i < 3; i++ {
+		m.Observe(context.Background(), errors.New("down"), time.Now())
+	}
+	for _, tt := range tests {
+		if code := serve(tt.method, tt.path); code != http.StatusOK {
+			t.Errorf("active %s %s = %d, want %d", tt.method, tt.path, code, http.StatusOK)
+		}
+	}
+}
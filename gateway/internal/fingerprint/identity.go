@@ -0,0 +1,83 @@
+package fingerprint
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// TokenSource creates the service tokens the identity service is called with
+type TokenSource interface {
+	GenerateServiceToken() (string, error)
+}
+
+// IdentityComputers looks up the computers the identity service synced from
+// Active Directory
+type IdentityComputers struct {
+	url    string
+	tokens TokenSource
+	client *http.Client
+}
+
+// NewIdentityComputers creates a lookup against the identity service at baseURL
+func NewIdentityComputers(baseURL string, tokens TokenSource) *IdentityComputers {
+	return &IdentityComputers{
+		url:    strings.TrimSuffix(baseURL, "/"),
+		tokens: tokens,
+		client: &http.Client{},
+	}
+}
+
+// FindComputer returns the computer whose DNS host name is host, or whose name
+// is host's first label
+func (c *IdentityComputers) FindComputer(ctx context.Context, host string) (*Computer, error) {
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+	short, _, _ := strings.Cut(host, ".")
+
+	token, err := c.tokens.GenerateServiceToken()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create service token: %w", err)
+	}
+
+	query := url.Values{"search": {short}, "limit": {"50"}}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.url+"/api/v1/ad-computers?"+query.Encode(), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to call identity service: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("identity service returned %s", resp.Status)
+	}
+
+	var result struct {
+		Computers []Computer `json:"computers"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("failed to decode AD computers: %w", err)
+	}
+
+	// A full DNS name match wins. Short names are shared across domains, so
+	// they only match computers without a DNS name, or a host given by its
+	// short name.
+	var byName *Computer
+	for i := range result.Computers {
+		computer := &result.Computers[i]
+		if strings.EqualFold(computer.DNSHostName, host) {
+			return computer, nil
+		}
+		if byName == nil && strings.EqualFold(computer.Name, short) && (computer.DNSHostName == "" || host == short) {
+			byName = computer
+		}
+	}
+	return byName, nil
+}
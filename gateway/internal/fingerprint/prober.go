@@ -0,0 +1,302 @@
+// Package fingerprint probes hosts to tell what they are before they are added
+// as targets, so admins don't have to guess the protocol, port and operating
+// system. A probe connects to a handful of ports and recognizes SSH servers by
+// their identification string and RDP servers by their answer to a connection
+// request. The operating system is taken from the host's computer object in
+// Active Directory if it has one, or else guessed from the SSH banner and the
+// ports that answered. The fingerprints of targets are kept so vulnerable
+// server versions can be reported on.
+package fingerprint
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/VanCannon/openpam/gateway/internal/models"
+	"github.com/VanCannon/openpam/pkg/logger"
+	"github.com/google/uuid"
+)
+
+// DefaultPorts are probed when no ports are given: SSH and RDP, and SMB and
+// WinRM, which tell Windows hosts apart
+var DefaultPorts = []int{22, 3389, 445, 5985}
+
+// MaxPorts is the most ports one probe may connect to
+const MaxPorts = 16
+
+// windowsPorts are open on Windows hosts and rarely elsewhere
+var windowsPorts = map[int]bool{135: true, 445: true, 5985: true, 5986: true}
+
+// Store keeps the fingerprints of targets
+type Store interface {
+	Save(ctx context.Context, targetID uuid.UUID, fp *models.Fingerprint) error
+}
+
+// Computer is a host's computer object in Active Directory
+type Computer struct {
+	Name                   string `json:"name"`
+	DNSHostName            string `json:"dns_host_name"`
+	OperatingSystem        string `json:"operating_system"`
+	OperatingSystemVersion string `json:"operating_system_version"`
+}
+
+// ComputerLookup finds the AD computer object of a host. It returns nil if the
+// host has none.
+type ComputerLookup interface {
+	FindComputer(ctx context.Context, host string) (*Computer, error)
+}
+
+// Prober fingerprints hosts
+type Prober struct {
+	store     Store
+	computers ComputerLookup // Nil when there is no directory to consult
+	timeout   time.Duration  // For each port
+	logger    *logger.Logger
+}
+
+// NewProber creates a prober. Each port is given timeout to connect and answer.
+func NewProber(store Store, computers ComputerLookup, timeout time.Duration, log *logger.Logger) *Prober {
+	return &Prober{
+		store:     store,
+		computers: computers,
+		timeout:   timeout,
+		logger:    log,
+	}
+}
+
+// Probe fingerprints host on ports, or on DefaultPorts if none are given
+func (p *Prober) Probe(ctx context.Context, host string, ports []int) *models.Fingerprint {
+	if len(ports) == 0 {
+		ports = DefaultPorts
+	}
+
+	fp := &models.Fingerprint{
+		Host:     host,
+		Services: models.ProbedServices{},
+		ProbedAt: time.Now(),
+	}
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for _, port := range dedupe(ports) {
+		wg.Add(1)
+		go func(port int) {
+			defer wg.Done()
+			if service, ok := p.probePort(ctx, host, port); ok {
+				mu.Lock()
+				fp.Services = append(fp.Services, service)
+				mu.Unlock()
+			}
+		}(port)
+	}
+	wg.Wait()
+	sort.Slice(fp.Services, func(i, j int) bool { return fp.Services[i].Port < fp.Services[j].Port })
+
+	p.guessOS(ctx, fp)
+	fp.SuggestedProtocol, fp.SuggestedPort = suggest(fp)
+	return fp
+}
+
+// ProbeTarget fingerprints a target on DefaultPorts and its own port, and
+// stores the fingerprint
+func (p *Prober) ProbeTarget(ctx context.Context, target *models.Target) (*models.Fingerprint, error) {
+	if target.Protocol != models.ProtocolSSH && target.Protocol != models.ProtocolRDP {
+		return nil, fmt.Errorf("only SSH and RDP targets can be fingerprinted")
+	}
+
+	fp := p.Probe(ctx, target.Hostname, append([]int{target.Port}, DefaultPorts...))
+	if err := p.store.Save(ctx, target.ID, fp); err != nil {
+		return nil, err
+	}
+
+	p.logger.Info("Target fingerprinted", map[string]interface{}{
+		"target_id":          target.ID.String(),
+		"target":             target.Name,
+		"services":           len(fp.Services),
+		"os":                 fp.OS,
+		"suggested_protocol": fp.SuggestedProtocol,
+		"suggested_port":     fp.SuggestedPort,
+	})
+
+	return fp, nil
+}
+
+// probePort connects to a port and works out what answers on it. It reports
+// false if the port is closed or doesn't answer.
+func (p *Prober) probePort(ctx context.Context, host string, port int) (models.ProbedService, bool) {
+	ctx, cancel := context.WithTimeout(ctx, p.timeout)
+	defer cancel()
+
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", net.JoinHostPort(host, strconv.Itoa(port)))
+	if err != nil {
+		return models.ProbedService{}, false
+	}
+	defer conn.Close()
+
+	deadline, _ := ctx.Deadline()
+	conn.SetDeadline(deadline)
+
+	service := models.ProbedService{Port: port}
+
+	// SSH servers speak first; RDP servers wait for the client
+	greeting := make([]byte, 256)
+	conn.SetReadDeadline(time.Now().Add(bannerWait(p.timeout)))
+	n, err := conn.Read(greeting)
+	if n > 0 {
+		line := firstLine(greeting[:n])
+		if strings.HasPrefix(line, "SSH-") {
+			service.Protocol = models.ProtocolSSH
+			service.Product, service.Version = parseSSHBanner(line)
+		}
+		service.Banner = line
+		return service, true
+	}
+	if netErr, ok := err.(net.Error); !ok || !netErr.Timeout() {
+		// Closed straight away, which RDP servers don't do either
+		return service, true
+	}
+
+	conn.SetDeadline(deadline)
+	if security, ok := negotiateRDP(conn); ok {
+		service.Protocol = models.ProtocolRDP
+		service.Security = security
+	}
+	return service, true
+}
+
+// bannerWait is how long a port is given to speak first
+func bannerWait(timeout time.Duration) time.Duration {
+	if wait := timeout / 2; wait < 2*time.Second {
+		return wait
+	}
+	return 2 * time.Second
+}
+
+// guessOS fills in the operating system of fp, from the most certain source
+// that knows it
+func (p *Prober) guessOS(ctx context.Context, fp *models.Fingerprint) {
+	if p.computers != nil && net.ParseIP(fp.Host) == nil {
+		computer, err := p.computers.FindComputer(ctx, fp.Host)
+		if err != nil {
+			p.logger.Warn("Failed to look up computer in Active Directory", map[string]interface{}{
+				"host":  fp.Host,
+				"error": err.Error(),
+			})
+		} else if computer != nil && computer.OperatingSystem != "" {
+			fp.OS = computer.OperatingSystem
+			fp.OSVersion = computer.OperatingSystemVersion
+			fp.OSFamily = osFamily(computer.OperatingSystem)
+			fp.OSSource = models.OSSourceActiveDirectory
+			return
+		}
+	}
+
+	for _, service := range fp.Services {
+		if service.Protocol != models.ProtocolSSH {
+			continue
+		}
+		if os, family := sshBannerOS(service.Banner); family != "" {
+			fp.OS, fp.OSFamily, fp.OSSource = os, family, models.OSSourceSSHBanner
+			return
+		}
+	}
+
+	for _, service := range fp.Services {
+		if service.Protocol == models.ProtocolRDP {
+			fp.OS, fp.OSFamily, fp.OSSource = "Windows", models.OSFamilyWindows, models.OSSourceRDP
+			return
+		}
+	}
+	for _, service := range fp.Services {
+		if windowsPorts[service.Port] {
+			fp.OS, fp.OSFamily, fp.OSSource = "Windows", models.OSFamilyWindows, models.OSSourcePorts
+			return
+		}
+	}
+}
+
+// suggest picks the protocol and port to add a host as a target with: RDP on
+// Windows hosts that have it and SSH elsewhere, on the standard port if the
+// host answers on several
+func suggest(fp *models.Fingerprint) (string, int) {
+	preferred := models.ProtocolSSH
+	if fp.OSFamily == models.OSFamilyWindows {
+		preferred = models.ProtocolRDP
+	}
+
+	var best *models.ProbedService
+	for i := range fp.Services {
+		service := &fp.Services[i]
+		if service.Protocol == "" {
+			continue
+		}
+		if best == nil || rank(service, preferred) > rank(best, preferred) {
+			best = service
+		}
+	}
+	if best == nil {
+		return "", 0
+	}
+	return best.Protocol, best.Port
+}
+
+// rank orders the services a target could be added with
+func rank(service *models.ProbedService, preferred string) int {
+	r := 0
+	if service.Protocol == preferred {
+		r += 2
+	}
+	if service.Port == standardPorts[service.Protocol] {
+		r++
+	}
+	return r
+}
+
+var standardPorts = map[string]int{models.ProtocolSSH: 22, models.ProtocolRDP: 3389}
+
+// osFamily tells the family of an operating system from its name
+func osFamily(os string) string {
+	lower := strings.ToLower(os)
+	switch {
+	case strings.Contains(lower, "windows"):
+		return models.OSFamilyWindows
+	case strings.Contains(lower, "bsd"):
+		return models.OSFamilyBSD
+	case lower != "":
+		// AD computer objects of other hosts are Linux joined with sssd or Samba
+		return models.OSFamilyLinux
+	}
+	return ""
+}
+
+// firstLine returns the first line of b, with unprintable bytes dropped
+func firstLine(b []byte) string {
+	line, _, _ := strings.Cut(string(b), "\n")
+	return strings.Map(func(r rune) rune {
+		if r < 0x20 || r == 0x7f {
+			return -1
+		}
+		return r
+	}, line)
+}
+
+// dedupe removes repeated and invalid ports, keeping the order
+func dedupe(ports []int) []int {
+	seen := make(map[int]bool, len(ports))
+	out := make([]int, 0, len(ports))
+	for _, port := range ports {
+		if port < 1 || port > 65535 || seen[port] {
+			continue
+		}
+		seen[port] = true
+		out = append(out, port)
+	}
+	return out
+}
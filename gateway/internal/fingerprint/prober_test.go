@@ -0,0 +1,212 @@
+package fingerprint
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/VanCannon/openpam/gateway/internal/models"
+	"github.com/VanCannon/openpam/pkg/logger"
+)
+
+// serve accepts connections on a local port and hands them to handle
+func serve(t *testing.T, handle func(net.Conn)) int {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen() error = %v", err)
+	}
+	t.Cleanup(func() { ln.Close() })
+
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				handle(conn)
+			}()
+		}
+	}()
+	return ln.Addr().(*net.TCPAddr).Port
+}
+
+// sshServer announces banner
+func sshServer(banner string) func(net.Conn) {
+	return func(conn net.Conn) {
+		io.WriteString(conn, banner+"\r\n")
+		io.Copy(io.Discard, conn)
+	}
+}
+
+// rdpServer answers a connection request choosing CredSSP
+func rdpServer(conn net.Conn) {
+	req := make([]byte, len(rdpConnectionRequest))
+	if _, err := io.ReadFull(conn, req); err != nil {
+		return
+	}
+	conn.Write([]byte{
+		0x03, 0x00, 0x00, 0x13,
+		0x0e, 0xd0, 0x00, 0x00, 0x12, 0x34, 0x00,
+		0x02, 0x1f, 0x08, 0x00, 0x02, 0x00, 0x00, 0x00,
+	})
+	io.Copy(io.Discard, conn)
+}
+
+// closedPort returns a port nothing listens on
+func closedPort(t *testing.T) int {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen() error = %v", err)
+	}
+	port := ln.Addr().(*net.TCPAddr).Port
+	ln.Close()
+	return port
+}
+
+type fakeComputers map[string]*Computer
+
+func (f fakeComputers) FindComputer(ctx context.Context, host string) (*Computer, error) {
+	return f[host], nil
+}
+
+func newTestProber(computers ComputerLookup) *Prober {
+	return NewProber(nil, computers, time.Second, logger.New(logger.LevelError, io.Discard))
+}
+
+func TestProbe(t *testing.T) {
+	sshPort := serve(t, sshServer("SSH-2.0-OpenSSH_8.9p1 Ubuntu-3ubuntu0.4"))
+	rdpPort := serve(t, rdpServer)
+	closed := closedPort(t)
+
+	fp := newTestProber(nil).Probe(context.Background(), "127.0.0.1", []int{rdpPort, sshPort, closed, sshPort})
+
+	if len(fp.Services) != 2 {
+		t.Fatalf("services = %+v, want the SSH and RDP ports", fp.Services)
+	}
+	for _, service := range fp.Services {
+		switch service.Port {
+		case sshPort:
+			if service.Protocol != models.ProtocolSSH || service.Product != "OpenSSH" || service.Version != "8.9p1" || service.Banner != "SSH-2.0-OpenSSH_8.9p1 Ubuntu-3ubuntu0.4" {
+				t.Errorf("SSH service = %+v", service)
+			}
+		case rdpPort:
+			if service.Protocol != models.ProtocolRDP || service.Security != "credssp" {
+				t.Errorf("RDP service = %+v", service)
+			}
+		default:
+			t.Errorf("unexpected service %+v", service)
+		}
+	}
+
+	if fp.OS != "Ubuntu" || fp.OSFamily != models.OSFamilyLinux || fp.OSSource != models.OSSourceSSHBanner {
+		t.Errorf("OS = %q (%s, from %s), want Ubuntu from the SSH banner", fp.OS, fp.OSFamily, fp.OSSource)
+	}
+	if fp.SuggestedProtocol != models.ProtocolSSH || fp.SuggestedPort != sshPort {
+		t.Errorf("suggested %s:%d, want ssh:%d", fp.SuggestedProtocol, fp.SuggestedPort, sshPort)
+	}
+}
+
+func TestProbe_ActiveDirectory(t *testing.T) {
+	sshPort := serve(t, sshServer("SSH-2.0-OpenSSH_for_Windows_9.5"))
+	rdpPort := serve(t, rdpServer)
+
+	computers := fakeComputers{"localhost": {
+		Name:                   "LOCALHOST",
+		OperatingSystem:        "Windows Server 2022 Datacenter",
+		OperatingSystemVersion: "10.0 (20348)",
+	}}
+	fp := newTestProber(computers).Probe(context.Background(), "localhost", []int{sshPort, rdpPort})
+
+	if fp.OS != "Windows Server 2022 Datacenter" || fp.OSVersion != "10.0 (20348)" || fp.OSSource != models.OSSourceActiveDirectory {
+		t.Errorf("OS = %q %q from %s, want the AD computer's", fp.OS, fp.OSVersion, fp.OSSource)
+	}
+	// Windows hosts are best reached over RDP, even with SSH running
+	if fp.SuggestedProtocol != models.ProtocolRDP || fp.SuggestedPort != rdpPort {
+		t.Errorf("suggested %s:%d, want rdp:%d", fp.SuggestedProtocol, fp.SuggestedPort, rdpPort)
+	}
+}
+
+func TestProbe_Nothing(t *testing.T) {
+	fp := newTestProber(nil).Probe(context.Background(), "127.0.0.1", []int{closedPort(t)})
+	if len(fp.Services) != 0 || fp.OS != "" || fp.SuggestedProtocol != "" {
+		t.Errorf("fingerprint of a host with nothing open = %+v", fp)
+	}
+}
+
+func TestSSHBanner(t *testing.T) {
+	tests := []struct {
+		banner  string
+		product string
+		version string
+		os      string
+		family  string
+	}{
+		{"SSH-2.0-OpenSSH_8.9p1 Ubuntu-3ubuntu0.4", "OpenSSH", "8.9p1", "Ubuntu", models.OSFamilyLinux},
+		{"SSH-2.0-OpenSSH_9.2p1 Debian-2+deb12u2", "OpenSSH", "9.2p1", "Debian", models.OSFamilyLinux},
+		{"SSH-2.0-OpenSSH_8.7", "OpenSSH", "8.7", "", ""},
+		{"SSH-2.0-OpenSSH_for_Windows_9.5", "OpenSSH_for_Windows", "9.5", "Windows", models.OSFamilyWindows},
+		{"SSH-2.0-OpenSSH_9.3 FreeBSD-20230719", "OpenSSH", "9.3", "FreeBSD", models.OSFamilyBSD},
+		{"SSH-2.0-dropbear_2022.83", "dropbear", "2022.83", "Linux", models.OSFamilyLinux},
+		{"SSH-1.99-Cisco-1.25", "Cisco", "1.25", "", ""},
+	}
+	for _, tt := range tests {
+		product, version := parseSSHBanner(tt.banner)
+		if product != tt.product || version != tt.version {
+			t.Errorf("parseSSHBanner(%q) = %q, %q, want %q, %q", tt.banner, product, version, tt.product, tt.version)
+		}
+		os, family := sshBannerOS(tt.banner)
+		if os != tt.os || family != tt.family {
+			t.Errorf("sshBannerOS(%q) = %q, %q, want %q, %q", tt.banner, os, family, tt.os, tt.family)
+		}
+	}
+}
+
+type staticToken string
+
+func (s staticToken) GenerateServiceToken() (string, error) { return string(s), nil }
+
+func TestIdentityComputers(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer svc" {
+			http.Error(w, "Authentication required", http.StatusUnauthorized)
+			return
+		}
+		if r.URL.Path != "/api/v1/ad-computers" || r.URL.Query().Get("search") != "web01" {
+			t.Errorf("request = %s", r.URL)
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"computers": []Computer{
+				{Name: "WEB01", DNSHostName: "web01.other.example.com", OperatingSystem: "Windows Server 2016"},
+				{Name: "WEB01", DNSHostName: "web01.corp.example.com", OperatingSystem: "Windows Server 2022"},
+			},
+		})
+	}))
+	defer srv.Close()
+
+	computers := NewIdentityComputers(srv.URL+"/", staticToken("svc"))
+
+	computer, err := computers.FindComputer(context.Background(), "WEB01.corp.example.com")
+	if err != nil {
+		t.Fatalf("FindComputer() error = %v", err)
+	}
+	if computer == nil || computer.OperatingSystem != "Windows Server 2022" {
+		t.Errorf("FindComputer() = %+v, want the computer with the same DNS name", computer)
+	}
+
+	computer, err = computers.FindComputer(context.Background(), "web01.lab.example.com")
+	if err != nil {
+		t.Fatalf("FindComputer() error = %v", err)
+	}
+	if computer != nil {
+		t.Errorf("FindComputer() = %+v for a host in another domain, want none", computer)
+	}
+}
@@ -0,0 +1,113 @@
+package fingerprint
+
+import (
+	"encoding/binary"
+	"io"
+	"strings"
+
+	"github.com/VanCannon/openpam/gateway/internal/models"
+)
+
+// parseSSHBanner splits an SSH identification string, such as
+// "SSH-2.0-OpenSSH_8.9p1 Ubuntu-3ubuntu0.4", into the server software and its
+// version
+func parseSSHBanner(banner string) (product, version string) {
+	// SSH-protoversion-softwareversion SP comments
+	rest := strings.TrimPrefix(banner, "SSH-")
+	_, software, ok := strings.Cut(rest, "-")
+	if !ok {
+		return "", ""
+	}
+	software, _, _ = strings.Cut(software, " ")
+	// The version follows the last underscore, as in "OpenSSH_for_Windows_9.5"
+	if i := strings.LastIndex(software, "_"); i >= 0 {
+		return software[:i], software[i+1:]
+	}
+	// Some network devices break the rules with "Cisco-1.25"
+	product, version, _ = strings.Cut(software, "-")
+	return product, version
+}
+
+// sshBannerDistributions are the distributions that name themselves in the
+// comments of their OpenSSH banner
+var sshBannerDistributions = []struct {
+	marker string
+	os     string
+	family string
+}{
+	{"ubuntu", "Ubuntu", models.OSFamilyLinux},
+	{"debian", "Debian", models.OSFamilyLinux},
+	{"raspbian", "Raspbian", models.OSFamilyLinux},
+	{"freebsd", "FreeBSD", models.OSFamilyBSD},
+	{"netbsd", "NetBSD", models.OSFamilyBSD},
+}
+
+// sshBannerOS guesses the operating system from an SSH identification string.
+// It returns an empty family if the banner doesn't give it away, as with the
+// bare "OpenSSH_8.7" of Red Hat.
+func sshBannerOS(banner string) (os, family string) {
+	lower := strings.ToLower(banner)
+	if strings.Contains(lower, "openssh_for_windows") {
+		return "Windows", models.OSFamilyWindows
+	}
+	for _, d := range sshBannerDistributions {
+		if strings.Contains(lower, d.marker) {
+			return d.os, d.family
+		}
+	}
+	if strings.Contains(lower, "dropbear") {
+		return "Linux", models.OSFamilyLinux
+	}
+	return "", ""
+}
+
+// rdpConnectionRequest is an X.224 Connection Request carrying an RDP
+// Negotiation Request for TLS or CredSSP, as an RDP client opens with
+var rdpConnectionRequest = []byte{
+	0x03, 0x00, 0x00, 0x13, // TPKT header, 19 bytes
+	0x0e, 0xe0, 0x00, 0x00, 0x00, 0x00, 0x00, // X.224 Connection Request
+	0x01, 0x00, 0x08, 0x00, 0x03, 0x00, 0x00, 0x00, // RDP_NEG_REQ: PROTOCOL_SSL | PROTOCOL_HYBRID
+}
+
+// RDP security protocols, as selected in an RDP_NEG_RSP
+var rdpSecurity = map[uint32]string{
+	0x0: "rdp",
+	0x1: "tls",
+	0x2: "credssp",
+	0x8: "credssp",
+}
+
+// negotiateRDP sends an RDP connection request on rw and reports whether the
+// answer is an RDP server's, with the security protocol the server chose
+func negotiateRDP(rw io.ReadWriter) (string, bool) {
+	if _, err := rw.Write(rdpConnectionRequest); err != nil {
+		return "", false
+	}
+
+	// TPKT header and X.224 Connection Confirm, then an optional RDP_NEG_RSP
+	// or RDP_NEG_FAILURE
+	header := make([]byte, 4)
+	if _, err := io.ReadFull(rw, header); err != nil || header[0] != 0x03 {
+		return "", false
+	}
+	length := int(binary.BigEndian.Uint16(header[2:4]))
+	if length < 11 || length > 64 {
+		return "", false
+	}
+	body := make([]byte, length-4)
+	if _, err := io.ReadFull(rw, body); err != nil || body[1] != 0xd0 {
+		return "", false
+	}
+
+	// Servers too old to negotiate answer without one and use RDP security
+	if len(body) < 15 {
+		return "rdp", true
+	}
+	switch body[7] {
+	case 0x02: // RDP_NEG_RSP
+		return rdpSecurity[binary.LittleEndian.Uint32(body[11:15])], true
+	case 0x03: // RDP_NEG_FAILURE, such as when the server only takes RDP security
+		return "", true
+	}
+	return "", true
+}
@@ -0,0 +1,147 @@
+package flightrec
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"runtime/debug"
+	"strings"
+	"time"
+
+	"github.com/VanCannon/openpam/pkg/logger"
+	"github.com/VanCannon/openpam/pkg/recovery"
+)
+
+// capture keeps up to max bytes written through it
+type capture struct {
+	buf       bytes.Buffer
+	max       int
+	truncated bool
+}
+
+func (c *capture) Write(p []byte) (int, error) {
+	if room := c.max - c.buf.Len(); room > 0 {
+		c.buf.Write(p[:min(room, len(p))])
+	}
+	if c.buf.Len()+len(p) > c.max {
+		c.truncated = true
+	}
+	return len(p), nil
+}
+
+// requestBody tees the request body into a capture as the handler reads it
+type requestBody struct {
+	io.ReadCloser
+	capture *capture
+}
+
+func (b *requestBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	b.capture.Write(p[:n])
+	return n, err
+}
+
+// responseWriter captures the status and the start of the body
+type responseWriter struct {
+	http.ResponseWriter
+	status  int
+	capture *capture
+}
+
+func (w *responseWriter) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *responseWriter) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	w.capture.Write(b)
+	return w.ResponseWriter.Write(b)
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer, so
+// streaming handlers can still flush
+func (w *responseWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// Middleware records every request not excluded. A panicking request is
+// recorded with its stack, the buffer is dumped, and the panic continues.
+func (r *Recorder) Middleware(log *logger.Logger) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			if r.excluded(req.URL.Path) {
+				next.ServeHTTP(w, req)
+				return
+			}
+
+			start := time.Now()
+			e := Exchange{
+				Time:           start,
+				RequestID:      recovery.RequestIDFromContext(req.Context()),
+				Method:         req.Method,
+				Path:           req.URL.Path,
+				Query:          redactQuery(req.URL.RawQuery),
+				RemoteAddr:     req.RemoteAddr,
+				RequestHeaders: redactHeaders(req.Header),
+			}
+
+			// WebSocket upgrades need the original writer to hijack the connection
+			if strings.EqualFold(req.Header.Get("Upgrade"), "websocket") {
+				e.Upgraded = true
+				r.Add(e)
+				next.ServeHTTP(w, req)
+				return
+			}
+
+			reqCapture := &capture{max: r.cfg.MaxBody}
+			if req.Body != nil {
+				req.Body = &requestBody{ReadCloser: req.Body, capture: reqCapture}
+			}
+			rw := &responseWriter{ResponseWriter: w, capture: &capture{max: r.cfg.MaxBody}}
+
+			defer func() {
+				e.DurationMs = time.Since(start).Milliseconds()
+				e.RequestBody = redactBody(req.Header.Get("Content-Type"), reqCapture.buf.Bytes(), reqCapture.truncated, r.cfg.MaxBody)
+				e.Status = rw.status
+				e.ResponseHeaders = redactHeaders(rw.Header())
+				e.ResponseBody = redactBody(rw.Header().Get("Content-Type"), rw.capture.buf.Bytes(), rw.capture.truncated, r.cfg.MaxBody)
+				// Plain-text error responses are the handlers' own error messages
+				if rw.status >= http.StatusBadRequest && strings.HasPrefix(rw.Header().Get("Content-Type"), "text/plain") {
+					e.ResponseBody = rw.capture.buf.String()
+				}
+
+				p := recover()
+				if p == nil {
+					r.Add(e)
+					return
+				}
+				if p == http.ErrAbortHandler {
+					r.Add(e)
+					panic(p)
+				}
+
+				e.Panic = fmt.Sprint(p)
+				e.Stack = string(debug.Stack())
+				r.Add(e)
+
+				fields := map[string]interface{}{
+					"panic": e.Panic,
+					"path":  e.Path,
+				}
+				if path, err := r.DumpToFile("panic: " + e.Panic); err == nil {
+					fields["dump"] = path
+				}
+				log.Error("Flight recorder captured panic", fields)
+				panic(p)
+			}()
+
+			next.ServeHTTP(rw, req)
+		})
+	}
+}
@@ -0,0 +1,282 @@
+// Package flightrec keeps the last API requests and responses a service
+// handled, redacted, so production issues can be debugged after the fact
+// without verbose logging.
+package flightrec
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Redacted replaces secrets in recorded exchanges
+const Redacted = "[REDACTED]"
+
+// Exchange is one recorded request and its response
+type Exchange struct {
+	Time            time.Time         `json:"time"`
+	RequestID       string            `json:"request_id,omitempty"`
+	DurationMs      int64             `json:"duration_ms"`
+	Method          string            `json:"method"`
+	Path            string            `json:"path"`
+	Query           string            `json:"query,omitempty"`
+	RemoteAddr      string            `json:"remote_addr"`
+	RequestHeaders  map[string]string `json:"request_headers,omitempty"`
+	RequestBody     string            `json:"request_body,omitempty"`
+	Status          int               `json:"status"`
+	ResponseHeaders map[string]string `json:"response_headers,omitempty"`
+	ResponseBody    string            `json:"response_body,omitempty"`
+	Upgraded        bool              `json:"upgraded,omitempty"` // WebSocket; only the request is recorded
+	Panic           string            `json:"panic,omitempty"`
+	Stack           string            `json:"stack,omitempty"`
+}
+
+// Config configures a flight recorder
+type Config struct {
+	Service string // Name reported with dumps
+	Size    int    // Exchanges kept
+	MaxBody int    // Bytes of each body kept
+	DumpDir string // Where dumps are written on panic; empty logs nothing to disk
+	Exclude []string
+}
+
+// Recorder keeps the last exchanges in a ring buffer
+type Recorder struct {
+	cfg Config
+
+	mu      sync.Mutex
+	ring    []Exchange
+	next    int
+	full    bool
+	started time.Time
+}
+
+// New creates a flight recorder
+func New(cfg Config) *Recorder {
+	if cfg.Size <= 0 {
+		cfg.Size = 200
+	}
+	if cfg.MaxBody < 0 {
+		cfg.MaxBody = 0
+	}
+	return &Recorder{
+		cfg:     cfg,
+		ring:    make([]Exchange, cfg.Size),
+		started: time.Now(),
+	}
+}
+
+// Service returns the name of the service being recorded
+func (r *Recorder) Service() string {
+	return r.cfg.Service
+}
+
+// Size returns how many exchanges the recorder keeps
+func (r *Recorder) Size() int {
+	return r.cfg.Size
+}
+
+// Add records an exchange, replacing the oldest once the buffer is full
+func (r *Recorder) Add(e Exchange) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.ring[r.next] = e
+	r.next = (r.next + 1) % len(r.ring)
+	if r.next == 0 {
+		r.full = true
+	}
+}
+
+// Snapshot returns the recorded exchanges, oldest first
+func (r *Recorder) Snapshot() []Exchange {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if !r.full {
+		return append([]Exchange(nil), r.ring[:r.next]...)
+	}
+	exchanges := make([]Exchange, 0, len(r.ring))
+	exchanges = append(exchanges, r.ring[r.next:]...)
+	return append(exchanges, r.ring[:r.next]...)
+}
+
+// Reset discards every recorded exchange
+func (r *Recorder) Reset() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.ring = make([]Exchange, len(r.ring))
+	r.next = 0
+	r.full = false
+}
+
+// Dump is the content of a dump file
+type Dump struct {
+	Service   string     `json:"service"`
+	DumpedAt  time.Time  `json:"dumped_at"`
+	Reason    string     `json:"reason"`
+	Exchanges []Exchange `json:"exchanges"`
+}
+
+// DumpToFile writes the recorded exchanges to a new file in the dump
+// directory and returns its path
+func (r *Recorder) DumpToFile(reason string) (string, error) {
+	if r.cfg.DumpDir == "" {
+		return "", fmt.Errorf("no flight recorder dump directory configured")
+	}
+
+	dump := Dump{
+		Service:   r.cfg.Service,
+		DumpedAt:  time.Now(),
+		Reason:    reason,
+		Exchanges: r.Snapshot(),
+	}
+	data, err := json.MarshalIndent(dump, "", "  ")
+	if err != nil {
+		return "", fmt.Errorf("failed to encode flight recorder dump: %w", err)
+	}
+
+	if err := os.MkdirAll(r.cfg.DumpDir, 0700); err != nil {
+		return "", fmt.Errorf("failed to create flight recorder dump directory: %w", err)
+	}
+	name := fmt.Sprintf("%s-%s.json", r.cfg.Service, dump.DumpedAt.UTC().Format("20060102T150405.000000000Z"))
+	path := filepath.Join(r.cfg.DumpDir, name)
+	if err := os.WriteFile(path, data, 0600); err != nil {
+		return "", fmt.Errorf("failed to write flight recorder dump: %w", err)
+	}
+	return path, nil
+}
+
+// excluded reports whether requests to path are not recorded
+func (r *Recorder) excluded(path string) bool {
+	for _, prefix := range r.cfg.Exclude {
+		if strings.HasPrefix(path, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// sensitiveParts are parts of header, parameter and field names whose values
+// are never recorded
+var sensitiveParts = []string{
+	"authorization", "cookie", "password", "passphrase", "secret", "token",
+	"private_key", "privatekey", "api_key", "apikey", "api-key",
+}
+
+// sensitiveNames are whole names whose values are never recorded, such as
+// OAuth authorization codes
+var sensitiveNames = map[string]bool{
+	"code":  true,
+	"state": true,
+	"otp":   true,
+	"key":   true,
+}
+
+// sensitive reports whether a value named name must be redacted
+func sensitive(name string) bool {
+	name = strings.ToLower(name)
+	if sensitiveNames[name] {
+		return true
+	}
+	for _, s := range sensitiveParts {
+		if strings.Contains(name, s) {
+			return true
+		}
+	}
+	return false
+}
+
+// redactHeaders flattens headers, redacting sensitive ones
+func redactHeaders(h http.Header) map[string]string {
+	if len(h) == 0 {
+		return nil
+	}
+	headers := make(map[string]string, len(h))
+	for name, values := range h {
+		if sensitive(name) {
+			headers[name] = Redacted
+			continue
+		}
+		headers[name] = strings.Join(values, ", ")
+	}
+	return headers
+}
+
+// redactQuery redacts sensitive query parameters
+func redactQuery(raw string) string {
+	if raw == "" {
+		return ""
+	}
+	values, err := url.ParseQuery(raw)
+	if err != nil {
+		return Redacted
+	}
+	for name := range values {
+		if sensitive(name) {
+			values[name] = []string{Redacted}
+		}
+	}
+	return values.Encode()
+}
+
+// redactBody returns a body as recorded. JSON bodies are kept with sensitive
+// fields redacted; other content is summarized, as it can't be redacted.
+func redactBody(contentType string, body []byte, truncated bool, maxBody int) string {
+	if len(body) == 0 {
+		return ""
+	}
+	if !strings.Contains(contentType, "json") {
+		return fmt.Sprintf("[%s body not recorded]", contentTypeOrUnknown(contentType))
+	}
+	if truncated {
+		// Partial JSON can't be parsed, so its fields can't be redacted
+		return fmt.Sprintf("[JSON body over %d bytes not recorded]", maxBody)
+	}
+
+	var v interface{}
+	if err := json.Unmarshal(body, &v); err != nil {
+		return "[invalid JSON body not recorded]"
+	}
+	data, err := json.Marshal(redactValue(v))
+	if err != nil {
+		return "[JSON body not recorded]"
+	}
+	return string(data)
+}
+
+// redactValue redacts sensitive fields at any depth of a decoded JSON value
+func redactValue(v interface{}) interface{} {
+	switch t := v.(type) {
+	case map[string]interface{}:
+		for k, child := range t {
+			if sensitive(k) {
+				t[k] = Redacted
+			} else {
+				t[k] = redactValue(child)
+			}
+		}
+	case []interface{}:
+		for i, child := range t {
+			t[i] = redactValue(child)
+		}
+	}
+	return v
+}
+
+func contentTypeOrUnknown(contentType string) string {
+	if contentType == "" {
+		return "unknown"
+	}
+	if i := strings.Index(contentType, ";"); i >= 0 {
+		contentType = contentType[:i]
+	}
+	return contentType
+}
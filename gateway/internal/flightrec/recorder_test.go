@@ -0,0 +1,105 @@
+package flightrec
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/VanCannon/openpam/pkg/logger"
+)
+
+func TestRecorder_Ring(t *testing.T) {
+	r := New(Config{Size: 3})
+	for _, path := range []string{"/a", "/b", "/c", "/d"} {
+		r.Add(Exchange{Path: path})
+	}
+
+	got := r.Snapshot()
+	if len(got) != 3 || got[0].Path != "/b" || got[2].Path != "/d" {
+		t.Errorf("Snapshot() = %+v, want /b to /d", got)
+	}
+
+	r.Reset()
+	if got := r.Snapshot(); len(got) != 0 {
+		t.Errorf("Snapshot() after Reset() = %d exchanges", len(got))
+	}
+}
+
+func TestMiddleware_Redacts(t *testing.T) {
+	r := New(Config{Size: 10, MaxBody: 1024})
+	handler := r.Middleware(logger.New(logger.LevelError, io.Discard))(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		io.ReadAll(req.Body)
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Set-Cookie", "openpam_token=abc")
+		w.Write([]byte(`{"id":"1","credential":{"username":"root","password":"hunter2"}}`))
+	}))
+
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/credentials/create?token=abc&target_id=1", strings.NewReader(`{"username":"root","password":"hunter2","private_key":"-----BEGIN"}`))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer abc")
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+
+	got := r.Snapshot()
+	if len(got) != 1 {
+		t.Fatalf("Snapshot() = %d exchanges, want 1", len(got))
+	}
+	e := got[0]
+	data, _ := json.Marshal(e)
+	for _, secret := range []string{"hunter2", "BEGIN", "Bearer abc", "token=abc", "openpam_token=abc"} {
+		if strings.Contains(string(data), secret) {
+			t.Errorf("exchange contains %q: %s", secret, data)
+		}
+	}
+	if e.Status != http.StatusOK || !strings.Contains(e.RequestBody, `"username":"root"`) || !strings.Contains(e.Query, "target_id=1") {
+		t.Errorf("exchange = %+v, want status, username and target_id kept", e)
+	}
+}
+
+func TestMiddleware_TruncatedAndExcluded(t *testing.T) {
+	r := New(Config{Size: 10, MaxBody: 8, Exclude: []string{"/health"}})
+	handler := r.Middleware(logger.New(logger.LevelError, io.Discard))(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"password":"a long secret value"}`))
+	}))
+
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/health", nil))
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/api/v1/x", nil))
+
+	got := r.Snapshot()
+	if len(got) != 1 || got[0].Path != "/api/v1/x" {
+		t.Fatalf("Snapshot() = %+v, want only /api/v1/x", got)
+	}
+	// A cut JSON body can't be redacted, so none of it is kept
+	if strings.Contains(got[0].ResponseBody, "password") {
+		t.Errorf("ResponseBody = %q, want it withheld", got[0].ResponseBody)
+	}
+}
+
+func TestMiddleware_DumpsOnPanic(t *testing.T) {
+	dir := t.TempDir()
+	r := New(Config{Service: "gateway", Size: 10, DumpDir: dir})
+	handler := r.Middleware(logger.New(logger.LevelError, io.Discard))(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		panic("boom")
+	}))
+
+	func() {
+		defer func() {
+			if p := recover(); p != "boom" {
+				t.Errorf("recover() = %v, want the panic to continue", p)
+			}
+		}()
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/api/v1/x", nil))
+	}()
+
+	entries, _ := os.ReadDir(dir)
+	if len(entries) != 1 {
+		t.Fatalf("dump files = %d, want 1", len(entries))
+	}
+	if got := r.Snapshot(); len(got) != 1 || got[0].Panic != "boom" || got[0].Stack == "" {
+		t.Errorf("Snapshot() = %+v, want the panic recorded", got)
+	}
+}
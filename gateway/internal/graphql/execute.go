@@ -0,0 +1,616 @@
+package graphql
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Request is a GraphQL request as clients post it
+type Request struct {
+	Query         string                 `json:"query"`
+	OperationName string                 `json:"operationName"`
+	Variables     map[string]interface{} `json:"variables"`
+}
+
+// Error is an error in a response. Path locates the field that failed.
+type Error struct {
+	Message string        `json:"message"`
+	Path    []interface{} `json:"path,omitempty"`
+}
+
+func (e *Error) Error() string {
+	return e.Message
+}
+
+// Response is the result of a request. Data is nil when the request was
+// rejected before execution, in which case Errors says why.
+type Response struct {
+	Data   interface{} `json:"data,omitempty"`
+	Errors []*Error    `json:"errors,omitempty"`
+}
+
+// Execute parses, validates and runs a query
+func (s *Schema) Execute(ctx context.Context, req Request) *Response {
+	doc, err := Parse(req.Query)
+	if err != nil {
+		return &Response{Errors: []*Error{{Message: err.Error()}}}
+	}
+
+	op, err := selectOperation(doc, req.OperationName)
+	if err != nil {
+		return &Response{Errors: []*Error{{Message: err.Error()}}}
+	}
+
+	e := &executor{schema: s, doc: doc}
+	if err := e.variables(op, req.Variables); err != nil {
+		return &Response{Errors: []*Error{{Message: err.Error()}}}
+	}
+	e.validate(s.Query, op.Selections, 1, make(map[string]string), nil)
+	if len(e.errors) > 0 {
+		return &Response{Errors: e.errors}
+	}
+
+	data := newOrderedMap()
+	e.object(ctx, s.Query, []*node{{out: data}}, op.Selections)
+	return &Response{Data: data, Errors: e.errors}
+}
+
+func selectOperation(doc *Document, name string) (*Operation, error) {
+	var op *Operation
+	if name == "" {
+		if len(doc.Operations) != 1 {
+			return nil, fmt.Errorf("operationName is required when the document has several operations")
+		}
+		op = doc.Operations[0]
+	} else {
+		for _, o := range doc.Operations {
+			if o.Name == name {
+				op = o
+				break
+			}
+		}
+		if op == nil {
+			return nil, fmt.Errorf("unknown operation %q", name)
+		}
+	}
+	if op.Type != "query" {
+		return nil, fmt.Errorf("only queries are supported")
+	}
+	return op, nil
+}
+
+type executor struct {
+	schema   *Schema
+	doc      *Document
+	declared map[string]*Scalar
+	vars     map[string]interface{}
+	errors   []*Error
+	tooDeep  bool
+}
+
+func (e *executor) fail(path []interface{}, format string, args ...interface{}) {
+	e.errors = append(e.errors, &Error{Message: fmt.Sprintf(format, args...), Path: path})
+}
+
+var scalars = map[string]*Scalar{
+	ID.Name:      ID,
+	String.Name:  String,
+	Int.Name:     Int,
+	Boolean.Name: Boolean,
+	Time.Name:    Time,
+}
+
+// variables coerces the request's variables to the types the operation
+// declares
+func (e *executor) variables(op *Operation, values map[string]interface{}) error {
+	e.declared = make(map[string]*Scalar)
+	e.vars = make(map[string]interface{})
+	for _, def := range op.Variables {
+		typ, ok := scalars[strings.TrimSuffix(def.Type, "!")]
+		if !ok {
+			return fmt.Errorf("variable $%s has unsupported type %s", def.Name, def.Type)
+		}
+		e.declared[def.Name] = typ
+
+		v, ok := values[def.Name]
+		if !ok && def.Default != nil {
+			v, ok, _ = e.literal(def.Default)
+		}
+		if v == nil && strings.HasSuffix(def.Type, "!") {
+			return fmt.Errorf("variable $%s of required type %s was not provided", def.Name, def.Type)
+		}
+		if !ok {
+			continue
+		}
+		c, err := coerce(typ, v)
+		if err != nil {
+			return fmt.Errorf("variable $%s: %v", def.Name, err)
+		}
+		e.vars[def.Name] = c
+	}
+	return nil
+}
+
+// validate checks a selection set against its object type. keys maps each
+// response key in the set to the field it selects, so fragments can't reuse
+// a key for another field.
+func (e *executor) validate(obj *Object, selections []Selection, depth int, keys map[string]string, spreading []string) {
+	for _, sel := range selections {
+		switch sel := sel.(type) {
+		case *FieldSelection:
+			e.validateDirectives(sel.Directives)
+			if name, ok := keys[sel.ResponseKey()]; ok && name != sel.Name {
+				e.fail(nil, "fields %s and %s both use the response key %s", name, sel.Name, sel.ResponseKey())
+			}
+			keys[sel.ResponseKey()] = sel.Name
+
+			if sel.Name == "__typename" {
+				if sel.Selections != nil {
+					e.fail(nil, "field %s.__typename must not have a selection of subfields", obj.Name)
+				}
+				continue
+			}
+			def := obj.Field(sel.Name)
+			if def == nil {
+				e.fail(nil, "cannot query field %s on type %s", sel.Name, obj.Name)
+				continue
+			}
+			if _, err := e.arguments(def, sel.Arguments); err != nil {
+				e.fail(nil, "field %s.%s: %v", obj.Name, def.Name, err)
+			}
+			if e.schema.MaxDepth > 0 && depth > e.schema.MaxDepth {
+				if !e.tooDeep {
+					e.tooDeep = true
+					e.fail(nil, "query exceeds the maximum depth of %d", e.schema.MaxDepth)
+				}
+				continue
+			}
+
+			child, isObject := named(def.Type).(*Object)
+			switch {
+			case isObject && sel.Selections == nil:
+				e.fail(nil, "field %s.%s of type %s must have a selection of subfields", obj.Name, def.Name, def.Type)
+			case !isObject && sel.Selections != nil:
+				e.fail(nil, "field %s.%s of type %s must not have a selection of subfields", obj.Name, def.Name, def.Type)
+			case isObject:
+				e.validate(child, sel.Selections, depth+1, make(map[string]string), spreading)
+			}
+
+		case *FragmentSpread:
+			e.validateDirectives(sel.Directives)
+			frag, ok := e.doc.Fragments[sel.Name]
+			if !ok {
+				e.fail(nil, "unknown fragment %s", sel.Name)
+				continue
+			}
+			for _, name := range spreading {
+				if name == sel.Name {
+					e.fail(nil, "fragment %s spreads itself", sel.Name)
+					return
+				}
+			}
+			if frag.TypeCondition != obj.Name {
+				e.fail(nil, "fragment %s on %s cannot be spread within %s", frag.Name, frag.TypeCondition, obj.Name)
+				continue
+			}
+			e.validate(obj, frag.Selections, depth, keys, append(spreading[:len(spreading):len(spreading)], sel.Name))
+
+		case *InlineFragment:
+			e.validateDirectives(sel.Directives)
+			if sel.TypeCondition != "" && sel.TypeCondition != obj.Name {
+				e.fail(nil, "fragment on %s cannot be spread within %s", sel.TypeCondition, obj.Name)
+				continue
+			}
+			e.validate(obj, sel.Selections, depth, keys, spreading)
+		}
+	}
+}
+
+func (e *executor) validateDirectives(directives []*Directive) {
+	for _, d := range directives {
+		if d.Name != "skip" && d.Name != "include" {
+			e.fail(nil, "unknown directive @%s", d.Name)
+			continue
+		}
+		if _, err := e.condition(d); err != nil {
+			e.fail(nil, "directive @%s: %v", d.Name, err)
+		}
+	}
+}
+
+func (e *executor) condition(d *Directive) (bool, error) {
+	if len(d.Arguments) != 1 || d.Arguments[0].Name != "if" {
+		return false, fmt.Errorf("expected a single if argument")
+	}
+	v, _, err := e.literal(d.Arguments[0].Value)
+	if err != nil {
+		return false, err
+	}
+	b, ok := v.(bool)
+	if !ok {
+		return false, fmt.Errorf("if must be a Boolean")
+	}
+	return b, nil
+}
+
+// included reports whether @skip and @include let a selection through
+func (e *executor) included(directives []*Directive) bool {
+	for _, d := range directives {
+		cond, _ := e.condition(d)
+		if d.Name == "skip" && cond || d.Name == "include" && !cond {
+			return false
+		}
+	}
+	return true
+}
+
+// arguments coerces a field's arguments, applying the defaults of those
+// absent
+func (e *executor) arguments(def *Field, args []*Argument) (Args, error) {
+	out := make(Args)
+	for _, a := range def.Args {
+		if a.Default != nil {
+			out[a.Name] = a.Default
+		}
+	}
+	for _, arg := range args {
+		var a *Arg
+		for _, candidate := range def.Args {
+			if candidate.Name == arg.Name {
+				a = candidate
+			}
+		}
+		if a == nil {
+			return nil, fmt.Errorf("unknown argument %s", arg.Name)
+		}
+		v, ok, err := e.literal(arg.Value)
+		if err != nil {
+			return nil, fmt.Errorf("argument %s: %v", arg.Name, err)
+		}
+		if !ok {
+			continue
+		}
+		c, err := coerce(a.Type, v)
+		if err != nil {
+			return nil, fmt.Errorf("argument %s: %v", arg.Name, err)
+		}
+		if c == nil {
+			delete(out, a.Name)
+			continue
+		}
+		out[a.Name] = c
+	}
+	return out, nil
+}
+
+// literal converts a document value to a Go value. ok is false for variables
+// the request left unset.
+func (e *executor) literal(v *Value) (value interface{}, ok bool, err error) {
+	switch v.Kind {
+	case ValueVariable:
+		if _, declared := e.declared[v.Raw]; !declared {
+			return nil, false, fmt.Errorf("variable $%s is not defined", v.Raw)
+		}
+		value, ok = e.vars[v.Raw]
+		return value, ok, nil
+	case ValueInt:
+		n, err := strconv.ParseInt(v.Raw, 10, 64)
+		if err != nil {
+			return nil, false, fmt.Errorf("invalid Int %s", v.Raw)
+		}
+		return float64(n), true, nil
+	case ValueFloat:
+		f, err := strconv.ParseFloat(v.Raw, 64)
+		if err != nil {
+			return nil, false, fmt.Errorf("invalid Float %s", v.Raw)
+		}
+		return f, true, nil
+	case ValueString:
+		return v.Raw, true, nil
+	case ValueBoolean:
+		return v.Raw == "true", true, nil
+	case ValueNull:
+		return nil, true, nil
+	}
+	return nil, false, fmt.Errorf("enum, list and object values are not supported")
+}
+
+// coerce converts an input value, as decoded from JSON, to a scalar type.
+// Values already coerced, such as variables passed on to arguments, are kept.
+func coerce(typ *Scalar, v interface{}) (interface{}, error) {
+	if v == nil {
+		return nil, nil
+	}
+	switch typ {
+	case ID:
+		switch v := v.(type) {
+		case string:
+			return v, nil
+		case int:
+			return strconv.Itoa(v), nil
+		case float64:
+			if v == math.Trunc(v) {
+				return strconv.FormatFloat(v, 'f', -1, 64), nil
+			}
+		}
+	case String:
+		if s, ok := v.(string); ok {
+			return s, nil
+		}
+	case Int:
+		if n, ok := v.(int); ok {
+			return n, nil
+		}
+		if f, ok := v.(float64); ok && f == math.Trunc(f) && f >= math.MinInt32 && f <= math.MaxInt32 {
+			return int(f), nil
+		}
+	case Boolean:
+		if b, ok := v.(bool); ok {
+			return b, nil
+		}
+	case Time:
+		if t, ok := v.(time.Time); ok {
+			return t, nil
+		}
+		if s, ok := v.(string); ok {
+			t, err := time.Parse(time.RFC3339, s)
+			if err != nil {
+				return nil, fmt.Errorf("expected an RFC 3339 timestamp")
+			}
+			return t, nil
+		}
+	default:
+		return v, nil
+	}
+	return nil, fmt.Errorf("expected %s", typ.Name)
+}
+
+// named unwraps lists down to the named type
+func named(t Type) Type {
+	for {
+		l, ok := t.(*List)
+		if !ok {
+			return t
+		}
+		t = l.Of
+	}
+}
+
+// node is an object in the result: its source, where it sits and the map its
+// fields are written to
+type node struct {
+	source interface{}
+	path   []interface{}
+	out    *orderedMap
+}
+
+// group is the fields a selection set selects under one response key
+type group struct {
+	key    string
+	fields []*FieldSelection
+}
+
+// collect flattens a selection set into groups, following fragments and
+// dropping what @skip and @include exclude
+func (e *executor) collect(selections []Selection, groups *[]*group, index map[string]*group) {
+	for _, sel := range selections {
+		switch sel := sel.(type) {
+		case *FieldSelection:
+			if !e.included(sel.Directives) {
+				continue
+			}
+			if g, ok := index[sel.ResponseKey()]; ok {
+				g.fields = append(g.fields, sel)
+				continue
+			}
+			g := &group{key: sel.ResponseKey(), fields: []*FieldSelection{sel}}
+			index[g.key] = g
+			*groups = append(*groups, g)
+		case *FragmentSpread:
+			if e.included(sel.Directives) {
+				e.collect(e.doc.Fragments[sel.Name].Selections, groups, index)
+			}
+		case *InlineFragment:
+			if e.included(sel.Directives) {
+				e.collect(sel.Selections, groups, index)
+			}
+		}
+	}
+}
+
+// object resolves a selection set for every node of an object type, one
+// field at a time
+func (e *executor) object(ctx context.Context, obj *Object, nodes []*node, selections []Selection) {
+	var groups []*group
+	e.collect(selections, &groups, make(map[string]*group))
+
+	for _, g := range groups {
+		field := g.fields[0]
+		if field.Name == "__typename" {
+			for _, n := range nodes {
+				n.out.set(g.key, obj.Name)
+			}
+			continue
+		}
+
+		def := obj.Field(field.Name)
+		args, _ := e.arguments(def, field.Arguments)
+		values, err := resolve(ctx, def, nodes, args)
+		if err != nil {
+			for _, n := range nodes {
+				n.out.set(g.key, nil)
+				e.fail(extend(n.path, g.key), "%v", err)
+			}
+			continue
+		}
+
+		var children []*node
+		for i, n := range nodes {
+			n.out.set(g.key, complete(def.Type, values[i], extend(n.path, g.key), &children))
+		}
+		if len(children) > 0 {
+			var sub []Selection
+			for _, f := range g.fields {
+				sub = append(sub, f.Selections...)
+			}
+			e.object(ctx, named(def.Type).(*Object), children, sub)
+		}
+	}
+}
+
+func resolve(ctx context.Context, def *Field, nodes []*node, args Args) ([]interface{}, error) {
+	sources := make([]interface{}, len(nodes))
+	for i, n := range nodes {
+		sources[i] = n.source
+	}
+
+	if def.Batch != nil {
+		values, err := def.Batch(ctx, sources, args)
+		if err == nil && len(values) != len(sources) {
+			err = fmt.Errorf("%s resolved %d values for %d objects", def.Name, len(values), len(sources))
+		}
+		return values, err
+	}
+
+	values := make([]interface{}, len(sources))
+	for i, source := range sources {
+		if def.Resolve == nil {
+			values[i] = structField(source, def.Name)
+			continue
+		}
+		v, err := def.Resolve(ctx, source, args)
+		if err != nil {
+			return nil, err
+		}
+		values[i] = v
+	}
+	return values, nil
+}
+
+// complete shapes a resolved value to its type. Objects get an empty map,
+// filled in once every object at this level is known, and are added to
+// children.
+func complete(t Type, v interface{}, path []interface{}, children *[]*node) interface{} {
+	if isNil(v) {
+		return nil
+	}
+	switch t := t.(type) {
+	case *Object:
+		out := newOrderedMap()
+		*children = append(*children, &node{source: v, path: path, out: out})
+		return out
+	case *List:
+		rv := reflect.ValueOf(v)
+		if rv.Kind() != reflect.Slice && rv.Kind() != reflect.Array {
+			return nil
+		}
+		items := make([]interface{}, rv.Len())
+		for i := range items {
+			items[i] = complete(t.Of, rv.Index(i).Interface(), extend(path, i), children)
+		}
+		return items
+	}
+	if rv := reflect.ValueOf(v); rv.Kind() == reflect.Pointer {
+		return rv.Elem().Interface()
+	}
+	return v
+}
+
+func isNil(v interface{}) bool {
+	if v == nil {
+		return true
+	}
+	switch rv := reflect.ValueOf(v); rv.Kind() {
+	case reflect.Pointer, reflect.Map, reflect.Slice, reflect.Interface:
+		return rv.IsNil()
+	}
+	return false
+}
+
+func extend(path []interface{}, elem interface{}) []interface{} {
+	out := make([]interface{}, len(path), len(path)+1)
+	copy(out, path)
+	return append(out, elem)
+}
+
+// jsonFields caches the struct field index of each JSON name by type
+var jsonFields sync.Map
+
+// structField returns the field of a struct, or of a pointer to one, whose
+// JSON name is name
+func structField(source interface{}, name string) interface{} {
+	rv := reflect.ValueOf(source)
+	for rv.Kind() == reflect.Pointer {
+		if rv.IsNil() {
+			return nil
+		}
+		rv = rv.Elem()
+	}
+	if rv.Kind() != reflect.Struct {
+		return nil
+	}
+
+	cached, ok := jsonFields.Load(rv.Type())
+	if !ok {
+		fields := make(map[string]int)
+		for i := 0; i < rv.NumField(); i++ {
+			f := rv.Type().Field(i)
+			tag, _, _ := strings.Cut(f.Tag.Get("json"), ",")
+			if f.IsExported() && tag != "" && tag != "-" {
+				fields[tag] = i
+			}
+		}
+		cached, _ = jsonFields.LoadOrStore(rv.Type(), fields)
+	}
+	i, ok := cached.(map[string]int)[name]
+	if !ok {
+		return nil
+	}
+	return rv.Field(i).Interface()
+}
+
+// orderedMap is a result object, which keeps its fields in the order the
+// query selects them
+type orderedMap struct {
+	keys   []string
+	values map[string]interface{}
+}
+
+func newOrderedMap() *orderedMap {
+	return &orderedMap{values: make(map[string]interface{})}
+}
+
+func (m *orderedMap) set(key string, value interface{}) {
+	if _, ok := m.values[key]; !ok {
+		m.keys = append(m.keys, key)
+	}
+	m.values[key] = value
+}
+
+func (m *orderedMap) MarshalJSON() ([]byte, error) {
+	var b bytes.Buffer
+	b.WriteByte('{')
+	for i, key := range m.keys {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		k, _ := json.Marshal(key)
+		b.Write(k)
+		b.WriteByte(':')
+		v, err := json.Marshal(m.values[key])
+		if err != nil {
+			return nil, err
+		}
+		b.Write(v)
+	}
+	b.WriteByte('}')
+	return b.Bytes(), nil
+}
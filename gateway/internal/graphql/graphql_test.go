@@ -0,0 +1,196 @@
+package graphql
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+type zone struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+type target struct {
+	ID          string  `json:"id"`
+	Name        string  `json:"name"`
+	ZoneID      string  `json:"zone_id"`
+	Description *string `json:"description,omitempty"`
+}
+
+// testSchema serves targets and their zones, counting the zone fetches
+func testSchema(zoneFetches *int) *Schema {
+	zones := map[string]*zone{"z1": {ID: "z1", Name: "Hub"}, "z2": {ID: "z2", Name: "Lab"}}
+	desc := "primary"
+	targets := []*target{
+		{ID: "t1", Name: "db", ZoneID: "z1", Description: &desc},
+		{ID: "t2", Name: "web", ZoneID: "z2"},
+		{ID: "t3", Name: "cache", ZoneID: "z1"},
+	}
+
+	zoneType := &Object{Name: "Zone", Fields: []*Field{
+		{Name: "id", Type: ID},
+		{Name: "name", Type: String},
+	}}
+	targetType := &Object{Name: "Target"}
+	targetType.Fields = []*Field{
+		{Name: "id", Type: ID},
+		{Name: "name", Type: String},
+		{Name: "description", Type: String},
+		{Name: "zone", Type: zoneType, Batch: func(ctx context.Context, sources []interface{}, args Args) ([]interface{}, error) {
+			*zoneFetches++
+			values := make([]interface{}, len(sources))
+			for i, s := range sources {
+				values[i] = zones[s.(*target).ZoneID]
+			}
+			return values, nil
+		}},
+	}
+
+	return &Schema{MaxDepth: 3, Query: &Object{Name: "Query", Fields: []*Field{
+		{
+			Name: "targets",
+			Type: &List{Of: targetType},
+			Args: []*Arg{{Name: "limit", Type: Int, Default: 10}, {Name: "name", Type: String}},
+			Resolve: func(ctx context.Context, source interface{}, args Args) (interface{}, error) {
+				limit, _ := args.Int("limit")
+				var out []*target
+				for _, t := range targets {
+					if len(out) < limit && (args.String("name") == "" || t.Name == args.String("name")) {
+						out = append(out, t)
+					}
+				}
+				return out, nil
+			},
+		},
+	}}}
+}
+
+func run(t *testing.T, s *Schema, req Request) (string, []*Error) {
+	t.Helper()
+	resp := s.Execute(context.Background(), req)
+	if resp.Data == nil {
+		return "", resp.Errors
+	}
+	data, err := json.Marshal(resp.Data)
+	if err != nil {
+		t.Fatalf("marshal: %v", err)
+	}
+	return string(data), resp.Errors
+}
+
+func TestExecute_Batches(t *testing.T) {
+	var fetches int
+	data, errs := run(t, testSchema(&fetches), Request{Query: `
+		query List($n: Int) {
+			targets(limit: $n) { id ...names home: zone { name } }
+			__typename
+		}
+		fragment names on Target { name, description }
+	`, Variables: map[string]interface{}{"n": 2.0}})
+
+	if len(errs) > 0 {
+		t.Fatalf("errors: %v", errs[0])
+	}
+	want := `{"targets":[{"id":"t1","name":"db","description":"primary","home":{"name":"Hub"}},` +
+		`{"id":"t2","name":"web","description":null,"home":{"name":"Lab"}}],"__typename":"Query"}`
+	if data != want {
+		t.Errorf("data = %s\nwant %s", data, want)
+	}
+	if fetches != 1 {
+		t.Errorf("zones fetched %d times, want once for all targets", fetches)
+	}
+}
+
+func TestExecute_Directives(t *testing.T) {
+	var fetches int
+	data, errs := run(t, testSchema(&fetches), Request{
+		Query:     `query($skip: Boolean!) { targets(name: "web") { name zone @skip(if: $skip) { id } } }`,
+		Variables: map[string]interface{}{"skip": true},
+	})
+	if len(errs) > 0 || data != `{"targets":[{"name":"web"}]}` || fetches != 0 {
+		t.Errorf("data = %s, errors %v, fetches %d", data, errs, fetches)
+	}
+}
+
+func TestExecute_Rejects(t *testing.T) {
+	var fetches int
+	s := testSchema(&fetches)
+	tests := map[string]string{
+		`{ targets { name `:                                      "syntax error",
+		`mutation { targets { id } }`:                            "only queries",
+		`{ targets { secret } }`:                                 "cannot query field secret",
+		`{ targets }`:                                            "must have a selection",
+		`{ targets { name { id } } }`:                            "must not have a selection",
+		`{ targets(limit: "ten") { id } }`:                       "expected Int",
+		`{ targets(owner: "me") { id } }`:                        "unknown argument owner",
+		`{ targets(limit: $n) { id } }`:                          "$n is not defined",
+		`{ targets { ...a } } fragment a on Target { ...a }`:     "spreads itself",
+		`{ targets { ...z } } fragment z on Zone { id }`:         "cannot be spread",
+		`{ targets { id: name } }`:                               "", // an alias on its own is fine
+		`{ targets { a: id a: name } }`:                          "both use the response key",
+		`query($n: Int!) { targets(limit: $n) { id } }`:          "was not provided",
+		`{ targets { zone { id } } } query Other { __typename }`: "operationName is required",
+	}
+	for query, want := range tests {
+		_, errs := run(t, s, Request{Query: query})
+		if want == "" {
+			if len(errs) > 0 {
+				t.Errorf("%s: unexpected error %v", query, errs[0])
+			}
+			continue
+		}
+		if len(errs) == 0 || !strings.Contains(errs[0].Message, want) {
+			t.Errorf("%s: errors %v, want %q", query, errs, want)
+		}
+	}
+	if fetches != 0 {
+		t.Errorf("rejected queries fetched zones %d times", fetches)
+	}
+}
+
+func TestExecute_MaxDepth(t *testing.T) {
+	var fetches int
+	s := testSchema(&fetches)
+	s.MaxDepth = 2
+	if _, errs := run(t, s, Request{Query: `{ targets { zone { id } } }`}); len(errs) == 0 || !strings.Contains(errs[0].Message, "maximum depth of 2") {
+		t.Errorf("errors = %v, want depth error", errs)
+	}
+	if _, errs := run(t, s, Request{Query: `{ targets { id } }`}); len(errs) > 0 {
+		t.Errorf("errors = %v", errs[0])
+	}
+}
+
+func TestLoader(t *testing.T) {
+	var calls [][]string
+	l := NewLoader(func(ctx context.Context, keys []string) (map[string]int, error) {
+		calls = append(calls, keys)
+		found := make(map[string]int)
+		for _, k := range keys {
+			if k != "missing" {
+				found[k] = len(k)
+			}
+		}
+		return found, nil
+	})
+
+	values, _ := l.LoadMany(context.Background(), []string{"a", "bb", "a", "missing"})
+	if len(values) != 4 || values[0] != 1 || values[1] != 2 || values[2] != 1 || values[3] != 0 {
+		t.Errorf("values = %v", values)
+	}
+	l.LoadMany(context.Background(), []string{"bb", "ccc"})
+	if len(calls) != 2 || len(calls[0]) != 3 || len(calls[1]) != 1 || calls[1][0] != "ccc" {
+		t.Errorf("fetches = %v, want cached keys skipped", calls)
+	}
+}
+
+func TestSDL(t *testing.T) {
+	var fetches int
+	sdl := testSchema(&fetches).SDL()
+	for _, want := range []string{"type Query {", "targets(limit: Int = 10, name: String): [Target]", "type Zone {"} {
+		if !strings.Contains(sdl, want) {
+			t.Errorf("SDL missing %q:\n%s", want, sdl)
+		}
+	}
+}
@@ -0,0 +1,54 @@
+package graphql
+
+import (
+	"context"
+	"sync"
+)
+
+// Loader fetches values by key in batches and caches them for the life of a
+// request, so the same record selected through different fields is fetched
+// once
+type Loader[K comparable, V any] struct {
+	fetch func(ctx context.Context, keys []K) (map[K]V, error)
+
+	mu    sync.Mutex
+	cache map[K]V
+}
+
+// NewLoader creates a loader. fetch returns the values it found; keys it
+// leaves out load as the zero value.
+func NewLoader[K comparable, V any](fetch func(ctx context.Context, keys []K) (map[K]V, error)) *Loader[K, V] {
+	return &Loader[K, V]{fetch: fetch, cache: make(map[K]V)}
+}
+
+// LoadMany returns the value of each key, in order, fetching those not yet
+// cached in a single call
+func (l *Loader[K, V]) LoadMany(ctx context.Context, keys []K) ([]V, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	var missing []K
+	seen := make(map[K]bool)
+	for _, k := range keys {
+		if _, ok := l.cache[k]; !ok && !seen[k] {
+			seen[k] = true
+			missing = append(missing, k)
+		}
+	}
+
+	if len(missing) > 0 {
+		found, err := l.fetch(ctx, missing)
+		if err != nil {
+			return nil, err
+		}
+		for _, k := range missing {
+			l.cache[k] = found[k]
+		}
+	}
+
+	values := make([]V, len(keys))
+	for i, k := range keys {
+		values[i] = l.cache[k]
+	}
+	return values, nil
+}
@@ -0,0 +1,518 @@
+package graphql
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// Document is a parsed GraphQL request document
+type Document struct {
+	Operations []*Operation
+	Fragments  map[string]*Fragment
+}
+
+// Operation is a query, mutation or subscription
+type Operation struct {
+	Type       string // "query", "mutation" or "subscription"
+	Name       string
+	Variables  []*VariableDef
+	Selections []Selection
+}
+
+// VariableDef declares an operation variable
+type VariableDef struct {
+	Name    string
+	Type    string
+	Default *Value
+}
+
+// Fragment is a named fragment definition
+type Fragment struct {
+	Name          string
+	TypeCondition string
+	Selections    []Selection
+}
+
+// Selection is a *FieldSelection, *FragmentSpread or *InlineFragment
+type Selection interface{}
+
+// FieldSelection selects a field, optionally under an alias
+type FieldSelection struct {
+	Alias      string
+	Name       string
+	Arguments  []*Argument
+	Directives []*Directive
+	Selections []Selection
+}
+
+// ResponseKey is the name of the field in the response
+func (f *FieldSelection) ResponseKey() string {
+	if f.Alias != "" {
+		return f.Alias
+	}
+	return f.Name
+}
+
+// FragmentSpread includes a named fragment
+type FragmentSpread struct {
+	Name       string
+	Directives []*Directive
+}
+
+// InlineFragment includes selections in place
+type InlineFragment struct {
+	TypeCondition string
+	Directives    []*Directive
+	Selections    []Selection
+}
+
+// Argument is a named argument value
+type Argument struct {
+	Name  string
+	Value *Value
+}
+
+// Directive such as @skip or @include
+type Directive struct {
+	Name      string
+	Arguments []*Argument
+}
+
+// Value kinds
+const (
+	ValueVariable = iota
+	ValueInt
+	ValueFloat
+	ValueString
+	ValueBoolean
+	ValueNull
+	ValueEnum
+	ValueList
+	ValueObject
+)
+
+// Value is a literal or variable in a document
+type Value struct {
+	Kind   int
+	Raw    string // Variable name, or the literal's text
+	List   []*Value
+	Fields []*Argument
+}
+
+// SyntaxError is a document that doesn't parse
+type SyntaxError struct {
+	Pos     int
+	Message string
+}
+
+func (e *SyntaxError) Error() string {
+	return fmt.Sprintf("syntax error at offset %d: %s", e.Pos, e.Message)
+}
+
+// Token kinds
+const (
+	tokEOF = iota
+	tokPunct
+	tokName
+	tokInt
+	tokFloat
+	tokString
+)
+
+type token struct {
+	kind  int
+	value string
+	pos   int
+}
+
+type parser struct {
+	src string
+	pos int
+	tok token
+}
+
+// Parse parses a request document
+func Parse(src string) (doc *Document, err error) {
+	p := &parser{src: src}
+	defer func() {
+		if r := recover(); r != nil {
+			se, ok := r.(*SyntaxError)
+			if !ok {
+				panic(r)
+			}
+			doc, err = nil, se
+		}
+	}()
+
+	p.next()
+	doc = &Document{Fragments: make(map[string]*Fragment)}
+	for p.tok.kind != tokEOF {
+		switch {
+		case p.peek(tokPunct, "{"):
+			doc.Operations = append(doc.Operations, &Operation{Type: "query", Selections: p.selectionSet()})
+		case p.peek(tokName, "fragment"):
+			p.next()
+			f := &Fragment{Name: p.name()}
+			p.expectName("on")
+			f.TypeCondition = p.name()
+			p.directives()
+			f.Selections = p.selectionSet()
+			if _, ok := doc.Fragments[f.Name]; ok {
+				p.fail("duplicate fragment %q", f.Name)
+			}
+			doc.Fragments[f.Name] = f
+		case p.peek(tokName, "query"), p.peek(tokName, "mutation"), p.peek(tokName, "subscription"):
+			op := &Operation{Type: p.tok.value}
+			p.next()
+			if p.tok.kind == tokName {
+				op.Name = p.name()
+			}
+			if p.skip(tokPunct, "(") {
+				for !p.skip(tokPunct, ")") {
+					op.Variables = append(op.Variables, p.variableDef())
+				}
+			}
+			p.directives()
+			op.Selections = p.selectionSet()
+			doc.Operations = append(doc.Operations, op)
+		default:
+			p.fail("unexpected %q", p.tok.value)
+		}
+	}
+	if len(doc.Operations) == 0 {
+		p.fail("no operation")
+	}
+	return doc, nil
+}
+
+func (p *parser) fail(format string, args ...interface{}) {
+	panic(&SyntaxError{Pos: p.tok.pos, Message: fmt.Sprintf(format, args...)})
+}
+
+func (p *parser) peek(kind int, value string) bool {
+	return p.tok.kind == kind && p.tok.value == value
+}
+
+func (p *parser) skip(kind int, value string) bool {
+	if p.peek(kind, value) {
+		p.next()
+		return true
+	}
+	return false
+}
+
+func (p *parser) expect(value string) {
+	if !p.skip(tokPunct, value) {
+		p.fail("expected %q, found %q", value, p.tok.value)
+	}
+}
+
+func (p *parser) expectName(value string) {
+	if !p.skip(tokName, value) {
+		p.fail("expected %q, found %q", value, p.tok.value)
+	}
+}
+
+func (p *parser) name() string {
+	if p.tok.kind != tokName {
+		p.fail("expected a name, found %q", p.tok.value)
+	}
+	name := p.tok.value
+	p.next()
+	return name
+}
+
+func (p *parser) variableDef() *VariableDef {
+	p.expect("$")
+	v := &VariableDef{Name: p.name()}
+	p.expect(":")
+	v.Type = p.typeRef()
+	if p.skip(tokPunct, "=") {
+		v.Default = p.value(true)
+	}
+	p.directives()
+	return v
+}
+
+func (p *parser) typeRef() string {
+	var t string
+	if p.skip(tokPunct, "[") {
+		t = "[" + p.typeRef() + "]"
+		p.expect("]")
+	} else {
+		t = p.name()
+	}
+	if p.skip(tokPunct, "!") {
+		t += "!"
+	}
+	return t
+}
+
+func (p *parser) selectionSet() []Selection {
+	p.expect("{")
+	var selections []Selection
+	for !p.skip(tokPunct, "}") {
+		if p.tok.kind == tokEOF {
+			p.fail("unterminated selection set")
+		}
+		selections = append(selections, p.selection())
+	}
+	if len(selections) == 0 {
+		p.fail("empty selection set")
+	}
+	return selections
+}
+
+func (p *parser) selection() Selection {
+	if p.skip(tokPunct, "...") {
+		if p.tok.kind == tokName && p.tok.value != "on" {
+			return &FragmentSpread{Name: p.name(), Directives: p.directives()}
+		}
+		f := &InlineFragment{}
+		if p.skip(tokName, "on") {
+			f.TypeCondition = p.name()
+		}
+		f.Directives = p.directives()
+		f.Selections = p.selectionSet()
+		return f
+	}
+
+	f := &FieldSelection{Name: p.name()}
+	if p.skip(tokPunct, ":") {
+		f.Alias, f.Name = f.Name, p.name()
+	}
+	f.Arguments = p.arguments(false)
+	f.Directives = p.directives()
+	if p.peek(tokPunct, "{") {
+		f.Selections = p.selectionSet()
+	}
+	return f
+}
+
+func (p *parser) arguments(constant bool) []*Argument {
+	if !p.skip(tokPunct, "(") {
+		return nil
+	}
+	var args []*Argument
+	for !p.skip(tokPunct, ")") {
+		a := &Argument{Name: p.name()}
+		p.expect(":")
+		a.Value = p.value(constant)
+		args = append(args, a)
+	}
+	return args
+}
+
+func (p *parser) directives() []*Directive {
+	var directives []*Directive
+	for p.skip(tokPunct, "@") {
+		directives = append(directives, &Directive{Name: p.name(), Arguments: p.arguments(false)})
+	}
+	return directives
+}
+
+func (p *parser) value(constant bool) *Value {
+	tok := p.tok
+	switch {
+	case p.skip(tokPunct, "$"):
+		if constant {
+			p.fail("variable not allowed here")
+		}
+		return &Value{Kind: ValueVariable, Raw: p.name()}
+	case p.skip(tokPunct, "["):
+		v := &Value{Kind: ValueList}
+		for !p.skip(tokPunct, "]") {
+			if p.tok.kind == tokEOF {
+				p.fail("unterminated list")
+			}
+			v.List = append(v.List, p.value(constant))
+		}
+		return v
+	case p.skip(tokPunct, "{"):
+		v := &Value{Kind: ValueObject}
+		for !p.skip(tokPunct, "}") {
+			a := &Argument{Name: p.name()}
+			p.expect(":")
+			a.Value = p.value(constant)
+			v.Fields = append(v.Fields, a)
+		}
+		return v
+	}
+
+	p.next()
+	switch tok.kind {
+	case tokInt:
+		return &Value{Kind: ValueInt, Raw: tok.value}
+	case tokFloat:
+		return &Value{Kind: ValueFloat, Raw: tok.value}
+	case tokString:
+		return &Value{Kind: ValueString, Raw: tok.value}
+	case tokName:
+		switch tok.value {
+		case "true", "false":
+			return &Value{Kind: ValueBoolean, Raw: tok.value}
+		case "null":
+			return &Value{Kind: ValueNull}
+		}
+		return &Value{Kind: ValueEnum, Raw: tok.value}
+	}
+	p.pos = tok.pos
+	p.tok = tok
+	p.fail("unexpected %q", tok.value)
+	return nil
+}
+
+// next reads the next token, skipping whitespace, commas and comments
+func (p *parser) next() {
+	for p.pos < len(p.src) {
+		c := p.src[p.pos]
+		if c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == ',' {
+			p.pos++
+		} else if c == '#' {
+			for p.pos < len(p.src) && p.src[p.pos] != '\n' && p.src[p.pos] != '\r' {
+				p.pos++
+			}
+		} else if strings.HasPrefix(p.src[p.pos:], "\uFEFF") {
+			p.pos += len("\uFEFF")
+		} else {
+			break
+		}
+	}
+
+	start := p.pos
+	if p.pos >= len(p.src) {
+		p.tok = token{kind: tokEOF, pos: start}
+		return
+	}
+
+	c := p.src[p.pos]
+	switch {
+	case strings.HasPrefix(p.src[p.pos:], "..."):
+		p.pos += 3
+		p.tok = token{kind: tokPunct, value: "...", pos: start}
+	case strings.IndexByte("!$&()/:=@[]{|}", c) >= 0:
+		p.pos++
+		p.tok = token{kind: tokPunct, value: string(c), pos: start}
+	case c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z':
+		for p.pos < len(p.src) && isNameChar(p.src[p.pos]) {
+			p.pos++
+		}
+		p.tok = token{kind: tokName, value: p.src[start:p.pos], pos: start}
+	case c == '-' || c >= '0' && c <= '9':
+		p.number()
+	case c == '"':
+		p.string()
+	default:
+		r, _ := utf8.DecodeRuneInString(p.src[p.pos:])
+		p.tok = token{kind: tokPunct, value: string(r), pos: start}
+		p.fail("unexpected character %q", r)
+	}
+}
+
+func isNameChar(c byte) bool {
+	return c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9'
+}
+
+func (p *parser) number() {
+	start := p.pos
+	float := false
+	if p.src[p.pos] == '-' {
+		p.pos++
+	}
+	digits := func() {
+		n := p.pos
+		for p.pos < len(p.src) && p.src[p.pos] >= '0' && p.src[p.pos] <= '9' {
+			p.pos++
+		}
+		if p.pos == n {
+			p.tok = token{pos: start, value: p.src[start:p.pos]}
+			p.fail("invalid number")
+		}
+	}
+	digits()
+	if p.pos < len(p.src) && p.src[p.pos] == '.' {
+		float = true
+		p.pos++
+		digits()
+	}
+	if p.pos < len(p.src) && (p.src[p.pos] == 'e' || p.src[p.pos] == 'E') {
+		float = true
+		p.pos++
+		if p.pos < len(p.src) && (p.src[p.pos] == '+' || p.src[p.pos] == '-') {
+			p.pos++
+		}
+		digits()
+	}
+	kind := tokInt
+	if float {
+		kind = tokFloat
+	}
+	p.tok = token{kind: kind, value: p.src[start:p.pos], pos: start}
+}
+
+// string reads a quoted string. Block strings are not supported.
+func (p *parser) string() {
+	start := p.pos
+	if strings.HasPrefix(p.src[p.pos:], `"""`) {
+		p.tok = token{pos: start, value: `"""`}
+		p.fail("block strings are not supported")
+	}
+	p.pos++
+
+	var b strings.Builder
+	for {
+		if p.pos >= len(p.src) || p.src[p.pos] == '\n' || p.src[p.pos] == '\r' {
+			p.tok = token{pos: start, value: p.src[start:p.pos]}
+			p.fail("unterminated string")
+		}
+		c := p.src[p.pos]
+		if c == '"' {
+			p.pos++
+			break
+		}
+		if c != '\\' {
+			b.WriteByte(c)
+			p.pos++
+			continue
+		}
+
+		if p.pos+1 >= len(p.src) {
+			p.tok = token{pos: start, value: p.src[start:]}
+			p.fail("unterminated string")
+		}
+		esc := p.src[p.pos+1]
+		p.pos += 2
+		switch esc {
+		case '"', '\\', '/':
+			b.WriteByte(esc)
+		case 'b':
+			b.WriteByte('\b')
+		case 'f':
+			b.WriteByte('\f')
+		case 'n':
+			b.WriteByte('\n')
+		case 'r':
+			b.WriteByte('\r')
+		case 't':
+			b.WriteByte('\t')
+		case 'u':
+			if p.pos+4 > len(p.src) {
+				p.tok = token{pos: start, value: p.src[start:]}
+				p.fail("invalid unicode escape")
+			}
+			r, err := strconv.ParseUint(p.src[p.pos:p.pos+4], 16, 32)
+			if err != nil {
+				p.tok = token{pos: start, value: p.src[start:p.pos]}
+				p.fail("invalid unicode escape")
+			}
+			b.WriteRune(rune(r))
+			p.pos += 4
+		default:
+			p.tok = token{pos: start, value: p.src[start:p.pos]}
+			p.fail("invalid escape \\%c", esc)
+		}
+	}
+	p.tok = token{kind: tokString, value: b.String(), pos: start}
+}
@@ -0,0 +1,192 @@
+// Package graphql is a small, query-only GraphQL engine. It resolves each
+// field once for every object at its level of the result, so a field backed
+// by a repository costs one query however many objects select it.
+package graphql
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Type is a *Scalar, *Object or *List
+type Type interface {
+	String() string
+	isType()
+}
+
+// Scalar is a leaf type
+type Scalar struct {
+	Name        string
+	Description string
+}
+
+// Built-in scalars. Time is an RFC 3339 string.
+var (
+	ID      = &Scalar{Name: "ID"}
+	String  = &Scalar{Name: "String"}
+	Int     = &Scalar{Name: "Int"}
+	Boolean = &Scalar{Name: "Boolean"}
+	Time    = &Scalar{Name: "Time", Description: "An RFC 3339 timestamp"}
+)
+
+func (s *Scalar) String() string { return s.Name }
+func (s *Scalar) isType()        {}
+
+// Object is a type with fields. Fields may be set after the object is created,
+// so objects can refer to each other.
+type Object struct {
+	Name        string
+	Description string
+	Fields      []*Field
+}
+
+func (o *Object) String() string { return o.Name }
+func (o *Object) isType()        {}
+
+// Field returns the named field, or nil
+func (o *Object) Field(name string) *Field {
+	for _, f := range o.Fields {
+		if f.Name == name {
+			return f
+		}
+	}
+	return nil
+}
+
+// List is a list of another type
+type List struct {
+	Of Type
+}
+
+func (l *List) String() string { return "[" + l.Of.String() + "]" }
+func (l *List) isType()        {}
+
+// Field is a field of an object. Batch resolves the field for every source at
+// once and must return a value for each, in order; Resolve resolves it for
+// one. With neither, the value is the source's struct field with the same
+// JSON name.
+type Field struct {
+	Name        string
+	Description string
+	Type        Type
+	Args        []*Arg
+	Resolve     func(ctx context.Context, source interface{}, args Args) (interface{}, error)
+	Batch       func(ctx context.Context, sources []interface{}, args Args) ([]interface{}, error)
+}
+
+// Arg is an argument of a field
+type Arg struct {
+	Name        string
+	Description string
+	Type        *Scalar
+	Default     interface{}
+}
+
+// Args are the coerced arguments of a field: strings for ID and String, int
+// for Int, bool for Boolean and time.Time for Time. Absent arguments without
+// a default, and explicit nulls, are missing.
+type Args map[string]interface{}
+
+// String returns a string argument, or ""
+func (a Args) String(name string) string {
+	s, _ := a[name].(string)
+	return s
+}
+
+// Int returns an Int argument
+func (a Args) Int(name string) (int, bool) {
+	n, ok := a[name].(int)
+	return n, ok
+}
+
+// Bool returns a Boolean argument, or false
+func (a Args) Bool(name string) bool {
+	b, _ := a[name].(bool)
+	return b
+}
+
+// Time returns a Time argument
+func (a Args) Time(name string) (time.Time, bool) {
+	t, ok := a[name].(time.Time)
+	return t, ok
+}
+
+// Schema is the query root and the limits placed on requests
+type Schema struct {
+	Query *Object
+	// MaxDepth is the deepest nesting of selections a query may have, the
+	// root fields being at depth 1. Zero means no limit.
+	MaxDepth int
+}
+
+// SDL prints the schema in the GraphQL schema definition language
+func (s *Schema) SDL() string {
+	var objects []*Object
+	var scalars []*Scalar
+	seen := make(map[Type]bool)
+	var walk func(t Type)
+	walk = func(t Type) {
+		switch t := t.(type) {
+		case *List:
+			walk(t.Of)
+			return
+		case *Scalar:
+			if !seen[t] && t != ID && t != String && t != Int && t != Boolean {
+				scalars = append(scalars, t)
+			}
+		case *Object:
+			if !seen[t] {
+				seen[t] = true
+				objects = append(objects, t)
+				for _, f := range t.Fields {
+					walk(f.Type)
+					for _, a := range f.Args {
+						walk(a.Type)
+					}
+				}
+			}
+		}
+		seen[t] = true
+	}
+	walk(s.Query)
+
+	var b strings.Builder
+	b.WriteString("schema {\n  query: " + s.Query.Name + "\n}\n")
+	for _, sc := range scalars {
+		b.WriteString("\n")
+		writeDescription(&b, "", sc.Description)
+		b.WriteString("scalar " + sc.Name + "\n")
+	}
+	for _, o := range objects {
+		b.WriteString("\n")
+		writeDescription(&b, "", o.Description)
+		b.WriteString("type " + o.Name + " {\n")
+		for _, f := range o.Fields {
+			writeDescription(&b, "  ", f.Description)
+			b.WriteString("  " + f.Name)
+			if len(f.Args) > 0 {
+				args := make([]string, len(f.Args))
+				for i, a := range f.Args {
+					args[i] = a.Name + ": " + a.Type.Name
+					if s, ok := a.Default.(string); ok {
+						args[i] += fmt.Sprintf(" = %q", s)
+					} else if a.Default != nil {
+						args[i] += fmt.Sprintf(" = %v", a.Default)
+					}
+				}
+				b.WriteString("(" + strings.Join(args, ", ") + ")")
+			}
+			b.WriteString(": " + f.Type.String() + "\n")
+		}
+		b.WriteString("}\n")
+	}
+	return b.String()
+}
+
+func writeDescription(b *strings.Builder, indent, description string) {
+	if description != "" {
+		fmt.Fprintf(b, "%s%q\n", indent, description)
+	}
+}
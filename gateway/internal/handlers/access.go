@@ -0,0 +1,303 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/VanCannon/openpam/gateway/internal/license"
+	"github.com/VanCannon/openpam/gateway/internal/middleware"
+	"github.com/VanCannon/openpam/gateway/internal/models"
+	"github.com/VanCannon/openpam/gateway/internal/policy"
+	"github.com/VanCannon/openpam/gateway/internal/repository"
+	"github.com/VanCannon/openpam/gateway/internal/settings"
+	"github.com/VanCannon/openpam/pkg/logger"
+	"github.com/google/uuid"
+)
+
+// AccessHandler explains whether a user can connect to a target, going
+// through the checks a connection goes through
+type AccessHandler struct {
+	userRepo     *repository.UserRepository
+	targetRepo   *repository.TargetRepository
+	credRepo     *repository.CredentialRepository
+	scheduleRepo *repository.ScheduleRepository
+	banners      *repository.BannerRepository
+	policy       *policy.Engine
+	settings     *settings.Resolver
+	license      *license.Monitor
+	logger       *logger.Logger
+}
+
+// NewAccessHandler creates a new access handler
+func NewAccessHandler(
+	userRepo *repository.UserRepository,
+	targetRepo *repository.TargetRepository,
+	credRepo *repository.CredentialRepository,
+	scheduleRepo *repository.ScheduleRepository,
+	banners *repository.BannerRepository,
+	policyEngine *policy.Engine,
+	settingsResolver *settings.Resolver,
+	licenseMonitor *license.Monitor,
+	log *logger.Logger,
+) *AccessHandler {
+	return &AccessHandler{
+		userRepo:     userRepo,
+		targetRepo:   targetRepo,
+		credRepo:     credRepo,
+		scheduleRepo: scheduleRepo,
+		banners:      banners,
+		policy:       policyEngine,
+		settings:     settingsResolver,
+		license:      licenseMonitor,
+		logger:       log,
+	}
+}
+
+// Access checks, in the order connections make them
+const (
+	AccessCheckLicense  = "license"
+	AccessCheckPolicy   = "policy"
+	AccessCheckCred     = "credential"
+	AccessCheckProtocol = "protocol"
+	AccessCheckPurpose  = "purpose"
+	AccessCheckBanner   = "banner"
+	AccessCheckSchedule = "schedule"
+)
+
+// accessCheck is the outcome of one check. Source names the setting or rule
+// behind it and is only shown to admins.
+type accessCheck struct {
+	Name   string `json:"name"`
+	Passed bool   `json:"passed"`
+	Detail string `json:"detail"`
+	Source string `json:"source,omitempty"`
+}
+
+// accessExplanation is the response of the explain endpoint
+type accessExplanation struct {
+	UserID       uuid.UUID     `json:"user_id"`
+	TargetID     uuid.UUID     `json:"target_id"`
+	Protocol     string        `json:"protocol"`
+	CredentialID *uuid.UUID    `json:"credential_id,omitempty"`
+	Allowed      bool          `json:"allowed"`
+	Checks       []accessCheck `json:"checks"`
+	Policy       *policy.Trace `json:"policy"`
+	Redacted     bool          `json:"redacted"`
+}
+
+// HandleExplain explains whether a user can connect to a target now. Users
+// ask about themselves and get a redacted trace; admins may ask about anyone
+// with ?user= and see everything.
+// Route: GET /api/v1/access/explain?user=&target=&protocol=&credential_id=
+func (h *AccessHandler) HandleExplain() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		query := r.URL.Query()
+
+		callerID, err := uuid.Parse(middleware.GetUserID(ctx))
+		if err != nil {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		isAdmin := middleware.GetUserRole(ctx) == models.RoleAdmin
+
+		// Callers are explained with the role they connect with, which may be
+		// an elevated one; other users with their stored role
+		subject := policy.Subject{UserID: callerID, Role: middleware.GetUserRole(ctx)}
+		if s := query.Get("user"); s != "" {
+			userID, err := uuid.Parse(s)
+			if err != nil {
+				http.Error(w, "Invalid user ID", http.StatusBadRequest)
+				return
+			}
+			if userID != callerID {
+				if !isAdmin {
+					http.Error(w, "Forbidden", http.StatusForbidden)
+					return
+				}
+				user, err := h.userRepo.GetByID(ctx, userID)
+				if err != nil {
+					http.Error(w, "User not found", http.StatusNotFound)
+					return
+				}
+				subject = policy.Subject{UserID: user.ID, Role: user.Role}
+			}
+		}
+
+		targetID, err := uuid.Parse(query.Get("target"))
+		if err != nil {
+			http.Error(w, "Invalid target ID", http.StatusBadRequest)
+			return
+		}
+		target, err := h.targetRepo.GetByID(ctx, targetID)
+		if err != nil {
+			http.Error(w, "Target not found", http.StatusNotFound)
+			return
+		}
+
+		var requested *uuid.UUID
+		if s := query.Get("credential_id"); s != "" {
+			id, err := uuid.Parse(s)
+			if err != nil {
+				http.Error(w, "Invalid credential ID", http.StatusBadRequest)
+				return
+			}
+			requested = &id
+		}
+
+		protocol := query.Get("protocol")
+		if protocol == "" {
+			protocol = target.Protocol
+		}
+
+		exp, err := h.explain(r, subject, target, protocol, requested)
+		if err != nil {
+			h.logger.Error("Failed to explain access", map[string]interface{}{
+				"user_id":   subject.UserID.String(),
+				"target_id": target.ID.String(),
+				"error":     err.Error(),
+			})
+			http.Error(w, "Failed to explain access", http.StatusInternalServerError)
+			return
+		}
+		if !isAdmin {
+			redactExplanation(exp)
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(exp)
+	}
+}
+
+// explain runs the subject's connection to the target through the checks of
+// the connection handler. Checks that depend on a credential are skipped when
+// none can be chosen.
+func (h *AccessHandler) explain(r *http.Request, subject policy.Subject, target *models.Target, protocol string, requested *uuid.UUID) (*accessExplanation, error) {
+	ctx := r.Context()
+	now := time.Now()
+	exp := &accessExplanation{
+		UserID:   subject.UserID,
+		TargetID: target.ID,
+		Protocol: protocol,
+		Checks:   []accessCheck{},
+	}
+	check := func(name string, passed bool, detail, source string) {
+		exp.Checks = append(exp.Checks, accessCheck{Name: name, Passed: passed, Detail: detail, Source: source})
+	}
+
+	if h.license.AllowsSession(protocol, now) {
+		check(AccessCheckLicense, true, "The license allows "+protocol+" sessions", "")
+	} else {
+		check(AccessCheckLicense, false, "New "+protocol+" sessions are disabled by the license", string(h.license.Status(now).Mode))
+	}
+
+	creds, err := h.credRepo.GetByTargetID(ctx, target.ID)
+	if err != nil {
+		return nil, err
+	}
+	exp.Policy, err = h.policy.Explain(ctx, subject, target, creds, now)
+	if err != nil {
+		return nil, err
+	}
+	check(AccessCheckPolicy, exp.Policy.Allowed, exp.Policy.Reason, "")
+
+	// The credential is chosen from the allowed ones the way connections choose it
+	allowedIDs := make(map[uuid.UUID]bool)
+	for _, ct := range exp.Policy.Credentials {
+		allowedIDs[ct.CredentialID] = ct.Allowed
+	}
+	var allowed []*models.Credential
+	for _, cred := range creds {
+		if allowedIDs[cred.ID] {
+			allowed = append(allowed, cred)
+		}
+	}
+
+	var cred *models.Credential
+	if exp.Policy.Allowed {
+		cred, err = policy.SelectCredential(allowed, requested)
+		switch {
+		case errors.Is(err, policy.ErrAmbiguousCredential):
+			check(AccessCheckCred, true, "More than one credential is allowed; the connection has to choose one", "")
+		case err != nil:
+			check(AccessCheckCred, false, err.Error(), "")
+		case cred.Quarantined():
+			check(AccessCheckCred, false, errCredentialQuarantined, "")
+		default:
+			check(AccessCheckCred, true, "Connects as "+cred.Username, "")
+		}
+	}
+
+	if cred != nil && !cred.Quarantined() {
+		exp.CredentialID = &cred.ID
+
+		eff, err := h.settings.Resolve(ctx, subject, target, cred)
+		if err != nil {
+			return nil, err
+		}
+
+		if eff.Allows(protocol) {
+			check(AccessCheckProtocol, true, "Sessions may use "+protocol, eff.Sources["allowed_protocols"])
+		} else {
+			check(AccessCheckProtocol, false, "Protocol not allowed for this target", eff.Sources["allowed_protocols"])
+		}
+
+		if eff.RequirePurpose {
+			check(AccessCheckPurpose, true, "A session purpose must be given when connecting", eff.Sources["require_purpose"])
+		}
+
+		if eff.RequiresAcknowledgment() {
+			ack, err := h.banners.Latest(ctx, subject.UserID, target.ID, eff.BannerVersion, now.Add(-models.BannerAcknowledgmentTTL))
+			if err != nil {
+				return nil, err
+			}
+			if ack != nil {
+				check(AccessCheckBanner, true, "The banner has been acknowledged", eff.Sources["banner_required"])
+			} else {
+				check(AccessCheckBanner, false, "The target's banner must be acknowledged before connecting", eff.Sources["banner_required"])
+			}
+		}
+	}
+
+	// Sessions don't need a schedule window, but those opened in one end with it
+	end, err := h.scheduleRepo.ActiveWindowEnd(ctx, subject.UserID, target.ID, now)
+	if err != nil {
+		return nil, err
+	}
+	if end != nil {
+		check(AccessCheckSchedule, true, "Sessions end with the schedule window at "+end.UTC().Format(time.RFC3339), "")
+	} else {
+		check(AccessCheckSchedule, true, "No schedule window is active; sessions aren't bound to one", "")
+	}
+
+	exp.Allowed = true
+	for _, c := range exp.Checks {
+		exp.Allowed = exp.Allowed && c.Passed
+	}
+	return exp, nil
+}
+
+// redactExplanation hides what an explanation says about other subjects and
+// the configuration: rules that don't apply to the user, rule IDs and the
+// sources of checks
+func redactExplanation(exp *accessExplanation) {
+	exp.Redacted = true
+	for i := range exp.Checks {
+		exp.Checks[i].Source = ""
+	}
+	if exp.Policy == nil {
+		return
+	}
+	for i := range exp.Policy.Credentials {
+		ct := &exp.Policy.Credentials[i]
+		rules := []policy.RuleTrace{}
+		for _, rt := range ct.Rules {
+			if rt.Applies {
+				rules = append(rules, policy.RuleTrace{Name: rt.Name, Effect: rt.Effect, Applies: true})
+			}
+		}
+		ct.Rules = rules
+	}
+}
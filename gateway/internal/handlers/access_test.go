@@ -0,0 +1,33 @@
+package handlers
+
+import (
+	"testing"
+
+	"github.com/VanCannon/openpam/gateway/internal/models"
+	"github.com/VanCannon/openpam/gateway/internal/policy"
+	"github.com/google/uuid"
+)
+
+func TestRedactExplanation(t *testing.T) {
+	applies, other := uuid.New(), uuid.New()
+	exp := &accessExplanation{
+		Checks: []accessCheck{{Name: AccessCheckProtocol, Passed: false, Source: "policy:Only SSH"}},
+		Policy: &policy.Trace{Credentials: []policy.CredentialTrace{{
+			Decision: policy.DecisionDenied,
+			Rules: []policy.RuleTrace{
+				{RuleID: &applies, Name: "Not contractors", Effect: models.RuleEffectDeny, Applies: true},
+				{RuleID: &other, Name: "Alice uses root", Effect: models.RuleEffectAllow, Reason: "rule is for another user"},
+			},
+		}}},
+	}
+
+	redactExplanation(exp)
+
+	if !exp.Redacted || exp.Checks[0].Source != "" {
+		t.Errorf("got %+v, want the check's source removed", exp.Checks[0])
+	}
+	rules := exp.Policy.Credentials[0].Rules
+	if len(rules) != 1 || rules[0].Name != "Not contractors" || rules[0].RuleID != nil {
+		t.Errorf("got %+v, want only the applying rule, without its ID", rules)
+	}
+}
@@ -0,0 +1,273 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/VanCannon/openpam/gateway/internal/analytics"
+	"github.com/VanCannon/openpam/gateway/internal/i18n"
+	"github.com/VanCannon/openpam/gateway/internal/models"
+	"github.com/VanCannon/openpam/gateway/internal/repository"
+	"github.com/VanCannon/openpam/pkg/logger"
+	"github.com/google/uuid"
+)
+
+// maxAnalyticsPeriod is the longest period analytics are reported over
+const maxAnalyticsPeriod = 366 * 24 * time.Hour
+
+// AnalyticsHandler reports target utilization, team access patterns and
+// approval turnaround from the analytics views
+type AnalyticsHandler struct {
+	repo      *repository.AnalyticsRepository
+	refresher *analytics.Refresher
+	working   analytics.WorkingHours
+	logger    *logger.Logger
+}
+
+// NewAnalyticsHandler creates a new analytics handler
+func NewAnalyticsHandler(repo *repository.AnalyticsRepository, refresher *analytics.Refresher, working analytics.WorkingHours, log *logger.Logger) *AnalyticsHandler {
+	return &AnalyticsHandler{
+		repo:      repo,
+		refresher: refresher,
+		working:   working,
+		logger:    log,
+	}
+}
+
+// analyticsPeriod parses the from and to query parameters, which default to
+// the last 30 days
+func analyticsPeriod(r *http.Request) (from, to time.Time, err error) {
+	q := r.URL.Query()
+
+	to = time.Now()
+	if v := q.Get("to"); v != "" {
+		if to, err = time.Parse(time.RFC3339, v); err != nil {
+			return from, to, errors.New("Invalid to time")
+		}
+	}
+	from = to.AddDate(0, 0, -30)
+	if v := q.Get("from"); v != "" {
+		if from, err = time.Parse(time.RFC3339, v); err != nil {
+			return from, to, errors.New("Invalid from time")
+		}
+	}
+
+	if !to.After(from) {
+		return from, to, errors.New("to must be after from")
+	}
+	if to.Sub(from) > maxAnalyticsPeriod {
+		return from, to, errors.New("Period can be at most 366 days")
+	}
+	return from, to, nil
+}
+
+// refreshedAt returns when view was last refreshed, or nil if it never was
+func (h *AnalyticsHandler) refreshedAt(ctx context.Context, view string) *time.Time {
+	refreshes, err := h.repo.Refreshes(ctx)
+	if err != nil {
+		h.logger.Warn("Failed to look up analytics refreshes", map[string]interface{}{
+			"error": err.Error(),
+		})
+		return nil
+	}
+	for _, refresh := range refreshes {
+		if refresh.View == view {
+			return &refresh.RefreshedAt
+		}
+	}
+	return nil
+}
+
+// HandleUtilization returns session use by hour of the week in the tz time
+// zone, and the most-used targets. target_id, zone_id and group_id narrow it
+// to a target, a zone's targets or a group's members.
+// Route: GET /api/v1/analytics/utilization
+func (h *AnalyticsHandler) HandleUtilization() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+
+		from, to, err := analyticsPeriod(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		loc, err := displayLocation(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		filter := repository.AnalyticsFilter{From: from, To: to, GroupID: q.Get("group_id")}
+		if v := q.Get("target_id"); v != "" {
+			id, err := uuid.Parse(v)
+			if err != nil {
+				http.Error(w, "Invalid target ID", http.StatusBadRequest)
+				return
+			}
+			filter.TargetID = &id
+		}
+		if v := q.Get("zone_id"); v != "" {
+			id, err := uuid.Parse(v)
+			if err != nil {
+				http.Error(w, "Invalid zone ID", http.StatusBadRequest)
+				return
+			}
+			filter.ZoneID = &id
+		}
+
+		limit := 20
+		if v := q.Get("limit"); v != "" {
+			if limit, err = strconv.Atoi(v); err != nil || limit < 1 || limit > 100 {
+				http.Error(w, "limit must be from 1 to 100", http.StatusBadRequest)
+				return
+			}
+		}
+
+		hours, err := h.repo.Hours(r.Context(), filter)
+		if err != nil {
+			h.logger.Error("Failed to get usage hours", map[string]interface{}{
+				"error": err.Error(),
+			})
+			http.Error(w, "Failed to get utilization", http.StatusInternalServerError)
+			return
+		}
+		targets, err := h.repo.Targets(r.Context(), filter, limit)
+		if err != nil {
+			h.logger.Error("Failed to get target usage", map[string]interface{}{
+				"error": err.Error(),
+			})
+			http.Error(w, "Failed to get utilization", http.StatusInternalServerError)
+			return
+		}
+
+		period := to.Sub(from).Seconds()
+		for i := range targets {
+			targets[i].Utilization = float64(targets[i].Seconds) / period
+		}
+
+		locale := i18n.FromRequest(r)
+		writeLocalized(w, locale, map[string]interface{}{
+			"from":         from,
+			"to":           to,
+			"locale":       locale,
+			"heatmap":      analytics.NewHeatmap(hours, loc, locale, h.working),
+			"targets":      targets,
+			"refreshed_at": h.refreshedAt(r.Context(), models.AnalyticsViewSessionHours),
+		})
+	}
+}
+
+// HandleTeams returns how the members of each group use targets, and when,
+// in the tz time zone
+// Route: GET /api/v1/analytics/teams
+func (h *AnalyticsHandler) HandleTeams() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		from, to, err := analyticsPeriod(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		loc, err := displayLocation(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		groups, err := h.repo.Groups(r.Context(), from, to)
+		if err != nil {
+			h.logger.Error("Failed to get group usage", map[string]interface{}{
+				"error": err.Error(),
+			})
+			http.Error(w, "Failed to get team analytics", http.StatusInternalServerError)
+			return
+		}
+		hours, err := h.repo.GroupHours(r.Context(), from, to)
+		if err != nil {
+			h.logger.Error("Failed to get group usage hours", map[string]interface{}{
+				"error": err.Error(),
+			})
+			http.Error(w, "Failed to get team analytics", http.StatusInternalServerError)
+			return
+		}
+
+		locale := i18n.FromRequest(r)
+		teams := analytics.Teams(groups, hours, loc, locale, h.working)
+		writeLocalized(w, locale, map[string]interface{}{
+			"from":         from,
+			"to":           to,
+			"locale":       locale,
+			"time_zone":    loc.String(),
+			"teams":        teams,
+			"count":        len(teams),
+			"refreshed_at": h.refreshedAt(r.Context(), models.AnalyticsViewSessionHours),
+		})
+	}
+}
+
+// HandleApprovals returns how long decisions on access requests took, per
+// zone and overall, and the requests still awaiting one
+// Route: GET /api/v1/analytics/approvals
+func (h *AnalyticsHandler) HandleApprovals() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		from, to, err := analyticsPeriod(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		zones, err := h.repo.Turnaround(r.Context(), from, to)
+		if err != nil {
+			h.logger.Error("Failed to get approval turnaround", map[string]interface{}{
+				"error": err.Error(),
+			})
+			http.Error(w, "Failed to get approval analytics", http.StatusInternalServerError)
+			return
+		}
+		pending, err := h.repo.Pending(r.Context())
+		if err != nil {
+			h.logger.Error("Failed to count pending requests", map[string]interface{}{
+				"error": err.Error(),
+			})
+			http.Error(w, "Failed to get approval analytics", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"from":         from,
+			"to":           to,
+			"zones":        zones,
+			"total":        analytics.SumTurnaround(zones),
+			"pending":      pending,
+			"refreshed_at": h.refreshedAt(r.Context(), models.AnalyticsViewApprovalDays),
+		})
+	}
+}
+
+// HandleRefresh refreshes the analytics views now
+// Route: POST /api/v1/analytics/refresh
+func (h *AnalyticsHandler) HandleRefresh() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		refreshes, err := h.refresher.Refresh(r.Context())
+		if errors.Is(err, analytics.ErrRefreshing) {
+			http.Error(w, "Analytics are already being refreshed", http.StatusConflict)
+			return
+		}
+		if err != nil {
+			h.logger.Error("Failed to refresh analytics", map[string]interface{}{
+				"error": err.Error(),
+			})
+			http.Error(w, "Failed to refresh analytics", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"refreshes": refreshes,
+		})
+	}
+}
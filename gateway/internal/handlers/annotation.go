@@ -0,0 +1,297 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/VanCannon/openpam/gateway/internal/middleware"
+	"github.com/VanCannon/openpam/gateway/internal/models"
+	"github.com/VanCannon/openpam/gateway/internal/repository"
+	"github.com/VanCannon/openpam/gateway/internal/validate"
+	"github.com/VanCannon/openpam/pkg/logger"
+	"github.com/google/uuid"
+)
+
+// AnnotationHandler handles annotations and bookmarks on recorded sessions
+type AnnotationHandler struct {
+	annotationRepo *repository.AnnotationRepository
+	auditRepo      *repository.AuditLogRepository
+	logger         *logger.Logger
+}
+
+// NewAnnotationHandler creates a new annotation handler
+func NewAnnotationHandler(annotationRepo *repository.AnnotationRepository, auditRepo *repository.AuditLogRepository, log *logger.Logger) *AnnotationHandler {
+	return &AnnotationHandler{
+		annotationRepo: annotationRepo,
+		auditRepo:      auditRepo,
+		logger:         log,
+	}
+}
+
+// HandleList lists the annotations of a session in playback order
+// Route: GET /api/v1/audit-logs/{id}/annotations
+func (h *AnnotationHandler) HandleList() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+
+		id, err := uuid.Parse(r.PathValue("id"))
+		if err != nil {
+			http.Error(w, "Invalid audit log ID", http.StatusBadRequest)
+			return
+		}
+
+		if _, err := h.auditRepo.GetByID(ctx, id); err != nil {
+			http.Error(w, "Audit log not found", http.StatusNotFound)
+			return
+		}
+
+		annotations, err := h.annotationRepo.ListBySession(ctx, id)
+		if err != nil {
+			h.logger.Error("Failed to list annotations", map[string]interface{}{
+				"audit_log_id": id.String(),
+				"error":        err.Error(),
+			})
+			http.Error(w, "Failed to list annotations", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"annotations": annotations,
+			"count":       len(annotations),
+		})
+	}
+}
+
+// HandleCreate adds an annotation or bookmark to a session
+// Route: POST /api/v1/audit-logs/{id}/annotations
+func (h *AnnotationHandler) HandleCreate() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+
+		id, err := uuid.Parse(r.PathValue("id"))
+		if err != nil {
+			http.Error(w, "Invalid audit log ID", http.StatusBadRequest)
+			return
+		}
+
+		userID, err := uuid.Parse(middleware.GetUserID(ctx))
+		if err != nil {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		var req struct {
+			Kind     string  `json:"kind"`
+			OffsetMs int64   `json:"offset_ms"`
+			Label    *string `json:"label"`
+			Note     *string `json:"note"`
+		}
+
+		if !validate.Decode(w, r, &req) {
+			return
+		}
+
+		if req.Kind == "" {
+			req.Kind = models.AnnotationKindAnnotation
+		}
+
+		auditLog, err := h.auditRepo.GetByID(ctx, id)
+		if err != nil {
+			http.Error(w, "Audit log not found", http.StatusNotFound)
+			return
+		}
+
+		annotation := &models.SessionAnnotation{
+			AuditLogID: id,
+			AuthorID:   &userID,
+			Kind:       req.Kind,
+			OffsetMs:   req.OffsetMs,
+			Label:      trimmedOrNil(req.Label),
+			Note:       trimmedOrNil(req.Note),
+		}
+
+		if msg := validateAnnotation(annotation, auditLog); msg != "" {
+			http.Error(w, msg, http.StatusBadRequest)
+			return
+		}
+
+		if err := h.annotationRepo.Create(ctx, annotation); err != nil {
+			h.logger.Error("Failed to create annotation", map[string]interface{}{
+				"audit_log_id": id.String(),
+				"error":        err.Error(),
+			})
+			http.Error(w, "Failed to create annotation", http.StatusInternalServerError)
+			return
+		}
+
+		email := middleware.GetUserEmail(ctx)
+		annotation.AuthorEmail = &email
+
+		h.logger.Info("Session annotation created", map[string]interface{}{
+			"annotation_id": annotation.ID.String(),
+			"audit_log_id":  id.String(),
+			"kind":          annotation.Kind,
+			"offset_ms":     annotation.OffsetMs,
+			"author":        email,
+		})
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(annotation)
+	}
+}
+
+// HandleUpdate moves or rewrites an annotation. Only its author may change it.
+// Route: PUT /api/v1/annotations/{id}
+func (h *AnnotationHandler) HandleUpdate() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+
+		id, err := uuid.Parse(r.PathValue("id"))
+		if err != nil {
+			http.Error(w, "Invalid annotation ID", http.StatusBadRequest)
+			return
+		}
+
+		var req struct {
+			OffsetMs *int64  `json:"offset_ms"`
+			Label    *string `json:"label"`
+			Note     *string `json:"note"`
+		}
+
+		if !validate.Decode(w, r, &req) {
+			return
+		}
+
+		annotation, err := h.annotationRepo.GetByID(ctx, id)
+		if err != nil {
+			http.Error(w, "Annotation not found", http.StatusNotFound)
+			return
+		}
+
+		if annotation.AuthorID == nil || annotation.AuthorID.String() != middleware.GetUserID(ctx) {
+			http.Error(w, "Forbidden: only the author can edit an annotation", http.StatusForbidden)
+			return
+		}
+
+		if req.OffsetMs != nil {
+			annotation.OffsetMs = *req.OffsetMs
+		}
+		if req.Label != nil {
+			annotation.Label = trimmedOrNil(req.Label)
+		}
+		if req.Note != nil {
+			annotation.Note = trimmedOrNil(req.Note)
+		}
+
+		auditLog, err := h.auditRepo.GetByID(ctx, annotation.AuditLogID)
+		if err != nil {
+			http.Error(w, "Audit log not found", http.StatusNotFound)
+			return
+		}
+
+		if msg := validateAnnotation(annotation, auditLog); msg != "" {
+			http.Error(w, msg, http.StatusBadRequest)
+			return
+		}
+
+		if err := h.annotationRepo.Update(ctx, annotation); err != nil {
+			h.logger.Error("Failed to update annotation", map[string]interface{}{
+				"annotation_id": id.String(),
+				"error":         err.Error(),
+			})
+			http.Error(w, "Failed to update annotation", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(annotation)
+	}
+}
+
+// HandleDelete removes an annotation. Its author or an admin may delete it.
+// Route: DELETE /api/v1/annotations/{id}
+func (h *AnnotationHandler) HandleDelete() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+
+		id, err := uuid.Parse(r.PathValue("id"))
+		if err != nil {
+			http.Error(w, "Invalid annotation ID", http.StatusBadRequest)
+			return
+		}
+
+		annotation, err := h.annotationRepo.GetByID(ctx, id)
+		if err != nil {
+			http.Error(w, "Annotation not found", http.StatusNotFound)
+			return
+		}
+
+		isAuthor := annotation.AuthorID != nil && annotation.AuthorID.String() == middleware.GetUserID(ctx)
+		if !isAuthor && middleware.GetUserRole(ctx) != models.RoleAdmin {
+			http.Error(w, "Forbidden: only the author or an admin can delete an annotation", http.StatusForbidden)
+			return
+		}
+
+		if err := h.annotationRepo.Delete(ctx, id); err != nil {
+			h.logger.Error("Failed to delete annotation", map[string]interface{}{
+				"annotation_id": id.String(),
+				"error":         err.Error(),
+			})
+			http.Error(w, "Failed to delete annotation", http.StatusInternalServerError)
+			return
+		}
+
+		h.logger.Info("Session annotation deleted", map[string]interface{}{
+			"annotation_id": id.String(),
+			"audit_log_id":  annotation.AuditLogID.String(),
+			"deleted_by":    middleware.GetUserEmail(ctx),
+		})
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// validateAnnotation returns a message describing what is wrong with an
+// annotation, or "" if it is valid for the session
+func validateAnnotation(annotation *models.SessionAnnotation, auditLog *models.AuditLog) string {
+	switch annotation.Kind {
+	case models.AnnotationKindAnnotation:
+		if annotation.Note == nil {
+			return "An annotation requires a note"
+		}
+	case models.AnnotationKindBookmark:
+		if annotation.Label == nil {
+			return "A bookmark requires a label"
+		}
+	default:
+		return "Invalid kind: must be 'annotation' or 'bookmark'"
+	}
+
+	if annotation.Label != nil && len(*annotation.Label) > 255 {
+		return "Label must be at most 255 characters"
+	}
+
+	if annotation.OffsetMs < 0 {
+		return "offset_ms must not be negative"
+	}
+	if auditLog.EndTime.Valid && annotation.OffsetMs > auditLog.EndTime.Time.Sub(auditLog.StartTime).Milliseconds() {
+		return "offset_ms is past the end of the session"
+	}
+
+	return ""
+}
+
+// trimmedOrNil trims s, returning nil if nothing is left
+func trimmedOrNil(s *string) *string {
+	if s == nil {
+		return nil
+	}
+	trimmed := strings.TrimSpace(*s)
+	if trimmed == "" {
+		return nil
+	}
+	return &trimmed
+}
@@ -0,0 +1,177 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/VanCannon/openpam/gateway/internal/auth"
+	"github.com/VanCannon/openpam/gateway/internal/middleware"
+	"github.com/VanCannon/openpam/gateway/internal/models"
+	"github.com/VanCannon/openpam/gateway/internal/repository"
+	"github.com/VanCannon/openpam/gateway/internal/validate"
+	"github.com/VanCannon/openpam/pkg/logger"
+	"github.com/google/uuid"
+)
+
+// APIKeyHandler handles API key management requests
+type APIKeyHandler struct {
+	keyRepo *repository.APIKeyRepository
+	logger  *logger.Logger
+}
+
+// NewAPIKeyHandler creates a new API key handler
+func NewAPIKeyHandler(keyRepo *repository.APIKeyRepository, log *logger.Logger) *APIKeyHandler {
+	return &APIKeyHandler{
+		keyRepo: keyRepo,
+		logger:  log,
+	}
+}
+
+// HandleKeys routes collection requests based on HTTP method
+// Route: /api/v1/api-keys
+func (h *APIKeyHandler) HandleKeys() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			h.HandleList()(w, r)
+		case http.MethodPost:
+			h.HandleCreate()(w, r)
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	}
+}
+
+// HandleList lists API keys. Key values are never returned.
+func (h *APIKeyHandler) HandleList() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		keys, err := h.keyRepo.List(r.Context())
+		if err != nil {
+			h.logger.Error("Failed to list API keys", map[string]interface{}{
+				"error": err.Error(),
+			})
+			http.Error(w, "Failed to list API keys", http.StatusInternalServerError)
+			return
+		}
+
+		if keys == nil {
+			keys = []*models.APIKey{}
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"api_keys": keys,
+			"count":    len(keys),
+		})
+	}
+}
+
+// HandleCreate issues a new API key acting as the calling admin with the requested role.
+// The key is only ever returned in this response.
+func (h *APIKeyHandler) HandleCreate() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+
+		var req struct {
+			Name      string     `json:"name"`
+			Role      string     `json:"role"`
+			ExpiresAt *time.Time `json:"expires_at"`
+		}
+
+		if !validate.Decode(w, r, &req) {
+			return
+		}
+
+		if req.Name == "" {
+			http.Error(w, "Missing required fields", http.StatusBadRequest)
+			return
+		}
+
+		if req.Role == "" {
+			req.Role = models.RoleUser
+		}
+		if req.Role != models.RoleAdmin && req.Role != models.RoleUser && req.Role != models.RoleAuditor {
+			http.Error(w, "Invalid role", http.StatusBadRequest)
+			return
+		}
+
+		if req.ExpiresAt != nil && !req.ExpiresAt.After(time.Now()) {
+			http.Error(w, "expires_at must be in the future", http.StatusBadRequest)
+			return
+		}
+
+		userID, err := uuid.Parse(middleware.GetUserID(ctx))
+		if err != nil {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		key, prefix, hash, err := auth.GenerateAPIKey()
+		if err != nil {
+			h.logger.Error("Failed to generate API key", map[string]interface{}{
+				"error": err.Error(),
+			})
+			http.Error(w, "Failed to create API key", http.StatusInternalServerError)
+			return
+		}
+
+		apiKey := &models.APIKey{
+			Name:      req.Name,
+			KeyPrefix: prefix,
+			KeyHash:   hash,
+			UserID:    userID,
+			Role:      req.Role,
+			ExpiresAt: req.ExpiresAt,
+		}
+
+		if err := h.keyRepo.Create(ctx, apiKey); err != nil {
+			h.logger.Error("Failed to create API key", map[string]interface{}{
+				"error": err.Error(),
+			})
+			http.Error(w, "Failed to create API key", http.StatusInternalServerError)
+			return
+		}
+
+		h.logger.Info("API key created", map[string]interface{}{
+			"api_key_id": apiKey.ID.String(),
+			"name":       apiKey.Name,
+			"role":       apiKey.Role,
+			"created_by": middleware.GetUserEmail(ctx),
+		})
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"api_key": apiKey,
+			"key":     key,
+		})
+	}
+}
+
+// HandleRevoke revokes an API key
+// Route: DELETE /api/v1/api-keys/{id}
+func (h *APIKeyHandler) HandleRevoke() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodDelete {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		id, err := uuid.Parse(r.PathValue("id"))
+		if err != nil {
+			http.Error(w, "Invalid API key ID", http.StatusBadRequest)
+			return
+		}
+
+		if err := h.keyRepo.Revoke(r.Context(), id); err != nil {
+			h.logger.Error("Failed to revoke API key", map[string]interface{}{
+				"error": err.Error(),
+			})
+			http.Error(w, "API key not found", http.StatusNotFound)
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
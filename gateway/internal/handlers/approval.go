@@ -0,0 +1,261 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/VanCannon/openpam/gateway/internal/auth"
+	"github.com/VanCannon/openpam/gateway/internal/middleware"
+	"github.com/VanCannon/openpam/gateway/internal/models"
+	"github.com/VanCannon/openpam/gateway/internal/repository"
+	"github.com/VanCannon/openpam/gateway/internal/validate"
+	"github.com/VanCannon/openpam/pkg/logger"
+)
+
+// ApprovalHandler lets approvers decide schedule requests through the links
+// sent to them by email or chat. The link's token stands in for signing in;
+// with step-up enabled the approver must also be signed in.
+type ApprovalHandler struct {
+	actions   *repository.ApprovalActionRepository
+	schedules *repository.ScheduleRepository
+	users     *repository.UserRepository
+	targets   *repository.TargetRepository
+	decider   *ScheduleHandler
+	tokens    *auth.ApprovalTokens
+	stepUp    bool
+	logger    *logger.Logger
+}
+
+// NewApprovalHandler creates a new approval link handler
+func NewApprovalHandler(actions *repository.ApprovalActionRepository, schedules *repository.ScheduleRepository, users *repository.UserRepository, targets *repository.TargetRepository, decider *ScheduleHandler, tokens *auth.ApprovalTokens, stepUp bool, log *logger.Logger) *ApprovalHandler {
+	return &ApprovalHandler{
+		actions:   actions,
+		schedules: schedules,
+		users:     users,
+		targets:   targets,
+		decider:   decider,
+		tokens:    tokens,
+		stepUp:    stepUp,
+		logger:    log,
+	}
+}
+
+// DecideWithLinkRequest is the body of an approval link decision
+type DecideWithLinkRequest struct {
+	Reason string `json:"reason"` // Required to reject
+}
+
+// loadAction resolves the token in the path to its approval action, responding
+// with an error if the link can't be used
+func (h *ApprovalHandler) loadAction(w http.ResponseWriter, r *http.Request) (*models.ApprovalAction, bool) {
+	id, err := h.tokens.Verify(r.PathValue("token"))
+	if err != nil {
+		h.logger.Warn("Rejected approval link", map[string]interface{}{
+			"error": err.Error(),
+			"ip":    r.RemoteAddr,
+		})
+		h.decider.respondWithError(w, http.StatusGone, "This approval link is invalid or has expired")
+		return nil, false
+	}
+
+	action, err := h.actions.GetByID(r.Context(), id)
+	if err != nil {
+		h.decider.respondWithError(w, http.StatusGone, "This approval link is invalid or has expired")
+		return nil, false
+	}
+	if action.UsedAt != nil || time.Now().After(action.ExpiresAt) {
+		h.decider.respondWithError(w, http.StatusGone, "This approval link has already been used or has expired")
+		return nil, false
+	}
+
+	return action, true
+}
+
+// HandleGetApproval shows the request an approval link decides, without using the link
+// Route: GET /api/v1/approvals/{token}
+func (h *ApprovalHandler) HandleGetApproval() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		action, ok := h.loadAction(w, r)
+		if !ok {
+			return
+		}
+
+		schedule, err := h.schedules.GetByID(r.Context(), action.ScheduleID)
+		if err != nil {
+			h.decider.respondWithError(w, http.StatusNotFound, "Schedule not found")
+			return
+		}
+
+		response := map[string]interface{}{
+			"success":          true,
+			"schedule":         schedule,
+			"channel":          action.Channel,
+			"expires_at":       action.ExpiresAt,
+			"step_up_required": h.stepUp,
+		}
+		if approver, err := h.users.GetByID(r.Context(), action.ApproverID); err == nil {
+			response["approver"] = map[string]string{"email": approver.Email, "display_name": approver.DisplayName}
+		}
+		if requester, err := h.users.GetByID(r.Context(), schedule.UserID); err == nil {
+			response["requester"] = map[string]string{"email": requester.Email, "display_name": requester.DisplayName}
+		}
+		if target, err := h.targets.GetByID(r.Context(), schedule.TargetID); err == nil {
+			response["target"] = map[string]string{"name": target.Name, "hostname": target.Hostname, "protocol": target.Protocol}
+		}
+		if quorum, err := h.decider.scheduleQuorum(r.Context(), schedule.ID); err == nil {
+			if progress, err := h.schedules.ApprovalProgress(r.Context(), schedule.ID, quorum); err == nil {
+				response["quorum"] = progress
+			}
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(response)
+	}
+}
+
+// HandleApprove approves the request of an approval link
+// Route: POST /api/v1/approvals/{token}/approve
+func (h *ApprovalHandler) HandleApprove() http.HandlerFunc {
+	return h.handleDecision(models.ApprovalStatusApproved)
+}
+
+// HandleReject rejects the request of an approval link
+// Route: POST /api/v1/approvals/{token}/reject
+func (h *ApprovalHandler) HandleReject() http.HandlerFunc {
+	return h.handleDecision(models.ApprovalStatusRejected)
+}
+
+// errLinkNotRedeemed is returned by decideThenRedeem when the decision was
+// recorded but the link could not be marked used
+var errLinkNotRedeemed = errors.New("approval link was not redeemed")
+
+// decideThenRedeem records a decision and only then uses up the link, so a
+// decision that fails leaves the link usable for another try. A link used twice
+// at once still decides only once: decisions are made against the schedule's
+// version, so the second one conflicts.
+func decideThenRedeem(decide func() error, redeem func() (bool, error)) error {
+	if err := decide(); err != nil {
+		return err
+	}
+
+	redeemed, err := redeem()
+	if err != nil {
+		return fmt.Errorf("%w: %v", errLinkNotRedeemed, err)
+	}
+	if !redeemed {
+		return errLinkNotRedeemed
+	}
+	return nil
+}
+
+func (h *ApprovalHandler) handleDecision(decision string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+
+		var req DecideWithLinkRequest
+		if r.ContentLength != 0 {
+			if !validate.Decode(w, r, &req) {
+				return
+			}
+		}
+		var reason *string
+		if decision == models.ApprovalStatusRejected {
+			if req.Reason == "" {
+				h.decider.respondWithError(w, http.StatusBadRequest, "Reason is required")
+				return
+			}
+			reason = &req.Reason
+		}
+
+		action, ok := h.loadAction(w, r)
+		if !ok {
+			return
+		}
+
+		// Step-up: the link alone isn't enough, the approver must be signed in too
+		if h.stepUp && middleware.GetUserID(ctx) != action.ApproverID.String() {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusUnauthorized)
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"success":          false,
+				"message":          "Sign in as the approver this link was sent to",
+				"step_up_required": true,
+			})
+			return
+		}
+
+		// The approver may have lost the right to approve since the link was sent
+		approver, err := h.users.GetByID(ctx, action.ApproverID)
+		if err != nil || !approver.Enabled || approver.Role != models.RoleAdmin {
+			h.decider.respondWithError(w, http.StatusForbidden, "You are no longer allowed to approve requests")
+			return
+		}
+
+		schedule, err := h.schedules.GetByID(ctx, action.ScheduleID)
+		if err != nil {
+			h.decider.respondWithError(w, http.StatusNotFound, "Schedule not found")
+			return
+		}
+		if schedule.ApprovalStatus != models.ApprovalStatusPending {
+			h.decider.respondWithError(w, http.StatusConflict, "This request has already been "+schedule.ApprovalStatus)
+			return
+		}
+
+		var progress *models.QuorumProgress
+		err = decideThenRedeem(
+			func() error {
+				var err error
+				progress, err = h.decider.decide(r, schedule.ID, schedule.Version, approver.ID, decision, reason, action.Channel, nil)
+				return err
+			},
+			func() (bool, error) {
+				return h.actions.Redeem(ctx, action.ID, decision)
+			},
+		)
+		if err != nil {
+			if errors.Is(err, repository.ErrVersionConflict) {
+				h.decider.respondWithError(w, http.StatusConflict, "This request was decided by someone else")
+				return
+			}
+			if errors.Is(err, repository.ErrAlreadyApproved) {
+				h.decider.respondWithError(w, http.StatusConflict, "You have already approved this request")
+				return
+			}
+			if errors.Is(err, errLinkNotRedeemed) {
+				// The decision stands; the link is spent as the request is no longer pending
+				h.logger.Warn("Approval link not marked used after its decision", map[string]interface{}{
+					"action_id": action.ID.String(),
+					"error":     err.Error(),
+				})
+			} else {
+				h.decider.respondWithDecisionError(w, r, schedule.ID, err, "Failed to record decision")
+				return
+			}
+		}
+
+		h.logger.Info("Schedule decided through approval link", map[string]interface{}{
+			"schedule_id": schedule.ID.String(),
+			"decision":    decision,
+			"approver":    approver.Email,
+			"channel":     action.Channel,
+		})
+
+		response := map[string]interface{}{
+			"success":  true,
+			"message":  "Schedule " + decision + " successfully",
+			"decision": decision,
+		}
+		if progress != nil {
+			response["quorum"] = progress
+			if !progress.Approved {
+				response["message"] = "Approval recorded; the request needs more approvals"
+			}
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(response)
+	}
+}
@@ -0,0 +1,41 @@
+package handlers
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/VanCannon/openpam/gateway/internal/repository"
+)
+
+func TestDecideThenRedeem_FailedDecisionKeepsLink(t *testing.T) {
+	used := false
+	redeem := func() (bool, error) {
+		if used {
+			return false, nil
+		}
+		used = true
+		return true, nil
+	}
+
+	// The decision fails: the link must not be spent
+	err := decideThenRedeem(func() error { return repository.ErrVersionConflict }, redeem)
+	if !errors.Is(err, repository.ErrVersionConflict) {
+		t.Fatalf("error = %v, want version conflict", err)
+	}
+	if used {
+		t.Fatal("link was used up by a decision that failed")
+	}
+
+	// Trying again with the same link works and spends it
+	if err := decideThenRedeem(func() error { return nil }, redeem); err != nil {
+		t.Fatalf("retry error = %v", err)
+	}
+	if !used {
+		t.Error("link was not used up by its decision")
+	}
+
+	// A spent link is reported, but the decision made with it stands
+	if err := decideThenRedeem(func() error { return nil }, redeem); !errors.Is(err, errLinkNotRedeemed) {
+		t.Errorf("error for a spent link = %v", err)
+	}
+}
@@ -2,34 +2,41 @@ package handlers
 
 import (
 	"encoding/json"
+	"errors"
 	"io"
+	"io/fs"
 	"net/http"
-	"os"
 	"strconv"
+	"time"
 
-	"github.com/VanCannon/openpam/gateway/internal/logger"
+	"github.com/VanCannon/openpam/gateway/internal/models"
+	"github.com/VanCannon/openpam/gateway/internal/recordings"
 	"github.com/VanCannon/openpam/gateway/internal/repository"
-	"github.com/VanCannon/openpam/gateway/internal/ssh"
+	"github.com/VanCannon/openpam/gateway/internal/transcript"
+	"github.com/VanCannon/openpam/pkg/logger"
 	"github.com/google/uuid"
 )
 
 // AuditLogHandler handles audit log-related requests
 type AuditLogHandler struct {
-	auditRepo *repository.AuditLogRepository
-	recorder  *ssh.Recorder
-	logger    *logger.Logger
+	auditRepo     *repository.AuditLogRepository
+	recordingRepo *repository.RecordingRepository
+	storage       recordings.Storage // nil when it couldn't be opened
+	logger        *logger.Logger
 }
 
 // NewAuditLogHandler creates a new audit log handler
-func NewAuditLogHandler(auditRepo *repository.AuditLogRepository, recorder *ssh.Recorder, log *logger.Logger) *AuditLogHandler {
+func NewAuditLogHandler(auditRepo *repository.AuditLogRepository, recordingRepo *repository.RecordingRepository, storage recordings.Storage, log *logger.Logger) *AuditLogHandler {
 	return &AuditLogHandler{
-		auditRepo: auditRepo,
-		recorder:  recorder,
-		logger:    log,
+		auditRepo:     auditRepo,
+		recordingRepo: recordingRepo,
+		storage:       storage,
+		logger:        log,
 	}
 }
 
-// HandleList lists audit logs with pagination
+// HandleList lists audit logs with pagination, optionally filtered by user,
+// target, status, purpose and reason
 func (h *AuditLogHandler) HandleList() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		if r.Method != http.MethodGet {
@@ -50,7 +57,36 @@ func (h *AuditLogHandler) HandleList() http.HandlerFunc {
 			offset = 0
 		}
 
-		logs, err := h.auditRepo.List(ctx, limit, offset)
+		query := r.URL.Query()
+		filter := repository.AuditLogFilter{
+			Status:  query.Get("status"),
+			Purpose: query.Get("purpose"),
+			Reason:  query.Get("reason"),
+			Limit:   limit,
+			Offset:  offset,
+		}
+		if v := query.Get("user_id"); v != "" {
+			id, err := uuid.Parse(v)
+			if err != nil {
+				http.Error(w, "Invalid user ID", http.StatusBadRequest)
+				return
+			}
+			filter.UserID = &id
+		}
+		if v := query.Get("target_id"); v != "" {
+			id, err := uuid.Parse(v)
+			if err != nil {
+				http.Error(w, "Invalid target ID", http.StatusBadRequest)
+				return
+			}
+			filter.TargetID = &id
+		}
+		if err := models.ValidatePurpose(filter.Purpose, ""); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		logs, err := h.auditRepo.Search(ctx, filter)
 		if err != nil {
 			h.logger.Error("Failed to list audit logs", map[string]interface{}{
 				"error": err.Error(),
@@ -171,7 +207,8 @@ func (h *AuditLogHandler) HandleListActive() http.HandlerFunc {
 	}
 }
 
-// HandleGetRecording retrieves the recording file for a session
+// HandleGetRecording retrieves the recording file of a session, found through
+// the recordings catalog
 func (h *AuditLogHandler) HandleGetRecording() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		if r.Method != http.MethodGet {
@@ -179,69 +216,214 @@ func (h *AuditLogHandler) HandleGetRecording() http.HandlerFunc {
 			return
 		}
 
-		sessionID := r.URL.Query().Get("session_id")
-		if sessionID == "" {
+		sessionID, err := uuid.Parse(r.URL.Query().Get("session_id"))
+		if err != nil {
 			http.Error(w, "Session ID required", http.StatusBadRequest)
 			return
 		}
 
-		if h.recorder == nil {
-			http.Error(w, "Recording not enabled", http.StatusNotImplemented)
+		rec, err := h.recordingRepo.GetBySessionID(r.Context(), sessionID)
+		if err != nil {
+			http.Error(w, "Recording not found", http.StatusNotFound)
+			return
+		}
+		if h.storage == nil {
+			http.Error(w, "Recording storage unavailable", http.StatusServiceUnavailable)
 			return
 		}
 
-		// Since the recorder stores active sessions in memory but we want to retrieve
-		// completed sessions from disk, we need a way to find the file.
-		// The recorder.GetRecordingPath only works for active sessions in the current implementation.
-		// However, we know the file naming convention: [sessionID]-[timestamp].log
-		// We'll search the recordings directory for a file matching the session ID.
+		file, err := h.storage.Open(recordings.NameOf(rec.Location))
+		if err != nil {
+			h.logger.Error("Failed to open recording file", map[string]interface{}{
+				"error":    err.Error(),
+				"location": rec.Location,
+			})
+			http.Error(w, "Failed to open recording", http.StatusInternalServerError)
+			return
+		}
+		defer file.Close()
 
-		// TODO: Refactor Recorder to support looking up completed sessions or store the path in DB.
-		// For now, we'll list files in the recordings directory.
+		// Point players at the auditor annotations for this session
+		w.Header().Set("Link", "</api/v1/audit-logs/"+sessionID.String()+"/annotations>; rel=\"annotations\"")
+		w.Header().Set("Content-Type", "text/plain")
+		io.Copy(w, file)
+	}
+}
 
-		// This is a bit of a hack because Recorder struct doesn't expose the path publicly,
-		// but we passed it in NewRecorder. We should probably expose it or add a method.
-		// Let's assume the recordings are in "./recordings" as per server.go for now,
-		// or better, we'll just search in the configured directory.
+// HandleListRecordings searches the recordings catalog by session, format
+// and start time (RFC 3339 from and to), newest first
+// Route: GET /api/v1/recordings
+func (h *AuditLogHandler) HandleListRecordings() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		var filter models.RecordingFilter
+
+		if v := q.Get("session_id"); v != "" {
+			id, err := uuid.Parse(v)
+			if err != nil {
+				http.Error(w, "Invalid session ID", http.StatusBadRequest)
+				return
+			}
+			filter.SessionID = &id
+		}
+		switch filter.Format = q.Get("format"); filter.Format {
+		case "", models.RecordingFormatSSH, models.RecordingFormatGuacamole:
+		default:
+			http.Error(w, "Invalid format", http.StatusBadRequest)
+			return
+		}
+		for param, dst := range map[string]**time.Time{"from": &filter.From, "to": &filter.To} {
+			if v := q.Get(param); v != "" {
+				t, err := time.Parse(time.RFC3339, v)
+				if err != nil {
+					http.Error(w, "Invalid "+param+" time", http.StatusBadRequest)
+					return
+				}
+				*dst = &t
+			}
+		}
 
-		// Actually, let's just list the directory and find the file.
-		// We need to know the base path. It's not exposed in the Recorder struct.
-		// Let's assume "./recordings" for this iteration as it's hardcoded in server.go.
+		filter.Limit, _ = strconv.Atoi(q.Get("limit"))
+		filter.Offset, _ = strconv.Atoi(q.Get("offset"))
+		if filter.Limit <= 0 || filter.Limit > 100 {
+			filter.Limit = 50
+		}
+		if filter.Offset < 0 {
+			filter.Offset = 0
+		}
 
-		files, err := os.ReadDir("./recordings")
+		recs, err := h.recordingRepo.List(r.Context(), filter)
 		if err != nil {
-			h.logger.Error("Failed to read recordings directory", map[string]interface{}{
+			h.logger.Error("Failed to list recordings", map[string]interface{}{
 				"error": err.Error(),
 			})
-			http.Error(w, "Failed to retrieve recording", http.StatusInternalServerError)
+			http.Error(w, "Failed to list recordings", http.StatusInternalServerError)
 			return
 		}
 
-		var filePath string
-		for _, file := range files {
-			if !file.IsDir() && len(file.Name()) > len(sessionID) && file.Name()[:len(sessionID)] == sessionID {
-				filePath = "./recordings/" + file.Name()
-				break
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"recordings": recs,
+			"count":      len(recs),
+			"limit":      filter.Limit,
+			"offset":     filter.Offset,
+		})
+	}
+}
+
+// HandleListUnrecorded reports the SSH and RDP sessions started between from
+// and to (RFC 3339, to defaults to now) that ended without a recording, with
+// how far their recording got and why it failed
+// Route: GET /api/v1/recordings/missing
+func (h *AuditLogHandler) HandleListUnrecorded() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+
+		from, err := time.Parse(time.RFC3339, q.Get("from"))
+		if err != nil {
+			http.Error(w, "Invalid from time", http.StatusBadRequest)
+			return
+		}
+		to := time.Now()
+		if v := q.Get("to"); v != "" {
+			to, err = time.Parse(time.RFC3339, v)
+			if err != nil {
+				http.Error(w, "Invalid to time", http.StatusBadRequest)
+				return
 			}
 		}
-
-		if filePath == "" {
-			http.Error(w, "Recording not found", http.StatusNotFound)
+		if !to.After(from) {
+			http.Error(w, "to must be after from", http.StatusBadRequest)
 			return
 		}
 
-		file, err := os.Open(filePath)
+		sessions, err := h.auditRepo.ListUnrecorded(r.Context(), from, to)
 		if err != nil {
-			h.logger.Error("Failed to open recording file", map[string]interface{}{
+			h.logger.Error("Failed to list unrecorded sessions", map[string]interface{}{
 				"error": err.Error(),
-				"path":  filePath,
 			})
-			http.Error(w, "Failed to open recording", http.StatusInternalServerError)
+			http.Error(w, "Failed to list unrecorded sessions", http.StatusInternalServerError)
 			return
 		}
-		defer file.Close()
 
-		w.Header().Set("Content-Type", "text/plain")
-		io.Copy(w, file)
+		// Sessions from before recording states were kept have none
+		byState := map[string]int{}
+		for _, session := range sessions {
+			state := "unknown"
+			if session.RecordingState != nil {
+				state = *session.RecordingState
+			}
+			byState[state]++
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"sessions": sessions,
+			"count":    len(sessions),
+			"by_state": byState,
+			"from":     from,
+			"to":       to,
+		})
+	}
+}
+
+// HandleGetTranscript returns an SSH session as a plain-text transcript, with
+// control sequences stripped, prompts normalized and a timestamp per line.
+// format=json returns the lines with their prompts and commands split out;
+// download=true serves it as a file.
+// Route: GET /api/v1/audit-logs/{id}/transcript
+func (h *AuditLogHandler) HandleGetTranscript() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, err := uuid.Parse(r.PathValue("id"))
+		if err != nil {
+			http.Error(w, "Invalid session ID", http.StatusBadRequest)
+			return
+		}
+
+		auditLog, err := h.auditRepo.GetByID(r.Context(), id)
+		if err != nil {
+			http.Error(w, "Session not found", http.StatusNotFound)
+			return
+		}
+		if auditLog.Protocol != models.ProtocolSSH {
+			http.Error(w, "Transcripts are only available for SSH sessions", http.StatusBadRequest)
+			return
+		}
+
+		if h.storage == nil {
+			http.Error(w, "Recording storage unavailable", http.StatusServiceUnavailable)
+			return
+		}
+
+		t, err := transcript.Load(h.storage, id.String())
+		if errors.Is(err, fs.ErrNotExist) {
+			http.Error(w, "Recording not found", http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			h.logger.Error("Failed to render transcript", map[string]interface{}{
+				"session_id": id.String(),
+				"error":      err.Error(),
+			})
+			http.Error(w, "Failed to render transcript", http.StatusInternalServerError)
+			return
+		}
+
+		format := r.URL.Query().Get("format")
+		ext := ".txt"
+		if format == "json" {
+			ext = ".json"
+		}
+		if r.URL.Query().Get("download") == "true" {
+			w.Header().Set("Content-Disposition", `attachment; filename="transcript-`+id.String()+ext+`"`)
+		}
+
+		if format == "json" {
+			w.Header().Set("Content-Type", "application/json")
+			t.WriteJSON(w)
+			return
+		}
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		t.WriteText(w)
 	}
 }
@@ -9,9 +9,12 @@ import (
 	"time"
 
 	"github.com/VanCannon/openpam/gateway/internal/auth"
-	"github.com/VanCannon/openpam/gateway/internal/logger"
+	"github.com/VanCannon/openpam/gateway/internal/license"
+	"github.com/VanCannon/openpam/gateway/internal/middleware"
 	"github.com/VanCannon/openpam/gateway/internal/models"
 	"github.com/VanCannon/openpam/gateway/internal/repository"
+	"github.com/VanCannon/openpam/gateway/internal/validate"
+	"github.com/VanCannon/openpam/pkg/logger"
 	"github.com/google/uuid"
 )
 
@@ -28,6 +31,7 @@ type AuthHandler struct {
 	devMode         bool
 	frontendURL     string
 	identityURL     string
+	license         *license.Monitor
 }
 
 // NewAuthHandler creates a new authentication handler
@@ -43,6 +47,7 @@ func NewAuthHandler(
 	devMode bool,
 	frontendURL string,
 	identityURL string,
+	licenseMonitor *license.Monitor,
 ) *AuthHandler {
 	return &AuthHandler{
 		entraID:         entraID,
@@ -56,6 +61,7 @@ func NewAuthHandler(
 		devMode:         devMode,
 		frontendURL:     frontendURL,
 		identityURL:     identityURL,
+		license:         licenseMonitor,
 	}
 }
 
@@ -115,7 +121,7 @@ func (h *AuthHandler) HandleCallback() http.HandlerFunc {
 			return
 		}
 
-		// Validate state
+		// Validate state, using it up
 		valid, err := h.stateStore.Validate(ctx, state)
 		if err != nil {
 			h.logger.Error("Failed to validate state", map[string]interface{}{
@@ -131,9 +137,6 @@ func (h *AuthHandler) HandleCallback() http.HandlerFunc {
 			return
 		}
 
-		// Delete state after validation
-		h.stateStore.Delete(ctx, state)
-
 		// Exchange code for token
 		token, err := h.entraID.ExchangeCode(ctx, code)
 		if err != nil {
@@ -204,6 +207,9 @@ func (h *AuthHandler) HandleCallback() http.HandlerFunc {
 			return
 		}
 
+		// The user's groups can raise their role for this login
+		user.Role = h.groupRole(ctx, user)
+
 		// Generate JWT token
 		jwtToken, err := h.tokenManager.GenerateToken(
 			user.ID.String(),
@@ -385,6 +391,9 @@ func (h *AuthHandler) HandleMe() http.HandlerFunc {
 			return
 		}
 
+		// Report the role the user logs in with
+		user.Role = h.groupRole(ctx, user)
+
 		// Return user info
 		response := map[string]interface{}{
 			"id":           user.ID.String(),
@@ -394,6 +403,13 @@ func (h *AuthHandler) HandleMe() http.HandlerFunc {
 			"role":         user.Role,
 		}
 
+		// While elevated the user acts with the elevated role
+		if el := middleware.GetElevation(ctx); el != nil {
+			response["role"] = el.Role
+			response["base_role"] = user.Role
+			response["elevation"] = el
+		}
+
 		w.Header().Set("Content-Type", "application/json")
 		json.NewEncoder(w).Encode(response)
 	}
@@ -571,8 +587,7 @@ func (h *AuthHandler) HandleDirectLogin() http.HandlerFunc {
 			Password string `json:"password"`
 		}
 
-		if err := json.NewDecoder(r.Body).Decode(&creds); err != nil {
-			http.Error(w, "Invalid request body", http.StatusBadRequest)
+		if !validate.Decode(w, r, &creds) {
 			return
 		}
 
@@ -580,8 +595,25 @@ func (h *AuthHandler) HandleDirectLogin() http.HandlerFunc {
 		// Use configured Identity URL
 		identityURL := fmt.Sprintf("%s/api/v1/identity/auth", h.identityURL)
 
+		serviceToken, err := h.tokenManager.GenerateServiceToken()
+		if err != nil {
+			h.logger.Error("Failed to create identity service token", map[string]interface{}{
+				"error": err.Error(),
+			})
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+
 		reqBody, _ := json.Marshal(creds)
-		resp, err := http.Post(identityURL, "application/json", bytes.NewBuffer(reqBody))
+		req, err := http.NewRequestWithContext(r.Context(), http.MethodPost, identityURL, bytes.NewBuffer(reqBody))
+		if err != nil {
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", "Bearer "+serviceToken)
+
+		resp, err := http.DefaultClient.Do(req)
 		if err != nil {
 			h.logger.Error("Failed to call identity service", map[string]interface{}{
 				"error": err.Error(),
@@ -635,15 +667,29 @@ func (h *AuthHandler) HandleDirectLogin() http.HandlerFunc {
 				json.Unmarshal([]byte(authResp.User.Groups), &groupDNs)
 			}
 
-			var allowedGroup *models.Group
+			var matched []*models.Group
 			for _, dn := range groupDNs {
 				group, err := h.groupRepo.GetByDN(ctx, dn)
 				if err == nil && group != nil {
-					allowedGroup = group
-					break // Found a matching group
+					matched = append(matched, group)
 				}
 			}
 
+			var allowedGroup *models.Group
+			if len(matched) > 0 {
+				allowedGroup = matched[0]
+			}
+
+			// An expired license keeps existing users working but admits no new ones
+			if allowedGroup != nil && !h.license.AllowsNewUsers(time.Now()) {
+				h.logger.Warn("JIT user creation refused by license", map[string]interface{}{
+					"entra_id": authResp.User.EntraID,
+					"email":    authResp.User.Email,
+				})
+				http.Error(w, "The OpenPAM license has expired and no new users can be added. Please contact an administrator.", http.StatusForbidden)
+				return
+			}
+
 			if allowedGroup != nil {
 				// Create JIT user
 				h.logger.Info("Creating JIT user from group membership", map[string]interface{}{
@@ -665,6 +711,18 @@ func (h *AuthHandler) HandleDirectLogin() http.HandlerFunc {
 				user.Role = allowedGroup.Role
 				user.Source = "active_directory"
 				h.userRepo.Update(ctx, user)
+
+				// Record the memberships now rather than at the next directory sync,
+				// so rules naming the groups apply from the first session
+				for _, group := range matched {
+					if err := h.groupRepo.AddMember(ctx, group.ID, user.ID, models.GroupSourceActiveDirectory); err != nil {
+						h.logger.Error("Failed to record group membership", map[string]interface{}{
+							"error":    err.Error(),
+							"group_id": group.ID,
+							"user_id":  user.ID,
+						})
+					}
+				}
 			} else {
 				h.logger.Warn("User not found in database and no matching groups", map[string]interface{}{
 					"entra_id": authResp.User.EntraID,
@@ -699,6 +757,9 @@ func (h *AuthHandler) HandleDirectLogin() http.HandlerFunc {
 			return
 		}
 
+		// The user's groups can raise their role for this login
+		user.Role = h.groupRole(ctx, user)
+
 		// Generate JWT token
 		jwtToken, err := h.tokenManager.GenerateToken(
 			user.ID.String(),
@@ -782,3 +843,24 @@ func (h *AuthHandler) HandleDirectLogin() http.HandlerFunc {
 		json.NewEncoder(w).Encode(response)
 	}
 }
+
+// groupRole returns the user's role raised to the most privileged role of the
+// groups they are a member of. Group roles aren't stored on the user, so
+// leaving a group takes its role away at the next login.
+func (h *AuthHandler) groupRole(ctx context.Context, user *models.User) string {
+	groups, err := h.groupRepo.ListByUser(ctx, user.ID)
+	if err != nil {
+		// Fail closed: the user keeps their own role
+		h.logger.Error("Failed to list user groups", map[string]interface{}{
+			"error":   err.Error(),
+			"user_id": user.ID.String(),
+		})
+		return user.Role
+	}
+
+	roles := make([]string, len(groups))
+	for i, group := range groups {
+		roles[i] = group.Role
+	}
+	return models.HighestRole(user.Role, roles...)
+}
@@ -0,0 +1,168 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/VanCannon/openpam/gateway/internal/middleware"
+	"github.com/VanCannon/openpam/gateway/internal/models"
+	"github.com/VanCannon/openpam/gateway/internal/policy"
+	"github.com/VanCannon/openpam/gateway/internal/repository"
+	"github.com/VanCannon/openpam/gateway/internal/settings"
+	"github.com/VanCannon/openpam/gateway/internal/validate"
+	"github.com/VanCannon/openpam/pkg/logger"
+	"github.com/google/uuid"
+)
+
+// BannerHandler shows the pre-session banner of a target and records users
+// acknowledging it
+type BannerHandler struct {
+	targetRepo *repository.TargetRepository
+	banners    *repository.BannerRepository
+	resolver   *settings.Resolver
+	logger     *logger.Logger
+}
+
+// NewBannerHandler creates a new banner handler
+func NewBannerHandler(targetRepo *repository.TargetRepository, banners *repository.BannerRepository, resolver *settings.Resolver, log *logger.Logger) *BannerHandler {
+	return &BannerHandler{
+		targetRepo: targetRepo,
+		banners:    banners,
+		resolver:   resolver,
+		logger:     log,
+	}
+}
+
+// HandleGet returns the banner shown before connecting to a target, whether
+// it must be acknowledged, and the caller's acknowledgment if it still counts
+// Route: GET /api/v1/targets/{id}/banner
+func (h *BannerHandler) HandleGet() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+
+		userID, target, eff, ok := h.resolve(w, r)
+		if !ok {
+			return
+		}
+
+		response := map[string]interface{}{
+			"target_id": target.ID,
+			"banner":    eff.Banner,
+			"version":   eff.BannerVersion,
+			"required":  eff.RequiresAcknowledgment(),
+		}
+
+		if eff.Banner != "" {
+			ack, err := h.banners.Latest(ctx, userID, target.ID, eff.BannerVersion, time.Now().Add(-models.BannerAcknowledgmentTTL))
+			if err != nil {
+				h.logger.Error("Failed to get banner acknowledgment", map[string]interface{}{
+					"error":     err.Error(),
+					"target_id": target.ID.String(),
+				})
+				http.Error(w, "Failed to get banner", http.StatusInternalServerError)
+				return
+			}
+			if ack != nil {
+				response["acknowledgment"] = ack
+			}
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(response)
+	}
+}
+
+// HandleAcknowledge records the caller accepting the target's banner. The
+// version must be the one they were shown, so a banner that changed in the
+// meantime is shown again.
+// Route: POST /api/v1/targets/{id}/banner/acknowledge
+func (h *BannerHandler) HandleAcknowledge() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+
+		var req struct {
+			Version string `json:"version"`
+		}
+		if !validate.Decode(w, r, &req) {
+			return
+		}
+
+		userID, target, eff, ok := h.resolve(w, r)
+		if !ok {
+			return
+		}
+
+		if eff.Banner == "" {
+			http.Error(w, "Target has no banner", http.StatusBadRequest)
+			return
+		}
+		if req.Version != eff.BannerVersion {
+			http.Error(w, "The banner has changed; show the current text and acknowledge again", http.StatusConflict)
+			return
+		}
+
+		clientIP := getClientIP(r)
+		ack := &models.BannerAcknowledgment{
+			UserID:        userID,
+			TargetID:      target.ID,
+			BannerVersion: eff.BannerVersion,
+			ClientIP:      &clientIP,
+		}
+		if err := h.banners.Acknowledge(ctx, ack); err != nil {
+			h.logger.Error("Failed to record banner acknowledgment", map[string]interface{}{
+				"error":     err.Error(),
+				"target_id": target.ID.String(),
+			})
+			http.Error(w, "Failed to record acknowledgment", http.StatusInternalServerError)
+			return
+		}
+
+		response := map[string]interface{}{
+			"acknowledgment": ack,
+			"expires_at":     ack.AcknowledgedAt.Add(models.BannerAcknowledgmentTTL),
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(response)
+	}
+}
+
+// resolve loads the target in the request path and its zone and target
+// settings, writing the error response if it can't. Banners aren't set on
+// credential rules, so no credential is needed.
+func (h *BannerHandler) resolve(w http.ResponseWriter, r *http.Request) (uuid.UUID, *models.Target, *settings.Effective, bool) {
+	ctx := r.Context()
+
+	targetID, err := uuid.Parse(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, "Invalid target ID", http.StatusBadRequest)
+		return uuid.Nil, nil, nil, false
+	}
+
+	userID, err := uuid.Parse(middleware.GetUserID(ctx))
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return uuid.Nil, nil, nil, false
+	}
+
+	target, err := h.targetRepo.GetByID(ctx, targetID)
+	if err != nil {
+		http.Error(w, "Target not found", http.StatusNotFound)
+		return uuid.Nil, nil, nil, false
+	}
+
+	subject := policy.Subject{UserID: userID, Role: middleware.GetUserRole(ctx)}
+	eff, err := h.resolver.Resolve(ctx, subject, target, nil)
+	if err != nil {
+		h.logger.Error("Failed to resolve session settings", map[string]interface{}{
+			"target_id": targetID.String(),
+			"error":     err.Error(),
+		})
+		http.Error(w, "Failed to resolve settings", http.StatusInternalServerError)
+		return uuid.Nil, nil, nil, false
+	}
+
+	return userID, target, eff, true
+}
@@ -0,0 +1,212 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/VanCannon/openpam/gateway/internal/auth"
+	"github.com/VanCannon/openpam/gateway/internal/calendar"
+	"github.com/VanCannon/openpam/gateway/internal/middleware"
+	"github.com/VanCannon/openpam/gateway/internal/models"
+	"github.com/VanCannon/openpam/gateway/internal/repository"
+	"github.com/VanCannon/openpam/gateway/internal/validate"
+	"github.com/VanCannon/openpam/pkg/logger"
+	"github.com/google/uuid"
+)
+
+// CalendarHandler manages users' calendar feeds and serves them to calendar apps
+type CalendarHandler struct {
+	feedRepo      *repository.CalendarFeedRepository
+	scheduleRepo  *repository.ScheduleRepository
+	userRepo      *repository.UserRepository
+	zoneAdminRepo *repository.ZoneAdminRepository
+	builder       *calendar.Builder
+	tokens        *auth.CalendarTokens
+	frontendURL   string
+	logger        *logger.Logger
+}
+
+// NewCalendarHandler creates a new calendar handler. Feed URLs are given on
+// frontendURL, which passes /api/v1/schedules on to the gateway.
+func NewCalendarHandler(feedRepo *repository.CalendarFeedRepository, scheduleRepo *repository.ScheduleRepository, userRepo *repository.UserRepository, zoneAdminRepo *repository.ZoneAdminRepository, builder *calendar.Builder, tokens *auth.CalendarTokens, frontendURL string, log *logger.Logger) *CalendarHandler {
+	return &CalendarHandler{
+		feedRepo:      feedRepo,
+		scheduleRepo:  scheduleRepo,
+		userRepo:      userRepo,
+		zoneAdminRepo: zoneAdminRepo,
+		builder:       builder,
+		tokens:        tokens,
+		frontendURL:   strings.TrimRight(frontendURL, "/"),
+		logger:        log,
+	}
+}
+
+// CalendarFeedRequest sets up the current user's feed
+type CalendarFeedRequest struct {
+	IncludePending bool `json:"include_pending"`
+}
+
+// calendarFeedResponse is a feed with the URL calendar apps subscribe to
+type calendarFeedResponse struct {
+	*models.CalendarFeed
+	URL string `json:"url"`
+}
+
+// feedURL returns the URL of a feed
+func (h *CalendarHandler) feedURL(feed *models.CalendarFeed) string {
+	return h.frontendURL + "/api/v1/schedules/calendar.ics?token=" + url.QueryEscape(h.tokens.Sign(feed.FeedID))
+}
+
+// HandleGetFeed returns the current user's feed and its URL
+// Route: GET /api/v1/schedules/calendar-feed
+func (h *CalendarHandler) HandleGetFeed() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, err := uuid.Parse(middleware.GetUserID(r.Context()))
+		if err != nil {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		feed, err := h.feedRepo.GetByUser(r.Context(), userID)
+		if err != nil {
+			http.Error(w, "No calendar feed", http.StatusNotFound)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(calendarFeedResponse{CalendarFeed: feed, URL: h.feedURL(feed)})
+	}
+}
+
+// HandleCreateFeed gives the current user a new feed URL. A user has one
+// feed; creating another revokes the URL of the last.
+// Route: POST /api/v1/schedules/calendar-feed
+func (h *CalendarHandler) HandleCreateFeed() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, err := uuid.Parse(middleware.GetUserID(r.Context()))
+		if err != nil {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		var req CalendarFeedRequest
+		if !validate.DecodeOptional(w, r, &req) {
+			return
+		}
+
+		feed := &models.CalendarFeed{UserID: userID, IncludePending: req.IncludePending}
+		if err := h.feedRepo.Create(r.Context(), feed); err != nil {
+			h.logger.Error("Failed to create calendar feed", map[string]interface{}{
+				"user_id": userID.String(),
+				"error":   err.Error(),
+			})
+			http.Error(w, "Failed to create calendar feed", http.StatusInternalServerError)
+			return
+		}
+
+		h.logger.Info("Calendar feed created", map[string]interface{}{
+			"user_id":         userID.String(),
+			"include_pending": feed.IncludePending,
+		})
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(calendarFeedResponse{CalendarFeed: feed, URL: h.feedURL(feed)})
+	}
+}
+
+// HandleDeleteFeed revokes the current user's feed URL
+// Route: DELETE /api/v1/schedules/calendar-feed
+func (h *CalendarHandler) HandleDeleteFeed() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, err := uuid.Parse(middleware.GetUserID(r.Context()))
+		if err != nil {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		deleted, err := h.feedRepo.Delete(r.Context(), userID)
+		if err != nil {
+			h.logger.Error("Failed to delete calendar feed", map[string]interface{}{
+				"user_id": userID.String(),
+				"error":   err.Error(),
+			})
+			http.Error(w, "Failed to delete calendar feed", http.StatusInternalServerError)
+			return
+		}
+		if !deleted {
+			http.Error(w, "No calendar feed", http.StatusNotFound)
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// HandleServeFeed serves a feed as an iCalendar to calendar apps. The signed
+// token in the URL stands in for signing in, since calendar apps can't.
+// Route: GET /api/v1/schedules/calendar.ics?token=cal_...
+func (h *CalendarHandler) HandleServeFeed() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+
+		// Revoked, forged and disabled users' feeds look the same
+		feedID, err := h.tokens.Verify(r.URL.Query().Get("token"))
+		if err != nil {
+			h.logger.Warn("Rejected calendar feed token", map[string]interface{}{
+				"error": err.Error(),
+				"ip":    r.RemoteAddr,
+			})
+			http.Error(w, "Calendar feed not found", http.StatusNotFound)
+			return
+		}
+		feed, err := h.feedRepo.GetByFeedID(ctx, feedID)
+		if err != nil {
+			http.Error(w, "Calendar feed not found", http.StatusNotFound)
+			return
+		}
+		user, err := h.userRepo.GetByID(ctx, feed.UserID)
+		if err != nil || !user.Enabled {
+			http.Error(w, "Calendar feed not found", http.StatusNotFound)
+			return
+		}
+
+		// Approvers also see the requests they can decide
+		filter := repository.CalendarFilter{UserID: user.ID, Pending: feed.IncludePending}
+		if feed.IncludePending {
+			if user.Role == models.RoleAdmin {
+				filter.AllRequests = true
+			} else if zones, err := h.zoneAdminRepo.ZonesOf(ctx, user.ID); err == nil {
+				filter.RequestZones = zones
+			}
+		}
+
+		schedules, err := h.scheduleRepo.ListForCalendar(ctx, filter)
+		if err != nil {
+			h.logger.Error("Failed to list calendar schedules", map[string]interface{}{
+				"user_id": user.ID.String(),
+				"error":   err.Error(),
+			})
+			http.Error(w, "Failed to build calendar feed", http.StatusInternalServerError)
+			return
+		}
+
+		now := time.Now()
+		events := h.builder.Events(ctx, user.ID, schedules, now)
+
+		if err := h.feedRepo.Fetched(ctx, feed.FeedID, now); err != nil {
+			h.logger.Warn("Failed to record calendar feed fetch", map[string]interface{}{
+				"user_id": user.ID.String(),
+				"error":   err.Error(),
+			})
+		}
+
+		w.Header().Set("Content-Type", "text/calendar; charset=utf-8")
+		w.Header().Set("Content-Disposition", `inline; filename="openpam.ics"`)
+		w.Header().Set("Cache-Control", "private, no-cache")
+		calendar.Write(w, "OpenPAM access", calendar.Refresh, events)
+	}
+}
@@ -0,0 +1,33 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/VanCannon/openpam/gateway/internal/license"
+	"github.com/VanCannon/openpam/pkg/logger"
+)
+
+// CapabilitiesHandler reports what the gateway currently allows
+type CapabilitiesHandler struct {
+	license *license.Monitor
+	logger  *logger.Logger
+}
+
+// NewCapabilitiesHandler creates a new capabilities handler
+func NewCapabilitiesHandler(licenseMonitor *license.Monitor, log *logger.Logger) *CapabilitiesHandler {
+	return &CapabilitiesHandler{
+		license: licenseMonitor,
+		logger:  log,
+	}
+}
+
+// HandleGet returns the license mode, what it allows and the banner to show
+// Route: GET /api/v1/capabilities
+func (h *CapabilitiesHandler) HandleGet() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(h.license.Capabilities(time.Now()))
+	}
+}
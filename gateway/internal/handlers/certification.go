@@ -0,0 +1,471 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/VanCannon/openpam/gateway/internal/certification"
+	"github.com/VanCannon/openpam/gateway/internal/middleware"
+	"github.com/VanCannon/openpam/gateway/internal/models"
+	"github.com/VanCannon/openpam/gateway/internal/reports"
+	"github.com/VanCannon/openpam/gateway/internal/repository"
+	"github.com/VanCannon/openpam/gateway/internal/validate"
+	"github.com/VanCannon/openpam/pkg/logger"
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+)
+
+// CertificationHandler handles access certification campaigns
+type CertificationHandler struct {
+	certRepo  *repository.CertificationRepository
+	userRepo  *repository.UserRepository
+	auditRepo *repository.SystemAuditLogRepository
+	closer    *certification.Closer
+	logger    *logger.Logger
+}
+
+// NewCertificationHandler creates a new certification handler
+func NewCertificationHandler(
+	certRepo *repository.CertificationRepository,
+	userRepo *repository.UserRepository,
+	auditRepo *repository.SystemAuditLogRepository,
+	closer *certification.Closer,
+	log *logger.Logger,
+) *CertificationHandler {
+	return &CertificationHandler{
+		certRepo:  certRepo,
+		userRepo:  userRepo,
+		auditRepo: auditRepo,
+		closer:    closer,
+		logger:    log,
+	}
+}
+
+// HandleCampaigns routes collection requests based on HTTP method
+// Route: /api/v1/certifications
+func (h *CertificationHandler) HandleCampaigns() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			h.HandleList()(w, r)
+		case http.MethodPost:
+			h.HandleLaunch()(w, r)
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	}
+}
+
+// HandleList lists all campaigns
+func (h *CertificationHandler) HandleList() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		campaigns, err := h.certRepo.ListCampaigns(r.Context())
+		if err != nil {
+			h.logger.Error("Failed to list certification campaigns", map[string]interface{}{
+				"error": err.Error(),
+			})
+			http.Error(w, "Failed to list certification campaigns", http.StatusInternalServerError)
+			return
+		}
+
+		if campaigns == nil {
+			campaigns = []*models.CertificationCampaign{}
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"campaigns": campaigns,
+			"count":     len(campaigns),
+		})
+	}
+}
+
+// HandleLaunch launches a campaign. The entitlements in scope are captured when
+// the campaign launches; access granted afterwards is reviewed by the next one.
+func (h *CertificationHandler) HandleLaunch() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+
+		var req struct {
+			Name            string                    `json:"name"`
+			Description     *string                   `json:"description"`
+			Scope           models.CertificationScope `json:"scope"`
+			ReviewerIDs     []uuid.UUID               `json:"reviewer_ids"`
+			RevokeUndecided bool                      `json:"revoke_undecided"`
+			DueAt           time.Time                 `json:"due_at"`
+		}
+
+		if !validate.Decode(w, r, &req) {
+			return
+		}
+
+		if req.Name == "" || req.DueAt.IsZero() {
+			http.Error(w, "Missing required fields", http.StatusBadRequest)
+			return
+		}
+
+		if !req.DueAt.After(time.Now()) {
+			http.Error(w, "due_at must be in the future", http.StatusBadRequest)
+			return
+		}
+
+		for _, t := range req.Scope.EntitlementTypes {
+			if t != models.EntitlementTypeRole && t != models.EntitlementTypeCredentialRule && t != models.EntitlementTypeSchedule {
+				http.Error(w, "Invalid entitlement type: must be 'role', 'credential_rule' or 'schedule'", http.StatusBadRequest)
+				return
+			}
+		}
+
+		reviewerIDs := make(pq.StringArray, len(req.ReviewerIDs))
+		for i, id := range req.ReviewerIDs {
+			reviewer, err := h.userRepo.GetByID(ctx, id)
+			if err != nil || !reviewer.Enabled {
+				http.Error(w, "Unknown or disabled reviewer: "+id.String(), http.StatusBadRequest)
+				return
+			}
+			reviewerIDs[i] = id.String()
+		}
+
+		campaign := &models.CertificationCampaign{
+			Name:            req.Name,
+			Description:     req.Description,
+			Scope:           req.Scope,
+			ReviewerIDs:     reviewerIDs,
+			RevokeUndecided: req.RevokeUndecided,
+			DueAt:           req.DueAt,
+		}
+		if userID, err := uuid.Parse(middleware.GetUserID(ctx)); err == nil {
+			campaign.CreatedBy = &userID
+		}
+
+		items, err := h.certRepo.ListEntitlements(ctx, req.Scope)
+		if err != nil {
+			h.logger.Error("Failed to list entitlements", map[string]interface{}{
+				"error": err.Error(),
+			})
+			http.Error(w, "Failed to launch certification campaign", http.StatusInternalServerError)
+			return
+		}
+
+		certification.AssignReviewers(items, req.ReviewerIDs, campaign.CreatedBy)
+
+		if err := h.certRepo.CreateCampaign(ctx, campaign, items); err != nil {
+			h.logger.Error("Failed to create certification campaign", map[string]interface{}{
+				"error": err.Error(),
+			})
+			http.Error(w, "Failed to launch certification campaign", http.StatusInternalServerError)
+			return
+		}
+
+		h.recordEvent(r, models.EventTypeCertificationLaunched, "launch_campaign", map[string]interface{}{
+			"campaign_id": campaign.ID.String(),
+			"name":        campaign.Name,
+			"items":       len(items),
+		})
+
+		h.logger.Info("Certification campaign launched", map[string]interface{}{
+			"campaign_id": campaign.ID.String(),
+			"name":        campaign.Name,
+			"items":       len(items),
+			"created_by":  middleware.GetUserEmail(ctx),
+		})
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"campaign": campaign,
+			"progress": models.CertificationProgress{Total: len(items), Pending: len(items)},
+		})
+	}
+}
+
+// HandleGet retrieves a campaign with its progress
+// Route: GET /api/v1/certifications/{id}
+func (h *CertificationHandler) HandleGet() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, err := uuid.Parse(r.PathValue("id"))
+		if err != nil {
+			http.Error(w, "Invalid campaign ID", http.StatusBadRequest)
+			return
+		}
+
+		campaign, err := h.certRepo.GetCampaign(r.Context(), id)
+		if err != nil {
+			http.Error(w, "Certification campaign not found", http.StatusNotFound)
+			return
+		}
+
+		progress, err := h.certRepo.Progress(r.Context(), id)
+		if err != nil {
+			h.logger.Error("Failed to get campaign progress", map[string]interface{}{
+				"error": err.Error(),
+			})
+			http.Error(w, "Failed to get certification campaign", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"campaign": campaign,
+			"progress": progress,
+		})
+	}
+}
+
+// HandleListItems lists every item of a campaign
+// Route: GET /api/v1/certifications/{id}/items
+func (h *CertificationHandler) HandleListItems() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, err := uuid.Parse(r.PathValue("id"))
+		if err != nil {
+			http.Error(w, "Invalid campaign ID", http.StatusBadRequest)
+			return
+		}
+
+		items, err := h.certRepo.ListItems(r.Context(), id)
+		if err != nil {
+			h.logger.Error("Failed to list certification items", map[string]interface{}{
+				"error": err.Error(),
+			})
+			http.Error(w, "Failed to list certification items", http.StatusInternalServerError)
+			return
+		}
+
+		if items == nil {
+			items = []*models.CertificationItem{}
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"items": items,
+			"count": len(items),
+		})
+	}
+}
+
+// HandleMyItems lists the undecided items awaiting the caller's review. Admins
+// also see items without an assigned reviewer.
+// Route: GET /api/v1/certifications/my-items
+func (h *CertificationHandler) HandleMyItems() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+
+		userID, err := uuid.Parse(middleware.GetUserID(ctx))
+		if err != nil {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		isAdmin := middleware.GetUserRole(ctx) == models.RoleAdmin
+		items, err := h.certRepo.ListPendingForReviewer(ctx, userID, isAdmin)
+		if err != nil {
+			h.logger.Error("Failed to list certification work items", map[string]interface{}{
+				"error": err.Error(),
+			})
+			http.Error(w, "Failed to list certification items", http.StatusInternalServerError)
+			return
+		}
+
+		if items == nil {
+			items = []*models.CertificationItem{}
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"items": items,
+			"count": len(items),
+		})
+	}
+}
+
+// HandleDecide certifies or revokes an item. Only the assigned reviewer or an
+// admin may decide, and never on their own entitlements. Revocations take effect
+// immediately.
+// Route: POST /api/v1/certifications/items/{id}/decision
+func (h *CertificationHandler) HandleDecide() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+
+		id, err := uuid.Parse(r.PathValue("id"))
+		if err != nil {
+			http.Error(w, "Invalid item ID", http.StatusBadRequest)
+			return
+		}
+
+		userID, err := uuid.Parse(middleware.GetUserID(ctx))
+		if err != nil {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		var req struct {
+			Decision string  `json:"decision"`
+			Comment  *string `json:"comment"`
+		}
+
+		if !validate.Decode(w, r, &req) {
+			return
+		}
+
+		var decision string
+		switch req.Decision {
+		case "certify":
+			decision = models.CertificationCertified
+		case "revoke":
+			decision = models.CertificationRevoked
+			if req.Comment == nil || strings.TrimSpace(*req.Comment) == "" {
+				http.Error(w, "A comment is required to revoke", http.StatusBadRequest)
+				return
+			}
+		default:
+			http.Error(w, "Invalid decision: must be 'certify' or 'revoke'", http.StatusBadRequest)
+			return
+		}
+
+		item, err := h.certRepo.GetItem(ctx, id)
+		if err != nil {
+			http.Error(w, "Certification item not found", http.StatusNotFound)
+			return
+		}
+
+		isReviewer := item.ReviewerID != nil && *item.ReviewerID == userID
+		if !isReviewer && middleware.GetUserRole(ctx) != models.RoleAdmin {
+			http.Error(w, "Forbidden: item is assigned to another reviewer", http.StatusForbidden)
+			return
+		}
+
+		if item.UserID == userID {
+			http.Error(w, "Forbidden: cannot review your own entitlements", http.StatusForbidden)
+			return
+		}
+
+		if err := h.certRepo.Decide(ctx, item, decision, req.Comment, userID); err != nil {
+			if errors.Is(err, repository.ErrAlreadyDecided) {
+				http.Error(w, "Item already decided or campaign closed", http.StatusConflict)
+				return
+			}
+			h.logger.Error("Failed to record certification decision", map[string]interface{}{
+				"item_id": id.String(),
+				"error":   err.Error(),
+			})
+			http.Error(w, "Failed to record decision", http.StatusInternalServerError)
+			return
+		}
+
+		if decision == models.CertificationRevoked {
+			h.closer.RecordRevocation(ctx, item, &userID)
+		}
+
+		h.logger.Info("Certification decision recorded", map[string]interface{}{
+			"item_id":          item.ID.String(),
+			"campaign_id":      item.CampaignID.String(),
+			"user_email":       item.UserEmail,
+			"entitlement_type": item.EntitlementType,
+			"decision":         decision,
+			"decided_by":       middleware.GetUserEmail(ctx),
+		})
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(item)
+	}
+}
+
+// HandleClose completes a campaign before its due date
+// Route: POST /api/v1/certifications/{id}/close
+func (h *CertificationHandler) HandleClose() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+
+		id, err := uuid.Parse(r.PathValue("id"))
+		if err != nil {
+			http.Error(w, "Invalid campaign ID", http.StatusBadRequest)
+			return
+		}
+
+		var closedBy *uuid.UUID
+		if userID, err := uuid.Parse(middleware.GetUserID(ctx)); err == nil {
+			closedBy = &userID
+		}
+
+		if err := h.closer.Complete(ctx, id, closedBy); err != nil {
+			h.logger.Error("Failed to close certification campaign", map[string]interface{}{
+				"campaign_id": id.String(),
+				"error":       err.Error(),
+			})
+			http.Error(w, "Active certification campaign not found", http.StatusNotFound)
+			return
+		}
+
+		h.HandleGet()(w, r)
+	}
+}
+
+// HandleReport exports the campaign's evidence report
+// Route: GET /api/v1/certifications/{id}/report?format=csv|pdf
+func (h *CertificationHandler) HandleReport() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+
+		id, err := uuid.Parse(r.PathValue("id"))
+		if err != nil {
+			http.Error(w, "Invalid campaign ID", http.StatusBadRequest)
+			return
+		}
+
+		format := r.URL.Query().Get("format")
+		if format == "" {
+			format = models.ReportFormatCSV
+		}
+		if format != models.ReportFormatCSV && format != models.ReportFormatPDF {
+			http.Error(w, "Invalid format: must be 'csv' or 'pdf'", http.StatusBadRequest)
+			return
+		}
+
+		campaign, err := h.certRepo.GetCampaign(ctx, id)
+		if err != nil {
+			http.Error(w, "Certification campaign not found", http.StatusNotFound)
+			return
+		}
+
+		items, err := h.certRepo.ListItems(ctx, id)
+		if err != nil {
+			h.logger.Error("Failed to list certification items", map[string]interface{}{
+				"error": err.Error(),
+			})
+			http.Error(w, "Failed to build evidence report", http.StatusInternalServerError)
+			return
+		}
+
+		data, contentType, err := reports.Render(format, certification.EvidenceTable(campaign, items))
+		if err != nil {
+			h.logger.Error("Failed to render evidence report", map[string]interface{}{
+				"campaign_id": id.String(),
+				"error":       err.Error(),
+			})
+			http.Error(w, "Failed to build evidence report", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", contentType)
+		w.Header().Set("Content-Disposition", `attachment; filename="certification-`+campaign.ID.String()+`.`+format+`"`)
+		w.Write(data)
+	}
+}
+
+func (h *CertificationHandler) recordEvent(r *http.Request, eventType, action string, details map[string]interface{}) {
+	var userID *uuid.UUID
+	if id, err := uuid.Parse(middleware.GetUserID(r.Context())); err == nil {
+		userID = &id
+	}
+
+	ip := r.RemoteAddr
+	if err := h.auditRepo.CreateSimple(r.Context(), eventType, userID, action, "success", &ip, details); err != nil {
+		h.logger.Error("Failed to record certification audit event", map[string]interface{}{
+			"event_type": eventType,
+			"error":      err.Error(),
+		})
+	}
+}
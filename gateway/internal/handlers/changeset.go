@@ -0,0 +1,243 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/VanCannon/openpam/gateway/internal/dualcontrol"
+	"github.com/VanCannon/openpam/gateway/internal/middleware"
+	"github.com/VanCannon/openpam/gateway/internal/models"
+	"github.com/VanCannon/openpam/gateway/internal/repository"
+	"github.com/VanCannon/openpam/gateway/internal/validate"
+	"github.com/VanCannon/openpam/pkg/logger"
+	"github.com/google/uuid"
+)
+
+// ChangeSetHandler handles the review of changes held under dual control
+type ChangeSetHandler struct {
+	changeSetRepo *repository.ChangeSetRepository
+	dualControl   *dualcontrol.Controller
+	auditRepo     systemAuditStore
+	logger        *logger.Logger
+}
+
+// NewChangeSetHandler creates a new change set handler
+func NewChangeSetHandler(
+	changeSetRepo *repository.ChangeSetRepository,
+	dualControl *dualcontrol.Controller,
+	auditRepo *repository.SystemAuditLogRepository,
+	log *logger.Logger,
+) *ChangeSetHandler {
+	return &ChangeSetHandler{
+		changeSetRepo: changeSetRepo,
+		dualControl:   dualControl,
+		auditRepo:     auditRepo,
+		logger:        log,
+	}
+}
+
+// HandleList lists change sets, newest first. Filter by status with ?status=.
+// Route: GET /api/v1/change-sets
+func (h *ChangeSetHandler) HandleList() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		sets, err := h.changeSetRepo.List(r.Context(), r.URL.Query().Get("status"), 200)
+		if err != nil {
+			h.logger.Error("Failed to list change sets", map[string]interface{}{
+				"error": err.Error(),
+			})
+			http.Error(w, "Failed to list change sets", http.StatusInternalServerError)
+			return
+		}
+
+		if sets == nil {
+			sets = []*models.ChangeSet{}
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"change_sets": sets,
+			"count":       len(sets),
+		})
+	}
+}
+
+// HandleGet retrieves a change set
+// Route: GET /api/v1/change-sets/{id}
+func (h *ChangeSetHandler) HandleGet() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		cs, ok := h.load(w, r)
+		if !ok {
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(cs)
+	}
+}
+
+// HandleApprove approves a pending change set and applies it as the approver.
+// The requester can't approve their own change.
+// Route: POST /api/v1/change-sets/{id}/approve
+func (h *ChangeSetHandler) HandleApprove() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+
+		cs, ok := h.load(w, r)
+		if !ok {
+			return
+		}
+
+		deciderID, err := uuid.Parse(middleware.GetUserID(ctx))
+		if err != nil {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		if cs.RequestedBy != nil && *cs.RequestedBy == deciderID {
+			http.Error(w, "A change must be approved by an admin other than the one who made it", http.StatusForbidden)
+			return
+		}
+
+		decided, ok := h.decide(w, r, cs, true, deciderID, nil)
+		if !ok {
+			return
+		}
+
+		status, body := h.dualControl.Apply(r, decided)
+		details := map[string]interface{}{
+			"change_set_id": cs.ID.String(),
+			"kind":          cs.Kind,
+			"path":          cs.Path,
+		}
+		if cs.RequestedBy != nil {
+			details["requested_by"] = cs.RequestedBy.String()
+		}
+
+		var applyErr *string
+		if status >= http.StatusMultipleChoices {
+			text := dualcontrol.ErrorText(body)
+			applyErr = &text
+			details["error"] = text
+		}
+		if err := h.changeSetRepo.Finish(ctx, cs.ID, applyErr); err != nil {
+			h.logger.Error("Failed to record change set outcome", map[string]interface{}{
+				"change_set_id": cs.ID.String(),
+				"error":         err.Error(),
+			})
+		}
+
+		decided.Status = models.ChangeSetStatusApplied
+		eventType, auditStatus := models.EventTypeChangeSetApplied, models.AuditStatusSuccess
+		if applyErr != nil {
+			decided.Status = models.ChangeSetStatusFailed
+			decided.Error = applyErr
+			eventType, auditStatus = models.EventTypeChangeSetFailed, models.AuditStatusFailure
+		}
+		h.recordEvent(r, eventType, "approve_change", auditStatus, details)
+
+		h.logger.Info("Change set approved", map[string]interface{}{
+			"change_set_id": cs.ID.String(),
+			"kind":          cs.Kind,
+			"status":        decided.Status,
+			"approved_by":   middleware.GetUserEmail(ctx),
+		})
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(decided)
+	}
+}
+
+// HandleReject rejects a pending change set. The requester may reject their
+// own to withdraw it.
+// Route: POST /api/v1/change-sets/{id}/reject
+func (h *ChangeSetHandler) HandleReject() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+
+		var req struct {
+			Reason string `json:"reason"`
+		}
+		if !validate.Decode(w, r, &req) {
+			return
+		}
+		if strings.TrimSpace(req.Reason) == "" {
+			http.Error(w, "Reason is required", http.StatusBadRequest)
+			return
+		}
+
+		cs, ok := h.load(w, r)
+		if !ok {
+			return
+		}
+
+		deciderID, err := uuid.Parse(middleware.GetUserID(ctx))
+		if err != nil {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		decided, ok := h.decide(w, r, cs, false, deciderID, &req.Reason)
+		if !ok {
+			return
+		}
+
+		h.recordEvent(r, models.EventTypeChangeSetRejected, "reject_change", models.AuditStatusSuccess, map[string]interface{}{
+			"change_set_id": cs.ID.String(),
+			"kind":          cs.Kind,
+			"path":          cs.Path,
+			"reason":        req.Reason,
+		})
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(decided)
+	}
+}
+
+// decide records the decision on a pending change set, responding with an
+// error if it was already decided
+func (h *ChangeSetHandler) decide(w http.ResponseWriter, r *http.Request, cs *models.ChangeSet, approve bool, deciderID uuid.UUID, reason *string) (*models.ChangeSet, bool) {
+	decided, err := h.changeSetRepo.Decide(r.Context(), cs.ID, approve, deciderID, reason, time.Now())
+	if err != nil {
+		if errors.Is(err, repository.ErrChangeSetClosed) {
+			http.Error(w, "Change set is no longer pending", http.StatusConflict)
+			return nil, false
+		}
+		h.logger.Error("Failed to decide change set", map[string]interface{}{
+			"change_set_id": cs.ID.String(),
+			"error":         err.Error(),
+		})
+		http.Error(w, "Failed to decide change set", http.StatusInternalServerError)
+		return nil, false
+	}
+	decided.RequestedEmail = cs.RequestedEmail
+	return decided, true
+}
+
+// load resolves the change set in the path, responding with an error if it doesn't exist
+func (h *ChangeSetHandler) load(w http.ResponseWriter, r *http.Request) (*models.ChangeSet, bool) {
+	id, err := uuid.Parse(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, "Invalid change set ID", http.StatusBadRequest)
+		return nil, false
+	}
+
+	cs, err := h.changeSetRepo.GetByID(r.Context(), id)
+	if err != nil {
+		http.Error(w, "Change set not found", http.StatusNotFound)
+		return nil, false
+	}
+
+	return cs, true
+}
+
+func (h *ChangeSetHandler) recordEvent(r *http.Request, eventType, action, status string, details map[string]interface{}) {
+	userID, ip := requester(r)
+	if err := h.auditRepo.CreateSimple(r.Context(), eventType, userID, action, status, &ip, details); err != nil {
+		h.logger.Error("Failed to record change set audit event", map[string]interface{}{
+			"event_type": eventType,
+			"error":      err.Error(),
+		})
+	}
+}
@@ -0,0 +1,378 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/VanCannon/openpam/gateway/internal/cloud"
+	"github.com/VanCannon/openpam/gateway/internal/middleware"
+	"github.com/VanCannon/openpam/gateway/internal/models"
+	"github.com/VanCannon/openpam/gateway/internal/policy"
+	"github.com/VanCannon/openpam/gateway/internal/repository"
+	"github.com/VanCannon/openpam/gateway/internal/settings"
+	"github.com/VanCannon/openpam/gateway/internal/validate"
+	"github.com/VanCannon/openpam/gateway/internal/vault"
+	"github.com/VanCannon/openpam/pkg/logger"
+	"github.com/google/uuid"
+)
+
+// CloudSessionHandler brokers sessions on AWS and Azure console targets
+type CloudSessionHandler struct {
+	targetRepo   *repository.TargetRepository
+	credRepo     *repository.CredentialRepository
+	scheduleRepo *repository.ScheduleRepository
+	userRepo     *repository.UserRepository
+	cloudRepo    *repository.CloudSessionRepository
+	auditRepo    *repository.SystemAuditLogRepository
+	vault        *vault.Client
+	policy       *policy.Engine
+	settings     *settings.Resolver
+	broker       *cloud.Broker
+	logger       *logger.Logger
+}
+
+// NewCloudSessionHandler creates a new cloud session handler
+func NewCloudSessionHandler(
+	targetRepo *repository.TargetRepository,
+	credRepo *repository.CredentialRepository,
+	scheduleRepo *repository.ScheduleRepository,
+	userRepo *repository.UserRepository,
+	cloudRepo *repository.CloudSessionRepository,
+	auditRepo *repository.SystemAuditLogRepository,
+	vaultClient *vault.Client,
+	policyEngine *policy.Engine,
+	settingsResolver *settings.Resolver,
+	broker *cloud.Broker,
+	log *logger.Logger,
+) *CloudSessionHandler {
+	return &CloudSessionHandler{
+		targetRepo:   targetRepo,
+		credRepo:     credRepo,
+		scheduleRepo: scheduleRepo,
+		userRepo:     userRepo,
+		cloudRepo:    cloudRepo,
+		auditRepo:    auditRepo,
+		vault:        vaultClient,
+		policy:       policyEngine,
+		settings:     settingsResolver,
+		broker:       broker,
+		logger:       log,
+	}
+}
+
+// StartCloudSessionRequest picks the role to assume
+type StartCloudSessionRequest struct {
+	CredentialID  *uuid.UUID `json:"credential_id"`
+	Justification string     `json:"justification"`
+}
+
+// CloudSessionResponse is a granted session: the console sign-in URL and, for
+// AWS, the temporary credentials
+type CloudSessionResponse struct {
+	SessionID uuid.UUID `json:"session_id"`
+	*cloud.Grant
+}
+
+// HandleStart grants a session on a cloud console target. As for an
+// interactive session, the caller needs an approved schedule window for the
+// target and access to the role's credential under the credential rules. The
+// session ends with the window, or sooner under CLOUD_SESSION_DURATION and the
+// target's max_duration.
+// Route: POST /api/v1/targets/{id}/cloud-sessions
+func (h *CloudSessionHandler) HandleStart() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		userEmail := middleware.GetUserEmail(ctx)
+
+		targetID, err := uuid.Parse(r.PathValue("id"))
+		if err != nil {
+			http.Error(w, "Invalid target ID", http.StatusBadRequest)
+			return
+		}
+
+		userID, err := uuid.Parse(middleware.GetUserID(ctx))
+		if err != nil {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		var req StartCloudSessionRequest
+		if !validate.DecodeOptional(w, r, &req) {
+			return
+		}
+		req.Justification = strings.TrimSpace(req.Justification)
+
+		target, err := h.targetRepo.GetByID(ctx, targetID)
+		if err != nil {
+			http.Error(w, "Target not found", http.StatusNotFound)
+			return
+		}
+		if !target.Enabled {
+			http.Error(w, "Target is disabled", http.StatusForbidden)
+			return
+		}
+		if target.Expired(time.Now()) {
+			http.Error(w, "Target has expired", http.StatusGone)
+			return
+		}
+		if !models.CloudProtocol(target.Protocol) {
+			http.Error(w, cloud.ErrNotCloud.Error(), http.StatusBadRequest)
+			return
+		}
+		if !maintenanceGate(w, r, target, h.auditRepo, h.logger) {
+			return
+		}
+
+		now := time.Now()
+		windowEnd, err := h.scheduleRepo.ActiveWindowEnd(ctx, userID, targetID, now)
+		if err != nil {
+			h.logger.Error("Failed to check schedule window", map[string]interface{}{
+				"error": err.Error(),
+			})
+			http.Error(w, "Failed to evaluate access policy", http.StatusInternalServerError)
+			return
+		}
+		if windowEnd == nil {
+			h.logger.Warn("Cloud session outside schedule window", map[string]interface{}{
+				"target_id": targetID.String(),
+				"user":      userEmail,
+			})
+			http.Error(w, "Forbidden: no approved schedule window for this target", http.StatusForbidden)
+			return
+		}
+
+		credentials, err := h.credRepo.GetByTargetID(ctx, targetID)
+		if err != nil || len(credentials) == 0 {
+			http.Error(w, "No credentials configured", http.StatusInternalServerError)
+			return
+		}
+		subject := policy.Subject{UserID: userID, Role: middleware.GetUserRole(ctx)}
+		allowed, err := h.policy.AllowedCredentials(ctx, subject, target, credentials)
+		if err != nil {
+			http.Error(w, "Failed to evaluate access policy", http.StatusInternalServerError)
+			return
+		}
+		cred, err := policy.SelectCredential(allowed, req.CredentialID)
+		if err != nil {
+			h.logger.Warn("Cloud role selection failed", map[string]interface{}{
+				"target_id": targetID.String(),
+				"user":      userEmail,
+				"error":     err.Error(),
+			})
+			if err == policy.ErrAmbiguousCredential {
+				http.Error(w, err.Error(), http.StatusConflict)
+				return
+			}
+			http.Error(w, err.Error(), http.StatusForbidden)
+			return
+		}
+
+		eff, err := h.settings.Resolve(ctx, subject, target, cred)
+		if err != nil {
+			http.Error(w, "Failed to resolve session settings", http.StatusInternalServerError)
+			return
+		}
+		if !eff.Allows(target.Protocol) {
+			http.Error(w, "Protocol not allowed for this target", http.StatusForbidden)
+			return
+		}
+
+		duration := h.broker.SessionDuration()
+		if left := windowEnd.Sub(now); left < duration {
+			duration = left
+		}
+		if max := time.Duration(eff.MaxDuration) * time.Second; max > 0 && max < duration {
+			duration = max
+		}
+		duration = duration.Truncate(time.Second)
+
+		user, err := h.userRepo.GetByID(ctx, userID)
+		if err != nil {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		secret, err := h.vault.GetCredentials(ctx, cred.VaultSecretPath)
+		if err != nil {
+			h.logger.Error("Failed to retrieve credentials from Vault", map[string]interface{}{
+				"vault_path": cred.VaultSecretPath,
+				"error":      err.Error(),
+			})
+			http.Error(w, "Failed to retrieve credentials", http.StatusInternalServerError)
+			return
+		}
+
+		grant, err := h.broker.Start(ctx, cloud.Request{
+			Provider:      target.Protocol,
+			Account:       target.Hostname,
+			Role:          cred.Username,
+			Key:           secret.Username,
+			Secret:        secret.Password,
+			UserEmail:     user.Email,
+			PrincipalID:   user.EntraID,
+			Justification: req.Justification,
+			Duration:      duration,
+		})
+
+		session := h.record(r, userID, target, cred, req.Justification, grant, err)
+		if err != nil {
+			h.logger.Warn("Cloud session refused", map[string]interface{}{
+				"target_id": targetID.String(),
+				"user":      userEmail,
+				"role":      cred.Username,
+				"error":     err.Error(),
+			})
+			switch {
+			case errors.Is(err, cloud.ErrTooShort):
+				http.Error(w, "Forbidden: the schedule window ends too soon for a session", http.StatusForbidden)
+			case errors.Is(err, cloud.ErrNoPrincipal), errors.Is(err, cloud.ErrInvalidRole):
+				http.Error(w, err.Error(), http.StatusBadRequest)
+			default:
+				http.Error(w, "Failed to start cloud session: "+err.Error(), http.StatusBadGateway)
+			}
+			return
+		}
+
+		h.logger.Info("Cloud session started", map[string]interface{}{
+			"session_id": session.ID.String(),
+			"target_id":  targetID.String(),
+			"user":       userEmail,
+			"provider":   grant.Provider,
+			"role":       grant.Role,
+			"expires_at": grant.ExpiresAt,
+		})
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "no-store")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(CloudSessionResponse{SessionID: session.ID, Grant: grant})
+	}
+}
+
+// record stores the session, granted or failed, and audits which role was
+// assumed for whom until when
+func (h *CloudSessionHandler) record(r *http.Request, userID uuid.UUID, target *models.Target, cred *models.Credential, justification string, grant *cloud.Grant, grantErr error) *models.CloudSession {
+	ctx := r.Context()
+	ip := r.RemoteAddr
+
+	session := &models.CloudSession{
+		ID:           uuid.New(),
+		TargetID:     &target.ID,
+		CredentialID: &cred.ID,
+		UserID:       &userID,
+		Provider:     target.Protocol,
+		Role:         cred.Username,
+		SessionName:  cloud.SessionName(middleware.GetUserEmail(ctx)),
+		Status:       models.CloudSessionGranted,
+		ClientIP:     &ip,
+		StartedAt:    time.Now(),
+	}
+	if justification != "" {
+		session.Justification = &justification
+	}
+
+	details := map[string]interface{}{
+		"session_id":  session.ID.String(),
+		"target_id":   target.ID.String(),
+		"target_name": target.Name,
+		"provider":    target.Protocol,
+		"role":        cred.Username,
+	}
+	status := "success"
+
+	if grantErr != nil {
+		msg := grantErr.Error()
+		session.Status = models.CloudSessionFailed
+		session.Error = &msg
+		details["error"] = msg
+		status = "failure"
+	} else {
+		session.SessionName = grant.SessionName
+		session.ExpiresAt = &grant.ExpiresAt
+		if grant.ExternalID != "" {
+			session.ExternalID = &grant.ExternalID
+		}
+		details["session_name"] = grant.SessionName
+		details["external_id"] = grant.ExternalID
+		details["expires_at"] = grant.ExpiresAt
+	}
+
+	if err := h.cloudRepo.Create(ctx, session); err != nil {
+		h.logger.Error("Failed to record cloud session", map[string]interface{}{
+			"session_id": session.ID.String(),
+			"error":      err.Error(),
+		})
+	}
+	if err := h.auditRepo.CreateSimple(ctx, models.EventTypeCloudSession, &userID, "start", status, &ip, details); err != nil {
+		h.logger.Error("Failed to audit cloud session", map[string]interface{}{
+			"session_id": session.ID.String(),
+			"error":      err.Error(),
+		})
+	}
+
+	return session
+}
+
+// HandleList lists brokered cloud sessions, newest first. Admins and auditors
+// see everyone's; other users only their own.
+// Route: GET /api/v1/cloud-sessions?target_id=&user_id=&provider=&limit=100
+func (h *CloudSessionHandler) HandleList() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		query := r.URL.Query()
+		filter := repository.CloudSessionFilter{
+			Provider: query.Get("provider"),
+			Limit:    100,
+		}
+
+		if t := query.Get("target_id"); t != "" {
+			id, err := uuid.Parse(t)
+			if err != nil {
+				http.Error(w, "Invalid target ID", http.StatusBadRequest)
+				return
+			}
+			filter.TargetID = &id
+		}
+		if u := query.Get("user_id"); u != "" {
+			id, err := uuid.Parse(u)
+			if err != nil {
+				http.Error(w, "Invalid user ID", http.StatusBadRequest)
+				return
+			}
+			filter.UserID = &id
+		}
+		if l := query.Get("limit"); l != "" {
+			if parsed, err := strconv.Atoi(l); err == nil && parsed > 0 && parsed <= 500 {
+				filter.Limit = parsed
+			}
+		}
+
+		if role := middleware.GetUserRole(ctx); role != models.RoleAdmin && role != models.RoleAuditor {
+			userID, err := uuid.Parse(middleware.GetUserID(ctx))
+			if err != nil {
+				http.Error(w, "Unauthorized", http.StatusUnauthorized)
+				return
+			}
+			filter.UserID = &userID
+		}
+
+		sessions, err := h.cloudRepo.ListSessions(ctx, filter)
+		if err != nil {
+			h.logger.Error("Failed to list cloud sessions", map[string]interface{}{
+				"error": err.Error(),
+			})
+			http.Error(w, "Failed to list cloud sessions", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"sessions": sessions,
+			"count":    len(sessions),
+		})
+	}
+}
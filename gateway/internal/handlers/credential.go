@@ -2,28 +2,100 @@ package handlers
 
 import (
 	"encoding/json"
+	"errors"
 	"net/http"
+	"time"
 
-	"github.com/VanCannon/openpam/gateway/internal/logger"
+	"github.com/VanCannon/openpam/gateway/internal/middleware"
 	"github.com/VanCannon/openpam/gateway/internal/models"
+	"github.com/VanCannon/openpam/gateway/internal/policy"
 	"github.com/VanCannon/openpam/gateway/internal/repository"
+	"github.com/VanCannon/openpam/gateway/internal/validate"
+	"github.com/VanCannon/openpam/gateway/internal/vault"
+	"github.com/VanCannon/openpam/pkg/logger"
 	"github.com/google/uuid"
 )
 
 // CredentialHandler handles credential-related requests
 type CredentialHandler struct {
-	credRepo *repository.CredentialRepository
-	logger   *logger.Logger
+	credRepo   *repository.CredentialRepository
+	targetRepo *repository.TargetRepository
+	userRepo   *repository.UserRepository
+	auditRepo  *repository.SystemAuditLogRepository
+	policy     *policy.Engine
+	vault      *vault.Client
+	logger     *logger.Logger
 }
 
 // NewCredentialHandler creates a new credential handler
-func NewCredentialHandler(credRepo *repository.CredentialRepository, log *logger.Logger) *CredentialHandler {
+func NewCredentialHandler(
+	credRepo *repository.CredentialRepository,
+	targetRepo *repository.TargetRepository,
+	userRepo *repository.UserRepository,
+	auditRepo *repository.SystemAuditLogRepository,
+	policyEngine *policy.Engine,
+	vaultClient *vault.Client,
+	log *logger.Logger,
+) *CredentialHandler {
 	return &CredentialHandler{
-		credRepo: credRepo,
-		logger:   log,
+		credRepo:   credRepo,
+		targetRepo: targetRepo,
+		userRepo:   userRepo,
+		auditRepo:  auditRepo,
+		policy:     policyEngine,
+		vault:      vaultClient,
+		logger:     log,
 	}
 }
 
+// credResponse is a credential as exposed to API consumers, without vault_secret_path
+type credResponse struct {
+	ID          string   `json:"id"`
+	TargetID    string   `json:"target_id"`
+	Username    string   `json:"username"`
+	Description string   `json:"description,omitempty"`
+	IsDefault   bool     `json:"is_default"`
+	SortOrder   int      `json:"sort_order"`
+	Tags        []string `json:"tags"`
+	Version     int      `json:"version"`
+
+	CertificateSubject   *string    `json:"certificate_subject,omitempty"`
+	CertificateExpiresAt *time.Time `json:"certificate_expires_at,omitempty"`
+
+	AuthFailures      int        `json:"auth_failures"`
+	LastAuthFailureAt *time.Time `json:"last_auth_failure_at,omitempty"`
+	LastAuthFailure   *string    `json:"last_auth_failure,omitempty"`
+	QuarantinedAt     *time.Time `json:"quarantined_at,omitempty"`
+}
+
+func toCredResponses(creds []*models.Credential) []credResponse {
+	response := make([]credResponse, len(creds))
+	for i, cred := range creds {
+		response[i] = credResponse{
+			ID:          cred.ID.String(),
+			TargetID:    cred.TargetID.String(),
+			Username:    cred.Username,
+			Description: cred.Description,
+			IsDefault:   cred.IsDefault,
+			SortOrder:   cred.SortOrder,
+			Tags:        cred.Tags,
+			Version:     cred.Version,
+
+			CertificateSubject:   cred.CertificateSubject,
+			CertificateExpiresAt: cred.CertificateExpiresAt,
+
+			AuthFailures:      cred.AuthFailures,
+			LastAuthFailureAt: cred.LastAuthFailureAt,
+			LastAuthFailure:   cred.LastAuthFailure,
+			QuarantinedAt:     cred.QuarantinedAt,
+		}
+		if response[i].Tags == nil {
+			response[i].Tags = []string{}
+		}
+	}
+	return response
+}
+
 // HandleListByTarget lists credentials for a target
 func (h *CredentialHandler) HandleListByTarget() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
@@ -51,22 +123,7 @@ func (h *CredentialHandler) HandleListByTarget() http.HandlerFunc {
 		}
 
 		// Don't expose vault_secret_path to API consumers
-		type credResponse struct {
-			ID          string `json:"id"`
-			TargetID    string `json:"target_id"`
-			Username    string `json:"username"`
-			Description string `json:"description,omitempty"`
-		}
-
-		response := make([]credResponse, len(creds))
-		for i, cred := range creds {
-			response[i] = credResponse{
-				ID:          cred.ID.String(),
-				TargetID:    cred.TargetID.String(),
-				Username:    cred.Username,
-				Description: cred.Description,
-			}
-		}
+		response := toCredResponses(creds)
 
 		w.Header().Set("Content-Type", "application/json")
 		json.NewEncoder(w).Encode(map[string]interface{}{
@@ -76,30 +133,117 @@ func (h *CredentialHandler) HandleListByTarget() http.HandlerFunc {
 	}
 }
 
-// HandleCreate creates a new credential
-func (h *CredentialHandler) HandleCreate() http.HandlerFunc {
+// HandleListAllowed lists the credentials the current user may use to connect to a target,
+// in the order they would be selected. Admins may pass user_id to see another user's view.
+// Route: GET /api/v1/targets/{id}/credentials
+func (h *CredentialHandler) HandleListAllowed() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		if r.Method != http.MethodPost {
+		if r.Method != http.MethodGet {
 			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 			return
 		}
 
 		ctx := r.Context()
 
-		var req struct {
-			TargetID        string `json:"target_id"`
-			Username        string `json:"username"`
-			VaultSecretPath string `json:"vault_secret_path"`
-			Description     string `json:"description"`
+		targetID, err := uuid.Parse(r.PathValue("id"))
+		if err != nil {
+			http.Error(w, "Invalid target ID", http.StatusBadRequest)
+			return
 		}
 
-		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-			http.Error(w, "Invalid request body", http.StatusBadRequest)
+		userID, err := uuid.Parse(middleware.GetUserID(ctx))
+		if err != nil {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
 			return
 		}
+		subject := policy.Subject{UserID: userID, Role: middleware.GetUserRole(ctx)}
 
-		if req.TargetID == "" || req.Username == "" || req.VaultSecretPath == "" {
-			http.Error(w, "Missing required fields", http.StatusBadRequest)
+		if userIDStr := r.URL.Query().Get("user_id"); userIDStr != "" && userIDStr != userID.String() {
+			if subject.Role != models.RoleAdmin {
+				http.Error(w, "Forbidden", http.StatusForbidden)
+				return
+			}
+
+			otherID, err := uuid.Parse(userIDStr)
+			if err != nil {
+				http.Error(w, "Invalid user ID", http.StatusBadRequest)
+				return
+			}
+
+			user, err := h.userRepo.GetByID(ctx, otherID)
+			if err != nil {
+				http.Error(w, "User not found", http.StatusNotFound)
+				return
+			}
+			subject = policy.Subject{UserID: user.ID, Role: user.Role}
+		}
+
+		target, err := h.targetRepo.GetByID(ctx, targetID)
+		if err != nil {
+			http.Error(w, "Target not found", http.StatusNotFound)
+			return
+		}
+
+		creds, err := h.credRepo.GetByTargetID(ctx, targetID)
+		if err != nil {
+			h.logger.Error("Failed to list credentials", map[string]interface{}{
+				"error": err.Error(),
+			})
+			http.Error(w, "Failed to list credentials", http.StatusInternalServerError)
+			return
+		}
+
+		allowed, err := h.policy.AllowedCredentials(ctx, subject, target, creds)
+		if err != nil {
+			h.logger.Error("Failed to evaluate credential policy", map[string]interface{}{
+				"error": err.Error(),
+			})
+			http.Error(w, "Failed to list credentials", http.StatusInternalServerError)
+			return
+		}
+		response := toCredResponses(allowed)
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"credentials": response,
+			"count":       len(response),
+		})
+	}
+}
+
+// createCredentialRequest is the body of a new credential
+type createCredentialRequest struct {
+	TargetID        string   `json:"target_id"`
+	Username        string   `json:"username"`
+	VaultSecretPath string   `json:"vault_secret_path"`
+	Description     string   `json:"description"`
+	IsDefault       bool     `json:"is_default"`
+	SortOrder       int      `json:"sort_order"`
+	Tags            []string `json:"tags"`
+}
+
+// Validate checks the fields of a new credential
+func (req *createCredentialRequest) Validate() validate.Errors {
+	var errs validate.Errors
+	errs.Required("target_id", req.TargetID)
+	errs.Required("username", req.Username)
+	errs.MaxLength("username", req.Username, 255)
+	errs.Required("vault_secret_path", req.VaultSecretPath)
+	return errs
+}
+
+// HandleCreate creates a new credential
+func (h *CredentialHandler) HandleCreate() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		ctx := r.Context()
+
+		var req createCredentialRequest
+		if !validate.Decode(w, r, &req) {
 			return
 		}
 
@@ -114,9 +258,15 @@ func (h *CredentialHandler) HandleCreate() http.HandlerFunc {
 			Username:        req.Username,
 			VaultSecretPath: req.VaultSecretPath,
 			Description:     req.Description,
+			IsDefault:       req.IsDefault,
+			SortOrder:       req.SortOrder,
+			Tags:            req.Tags,
 		}
 
 		if err := h.credRepo.Create(ctx, cred); err != nil {
+			if writeOutsideZones(w, err) {
+				return
+			}
 			h.logger.Error("Failed to create credential", map[string]interface{}{
 				"error": err.Error(),
 			})
@@ -148,13 +298,16 @@ func (h *CredentialHandler) HandleUpdate() http.HandlerFunc {
 		}
 
 		var req struct {
-			Username        string `json:"username"`
-			VaultSecretPath string `json:"vault_secret_path"`
-			Description     string `json:"description"`
+			Username        string   `json:"username"`
+			VaultSecretPath string   `json:"vault_secret_path"`
+			Description     string   `json:"description"`
+			IsDefault       *bool    `json:"is_default"`
+			SortOrder       *int     `json:"sort_order"`
+			Tags            []string `json:"tags"`
+			Version         *int     `json:"version"`
 		}
 
-		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-			http.Error(w, "Invalid request body", http.StatusBadRequest)
+		if !validate.Decode(w, r, &req) {
 			return
 		}
 
@@ -163,6 +316,11 @@ func (h *CredentialHandler) HandleUpdate() http.HandlerFunc {
 			return
 		}
 
+		version, ok := requireVersion(w, r, req.Version)
+		if !ok {
+			return
+		}
+
 		// Get existing credential to preserve other fields
 		existingCred, err := h.credRepo.GetByID(ctx, credID)
 		if err != nil {
@@ -173,11 +331,34 @@ func (h *CredentialHandler) HandleUpdate() http.HandlerFunc {
 			return
 		}
 
+		if existingCred.Version != version {
+			writeVersionConflict(w, existingCred.Version, existingCred)
+			return
+		}
+
 		existingCred.Username = req.Username
 		existingCred.VaultSecretPath = req.VaultSecretPath
 		existingCred.Description = req.Description
+		if req.IsDefault != nil {
+			existingCred.IsDefault = *req.IsDefault
+		}
+		if req.SortOrder != nil {
+			existingCred.SortOrder = *req.SortOrder
+		}
+		if req.Tags != nil {
+			existingCred.Tags = req.Tags
+		}
 
 		if err := h.credRepo.Update(ctx, existingCred); err != nil {
+			if writeOutsideZones(w, err) {
+				return
+			}
+			if errors.Is(err, repository.ErrVersionConflict) {
+				if current, err := h.credRepo.GetByID(ctx, credID); err == nil {
+					writeVersionConflict(w, current.Version, current)
+					return
+				}
+			}
 			h.logger.Error("Failed to update credential", map[string]interface{}{
 				"error": err.Error(),
 			})
@@ -185,11 +366,44 @@ func (h *CredentialHandler) HandleUpdate() http.HandlerFunc {
 			return
 		}
 
+		setETag(w, existingCred.Version)
 		w.Header().Set("Content-Type", "application/json")
 		json.NewEncoder(w).Encode(existingCred)
 	}
 }
 
+// Current loads the credential an update or delete request would change, for
+// staging the request under dual control
+func (h *CredentialHandler) Current(r *http.Request) (interface{}, error) {
+	id, err := uuid.Parse(r.URL.Query().Get("id"))
+	if err != nil {
+		return nil, err
+	}
+	return h.credRepo.GetByID(r.Context(), id)
+}
+
+// CheckZone refuses a zone admin's create, update or delete of a credential
+// outside their zones, before it is staged under dual control
+func (h *CredentialHandler) CheckZone(r *http.Request, body []byte) error {
+	if r.Method == http.MethodPost {
+		var req createCredentialRequest
+		if err := json.Unmarshal(body, &req); err != nil {
+			return err
+		}
+		targetID, err := uuid.Parse(req.TargetID)
+		if err != nil {
+			return err
+		}
+		return h.credRepo.CheckTargetZone(r.Context(), targetID)
+	}
+
+	id, err := uuid.Parse(r.URL.Query().Get("id"))
+	if err != nil {
+		return err
+	}
+	return h.credRepo.CheckZone(r.Context(), id)
+}
+
 // HandleDelete deletes a credential
 func (h *CredentialHandler) HandleDelete() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
@@ -208,6 +422,9 @@ func (h *CredentialHandler) HandleDelete() http.HandlerFunc {
 		}
 
 		if err := h.credRepo.Delete(ctx, credID); err != nil {
+			if writeOutsideZones(w, err) {
+				return
+			}
 			h.logger.Error("Failed to delete credential", map[string]interface{}{
 				"error": err.Error(),
 			})
@@ -0,0 +1,131 @@
+package handlers
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/VanCannon/openpam/gateway/internal/models"
+	"github.com/VanCannon/openpam/gateway/internal/validate"
+	"github.com/VanCannon/openpam/gateway/internal/vault"
+	"github.com/google/uuid"
+)
+
+// SetCertificateRequest is a client certificate and its private key, PEM-encoded
+type SetCertificateRequest struct {
+	Certificate string `json:"certificate"`
+	PrivateKey  string `json:"private_key"`
+}
+
+// HandleSetCertificate stores a client certificate for smart card RDP logon
+// with a credential's secret in Vault, and tracks its expiry
+// Route: PUT /api/v1/credentials/{id}/certificate
+func (h *CredentialHandler) HandleSetCertificate() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+
+		credID, err := uuid.Parse(r.PathValue("id"))
+		if err != nil {
+			http.Error(w, "Invalid credential ID", http.StatusBadRequest)
+			return
+		}
+
+		var req SetCertificateRequest
+		if !validate.Decode(w, r, &req) {
+			return
+		}
+
+		cert, err := parseClientCertificate(req.Certificate, req.PrivateKey)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if !time.Now().Before(cert.NotAfter) {
+			http.Error(w, "Certificate has expired", http.StatusBadRequest)
+			return
+		}
+
+		cred, err := h.credRepo.GetByID(ctx, credID)
+		if err != nil {
+			http.Error(w, "Credential not found", http.StatusNotFound)
+			return
+		}
+		if strings.HasPrefix(cred.VaultSecretPath, "raw:") {
+			http.Error(w, "Certificates can only be stored with credentials kept in Vault", http.StatusBadRequest)
+			return
+		}
+
+		// Keep the rest of the secret, such as the password guacd falls back to
+		secret, err := h.vault.GetCredentials(ctx, cred.VaultSecretPath)
+		if err != nil {
+			secret = &vault.Credentials{Username: cred.Username}
+		}
+		secret.Certificate = req.Certificate
+		secret.PrivateKey = req.PrivateKey
+
+		if err := h.vault.PutCredentials(ctx, cred.VaultSecretPath, secret); err != nil {
+			h.logger.Error("Failed to store certificate in Vault", map[string]interface{}{
+				"credential_id": credID.String(),
+				"error":         err.Error(),
+			})
+			http.Error(w, "Failed to store certificate", http.StatusInternalServerError)
+			return
+		}
+
+		subject := cert.Subject.String()
+		if err := h.credRepo.SetCertificate(ctx, credID, subject, cert.NotAfter); err != nil {
+			h.logger.Error("Failed to record credential certificate", map[string]interface{}{
+				"credential_id": credID.String(),
+				"error":         err.Error(),
+			})
+			http.Error(w, "Failed to record certificate", http.StatusInternalServerError)
+			return
+		}
+
+		userID, ip := requester(r)
+		details := map[string]interface{}{
+			"credential_id": credID.String(),
+			"target_id":     cred.TargetID.String(),
+			"subject":       subject,
+			"serial":        cert.SerialNumber.String(),
+			"expires_at":    cert.NotAfter,
+		}
+		if err := h.auditRepo.CreateSimple(ctx, models.EventTypeCertificateUploaded, userID, "upload", models.AuditStatusSuccess, &ip, details); err != nil {
+			h.logger.Error("Failed to create system audit log", map[string]interface{}{
+				"error": err.Error(),
+			})
+		}
+
+		cred, err = h.credRepo.GetByID(ctx, credID)
+		if err != nil {
+			http.Error(w, "Credential not found", http.StatusNotFound)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(toCredResponses([]*models.Credential{cred})[0])
+	}
+}
+
+// parseClientCertificate checks that the certificate and key belong together
+// and returns the certificate
+func parseClientCertificate(certPEM, keyPEM string) (*x509.Certificate, error) {
+	if certPEM == "" || keyPEM == "" {
+		return nil, errors.New("certificate and private_key are required")
+	}
+
+	pair, err := tls.X509KeyPair([]byte(certPEM), []byte(keyPEM))
+	if err != nil {
+		return nil, errors.New("certificate and private key are invalid or don't match")
+	}
+
+	cert, err := x509.ParseCertificate(pair.Certificate[0])
+	if err != nil {
+		return nil, errors.New("invalid certificate")
+	}
+	return cert, nil
+}
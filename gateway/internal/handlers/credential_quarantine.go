@@ -0,0 +1,61 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/VanCannon/openpam/gateway/internal/models"
+	"github.com/google/uuid"
+)
+
+// HandleRelease releases a credential from quarantine and clears its failed
+// logons, once an admin has rotated its secret in place in Vault
+// Route: DELETE /api/v1/credentials/{id}/quarantine
+func (h *CredentialHandler) HandleRelease() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+
+		credID, err := uuid.Parse(r.PathValue("id"))
+		if err != nil {
+			http.Error(w, "Invalid credential ID", http.StatusBadRequest)
+			return
+		}
+
+		cred, err := h.credRepo.GetByID(ctx, credID)
+		if err != nil {
+			http.Error(w, "Credential not found", http.StatusNotFound)
+			return
+		}
+
+		if err := h.credRepo.ClearAuthFailures(ctx, credID); err != nil {
+			h.logger.Error("Failed to release credential", map[string]interface{}{
+				"credential_id": credID.String(),
+				"error":         err.Error(),
+			})
+			http.Error(w, "Failed to release credential", http.StatusInternalServerError)
+			return
+		}
+
+		userID, ip := requester(r)
+		details := map[string]interface{}{
+			"credential_id": credID.String(),
+			"target_id":     cred.TargetID.String(),
+			"failures":      cred.AuthFailures,
+			"quarantined":   cred.Quarantined(),
+		}
+		if err := h.auditRepo.CreateSimple(ctx, models.EventTypeCredentialReleased, userID, "release", models.AuditStatusSuccess, &ip, details); err != nil {
+			h.logger.Error("Failed to create system audit log", map[string]interface{}{
+				"error": err.Error(),
+			})
+		}
+
+		cred, err = h.credRepo.GetByID(ctx, credID)
+		if err != nil {
+			http.Error(w, "Credential not found", http.StatusNotFound)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(toCredResponses([]*models.Credential{cred})[0])
+	}
+}
@@ -0,0 +1,266 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/VanCannon/openpam/gateway/internal/models"
+	"github.com/VanCannon/openpam/gateway/internal/policy"
+	"github.com/VanCannon/openpam/gateway/internal/repository"
+	"github.com/VanCannon/openpam/gateway/internal/validate"
+	"github.com/VanCannon/openpam/pkg/logger"
+	"github.com/google/uuid"
+)
+
+// CredentialRuleHandler handles credential access rule requests
+type CredentialRuleHandler struct {
+	ruleRepo *repository.CredentialRuleRepository
+	logger   *logger.Logger
+}
+
+// NewCredentialRuleHandler creates a new credential rule handler
+func NewCredentialRuleHandler(ruleRepo *repository.CredentialRuleRepository, log *logger.Logger) *CredentialRuleHandler {
+	return &CredentialRuleHandler{
+		ruleRepo: ruleRepo,
+		logger:   log,
+	}
+}
+
+// credentialRuleRequest is the body accepted by create and update
+type credentialRuleRequest struct {
+	Name          string                  `json:"name"`
+	Description   *string                 `json:"description"`
+	Effect        string                  `json:"effect"`
+	UserID        *uuid.UUID              `json:"user_id"`
+	Role          *string                 `json:"role"`
+	GroupID       *uuid.UUID              `json:"group_id"`
+	TargetID      *uuid.UUID              `json:"target_id"`
+	CredentialID  *uuid.UUID              `json:"credential_id"`
+	CredentialTag *string                 `json:"credential_tag"`
+	Condition     *string                 `json:"condition"`
+	Enabled       *bool                   `json:"enabled"`
+	Settings      *models.SessionSettings `json:"settings"`
+}
+
+// validate returns a client-facing message for the first problem found, or ""
+func (req *credentialRuleRequest) validate() string {
+	if req.Name == "" {
+		return "Missing required fields"
+	}
+	if req.Effect != models.RuleEffectAllow && req.Effect != models.RuleEffectDeny {
+		return "Invalid effect: must be 'allow' or 'deny'"
+	}
+	if req.Role != nil && *req.Role != models.RoleAdmin && *req.Role != models.RoleUser && *req.Role != models.RoleAuditor {
+		return "Invalid role"
+	}
+	if req.CredentialTag != nil && *req.CredentialTag == "" {
+		req.CredentialTag = nil
+	}
+	if req.CredentialID == nil && req.CredentialTag == nil {
+		return "Either credential_id or credential_tag is required"
+	}
+	if req.Condition != nil && strings.TrimSpace(*req.Condition) == "" {
+		req.Condition = nil
+	}
+	if req.Condition != nil {
+		if _, err := policy.CompileCondition(*req.Condition); err != nil {
+			return "Invalid condition: " + err.Error()
+		}
+	}
+	if req.Settings != nil {
+		if req.Effect != models.RuleEffectAllow {
+			return "Settings can only be set on allow rules"
+		}
+		if req.Settings.Banner != nil || req.Settings.BannerRequired != nil {
+			return "Banners can only be set on a zone or target"
+		}
+		if err := req.Settings.Validate(false); err != nil {
+			return err.Error()
+		}
+	}
+	return ""
+}
+
+// apply copies the request onto a rule
+func (req *credentialRuleRequest) apply(rule *models.CredentialRule) {
+	rule.Name = req.Name
+	rule.Description = req.Description
+	rule.Effect = req.Effect
+	rule.UserID = req.UserID
+	rule.Role = req.Role
+	rule.GroupID = req.GroupID
+	rule.TargetID = req.TargetID
+	rule.CredentialID = req.CredentialID
+	rule.CredentialTag = req.CredentialTag
+	rule.Condition = req.Condition
+	if req.Enabled != nil {
+		rule.Enabled = *req.Enabled
+	}
+	if req.Settings != nil {
+		rule.Settings = *req.Settings
+	}
+}
+
+// HandleRules routes collection requests based on HTTP method
+// Route: /api/v1/credential-rules
+func (h *CredentialRuleHandler) HandleRules() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			h.HandleList()(w, r)
+		case http.MethodPost:
+			h.HandleCreate()(w, r)
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	}
+}
+
+// HandleRule routes single-rule requests based on HTTP method
+// Route: /api/v1/credential-rules/{id}
+func (h *CredentialRuleHandler) HandleRule() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodPut:
+			h.HandleUpdate()(w, r)
+		case http.MethodDelete:
+			h.HandleDelete()(w, r)
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	}
+}
+
+// HandleList lists all credential rules
+func (h *CredentialRuleHandler) HandleList() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		rules, err := h.ruleRepo.List(r.Context())
+		if err != nil {
+			h.logger.Error("Failed to list credential rules", map[string]interface{}{
+				"error": err.Error(),
+			})
+			http.Error(w, "Failed to list credential rules", http.StatusInternalServerError)
+			return
+		}
+
+		if rules == nil {
+			rules = []*models.CredentialRule{}
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"rules": rules,
+			"count": len(rules),
+		})
+	}
+}
+
+// HandleCreate creates a new credential rule
+func (h *CredentialRuleHandler) HandleCreate() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req credentialRuleRequest
+		if !validate.Decode(w, r, &req) {
+			return
+		}
+
+		if msg := req.validate(); msg != "" {
+			http.Error(w, msg, http.StatusBadRequest)
+			return
+		}
+
+		rule := &models.CredentialRule{Enabled: true}
+		req.apply(rule)
+
+		if err := h.ruleRepo.Create(r.Context(), rule); err != nil {
+			h.logger.Error("Failed to create credential rule", map[string]interface{}{
+				"error": err.Error(),
+			})
+			http.Error(w, "Failed to create credential rule", http.StatusInternalServerError)
+			return
+		}
+
+		h.logger.Info("Credential rule created", map[string]interface{}{
+			"rule_id": rule.ID.String(),
+			"name":    rule.Name,
+			"effect":  rule.Effect,
+		})
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(rule)
+	}
+}
+
+// HandleUpdate replaces an existing credential rule
+func (h *CredentialRuleHandler) HandleUpdate() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+
+		id, err := uuid.Parse(r.PathValue("id"))
+		if err != nil {
+			http.Error(w, "Invalid rule ID", http.StatusBadRequest)
+			return
+		}
+
+		var req credentialRuleRequest
+		if !validate.Decode(w, r, &req) {
+			return
+		}
+
+		if msg := req.validate(); msg != "" {
+			http.Error(w, msg, http.StatusBadRequest)
+			return
+		}
+
+		rule, err := h.ruleRepo.GetByID(ctx, id)
+		if err != nil {
+			http.Error(w, "Credential rule not found", http.StatusNotFound)
+			return
+		}
+
+		req.apply(rule)
+
+		if err := h.ruleRepo.Update(ctx, rule); err != nil {
+			h.logger.Error("Failed to update credential rule", map[string]interface{}{
+				"error": err.Error(),
+			})
+			http.Error(w, "Failed to update credential rule", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(rule)
+	}
+}
+
+// Current loads the rule an update or delete request would change, for
+// staging the request under dual control
+func (h *CredentialRuleHandler) Current(r *http.Request) (interface{}, error) {
+	id, err := uuid.Parse(r.PathValue("id"))
+	if err != nil {
+		return nil, err
+	}
+	return h.ruleRepo.GetByID(r.Context(), id)
+}
+
+// HandleDelete deletes a credential rule
+func (h *CredentialRuleHandler) HandleDelete() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, err := uuid.Parse(r.PathValue("id"))
+		if err != nil {
+			http.Error(w, "Invalid rule ID", http.StatusBadRequest)
+			return
+		}
+
+		if err := h.ruleRepo.Delete(r.Context(), id); err != nil {
+			h.logger.Error("Failed to delete credential rule", map[string]interface{}{
+				"error": err.Error(),
+			})
+			http.Error(w, "Failed to delete credential rule", http.StatusInternalServerError)
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
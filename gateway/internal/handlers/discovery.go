@@ -0,0 +1,245 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/VanCannon/openpam/gateway/internal/discovery"
+	"github.com/VanCannon/openpam/gateway/internal/middleware"
+	"github.com/VanCannon/openpam/gateway/internal/repository"
+	"github.com/VanCannon/openpam/gateway/internal/validate"
+	"github.com/VanCannon/openpam/pkg/logger"
+	"github.com/google/uuid"
+)
+
+// DiscoveryHandler handles account discovery scans and the discovered account inventory
+type DiscoveryHandler struct {
+	discoveryRepo *repository.DiscoveryRepository
+	scanner       *discovery.Scanner
+	logger        *logger.Logger
+}
+
+// NewDiscoveryHandler creates a new discovery handler
+func NewDiscoveryHandler(discoveryRepo *repository.DiscoveryRepository, scanner *discovery.Scanner, log *logger.Logger) *DiscoveryHandler {
+	return &DiscoveryHandler{
+		discoveryRepo: discoveryRepo,
+		scanner:       scanner,
+		logger:        log,
+	}
+}
+
+// StartScanRequest selects the credential a scan logs in with
+type StartScanRequest struct {
+	CredentialID *uuid.UUID `json:"credential_id,omitempty"` // Defaults to the target's default credential
+}
+
+// HandleStartScan starts scanning a target's local accounts. The scan runs in
+// the background; its outcome is listed with the target's scans.
+// Route: POST /api/v1/targets/{id}/discovery-scans
+func (h *DiscoveryHandler) HandleStartScan() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		targetID, err := uuid.Parse(r.PathValue("id"))
+		if err != nil {
+			http.Error(w, "Invalid target ID", http.StatusBadRequest)
+			return
+		}
+
+		var req StartScanRequest
+		if r.ContentLength != 0 {
+			if !validate.Decode(w, r, &req) {
+				return
+			}
+		}
+
+		startedBy, _ := requester(r)
+		scan, err := h.scanner.StartScan(r.Context(), targetID, req.CredentialID, startedBy)
+		if err != nil {
+			switch {
+			case errors.Is(err, repository.ErrScanRunning):
+				http.Error(w, err.Error(), http.StatusConflict)
+			case errors.Is(err, discovery.ErrUnsupportedProtocol), errors.Is(err, discovery.ErrNoCredential):
+				http.Error(w, err.Error(), http.StatusBadRequest)
+			default:
+				h.logger.Warn("Failed to start discovery scan", map[string]interface{}{
+					"target_id": targetID.String(),
+					"error":     err.Error(),
+				})
+				http.Error(w, "Target or credential not found", http.StatusNotFound)
+			}
+			return
+		}
+
+		h.logger.Info("Discovery scan started", map[string]interface{}{
+			"scan_id":    scan.ID.String(),
+			"target_id":  targetID.String(),
+			"started_by": middleware.GetUserEmail(r.Context()),
+		})
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusAccepted)
+		json.NewEncoder(w).Encode(scan)
+	}
+}
+
+// HandleListScans lists a target's discovery scans, newest first
+// Route: GET /api/v1/targets/{id}/discovery-scans?limit=20
+func (h *DiscoveryHandler) HandleListScans() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		targetID, err := uuid.Parse(r.PathValue("id"))
+		if err != nil {
+			http.Error(w, "Invalid target ID", http.StatusBadRequest)
+			return
+		}
+
+		limit := 20
+		if l := r.URL.Query().Get("limit"); l != "" {
+			if parsed, err := strconv.Atoi(l); err == nil && parsed > 0 && parsed <= 200 {
+				limit = parsed
+			}
+		}
+
+		scans, err := h.discoveryRepo.ListScans(r.Context(), targetID, limit)
+		if err != nil {
+			h.logger.Error("Failed to list discovery scans", map[string]interface{}{
+				"target_id": targetID.String(),
+				"error":     err.Error(),
+			})
+			http.Error(w, "Failed to list discovery scans", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"scans": scans,
+			"count": len(scans),
+		})
+	}
+}
+
+// HandleListAccounts lists discovered accounts, unmanaged privileged accounts first
+// Route: GET /api/v1/discovered-accounts?target_id=&privileged=true&managed=false&include_removed=false
+func (h *DiscoveryHandler) HandleListAccounts() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		var filter repository.DiscoveredAccountFilter
+
+		if t := query.Get("target_id"); t != "" {
+			id, err := uuid.Parse(t)
+			if err != nil {
+				http.Error(w, "Invalid target ID", http.StatusBadRequest)
+				return
+			}
+			filter.TargetID = &id
+		}
+		if v := query.Get("privileged"); v != "" {
+			privileged := v == "true"
+			filter.Privileged = &privileged
+		}
+		if v := query.Get("managed"); v != "" {
+			managed := v == "true"
+			filter.Managed = &managed
+		}
+		filter.IncludeRemoved = query.Get("include_removed") == "true"
+
+		accounts, err := h.discoveryRepo.ListAccounts(r.Context(), filter)
+		if err != nil {
+			h.logger.Error("Failed to list discovered accounts", map[string]interface{}{
+				"error": err.Error(),
+			})
+			http.Error(w, "Failed to list discovered accounts", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"accounts": accounts,
+			"count":    len(accounts),
+		})
+	}
+}
+
+// HandleOnboard brings a discovered account under management with a generated
+// password stored in Vault, and returns the credential created for it
+// Route: POST /api/v1/discovered-accounts/{id}/onboard
+func (h *DiscoveryHandler) HandleOnboard() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, ok := h.account(w, r)
+		if !ok {
+			return
+		}
+
+		userID, ip := requester(r)
+		cred, err := h.scanner.Onboard(r.Context(), id, userID, &ip)
+		if err != nil {
+			h.writeAccountError(w, "onboard", id, err)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(cred)
+	}
+}
+
+// HandleRotate replaces the password of an onboarded account
+// Route: POST /api/v1/discovered-accounts/{id}/rotate
+func (h *DiscoveryHandler) HandleRotate() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, ok := h.account(w, r)
+		if !ok {
+			return
+		}
+
+		userID, ip := requester(r)
+		account, err := h.scanner.Rotate(r.Context(), id, userID, &ip)
+		if err != nil {
+			h.writeAccountError(w, "rotate", id, err)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(account)
+	}
+}
+
+// account parses the account ID and checks that the account exists
+func (h *DiscoveryHandler) account(w http.ResponseWriter, r *http.Request) (uuid.UUID, bool) {
+	id, err := uuid.Parse(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, "Invalid account ID", http.StatusBadRequest)
+		return uuid.Nil, false
+	}
+
+	if _, err := h.discoveryRepo.GetAccount(r.Context(), id); err != nil {
+		http.Error(w, "Discovered account not found", http.StatusNotFound)
+		return uuid.Nil, false
+	}
+
+	return id, true
+}
+
+func (h *DiscoveryHandler) writeAccountError(w http.ResponseWriter, action string, id uuid.UUID, err error) {
+	switch {
+	case errors.Is(err, discovery.ErrAlreadyManaged), errors.Is(err, discovery.ErrNotOnboarded), errors.Is(err, discovery.ErrAccountRemoved):
+		http.Error(w, err.Error(), http.StatusConflict)
+	case errors.Is(err, discovery.ErrNoCredential):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	default:
+		h.logger.Error("Failed to "+action+" discovered account", map[string]interface{}{
+			"account_id": id.String(),
+			"error":      err.Error(),
+		})
+		http.Error(w, "Failed to "+action+" account: "+err.Error(), http.StatusBadGateway)
+	}
+}
+
+// requester returns the user making the request and their address
+func requester(r *http.Request) (*uuid.UUID, string) {
+	var userID *uuid.UUID
+	if id, err := uuid.Parse(middleware.GetUserID(r.Context())); err == nil {
+		userID = &id
+	}
+	return userID, r.RemoteAddr
+}
@@ -0,0 +1,402 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/VanCannon/openpam/gateway/internal/elevation"
+	"github.com/VanCannon/openpam/gateway/internal/middleware"
+	"github.com/VanCannon/openpam/gateway/internal/models"
+	"github.com/VanCannon/openpam/gateway/internal/repository"
+	"github.com/VanCannon/openpam/gateway/internal/validate"
+	"github.com/VanCannon/openpam/pkg/logger"
+	"github.com/google/uuid"
+)
+
+// ElevationHandler handles time-boxed role elevation requests
+type ElevationHandler struct {
+	elevationRepo *repository.RoleElevationRepository
+	auditRepo     *repository.SystemAuditLogRepository
+	policy        elevation.Policy
+	logger        *logger.Logger
+}
+
+// NewElevationHandler creates a new role elevation handler
+func NewElevationHandler(
+	elevationRepo *repository.RoleElevationRepository,
+	auditRepo *repository.SystemAuditLogRepository,
+	policy elevation.Policy,
+	log *logger.Logger,
+) *ElevationHandler {
+	return &ElevationHandler{
+		elevationRepo: elevationRepo,
+		auditRepo:     auditRepo,
+		policy:        policy,
+		logger:        log,
+	}
+}
+
+// HandleElevations routes collection requests based on HTTP method
+// Route: /api/v1/elevations
+func (h *ElevationHandler) HandleElevations() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			h.HandleList()(w, r)
+		case http.MethodPost:
+			h.HandleRequest()(w, r)
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	}
+}
+
+// canReview reports whether the caller may see every user's elevations
+func canReview(r *http.Request) bool {
+	role := middleware.GetUserRole(r.Context())
+	return role == models.RoleAdmin || role == models.RoleAuditor
+}
+
+// HandleList lists elevations. Admins and auditors see everyone's and may
+// filter by user_id; other users see their own. Filter by status with ?status=.
+func (h *ElevationHandler) HandleList() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+
+		userID, err := uuid.Parse(middleware.GetUserID(ctx))
+		if err != nil {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		filter := &userID
+		if canReview(r) {
+			filter = nil
+			if s := r.URL.Query().Get("user_id"); s != "" {
+				id, err := uuid.Parse(s)
+				if err != nil {
+					http.Error(w, "Invalid user ID", http.StatusBadRequest)
+					return
+				}
+				filter = &id
+			}
+		}
+
+		elevations, err := h.elevationRepo.List(ctx, filter, r.URL.Query().Get("status"), 200)
+		if err != nil {
+			h.logger.Error("Failed to list role elevations", map[string]interface{}{
+				"error": err.Error(),
+			})
+			http.Error(w, "Failed to list role elevations", http.StatusInternalServerError)
+			return
+		}
+
+		if elevations == nil {
+			elevations = []*models.RoleElevation{}
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"elevations": elevations,
+			"count":      len(elevations),
+		})
+	}
+}
+
+// HandleRequest requests an elevation for the caller. Elevations the policy
+// grants without approval are active immediately; the others wait for an admin.
+func (h *ElevationHandler) HandleRequest() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+
+		userID, err := uuid.Parse(middleware.GetUserID(ctx))
+		if err != nil || middleware.GetAPIKeyID(ctx) != "" {
+			http.Error(w, "Only users can request a role elevation", http.StatusForbidden)
+			return
+		}
+
+		var req struct {
+			Role          string `json:"role"`
+			Hours         int    `json:"hours"`
+			Justification string `json:"justification"`
+		}
+		if !validate.Decode(w, r, &req) {
+			return
+		}
+
+		req.Justification = strings.TrimSpace(req.Justification)
+		if req.Justification == "" {
+			http.Error(w, "Justification is required", http.StatusBadRequest)
+			return
+		}
+
+		if err := h.policy.Check(middleware.GetBaseRole(ctx), req.Role, req.Hours); err != nil {
+			status := http.StatusBadRequest
+			if errors.Is(err, elevation.ErrNotEligible) {
+				status = http.StatusForbidden
+			}
+			http.Error(w, err.Error(), status)
+			return
+		}
+
+		el := &models.RoleElevation{
+			UserID:        userID,
+			UserEmail:     middleware.GetUserEmail(ctx),
+			Role:          req.Role,
+			Justification: req.Justification,
+			DurationHours: req.Hours,
+			Status:        models.ElevationStatusPending,
+		}
+		autoApproved := !h.policy.RequiresApproval(req.Role)
+		if autoApproved {
+			now := time.Now()
+			expires := now.Add(time.Duration(req.Hours) * time.Hour)
+			el.Status = models.ElevationStatusActive
+			el.DecidedAt = &now
+			el.StartsAt = &now
+			el.ExpiresAt = &expires
+		}
+
+		if err := h.elevationRepo.Create(ctx, el); err != nil {
+			if errors.Is(err, repository.ErrElevationOpen) {
+				http.Error(w, "You already have a pending or active role elevation", http.StatusConflict)
+				return
+			}
+			h.logger.Error("Failed to create role elevation", map[string]interface{}{
+				"error": err.Error(),
+			})
+			http.Error(w, "Failed to request role elevation", http.StatusInternalServerError)
+			return
+		}
+
+		h.recordEvent(r, models.EventTypeElevationRequested, "request_elevation", map[string]interface{}{
+			"elevation_id":   el.ID.String(),
+			"role":           el.Role,
+			"duration_hours": el.DurationHours,
+			"justification":  el.Justification,
+			"auto_approved":  autoApproved,
+		})
+		if autoApproved {
+			h.recordEvent(r, models.EventTypeElevationApproved, "approve_elevation", map[string]interface{}{
+				"elevation_id":  el.ID.String(),
+				"user_id":       el.UserID.String(),
+				"role":          el.Role,
+				"expires_at":    el.ExpiresAt,
+				"auto_approved": true,
+			})
+		}
+
+		h.logger.Info("Role elevation requested", map[string]interface{}{
+			"elevation_id":  el.ID.String(),
+			"user":          el.UserEmail,
+			"role":          el.Role,
+			"hours":         el.DurationHours,
+			"auto_approved": autoApproved,
+		})
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(el)
+	}
+}
+
+// HandleGet retrieves an elevation. Users may only see their own.
+// Route: GET /api/v1/elevations/{id}
+func (h *ElevationHandler) HandleGet() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		el, ok := h.load(w, r)
+		if !ok {
+			return
+		}
+
+		if !canReview(r) && el.UserID.String() != middleware.GetUserID(r.Context()) {
+			http.Error(w, "Role elevation not found", http.StatusNotFound)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(el)
+	}
+}
+
+// HandleApprove approves a pending elevation, starting it now
+// Route: POST /api/v1/elevations/{id}/approve
+func (h *ElevationHandler) HandleApprove() http.HandlerFunc {
+	return h.handleDecision(true)
+}
+
+// HandleReject rejects a pending elevation
+// Route: POST /api/v1/elevations/{id}/reject
+func (h *ElevationHandler) HandleReject() http.HandlerFunc {
+	return h.handleDecision(false)
+}
+
+func (h *ElevationHandler) handleDecision(approve bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+
+		var req struct {
+			Reason string `json:"reason"`
+		}
+		if r.ContentLength != 0 {
+			if !validate.Decode(w, r, &req) {
+				return
+			}
+		}
+		var reason *string
+		if !approve {
+			if strings.TrimSpace(req.Reason) == "" {
+				http.Error(w, "Reason is required", http.StatusBadRequest)
+				return
+			}
+			reason = &req.Reason
+		}
+
+		el, ok := h.load(w, r)
+		if !ok {
+			return
+		}
+
+		deciderID, err := uuid.Parse(middleware.GetUserID(ctx))
+		if err != nil {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		if deciderID == el.UserID {
+			http.Error(w, "You can't decide your own role elevation", http.StatusForbidden)
+			return
+		}
+		// Elevations are decided by standing admins, so one elevation can't grant another
+		if middleware.GetElevation(ctx) != nil {
+			http.Error(w, "Elevated admins can't decide role elevations", http.StatusForbidden)
+			return
+		}
+
+		decided, err := h.elevationRepo.Decide(ctx, el.ID, approve, deciderID, reason, time.Now())
+		if err != nil {
+			if errors.Is(err, repository.ErrElevationClosed) {
+				http.Error(w, "Role elevation is no longer pending", http.StatusConflict)
+				return
+			}
+			h.logger.Error("Failed to decide role elevation", map[string]interface{}{
+				"elevation_id": el.ID.String(),
+				"error":        err.Error(),
+			})
+			http.Error(w, "Failed to decide role elevation", http.StatusInternalServerError)
+			return
+		}
+		decided.UserEmail = el.UserEmail
+
+		eventType, action := models.EventTypeElevationApproved, "approve_elevation"
+		details := map[string]interface{}{
+			"elevation_id": el.ID.String(),
+			"user_id":      el.UserID.String(),
+			"role":         el.Role,
+		}
+		if approve {
+			details["expires_at"] = decided.ExpiresAt
+		} else {
+			eventType, action = models.EventTypeElevationRejected, "reject_elevation"
+			details["reason"] = req.Reason
+		}
+		h.recordEvent(r, eventType, action, details)
+
+		h.logger.Info("Role elevation decided", map[string]interface{}{
+			"elevation_id": el.ID.String(),
+			"status":       decided.Status,
+			"decided_by":   middleware.GetUserEmail(ctx),
+		})
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(decided)
+	}
+}
+
+// HandleRevoke ends an active elevation early or withdraws a pending one. Users
+// may end their own; admins may end anyone's.
+// Route: POST /api/v1/elevations/{id}/revoke
+func (h *ElevationHandler) HandleRevoke() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+
+		el, ok := h.load(w, r)
+		if !ok {
+			return
+		}
+
+		userID, err := uuid.Parse(middleware.GetUserID(ctx))
+		if err != nil {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		if userID != el.UserID && middleware.GetUserRole(ctx) != models.RoleAdmin {
+			http.Error(w, "Forbidden", http.StatusForbidden)
+			return
+		}
+
+		revoked, err := h.elevationRepo.Revoke(ctx, el.ID, userID, time.Now())
+		if err != nil {
+			if errors.Is(err, repository.ErrElevationClosed) {
+				http.Error(w, "Role elevation has already ended", http.StatusConflict)
+				return
+			}
+			h.logger.Error("Failed to revoke role elevation", map[string]interface{}{
+				"elevation_id": el.ID.String(),
+				"error":        err.Error(),
+			})
+			http.Error(w, "Failed to revoke role elevation", http.StatusInternalServerError)
+			return
+		}
+		revoked.UserEmail = el.UserEmail
+
+		h.recordEvent(r, models.EventTypeElevationRevoked, "revoke_elevation", map[string]interface{}{
+			"elevation_id": el.ID.String(),
+			"user_id":      el.UserID.String(),
+			"role":         el.Role,
+			"was":          el.Status,
+		})
+
+		h.logger.Info("Role elevation revoked", map[string]interface{}{
+			"elevation_id": el.ID.String(),
+			"revoked_by":   middleware.GetUserEmail(ctx),
+		})
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(revoked)
+	}
+}
+
+// load resolves the elevation in the path, responding with an error if it doesn't exist
+func (h *ElevationHandler) load(w http.ResponseWriter, r *http.Request) (*models.RoleElevation, bool) {
+	id, err := uuid.Parse(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, "Invalid elevation ID", http.StatusBadRequest)
+		return nil, false
+	}
+
+	el, err := h.elevationRepo.GetByID(r.Context(), id)
+	if err != nil {
+		http.Error(w, "Role elevation not found", http.StatusNotFound)
+		return nil, false
+	}
+
+	return el, true
+}
+
+func (h *ElevationHandler) recordEvent(r *http.Request, eventType, action string, details map[string]interface{}) {
+	var userID *uuid.UUID
+	if id, err := uuid.Parse(middleware.GetUserID(r.Context())); err == nil {
+		userID = &id
+	}
+
+	ip := r.RemoteAddr
+	if err := h.auditRepo.CreateSimple(r.Context(), eventType, userID, action, "success", &ip, details); err != nil {
+		h.logger.Error("Failed to record role elevation audit event", map[string]interface{}{
+			"event_type": eventType,
+			"error":      err.Error(),
+		})
+	}
+}
@@ -0,0 +1,105 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/VanCannon/openpam/gateway/internal/i18n"
+	"github.com/VanCannon/openpam/gateway/internal/models"
+)
+
+// enumerations are the values clients show by label, keyed by the name used
+// in the catalog
+var enumerations = map[string][]string{
+	"role":            {models.RoleAdmin, models.RoleUser, models.RoleAuditor},
+	"protocol":        {models.ProtocolSSH, models.ProtocolRDP, models.ProtocolAWS, models.ProtocolAzure},
+	"session_status":  {models.SessionStatusActive, models.SessionStatusCompleted, models.SessionStatusFailed, models.SessionStatusTerminated},
+	"schedule_status": {string(models.ScheduleStatusPending), string(models.ScheduleStatusActive), string(models.ScheduleStatusExpired), string(models.ScheduleStatusCancelled)},
+	"approval_status": {models.ApprovalStatusPending, models.ApprovalStatusApproved, models.ApprovalStatusRejected},
+	"zone_type":       {models.ZoneTypeHub, models.ZoneTypeSatellite},
+	"weekday":         {"monday", "tuesday", "wednesday", "thursday", "friday", "saturday", "sunday"},
+}
+
+// EnumValue is an enumeration value and its label
+type EnumValue struct {
+	Value string `json:"value"`
+	Label string `json:"label"`
+}
+
+// EnumHandler serves enumerations and API messages in the caller's language
+type EnumHandler struct{}
+
+// NewEnumHandler creates a new enumeration handler
+func NewEnumHandler() *EnumHandler {
+	return &EnumHandler{}
+}
+
+// HandleList lists every enumeration with its labels. The locale comes from
+// the locale query parameter or Accept-Language.
+// Route: GET /api/v1/enums
+func (h *EnumHandler) HandleList() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		locale := i18n.FromRequest(r)
+
+		enums := make(map[string][]EnumValue, len(enumerations))
+		for name := range enumerations {
+			enums[name] = enumValues(locale, name)
+		}
+
+		writeLocalized(w, locale, map[string]interface{}{
+			"locale":  locale,
+			"locales": i18n.Locales(),
+			"enums":   enums,
+		})
+	}
+}
+
+// HandleGet lists the values of one enumeration
+// Route: GET /api/v1/enums/{name}
+func (h *EnumHandler) HandleGet() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		name := r.PathValue("name")
+		if _, ok := enumerations[name]; !ok {
+			http.Error(w, "Enumeration not found", http.StatusNotFound)
+			return
+		}
+
+		locale := i18n.FromRequest(r)
+		values := enumValues(locale, name)
+		writeLocalized(w, locale, map[string]interface{}{
+			"locale": locale,
+			"name":   name,
+			"values": values,
+			"count":  len(values),
+		})
+	}
+}
+
+// HandleMessages returns the message catalog, so clients can render the code
+// of an error response in their own language
+// Route: GET /api/v1/messages
+func (h *EnumHandler) HandleMessages() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		locale := i18n.FromRequest(r)
+		writeLocalized(w, locale, map[string]interface{}{
+			"locale":   locale,
+			"locales":  i18n.Locales(),
+			"messages": i18n.Messages(locale),
+		})
+	}
+}
+
+func enumValues(locale, name string) []EnumValue {
+	values := make([]EnumValue, 0, len(enumerations[name]))
+	for _, v := range enumerations[name] {
+		values = append(values, EnumValue{Value: v, Label: i18n.Text(locale, name+"."+v)})
+	}
+	return values
+}
+
+func writeLocalized(w http.ResponseWriter, locale string, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Content-Language", locale)
+	w.Header().Add("Vary", "Accept-Language")
+	json.NewEncoder(w).Encode(body)
+}
@@ -0,0 +1,148 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/VanCannon/openpam/gateway/internal/events"
+	"github.com/VanCannon/openpam/gateway/internal/middleware"
+	"github.com/VanCannon/openpam/gateway/internal/models"
+	"github.com/VanCannon/openpam/pkg/logger"
+)
+
+// EventStreamHandler streams audit events to live dashboards over Server-Sent Events
+type EventStreamHandler struct {
+	broker    *events.Broker
+	heartbeat time.Duration
+	logger    *logger.Logger
+}
+
+// NewEventStreamHandler creates a new event stream handler
+func NewEventStreamHandler(broker *events.Broker, heartbeat time.Duration, log *logger.Logger) *EventStreamHandler {
+	if heartbeat <= 0 {
+		heartbeat = 15 * time.Second
+	}
+
+	return &EventStreamHandler{
+		broker:    broker,
+		heartbeat: heartbeat,
+		logger:    log,
+	}
+}
+
+// HandleStream streams events as text/event-stream.
+// Route: GET /api/v1/events/stream?types=audit.*,system.login_failed
+//
+// Clients that send Last-Event-ID (or last_event_id, since EventSource can't set
+// headers on the first request) first receive the stored events they missed.
+func (h *EventStreamHandler) HandleStream() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		ctx := r.Context()
+		rc := http.NewResponseController(w)
+
+		lastEventID := r.Header.Get("Last-Event-ID")
+		if lastEventID == "" {
+			lastEventID = r.URL.Query().Get("last_event_id")
+		}
+
+		var resumeFrom int64
+		if lastEventID != "" {
+			id, err := strconv.ParseInt(lastEventID, 10, 64)
+			if err != nil || id < 0 {
+				http.Error(w, "Invalid Last-Event-ID", http.StatusBadRequest)
+				return
+			}
+			resumeFrom = id
+		}
+
+		filter := events.ParseFilter(r.URL.Query().Get("types"))
+
+		// Subscribe before replaying so nothing committed in between is lost
+		sub := h.broker.Subscribe(filter)
+		defer sub.Close()
+
+		// The stream outlives the server's write timeout
+		rc.SetWriteDeadline(time.Time{})
+
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("Cache-Control", "no-cache")
+		w.Header().Set("Connection", "keep-alive")
+		w.Header().Set("X-Accel-Buffering", "no") // Disable proxy buffering
+		w.WriteHeader(http.StatusOK)
+
+		fmt.Fprintf(w, "retry: 3000\n\n")
+		if err := rc.Flush(); err != nil {
+			h.logger.Error("Event stream not supported by response writer", map[string]interface{}{
+				"error": err.Error(),
+			})
+			return
+		}
+
+		h.logger.Info("Event stream opened", map[string]interface{}{
+			"user_id":       middleware.GetUserID(ctx),
+			"types":         r.URL.Query().Get("types"),
+			"last_event_id": resumeFrom,
+		})
+
+		// replayed is the newest event sent during replay; live events up to it are duplicates
+		var replayed int64
+		if lastEventID != "" {
+			err := h.broker.Replay(ctx, resumeFrom, filter, func(event *models.Event) error {
+				replayed = event.ID
+				return writeEvent(w, event)
+			})
+			if err != nil {
+				h.logger.Error("Failed to replay events", map[string]interface{}{
+					"error": err.Error(),
+				})
+				return
+			}
+			if err := rc.Flush(); err != nil {
+				return
+			}
+		}
+
+		ticker := time.NewTicker(h.heartbeat)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if _, err := fmt.Fprint(w, ": keep-alive\n\n"); err != nil {
+					return
+				}
+			case event, ok := <-sub.Events():
+				if !ok {
+					// Dropped for falling behind or shutting down; the client reconnects and resumes
+					return
+				}
+				if event.ID <= replayed {
+					continue
+				}
+				if err := writeEvent(w, event); err != nil {
+					return
+				}
+			}
+
+			if err := rc.Flush(); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// writeEvent writes one event in text/event-stream format. The payload is
+// compact JSON, so it always fits on a single data line.
+func writeEvent(w http.ResponseWriter, event *models.Event) error {
+	_, err := fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", event.ID, event.Type, event.Payload)
+	return err
+}
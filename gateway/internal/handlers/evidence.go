@@ -0,0 +1,118 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/VanCannon/openpam/gateway/internal/evidence"
+	"github.com/VanCannon/openpam/gateway/internal/middleware"
+	"github.com/VanCannon/openpam/gateway/internal/models"
+	"github.com/VanCannon/openpam/gateway/internal/repository"
+	"github.com/VanCannon/openpam/pkg/logger"
+	"github.com/google/uuid"
+)
+
+// EvidenceHandler serves the evidence captured on policy violations
+type EvidenceHandler struct {
+	evidenceRepo    *repository.EvidenceRepository
+	systemAuditRepo *repository.SystemAuditLogRepository
+	capturer        *evidence.Capturer
+	logger          *logger.Logger
+}
+
+// NewEvidenceHandler creates a new evidence handler
+func NewEvidenceHandler(evidenceRepo *repository.EvidenceRepository, systemAuditRepo *repository.SystemAuditLogRepository, capturer *evidence.Capturer, log *logger.Logger) *EvidenceHandler {
+	return &EvidenceHandler{
+		evidenceRepo:    evidenceRepo,
+		systemAuditRepo: systemAuditRepo,
+		capturer:        capturer,
+		logger:          log,
+	}
+}
+
+// HandleListBySession lists the evidence captured in a session
+// Route: GET /api/v1/audit-logs/{id}/evidence
+func (h *EvidenceHandler) HandleListBySession() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, err := uuid.Parse(r.PathValue("id"))
+		if err != nil {
+			http.Error(w, "Invalid audit log ID", http.StatusBadRequest)
+			return
+		}
+
+		evidence, err := h.evidenceRepo.ListBySession(r.Context(), id)
+		if err != nil {
+			h.logger.Error("Failed to list evidence", map[string]interface{}{
+				"audit_log_id": id.String(),
+				"error":        err.Error(),
+			})
+			http.Error(w, "Failed to list evidence", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"evidence": evidence,
+			"count":    len(evidence),
+		})
+	}
+}
+
+// HandleGet decrypts and downloads captured evidence. Every download is recorded
+// in the system audit log.
+// Route: GET /api/v1/evidence/{id}
+func (h *EvidenceHandler) HandleGet() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+
+		id, err := uuid.Parse(r.PathValue("id"))
+		if err != nil {
+			http.Error(w, "Invalid evidence ID", http.StatusBadRequest)
+			return
+		}
+
+		if !h.capturer.CanOpen() {
+			http.Error(w, "Evidence encryption key not configured", http.StatusServiceUnavailable)
+			return
+		}
+
+		ev, err := h.evidenceRepo.GetByID(ctx, id)
+		if err != nil {
+			http.Error(w, "Evidence not found", http.StatusNotFound)
+			return
+		}
+
+		plaintext, err := h.capturer.Open(ev)
+		if err != nil {
+			h.logger.Error("Failed to decrypt evidence", map[string]interface{}{
+				"evidence_id": id.String(),
+				"error":       err.Error(),
+			})
+			http.Error(w, "Failed to decrypt evidence", http.StatusInternalServerError)
+			return
+		}
+
+		var userID *uuid.UUID
+		if uid, err := uuid.Parse(middleware.GetUserID(ctx)); err == nil {
+			userID = &uid
+		}
+		ip := r.RemoteAddr
+		if err := h.systemAuditRepo.CreateSimple(ctx, models.EventTypeEvidenceViewed, userID, "view", "success", &ip, map[string]interface{}{
+			"evidence_id":         ev.ID.String(),
+			"session_id":          ev.AuditLogID.String(),
+			"system_audit_log_id": ev.SystemAuditLogID.String(),
+		}); err != nil {
+			h.logger.Error("Failed to record evidence audit event", map[string]interface{}{
+				"evidence_id": id.String(),
+				"error":       err.Error(),
+			})
+		}
+
+		w.Header().Set("Content-Type", ev.ContentType)
+		w.Header().Set("Content-Length", strconv.Itoa(len(plaintext)))
+		w.Header().Set("Content-Disposition", `attachment; filename="evidence-`+ev.ID.String()+`"`)
+		w.Header().Set("X-Evidence-SHA256", ev.SHA256)
+		w.Write(plaintext)
+	}
+}
@@ -0,0 +1,65 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/VanCannon/openpam/gateway/internal/failover"
+	"github.com/VanCannon/openpam/gateway/internal/models"
+	"github.com/VanCannon/openpam/gateway/internal/repository"
+	"github.com/VanCannon/openpam/pkg/logger"
+)
+
+// FailoverHandler reports the gateway's failover role and state
+type FailoverHandler struct {
+	monitor *failover.Monitor
+	repo    *repository.FailoverRepository
+	logger  *logger.Logger
+}
+
+// NewFailoverHandler creates a new failover handler
+func NewFailoverHandler(monitor *failover.Monitor, repo *repository.FailoverRepository, log *logger.Logger) *FailoverHandler {
+	return &FailoverHandler{
+		monitor: monitor,
+		repo:    repo,
+		logger:  log,
+	}
+}
+
+// HandleGet returns this gateway's role and state, and the history of the
+// pair's failovers. Limit the history with ?limit= (default 50, at most 500).
+// Route: GET /api/v1/admin/failover
+func (h *FailoverHandler) HandleGet() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		limit := 50
+		if s := r.URL.Query().Get("limit"); s != "" {
+			n, err := strconv.Atoi(s)
+			if err != nil || n < 1 || n > 500 {
+				http.Error(w, "limit must be between 1 and 500", http.StatusBadRequest)
+				return
+			}
+			limit = n
+		}
+
+		history, err := h.repo.List(r.Context(), limit)
+		if err != nil {
+			h.logger.Error("Failed to list failover events", map[string]interface{}{
+				"error": err.Error(),
+			})
+			http.Error(w, "Failed to list failover events", http.StatusInternalServerError)
+			return
+		}
+
+		if history == nil {
+			history = []*models.FailoverEvent{}
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"status":  h.monitor.Status(),
+			"history": history,
+			"count":   len(history),
+		})
+	}
+}
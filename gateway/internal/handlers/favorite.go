@@ -0,0 +1,193 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/VanCannon/openpam/gateway/internal/middleware"
+	"github.com/VanCannon/openpam/gateway/internal/models"
+	"github.com/VanCannon/openpam/gateway/internal/repository"
+	"github.com/VanCannon/openpam/pkg/logger"
+	"github.com/google/uuid"
+)
+
+// defaultRecentTargets is the number of recent targets returned without a limit
+const defaultRecentTargets = 10
+
+// favoriteStore stores users' favorite targets and reads their recent ones
+type favoriteStore interface {
+	Add(ctx context.Context, userID, targetID uuid.UUID) error
+	Remove(ctx context.Context, userID, targetID uuid.UUID) error
+	List(ctx context.Context, userID uuid.UUID) ([]*models.LauncherTarget, error)
+	Recent(ctx context.Context, userID uuid.UUID, limit int) ([]*models.LauncherTarget, error)
+}
+
+// targetGetter looks targets up by ID
+type targetGetter interface {
+	GetByID(ctx context.Context, id uuid.UUID) (*models.Target, error)
+}
+
+// FavoriteHandler handles the current user's favorite and recently used targets
+type FavoriteHandler struct {
+	favoriteRepo favoriteStore
+	targetRepo   targetGetter
+	logger       *logger.Logger
+}
+
+// NewFavoriteHandler creates a new favorite handler
+func NewFavoriteHandler(favoriteRepo *repository.FavoriteRepository, targetRepo *repository.TargetRepository, log *logger.Logger) *FavoriteHandler {
+	return &FavoriteHandler{
+		favoriteRepo: favoriteRepo,
+		targetRepo:   targetRepo,
+		logger:       log,
+	}
+}
+
+// HandleList lists the current user's favorite targets, most recently starred first
+// Route: GET /api/v1/favorites
+func (h *FavoriteHandler) HandleList() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+
+		userID, err := uuid.Parse(middleware.GetUserID(ctx))
+		if err != nil {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		targets, err := h.favoriteRepo.List(ctx, userID)
+		if err != nil {
+			h.logger.Error("Failed to list favorites", map[string]interface{}{
+				"user_id": userID.String(),
+				"error":   err.Error(),
+			})
+			http.Error(w, "Failed to list favorites", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"targets": targets,
+			"count":   len(targets),
+			"limit":   models.MaxFavoriteTargets,
+		})
+	}
+}
+
+// HandleAdd stars a target for the current user
+// Route: PUT /api/v1/favorites/{target_id}
+func (h *FavoriteHandler) HandleAdd() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+
+		userID, err := uuid.Parse(middleware.GetUserID(ctx))
+		if err != nil {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		targetID, err := uuid.Parse(r.PathValue("target_id"))
+		if err != nil {
+			http.Error(w, "Invalid target ID", http.StatusBadRequest)
+			return
+		}
+
+		if _, err := h.targetRepo.GetByID(ctx, targetID); err != nil {
+			http.Error(w, "Target not found", http.StatusNotFound)
+			return
+		}
+
+		if err := h.favoriteRepo.Add(ctx, userID, targetID); err != nil {
+			if errors.Is(err, repository.ErrTooManyFavorites) {
+				http.Error(w, err.Error(), http.StatusConflict)
+				return
+			}
+			h.logger.Error("Failed to add favorite", map[string]interface{}{
+				"user_id":   userID.String(),
+				"target_id": targetID.String(),
+				"error":     err.Error(),
+			})
+			http.Error(w, "Failed to add favorite", http.StatusInternalServerError)
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// HandleRemove unstars a target for the current user
+// Route: DELETE /api/v1/favorites/{target_id}
+func (h *FavoriteHandler) HandleRemove() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+
+		userID, err := uuid.Parse(middleware.GetUserID(ctx))
+		if err != nil {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		targetID, err := uuid.Parse(r.PathValue("target_id"))
+		if err != nil {
+			http.Error(w, "Invalid target ID", http.StatusBadRequest)
+			return
+		}
+
+		if err := h.favoriteRepo.Remove(ctx, userID, targetID); err != nil {
+			h.logger.Error("Failed to remove favorite", map[string]interface{}{
+				"user_id":   userID.String(),
+				"target_id": targetID.String(),
+				"error":     err.Error(),
+			})
+			http.Error(w, "Failed to remove favorite", http.StatusInternalServerError)
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// HandleRecent lists the targets the current user most recently connected to
+// Route: GET /api/v1/targets/recent?limit=10
+func (h *FavoriteHandler) HandleRecent() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+
+		userID, err := uuid.Parse(middleware.GetUserID(ctx))
+		if err != nil {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		limit := defaultRecentTargets
+		if v := r.URL.Query().Get("limit"); v != "" {
+			limit, err = strconv.Atoi(v)
+			if err != nil || limit < 1 {
+				http.Error(w, "Invalid limit", http.StatusBadRequest)
+				return
+			}
+			if limit > models.MaxRecentTargets {
+				limit = models.MaxRecentTargets
+			}
+		}
+
+		targets, err := h.favoriteRepo.Recent(ctx, userID, limit)
+		if err != nil {
+			h.logger.Error("Failed to list recent targets", map[string]interface{}{
+				"user_id": userID.String(),
+				"error":   err.Error(),
+			})
+			http.Error(w, "Failed to list recent targets", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"targets": targets,
+			"count":   len(targets),
+		})
+	}
+}
@@ -0,0 +1,203 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/VanCannon/openpam/gateway/internal/auth"
+	"github.com/VanCannon/openpam/gateway/internal/middleware"
+	"github.com/VanCannon/openpam/gateway/internal/models"
+	"github.com/VanCannon/openpam/gateway/internal/repository"
+	"github.com/VanCannon/openpam/pkg/logger"
+	"github.com/google/uuid"
+)
+
+// fakeFavorites keeps favorites in memory with the repository's limit
+type fakeFavorites struct {
+	starred     map[uuid.UUID][]uuid.UUID
+	recentLimit int
+}
+
+func (f *fakeFavorites) Add(ctx context.Context, userID, targetID uuid.UUID) error {
+	for _, id := range f.starred[userID] {
+		if id == targetID {
+			return nil
+		}
+	}
+	if len(f.starred[userID]) >= models.MaxFavoriteTargets {
+		return repository.ErrTooManyFavorites
+	}
+	f.starred[userID] = append(f.starred[userID], targetID)
+	return nil
+}
+
+func (f *fakeFavorites) Remove(ctx context.Context, userID, targetID uuid.UUID) error {
+	ids := f.starred[userID]
+	for i, id := range ids {
+		if id == targetID {
+			f.starred[userID] = append(ids[:i], ids[i+1:]...)
+		}
+	}
+	return nil
+}
+
+func (f *fakeFavorites) List(ctx context.Context, userID uuid.UUID) ([]*models.LauncherTarget, error) {
+	targets := []*models.LauncherTarget{}
+	for _, id := range f.starred[userID] {
+		targets = append(targets, &models.LauncherTarget{Target: models.Target{ID: id}})
+	}
+	return targets, nil
+}
+
+func (f *fakeFavorites) Recent(ctx context.Context, userID uuid.UUID, limit int) ([]*models.LauncherTarget, error) {
+	f.recentLimit = limit
+	return []*models.LauncherTarget{}, nil
+}
+
+// fakeTargets knows the targets in it
+type fakeTargets map[uuid.UUID]bool
+
+func (f fakeTargets) GetByID(ctx context.Context, id uuid.UUID) (*models.Target, error) {
+	if !f[id] {
+		return nil, errors.New("target not found")
+	}
+	return &models.Target{ID: id}, nil
+}
+
+// favoriteServer serves the favorite routes for a user signed in with token
+func favoriteServer(t *testing.T, targets fakeTargets) (*fakeFavorites, http.Handler, string) {
+	t.Helper()
+
+	favorites := &fakeFavorites{starred: map[uuid.UUID][]uuid.UUID{}}
+	h := &FavoriteHandler{
+		favoriteRepo: favorites,
+		targetRepo:   targets,
+		logger:       logger.New(logger.LevelError, io.Discard),
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle("GET /api/v1/favorites", h.HandleList())
+	mux.Handle("PUT /api/v1/favorites/{target_id}", h.HandleAdd())
+	mux.Handle("DELETE /api/v1/favorites/{target_id}", h.HandleRemove())
+	mux.Handle("GET /api/v1/targets/recent", h.HandleRecent())
+
+	tokens := auth.NewTokenManager("test-secret", time.Hour)
+	token, err := tokens.GenerateToken(uuid.NewString(), "user@example.com", "User", models.RoleUser)
+	if err != nil {
+		t.Fatalf("GenerateToken() error = %v", err)
+	}
+	return favorites, middleware.OptionalAuth(tokens)(mux), token
+}
+
+func serveFavorite(handler http.Handler, token, method, path string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, nil)
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestFavoriteHandler_Add(t *testing.T) {
+	known := uuid.New()
+	_, handler, token := favoriteServer(t, fakeTargets{known: true})
+
+	tests := []struct {
+		name   string
+		token  string
+		path   string
+		status int
+	}{
+		{name: "Starred", token: token, path: "/api/v1/favorites/" + known.String(), status: http.StatusNoContent},
+		{name: "Starred again", token: token, path: "/api/v1/favorites/" + known.String(), status: http.StatusNoContent},
+		{name: "Unknown target", token: token, path: "/api/v1/favorites/" + uuid.NewString(), status: http.StatusNotFound},
+		{name: "Invalid target ID", token: token, path: "/api/v1/favorites/nope", status: http.StatusBadRequest},
+		{name: "Signed out", path: "/api/v1/favorites/" + known.String(), status: http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := serveFavorite(handler, tt.token, http.MethodPut, tt.path)
+			if rec.Code != tt.status {
+				t.Errorf("status = %d, want %d", rec.Code, tt.status)
+			}
+		})
+	}
+}
+
+func TestFavoriteHandler_Limit(t *testing.T) {
+	targets := fakeTargets{}
+	ids := make([]uuid.UUID, models.MaxFavoriteTargets+1)
+	for i := range ids {
+		ids[i] = uuid.New()
+		targets[ids[i]] = true
+	}
+	_, handler, token := favoriteServer(t, targets)
+
+	for _, id := range ids[:models.MaxFavoriteTargets] {
+		if rec := serveFavorite(handler, token, http.MethodPut, "/api/v1/favorites/"+id.String()); rec.Code != http.StatusNoContent {
+			t.Fatalf("starring favorite: status = %d", rec.Code)
+		}
+	}
+
+	// One over the limit is refused, but starring a favorite again isn't
+	over := "/api/v1/favorites/" + ids[models.MaxFavoriteTargets].String()
+	if rec := serveFavorite(handler, token, http.MethodPut, over); rec.Code != http.StatusConflict {
+		t.Errorf("starring over the limit: status = %d, want %d", rec.Code, http.StatusConflict)
+	}
+	if rec := serveFavorite(handler, token, http.MethodPut, "/api/v1/favorites/"+ids[0].String()); rec.Code != http.StatusNoContent {
+		t.Errorf("starring a favorite again at the limit: status = %d, want %d", rec.Code, http.StatusNoContent)
+	}
+
+	// Unstarring one makes room again
+	serveFavorite(handler, token, http.MethodDelete, "/api/v1/favorites/"+ids[0].String())
+	if rec := serveFavorite(handler, token, http.MethodPut, over); rec.Code != http.StatusNoContent {
+		t.Errorf("starring after unstarring: status = %d, want %d", rec.Code, http.StatusNoContent)
+	}
+
+	rec := serveFavorite(handler, token, http.MethodGet, "/api/v1/favorites")
+	var body struct {
+		Count int `json:"count"`
+		Limit int `json:"limit"`
+	}
+	if err := json.NewDecoder(rec.Body).Decode(&body); err != nil {
+		t.Fatalf("decoding favorites: %v", err)
+	}
+	if body.Count != models.MaxFavoriteTargets || body.Limit != models.MaxFavoriteTargets {
+		t.Errorf("count = %d, limit = %d, want both %d", body.Count, body.Limit, models.MaxFavoriteTargets)
+	}
+}
+
+func TestFavoriteHandler_RecentLimit(t *testing.T) {
+	favorites, handler, token := favoriteServer(t, fakeTargets{})
+
+	tests := []struct {
+		query  string
+		status int
+		limit  int
+	}{
+		{query: "", status: http.StatusOK, limit: defaultRecentTargets},
+		{query: "?limit=3", status: http.StatusOK, limit: 3},
+		{query: "?limit=100000", status: http.StatusOK, limit: models.MaxRecentTargets},
+		{query: "?limit=0", status: http.StatusBadRequest},
+		{query: "?limit=many", status: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		favorites.recentLimit = 0
+		rec := serveFavorite(handler, token, http.MethodGet, "/api/v1/targets/recent"+tt.query)
+		if rec.Code != tt.status {
+			t.Errorf("%q: status = %d, want %d", tt.query, rec.Code, tt.status)
+		}
+		if favorites.recentLimit != tt.limit {
+			t.Errorf("%q: limit = %d, want %d", tt.query, favorites.recentLimit, tt.limit)
+		}
+	}
+}
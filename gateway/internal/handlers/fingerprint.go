@@ -0,0 +1,172 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/VanCannon/openpam/gateway/internal/fingerprint"
+	"github.com/VanCannon/openpam/gateway/internal/middleware"
+	"github.com/VanCannon/openpam/gateway/internal/models"
+	"github.com/VanCannon/openpam/gateway/internal/repository"
+	"github.com/VanCannon/openpam/gateway/internal/validate"
+	"github.com/VanCannon/openpam/pkg/logger"
+	"github.com/google/uuid"
+)
+
+// FingerprintHandler probes hosts and serves the fingerprints of targets
+type FingerprintHandler struct {
+	prober     *fingerprint.Prober
+	fpRepo     *repository.FingerprintRepository
+	targetRepo *repository.TargetRepository
+	logger     *logger.Logger
+}
+
+// NewFingerprintHandler creates a new fingerprint handler
+func NewFingerprintHandler(prober *fingerprint.Prober, fpRepo *repository.FingerprintRepository, targetRepo *repository.TargetRepository, log *logger.Logger) *FingerprintHandler {
+	return &FingerprintHandler{
+		prober:     prober,
+		fpRepo:     fpRepo,
+		targetRepo: targetRepo,
+		logger:     log,
+	}
+}
+
+// ProbeRequest names the host to probe
+type ProbeRequest struct {
+	Host  string `json:"host"`
+	Ports []int  `json:"ports,omitempty"` // Defaults to fingerprint.DefaultPorts
+}
+
+// Validate checks the host and ports
+func (req *ProbeRequest) Validate() validate.Errors {
+	var errs validate.Errors
+	req.Host = strings.TrimSpace(req.Host)
+	errs.Required("host", req.Host)
+	errs.MaxLength("host", req.Host, 255)
+	errs.Check(!strings.ContainsAny(req.Host, " /@") && (!strings.Contains(req.Host, ":") || net.ParseIP(req.Host) != nil), "host", "must be a host name or address")
+	errs.Check(len(req.Ports) <= fingerprint.MaxPorts, "ports", fmt.Sprintf("must have at most %d ports", fingerprint.MaxPorts))
+	for i, port := range req.Ports {
+		errs.Range(fmt.Sprintf("ports[%d]", i), port, 1, 65535)
+	}
+	return errs
+}
+
+// HandleProbe fingerprints a host that isn't a target yet and suggests the
+// protocol and port to add it with. Nothing is stored.
+// Route: POST /api/v1/fingerprints
+func (h *FingerprintHandler) HandleProbe() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req ProbeRequest
+		if !validate.Decode(w, r, &req) {
+			return
+		}
+
+		fp := h.prober.Probe(r.Context(), req.Host, req.Ports)
+
+		h.logger.Info("Host fingerprinted", map[string]interface{}{
+			"host":               req.Host,
+			"services":           len(fp.Services),
+			"suggested_protocol": fp.SuggestedProtocol,
+			"probed_by":          middleware.GetUserEmail(r.Context()),
+		})
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(fp)
+	}
+}
+
+// HandleProbeTarget fingerprints a target and stores the result
+// Route: POST /api/v1/targets/{id}/fingerprint
+func (h *FingerprintHandler) HandleProbeTarget() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		targetID, err := uuid.Parse(r.PathValue("id"))
+		if err != nil {
+			http.Error(w, "Invalid target ID", http.StatusBadRequest)
+			return
+		}
+
+		target, err := h.targetRepo.GetByID(r.Context(), targetID)
+		if err != nil {
+			http.Error(w, "Target not found", http.StatusNotFound)
+			return
+		}
+		if target.Protocol != models.ProtocolSSH && target.Protocol != models.ProtocolRDP {
+			http.Error(w, "Only SSH and RDP targets can be fingerprinted", http.StatusBadRequest)
+			return
+		}
+
+		fp, err := h.prober.ProbeTarget(r.Context(), target)
+		if err != nil {
+			h.logger.Error("Failed to fingerprint target", map[string]interface{}{
+				"target_id": targetID.String(),
+				"error":     err.Error(),
+			})
+			http.Error(w, "Failed to fingerprint target", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(models.TargetFingerprint{
+			TargetID:    target.ID,
+			TargetName:  target.Name,
+			Fingerprint: *fp,
+		})
+	}
+}
+
+// HandleGetTargetFingerprint returns the latest fingerprint of a target
+// Route: GET /api/v1/targets/{id}/fingerprint
+func (h *FingerprintHandler) HandleGetTargetFingerprint() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		targetID, err := uuid.Parse(r.PathValue("id"))
+		if err != nil {
+			http.Error(w, "Invalid target ID", http.StatusBadRequest)
+			return
+		}
+
+		fp, err := h.fpRepo.Get(r.Context(), targetID)
+		if err != nil {
+			http.Error(w, "Fingerprint not found", http.StatusNotFound)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(fp)
+	}
+}
+
+// HandleListFingerprints lists the fingerprints of targets, such as those
+// running a vulnerable server version
+// Route: GET /api/v1/fingerprints?os_family=linux&product=OpenSSH&version=8.
+func (h *FingerprintHandler) HandleListFingerprints() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		filter := repository.FingerprintFilter{
+			OSFamily: query.Get("os_family"),
+			Product:  query.Get("product"),
+			Version:  query.Get("version"),
+		}
+		if filter.Version != "" && filter.Product == "" {
+			http.Error(w, "version needs a product", http.StatusBadRequest)
+			return
+		}
+
+		fps, err := h.fpRepo.List(r.Context(), filter)
+		if err != nil {
+			h.logger.Error("Failed to list fingerprints", map[string]interface{}{
+				"error": err.Error(),
+			})
+			http.Error(w, "Failed to list fingerprints", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"fingerprints": fps,
+			"count":        len(fps),
+		})
+	}
+}
@@ -0,0 +1,144 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/VanCannon/openpam/gateway/internal/flightrec"
+	"github.com/VanCannon/openpam/gateway/internal/middleware"
+	"github.com/VanCannon/openpam/gateway/internal/models"
+	"github.com/VanCannon/openpam/gateway/internal/repository"
+	"github.com/VanCannon/openpam/pkg/logger"
+	"github.com/google/uuid"
+)
+
+// FlightRecorderHandler exposes the recent API exchanges kept by the flight
+// recorder. Recorded exchanges can reveal what users did, so every read is
+// audited.
+type FlightRecorderHandler struct {
+	recorder  *flightrec.Recorder
+	auditRepo *repository.SystemAuditLogRepository
+	logger    *logger.Logger
+}
+
+// NewFlightRecorderHandler creates a new flight recorder handler
+func NewFlightRecorderHandler(recorder *flightrec.Recorder, auditRepo *repository.SystemAuditLogRepository, log *logger.Logger) *FlightRecorderHandler {
+	return &FlightRecorderHandler{
+		recorder:  recorder,
+		auditRepo: auditRepo,
+		logger:    log,
+	}
+}
+
+// HandleRecorder routes flight recorder requests based on HTTP method
+// Route: /api/v1/admin/flight-recorder
+func (h *FlightRecorderHandler) HandleRecorder() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			h.HandleList()(w, r)
+		case http.MethodDelete:
+			h.HandleReset()(w, r)
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	}
+}
+
+// HandleList returns the recorded exchanges, newest first
+// Route: GET /api/v1/admin/flight-recorder?path=/api/v1/targets&min_status=500&limit=N
+func (h *FlightRecorderHandler) HandleList() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		path := query.Get("path")
+		minStatus := 0
+		if v := query.Get("min_status"); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil {
+				http.Error(w, "Invalid min_status", http.StatusBadRequest)
+				return
+			}
+			minStatus = n
+		}
+		limit := h.recorder.Size()
+		if v := query.Get("limit"); v != "" {
+			if n, err := strconv.Atoi(v); err == nil && n > 0 && n < limit {
+				limit = n
+			}
+		}
+
+		recorded := h.recorder.Snapshot()
+		exchanges := []flightrec.Exchange{}
+		for i := len(recorded) - 1; i >= 0 && len(exchanges) < limit; i-- {
+			e := recorded[i]
+			if path != "" && !strings.HasPrefix(e.Path, path) {
+				continue
+			}
+			if e.Status < minStatus {
+				continue
+			}
+			exchanges = append(exchanges, e)
+		}
+
+		h.recordEvent(r, "view_flight_recorder", map[string]interface{}{
+			"count": len(exchanges),
+		})
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"service":   h.recorder.Service(),
+			"size":      h.recorder.Size(),
+			"exchanges": exchanges,
+			"count":     len(exchanges),
+		})
+	}
+}
+
+// HandleDump writes the recorded exchanges to the dump directory
+// Route: POST /api/v1/admin/flight-recorder/dump
+func (h *FlightRecorderHandler) HandleDump() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		path, err := h.recorder.DumpToFile("requested by " + middleware.GetUserEmail(r.Context()))
+		if err != nil {
+			h.logger.Error("Failed to dump flight recorder", map[string]interface{}{
+				"error": err.Error(),
+			})
+			http.Error(w, "Failed to dump flight recorder", http.StatusInternalServerError)
+			return
+		}
+
+		h.recordEvent(r, "dump_flight_recorder", map[string]interface{}{
+			"path": path,
+		})
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"path": path,
+		})
+	}
+}
+
+// HandleReset discards the recorded exchanges
+func (h *FlightRecorderHandler) HandleReset() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		h.recorder.Reset()
+		h.recordEvent(r, "reset_flight_recorder", nil)
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func (h *FlightRecorderHandler) recordEvent(r *http.Request, action string, details map[string]interface{}) {
+	var userID *uuid.UUID
+	if id, err := uuid.Parse(middleware.GetUserID(r.Context())); err == nil {
+		userID = &id
+	}
+
+	ip := r.RemoteAddr
+	if err := h.auditRepo.CreateSimple(r.Context(), models.EventTypeFlightRecorderViewed, userID, action, "success", &ip, details); err != nil {
+		h.logger.Error("Failed to record flight recorder audit event", map[string]interface{}{
+			"error": err.Error(),
+		})
+	}
+}
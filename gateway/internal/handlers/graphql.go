@@ -0,0 +1,502 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/VanCannon/openpam/gateway/internal/graphql"
+	"github.com/VanCannon/openpam/gateway/internal/middleware"
+	"github.com/VanCannon/openpam/gateway/internal/models"
+	"github.com/VanCannon/openpam/gateway/internal/repository"
+	"github.com/VanCannon/openpam/pkg/logger"
+)
+
+// maxGraphQLBody is the largest query document accepted
+const maxGraphQLBody = 64 << 10
+
+// GraphQLHandler serves read-only GraphQL queries over the repositories, for
+// views that would otherwise take several REST calls
+type GraphQLHandler struct {
+	zoneRepo     *repository.ZoneRepository
+	targetRepo   *repository.TargetRepository
+	credRepo     *repository.CredentialRepository
+	auditRepo    *repository.AuditLogRepository
+	scheduleRepo *repository.ScheduleRepository
+	schema       *graphql.Schema
+	logger       *logger.Logger
+}
+
+// NewGraphQLHandler creates a new GraphQL handler. Queries nested deeper than
+// maxDepth are rejected.
+func NewGraphQLHandler(
+	zoneRepo *repository.ZoneRepository,
+	targetRepo *repository.TargetRepository,
+	credRepo *repository.CredentialRepository,
+	auditRepo *repository.AuditLogRepository,
+	scheduleRepo *repository.ScheduleRepository,
+	maxDepth int,
+	log *logger.Logger,
+) *GraphQLHandler {
+	h := &GraphQLHandler{
+		zoneRepo:     zoneRepo,
+		targetRepo:   targetRepo,
+		credRepo:     credRepo,
+		auditRepo:    auditRepo,
+		scheduleRepo: scheduleRepo,
+		logger:       log,
+	}
+	h.schema = &graphql.Schema{Query: h.queryType(), MaxDepth: maxDepth}
+	return h
+}
+
+// HandleQuery runs a query posted as {"query", "operationName", "variables"}.
+// Requests that fail to parse or validate get a 400; errors resolving fields
+// are reported alongside the data that did resolve.
+// Route: POST /api/v1/graphql
+func (h *GraphQLHandler) HandleQuery() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req graphql.Request
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxGraphQLBody)).Decode(&req); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+
+		resp := h.schema.Execute(withViewer(r.Context(), h, r), req)
+
+		w.Header().Set("Content-Type", "application/json")
+		if resp.Data == nil {
+			h.logger.Info("Rejected GraphQL query", map[string]interface{}{
+				"user_id": middleware.GetUserID(r.Context()),
+				"error":   resp.Errors[0].Message,
+			})
+			w.WriteHeader(http.StatusBadRequest)
+		}
+		json.NewEncoder(w).Encode(resp)
+	}
+}
+
+// HandleSchema returns the schema in the GraphQL schema definition language
+// Route: GET /api/v1/graphql
+func (h *GraphQLHandler) HandleSchema() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		fmt.Fprint(w, h.schema.SDL())
+	}
+}
+
+// viewer is the caller of a query and the loaders that cache what the query
+// has fetched
+type viewer struct {
+	// scheduleUser limits schedules to the caller's own, as on the REST API;
+	// nil for admins
+	scheduleUser *uuid.UUID
+	zones        *graphql.Loader[uuid.UUID, *models.Zone]
+	targets      *graphql.Loader[uuid.UUID, *models.Target]
+}
+
+type viewerKey struct{}
+
+func withViewer(ctx context.Context, h *GraphQLHandler, r *http.Request) context.Context {
+	v := &viewer{
+		zones: graphql.NewLoader(func(ctx context.Context, ids []uuid.UUID) (map[uuid.UUID]*models.Zone, error) {
+			zones, err := h.zoneRepo.ListByIDs(ctx, ids)
+			if err != nil {
+				return nil, err
+			}
+			byID := make(map[uuid.UUID]*models.Zone, len(zones))
+			for _, z := range zones {
+				byID[z.ID] = z
+			}
+			return byID, nil
+		}),
+		targets: graphql.NewLoader(func(ctx context.Context, ids []uuid.UUID) (map[uuid.UUID]*models.Target, error) {
+			targets, err := h.targetRepo.ListByIDs(ctx, ids)
+			if err != nil {
+				return nil, err
+			}
+			byID := make(map[uuid.UUID]*models.Target, len(targets))
+			for _, t := range targets {
+				byID[t.ID] = t
+			}
+			return byID, nil
+		}),
+	}
+
+	if middleware.GetUserRole(r.Context()) != models.RoleAdmin {
+		// Callers without a user ID see no schedules at all
+		userID, _ := uuid.Parse(middleware.GetUserID(r.Context()))
+		v.scheduleUser = &userID
+	}
+	return context.WithValue(ctx, viewerKey{}, v)
+}
+
+func viewerFrom(ctx context.Context) *viewer {
+	return ctx.Value(viewerKey{}).(*viewer)
+}
+
+// failed logs an error resolving a field and returns the message the client
+// sees in its place
+func (h *GraphQLHandler) failed(what string, err error) error {
+	h.logger.Error("Failed to resolve GraphQL field", map[string]interface{}{
+		"field": what,
+		"error": err.Error(),
+	})
+	return fmt.Errorf("failed to load %s", what)
+}
+
+// idArg parses an ID argument, which is nil when absent
+func idArg(args graphql.Args, name string) (*uuid.UUID, error) {
+	s := args.String(name)
+	if s == "" {
+		return nil, nil
+	}
+	id, err := uuid.Parse(s)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s", name)
+	}
+	return &id, nil
+}
+
+// targetLabel is a label of a target, as a GraphQL object
+type targetLabel struct {
+	Key   string `json:"key"`
+	Value string `json:"value"`
+}
+
+func (h *GraphQLHandler) queryType() *graphql.Object {
+	zoneType := &graphql.Object{Name: "Zone"}
+	targetType := &graphql.Object{Name: "Target"}
+	sessionType := &graphql.Object{Name: "Session", Description: "A connection to a target, as recorded in the audit log"}
+	scheduleType := &graphql.Object{Name: "Schedule"}
+	labelType := &graphql.Object{Name: "Label", Fields: []*graphql.Field{
+		{Name: "key", Type: graphql.String},
+		{Name: "value", Type: graphql.String},
+	}}
+
+	zoneType.Fields = []*graphql.Field{
+		{Name: "id", Type: graphql.ID},
+		{Name: "name", Type: graphql.String},
+		{Name: "type", Type: graphql.String},
+		{Name: "description", Type: graphql.String},
+		{Name: "version", Type: graphql.Int},
+		{Name: "created_at", Type: graphql.Time},
+		{Name: "updated_at", Type: graphql.Time},
+		{Name: "targets", Type: &graphql.List{Of: targetType}, Description: "Enabled targets in the zone", Batch: h.zoneTargets},
+	}
+
+	targetType.Fields = []*graphql.Field{
+		{Name: "id", Type: graphql.ID},
+		{Name: "zone_id", Type: graphql.ID},
+		{Name: "name", Type: graphql.String},
+		{Name: "hostname", Type: graphql.String},
+		{Name: "port", Type: graphql.Int},
+		{Name: "protocol", Type: graphql.String},
+		{Name: "owner_team", Type: graphql.String},
+		{Name: "environment", Type: graphql.String},
+		{Name: "compliance_scope", Type: &graphql.List{Of: graphql.String}},
+		{
+			Name:        "labels",
+			Type:        &graphql.List{Of: labelType},
+			Description: "Custom labels, by key",
+			Resolve: func(ctx context.Context, source interface{}, args graphql.Args) (interface{}, error) {
+				labels := source.(*models.Target).Labels
+				out := make([]targetLabel, 0, len(labels))
+				for _, key := range labels.Keys() {
+					out = append(out, targetLabel{Key: key, Value: labels[key]})
+				}
+				return out, nil
+			},
+		},
+		{Name: "connection_notes", Type: graphql.String, Description: "Markdown shown to users before they connect"},
+		{Name: "enabled", Type: graphql.Boolean},
+		{Name: "ephemeral", Type: graphql.Boolean},
+		{Name: "expires_at", Type: graphql.Time},
+		{Name: "version", Type: graphql.Int},
+		{Name: "created_at", Type: graphql.Time},
+		{Name: "updated_at", Type: graphql.Time},
+		{Name: "maintenance_start", Type: graphql.Time},
+		{Name: "maintenance_end", Type: graphql.Time},
+		{Name: "maintenance_reason", Type: graphql.String},
+		{
+			Name: "in_maintenance",
+			Type: graphql.Boolean,
+			Resolve: func(ctx context.Context, source interface{}, args graphql.Args) (interface{}, error) {
+				return source.(*models.Target).InMaintenance(time.Now()), nil
+			},
+		},
+		{Name: "zone", Type: zoneType, Batch: h.targetZone},
+		{Name: "credentials_count", Type: graphql.Int, Batch: h.targetCredentialsCount},
+		{Name: "last_session", Type: sessionType, Batch: h.targetLastSession},
+		{Name: "pending_schedules", Type: &graphql.List{Of: scheduleType}, Description: "Upcoming schedules not yet started or awaiting approval", Batch: h.targetPendingSchedules},
+	}
+
+	sessionType.Fields = []*graphql.Field{
+		{Name: "id", Type: graphql.ID},
+		{Name: "user_id", Type: graphql.ID},
+		{Name: "target_id", Type: graphql.ID},
+		{
+			Name: "credential_id",
+			Type: graphql.ID,
+			Resolve: func(ctx context.Context, source interface{}, args graphql.Args) (interface{}, error) {
+				if id := source.(*models.AuditLog).CredentialID; id.Valid {
+					return id.UUID, nil
+				}
+				return nil, nil
+			},
+		},
+		{Name: "start_time", Type: graphql.Time},
+		{
+			Name: "end_time",
+			Type: graphql.Time,
+			Resolve: func(ctx context.Context, source interface{}, args graphql.Args) (interface{}, error) {
+				if t := source.(*models.AuditLog).EndTime; t.Valid {
+					return t.Time, nil
+				}
+				return nil, nil
+			},
+		},
+		{Name: "session_status", Type: graphql.String},
+		{Name: "protocol", Type: graphql.String},
+	}
+
+	scheduleType.Fields = []*graphql.Field{
+		{Name: "id", Type: graphql.ID},
+		{Name: "user_id", Type: graphql.ID},
+		{Name: "target_id", Type: graphql.ID},
+		{Name: "start_time", Type: graphql.Time},
+		{Name: "end_time", Type: graphql.Time},
+		{Name: "timezone", Type: graphql.String},
+		{Name: "status", Type: graphql.String},
+		{Name: "approval_status", Type: graphql.String},
+		{Name: "created_at", Type: graphql.Time},
+	}
+
+	return &graphql.Object{Name: "Query", Fields: []*graphql.Field{
+		{
+			Name:        "targets",
+			Description: "Enabled targets by name",
+			Type:        &graphql.List{Of: targetType},
+			Args: []*graphql.Arg{
+				{Name: "zone_id", Type: graphql.ID},
+				{Name: "limit", Type: graphql.Int, Default: 50},
+				{Name: "offset", Type: graphql.Int, Default: 0},
+			},
+			Resolve: h.targets,
+		},
+		{
+			Name: "target",
+			Type: targetType,
+			Args: []*graphql.Arg{{Name: "id", Type: graphql.ID}},
+			Resolve: func(ctx context.Context, source interface{}, args graphql.Args) (interface{}, error) {
+				id, err := idArg(args, "id")
+				if err != nil || id == nil {
+					return nil, fmt.Errorf("invalid id")
+				}
+				targets, err := viewerFrom(ctx).targets.LoadMany(ctx, []uuid.UUID{*id})
+				if err != nil {
+					return nil, h.failed("target", err)
+				}
+				return targets[0], nil
+			},
+		},
+		{
+			Name: "zones",
+			Type: &graphql.List{Of: zoneType},
+			Resolve: func(ctx context.Context, source interface{}, args graphql.Args) (interface{}, error) {
+				zones, err := h.zoneRepo.List(ctx)
+				if err != nil {
+					return nil, h.failed("zones", err)
+				}
+				return zones, nil
+			},
+		},
+		{
+			Name: "zone",
+			Type: zoneType,
+			Args: []*graphql.Arg{{Name: "id", Type: graphql.ID}},
+			Resolve: func(ctx context.Context, source interface{}, args graphql.Args) (interface{}, error) {
+				id, err := idArg(args, "id")
+				if err != nil || id == nil {
+					return nil, fmt.Errorf("invalid id")
+				}
+				zones, err := viewerFrom(ctx).zones.LoadMany(ctx, []uuid.UUID{*id})
+				if err != nil {
+					return nil, h.failed("zone", err)
+				}
+				return zones[0], nil
+			},
+		},
+		{
+			Name:        "schedules",
+			Description: "Schedules, newest first; non-admins see only their own",
+			Type:        &graphql.List{Of: scheduleType},
+			Args: []*graphql.Arg{
+				{Name: "target_id", Type: graphql.ID},
+				{Name: "status", Type: graphql.String},
+				{Name: "approval_status", Type: graphql.String},
+			},
+			Resolve: h.schedules,
+		},
+	}}
+}
+
+func (h *GraphQLHandler) targets(ctx context.Context, source interface{}, args graphql.Args) (interface{}, error) {
+	limit, _ := args.Int("limit")
+	offset, _ := args.Int("offset")
+	if limit < 1 || limit > 100 {
+		return nil, fmt.Errorf("limit must be between 1 and 100")
+	}
+	if offset < 0 {
+		return nil, fmt.Errorf("offset cannot be negative")
+	}
+
+	zoneID, err := idArg(args, "zone_id")
+	if err != nil {
+		return nil, err
+	}
+	if zoneID == nil {
+		targets, err := h.targetRepo.List(ctx, limit, offset)
+		if err != nil {
+			return nil, h.failed("targets", err)
+		}
+		return targets, nil
+	}
+
+	targets, err := h.targetRepo.ListByZone(ctx, *zoneID)
+	if err != nil {
+		return nil, h.failed("targets", err)
+	}
+	if offset >= len(targets) {
+		return []*models.Target{}, nil
+	}
+	return targets[offset:min(offset+limit, len(targets))], nil
+}
+
+func (h *GraphQLHandler) schedules(ctx context.Context, source interface{}, args graphql.Args) (interface{}, error) {
+	targetID, err := idArg(args, "target_id")
+	if err != nil {
+		return nil, err
+	}
+
+	var status *models.ScheduleStatus
+	if s := args.String("status"); s != "" {
+		st := models.ScheduleStatus(s)
+		status = &st
+	}
+	var approvalStatus *string
+	if s := args.String("approval_status"); s != "" {
+		approvalStatus = &s
+	}
+
+	schedules, err := h.scheduleRepo.List(ctx, viewerFrom(ctx).scheduleUser, targetID, status, approvalStatus)
+	if err != nil {
+		return nil, h.failed("schedules", err)
+	}
+	out := make([]*models.Schedule, len(schedules))
+	for i := range schedules {
+		out[i] = &schedules[i]
+	}
+	return out, nil
+}
+
+// targetIDs returns the IDs of Target sources
+func targetIDs(sources []interface{}) []uuid.UUID {
+	ids := make([]uuid.UUID, len(sources))
+	for i, s := range sources {
+		ids[i] = s.(*models.Target).ID
+	}
+	return ids
+}
+
+func (h *GraphQLHandler) targetZone(ctx context.Context, sources []interface{}, args graphql.Args) ([]interface{}, error) {
+	ids := make([]uuid.UUID, len(sources))
+	for i, s := range sources {
+		ids[i] = s.(*models.Target).ZoneID
+	}
+	zones, err := viewerFrom(ctx).zones.LoadMany(ctx, ids)
+	if err != nil {
+		return nil, h.failed("zone", err)
+	}
+
+	values := make([]interface{}, len(zones))
+	for i, z := range zones {
+		values[i] = z
+	}
+	return values, nil
+}
+
+func (h *GraphQLHandler) targetCredentialsCount(ctx context.Context, sources []interface{}, args graphql.Args) ([]interface{}, error) {
+	ids := targetIDs(sources)
+	counts, err := h.credRepo.CountByTargets(ctx, ids)
+	if err != nil {
+		return nil, h.failed("credentials_count", err)
+	}
+
+	values := make([]interface{}, len(ids))
+	for i, id := range ids {
+		values[i] = counts[id]
+	}
+	return values, nil
+}
+
+func (h *GraphQLHandler) targetLastSession(ctx context.Context, sources []interface{}, args graphql.Args) ([]interface{}, error) {
+	ids := targetIDs(sources)
+	logs, err := h.auditRepo.LastByTargets(ctx, ids)
+	if err != nil {
+		return nil, h.failed("last_session", err)
+	}
+
+	byTarget := make(map[uuid.UUID]*models.AuditLog, len(logs))
+	for _, l := range logs {
+		byTarget[l.TargetID] = l
+	}
+	values := make([]interface{}, len(ids))
+	for i, id := range ids {
+		values[i] = byTarget[id]
+	}
+	return values, nil
+}
+
+func (h *GraphQLHandler) targetPendingSchedules(ctx context.Context, sources []interface{}, args graphql.Args) ([]interface{}, error) {
+	ids := targetIDs(sources)
+	schedules, err := h.scheduleRepo.ListPendingByTargets(ctx, ids, viewerFrom(ctx).scheduleUser)
+	if err != nil {
+		return nil, h.failed("pending_schedules", err)
+	}
+
+	byTarget := make(map[uuid.UUID][]*models.Schedule)
+	for i := range schedules {
+		byTarget[schedules[i].TargetID] = append(byTarget[schedules[i].TargetID], &schedules[i])
+	}
+	values := make([]interface{}, len(ids))
+	for i, id := range ids {
+		values[i] = append([]*models.Schedule{}, byTarget[id]...)
+	}
+	return values, nil
+}
+
+func (h *GraphQLHandler) zoneTargets(ctx context.Context, sources []interface{}, args graphql.Args) ([]interface{}, error) {
+	ids := make([]uuid.UUID, len(sources))
+	for i, s := range sources {
+		ids[i] = s.(*models.Zone).ID
+	}
+	targets, err := h.targetRepo.ListByZones(ctx, ids)
+	if err != nil {
+		return nil, h.failed("targets", err)
+	}
+
+	byZone := make(map[uuid.UUID][]*models.Target)
+	for _, t := range targets {
+		byZone[t.ZoneID] = append(byZone[t.ZoneID], t)
+	}
+	values := make([]interface{}, len(ids))
+	for i, id := range ids {
+		values[i] = append([]*models.Target{}, byZone[id]...)
+	}
+	return values, nil
+}
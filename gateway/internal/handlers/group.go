@@ -2,22 +2,28 @@ package handlers
 
 import (
 	"encoding/json"
+	"errors"
 	"net/http"
+	"strings"
 
-	"github.com/VanCannon/openpam/gateway/internal/logger"
+	"github.com/VanCannon/openpam/gateway/internal/models"
 	"github.com/VanCannon/openpam/gateway/internal/repository"
+	"github.com/VanCannon/openpam/gateway/internal/validate"
+	"github.com/VanCannon/openpam/pkg/logger"
 	"github.com/google/uuid"
 )
 
 type GroupHandler struct {
-	repo   *repository.GroupRepository
-	logger *logger.Logger
+	repo     *repository.GroupRepository
+	userRepo *repository.UserRepository
+	logger   *logger.Logger
 }
 
-func NewGroupHandler(repo *repository.GroupRepository, log *logger.Logger) *GroupHandler {
+func NewGroupHandler(repo *repository.GroupRepository, userRepo *repository.UserRepository, log *logger.Logger) *GroupHandler {
 	return &GroupHandler{
-		repo:   repo,
-		logger: log,
+		repo:     repo,
+		userRepo: userRepo,
+		logger:   log,
 	}
 }
 
@@ -63,6 +69,10 @@ func (h *GroupHandler) HandleDelete() http.HandlerFunc {
 		}
 
 		if err := h.repo.Delete(ctx, id); err != nil {
+			if errors.Is(err, repository.ErrGroupInQuorum) {
+				http.Error(w, "The group is required by a risk tier's approval quorum; change the quorum first", http.StatusConflict)
+				return
+			}
 			h.logger.Error("Failed to delete group", map[string]interface{}{
 				"error":    err.Error(),
 				"group_id": id,
@@ -74,3 +84,209 @@ func (h *GroupHandler) HandleDelete() http.HandlerFunc {
 		w.WriteHeader(http.StatusNoContent)
 	}
 }
+
+// HandleCreate creates a local group
+func (h *GroupHandler) HandleCreate() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+
+		var req struct {
+			Name        string `json:"name"`
+			Description string `json:"description"`
+			Role        string `json:"role"`
+		}
+		if !validate.Decode(w, r, &req) {
+			return
+		}
+
+		req.Name = strings.TrimSpace(req.Name)
+		if req.Name == "" {
+			http.Error(w, "Missing required fields", http.StatusBadRequest)
+			return
+		}
+		if req.Role == "" {
+			req.Role = models.RoleUser
+		}
+		if req.Role != models.RoleAdmin && req.Role != models.RoleUser && req.Role != models.RoleAuditor {
+			http.Error(w, "Invalid role", http.StatusBadRequest)
+			return
+		}
+
+		group := &models.Group{
+			Name:        req.Name,
+			Description: req.Description,
+			Role:        req.Role,
+		}
+		if err := h.repo.Create(ctx, group); err != nil {
+			h.logger.Error("Failed to create group", map[string]interface{}{
+				"error": err.Error(),
+			})
+			http.Error(w, "Failed to create group", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(group)
+	}
+}
+
+// HandleListMembers lists the members of a group
+func (h *GroupHandler) HandleListMembers() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+
+		group, ok := h.group(w, r)
+		if !ok {
+			return
+		}
+
+		members, err := h.repo.ListMembers(ctx, group.ID)
+		if err != nil {
+			h.logger.Error("Failed to list group members", map[string]interface{}{
+				"error":    err.Error(),
+				"group_id": group.ID,
+			})
+			http.Error(w, "Failed to list group members", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"members": members,
+		})
+	}
+}
+
+// HandleAddMember adds a user to a local group
+func (h *GroupHandler) HandleAddMember() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+
+		group, userID, ok := h.membership(w, r)
+		if !ok {
+			return
+		}
+
+		if _, err := h.userRepo.GetByID(ctx, userID); err != nil {
+			http.Error(w, "User not found", http.StatusNotFound)
+			return
+		}
+
+		if err := h.repo.AddMember(ctx, group.ID, userID, models.GroupSourceLocal); err != nil {
+			h.logger.Error("Failed to add group member", map[string]interface{}{
+				"error":    err.Error(),
+				"group_id": group.ID,
+				"user_id":  userID,
+			})
+			http.Error(w, "Failed to add group member", http.StatusInternalServerError)
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// HandleRemoveMember removes a user from a local group
+func (h *GroupHandler) HandleRemoveMember() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+
+		group, userID, ok := h.membership(w, r)
+		if !ok {
+			return
+		}
+
+		if err := h.repo.RemoveMember(ctx, group.ID, userID); err != nil {
+			if errors.Is(err, repository.ErrNotMember) {
+				http.Error(w, err.Error(), http.StatusNotFound)
+				return
+			}
+			h.logger.Error("Failed to remove group member", map[string]interface{}{
+				"error":    err.Error(),
+				"group_id": group.ID,
+				"user_id":  userID,
+			})
+			http.Error(w, "Failed to remove group member", http.StatusInternalServerError)
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// HandleListUserGroups lists the groups a user is a member of
+func (h *GroupHandler) HandleListUserGroups() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+
+		userID, err := uuid.Parse(r.PathValue("id"))
+		if err != nil {
+			http.Error(w, "Invalid user ID", http.StatusBadRequest)
+			return
+		}
+
+		groups, err := h.repo.ListByUser(ctx, userID)
+		if err != nil {
+			h.logger.Error("Failed to list user groups", map[string]interface{}{
+				"error":   err.Error(),
+				"user_id": userID,
+			})
+			http.Error(w, "Failed to list user groups", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"groups": groups,
+		})
+	}
+}
+
+// group loads the group named by the request path, writing the error response
+// if it can't
+func (h *GroupHandler) group(w http.ResponseWriter, r *http.Request) (*models.Group, bool) {
+	id, err := uuid.Parse(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, "Invalid group ID", http.StatusBadRequest)
+		return nil, false
+	}
+
+	group, err := h.repo.GetByID(r.Context(), id)
+	if err != nil {
+		if errors.Is(err, repository.ErrGroupNotFound) {
+			http.Error(w, "Group not found", http.StatusNotFound)
+			return nil, false
+		}
+		h.logger.Error("Failed to get group", map[string]interface{}{
+			"error":    err.Error(),
+			"group_id": id,
+		})
+		http.Error(w, "Failed to get group", http.StatusInternalServerError)
+		return nil, false
+	}
+
+	return group, true
+}
+
+// membership loads the local group and parses the user named by the request
+// path. Members of Active Directory groups come from the directory sync and
+// can't be changed here.
+func (h *GroupHandler) membership(w http.ResponseWriter, r *http.Request) (*models.Group, uuid.UUID, bool) {
+	group, ok := h.group(w, r)
+	if !ok {
+		return nil, uuid.Nil, false
+	}
+	if !group.IsLocal() {
+		http.Error(w, "Members of Active Directory groups are synced from the directory", http.StatusConflict)
+		return nil, uuid.Nil, false
+	}
+
+	userID, err := uuid.Parse(r.PathValue("user_id"))
+	if err != nil {
+		http.Error(w, "Invalid user ID", http.StatusBadRequest)
+		return nil, uuid.Nil, false
+	}
+
+	return group, userID, true
+}
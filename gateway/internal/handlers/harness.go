@@ -0,0 +1,45 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"runtime"
+	"time"
+
+	"github.com/VanCannon/openpam/gateway/internal/wsconn"
+)
+
+// HarnessHandler reports the gateway's resource usage to load generators
+// while the test harness runs
+type HarnessHandler struct {
+	sessions *wsconn.Tracker
+	started  time.Time
+}
+
+// NewHarnessHandler creates a new harness handler
+func NewHarnessHandler(sessions *wsconn.Tracker) *HarnessHandler {
+	return &HarnessHandler{
+		sessions: sessions,
+		started:  time.Now(),
+	}
+}
+
+// HandleStats returns the gateway's open sessions and Go runtime statistics
+// Route: GET /api/v1/harness/stats
+func (h *HarnessHandler) HandleStats() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var mem runtime.MemStats
+		runtime.ReadMemStats(&mem)
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"sessions":         h.sessions.Count(),
+			"goroutines":       runtime.NumGoroutine(),
+			"heap_alloc_bytes": mem.HeapAlloc,
+			"heap_sys_bytes":   mem.HeapSys,
+			"gc_runs":          mem.NumGC,
+			"gc_pause_ns":      mem.PauseTotalNs,
+			"uptime_seconds":   int64(time.Since(h.started).Seconds()),
+		})
+	}
+}
@@ -0,0 +1,574 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/VanCannon/openpam/gateway/internal/investigation"
+	"github.com/VanCannon/openpam/gateway/internal/middleware"
+	"github.com/VanCannon/openpam/gateway/internal/models"
+	"github.com/VanCannon/openpam/gateway/internal/recordings"
+	"github.com/VanCannon/openpam/gateway/internal/repository"
+	"github.com/VanCannon/openpam/gateway/internal/validate"
+	"github.com/VanCannon/openpam/pkg/logger"
+	"github.com/google/uuid"
+)
+
+// InvestigationHandler handles investigations: auditor cases that group
+// related sessions, system audit events, annotations and notes
+type InvestigationHandler struct {
+	invRepo         *repository.InvestigationRepository
+	auditRepo       *repository.AuditLogRepository
+	systemAuditRepo *repository.SystemAuditLogRepository
+	annotationRepo  *repository.AnnotationRepository
+	userRepo        *repository.UserRepository
+	storage         recordings.Storage
+	logger          *logger.Logger
+}
+
+// NewInvestigationHandler creates a new investigation handler
+func NewInvestigationHandler(
+	invRepo *repository.InvestigationRepository,
+	auditRepo *repository.AuditLogRepository,
+	systemAuditRepo *repository.SystemAuditLogRepository,
+	annotationRepo *repository.AnnotationRepository,
+	userRepo *repository.UserRepository,
+	storage recordings.Storage,
+	log *logger.Logger,
+) *InvestigationHandler {
+	return &InvestigationHandler{
+		invRepo:         invRepo,
+		auditRepo:       auditRepo,
+		systemAuditRepo: systemAuditRepo,
+		annotationRepo:  annotationRepo,
+		userRepo:        userRepo,
+		storage:         storage,
+		logger:          log,
+	}
+}
+
+type investigationRequest struct {
+	Title       string     `json:"title"`
+	Description *string    `json:"description"`
+	Status      string     `json:"status"`
+	OwnerID     *uuid.UUID `json:"owner_id"`
+	Version     *int       `json:"version"`
+}
+
+// validate normalises the request and returns a client-facing message for the
+// first problem found, or ""
+func (h *InvestigationHandler) validate(ctx context.Context, req *investigationRequest) string {
+	req.Title = strings.TrimSpace(req.Title)
+	if req.Title == "" {
+		return "Title is required"
+	}
+	if len(req.Title) > 255 {
+		return "Title must be at most 255 characters"
+	}
+
+	if req.Status == "" {
+		req.Status = models.InvestigationOpen
+	}
+	switch req.Status {
+	case models.InvestigationOpen, models.InvestigationInProgress, models.InvestigationClosed:
+	default:
+		return "Invalid status: must be 'open', 'in_progress' or 'closed'"
+	}
+
+	if req.OwnerID != nil {
+		owner, err := h.userRepo.GetByID(ctx, *req.OwnerID)
+		if err != nil {
+			return "Owner not found"
+		}
+		if owner.Role != models.RoleAdmin && owner.Role != models.RoleAuditor {
+			return "Owner must be an admin or auditor"
+		}
+	}
+
+	return ""
+}
+
+// HandleList lists investigations, optionally filtered by status and owner
+// Route: GET /api/v1/investigations?status=open&owner_id=UUID
+func (h *InvestigationHandler) HandleList() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+
+		limit, _ := strconv.Atoi(query.Get("limit"))
+		offset, _ := strconv.Atoi(query.Get("offset"))
+		if limit <= 0 || limit > 100 {
+			limit = 50
+		}
+		if offset < 0 {
+			offset = 0
+		}
+
+		var ownerID *uuid.UUID
+		if v := query.Get("owner_id"); v != "" {
+			id, err := uuid.Parse(v)
+			if err != nil {
+				http.Error(w, "Invalid owner_id", http.StatusBadRequest)
+				return
+			}
+			ownerID = &id
+		}
+
+		invs, err := h.invRepo.List(r.Context(), query.Get("status"), ownerID, limit, offset)
+		if err != nil {
+			h.logger.Error("Failed to list investigations", map[string]interface{}{
+				"error": err.Error(),
+			})
+			http.Error(w, "Failed to list investigations", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"investigations": invs,
+			"count":          len(invs),
+			"limit":          limit,
+			"offset":         offset,
+		})
+	}
+}
+
+// HandleCreate opens a new investigation
+// Route: POST /api/v1/investigations
+func (h *InvestigationHandler) HandleCreate() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+
+		userID, err := uuid.Parse(middleware.GetUserID(ctx))
+		if err != nil {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		var req investigationRequest
+		if !validate.Decode(w, r, &req) {
+			return
+		}
+
+		// The creator owns the case unless it is handed to someone else
+		if req.OwnerID == nil {
+			req.OwnerID = &userID
+		}
+
+		if msg := h.validate(ctx, &req); msg != "" {
+			http.Error(w, msg, http.StatusBadRequest)
+			return
+		}
+		if req.Status == models.InvestigationClosed {
+			http.Error(w, "A new investigation cannot be closed", http.StatusBadRequest)
+			return
+		}
+
+		inv := &models.Investigation{
+			Title:       req.Title,
+			Description: req.Description,
+			Status:      req.Status,
+			OwnerID:     req.OwnerID,
+			CreatedBy:   &userID,
+		}
+
+		if err := h.invRepo.Create(ctx, inv); err != nil {
+			h.logger.Error("Failed to create investigation", map[string]interface{}{
+				"error": err.Error(),
+			})
+			http.Error(w, "Failed to create investigation", http.StatusInternalServerError)
+			return
+		}
+
+		h.recordEvent(r, models.EventTypeInvestigationCreated, "create", map[string]interface{}{
+			"investigation_id": inv.ID.String(),
+			"title":            inv.Title,
+		})
+
+		h.logger.Info("Investigation created", map[string]interface{}{
+			"investigation_id": inv.ID.String(),
+			"created_by":       middleware.GetUserEmail(ctx),
+		})
+
+		setETag(w, inv.Version)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(inv)
+	}
+}
+
+// HandleGet retrieves an investigation with its evidence
+// Route: GET /api/v1/investigations/{id}
+func (h *InvestigationHandler) HandleGet() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+
+		id, err := uuid.Parse(r.PathValue("id"))
+		if err != nil {
+			http.Error(w, "Invalid investigation ID", http.StatusBadRequest)
+			return
+		}
+
+		inv, err := h.invRepo.GetByID(ctx, id)
+		if err != nil {
+			http.Error(w, "Investigation not found", http.StatusNotFound)
+			return
+		}
+
+		evidence, err := h.loadEvidence(ctx, id)
+		if err != nil {
+			h.logger.Error("Failed to load investigation evidence", map[string]interface{}{
+				"investigation_id": id.String(),
+				"error":            err.Error(),
+			})
+			http.Error(w, "Failed to load investigation", http.StatusInternalServerError)
+			return
+		}
+
+		setETag(w, inv.Version)
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"investigation": inv,
+			"evidence":      evidence,
+		})
+	}
+}
+
+// HandleUpdate changes the title, description, status or owner of an investigation
+// Route: PUT /api/v1/investigations/{id}
+func (h *InvestigationHandler) HandleUpdate() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+
+		id, err := uuid.Parse(r.PathValue("id"))
+		if err != nil {
+			http.Error(w, "Invalid investigation ID", http.StatusBadRequest)
+			return
+		}
+
+		var req investigationRequest
+		if !validate.Decode(w, r, &req) {
+			return
+		}
+
+		version, ok := requireVersion(w, r, req.Version)
+		if !ok {
+			return
+		}
+
+		if msg := h.validate(ctx, &req); msg != "" {
+			http.Error(w, msg, http.StatusBadRequest)
+			return
+		}
+
+		inv, err := h.invRepo.GetByID(ctx, id)
+		if err != nil {
+			http.Error(w, "Investigation not found", http.StatusNotFound)
+			return
+		}
+
+		if inv.Version != version {
+			writeVersionConflict(w, inv.Version, inv)
+			return
+		}
+
+		previousStatus := inv.Status
+		inv.Title = req.Title
+		inv.Description = req.Description
+		inv.Status = req.Status
+		inv.OwnerID = req.OwnerID
+
+		if err := h.invRepo.Update(ctx, inv); err != nil {
+			if errors.Is(err, repository.ErrVersionConflict) {
+				if current, err := h.invRepo.GetByID(ctx, id); err == nil {
+					writeVersionConflict(w, current.Version, current)
+					return
+				}
+			}
+			h.logger.Error("Failed to update investigation", map[string]interface{}{
+				"error": err.Error(),
+			})
+			http.Error(w, "Failed to update investigation", http.StatusInternalServerError)
+			return
+		}
+
+		// Return the stored row so the owner email matches the new owner
+		if current, err := h.invRepo.GetByID(ctx, id); err == nil {
+			inv = current
+		}
+
+		details := map[string]interface{}{
+			"investigation_id": inv.ID.String(),
+			"status":           inv.Status,
+		}
+		if previousStatus != inv.Status {
+			details["previous_status"] = previousStatus
+		}
+		if inv.OwnerID != nil {
+			details["owner_id"] = inv.OwnerID.String()
+		}
+		h.recordEvent(r, models.EventTypeInvestigationUpdated, "update", details)
+
+		setETag(w, inv.Version)
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(inv)
+	}
+}
+
+// HandleAddItem attaches a session, system audit event or annotation, or adds a note
+// Route: POST /api/v1/investigations/{id}/items
+func (h *InvestigationHandler) HandleAddItem() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+
+		id, err := uuid.Parse(r.PathValue("id"))
+		if err != nil {
+			http.Error(w, "Invalid investigation ID", http.StatusBadRequest)
+			return
+		}
+
+		userID, err := uuid.Parse(middleware.GetUserID(ctx))
+		if err != nil {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		var req struct {
+			Type        string     `json:"type"`
+			ReferenceID *uuid.UUID `json:"reference_id"`
+			Note        *string    `json:"note"`
+		}
+
+		if !validate.Decode(w, r, &req) {
+			return
+		}
+
+		inv, err := h.invRepo.GetByID(ctx, id)
+		if err != nil {
+			http.Error(w, "Investigation not found", http.StatusNotFound)
+			return
+		}
+		if inv.Status == models.InvestigationClosed {
+			http.Error(w, "Investigation is closed", http.StatusConflict)
+			return
+		}
+
+		item := &models.InvestigationItem{
+			InvestigationID: id,
+			ItemType:        req.Type,
+			AddedBy:         &userID,
+		}
+
+		if req.Type == models.InvestigationItemNote {
+			item.Note = trimmedOrNil(req.Note)
+			if item.Note == nil {
+				http.Error(w, "A note requires text", http.StatusBadRequest)
+				return
+			}
+		} else {
+			if req.ReferenceID == nil {
+				http.Error(w, "reference_id is required", http.StatusBadRequest)
+				return
+			}
+
+			var lookupErr error
+			switch req.Type {
+			case models.InvestigationItemSession:
+				_, lookupErr = h.auditRepo.GetByID(ctx, *req.ReferenceID)
+				item.AuditLogID = req.ReferenceID
+			case models.InvestigationItemSystemEvent:
+				_, lookupErr = h.systemAuditRepo.GetByID(ctx, *req.ReferenceID)
+				item.SystemAuditLogID = req.ReferenceID
+			case models.InvestigationItemAnnotation:
+				_, lookupErr = h.annotationRepo.GetByID(ctx, *req.ReferenceID)
+				item.AnnotationID = req.ReferenceID
+			default:
+				http.Error(w, "Invalid type: must be 'session', 'system_event', 'annotation' or 'note'", http.StatusBadRequest)
+				return
+			}
+			if lookupErr != nil {
+				http.Error(w, "Referenced "+strings.ReplaceAll(req.Type, "_", " ")+" not found", http.StatusBadRequest)
+				return
+			}
+		}
+
+		if err := h.invRepo.AddItem(ctx, item); err != nil {
+			if errors.Is(err, repository.ErrAlreadyAttached) {
+				http.Error(w, "Already attached to this investigation", http.StatusConflict)
+				return
+			}
+			h.logger.Error("Failed to add investigation item", map[string]interface{}{
+				"investigation_id": id.String(),
+				"error":            err.Error(),
+			})
+			http.Error(w, "Failed to add item", http.StatusInternalServerError)
+			return
+		}
+
+		email := middleware.GetUserEmail(ctx)
+		item.AddedByEmail = &email
+
+		h.logger.Info("Investigation item added", map[string]interface{}{
+			"investigation_id": id.String(),
+			"item_id":          item.ID.String(),
+			"item_type":        item.ItemType,
+			"added_by":         email,
+		})
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(item)
+	}
+}
+
+// HandleRemoveItem detaches an item from an investigation
+// Route: DELETE /api/v1/investigations/{id}/items/{item_id}
+func (h *InvestigationHandler) HandleRemoveItem() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+
+		id, err := uuid.Parse(r.PathValue("id"))
+		if err != nil {
+			http.Error(w, "Invalid investigation ID", http.StatusBadRequest)
+			return
+		}
+
+		itemID, err := uuid.Parse(r.PathValue("item_id"))
+		if err != nil {
+			http.Error(w, "Invalid item ID", http.StatusBadRequest)
+			return
+		}
+
+		inv, err := h.invRepo.GetByID(ctx, id)
+		if err != nil {
+			http.Error(w, "Investigation not found", http.StatusNotFound)
+			return
+		}
+		if inv.Status == models.InvestigationClosed {
+			http.Error(w, "Investigation is closed", http.StatusConflict)
+			return
+		}
+
+		if err := h.invRepo.RemoveItem(ctx, id, itemID); err != nil {
+			http.Error(w, "Investigation item not found", http.StatusNotFound)
+			return
+		}
+
+		h.logger.Info("Investigation item removed", map[string]interface{}{
+			"investigation_id": id.String(),
+			"item_id":          itemID.String(),
+			"removed_by":       middleware.GetUserEmail(ctx),
+		})
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// HandleExport downloads the case bundle: a ZIP with the case and its evidence as
+// JSON, a CSV timeline, the recordings of the attached sessions and a SHA-256
+// manifest
+// Route: GET /api/v1/investigations/{id}/export
+func (h *InvestigationHandler) HandleExport() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+
+		id, err := uuid.Parse(r.PathValue("id"))
+		if err != nil {
+			http.Error(w, "Invalid investigation ID", http.StatusBadRequest)
+			return
+		}
+
+		inv, err := h.invRepo.GetByID(ctx, id)
+		if err != nil {
+			http.Error(w, "Investigation not found", http.StatusNotFound)
+			return
+		}
+
+		evidence, err := h.loadEvidence(ctx, id)
+		if err != nil {
+			h.logger.Error("Failed to load investigation evidence", map[string]interface{}{
+				"investigation_id": id.String(),
+				"error":            err.Error(),
+			})
+			http.Error(w, "Failed to build case bundle", http.StatusInternalServerError)
+			return
+		}
+
+		bundle := &investigation.Bundle{
+			Investigation: inv,
+			Evidence:      evidence,
+			ExportedAt:    time.Now().UTC(),
+			ExportedBy:    middleware.GetUserEmail(ctx),
+		}
+
+		// Build the archive first so a failure still yields a proper error response
+		var buf bytes.Buffer
+		if err := investigation.WriteZip(&buf, bundle, h.storage); err != nil {
+			h.logger.Error("Failed to build case bundle", map[string]interface{}{
+				"investigation_id": id.String(),
+				"error":            err.Error(),
+			})
+			http.Error(w, "Failed to build case bundle", http.StatusInternalServerError)
+			return
+		}
+
+		h.recordEvent(r, models.EventTypeInvestigationExported, "export", map[string]interface{}{
+			"investigation_id": inv.ID.String(),
+			"items":            len(evidence),
+		})
+
+		w.Header().Set("Content-Type", "application/zip")
+		w.Header().Set("Content-Disposition", `attachment; filename="investigation-`+inv.ID.String()+`.zip"`)
+		w.Write(buf.Bytes())
+	}
+}
+
+// loadEvidence returns the items of an investigation with the records they refer to
+func (h *InvestigationHandler) loadEvidence(ctx context.Context, id uuid.UUID) ([]*investigation.Evidence, error) {
+	items, err := h.invRepo.ListItems(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	evidence := make([]*investigation.Evidence, 0, len(items))
+	for _, item := range items {
+		e := &investigation.Evidence{Item: item}
+		switch {
+		case item.AuditLogID != nil:
+			if e.Session, err = h.auditRepo.GetByID(ctx, *item.AuditLogID); err != nil {
+				return nil, err
+			}
+		case item.SystemAuditLogID != nil:
+			if e.Event, err = h.systemAuditRepo.GetByID(ctx, *item.SystemAuditLogID); err != nil {
+				return nil, err
+			}
+		case item.AnnotationID != nil:
+			if e.Annotation, err = h.annotationRepo.GetByID(ctx, *item.AnnotationID); err != nil {
+				return nil, err
+			}
+		}
+		evidence = append(evidence, e)
+	}
+
+	return evidence, nil
+}
+
+func (h *InvestigationHandler) recordEvent(r *http.Request, eventType, action string, details map[string]interface{}) {
+	var userID *uuid.UUID
+	if id, err := uuid.Parse(middleware.GetUserID(r.Context())); err == nil {
+		userID = &id
+	}
+
+	ip := r.RemoteAddr
+	if err := h.systemAuditRepo.CreateSimple(r.Context(), eventType, userID, action, "success", &ip, details); err != nil {
+		h.logger.Error("Failed to record investigation audit event", map[string]interface{}{
+			"event_type": eventType,
+			"error":      err.Error(),
+		})
+	}
+}
@@ -0,0 +1,225 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/VanCannon/openpam/gateway/internal/discovery"
+	"github.com/VanCannon/openpam/gateway/internal/middleware"
+	"github.com/VanCannon/openpam/gateway/internal/validate"
+	"github.com/VanCannon/openpam/pkg/logger"
+	"github.com/google/uuid"
+)
+
+// LAPSHandler handles LAPS-style rotation of Windows Administrator passwords
+type LAPSHandler struct {
+	scanner *discovery.Scanner
+	logger  *logger.Logger
+}
+
+// NewLAPSHandler creates a new LAPS handler
+func NewLAPSHandler(scanner *discovery.Scanner, log *logger.Logger) *LAPSHandler {
+	return &LAPSHandler{
+		scanner: scanner,
+		logger:  log,
+	}
+}
+
+// EnrollLAPSRequest names the machine to enroll
+type EnrollLAPSRequest struct {
+	TargetID uuid.UUID `json:"target_id"`
+}
+
+// Validate checks that a target is given
+func (req *EnrollLAPSRequest) Validate() validate.Errors {
+	var errs validate.Errors
+	errs.Check(req.TargetID != uuid.Nil, "target_id", "is required")
+	return errs
+}
+
+// RetrieveLAPSRequest gives the reason a password is retrieved
+type RetrieveLAPSRequest struct {
+	Reason string `json:"reason"`
+}
+
+// HandleList lists the enrolled machines, or only the overdue ones
+// Route: GET /api/v1/laps/machines?overdue=true
+func (h *LAPSHandler) HandleList() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		machines, err := h.scanner.LAPSMachines(r.Context(), r.URL.Query().Get("overdue") == "true")
+		if err != nil {
+			h.logger.Error("Failed to list LAPS machines", map[string]interface{}{
+				"error": err.Error(),
+			})
+			http.Error(w, "Failed to list LAPS machines", http.StatusInternalServerError)
+			return
+		}
+
+		overdue := 0
+		for _, m := range machines {
+			if m.Overdue {
+				overdue++
+			}
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"machines": machines,
+			"count":    len(machines),
+			"overdue":  overdue,
+		})
+	}
+}
+
+// HandleEnroll enrolls a Windows target: its Administrator password is set to
+// a generated one and rotated on a schedule from then on
+// Route: POST /api/v1/laps/machines
+func (h *LAPSHandler) HandleEnroll() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req EnrollLAPSRequest
+		if !validate.Decode(w, r, &req) {
+			return
+		}
+
+		userID, ip := requester(r)
+		machine, err := h.scanner.EnrollLAPS(r.Context(), req.TargetID, userID, &ip)
+		if err != nil {
+			h.writeLAPSError(w, "enroll", req.TargetID, err)
+			return
+		}
+
+		h.logger.Info("LAPS machine enrolled", map[string]interface{}{
+			"target_id":   req.TargetID.String(),
+			"enrolled_by": middleware.GetUserEmail(r.Context()),
+		})
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(machine)
+	}
+}
+
+// HandleGet returns an enrolled machine
+// Route: GET /api/v1/laps/machines/{id}
+func (h *LAPSHandler) HandleGet() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		targetID, ok := h.machine(w, r)
+		if !ok {
+			return
+		}
+
+		machine, err := h.scanner.LAPSMachine(r.Context(), targetID)
+		if err != nil {
+			http.Error(w, "LAPS machine not found", http.StatusNotFound)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(machine)
+	}
+}
+
+// HandleUnenroll stops rotating a machine's password
+// Route: DELETE /api/v1/laps/machines/{id}
+func (h *LAPSHandler) HandleUnenroll() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		targetID, ok := h.machine(w, r)
+		if !ok {
+			return
+		}
+
+		userID, ip := requester(r)
+		if err := h.scanner.UnenrollLAPS(r.Context(), targetID, userID, &ip); err != nil {
+			h.writeLAPSError(w, "unenroll", targetID, err)
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// HandleRotate rotates a machine's password now
+// Route: POST /api/v1/laps/machines/{id}/rotate
+func (h *LAPSHandler) HandleRotate() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		targetID, ok := h.machine(w, r)
+		if !ok {
+			return
+		}
+
+		userID, ip := requester(r)
+		machine, err := h.scanner.RotateLAPS(r.Context(), targetID, userID, &ip)
+		if err != nil {
+			h.writeLAPSError(w, "rotate", targetID, err)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(machine)
+	}
+}
+
+// HandleRetrieve returns a machine's current password. A reason is required
+// and recorded in the audit log with the retrieval.
+// Route: POST /api/v1/laps/machines/{id}/password
+func (h *LAPSHandler) HandleRetrieve() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		targetID, ok := h.machine(w, r)
+		if !ok {
+			return
+		}
+
+		var req RetrieveLAPSRequest
+		if !validate.Decode(w, r, &req) {
+			return
+		}
+
+		userID, ip := requester(r)
+		password, err := h.scanner.RetrieveLAPSPassword(r.Context(), targetID, req.Reason, userID, &ip)
+		if err != nil {
+			h.writeLAPSError(w, "retrieve password of", targetID, err)
+			return
+		}
+
+		h.logger.Info("LAPS password retrieved", map[string]interface{}{
+			"target_id":    targetID.String(),
+			"retrieved_by": middleware.GetUserEmail(r.Context()),
+		})
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "no-store")
+		json.NewEncoder(w).Encode(password)
+	}
+}
+
+// machine parses the machine's target ID and checks that it is enrolled
+func (h *LAPSHandler) machine(w http.ResponseWriter, r *http.Request) (uuid.UUID, bool) {
+	targetID, err := uuid.Parse(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, "Invalid target ID", http.StatusBadRequest)
+		return uuid.Nil, false
+	}
+
+	if _, err := h.scanner.LAPSMachine(r.Context(), targetID); err != nil {
+		http.Error(w, "LAPS machine not found", http.StatusNotFound)
+		return uuid.Nil, false
+	}
+
+	return targetID, true
+}
+
+func (h *LAPSHandler) writeLAPSError(w http.ResponseWriter, action string, targetID uuid.UUID, err error) {
+	switch {
+	case errors.Is(err, discovery.ErrNotEnrolled):
+		http.Error(w, err.Error(), http.StatusConflict)
+	case errors.Is(err, discovery.ErrNotWindows), errors.Is(err, discovery.ErrNoCredential), errors.Is(err, discovery.ErrReasonRequired):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	default:
+		h.logger.Error("Failed to "+action+" LAPS machine", map[string]interface{}{
+			"target_id": targetID.String(),
+			"error":     err.Error(),
+		})
+		http.Error(w, "Failed to "+action+" machine: "+err.Error(), http.StatusBadGateway)
+	}
+}
@@ -0,0 +1,326 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/VanCannon/openpam/gateway/internal/middleware"
+	"github.com/VanCannon/openpam/gateway/internal/models"
+	"github.com/VanCannon/openpam/gateway/internal/notify"
+	"github.com/VanCannon/openpam/gateway/internal/repository"
+	"github.com/VanCannon/openpam/gateway/internal/validate"
+	"github.com/VanCannon/openpam/pkg/logger"
+	"github.com/google/uuid"
+)
+
+// MaintenanceHandler handles target maintenance windows
+type MaintenanceHandler struct {
+	targetRepo   *repository.TargetRepository
+	scheduleRepo *repository.ScheduleRepository
+	auditRepo    *repository.SystemAuditLogRepository
+	notifier     notify.Notifier
+	logger       *logger.Logger
+}
+
+// NewMaintenanceHandler creates a new maintenance handler
+func NewMaintenanceHandler(
+	targetRepo *repository.TargetRepository,
+	scheduleRepo *repository.ScheduleRepository,
+	auditRepo *repository.SystemAuditLogRepository,
+	notifier notify.Notifier,
+	log *logger.Logger,
+) *MaintenanceHandler {
+	return &MaintenanceHandler{
+		targetRepo:   targetRepo,
+		scheduleRepo: scheduleRepo,
+		auditRepo:    auditRepo,
+		notifier:     notifier,
+		logger:       log,
+	}
+}
+
+// MaintenanceRequest puts a target under maintenance, or takes it out
+type MaintenanceRequest struct {
+	Enabled bool       `json:"enabled"`
+	Start   *time.Time `json:"start"` // Default now
+	End     *time.Time `json:"end"`   // Unset: until cleared
+	Reason  string     `json:"reason"`
+}
+
+// MaintenanceResponse is the target's window and the scheduled accesses it overlaps
+type MaintenanceResponse struct {
+	Maintenance *models.MaintenanceWindow     `json:"maintenance"`
+	Conflicts   []*models.MaintenanceConflict `json:"conflicts"`
+	Notified    int                           `json:"notified"`
+}
+
+// HandleSet sets or clears a target's maintenance window. Users whose
+// scheduled accesses overlap a new window are notified.
+// Route: PATCH /api/v1/targets/{id}/maintenance
+func (h *MaintenanceHandler) HandleSet() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+
+		targetID, err := uuid.Parse(r.PathValue("id"))
+		if err != nil {
+			http.Error(w, "Invalid target ID", http.StatusBadRequest)
+			return
+		}
+
+		var req MaintenanceRequest
+		if !validate.Decode(w, r, &req) {
+			return
+		}
+
+		target, err := h.targetRepo.GetByID(ctx, targetID)
+		if err != nil {
+			http.Error(w, "Target not found", http.StatusNotFound)
+			return
+		}
+
+		userID, ip := requester(r)
+		now := time.Now()
+
+		if !req.Enabled {
+			target.MaintenanceStart = nil
+		} else {
+			start := now
+			if req.Start != nil {
+				start = *req.Start
+			}
+			if req.End != nil && !req.End.After(start) {
+				http.Error(w, "Maintenance end must be after its start", http.StatusBadRequest)
+				return
+			}
+			if req.End != nil && !req.End.After(now) {
+				http.Error(w, "Maintenance end must be in the future", http.StatusBadRequest)
+				return
+			}
+
+			target.MaintenanceStart = &start
+			target.MaintenanceEnd = req.End
+			target.MaintenanceReason = nil
+			if reason := strings.TrimSpace(req.Reason); reason != "" {
+				target.MaintenanceReason = &reason
+			}
+			target.MaintenanceBy = userID
+		}
+
+		if err := h.targetRepo.SetMaintenance(ctx, target); err != nil {
+			h.logger.Error("Failed to set target maintenance", map[string]interface{}{
+				"target_id": targetID.String(),
+				"error":     err.Error(),
+			})
+			http.Error(w, "Failed to set target maintenance", http.StatusInternalServerError)
+			return
+		}
+
+		resp := MaintenanceResponse{
+			Maintenance: target.Maintenance(),
+			Conflicts:   []*models.MaintenanceConflict{},
+		}
+
+		details := map[string]interface{}{
+			"target_id":   target.ID.String(),
+			"target_name": target.Name,
+		}
+		eventType, action := models.EventTypeMaintenanceCleared, "clear"
+
+		if resp.Maintenance != nil {
+			eventType, action = models.EventTypeMaintenanceSet, "set"
+			details["start"] = resp.Maintenance.Start
+			details["end"] = resp.Maintenance.End
+			details["reason"] = resp.Maintenance.Reason
+
+			conflicts, err := h.scheduleRepo.ListOverlapping(ctx, targetID, resp.Maintenance.Start, resp.Maintenance.End)
+			if err != nil {
+				h.logger.Error("Failed to list schedules overlapping maintenance", map[string]interface{}{
+					"target_id": targetID.String(),
+					"error":     err.Error(),
+				})
+			} else if len(conflicts) > 0 {
+				resp.Conflicts = conflicts
+				resp.Notified = h.notifyConflicts(r, resp.Maintenance, conflicts)
+				details["conflicts"] = len(conflicts)
+				details["notified"] = resp.Notified
+			}
+		}
+
+		if err := h.auditRepo.CreateSimple(ctx, eventType, userID, action, "success", &ip, details); err != nil {
+			h.logger.Error("Failed to create system audit log", map[string]interface{}{
+				"error": err.Error(),
+			})
+		}
+
+		h.logger.Info("Target maintenance "+action, map[string]interface{}{
+			"target_id": targetID.String(),
+			"by":        middleware.GetUserEmail(ctx),
+			"conflicts": len(resp.Conflicts),
+		})
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(resp)
+	}
+}
+
+// notifyConflicts tells each user with a scheduled access overlapping the
+// window about it, and returns how many users were notified
+func (h *MaintenanceHandler) notifyConflicts(r *http.Request, window *models.MaintenanceWindow, conflicts []*models.MaintenanceConflict) int {
+	byUser := make(map[string][]*models.MaintenanceConflict)
+	for _, c := range conflicts {
+		byUser[c.UserEmail] = append(byUser[c.UserEmail], c)
+	}
+	emails := make([]string, 0, len(byUser))
+	for email := range byUser {
+		emails = append(emails, email)
+	}
+	sort.Strings(emails)
+
+	until := "until further notice"
+	if window.End != nil {
+		until = "until " + window.End.UTC().Format(time.RFC1123)
+	}
+	reason := ""
+	if window.Reason != nil {
+		reason = "\nReason: " + *window.Reason + "\n"
+	}
+
+	notified := 0
+	for _, email := range emails {
+		var lines []string
+		for _, c := range byUser[email] {
+			lines = append(lines, fmt.Sprintf("  %s to %s (%s)",
+				c.StartTime.UTC().Format(time.RFC1123), c.EndTime.UTC().Format(time.RFC1123), c.ApprovalStatus))
+		}
+
+		msg := &notify.Message{
+			To:      []string{email},
+			Subject: fmt.Sprintf("OpenPAM: %s is under maintenance", window.TargetName),
+			Body: fmt.Sprintf("%s is under maintenance from %s %s.\n%s\n"+
+				"Your scheduled access overlaps it:\n\n%s\n\n"+
+				"New sessions to the target are refused during maintenance. You may want to reschedule.",
+				window.TargetName, window.Start.UTC().Format(time.RFC1123), until, reason, strings.Join(lines, "\n")),
+		}
+		if err := h.notifier.Send(r.Context(), msg); err != nil {
+			h.logger.Warn("Failed to notify user of target maintenance", map[string]interface{}{
+				"target_id": window.TargetID.String(),
+				"user":      email,
+				"error":     err.Error(),
+			})
+			continue
+		}
+		notified++
+	}
+
+	return notified
+}
+
+// HandleCalendar lists the maintenance windows overlapping a period, for the
+// schedule calendar
+// Route: GET /api/v1/schedules/maintenance?from=&to=
+func (h *MaintenanceHandler) HandleCalendar() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		from := time.Now()
+
+		if f := query.Get("from"); f != "" {
+			parsed, err := time.Parse(time.RFC3339, f)
+			if err != nil {
+				http.Error(w, "Invalid from time", http.StatusBadRequest)
+				return
+			}
+			from = parsed
+		}
+		to := from.Add(30 * 24 * time.Hour)
+		if t := query.Get("to"); t != "" {
+			parsed, err := time.Parse(time.RFC3339, t)
+			if err != nil {
+				http.Error(w, "Invalid to time", http.StatusBadRequest)
+				return
+			}
+			to = parsed
+		}
+		if !to.After(from) {
+			http.Error(w, "to must be after from", http.StatusBadRequest)
+			return
+		}
+
+		targets, err := h.targetRepo.ListMaintenance(r.Context(), from, to)
+		if err != nil {
+			h.logger.Error("Failed to list maintenance windows", map[string]interface{}{
+				"error": err.Error(),
+			})
+			http.Error(w, "Failed to list maintenance windows", http.StatusInternalServerError)
+			return
+		}
+
+		windows := make([]*models.MaintenanceWindow, 0, len(targets))
+		for _, t := range targets {
+			windows = append(windows, t.Maintenance())
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"windows": windows,
+			"count":   len(windows),
+		})
+	}
+}
+
+// systemAuditStore records events in the system audit log
+type systemAuditStore interface {
+	CreateSimple(ctx context.Context, eventType string, userID *uuid.UUID, action string, status string, ipAddress *string, details map[string]interface{}) error
+}
+
+// maintenanceGate refuses a new session on a target under maintenance and
+// reports false, having written the response. Admins may connect anyway by
+// passing override_maintenance=true; overrides are audited.
+func maintenanceGate(w http.ResponseWriter, r *http.Request, target *models.Target, audit systemAuditStore, log *logger.Logger) bool {
+	now := time.Now()
+	if !target.InMaintenance(now) {
+		return true
+	}
+
+	ctx := r.Context()
+	userEmail := middleware.GetUserEmail(ctx)
+
+	if middleware.GetUserRole(ctx) == models.RoleAdmin && r.URL.Query().Get("override_maintenance") == "true" {
+		log.Warn("Maintenance overridden by admin", map[string]interface{}{
+			"target_id": target.ID.String(),
+			"user":      userEmail,
+		})
+		userID, ip := requester(r)
+		details := map[string]interface{}{
+			"target_id":   target.ID.String(),
+			"target_name": target.Name,
+		}
+		if err := audit.CreateSimple(ctx, models.EventTypeMaintenanceOverride, userID, "override", "success", &ip, details); err != nil {
+			log.Error("Failed to create system audit log", map[string]interface{}{
+				"error": err.Error(),
+			})
+		}
+		return true
+	}
+
+	log.Warn("Session refused during maintenance", map[string]interface{}{
+		"target_id": target.ID.String(),
+		"user":      userEmail,
+	})
+
+	msg := "Target is under maintenance"
+	if target.MaintenanceEnd != nil {
+		msg += " until " + target.MaintenanceEnd.UTC().Format(time.RFC1123)
+		w.Header().Set("Retry-After", strconv.Itoa(int(target.MaintenanceEnd.Sub(now).Seconds())+1))
+	}
+	if target.MaintenanceReason != nil {
+		msg += ": " + *target.MaintenanceReason
+	}
+	http.Error(w, msg, http.StatusServiceUnavailable)
+	return false
+}
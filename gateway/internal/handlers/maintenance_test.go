@@ -0,0 +1,93 @@
+package handlers
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/VanCannon/openpam/gateway/internal/auth"
+	"github.com/VanCannon/openpam/gateway/internal/middleware"
+	"github.com/VanCannon/openpam/gateway/internal/models"
+	"github.com/VanCannon/openpam/pkg/logger"
+	"github.com/google/uuid"
+)
+
+// recordedAudit keeps the system audit events it is given
+type recordedAudit struct {
+	events []string
+}
+
+func (a *recordedAudit) CreateSimple(ctx context.Context, eventType string, userID *uuid.UUID, action string, status string, ipAddress *string, details map[string]interface{}) error {
+	a.events = append(a.events, eventType)
+	return nil
+}
+
+func TestMaintenanceGate(t *testing.T) {
+	tokens := auth.NewTokenManager("test-secret", time.Hour)
+	signIn := func(role string) string {
+		token, err := tokens.GenerateToken(uuid.NewString(), role+"@example.com", role, role)
+		if err != nil {
+			t.Fatalf("GenerateToken() error = %v", err)
+		}
+		return token
+	}
+
+	past := time.Now().Add(-time.Hour)
+	future := time.Now().Add(time.Hour)
+	reason := "Patching"
+
+	tests := []struct {
+		name       string
+		target     models.Target
+		role       string
+		query      string
+		allowed    bool
+		retryAfter bool
+		overridden bool
+	}{
+		{name: "No maintenance", target: models.Target{}, role: models.RoleUser, allowed: true},
+		{name: "Maintenance later", target: models.Target{MaintenanceStart: &future}, role: models.RoleUser, allowed: true},
+		{name: "User refused", target: models.Target{MaintenanceStart: &past, MaintenanceEnd: &future, MaintenanceReason: &reason}, role: models.RoleUser, retryAfter: true},
+		{name: "User can't override", target: models.Target{MaintenanceStart: &past, MaintenanceEnd: &future}, role: models.RoleUser, query: "?override_maintenance=true", retryAfter: true},
+		{name: "Open-ended has no Retry-After", target: models.Target{MaintenanceStart: &past}, role: models.RoleUser},
+		{name: "Admin without override refused", target: models.Target{MaintenanceStart: &past, MaintenanceEnd: &future}, role: models.RoleAdmin, retryAfter: true},
+		{name: "Admin override", target: models.Target{MaintenanceStart: &past}, role: models.RoleAdmin, query: "?override_maintenance=true", allowed: true, overridden: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			audit := &recordedAudit{}
+			var allowed bool
+			handler := middleware.OptionalAuth(tokens)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				allowed = maintenanceGate(w, r, &tt.target, audit, logger.New(logger.LevelError, io.Discard))
+			}))
+
+			req := httptest.NewRequest(http.MethodGet, "/api/ws/connect/ssh/"+uuid.NewString()+tt.query, nil)
+			req.Header.Set("Authorization", "Bearer "+signIn(tt.role))
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+
+			if allowed != tt.allowed {
+				t.Fatalf("allowed = %v, want %v", allowed, tt.allowed)
+			}
+			if !allowed {
+				if rec.Code != http.StatusServiceUnavailable {
+					t.Errorf("status = %d, want %d", rec.Code, http.StatusServiceUnavailable)
+				}
+				if got := rec.Header().Get("Retry-After") != ""; got != tt.retryAfter {
+					t.Errorf("Retry-After set = %v, want %v", got, tt.retryAfter)
+				}
+				if tt.target.MaintenanceReason != nil && !strings.Contains(rec.Body.String(), reason) {
+					t.Errorf("body %q doesn't give the reason", rec.Body.String())
+				}
+			}
+			if overridden := len(audit.events) == 1 && audit.events[0] == models.EventTypeMaintenanceOverride; overridden != tt.overridden {
+				t.Errorf("audit events = %v, want override recorded %v", audit.events, tt.overridden)
+			}
+		})
+	}
+}
@@ -1,13 +1,18 @@
 package handlers
 
 import (
+	"context"
 	"net/http"
+	"time"
 
-	"github.com/VanCannon/openpam/gateway/internal/logger"
+	"github.com/VanCannon/openpam/gateway/internal/auth"
 	"github.com/VanCannon/openpam/gateway/internal/middleware"
 	"github.com/VanCannon/openpam/gateway/internal/models"
+	"github.com/VanCannon/openpam/gateway/internal/notice"
 	"github.com/VanCannon/openpam/gateway/internal/repository"
 	"github.com/VanCannon/openpam/gateway/internal/ssh"
+	"github.com/VanCannon/openpam/gateway/internal/wsconn"
+	"github.com/VanCannon/openpam/pkg/logger"
 	"github.com/google/uuid"
 	"github.com/gorilla/websocket"
 )
@@ -18,6 +23,9 @@ type MonitorHandler struct {
 	userRepo  *repository.UserRepository
 	monitor   *ssh.Monitor
 	recorder  *ssh.Recorder
+	sessions  *wsconn.Tracker
+	notices   *notice.Hub
+	reconnect *auth.ReconnectAuthenticator
 	logger    *logger.Logger
 	devMode   bool
 }
@@ -28,6 +36,9 @@ func NewMonitorHandler(
 	userRepo *repository.UserRepository,
 	monitor *ssh.Monitor,
 	recorder *ssh.Recorder,
+	sessions *wsconn.Tracker,
+	notices *notice.Hub,
+	reconnect *auth.ReconnectAuthenticator,
 	log *logger.Logger,
 	devMode bool,
 ) *MonitorHandler {
@@ -36,6 +47,9 @@ func NewMonitorHandler(
 		userRepo:  userRepo,
 		monitor:   monitor,
 		recorder:  recorder,
+		sessions:  sessions,
+		notices:   notices,
+		reconnect: reconnect,
 		logger:    log,
 		devMode:   devMode,
 	}
@@ -118,14 +132,48 @@ func (h *MonitorHandler) HandleMonitor() http.HandlerFunc {
 			}
 		}
 
+		// The user is told they are being watched
+		h.notices.Send(sessionID, notice.Notice{
+			Type:    notice.TypeMonitorJoined,
+			Message: monitorUser + " is monitoring your session",
+			By:      monitorUser,
+		})
+
+		// A gateway restart closes the stream with a token to resume it
+		ctx, untrack := h.sessions.Track(ctx, reconnectToken(ctx, h.reconnect, r.URL.Path, h.logger))
+		defer untrack()
+
+		// Notice the monitor closing the connection
+		go func() {
+			for {
+				if _, _, err := conn.NextReader(); err != nil {
+					untrack()
+					return
+				}
+			}
+		}()
+
 		// Forward data from monitor to WebSocket
-		for data := range dataChan {
-			if err := conn.WriteMessage(websocket.BinaryMessage, data); err != nil {
-				h.logger.Debug("Monitor WebSocket write error", map[string]interface{}{
-					"session_id": sessionID.String(),
-					"error":      err.Error(),
-				})
-				return
+	forward:
+		for {
+			select {
+			case <-ctx.Done():
+				if code, text, ok := wsconn.CloseFor(context.Cause(ctx)); ok {
+					conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(code, text), time.Now().Add(time.Second))
+				}
+				break forward
+			case data, ok := <-dataChan:
+				if !ok {
+					wsconn.WriteClose(conn, wsconn.CloseSessionEnded, wsconn.CloseReason{Reason: wsconn.ReasonSessionEnded})
+					break forward
+				}
+				if err := conn.WriteMessage(websocket.BinaryMessage, data); err != nil {
+					h.logger.Debug("Monitor WebSocket write error", map[string]interface{}{
+						"session_id": sessionID.String(),
+						"error":      err.Error(),
+					})
+					return
+				}
 			}
 		}
 
@@ -0,0 +1,393 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/VanCannon/openpam/gateway/internal/middleware"
+	"github.com/VanCannon/openpam/gateway/internal/models"
+	"github.com/VanCannon/openpam/gateway/internal/oncall"
+	"github.com/VanCannon/openpam/gateway/internal/repository"
+	"github.com/VanCannon/openpam/gateway/internal/validate"
+	"github.com/VanCannon/openpam/pkg/logger"
+	"github.com/google/uuid"
+)
+
+// OnCallHandler handles the mappings of PagerDuty and Opsgenie schedules to
+// the zones their engineers get access to while on call
+type OnCallHandler struct {
+	mappings  *repository.OnCallRepository
+	zones     *repository.ZoneRepository
+	schedules *repository.ScheduleRepository
+	syncer    *oncall.Syncer
+	logger    *logger.Logger
+}
+
+// NewOnCallHandler creates a new on-call handler
+func NewOnCallHandler(mappings *repository.OnCallRepository, zones *repository.ZoneRepository, schedules *repository.ScheduleRepository, syncer *oncall.Syncer, log *logger.Logger) *OnCallHandler {
+	return &OnCallHandler{
+		mappings:  mappings,
+		zones:     zones,
+		schedules: schedules,
+		syncer:    syncer,
+		logger:    log,
+	}
+}
+
+// onCallMappingRequest is the body accepted by create and update
+type onCallMappingRequest struct {
+	Name               string `json:"name"`
+	Provider           string `json:"provider"`
+	ExternalScheduleID string `json:"external_schedule_id"`
+	ZoneID             string `json:"zone_id"`
+	Enabled            *bool  `json:"enabled"`
+	Version            *int   `json:"version"`
+}
+
+// validate normalises the request and returns a client-facing message for the
+// first problem found, or ""
+func (req *onCallMappingRequest) validate() string {
+	req.Name = strings.TrimSpace(req.Name)
+	req.ExternalScheduleID = strings.TrimSpace(req.ExternalScheduleID)
+	if req.Name == "" || req.Provider == "" || req.ExternalScheduleID == "" || req.ZoneID == "" {
+		return "Missing required fields"
+	}
+	if req.Provider != models.OnCallProviderPagerDuty && req.Provider != models.OnCallProviderOpsgenie {
+		return "Invalid provider: must be 'pagerduty' or 'opsgenie'"
+	}
+	if _, err := uuid.Parse(req.ZoneID); err != nil {
+		return "Invalid zone_id"
+	}
+	return ""
+}
+
+// apply copies the request onto a mapping
+func (req *onCallMappingRequest) apply(mapping *models.OnCallMapping) {
+	mapping.Name = req.Name
+	mapping.Provider = req.Provider
+	mapping.ExternalScheduleID = req.ExternalScheduleID
+	mapping.ZoneID = uuid.MustParse(req.ZoneID)
+	if req.Enabled != nil {
+		mapping.Enabled = *req.Enabled
+	}
+}
+
+// onCallMappingResponse is a mapping with the access schedules it maintains
+type onCallMappingResponse struct {
+	*models.OnCallMapping
+	Schedules []models.Schedule `json:"schedules"`
+}
+
+// HandleMappings routes collection requests based on HTTP method
+// Route: /api/v1/oncall/mappings
+func (h *OnCallHandler) HandleMappings() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			h.HandleList()(w, r)
+		case http.MethodPost:
+			h.HandleCreate()(w, r)
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	}
+}
+
+// HandleMapping routes single-mapping requests based on HTTP method
+// Route: /api/v1/oncall/mappings/{id}
+func (h *OnCallHandler) HandleMapping() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			h.HandleGet()(w, r)
+		case http.MethodPut:
+			h.HandleUpdate()(w, r)
+		case http.MethodDelete:
+			h.HandleDelete()(w, r)
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	}
+}
+
+// HandleList lists all on-call mappings with their last sync, and which
+// providers are configured
+func (h *OnCallHandler) HandleList() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		list, err := h.mappings.List(r.Context())
+		if err != nil {
+			h.logger.Error("Failed to list on-call mappings", map[string]interface{}{
+				"error": err.Error(),
+			})
+			http.Error(w, "Failed to list on-call mappings", http.StatusInternalServerError)
+			return
+		}
+
+		if list == nil {
+			list = []*models.OnCallMapping{}
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"mappings": list,
+			"count":    len(list),
+			"providers": map[string]bool{
+				models.OnCallProviderPagerDuty: h.syncer.Configured(models.OnCallProviderPagerDuty),
+				models.OnCallProviderOpsgenie:  h.syncer.Configured(models.OnCallProviderOpsgenie),
+			},
+		})
+	}
+}
+
+// HandleGet retrieves an on-call mapping, its last sync and the schedules it
+// currently maintains
+func (h *OnCallHandler) HandleGet() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+
+		id, err := uuid.Parse(r.PathValue("id"))
+		if err != nil {
+			http.Error(w, "Invalid mapping ID", http.StatusBadRequest)
+			return
+		}
+
+		loc, err := displayLocation(r)
+		if err != nil {
+			http.Error(w, "Invalid tz", http.StatusBadRequest)
+			return
+		}
+
+		mapping, err := h.mappings.GetByID(ctx, id)
+		if err != nil {
+			http.Error(w, "On-call mapping not found", http.StatusNotFound)
+			return
+		}
+
+		schedules, err := h.schedules.ListByOnCallMapping(ctx, id, time.Now())
+		if err != nil {
+			h.logger.Error("Failed to list on-call schedules", map[string]interface{}{
+				"mapping_id": id.String(),
+				"error":      err.Error(),
+			})
+			http.Error(w, "Failed to list on-call schedules", http.StatusInternalServerError)
+			return
+		}
+		if schedules == nil {
+			schedules = []models.Schedule{}
+		}
+		for i := range schedules {
+			schedules[i].In(loc)
+		}
+
+		setETag(w, mapping.Version)
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(onCallMappingResponse{OnCallMapping: mapping, Schedules: schedules})
+	}
+}
+
+// HandleCreate creates an on-call mapping, synced on the next pass
+func (h *OnCallHandler) HandleCreate() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+
+		var req onCallMappingRequest
+		if !validate.Decode(w, r, &req) {
+			return
+		}
+
+		if msg := req.validate(); msg != "" {
+			http.Error(w, msg, http.StatusBadRequest)
+			return
+		}
+		if _, err := h.zones.GetByID(ctx, uuid.MustParse(req.ZoneID)); err != nil {
+			http.Error(w, "Zone not found", http.StatusBadRequest)
+			return
+		}
+
+		mapping := &models.OnCallMapping{Enabled: true}
+		if userID, err := uuid.Parse(middleware.GetUserID(ctx)); err == nil {
+			mapping.CreatedBy = &userID
+		}
+		req.apply(mapping)
+
+		if err := h.mappings.Create(ctx, mapping); err != nil {
+			h.logger.Error("Failed to create on-call mapping", map[string]interface{}{
+				"error": err.Error(),
+			})
+			http.Error(w, "Failed to create on-call mapping", http.StatusInternalServerError)
+			return
+		}
+
+		h.logger.Info("On-call mapping created", map[string]interface{}{
+			"mapping_id":           mapping.ID.String(),
+			"provider":             mapping.Provider,
+			"external_schedule_id": mapping.ExternalScheduleID,
+			"zone_id":              mapping.ZoneID.String(),
+			"created_by":           middleware.GetUserEmail(ctx),
+		})
+
+		setETag(w, mapping.Version)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(mapping)
+	}
+}
+
+// HandleUpdate replaces an on-call mapping. Disabling it revokes the schedules
+// it maintains; other changes apply on the next sync, which is due right away.
+func (h *OnCallHandler) HandleUpdate() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+
+		id, err := uuid.Parse(r.PathValue("id"))
+		if err != nil {
+			http.Error(w, "Invalid mapping ID", http.StatusBadRequest)
+			return
+		}
+
+		var req onCallMappingRequest
+		if !validate.Decode(w, r, &req) {
+			return
+		}
+
+		version, ok := requireVersion(w, r, req.Version)
+		if !ok {
+			return
+		}
+
+		if msg := req.validate(); msg != "" {
+			http.Error(w, msg, http.StatusBadRequest)
+			return
+		}
+
+		mapping, err := h.mappings.GetByID(ctx, id)
+		if err != nil {
+			http.Error(w, "On-call mapping not found", http.StatusNotFound)
+			return
+		}
+
+		if mapping.Version != version {
+			writeVersionConflict(w, mapping.Version, mapping)
+			return
+		}
+
+		if req.ZoneID != mapping.ZoneID.String() {
+			if _, err := h.zones.GetByID(ctx, uuid.MustParse(req.ZoneID)); err != nil {
+				http.Error(w, "Zone not found", http.StatusBadRequest)
+				return
+			}
+		}
+
+		req.apply(mapping)
+		if err := h.mappings.Update(ctx, mapping); err != nil {
+			if errors.Is(err, repository.ErrVersionConflict) {
+				if current, err := h.mappings.GetByID(ctx, id); err == nil {
+					writeVersionConflict(w, current.Version, current)
+					return
+				}
+			}
+			h.logger.Error("Failed to update on-call mapping", map[string]interface{}{
+				"error": err.Error(),
+			})
+			http.Error(w, "Failed to update on-call mapping", http.StatusInternalServerError)
+			return
+		}
+
+		if !mapping.Enabled {
+			h.release(r, mapping.ID, "On-call mapping disabled")
+		}
+
+		setETag(w, mapping.Version)
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(mapping)
+	}
+}
+
+// HandleDelete deletes an on-call mapping and revokes the schedules it maintains
+func (h *OnCallHandler) HandleDelete() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, err := uuid.Parse(r.PathValue("id"))
+		if err != nil {
+			http.Error(w, "Invalid mapping ID", http.StatusBadRequest)
+			return
+		}
+
+		if err := h.mappings.Delete(r.Context(), id); err != nil {
+			h.logger.Error("Failed to delete on-call mapping", map[string]interface{}{
+				"error": err.Error(),
+			})
+			http.Error(w, "On-call mapping not found", http.StatusNotFound)
+			return
+		}
+
+		h.release(r, id, "On-call mapping deleted")
+
+		h.logger.Info("On-call mapping deleted", map[string]interface{}{
+			"mapping_id": id.String(),
+			"deleted_by": middleware.GetUserEmail(r.Context()),
+		})
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// HandleSync syncs an enabled mapping right away and returns what changed
+// Route: POST /api/v1/oncall/mappings/{id}/sync
+func (h *OnCallHandler) HandleSync() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+
+		id, err := uuid.Parse(r.PathValue("id"))
+		if err != nil {
+			http.Error(w, "Invalid mapping ID", http.StatusBadRequest)
+			return
+		}
+
+		mapping, err := h.mappings.GetByID(ctx, id)
+		if err != nil {
+			http.Error(w, "On-call mapping not found", http.StatusNotFound)
+			return
+		}
+		if !mapping.Enabled {
+			http.Error(w, "On-call mapping is disabled", http.StatusConflict)
+			return
+		}
+
+		result, err := h.syncer.Sync(ctx, mapping, time.Now())
+		if err != nil {
+			http.Error(w, "On-call sync failed: "+err.Error(), http.StatusBadGateway)
+			return
+		}
+
+		h.logger.Info("On-call mapping synced", map[string]interface{}{
+			"mapping_id":   id.String(),
+			"requested_by": middleware.GetUserEmail(ctx),
+		})
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(result)
+	}
+}
+
+// release revokes the schedules of a mapping that no longer grants access.
+// Failures are logged; the schedules still end with their shifts.
+func (h *OnCallHandler) release(r *http.Request, mappingID uuid.UUID, reason string) {
+	revoked, err := h.syncer.Release(r.Context(), mappingID, reason)
+	if err != nil {
+		h.logger.Error("Failed to revoke on-call schedules", map[string]interface{}{
+			"mapping_id": mappingID.String(),
+			"error":      err.Error(),
+		})
+		return
+	}
+	if revoked > 0 {
+		h.logger.Info("On-call schedules revoked", map[string]interface{}{
+			"mapping_id": mappingID.String(),
+			"revoked":    revoked,
+			"reason":     reason,
+		})
+	}
+}
@@ -0,0 +1,459 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/VanCannon/openpam/gateway/internal/models"
+	"github.com/VanCannon/openpam/gateway/internal/policy"
+	"github.com/VanCannon/openpam/gateway/internal/repository"
+	"github.com/VanCannon/openpam/gateway/internal/validate"
+	"github.com/VanCannon/openpam/pkg/logger"
+	"github.com/google/uuid"
+)
+
+// PolicyDraftHandler handles drafting credential rule changes, trying them out
+// with dry-run evaluations and publishing them
+type PolicyDraftHandler struct {
+	draftRepo    *repository.PolicyDraftRepository
+	userRepo     *repository.UserRepository
+	targetRepo   *repository.TargetRepository
+	credRepo     *repository.CredentialRepository
+	groupRepo    *repository.GroupRepository
+	scheduleRepo *repository.ScheduleRepository
+	live         *policy.Engine
+	auditRepo    systemAuditStore
+	logger       *logger.Logger
+}
+
+// NewPolicyDraftHandler creates a new policy draft handler. live is the engine
+// evaluating the published rules.
+func NewPolicyDraftHandler(
+	draftRepo *repository.PolicyDraftRepository,
+	userRepo *repository.UserRepository,
+	targetRepo *repository.TargetRepository,
+	credRepo *repository.CredentialRepository,
+	groupRepo *repository.GroupRepository,
+	scheduleRepo *repository.ScheduleRepository,
+	live *policy.Engine,
+	auditRepo *repository.SystemAuditLogRepository,
+	log *logger.Logger,
+) *PolicyDraftHandler {
+	return &PolicyDraftHandler{
+		draftRepo:    draftRepo,
+		userRepo:     userRepo,
+		targetRepo:   targetRepo,
+		credRepo:     credRepo,
+		groupRepo:    groupRepo,
+		scheduleRepo: scheduleRepo,
+		live:         live,
+		auditRepo:    auditRepo,
+		logger:       log,
+	}
+}
+
+// HandleList lists drafts. Filter by status with ?status=.
+// Route: GET /api/v1/policy-drafts
+func (h *PolicyDraftHandler) HandleList() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		drafts, err := h.draftRepo.List(r.Context(), r.URL.Query().Get("status"))
+		if err != nil {
+			h.logger.Error("Failed to list policy drafts", map[string]interface{}{
+				"error": err.Error(),
+			})
+			http.Error(w, "Failed to list policy drafts", http.StatusInternalServerError)
+			return
+		}
+
+		if drafts == nil {
+			drafts = []*models.PolicyDraft{}
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"drafts": drafts,
+			"count":  len(drafts),
+		})
+	}
+}
+
+// HandleCreate starts a draft from the live credential rules
+// Route: POST /api/v1/policy-drafts
+func (h *PolicyDraftHandler) HandleCreate() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Name        string  `json:"name"`
+			Description *string `json:"description"`
+		}
+		if !validate.Decode(w, r, &req) {
+			return
+		}
+		if req.Name == "" {
+			http.Error(w, "Name is required", http.StatusBadRequest)
+			return
+		}
+
+		draft := &models.PolicyDraft{Name: req.Name, Description: req.Description}
+		if err := h.draftRepo.Create(r.Context(), draft); err != nil {
+			h.logger.Error("Failed to create policy draft", map[string]interface{}{
+				"error": err.Error(),
+			})
+			http.Error(w, "Failed to create policy draft", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(draft)
+	}
+}
+
+// HandleGet retrieves a draft
+// Route: GET /api/v1/policy-drafts/{id}
+func (h *PolicyDraftHandler) HandleGet() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		draft, ok := h.load(w, r)
+		if !ok {
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(draft)
+	}
+}
+
+// draftRuleRequest is a rule of a draft. Rules keep their ID, so publishing
+// updates the live rule; rules without one are created.
+type draftRuleRequest struct {
+	ID *uuid.UUID `json:"id"`
+	credentialRuleRequest
+}
+
+// HandleUpdate replaces an open draft's name, description and rules
+// Route: PUT /api/v1/policy-drafts/{id}
+func (h *PolicyDraftHandler) HandleUpdate() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		draft, ok := h.load(w, r)
+		if !ok {
+			return
+		}
+
+		var req struct {
+			Name        string             `json:"name"`
+			Description *string            `json:"description"`
+			Rules       []draftRuleRequest `json:"rules"`
+		}
+		if !validate.Decode(w, r, &req) {
+			return
+		}
+		if req.Name == "" {
+			http.Error(w, "Name is required", http.StatusBadRequest)
+			return
+		}
+
+		rules := make(models.DraftRules, 0, len(req.Rules))
+		seen := make(map[uuid.UUID]bool)
+		for i := range req.Rules {
+			ruleReq := &req.Rules[i]
+			if msg := ruleReq.validate(); msg != "" {
+				http.Error(w, fmt.Sprintf("Rule %d: %s", i+1, msg), http.StatusBadRequest)
+				return
+			}
+
+			rule := &models.CredentialRule{ID: uuid.New(), Enabled: true}
+			if ruleReq.ID != nil {
+				rule.ID = *ruleReq.ID
+			}
+			if seen[rule.ID] {
+				http.Error(w, fmt.Sprintf("Rule %d: duplicate id", i+1), http.StatusBadRequest)
+				return
+			}
+			seen[rule.ID] = true
+
+			ruleReq.apply(rule)
+			rules = append(rules, rule)
+		}
+
+		draft.Name = req.Name
+		draft.Description = req.Description
+		draft.Rules = rules
+		if err := h.draftRepo.Update(r.Context(), draft); err != nil {
+			if errors.Is(err, repository.ErrDraftClosed) {
+				http.Error(w, "Policy draft is no longer open", http.StatusConflict)
+				return
+			}
+			h.logger.Error("Failed to update policy draft", map[string]interface{}{
+				"draft_id": draft.ID.String(),
+				"error":    err.Error(),
+			})
+			http.Error(w, "Failed to update policy draft", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(draft)
+	}
+}
+
+// HandleDiscard closes an open draft without publishing it
+// Route: DELETE /api/v1/policy-drafts/{id}
+func (h *PolicyDraftHandler) HandleDiscard() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		draft, ok := h.load(w, r)
+		if !ok {
+			return
+		}
+
+		if err := h.draftRepo.Discard(r.Context(), draft.ID); err != nil {
+			if errors.Is(err, repository.ErrDraftClosed) {
+				http.Error(w, "Policy draft is no longer open", http.StatusConflict)
+				return
+			}
+			h.logger.Error("Failed to discard policy draft", map[string]interface{}{
+				"draft_id": draft.ID.String(),
+				"error":    err.Error(),
+			})
+			http.Error(w, "Failed to discard policy draft", http.StatusInternalServerError)
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// HandlePublish makes a draft's rules the live credential rules
+// Route: POST /api/v1/policy-drafts/{id}/publish
+func (h *PolicyDraftHandler) HandlePublish() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, err := uuid.Parse(r.PathValue("id"))
+		if err != nil {
+			http.Error(w, "Invalid draft ID", http.StatusBadRequest)
+			return
+		}
+
+		draft, err := h.draftRepo.Publish(r.Context(), id)
+		if err != nil {
+			switch {
+			case errors.Is(err, repository.ErrDraftClosed):
+				http.Error(w, "Policy draft is no longer open", http.StatusConflict)
+			case errors.Is(err, repository.ErrDraftStale):
+				http.Error(w, "Credential rules changed since the draft was started; start a new draft", http.StatusConflict)
+			default:
+				h.logger.Error("Failed to publish policy draft", map[string]interface{}{
+					"draft_id": id.String(),
+					"error":    err.Error(),
+				})
+				http.Error(w, "Failed to publish policy draft", http.StatusInternalServerError)
+			}
+			return
+		}
+
+		userID, ip := requester(r)
+		details := map[string]interface{}{
+			"draft_id":   draft.ID.String(),
+			"draft_name": draft.Name,
+			"rule_count": len(draft.Rules),
+		}
+		if err := h.auditRepo.CreateSimple(r.Context(), models.EventTypePolicyDraftPublished, userID, "publish", models.AuditStatusSuccess, &ip, details); err != nil {
+			h.logger.Error("Failed to create system audit log", map[string]interface{}{
+				"error": err.Error(),
+			})
+		}
+
+		h.logger.Info("Policy draft published", map[string]interface{}{
+			"draft_id": draft.ID.String(),
+			"rules":    len(draft.Rules),
+		})
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(draft)
+	}
+}
+
+// evaluationRequest asks whether a user could reach a target at a time
+type evaluationRequest struct {
+	UserID   uuid.UUID  `json:"user_id"`
+	TargetID uuid.UUID  `json:"target_id"`
+	At       *time.Time `json:"at"`
+}
+
+// Validate checks that the user and target are given
+func (req *evaluationRequest) Validate() validate.Errors {
+	var errs validate.Errors
+	errs.Check(req.UserID != uuid.Nil, "user_id", "is required")
+	errs.Check(req.TargetID != uuid.Nil, "target_id", "is required")
+	return errs
+}
+
+// evaluation is what a dry run needs: the subject, the target with its
+// credentials, and whether the user has a schedule window at the time
+type evaluation struct {
+	subject  policy.Subject
+	target   *models.Target
+	creds    []*models.Credential
+	at       time.Time
+	inWindow bool
+}
+
+// prepare loads what an evaluation request refers to, responding with an
+// error if something is missing
+func (h *PolicyDraftHandler) prepare(w http.ResponseWriter, r *http.Request) (*evaluation, bool) {
+	ctx := r.Context()
+
+	var req evaluationRequest
+	if !validate.Decode(w, r, &req) {
+		return nil, false
+	}
+
+	user, err := h.userRepo.GetByID(ctx, req.UserID)
+	if err != nil {
+		http.Error(w, "User not found", http.StatusNotFound)
+		return nil, false
+	}
+	target, err := h.targetRepo.GetByID(ctx, req.TargetID)
+	if err != nil {
+		http.Error(w, "Target not found", http.StatusNotFound)
+		return nil, false
+	}
+
+	creds, err := h.credRepo.GetByTargetID(ctx, target.ID)
+	if err != nil {
+		h.logger.Error("Failed to list credentials", map[string]interface{}{
+			"error": err.Error(),
+		})
+		http.Error(w, "Failed to evaluate policy", http.StatusInternalServerError)
+		return nil, false
+	}
+
+	ev := &evaluation{
+		subject: policy.Subject{UserID: user.ID, Role: user.Role, Email: user.Email, Attributes: user.Attributes},
+		target:  target,
+		creds:   creds,
+		at:      time.Now(),
+	}
+	if req.At != nil {
+		ev.at = *req.At
+	}
+
+	ev.inWindow, err = h.scheduleRepo.HasActiveWindow(ctx, user.ID, target.ID, ev.at)
+	if err != nil {
+		h.logger.Error("Failed to check schedule window", map[string]interface{}{
+			"error": err.Error(),
+		})
+		http.Error(w, "Failed to evaluate policy", http.StatusInternalServerError)
+		return nil, false
+	}
+
+	return ev, true
+}
+
+// explain runs an evaluation through an engine, responding with an error if it fails
+func (h *PolicyDraftHandler) explain(w http.ResponseWriter, r *http.Request, engine *policy.Engine, ev *evaluation) (*policy.Trace, bool) {
+	trace, err := engine.Explain(r.Context(), ev.subject, ev.target, ev.creds, ev.at)
+	if err != nil {
+		h.logger.Error("Failed to evaluate policy", map[string]interface{}{
+			"target_id": ev.target.ID.String(),
+			"error":     err.Error(),
+		})
+		http.Error(w, "Failed to evaluate policy", http.StatusInternalServerError)
+		return nil, false
+	}
+	return trace, true
+}
+
+// HandleEvaluate evaluates a user's access to a target at a time under the
+// live credential rules, with a trace of the rules that decided it
+// Route: POST /api/v1/policy/evaluate
+func (h *PolicyDraftHandler) HandleEvaluate() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ev, ok := h.prepare(w, r)
+		if !ok {
+			return
+		}
+
+		live, ok := h.explain(w, r, h.live, ev)
+		if !ok {
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"live":            live,
+			"schedule_window": ev.inWindow,
+		})
+	}
+}
+
+// HandleEvaluateDraft evaluates a user's access to a target at a time under a
+// draft's rules and under the live ones, so the effect of publishing shows
+// Route: POST /api/v1/policy-drafts/{id}/evaluate
+func (h *PolicyDraftHandler) HandleEvaluateDraft() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		draft, ok := h.load(w, r)
+		if !ok {
+			return
+		}
+		ev, ok := h.prepare(w, r)
+		if !ok {
+			return
+		}
+
+		engine := policy.NewEngine(policy.RuleSet(draft.Rules), h.logger)
+		engine.ResolveGroups(h.groupRepo)
+		engine.ResolveUsers(h.userRepo)
+
+		proposed, ok := h.explain(w, r, engine, ev)
+		if !ok {
+			return
+		}
+		live, ok := h.explain(w, r, h.live, ev)
+		if !ok {
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"draft":           proposed,
+			"live":            live,
+			"changed":         changedAccess(proposed, live),
+			"schedule_window": ev.inWindow,
+		})
+	}
+}
+
+// changedAccess reports whether two traces allow different credentials
+func changedAccess(a, b *policy.Trace) bool {
+	if a.Allowed != b.Allowed {
+		return true
+	}
+	allowed := make(map[uuid.UUID]bool)
+	for _, ct := range b.Credentials {
+		allowed[ct.CredentialID] = ct.Allowed
+	}
+	for _, ct := range a.Credentials {
+		if allowed[ct.CredentialID] != ct.Allowed {
+			return true
+		}
+	}
+	return false
+}
+
+// load resolves the draft in the path, responding with an error if it doesn't exist
+func (h *PolicyDraftHandler) load(w http.ResponseWriter, r *http.Request) (*models.PolicyDraft, bool) {
+	id, err := uuid.Parse(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, "Invalid draft ID", http.StatusBadRequest)
+		return nil, false
+	}
+
+	draft, err := h.draftRepo.GetByID(r.Context(), id)
+	if err != nil {
+		http.Error(w, "Policy draft not found", http.StatusNotFound)
+		return nil, false
+	}
+
+	return draft, true
+}
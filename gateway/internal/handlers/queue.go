@@ -0,0 +1,208 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/VanCannon/openpam/gateway/internal/middleware"
+	"github.com/VanCannon/openpam/gateway/internal/models"
+	"github.com/VanCannon/openpam/gateway/internal/queue"
+	"github.com/VanCannon/openpam/gateway/internal/repository"
+	"github.com/VanCannon/openpam/gateway/internal/settings"
+	"github.com/VanCannon/openpam/pkg/logger"
+	"github.com/google/uuid"
+)
+
+// QueueHandler streams the session queues of targets at their session limit
+type QueueHandler struct {
+	queue      *queue.Queue
+	targetRepo *repository.TargetRepository
+	heartbeat  time.Duration
+	logger     *logger.Logger
+}
+
+// NewQueueHandler creates a new queue handler
+func NewQueueHandler(q *queue.Queue, targetRepo *repository.TargetRepository, heartbeat time.Duration, log *logger.Logger) *QueueHandler {
+	if heartbeat <= 0 {
+		heartbeat = 15 * time.Second
+	}
+
+	return &QueueHandler{
+		queue:      q,
+		targetRepo: targetRepo,
+		heartbeat:  heartbeat,
+		logger:     log,
+	}
+}
+
+// HandleStream streams a target's queue as text/event-stream, with a "queue"
+// event each time it changes. Users see their own place in line; admins see
+// everyone waiting.
+// Route: GET /api/v1/targets/{id}/queue
+func (h *QueueHandler) HandleStream() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		rc := http.NewResponseController(w)
+
+		targetID, err := uuid.Parse(r.PathValue("id"))
+		if err != nil {
+			http.Error(w, "Invalid target ID", http.StatusBadRequest)
+			return
+		}
+		if _, err := h.targetRepo.GetByID(ctx, targetID); err != nil {
+			http.Error(w, "Target not found", http.StatusNotFound)
+			return
+		}
+
+		admin := middleware.GetUserRole(ctx) == models.RoleAdmin
+		userID, _ := uuid.Parse(middleware.GetUserID(ctx))
+
+		// The stream outlives the server's write timeout
+		rc.SetWriteDeadline(time.Time{})
+
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("Cache-Control", "no-cache")
+		w.Header().Set("Connection", "keep-alive")
+		w.Header().Set("X-Accel-Buffering", "no") // Disable proxy buffering
+		w.WriteHeader(http.StatusOK)
+
+		fmt.Fprintf(w, "retry: 3000\n\n")
+		if err := rc.Flush(); err != nil {
+			h.logger.Error("Queue stream not supported by response writer", map[string]interface{}{
+				"error": err.Error(),
+			})
+			return
+		}
+
+		ticker := time.NewTicker(h.heartbeat)
+		defer ticker.Stop()
+
+		for {
+			// Watch before reading so no change in between is missed
+			changed := h.queue.Changed(targetID)
+			if err := writeQueueStatus(w, h.queue.Status(targetID), admin, userID); err != nil {
+				return
+			}
+			if err := rc.Flush(); err != nil {
+				return
+			}
+
+		wait:
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case <-ticker.C:
+					if _, err := fmt.Fprint(w, ": keep-alive\n\n"); err != nil {
+						return
+					}
+					if err := rc.Flush(); err != nil {
+						return
+					}
+				case <-changed:
+					break wait
+				}
+			}
+		}
+	}
+}
+
+// queueEvent is a target's queue as a user sees it
+type queueEvent struct {
+	TargetID uuid.UUID       `json:"target_id"`
+	Running  int             `json:"running"`
+	Waiting  int             `json:"waiting"`
+	Tickets  []*queue.Ticket `json:"tickets"` // The user's own, or everyone's for admins
+}
+
+// writeQueueStatus writes one queue event. The payload is compact JSON, so it
+// always fits on a single data line.
+func writeQueueStatus(w http.ResponseWriter, status *queue.Status, admin bool, userID uuid.UUID) error {
+	event := queueEvent{
+		TargetID: status.TargetID,
+		Running:  status.Running,
+		Waiting:  len(status.Waiting),
+		Tickets:  []*queue.Ticket{},
+	}
+	for _, ticket := range status.Waiting {
+		if admin || ticket.UserID == userID {
+			event.Tickets = append(event.Tickets, ticket)
+		}
+	}
+
+	data, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "event: queue\ndata: %s\n\n", data)
+	return err
+}
+
+// acquireSlot takes a session slot on the target, waiting in its queue when
+// the settings allow. Admins may jump the queue with queue_jump=true; jumps
+// are audited. On failure it has written the response.
+func acquireSlot(w http.ResponseWriter, r *http.Request, q *queue.Queue, target *models.Target, eff *settings.Effective, audit *repository.SystemAuditLogRepository, log *logger.Logger) (func(), bool) {
+	ctx := r.Context()
+	userEmail := middleware.GetUserEmail(ctx)
+	userID, _ := uuid.Parse(middleware.GetUserID(ctx))
+
+	req := queue.Request{
+		TargetID:  target.ID,
+		UserID:    userID,
+		UserEmail: userEmail,
+		Limit:     eff.MaxSessions,
+		MaxWait:   time.Duration(eff.QueueWait) * time.Second,
+		Jump:      middleware.GetUserRole(ctx) == models.RoleAdmin && r.URL.Query().Get("queue_jump") == "true",
+	}
+	if req.MaxWait > 0 {
+		// Waiting may outlast the server's write timeout
+		http.NewResponseController(w).SetWriteDeadline(time.Time{})
+	}
+
+	start := time.Now()
+	release, err := q.Acquire(ctx, req)
+	switch {
+	case errors.Is(err, queue.ErrBusy), errors.Is(err, queue.ErrWaitExceeded):
+		log.Warn("Session refused at the target's session limit", map[string]interface{}{
+			"target_id":    target.ID.String(),
+			"user":         userEmail,
+			"max_sessions": eff.MaxSessions,
+			"waited":       time.Since(start).String(),
+		})
+		msg := "Target has reached its session limit"
+		if errors.Is(err, queue.ErrWaitExceeded) {
+			msg = "No session slot freed up in time"
+		}
+		http.Error(w, msg, http.StatusServiceUnavailable)
+		return nil, false
+	case err != nil:
+		// The client gave up waiting
+		return nil, false
+	}
+
+	if waited := time.Since(start); waited >= time.Second {
+		log.Info("Session slot freed up for queued user", map[string]interface{}{
+			"target_id": target.ID.String(),
+			"user":      userEmail,
+			"waited":    waited.String(),
+		})
+	}
+
+	if req.Jump && eff.MaxSessions > 0 {
+		auditUserID, ip := requester(r)
+		details := map[string]interface{}{
+			"target_id":   target.ID.String(),
+			"target_name": target.Name,
+		}
+		if err := audit.CreateSimple(ctx, models.EventTypeSessionQueueJumped, auditUserID, "jump", "success", &ip, details); err != nil {
+			log.Error("Failed to create system audit log", map[string]interface{}{
+				"error": err.Error(),
+			})
+		}
+	}
+
+	return release, true
+}
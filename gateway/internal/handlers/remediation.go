@@ -0,0 +1,52 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/VanCannon/openpam/gateway/internal/repository"
+	"github.com/VanCannon/openpam/pkg/logger"
+	"github.com/google/uuid"
+)
+
+// RemediationHandler serves the AWX jobs launched after sessions
+type RemediationHandler struct {
+	remediationRepo *repository.RemediationRepository
+	logger          *logger.Logger
+}
+
+// NewRemediationHandler creates a new remediation handler
+func NewRemediationHandler(remediationRepo *repository.RemediationRepository, log *logger.Logger) *RemediationHandler {
+	return &RemediationHandler{
+		remediationRepo: remediationRepo,
+		logger:          log,
+	}
+}
+
+// HandleListBySession lists the remediation jobs launched for a session and their results
+// Route: GET /api/v1/audit-logs/{id}/remediations
+func (h *RemediationHandler) HandleListBySession() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, err := uuid.Parse(r.PathValue("id"))
+		if err != nil {
+			http.Error(w, "Invalid audit log ID", http.StatusBadRequest)
+			return
+		}
+
+		runs, err := h.remediationRepo.ListBySession(r.Context(), id)
+		if err != nil {
+			h.logger.Error("Failed to list remediation runs", map[string]interface{}{
+				"audit_log_id": id.String(),
+				"error":        err.Error(),
+			})
+			http.Error(w, "Failed to list remediation runs", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"remediations": runs,
+			"count":        len(runs),
+		})
+	}
+}
@@ -0,0 +1,386 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/mail"
+	"strconv"
+	"time"
+
+	"github.com/VanCannon/openpam/gateway/internal/middleware"
+	"github.com/VanCannon/openpam/gateway/internal/models"
+	"github.com/VanCannon/openpam/gateway/internal/reports"
+	"github.com/VanCannon/openpam/gateway/internal/repository"
+	"github.com/VanCannon/openpam/gateway/internal/validate"
+	"github.com/VanCannon/openpam/pkg/logger"
+	"github.com/google/uuid"
+)
+
+// ReportHandler handles scheduled report requests
+type ReportHandler struct {
+	reportRepo *repository.ReportRepository
+	logger     *logger.Logger
+}
+
+// NewReportHandler creates a new report handler
+func NewReportHandler(reportRepo *repository.ReportRepository, log *logger.Logger) *ReportHandler {
+	return &ReportHandler{
+		reportRepo: reportRepo,
+		logger:     log,
+	}
+}
+
+// reportRequest is the body accepted by create and update
+type reportRequest struct {
+	Name           string               `json:"name"`
+	ReportType     string               `json:"report_type"`
+	Format         string               `json:"format"`
+	CronExpression string               `json:"cron_expression"`
+	Timezone       string               `json:"timezone"`
+	Filters        models.ReportFilters `json:"filters"`
+	Recipients     []string             `json:"recipients"`
+	Enabled        *bool                `json:"enabled"`
+	Version        *int                 `json:"version"`
+}
+
+// validate normalises the request and returns a client-facing message for the
+// first problem found, or ""
+func (req *reportRequest) validate() string {
+	if req.Name == "" || req.ReportType == "" || req.CronExpression == "" || len(req.Recipients) == 0 {
+		return "Missing required fields"
+	}
+	if !reports.ValidType(req.ReportType) {
+		return "Invalid report_type: must be 'access_review', 'session_activity' or 'system_audit'"
+	}
+	if req.Format == "" {
+		req.Format = models.ReportFormatCSV
+	}
+	if req.Format != models.ReportFormatCSV && req.Format != models.ReportFormatPDF {
+		return "Invalid format: must be 'csv' or 'pdf'"
+	}
+	if _, err := reports.ParseCron(req.CronExpression); err != nil {
+		return "Invalid cron_expression: " + err.Error()
+	}
+	if req.Timezone == "" {
+		req.Timezone = "UTC"
+	}
+	if _, err := time.LoadLocation(req.Timezone); err != nil {
+		return "Invalid timezone"
+	}
+	for i, recipient := range req.Recipients {
+		addr, err := mail.ParseAddress(recipient)
+		if err != nil {
+			return "Invalid recipient: " + recipient
+		}
+		req.Recipients[i] = addr.Address
+	}
+	if req.Filters.Lookback != "" {
+		if d, err := time.ParseDuration(req.Filters.Lookback); err != nil || d <= 0 {
+			return "Invalid filters.lookback: must be a positive duration such as '168h'"
+		}
+	}
+	return ""
+}
+
+// apply copies the request onto a report and schedules its next run
+func (req *reportRequest) apply(report *models.ScheduledReport) error {
+	report.Name = req.Name
+	report.ReportType = req.ReportType
+	report.Format = req.Format
+	report.CronExpression = req.CronExpression
+	report.Timezone = req.Timezone
+	report.Filters = req.Filters
+	report.Recipients = req.Recipients
+	if req.Enabled != nil {
+		report.Enabled = *req.Enabled
+	}
+
+	report.NextRunAt = nil
+	if report.Enabled {
+		next, err := reports.NextRun(report, time.Now())
+		if err != nil {
+			return err
+		}
+		report.NextRunAt = next
+	}
+	return nil
+}
+
+// HandleReports routes collection requests based on HTTP method
+// Route: /api/v1/reports
+func (h *ReportHandler) HandleReports() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			h.HandleList()(w, r)
+		case http.MethodPost:
+			h.HandleCreate()(w, r)
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	}
+}
+
+// HandleReport routes single-report requests based on HTTP method
+// Route: /api/v1/reports/{id}
+func (h *ReportHandler) HandleReport() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			h.HandleGet()(w, r)
+		case http.MethodPut:
+			h.HandleUpdate()(w, r)
+		case http.MethodDelete:
+			h.HandleDelete()(w, r)
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	}
+}
+
+// HandleList lists all scheduled reports
+func (h *ReportHandler) HandleList() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		list, err := h.reportRepo.List(r.Context())
+		if err != nil {
+			h.logger.Error("Failed to list scheduled reports", map[string]interface{}{
+				"error": err.Error(),
+			})
+			http.Error(w, "Failed to list scheduled reports", http.StatusInternalServerError)
+			return
+		}
+
+		if list == nil {
+			list = []*models.ScheduledReport{}
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"reports": list,
+			"count":   len(list),
+		})
+	}
+}
+
+// HandleGet retrieves a scheduled report
+func (h *ReportHandler) HandleGet() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, err := uuid.Parse(r.PathValue("id"))
+		if err != nil {
+			http.Error(w, "Invalid report ID", http.StatusBadRequest)
+			return
+		}
+
+		report, err := h.reportRepo.GetByID(r.Context(), id)
+		if err != nil {
+			http.Error(w, "Scheduled report not found", http.StatusNotFound)
+			return
+		}
+
+		setETag(w, report.Version)
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(report)
+	}
+}
+
+// HandleCreate creates a new scheduled report owned by the caller
+func (h *ReportHandler) HandleCreate() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+
+		var req reportRequest
+		if !validate.Decode(w, r, &req) {
+			return
+		}
+
+		if msg := req.validate(); msg != "" {
+			http.Error(w, msg, http.StatusBadRequest)
+			return
+		}
+
+		report := &models.ScheduledReport{Enabled: true}
+		if userID, err := uuid.Parse(middleware.GetUserID(ctx)); err == nil {
+			report.CreatedBy = &userID
+		}
+		if err := req.apply(report); err != nil {
+			http.Error(w, "Invalid cron_expression: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		if err := h.reportRepo.Create(ctx, report); err != nil {
+			h.logger.Error("Failed to create scheduled report", map[string]interface{}{
+				"error": err.Error(),
+			})
+			http.Error(w, "Failed to create scheduled report", http.StatusInternalServerError)
+			return
+		}
+
+		h.logger.Info("Scheduled report created", map[string]interface{}{
+			"report_id":   report.ID.String(),
+			"name":        report.Name,
+			"report_type": report.ReportType,
+			"created_by":  middleware.GetUserEmail(ctx),
+		})
+
+		setETag(w, report.Version)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(report)
+	}
+}
+
+// HandleUpdate replaces an existing scheduled report
+func (h *ReportHandler) HandleUpdate() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+
+		id, err := uuid.Parse(r.PathValue("id"))
+		if err != nil {
+			http.Error(w, "Invalid report ID", http.StatusBadRequest)
+			return
+		}
+
+		var req reportRequest
+		if !validate.Decode(w, r, &req) {
+			return
+		}
+
+		version, ok := requireVersion(w, r, req.Version)
+		if !ok {
+			return
+		}
+
+		if msg := req.validate(); msg != "" {
+			http.Error(w, msg, http.StatusBadRequest)
+			return
+		}
+
+		report, err := h.reportRepo.GetByID(ctx, id)
+		if err != nil {
+			http.Error(w, "Scheduled report not found", http.StatusNotFound)
+			return
+		}
+
+		if report.Version != version {
+			writeVersionConflict(w, report.Version, report)
+			return
+		}
+
+		if err := req.apply(report); err != nil {
+			http.Error(w, "Invalid cron_expression: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		if err := h.reportRepo.Update(ctx, report); err != nil {
+			if errors.Is(err, repository.ErrVersionConflict) {
+				if current, err := h.reportRepo.GetByID(ctx, id); err == nil {
+					writeVersionConflict(w, current.Version, current)
+					return
+				}
+			}
+			h.logger.Error("Failed to update scheduled report", map[string]interface{}{
+				"error": err.Error(),
+			})
+			http.Error(w, "Failed to update scheduled report", http.StatusInternalServerError)
+			return
+		}
+
+		setETag(w, report.Version)
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(report)
+	}
+}
+
+// HandleDelete deletes a scheduled report and its run history
+func (h *ReportHandler) HandleDelete() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, err := uuid.Parse(r.PathValue("id"))
+		if err != nil {
+			http.Error(w, "Invalid report ID", http.StatusBadRequest)
+			return
+		}
+
+		if err := h.reportRepo.Delete(r.Context(), id); err != nil {
+			h.logger.Error("Failed to delete scheduled report", map[string]interface{}{
+				"error": err.Error(),
+			})
+			http.Error(w, "Scheduled report not found", http.StatusNotFound)
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// HandleRunNow queues an immediate run. The report is picked up by the next
+// scheduler pass on any replica.
+// Route: POST /api/v1/reports/{id}/run
+func (h *ReportHandler) HandleRunNow() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, err := uuid.Parse(r.PathValue("id"))
+		if err != nil {
+			http.Error(w, "Invalid report ID", http.StatusBadRequest)
+			return
+		}
+
+		if err := h.reportRepo.RunNow(r.Context(), id); err != nil {
+			http.Error(w, "Scheduled report not found or disabled", http.StatusNotFound)
+			return
+		}
+
+		h.logger.Info("Scheduled report run requested", map[string]interface{}{
+			"report_id":    id.String(),
+			"requested_by": middleware.GetUserEmail(r.Context()),
+		})
+
+		w.WriteHeader(http.StatusAccepted)
+	}
+}
+
+// HandleListRuns lists the run history of a report, newest first
+// Route: GET /api/v1/reports/{id}/runs?limit=50&offset=0
+func (h *ReportHandler) HandleListRuns() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, err := uuid.Parse(r.PathValue("id"))
+		if err != nil {
+			http.Error(w, "Invalid report ID", http.StatusBadRequest)
+			return
+		}
+
+		limit := 50
+		if l := r.URL.Query().Get("limit"); l != "" {
+			if parsed, err := strconv.Atoi(l); err == nil && parsed > 0 && parsed <= 500 {
+				limit = parsed
+			}
+		}
+
+		offset := 0
+		if o := r.URL.Query().Get("offset"); o != "" {
+			if parsed, err := strconv.Atoi(o); err == nil && parsed >= 0 {
+				offset = parsed
+			}
+		}
+
+		runs, err := h.reportRepo.ListRuns(r.Context(), id, limit, offset)
+		if err != nil {
+			h.logger.Error("Failed to list report runs", map[string]interface{}{
+				"error": err.Error(),
+			})
+			http.Error(w, "Failed to list report runs", http.StatusInternalServerError)
+			return
+		}
+
+		if runs == nil {
+			runs = []*models.ReportRun{}
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"runs":   runs,
+			"count":  len(runs),
+			"limit":  limit,
+			"offset": offset,
+		})
+	}
+}
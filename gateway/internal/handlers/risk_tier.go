@@ -0,0 +1,287 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/VanCannon/openpam/gateway/internal/middleware"
+	"github.com/VanCannon/openpam/gateway/internal/models"
+	"github.com/VanCannon/openpam/gateway/internal/repository"
+	"github.com/VanCannon/openpam/gateway/internal/validate"
+	"github.com/VanCannon/openpam/pkg/logger"
+	"github.com/google/uuid"
+)
+
+// RiskTierHandler handles the approval quorums of risk tiers and the labels
+// that put targets in a tier
+type RiskTierHandler struct {
+	riskTiers *repository.RiskTierRepository
+	groups    *repository.GroupRepository
+	auditRepo *repository.SystemAuditLogRepository
+	logger    *logger.Logger
+}
+
+// NewRiskTierHandler creates a new risk tier handler
+func NewRiskTierHandler(riskTiers *repository.RiskTierRepository, groups *repository.GroupRepository, auditRepo *repository.SystemAuditLogRepository, log *logger.Logger) *RiskTierHandler {
+	return &RiskTierHandler{
+		riskTiers: riskTiers,
+		groups:    groups,
+		auditRepo: auditRepo,
+		logger:    log,
+	}
+}
+
+// applyRiskTier stamps a new schedule with its target's risk tier and returns
+// the tier's quorum. Schedules of auto-approved tiers are approved right away.
+func applyRiskTier(ctx context.Context, riskTiers *repository.RiskTierRepository, schedule *models.Schedule) (*models.ApprovalQuorum, error) {
+	quorum, err := riskTiers.TargetQuorum(ctx, schedule.TargetID)
+	if err != nil {
+		return nil, err
+	}
+
+	schedule.RiskTier = &quorum.Tier
+	if quorum.AutoApprove {
+		now := time.Now().UTC()
+		schedule.ApprovalStatus = models.ApprovalStatusApproved
+		schedule.ApprovedAt = &now
+	}
+	return quorum, nil
+}
+
+// quorumOf returns the approval quorum a schedule needs: that of the risk tier
+// its target had when it was requested, or of the target's current tier for
+// schedules requested before targets had tiers
+func quorumOf(ctx context.Context, riskTiers *repository.RiskTierRepository, schedule *models.Schedule) (*models.ApprovalQuorum, error) {
+	if schedule.RiskTier == nil {
+		return riskTiers.TargetQuorum(ctx, schedule.TargetID)
+	}
+	return riskTiers.GetQuorum(ctx, *schedule.RiskTier)
+}
+
+// quorumUpdateRequest is the body of a quorum update
+type quorumUpdateRequest struct {
+	AutoApprove    bool    `json:"auto_approve"`
+	Approvals      int     `json:"approvals"`
+	GroupID        *string `json:"group_id"`
+	GroupApprovals int     `json:"group_approvals"`
+	Version        *int    `json:"version"`
+}
+
+// Validate checks the group ID's format; the quorum checks the rest
+func (req *quorumUpdateRequest) Validate() validate.Errors {
+	var errs validate.Errors
+	if req.GroupID != nil {
+		_, err := uuid.Parse(*req.GroupID)
+		errs.Check(err == nil, "group_id", "must be a UUID")
+	}
+	return errs
+}
+
+// riskTierLabelRequest is the body that puts a label in a tier
+type riskTierLabelRequest struct {
+	Label string `json:"label"` // "key=value", or "key" for any value
+	Tier  string `json:"tier"`
+}
+
+// Validate checks the label and tier
+func (req *riskTierLabelRequest) Validate() validate.Errors {
+	var errs validate.Errors
+	_, _, err := models.ParseLabelSelector(req.Label)
+	errs.Check(err == nil, "label", "must be key=value or key")
+	errs.OneOf("tier", req.Tier, models.RiskTiers...)
+	return errs
+}
+
+// HandleList lists the tiers' approval quorums and the labels that put
+// targets in a tier
+// Route: GET /api/v1/risk-tiers
+func (h *RiskTierHandler) HandleList() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		quorums, err := h.riskTiers.ListQuorums(r.Context())
+		if err != nil {
+			h.logger.Error("Failed to list approval quorums", map[string]interface{}{
+				"error": err.Error(),
+			})
+			http.Error(w, "Failed to list risk tiers", http.StatusInternalServerError)
+			return
+		}
+
+		labels, err := h.riskTiers.ListLabels(r.Context())
+		if err != nil {
+			h.logger.Error("Failed to list risk tier labels", map[string]interface{}{
+				"error": err.Error(),
+			})
+			http.Error(w, "Failed to list risk tiers", http.StatusInternalServerError)
+			return
+		}
+		if labels == nil {
+			labels = []*models.RiskTierLabel{}
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"default_tier": models.DefaultRiskTier,
+			"quorums":      quorums,
+			"labels":       labels,
+		})
+	}
+}
+
+// HandleUpdateQuorum changes the approval quorum of a tier. Pending requests
+// keep counting towards the quorum of their tier, so the change applies to
+// them as well.
+// Route: PUT /api/v1/risk-tiers/{tier}/quorum
+func (h *RiskTierHandler) HandleUpdateQuorum() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+
+		tier := r.PathValue("tier")
+		if !models.ValidRiskTier(tier) {
+			http.Error(w, "Unknown risk tier", http.StatusNotFound)
+			return
+		}
+
+		var req quorumUpdateRequest
+		if !validate.Decode(w, r, &req) {
+			return
+		}
+
+		version, ok := requireVersion(w, r, req.Version)
+		if !ok {
+			return
+		}
+
+		quorum := &models.ApprovalQuorum{
+			Tier:           tier,
+			AutoApprove:    req.AutoApprove,
+			Approvals:      req.Approvals,
+			GroupApprovals: req.GroupApprovals,
+			Version:        version,
+		}
+		if req.GroupID != nil {
+			groupID := uuid.MustParse(*req.GroupID)
+			quorum.GroupID = &groupID
+		}
+		if err := quorum.Validate(); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if quorum.GroupID != nil {
+			if _, err := h.groups.GetByID(ctx, *quorum.GroupID); err != nil {
+				http.Error(w, "Group not found", http.StatusBadRequest)
+				return
+			}
+		}
+
+		if err := h.riskTiers.UpdateQuorum(ctx, quorum); err != nil {
+			if errors.Is(err, repository.ErrVersionConflict) {
+				if current, err := h.riskTiers.GetQuorum(ctx, tier); err == nil {
+					writeVersionConflict(w, current.Version, current)
+					return
+				}
+			}
+			h.logger.Error("Failed to update approval quorum", map[string]interface{}{
+				"tier":  tier,
+				"error": err.Error(),
+			})
+			http.Error(w, "Failed to update approval quorum", http.StatusInternalServerError)
+			return
+		}
+
+		details := map[string]interface{}{
+			"tier":            tier,
+			"auto_approve":    quorum.AutoApprove,
+			"approvals":       quorum.Approvals,
+			"group_approvals": quorum.GroupApprovals,
+		}
+		if quorum.GroupID != nil {
+			details["group_id"] = quorum.GroupID.String()
+		}
+		h.recordEvent(r, models.EventTypeApprovalQuorumUpdated, "Approval quorum updated", details)
+
+		setETag(w, quorum.Version)
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(quorum)
+	}
+}
+
+// HandleSetLabel puts the targets carrying a label in a tier
+// Route: PUT /api/v1/risk-tier-labels
+func (h *RiskTierHandler) HandleSetLabel() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req riskTierLabelRequest
+		if !validate.Decode(w, r, &req) {
+			return
+		}
+
+		key, value, _ := models.ParseLabelSelector(req.Label)
+		label := &models.RiskTierLabel{Key: key, Value: value, Tier: req.Tier}
+		if err := h.riskTiers.SetLabel(r.Context(), label); err != nil {
+			h.logger.Error("Failed to set risk tier label", map[string]interface{}{
+				"error": err.Error(),
+			})
+			http.Error(w, "Failed to set risk tier label", http.StatusInternalServerError)
+			return
+		}
+
+		h.recordEvent(r, models.EventTypeRiskTierLabelSet, "Risk tier label set", map[string]interface{}{
+			"label_key":   key,
+			"label_value": value,
+			"tier":        label.Tier,
+		})
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(label)
+	}
+}
+
+// HandleDeleteLabel stops a label from putting targets in a tier
+// Route: DELETE /api/v1/risk-tier-labels?label=key=value
+func (h *RiskTierHandler) HandleDeleteLabel() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		key, value, err := models.ParseLabelSelector(r.URL.Query().Get("label"))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		if err := h.riskTiers.DeleteLabel(r.Context(), key, value); err != nil {
+			h.logger.Error("Failed to delete risk tier label", map[string]interface{}{
+				"error": err.Error(),
+			})
+			http.Error(w, "Risk tier label not found", http.StatusNotFound)
+			return
+		}
+
+		h.recordEvent(r, models.EventTypeRiskTierLabelDeleted, "Risk tier label deleted", map[string]interface{}{
+			"label_key":   key,
+			"label_value": value,
+		})
+
+		h.logger.Info("Risk tier label deleted", map[string]interface{}{
+			"label_key":  key,
+			"deleted_by": middleware.GetUserEmail(r.Context()),
+		})
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// recordEvent audits a change to the risk tiers
+func (h *RiskTierHandler) recordEvent(r *http.Request, eventType, action string, details map[string]interface{}) {
+	var userID *uuid.UUID
+	if id, err := uuid.Parse(middleware.GetUserID(r.Context())); err == nil {
+		userID = &id
+	}
+
+	ip := r.RemoteAddr
+	if err := h.auditRepo.CreateSimple(r.Context(), eventType, userID, action, models.AuditStatusSuccess, &ip, details); err != nil {
+		h.logger.Error("Failed to record risk tier audit event", map[string]interface{}{
+			"event_type": eventType,
+			"error":      err.Error(),
+		})
+	}
+}
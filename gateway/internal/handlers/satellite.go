@@ -0,0 +1,553 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/VanCannon/openpam/gateway/internal/middleware"
+	"github.com/VanCannon/openpam/gateway/internal/models"
+	"github.com/VanCannon/openpam/gateway/internal/repository"
+	"github.com/VanCannon/openpam/gateway/internal/tunnel"
+	"github.com/VanCannon/openpam/gateway/internal/validate"
+	"github.com/VanCannon/openpam/pkg/logger"
+	"github.com/google/uuid"
+)
+
+var sha256Pattern = regexp.MustCompile(`^[0-9a-f]{64}$`)
+
+// SatelliteHandler handles the configuration and updates the hub pushes to
+// satellites
+type SatelliteHandler struct {
+	satelliteRepo *repository.SatelliteRepository
+	zoneRepo      *repository.ZoneRepository
+	auditRepo     *repository.SystemAuditLogRepository
+	hub           *tunnel.HubServer
+	logger        *logger.Logger
+}
+
+// NewSatelliteHandler creates a new satellite handler
+func NewSatelliteHandler(
+	satelliteRepo *repository.SatelliteRepository,
+	zoneRepo *repository.ZoneRepository,
+	auditRepo *repository.SystemAuditLogRepository,
+	hub *tunnel.HubServer,
+	log *logger.Logger,
+) *SatelliteHandler {
+	return &SatelliteHandler{
+		satelliteRepo: satelliteRepo,
+		zoneRepo:      zoneRepo,
+		auditRepo:     auditRepo,
+		hub:           hub,
+		logger:        log,
+	}
+}
+
+// HandleList lists satellite zones with the status they last reported
+// Route: GET /api/v1/satellites
+func (h *SatelliteHandler) HandleList() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+
+		zones, err := h.zoneRepo.List(ctx)
+		if err != nil {
+			h.logger.Error("Failed to list zones", map[string]interface{}{
+				"error": err.Error(),
+			})
+			http.Error(w, "Failed to list satellites", http.StatusInternalServerError)
+			return
+		}
+
+		statuses, err := h.satelliteRepo.ListStatus(ctx)
+		if err != nil {
+			h.logger.Error("Failed to list satellite status", map[string]interface{}{
+				"error": err.Error(),
+			})
+			http.Error(w, "Failed to list satellites", http.StatusInternalServerError)
+			return
+		}
+		byZone := make(map[uuid.UUID]*models.SatelliteStatus, len(statuses))
+		for _, status := range statuses {
+			byZone[status.ZoneID] = status
+		}
+
+		satellites := []map[string]interface{}{}
+		for _, zone := range zones {
+			if zone.Type != models.ZoneTypeSatellite {
+				continue
+			}
+			_, connected := h.hub.GetSatellite(zone.ID.String())
+			satellites = append(satellites, map[string]interface{}{
+				"zone":      zone,
+				"connected": connected,
+				"status":    byZone[zone.ID],
+			})
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"satellites": satellites,
+			"count":      len(satellites),
+		})
+	}
+}
+
+// HandleDiagnostics returns the metrics and log messages a satellite zone
+// forwarded to the hub
+// Route: GET /api/v1/zones/{id}/diagnostics?since=RFC3339&level=warn,error&q=text&limit=N
+func (h *SatelliteHandler) HandleDiagnostics() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+
+		zoneID, err := uuid.Parse(r.PathValue("id"))
+		if err != nil {
+			http.Error(w, "Invalid zone ID", http.StatusBadRequest)
+			return
+		}
+
+		query := r.URL.Query()
+		filter := repository.SatelliteLogFilter{
+			Since:  time.Now().Add(-time.Hour),
+			Search: query.Get("q"),
+			Limit:  200,
+		}
+		if v := query.Get("since"); v != "" {
+			since, err := time.Parse(time.RFC3339, v)
+			if err != nil {
+				http.Error(w, "Invalid since: must be RFC 3339", http.StatusBadRequest)
+				return
+			}
+			filter.Since = since
+		}
+		if v := query.Get("level"); v != "" {
+			for _, name := range strings.Split(v, ",") {
+				level, err := logger.ParseLevel(strings.TrimSpace(name))
+				if err != nil {
+					http.Error(w, "Invalid level: must be 'debug', 'info', 'warn' or 'error'", http.StatusBadRequest)
+					return
+				}
+				filter.Levels = append(filter.Levels, level.String())
+			}
+		}
+		if l := query.Get("limit"); l != "" {
+			if v, err := strconv.Atoi(l); err == nil && v > 0 && v <= 1000 {
+				filter.Limit = v
+			}
+		}
+
+		zone, err := h.zoneRepo.GetByID(ctx, zoneID)
+		if err != nil {
+			http.Error(w, "Zone not found", http.StatusNotFound)
+			return
+		}
+		if zone.Type != models.ZoneTypeSatellite {
+			http.Error(w, "Zone is not a satellite zone", http.StatusBadRequest)
+			return
+		}
+
+		metrics, err := h.satelliteRepo.ListMetrics(ctx, zoneID, filter.Since, 500)
+		if err != nil {
+			h.logger.Error("Failed to list satellite metrics", map[string]interface{}{
+				"zone_id": zoneID.String(),
+				"error":   err.Error(),
+			})
+			http.Error(w, "Failed to get diagnostics", http.StatusInternalServerError)
+			return
+		}
+		logs, err := h.satelliteRepo.ListLogs(ctx, zoneID, filter)
+		if err != nil {
+			h.logger.Error("Failed to list satellite logs", map[string]interface{}{
+				"zone_id": zoneID.String(),
+				"error":   err.Error(),
+			})
+			http.Error(w, "Failed to get diagnostics", http.StatusInternalServerError)
+			return
+		}
+
+		if metrics == nil {
+			metrics = []*models.SatelliteMetrics{}
+		}
+		if logs == nil {
+			logs = []*models.SatelliteLog{}
+		}
+		var latest *models.SatelliteMetrics
+		if len(metrics) > 0 {
+			latest = metrics[0]
+		}
+		_, connected := h.hub.GetSatellite(zoneID.String())
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"zone_id":   zoneID,
+			"connected": connected,
+			"latest":    latest,
+			"metrics":   metrics,
+			"logs":      logs,
+			"count":     len(logs),
+		})
+	}
+}
+
+// HandleConfig routes satellite configuration requests based on HTTP method
+// Route: /api/v1/zones/{id}/satellite-config
+func (h *SatelliteHandler) HandleConfig() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			h.HandleGetConfig()(w, r)
+		case http.MethodPut:
+			h.HandleUpdateConfig()(w, r)
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	}
+}
+
+// HandleGetConfig returns the configuration pushed to a zone's satellites
+func (h *SatelliteHandler) HandleGetConfig() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		zoneID, err := uuid.Parse(r.PathValue("id"))
+		if err != nil {
+			http.Error(w, "Invalid zone ID", http.StatusBadRequest)
+			return
+		}
+
+		cfg, err := h.satelliteRepo.GetConfig(r.Context(), zoneID)
+		if err != nil {
+			// Nothing pushed yet
+			cfg = &models.SatelliteConfig{ZoneID: zoneID, Values: models.ConfigValues{}}
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(cfg)
+	}
+}
+
+// HandleUpdateConfig stores a new revision of a zone's satellite configuration
+// and pushes it to the connected satellites
+func (h *SatelliteHandler) HandleUpdateConfig() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+
+		zoneID, err := uuid.Parse(r.PathValue("id"))
+		if err != nil {
+			http.Error(w, "Invalid zone ID", http.StatusBadRequest)
+			return
+		}
+
+		var req struct {
+			Values models.ConfigValues `json:"values"`
+		}
+		if !validate.Decode(w, r, &req) {
+			return
+		}
+		if err := tunnel.ValidateConfigValues(req.Values); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		zone, err := h.zoneRepo.GetByID(ctx, zoneID)
+		if err != nil {
+			http.Error(w, "Zone not found", http.StatusNotFound)
+			return
+		}
+		if zone.Type != models.ZoneTypeSatellite {
+			http.Error(w, "Zone is not a satellite zone", http.StatusBadRequest)
+			return
+		}
+		if !h.hub.ManagementEnabled() {
+			http.Error(w, "Satellite management requires POLICY_SIGNING_KEY", http.StatusServiceUnavailable)
+			return
+		}
+
+		cfg := &models.SatelliteConfig{ZoneID: zoneID, Values: req.Values}
+		if userID, err := uuid.Parse(middleware.GetUserID(ctx)); err == nil {
+			cfg.UpdatedBy = uuid.NullUUID{UUID: userID, Valid: true}
+		}
+		if err := h.satelliteRepo.SaveConfig(ctx, cfg); err != nil {
+			h.logger.Error("Failed to save satellite config", map[string]interface{}{
+				"zone_id": zoneID.String(),
+				"error":   err.Error(),
+			})
+			http.Error(w, "Failed to save satellite config", http.StatusInternalServerError)
+			return
+		}
+
+		h.logger.Info("Satellite config updated", map[string]interface{}{
+			"zone_id":  zoneID.String(),
+			"revision": cfg.Revision,
+		})
+		h.recordEvent(r, models.EventTypeSatelliteConfigUpdated, "update_satellite_config", map[string]interface{}{
+			"zone_id":  zoneID.String(),
+			"revision": cfg.Revision,
+		})
+
+		h.hub.Reconcile(context.WithoutCancel(ctx))
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(cfg)
+	}
+}
+
+// HandleRollouts routes rollout collection requests based on HTTP method
+// Route: /api/v1/satellite-rollouts
+func (h *SatelliteHandler) HandleRollouts() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			h.HandleListRollouts()(w, r)
+		case http.MethodPost:
+			h.HandleCreateRollout()(w, r)
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	}
+}
+
+// HandleListRollouts lists rollouts, newest first
+func (h *SatelliteHandler) HandleListRollouts() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		limit := 50
+		offset := 0
+		if l := r.URL.Query().Get("limit"); l != "" {
+			if v, err := strconv.Atoi(l); err == nil && v > 0 && v <= 500 {
+				limit = v
+			}
+		}
+		if o := r.URL.Query().Get("offset"); o != "" {
+			if v, err := strconv.Atoi(o); err == nil && v >= 0 {
+				offset = v
+			}
+		}
+
+		rollouts, err := h.satelliteRepo.ListRollouts(r.Context(), limit, offset)
+		if err != nil {
+			h.logger.Error("Failed to list rollouts", map[string]interface{}{
+				"error": err.Error(),
+			})
+			http.Error(w, "Failed to list rollouts", http.StatusInternalServerError)
+			return
+		}
+
+		if rollouts == nil {
+			rollouts = []*models.SatelliteRollout{}
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"rollouts": rollouts,
+			"count":    len(rollouts),
+		})
+	}
+}
+
+// HandleCreateRollout starts delivering a signed build to satellites. Each
+// stage starts once every satellite of the previous one is healthy on the new
+// version, and the rollout stops at the first satellite that rolls back.
+func (h *SatelliteHandler) HandleCreateRollout() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+
+		var req struct {
+			Version string               `json:"version"`
+			URL     string               `json:"url"`
+			SHA256  string               `json:"sha256"`
+			Size    int64                `json:"size"`
+			Stages  models.RolloutStages `json:"stages"`
+		}
+		if !validate.Decode(w, r, &req) {
+			return
+		}
+
+		if req.Version == "" || req.URL == "" || req.SHA256 == "" || req.Size <= 0 || len(req.Stages) == 0 {
+			http.Error(w, "Missing required fields", http.StatusBadRequest)
+			return
+		}
+		if u, err := url.Parse(req.URL); err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" {
+			http.Error(w, "Invalid url: must be an http or https URL", http.StatusBadRequest)
+			return
+		}
+		req.SHA256 = strings.ToLower(req.SHA256)
+		if !sha256Pattern.MatchString(req.SHA256) {
+			http.Error(w, "Invalid sha256: must be a hex SHA-256 digest", http.StatusBadRequest)
+			return
+		}
+
+		seen := make(map[uuid.UUID]bool)
+		for _, stage := range req.Stages {
+			if len(stage) == 0 {
+				http.Error(w, "Rollout stages must not be empty", http.StatusBadRequest)
+				return
+			}
+			for _, zoneID := range stage {
+				if seen[zoneID] {
+					http.Error(w, "Zone appears in more than one stage: "+zoneID.String(), http.StatusBadRequest)
+					return
+				}
+				seen[zoneID] = true
+
+				zone, err := h.zoneRepo.GetByID(ctx, zoneID)
+				if err != nil || zone.Type != models.ZoneTypeSatellite {
+					http.Error(w, "Unknown satellite zone: "+zoneID.String(), http.StatusBadRequest)
+					return
+				}
+			}
+		}
+
+		if !h.hub.ManagementEnabled() {
+			http.Error(w, "Satellite management requires POLICY_SIGNING_KEY", http.StatusServiceUnavailable)
+			return
+		}
+
+		rollout := &models.SatelliteRollout{
+			Version: req.Version,
+			URL:     req.URL,
+			SHA256:  req.SHA256,
+			Size:    req.Size,
+			Stages:  req.Stages,
+			Status:  models.RolloutStatusActive,
+		}
+		if userID, err := uuid.Parse(middleware.GetUserID(ctx)); err == nil {
+			rollout.CreatedBy = uuid.NullUUID{UUID: userID, Valid: true}
+		}
+		if err := h.satelliteRepo.CreateRollout(ctx, rollout); err != nil {
+			h.logger.Error("Failed to create rollout", map[string]interface{}{
+				"error": err.Error(),
+			})
+			http.Error(w, "Failed to create rollout", http.StatusInternalServerError)
+			return
+		}
+
+		h.logger.Info("Satellite rollout created", map[string]interface{}{
+			"rollout_id": rollout.ID.String(),
+			"version":    rollout.Version,
+			"stages":     len(rollout.Stages),
+		})
+		h.recordEvent(r, models.EventTypeRolloutCreated, "create_rollout", map[string]interface{}{
+			"rollout_id": rollout.ID.String(),
+			"version":    rollout.Version,
+			"sha256":     rollout.SHA256,
+		})
+
+		h.hub.Reconcile(context.WithoutCancel(ctx))
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(rollout)
+	}
+}
+
+// HandleGetRollout returns a rollout
+// Route: GET /api/v1/satellite-rollouts/{id}
+func (h *SatelliteHandler) HandleGetRollout() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, err := uuid.Parse(r.PathValue("id"))
+		if err != nil {
+			http.Error(w, "Invalid rollout ID", http.StatusBadRequest)
+			return
+		}
+
+		rollout, err := h.satelliteRepo.GetRollout(r.Context(), id)
+		if err != nil {
+			http.Error(w, "Rollout not found", http.StatusNotFound)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(rollout)
+	}
+}
+
+// HandlePause stops a rollout from reaching further satellites
+// Route: POST /api/v1/satellite-rollouts/{id}/pause
+func (h *SatelliteHandler) HandlePause() http.HandlerFunc {
+	return h.transition("pause_rollout", models.RolloutStatusPaused, models.RolloutStatusActive)
+}
+
+// HandleResume continues a paused rollout
+// Route: POST /api/v1/satellite-rollouts/{id}/resume
+func (h *SatelliteHandler) HandleResume() http.HandlerFunc {
+	return h.transition("resume_rollout", models.RolloutStatusActive, models.RolloutStatusPaused)
+}
+
+// HandleCancel abandons a rollout. Satellites already updated keep the new
+// version; a failed rollout is cancelled to acknowledge it.
+// Route: POST /api/v1/satellite-rollouts/{id}/cancel
+func (h *SatelliteHandler) HandleCancel() http.HandlerFunc {
+	return h.transition("cancel_rollout", models.RolloutStatusCancelled,
+		models.RolloutStatusActive, models.RolloutStatusPaused, models.RolloutStatusFailed)
+}
+
+// transition moves a rollout to status from one of the allowed statuses
+func (h *SatelliteHandler) transition(action, status string, from ...string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+
+		id, err := uuid.Parse(r.PathValue("id"))
+		if err != nil {
+			http.Error(w, "Invalid rollout ID", http.StatusBadRequest)
+			return
+		}
+
+		rollout, err := h.satelliteRepo.GetRollout(ctx, id)
+		if err != nil {
+			http.Error(w, "Rollout not found", http.StatusNotFound)
+			return
+		}
+
+		allowed := false
+		for _, s := range from {
+			if rollout.Status == s {
+				allowed = true
+			}
+		}
+		if !allowed {
+			http.Error(w, "Rollout is "+rollout.Status, http.StatusConflict)
+			return
+		}
+
+		previous := rollout.Status
+		rollout.Status = status
+		if err := h.satelliteRepo.UpdateRollout(ctx, rollout); err != nil {
+			h.logger.Error("Failed to update rollout", map[string]interface{}{
+				"rollout_id": id.String(),
+				"error":      err.Error(),
+			})
+			http.Error(w, "Failed to update rollout", http.StatusInternalServerError)
+			return
+		}
+
+		h.recordEvent(r, models.EventTypeRolloutUpdated, action, map[string]interface{}{
+			"rollout_id": id.String(),
+			"from":       previous,
+			"to":         status,
+		})
+
+		if status == models.RolloutStatusActive {
+			h.hub.Reconcile(context.WithoutCancel(ctx))
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(rollout)
+	}
+}
+
+func (h *SatelliteHandler) recordEvent(r *http.Request, eventType, action string, details map[string]interface{}) {
+	var userID *uuid.UUID
+	if id, err := uuid.Parse(middleware.GetUserID(r.Context())); err == nil {
+		userID = &id
+	}
+
+	ip := r.RemoteAddr
+	if err := h.auditRepo.CreateSimple(r.Context(), eventType, userID, action, "success", &ip, details); err != nil {
+		h.logger.Error("Failed to record satellite audit event", map[string]interface{}{
+			"event_type": eventType,
+			"error":      err.Error(),
+		})
+	}
+}
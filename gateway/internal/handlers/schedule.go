@@ -1,28 +1,44 @@
 package handlers
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"net/http"
+	"strings"
 	"time"
 
-	"github.com/VanCannon/openpam/gateway/internal/logger"
+	"github.com/VanCannon/openpam/gateway/internal/actor"
+	"github.com/VanCannon/openpam/gateway/internal/approval"
 	"github.com/VanCannon/openpam/gateway/internal/middleware"
 	"github.com/VanCannon/openpam/gateway/internal/models"
+	"github.com/VanCannon/openpam/gateway/internal/recurrence"
 	"github.com/VanCannon/openpam/gateway/internal/repository"
+	"github.com/VanCannon/openpam/gateway/internal/validate"
+	"github.com/VanCannon/openpam/pkg/logger"
 	"github.com/google/uuid"
 )
 
 // ScheduleHandler handles schedule-related requests
 type ScheduleHandler struct {
-	repo   *repository.ScheduleRepository
-	logger *logger.Logger
+	repo            *repository.ScheduleRepository
+	riskTiers       *repository.RiskTierRepository
+	systemAuditRepo *repository.SystemAuditLogRepository
+	approvals       *approval.Notifier
+	logger          *logger.Logger
 }
 
-// NewScheduleHandler creates a new schedule handler
-func NewScheduleHandler(repo *repository.ScheduleRepository, log *logger.Logger) *ScheduleHandler {
+// NewScheduleHandler creates a new schedule handler. New requests are sent to
+// approvers through approvals, and need the approval quorum of their
+// target's risk tier.
+func NewScheduleHandler(repo *repository.ScheduleRepository, riskTiers *repository.RiskTierRepository, systemAuditRepo *repository.SystemAuditLogRepository, approvals *approval.Notifier, log *logger.Logger) *ScheduleHandler {
 	return &ScheduleHandler{
-		repo:   repo,
-		logger: log,
+		repo:            repo,
+		riskTiers:       riskTiers,
+		systemAuditRepo: systemAuditRepo,
+		approvals:       approvals,
+		logger:          log,
 	}
 }
 
@@ -30,11 +46,27 @@ func NewScheduleHandler(repo *repository.ScheduleRepository, log *logger.Logger)
 type CreateScheduleRequest struct {
 	UserID         string                 `json:"user_id"`
 	TargetID       string                 `json:"target_id"`
-	StartTime      string                 `json:"start_time"` // RFC3339 format
-	EndTime        string                 `json:"end_time"`   // RFC3339 format
+	StartTime      string                 `json:"start_time"` // RFC3339, or a local time in Timezone
+	EndTime        string                 `json:"end_time"`   // RFC3339, or a local time in Timezone
 	RecurrenceRule *string                `json:"recurrence_rule,omitempty"`
 	Timezone       string                 `json:"timezone"`
 	Metadata       map[string]interface{} `json:"metadata,omitempty"`
+	Purpose        string                 `json:"purpose,omitempty"` // Shown to approvers, see the models.Purpose constants
+	Reason         string                 `json:"reason,omitempty"`
+}
+
+// Validate checks the fields of a schedule request; the window itself is
+// checked once its time zone is known
+func (req *CreateScheduleRequest) Validate() validate.Errors {
+	var errs validate.Errors
+	_, err := uuid.Parse(req.UserID)
+	errs.Check(err == nil, "user_id", "must be a UUID")
+	_, err = uuid.Parse(req.TargetID)
+	errs.Check(err == nil, "target_id", "must be a UUID")
+	errs.Required("start_time", req.StartTime)
+	errs.Required("end_time", req.EndTime)
+	errs.MaxLength("reason", req.Reason, 1000)
+	return errs
 }
 
 // ApproveScheduleRequest represents a schedule approval request
@@ -42,12 +74,80 @@ type ApproveScheduleRequest struct {
 	ScheduleID string  `json:"schedule_id"`
 	StartTime  *string `json:"start_time,omitempty"` // Optional: modify start time
 	EndTime    *string `json:"end_time,omitempty"`   // Optional: modify end time
+	Version    *int    `json:"version,omitempty"`    // Expected version, unless sent as If-Match
 }
 
 // RejectScheduleRequest represents a schedule rejection request
 type RejectScheduleRequest struct {
 	ScheduleID string `json:"schedule_id"`
 	Reason     string `json:"reason"`
+	Version    *int   `json:"version,omitempty"` // Expected version, unless sent as If-Match
+}
+
+// localTimeLayout is a schedule time given without an offset, taken as a
+// wall-clock time in the schedule's timezone
+const localTimeLayout = "2006-01-02T15:04:05"
+
+// parseScheduleTime parses an RFC3339 time, or a local time in loc, and
+// returns it in UTC. Local times get the offset in effect on their date from
+// the tz database; one that falls in a DST gap moves past it.
+func parseScheduleTime(value string, loc *time.Location) (time.Time, error) {
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		var localErr error
+		if t, localErr = time.ParseInLocation(localTimeLayout, value, loc); localErr != nil {
+			return time.Time{}, err
+		}
+	}
+	return t.UTC(), nil
+}
+
+// scheduleWindow validates the window, timezone and recurrence rule of a
+// schedule request and returns the window in UTC. Times are stored in UTC; the
+// timezone, UTC if empty, is where local times are given and recurring windows
+// repeat. The returned errors are meant for the client.
+func scheduleWindow(startTime, endTime string, timezone *string, rule *string) (time.Time, time.Time, error) {
+	if *timezone == "" {
+		*timezone = "UTC"
+	}
+	loc, err := time.LoadLocation(*timezone)
+	if err != nil {
+		return time.Time{}, time.Time{}, errors.New("invalid timezone")
+	}
+
+	start, err := parseScheduleTime(startTime, loc)
+	if err != nil {
+		return time.Time{}, time.Time{}, errors.New("invalid start_time format (use RFC3339)")
+	}
+	end, err := parseScheduleTime(endTime, loc)
+	if err != nil {
+		return time.Time{}, time.Time{}, errors.New("invalid end_time format (use RFC3339)")
+	}
+	if !end.After(start) {
+		return time.Time{}, time.Time{}, errors.New("end_time must be after start_time")
+	}
+
+	if rule != nil && *rule != "" {
+		if _, err := recurrence.Parse(*rule); err != nil {
+			return time.Time{}, time.Time{}, fmt.Errorf("invalid recurrence_rule: %w", err)
+		}
+	}
+
+	return start, end, nil
+}
+
+// displayLocation resolves the timezone times are returned in from the tz
+// query parameter, UTC by default
+func displayLocation(r *http.Request) (*time.Location, error) {
+	tz := r.URL.Query().Get("tz")
+	if tz == "" {
+		return time.UTC, nil
+	}
+	loc, err := time.LoadLocation(tz)
+	if err != nil {
+		return nil, fmt.Errorf("invalid tz %q", tz)
+	}
+	return loc, nil
 }
 
 // respondWithError sends a JSON error response
@@ -60,6 +160,209 @@ func (h *ScheduleHandler) respondWithError(w http.ResponseWriter, code int, mess
 	})
 }
 
+// scheduleVersion resolves the version an approval decision is based on,
+// responding with an error if it is malformed or missing
+func (h *ScheduleHandler) scheduleVersion(w http.ResponseWriter, r *http.Request, bodyVersion *int) (int, bool) {
+	version, ok, err := expectedVersion(r, bodyVersion)
+	if err != nil {
+		h.respondWithError(w, http.StatusBadRequest, err.Error())
+		return 0, false
+	}
+	if !ok {
+		h.respondWithError(w, http.StatusPreconditionRequired, "Version required: send If-Match or a version field")
+		return 0, false
+	}
+	return version, true
+}
+
+// respondWithDecisionError maps a failed approval status update to a response.
+// A version conflict means another admin decided first, so the current schedule is returned.
+func (h *ScheduleHandler) respondWithDecisionError(w http.ResponseWriter, r *http.Request, scheduleID uuid.UUID, err error, message string) {
+	if errors.Is(err, repository.ErrOutsideZones) {
+		h.respondWithError(w, http.StatusForbidden, "Forbidden: the schedule's target is outside the zones you administer")
+		return
+	}
+	if errors.Is(err, repository.ErrSelfApproval) {
+		h.respondWithError(w, http.StatusForbidden, "A schedule must be approved by someone other than its requester")
+		return
+	}
+	if errors.Is(err, repository.ErrNotPending) {
+		h.respondWithError(w, http.StatusConflict, "The schedule is no longer pending approval")
+		return
+	}
+	if errors.Is(err, repository.ErrVersionConflict) {
+		if current, err := h.repo.GetByID(r.Context(), scheduleID); err == nil {
+			writeVersionConflict(w, current.Version, current)
+			return
+		}
+	}
+
+	h.logger.Error(message, map[string]interface{}{
+		"error": err.Error(),
+	})
+	h.respondWithError(w, http.StatusInternalServerError, message)
+}
+
+// modifiedWindow is the window a schedule is approved for when the approver
+// changed it, along with the window that was requested
+type modifiedWindow struct {
+	schedule       *models.Schedule
+	requestedStart time.Time
+	requestedEnd   time.Time
+}
+
+// approvalWindow resolves the window a schedule is approved for from the
+// optional start and end times of an approval, responding with an error if
+// they are malformed. It returns nil when the requested window is kept.
+func (h *ScheduleHandler) approvalWindow(w http.ResponseWriter, r *http.Request, scheduleID uuid.UUID, req *ApproveScheduleRequest) (*modifiedWindow, bool) {
+	if req.StartTime == nil && req.EndTime == nil {
+		return nil, true
+	}
+
+	schedule, err := h.repo.GetByID(r.Context(), scheduleID)
+	if err != nil {
+		h.respondWithError(w, http.StatusNotFound, "Schedule not found")
+		return nil, false
+	}
+
+	window, err := resolveApprovalWindow(schedule, req, time.Now())
+	if err != nil {
+		h.respondWithError(w, http.StatusBadRequest, err.Error())
+		return nil, false
+	}
+	return window, true
+}
+
+// resolveApprovalWindow applies an approval's start and end times to a
+// schedule. It returns nil when they keep the requested window.
+func resolveApprovalWindow(schedule *models.Schedule, req *ApproveScheduleRequest, now time.Time) (*modifiedWindow, error) {
+	var err error
+	start, end := schedule.StartTime, schedule.EndTime
+	if req.StartTime != nil {
+		if start, err = parseScheduleTime(*req.StartTime, schedule.Location()); err != nil {
+			return nil, errors.New("Invalid start_time format (use RFC3339)")
+		}
+	}
+	if req.EndTime != nil {
+		if end, err = parseScheduleTime(*req.EndTime, schedule.Location()); err != nil {
+			return nil, errors.New("Invalid end_time format (use RFC3339)")
+		}
+	}
+
+	if !end.After(start) {
+		return nil, errors.New("end_time must be after start_time")
+	}
+	if !end.After(now) {
+		return nil, errors.New("end_time must be in the future")
+	}
+	if start.Equal(schedule.StartTime) && end.Equal(schedule.EndTime) {
+		return nil, nil
+	}
+
+	window := &modifiedWindow{schedule: schedule, requestedStart: schedule.StartTime, requestedEnd: schedule.EndTime}
+	schedule.StartTime, schedule.EndTime = start, end
+	return window, nil
+}
+
+// scheduleQuorum returns the approval quorum a schedule needs
+func (h *ScheduleHandler) scheduleQuorum(ctx context.Context, scheduleID uuid.UUID) (*models.ApprovalQuorum, error) {
+	schedule, err := h.repo.GetByID(ctx, scheduleID)
+	if err != nil {
+		return nil, err
+	}
+	return quorumOf(ctx, h.riskTiers, schedule)
+}
+
+// decide records an approver's decision on a schedule, cancels it if rejected
+// and audits the decision with the channel it was made through. An approval
+// counts towards the schedule's quorum, which approves the schedule once met;
+// the returned progress is nil for rejections. Approvals for a modified window
+// also persist the window, and the requester is told about a modified window
+// once the schedule is approved.
+func (h *ScheduleHandler) decide(r *http.Request, scheduleID uuid.UUID, version int, approverID uuid.UUID, decision string, reason *string, channel string, window *modifiedWindow) (*models.QuorumProgress, error) {
+	ctx := r.Context()
+	var progress *models.QuorumProgress
+	if decision == models.ApprovalStatusApproved {
+		quorum, err := h.scheduleQuorum(ctx, scheduleID)
+		if err != nil {
+			return nil, err
+		}
+		var approved *repository.ApprovalWindow
+		if window != nil {
+			approved = &repository.ApprovalWindow{Start: window.schedule.StartTime, End: window.schedule.EndTime}
+		}
+		if progress, err = h.repo.RecordApproval(ctx, scheduleID, version, approverID, channel, quorum, approved); err != nil {
+			return nil, err
+		}
+	} else if err := h.repo.UpdateApprovalStatus(ctx, scheduleID, version, decision, reason, &approverID); err != nil {
+		return nil, err
+	}
+
+	// Approved schedules stay pending until the schedule lifecycle activates
+	// them when their window starts
+	var eventType, action string
+	switch {
+	case decision == models.ApprovalStatusRejected:
+		eventType, action = models.EventTypeScheduleRejected, "Schedule rejected"
+		if err := h.repo.UpdateStatus(ctx, scheduleID, models.ScheduleStatusCancelled); err != nil {
+			h.logger.Error("Failed to update schedule status", map[string]interface{}{
+				"schedule_id": scheduleID.String(),
+				"status":      string(models.ScheduleStatusCancelled),
+				"error":       err.Error(),
+			})
+		}
+	case progress.Approved:
+		eventType, action = models.EventTypeScheduleApproved, "Schedule approved"
+	default:
+		eventType, action = models.EventTypeScheduleApprovalRecorded, "Schedule approval recorded"
+	}
+
+	details := map[string]interface{}{
+		"schedule_id": scheduleID.String(),
+		"channel":     channel,
+	}
+	if reason != nil {
+		details["reason"] = *reason
+	}
+	if progress != nil {
+		details["risk_tier"] = progress.Tier
+		details["approvals"] = progress.Approvals
+		details["required_approvals"] = progress.RequiredApprovals
+	}
+	if window != nil {
+		details["start_time"] = window.schedule.StartTime
+		details["end_time"] = window.schedule.EndTime
+		details["requested_start_time"] = window.requestedStart
+		details["requested_end_time"] = window.requestedEnd
+	}
+	ip := r.RemoteAddr
+	if err := h.systemAuditRepo.CreateSimple(ctx, eventType, &approverID, action, models.AuditStatusSuccess, &ip, details); err != nil {
+		h.logger.Error("Failed to record schedule decision audit event", map[string]interface{}{
+			"schedule_id": scheduleID.String(),
+			"error":       err.Error(),
+		})
+	}
+
+	if progress != nil && progress.Approved && h.approvals != nil {
+		// The window may have been modified by an earlier approval
+		schedule, err := h.repo.GetByID(ctx, scheduleID)
+		if err == nil && schedule.RequestedStartTime != nil && schedule.RequestedEndTime != nil {
+			go func() {
+				ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+				defer cancel()
+				if err := h.approvals.NotifyWindowChanged(ctx, schedule, *schedule.RequestedStartTime, *schedule.RequestedEndTime); err != nil {
+					h.logger.Error("Failed to notify requester of the approved window", map[string]interface{}{
+						"schedule_id": scheduleID.String(),
+						"error":       err.Error(),
+					})
+				}
+			}()
+		}
+	}
+
+	return progress, nil
+}
+
 // HandleRequestSchedule handles schedule requests from users
 func (h *ScheduleHandler) HandleRequestSchedule() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
@@ -73,11 +376,7 @@ func (h *ScheduleHandler) HandleRequestSchedule() http.HandlerFunc {
 		}
 
 		var req CreateScheduleRequest
-		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-			h.logger.Warn("Invalid request body", map[string]interface{}{
-				"error": err.Error(),
-			})
-			h.respondWithError(w, http.StatusBadRequest, "Invalid request body")
+		if !validate.Decode(w, r, &req) {
 			return
 		}
 
@@ -87,22 +386,21 @@ func (h *ScheduleHandler) HandleRequestSchedule() http.HandlerFunc {
 			return
 		}
 
-		// Validate time format
-		startTime, err := time.Parse(time.RFC3339, req.StartTime)
+		loc, err := displayLocation(r)
 		if err != nil {
-			h.respondWithError(w, http.StatusBadRequest, "Invalid start_time format (use RFC3339)")
+			h.respondWithError(w, http.StatusBadRequest, err.Error())
 			return
 		}
 
-		endTime, err := time.Parse(time.RFC3339, req.EndTime)
-		if err != nil {
-			h.respondWithError(w, http.StatusBadRequest, "Invalid end_time format (use RFC3339)")
+		req.Reason = strings.TrimSpace(req.Reason)
+		if err := models.ValidatePurpose(req.Purpose, req.Reason); err != nil {
+			h.respondWithError(w, http.StatusBadRequest, err.Error())
 			return
 		}
 
-		// Validate time range
-		if endTime.Before(startTime) || endTime.Equal(startTime) {
-			h.respondWithError(w, http.StatusBadRequest, "end_time must be after start_time")
+		startTime, endTime, err := scheduleWindow(req.StartTime, req.EndTime, &req.Timezone, req.RecurrenceRule)
+		if err != nil {
+			h.respondWithError(w, http.StatusBadRequest, err.Error())
 			return
 		}
 
@@ -130,13 +428,24 @@ func (h *ScheduleHandler) HandleRequestSchedule() http.HandlerFunc {
 			Timezone:       req.Timezone,
 			Status:         models.ScheduleStatusPending,
 			ApprovalStatus: models.ApprovalStatusPending,
-			CreatedAt:      time.Now(),
-			UpdatedAt:      time.Now(),
+			CreatedAt:      time.Now().UTC(),
+			UpdatedAt:      time.Now().UTC(),
 		}
 
 		if req.Metadata != nil {
 			schedule.Metadata = req.Metadata
 		}
+		schedule.SetPurpose(req.Purpose, req.Reason)
+
+		quorum, err := applyRiskTier(ctx, h.riskTiers, schedule)
+		if err != nil {
+			h.logger.Error("Failed to resolve the target's risk tier", map[string]interface{}{
+				"target_id": targetID.String(),
+				"error":     err.Error(),
+			})
+			h.respondWithError(w, http.StatusInternalServerError, "Failed to create schedule")
+			return
+		}
 
 		if err := h.repo.Create(ctx, schedule); err != nil {
 			h.logger.Error("Failed to create schedule", map[string]interface{}{
@@ -150,12 +459,44 @@ func (h *ScheduleHandler) HandleRequestSchedule() http.HandlerFunc {
 			"schedule_id": schedule.ID,
 			"user_id":     userID,
 			"target_id":   targetID,
+			"risk_tier":   quorum.Tier,
 		})
 
+		if quorum.AutoApprove {
+			ip := r.RemoteAddr
+			details := map[string]interface{}{
+				"schedule_id": schedule.ID.String(),
+				"channel":     models.ApprovalChannelAuto,
+				"risk_tier":   quorum.Tier,
+			}
+			if err := h.systemAuditRepo.CreateSimple(ctx, models.EventTypeScheduleApproved, nil, "Schedule approved", models.AuditStatusSuccess, &ip, details); err != nil {
+				h.logger.Error("Failed to record schedule decision audit event", map[string]interface{}{
+					"schedule_id": schedule.ID.String(),
+					"error":       err.Error(),
+				})
+			}
+		} else if h.approvals != nil {
+			// Send approvers links to decide without signing in
+			go func() {
+				ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+				defer cancel()
+				if err := h.approvals.NotifyApprovers(ctx, schedule); err != nil {
+					h.logger.Error("Failed to send approval links", map[string]interface{}{
+						"schedule_id": schedule.ID.String(),
+						"error":       err.Error(),
+					})
+				}
+			}()
+		}
+
+		// Rendered on a copy; the approval notifications read the schedule
+		created := *schedule
+		created.In(loc)
 		response := map[string]interface{}{
 			"success":  true,
 			"message":  "Schedule request created successfully",
-			"schedule": schedule,
+			"schedule": &created,
+			"quorum":   quorum.Progress(0, 0),
 		}
 
 		w.Header().Set("Content-Type", "application/json")
@@ -175,14 +516,21 @@ func (h *ScheduleHandler) HandleListSchedules() http.HandlerFunc {
 			return
 		}
 
+		loc, err := displayLocation(r)
+		if err != nil {
+			h.respondWithError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+
 		// Parse query parameters
 		targetIDStr := r.URL.Query().Get("target_id")
 		statusStr := r.URL.Query().Get("status")
 		approvalStatusStr := r.URL.Query().Get("approval_status")
 		filterUserIDStr := r.URL.Query().Get("user_id")
 
-		// Non-admins can only see their own schedules
-		if userRole != models.RoleAdmin {
+		// Non-admins can only see their own schedules. Zone admins also see those
+		// of their zones' targets, which the repository limits them to.
+		if zones, _ := actor.ZoneScope(ctx); userRole != models.RoleAdmin && len(zones) == 0 {
 			filterUserIDStr = userIDStr
 		}
 
@@ -222,6 +570,9 @@ func (h *ScheduleHandler) HandleListSchedules() http.HandlerFunc {
 			h.respondWithError(w, http.StatusInternalServerError, "Failed to list schedules")
 			return
 		}
+		for i := range schedules {
+			schedules[i].In(loc)
+		}
 
 		response := map[string]interface{}{
 			"success":   true,
@@ -233,7 +584,8 @@ func (h *ScheduleHandler) HandleListSchedules() http.HandlerFunc {
 	}
 }
 
-// HandleApproveSchedule handles schedule approval (Admin only)
+// HandleApproveSchedule handles schedule approval by admins, and by zone admins
+// for their zones' targets. The requester can't approve their own schedule.
 func (h *ScheduleHandler) HandleApproveSchedule() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		ctx := r.Context()
@@ -246,8 +598,7 @@ func (h *ScheduleHandler) HandleApproveSchedule() http.HandlerFunc {
 		}
 
 		var req ApproveScheduleRequest
-		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-			h.respondWithError(w, http.StatusBadRequest, "Invalid request body")
+		if !validate.Decode(w, r, &req) {
 			return
 		}
 
@@ -257,35 +608,61 @@ func (h *ScheduleHandler) HandleApproveSchedule() http.HandlerFunc {
 			return
 		}
 
-		// TODO: Handle start/end time modifications if provided
-		// For now, just approve
+		version, ok := h.scheduleVersion(w, r, req.Version)
+		if !ok {
+			return
+		}
 
-		if err := h.repo.UpdateApprovalStatus(ctx, scheduleID, models.ApprovalStatusApproved, nil, &userID); err != nil {
-			h.logger.Error("Failed to approve schedule", map[string]interface{}{
-				"error": err.Error(),
-			})
-			h.respondWithError(w, http.StatusInternalServerError, "Failed to approve schedule")
+		schedule, err := h.repo.GetByID(ctx, scheduleID)
+		if err != nil {
+			h.respondWithError(w, http.StatusNotFound, "Schedule not found")
+			return
+		}
+		if schedule.UserID == userID {
+			h.respondWithError(w, http.StatusForbidden, "A schedule must be approved by someone other than its requester")
 			return
 		}
 
-		// Also set status to active if start time is now or past
-		// Ideally a background job handles this, but for immediate effect:
-		// We'll just set it to active for now if it's approved.
-		// Real implementation should check time.
-		if err := h.repo.UpdateStatus(ctx, scheduleID, models.ScheduleStatusActive); err != nil {
-			h.logger.Error("Failed to activate schedule", map[string]interface{}{
-				"error": err.Error(),
-			})
+		loc, err := displayLocation(r)
+		if err != nil {
+			h.respondWithError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		window, ok := h.approvalWindow(w, r, scheduleID, &req)
+		if !ok {
+			return
+		}
+
+		progress, err := h.decide(r, scheduleID, version, userID, models.ApprovalStatusApproved, nil, models.ApprovalChannelWeb, window)
+		if errors.Is(err, repository.ErrAlreadyApproved) {
+			h.respondWithError(w, http.StatusConflict, "You have already approved this schedule")
+			return
+		}
+		if err != nil {
+			h.respondWithDecisionError(w, r, scheduleID, err, "Failed to approve schedule")
+			return
 		}
 
-		h.logger.Info("Schedule approved", map[string]interface{}{
+		h.logger.Info("Schedule approval recorded", map[string]interface{}{
 			"schedule_id": req.ScheduleID,
 			"approved_by": userIDStr,
+			"modified":    window != nil,
+			"approved":    progress.Approved,
 		})
 
+		message := "Schedule approved successfully"
+		if !progress.Approved {
+			message = "Approval recorded; the schedule needs more approvals"
+		}
 		response := map[string]interface{}{
 			"success": true,
-			"message": "Schedule approved successfully",
+			"message": message,
+			"quorum":  progress,
+		}
+		if window != nil {
+			response["start_time"] = window.schedule.StartTime.In(loc)
+			response["end_time"] = window.schedule.EndTime.In(loc)
 		}
 
 		w.Header().Set("Content-Type", "application/json")
@@ -293,7 +670,8 @@ func (h *ScheduleHandler) HandleApproveSchedule() http.HandlerFunc {
 	}
 }
 
-// HandleRejectSchedule handles schedule rejection (Admin only)
+// HandleRejectSchedule handles schedule rejection by admins, and by zone admins
+// for their zones' targets
 func (h *ScheduleHandler) HandleRejectSchedule() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		ctx := r.Context()
@@ -306,8 +684,7 @@ func (h *ScheduleHandler) HandleRejectSchedule() http.HandlerFunc {
 		}
 
 		var req RejectScheduleRequest
-		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-			h.respondWithError(w, http.StatusBadRequest, "Invalid request body")
+		if !validate.Decode(w, r, &req) {
 			return
 		}
 
@@ -322,18 +699,14 @@ func (h *ScheduleHandler) HandleRejectSchedule() http.HandlerFunc {
 			return
 		}
 
-		if err := h.repo.UpdateApprovalStatus(ctx, scheduleID, models.ApprovalStatusRejected, &req.Reason, &userID); err != nil {
-			h.logger.Error("Failed to reject schedule", map[string]interface{}{
-				"error": err.Error(),
-			})
-			h.respondWithError(w, http.StatusInternalServerError, "Failed to reject schedule")
+		version, ok := h.scheduleVersion(w, r, req.Version)
+		if !ok {
 			return
 		}
 
-		if err := h.repo.UpdateStatus(ctx, scheduleID, models.ScheduleStatusCancelled); err != nil {
-			h.logger.Error("Failed to cancel schedule", map[string]interface{}{
-				"error": err.Error(),
-			})
+		if _, err := h.decide(r, scheduleID, version, userID, models.ApprovalStatusRejected, &req.Reason, models.ApprovalChannelWeb, nil); err != nil {
+			h.respondWithDecisionError(w, r, scheduleID, err, "Failed to reject schedule")
+			return
 		}
 
 		h.logger.Info("Schedule rejected", map[string]interface{}{
@@ -0,0 +1,631 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/VanCannon/openpam/gateway/internal/middleware"
+	"github.com/VanCannon/openpam/gateway/internal/models"
+	"github.com/VanCannon/openpam/gateway/internal/repository"
+	"github.com/VanCannon/openpam/gateway/internal/schedule"
+	"github.com/VanCannon/openpam/gateway/internal/validate"
+	"github.com/VanCannon/openpam/pkg/logger"
+	"github.com/google/uuid"
+)
+
+// maxBulkEntries caps the user and target combinations of one bulk request
+const maxBulkEntries = 500
+
+// Outcomes of a bulk request entry
+const (
+	bulkEntryValid    = "valid"    // Would be created; preview only
+	bulkEntryCreated  = "created"  // Created, awaiting approval
+	bulkEntryApproved = "approved" // Created and approved, as its target's risk tier is auto-approved
+	bulkEntryInvalid  = "invalid"  // The user or target can't be scheduled
+	bulkEntryFailed   = "failed"   // Valid, but storing the schedule failed
+)
+
+// ScheduleBatchHandler handles bulk schedule creation and the batches that
+// link bulk-created schedules
+type ScheduleBatchHandler struct {
+	schedules *repository.ScheduleRepository
+	riskTiers *repository.RiskTierRepository
+	users     *repository.UserRepository
+	targets   *repository.TargetRepository
+	auditRepo *repository.SystemAuditLogRepository
+	sessions  *schedule.Sessions
+	logger    *logger.Logger
+}
+
+// NewScheduleBatchHandler creates a new schedule batch handler. Revoking a
+// batch ends the sessions in sessions that no schedule covers anymore.
+func NewScheduleBatchHandler(
+	schedules *repository.ScheduleRepository,
+	riskTiers *repository.RiskTierRepository,
+	users *repository.UserRepository,
+	targets *repository.TargetRepository,
+	auditRepo *repository.SystemAuditLogRepository,
+	sessions *schedule.Sessions,
+	log *logger.Logger,
+) *ScheduleBatchHandler {
+	return &ScheduleBatchHandler{
+		schedules: schedules,
+		riskTiers: riskTiers,
+		users:     users,
+		targets:   targets,
+		auditRepo: auditRepo,
+		sessions:  sessions,
+		logger:    log,
+	}
+}
+
+// BulkScheduleRequest requests the same window for every combination of the
+// given users and targets
+type BulkScheduleRequest struct {
+	UserIDs        []string               `json:"user_ids"`
+	TargetIDs      []string               `json:"target_ids,omitempty"`
+	ZoneIDs        []string               `json:"zone_ids,omitempty"` // Adds the enabled targets of the zones
+	StartTime      string                 `json:"start_time"`         // RFC3339, or a local time in Timezone
+	EndTime        string                 `json:"end_time"`           // RFC3339, or a local time in Timezone
+	RecurrenceRule *string                `json:"recurrence_rule,omitempty"`
+	Timezone       string                 `json:"timezone"`
+	Metadata       map[string]interface{} `json:"metadata,omitempty"`
+	Preview        bool                   `json:"preview"`        // Validate only; nothing is created
+	Link           bool                   `json:"link"`           // Link the schedules in a batch
+	Name           string                 `json:"name,omitempty"` // Name of the batch
+}
+
+// BulkScheduleEntry is the outcome of a bulk request for one user and target
+type BulkScheduleEntry struct {
+	UserID     string     `json:"user_id"`
+	TargetID   string     `json:"target_id"`
+	Status     string     `json:"status"`
+	ScheduleID *uuid.UUID `json:"schedule_id,omitempty"`
+	RiskTier   string     `json:"risk_tier,omitempty"` // The target's tier, once created
+	Error      string     `json:"error,omitempty"`
+}
+
+// HandleBulkCreate creates a schedule for every combination of users and
+// targets in the request (Admin only). Each combination is checked on its
+// own, so the valid ones are created even if others are not; in preview mode
+// they are only checked.
+// Route: POST /api/v1/schedules/bulk
+func (h *ScheduleBatchHandler) HandleBulkCreate() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+
+		var req BulkScheduleRequest
+		if !validate.Decode(w, r, &req) {
+			return
+		}
+
+		loc, err := displayLocation(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		startTime, endTime, err := scheduleWindow(req.StartTime, req.EndTime, &req.Timezone, req.RecurrenceRule)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		if len(req.UserIDs) == 0 || (len(req.TargetIDs) == 0 && len(req.ZoneIDs) == 0) {
+			http.Error(w, "At least one user and one target or zone are required", http.StatusBadRequest)
+			return
+		}
+
+		zoneIDs := make([]uuid.UUID, 0, len(req.ZoneIDs))
+		for _, raw := range req.ZoneIDs {
+			id, err := uuid.Parse(raw)
+			if err != nil {
+				http.Error(w, "Invalid zone_id: "+raw, http.StatusBadRequest)
+				return
+			}
+			zoneIDs = append(zoneIDs, id)
+		}
+
+		userIDs, userErrs, err := h.resolveUsers(r, req.UserIDs)
+		if err != nil {
+			h.logger.Error("Failed to look up bulk schedule users", map[string]interface{}{
+				"error": err.Error(),
+			})
+			http.Error(w, "Failed to look up users", http.StatusInternalServerError)
+			return
+		}
+		targetIDs, targetErrs, err := h.resolveTargets(r, req.TargetIDs, zoneIDs)
+		if err != nil {
+			h.logger.Error("Failed to look up bulk schedule targets", map[string]interface{}{
+				"error": err.Error(),
+			})
+			http.Error(w, "Failed to look up targets", http.StatusInternalServerError)
+			return
+		}
+		if len(targetIDs) == 0 {
+			http.Error(w, "The zones have no enabled targets", http.StatusBadRequest)
+			return
+		}
+		if len(userIDs)*len(targetIDs) > maxBulkEntries {
+			http.Error(w, fmt.Sprintf("A bulk request can create at most %d schedules", maxBulkEntries), http.StatusBadRequest)
+			return
+		}
+
+		entries := make([]BulkScheduleEntry, 0, len(userIDs)*len(targetIDs))
+		for _, userID := range userIDs {
+			for _, targetID := range targetIDs {
+				entry := BulkScheduleEntry{UserID: userID, TargetID: targetID, Status: bulkEntryValid}
+				if msg := userErrs[userID]; msg != "" {
+					entry.Status, entry.Error = bulkEntryInvalid, msg
+				} else if msg := targetErrs[targetID]; msg != "" {
+					entry.Status, entry.Error = bulkEntryInvalid, msg
+				}
+				entries = append(entries, entry)
+			}
+		}
+
+		if req.Preview {
+			h.respondWithEntries(w, http.StatusOK, true, nil, entries, loc)
+			return
+		}
+
+		var batch *models.ScheduleBatch
+		if req.Link && countEntries(entries, bulkEntryValid) > 0 {
+			batch = &models.ScheduleBatch{}
+			if name := strings.TrimSpace(req.Name); name != "" {
+				batch.Name = &name
+			}
+			if err := h.schedules.CreateBatch(ctx, batch); err != nil {
+				h.logger.Error("Failed to create schedule batch", map[string]interface{}{
+					"error": err.Error(),
+				})
+				http.Error(w, "Failed to create schedule batch", http.StatusInternalServerError)
+				return
+			}
+		}
+
+		for i := range entries {
+			entry := &entries[i]
+			if entry.Status != bulkEntryValid {
+				continue
+			}
+
+			now := time.Now().UTC()
+			s := &models.Schedule{
+				ID:             uuid.New(),
+				UserID:         uuid.MustParse(entry.UserID),
+				TargetID:       uuid.MustParse(entry.TargetID),
+				StartTime:      startTime,
+				EndTime:        endTime,
+				RecurrenceRule: req.RecurrenceRule,
+				Timezone:       req.Timezone,
+				Status:         models.ScheduleStatusPending,
+				ApprovalStatus: models.ApprovalStatusPending,
+				CreatedAt:      now,
+				UpdatedAt:      now,
+				Metadata:       req.Metadata,
+			}
+			if batch != nil {
+				s.BatchID = &batch.ID
+			}
+
+			quorum, err := applyRiskTier(ctx, h.riskTiers, s)
+			if err != nil {
+				h.logger.Error("Failed to resolve bulk schedule risk tier", map[string]interface{}{
+					"target_id": entry.TargetID,
+					"error":     err.Error(),
+				})
+				entry.Status, entry.Error = bulkEntryFailed, "Failed to resolve the target's risk tier"
+				continue
+			}
+			entry.RiskTier = quorum.Tier
+
+			if err := h.schedules.Create(ctx, s); err != nil {
+				h.logger.Error("Failed to create bulk schedule", map[string]interface{}{
+					"user_id":   entry.UserID,
+					"target_id": entry.TargetID,
+					"error":     err.Error(),
+				})
+				entry.Status, entry.Error = bulkEntryFailed, "Failed to create schedule"
+				continue
+			}
+			entry.Status, entry.ScheduleID = bulkEntryCreated, &s.ID
+			if quorum.AutoApprove {
+				entry.Status = bulkEntryApproved
+				h.recordEvent(r, models.EventTypeScheduleApproved, "Schedule approved", map[string]interface{}{
+					"schedule_id": s.ID.String(),
+					"channel":     models.ApprovalChannelAuto,
+					"risk_tier":   quorum.Tier,
+				})
+			}
+		}
+
+		created := countEntries(entries, bulkEntryCreated) + countEntries(entries, bulkEntryApproved)
+		details := map[string]interface{}{
+			"users":   len(userIDs),
+			"targets": len(targetIDs),
+			"created": created,
+			"invalid": countEntries(entries, bulkEntryInvalid),
+			"failed":  countEntries(entries, bulkEntryFailed),
+		}
+		if batch != nil {
+			details["batch_id"] = batch.ID.String()
+		}
+		h.recordEvent(r, models.EventTypeScheduleBatchCreated, "Bulk schedules requested", details)
+
+		h.logger.Info("Bulk schedules requested", details)
+
+		status := http.StatusCreated
+		if created == 0 {
+			status = http.StatusUnprocessableEntity
+		}
+		h.respondWithEntries(w, status, false, batch, entries, loc)
+	}
+}
+
+// HandleGetBatch returns a batch with its schedules (Admin only)
+// Route: GET /api/v1/schedule-batches/{id}
+func (h *ScheduleBatchHandler) HandleGetBatch() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		loc, err := displayLocation(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		batch, ok := h.loadBatch(w, r)
+		if !ok {
+			return
+		}
+
+		schedules, err := h.schedules.ListByBatch(r.Context(), batch.ID)
+		if err != nil {
+			h.logger.Error("Failed to list batch schedules", map[string]interface{}{
+				"batch_id": batch.ID.String(),
+				"error":    err.Error(),
+			})
+			http.Error(w, "Failed to list batch schedules", http.StatusInternalServerError)
+			return
+		}
+
+		batch.CreatedAt = batch.CreatedAt.In(loc)
+		for i := range schedules {
+			schedules[i].In(loc)
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"batch":     batch,
+			"schedules": schedules,
+			"count":     len(schedules),
+		})
+	}
+}
+
+// HandleApproveBatch records the caller's approval of the schedules of a batch
+// that are still awaiting approval (Admin only). Each counts towards its own
+// quorum, so schedules of tiers needing more approvers stay pending.
+// Route: POST /api/v1/schedule-batches/{id}/approve
+func (h *ScheduleBatchHandler) HandleApproveBatch() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		approverID, err := uuid.Parse(middleware.GetUserID(ctx))
+		if err != nil {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		batch, ok := h.loadBatch(w, r)
+		if !ok {
+			return
+		}
+
+		schedules, err := h.schedules.ListByBatch(ctx, batch.ID)
+		if err != nil {
+			h.logger.Error("Failed to list batch schedules", map[string]interface{}{
+				"batch_id": batch.ID.String(),
+				"error":    err.Error(),
+			})
+			http.Error(w, "Failed to approve batch", http.StatusInternalServerError)
+			return
+		}
+
+		approved, awaiting := []uuid.UUID{}, []uuid.UUID{}
+		for _, s := range schedules {
+			if s.ApprovalStatus != models.ApprovalStatusPending {
+				continue
+			}
+			if s.UserID == approverID {
+				// The requester's vote doesn't count towards the quorum
+				awaiting = append(awaiting, s.ID)
+				continue
+			}
+
+			quorum, err := quorumOf(ctx, h.riskTiers, &s)
+			if err != nil {
+				h.logger.Error("Failed to get batch schedule approval quorum", map[string]interface{}{
+					"schedule_id": s.ID.String(),
+					"error":       err.Error(),
+				})
+				continue
+			}
+
+			progress, err := h.schedules.RecordApproval(ctx, s.ID, s.Version, approverID, models.ApprovalChannelWeb, quorum, nil)
+			if errors.Is(err, repository.ErrAlreadyApproved) {
+				awaiting = append(awaiting, s.ID)
+				continue
+			}
+			if err != nil {
+				h.logger.Error("Failed to approve batch schedule", map[string]interface{}{
+					"schedule_id": s.ID.String(),
+					"error":       err.Error(),
+				})
+				continue
+			}
+
+			eventType, action := models.EventTypeScheduleApproved, "Schedule approved"
+			if progress.Approved {
+				approved = append(approved, s.ID)
+			} else {
+				eventType, action = models.EventTypeScheduleApprovalRecorded, "Schedule approval recorded"
+				awaiting = append(awaiting, s.ID)
+			}
+			h.recordEvent(r, eventType, action, map[string]interface{}{
+				"schedule_id":        s.ID.String(),
+				"batch_id":           batch.ID.String(),
+				"channel":            models.ApprovalChannelWeb,
+				"risk_tier":          progress.Tier,
+				"approvals":          progress.Approvals,
+				"required_approvals": progress.RequiredApprovals,
+			})
+		}
+
+		h.logger.Info("Schedule batch approved", map[string]interface{}{
+			"batch_id":    batch.ID.String(),
+			"approved_by": approverID.String(),
+			"approved":    len(approved),
+			"awaiting":    len(awaiting),
+		})
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"success":      true,
+			"batch_id":     batch.ID,
+			"schedule_ids": approved,
+			"count":        len(approved),
+			"awaiting_ids": awaiting, // Still short of their quorum
+		})
+	}
+}
+
+// HandleRevokeBatch cancels the schedules of a batch that haven't ended
+// (Admin only). Schedules still awaiting approval are rejected, and sessions
+// that no schedule covers anymore are ended.
+// Route: POST /api/v1/schedule-batches/{id}/revoke
+func (h *ScheduleBatchHandler) HandleRevokeBatch() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Reason string `json:"reason"`
+		}
+		if !validate.Decode(w, r, &req) {
+			return
+		}
+		if strings.TrimSpace(req.Reason) == "" {
+			http.Error(w, "Reason is required", http.StatusBadRequest)
+			return
+		}
+
+		batch, ok := h.loadBatch(w, r)
+		if !ok {
+			return
+		}
+
+		revoked, err := h.schedules.RevokeBatch(r.Context(), batch.ID, req.Reason)
+		if err != nil {
+			h.logger.Error("Failed to revoke schedule batch", map[string]interface{}{
+				"batch_id": batch.ID.String(),
+				"error":    err.Error(),
+			})
+			http.Error(w, "Failed to revoke batch", http.StatusInternalServerError)
+			return
+		}
+
+		ids := make([]uuid.UUID, len(revoked))
+		for i, s := range revoked {
+			ids[i] = s.ID
+			h.recordEvent(r, models.EventTypeScheduleRevoked, "Schedule revoked", map[string]interface{}{
+				"schedule_id": s.ID.String(),
+				"batch_id":    batch.ID.String(),
+				"reason":      req.Reason,
+			})
+			h.sessions.Recheck(s.UserID, s.TargetID)
+		}
+
+		h.logger.Info("Schedule batch revoked", map[string]interface{}{
+			"batch_id": batch.ID.String(),
+			"revoked":  len(revoked),
+			"reason":   req.Reason,
+		})
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"success":      true,
+			"batch_id":     batch.ID,
+			"schedule_ids": ids,
+			"count":        len(ids),
+		})
+	}
+}
+
+// resolveUsers parses and deduplicates the users of a bulk request, keeping
+// their order, and returns why each one that can't be scheduled can't be
+func (h *ScheduleBatchHandler) resolveUsers(r *http.Request, raw []string) ([]string, map[string]string, error) {
+	ids, errs := parseBulkIDs(raw, "Invalid user_id")
+
+	users, err := h.users.ListByIDs(r.Context(), parsedIDs(ids, errs))
+	if err != nil {
+		return nil, nil, err
+	}
+	found := make(map[string]*models.User, len(users))
+	for _, u := range users {
+		found[u.ID.String()] = u
+	}
+
+	for _, id := range ids {
+		if errs[id] != "" {
+			continue
+		}
+		switch u := found[id]; {
+		case u == nil:
+			errs[id] = "User not found"
+		case !u.Enabled:
+			errs[id] = "User is disabled"
+		}
+	}
+	return ids, errs, nil
+}
+
+// resolveTargets parses and deduplicates the targets of a bulk request
+// followed by the enabled targets of its zones, keeping their order, and
+// returns why each one that can't be scheduled can't be
+func (h *ScheduleBatchHandler) resolveTargets(r *http.Request, rawTargets []string, zoneIDs []uuid.UUID) ([]string, map[string]string, error) {
+	ids, errs := parseBulkIDs(rawTargets, "Invalid target_id")
+
+	targets, err := h.targets.ListByIDs(r.Context(), parsedIDs(ids, errs))
+	if err != nil {
+		return nil, nil, err
+	}
+	found := make(map[string]*models.Target, len(targets))
+	for _, t := range targets {
+		found[t.ID.String()] = t
+	}
+	for _, id := range ids {
+		if errs[id] != "" {
+			continue
+		}
+		switch t := found[id]; {
+		case t == nil:
+			errs[id] = "Target not found"
+		case !t.Enabled:
+			errs[id] = "Target is disabled"
+		}
+	}
+
+	if len(zoneIDs) == 0 {
+		return ids, errs, nil
+	}
+	zoneTargets, err := h.targets.ListByZones(r.Context(), zoneIDs)
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, t := range zoneTargets {
+		id := t.ID.String()
+		if _, seen := errs[id]; !seen {
+			ids = append(ids, id)
+			errs[id] = ""
+		}
+	}
+	return ids, errs, nil
+}
+
+// parseBulkIDs deduplicates IDs in their canonical form, keeping their order.
+// Those that don't parse are reported with invalid.
+func parseBulkIDs(raw []string, invalid string) ([]string, map[string]string) {
+	ids := make([]string, 0, len(raw))
+	errs := make(map[string]string, len(raw))
+	for _, value := range raw {
+		id := value
+		msg := invalid
+		if parsed, err := uuid.Parse(value); err == nil {
+			id, msg = parsed.String(), ""
+		}
+		if _, seen := errs[id]; seen {
+			continue
+		}
+		ids = append(ids, id)
+		errs[id] = msg
+	}
+	return ids, errs
+}
+
+// parsedIDs returns the IDs that parsed
+func parsedIDs(ids []string, errs map[string]string) []uuid.UUID {
+	parsed := make([]uuid.UUID, 0, len(ids))
+	for _, id := range ids {
+		if errs[id] == "" {
+			parsed = append(parsed, uuid.MustParse(id))
+		}
+	}
+	return parsed
+}
+
+// countEntries counts the entries with a status
+func countEntries(entries []BulkScheduleEntry, status string) int {
+	n := 0
+	for _, e := range entries {
+		if e.Status == status {
+			n++
+		}
+	}
+	return n
+}
+
+// respondWithEntries sends the outcome of a bulk request
+func (h *ScheduleBatchHandler) respondWithEntries(w http.ResponseWriter, status int, preview bool, batch *models.ScheduleBatch, entries []BulkScheduleEntry, loc *time.Location) {
+	response := map[string]interface{}{
+		"success":  status < http.StatusBadRequest,
+		"preview":  preview,
+		"valid":    countEntries(entries, bulkEntryValid),
+		"created":  countEntries(entries, bulkEntryCreated) + countEntries(entries, bulkEntryApproved),
+		"approved": countEntries(entries, bulkEntryApproved),
+		"invalid":  countEntries(entries, bulkEntryInvalid),
+		"failed":   countEntries(entries, bulkEntryFailed),
+		"entries":  entries,
+	}
+	if batch != nil {
+		batch.CreatedAt = batch.CreatedAt.In(loc)
+		response["batch"] = batch
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(response)
+}
+
+// loadBatch resolves the batch in the path, responding with an error if it
+// doesn't exist
+func (h *ScheduleBatchHandler) loadBatch(w http.ResponseWriter, r *http.Request) (*models.ScheduleBatch, bool) {
+	id, err := uuid.Parse(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, "Invalid batch ID", http.StatusBadRequest)
+		return nil, false
+	}
+
+	batch, err := h.schedules.GetBatch(r.Context(), id)
+	if err != nil {
+		http.Error(w, "Batch not found", http.StatusNotFound)
+		return nil, false
+	}
+
+	return batch, true
+}
+
+// recordEvent records a system audit event for the caller
+func (h *ScheduleBatchHandler) recordEvent(r *http.Request, eventType, action string, details map[string]interface{}) {
+	var userID *uuid.UUID
+	if id, err := uuid.Parse(middleware.GetUserID(r.Context())); err == nil {
+		userID = &id
+	}
+
+	ip := r.RemoteAddr
+	if err := h.auditRepo.CreateSimple(r.Context(), eventType, userID, action, models.AuditStatusSuccess, &ip, details); err != nil {
+		h.logger.Error("Failed to record schedule batch audit event", map[string]interface{}{
+			"event_type": eventType,
+			"error":      err.Error(),
+		})
+	}
+}
@@ -0,0 +1,406 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/VanCannon/openpam/gateway/internal/middleware"
+	"github.com/VanCannon/openpam/gateway/internal/models"
+	"github.com/VanCannon/openpam/gateway/internal/repository"
+	"github.com/VanCannon/openpam/gateway/internal/schedule"
+	"github.com/VanCannon/openpam/gateway/internal/validate"
+	"github.com/VanCannon/openpam/pkg/logger"
+	"github.com/google/uuid"
+)
+
+// ScheduleExtensionHandler handles requests to extend a running schedule
+type ScheduleExtensionHandler struct {
+	schedules   *repository.ScheduleRepository
+	extensions  *repository.ScheduleExtensionRepository
+	auditRepo   *repository.SystemAuditLogRepository
+	sessions    *schedule.Sessions
+	autoApprove int // Longest extension in minutes approved without an admin
+	maxMinutes  int // Longest extension in minutes that may be requested
+	logger      *logger.Logger
+}
+
+// NewScheduleExtensionHandler creates a new schedule extension handler.
+// Extensions of up to autoApprove minutes are approved right away; approved
+// extensions postpone the end of the user's sessions in sessions.
+func NewScheduleExtensionHandler(
+	schedules *repository.ScheduleRepository,
+	extensions *repository.ScheduleExtensionRepository,
+	auditRepo *repository.SystemAuditLogRepository,
+	sessions *schedule.Sessions,
+	autoApprove, maxMinutes int,
+	log *logger.Logger,
+) *ScheduleExtensionHandler {
+	return &ScheduleExtensionHandler{
+		schedules:   schedules,
+		extensions:  extensions,
+		auditRepo:   auditRepo,
+		sessions:    sessions,
+		autoApprove: autoApprove,
+		maxMinutes:  maxMinutes,
+		logger:      log,
+	}
+}
+
+// HandleExtend requests an extension of one of the caller's schedules. It
+// must be approved and its window must not have ended. Extensions the policy
+// allows are approved right away; the others wait for an admin.
+// Route: POST /api/v1/schedules/{id}/extend
+func (h *ScheduleExtensionHandler) HandleExtend() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+
+		s, ok := h.loadSchedule(w, r)
+		if !ok {
+			return
+		}
+		if s.UserID.String() != middleware.GetUserID(ctx) && middleware.GetUserRole(ctx) != models.RoleAdmin {
+			http.Error(w, "You can only extend your own schedules", http.StatusForbidden)
+			return
+		}
+
+		var req struct {
+			Minutes int    `json:"minutes"`
+			Reason  string `json:"reason"`
+		}
+		if !validate.Decode(w, r, &req) {
+			return
+		}
+		if req.Minutes < 1 || req.Minutes > h.maxMinutes {
+			http.Error(w, fmt.Sprintf("minutes must be between 1 and %d", h.maxMinutes), http.StatusBadRequest)
+			return
+		}
+
+		if s.RecurrenceRule != nil && *s.RecurrenceRule != "" {
+			http.Error(w, "Recurring schedules can't be extended", http.StatusBadRequest)
+			return
+		}
+		if s.ApprovalStatus != models.ApprovalStatusApproved || s.Status == models.ScheduleStatusCancelled || !s.EndTime.After(time.Now()) {
+			http.Error(w, "Only approved schedules that haven't ended can be extended", http.StatusConflict)
+			return
+		}
+
+		ext := &models.ScheduleExtension{
+			ScheduleID: s.ID,
+			Minutes:    req.Minutes,
+		}
+		if id, err := uuid.Parse(middleware.GetUserID(ctx)); err == nil {
+			ext.RequestedBy = &id
+		}
+		if reason := strings.TrimSpace(req.Reason); reason != "" {
+			ext.Reason = &reason
+		}
+
+		if err := h.extensions.Create(ctx, ext); err != nil {
+			if errors.Is(err, repository.ErrExtensionPending) {
+				http.Error(w, "This schedule already has a pending extension", http.StatusConflict)
+				return
+			}
+			h.logger.Error("Failed to create schedule extension", map[string]interface{}{
+				"schedule_id": s.ID.String(),
+				"error":       err.Error(),
+			})
+			http.Error(w, "Failed to request extension", http.StatusInternalServerError)
+			return
+		}
+
+		autoApproved := req.Minutes <= h.autoApprove
+		h.recordEvent(r, models.EventTypeScheduleExtensionRequested, "request_schedule_extension", map[string]interface{}{
+			"schedule_id":   s.ID.String(),
+			"extension_id":  ext.ID.String(),
+			"minutes":       ext.Minutes,
+			"reason":        req.Reason,
+			"auto_approved": autoApproved,
+		})
+
+		if autoApproved {
+			approved, err := h.approve(r, s, ext.ID, nil)
+			if err != nil {
+				h.respondWithApproveError(w, ext.ID, err)
+				return
+			}
+			ext = approved
+		}
+
+		h.logger.Info("Schedule extension requested", map[string]interface{}{
+			"schedule_id":   s.ID.String(),
+			"extension_id":  ext.ID.String(),
+			"minutes":       ext.Minutes,
+			"auto_approved": autoApproved,
+		})
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(ext)
+	}
+}
+
+// HandleList lists a schedule's extensions, oldest first. Users may only see
+// those of their own schedules.
+// Route: GET /api/v1/schedules/{id}/extensions
+func (h *ScheduleExtensionHandler) HandleList() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		loc, err := displayLocation(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		s, ok := h.loadSchedule(w, r)
+		if !ok {
+			return
+		}
+
+		extensions, err := h.extensions.ListBySchedule(r.Context(), s.ID)
+		if err != nil {
+			h.logger.Error("Failed to list schedule extensions", map[string]interface{}{
+				"schedule_id": s.ID.String(),
+				"error":       err.Error(),
+			})
+			http.Error(w, "Failed to list extensions", http.StatusInternalServerError)
+			return
+		}
+		for _, ext := range extensions {
+			ext.In(loc)
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"extensions": extensions,
+			"count":      len(extensions),
+		})
+	}
+}
+
+// HandleListPending lists the extensions waiting for a decision (Admin only)
+// Route: GET /api/v1/schedules/extensions
+func (h *ScheduleExtensionHandler) HandleListPending() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		loc, err := displayLocation(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		extensions, err := h.extensions.ListPending(r.Context())
+		if err != nil {
+			h.logger.Error("Failed to list pending schedule extensions", map[string]interface{}{
+				"error": err.Error(),
+			})
+			http.Error(w, "Failed to list extensions", http.StatusInternalServerError)
+			return
+		}
+		for _, ext := range extensions {
+			ext.In(loc)
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"extensions": extensions,
+			"count":      len(extensions),
+		})
+	}
+}
+
+// HandleApprove approves a pending extension, moving the end of its schedule (Admin only)
+// Route: POST /api/v1/schedules/extensions/{id}/approve
+func (h *ScheduleExtensionHandler) HandleApprove() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ext, s, deciderID, ok := h.loadDecision(w, r)
+		if !ok {
+			return
+		}
+
+		approved, err := h.approve(r, s, ext.ID, &deciderID)
+		if err != nil {
+			h.respondWithApproveError(w, ext.ID, err)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(approved)
+	}
+}
+
+// HandleReject rejects a pending extension (Admin only)
+// Route: POST /api/v1/schedules/extensions/{id}/reject
+func (h *ScheduleExtensionHandler) HandleReject() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Reason string `json:"reason"`
+		}
+		if !validate.Decode(w, r, &req) {
+			return
+		}
+		if strings.TrimSpace(req.Reason) == "" {
+			http.Error(w, "Reason is required", http.StatusBadRequest)
+			return
+		}
+
+		ext, _, deciderID, ok := h.loadDecision(w, r)
+		if !ok {
+			return
+		}
+
+		rejected, err := h.extensions.Reject(r.Context(), ext.ID, deciderID, req.Reason, time.Now())
+		if err != nil {
+			if errors.Is(err, repository.ErrExtensionClosed) {
+				http.Error(w, "Extension is no longer pending", http.StatusConflict)
+				return
+			}
+			h.logger.Error("Failed to reject schedule extension", map[string]interface{}{
+				"extension_id": ext.ID.String(),
+				"error":        err.Error(),
+			})
+			http.Error(w, "Failed to reject extension", http.StatusInternalServerError)
+			return
+		}
+
+		h.recordEvent(r, models.EventTypeScheduleExtensionRejected, "reject_schedule_extension", map[string]interface{}{
+			"schedule_id":  ext.ScheduleID.String(),
+			"extension_id": ext.ID.String(),
+			"reason":       req.Reason,
+		})
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(rejected)
+	}
+}
+
+// approve approves an extension, records it with the schedule's extension
+// chain and postpones the end of the user's running sessions on the target.
+// decidedBy is nil for extensions approved by policy.
+func (h *ScheduleExtensionHandler) approve(r *http.Request, s *models.Schedule, extensionID uuid.UUID, decidedBy *uuid.UUID) (*models.ScheduleExtension, error) {
+	ctx := r.Context()
+	ext, err := h.extensions.Approve(ctx, extensionID, decidedBy, time.Now())
+	if err != nil {
+		return nil, err
+	}
+
+	extended := h.sessions.Extend(s.UserID, s.TargetID, *ext.NewEndTime)
+
+	details := map[string]interface{}{
+		"schedule_id":       s.ID.String(),
+		"extension_id":      ext.ID.String(),
+		"minutes":           ext.Minutes,
+		"previous_end_time": ext.PreviousEndTime,
+		"new_end_time":      ext.NewEndTime,
+		"auto_approved":     ext.AutoApproved,
+		"sessions_extended": extended,
+	}
+	// The chain runs from the originally approved end to this extension
+	if all, err := h.extensions.ListBySchedule(ctx, s.ID); err == nil {
+		var chain []string
+		for _, e := range all {
+			if e.Status != models.ExtensionStatusApproved {
+				continue
+			}
+			if len(chain) == 0 {
+				details["original_end_time"] = e.PreviousEndTime
+			}
+			chain = append(chain, e.ID.String())
+		}
+		details["chain"] = chain
+	}
+	h.recordEvent(r, models.EventTypeScheduleExtended, "extend_schedule", details)
+
+	h.logger.Info("Schedule extended", map[string]interface{}{
+		"schedule_id":       s.ID.String(),
+		"extension_id":      ext.ID.String(),
+		"new_end_time":      ext.NewEndTime,
+		"sessions_extended": extended,
+	})
+
+	return ext, nil
+}
+
+// respondWithApproveError maps a failed approval to a response
+func (h *ScheduleExtensionHandler) respondWithApproveError(w http.ResponseWriter, extensionID uuid.UUID, err error) {
+	switch {
+	case errors.Is(err, repository.ErrExtensionClosed):
+		http.Error(w, "Extension is no longer pending", http.StatusConflict)
+	case errors.Is(err, repository.ErrScheduleNotRunning):
+		http.Error(w, "The schedule has ended or was cancelled", http.StatusConflict)
+	default:
+		h.logger.Error("Failed to approve schedule extension", map[string]interface{}{
+			"extension_id": extensionID.String(),
+			"error":        err.Error(),
+		})
+		http.Error(w, "Failed to approve extension", http.StatusInternalServerError)
+	}
+}
+
+// loadSchedule resolves the schedule in the path, responding with an error if
+// it doesn't exist or isn't the caller's. Admins may act on any schedule.
+func (h *ScheduleExtensionHandler) loadSchedule(w http.ResponseWriter, r *http.Request) (*models.Schedule, bool) {
+	id, err := uuid.Parse(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, "Invalid schedule ID", http.StatusBadRequest)
+		return nil, false
+	}
+
+	s, err := h.schedules.GetByID(r.Context(), id)
+	if err != nil || (s.UserID.String() != middleware.GetUserID(r.Context()) && !canReview(r)) {
+		http.Error(w, "Schedule not found", http.StatusNotFound)
+		return nil, false
+	}
+
+	return s, true
+}
+
+// loadDecision resolves the pending extension in the path and its schedule
+// for an admin to decide, responding with an error if they can't
+func (h *ScheduleExtensionHandler) loadDecision(w http.ResponseWriter, r *http.Request) (*models.ScheduleExtension, *models.Schedule, uuid.UUID, bool) {
+	ctx := r.Context()
+	id, err := uuid.Parse(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, "Invalid extension ID", http.StatusBadRequest)
+		return nil, nil, uuid.Nil, false
+	}
+
+	ext, err := h.extensions.GetByID(ctx, id)
+	if err != nil {
+		http.Error(w, "Extension not found", http.StatusNotFound)
+		return nil, nil, uuid.Nil, false
+	}
+	s, err := h.schedules.GetByID(ctx, ext.ScheduleID)
+	if err != nil {
+		http.Error(w, "Schedule not found", http.StatusNotFound)
+		return nil, nil, uuid.Nil, false
+	}
+
+	deciderID, err := uuid.Parse(middleware.GetUserID(ctx))
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return nil, nil, uuid.Nil, false
+	}
+	if deciderID == s.UserID {
+		http.Error(w, "You can't decide an extension of your own schedule", http.StatusForbidden)
+		return nil, nil, uuid.Nil, false
+	}
+
+	return ext, s, deciderID, true
+}
+
+func (h *ScheduleExtensionHandler) recordEvent(r *http.Request, eventType, action string, details map[string]interface{}) {
+	var userID *uuid.UUID
+	if id, err := uuid.Parse(middleware.GetUserID(r.Context())); err == nil {
+		userID = &id
+	}
+
+	ip := r.RemoteAddr
+	if err := h.auditRepo.CreateSimple(r.Context(), eventType, userID, action, models.AuditStatusSuccess, &ip, details); err != nil {
+		h.logger.Error("Failed to record schedule extension audit event", map[string]interface{}{
+			"event_type": eventType,
+			"error":      err.Error(),
+		})
+	}
+}
@@ -0,0 +1,210 @@
+package handlers
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/VanCannon/openpam/gateway/internal/models"
+	"github.com/VanCannon/openpam/gateway/internal/repository"
+	"github.com/VanCannon/openpam/pkg/logger"
+	"github.com/google/uuid"
+)
+
+func TestParseScheduleTime(t *testing.T) {
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	if err != nil {
+		t.Skip("tz database not available")
+	}
+
+	tests := []struct {
+		name    string
+		value   string
+		want    time.Time
+		wantErr bool
+	}{
+		{name: "RFC3339 keeps its offset", value: "2025-01-24T10:00:00-05:00", want: time.Date(2025, 1, 24, 15, 0, 0, 0, time.UTC)},
+		{name: "Local in winter", value: "2025-01-24T10:00:00", want: time.Date(2025, 1, 24, 9, 0, 0, 0, time.UTC)},
+		{name: "Local in summer", value: "2025-07-24T10:00:00", want: time.Date(2025, 7, 24, 8, 0, 0, 0, time.UTC)},
+		{name: "Local in the DST gap", value: "2025-03-30T02:30:00", want: time.Date(2025, 3, 30, 1, 30, 0, 0, time.UTC)},
+		{name: "Not a time", value: "tomorrow", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseScheduleTime(tt.value, berlin)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseScheduleTime() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && (!got.Equal(tt.want) || got.Location() != time.UTC) {
+				t.Errorf("parseScheduleTime() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseBulkIDs(t *testing.T) {
+	id := "0b6a3e4c-6f1d-4c57-9d1e-2f3a4b5c6d7e"
+	ids, errs := parseBulkIDs([]string{id, "nope", "0B6A3E4C-6F1D-4C57-9D1E-2F3A4B5C6D7E", "nope"}, "Invalid user_id")
+
+	if len(ids) != 2 || ids[0] != id || ids[1] != "nope" {
+		t.Fatalf("ids = %v", ids)
+	}
+	if errs[id] != "" || errs["nope"] != "Invalid user_id" {
+		t.Errorf("errs = %v", errs)
+	}
+	if parsed := parsedIDs(ids, errs); len(parsed) != 1 || parsed[0].String() != id {
+		t.Errorf("parsed = %v", parsed)
+	}
+}
+
+func TestDisplayLocation(t *testing.T) {
+	loc, err := displayLocation(httptest.NewRequest("GET", "/api/v1/schedules", nil))
+	if err != nil || loc != time.UTC {
+		t.Errorf("default = %v, %v, want UTC", loc, err)
+	}
+
+	loc, err = displayLocation(httptest.NewRequest("GET", "/api/v1/schedules?tz=Asia/Tokyo", nil))
+	if err != nil || loc.String() != "Asia/Tokyo" {
+		t.Errorf("tz=Asia/Tokyo gave %v, %v", loc, err)
+	}
+
+	if _, err := displayLocation(httptest.NewRequest("GET", "/api/v1/schedules?tz=Mars/Olympus", nil)); err == nil {
+		t.Error("unknown tz was accepted")
+	}
+}
+
+func TestResolveApprovalWindow(t *testing.T) {
+	now := time.Date(2025, 5, 1, 12, 0, 0, 0, time.UTC)
+	start := time.Date(2025, 5, 2, 9, 0, 0, 0, time.UTC)
+	end := time.Date(2025, 5, 2, 17, 0, 0, 0, time.UTC)
+	at := func(v string) *string { return &v }
+
+	tests := []struct {
+		name      string
+		req       ApproveScheduleRequest
+		wantErr   string
+		unchanged bool
+		wantStart time.Time
+		wantEnd   time.Time
+	}{
+		{
+			name:      "Both times moved",
+			req:       ApproveScheduleRequest{StartTime: at("2025-05-02T10:00:00Z"), EndTime: at("2025-05-02T12:00:00Z")},
+			wantStart: time.Date(2025, 5, 2, 10, 0, 0, 0, time.UTC),
+			wantEnd:   time.Date(2025, 5, 2, 12, 0, 0, 0, time.UTC),
+		},
+		{
+			name:      "Only the start moved",
+			req:       ApproveScheduleRequest{StartTime: at("2025-05-02T13:00:00Z")},
+			wantStart: time.Date(2025, 5, 2, 13, 0, 0, 0, time.UTC),
+			wantEnd:   end,
+		},
+		{
+			name:      "Only the end moved",
+			req:       ApproveScheduleRequest{EndTime: at("2025-05-02T11:00:00Z")},
+			wantStart: start,
+			wantEnd:   time.Date(2025, 5, 2, 11, 0, 0, 0, time.UTC),
+		},
+		{
+			name:      "Local time in the schedule's timezone",
+			req:       ApproveScheduleRequest{EndTime: at("2025-05-02T17:00:00")},
+			wantStart: start,
+			wantEnd:   time.Date(2025, 5, 2, 16, 0, 0, 0, time.UTC),
+		},
+		{
+			name:      "Same times as requested",
+			req:       ApproveScheduleRequest{StartTime: at("2025-05-02T09:00:00Z"), EndTime: at("2025-05-02T17:00:00Z")},
+			unchanged: true,
+		},
+		{
+			name:    "End before start",
+			req:     ApproveScheduleRequest{StartTime: at("2025-05-02T18:00:00Z")},
+			wantErr: "end_time must be after start_time",
+		},
+		{
+			name:    "End at start",
+			req:     ApproveScheduleRequest{EndTime: at("2025-05-02T09:00:00Z")},
+			wantErr: "end_time must be after start_time",
+		},
+		{
+			name:    "End in the past",
+			req:     ApproveScheduleRequest{StartTime: at("2025-04-30T09:00:00Z"), EndTime: at("2025-04-30T17:00:00Z")},
+			wantErr: "end_time must be in the future",
+		},
+		{
+			name:    "Malformed start",
+			req:     ApproveScheduleRequest{StartTime: at("tomorrow")},
+			wantErr: "Invalid start_time format (use RFC3339)",
+		},
+		{
+			name:    "Malformed end",
+			req:     ApproveScheduleRequest{EndTime: at("later")},
+			wantErr: "Invalid end_time format (use RFC3339)",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Europe/London is an hour ahead of UTC in May
+			schedule := &models.Schedule{StartTime: start, EndTime: end, Timezone: "Europe/London"}
+			if tt.name == "Local time in the schedule's timezone" && schedule.Location() == time.UTC {
+				t.Skip("tz database not available")
+			}
+
+			window, err := resolveApprovalWindow(schedule, &tt.req, now)
+			if tt.wantErr != "" {
+				if err == nil || err.Error() != tt.wantErr {
+					t.Fatalf("error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("error = %v", err)
+			}
+
+			if tt.unchanged {
+				if window != nil {
+					t.Errorf("window = %+v, want nil for the requested window", window)
+				}
+				return
+			}
+			if window == nil {
+				t.Fatal("window = nil, want the modified window")
+			}
+			if !window.requestedStart.Equal(start) || !window.requestedEnd.Equal(end) {
+				t.Errorf("requested window = %v - %v, want %v - %v", window.requestedStart, window.requestedEnd, start, end)
+			}
+			if !window.schedule.StartTime.Equal(tt.wantStart) || !window.schedule.EndTime.Equal(tt.wantEnd) {
+				t.Errorf("approved window = %v - %v, want %v - %v", window.schedule.StartTime, window.schedule.EndTime, tt.wantStart, tt.wantEnd)
+			}
+		})
+	}
+}
+
+func TestRespondWithDecisionError(t *testing.T) {
+	h := &ScheduleHandler{logger: logger.New(logger.LevelError, io.Discard)}
+
+	tests := []struct {
+		name string
+		err  error
+		want int
+	}{
+		{"requester approves", repository.ErrSelfApproval, http.StatusForbidden},
+		{"already decided", repository.ErrNotPending, http.StatusConflict},
+		{"outside zones", repository.ErrOutsideZones, http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			req := httptest.NewRequest(http.MethodPost, "/api/v1/schedules/approve", nil)
+			h.respondWithDecisionError(rec, req, uuid.New(), tt.err, "Failed to approve schedule")
+			if rec.Code != tt.want {
+				t.Errorf("status = %d, want %d", rec.Code, tt.want)
+			}
+		})
+	}
+}
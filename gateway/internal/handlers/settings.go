@@ -0,0 +1,149 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/VanCannon/openpam/gateway/internal/middleware"
+	"github.com/VanCannon/openpam/gateway/internal/models"
+	"github.com/VanCannon/openpam/gateway/internal/policy"
+	"github.com/VanCannon/openpam/gateway/internal/repository"
+	"github.com/VanCannon/openpam/gateway/internal/settings"
+	"github.com/VanCannon/openpam/pkg/logger"
+	"github.com/google/uuid"
+)
+
+// SettingsHandler reports the session settings that apply to a target
+type SettingsHandler struct {
+	targetRepo *repository.TargetRepository
+	credRepo   *repository.CredentialRepository
+	userRepo   *repository.UserRepository
+	policy     *policy.Engine
+	resolver   *settings.Resolver
+	logger     *logger.Logger
+}
+
+// NewSettingsHandler creates a new settings handler
+func NewSettingsHandler(
+	targetRepo *repository.TargetRepository,
+	credRepo *repository.CredentialRepository,
+	userRepo *repository.UserRepository,
+	policyEngine *policy.Engine,
+	resolver *settings.Resolver,
+	log *logger.Logger,
+) *SettingsHandler {
+	return &SettingsHandler{
+		targetRepo: targetRepo,
+		credRepo:   credRepo,
+		userRepo:   userRepo,
+		policy:     policyEngine,
+		resolver:   resolver,
+		logger:     log,
+	}
+}
+
+// HandleEffective returns the merged zone, target and policy settings for a
+// session on a target, with the level each setting came from. The credential
+// is the one a connection would use: credential_id if given, otherwise the
+// default. Admins can ask on behalf of another user with user_id.
+func (h *SettingsHandler) HandleEffective() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+
+		targetID, err := uuid.Parse(r.PathValue("id"))
+		if err != nil {
+			http.Error(w, "Invalid target ID", http.StatusBadRequest)
+			return
+		}
+
+		userID, err := uuid.Parse(middleware.GetUserID(ctx))
+		if err != nil {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		subject := policy.Subject{UserID: userID, Role: middleware.GetUserRole(ctx)}
+
+		if userIDStr := r.URL.Query().Get("user_id"); userIDStr != "" && userIDStr != userID.String() {
+			if subject.Role != models.RoleAdmin {
+				http.Error(w, "Forbidden", http.StatusForbidden)
+				return
+			}
+
+			otherID, err := uuid.Parse(userIDStr)
+			if err != nil {
+				http.Error(w, "Invalid user ID", http.StatusBadRequest)
+				return
+			}
+
+			user, err := h.userRepo.GetByID(ctx, otherID)
+			if err != nil {
+				http.Error(w, "User not found", http.StatusNotFound)
+				return
+			}
+			subject = policy.Subject{UserID: user.ID, Role: user.Role}
+		}
+
+		var requested *uuid.UUID
+		if credIDStr := r.URL.Query().Get("credential_id"); credIDStr != "" {
+			credID, err := uuid.Parse(credIDStr)
+			if err != nil {
+				http.Error(w, "Invalid credential ID", http.StatusBadRequest)
+				return
+			}
+			requested = &credID
+		}
+
+		target, err := h.targetRepo.GetByID(ctx, targetID)
+		if err != nil {
+			http.Error(w, "Target not found", http.StatusNotFound)
+			return
+		}
+
+		creds, err := h.credRepo.GetByTargetID(ctx, targetID)
+		if err != nil {
+			h.logger.Error("Failed to list credentials", map[string]interface{}{
+				"error": err.Error(),
+			})
+			http.Error(w, "Failed to resolve settings", http.StatusInternalServerError)
+			return
+		}
+
+		allowed, err := h.policy.AllowedCredentials(ctx, subject, target, creds)
+		if err != nil {
+			h.logger.Error("Failed to evaluate credential policy", map[string]interface{}{
+				"error": err.Error(),
+			})
+			http.Error(w, "Failed to resolve settings", http.StatusInternalServerError)
+			return
+		}
+
+		// Without a usable credential only the zone and target levels apply
+		cred, err := policy.SelectCredential(allowed, requested)
+		if err == policy.ErrCredentialNotAllowed {
+			http.Error(w, err.Error(), http.StatusForbidden)
+			return
+		}
+
+		eff, err := h.resolver.Resolve(ctx, subject, target, cred)
+		if err != nil {
+			h.logger.Error("Failed to resolve session settings", map[string]interface{}{
+				"target_id": targetID.String(),
+				"error":     err.Error(),
+			})
+			http.Error(w, "Failed to resolve settings", http.StatusInternalServerError)
+			return
+		}
+
+		response := map[string]interface{}{
+			"target_id": target.ID,
+			"zone_id":   target.ZoneID,
+			"settings":  eff,
+		}
+		if cred != nil {
+			response["credential_id"] = cred.ID
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(response)
+	}
+}
@@ -0,0 +1,60 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/VanCannon/openpam/gateway/internal/keys"
+)
+
+// SigningKeyHandler publishes the keys the gateway signs what it issues with
+type SigningKeyHandler struct {
+	keys *keys.Ring
+}
+
+// NewSigningKeyHandler creates a new signing key handler
+func NewSigningKeyHandler(ring *keys.Ring) *SigningKeyHandler {
+	return &SigningKeyHandler{keys: ring}
+}
+
+// signingKey describes a signing key without its secret parts
+type signingKey struct {
+	ID        string `json:"id"`
+	Algorithm string `json:"algorithm"`
+	Provider  string `json:"provider"`
+	Active    bool   `json:"active"`
+}
+
+// HandleJWKS publishes the public signing keys, so other services can verify
+// session tokens without the session secret
+// Route: GET /.well-known/jwks.json
+func (h *SigningKeyHandler) HandleJWKS() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/jwk-set+json")
+		w.Header().Set("Cache-Control", "public, max-age=300")
+		json.NewEncoder(w).Encode(h.keys.JWKS())
+	}
+}
+
+// HandleList lists the signing keys, the active key first
+// Route: GET /api/v1/signing-keys
+func (h *SigningKeyHandler) HandleList() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		active := h.keys.Active().ID()
+		list := []signingKey{}
+		for _, key := range h.keys.Keys() {
+			list = append(list, signingKey{
+				ID:        key.ID(),
+				Algorithm: key.Algorithm(),
+				Provider:  key.Provider(),
+				Active:    key.ID() == active,
+			})
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"keys":  list,
+			"count": len(list),
+		})
+	}
+}
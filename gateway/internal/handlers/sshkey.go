@@ -0,0 +1,289 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/VanCannon/openpam/gateway/internal/discovery"
+	"github.com/VanCannon/openpam/gateway/internal/middleware"
+	"github.com/VanCannon/openpam/gateway/internal/repository"
+	"github.com/VanCannon/openpam/gateway/internal/validate"
+	"github.com/VanCannon/openpam/pkg/logger"
+	"github.com/google/uuid"
+)
+
+// SSHKeyHandler handles managed SSH keys on targets and the authorized_keys
+// drift found by discovery scans
+type SSHKeyHandler struct {
+	sshKeyRepo *repository.SSHKeyRepository
+	scanner    *discovery.Scanner
+	logger     *logger.Logger
+}
+
+// NewSSHKeyHandler creates a new SSH key handler
+func NewSSHKeyHandler(sshKeyRepo *repository.SSHKeyRepository, scanner *discovery.Scanner, log *logger.Logger) *SSHKeyHandler {
+	return &SSHKeyHandler{
+		sshKeyRepo: sshKeyRepo,
+		scanner:    scanner,
+		logger:     log,
+	}
+}
+
+// DeployKeyRequest names the account a key is deployed to
+type DeployKeyRequest struct {
+	Username string `json:"username"`
+}
+
+// HandleListKeys lists tracked keys
+// Route: GET /api/v1/ssh-keys?target_id=&username=&source=&include_removed=false
+func (h *SSHKeyHandler) HandleListKeys() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		filter := repository.SSHKeyFilter{
+			Username:       query.Get("username"),
+			Source:         query.Get("source"),
+			IncludeRemoved: query.Get("include_removed") == "true",
+		}
+
+		if t := query.Get("target_id"); t != "" {
+			id, err := uuid.Parse(t)
+			if err != nil {
+				http.Error(w, "Invalid target ID", http.StatusBadRequest)
+				return
+			}
+			filter.TargetID = &id
+		}
+
+		keys, err := h.sshKeyRepo.ListKeys(r.Context(), filter)
+		if err != nil {
+			h.logger.Error("Failed to list SSH keys", map[string]interface{}{
+				"error": err.Error(),
+			})
+			http.Error(w, "Failed to list SSH keys", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"keys":  keys,
+			"count": len(keys),
+		})
+	}
+}
+
+// HandleDeploy generates a key for an account on the target, adds it to the
+// account's authorized_keys and stores the private key in Vault
+// Route: POST /api/v1/targets/{id}/ssh-keys
+func (h *SSHKeyHandler) HandleDeploy() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		targetID, err := uuid.Parse(r.PathValue("id"))
+		if err != nil {
+			http.Error(w, "Invalid target ID", http.StatusBadRequest)
+			return
+		}
+
+		var req DeployKeyRequest
+		if !validate.Decode(w, r, &req) {
+			return
+		}
+		req.Username = strings.TrimSpace(req.Username)
+		if req.Username == "" || strings.ContainsAny(req.Username, ":/\n") {
+			http.Error(w, "A valid username is required", http.StatusBadRequest)
+			return
+		}
+
+		userID, ip := requester(r)
+		key, err := h.scanner.DeployKey(r.Context(), targetID, req.Username, userID, &ip)
+		if err != nil {
+			h.writeKeyError(w, "deploy SSH key", targetID, err)
+			return
+		}
+
+		h.logger.Info("SSH key deployed", map[string]interface{}{
+			"key_id":      key.ID.String(),
+			"target_id":   targetID.String(),
+			"username":    key.Username,
+			"deployed_by": middleware.GetUserEmail(r.Context()),
+		})
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(key)
+	}
+}
+
+// HandleRotate replaces a managed key with a new one
+// Route: POST /api/v1/ssh-keys/{id}/rotate
+func (h *SSHKeyHandler) HandleRotate() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, ok := h.key(w, r)
+		if !ok {
+			return
+		}
+
+		userID, ip := requester(r)
+		key, err := h.scanner.RotateKey(r.Context(), id, userID, &ip)
+		if err != nil {
+			h.writeKeyError(w, "rotate SSH key", id, err)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(key)
+	}
+}
+
+// HandleRemove takes a tracked key off its target and stops tracking it
+// Route: DELETE /api/v1/ssh-keys/{id}
+func (h *SSHKeyHandler) HandleRemove() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, ok := h.key(w, r)
+		if !ok {
+			return
+		}
+
+		userID, ip := requester(r)
+		if err := h.scanner.RemoveKey(r.Context(), id, userID, &ip); err != nil {
+			h.writeKeyError(w, "remove SSH key", id, err)
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// HandleListDrift lists authorized_keys drift, newest first
+// Route: GET /api/v1/ssh-key-drift?target_id=&include_resolved=false&limit=100
+func (h *SSHKeyHandler) HandleListDrift() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+
+		var targetID *uuid.UUID
+		if t := query.Get("target_id"); t != "" {
+			id, err := uuid.Parse(t)
+			if err != nil {
+				http.Error(w, "Invalid target ID", http.StatusBadRequest)
+				return
+			}
+			targetID = &id
+		}
+
+		limit := 100
+		if l := query.Get("limit"); l != "" {
+			if parsed, err := strconv.Atoi(l); err == nil && parsed > 0 && parsed <= 500 {
+				limit = parsed
+			}
+		}
+
+		drift, err := h.sshKeyRepo.ListDrift(r.Context(), targetID, query.Get("include_resolved") == "true", limit)
+		if err != nil {
+			h.logger.Error("Failed to list SSH key drift", map[string]interface{}{
+				"error": err.Error(),
+			})
+			http.Error(w, "Failed to list SSH key drift", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"drift": drift,
+			"count": len(drift),
+		})
+	}
+}
+
+// HandleApproveDrift accepts drift: an unauthorized key is tracked as approved,
+// a missing key stops being tracked
+// Route: POST /api/v1/ssh-key-drift/{id}/approve
+func (h *SSHKeyHandler) HandleApproveDrift() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, ok := h.drift(w, r)
+		if !ok {
+			return
+		}
+
+		userID, ip := requester(r)
+		drift, err := h.scanner.ApproveDrift(r.Context(), id, userID, &ip)
+		if err != nil {
+			h.writeKeyError(w, "approve SSH key drift", id, err)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(drift)
+	}
+}
+
+// HandleRevertDrift undoes drift on the target: an unauthorized key is removed,
+// a missing key is added back
+// Route: POST /api/v1/ssh-key-drift/{id}/revert
+func (h *SSHKeyHandler) HandleRevertDrift() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, ok := h.drift(w, r)
+		if !ok {
+			return
+		}
+
+		userID, ip := requester(r)
+		drift, err := h.scanner.RevertDrift(r.Context(), id, userID, &ip)
+		if err != nil {
+			h.writeKeyError(w, "revert SSH key drift", id, err)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(drift)
+	}
+}
+
+// key parses the key ID and checks that the key exists
+func (h *SSHKeyHandler) key(w http.ResponseWriter, r *http.Request) (uuid.UUID, bool) {
+	id, err := uuid.Parse(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, "Invalid key ID", http.StatusBadRequest)
+		return uuid.Nil, false
+	}
+
+	if _, err := h.sshKeyRepo.GetKey(r.Context(), id); err != nil {
+		http.Error(w, "SSH key not found", http.StatusNotFound)
+		return uuid.Nil, false
+	}
+
+	return id, true
+}
+
+// drift parses the drift ID and checks that the drift exists
+func (h *SSHKeyHandler) drift(w http.ResponseWriter, r *http.Request) (uuid.UUID, bool) {
+	id, err := uuid.Parse(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, "Invalid drift ID", http.StatusBadRequest)
+		return uuid.Nil, false
+	}
+
+	if _, err := h.sshKeyRepo.GetDrift(r.Context(), id); err != nil {
+		http.Error(w, "SSH key drift not found", http.StatusNotFound)
+		return uuid.Nil, false
+	}
+
+	return id, true
+}
+
+func (h *SSHKeyHandler) writeKeyError(w http.ResponseWriter, action string, id uuid.UUID, err error) {
+	switch {
+	case errors.Is(err, discovery.ErrKeyManaged), errors.Is(err, discovery.ErrKeyRemoved),
+		errors.Is(err, discovery.ErrDriftResolved), errors.Is(err, repository.ErrDriftResolved),
+		errors.Is(err, repository.ErrSSHKeyExists):
+		http.Error(w, err.Error(), http.StatusConflict)
+	case errors.Is(err, discovery.ErrNotSSH), errors.Is(err, discovery.ErrKeyNotManaged), errors.Is(err, discovery.ErrNoCredential):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	default:
+		h.logger.Error("Failed to "+action, map[string]interface{}{
+			"id":    id.String(),
+			"error": err.Error(),
+		})
+		http.Error(w, "Failed to "+action+": "+err.Error(), http.StatusBadGateway)
+	}
+}
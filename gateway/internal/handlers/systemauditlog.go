@@ -5,8 +5,8 @@ import (
 	"net/http"
 	"strconv"
 
-	"github.com/VanCannon/openpam/gateway/internal/logger"
 	"github.com/VanCannon/openpam/gateway/internal/repository"
+	"github.com/VanCannon/openpam/pkg/logger"
 	"github.com/google/uuid"
 )
 
@@ -48,11 +48,19 @@ func (h *SystemAuditLogHandler) HandleList() http.HandlerFunc {
 		// Check for filters
 		eventType := r.URL.Query().Get("event_type")
 		userIDStr := r.URL.Query().Get("user_id")
+		elevationIDStr := r.URL.Query().Get("elevation_id")
 
 		var logs interface{}
 		var err error
 
-		if eventType != "" {
+		if elevationIDStr != "" {
+			elevationID, parseErr := uuid.Parse(elevationIDStr)
+			if parseErr != nil {
+				http.Error(w, "Invalid elevation ID", http.StatusBadRequest)
+				return
+			}
+			logs, err = h.auditRepo.ListByElevation(ctx, elevationID, limit, offset)
+		} else if eventType != "" {
 			logs, err = h.auditRepo.ListByEventType(ctx, eventType, limit, offset)
 		} else if userIDStr != "" {
 			userID, parseErr := uuid.Parse(userIDStr)
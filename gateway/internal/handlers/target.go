@@ -4,22 +4,28 @@ import (
 	"encoding/json"
 	"net/http"
 	"strconv"
+	"strings"
+	"time"
 
-	"github.com/VanCannon/openpam/gateway/internal/logger"
+	"github.com/VanCannon/openpam/gateway/internal/models"
 	"github.com/VanCannon/openpam/gateway/internal/repository"
+	"github.com/VanCannon/openpam/pkg/logger"
+	"github.com/google/uuid"
 )
 
 // TargetHandler handles target-related requests
 type TargetHandler struct {
-	targetRepo *repository.TargetRepository
-	logger     *logger.Logger
+	targetRepo   *repository.TargetRepository
+	ephemeralTTL EphemeralTTL
+	logger       *logger.Logger
 }
 
 // NewTargetHandler creates a new target handler
-func NewTargetHandler(targetRepo *repository.TargetRepository, log *logger.Logger) *TargetHandler {
+func NewTargetHandler(targetRepo *repository.TargetRepository, ephemeralTTL EphemeralTTL, log *logger.Logger) *TargetHandler {
 	return &TargetHandler{
-		targetRepo: targetRepo,
-		logger:     log,
+		targetRepo:   targetRepo,
+		ephemeralTTL: ephemeralTTL,
+		logger:       log,
 	}
 }
 
@@ -48,7 +54,8 @@ func (h *TargetHandler) HandleTargets() http.HandlerFunc {
 	}
 }
 
-// HandleList returns a list of available targets
+// HandleList returns a list of available targets, optionally filtered by
+// zone, owner team, environment, compliance scope, labels and text
 func (h *TargetHandler) HandleList() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		ctx := r.Context()
@@ -72,8 +79,38 @@ func (h *TargetHandler) HandleList() http.HandlerFunc {
 			}
 		}
 
+		query := r.URL.Query()
+		filter := repository.TargetFilter{
+			OwnerTeam:       query.Get("owner_team"),
+			Environment:     strings.ToLower(query.Get("environment")),
+			ComplianceScope: strings.ToLower(query.Get("compliance_scope")),
+			Search:          query.Get("q"),
+			Limit:           limit,
+			Offset:          offset,
+		}
+		if v := query.Get("zone_id"); v != "" {
+			zoneID, err := uuid.Parse(v)
+			if err != nil {
+				http.Error(w, "Invalid zone ID", http.StatusBadRequest)
+				return
+			}
+			filter.ZoneID = &zoneID
+		}
+		// Each label=key or label=key=value narrows the list further
+		for _, selector := range query["label"] {
+			key, value, err := models.ParseLabelSelector(selector)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			if filter.Labels == nil {
+				filter.Labels = make(map[string]string)
+			}
+			filter.Labels[key] = value
+		}
+
 		// Get targets from database
-		targets, err := h.targetRepo.List(ctx, limit, offset)
+		targets, err := h.targetRepo.Search(ctx, filter)
 		if err != nil {
 			h.logger.Error("Failed to list targets", map[string]interface{}{
 				"error": err.Error(),
@@ -84,25 +121,39 @@ func (h *TargetHandler) HandleList() http.HandlerFunc {
 
 		// Build response
 		type targetResponse struct {
-			ID          string `json:"id"`
-			Name        string `json:"name"`
-			Hostname    string `json:"hostname"`
-			Protocol    string `json:"protocol"`
-			Port        int    `json:"port"`
-			Description string `json:"description,omitempty"`
-			Enabled     bool   `json:"enabled"`
+			ID              string        `json:"id"`
+			Name            string        `json:"name"`
+			Hostname        string        `json:"hostname"`
+			Protocol        string        `json:"protocol"`
+			Port            int           `json:"port"`
+			OwnerTeam       string        `json:"owner_team,omitempty"`
+			Environment     string        `json:"environment,omitempty"`
+			ComplianceScope []string      `json:"compliance_scope,omitempty"`
+			Labels          models.Labels `json:"labels,omitempty"`
+			ConnectionNotes string        `json:"connection_notes,omitempty"`
+			Enabled         bool          `json:"enabled"`
+			Ephemeral       bool          `json:"ephemeral"`
+			ExpiresAt       *time.Time    `json:"expires_at,omitempty"`
+			Version         int           `json:"version"`
 		}
 
 		response := make([]targetResponse, len(targets))
 		for i, target := range targets {
 			response[i] = targetResponse{
-				ID:          target.ID.String(),
-				Name:        target.Name,
-				Hostname:    target.Hostname,
-				Protocol:    target.Protocol,
-				Port:        target.Port,
-				Description: target.Description,
-				Enabled:     target.Enabled,
+				ID:              target.ID.String(),
+				Name:            target.Name,
+				Hostname:        target.Hostname,
+				Protocol:        target.Protocol,
+				Port:            target.Port,
+				OwnerTeam:       target.OwnerTeam,
+				Environment:     target.Environment,
+				ComplianceScope: target.ComplianceScope,
+				Labels:          target.Labels,
+				ConnectionNotes: target.ConnectionNotes,
+				Enabled:         target.Enabled,
+				Ephemeral:       target.Ephemeral,
+				ExpiresAt:       target.ExpiresAt,
+				Version:         target.Version,
 			}
 		}
 
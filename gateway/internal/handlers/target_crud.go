@@ -2,12 +2,71 @@ package handlers
 
 import (
 	"encoding/json"
+	"errors"
 	"net/http"
 
+	"github.com/VanCannon/openpam/gateway/internal/actor"
 	"github.com/VanCannon/openpam/gateway/internal/models"
+	"github.com/VanCannon/openpam/gateway/internal/repository"
+	"github.com/VanCannon/openpam/gateway/internal/validate"
 	"github.com/google/uuid"
 )
 
+// targetMetadata is the metadata a target is created or updated with
+type targetMetadata struct {
+	OwnerTeam       string        `json:"owner_team"`
+	Environment     string        `json:"environment"`
+	ComplianceScope []string      `json:"compliance_scope"`
+	Labels          models.Labels `json:"labels"`
+	RiskTier        *string       `json:"risk_tier"`
+	ConnectionNotes string        `json:"connection_notes"`
+	Description     string        `json:"description"` // Deprecated: taken as connection_notes when those are unset
+}
+
+// apply sets the target's metadata and checks it
+func (m *targetMetadata) apply(target *models.Target) error {
+	target.OwnerTeam = m.OwnerTeam
+	target.Environment = m.Environment
+	target.ComplianceScope = m.ComplianceScope
+	target.Labels = m.Labels
+	target.RiskTier = m.RiskTier
+	target.ConnectionNotes = m.ConnectionNotes
+	if target.ConnectionNotes == "" {
+		target.ConnectionNotes = m.Description
+	}
+	return target.NormalizeMetadata()
+}
+
+// createTargetRequest is the body of a new target
+type createTargetRequest struct {
+	ZoneID            string                  `json:"zone_id"`
+	Name              string                  `json:"name"`
+	Hostname          string                  `json:"hostname"`
+	Protocol          string                  `json:"protocol"`
+	Port              int                     `json:"port"`
+	KeepaliveInterval *int                    `json:"keepalive_interval"`
+	Settings          *models.SessionSettings `json:"settings"`
+	RDPSettings       *models.RDPSettings     `json:"rdp_settings"`
+	targetMetadata
+}
+
+// Validate checks the fields of a new target
+func (req *createTargetRequest) Validate() validate.Errors {
+	var errs validate.Errors
+	errs.Required("zone_id", req.ZoneID)
+	errs.Required("name", req.Name)
+	errs.MaxLength("name", req.Name, 255)
+	errs.Required("hostname", req.Hostname)
+	errs.MaxLength("hostname", req.Hostname, 255)
+	errs.Check(models.ValidProtocol(req.Protocol), "protocol", "is not a supported protocol")
+	// Cloud console targets default to 443
+	if req.Port != 0 || !models.CloudProtocol(req.Protocol) {
+		errs.Range("port", req.Port, 1, 65535)
+	}
+	errs.Check(req.KeepaliveInterval == nil || *req.KeepaliveInterval >= 0, "keepalive_interval", "must not be negative")
+	return errs
+}
+
 // HandleCreate creates a new target
 func (h *TargetHandler) HandleCreate() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
@@ -18,34 +77,28 @@ func (h *TargetHandler) HandleCreate() http.HandlerFunc {
 
 		ctx := r.Context()
 
-		var req struct {
-			ZoneID      string `json:"zone_id"`
-			Name        string `json:"name"`
-			Hostname    string `json:"hostname"`
-			Protocol    string `json:"protocol"`
-			Port        int    `json:"port"`
-			Description string `json:"description"`
-		}
-
-		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-			http.Error(w, "Invalid request body", http.StatusBadRequest)
+		var req createTargetRequest
+		if !validate.Decode(w, r, &req) {
 			return
 		}
 
-		// Validate
-		if req.Name == "" || req.Hostname == "" || req.Protocol == "" || req.ZoneID == "" {
-			http.Error(w, "Missing required fields", http.StatusBadRequest)
-			return
+		// Cloud console targets are never dialed; the port is informational
+		if models.CloudProtocol(req.Protocol) && req.Port == 0 {
+			req.Port = 443
 		}
 
-		if req.Protocol != models.ProtocolSSH && req.Protocol != models.ProtocolRDP {
-			http.Error(w, "Invalid protocol", http.StatusBadRequest)
-			return
+		if req.Settings != nil {
+			if err := req.Settings.Validate(false); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
 		}
 
-		if req.Port <= 0 || req.Port > 65535 {
-			http.Error(w, "Invalid port", http.StatusBadRequest)
-			return
+		if req.RDPSettings != nil {
+			if err := req.RDPSettings.Validate(); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
 		}
 
 		zoneID, err := uuid.Parse(req.ZoneID)
@@ -54,14 +107,30 @@ func (h *TargetHandler) HandleCreate() http.HandlerFunc {
 			return
 		}
 
+		// Zone admins add targets to their own zones only
+		if !actor.ManagesZone(ctx, zoneID) {
+			writeOutsideZones(w, repository.ErrOutsideZones)
+			return
+		}
+
 		target := &models.Target{
-			ZoneID:      zoneID,
-			Name:        req.Name,
-			Hostname:    req.Hostname,
-			Protocol:    req.Protocol,
-			Port:        req.Port,
-			Description: req.Description,
-			Enabled:     true,
+			ZoneID:            zoneID,
+			Name:              req.Name,
+			Hostname:          req.Hostname,
+			Protocol:          req.Protocol,
+			Port:              req.Port,
+			Enabled:           true,
+			KeepaliveInterval: req.KeepaliveInterval,
+		}
+		if err := req.targetMetadata.apply(target); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if req.Settings != nil {
+			target.Settings = *req.Settings
+		}
+		if req.RDPSettings != nil {
+			target.RDP = *req.RDPSettings
 		}
 
 		if err := h.targetRepo.Create(ctx, target); err != nil {
@@ -101,6 +170,7 @@ func (h *TargetHandler) HandleGet() http.HandlerFunc {
 			return
 		}
 
+		setETag(w, target.Version)
 		w.Header().Set("Content-Type", "application/json")
 		json.NewEncoder(w).Encode(target)
 	}
@@ -124,17 +194,25 @@ func (h *TargetHandler) HandleUpdate() http.HandlerFunc {
 		}
 
 		var req struct {
-			ZoneID      string `json:"zone_id"`
-			Name        string `json:"name"`
-			Hostname    string `json:"hostname"`
-			Protocol    string `json:"protocol"`
-			Port        int    `json:"port"`
-			Description string `json:"description"`
-			Enabled     bool   `json:"enabled"`
+			ZoneID            string                  `json:"zone_id"`
+			Name              string                  `json:"name"`
+			Hostname          string                  `json:"hostname"`
+			Protocol          string                  `json:"protocol"`
+			Port              int                     `json:"port"`
+			Enabled           bool                    `json:"enabled"`
+			KeepaliveInterval *int                    `json:"keepalive_interval"`
+			Settings          *models.SessionSettings `json:"settings"`
+			RDPSettings       *models.RDPSettings     `json:"rdp_settings"`
+			Version           *int                    `json:"version"`
+			targetMetadata
+		}
+
+		if !validate.Decode(w, r, &req) {
+			return
 		}
 
-		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-			http.Error(w, "Invalid request body", http.StatusBadRequest)
+		version, ok := requireVersion(w, r, req.Version)
+		if !ok {
 			return
 		}
 
@@ -144,21 +222,64 @@ func (h *TargetHandler) HandleUpdate() http.HandlerFunc {
 			return
 		}
 
+		if target.Version != version {
+			writeVersionConflict(w, target.Version, target)
+			return
+		}
+
 		zoneID, err := uuid.Parse(req.ZoneID)
 		if err != nil {
 			http.Error(w, "Invalid zone ID", http.StatusBadRequest)
 			return
 		}
 
+		if req.KeepaliveInterval != nil && *req.KeepaliveInterval < 0 {
+			http.Error(w, "Invalid keepalive interval", http.StatusBadRequest)
+			return
+		}
+
+		if req.Settings != nil {
+			if err := req.Settings.Validate(false); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+		}
+
+		if req.RDPSettings != nil {
+			if err := req.RDPSettings.Validate(); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+		}
+
 		target.ZoneID = zoneID
 		target.Name = req.Name
 		target.Hostname = req.Hostname
 		target.Protocol = req.Protocol
 		target.Port = req.Port
-		target.Description = req.Description
 		target.Enabled = req.Enabled
+		target.KeepaliveInterval = req.KeepaliveInterval
+		if req.Settings != nil {
+			target.Settings = *req.Settings
+		}
+		if req.RDPSettings != nil {
+			target.RDP = *req.RDPSettings
+		}
+		if err := req.targetMetadata.apply(target); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
 
 		if err := h.targetRepo.Update(ctx, target); err != nil {
+			if writeOutsideZones(w, err) {
+				return
+			}
+			if errors.Is(err, repository.ErrVersionConflict) {
+				if current, err := h.targetRepo.GetByID(ctx, targetID); err == nil {
+					writeVersionConflict(w, current.Version, current)
+					return
+				}
+			}
 			h.logger.Error("Failed to update target", map[string]interface{}{
 				"error": err.Error(),
 			})
@@ -166,6 +287,7 @@ func (h *TargetHandler) HandleUpdate() http.HandlerFunc {
 			return
 		}
 
+		setETag(w, target.Version)
 		w.Header().Set("Content-Type", "application/json")
 		json.NewEncoder(w).Encode(target)
 	}
@@ -189,6 +311,9 @@ func (h *TargetHandler) HandleDelete() http.HandlerFunc {
 		}
 
 		if err := h.targetRepo.Delete(ctx, targetID); err != nil {
+			if writeOutsideZones(w, err) {
+				return
+			}
 			h.logger.Error("Failed to delete target", map[string]interface{}{
 				"error": err.Error(),
 			})
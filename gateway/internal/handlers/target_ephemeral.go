@@ -0,0 +1,130 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/VanCannon/openpam/gateway/internal/middleware"
+	"github.com/VanCannon/openpam/gateway/internal/models"
+	"github.com/VanCannon/openpam/gateway/internal/validate"
+	"github.com/google/uuid"
+)
+
+// EphemeralTTL bounds the lifetime of ephemeral targets
+type EphemeralTTL struct {
+	Default time.Duration
+	Max     time.Duration
+}
+
+// HandleCreateEphemeral registers a short-lived target, typically a cloud instance
+// created by automation. The target is disabled when its TTL runs out and later
+// removed by the ephemeral target collector.
+// Route: POST /api/v1/targets/ephemeral
+func (h *TargetHandler) HandleCreateEphemeral() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		ctx := r.Context()
+
+		// Ephemeral targets are registered by automation; admins may also create them by hand
+		if middleware.GetAPIKeyID(ctx) == "" && middleware.GetUserRole(ctx) != models.RoleAdmin {
+			http.Error(w, "Forbidden: API key or admin role required", http.StatusForbidden)
+			return
+		}
+
+		var req struct {
+			ZoneID            string `json:"zone_id"`
+			Name              string `json:"name"`
+			Hostname          string `json:"hostname"`
+			Protocol          string `json:"protocol"`
+			Port              int    `json:"port"`
+			KeepaliveInterval *int   `json:"keepalive_interval"`
+			TTLSeconds        int    `json:"ttl_seconds"`
+			targetMetadata
+		}
+
+		if !validate.Decode(w, r, &req) {
+			return
+		}
+
+		// Validate
+		if req.Name == "" || req.Hostname == "" || req.Protocol == "" || req.ZoneID == "" {
+			http.Error(w, "Missing required fields", http.StatusBadRequest)
+			return
+		}
+
+		if req.Protocol != models.ProtocolSSH && req.Protocol != models.ProtocolRDP {
+			http.Error(w, "Invalid protocol", http.StatusBadRequest)
+			return
+		}
+
+		if req.Port <= 0 || req.Port > 65535 {
+			http.Error(w, "Invalid port", http.StatusBadRequest)
+			return
+		}
+
+		if req.KeepaliveInterval != nil && *req.KeepaliveInterval < 0 {
+			http.Error(w, "Invalid keepalive interval", http.StatusBadRequest)
+			return
+		}
+
+		ttl := h.ephemeralTTL.Default
+		if req.TTLSeconds < 0 {
+			http.Error(w, "Invalid TTL", http.StatusBadRequest)
+			return
+		}
+		if req.TTLSeconds > 0 {
+			ttl = time.Duration(req.TTLSeconds) * time.Second
+		}
+		if h.ephemeralTTL.Max > 0 && ttl > h.ephemeralTTL.Max {
+			http.Error(w, "TTL exceeds maximum of "+h.ephemeralTTL.Max.String(), http.StatusBadRequest)
+			return
+		}
+
+		zoneID, err := uuid.Parse(req.ZoneID)
+		if err != nil {
+			http.Error(w, "Invalid zone ID", http.StatusBadRequest)
+			return
+		}
+
+		expiresAt := time.Now().Add(ttl)
+		target := &models.Target{
+			ZoneID:            zoneID,
+			Name:              req.Name,
+			Hostname:          req.Hostname,
+			Protocol:          req.Protocol,
+			Port:              req.Port,
+			Enabled:           true,
+			KeepaliveInterval: req.KeepaliveInterval,
+			Ephemeral:         true,
+			ExpiresAt:         &expiresAt,
+		}
+		if err := req.targetMetadata.apply(target); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		if err := h.targetRepo.Create(ctx, target); err != nil {
+			h.logger.Error("Failed to create ephemeral target", map[string]interface{}{
+				"error": err.Error(),
+			})
+			http.Error(w, "Failed to create target", http.StatusInternalServerError)
+			return
+		}
+
+		h.logger.Info("Ephemeral target created", map[string]interface{}{
+			"target_id":  target.ID.String(),
+			"name":       target.Name,
+			"expires_at": expiresAt,
+			"created_by": middleware.GetUserEmail(ctx),
+		})
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(target)
+	}
+}
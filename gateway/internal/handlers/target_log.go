@@ -0,0 +1,130 @@
+package handlers
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/VanCannon/openpam/gateway/internal/repository"
+	"github.com/VanCannon/openpam/gateway/internal/targetlog"
+	"github.com/VanCannon/openpam/gateway/internal/validate"
+	"github.com/VanCannon/openpam/pkg/logger"
+	"github.com/google/uuid"
+)
+
+// TargetLogHandler takes the logs targets forward and serves the lines
+// attached to sessions
+type TargetLogHandler struct {
+	correlator *targetlog.Correlator
+	logRepo    *repository.TargetLogRepository
+	auditRepo  *repository.AuditLogRepository
+	token      string
+	logger     *logger.Logger
+}
+
+// NewTargetLogHandler creates a new target log handler. Forwarders
+// authenticate with token.
+func NewTargetLogHandler(correlator *targetlog.Correlator, logRepo *repository.TargetLogRepository, auditRepo *repository.AuditLogRepository, token string, log *logger.Logger) *TargetLogHandler {
+	return &TargetLogHandler{
+		correlator: correlator,
+		logRepo:    logRepo,
+		auditRepo:  auditRepo,
+		token:      token,
+		logger:     log,
+	}
+}
+
+// targetLogBatch is a batch of forwarded lines
+type targetLogBatch struct {
+	Lines []targetlog.Line `json:"lines"`
+}
+
+// Validate checks the lines of a batch
+func (b *targetLogBatch) Validate() validate.Errors {
+	var errs validate.Errors
+	errs.Check(len(b.Lines) > 0, "lines", "is required")
+	errs.Check(len(b.Lines) <= targetlog.MaxLines, "lines", fmt.Sprintf("must have at most %d lines", targetlog.MaxLines))
+	for i, line := range b.Lines {
+		errs.Required(fmt.Sprintf("lines[%d].message", i), line.Message)
+		errs.MaxLength(fmt.Sprintf("lines[%d].host", i), line.Host, 255)
+		errs.MaxLength(fmt.Sprintf("lines[%d].program", i), line.Program, 255)
+	}
+	return errs
+}
+
+// HandleIngest matches forwarded lines to sessions and attaches them
+// Route: POST /api/v1/target-logs
+func (h *TargetLogHandler) HandleIngest() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if subtle.ConstantTimeCompare([]byte(token), []byte(h.token)) != 1 {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		var req targetLogBatch
+		if !validate.Decode(w, r, &req) {
+			return
+		}
+
+		// Targets forward straight to the gateway, so the connection's address is theirs
+		source := r.RemoteAddr
+		if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+			source = host
+		}
+
+		matched, err := h.correlator.Ingest(r.Context(), source, req.Lines)
+		if err != nil {
+			h.logger.Error("Failed to ingest target logs", map[string]interface{}{
+				"source": source,
+				"error":  err.Error(),
+			})
+			http.Error(w, "Failed to ingest target logs", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"received": len(req.Lines),
+			"matched":  matched,
+		})
+	}
+}
+
+// HandleListBySession lists the target log lines attached to a session
+// Route: GET /api/v1/audit-logs/{id}/target-logs
+func (h *TargetLogHandler) HandleListBySession() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+
+		id, err := uuid.Parse(r.PathValue("id"))
+		if err != nil {
+			http.Error(w, "Invalid audit log ID", http.StatusBadRequest)
+			return
+		}
+
+		if _, err := h.auditRepo.GetByID(ctx, id); err != nil {
+			http.Error(w, "Audit log not found", http.StatusNotFound)
+			return
+		}
+
+		logs, err := h.logRepo.ListBySession(ctx, id)
+		if err != nil {
+			h.logger.Error("Failed to list target logs", map[string]interface{}{
+				"audit_log_id": id.String(),
+				"error":        err.Error(),
+			})
+			http.Error(w, "Failed to list target logs", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"target_logs": logs,
+			"count":       len(logs),
+		})
+	}
+}
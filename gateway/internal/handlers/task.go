@@ -0,0 +1,618 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/VanCannon/openpam/gateway/internal/middleware"
+	"github.com/VanCannon/openpam/gateway/internal/models"
+	"github.com/VanCannon/openpam/gateway/internal/policy"
+	"github.com/VanCannon/openpam/gateway/internal/repository"
+	"github.com/VanCannon/openpam/gateway/internal/task"
+	"github.com/VanCannon/openpam/gateway/internal/validate"
+	"github.com/VanCannon/openpam/gateway/internal/vault"
+	"github.com/VanCannon/openpam/pkg/logger"
+	"github.com/google/uuid"
+)
+
+// TaskHandler handles privileged task definitions and executions
+type TaskHandler struct {
+	taskRepo     *repository.TaskRepository
+	targetRepo   *repository.TargetRepository
+	credRepo     *repository.CredentialRepository
+	scheduleRepo *repository.ScheduleRepository
+	auditRepo    *repository.SystemAuditLogRepository
+	vault        *vault.Client
+	policy       *policy.Engine
+	runner       *task.Runner
+	maxTimeout   time.Duration
+	logger       *logger.Logger
+}
+
+// NewTaskHandler creates a new task handler
+func NewTaskHandler(
+	taskRepo *repository.TaskRepository,
+	targetRepo *repository.TargetRepository,
+	credRepo *repository.CredentialRepository,
+	scheduleRepo *repository.ScheduleRepository,
+	auditRepo *repository.SystemAuditLogRepository,
+	vaultClient *vault.Client,
+	policyEngine *policy.Engine,
+	runner *task.Runner,
+	maxTimeout time.Duration,
+	log *logger.Logger,
+) *TaskHandler {
+	return &TaskHandler{
+		taskRepo:     taskRepo,
+		targetRepo:   targetRepo,
+		credRepo:     credRepo,
+		scheduleRepo: scheduleRepo,
+		auditRepo:    auditRepo,
+		vault:        vaultClient,
+		policy:       policyEngine,
+		runner:       runner,
+		maxTimeout:   maxTimeout,
+		logger:       log,
+	}
+}
+
+// taskRequest is the body accepted by create and update
+type taskRequest struct {
+	Name            string                 `json:"name"`
+	Description     *string                `json:"description"`
+	TargetID        uuid.UUID              `json:"target_id"`
+	CredentialID    *uuid.UUID             `json:"credential_id"`
+	CommandTemplate string                 `json:"command_template"`
+	Parameters      []models.TaskParameter `json:"parameters"`
+	TimeoutSeconds  int                    `json:"timeout_seconds"`
+	RequireSchedule *bool                  `json:"require_schedule"`
+	Enabled         *bool                  `json:"enabled"`
+	Version         *int                   `json:"version"`
+}
+
+// validate normalises the request and returns a client-facing message for the
+// first problem found, or ""
+func (h *TaskHandler) validate(ctx context.Context, req *taskRequest) string {
+	if req.Name == "" || req.TargetID == uuid.Nil || req.CommandTemplate == "" {
+		return "Missing required fields"
+	}
+	if err := task.Validate(req.CommandTemplate, req.Parameters); err != nil {
+		return "Invalid command_template: " + err.Error()
+	}
+	if req.TimeoutSeconds == 0 {
+		req.TimeoutSeconds = 60
+	}
+	if req.TimeoutSeconds < 0 || time.Duration(req.TimeoutSeconds)*time.Second > h.maxTimeout {
+		return "Invalid timeout_seconds: must be between 1 and " + strconv.Itoa(int(h.maxTimeout.Seconds()))
+	}
+
+	if _, err := h.targetRepo.GetByID(ctx, req.TargetID); err != nil {
+		return "Target not found"
+	}
+	if req.CredentialID != nil {
+		cred, err := h.credRepo.GetByID(ctx, *req.CredentialID)
+		if err != nil || cred.TargetID != req.TargetID {
+			return "Credential not found for target"
+		}
+	}
+	return ""
+}
+
+// apply copies the request onto a task
+func (req *taskRequest) apply(t *models.Task) {
+	t.Name = req.Name
+	t.Description = req.Description
+	t.TargetID = req.TargetID
+	t.CredentialID = req.CredentialID
+	t.CommandTemplate = req.CommandTemplate
+	t.Parameters = req.Parameters
+	t.TimeoutSeconds = req.TimeoutSeconds
+	if req.RequireSchedule != nil {
+		t.RequireSchedule = *req.RequireSchedule
+	}
+	if req.Enabled != nil {
+		t.Enabled = *req.Enabled
+	}
+}
+
+// HandleList lists tasks. Only admins see disabled tasks.
+func (h *TaskHandler) HandleList() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		isAdmin := middleware.GetUserRole(r.Context()) == models.RoleAdmin
+
+		tasks, err := h.taskRepo.List(r.Context(), !isAdmin)
+		if err != nil {
+			h.logger.Error("Failed to list tasks", map[string]interface{}{
+				"error": err.Error(),
+			})
+			http.Error(w, "Failed to list tasks", http.StatusInternalServerError)
+			return
+		}
+
+		if tasks == nil {
+			tasks = []*models.Task{}
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"tasks": tasks,
+			"count": len(tasks),
+		})
+	}
+}
+
+// HandleGet retrieves a task
+func (h *TaskHandler) HandleGet() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, err := uuid.Parse(r.PathValue("id"))
+		if err != nil {
+			http.Error(w, "Invalid task ID", http.StatusBadRequest)
+			return
+		}
+
+		t, err := h.taskRepo.GetByID(r.Context(), id)
+		if err != nil || (!t.Enabled && middleware.GetUserRole(r.Context()) != models.RoleAdmin) {
+			http.Error(w, "Task not found", http.StatusNotFound)
+			return
+		}
+
+		setETag(w, t.Version)
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(t)
+	}
+}
+
+// HandleCreate creates a new task
+func (h *TaskHandler) HandleCreate() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+
+		var req taskRequest
+		if !validate.Decode(w, r, &req) {
+			return
+		}
+
+		if msg := h.validate(ctx, &req); msg != "" {
+			http.Error(w, msg, http.StatusBadRequest)
+			return
+		}
+
+		t := &models.Task{RequireSchedule: true, Enabled: true}
+		if userID, err := uuid.Parse(middleware.GetUserID(ctx)); err == nil {
+			t.CreatedBy = &userID
+		}
+		req.apply(t)
+
+		if err := h.taskRepo.Create(ctx, t); err != nil {
+			h.logger.Error("Failed to create task", map[string]interface{}{
+				"error": err.Error(),
+			})
+			http.Error(w, "Failed to create task", http.StatusInternalServerError)
+			return
+		}
+
+		h.logger.Info("Task created", map[string]interface{}{
+			"task_id":    t.ID.String(),
+			"name":       t.Name,
+			"target_id":  t.TargetID.String(),
+			"created_by": middleware.GetUserEmail(ctx),
+		})
+
+		setETag(w, t.Version)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(t)
+	}
+}
+
+// HandleUpdate replaces an existing task
+func (h *TaskHandler) HandleUpdate() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+
+		id, err := uuid.Parse(r.PathValue("id"))
+		if err != nil {
+			http.Error(w, "Invalid task ID", http.StatusBadRequest)
+			return
+		}
+
+		var req taskRequest
+		if !validate.Decode(w, r, &req) {
+			return
+		}
+
+		version, ok := requireVersion(w, r, req.Version)
+		if !ok {
+			return
+		}
+
+		if msg := h.validate(ctx, &req); msg != "" {
+			http.Error(w, msg, http.StatusBadRequest)
+			return
+		}
+
+		t, err := h.taskRepo.GetByID(ctx, id)
+		if err != nil {
+			http.Error(w, "Task not found", http.StatusNotFound)
+			return
+		}
+
+		if t.Version != version {
+			writeVersionConflict(w, t.Version, t)
+			return
+		}
+
+		req.apply(t)
+
+		if err := h.taskRepo.Update(ctx, t); err != nil {
+			if errors.Is(err, repository.ErrVersionConflict) {
+				if current, err := h.taskRepo.GetByID(ctx, id); err == nil {
+					writeVersionConflict(w, current.Version, current)
+					return
+				}
+			}
+			h.logger.Error("Failed to update task", map[string]interface{}{
+				"error": err.Error(),
+			})
+			http.Error(w, "Failed to update task", http.StatusInternalServerError)
+			return
+		}
+
+		h.logger.Info("Task updated", map[string]interface{}{
+			"task_id":    t.ID.String(),
+			"updated_by": middleware.GetUserEmail(ctx),
+		})
+
+		setETag(w, t.Version)
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(t)
+	}
+}
+
+// HandleDelete deletes a task. Its execution history is kept.
+func (h *TaskHandler) HandleDelete() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, err := uuid.Parse(r.PathValue("id"))
+		if err != nil {
+			http.Error(w, "Invalid task ID", http.StatusBadRequest)
+			return
+		}
+
+		if err := h.taskRepo.Delete(r.Context(), id); err != nil {
+			http.Error(w, "Task not found", http.StatusNotFound)
+			return
+		}
+
+		h.logger.Info("Task deleted", map[string]interface{}{
+			"task_id":    id.String(),
+			"deleted_by": middleware.GetUserEmail(r.Context()),
+		})
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// HandleExecute runs a task on its target and returns the execution with its
+// output. The caller needs an approved schedule window for the target (unless the
+// task doesn't require one) and access to the credential under the credential
+// rules, exactly as for an interactive session.
+// Route: POST /api/v1/tasks/{id}/execute
+func (h *TaskHandler) HandleExecute() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		userEmail := middleware.GetUserEmail(ctx)
+
+		id, err := uuid.Parse(r.PathValue("id"))
+		if err != nil {
+			http.Error(w, "Invalid task ID", http.StatusBadRequest)
+			return
+		}
+
+		userID, err := uuid.Parse(middleware.GetUserID(ctx))
+		if err != nil {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		var req struct {
+			Parameters map[string]string `json:"parameters"`
+		}
+		if !validate.DecodeOptional(w, r, &req) {
+			return
+		}
+
+		t, err := h.taskRepo.GetByID(ctx, id)
+		if err != nil || !t.Enabled {
+			http.Error(w, "Task not found", http.StatusNotFound)
+			return
+		}
+
+		target, err := h.targetRepo.GetByID(ctx, t.TargetID)
+		if err != nil {
+			http.Error(w, "Target not found", http.StatusNotFound)
+			return
+		}
+		if !target.Enabled {
+			http.Error(w, "Target is disabled", http.StatusForbidden)
+			return
+		}
+		if target.Expired(time.Now()) {
+			http.Error(w, "Target has expired", http.StatusGone)
+			return
+		}
+
+		if t.RequireSchedule {
+			inWindow, err := h.scheduleRepo.HasActiveWindow(ctx, userID, target.ID, time.Now())
+			if err != nil {
+				h.logger.Error("Failed to check schedule window", map[string]interface{}{
+					"error": err.Error(),
+				})
+				http.Error(w, "Failed to evaluate access policy", http.StatusInternalServerError)
+				return
+			}
+			if !inWindow {
+				h.logger.Warn("Task execution outside schedule window", map[string]interface{}{
+					"task_id": t.ID.String(),
+					"user":    userEmail,
+				})
+				http.Error(w, "Forbidden: no approved schedule window for this target", http.StatusForbidden)
+				return
+			}
+		}
+
+		cred, status, msg := h.selectCredential(ctx, userID, target, t.CredentialID)
+		if cred == nil {
+			h.logger.Warn("Task credential selection failed", map[string]interface{}{
+				"task_id": t.ID.String(),
+				"user":    userEmail,
+				"reason":  msg,
+			})
+			http.Error(w, msg, status)
+			return
+		}
+
+		command, values, err := task.Render(t.CommandTemplate, t.Parameters, req.Parameters, h.runner.Quoter(target.Protocol))
+		if err != nil {
+			http.Error(w, "Invalid parameters: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		creds, err := h.resolveCredentials(ctx, cred)
+		if err != nil {
+			h.logger.Error("Failed to retrieve credentials from Vault", map[string]interface{}{
+				"vault_path": cred.VaultSecretPath,
+				"error":      err.Error(),
+			})
+			http.Error(w, "Failed to retrieve credentials", http.StatusInternalServerError)
+			return
+		}
+
+		exec := &models.TaskExecution{
+			TaskID:       &t.ID,
+			TaskName:     t.Name,
+			UserID:       userID,
+			TargetID:     target.ID,
+			CredentialID: &cred.ID,
+			Parameters:   values,
+			Command:      command,
+			Status:       models.TaskExecutionRunning,
+			ClientIP:     &r.RemoteAddr,
+		}
+
+		if err := h.taskRepo.CreateExecution(ctx, exec); err != nil {
+			h.logger.Error("Failed to record task execution", map[string]interface{}{
+				"error": err.Error(),
+			})
+			http.Error(w, "Failed to record task execution", http.StatusInternalServerError)
+			return
+		}
+
+		h.logger.Info("Task execution started", map[string]interface{}{
+			"execution_id": exec.ID.String(),
+			"task_id":      t.ID.String(),
+			"user":         userEmail,
+			"target":       target.Name,
+		})
+
+		// The command runs to completion even if the client goes away, so the
+		// record always reflects what happened on the target
+		timeout := min(time.Duration(t.TimeoutSeconds)*time.Second, h.maxTimeout)
+		http.NewResponseController(w).SetWriteDeadline(time.Now().Add(timeout + 30*time.Second))
+		runCtx := context.WithoutCancel(ctx)
+
+		result, runErr := h.runner.Run(runCtx, target, creds, command, timeout)
+		if result != nil {
+			exec.Output = result.Output
+			exec.OutputTruncated = result.Truncated
+			if runErr == nil {
+				exec.ExitCode = &result.ExitCode
+			}
+		}
+
+		auditStatus := "success"
+		if runErr != nil {
+			msg := runErr.Error()
+			exec.Status = models.TaskExecutionFailed
+			exec.ErrorMessage = &msg
+			auditStatus = "failure"
+		} else if result.ExitCode != 0 {
+			exec.Status = models.TaskExecutionFailed
+			auditStatus = "failure"
+		} else {
+			exec.Status = models.TaskExecutionSucceeded
+		}
+
+		finishCtx, cancel := context.WithTimeout(runCtx, 10*time.Second)
+		defer cancel()
+
+		if err := h.taskRepo.FinishExecution(finishCtx, exec); err != nil {
+			h.logger.Error("Failed to record task execution result", map[string]interface{}{
+				"execution_id": exec.ID.String(),
+				"error":        err.Error(),
+			})
+		}
+
+		details := map[string]interface{}{
+			"task_id":      t.ID.String(),
+			"task_name":    t.Name,
+			"execution_id": exec.ID.String(),
+			"target_id":    target.ID.String(),
+			"target_name":  target.Name,
+			"command":      command,
+		}
+		if exec.ExitCode != nil {
+			details["exit_code"] = *exec.ExitCode
+		}
+		if exec.ErrorMessage != nil {
+			details["error"] = *exec.ErrorMessage
+		}
+
+		if err := h.auditRepo.CreateSimple(finishCtx, models.EventTypeTaskExecuted, &userID, "execute_task", auditStatus, &r.RemoteAddr, details); err != nil {
+			h.logger.Error("Failed to record task audit event", map[string]interface{}{
+				"error": err.Error(),
+			})
+		}
+
+		h.logger.Info("Task execution finished", map[string]interface{}{
+			"execution_id": exec.ID.String(),
+			"status":       exec.Status,
+		})
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(exec)
+	}
+}
+
+// selectCredential picks the task's credential, or the user's allowed credential
+// for the target, under the credential rules. On failure it returns nil with the
+// status and message for the client.
+func (h *TaskHandler) selectCredential(ctx context.Context, userID uuid.UUID, target *models.Target, requested *uuid.UUID) (*models.Credential, int, string) {
+	credentials, err := h.credRepo.GetByTargetID(ctx, target.ID)
+	if err != nil || len(credentials) == 0 {
+		return nil, http.StatusInternalServerError, "No credentials configured"
+	}
+
+	subject := policy.Subject{UserID: userID, Role: middleware.GetUserRole(ctx)}
+	allowed, err := h.policy.AllowedCredentials(ctx, subject, target, credentials)
+	if err != nil {
+		return nil, http.StatusInternalServerError, "Failed to evaluate access policy"
+	}
+
+	cred, err := policy.SelectCredential(allowed, requested)
+	if err != nil {
+		if err == policy.ErrAmbiguousCredential {
+			return nil, http.StatusConflict, err.Error()
+		}
+		return nil, http.StatusForbidden, err.Error()
+	}
+	if cred.Quarantined() {
+		return nil, http.StatusLocked, errCredentialQuarantined
+	}
+
+	return cred, 0, ""
+}
+
+// resolveCredentials retrieves the secret of a credential. A "raw:" path holds
+// the password itself, for development.
+func (h *TaskHandler) resolveCredentials(ctx context.Context, cred *models.Credential) (*vault.Credentials, error) {
+	if strings.HasPrefix(cred.VaultSecretPath, "raw:") {
+		return &vault.Credentials{
+			Username: cred.Username,
+			Password: strings.TrimPrefix(cred.VaultSecretPath, "raw:"),
+		}, nil
+	}
+
+	return h.vault.GetCredentials(ctx, cred.VaultSecretPath)
+}
+
+// HandleListExecutions lists the executions of a task, newest first
+// Route: GET /api/v1/tasks/{id}/executions?limit=50&offset=0
+func (h *TaskHandler) HandleListExecutions() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, err := uuid.Parse(r.PathValue("id"))
+		if err != nil {
+			http.Error(w, "Invalid task ID", http.StatusBadRequest)
+			return
+		}
+
+		limit := 50
+		if l := r.URL.Query().Get("limit"); l != "" {
+			if parsed, err := strconv.Atoi(l); err == nil && parsed > 0 && parsed <= 500 {
+				limit = parsed
+			}
+		}
+
+		offset := 0
+		if o := r.URL.Query().Get("offset"); o != "" {
+			if parsed, err := strconv.Atoi(o); err == nil && parsed >= 0 {
+				offset = parsed
+			}
+		}
+
+		var userID *uuid.UUID
+		if u := r.URL.Query().Get("user_id"); u != "" {
+			parsed, err := uuid.Parse(u)
+			if err != nil {
+				http.Error(w, "Invalid user_id", http.StatusBadRequest)
+				return
+			}
+			userID = &parsed
+		}
+
+		execs, err := h.taskRepo.ListExecutions(r.Context(), &id, userID, limit, offset)
+		if err != nil {
+			h.logger.Error("Failed to list task executions", map[string]interface{}{
+				"error": err.Error(),
+			})
+			http.Error(w, "Failed to list task executions", http.StatusInternalServerError)
+			return
+		}
+
+		if execs == nil {
+			execs = []*models.TaskExecution{}
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"executions": execs,
+			"count":      len(execs),
+			"limit":      limit,
+			"offset":     offset,
+		})
+	}
+}
+
+// HandleGetExecution retrieves an execution with its output. Users can read their
+// own executions; admins and auditors can read all of them.
+// Route: GET /api/v1/task-executions/{id}
+func (h *TaskHandler) HandleGetExecution() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+
+		id, err := uuid.Parse(r.PathValue("id"))
+		if err != nil {
+			http.Error(w, "Invalid execution ID", http.StatusBadRequest)
+			return
+		}
+
+		exec, err := h.taskRepo.GetExecution(ctx, id)
+		if err != nil {
+			http.Error(w, "Task execution not found", http.StatusNotFound)
+			return
+		}
+
+		role := middleware.GetUserRole(ctx)
+		if exec.UserID.String() != middleware.GetUserID(ctx) && role != models.RoleAdmin && role != models.RoleAuditor {
+			http.Error(w, "Task execution not found", http.StatusNotFound)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(exec)
+	}
+}
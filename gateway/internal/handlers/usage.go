@@ -0,0 +1,282 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/VanCannon/openpam/gateway/internal/middleware"
+	"github.com/VanCannon/openpam/gateway/internal/models"
+	"github.com/VanCannon/openpam/gateway/internal/repository"
+	"github.com/VanCannon/openpam/gateway/internal/usage"
+	"github.com/VanCannon/openpam/gateway/internal/validate"
+	"github.com/VanCannon/openpam/pkg/logger"
+	"github.com/google/uuid"
+)
+
+// maxUsageDays is the longest period of usage listed at once
+const maxUsageDays = 366
+
+// UsageHandler handles API usage and quota requests
+type UsageHandler struct {
+	usageRepo  *repository.UsageRepository
+	apiKeyRepo *repository.APIKeyRepository
+	meter      *usage.Meter
+	auditRepo  systemAuditStore
+	logger     *logger.Logger
+}
+
+// NewUsageHandler creates a new usage handler
+func NewUsageHandler(usageRepo *repository.UsageRepository, apiKeyRepo *repository.APIKeyRepository, meter *usage.Meter, auditRepo *repository.SystemAuditLogRepository, log *logger.Logger) *UsageHandler {
+	return &UsageHandler{
+		usageRepo:  usageRepo,
+		apiKeyRepo: apiKeyRepo,
+		meter:      meter,
+		auditRepo:  auditRepo,
+		logger:     log,
+	}
+}
+
+// HandleList lists daily usage, newest first, with its totals. Users see
+// their own; admins and auditors anyone's, everyone's by default.
+// Route: GET /api/v1/usage?from=2026-01-01&to=2026-01-31&user_id=UUID&api_key_id=UUID
+func (h *UsageHandler) HandleList() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+
+		// The last 30 days by default
+		now := time.Now().UTC()
+		filter := repository.UsageFilter{
+			From: time.Date(now.Year(), now.Month(), now.Day()-29, 0, 0, 0, 0, time.UTC),
+			To:   time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC),
+		}
+		for name, day := range map[string]*time.Time{"from": &filter.From, "to": &filter.To} {
+			if v := query.Get(name); v != "" {
+				parsed, err := time.Parse(time.DateOnly, v)
+				if err != nil {
+					http.Error(w, "Invalid date, use YYYY-MM-DD", http.StatusBadRequest)
+					return
+				}
+				*day = parsed
+			}
+		}
+		if filter.To.Before(filter.From) || filter.To.Sub(filter.From) >= maxUsageDays*24*time.Hour {
+			http.Error(w, "Invalid usage period", http.StatusBadRequest)
+			return
+		}
+
+		for name, id := range map[string]**uuid.UUID{"user_id": &filter.UserID, "api_key_id": &filter.APIKeyID} {
+			if v := query.Get(name); v != "" {
+				parsed, err := uuid.Parse(v)
+				if err != nil {
+					http.Error(w, "Invalid "+name, http.StatusBadRequest)
+					return
+				}
+				*id = &parsed
+			}
+		}
+
+		role := middleware.GetUserRole(r.Context())
+		if role != models.RoleAdmin && role != models.RoleAuditor {
+			userID, err := uuid.Parse(middleware.GetUserID(r.Context()))
+			if err != nil {
+				http.Error(w, "Unauthorized", http.StatusUnauthorized)
+				return
+			}
+			filter.UserID = &userID
+		}
+
+		days, err := h.usageRepo.List(r.Context(), filter)
+		if err != nil {
+			h.logger.Error("Failed to list usage", map[string]interface{}{
+				"error": err.Error(),
+			})
+			http.Error(w, "Failed to list usage", http.StatusInternalServerError)
+			return
+		}
+
+		totals := &models.Usage{}
+		for _, day := range days {
+			totals.Add(day)
+		}
+		if days == nil {
+			days = []*models.Usage{}
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"from": filter.From.Format(time.DateOnly),
+			"to":   filter.To.Format(time.DateOnly),
+			"days": days,
+			"totals": map[string]int64{
+				"api_calls":      totals.APICalls,
+				"sessions":       totals.Sessions,
+				"bytes_sent":     totals.BytesSent,
+				"bytes_received": totals.BytesReceived,
+			},
+		})
+	}
+}
+
+// usageQuotaRequest is the body of a new quota. A quota on an API key
+// belongs to the key's user.
+type usageQuotaRequest struct {
+	UserID       *uuid.UUID `json:"user_id"`
+	APIKeyID     *uuid.UUID `json:"api_key_id"`
+	Metric       string     `json:"metric"`
+	DailyLimit   int64      `json:"daily_limit"`
+	AlertPercent int        `json:"alert_percent"`
+}
+
+// Validate checks the fields of a new quota
+func (req *usageQuotaRequest) Validate() validate.Errors {
+	var errs validate.Errors
+	errs.Check(req.UserID != nil || req.APIKeyID != nil, "user_id", "or api_key_id is required")
+	errs.OneOf("metric", req.Metric, models.UsageMetrics...)
+	errs.Check(req.DailyLimit > 0, "daily_limit", "must be positive")
+	if req.AlertPercent != 0 {
+		errs.Range("alert_percent", req.AlertPercent, 1, 100)
+	}
+	return errs
+}
+
+// HandleListQuotas lists every quota
+// Route: GET /api/v1/usage/quotas
+func (h *UsageHandler) HandleListQuotas() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		quotas, err := h.usageRepo.ListQuotas(r.Context())
+		if err != nil {
+			h.logger.Error("Failed to list usage quotas", map[string]interface{}{
+				"error": err.Error(),
+			})
+			http.Error(w, "Failed to list usage quotas", http.StatusInternalServerError)
+			return
+		}
+
+		if quotas == nil {
+			quotas = []*models.UsageQuota{}
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"quotas": quotas,
+			"count":  len(quotas),
+		})
+	}
+}
+
+// HandleCreateQuota adds a quota, enforced once the gateways reload them
+// Route: POST /api/v1/usage/quotas
+func (h *UsageHandler) HandleCreateQuota() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+
+		var req usageQuotaRequest
+		if !validate.Decode(w, r, &req) {
+			return
+		}
+
+		quota := &models.UsageQuota{
+			APIKeyID:     req.APIKeyID,
+			Metric:       req.Metric,
+			DailyLimit:   req.DailyLimit,
+			AlertPercent: req.AlertPercent,
+		}
+		if quota.AlertPercent == 0 {
+			quota.AlertPercent = models.DefaultUsageAlertPercent
+		}
+		if req.APIKeyID != nil {
+			key, err := h.apiKeyRepo.GetByID(ctx, *req.APIKeyID)
+			if err != nil || (req.UserID != nil && *req.UserID != key.UserID) {
+				http.Error(w, "API key not found", http.StatusNotFound)
+				return
+			}
+			quota.UserID = key.UserID
+		} else {
+			quota.UserID = *req.UserID
+		}
+		if userID, _ := requester(r); userID != nil {
+			quota.CreatedBy = uuid.NullUUID{UUID: *userID, Valid: true}
+		}
+
+		if err := h.usageRepo.CreateQuota(ctx, quota); err != nil {
+			if errors.Is(err, repository.ErrQuotaExists) {
+				http.Error(w, "A quota already limits this metric", http.StatusConflict)
+				return
+			}
+			h.logger.Error("Failed to create usage quota", map[string]interface{}{
+				"error": err.Error(),
+			})
+			http.Error(w, "Failed to create usage quota", http.StatusInternalServerError)
+			return
+		}
+
+		h.audit(r, quota, "create")
+		h.reload(r)
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(quota)
+	}
+}
+
+// HandleDeleteQuota removes a quota
+// Route: DELETE /api/v1/usage/quotas/{id}
+func (h *UsageHandler) HandleDeleteQuota() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, err := uuid.Parse(r.PathValue("id"))
+		if err != nil {
+			http.Error(w, "Invalid quota ID", http.StatusBadRequest)
+			return
+		}
+
+		if err := h.usageRepo.DeleteQuota(r.Context(), id); err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				http.Error(w, "Usage quota not found", http.StatusNotFound)
+				return
+			}
+			h.logger.Error("Failed to delete usage quota", map[string]interface{}{
+				"error": err.Error(),
+			})
+			http.Error(w, "Failed to delete usage quota", http.StatusInternalServerError)
+			return
+		}
+
+		h.audit(r, &models.UsageQuota{ID: id}, "delete")
+		h.reload(r)
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// reload applies a quota change on this gateway right away; the others
+// pick it up at their next flush
+func (h *UsageHandler) reload(r *http.Request) {
+	if err := h.meter.Reload(r.Context()); err != nil {
+		h.logger.Error("Failed to reload usage quotas", map[string]interface{}{
+			"error": err.Error(),
+		})
+	}
+}
+
+func (h *UsageHandler) audit(r *http.Request, quota *models.UsageQuota, action string) {
+	userID, ip := requester(r)
+	details := map[string]interface{}{
+		"quota_id": quota.ID.String(),
+	}
+	if quota.Metric != "" {
+		details["user_id"] = quota.UserID.String()
+		details["metric"] = quota.Metric
+		details["daily_limit"] = quota.DailyLimit
+		if quota.APIKeyID != nil {
+			details["api_key_id"] = quota.APIKeyID.String()
+		}
+	}
+	if err := h.auditRepo.CreateSimple(r.Context(), models.EventTypeUsageQuotaChanged, userID, action, models.AuditStatusSuccess, &ip, details); err != nil {
+		h.logger.Error("Failed to create system audit log", map[string]interface{}{
+			"error": err.Error(),
+		})
+	}
+}
@@ -2,12 +2,14 @@ package handlers
 
 import (
 	"encoding/json"
+	"errors"
 	"net/http"
 	"strconv"
 
-	"github.com/VanCannon/openpam/gateway/internal/logger"
 	"github.com/VanCannon/openpam/gateway/internal/models"
 	"github.com/VanCannon/openpam/gateway/internal/repository"
+	"github.com/VanCannon/openpam/gateway/internal/validate"
+	"github.com/VanCannon/openpam/pkg/logger"
 	"github.com/google/uuid"
 )
 
@@ -78,11 +80,11 @@ func (h *UserHandler) HandleUpdateRole() http.HandlerFunc {
 		}
 
 		var req struct {
-			Role string `json:"role"`
+			Role    string `json:"role"`
+			Version *int   `json:"version"`
 		}
 
-		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-			http.Error(w, "Invalid request body", http.StatusBadRequest)
+		if !validate.Decode(w, r, &req) {
 			return
 		}
 
@@ -92,14 +94,30 @@ func (h *UserHandler) HandleUpdateRole() http.HandlerFunc {
 			return
 		}
 
+		version, ok := requireVersion(w, r, req.Version)
+		if !ok {
+			return
+		}
+
 		user, err := h.repo.GetByID(ctx, id)
 		if err != nil {
 			http.Error(w, "User not found", http.StatusNotFound)
 			return
 		}
 
+		if user.Version != version {
+			writeVersionConflict(w, user.Version, user)
+			return
+		}
+
 		user.Role = req.Role
 		if err := h.repo.Update(ctx, user); err != nil {
+			if errors.Is(err, repository.ErrVersionConflict) {
+				if current, err := h.repo.GetByID(ctx, id); err == nil {
+					writeVersionConflict(w, current.Version, current)
+					return
+				}
+			}
 			h.logger.Error("Failed to update user role", map[string]interface{}{
 				"error":   err.Error(),
 				"user_id": id,
@@ -108,11 +126,22 @@ func (h *UserHandler) HandleUpdateRole() http.HandlerFunc {
 			return
 		}
 
+		setETag(w, user.Version)
 		w.Header().Set("Content-Type", "application/json")
 		json.NewEncoder(w).Encode(user)
 	}
 }
 
+// Current loads the user a role change would change, for staging the request
+// under dual control
+func (h *UserHandler) Current(r *http.Request) (interface{}, error) {
+	id, err := uuid.Parse(r.PathValue("id"))
+	if err != nil {
+		return nil, err
+	}
+	return h.repo.GetByID(r.Context(), id)
+}
+
 // HandleUpdateEnabled updates a user's enabled status
 func (h *UserHandler) HandleUpdateEnabled() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
@@ -127,10 +156,15 @@ func (h *UserHandler) HandleUpdateEnabled() http.HandlerFunc {
 
 		var req struct {
 			Enabled bool `json:"enabled"`
+			Version *int `json:"version"`
 		}
 
-		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-			http.Error(w, "Invalid request body", http.StatusBadRequest)
+		if !validate.Decode(w, r, &req) {
+			return
+		}
+
+		version, ok := requireVersion(w, r, req.Version)
+		if !ok {
 			return
 		}
 
@@ -140,8 +174,19 @@ func (h *UserHandler) HandleUpdateEnabled() http.HandlerFunc {
 			return
 		}
 
+		if user.Version != version {
+			writeVersionConflict(w, user.Version, user)
+			return
+		}
+
 		user.Enabled = req.Enabled
 		if err := h.repo.Update(ctx, user); err != nil {
+			if errors.Is(err, repository.ErrVersionConflict) {
+				if current, err := h.repo.GetByID(ctx, id); err == nil {
+					writeVersionConflict(w, current.Version, current)
+					return
+				}
+			}
 			h.logger.Error("Failed to update user status", map[string]interface{}{
 				"error":   err.Error(),
 				"user_id": id,
@@ -150,6 +195,71 @@ func (h *UserHandler) HandleUpdateEnabled() http.HandlerFunc {
 			return
 		}
 
+		setETag(w, user.Version)
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(user)
+	}
+}
+
+// HandleUpdateAttributes replaces a user's attributes, which credential rule
+// conditions can test
+func (h *UserHandler) HandleUpdateAttributes() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+
+		id, err := uuid.Parse(r.PathValue("id"))
+		if err != nil {
+			http.Error(w, "Invalid user ID", http.StatusBadRequest)
+			return
+		}
+
+		var req struct {
+			Attributes models.Labels `json:"attributes"`
+			Version    *int          `json:"version"`
+		}
+
+		if !validate.Decode(w, r, &req) {
+			return
+		}
+
+		version, ok := requireVersion(w, r, req.Version)
+		if !ok {
+			return
+		}
+
+		user, err := h.repo.GetByID(ctx, id)
+		if err != nil {
+			http.Error(w, "User not found", http.StatusNotFound)
+			return
+		}
+
+		if user.Version != version {
+			writeVersionConflict(w, user.Version, user)
+			return
+		}
+
+		user.Attributes = req.Attributes
+		if err := user.NormalizeAttributes(); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		if err := h.repo.Update(ctx, user); err != nil {
+			if errors.Is(err, repository.ErrVersionConflict) {
+				if current, err := h.repo.GetByID(ctx, id); err == nil {
+					writeVersionConflict(w, current.Version, current)
+					return
+				}
+			}
+			h.logger.Error("Failed to update user attributes", map[string]interface{}{
+				"error":   err.Error(),
+				"user_id": id,
+			})
+			http.Error(w, "Failed to update user", http.StatusInternalServerError)
+			return
+		}
+
+		setETag(w, user.Version)
 		w.Header().Set("Content-Type", "application/json")
 		json.NewEncoder(w).Encode(user)
 	}
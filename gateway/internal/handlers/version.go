@@ -0,0 +1,75 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// Versioned resources (targets, zones, credentials, users, schedules) carry a
+// version that is bumped on every update. Updates must say which version they
+// were based on, either with an If-Match header holding the ETag from a previous
+// response or with a "version" field in the body, so concurrent admin edits are
+// rejected instead of silently overwriting each other.
+
+// etag formats a resource version as an ETag
+func etag(version int) string {
+	return fmt.Sprintf(`"%d"`, version)
+}
+
+// setETag sets the ETag header for a versioned resource
+func setETag(w http.ResponseWriter, version int) {
+	w.Header().Set("ETag", etag(version))
+}
+
+// expectedVersion returns the version an update is based on. If-Match takes
+// precedence over the body field. ok is false if the client sent neither.
+func expectedVersion(r *http.Request, bodyVersion *int) (version int, ok bool, err error) {
+	if header := strings.TrimSpace(r.Header.Get("If-Match")); header != "" {
+		tag := strings.TrimPrefix(header, "W/")
+		unquoted, err := strconv.Unquote(tag)
+		if err != nil {
+			return 0, false, fmt.Errorf("invalid If-Match header")
+		}
+		version, err := strconv.Atoi(unquoted)
+		if err != nil {
+			return 0, false, fmt.Errorf("invalid If-Match header")
+		}
+		return version, true, nil
+	}
+
+	if bodyVersion != nil {
+		return *bodyVersion, true, nil
+	}
+
+	return 0, false, nil
+}
+
+// requireVersion resolves the expected version and writes 400 or 428 if it is
+// malformed or missing. Handlers return when ok is false.
+func requireVersion(w http.ResponseWriter, r *http.Request, bodyVersion *int) (int, bool) {
+	version, ok, err := expectedVersion(r, bodyVersion)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return 0, false
+	}
+	if !ok {
+		http.Error(w, "Version required: send If-Match or a version field", http.StatusPreconditionRequired)
+		return 0, false
+	}
+	return version, true
+}
+
+// writeVersionConflict responds with 409 and the current state of the resource
+// so the client can show what changed and retry against the latest version
+func writeVersionConflict(w http.ResponseWriter, version int, current interface{}) {
+	setETag(w, version)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusConflict)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"error":   "Resource was modified by another request",
+		"current": current,
+	})
+}
@@ -0,0 +1,44 @@
+package handlers
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+func TestExpectedVersion(t *testing.T) {
+	three := 3
+
+	tests := []struct {
+		name        string
+		ifMatch     string
+		bodyVersion *int
+		want        int
+		wantOK      bool
+		wantErr     bool
+	}{
+		{name: "Neither", wantOK: false},
+		{name: "Body only", bodyVersion: &three, want: 3, wantOK: true},
+		{name: "Strong ETag", ifMatch: `"7"`, want: 7, wantOK: true},
+		{name: "Weak ETag", ifMatch: `W/"7"`, want: 7, wantOK: true},
+		{name: "Header wins over body", ifMatch: `"7"`, bodyVersion: &three, want: 7, wantOK: true},
+		{name: "Unquoted", ifMatch: `7`, wantErr: true},
+		{name: "Not a number", ifMatch: `"abc"`, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("PUT", "/", nil)
+			if tt.ifMatch != "" {
+				r.Header.Set("If-Match", tt.ifMatch)
+			}
+
+			got, ok, err := expectedVersion(r, tt.bodyVersion)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("expectedVersion() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if ok != tt.wantOK || got != tt.want {
+				t.Errorf("expectedVersion() = %d, %v, want %d, %v", got, ok, tt.want, tt.wantOK)
+			}
+		})
+	}
+}
@@ -0,0 +1,271 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/VanCannon/openpam/gateway/internal/models"
+	"github.com/VanCannon/openpam/gateway/internal/repository"
+	"github.com/VanCannon/openpam/gateway/internal/validate"
+	"github.com/VanCannon/openpam/pkg/logger"
+	"github.com/google/uuid"
+)
+
+// WatchHandler handles watch rule and alert requests
+type WatchHandler struct {
+	watchRepo *repository.WatchRepository
+	auditRepo systemAuditStore
+	logger    *logger.Logger
+}
+
+// NewWatchHandler creates a new watch handler
+func NewWatchHandler(watchRepo *repository.WatchRepository, auditRepo *repository.SystemAuditLogRepository, log *logger.Logger) *WatchHandler {
+	return &WatchHandler{
+		watchRepo: watchRepo,
+		auditRepo: auditRepo,
+		logger:    log,
+	}
+}
+
+// watchRuleRequest is the body accepted by create and update
+type watchRuleRequest struct {
+	Name          string               `json:"name"`
+	Description   *string              `json:"description"`
+	Enabled       *bool                `json:"enabled"`
+	EventTypes    []string             `json:"event_types"`
+	UserID        *uuid.UUID           `json:"user_id"`
+	TargetTag     *string              `json:"target_tag"`
+	Status        *string              `json:"status"`
+	OutsideHours  *models.WorkingHours `json:"outside_hours"`
+	Threshold     int                  `json:"threshold"`
+	WindowSeconds int                  `json:"window_seconds"`
+	GroupBy       string               `json:"group_by"`
+	Actions       []string             `json:"actions"`
+	Recipients    []string             `json:"recipients"`
+}
+
+// apply copies the request onto a rule and validates the result
+func (req *watchRuleRequest) apply(rule *models.WatchRule) error {
+	rule.Name = req.Name
+	rule.Description = req.Description
+	if req.Enabled != nil {
+		rule.Enabled = *req.Enabled
+	}
+	rule.EventTypes = req.EventTypes
+	rule.UserID = req.UserID
+	rule.TargetTag = nilIfEmpty(req.TargetTag)
+	rule.Status = nilIfEmpty(req.Status)
+	rule.OutsideHours = req.OutsideHours
+	rule.Threshold = req.Threshold
+	rule.WindowSeconds = req.WindowSeconds
+	rule.GroupBy = req.GroupBy
+	rule.Actions = req.Actions
+	rule.Recipients = req.Recipients
+	if rule.Recipients == nil {
+		rule.Recipients = []string{}
+	}
+	return rule.Validate()
+}
+
+func nilIfEmpty(s *string) *string {
+	if s == nil || *s == "" {
+		return nil
+	}
+	return s
+}
+
+// HandleList lists all watch rules
+// Route: GET /api/v1/watch-rules
+func (h *WatchHandler) HandleList() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		rules, err := h.watchRepo.List(r.Context())
+		if err != nil {
+			h.logger.Error("Failed to list watch rules", map[string]interface{}{
+				"error": err.Error(),
+			})
+			http.Error(w, "Failed to list watch rules", http.StatusInternalServerError)
+			return
+		}
+
+		if rules == nil {
+			rules = []*models.WatchRule{}
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"rules": rules,
+			"count": len(rules),
+		})
+	}
+}
+
+// HandleCreate creates a new watch rule
+// Route: POST /api/v1/watch-rules
+func (h *WatchHandler) HandleCreate() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req watchRuleRequest
+		if !validate.Decode(w, r, &req) {
+			return
+		}
+
+		rule := &models.WatchRule{Enabled: true}
+		if err := req.apply(rule); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		if err := h.watchRepo.Create(r.Context(), rule); err != nil {
+			h.logger.Error("Failed to create watch rule", map[string]interface{}{
+				"error": err.Error(),
+			})
+			http.Error(w, "Failed to create watch rule", http.StatusInternalServerError)
+			return
+		}
+
+		h.audit(r, rule, "create")
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(rule)
+	}
+}
+
+// HandleUpdate replaces an existing watch rule
+// Route: PUT /api/v1/watch-rules/{id}
+func (h *WatchHandler) HandleUpdate() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+
+		id, err := uuid.Parse(r.PathValue("id"))
+		if err != nil {
+			http.Error(w, "Invalid rule ID", http.StatusBadRequest)
+			return
+		}
+
+		var req watchRuleRequest
+		if !validate.Decode(w, r, &req) {
+			return
+		}
+
+		rule, err := h.watchRepo.GetByID(ctx, id)
+		if err != nil {
+			http.Error(w, "Watch rule not found", http.StatusNotFound)
+			return
+		}
+
+		if err := req.apply(rule); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		if err := h.watchRepo.Update(ctx, rule); err != nil {
+			h.logger.Error("Failed to update watch rule", map[string]interface{}{
+				"error": err.Error(),
+			})
+			http.Error(w, "Failed to update watch rule", http.StatusInternalServerError)
+			return
+		}
+
+		h.audit(r, rule, "update")
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(rule)
+	}
+}
+
+// HandleDelete deletes a watch rule
+// Route: DELETE /api/v1/watch-rules/{id}
+func (h *WatchHandler) HandleDelete() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+
+		id, err := uuid.Parse(r.PathValue("id"))
+		if err != nil {
+			http.Error(w, "Invalid rule ID", http.StatusBadRequest)
+			return
+		}
+
+		rule, err := h.watchRepo.GetByID(ctx, id)
+		if err != nil {
+			http.Error(w, "Watch rule not found", http.StatusNotFound)
+			return
+		}
+
+		if err := h.watchRepo.Delete(ctx, id); err != nil {
+			h.logger.Error("Failed to delete watch rule", map[string]interface{}{
+				"error": err.Error(),
+			})
+			http.Error(w, "Failed to delete watch rule", http.StatusInternalServerError)
+			return
+		}
+
+		h.audit(r, rule, "delete")
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// HandleListAlerts lists alerts newest first, optionally of one rule
+// Route: GET /api/v1/watch-alerts?rule_id=UUID&limit=50&offset=0
+func (h *WatchHandler) HandleListAlerts() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+
+		limit, _ := strconv.Atoi(query.Get("limit"))
+		offset, _ := strconv.Atoi(query.Get("offset"))
+		if limit <= 0 || limit > 100 {
+			limit = 50
+		}
+		if offset < 0 {
+			offset = 0
+		}
+
+		var ruleID *uuid.UUID
+		if v := query.Get("rule_id"); v != "" {
+			id, err := uuid.Parse(v)
+			if err != nil {
+				http.Error(w, "Invalid rule_id", http.StatusBadRequest)
+				return
+			}
+			ruleID = &id
+		}
+
+		alerts, err := h.watchRepo.ListAlerts(r.Context(), ruleID, limit, offset)
+		if err != nil {
+			h.logger.Error("Failed to list watch alerts", map[string]interface{}{
+				"error": err.Error(),
+			})
+			http.Error(w, "Failed to list watch alerts", http.StatusInternalServerError)
+			return
+		}
+
+		if alerts == nil {
+			alerts = []*models.WatchAlert{}
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"alerts": alerts,
+			"count":  len(alerts),
+			"limit":  limit,
+			"offset": offset,
+		})
+	}
+}
+
+// audit records a change to a rule, since rules can disable users
+func (h *WatchHandler) audit(r *http.Request, rule *models.WatchRule, action string) {
+	userID, ip := requester(r)
+	details := map[string]interface{}{
+		"rule_id":   rule.ID.String(),
+		"rule_name": rule.Name,
+		"enabled":   rule.Enabled,
+		"actions":   rule.Actions,
+	}
+	if err := h.auditRepo.CreateSimple(r.Context(), models.EventTypeWatchRuleChanged, userID, action, models.AuditStatusSuccess, &ip, details); err != nil {
+		h.logger.Error("Failed to create system audit log", map[string]interface{}{
+			"error": err.Error(),
+		})
+	}
+}
@@ -2,27 +2,38 @@ package handlers
 
 import (
 	"context"
+	"database/sql"
+	"errors"
 	"fmt"
 	"net/http"
-	"strconv"
 	"strings"
 	"time"
 
-	"github.com/VanCannon/openpam/gateway/internal/logger"
+	"github.com/VanCannon/openpam/gateway/internal/auth"
+	"github.com/VanCannon/openpam/gateway/internal/authfail"
 	"github.com/VanCannon/openpam/gateway/internal/middleware"
 	"github.com/VanCannon/openpam/gateway/internal/models"
-	"github.com/VanCannon/openpam/gateway/internal/rdp"
+	"github.com/VanCannon/openpam/gateway/internal/notice"
+	"github.com/VanCannon/openpam/gateway/internal/policy"
+	"github.com/VanCannon/openpam/gateway/internal/protocol"
+	"github.com/VanCannon/openpam/gateway/internal/queue"
+	"github.com/VanCannon/openpam/gateway/internal/recordings"
 	"github.com/VanCannon/openpam/gateway/internal/repository"
-	"github.com/VanCannon/openpam/gateway/internal/ssh"
+	"github.com/VanCannon/openpam/gateway/internal/schedule"
+	"github.com/VanCannon/openpam/gateway/internal/settings"
+	"github.com/VanCannon/openpam/gateway/internal/tunnel"
+	"github.com/VanCannon/openpam/gateway/internal/usage"
 	"github.com/VanCannon/openpam/gateway/internal/vault"
+	"github.com/VanCannon/openpam/gateway/internal/wsconn"
+	"github.com/VanCannon/openpam/pkg/logger"
 	"github.com/google/uuid"
 	"github.com/gorilla/websocket"
 )
 
 var upgrader = websocket.Upgrader{
-	ReadBufferSize:    16384, // 16KB
-	WriteBufferSize:   16384, // 16KB
-	EnableCompression: false, // Disable compression - can interfere with Guacamole protocol
+	ReadBufferSize:    16384,                 // 16KB
+	WriteBufferSize:   16384,                 // 16KB
+	EnableCompression: false,                 // Session connections negotiate it per session; see wsconn.Upgrade
 	Subprotocols:      []string{"guacamole"}, // Support Guacamole WebSocket protocol
 	CheckOrigin: func(r *http.Request) bool {
 		// TODO: Implement proper origin checking in production
@@ -30,35 +41,84 @@ var upgrader = websocket.Upgrader{
 	},
 }
 
+// OfflineAuthorizer authorizes and records sessions on a satellite while its hub
+// is unreachable
+type OfflineAuthorizer interface {
+	Online() bool
+	Authorize(ctx context.Context, subject policy.Subject, targetID uuid.UUID, requested *uuid.UUID) (*models.Target, *models.Credential, error)
+	Settings(ctx context.Context, subject policy.Subject, target *models.Target, cred *models.Credential) (*settings.Effective, error)
+	RecordSession(log *models.AuditLog) error
+}
+
 // ConnectionHandler handles WebSocket connection requests
 type ConnectionHandler struct {
-	vault      *vault.Client
-	targetRepo *repository.TargetRepository
-	credRepo   *repository.CredentialRepository
-	auditRepo  *repository.AuditLogRepository
-	sshProxy   *ssh.Proxy
-	rdpProxy   *rdp.Proxy
-	logger     *logger.Logger
+	vault        *vault.Client
+	targetRepo   *repository.TargetRepository
+	credRepo     *repository.CredentialRepository
+	auditRepo    *repository.AuditLogRepository
+	systemAudit  *repository.SystemAuditLogRepository
+	policy       *policy.Engine
+	settings     *settings.Resolver
+	offline      OfflineAuthorizer
+	protocols    *protocol.Registry
+	sessions     *wsconn.Tracker
+	windows      *schedule.Sessions
+	notices      *notice.Hub
+	queue        *queue.Queue
+	reconnect    *auth.ReconnectAuthenticator
+	compression  wsconn.Compression
+	authFailures *authfail.Tracker
+	banners      *repository.BannerRepository
+	usage        *usage.Meter
+	logger       *logger.Logger
 }
 
-// NewConnectionHandler creates a new connection handler
+// errCredentialQuarantined is the response to sessions with a quarantined credential
+const errCredentialQuarantined = "Credential is quarantined after repeated failed logons; rotate its secret or ask an admin to release it"
+
+// NewConnectionHandler creates a new connection handler. offline is only set
+// on satellites.
 func NewConnectionHandler(
 	vaultClient *vault.Client,
 	targetRepo *repository.TargetRepository,
 	credRepo *repository.CredentialRepository,
 	auditRepo *repository.AuditLogRepository,
-	sshProxy *ssh.Proxy,
-	rdpProxy *rdp.Proxy,
+	systemAuditRepo *repository.SystemAuditLogRepository,
+	policyEngine *policy.Engine,
+	settingsResolver *settings.Resolver,
+	offline OfflineAuthorizer,
+	protocols *protocol.Registry,
+	sessions *wsconn.Tracker,
+	windows *schedule.Sessions,
+	notices *notice.Hub,
+	sessionQueue *queue.Queue,
+	reconnect *auth.ReconnectAuthenticator,
+	compression wsconn.Compression,
+	authFailures *authfail.Tracker,
+	banners *repository.BannerRepository,
+	meter *usage.Meter,
 	log *logger.Logger,
 ) *ConnectionHandler {
 	return &ConnectionHandler{
-		vault:      vaultClient,
-		targetRepo: targetRepo,
-		credRepo:   credRepo,
-		auditRepo:  auditRepo,
-		sshProxy:   sshProxy,
-		rdpProxy:   rdpProxy,
-		logger:     log,
+		vault:        vaultClient,
+		targetRepo:   targetRepo,
+		credRepo:     credRepo,
+		auditRepo:    auditRepo,
+		systemAudit:  systemAuditRepo,
+		policy:       policyEngine,
+		settings:     settingsResolver,
+		offline:      offline,
+		protocols:    protocols,
+		sessions:     sessions,
+		windows:      windows,
+		notices:      notices,
+		queue:        sessionQueue,
+		reconnect:    reconnect,
+		compression:  compression,
+		authFailures: authFailures,
+		banners:      banners,
+		usage:        meter,
+		logger:       log,
 	}
 }
 
@@ -90,13 +150,14 @@ func (h *ConnectionHandler) HandleConnect() http.HandlerFunc {
 			return
 		}
 
-		protocol := parts[0]
+		proto := parts[0]
 		targetIDStr := parts[1]
 
 		// Validate protocol
-		if protocol != models.ProtocolSSH && protocol != models.ProtocolRDP {
+		handler, ok := h.protocols.Lookup(proto)
+		if !ok {
 			h.logger.Warn("Invalid protocol", map[string]interface{}{
-				"protocol": protocol,
+				"protocol": proto,
 			})
 			http.Error(w, "Invalid protocol", http.StatusBadRequest)
 			return
@@ -115,74 +176,156 @@ func (h *ConnectionHandler) HandleConnect() http.HandlerFunc {
 
 		h.logger.Info("Connection request", map[string]interface{}{
 			"user":      userEmail,
-			"protocol":  protocol,
+			"protocol":  proto,
 			"target_id": targetID.String(),
 		})
 
-		// Get target from database
-		target, err := h.targetRepo.GetByID(ctx, targetID)
+		// If a specific credential ID was requested, use that one
+		credentialId := r.URL.Query().Get("credential_id")
+
+		// Defensive fix: client library seems to append ?undefined
+		if strings.Contains(credentialId, "?undefined") {
+			credentialId = strings.ReplaceAll(credentialId, "?undefined", "")
+		}
+
+		var requested *uuid.UUID
+		if credentialId != "" {
+			credUUID, err := uuid.Parse(credentialId)
+			if err != nil {
+				http.Error(w, "Invalid credential ID", http.StatusBadRequest)
+				return
+			}
+			requested = &credUUID
+		}
+
+		// The purpose and reason the user gave the session, such as a change ticket
+		purpose := r.URL.Query().Get("purpose")
+		reason := strings.TrimSpace(r.URL.Query().Get("reason"))
+		if err := models.ValidatePurpose(purpose, reason); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		// Protocol-specific options, such as the terminal or display size
+		params, err := handler.ValidateParams(r.URL.Query())
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		userUUID, _ := uuid.Parse(userID)
+		subject := policy.Subject{UserID: userUUID, Role: middleware.GetUserRole(ctx)}
+
+		// A satellite that has lost its hub authorizes from its cached policy bundle
+		offline := h.offline != nil && !h.offline.Online()
+
+		var target *models.Target
+		var cred *models.Credential
+		if offline {
+			target, cred, ok = h.authorizeOffline(ctx, w, subject, targetID, proto, requested, userEmail)
+		} else {
+			target, cred, ok = h.authorize(ctx, w, subject, targetID, proto, requested, userEmail)
+		}
+		if !ok {
+			return
+		}
+
+		// A credential the target kept rejecting stays unused until it is rotated
+		if cred.Quarantined() {
+			h.logger.Warn("Attempt to connect with quarantined credential", map[string]interface{}{
+				"target_id":     targetID.String(),
+				"credential_id": cred.ID.String(),
+				"user":          userEmail,
+			})
+			http.Error(w, errCredentialQuarantined, http.StatusLocked)
+			return
+		}
+
+		// New sessions wait out the target's maintenance unless an admin overrides it
+		if !maintenanceGate(w, r, target, h.systemAudit, h.logger) {
+			return
+		}
+
+		// Zone, target and credential rule settings decide how the session runs
+		var eff *settings.Effective
+		if offline {
+			eff, err = h.offline.Settings(ctx, subject, target, cred)
+		} else {
+			eff, err = h.settings.Resolve(ctx, subject, target, cred)
+		}
 		if err != nil {
-			h.logger.Error("Failed to get target", map[string]interface{}{
+			h.logger.Error("Failed to resolve session settings", map[string]interface{}{
 				"target_id": targetID.String(),
 				"error":     err.Error(),
 			})
-			http.Error(w, "Target not found", http.StatusNotFound)
+			http.Error(w, "Failed to resolve session settings", http.StatusInternalServerError)
 			return
 		}
-
-		// Check if target is enabled
-		if !target.Enabled {
-			h.logger.Warn("Attempt to connect to disabled target", map[string]interface{}{
+		if !eff.Allows(proto) {
+			h.logger.Warn("Protocol not allowed by session settings", map[string]interface{}{
 				"target_id": targetID.String(),
 				"user":      userEmail,
+				"protocol":  proto,
+				"source":    eff.Sources["allowed_protocols"],
 			})
-			http.Error(w, "Target is disabled", http.StatusForbidden)
+			http.Error(w, "Protocol not allowed for this target", http.StatusForbidden)
 			return
 		}
-
-		// Verify protocol matches
-		if target.Protocol != protocol {
-			h.logger.Warn("Protocol mismatch", map[string]interface{}{
-				"requested": protocol,
-				"actual":    target.Protocol,
+		if eff.RequirePurpose && purpose == "" {
+			h.logger.Warn("Session purpose required", map[string]interface{}{
+				"target_id": targetID.String(),
+				"user":      userEmail,
+				"source":    eff.Sources["require_purpose"],
 			})
-			http.Error(w, "Protocol mismatch", http.StatusBadRequest)
+			http.Error(w, "A session purpose is required for this target", http.StatusBadRequest)
 			return
 		}
 
-		// Get credentials for target
-		credentials, err := h.credRepo.GetByTargetID(ctx, targetID)
-		if err != nil || len(credentials) == 0 {
-			h.logger.Error("No credentials found for target", map[string]interface{}{
+		// The session records the banner the user acknowledged, and targets that
+		// require it refuse sessions until they have. A satellite without its hub
+		// can't check acknowledgments, so it refuses those targets.
+		var ack *models.BannerAcknowledgment
+		if eff.Banner != "" && !offline {
+			ack, err = h.banners.Latest(ctx, userUUID, targetID, eff.BannerVersion, time.Now().Add(-models.BannerAcknowledgmentTTL))
+			if err != nil {
+				h.logger.Error("Failed to get banner acknowledgment", map[string]interface{}{
+					"target_id": targetID.String(),
+					"error":     err.Error(),
+				})
+				if eff.RequiresAcknowledgment() {
+					http.Error(w, "Failed to check banner acknowledgment", http.StatusInternalServerError)
+					return
+				}
+			}
+		}
+		if eff.RequiresAcknowledgment() && ack == nil {
+			h.logger.Warn("Banner not acknowledged", map[string]interface{}{
 				"target_id": targetID.String(),
-				"error":     err,
+				"user":      userEmail,
+				"source":    eff.Sources["banner_required"],
 			})
-			http.Error(w, "No credentials configured", http.StatusInternalServerError)
+			http.Error(w, "The target's banner must be acknowledged before connecting", http.StatusPreconditionRequired)
 			return
 		}
 
-		// Use first credential (TODO: implement credential selection)
-		cred := credentials[0]
-
-		// If a specific credential ID was requested, use that one
-		credentialId := r.URL.Query().Get("credential_id")
-
-		// Defensive fix: client library seems to append ?undefined
-		if strings.Contains(credentialId, "?undefined") {
-			credentialId = strings.ReplaceAll(credentialId, "?undefined", "")
+		// Quotas on sessions or bytes refuse new sessions once reached for the day
+		_, apiKeyID, _ := usage.Caller(ctx)
+		if !h.usage.AllowSession(userUUID, apiKeyID) {
+			h.logger.Warn("Session quota reached", map[string]interface{}{
+				"target_id": targetID.String(),
+				"user":      userEmail,
+			})
+			http.Error(w, "Daily session quota reached", http.StatusTooManyRequests)
+			return
 		}
 
-		if credentialId != "" {
-			credUUID, err := uuid.Parse(credentialId)
-			if err == nil {
-				for _, c := range credentials {
-					if c.ID == credUUID {
-						cred = c
-						break
-					}
-				}
-			}
+		// A target at its session limit holds the user in its queue, if the
+		// settings allow waiting, until a slot frees up
+		releaseSlot, ok := acquireSlot(w, r, h.queue, target, eff, h.systemAudit, h.logger)
+		if !ok {
+			return
 		}
+		defer releaseSlot()
 
 		// Check if using raw password (for testing/dev)
 		var vaultCreds *vault.Credentials
@@ -220,11 +363,11 @@ func (h *ConnectionHandler) HandleConnect() http.HandlerFunc {
 			"url":           r.URL.String(),
 			"remote_addr":   r.RemoteAddr,
 			"x_forwarded":   r.Header.Get("X-Forwarded-For"),
-			"protocol":      protocol,
+			"protocol":      proto,
 			"target_id":     targetID.String(),
 			"credential_id": cred.ID.String(),
 		})
-		conn, err := upgrader.Upgrade(w, r, nil)
+		conn, meter, err := wsconn.Upgrade(upgrader, w, r, h.compression)
 		if err != nil {
 			h.logger.Error("Failed to upgrade to WebSocket", map[string]interface{}{
 				"error": err.Error(),
@@ -238,7 +381,6 @@ func (h *ConnectionHandler) HandleConnect() http.HandlerFunc {
 		conn.SetWriteDeadline(time.Time{}) // No write deadline
 
 		// Create audit log entry
-		userUUID, _ := uuid.Parse(userID)
 		auditLog := &models.AuditLog{
 			UserID:        userUUID,
 			TargetID:      targetID,
@@ -246,46 +388,97 @@ func (h *ConnectionHandler) HandleConnect() http.HandlerFunc {
 			SessionStatus: models.SessionStatusActive,
 			ClientIP:      &r.RemoteAddr,
 		}
+		if purpose != "" {
+			auditLog.Purpose = &purpose
+		}
+		if reason != "" {
+			auditLog.Reason = &reason
+		}
+		if ack != nil {
+			auditLog.BannerVersion = &ack.BannerVersion
+			auditLog.BannerAckedAt = &ack.AcknowledgedAt
+		}
 
-		if err := h.auditRepo.Create(ctx, auditLog); err != nil {
+		if offline {
+			// Kept on the satellite until the hub is reachable again
+			auditLog.ID = uuid.New()
+			auditLog.StartTime = time.Now()
+			auditLog.CreatedAt = auditLog.StartTime
+			auditLog.Protocol = proto
+			err = h.offline.RecordSession(auditLog)
+		} else {
+			err = h.auditRepo.Create(ctx, auditLog)
+		}
+		if err != nil {
 			h.logger.Error("Failed to create audit log", map[string]interface{}{
 				"error": err.Error(),
 			})
-			conn.WriteMessage(websocket.TextMessage, []byte("Failed to create audit log"))
+			wsconn.WriteClose(conn, wsconn.CloseInternalError, wsconn.CloseReason{Reason: wsconn.ReasonInternalError, Message: "Failed to create audit log"})
 			return
 		}
 
+		h.usage.SessionStarted(userUUID, apiKeyID)
+
 		h.logger.Info("Session started", map[string]interface{}{
 			"audit_log_id": auditLog.ID.String(),
 			"user":         userEmail,
 			"target":       target.Name,
+			"purpose":      purpose,
 		})
 
-		// Handle connection based on protocol
-		switch protocol {
-		case models.ProtocolSSH:
-			err = h.handleSSHConnection(ctx, conn, target, vaultCreds, auditLog)
-		case models.ProtocolRDP:
-			// Parse resolution from query params
-			width := 1024
-			height := 768
-
-			if wStr := r.URL.Query().Get("width"); wStr != "" {
-				if w, err := strconv.Atoi(wStr); err == nil && w > 0 {
-					width = w
-				}
-			}
-			if hStr := r.URL.Query().Get("height"); hStr != "" {
-				if h, err := strconv.Atoi(hStr); err == nil && h > 0 {
-					height = h
-				}
-			}
+		// A gateway restart closes the session with a token to reopen it
+		ctx, untrack := h.sessions.Track(ctx, reconnectToken(ctx, h.reconnect, r.URL.Path, h.logger))
+		defer untrack()
+
+		// The session ends when it reaches its idle timeout or maximum duration
+		sessionCtx, stopSession := settings.Start(ctx, eff)
+		defer stopSession()
 
-			err = h.handleRDPConnection(ctx, conn, target, vaultCreds, auditLog, width, height)
+		// Sessions opened in a schedule window end with it, unless it is extended
+		if !offline {
+			var stopWindow func()
+			sessionCtx, stopWindow, err = h.windows.Start(sessionCtx, userUUID, targetID)
+			if err != nil {
+				h.logger.Warn("Failed to look up the session's schedule window", map[string]interface{}{
+					"audit_log_id": auditLog.ID.String(),
+					"error":        err.Error(),
+				})
+			}
+			defer stopWindow()
 		}
 
+		// The user is warned before the session ends, and told of what the gateway does to it
+		sessionCtx, stopNotices := h.notices.Start(sessionCtx, auditLog.ID)
+		defer stopNotices()
+
+		// The proxies report whether the recording started, so missing ones can be told apart
+		sessionCtx, recording := recordings.Track(sessionCtx, eff.Recording, eff.RecordingRequired)
+
+		// The protocol runs the session through its middleware
+		err = h.protocols.Serve(sessionCtx, proto, &protocol.Session{
+			Conn:       conn,
+			UserID:     userUUID,
+			UserEmail:  userEmail,
+			Target:     target,
+			Credential: cred,
+			Secret:     vaultCreds,
+			AuditLog:   auditLog,
+			Settings:   eff,
+			Params:     params,
+		})
+
 		// Update audit log with final status
-		if err != nil {
+		auditLog.RecordingState, auditLog.RecordingError = recording.Result()
+		var closeErr *wsconn.CloseError
+		if settings.Limited(err) || errors.As(err, &closeErr) {
+			auditLog.SessionStatus = models.SessionStatusTerminated
+			errMsg := err.Error()
+			auditLog.ErrorMessage = &errMsg
+			h.logger.Info("Session ended by the gateway", map[string]interface{}{
+				"audit_log_id": auditLog.ID.String(),
+				"reason":       errMsg,
+			})
+		} else if err != nil {
 			auditLog.SessionStatus = models.SessionStatusFailed
 			errMsg := err.Error()
 			auditLog.ErrorMessage = &errMsg
@@ -297,67 +490,185 @@ func (h *ConnectionHandler) HandleConnect() http.HandlerFunc {
 			auditLog.SessionStatus = models.SessionStatusCompleted
 		}
 
+		h.usage.Proxied(userUUID, apiKeyID, auditLog.BytesSent, auditLog.BytesReceived)
+
 		// Use a new context for the update since the request context might be cancelled
 		updateCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 		defer cancel()
 
-		if err := h.auditRepo.UpdateStatus(updateCtx, auditLog); err != nil {
+		// Track logons the target rejected; satellites leave it to the hub
+		if !offline {
+			if protocol.AuthenticationFailed(err) {
+				h.authFailures.Failed(updateCtx, target, cred, userUUID, err)
+			} else if auditLog.SessionStatus != models.SessionStatusFailed {
+				h.authFailures.Succeeded(updateCtx, cred)
+			}
+		}
+
+		if offline {
+			auditLog.EndTime = sql.NullTime{Time: time.Now(), Valid: true}
+			err = h.offline.RecordSession(auditLog)
+		} else {
+			err = h.auditRepo.UpdateStatus(updateCtx, auditLog)
+		}
+		if err != nil {
 			h.logger.Error("Failed to update audit log", map[string]interface{}{
 				"error": err.Error(),
 			})
 		}
 
 		h.logger.Info("Session ended", map[string]interface{}{
-			"audit_log_id": auditLog.ID.String(),
-			"status":       auditLog.SessionStatus,
+			"audit_log_id":      auditLog.ID.String(),
+			"status":            auditLog.SessionStatus,
+			"compressed":        meter.Compressed,
+			"payload_bytes":     meter.PayloadBytes(),
+			"wire_bytes":        meter.WireBytes(),
+			"compression_ratio": fmt.Sprintf("%.2f", meter.Ratio()),
 		})
 	}
 }
 
-// handleSSHConnection handles an SSH connection
-func (h *ConnectionHandler) handleSSHConnection(
-	ctx context.Context,
-	conn *websocket.Conn,
-	target *models.Target,
-	creds *vault.Credentials,
-	auditLog *models.AuditLog,
-) error {
-	h.logger.Info("Starting SSH proxy", map[string]interface{}{
-		"target":   target.Hostname,
-		"port":     target.Port,
-		"username": creds.Username,
-	})
+// reconnectToken returns a function issuing the token that reopens the
+// WebSocket at path for the signed-in user. API key sessions get no token,
+// since it would carry the user's role rather than the key's.
+func reconnectToken(ctx context.Context, reconnect *auth.ReconnectAuthenticator, path string, log *logger.Logger) func() string {
+	userID := middleware.GetUserID(ctx)
+	if reconnect == nil || middleware.GetAPIKeyID(ctx) != "" {
+		return nil
+	}
+	return func() string {
+		token, err := reconnect.Issue(userID, path)
+		if err != nil {
+			log.Warn("Failed to issue reconnect token", map[string]interface{}{
+				"path":  path,
+				"error": err.Error(),
+			})
+			return ""
+		}
+		return token
+	}
+}
 
-	err := h.sshProxy.Handle(ctx, conn, target, creds, auditLog)
+// authorize looks up the target and picks the credential the subject may use.
+// On failure it has written the response.
+func (h *ConnectionHandler) authorize(ctx context.Context, w http.ResponseWriter, subject policy.Subject, targetID uuid.UUID, protocol string, requested *uuid.UUID, userEmail string) (*models.Target, *models.Credential, bool) {
+	// Get target from database
+	target, err := h.targetRepo.GetByID(ctx, targetID)
 	if err != nil {
-		return fmt.Errorf("SSH proxy error: %w", err)
+		h.logger.Error("Failed to get target", map[string]interface{}{
+			"target_id": targetID.String(),
+			"error":     err.Error(),
+		})
+		http.Error(w, "Target not found", http.StatusNotFound)
+		return nil, nil, false
 	}
 
-	return nil
-}
+	// Check if target is enabled
+	if !target.Enabled {
+		h.logger.Warn("Attempt to connect to disabled target", map[string]interface{}{
+			"target_id": targetID.String(),
+			"user":      userEmail,
+		})
+		http.Error(w, "Target is disabled", http.StatusForbidden)
+		return nil, nil, false
+	}
 
-// handleRDPConnection handles an RDP connection
-func (h *ConnectionHandler) handleRDPConnection(
-	ctx context.Context,
-	conn *websocket.Conn,
-	target *models.Target,
-	creds *vault.Credentials,
-	auditLog *models.AuditLog,
-	width int,
-	height int,
-) error {
-	h.logger.Info("Starting RDP proxy", map[string]interface{}{
-		"target":   target.Hostname,
-		"port":     target.Port,
-		"username": creds.Username,
-		"width":    width,
-		"height":   height,
-	})
+	// Ephemeral targets stop accepting sessions as soon as they expire,
+	// even if the collector hasn't disabled them yet
+	if target.Expired(time.Now()) {
+		h.logger.Warn("Attempt to connect to expired target", map[string]interface{}{
+			"target_id": targetID.String(),
+			"user":      userEmail,
+		})
+		http.Error(w, "Target has expired", http.StatusGone)
+		return nil, nil, false
+	}
+
+	// Verify protocol matches
+	if target.Protocol != protocol {
+		h.logger.Warn("Protocol mismatch", map[string]interface{}{
+			"requested": protocol,
+			"actual":    target.Protocol,
+		})
+		http.Error(w, "Protocol mismatch", http.StatusBadRequest)
+		return nil, nil, false
+	}
+
+	// Get credentials for target
+	credentials, err := h.credRepo.GetByTargetID(ctx, targetID)
+	if err != nil || len(credentials) == 0 {
+		h.logger.Error("No credentials found for target", map[string]interface{}{
+			"target_id": targetID.String(),
+			"error":     err,
+		})
+		http.Error(w, "No credentials configured", http.StatusInternalServerError)
+		return nil, nil, false
+	}
+
+	allowed, err := h.policy.AllowedCredentials(ctx, subject, target, credentials)
+	if err != nil {
+		h.logger.Error("Failed to evaluate credential policy", map[string]interface{}{
+			"target_id": targetID.String(),
+			"error":     err.Error(),
+		})
+		http.Error(w, "Failed to evaluate access policy", http.StatusInternalServerError)
+		return nil, nil, false
+	}
+
+	cred, err := policy.SelectCredential(allowed, requested)
+	if err != nil {
+		h.logger.Warn("Credential selection failed", map[string]interface{}{
+			"target_id": targetID.String(),
+			"user":      userEmail,
+			"available": len(allowed),
+			"error":     err.Error(),
+		})
+		switch err {
+		case policy.ErrCredentialNotAllowed:
+			http.Error(w, err.Error(), http.StatusForbidden)
+		case policy.ErrAmbiguousCredential:
+			http.Error(w, err.Error(), http.StatusConflict)
+		default:
+			http.Error(w, err.Error(), http.StatusForbidden)
+		}
+		return nil, nil, false
+	}
 
-	err := h.rdpProxy.Handle(ctx, conn, target, creds, auditLog, width, height)
+	return target, cred, true
+}
+
+// authorizeOffline authorizes a session from the satellite's cached policy
+// bundle while the hub is unreachable. On failure it has written the response.
+func (h *ConnectionHandler) authorizeOffline(ctx context.Context, w http.ResponseWriter, subject policy.Subject, targetID uuid.UUID, protocol string, requested *uuid.UUID, userEmail string) (*models.Target, *models.Credential, bool) {
+	target, cred, err := h.offline.Authorize(ctx, subject, targetID, requested)
 	if err != nil {
-		return fmt.Errorf("RDP proxy error: %w", err)
+		h.logger.Warn("Offline authorization failed", map[string]interface{}{
+			"target_id": targetID.String(),
+			"user":      userEmail,
+			"error":     err.Error(),
+		})
+		switch err {
+		case tunnel.ErrOfflineDenied, tunnel.ErrNoBundle:
+			http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		case tunnel.ErrTargetNotCached:
+			http.Error(w, err.Error(), http.StatusNotFound)
+		case policy.ErrAmbiguousCredential:
+			http.Error(w, err.Error(), http.StatusConflict)
+		default:
+			http.Error(w, err.Error(), http.StatusForbidden)
+		}
+		return nil, nil, false
+	}
+
+	if target.Protocol != protocol {
+		http.Error(w, "Protocol mismatch", http.StatusBadRequest)
+		return nil, nil, false
 	}
 
-	return nil
+	h.logger.Info("Session authorized offline from cached policy", map[string]interface{}{
+		"target_id":     targetID.String(),
+		"user":          userEmail,
+		"credential_id": cred.ID.String(),
+	})
+	return target, cred, true
 }
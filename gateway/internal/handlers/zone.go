@@ -2,11 +2,13 @@ package handlers
 
 import (
 	"encoding/json"
+	"errors"
 	"net/http"
 
-	"github.com/VanCannon/openpam/gateway/internal/logger"
 	"github.com/VanCannon/openpam/gateway/internal/models"
 	"github.com/VanCannon/openpam/gateway/internal/repository"
+	"github.com/VanCannon/openpam/gateway/internal/validate"
+	"github.com/VanCannon/openpam/pkg/logger"
 	"github.com/google/uuid"
 )
 
@@ -51,6 +53,23 @@ func (h *ZoneHandler) HandleList() http.HandlerFunc {
 	}
 }
 
+// createZoneRequest is the body of a new zone
+type createZoneRequest struct {
+	Name        string                  `json:"name"`
+	Type        string                  `json:"type"`
+	Description string                  `json:"description"`
+	Settings    *models.SessionSettings `json:"settings"`
+}
+
+// Validate checks the fields of a new zone
+func (req *createZoneRequest) Validate() validate.Errors {
+	var errs validate.Errors
+	errs.Required("name", req.Name)
+	errs.MaxLength("name", req.Name, 255)
+	errs.OneOf("type", req.Type, models.ZoneTypeHub, models.ZoneTypeSatellite)
+	return errs
+}
+
 // HandleCreate creates a new zone
 func (h *ZoneHandler) HandleCreate() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
@@ -61,26 +80,16 @@ func (h *ZoneHandler) HandleCreate() http.HandlerFunc {
 
 		ctx := r.Context()
 
-		var req struct {
-			Name        string `json:"name"`
-			Type        string `json:"type"`
-			Description string `json:"description"`
-		}
-
-		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-			http.Error(w, "Invalid request body", http.StatusBadRequest)
+		var req createZoneRequest
+		if !validate.Decode(w, r, &req) {
 			return
 		}
 
-		// Validate
-		if req.Name == "" {
-			http.Error(w, "Name is required", http.StatusBadRequest)
-			return
-		}
-
-		if req.Type != models.ZoneTypeHub && req.Type != models.ZoneTypeSatellite {
-			http.Error(w, "Invalid zone type", http.StatusBadRequest)
-			return
+		if req.Settings != nil {
+			if err := req.Settings.Validate(true); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
 		}
 
 		zone := &models.Zone{
@@ -88,6 +97,9 @@ func (h *ZoneHandler) HandleCreate() http.HandlerFunc {
 			Type:        req.Type,
 			Description: req.Description,
 		}
+		if req.Settings != nil {
+			zone.Settings = *req.Settings
+		}
 
 		if err := h.zoneRepo.Create(ctx, zone); err != nil {
 			h.logger.Error("Failed to create zone", map[string]interface{}{
@@ -129,6 +141,7 @@ func (h *ZoneHandler) HandleGet() http.HandlerFunc {
 			return
 		}
 
+		setETag(w, zone.Version)
 		w.Header().Set("Content-Type", "application/json")
 		json.NewEncoder(w).Encode(zone)
 	}
@@ -152,27 +165,54 @@ func (h *ZoneHandler) HandleUpdate() http.HandlerFunc {
 		}
 
 		var req struct {
-			Name        string `json:"name"`
-			Type        string `json:"type"`
-			Description string `json:"description"`
+			Name        string                  `json:"name"`
+			Type        string                  `json:"type"`
+			Description string                  `json:"description"`
+			Settings    *models.SessionSettings `json:"settings"`
+			Version     *int                    `json:"version"`
 		}
 
-		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-			http.Error(w, "Invalid request body", http.StatusBadRequest)
+		if !validate.Decode(w, r, &req) {
 			return
 		}
 
+		version, ok := requireVersion(w, r, req.Version)
+		if !ok {
+			return
+		}
+
+		if req.Settings != nil {
+			if err := req.Settings.Validate(true); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+		}
+
 		zone, err := h.zoneRepo.GetByID(ctx, zoneID)
 		if err != nil {
 			http.Error(w, "Zone not found", http.StatusNotFound)
 			return
 		}
 
+		if zone.Version != version {
+			writeVersionConflict(w, zone.Version, zone)
+			return
+		}
+
 		zone.Name = req.Name
 		zone.Type = req.Type
 		zone.Description = req.Description
+		if req.Settings != nil {
+			zone.Settings = *req.Settings
+		}
 
 		if err := h.zoneRepo.Update(ctx, zone); err != nil {
+			if errors.Is(err, repository.ErrVersionConflict) {
+				if current, err := h.zoneRepo.GetByID(ctx, zoneID); err == nil {
+					writeVersionConflict(w, current.Version, current)
+					return
+				}
+			}
 			h.logger.Error("Failed to update zone", map[string]interface{}{
 				"error": err.Error(),
 			})
@@ -180,6 +220,7 @@ func (h *ZoneHandler) HandleUpdate() http.HandlerFunc {
 			return
 		}
 
+		setETag(w, zone.Version)
 		w.Header().Set("Content-Type", "application/json")
 		json.NewEncoder(w).Encode(zone)
 	}
@@ -0,0 +1,179 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/VanCannon/openpam/gateway/internal/models"
+	"github.com/VanCannon/openpam/gateway/internal/repository"
+	"github.com/VanCannon/openpam/gateway/internal/validate"
+	"github.com/VanCannon/openpam/pkg/logger"
+	"github.com/google/uuid"
+)
+
+// ZoneAdminHandler handles the assignment of zone admins
+type ZoneAdminHandler struct {
+	zoneAdminRepo *repository.ZoneAdminRepository
+	zoneRepo      *repository.ZoneRepository
+	userRepo      *repository.UserRepository
+	auditRepo     systemAuditStore
+	logger        *logger.Logger
+}
+
+// NewZoneAdminHandler creates a new zone admin handler
+func NewZoneAdminHandler(zoneAdminRepo *repository.ZoneAdminRepository, zoneRepo *repository.ZoneRepository, userRepo *repository.UserRepository, auditRepo *repository.SystemAuditLogRepository, log *logger.Logger) *ZoneAdminHandler {
+	return &ZoneAdminHandler{
+		zoneAdminRepo: zoneAdminRepo,
+		zoneRepo:      zoneRepo,
+		userRepo:      userRepo,
+		auditRepo:     auditRepo,
+		logger:        log,
+	}
+}
+
+// writeOutsideZones responds with 403 when a zone admin's change was refused
+// for being outside their zones, and reports whether it did
+func writeOutsideZones(w http.ResponseWriter, err error) bool {
+	if !errors.Is(err, repository.ErrOutsideZones) {
+		return false
+	}
+	http.Error(w, "Forbidden: "+repository.ErrOutsideZones.Error(), http.StatusForbidden)
+	return true
+}
+
+// zone resolves the zone in the path, responding with an error if there is none
+func (h *ZoneAdminHandler) zone(w http.ResponseWriter, r *http.Request) (*models.Zone, bool) {
+	zoneID, err := uuid.Parse(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, "Invalid zone ID", http.StatusBadRequest)
+		return nil, false
+	}
+
+	zone, err := h.zoneRepo.GetByID(r.Context(), zoneID)
+	if err != nil {
+		http.Error(w, "Zone not found", http.StatusNotFound)
+		return nil, false
+	}
+	return zone, true
+}
+
+// HandleList lists the admins of a zone
+// Route: GET /api/v1/zones/{id}/admins
+func (h *ZoneAdminHandler) HandleList() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		zone, ok := h.zone(w, r)
+		if !ok {
+			return
+		}
+
+		admins, err := h.zoneAdminRepo.ListByZone(r.Context(), zone.ID)
+		if err != nil {
+			h.logger.Error("Failed to list zone admins", map[string]interface{}{
+				"zone_id": zone.ID.String(),
+				"error":   err.Error(),
+			})
+			http.Error(w, "Failed to list zone admins", http.StatusInternalServerError)
+			return
+		}
+
+		if admins == nil {
+			admins = []*models.ZoneAdmin{}
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"admins": admins,
+			"count":  len(admins),
+		})
+	}
+}
+
+// HandleAssign makes a user an admin of a zone
+// Route: POST /api/v1/zones/{id}/admins
+func (h *ZoneAdminHandler) HandleAssign() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+
+		zone, ok := h.zone(w, r)
+		if !ok {
+			return
+		}
+
+		var req struct {
+			UserID uuid.UUID `json:"user_id"`
+		}
+		if !validate.Decode(w, r, &req) {
+			return
+		}
+		if req.UserID == uuid.Nil {
+			validate.WriteProblem(w, r, http.StatusBadRequest, "validation_failed", validate.Errors{{Field: "user_id", Message: "is required"}})
+			return
+		}
+
+		user, err := h.userRepo.GetByID(ctx, req.UserID)
+		if err != nil {
+			http.Error(w, "User not found", http.StatusNotFound)
+			return
+		}
+		if user.Role == models.RoleAdmin {
+			http.Error(w, "Admins already manage every zone", http.StatusBadRequest)
+			return
+		}
+
+		if err := h.zoneAdminRepo.Assign(ctx, zone.ID, user.ID); err != nil {
+			h.logger.Error("Failed to assign zone admin", map[string]interface{}{
+				"zone_id": zone.ID.String(),
+				"user_id": user.ID.String(),
+				"error":   err.Error(),
+			})
+			http.Error(w, "Failed to assign zone admin", http.StatusInternalServerError)
+			return
+		}
+
+		h.audit(r, models.EventTypeZoneAdminAssigned, "assign", zone, user.ID)
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// HandleRemove removes a user's assignment as admin of a zone
+// Route: DELETE /api/v1/zones/{id}/admins/{user_id}
+func (h *ZoneAdminHandler) HandleRemove() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		zone, ok := h.zone(w, r)
+		if !ok {
+			return
+		}
+
+		userID, err := uuid.Parse(r.PathValue("user_id"))
+		if err != nil {
+			http.Error(w, "Invalid user ID", http.StatusBadRequest)
+			return
+		}
+
+		if err := h.zoneAdminRepo.Remove(r.Context(), zone.ID, userID); err != nil {
+			http.Error(w, "Zone admin not found", http.StatusNotFound)
+			return
+		}
+
+		h.audit(r, models.EventTypeZoneAdminRemoved, "remove", zone, userID)
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// audit records a change to a zone's admins
+func (h *ZoneAdminHandler) audit(r *http.Request, eventType, action string, zone *models.Zone, userID uuid.UUID) {
+	actorID, ip := requester(r)
+	details := map[string]interface{}{
+		"zone_id":   zone.ID.String(),
+		"zone_name": zone.Name,
+		"user_id":   userID.String(),
+	}
+	if err := h.auditRepo.CreateSimple(r.Context(), eventType, actorID, action, models.AuditStatusSuccess, &ip, details); err != nil {
+		h.logger.Error("Failed to create system audit log", map[string]interface{}{
+			"error": err.Error(),
+		})
+	}
+}
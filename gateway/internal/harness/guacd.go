@@ -0,0 +1,142 @@
+package harness
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/VanCannon/openpam/gateway/internal/rdp"
+	"github.com/VanCannon/openpam/pkg/logger"
+)
+
+// guacdArgs are the connection parameters the stand-in asks for. The RDP
+// proxy fills in the ones it knows and leaves the rest empty.
+var guacdArgs = []string{"VERSION_1_5_0", "hostname", "port", "username", "password", "width", "height", "dpi"}
+
+// idleFrameInterval is how often a frame is sent while the client is idle,
+// like a desktop with a blinking cursor
+const idleFrameInterval = time.Second
+
+// Guacd stands in for guacd. It completes the Guacamole handshake without
+// connecting anywhere, then answers every key and mouse instruction with a
+// frame: a small rectangle fill followed by sync.
+type Guacd struct {
+	logger   *logger.Logger
+	sessions atomic.Int64
+}
+
+// NewGuacd creates a guacd stand-in
+func NewGuacd(log *logger.Logger) *Guacd {
+	return &Guacd{logger: log}
+}
+
+// ServeConn runs a Guacamole connection until the client closes it or ctx is done
+func (g *Guacd) ServeConn(ctx context.Context, conn net.Conn) {
+	defer conn.Close()
+
+	go func() {
+		<-ctx.Done()
+		conn.Close()
+	}()
+
+	parser := rdp.NewParser(bufio.NewReader(conn))
+	width, height := "1024", "768"
+
+	// select, then the client's capabilities until connect
+	for handshake := true; handshake; {
+		instr, err := parser.Next()
+		if err != nil {
+			return
+		}
+		switch instr.Opcode() {
+		case "select":
+			if err := writeInstruction(conn, "args", guacdArgs...); err != nil {
+				return
+			}
+		case "size":
+			if args := instr.Args(); len(args) >= 2 {
+				width, height = args[0], args[1]
+			}
+		case "connect":
+			handshake = false
+		}
+	}
+
+	id := g.sessions.Add(1)
+	if err := writeInstruction(conn, "ready", fmt.Sprintf("$synthetic-%d", id)); err != nil {
+		return
+	}
+	if err := writeInstruction(conn, "size", "0", width, height); err != nil {
+		return
+	}
+
+	// Frames are written by the idle ticker and in answer to input
+	var mu sync.Mutex
+	frame := func() error {
+		mu.Lock()
+		defer mu.Unlock()
+		now := strconv.FormatInt(time.Now().UnixMilli(), 10)
+		var b strings.Builder
+		b.Write(encodeInstruction("rect", "0", "0", "0", "8", "8"))
+		b.Write(encodeInstruction("cfill", "14", "0", "0", "0", "0", "255"))
+		b.Write(encodeInstruction("sync", now))
+		_, err := conn.Write([]byte(b.String()))
+		return err
+	}
+
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		ticker := time.NewTicker(idleFrameInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				if frame() != nil {
+					conn.Close()
+					return
+				}
+			}
+		}
+	}()
+
+	for {
+		instr, err := parser.Next()
+		if err != nil {
+			return
+		}
+		switch instr.Opcode() {
+		case "key", "mouse":
+			if frame() != nil {
+				return
+			}
+		case "disconnect":
+			return
+		}
+	}
+}
+
+// writeInstruction writes a single Guacamole instruction
+func writeInstruction(conn net.Conn, opcode string, args ...string) error {
+	_, err := conn.Write(encodeInstruction(opcode, args...))
+	return err
+}
+
+// encodeInstruction encodes a Guacamole instruction
+func encodeInstruction(opcode string, args ...string) []byte {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%d.%s", len(opcode), opcode)
+	for _, arg := range args {
+		fmt.Fprintf(&b, ",%d.%s", len(arg), arg)
+	}
+	b.WriteString(";")
+	return []byte(b.String())
+}
@@ -0,0 +1,113 @@
+// Package harness runs synthetic targets inside the gateway for load and
+// regression testing of the session proxies without real servers: an SSH
+// server that echoes terminal input, and a guacd stand-in that completes the
+// Guacamole handshake and answers RDP input with frames. It is only started
+// in development mode.
+package harness
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync"
+
+	"github.com/VanCannon/openpam/pkg/logger"
+)
+
+// Label marks the targets the harness seeds, so load generators can find them
+const Label = "synthetic"
+
+// Config holds where the synthetic targets listen
+type Config struct {
+	SSHAddress   string // SSH echo server
+	GuacdAddress string // guacd stand-in the RDP proxy is pointed at
+}
+
+// Harness runs the synthetic targets until stopped
+type Harness struct {
+	config Config
+	ssh    *SSHServer
+	guacd  *Guacd
+	logger *logger.Logger
+
+	mu        sync.Mutex
+	listeners []net.Listener
+	wg        sync.WaitGroup
+}
+
+// New creates the synthetic targets. The SSH server's host key is generated
+// here, so it changes on every start.
+func New(cfg Config, log *logger.Logger) (*Harness, error) {
+	sshServer, err := NewSSHServer(log)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Harness{
+		config: cfg,
+		ssh:    sshServer,
+		guacd:  NewGuacd(log),
+		logger: log,
+	}, nil
+}
+
+// Start listens on the configured addresses and serves connections in the background
+func (h *Harness) Start() error {
+	sshListener, err := net.Listen("tcp", h.config.SSHAddress)
+	if err != nil {
+		return err
+	}
+	guacdListener, err := net.Listen("tcp", h.config.GuacdAddress)
+	if err != nil {
+		sshListener.Close()
+		return err
+	}
+
+	h.mu.Lock()
+	h.listeners = []net.Listener{sshListener, guacdListener}
+	h.mu.Unlock()
+
+	h.wg.Add(2)
+	go h.serve(sshListener, h.ssh.ServeConn)
+	go h.serve(guacdListener, h.guacd.ServeConn)
+
+	h.logger.Warn("Test harness started with synthetic targets", map[string]interface{}{
+		"ssh_address":   sshListener.Addr().String(),
+		"guacd_address": guacdListener.Addr().String(),
+	})
+	return nil
+}
+
+// Stop closes the listeners and waits for them to stop accepting. Sessions
+// in progress end when the gateway closes its side.
+func (h *Harness) Stop() {
+	h.mu.Lock()
+	for _, l := range h.listeners {
+		l.Close()
+	}
+	h.listeners = nil
+	h.mu.Unlock()
+
+	h.wg.Wait()
+}
+
+func (h *Harness) serve(l net.Listener, handle func(ctx context.Context, conn net.Conn)) {
+	defer h.wg.Done()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			if !errors.Is(err, net.ErrClosed) {
+				h.logger.Error("Test harness stopped accepting", map[string]interface{}{
+					"address": l.Addr().String(),
+					"error":   err.Error(),
+				})
+			}
+			return
+		}
+		go handle(ctx, conn)
+	}
+}
@@ -0,0 +1,127 @@
+package harness
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/VanCannon/openpam/gateway/internal/rdp"
+	"github.com/VanCannon/openpam/pkg/logger"
+	"golang.org/x/crypto/ssh"
+)
+
+// tcpPipe returns both ends of a loopback TCP connection. Unlike net.Pipe,
+// writes are buffered, as the SSH version exchange needs.
+func tcpPipe(t *testing.T) (net.Conn, net.Conn) {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	client, err := net.Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	server, err := l.Accept()
+	if err != nil {
+		client.Close()
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		client.Close()
+		server.Close()
+	})
+	return client, server
+}
+
+func TestSSHServer_Echo(t *testing.T) {
+	server, err := NewSSHServer(logger.New(logger.LevelError, io.Discard))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	clientConn, serverConn := tcpPipe(t)
+	go server.ServeConn(context.Background(), serverConn)
+
+	conn, channels, requests, err := ssh.NewClientConn(clientConn, "synthetic", &ssh.ClientConfig{
+		User:            "loadtest",
+		Auth:            []ssh.AuthMethod{ssh.Password("anything")},
+		HostKeyCallback: ssh.InsecureIgnoreHostKey(),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := ssh.NewClient(conn, channels, requests)
+	defer client.Close()
+
+	session, err := client.NewSession()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stdin, _ := session.StdinPipe()
+	stdout, _ := session.StdoutPipe()
+	if err := session.RequestPty("xterm", 24, 80, ssh.TerminalModes{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := session.Shell(); err != nil {
+		t.Fatal(err)
+	}
+
+	banner := make([]byte, len(Banner))
+	if _, err := io.ReadFull(stdout, banner); err != nil || string(banner) != Banner {
+		t.Fatalf("banner = %q, %v", banner, err)
+	}
+
+	io.WriteString(stdin, "ls\r")
+	echo := make([]byte, 3)
+	if _, err := io.ReadFull(stdout, echo); err != nil || string(echo) != "ls\r" {
+		t.Errorf("echo = %q, %v", echo, err)
+	}
+}
+
+func TestGuacd_Handshake(t *testing.T) {
+	guacd := NewGuacd(logger.New(logger.LevelError, io.Discard))
+
+	clientConn, serverConn := tcpPipe(t)
+	go guacd.ServeConn(context.Background(), serverConn)
+	defer clientConn.Close()
+	clientConn.SetDeadline(time.Now().Add(5 * time.Second))
+
+	parser := rdp.NewParser(bufio.NewReader(clientConn))
+	next := func() (string, []string) {
+		t.Helper()
+		instr, err := parser.Next()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return instr.Opcode(), instr.Args()
+	}
+
+	clientConn.Write(encodeInstruction("select", "rdp"))
+	if opcode, args := next(); opcode != "args" || args[0] != "VERSION_1_5_0" {
+		t.Fatalf("got %s %v, want args", opcode, args)
+	}
+
+	clientConn.Write(encodeInstruction("size", "1280", "720", "96"))
+	clientConn.Write(encodeInstruction("connect", make([]string, len(guacdArgs))...))
+	if opcode, args := next(); opcode != "ready" || !strings.HasPrefix(args[0], "$synthetic-") {
+		t.Fatalf("got %s %v, want ready", opcode, args)
+	}
+	if opcode, args := next(); opcode != "size" || args[1] != "1280" || args[2] != "720" {
+		t.Fatalf("got %s %v, want the client's size", opcode, args)
+	}
+
+	// Input is answered with a frame
+	clientConn.Write(encodeInstruction("key", "97", "1"))
+	for {
+		if opcode, _ := next(); opcode == "sync" {
+			break
+		}
+	}
+}
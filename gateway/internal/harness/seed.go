@@ -0,0 +1,110 @@
+package harness
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strconv"
+
+	"github.com/VanCannon/openpam/gateway/internal/models"
+	"github.com/google/uuid"
+)
+
+// ZoneStore is the subset of the zone repository seeding needs
+type ZoneStore interface {
+	GetByName(ctx context.Context, name string) (*models.Zone, error)
+	Create(ctx context.Context, zone *models.Zone) error
+}
+
+// TargetStore is the subset of the target repository seeding needs
+type TargetStore interface {
+	ListByZone(ctx context.Context, zoneID uuid.UUID) ([]*models.Target, error)
+	Create(ctx context.Context, target *models.Target) error
+}
+
+// CredentialStore is the subset of the credential repository seeding needs
+type CredentialStore interface {
+	Create(ctx context.Context, cred *models.Credential) error
+}
+
+// Seed creates the synthetic zone and a target with a credential for each
+// synthetic server, unless they exist. It returns the synthetic targets.
+func (h *Harness) Seed(ctx context.Context, zones ZoneStore, targets TargetStore, creds CredentialStore) ([]*models.Target, error) {
+	zone, err := zones.GetByName(ctx, Label)
+	if err != nil {
+		zone = &models.Zone{
+			Name:        Label,
+			Type:        models.ZoneTypeHub,
+			Description: "Synthetic targets of the test harness",
+		}
+		if err := zones.Create(ctx, zone); err != nil {
+			return nil, err
+		}
+	}
+
+	existing, err := targets.ListByZone(ctx, zone.ID)
+	if err != nil {
+		return nil, err
+	}
+	byName := make(map[string]*models.Target, len(existing))
+	for _, t := range existing {
+		byName[t.Name] = t
+	}
+
+	sshHost, sshPort, err := splitAddress(h.config.SSHAddress)
+	if err != nil {
+		return nil, err
+	}
+	wanted := []*models.Target{
+		{Name: Label + "-ssh", Protocol: models.ProtocolSSH, Hostname: sshHost, Port: sshPort},
+		// The guacd stand-in never connects to the host
+		{Name: Label + "-rdp", Protocol: models.ProtocolRDP, Hostname: "synthetic.invalid", Port: 3389},
+	}
+
+	seeded := make([]*models.Target, 0, len(wanted))
+	for _, target := range wanted {
+		if t, ok := byName[target.Name]; ok {
+			seeded = append(seeded, t)
+			continue
+		}
+
+		target.ZoneID = zone.ID
+		target.Enabled = true
+		target.Environment = "test"
+		target.Labels = models.Labels{Label: "true"}
+		target.ConnectionNotes = "Synthetic target of the test harness. Input is echoed back."
+		if err := targets.Create(ctx, target); err != nil {
+			return nil, err
+		}
+
+		cred := &models.Credential{
+			TargetID:        target.ID,
+			Username:        "loadtest",
+			VaultSecretPath: "raw:synthetic",
+			Description:     "Accepted by the synthetic target",
+			IsDefault:       true,
+		}
+		if err := creds.Create(ctx, cred); err != nil {
+			return nil, err
+		}
+		seeded = append(seeded, target)
+	}
+
+	return seeded, nil
+}
+
+// splitAddress splits a listen address, using loopback for an empty host
+func splitAddress(address string) (string, int, error) {
+	host, portStr, err := net.SplitHostPort(address)
+	if err != nil {
+		return "", 0, fmt.Errorf("invalid address %q: %w", address, err)
+	}
+	port, err := strconv.Atoi(portStr)
+	if err != nil {
+		return "", 0, fmt.Errorf("invalid port in %q", address)
+	}
+	if host == "" || host == "0.0.0.0" || host == "::" {
+		host = "127.0.0.1"
+	}
+	return host, port, nil
+}
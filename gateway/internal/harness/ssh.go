@@ -0,0 +1,108 @@
+package harness
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"fmt"
+	"io"
+	"net"
+
+	"github.com/VanCannon/openpam/pkg/logger"
+	"golang.org/x/crypto/ssh"
+)
+
+// Banner is written when a synthetic SSH shell starts, before any input is echoed
+const Banner = "OpenPAM synthetic target\r\n$ "
+
+// SSHServer is an SSH server that accepts any password and echoes shell
+// input back, the way a terminal with echo on does
+type SSHServer struct {
+	config *ssh.ServerConfig
+	logger *logger.Logger
+}
+
+// NewSSHServer creates an SSH echo server with a new host key
+func NewSSHServer(log *logger.Logger) (*SSHServer, error) {
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate host key: %w", err)
+	}
+	signer, err := ssh.NewSignerFromKey(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create host key signer: %w", err)
+	}
+
+	config := &ssh.ServerConfig{
+		PasswordCallback: func(conn ssh.ConnMetadata, password []byte) (*ssh.Permissions, error) {
+			return nil, nil
+		},
+	}
+	config.AddHostKey(signer)
+
+	return &SSHServer{config: config, logger: log}, nil
+}
+
+// ServeConn runs an SSH connection until the client closes it or ctx is done
+func (s *SSHServer) ServeConn(ctx context.Context, conn net.Conn) {
+	defer conn.Close()
+
+	sshConn, channels, requests, err := ssh.NewServerConn(conn, s.config)
+	if err != nil {
+		s.logger.Debug("Synthetic SSH handshake failed", map[string]interface{}{
+			"error": err.Error(),
+		})
+		return
+	}
+	defer sshConn.Close()
+	go ssh.DiscardRequests(requests)
+
+	go func() {
+		<-ctx.Done()
+		sshConn.Close()
+	}()
+
+	for newChannel := range channels {
+		if newChannel.ChannelType() != "session" {
+			newChannel.Reject(ssh.UnknownChannelType, "only sessions are supported")
+			continue
+		}
+		channel, requests, err := newChannel.Accept()
+		if err != nil {
+			continue
+		}
+		go s.serveSession(channel, requests)
+	}
+}
+
+// serveSession accepts the terminal requests of a session and echoes its
+// input once the shell starts
+func (s *SSHServer) serveSession(channel ssh.Channel, requests <-chan *ssh.Request) {
+	defer channel.Close()
+
+	for req := range requests {
+		switch req.Type {
+		case "pty-req", "window-change", "env":
+			req.Reply(true, nil)
+		case "shell":
+			req.Reply(true, nil)
+			go func() {
+				for req := range requests {
+					req.Reply(req.Type == "window-change", nil)
+				}
+			}()
+			s.echo(channel)
+			return
+		default:
+			req.Reply(false, nil)
+		}
+	}
+}
+
+func (s *SSHServer) echo(channel ssh.Channel) {
+	if _, err := io.WriteString(channel, Banner); err != nil {
+		return
+	}
+	io.Copy(channel, channel)
+	channel.SendRequest("exit-status", false, ssh.Marshal(struct{ Status uint32 }{0}))
+}
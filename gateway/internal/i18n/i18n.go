@@ -0,0 +1,165 @@
+// Package i18n renders API messages and enumeration labels in the caller's
+// language. Messages are keyed by stable codes that clients can match on. The
+// English text of each message is what the handlers write, so their error
+// responses are recognized and localized without the handlers knowing.
+package i18n
+
+import (
+	"embed"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// DefaultLocale is used when the caller accepts none of the built-in locales,
+// and for messages a locale doesn't translate
+const DefaultLocale = "en"
+
+//go:embed locales/*.json
+var localeFiles embed.FS
+
+var (
+	// catalogs maps each locale to its messages and labels by key
+	catalogs = make(map[string]map[string]string)
+	// codes maps the English text of each message to its code
+	codes = make(map[string]string)
+)
+
+func init() {
+	files, err := localeFiles.ReadDir("locales")
+	if err != nil {
+		panic(err)
+	}
+	for _, f := range files {
+		data, err := localeFiles.ReadFile("locales/" + f.Name())
+		if err != nil {
+			panic(err)
+		}
+		catalog := make(map[string]string)
+		if err := json.Unmarshal(data, &catalog); err != nil {
+			panic(fmt.Sprintf("i18n: invalid catalog %s: %v", f.Name(), err))
+		}
+		catalogs[strings.TrimSuffix(f.Name(), path.Ext(f.Name()))] = catalog
+	}
+
+	// Labels are keyed by "<enum>.<value>"; only messages are matched by text
+	for key, text := range catalogs[DefaultLocale] {
+		if !strings.Contains(key, ".") {
+			codes[text] = key
+		}
+	}
+}
+
+// Locales returns the built-in locales, the default first
+func Locales() []string {
+	locales := make([]string, 0, len(catalogs))
+	for locale := range catalogs {
+		if locale != DefaultLocale {
+			locales = append(locales, locale)
+		}
+	}
+	sort.Strings(locales)
+	return append([]string{DefaultLocale}, locales...)
+}
+
+// Negotiate picks the built-in locale that best matches an Accept-Language
+// header. Regional tags fall back to their language, so "de-AT" gets "de".
+func Negotiate(acceptLanguage string) string {
+	best, bestQ := DefaultLocale, 0.0
+	for _, part := range strings.Split(acceptLanguage, ",") {
+		tag, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		q := 1.0
+		if v, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			parsed, err := strconv.ParseFloat(v, 64)
+			if err != nil {
+				continue
+			}
+			q = parsed
+		}
+		lang, _, _ := strings.Cut(strings.ToLower(strings.TrimSpace(tag)), "-")
+		if _, ok := catalogs[lang]; ok && q > bestQ {
+			best, bestQ = lang, q
+		}
+	}
+	return best
+}
+
+// FromRequest picks the locale for a request: the locale query parameter if it
+// names a built-in locale, otherwise the Accept-Language header
+func FromRequest(r *http.Request) string {
+	if locale := r.URL.Query().Get("locale"); locale != "" {
+		if _, ok := catalogs[locale]; ok {
+			return locale
+		}
+	}
+	return Negotiate(r.Header.Get("Accept-Language"))
+}
+
+// Text returns the message or label for key in locale, falling back to
+// English and then to the key itself
+func Text(locale, key string) string {
+	if text, ok := catalogs[locale][key]; ok {
+		return text
+	}
+	if text, ok := catalogs[DefaultLocale][key]; ok {
+		return text
+	}
+	return key
+}
+
+// Messages returns every message and label of a locale, with English filling
+// in what it doesn't translate
+func Messages(locale string) map[string]string {
+	messages := make(map[string]string, len(catalogs[DefaultLocale]))
+	for key := range catalogs[DefaultLocale] {
+		messages[key] = Text(locale, key)
+	}
+	return messages
+}
+
+// Code returns the code of a message from its English text
+func Code(message string) (string, bool) {
+	code, ok := codes[message]
+	return code, ok
+}
+
+// StatusCode returns the generic code for an HTTP status, used for messages
+// the catalog doesn't know and as the title of problem responses
+func StatusCode(status int) string {
+	switch status {
+	case http.StatusBadRequest:
+		return "bad_request"
+	case http.StatusUnauthorized:
+		return "unauthorized"
+	case http.StatusForbidden:
+		return "forbidden"
+	case http.StatusNotFound:
+		return "not_found"
+	case http.StatusMethodNotAllowed:
+		return "method_not_allowed"
+	case http.StatusConflict:
+		return "conflict"
+	case http.StatusGone:
+		return "gone"
+	case http.StatusRequestEntityTooLarge:
+		return "payload_too_large"
+	case http.StatusPreconditionRequired:
+		return "precondition_required"
+	case http.StatusTooManyRequests:
+		return "too_many_requests"
+	case http.StatusNotImplemented:
+		return "not_implemented"
+	case http.StatusBadGateway:
+		return "bad_gateway"
+	case http.StatusServiceUnavailable:
+		return "service_unavailable"
+	}
+	if status >= 500 {
+		return "internal_error"
+	}
+	return "bad_request"
+}
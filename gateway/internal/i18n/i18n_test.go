@@ -0,0 +1,108 @@
+package i18n
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/VanCannon/openpam/pkg/recovery"
+)
+
+func TestCatalogs(t *testing.T) {
+	en := catalogs[DefaultLocale]
+	texts := make(map[string]string)
+	for key, text := range en {
+		if strings.Contains(key, ".") {
+			continue
+		}
+		if other, ok := texts[text]; ok {
+			t.Errorf("%s and %s share the text %q", key, other, text)
+		}
+		texts[text] = key
+	}
+
+	for locale, catalog := range catalogs {
+		for key := range en {
+			if catalog[key] == "" {
+				t.Errorf("%s: missing %s", locale, key)
+			}
+		}
+		for key := range catalog {
+			if _, ok := en[key]; !ok {
+				t.Errorf("%s: %s is not in the English catalog", locale, key)
+			}
+		}
+	}
+}
+
+func TestNegotiate(t *testing.T) {
+	tests := map[string]string{
+		"":                             "en",
+		"de":                           "de",
+		"de-AT,de;q=0.9,en;q=0.8":      "de",
+		"ja,fr;q=0.5":                  "fr",
+		"en;q=0.3,es;q=0.7":            "es",
+		"ja, zh-CN":                    "en",
+		"fr;q=bogus,de;q=0.1":          "de",
+		"FR-ca":                        "fr",
+		"*":                            "en",
+		"de;q=0.5, fr;q=0.5, es;q=0.4": "de",
+	}
+	for header, want := range tests {
+		if got := Negotiate(header); got != want {
+			t.Errorf("Negotiate(%q) = %s, want %s", header, got, want)
+		}
+	}
+}
+
+func serve(h http.HandlerFunc, header http.Header) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/targets/x", nil)
+	req.Header = header
+	rec := httptest.NewRecorder()
+	Middleware(h).ServeHTTP(rec, req)
+	return rec
+}
+
+func TestMiddleware(t *testing.T) {
+	notFound := func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "Target not found", http.StatusNotFound)
+	}
+
+	rec := serve(notFound, http.Header{"Accept-Language": {"de-DE,de;q=0.9"}})
+	if rec.Code != http.StatusNotFound || strings.TrimSpace(rec.Body.String()) != "Ziel nicht gefunden" {
+		t.Errorf("response = %d %q, want 404 in German", rec.Code, rec.Body.String())
+	}
+	if rec.Header().Get(CodeHeader) != "target_not_found" || rec.Header().Get("Content-Language") != "de" {
+		t.Errorf("headers = %v", rec.Header())
+	}
+
+	rec = serve(notFound, http.Header{"Accept": {"application/problem+json"}, "Accept-Language": {"fr"}})
+	if ct := rec.Header().Get("Content-Type"); ct != "application/problem+json" {
+		t.Fatalf("Content-Type = %s, want problem+json", ct)
+	}
+	var problem recovery.Problem
+	json.NewDecoder(rec.Body).Decode(&problem)
+	if problem.Code != "target_not_found" || problem.Title != "Introuvable" || problem.Detail != "Cible introuvable" || problem.Status != http.StatusNotFound {
+		t.Errorf("problem = %+v", problem)
+	}
+
+	// Messages outside the catalog keep their text and get the status's code
+	rec = serve(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "Invalid since: must be RFC 3339", http.StatusBadRequest)
+	}, http.Header{"Accept-Language": {"es"}})
+	if strings.TrimSpace(rec.Body.String()) != "Invalid since: must be RFC 3339" || rec.Header().Get(CodeHeader) != "bad_request" {
+		t.Errorf("response = %q, code %s", rec.Body.String(), rec.Header().Get(CodeHeader))
+	}
+
+	// Successful and JSON responses pass through
+	rec = serve(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusConflict)
+		w.Write([]byte(`{"version":2}`))
+	}, http.Header{"Accept-Language": {"de"}})
+	if rec.Code != http.StatusConflict || rec.Body.String() != `{"version":2}` || rec.Header().Get(CodeHeader) != "" {
+		t.Errorf("JSON response rewritten: %d %s", rec.Code, rec.Body.String())
+	}
+}
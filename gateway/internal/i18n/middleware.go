@@ -0,0 +1,133 @@
+package i18n
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/VanCannon/openpam/pkg/recovery"
+)
+
+// CodeHeader carries the code of an error response, for clients reading it as
+// plain text
+const CodeHeader = "X-OpenPAM-Error-Code"
+
+// Middleware returns a middleware that localizes plain text error responses,
+// such as those written by http.Error. Each gets its code, in CodeHeader and,
+// for clients accepting problem+json, as the code field of an RFC 7807 body.
+// Other responses pass through untouched.
+func Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ew := &errorWriter{ResponseWriter: w}
+		next.ServeHTTP(ew, r)
+		if ew.capture {
+			writeError(w, r, ew.status, strings.TrimSpace(ew.body.String()))
+		}
+	})
+}
+
+// wantsProblem reports whether the client takes JSON error bodies
+func wantsProblem(r *http.Request) bool {
+	accept := r.Header.Get("Accept")
+	return strings.Contains(accept, "application/problem+json") || strings.Contains(accept, "application/json")
+}
+
+// writeError writes a localized error response for message
+func writeError(w http.ResponseWriter, r *http.Request, status int, message string) {
+	locale := FromRequest(r)
+	code, known := Code(message)
+	if !known {
+		code = StatusCode(status)
+	}
+	detail := message
+	if known {
+		detail = Text(locale, code)
+	}
+
+	h := w.Header()
+	h.Del("Content-Length")
+	h.Set(CodeHeader, code)
+	h.Set("Content-Language", locale)
+	h.Add("Vary", "Accept-Language")
+
+	if !wantsProblem(r) {
+		h.Set("Content-Type", "text/plain; charset=utf-8")
+		w.WriteHeader(status)
+		fmt.Fprintln(w, detail)
+		return
+	}
+
+	h.Set("Content-Type", "application/problem+json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(recovery.Problem{
+		Type:      "about:blank",
+		Code:      code,
+		Title:     Text(locale, StatusCode(status)),
+		Status:    status,
+		Detail:    detail,
+		Instance:  r.URL.Path,
+		RequestID: recovery.RequestIDFromContext(r.Context()),
+	})
+}
+
+// errorWriter holds back plain text error responses so they can be rewritten,
+// and passes everything else straight through
+type errorWriter struct {
+	http.ResponseWriter
+	status      int
+	wroteHeader bool
+	capture     bool
+	body        bytes.Buffer
+}
+
+func (w *errorWriter) WriteHeader(status int) {
+	if w.wroteHeader {
+		return
+	}
+	w.wroteHeader = true
+	if status >= 400 && strings.HasPrefix(w.Header().Get("Content-Type"), "text/plain") {
+		w.status = status
+		w.capture = true
+		return
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *errorWriter) Write(p []byte) (int, error) {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	if w.capture {
+		return w.body.Write(p)
+	}
+	return w.ResponseWriter.Write(p)
+}
+
+// Flush lets event streams through as they are written
+func (w *errorWriter) Flush() {
+	if w.capture {
+		return
+	}
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Hijack hands the connection to WebSocket handlers
+func (w *errorWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	h, ok := w.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, fmt.Errorf("response writer does not support hijacking")
+	}
+	w.wroteHeader = true
+	return h.Hijack()
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer
+func (w *errorWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
@@ -0,0 +1,275 @@
+// Package idempotency lets clients retry create requests safely. A POST sent
+// with an Idempotency-Key header is recorded with its response; retries under
+// the same key get that response replayed instead of creating again, and a
+// different request under a key already used is refused.
+package idempotency
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/VanCannon/openpam/gateway/internal/middleware"
+	"github.com/VanCannon/openpam/gateway/internal/models"
+	"github.com/VanCannon/openpam/gateway/internal/worker"
+	"github.com/VanCannon/openpam/pkg/logger"
+	"github.com/google/uuid"
+)
+
+const (
+	// Header carries the client's key for a request
+	Header = "Idempotency-Key"
+
+	// ReplayedHeader marks a response replayed from an earlier request
+	ReplayedHeader = "Idempotent-Replayed"
+
+	// maxSnapshot is the largest response body kept for replay. Larger
+	// responses free their key, so a retry runs again.
+	maxSnapshot = 1 << 20
+)
+
+// replayedHeaders are the response headers kept with a snapshot
+var replayedHeaders = []string{"Content-Type", "Location", "ETag", "X-OpenPAM-Error-Code"}
+
+// Store persists the requests made under idempotency keys
+type Store interface {
+	Reserve(ctx context.Context, key *models.IdempotencyKey) (*models.IdempotencyKey, error)
+	Complete(ctx context.Context, key *models.IdempotencyKey) error
+	Release(ctx context.Context, userID uuid.UUID, key string) error
+	DeleteExpired(ctx context.Context, cutoff time.Time) (int64, error)
+}
+
+// Cache records the responses to keyed requests for ttl and deletes them
+// once expired
+type Cache struct {
+	store  Store
+	ttl    time.Duration
+	logger *logger.Logger
+
+	loop worker.Loop
+}
+
+// New creates a cache keeping responses for ttl
+func New(store Store, ttl time.Duration, log *logger.Logger) *Cache {
+	if ttl <= 0 {
+		ttl = 24 * time.Hour
+	}
+	return &Cache{store: store, ttl: ttl, logger: log}
+}
+
+// Start deletes expired keys in the background until Stop is called
+func (c *Cache) Start() {
+	c.loop.Start(c.run)
+}
+
+// Stop stops deleting expired keys. It is safe to call even if the cache was
+// never started.
+func (c *Cache) Stop() {
+	c.loop.Stop()
+}
+
+func (c *Cache) run() {
+	ticker := time.NewTicker(time.Hour)
+	defer ticker.Stop()
+
+	for {
+		c.Purge(time.Now())
+
+		select {
+		case <-c.loop.Stopping():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Purge deletes the keys expired as of now
+func (c *Cache) Purge(now time.Time) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	deleted, err := c.store.DeleteExpired(ctx, now)
+	if err != nil {
+		c.logger.Error("Failed to delete expired idempotency keys", map[string]interface{}{
+			"error": err.Error(),
+		})
+	} else if deleted > 0 {
+		c.logger.Info("Deleted expired idempotency keys", map[string]interface{}{
+			"count": deleted,
+		})
+	}
+}
+
+// Wrap makes the POST requests h handles idempotent for callers that send a
+// key. It must run after authentication, since keys belong to a user.
+func (c *Cache) Wrap(h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		name := r.Header.Get(Header)
+		userID, err := uuid.Parse(middleware.GetUserID(r.Context()))
+		if r.Method != http.MethodPost || name == "" || err != nil {
+			h(w, r)
+			return
+		}
+		if len(name) > models.MaxIdempotencyKeyLength {
+			http.Error(w, "Idempotency key is too long", http.StatusBadRequest)
+			return
+		}
+
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			var tooLarge *http.MaxBytesError
+			if errors.As(err, &tooLarge) {
+				http.Error(w, "Request body too large", http.StatusRequestEntityTooLarge)
+				return
+			}
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+
+		now := time.Now()
+		key := &models.IdempotencyKey{
+			UserID:      userID,
+			Key:         name,
+			Method:      r.Method,
+			Path:        r.URL.Path,
+			RequestHash: requestHash(r, body),
+			CreatedAt:   now,
+			ExpiresAt:   now.Add(c.ttl),
+		}
+
+		existing, err := c.store.Reserve(r.Context(), key)
+		if err != nil {
+			c.logger.Error("Failed to reserve idempotency key", map[string]interface{}{
+				"user_id": userID.String(),
+				"error":   err.Error(),
+			})
+			http.Error(w, "Failed to check idempotency key", http.StatusInternalServerError)
+			return
+		}
+		if existing != nil {
+			c.replay(w, key, existing)
+			return
+		}
+
+		// A handler that panics settles nothing: free the key so a retry runs
+		// again instead of being told the request is still in progress
+		defer func() {
+			if p := recover(); p != nil {
+				c.release(key)
+				panic(p)
+			}
+		}()
+
+		rec := &recorder{ResponseWriter: w, status: http.StatusOK}
+		h(rec, r)
+		c.finish(key, rec)
+	}
+}
+
+// replay answers a retry with the response to the first request under its key
+func (c *Cache) replay(w http.ResponseWriter, key, existing *models.IdempotencyKey) {
+	switch {
+	case existing.RequestHash != key.RequestHash:
+		http.Error(w, "Idempotency key was already used for a different request", http.StatusUnprocessableEntity)
+	case existing.Status == 0:
+		http.Error(w, "A request with this idempotency key is still in progress", http.StatusConflict)
+	default:
+		var headers map[string]string
+		json.Unmarshal(existing.Headers, &headers)
+		for name, value := range headers {
+			w.Header().Set(name, value)
+		}
+		w.Header().Set(ReplayedHeader, "true")
+		w.WriteHeader(existing.Status)
+		w.Write(existing.Body)
+	}
+}
+
+// finish stores the response to a keyed request. Server errors and responses
+// too large to keep free the key instead, so the request can be retried.
+func (c *Cache) finish(key *models.IdempotencyKey, rec *recorder) {
+	// The client may be gone; the key must still be settled
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	if rec.status >= http.StatusInternalServerError || rec.overflow {
+		c.release(key)
+		return
+	}
+
+	headers := make(map[string]string)
+	for _, name := range replayedHeaders {
+		if value := rec.Header().Get(name); value != "" {
+			headers[name] = value
+		}
+	}
+	key.Headers, _ = json.Marshal(headers)
+	key.Status = rec.status
+	key.Body = rec.body.Bytes()
+
+	if err := c.store.Complete(ctx, key); err != nil {
+		c.logger.Error("Failed to store idempotent response", map[string]interface{}{
+			"user_id": key.UserID.String(),
+			"error":   err.Error(),
+		})
+	}
+}
+
+// release frees a key for its request to run again
+func (c *Cache) release(key *models.IdempotencyKey) {
+	// The client may be gone; the key must still be freed
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	if err := c.store.Release(ctx, key.UserID, key.Key); err != nil {
+		c.logger.Error("Failed to release idempotency key", map[string]interface{}{
+			"user_id": key.UserID.String(),
+			"error":   err.Error(),
+		})
+	}
+}
+
+// requestHash identifies a request by its method, path and body
+func requestHash(r *http.Request, body []byte) string {
+	sum := sha256.New()
+	io.WriteString(sum, r.Method+" "+r.URL.RequestURI()+"\n")
+	sum.Write(body)
+	return hex.EncodeToString(sum.Sum(nil))
+}
+
+// recorder passes a response through while keeping a copy of it
+type recorder struct {
+	http.ResponseWriter
+	status   int
+	body     bytes.Buffer
+	overflow bool
+	wrote    bool
+}
+
+func (r *recorder) WriteHeader(status int) {
+	if !r.wrote {
+		r.status = status
+		r.wrote = true
+	}
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *recorder) Write(p []byte) (int, error) {
+	r.wrote = true
+	if !r.overflow {
+		if r.body.Len()+len(p) > maxSnapshot {
+			r.overflow = true
+			r.body.Reset()
+		} else {
+			r.body.Write(p)
+		}
+	}
+	return r.ResponseWriter.Write(p)
+}
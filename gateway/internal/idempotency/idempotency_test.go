@@ -0,0 +1,202 @@
+package idempotency
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/VanCannon/openpam/gateway/internal/auth"
+	"github.com/VanCannon/openpam/gateway/internal/middleware"
+	"github.com/VanCannon/openpam/gateway/internal/models"
+	"github.com/VanCannon/openpam/pkg/logger"
+	"github.com/google/uuid"
+)
+
+type fakeStore struct {
+	mu   sync.Mutex
+	keys map[string]*models.IdempotencyKey
+}
+
+func (s *fakeStore) id(userID uuid.UUID, key string) string {
+	return userID.String() + "/" + key
+}
+
+func (s *fakeStore) Reserve(ctx context.Context, key *models.IdempotencyKey) (*models.IdempotencyKey, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if existing, ok := s.keys[s.id(key.UserID, key.Key)]; ok && existing.ExpiresAt.After(key.CreatedAt) {
+		copied := *existing
+		return &copied, nil
+	}
+	copied := *key
+	s.keys[s.id(key.UserID, key.Key)] = &copied
+	return nil, nil
+}
+
+func (s *fakeStore) Complete(ctx context.Context, key *models.IdempotencyKey) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	copied := *key
+	s.keys[s.id(key.UserID, key.Key)] = &copied
+	return nil
+}
+
+func (s *fakeStore) Release(ctx context.Context, userID uuid.UUID, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.keys, s.id(userID, key))
+	return nil
+}
+
+func (s *fakeStore) DeleteExpired(ctx context.Context, cutoff time.Time) (int64, error) {
+	return 0, nil
+}
+
+// setup wraps a handler creating numbered things, failing while fail is set,
+// and returns it behind authentication with a token for each of two users
+func setup(t *testing.T) (http.Handler, *int, *bool, []string) {
+	t.Helper()
+
+	created, fail := 0, false
+	c := New(&fakeStore{keys: map[string]*models.IdempotencyKey{}}, time.Hour, logger.New(logger.LevelError, io.Discard))
+	handler := c.Wrap(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if fail {
+			http.Error(w, "Failed to create thing", http.StatusInternalServerError)
+			return
+		}
+		created++
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		fmt.Fprintf(w, `{"id":%d,"request":%s}`, created, body)
+	})
+
+	tokens := auth.NewTokenManager("test-secret", time.Hour)
+	var issued []string
+	for i := 0; i < 2; i++ {
+		token, err := tokens.GenerateToken(uuid.NewString(), "user@example.com", "User", models.RoleAdmin)
+		if err != nil {
+			t.Fatalf("GenerateToken() error = %v", err)
+		}
+		issued = append(issued, token)
+	}
+	return middleware.OptionalAuth(tokens)(handler), &created, &fail, issued
+}
+
+func post(handler http.Handler, token, key, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/targets/create", strings.NewReader(body))
+	req.Header.Set("Authorization", "Bearer "+token)
+	if key != "" {
+		req.Header.Set(Header, key)
+	}
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestWrap_ReplaysRetries(t *testing.T) {
+	handler, created, _, tokens := setup(t)
+
+	first := post(handler, tokens[0], "key-1", `{"name":"db"}`)
+	retry := post(handler, tokens[0], "key-1", `{"name":"db"}`)
+
+	if *created != 1 {
+		t.Fatalf("created %d things, want 1", *created)
+	}
+	if retry.Code != http.StatusCreated || retry.Body.String() != first.Body.String() {
+		t.Errorf("retry = %d %s, want %d %s", retry.Code, retry.Body, first.Code, first.Body)
+	}
+	if retry.Header().Get(ReplayedHeader) != "true" || first.Header().Get(ReplayedHeader) != "" {
+		t.Errorf("%s = %q on the retry, %q on the first", ReplayedHeader, retry.Header().Get(ReplayedHeader), first.Header().Get(ReplayedHeader))
+	}
+	if ct := retry.Header().Get("Content-Type"); ct != "application/json" {
+		t.Errorf("replayed Content-Type = %q", ct)
+	}
+
+	// Keys belong to their user, and requests without one always run
+	post(handler, tokens[1], "key-1", `{"name":"db"}`)
+	post(handler, tokens[0], "", `{"name":"db"}`)
+	if *created != 3 {
+		t.Errorf("created %d things, want 3", *created)
+	}
+}
+
+func TestWrap_RefusesDifferentRequest(t *testing.T) {
+	handler, created, _, tokens := setup(t)
+
+	post(handler, tokens[0], "key-1", `{"name":"db"}`)
+	rec := post(handler, tokens[0], "key-1", `{"name":"web"}`)
+
+	if rec.Code != http.StatusUnprocessableEntity {
+		t.Errorf("status = %d, want 422", rec.Code)
+	}
+	if *created != 1 {
+		t.Errorf("created %d things, want 1", *created)
+	}
+}
+
+func TestWrap_ServerErrorsFreeKey(t *testing.T) {
+	handler, created, fail, tokens := setup(t)
+
+	*fail = true
+	if rec := post(handler, tokens[0], "key-1", `{"name":"db"}`); rec.Code != http.StatusInternalServerError {
+		t.Fatalf("status = %d, want 500", rec.Code)
+	}
+
+	*fail = false
+	if rec := post(handler, tokens[0], "key-1", `{"name":"db"}`); rec.Code != http.StatusCreated || rec.Header().Get(ReplayedHeader) != "" {
+		t.Errorf("retry = %d, replayed %q; want it to run", rec.Code, rec.Header().Get(ReplayedHeader))
+	}
+	if *created != 1 {
+		t.Errorf("created %d things, want 1", *created)
+	}
+}
+
+func TestWrap_PanicFreesKey(t *testing.T) {
+	created, panicking := 0, true
+	c := New(&fakeStore{keys: map[string]*models.IdempotencyKey{}}, time.Hour, logger.New(logger.LevelError, io.Discard))
+	tokens := auth.NewTokenManager("test-secret", time.Hour)
+	handler := middleware.OptionalAuth(tokens)(c.Wrap(func(w http.ResponseWriter, r *http.Request) {
+		if panicking {
+			panic("handler bug")
+		}
+		created++
+		w.WriteHeader(http.StatusCreated)
+	}))
+	token, err := tokens.GenerateToken(uuid.NewString(), "user@example.com", "User", models.RoleAdmin)
+	if err != nil {
+		t.Fatalf("GenerateToken() error = %v", err)
+	}
+
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Error("panic was swallowed instead of passed on")
+			}
+		}()
+		post(handler, token, "key-1", `{"name":"db"}`)
+	}()
+
+	panicking = false
+	if rec := post(handler, token, "key-1", `{"name":"db"}`); rec.Code != http.StatusCreated || rec.Header().Get(ReplayedHeader) != "" {
+		t.Errorf("retry = %d, replayed %q; want it to run", rec.Code, rec.Header().Get(ReplayedHeader))
+	}
+	if created != 1 {
+		t.Errorf("created %d things, want 1", created)
+	}
+}
+
+func TestWrap_RefusesLongKey(t *testing.T) {
+	handler, created, _, tokens := setup(t)
+
+	rec := post(handler, tokens[0], strings.Repeat("k", models.MaxIdempotencyKeyLength+1), `{}`)
+	if rec.Code != http.StatusBadRequest || *created != 0 {
+		t.Errorf("status = %d, created %d; want 400 and nothing created", rec.Code, *created)
+	}
+}
@@ -0,0 +1,254 @@
+// Package investigation assembles the export bundle of an investigation: the case
+// with its evidence, a timeline and the recordings of the attached sessions.
+package investigation
+
+import (
+	"archive/zip"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/VanCannon/openpam/gateway/internal/models"
+	"github.com/VanCannon/openpam/gateway/internal/reports"
+	"github.com/VanCannon/openpam/gateway/internal/transcript"
+)
+
+// Evidence is an investigation item with the record it refers to
+type Evidence struct {
+	Item       *models.InvestigationItem `json:"item"`
+	Session    *models.AuditLog          `json:"session,omitempty"`
+	Event      *models.SystemAuditLog    `json:"event,omitempty"`
+	Annotation *models.SessionAnnotation `json:"annotation,omitempty"`
+}
+
+// Bundle is everything exported for an investigation
+type Bundle struct {
+	Investigation *models.Investigation `json:"investigation"`
+	Evidence      []*Evidence           `json:"evidence"`
+	ExportedAt    time.Time             `json:"exported_at"`
+	ExportedBy    string                `json:"exported_by"`
+}
+
+// Timeline lists the evidence of a bundle in the order it happened: sessions by
+// start time, events by timestamp, annotations and notes by when they were written
+func Timeline(b *Bundle) *reports.Table {
+	inv := b.Investigation
+	subtitle := fmt.Sprintf("Status: %s | Opened: %s | Exported: %s by %s",
+		inv.Status, formatTime(inv.CreatedAt), formatTime(b.ExportedAt), b.ExportedBy)
+	if inv.OwnerEmail != nil {
+		subtitle += " | Owner: " + *inv.OwnerEmail
+	}
+
+	table := &reports.Table{
+		Title:    "Investigation: " + inv.Title,
+		Subtitle: subtitle,
+		Columns:  []string{"Time", "Type", "Reference", "Summary", "Added By", "Added At"},
+	}
+
+	evidence := make([]*Evidence, len(b.Evidence))
+	copy(evidence, b.Evidence)
+	sort.SliceStable(evidence, func(i, j int) bool {
+		return evidence[i].occurredAt().Before(evidence[j].occurredAt())
+	})
+
+	for _, e := range evidence {
+		addedBy := ""
+		if e.Item.AddedByEmail != nil {
+			addedBy = *e.Item.AddedByEmail
+		}
+		table.Rows = append(table.Rows, []string{
+			formatTime(e.occurredAt()),
+			e.Item.ItemType,
+			e.reference(),
+			e.summary(),
+			addedBy,
+			formatTime(e.Item.CreatedAt),
+		})
+	}
+
+	return table
+}
+
+// WriteZip writes the bundle as a ZIP archive containing case.json, timeline.csv,
+// the recordings of the attached sessions found in recordings, and a SHA-256
+// manifest of all of them
+func WriteZip(w io.Writer, b *Bundle, recordings fs.FS) error {
+	zw := zip.NewWriter(w)
+	var manifest strings.Builder
+
+	add := func(name string, r io.Reader) error {
+		f, err := zw.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Deflate, Modified: b.ExportedAt})
+		if err != nil {
+			return fmt.Errorf("failed to add %s: %w", name, err)
+		}
+		h := sha256.New()
+		if _, err := io.Copy(io.MultiWriter(f, h), r); err != nil {
+			return fmt.Errorf("failed to write %s: %w", name, err)
+		}
+		fmt.Fprintf(&manifest, "%s  %s\n", hex.EncodeToString(h.Sum(nil)), name)
+		return nil
+	}
+
+	caseJSON, err := json.MarshalIndent(b, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode case: %w", err)
+	}
+	if err := add("case.json", bytes.NewReader(caseJSON)); err != nil {
+		return err
+	}
+
+	timeline, err := reports.RenderCSV(Timeline(b))
+	if err != nil {
+		return err
+	}
+	if err := add("timeline.csv", bytes.NewReader(timeline)); err != nil {
+		return err
+	}
+
+	if recordings != nil {
+		names, err := recordingNames(b, recordings)
+		if err != nil {
+			return err
+		}
+		for _, name := range names {
+			f, err := recordings.Open(name)
+			if err != nil {
+				return fmt.Errorf("failed to open recording %s: %w", name, err)
+			}
+			err = add("recordings/"+name, f)
+			f.Close()
+			if err != nil {
+				return err
+			}
+
+			// SSH recordings also get a plain-text transcript for readers
+			// without a terminal player
+			if strings.HasSuffix(name, ".log") {
+				if t, ok := renderTranscript(recordings, name); ok {
+					var buf bytes.Buffer
+					t.WriteText(&buf)
+					if err := add("transcripts/"+strings.TrimSuffix(name, ".log")+".txt", &buf); err != nil {
+						return err
+					}
+				}
+			}
+		}
+	}
+
+	if err := add("manifest.sha256", strings.NewReader(manifest.String())); err != nil {
+		return err
+	}
+
+	if err := zw.Close(); err != nil {
+		return fmt.Errorf("failed to finish bundle: %w", err)
+	}
+	return nil
+}
+
+// renderTranscript renders the transcript of an SSH recording, reporting false
+// when the file isn't one
+func renderTranscript(recordings fs.FS, name string) (*transcript.Transcript, bool) {
+	data, err := fs.ReadFile(recordings, name)
+	if err != nil {
+		return nil, false
+	}
+	timing, _ := fs.ReadFile(recordings, strings.TrimSuffix(name, ".log")+transcript.TimingSuffix)
+	t, err := transcript.Render(data, timing)
+	if err != nil {
+		return nil, false
+	}
+	// Recordings are named after the session ID, a UUID
+	t.SessionID = name[:min(len(name), 36)]
+	return t, true
+}
+
+// recordingNames finds the recording files of the attached sessions. Recordings
+// are named after the session ID followed by the time they started.
+func recordingNames(b *Bundle, recordings fs.FS) ([]string, error) {
+	entries, err := fs.ReadDir(recordings, ".")
+	if err != nil {
+		return nil, fmt.Errorf("failed to read recordings: %w", err)
+	}
+
+	var names []string
+	for _, e := range b.Evidence {
+		if e.Session == nil {
+			continue
+		}
+		prefix := e.Session.ID.String() + "-"
+		for _, entry := range entries {
+			if !entry.IsDir() && strings.HasPrefix(entry.Name(), prefix) {
+				names = append(names, entry.Name())
+			}
+		}
+	}
+	return names, nil
+}
+
+func (e *Evidence) occurredAt() time.Time {
+	switch {
+	case e.Session != nil:
+		return e.Session.StartTime
+	case e.Event != nil:
+		return e.Event.Timestamp
+	case e.Annotation != nil:
+		return e.Annotation.CreatedAt
+	}
+	return e.Item.CreatedAt
+}
+
+func (e *Evidence) reference() string {
+	switch {
+	case e.Session != nil:
+		return e.Session.ID.String()
+	case e.Event != nil:
+		return e.Event.ID.String()
+	case e.Annotation != nil:
+		return e.Annotation.AuditLogID.String()
+	}
+	return ""
+}
+
+func (e *Evidence) summary() string {
+	switch {
+	case e.Session != nil:
+		s := e.Session
+		summary := fmt.Sprintf("%s session %s: user %s, target %s", s.Protocol, s.SessionStatus, s.UserID, s.TargetID)
+		if s.ClientIP != nil {
+			summary += ", from " + *s.ClientIP
+		}
+		return summary
+	case e.Event != nil:
+		ev := e.Event
+		summary := fmt.Sprintf("%s: %s (%s)", ev.EventType, ev.Action, ev.Status)
+		if ev.ResourceName != nil {
+			summary += " " + *ev.ResourceName
+		}
+		return summary
+	case e.Annotation != nil:
+		a := e.Annotation
+		offset := time.Duration(a.OffsetMs) * time.Millisecond
+		parts := []string{fmt.Sprintf("[%02d:%02d:%02d]", int(offset.Hours()), int(offset.Minutes())%60, int(offset.Seconds())%60)}
+		if a.Label != nil {
+			parts = append(parts, *a.Label)
+		}
+		if a.Note != nil {
+			parts = append(parts, *a.Note)
+		}
+		return a.Kind + " " + strings.Join(parts, " ")
+	case e.Item.Note != nil:
+		return *e.Item.Note
+	}
+	return "(record no longer available)"
+}
+
+func formatTime(t time.Time) string {
+	return t.UTC().Format(time.RFC3339)
+}
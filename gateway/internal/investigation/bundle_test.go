@@ -0,0 +1,103 @@
+package investigation
+
+import (
+	"archive/zip"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/VanCannon/openpam/gateway/internal/models"
+	"github.com/google/uuid"
+)
+
+func testBundle() *Bundle {
+	base := time.Date(2024, 3, 1, 10, 0, 0, 0, time.UTC)
+	sessionID := uuid.MustParse("11111111-1111-1111-1111-111111111111")
+	note := "Escalated to security team"
+	label := "sudo"
+
+	return &Bundle{
+		Investigation: &models.Investigation{ID: uuid.New(), Title: "Weekend access", Status: models.InvestigationInProgress, CreatedAt: base},
+		Evidence: []*Evidence{
+			{
+				Item: &models.InvestigationItem{ItemType: models.InvestigationItemNote, Note: &note, CreatedAt: base.Add(3 * time.Hour)},
+			},
+			{
+				Item:       &models.InvestigationItem{ItemType: models.InvestigationItemAnnotation, CreatedAt: base.Add(2 * time.Hour)},
+				Annotation: &models.SessionAnnotation{AuditLogID: sessionID, Kind: models.AnnotationKindBookmark, OffsetMs: 3723000, Label: &label, CreatedAt: base.Add(time.Hour)},
+			},
+			{
+				Item:    &models.InvestigationItem{ItemType: models.InvestigationItemSession, CreatedAt: base.Add(2 * time.Hour)},
+				Session: &models.AuditLog{ID: sessionID, Protocol: "ssh", SessionStatus: models.SessionStatusCompleted, StartTime: base.Add(-time.Hour)},
+			},
+		},
+		ExportedAt: base.Add(4 * time.Hour),
+		ExportedBy: "auditor@example.com",
+	}
+}
+
+func TestTimeline_OrdersByOccurrence(t *testing.T) {
+	table := Timeline(testBundle())
+
+	if len(table.Rows) != 3 {
+		t.Fatalf("got %d rows, want 3", len(table.Rows))
+	}
+
+	wantTypes := []string{models.InvestigationItemSession, models.InvestigationItemAnnotation, models.InvestigationItemNote}
+	for i, want := range wantTypes {
+		if table.Rows[i][1] != want {
+			t.Errorf("row %d type = %q, want %q", i, table.Rows[i][1], want)
+		}
+	}
+
+	if got := table.Rows[1][3]; got != "bookmark [01:02:03] sudo" {
+		t.Errorf("annotation summary = %q", got)
+	}
+}
+
+func TestWriteZip(t *testing.T) {
+	recordings := fstest.MapFS{
+		"11111111-1111-1111-1111-111111111111-20240301-090000.log": {Data: []byte("$ sudo su -\n")},
+		"22222222-2222-2222-2222-222222222222-20240301-090000.log": {Data: []byte("unrelated\n")},
+	}
+
+	var buf bytes.Buffer
+	if err := WriteZip(&buf, testBundle(), recordings); err != nil {
+		t.Fatalf("WriteZip() error = %v", err)
+	}
+
+	zr, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatalf("invalid zip: %v", err)
+	}
+
+	files := make(map[string]string)
+	for _, f := range zr.File {
+		rc, err := f.Open()
+		if err != nil {
+			t.Fatalf("open %s: %v", f.Name, err)
+		}
+		data, _ := io.ReadAll(rc)
+		rc.Close()
+		files[f.Name] = string(data)
+	}
+
+	for _, name := range []string{"case.json", "timeline.csv", "recordings/11111111-1111-1111-1111-111111111111-20240301-090000.log", "manifest.sha256"} {
+		if _, ok := files[name]; !ok {
+			t.Errorf("bundle missing %s", name)
+		}
+	}
+	if len(files) != 4 {
+		t.Errorf("bundle has %d files, want 4", len(files))
+	}
+
+	sum := sha256.Sum256([]byte(files["case.json"]))
+	if !strings.Contains(files["manifest.sha256"], hex.EncodeToString(sum[:])+"  case.json") {
+		t.Errorf("manifest does not match case.json:\n%s", files["manifest.sha256"])
+	}
+}
@@ -0,0 +1,148 @@
+package keys
+
+import (
+	"bytes"
+	"context"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/VanCannon/openpam/gateway/internal/awssig"
+)
+
+// kmsKey is an asymmetric AWS KMS key. The private key never leaves KMS; each
+// signature is a KMS Sign call with the access key of the config.
+type kmsKey struct {
+	publicKey
+	arn      string
+	endpoint string
+	region   string
+	cfg      Config
+	client   *http.Client
+}
+
+// kmsRegion returns the region of a KMS key or alias ARN
+func kmsRegion(arn string) (string, error) {
+	parts := strings.SplitN(arn, ":", 6)
+	if len(parts) != 6 || parts[0] != "arn" || parts[2] != "kms" || parts[3] == "" {
+		return "", fmt.Errorf("AWS KMS keys must be a key ARN, got %q", arn)
+	}
+	return parts[3], nil
+}
+
+func openKMS(ctx context.Context, client *http.Client, cfg Config, arn string) (Key, error) {
+	region, err := kmsRegion(arn)
+	if err != nil {
+		return nil, err
+	}
+	k := &kmsKey{
+		arn:      arn,
+		endpoint: "https://kms." + region + ".amazonaws.com/",
+		region:   region,
+		cfg:      cfg,
+		client:   client,
+	}
+
+	var out struct {
+		PublicKey string `json:"PublicKey"`
+		KeyUsage  string `json:"KeyUsage"`
+	}
+	if err := k.call(ctx, "GetPublicKey", map[string]string{"KeyId": arn}, &out); err != nil {
+		return nil, err
+	}
+	if out.KeyUsage != "SIGN_VERIFY" {
+		return nil, fmt.Errorf("key usage is %s, not SIGN_VERIFY", out.KeyUsage)
+	}
+	der, err := base64.StdEncoding.DecodeString(out.PublicKey)
+	if err != nil {
+		return nil, fmt.Errorf("invalid public key: %w", err)
+	}
+	pub, err := x509.ParsePKIXPublicKey(der)
+	if err != nil {
+		return nil, fmt.Errorf("invalid public key: %w", err)
+	}
+	k.publicKey, err = newPublicKey(ProviderAWSKMS, pub)
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := kmsAlgorithm[k.alg]; !ok {
+		return nil, fmt.Errorf("KMS cannot sign %s", k.alg)
+	}
+	return k, nil
+}
+
+// kmsAlgorithm is the KMS signing algorithm of a JWS algorithm
+var kmsAlgorithm = map[string]string{
+	"RS256": "RSASSA_PKCS1_V1_5_SHA_256",
+	"ES256": "ECDSA_SHA_256",
+	"ES384": "ECDSA_SHA_384",
+}
+
+// Sign has KMS sign the digest of data
+func (k *kmsKey) Sign(ctx context.Context, data []byte) ([]byte, error) {
+	var out struct {
+		Signature string `json:"Signature"`
+	}
+	err := k.call(ctx, "Sign", map[string]string{
+		"KeyId":            k.arn,
+		"Message":          base64.StdEncoding.EncodeToString(k.digest(data)),
+		"MessageType":      "DIGEST",
+		"SigningAlgorithm": kmsAlgorithm[k.alg],
+	}, &out)
+	if err != nil {
+		return nil, err
+	}
+	sig, err := base64.StdEncoding.DecodeString(out.Signature)
+	if err != nil {
+		return nil, fmt.Errorf("invalid KMS signature: %w", err)
+	}
+	return k.joseSignature(sig)
+}
+
+// kmsError is a KMS error response
+type kmsError struct {
+	Type    string `json:"__type"`
+	Message string `json:"message"`
+}
+
+// call calls the KMS JSON API action
+func (k *kmsKey) call(ctx context.Context, action string, in, out interface{}) error {
+	body, err := json.Marshal(in)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, k.endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-amz-json-1.1")
+	req.Header.Set("X-Amz-Target", "TrentService."+action)
+	if k.cfg.AWSSessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", k.cfg.AWSSessionToken)
+	}
+	awssig.Sign(req, body, k.cfg.AWSAccessKey, k.cfg.AWSSecretKey, k.region, "kms", time.Now())
+
+	resp, err := k.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("KMS %s failed: %w", action, err)
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return fmt.Errorf("failed to read KMS response: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		var e kmsError
+		if json.Unmarshal(data, &e) == nil && e.Type != "" {
+			return fmt.Errorf("KMS %s failed: %s: %s", action, e.Type, e.Message)
+		}
+		return fmt.Errorf("KMS %s failed: status %d", action, resp.StatusCode)
+	}
+	return json.Unmarshal(data, out)
+}
@@ -0,0 +1,129 @@
+package keys
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/VanCannon/openpam/pkg/servicetoken"
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/clientcredentials"
+)
+
+// azureKeyVaultVersion is the Key Vault API version requests are made with
+const azureKeyVaultVersion = "7.4"
+
+// azureLoginURL issues the application's Key Vault tokens
+const azureLoginURL = "https://login.microsoftonline.com"
+
+// azureKey is an Azure Key Vault key. The private key never leaves the vault;
+// each signature is a sign operation as the configured application.
+type azureKey struct {
+	publicKey
+	kid    string // Key identifier URL, including the version
+	tokens oauth2.TokenSource
+	client *http.Client
+}
+
+func openAzure(ctx context.Context, client *http.Client, cfg Config, kid string) (Key, error) {
+	tokens := &clientcredentials.Config{
+		ClientID:     cfg.AzureClientID,
+		ClientSecret: cfg.AzureClientSecret,
+		TokenURL:     azureLoginURL + "/" + url.PathEscape(cfg.AzureTenantID) + "/oauth2/v2.0/token",
+		Scopes:       []string{"https://vault.azure.net/.default"},
+	}
+	k := &azureKey{
+		kid:    strings.TrimRight(kid, "/"),
+		tokens: tokens.TokenSource(context.WithValue(context.Background(), oauth2.HTTPClient, client)),
+		client: client,
+	}
+
+	var out struct {
+		Key servicetoken.JWK `json:"key"`
+	}
+	if err := k.call(ctx, http.MethodGet, k.kid, nil, &out); err != nil {
+		return nil, err
+	}
+	// A key named without a version keeps signing with the version current
+	// now, so rotating it in the vault does not change the key under the ring
+	k.kid = out.Key.Kid
+	out.Key.Kty = strings.TrimSuffix(out.Key.Kty, "-HSM")
+	pub, err := out.Key.PublicKey()
+	if err != nil {
+		return nil, err
+	}
+	k.publicKey, err = newPublicKey(ProviderAzure, pub)
+	if err != nil {
+		return nil, err
+	}
+	return k, nil
+}
+
+// Sign has Key Vault sign the digest of data. Key Vault returns ECDSA
+// signatures in JWS form already.
+func (k *azureKey) Sign(ctx context.Context, data []byte) ([]byte, error) {
+	in := map[string]string{
+		"alg":   k.alg,
+		"value": base64.RawURLEncoding.EncodeToString(k.digest(data)),
+	}
+	var out struct {
+		Value string `json:"value"`
+	}
+	if err := k.call(ctx, http.MethodPost, k.kid+"/sign", in, &out); err != nil {
+		return nil, err
+	}
+	return base64.RawURLEncoding.DecodeString(out.Value)
+}
+
+// call calls the Key Vault API
+func (k *azureKey) call(ctx context.Context, method, endpoint string, in, out interface{}) error {
+	var body io.Reader
+	if in != nil {
+		data, err := json.Marshal(in)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewReader(data)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, endpoint+"?api-version="+azureKeyVaultVersion, body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	token, err := k.tokens.Token()
+	if err != nil {
+		return fmt.Errorf("failed to get Key Vault token: %w", err)
+	}
+	token.SetAuthHeader(req)
+
+	resp, err := k.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("Key Vault request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return fmt.Errorf("failed to read Key Vault response: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		var e struct {
+			Error struct {
+				Code    string `json:"code"`
+				Message string `json:"message"`
+			} `json:"error"`
+		}
+		if json.Unmarshal(data, &e) == nil && e.Error.Code != "" {
+			return fmt.Errorf("Key Vault request failed: %s: %s", e.Error.Code, e.Error.Message)
+		}
+		return fmt.Errorf("Key Vault request failed: status %d", resp.StatusCode)
+	}
+	return json.Unmarshal(data, out)
+}
@@ -0,0 +1,398 @@
+// Package keys signs the artifacts the gateway issues, such as session
+// tokens, with a key held in software, a PKCS#11 HSM, AWS KMS or Azure Key
+// Vault. Every artifact names the key that signed it, so keys can be rotated:
+// the new key signs, and the keys it replaced stay trusted to verify what they
+// signed until that has expired.
+package keys
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/VanCannon/openpam/pkg/servicetoken"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// Key providers
+const (
+	ProviderSecret = "secret"  // HMAC with the session secret
+	ProviderFile   = "file"    // PEM private key file
+	ProviderPKCS11 = "pkcs11"  // PKCS#11 HSM, named by an RFC 7512 URI
+	ProviderAWSKMS = "awskms"  // AWS KMS asymmetric key, named by its ARN
+	ProviderAzure  = "azurekv" // Azure Key Vault key, named by its key identifier URL
+)
+
+// defaultClient calls KMS and Key Vault
+var defaultClient = &http.Client{Timeout: 10 * time.Second}
+
+// ErrUnknownKey is returned when an artifact names a key the ring does not hold
+var ErrUnknownKey = errors.New("unknown signing key")
+
+// Key is a signing key
+type Key interface {
+	// ID names the key in the artifacts it signs
+	ID() string
+
+	// Algorithm is the JWS algorithm the key signs with, e.g. RS256
+	Algorithm() string
+
+	// Provider is where the key is held
+	Provider() string
+
+	// Sign returns the JWS signature of data
+	Sign(ctx context.Context, data []byte) ([]byte, error)
+
+	// Verifier is what signatures are verified with: the public key, or the
+	// secret of an HMAC key
+	Verifier() interface{}
+}
+
+// Config selects the signing key and the keys it replaced
+type Config struct {
+	Key      string   // Provider-prefixed key, e.g. "awskms:arn:aws:kms:...", or empty for the session secret
+	Previous []string // Keys rotated out, still trusted for verification
+	Secret   string   // Session secret
+
+	AWSAccessKey    string
+	AWSSecretKey    string
+	AWSSessionToken string
+
+	AzureTenantID     string
+	AzureClientID     string
+	AzureClientSecret string
+
+	Client *http.Client // nil uses a default client
+}
+
+// Validate checks the keys are well formed, without contacting their providers
+func (c Config) Validate() error {
+	for _, spec := range append([]string{c.Key}, c.Previous...) {
+		provider, ref := split(spec)
+		switch provider {
+		case ProviderSecret:
+			if c.Secret == "" {
+				return fmt.Errorf("the session secret key requires a session secret")
+			}
+		case ProviderFile:
+			if ref == "" {
+				return fmt.Errorf("file keys require a path")
+			}
+		case ProviderPKCS11:
+			if _, err := parsePKCS11URI(spec); err != nil {
+				return err
+			}
+		case ProviderAWSKMS:
+			if _, err := kmsRegion(ref); err != nil {
+				return err
+			}
+			if c.AWSAccessKey == "" || c.AWSSecretKey == "" {
+				return fmt.Errorf("AWS KMS keys require an access key and a secret key")
+			}
+		case ProviderAzure:
+			if !strings.HasPrefix(ref, "https://") || !strings.Contains(ref, "/keys/") {
+				return fmt.Errorf("Azure Key Vault keys must be a key identifier URL")
+			}
+			if c.AzureTenantID == "" || c.AzureClientID == "" || c.AzureClientSecret == "" {
+				return fmt.Errorf("Azure Key Vault keys require a tenant ID, client ID and client secret")
+			}
+		default:
+			return fmt.Errorf("invalid signing key provider: %s (must be 'secret', 'file', 'pkcs11', 'awskms' or 'azurekv')", provider)
+		}
+	}
+	return nil
+}
+
+// split returns the provider of a key and what names the key to it
+func split(spec string) (provider, ref string) {
+	if spec == "" {
+		return ProviderSecret, ""
+	}
+	provider, ref, _ = strings.Cut(spec, ":")
+	return provider, ref
+}
+
+// Load opens the signing key and the keys it replaced. Remote keys are
+// contacted once, for their public key.
+func Load(ctx context.Context, cfg Config) (*Ring, error) {
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+
+	active, err := open(ctx, cfg, cfg.Key)
+	if err != nil {
+		return nil, err
+	}
+	previous := make([]Key, 0, len(cfg.Previous))
+	for _, spec := range cfg.Previous {
+		key, err := open(ctx, cfg, spec)
+		if err != nil {
+			return nil, err
+		}
+		previous = append(previous, key)
+	}
+	return NewRing(active, previous...), nil
+}
+
+// open opens one key
+func open(ctx context.Context, cfg Config, spec string) (Key, error) {
+	client := cfg.Client
+	if client == nil {
+		client = defaultClient
+	}
+
+	provider, ref := split(spec)
+	var key Key
+	var err error
+	switch provider {
+	case ProviderSecret:
+		key = NewSecretKey(cfg.Secret)
+	case ProviderFile:
+		key, err = LoadFile(ref)
+	case ProviderPKCS11:
+		key, err = openPKCS11(spec)
+	case ProviderAWSKMS:
+		key, err = openKMS(ctx, client, cfg, ref)
+	case ProviderAzure:
+		key, err = openAzure(ctx, client, cfg, ref)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to open %s signing key: %w", provider, err)
+	}
+	return key, nil
+}
+
+// Ring holds the active signing key and the keys it replaced
+type Ring struct {
+	active Key
+	keys   []Key
+}
+
+// NewRing creates a ring signing with active and also verifying with previous
+func NewRing(active Key, previous ...Key) *Ring {
+	return &Ring{active: active, keys: append([]Key{active}, previous...)}
+}
+
+// Active returns the key new artifacts are signed with
+func (r *Ring) Active() Key {
+	return r.active
+}
+
+// Keys returns every key of the ring, the active key first
+func (r *Ring) Keys() []Key {
+	return r.keys
+}
+
+// Lookup returns the key with the ID id
+func (r *Ring) Lookup(id string) (Key, bool) {
+	for _, key := range r.keys {
+		if key.ID() == id {
+			return key, true
+		}
+	}
+	return nil, false
+}
+
+// Sign signs payload with the active key as a compact JWS of type typ, naming
+// the key in its kid header
+func (r *Ring) Sign(ctx context.Context, typ string, payload []byte) (string, error) {
+	fields := map[string]string{
+		"alg": r.active.Algorithm(),
+		"kid": r.active.ID(),
+	}
+	if typ != "" {
+		fields["typ"] = typ
+	}
+	header, err := json.Marshal(fields)
+	if err != nil {
+		return "", err
+	}
+
+	b64 := base64.RawURLEncoding.EncodeToString
+	input := b64(header) + "." + b64(payload)
+	sig, err := r.active.Sign(ctx, []byte(input))
+	if err != nil {
+		return "", fmt.Errorf("failed to sign: %w", err)
+	}
+	return input + "." + b64(sig), nil
+}
+
+// SignDetached signs payload as a compact JWS with the payload left out
+// (RFC 7515 appendix F), to travel beside the payload it signs
+func (r *Ring) SignDetached(ctx context.Context, payload []byte) (string, error) {
+	jws, err := r.Sign(ctx, "", payload)
+	if err != nil {
+		return "", err
+	}
+	parts := strings.Split(jws, ".")
+	return parts[0] + ".." + parts[2], nil
+}
+
+// VerifyDetached checks a detached JWS over payload signed by a key of the ring
+func (r *Ring) VerifyDetached(jws string, payload []byte) error {
+	header, sig, ok := strings.Cut(jws, "..")
+	if !ok {
+		return errors.New("malformed signature")
+	}
+	_, err := r.Verify(header + "." + base64.RawURLEncoding.EncodeToString(payload) + "." + sig)
+	return err
+}
+
+// Verify checks a compact JWS signed by a key of the ring and returns its
+// payload
+func (r *Ring) Verify(jws string) ([]byte, error) {
+	parts := strings.Split(jws, ".")
+	if len(parts) != 3 {
+		return nil, errors.New("malformed signature")
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, errors.New("malformed signature")
+	}
+	header, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return nil, errors.New("malformed signature")
+	}
+	var h struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+	if err := json.Unmarshal(header, &h); err != nil {
+		return nil, errors.New("malformed signature")
+	}
+
+	key, err := r.KeyFor(h.Kid, h.Alg)
+	if err != nil {
+		return nil, err
+	}
+	method := jwt.GetSigningMethod(h.Alg)
+	if err := method.Verify(parts[0]+"."+parts[1], sig, key); err != nil {
+		return nil, fmt.Errorf("invalid signature: %w", err)
+	}
+	return base64.RawURLEncoding.DecodeString(parts[1])
+}
+
+// KeyFor returns what an artifact signed by the key kid with the algorithm
+// alg is verified with. Artifacts signed before keys were named are verified
+// with the session secret, if the ring holds it.
+func (r *Ring) KeyFor(kid, alg string) (interface{}, error) {
+	var key Key
+	if kid == "" {
+		for _, k := range r.keys {
+			if k.Provider() == ProviderSecret {
+				key = k
+			}
+		}
+	} else {
+		key, _ = r.Lookup(kid)
+	}
+	if key == nil {
+		return nil, ErrUnknownKey
+	}
+	if key.Algorithm() != alg {
+		return nil, fmt.Errorf("unexpected signing method: %s", alg)
+	}
+	return key.Verifier(), nil
+}
+
+// JWKS returns the public keys of the ring, for verifying what it signed
+// without trusting the gateway's secrets. HMAC keys are never published.
+func (r *Ring) JWKS() servicetoken.JWKSet {
+	set := servicetoken.JWKSet{Keys: []servicetoken.JWK{}}
+	for _, key := range r.keys {
+		if jwk, err := servicetoken.NewJWK(key.ID(), key.Algorithm(), key.Verifier()); err == nil {
+			set.Keys = append(set.Keys, jwk)
+		}
+	}
+	return set
+}
+
+// publicKey implements the parts of Key shared by asymmetric keys. Its ID is
+// the RFC 7638 thumbprint of the public key, so it is the same wherever the
+// key is held.
+type publicKey struct {
+	id       string
+	alg      string
+	provider string
+	pub      crypto.PublicKey
+}
+
+func newPublicKey(provider string, pub crypto.PublicKey) (publicKey, error) {
+	var alg string
+	switch pub := pub.(type) {
+	case *rsa.PublicKey:
+		if pub.N.BitLen() < 2048 {
+			return publicKey{}, errors.New("RSA keys must be at least 2048 bits")
+		}
+		alg = "RS256"
+	case *ecdsa.PublicKey:
+		switch pub.Curve.Params().Name {
+		case "P-256":
+			alg = "ES256"
+		case "P-384":
+			alg = "ES384"
+		default:
+			return publicKey{}, fmt.Errorf("unsupported curve %s", pub.Curve.Params().Name)
+		}
+	case ed25519.PublicKey:
+		alg = "EdDSA"
+	default:
+		return publicKey{}, fmt.Errorf("unsupported key type %T", pub)
+	}
+
+	jwk, err := servicetoken.NewJWK("", alg, pub)
+	if err != nil {
+		return publicKey{}, err
+	}
+	return publicKey{id: jwk.Thumbprint(), alg: alg, provider: provider, pub: pub}, nil
+}
+
+func (k publicKey) ID() string            { return k.id }
+func (k publicKey) Algorithm() string     { return k.alg }
+func (k publicKey) Provider() string      { return k.provider }
+func (k publicKey) Verifier() interface{} { return k.pub }
+
+// hash returns the hash the key's algorithm signs
+func (k publicKey) hash() crypto.Hash {
+	if k.alg == "ES384" {
+		return crypto.SHA384
+	}
+	return crypto.SHA256
+}
+
+// digest hashes data as the key's algorithm signs it
+func (k publicKey) digest(data []byte) []byte {
+	h := k.hash().New()
+	h.Write(data)
+	return h.Sum(nil)
+}
+
+// joseSignature converts an ASN.1 ECDSA signature, as HSMs and KMSs return
+// them, to the fixed-size r || s form JWS uses. Other signatures are returned
+// as they are.
+func (k publicKey) joseSignature(sig []byte) ([]byte, error) {
+	pub, ok := k.pub.(*ecdsa.PublicKey)
+	if !ok {
+		return sig, nil
+	}
+	var rs struct{ R, S *big.Int }
+	if rest, err := asn1.Unmarshal(sig, &rs); err != nil || len(rest) > 0 {
+		return nil, errors.New("malformed ECDSA signature")
+	}
+	size := (pub.Curve.Params().BitSize + 7) / 8
+	out := make([]byte, 2*size)
+	rs.R.FillBytes(out[:size])
+	rs.S.FillBytes(out[size:])
+	return out, nil
+}
@@ -0,0 +1,235 @@
+package keys
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/VanCannon/openpam/pkg/servicetoken"
+)
+
+func writeECKey(t *testing.T) (string, *ecdsa.PrivateKey) {
+	t.Helper()
+	private, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	der, _ := x509.MarshalPKCS8PrivateKey(private)
+	path := filepath.Join(t.TempDir(), "signing.pem")
+	if err := os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path, private
+}
+
+func TestRing(t *testing.T) {
+	ctx := context.Background()
+	path, _ := writeECKey(t)
+
+	// Rotating from the session secret to a file key
+	old, err := Load(ctx, Config{Secret: "test-secret"})
+	if err != nil {
+		t.Fatalf("Load(secret) error = %v", err)
+	}
+	oldJWS, _ := old.Sign(ctx, "JWT", []byte(`{"n":1}`))
+
+	ring, err := Load(ctx, Config{Key: "file:" + path, Previous: []string{"secret"}, Secret: "test-secret"})
+	if err != nil {
+		t.Fatalf("Load(file) error = %v", err)
+	}
+	if got := ring.Active(); got.Algorithm() != "ES256" || got.Provider() != ProviderFile {
+		t.Errorf("Active() = %s %s", got.Algorithm(), got.Provider())
+	}
+
+	jws, err := ring.Sign(ctx, "JWT", []byte(`{"n":2}`))
+	if err != nil {
+		t.Fatalf("Sign() error = %v", err)
+	}
+	header, _ := base64.RawURLEncoding.DecodeString(strings.Split(jws, ".")[0])
+	if !strings.Contains(string(header), `"kid":"`+ring.Active().ID()+`"`) {
+		t.Errorf("header = %s, want the kid of the active key", header)
+	}
+
+	for _, tt := range []struct {
+		jws, want string
+	}{{jws, `{"n":2}`}, {oldJWS, `{"n":1}`}} {
+		payload, err := ring.Verify(tt.jws)
+		if err != nil || string(payload) != tt.want {
+			t.Errorf("Verify() = %s, %v, want %s", payload, err, tt.want)
+		}
+	}
+
+	// Tampered payloads and keys the ring does not hold are refused
+	parts := strings.Split(jws, ".")
+	parts[1] = base64.RawURLEncoding.EncodeToString([]byte(`{"n":3}`))
+	if _, err := ring.Verify(strings.Join(parts, ".")); err == nil {
+		t.Error("Verify() accepted a tampered payload")
+	}
+	other, _ := Load(ctx, Config{Secret: "other-secret"})
+	otherJWS, _ := other.Sign(ctx, "JWT", []byte(`{}`))
+	if _, err := ring.Verify(otherJWS); !errors.Is(err, ErrUnknownKey) {
+		t.Errorf("Verify(other key) error = %v, want ErrUnknownKey", err)
+	}
+
+	// A key cannot be used with another algorithm than its own
+	if _, err := ring.KeyFor(ring.Active().ID(), "HS256"); err == nil {
+		t.Error("KeyFor() accepted HS256 for an ES256 key")
+	}
+
+	// The session secret is never published
+	set := ring.JWKS()
+	if len(set.Keys) != 1 || set.Keys[0].Kid != ring.Active().ID() || set.Keys[0].Kty != "EC" {
+		t.Errorf("JWKS() = %+v", set)
+	}
+}
+
+func TestMiddleware(t *testing.T) {
+	path, _ := writeECKey(t)
+	ring, err := Load(context.Background(), Config{Key: "file:" + path})
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	jwks := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(ring.JWKS())
+	}))
+	defer jwks.Close()
+	keySet := servicetoken.NewKeySet(jwks.URL)
+
+	handler := ring.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("fail") != "" {
+			http.Error(w, "nope", http.StatusForbidden)
+			return
+		}
+		w.Write([]byte(`{"premium":true}`))
+	}))
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+	sig := rec.Header().Get(SignatureHeader)
+	if rec.Code != http.StatusOK || rec.Body.String() != `{"premium":true}` || sig == "" {
+		t.Fatalf("response = %d %q, signature %q", rec.Code, rec.Body.String(), sig)
+	}
+	if err := keySet.VerifyDetached(sig, rec.Body.Bytes()); err != nil {
+		t.Errorf("VerifyDetached() error = %v", err)
+	}
+	if err := keySet.VerifyDetached(sig, []byte(`{"premium":false}`)); err == nil {
+		t.Error("VerifyDetached() accepted a spoofed body")
+	}
+
+	// Errors are passed through unsigned
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/?fail=1", nil))
+	if rec.Code != http.StatusForbidden || rec.Header().Get(SignatureHeader) != "" {
+		t.Errorf("error response = %d, signature %q", rec.Code, rec.Header().Get(SignatureHeader))
+	}
+
+	// The key set holds no secrets, so HMAC signatures are refused
+	secret, _ := Load(context.Background(), Config{Secret: "test-secret"})
+	hmacSig, _ := secret.SignDetached(context.Background(), rec.Body.Bytes())
+	if err := keySet.VerifyDetached(hmacSig, rec.Body.Bytes()); err == nil {
+		t.Error("VerifyDetached() accepted an HS256 signature")
+	}
+}
+
+// kmsRedirect sends every request to the test server
+type kmsRedirect struct {
+	target *url.URL
+}
+
+func (t kmsRedirect) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context())
+	req.URL.Scheme = t.target.Scheme
+	req.URL.Host = t.target.Host
+	return http.DefaultTransport.RoundTrip(req)
+}
+
+func TestKMS(t *testing.T) {
+	private, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	der, _ := x509.MarshalPKIXPublicKey(&private.PublicKey)
+	arn := "arn:aws:kms:eu-west-1:111122223333:key/1234abcd-12ab-34cd-56ef-1234567890ab"
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.Contains(r.Header.Get("Authorization"), "/eu-west-1/kms/aws4_request") {
+			t.Errorf("Authorization = %q", r.Header.Get("Authorization"))
+		}
+		var in map[string]string
+		json.NewDecoder(r.Body).Decode(&in)
+		if in["KeyId"] != arn {
+			t.Errorf("KeyId = %q", in["KeyId"])
+		}
+
+		switch r.Header.Get("X-Amz-Target") {
+		case "TrentService.GetPublicKey":
+			json.NewEncoder(w).Encode(map[string]string{
+				"PublicKey": base64.StdEncoding.EncodeToString(der),
+				"KeyUsage":  "SIGN_VERIFY",
+			})
+		case "TrentService.Sign":
+			if in["MessageType"] != "DIGEST" || in["SigningAlgorithm"] != "ECDSA_SHA_256" {
+				t.Errorf("Sign request = %v", in)
+			}
+			digest, _ := base64.StdEncoding.DecodeString(in["Message"])
+			sig, _ := ecdsa.SignASN1(rand.Reader, private, digest)
+			json.NewEncoder(w).Encode(map[string]string{"Signature": base64.StdEncoding.EncodeToString(sig)})
+		default:
+			w.WriteHeader(http.StatusBadRequest)
+		}
+	}))
+	defer srv.Close()
+	target, _ := url.Parse(srv.URL)
+
+	ring, err := Load(context.Background(), Config{
+		Key:          "awskms:" + arn,
+		AWSAccessKey: "AKIDEXAMPLE",
+		AWSSecretKey: "secret",
+		Client:       &http.Client{Transport: kmsRedirect{target}},
+	})
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+
+	// KMS returns ASN.1 signatures, which JWS verifiers do not accept
+	jws, err := ring.Sign(context.Background(), "JWT", []byte(`{"sub":"x"}`))
+	if err != nil {
+		t.Fatalf("Sign() error = %v", err)
+	}
+	if _, err := ring.Verify(jws); err != nil {
+		t.Errorf("Verify() error = %v", err)
+	}
+}
+
+func TestConfigValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		cfg     Config
+		wantErr bool
+	}{
+		{"secret", Config{Secret: "s"}, false},
+		{"no secret", Config{}, true},
+		{"file", Config{Key: "file:/etc/openpam/signing.pem"}, false},
+		{"unknown provider", Config{Key: "vault:transit/openpam"}, true},
+		{"kms without credentials", Config{Key: "awskms:arn:aws:kms:us-east-1:1:key/k"}, true},
+		{"kms bad arn", Config{Key: "awskms:k", AWSAccessKey: "a", AWSSecretKey: "s"}, true},
+		{"azure", Config{Key: "azurekv:https://v.vault.azure.net/keys/k/1", AzureTenantID: "t", AzureClientID: "c", AzureClientSecret: "s"}, false},
+		{"pkcs11 without module", Config{Key: "pkcs11:token=openpam;object=signing"}, true},
+		{"pkcs11", Config{Key: "pkcs11:token=openpam;object=signing?module-path=/usr/lib/softhsm/libsofthsm2.so&pin-value=1234"}, false},
+		{"bad previous", Config{Key: "file:/k.pem", Previous: []string{"file:"}}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.cfg.Validate(); (err != nil) != tt.wantErr {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
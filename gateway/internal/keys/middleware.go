@@ -0,0 +1,55 @@
+package keys
+
+import (
+	"bytes"
+	"net/http"
+)
+
+// SignatureHeader carries the detached JWS of a signed response body
+const SignatureHeader = "JWS-Signature"
+
+// signedResponse holds a response back until its body is signed
+type signedResponse struct {
+	http.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+func (w *signedResponse) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
+}
+
+func (w *signedResponse) Write(p []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	return w.body.Write(p)
+}
+
+// Middleware signs successful responses with the active key. The detached JWS
+// of the exact body bytes goes in the JWS-Signature header, so a component
+// downstream of a proxy can check the body came from the gateway unchanged by
+// verifying it against /.well-known/jwks.json.
+func (r *Ring) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		rec := &signedResponse{ResponseWriter: w}
+		next.ServeHTTP(rec, req)
+		if rec.status == 0 {
+			rec.status = http.StatusOK
+		}
+
+		if rec.status == http.StatusOK {
+			sig, err := r.SignDetached(req.Context(), rec.body.Bytes())
+			if err != nil {
+				// Unsigned responses would be rejected downstream anyway
+				http.Error(w, "Failed to sign response", http.StatusInternalServerError)
+				return
+			}
+			w.Header().Set(SignatureHeader, sig)
+		}
+		w.WriteHeader(rec.status)
+		w.Write(rec.body.Bytes())
+	})
+}
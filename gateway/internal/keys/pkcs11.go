@@ -0,0 +1,214 @@
+//go:build pkcs11
+
+package keys
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/asn1"
+	"errors"
+	"fmt"
+	"math/big"
+	"sync"
+
+	"github.com/miekg/pkcs11"
+)
+
+// pkcs11Key is a key held in a PKCS#11 token, such as an HSM. The private key
+// never leaves the token; the gateway keeps one logged-in session to sign with.
+type pkcs11Key struct {
+	publicKey
+	ctx     *pkcs11.Ctx
+	private pkcs11.ObjectHandle
+
+	mu      sync.Mutex // A session signs one thing at a time
+	session pkcs11.SessionHandle
+}
+
+// Named curves of PKCS#11 EC keys
+var (
+	oidP256 = asn1.ObjectIdentifier{1, 2, 840, 10045, 3, 1, 7}
+	oidP384 = asn1.ObjectIdentifier{1, 3, 132, 0, 34}
+)
+
+func openPKCS11(uri string) (Key, error) {
+	u, err := parsePKCS11URI(uri)
+	if err != nil {
+		return nil, err
+	}
+
+	p := pkcs11.New(u.module)
+	if p == nil {
+		return nil, fmt.Errorf("failed to load PKCS#11 module %s", u.module)
+	}
+	if err := p.Initialize(); err != nil && !errors.Is(err, pkcs11.Error(pkcs11.CKR_CRYPTOKI_ALREADY_INITIALIZED)) {
+		return nil, fmt.Errorf("failed to initialize PKCS#11 module: %w", err)
+	}
+
+	slot, err := findSlot(p, u.token)
+	if err != nil {
+		return nil, err
+	}
+	session, err := p.OpenSession(slot, pkcs11.CKF_SERIAL_SESSION)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open PKCS#11 session: %w", err)
+	}
+	if err := p.Login(session, pkcs11.CKU_USER, u.pin); err != nil && !errors.Is(err, pkcs11.Error(pkcs11.CKR_USER_ALREADY_LOGGED_IN)) {
+		p.CloseSession(session)
+		return nil, fmt.Errorf("failed to log in to PKCS#11 token: %w", err)
+	}
+
+	k := &pkcs11Key{ctx: p, session: session}
+	k.private, err = findObject(p, session, pkcs11.CKO_PRIVATE_KEY, u)
+	if err != nil {
+		p.CloseSession(session)
+		return nil, err
+	}
+	public, err := findObject(p, session, pkcs11.CKO_PUBLIC_KEY, u)
+	if err != nil {
+		p.CloseSession(session)
+		return nil, err
+	}
+	pub, err := readPublicKey(p, session, public)
+	if err != nil {
+		p.CloseSession(session)
+		return nil, err
+	}
+	k.publicKey, err = newPublicKey(ProviderPKCS11, pub)
+	if err != nil {
+		p.CloseSession(session)
+		return nil, err
+	}
+	return k, nil
+}
+
+// findSlot returns the slot holding the token labelled label
+func findSlot(p *pkcs11.Ctx, label string) (uint, error) {
+	slots, err := p.GetSlotList(true)
+	if err != nil {
+		return 0, fmt.Errorf("failed to list PKCS#11 slots: %w", err)
+	}
+	for _, slot := range slots {
+		info, err := p.GetTokenInfo(slot)
+		if err == nil && info.Label == label {
+			return slot, nil
+		}
+	}
+	return 0, fmt.Errorf("PKCS#11 token %q not found", label)
+}
+
+// findObject returns the key of class named by the URI
+func findObject(p *pkcs11.Ctx, session pkcs11.SessionHandle, class uint, u *pkcs11URI) (pkcs11.ObjectHandle, error) {
+	template := []*pkcs11.Attribute{pkcs11.NewAttribute(pkcs11.CKA_CLASS, class)}
+	if u.object != "" {
+		template = append(template, pkcs11.NewAttribute(pkcs11.CKA_LABEL, u.object))
+	}
+	if u.id != nil {
+		template = append(template, pkcs11.NewAttribute(pkcs11.CKA_ID, u.id))
+	}
+
+	if err := p.FindObjectsInit(session, template); err != nil {
+		return 0, fmt.Errorf("failed to search PKCS#11 token: %w", err)
+	}
+	defer p.FindObjectsFinal(session)
+
+	objects, _, err := p.FindObjects(session, 2)
+	if err != nil {
+		return 0, fmt.Errorf("failed to search PKCS#11 token: %w", err)
+	}
+	switch len(objects) {
+	case 0:
+		return 0, errors.New("PKCS#11 key not found")
+	case 1:
+		return objects[0], nil
+	default:
+		return 0, errors.New("PKCS#11 URI matches more than one key; add its id")
+	}
+}
+
+// readPublicKey reads an RSA or EC public key object
+func readPublicKey(p *pkcs11.Ctx, session pkcs11.SessionHandle, object pkcs11.ObjectHandle) (crypto.PublicKey, error) {
+	attrs, err := p.GetAttributeValue(session, object, []*pkcs11.Attribute{
+		pkcs11.NewAttribute(pkcs11.CKA_KEY_TYPE, nil),
+	})
+	if err != nil || len(attrs) != 1 {
+		return nil, fmt.Errorf("failed to read PKCS#11 key type: %w", err)
+	}
+
+	// Attributes hold a native CK_ULONG, compared as the library encodes one
+	keyType := func(t uint) bool {
+		return bytes.Equal(attrs[0].Value, pkcs11.NewAttribute(pkcs11.CKA_KEY_TYPE, t).Value)
+	}
+	switch {
+	case keyType(pkcs11.CKK_RSA):
+		attrs, err := p.GetAttributeValue(session, object, []*pkcs11.Attribute{
+			pkcs11.NewAttribute(pkcs11.CKA_MODULUS, nil),
+			pkcs11.NewAttribute(pkcs11.CKA_PUBLIC_EXPONENT, nil),
+		})
+		if err != nil || len(attrs) != 2 {
+			return nil, fmt.Errorf("failed to read RSA public key: %w", err)
+		}
+		return &rsa.PublicKey{
+			N: new(big.Int).SetBytes(attrs[0].Value),
+			E: int(new(big.Int).SetBytes(attrs[1].Value).Int64()),
+		}, nil
+	case keyType(pkcs11.CKK_EC):
+		attrs, err := p.GetAttributeValue(session, object, []*pkcs11.Attribute{
+			pkcs11.NewAttribute(pkcs11.CKA_EC_PARAMS, nil),
+			pkcs11.NewAttribute(pkcs11.CKA_EC_POINT, nil),
+		})
+		if err != nil || len(attrs) != 2 {
+			return nil, fmt.Errorf("failed to read EC public key: %w", err)
+		}
+		var oid asn1.ObjectIdentifier
+		if _, err := asn1.Unmarshal(attrs[0].Value, &oid); err != nil {
+			return nil, errors.New("EC keys must be on a named curve")
+		}
+		var curve elliptic.Curve
+		switch {
+		case oid.Equal(oidP256):
+			curve = elliptic.P256()
+		case oid.Equal(oidP384):
+			curve = elliptic.P384()
+		default:
+			return nil, fmt.Errorf("unsupported curve %s", oid)
+		}
+		// The point is an uncompressed point wrapped in an OCTET STRING
+		var point []byte
+		if _, err := asn1.Unmarshal(attrs[1].Value, &point); err != nil {
+			return nil, errors.New("malformed EC point")
+		}
+		x, y := elliptic.Unmarshal(curve, point)
+		if x == nil {
+			return nil, errors.New("malformed EC point")
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+	default:
+		return nil, errors.New("PKCS#11 keys must be RSA or EC keys")
+	}
+}
+
+// Sign has the token sign data. RSA keys hash on the token; EC keys sign the
+// digest, and return signatures in JWS form already.
+func (k *pkcs11Key) Sign(ctx context.Context, data []byte) ([]byte, error) {
+	mechanism := pkcs11.NewMechanism(pkcs11.CKM_SHA256_RSA_PKCS, nil)
+	if _, ok := k.pub.(*ecdsa.PublicKey); ok {
+		mechanism = pkcs11.NewMechanism(pkcs11.CKM_ECDSA, nil)
+		data = k.digest(data)
+	}
+
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if err := k.ctx.SignInit(k.session, []*pkcs11.Mechanism{mechanism}, k.private); err != nil {
+		return nil, fmt.Errorf("PKCS#11 sign failed: %w", err)
+	}
+	sig, err := k.ctx.Sign(k.session, data)
+	if err != nil {
+		return nil, fmt.Errorf("PKCS#11 sign failed: %w", err)
+	}
+	return sig, nil
+}
@@ -0,0 +1,11 @@
+//go:build !pkcs11
+
+package keys
+
+import "errors"
+
+// openPKCS11 fails: PKCS#11 needs cgo, so it is only built with the pkcs11
+// build tag
+func openPKCS11(uri string) (Key, error) {
+	return nil, errors.New("this gateway was built without PKCS#11 support; rebuild with -tags pkcs11")
+}
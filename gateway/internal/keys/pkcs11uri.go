@@ -0,0 +1,74 @@
+package keys
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+)
+
+// pkcs11URI is the part of an RFC 7512 PKCS#11 URI that names a signing key
+type pkcs11URI struct {
+	module string // Path of the PKCS#11 library
+	token  string // Token label
+	object string // Label of the private key and its public key
+	id     []byte // CKA_ID of the keys, if the label is not enough
+	pin    string
+}
+
+// parsePKCS11URI parses a URI such as
+// pkcs11:token=openpam;object=signing?module-path=/usr/lib/softhsm/libsofthsm2.so&pin-source=/run/secrets/pin
+func parsePKCS11URI(s string) (*pkcs11URI, error) {
+	rest, ok := strings.CutPrefix(s, "pkcs11:")
+	if !ok {
+		return nil, errors.New("PKCS#11 keys must be a pkcs11: URI")
+	}
+	path, query, _ := strings.Cut(rest, "?")
+
+	var u pkcs11URI
+	for _, attr := range strings.Split(path, ";") {
+		if attr == "" {
+			continue
+		}
+		name, value, _ := strings.Cut(attr, "=")
+		value, err := url.PathUnescape(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid PKCS#11 URI attribute %s: %w", name, err)
+		}
+		switch name {
+		case "token":
+			u.token = value
+		case "object":
+			u.object = value
+		case "id":
+			u.id = []byte(value)
+		}
+	}
+
+	params, err := url.ParseQuery(query)
+	if err != nil {
+		return nil, fmt.Errorf("invalid PKCS#11 URI query: %w", err)
+	}
+	u.module = params.Get("module-path")
+	u.pin = params.Get("pin-value")
+	if source := params.Get("pin-source"); source != "" {
+		// Read when the key is opened, so the PIN can stay out of the environment
+		data, err := os.ReadFile(strings.TrimPrefix(source, "file:"))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read PKCS#11 PIN: %w", err)
+		}
+		u.pin = strings.TrimSpace(string(data))
+	}
+
+	if u.module == "" {
+		return nil, errors.New("PKCS#11 URI requires module-path")
+	}
+	if u.token == "" {
+		return nil, errors.New("PKCS#11 URI requires token")
+	}
+	if u.object == "" && u.id == nil {
+		return nil, errors.New("PKCS#11 URI requires object or id")
+	}
+	return &u, nil
+}
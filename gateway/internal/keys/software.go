@@ -0,0 +1,86 @@
+package keys
+
+import (
+	"context"
+	"crypto"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// secretKey signs HS256 with the session secret, as the gateway always has
+type secretKey struct {
+	id     string
+	secret []byte
+}
+
+// NewSecretKey creates an HMAC key from the session secret. Its ID is the
+// RFC 7638 thumbprint of the secret as an oct JWK, which reveals nothing of it.
+func NewSecretKey(secret string) Key {
+	members := fmt.Sprintf(`{"k":%q,"kty":"oct"}`, base64.RawURLEncoding.EncodeToString([]byte(secret)))
+	sum := sha256.Sum256([]byte(members))
+	return &secretKey{id: base64.RawURLEncoding.EncodeToString(sum[:]), secret: []byte(secret)}
+}
+
+func (k *secretKey) ID() string            { return k.id }
+func (k *secretKey) Algorithm() string     { return "HS256" }
+func (k *secretKey) Provider() string      { return ProviderSecret }
+func (k *secretKey) Verifier() interface{} { return k.secret }
+
+// Sign returns the HMAC of data
+func (k *secretKey) Sign(ctx context.Context, data []byte) ([]byte, error) {
+	return jwt.SigningMethodHS256.Sign(string(data), k.secret)
+}
+
+// fileKey is a private key read from a PEM file
+type fileKey struct {
+	publicKey
+	private crypto.Signer
+}
+
+// LoadFile reads an RSA, ECDSA or Ed25519 private key from a PEM file, in
+// PKCS#8, PKCS#1 or SEC 1 form
+func LoadFile(path string) (Key, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("no PEM block found")
+	}
+
+	var private interface{}
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		private, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "EC PRIVATE KEY":
+		private, err = x509.ParseECPrivateKey(block.Bytes)
+	default:
+		private, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse private key: %w", err)
+	}
+
+	signer, ok := private.(crypto.Signer)
+	if !ok {
+		return nil, fmt.Errorf("unsupported key type %T", private)
+	}
+	pub, err := newPublicKey(ProviderFile, signer.Public())
+	if err != nil {
+		return nil, err
+	}
+	return &fileKey{publicKey: pub, private: signer}, nil
+}
+
+// Sign signs data with the private key
+func (k *fileKey) Sign(ctx context.Context, data []byte) ([]byte, error) {
+	return jwt.GetSigningMethod(k.alg).Sign(string(data), k.private)
+}
@@ -0,0 +1,131 @@
+// Package license enforces the license held by the license service. Once a
+// license expires the gateway enters a grace period: existing users keep
+// working, but new sessions to premium protocols and new user accounts are
+// refused. When the grace period ends the gateway turns read-only, leaving
+// audit data and recordings readable but refusing every change and new session.
+package license
+
+import (
+	"fmt"
+	"math"
+	"time"
+)
+
+// Mode is how the gateway behaves under the current license
+type Mode string
+
+const (
+	ModeUnenforced Mode = "unenforced" // No license service configured
+	ModeActive     Mode = "active"
+	ModeGrace      Mode = "grace"
+	ModeReadOnly   Mode = "read_only"
+)
+
+// Banner levels
+const (
+	BannerInfo    = "info"
+	BannerWarning = "warning"
+	BannerError   = "error"
+)
+
+// License is the active license as reported by the license service
+type License struct {
+	ID          string                 `json:"id"`
+	LicenseType string                 `json:"license_type"`
+	IssuedTo    string                 `json:"issued_to"`
+	ExpiresAt   *time.Time             `json:"expires_at,omitempty"`
+	IsActive    bool                   `json:"is_active"`
+	Features    map[string]interface{} `json:"features"`
+}
+
+// Banner is a message every page of the web console should show
+type Banner struct {
+	Level   string `json:"level"`
+	Message string `json:"message"`
+}
+
+// Status describes the license and the mode it puts the gateway in
+type Status struct {
+	Mode        Mode       `json:"mode"`
+	LicenseType string     `json:"license_type,omitempty"`
+	IssuedTo    string     `json:"issued_to,omitempty"`
+	ExpiresAt   *time.Time `json:"expires_at,omitempty"`
+	GraceEndsAt *time.Time `json:"grace_ends_at,omitempty"`
+	// DaysRemaining counts down to expiry, or to the end of the grace period once expired
+	DaysRemaining *int       `json:"days_remaining,omitempty"`
+	Banner        *Banner    `json:"banner,omitempty"`
+	CheckedAt     *time.Time `json:"checked_at,omitempty"`
+}
+
+// Policy decides the mode a license puts the gateway in
+type Policy struct {
+	GracePeriod   time.Duration // How long after expiry the grace period lasts
+	ExpiryWarning time.Duration // How long before expiry a warning banner is shown
+}
+
+// Evaluate returns the status of a license at now. A nil or inactive license
+// means there is no valid license, which puts the gateway straight into
+// read-only mode.
+func (p Policy) Evaluate(lic *License, now time.Time) Status {
+	if lic == nil || !lic.IsActive {
+		return Status{
+			Mode:   ModeReadOnly,
+			Banner: &Banner{Level: BannerError, Message: "No active license. OpenPAM is read-only until a license is activated."},
+		}
+	}
+
+	status := Status{
+		Mode:        ModeActive,
+		LicenseType: lic.LicenseType,
+		IssuedTo:    lic.IssuedTo,
+		ExpiresAt:   lic.ExpiresAt,
+	}
+	if lic.ExpiresAt == nil {
+		return status
+	}
+
+	expires := *lic.ExpiresAt
+	graceEnds := expires.Add(p.GracePeriod)
+	status.GraceEndsAt = &graceEnds
+
+	switch {
+	case now.Before(expires):
+		days := daysUntil(now, expires)
+		status.DaysRemaining = &days
+		if p.ExpiryWarning > 0 && expires.Sub(now) <= p.ExpiryWarning {
+			status.Banner = &Banner{
+				Level:   BannerWarning,
+				Message: fmt.Sprintf("The OpenPAM license expires in %s, on %s.", plural(days, "day"), expires.Format("2006-01-02")),
+			}
+		}
+	case now.Before(graceEnds):
+		days := daysUntil(now, graceEnds)
+		status.Mode = ModeGrace
+		status.DaysRemaining = &days
+		status.Banner = &Banner{
+			Level: BannerError,
+			Message: fmt.Sprintf("The OpenPAM license expired on %s. New premium sessions and new users are disabled, and OpenPAM becomes read-only in %s.",
+				expires.Format("2006-01-02"), plural(days, "day")),
+		}
+	default:
+		status.Mode = ModeReadOnly
+		status.Banner = &Banner{
+			Level:   BannerError,
+			Message: fmt.Sprintf("The OpenPAM license expired on %s and its grace period has ended. OpenPAM is read-only until the license is renewed.", expires.Format("2006-01-02")),
+		}
+	}
+
+	return status
+}
+
+// daysUntil counts the days left until t, rounding up so the last day reads as 1
+func daysUntil(now, t time.Time) int {
+	return int(math.Ceil(t.Sub(now).Hours() / 24))
+}
+
+func plural(n int, unit string) string {
+	if n == 1 {
+		return fmt.Sprintf("%d %s", n, unit)
+	}
+	return fmt.Sprintf("%d %ss", n, unit)
+}
@@ -0,0 +1,103 @@
+package license
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/VanCannon/openpam/pkg/logger"
+)
+
+func TestPolicy_Evaluate(t *testing.T) {
+	policy := Policy{GracePeriod: 14 * 24 * time.Hour, ExpiryWarning: 30 * 24 * time.Hour}
+	now := time.Date(2026, 6, 1, 12, 0, 0, 0, time.UTC)
+	expiringIn := func(d time.Duration) *License {
+		expires := now.Add(d)
+		return &License{IsActive: true, ExpiresAt: &expires}
+	}
+
+	tests := []struct {
+		name       string
+		license    *License
+		wantMode   Mode
+		wantBanner bool
+		wantDays   int
+	}{
+		{"perpetual", &License{IsActive: true}, ModeActive, false, 0},
+		{"far from expiry", expiringIn(90 * 24 * time.Hour), ModeActive, false, 90},
+		{"expiring soon", expiringIn(10 * 24 * time.Hour), ModeActive, true, 10},
+		{"last day", expiringIn(2 * time.Hour), ModeActive, true, 1},
+		{"in grace", expiringIn(-3 * 24 * time.Hour), ModeGrace, true, 11},
+		{"after grace", expiringIn(-15 * 24 * time.Hour), ModeReadOnly, true, 0},
+		{"no license", nil, ModeReadOnly, true, 0},
+		{"inactive", &License{IsActive: false}, ModeReadOnly, true, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			status := policy.Evaluate(tt.license, now)
+			if status.Mode != tt.wantMode {
+				t.Errorf("mode = %s, want %s", status.Mode, tt.wantMode)
+			}
+			if (status.Banner != nil) != tt.wantBanner {
+				t.Errorf("banner = %+v, want banner %v", status.Banner, tt.wantBanner)
+			}
+			if tt.wantDays != 0 && (status.DaysRemaining == nil || *status.DaysRemaining != tt.wantDays) {
+				t.Errorf("days remaining = %v, want %d", status.DaysRemaining, tt.wantDays)
+			}
+		})
+	}
+}
+
+func TestMonitor_Middleware(t *testing.T) {
+	now := time.Now()
+	inGrace := now.Add(-24 * time.Hour)
+	pastGrace := now.Add(-30 * 24 * time.Hour)
+
+	tests := []struct {
+		name    string
+		license *License
+		method  string
+		path    string
+		allowed bool
+	}{
+		{"active RDP session", &License{IsActive: true}, "GET", "/api/ws/connect/rdp/id", true},
+		{"grace SSH session", &License{IsActive: true, ExpiresAt: &inGrace}, "GET", "/api/ws/connect/ssh/id", true},
+		{"grace RDP session", &License{IsActive: true, ExpiresAt: &inGrace}, "GET", "/api/ws/connect/rdp/id", false},
+		{"grace change", &License{IsActive: true, ExpiresAt: &inGrace}, "POST", "/api/v1/targets/create", true},
+		{"read-only session", &License{IsActive: true, ExpiresAt: &pastGrace}, "GET", "/api/ws/connect/ssh/id", false},
+		{"read-only change", &License{IsActive: true, ExpiresAt: &pastGrace}, "POST", "/api/v1/targets/create", false},
+		{"read-only read", &License{IsActive: true, ExpiresAt: &pastGrace}, "GET", "/api/v1/audit-logs", true},
+		{"read-only logout", &License{IsActive: true, ExpiresAt: &pastGrace}, "POST", "/api/v1/auth/logout", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := NewMonitor("http://license", Policy{GracePeriod: 14 * 24 * time.Hour}, []string{"rdp"}, time.Minute, logger.Default())
+			m.Set(tt.license, now)
+
+			handler := m.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusOK)
+			}))
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, httptest.NewRequest(tt.method, tt.path, nil))
+
+			if allowed := rec.Code == http.StatusOK; allowed != tt.allowed {
+				t.Errorf("status = %d, allowed = %v, want %v", rec.Code, allowed, tt.allowed)
+			}
+		})
+	}
+}
+
+func TestMonitor_Unenforced(t *testing.T) {
+	m := NewMonitor("", Policy{}, []string{"rdp"}, time.Minute, logger.Default())
+	m.Set(nil, time.Now())
+
+	if mode := m.Status(time.Now()).Mode; mode != ModeUnenforced {
+		t.Errorf("mode = %s, want %s", mode, ModeUnenforced)
+	}
+	if !m.AllowsSession("rdp", time.Now()) || !m.AllowsNewUsers(time.Now()) {
+		t.Error("nothing should be refused without a license service")
+	}
+}
@@ -0,0 +1,80 @@
+package license
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// connectPrefix is where sessions are opened: /api/ws/connect/{protocol}/{target_id}
+const connectPrefix = "/api/ws/connect/"
+
+// alwaysAllowed are paths that keep working in read-only mode, so users can
+// still sign in and out to read what's there
+var alwaysAllowed = []string{
+	"/api/v1/auth/",
+}
+
+// Middleware returns a middleware enforcing the license mode: premium
+// sessions are refused during the grace period, and new sessions and every
+// change are refused once the gateway is read-only
+func (m *Monitor) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !m.Enabled() {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		now := time.Now()
+
+		if strings.HasPrefix(r.URL.Path, connectPrefix) {
+			protocol, _, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, connectPrefix), "/")
+			if !m.AllowsSession(protocol, now) {
+				m.refuse(w, r, now, "New "+strings.ToUpper(protocol)+" sessions are disabled by the license")
+				return
+			}
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if !isSafeMethod(r.Method) && !isAlwaysAllowed(r.URL.Path) && m.Status(now).Mode == ModeReadOnly {
+			m.refuse(w, r, now, "OpenPAM is read-only because the license has expired")
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// refuse writes a 403 naming the license mode, so clients can tell it apart
+// from a permission error
+func (m *Monitor) refuse(w http.ResponseWriter, r *http.Request, now time.Time, message string) {
+	mode := m.Status(now).Mode
+
+	m.logger.Warn("Request refused by license", map[string]interface{}{
+		"mode":   string(mode),
+		"method": r.Method,
+		"path":   r.URL.Path,
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusForbidden)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"error":        message,
+		"license_mode": mode,
+	})
+}
+
+func isSafeMethod(method string) bool {
+	return method == http.MethodGet || method == http.MethodHead || method == http.MethodOptions
+}
+
+func isAlwaysAllowed(path string) bool {
+	for _, prefix := range alwaysAllowed {
+		if strings.HasPrefix(path, prefix) {
+			return true
+		}
+	}
+	return false
+}
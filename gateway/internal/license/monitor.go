@@ -0,0 +1,222 @@
+package license
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/VanCannon/openpam/gateway/internal/worker"
+	"github.com/VanCannon/openpam/pkg/logger"
+)
+
+// Monitor keeps track of the active license by polling the license service.
+// If the service can't be reached the last license seen keeps applying, so an
+// outage of the license service alone never locks the gateway.
+type Monitor struct {
+	url              string
+	policy           Policy
+	premiumProtocols []string
+	interval         time.Duration
+	client           *http.Client
+	logger           *logger.Logger
+
+	mu        sync.RWMutex
+	license   *License
+	known     bool // Whether the license service has answered yet
+	checkedAt time.Time
+	lastMode  Mode
+
+	loop worker.Loop
+}
+
+// NewMonitor creates a monitor polling the license service at url every
+// interval. An empty url disables enforcement.
+func NewMonitor(url string, policy Policy, premiumProtocols []string, interval time.Duration, log *logger.Logger) *Monitor {
+	if interval <= 0 {
+		interval = 5 * time.Minute
+	}
+
+	return &Monitor{
+		url:              strings.TrimRight(url, "/"),
+		policy:           policy,
+		premiumProtocols: premiumProtocols,
+		interval:         interval,
+		client:           &http.Client{Timeout: 10 * time.Second},
+		logger:           log,
+	}
+}
+
+// Enabled reports whether the license is enforced
+func (m *Monitor) Enabled() bool {
+	return m.url != ""
+}
+
+// Start polls the license service in the background until Stop is called
+func (m *Monitor) Start() {
+	if !m.Enabled() {
+		return
+	}
+	m.loop.Start(m.run)
+}
+
+// Stop stops polling. It is safe to call even if the monitor was never started.
+func (m *Monitor) Stop() {
+	m.loop.Stop()
+}
+
+func (m *Monitor) run() {
+	ticker := time.NewTicker(m.interval)
+	defer ticker.Stop()
+
+	for {
+		ctx, cancel := context.WithTimeout(context.Background(), m.interval)
+		if err := m.Refresh(ctx); err != nil {
+			m.logger.Warn("Failed to refresh license", map[string]interface{}{
+				"error": err.Error(),
+			})
+		}
+		cancel()
+
+		select {
+		case <-m.loop.Stopping():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Refresh fetches the active license from the license service
+func (m *Monitor) Refresh(ctx context.Context) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, m.url+"/api/v1/license", nil)
+	if err != nil {
+		return fmt.Errorf("failed to build license request: %w", err)
+	}
+
+	resp, err := m.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to reach license service: %w", err)
+	}
+	defer resp.Body.Close()
+
+	var lic *License
+	switch resp.StatusCode {
+	case http.StatusOK:
+		lic = &License{}
+		if err := json.NewDecoder(resp.Body).Decode(lic); err != nil {
+			return fmt.Errorf("failed to decode license: %w", err)
+		}
+	case http.StatusNotFound:
+		// The license service also answers 404 when its database is down, so a
+		// license that was seen before keeps applying
+		m.mu.RLock()
+		hadLicense := m.license != nil
+		m.mu.RUnlock()
+		if hadLicense {
+			return fmt.Errorf("license service found no active license")
+		}
+	default:
+		return fmt.Errorf("license service returned status %d", resp.StatusCode)
+	}
+
+	m.Set(lic, time.Now())
+	return nil
+}
+
+// Set records the active license, nil if there is none, as checked at now
+func (m *Monitor) Set(lic *License, now time.Time) {
+	m.mu.Lock()
+	m.license = lic
+	m.known = true
+	m.checkedAt = now
+	previous := m.lastMode
+	mode := m.policy.Evaluate(lic, now).Mode
+	m.lastMode = mode
+	m.mu.Unlock()
+
+	if mode != previous {
+		fields := map[string]interface{}{
+			"mode": string(mode),
+		}
+		if mode == ModeActive {
+			m.logger.Info("License mode changed", fields)
+		} else {
+			m.logger.Warn("License mode changed", fields)
+		}
+	}
+}
+
+// Status returns the license status at now
+func (m *Monitor) Status(now time.Time) Status {
+	if !m.Enabled() {
+		return Status{Mode: ModeUnenforced}
+	}
+
+	m.mu.RLock()
+	lic, known, checkedAt := m.license, m.known, m.checkedAt
+	m.mu.RUnlock()
+
+	// Nothing is enforced until the license service has answered once
+	if !known {
+		return Status{Mode: ModeUnenforced}
+	}
+
+	status := m.policy.Evaluate(lic, now)
+	status.CheckedAt = &checkedAt
+	return status
+}
+
+// Capabilities lists what the gateway allows under the current license
+type Capabilities struct {
+	License          Status   `json:"license"`
+	ReadOnly         bool     `json:"read_only"`
+	NewSessions      bool     `json:"new_sessions"`
+	NewUsers         bool     `json:"new_users"`
+	BlockedProtocols []string `json:"blocked_protocols"`
+	Banner           *Banner  `json:"banner,omitempty"`
+}
+
+// Capabilities returns what the gateway allows at now
+func (m *Monitor) Capabilities(now time.Time) Capabilities {
+	status := m.Status(now)
+	caps := Capabilities{
+		License:          status,
+		NewSessions:      true,
+		NewUsers:         true,
+		BlockedProtocols: []string{},
+		Banner:           status.Banner,
+	}
+
+	switch status.Mode {
+	case ModeGrace:
+		caps.NewUsers = false
+		caps.BlockedProtocols = m.premiumProtocols
+	case ModeReadOnly:
+		caps.ReadOnly = true
+		caps.NewSessions = false
+		caps.NewUsers = false
+	}
+	return caps
+}
+
+// AllowsNewUsers reports whether user accounts may be created at now
+func (m *Monitor) AllowsNewUsers(now time.Time) bool {
+	return m.Capabilities(now).NewUsers
+}
+
+// AllowsSession reports whether a new session over protocol may start at now
+func (m *Monitor) AllowsSession(protocol string, now time.Time) bool {
+	caps := m.Capabilities(now)
+	if !caps.NewSessions {
+		return false
+	}
+	for _, blocked := range caps.BlockedProtocols {
+		if strings.EqualFold(blocked, protocol) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,48 @@
+package middleware
+
+import (
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/VanCannon/openpam/gateway/internal/actor"
+	"github.com/VanCannon/openpam/pkg/recovery"
+	"github.com/google/uuid"
+)
+
+// Actor returns a middleware that adds the caller to the context for the
+// repositories to record as the creator or last editor of what they write. It
+// must run after RequireAuth or OptionalAuth, and after Elevate so the role
+// is the one the request is made under. Requests without a signed-in user
+// get an actor without a user ID.
+func Actor(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		a := &actor.Actor{
+			Role:      GetUserRole(ctx),
+			IP:        clientIP(r),
+			RequestID: recovery.RequestIDFromContext(ctx),
+		}
+		if id, err := uuid.Parse(GetUserID(ctx)); err == nil {
+			a.UserID = &id
+		}
+
+		next.ServeHTTP(w, r.WithContext(actor.WithActor(ctx, a)))
+	})
+}
+
+// clientIP returns the address the request came from: the first
+// X-Forwarded-For hop, X-Real-IP or the connection's address
+func clientIP(r *http.Request) string {
+	if xff := r.Header.Get("X-Forwarded-For"); xff != "" {
+		first, _, _ := strings.Cut(xff, ",")
+		return strings.TrimSpace(first)
+	}
+	if xri := r.Header.Get("X-Real-IP"); xri != "" {
+		return xri
+	}
+	if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		return host
+	}
+	return r.RemoteAddr
+}
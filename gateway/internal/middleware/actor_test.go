@@ -0,0 +1,41 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/VanCannon/openpam/gateway/internal/actor"
+	"github.com/VanCannon/openpam/gateway/internal/auth"
+	"github.com/VanCannon/openpam/gateway/internal/models"
+	"github.com/google/uuid"
+)
+
+func TestActor(t *testing.T) {
+	userID := uuid.New()
+	var got *actor.Actor
+	handler := Actor(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = actor.FromContext(r.Context())
+	}))
+
+	req := httptest.NewRequest("PUT", "/api/v1/targets/x", nil)
+	req.RemoteAddr = "192.0.2.10:53211"
+	req = req.WithContext(withClaims(req.Context(), &auth.Claims{UserID: userID.String(), Role: models.RoleAdmin}))
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+
+	if got == nil || got.UserID == nil || *got.UserID != userID || got.Role != models.RoleAdmin || got.IP != "192.0.2.10" {
+		t.Fatalf("actor = %+v", got)
+	}
+
+	// Without a signed-in user the actor has no user ID
+	req = httptest.NewRequest("POST", "/api/v1/approvals/token/approve", nil)
+	req.Header.Set("X-Forwarded-For", "198.51.100.7, 10.0.0.1")
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+
+	if got == nil || got.UserID != nil || got.IP != "198.51.100.7" {
+		t.Errorf("actor = %+v", got)
+	}
+	if actor.UserID(req.Context()) != nil {
+		t.Error("UserID outside a request should be nil")
+	}
+}
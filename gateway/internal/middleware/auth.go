@@ -6,7 +6,7 @@ import (
 	"strings"
 
 	"github.com/VanCannon/openpam/gateway/internal/auth"
-	"github.com/VanCannon/openpam/gateway/internal/logger"
+	"github.com/VanCannon/openpam/pkg/logger"
 )
 
 // contextKey is a custom type for context keys
@@ -17,28 +17,16 @@ const (
 	userEmailKey   contextKey = "user_email"
 	displayNameKey contextKey = "display_name"
 	roleKey        contextKey = "role"
+	apiKeyIDKey    contextKey = "api_key_id"
 )
 
-// RequireAuth returns a middleware that requires authentication
-func RequireAuth(tokenManager *auth.TokenManager, log *logger.Logger) func(http.Handler) http.Handler {
+// RequireAuth returns a middleware that requires authentication.
+// Bearer tokens starting with the API key prefix are validated by apiKeys when it is set,
+// and WebSocket reconnect tokens by reconnect, for the path they were issued for.
+func RequireAuth(tokenManager *auth.TokenManager, apiKeys *auth.APIKeyAuthenticator, reconnect *auth.ReconnectAuthenticator, log *logger.Logger) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			// Try to get token from cookie first
-			var token string
-			cookie, err := r.Cookie("openpam_token")
-			if err == nil && cookie.Value != "" {
-				token = cookie.Value
-			} else {
-				// Try Authorization header
-				authHeader := r.Header.Get("Authorization")
-				if authHeader != "" {
-					// Expect format: "Bearer <token>"
-					parts := strings.SplitN(authHeader, " ", 2)
-					if len(parts) == 2 && parts[0] == "Bearer" {
-						token = parts[1]
-					}
-				}
-			}
+			token := requestToken(r)
 
 			// If still no token, try query parameter (for WebSockets)
 			if token == "" {
@@ -53,8 +41,16 @@ func RequireAuth(tokenManager *auth.TokenManager, log *logger.Logger) func(http.
 				return
 			}
 
-			// Validate JWT token
-			claims, err := tokenManager.ValidateToken(token)
+			// Validate API key, reconnect token or JWT token
+			var claims *auth.Claims
+			var err error
+			if apiKeys != nil && auth.IsAPIKey(token) {
+				claims, err = apiKeys.Authenticate(r.Context(), token)
+			} else if reconnect != nil && auth.IsReconnectToken(token) {
+				claims, err = reconnect.Authenticate(r.Context(), token, r.URL.Path)
+			} else {
+				claims, err = tokenManager.ValidateToken(token)
+			}
 			if err != nil {
 				log.Warn("Invalid token", map[string]interface{}{
 					"path":  r.URL.Path,
@@ -64,19 +60,60 @@ func RequireAuth(tokenManager *auth.TokenManager, log *logger.Logger) func(http.
 				return
 			}
 
-			// Add user info to context
-			ctx := r.Context()
-			ctx = context.WithValue(ctx, userIDKey, claims.UserID)
-			ctx = context.WithValue(ctx, userEmailKey, claims.Email)
-			ctx = context.WithValue(ctx, displayNameKey, claims.DisplayName)
-			ctx = context.WithValue(ctx, roleKey, claims.Role)
-
 			// Continue with the request
-			next.ServeHTTP(w, r.WithContext(ctx))
+			next.ServeHTTP(w, r.WithContext(withClaims(r.Context(), claims)))
+		})
+	}
+}
+
+// OptionalAuth returns a middleware that adds the signed-in user to the
+// context when the request carries a valid session token, and passes the
+// request on unchanged otherwise. API keys are not accepted.
+func OptionalAuth(tokenManager *auth.TokenManager) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if token := requestToken(r); token != "" && !auth.IsAPIKey(token) && !auth.IsReconnectToken(token) {
+				if claims, err := tokenManager.ValidateToken(token); err == nil {
+					r = r.WithContext(withClaims(r.Context(), claims))
+				}
+			}
+			next.ServeHTTP(w, r)
 		})
 	}
 }
 
+// requestToken returns the session token from the cookie or the Authorization header
+func requestToken(r *http.Request) string {
+	// Try to get token from cookie first
+	cookie, err := r.Cookie("openpam_token")
+	if err == nil && cookie.Value != "" {
+		return cookie.Value
+	}
+
+	// Try Authorization header
+	authHeader := r.Header.Get("Authorization")
+	if authHeader != "" {
+		// Expect format: "Bearer <token>"
+		parts := strings.SplitN(authHeader, " ", 2)
+		if len(parts) == 2 && parts[0] == "Bearer" {
+			return parts[1]
+		}
+	}
+	return ""
+}
+
+// withClaims adds the authenticated user's details to ctx
+func withClaims(ctx context.Context, claims *auth.Claims) context.Context {
+	ctx = context.WithValue(ctx, userIDKey, claims.UserID)
+	ctx = context.WithValue(ctx, userEmailKey, claims.Email)
+	ctx = context.WithValue(ctx, displayNameKey, claims.DisplayName)
+	ctx = context.WithValue(ctx, roleKey, claims.Role)
+	if claims.APIKeyID != "" {
+		ctx = context.WithValue(ctx, apiKeyIDKey, claims.APIKeyID)
+	}
+	return ctx
+}
+
 // GetUserID retrieves the user ID from the request context
 func GetUserID(ctx context.Context) string {
 	if userID, ok := ctx.Value(userIDKey).(string); ok {
@@ -101,6 +138,14 @@ func GetDisplayName(ctx context.Context) string {
 	return ""
 }
 
+// GetAPIKeyID returns the ID of the API key used to authenticate, or "" for user sessions
+func GetAPIKeyID(ctx context.Context) string {
+	if id, ok := ctx.Value(apiKeyIDKey).(string); ok {
+		return id
+	}
+	return ""
+}
+
 // GetUserRole retrieves the user role from the request context
 func GetUserRole(ctx context.Context) string {
 	if role, ok := ctx.Value(roleKey).(string); ok {
@@ -130,7 +175,8 @@ func CORS(allowedOrigins []string) func(http.Handler) http.Handler {
 			}
 
 			w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
-			w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, Cache-Control")
+			w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, Cache-Control, Idempotency-Key, If-Match, Last-Event-ID, X-OpenPAM-Redact")
+			w.Header().Set("Access-Control-Expose-Headers", "ETag, Idempotent-Replayed, JWS-Signature, X-OpenPAM-Redacted")
 			w.Header().Set("Access-Control-Allow-Credentials", "true")
 
 			// Handle preflight requests
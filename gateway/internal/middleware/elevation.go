@@ -0,0 +1,78 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/VanCannon/openpam/gateway/internal/elevation"
+	"github.com/VanCannon/openpam/gateway/internal/models"
+	"github.com/VanCannon/openpam/pkg/logger"
+	"github.com/google/uuid"
+)
+
+const (
+	baseRoleKey  contextKey = "base_role"
+	elevationKey contextKey = "elevation"
+)
+
+// ElevationLookup finds the role elevation a user currently holds
+type ElevationLookup interface {
+	GetActive(ctx context.Context, userID uuid.UUID, now time.Time) (*models.RoleElevation, error)
+}
+
+// Elevate returns a middleware that applies the authenticated user's active
+// role elevation: the elevated role replaces the user's own for the request,
+// and the elevation is added to the context so audit events recorded while
+// handling it are tagged. It must run after RequireAuth. API keys are never
+// elevated, and admins have nothing to elevate to.
+func Elevate(lookup ElevationLookup, log *logger.Logger) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx := r.Context()
+			role := GetUserRole(ctx)
+			if lookup == nil || GetAPIKeyID(ctx) != "" || role == models.RoleAdmin {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			userID, err := uuid.Parse(GetUserID(ctx))
+			if err != nil {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			el, err := lookup.GetActive(ctx, userID, time.Now())
+			if err != nil {
+				// Fail closed: the user keeps their own role
+				log.Error("Failed to look up role elevation", map[string]interface{}{
+					"user_id": userID.String(),
+					"error":   err.Error(),
+				})
+			}
+			if el != nil {
+				ctx = context.WithValue(ctx, baseRoleKey, role)
+				ctx = context.WithValue(ctx, roleKey, el.Role)
+				ctx = context.WithValue(ctx, elevationKey, el)
+				ctx = elevation.WithID(ctx, el.ID)
+				r = r.WithContext(ctx)
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// GetBaseRole returns the user's own role, before any elevation
+func GetBaseRole(ctx context.Context) string {
+	if role, ok := ctx.Value(baseRoleKey).(string); ok {
+		return role
+	}
+	return GetUserRole(ctx)
+}
+
+// GetElevation returns the role elevation the request is made under, or nil
+func GetElevation(ctx context.Context) *models.RoleElevation {
+	el, _ := ctx.Value(elevationKey).(*models.RoleElevation)
+	return el
+}
@@ -0,0 +1,65 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/VanCannon/openpam/gateway/internal/auth"
+	"github.com/VanCannon/openpam/gateway/internal/elevation"
+	"github.com/VanCannon/openpam/gateway/internal/models"
+	"github.com/VanCannon/openpam/pkg/logger"
+	"github.com/google/uuid"
+)
+
+type fakeElevations map[uuid.UUID]*models.RoleElevation
+
+func (f fakeElevations) GetActive(ctx context.Context, userID uuid.UUID, now time.Time) (*models.RoleElevation, error) {
+	return f[userID], nil
+}
+
+func TestElevate(t *testing.T) {
+	elevated, plain := uuid.New(), uuid.New()
+	el := &models.RoleElevation{ID: uuid.New(), UserID: elevated, Role: models.RoleAdmin}
+	lookup := fakeElevations{elevated: el}
+
+	tests := []struct {
+		name      string
+		claims    auth.Claims
+		wantRole  string
+		wantTagID bool
+	}{
+		{"elevated user", auth.Claims{UserID: elevated.String(), Role: models.RoleUser}, models.RoleAdmin, true},
+		{"user without elevation", auth.Claims{UserID: plain.String(), Role: models.RoleUser}, models.RoleUser, false},
+		{"API key", auth.Claims{UserID: elevated.String(), Role: models.RoleUser, APIKeyID: "key"}, models.RoleUser, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var role, baseRole string
+			var tag uuid.NullUUID
+			handler := Elevate(lookup, logger.Default())(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				role = GetUserRole(r.Context())
+				baseRole = GetBaseRole(r.Context())
+				tag = elevation.IDFromContext(r.Context())
+			}))
+
+			claims := tt.claims
+			req := httptest.NewRequest("GET", "/", nil)
+			req = req.WithContext(withClaims(req.Context(), &claims))
+			handler.ServeHTTP(httptest.NewRecorder(), req)
+
+			if role != tt.wantRole {
+				t.Errorf("role = %q, want %q", role, tt.wantRole)
+			}
+			if baseRole != tt.claims.Role {
+				t.Errorf("base role = %q, want %q", baseRole, tt.claims.Role)
+			}
+			if tag.Valid != tt.wantTagID || (tag.Valid && tag.UUID != el.ID) {
+				t.Errorf("elevation tag = %v", tag)
+			}
+		})
+	}
+}
@@ -4,7 +4,8 @@ import (
 	"net/http"
 	"time"
 
-	"github.com/VanCannon/openpam/gateway/internal/logger"
+	"github.com/VanCannon/openpam/pkg/logger"
+	"github.com/VanCannon/openpam/pkg/recovery"
 )
 
 // responseWriter wraps http.ResponseWriter to capture status code
@@ -50,26 +51,8 @@ func Logging(log *logger.Logger) func(http.Handler) http.Handler {
 				"bytes":      rw.written,
 				"remote_ip":  r.RemoteAddr,
 				"user_agent": r.UserAgent(),
+				"request_id": recovery.RequestIDFromContext(r.Context()),
 			})
 		})
 	}
 }
-
-// Recovery returns a middleware that recovers from panics
-func Recovery(log *logger.Logger) func(http.Handler) http.Handler {
-	return func(next http.Handler) http.Handler {
-		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			defer func() {
-				if err := recover(); err != nil {
-					log.Error("Panic recovered", map[string]interface{}{
-						"error": err,
-						"path":  r.URL.Path,
-					})
-					http.Error(w, "Internal Server Error", http.StatusInternalServerError)
-				}
-			}()
-
-			next.ServeHTTP(w, r)
-		})
-	}
-}
@@ -0,0 +1,47 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/VanCannon/openpam/gateway/internal/actor"
+	"github.com/VanCannon/openpam/gateway/internal/models"
+	"github.com/VanCannon/openpam/pkg/logger"
+	"github.com/google/uuid"
+)
+
+// ZoneAdminLookup finds the zones a user is an admin of
+type ZoneAdminLookup interface {
+	ZonesOf(ctx context.Context, userID uuid.UUID) ([]uuid.UUID, error)
+}
+
+// ZoneScope returns a middleware that limits the changes a non-admin makes
+// to the targets, credentials and schedules of the zones they are an admin
+// of, none for most users. It must run after Actor. Admins, including users
+// elevated to admin, are not limited.
+func ZoneScope(lookup ZoneAdminLookup, log *logger.Logger) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			a := actor.FromContext(r.Context())
+			if a == nil || a.Role == models.RoleAdmin {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			a.ZoneScoped = true
+			if lookup != nil && a.UserID != nil && GetAPIKeyID(r.Context()) == "" {
+				zones, err := lookup.ZonesOf(r.Context(), *a.UserID)
+				if err != nil {
+					// Fail closed: the user administers no zone for this request
+					log.Error("Failed to look up zone admin assignments", map[string]interface{}{
+						"user_id": a.UserID.String(),
+						"error":   err.Error(),
+					})
+				}
+				a.Zones = zones
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
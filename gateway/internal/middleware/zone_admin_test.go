@@ -0,0 +1,81 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/VanCannon/openpam/gateway/internal/actor"
+	"github.com/VanCannon/openpam/gateway/internal/auth"
+	"github.com/VanCannon/openpam/gateway/internal/models"
+	"github.com/VanCannon/openpam/pkg/logger"
+	"github.com/google/uuid"
+)
+
+type fakeZoneAdmins map[uuid.UUID][]uuid.UUID
+
+func (f fakeZoneAdmins) ZonesOf(ctx context.Context, userID uuid.UUID) ([]uuid.UUID, error) {
+	if zones, ok := f[userID]; ok {
+		return zones, nil
+	}
+	return nil, errors.New("lookup failed")
+}
+
+func TestZoneScope(t *testing.T) {
+	zoneAdmin, plain, broken := uuid.New(), uuid.New(), uuid.New()
+	zone, other := uuid.New(), uuid.New()
+	lookup := fakeZoneAdmins{zoneAdmin: {zone}, plain: nil}
+
+	tests := []struct {
+		name       string
+		claims     auth.Claims
+		wantScoped bool
+		manages    []uuid.UUID
+		notManages []uuid.UUID
+	}{
+		{"admin", auth.Claims{UserID: plain.String(), Role: models.RoleAdmin}, false, []uuid.UUID{zone, other}, nil},
+		{"zone admin", auth.Claims{UserID: zoneAdmin.String(), Role: models.RoleUser}, true, []uuid.UUID{zone}, []uuid.UUID{other}},
+		{"user", auth.Claims{UserID: plain.String(), Role: models.RoleUser}, true, nil, []uuid.UUID{zone}},
+		{"failed lookup", auth.Claims{UserID: broken.String(), Role: models.RoleUser}, true, nil, []uuid.UUID{zone}},
+		{"API key of a zone admin", auth.Claims{UserID: zoneAdmin.String(), Role: models.RoleUser, APIKeyID: "key"}, true, nil, []uuid.UUID{zone}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var scoped bool
+			manages := map[uuid.UUID]bool{}
+			handler := Actor(ZoneScope(lookup, logger.Default())(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				_, scoped = actor.ZoneScope(r.Context())
+				for _, z := range []uuid.UUID{zone, other} {
+					manages[z] = actor.ManagesZone(r.Context(), z)
+				}
+			})))
+
+			claims := tt.claims
+			req := httptest.NewRequest("GET", "/", nil)
+			req = req.WithContext(withClaims(req.Context(), &claims))
+			handler.ServeHTTP(httptest.NewRecorder(), req)
+
+			if scoped != tt.wantScoped {
+				t.Errorf("scoped = %v, want %v", scoped, tt.wantScoped)
+			}
+			for _, z := range tt.manages {
+				if !manages[z] {
+					t.Errorf("doesn't manage zone %s", z)
+				}
+			}
+			for _, z := range tt.notManages {
+				if manages[z] {
+					t.Errorf("manages zone %s", z)
+				}
+			}
+		})
+	}
+
+	// Without the middleware nothing is limited, e.g. for approval links
+	if !actor.ManagesZone(actor.WithActor(context.Background(), &actor.Actor{Role: models.RoleUser}), zone) {
+		t.Error("unscoped actor doesn't manage zone")
+	}
+}
@@ -0,0 +1,82 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Analytics views, refreshed by the analytics refresher
+const (
+	AnalyticsViewSessionHours = "analytics_session_hours"
+	AnalyticsViewApprovalDays = "analytics_approval_days"
+)
+
+// AnalyticsViews are the materialized views of the analytics, in the order
+// they are refreshed
+var AnalyticsViews = []string{AnalyticsViewSessionHours, AnalyticsViewApprovalDays}
+
+// AnalyticsRefresh is when an analytics view was last refreshed
+type AnalyticsRefresh struct {
+	View        string    `json:"view" db:"view_name"`
+	RefreshedAt time.Time `json:"refreshed_at" db:"refreshed_at"`
+	DurationMS  int       `json:"duration_ms" db:"duration_ms"`
+}
+
+// UsageHour is the session use of a UTC hour
+type UsageHour struct {
+	Hour     time.Time `json:"hour" db:"hour"`
+	Sessions int       `json:"sessions" db:"sessions"` // Sessions that started in the hour
+	Seconds  int64     `json:"seconds" db:"seconds"`   // Session time in the hour, summed over concurrent sessions
+}
+
+// GroupUsageHour is the session use of a group's members in a UTC hour
+type GroupUsageHour struct {
+	GroupID string `db:"group_id"`
+	UsageHour
+}
+
+// TargetUsage is the session use of a target over a period
+type TargetUsage struct {
+	TargetID   uuid.UUID `json:"target_id" db:"target_id"`
+	TargetName string    `json:"target_name" db:"target_name"`
+	ZoneID     uuid.UUID `json:"zone_id" db:"zone_id"`
+	Sessions   int       `json:"sessions" db:"sessions"`
+	Seconds    int64     `json:"seconds" db:"seconds"`
+	Users      int       `json:"users" db:"users"`
+
+	// Session time over the length of the period; above 1 when sessions overlap
+	Utilization float64 `json:"utilization" db:"-"`
+}
+
+// GroupUsage is the session use of a group's members over a period
+type GroupUsage struct {
+	GroupID   string `json:"group_id" db:"group_id"`
+	GroupName string `json:"group_name" db:"group_name"`
+	Members   int    `json:"members" db:"members"`
+	Users     int    `json:"users" db:"users"` // Members who had sessions
+	Targets   int    `json:"targets" db:"targets"`
+	Sessions  int    `json:"sessions" db:"sessions"`
+	Seconds   int64  `json:"seconds" db:"seconds"`
+}
+
+// ApprovalTurnaround is how long decisions on access requests to a zone's
+// targets took over a period
+type ApprovalTurnaround struct {
+	ZoneID         uuid.UUID `json:"zone_id" db:"zone_id"`
+	ZoneName       string    `json:"zone_name" db:"zone_name"`
+	Approved       int       `json:"approved" db:"approved"`
+	Rejected       int       `json:"rejected" db:"rejected"`
+	AverageSeconds int64     `json:"average_seconds" db:"average_seconds"`
+	MaxSeconds     int64     `json:"max_seconds" db:"max_seconds"`
+	Within15m      int       `json:"within_15m" db:"within_15m"`
+	Within1h       int       `json:"within_1h" db:"within_1h"`
+	Within4h       int       `json:"within_4h" db:"within_4h"`
+	Within1d       int       `json:"within_1d" db:"within_1d"`
+}
+
+// PendingRequests are the access requests awaiting a decision
+type PendingRequests struct {
+	Count  int        `json:"count" db:"count"`
+	Oldest *time.Time `json:"oldest,omitempty" db:"oldest"` // When the longest-waiting request was made
+}
@@ -0,0 +1,28 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// SessionAnnotation is an auditor's note or bookmark at a point in a recorded
+// session
+type SessionAnnotation struct {
+	ID          uuid.UUID  `json:"id" db:"id"`
+	AuditLogID  uuid.UUID  `json:"audit_log_id" db:"audit_log_id"`
+	AuthorID    *uuid.UUID `json:"author_id,omitempty" db:"author_id"`
+	AuthorEmail *string    `json:"author_email,omitempty" db:"author_email"`
+	Kind        string     `json:"kind" db:"kind"`
+	OffsetMs    int64      `json:"offset_ms" db:"offset_ms"` // Milliseconds from the start of the recording
+	Label       *string    `json:"label,omitempty" db:"label"`
+	Note        *string    `json:"note,omitempty" db:"note"`
+	CreatedAt   time.Time  `json:"created_at" db:"created_at"`
+	UpdatedAt   time.Time  `json:"updated_at" db:"updated_at"`
+}
+
+// Annotation kinds
+const (
+	AnnotationKindAnnotation = "annotation" // A note on what happened at this point
+	AnnotationKindBookmark   = "bookmark"   // A named position to jump to
+)
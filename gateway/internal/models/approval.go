@@ -0,0 +1,35 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// ApprovalAction is a single-use link that lets one approver decide a schedule
+// request from a notification, without signing in first
+type ApprovalAction struct {
+	ID         uuid.UUID  `json:"id" db:"id"`
+	ScheduleID uuid.UUID  `json:"schedule_id" db:"schedule_id"`
+	ApproverID uuid.UUID  `json:"approver_id" db:"approver_id"`
+	Channel    string     `json:"channel" db:"channel"`
+	ExpiresAt  time.Time  `json:"expires_at" db:"expires_at"`
+	UsedAt     *time.Time `json:"used_at,omitempty" db:"used_at"`
+	Decision   *string    `json:"decision,omitempty" db:"decision"`
+	CreatedAt  time.Time  `json:"created_at" db:"created_at"`
+}
+
+// Channels through which a schedule request is decided
+const (
+	ApprovalChannelWeb   = "web"
+	ApprovalChannelEmail = "email"
+	ApprovalChannelSlack = "slack"
+	ApprovalChannelAuto  = "auto" // Requests of auto-approved risk tiers
+)
+
+// System audit event types for schedule decisions. The details record the
+// channel the decision was made through.
+const (
+	EventTypeScheduleApproved = "schedule_approved"
+	EventTypeScheduleRejected = "schedule_rejected"
+)
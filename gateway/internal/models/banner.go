@@ -0,0 +1,34 @@
+package models
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// MaxBannerLength is the longest banner a zone or target may show
+const MaxBannerLength = 10000
+
+// BannerAcknowledgmentTTL is how long an acknowledgment lets its user open
+// sessions on the target, so a banner is accepted again for every new
+// connection rather than once
+const BannerAcknowledgmentTTL = 10 * time.Minute
+
+// BannerAcknowledgment records a user accepting a target's banner before connecting
+type BannerAcknowledgment struct {
+	ID             uuid.UUID `json:"id" db:"id"`
+	UserID         uuid.UUID `json:"user_id" db:"user_id"`
+	TargetID       uuid.UUID `json:"target_id" db:"target_id"`
+	BannerVersion  string    `json:"banner_version" db:"banner_version"`
+	ClientIP       *string   `json:"client_ip,omitempty" db:"client_ip"`
+	AcknowledgedAt time.Time `json:"acknowledged_at" db:"acknowledged_at"`
+}
+
+// BannerVersion identifies a banner text, so an acknowledgment only counts
+// for the text the user was shown
+func BannerVersion(text string) string {
+	sum := sha256.Sum256([]byte(text))
+	return hex.EncodeToString(sum[:8])
+}
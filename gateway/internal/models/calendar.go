@@ -0,0 +1,17 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// CalendarFeed is a user's iCalendar feed of their upcoming access windows,
+// subscribed to from a calendar app by a signed URL
+type CalendarFeed struct {
+	UserID         uuid.UUID  `json:"user_id" db:"user_id"`
+	FeedID         uuid.UUID  `json:"-" db:"feed_id"`                       // Named by the URL's token; replaced to revoke it
+	IncludePending bool       `json:"include_pending" db:"include_pending"` // Also requests awaiting approval, including those the user can decide
+	CreatedAt      time.Time  `json:"created_at" db:"created_at"`
+	LastFetchedAt  *time.Time `json:"last_fetched_at,omitempty" db:"last_fetched_at"`
+}
@@ -0,0 +1,119 @@
+package models
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+)
+
+// CertificationCampaign is a periodic review of the entitlements in its scope.
+// Reviewers certify or revoke each item; revocations are applied immediately.
+type CertificationCampaign struct {
+	ID              uuid.UUID          `json:"id" db:"id"`
+	Name            string             `json:"name" db:"name"`
+	Description     *string            `json:"description,omitempty" db:"description"`
+	Status          string             `json:"status" db:"status"`
+	Scope           CertificationScope `json:"scope" db:"scope"`
+	ReviewerIDs     pq.StringArray     `json:"reviewer_ids" db:"reviewer_ids"`
+	RevokeUndecided bool               `json:"revoke_undecided" db:"revoke_undecided"`
+	DueAt           time.Time          `json:"due_at" db:"due_at"`
+	CreatedBy       *uuid.UUID         `json:"created_by,omitempty" db:"created_by"`
+	CreatedAt       time.Time          `json:"created_at" db:"created_at"`
+	CompletedAt     *time.Time         `json:"completed_at,omitempty" db:"completed_at"`
+}
+
+// CertificationScope selects the entitlements a campaign reviews. Empty fields
+// don't restrict the scope.
+type CertificationScope struct {
+	EntitlementTypes []string    `json:"entitlement_types,omitempty"`
+	UserIDs          []uuid.UUID `json:"user_ids,omitempty"`
+	Roles            []string    `json:"roles,omitempty"`
+	ZoneIDs          []uuid.UUID `json:"zone_ids,omitempty"`   // Rules and schedules for targets in these zones
+	TargetIDs        []uuid.UUID `json:"target_ids,omitempty"` // Rules and schedules for these targets
+}
+
+// Value implements the driver.Valuer interface
+func (s CertificationScope) Value() (driver.Value, error) {
+	return json.Marshal(s)
+}
+
+// Scan implements the sql.Scanner interface
+func (s *CertificationScope) Scan(value interface{}) error {
+	b, ok := value.([]byte)
+	if !ok {
+		return errors.New("type assertion to []byte failed")
+	}
+	return json.Unmarshal(b, s)
+}
+
+// IncludesType reports whether the scope covers the entitlement type
+func (s *CertificationScope) IncludesType(entitlementType string) bool {
+	if len(s.EntitlementTypes) == 0 {
+		return true
+	}
+	for _, t := range s.EntitlementTypes {
+		if t == entitlementType {
+			return true
+		}
+	}
+	return false
+}
+
+// CertificationItem is one entitlement of one user awaiting a decision
+type CertificationItem struct {
+	ID                     uuid.UUID  `json:"id" db:"id"`
+	CampaignID             uuid.UUID  `json:"campaign_id" db:"campaign_id"`
+	UserID                 uuid.UUID  `json:"user_id" db:"user_id"`
+	UserEmail              string     `json:"user_email" db:"user_email"`
+	EntitlementType        string     `json:"entitlement_type" db:"entitlement_type"`
+	EntitlementID          *uuid.UUID `json:"entitlement_id,omitempty" db:"entitlement_id"`
+	EntitlementDescription string     `json:"entitlement_description" db:"entitlement_description"`
+	ReviewerID             *uuid.UUID `json:"reviewer_id,omitempty" db:"reviewer_id"`
+	Decision               string     `json:"decision" db:"decision"`
+	Comment                *string    `json:"comment,omitempty" db:"comment"`
+	DecidedBy              *uuid.UUID `json:"decided_by,omitempty" db:"decided_by"`
+	DecidedAt              *time.Time `json:"decided_at,omitempty" db:"decided_at"`
+	ExecutedAt             *time.Time `json:"executed_at,omitempty" db:"executed_at"`
+	CreatedAt              time.Time  `json:"created_at" db:"created_at"`
+}
+
+// CertificationProgress counts a campaign's items by decision
+type CertificationProgress struct {
+	Total       int `json:"total" db:"total"`
+	Pending     int `json:"pending" db:"pending"`
+	Certified   int `json:"certified" db:"certified"`
+	Revoked     int `json:"revoked" db:"revoked"`
+	NotReviewed int `json:"not_reviewed" db:"not_reviewed"`
+}
+
+// Campaign status constants
+const (
+	CampaignStatusActive    = "active"
+	CampaignStatusCompleted = "completed"
+)
+
+// Entitlement types reviewed by certification campaigns
+const (
+	EntitlementTypeRole           = "role"            // A privileged role (admin or auditor)
+	EntitlementTypeCredentialRule = "credential_rule" // An allow rule granted to the user
+	EntitlementTypeSchedule       = "schedule"        // An approved access window
+)
+
+// Certification decision constants
+const (
+	CertificationPending     = "pending"
+	CertificationCertified   = "certified"
+	CertificationRevoked     = "revoked"
+	CertificationNotReviewed = "not_reviewed"
+)
+
+// System audit event types for certifications
+const (
+	EventTypeCertificationLaunched  = "certification_launched"
+	EventTypeCertificationCompleted = "certification_completed"
+	EventTypeEntitlementRevoked     = "entitlement_revoked"
+)
@@ -0,0 +1,97 @@
+package models
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// ChangeSet is an admin change held under dual control. The request that
+// would have made it is staged with a diff against the current state, and is
+// replayed as the approving admin once someone other than the requester
+// approves it.
+type ChangeSet struct {
+	ID              uuid.UUID       `json:"id" db:"id"`
+	Category        string          `json:"category" db:"category"`
+	Kind            string          `json:"kind" db:"kind"`
+	Method          string          `json:"method" db:"method"`
+	Path            string          `json:"path" db:"path"`
+	Body            json.RawMessage `json:"body,omitempty" db:"body"`
+	IfMatch         *string         `json:"if_match,omitempty" db:"if_match"`
+	Before          json.RawMessage `json:"before,omitempty" db:"before"`
+	Diff            ChangeDiff      `json:"diff" db:"diff"`
+	Status          string          `json:"status" db:"status"`
+	RequestedBy     *uuid.UUID      `json:"requested_by,omitempty" db:"requested_by"`
+	RequestedEmail  string          `json:"requested_by_email,omitempty" db:"requested_email"`
+	DecidedBy       *uuid.UUID      `json:"decided_by,omitempty" db:"decided_by"`
+	DecidedAt       *time.Time      `json:"decided_at,omitempty" db:"decided_at"`
+	RejectionReason *string         `json:"rejection_reason,omitempty" db:"rejection_reason"`
+	Error           *string         `json:"error,omitempty" db:"error"`
+	CreatedAt       time.Time       `json:"created_at" db:"created_at"`
+}
+
+// FieldChange is the old and proposed value of one field of a change set
+type FieldChange struct {
+	From interface{} `json:"from"`
+	To   interface{} `json:"to"`
+}
+
+// ChangeDiff maps the fields a change set touches to their change
+type ChangeDiff map[string]FieldChange
+
+// Value implements the driver.Valuer interface
+func (d ChangeDiff) Value() (driver.Value, error) {
+	if d == nil {
+		return []byte("{}"), nil
+	}
+	return json.Marshal(d)
+}
+
+// Scan implements the sql.Scanner interface
+func (d *ChangeDiff) Scan(value interface{}) error {
+	b, ok := value.([]byte)
+	if !ok {
+		return errors.New("type assertion to []byte failed")
+	}
+	return json.Unmarshal(b, d)
+}
+
+// Categories of changes that can be put under dual control
+const (
+	ChangeCategoryCredentials     = "credentials"
+	ChangeCategoryCredentialRules = "credential_rules"
+	ChangeCategoryUserRoles       = "user_roles"
+)
+
+// Kinds of changes held in change sets
+const (
+	ChangeKindCredentialCreate     = "credential_create"
+	ChangeKindCredentialUpdate     = "credential_update"
+	ChangeKindCredentialDelete     = "credential_delete"
+	ChangeKindCredentialRuleCreate = "credential_rule_create"
+	ChangeKindCredentialRuleUpdate = "credential_rule_update"
+	ChangeKindCredentialRuleDelete = "credential_rule_delete"
+	ChangeKindPolicyPublish        = "policy_draft_publish"
+	ChangeKindUserRole             = "user_role"
+)
+
+// Change set statuses. An approved change set is being applied, and ends up
+// applied or failed.
+const (
+	ChangeSetStatusPending  = "pending"
+	ChangeSetStatusApproved = "approved"
+	ChangeSetStatusApplied  = "applied"
+	ChangeSetStatusRejected = "rejected"
+	ChangeSetStatusFailed   = "failed"
+)
+
+// System audit event types for change sets
+const (
+	EventTypeChangeSetStaged   = "change_set_staged"
+	EventTypeChangeSetApplied  = "change_set_applied"
+	EventTypeChangeSetRejected = "change_set_rejected"
+	EventTypeChangeSetFailed   = "change_set_failed"
+)
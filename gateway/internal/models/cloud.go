@@ -0,0 +1,40 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// CloudSession records a cloud console session the gateway brokered: the AWS
+// role it assumed or the Azure role it activated on behalf of a user. On cloud
+// targets a credential names the role (an IAM role ARN, or an Azure role
+// definition ID with an optional "@scope") and its Vault secret holds the
+// broker identity used to grant it.
+type CloudSession struct {
+	ID            uuid.UUID  `json:"id" db:"id"`
+	TargetID      *uuid.UUID `json:"target_id,omitempty" db:"target_id"`
+	TargetName    *string    `json:"target_name,omitempty" db:"target_name"`
+	CredentialID  *uuid.UUID `json:"credential_id,omitempty" db:"credential_id"`
+	UserID        *uuid.UUID `json:"user_id,omitempty" db:"user_id"`
+	UserEmail     *string    `json:"user_email,omitempty" db:"user_email"`
+	Provider      string     `json:"provider" db:"provider"`
+	Role          string     `json:"role" db:"role"`
+	SessionName   string     `json:"session_name" db:"session_name"`
+	ExternalID    *string    `json:"external_id,omitempty" db:"external_id"`
+	Justification *string    `json:"justification,omitempty" db:"justification"`
+	Status        string     `json:"status" db:"status"`
+	Error         *string    `json:"error,omitempty" db:"error"`
+	ClientIP      *string    `json:"client_ip,omitempty" db:"client_ip"`
+	StartedAt     time.Time  `json:"started_at" db:"started_at"`
+	ExpiresAt     *time.Time `json:"expires_at,omitempty" db:"expires_at"`
+}
+
+// Cloud session status constants
+const (
+	CloudSessionGranted = "granted"
+	CloudSessionFailed  = "failed"
+)
+
+// EventTypeCloudSession is the system audit event for brokered cloud sessions
+const EventTypeCloudSession = "cloud_session_started"
@@ -0,0 +1,100 @@
+package models
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+)
+
+// DiscoveryScan is one enumeration of a target's local accounts
+type DiscoveryScan struct {
+	ID                  uuid.UUID      `json:"id" db:"id"`
+	TargetID            uuid.UUID      `json:"target_id" db:"target_id"`
+	CredentialID        *uuid.UUID     `json:"credential_id,omitempty" db:"credential_id"`
+	Status              string         `json:"status" db:"status"`
+	StartedBy           *uuid.UUID     `json:"started_by,omitempty" db:"started_by"` // Nil for scheduled scans
+	AccountsFound       int            `json:"accounts_found" db:"accounts_found"`
+	UnmanagedPrivileged int            `json:"unmanaged_privileged" db:"unmanaged_privileged"`
+	Warnings            pq.StringArray `json:"warnings" db:"warnings"` // What the scan couldn't read, e.g. sudoers without sudo
+	Error               *string        `json:"error,omitempty" db:"error"`
+	StartedAt           time.Time      `json:"started_at" db:"started_at"`
+	FinishedAt          *time.Time     `json:"finished_at,omitempty" db:"finished_at"`
+}
+
+// Discovery scan status constants
+const (
+	DiscoveryScanRunning   = "running"
+	DiscoveryScanSucceeded = "succeeded"
+	DiscoveryScanFailed    = "failed"
+)
+
+// DiscoveredAccount is a local account found on a target. It is managed once a
+// credential for it exists on the target, and privileged if it can act as an
+// administrator: root or UID 0, sudo rights or an admin group on Linux, and
+// membership of an administrative group on Windows.
+type DiscoveredAccount struct {
+	ID               uuid.UUID      `json:"id" db:"id"`
+	TargetID         uuid.UUID      `json:"target_id" db:"target_id"`
+	TargetName       string         `json:"target_name,omitempty" db:"target_name"`
+	Username         string         `json:"username" db:"username"`
+	UID              string         `json:"uid" db:"uid"` // Numeric UID on Linux, SID on Windows
+	Home             string         `json:"home,omitempty" db:"home"`
+	Shell            string         `json:"shell,omitempty" db:"shell"`
+	Groups           pq.StringArray `json:"groups" db:"groups"`
+	Privileged       bool           `json:"privileged" db:"privileged"`
+	PrivilegeReasons pq.StringArray `json:"privilege_reasons" db:"privilege_reasons"`
+	SudoRules        pq.StringArray `json:"sudo_rules" db:"sudo_rules"`
+	AuthorizedKeys   AuthorizedKeys `json:"authorized_keys" db:"authorized_keys"`
+	LoginEnabled     bool           `json:"login_enabled" db:"login_enabled"`
+	SystemAccount    bool           `json:"system_account" db:"system_account"`
+	LastLogon        *time.Time     `json:"last_logon,omitempty" db:"last_logon"`
+	CredentialID     *uuid.UUID     `json:"credential_id,omitempty" db:"credential_id"`
+	Managed          bool           `json:"managed" db:"managed"`
+	RotatedAt        *time.Time     `json:"rotated_at,omitempty" db:"rotated_at"` // Last password change, for onboarded accounts
+	FirstSeenAt      time.Time      `json:"first_seen_at" db:"first_seen_at"`
+	LastSeenAt       time.Time      `json:"last_seen_at" db:"last_seen_at"`
+	RemovedAt        *time.Time     `json:"removed_at,omitempty" db:"removed_at"` // Set when a later scan no longer found it
+}
+
+// AuthorizedKey is a public key an account accepts for SSH logins
+type AuthorizedKey struct {
+	Type        string `json:"type"`
+	Key         string `json:"key"`         // Type and base64 key, as in authorized_keys
+	Fingerprint string `json:"fingerprint"` // SHA256, as printed by ssh-keygen -l
+	Comment     string `json:"comment,omitempty"`
+	Options     string `json:"options,omitempty"` // e.g. from="10.0.0.0/8",no-pty
+}
+
+// AuthorizedKeys is the JSONB list of an account's authorized keys
+type AuthorizedKeys []AuthorizedKey
+
+// Value implements the driver.Valuer interface
+func (k AuthorizedKeys) Value() (driver.Value, error) {
+	if k == nil {
+		return []byte("[]"), nil
+	}
+	return json.Marshal(k)
+}
+
+// Scan implements the sql.Scanner interface
+func (k *AuthorizedKeys) Scan(value interface{}) error {
+	b, ok := value.([]byte)
+	if !ok {
+		return errors.New("type assertion to []byte failed")
+	}
+	return json.Unmarshal(b, k)
+}
+
+// CredentialTagDiscovered tags the credentials created by onboarding discovered accounts
+const CredentialTagDiscovered = "discovered"
+
+// System audit event types for account discovery
+const (
+	EventTypeDiscoveryScan    = "discovery_scan"
+	EventTypeAccountOnboarded = "discovered_account_onboarded"
+	EventTypeAccountRotated   = "discovered_account_rotated"
+)
@@ -0,0 +1,46 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// RoleElevation is a user's request to hold a higher role for a limited time.
+// Once approved the user acts with Role until ExpiresAt, and every system audit
+// event they cause meanwhile carries the elevation's ID.
+type RoleElevation struct {
+	ID              uuid.UUID  `json:"id" db:"id"`
+	UserID          uuid.UUID  `json:"user_id" db:"user_id"`
+	UserEmail       string     `json:"user_email,omitempty" db:"user_email"`
+	Role            string     `json:"role" db:"role"`
+	Justification   string     `json:"justification" db:"justification"`
+	DurationHours   int        `json:"duration_hours" db:"duration_hours"`
+	Status          string     `json:"status" db:"status"`
+	DecidedBy       *uuid.UUID `json:"decided_by,omitempty" db:"decided_by"`
+	DecidedAt       *time.Time `json:"decided_at,omitempty" db:"decided_at"`
+	RejectionReason *string    `json:"rejection_reason,omitempty" db:"rejection_reason"`
+	StartsAt        *time.Time `json:"starts_at,omitempty" db:"starts_at"`
+	ExpiresAt       *time.Time `json:"expires_at,omitempty" db:"expires_at"`
+	EndedBy         *uuid.UUID `json:"ended_by,omitempty" db:"ended_by"`
+	EndedAt         *time.Time `json:"ended_at,omitempty" db:"ended_at"`
+	CreatedAt       time.Time  `json:"created_at" db:"created_at"`
+}
+
+// Role elevation status constants
+const (
+	ElevationStatusPending  = "pending"
+	ElevationStatusActive   = "active"
+	ElevationStatusRejected = "rejected"
+	ElevationStatusExpired  = "expired"
+	ElevationStatusRevoked  = "revoked"
+)
+
+// System audit event types for role elevations
+const (
+	EventTypeElevationRequested = "role_elevation_requested"
+	EventTypeElevationApproved  = "role_elevation_approved"
+	EventTypeElevationRejected  = "role_elevation_rejected"
+	EventTypeElevationExpired   = "role_elevation_expired"
+	EventTypeElevationRevoked   = "role_elevation_revoked"
+)
@@ -0,0 +1,26 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// Event is an entry in the event log that is streamed to live subscribers
+type Event struct {
+	ID        int64           `json:"id" db:"id"`
+	Type      string          `json:"type" db:"type"`
+	Payload   json.RawMessage `json:"payload" db:"payload"`
+	CreatedAt time.Time       `json:"created_at" db:"created_at"`
+}
+
+// StreamEventChannel is the PostgreSQL NOTIFY channel on which new event IDs are announced
+const StreamEventChannel = "openpam_events"
+
+// Stream event types. Session events are "audit.session_" followed by the session
+// status (started, completed, failed, terminated); system audit events are "system."
+// followed by the system audit event type, e.g. "system.login_success".
+const (
+	StreamEventSessionStarted = "audit.session_started"
+	StreamEventSessionPrefix  = "audit.session_"
+	StreamEventSystemPrefix   = "system."
+)
@@ -0,0 +1,40 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// ViolationEvidence is the context captured when a policy violation fires in a
+// session, encrypted at rest and linked to the violation's system audit event
+type ViolationEvidence struct {
+	ID               uuid.UUID `json:"id" db:"id"`
+	SystemAuditLogID uuid.UUID `json:"system_audit_log_id" db:"system_audit_log_id"`
+	AuditLogID       uuid.UUID `json:"audit_log_id" db:"audit_log_id"`
+	ViolationType    string    `json:"violation_type" db:"violation_type"`
+	Kind             string    `json:"kind" db:"kind"`
+	ContentType      string    `json:"content_type" db:"content_type"`
+	Size             int       `json:"size" db:"size"`     // Plaintext size in bytes
+	SHA256           string    `json:"sha256" db:"sha256"` // Hex digest of the plaintext
+	Ciphertext       []byte    `json:"-" db:"ciphertext"`
+	CreatedAt        time.Time `json:"created_at" db:"created_at"`
+}
+
+// Policy violation types
+const (
+	ViolationDLPMatch         = "dlp_match"         // Terminal output matched a DLP rule
+	ViolationClipboardBlocked = "clipboard_blocked" // A clipboard transfer was refused
+)
+
+// Evidence kinds
+const (
+	EvidenceTerminalOutput = "terminal_output" // The last terminal output of an SSH session
+	EvidenceRDPStream      = "rdp_stream"      // The last Guacamole display instructions of an RDP session
+)
+
+// System audit event types for policy violations
+const (
+	EventTypePolicyViolation = "policy_violation"
+	EventTypeEvidenceViewed  = "evidence_viewed"
+)
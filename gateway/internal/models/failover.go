@@ -0,0 +1,21 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// FailoverEvent records a standby gateway taking over from the primary or
+// handing back to it
+type FailoverEvent struct {
+	ID        uuid.UUID `json:"id" db:"id"`
+	Node      string    `json:"node" db:"node"`
+	FromState string    `json:"from_state" db:"from_state"`
+	ToState   string    `json:"to_state" db:"to_state"`
+	Reason    string    `json:"reason" db:"reason"`
+	CreatedAt time.Time `json:"created_at" db:"created_at"`
+}
+
+// EventTypeFailover is the system audit event for a standby changing state
+const EventTypeFailover = "gateway_failover"
@@ -0,0 +1,76 @@
+package models
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Fingerprint is what probing a host found out about it: the remote access
+// services it answers on, what software runs them, and its operating system
+type Fingerprint struct {
+	Host              string         `json:"host" db:"host"`
+	Services          ProbedServices `json:"services" db:"services"`
+	OS                string         `json:"os,omitempty" db:"os"` // Such as "Ubuntu" or "Windows Server 2022 Datacenter"
+	OSVersion         string         `json:"os_version,omitempty" db:"os_version"`
+	OSFamily          string         `json:"os_family,omitempty" db:"os_family"` // One of the OSFamily constants
+	OSSource          string         `json:"os_source,omitempty" db:"os_source"` // One of the OSSource constants
+	SuggestedProtocol string         `json:"suggested_protocol,omitempty" db:"suggested_protocol"`
+	SuggestedPort     int            `json:"suggested_port,omitempty" db:"suggested_port"`
+	ProbedAt          time.Time      `json:"probed_at" db:"probed_at"`
+}
+
+// TargetFingerprint is the latest fingerprint of a target
+type TargetFingerprint struct {
+	TargetID   uuid.UUID `json:"target_id" db:"target_id"`
+	TargetName string    `json:"target_name,omitempty" db:"target_name"`
+	Fingerprint
+}
+
+// ProbedService is a port a probe found open
+type ProbedService struct {
+	Port     int    `json:"port"`
+	Protocol string `json:"protocol,omitempty"` // "ssh" or "rdp"; empty for other services
+	Banner   string `json:"banner,omitempty"`   // What the service announced itself with, such as an SSH identification string
+	Product  string `json:"product,omitempty"`  // Such as "OpenSSH"
+	Version  string `json:"version,omitempty"`  // Such as "8.9p1"
+	Security string `json:"security,omitempty"` // The RDP security protocol the server chose: "rdp", "tls" or "credssp"
+}
+
+// ProbedServices is the JSONB list of the services a probe found
+type ProbedServices []ProbedService
+
+// Value implements the driver.Valuer interface
+func (s ProbedServices) Value() (driver.Value, error) {
+	if s == nil {
+		return []byte("[]"), nil
+	}
+	return json.Marshal(s)
+}
+
+// Scan implements the sql.Scanner interface
+func (s *ProbedServices) Scan(value interface{}) error {
+	b, ok := value.([]byte)
+	if !ok {
+		return errors.New("type assertion to []byte failed")
+	}
+	return json.Unmarshal(b, s)
+}
+
+// Operating system families
+const (
+	OSFamilyLinux   = "linux"
+	OSFamilyWindows = "windows"
+	OSFamilyBSD     = "bsd"
+)
+
+// Where a fingerprint's operating system came from, from most to least certain
+const (
+	OSSourceActiveDirectory = "active_directory" // The computer's operatingSystem attribute in AD
+	OSSourceSSHBanner       = "ssh_banner"       // The SSH server's identification string
+	OSSourceRDP             = "rdp"              // The host speaks RDP
+	OSSourcePorts           = "ports"            // The host has ports open that only Windows usually has
+)
@@ -6,6 +6,12 @@ import (
 	"github.com/google/uuid"
 )
 
+// Group sources
+const (
+	GroupSourceLocal           = "local"
+	GroupSourceActiveDirectory = "active_directory"
+)
+
 type Group struct {
 	ID          uuid.UUID `json:"id" db:"id"`
 	Name        string    `json:"name" db:"name"`
@@ -15,3 +21,38 @@ type Group struct {
 	Source      string    `json:"source" db:"source"`
 	CreatedAt   time.Time `json:"created_at" db:"created_at"`
 }
+
+// IsLocal reports whether the group's members are managed in OpenPAM rather
+// than synced from Active Directory
+func (g *Group) IsLocal() bool {
+	return g.Source == GroupSourceLocal
+}
+
+// GroupMember is a user's membership of a group
+type GroupMember struct {
+	GroupID     uuid.UUID `json:"group_id" db:"group_id"`
+	UserID      uuid.UUID `json:"user_id" db:"user_id"`
+	Email       string    `json:"email" db:"email"`
+	DisplayName string    `json:"display_name" db:"display_name"`
+	Source      string    `json:"source" db:"source"` // "local" or "active_directory"
+	CreatedAt   time.Time `json:"created_at" db:"created_at"`
+}
+
+// rolePrecedence orders the roles from least to most privileged, for combining
+// a user's own role with those of their groups
+var rolePrecedence = map[string]int{
+	RoleUser:    1,
+	RoleAuditor: 2,
+	RoleAdmin:   3,
+}
+
+// HighestRole returns the most privileged of role and others. Unknown roles
+// never win.
+func HighestRole(role string, others ...string) string {
+	for _, other := range others {
+		if rolePrecedence[other] > rolePrecedence[role] {
+			role = other
+		}
+	}
+	return role
+}
@@ -0,0 +1,23 @@
+package models
+
+import "testing"
+
+func TestHighestRole(t *testing.T) {
+	tests := []struct {
+		role   string
+		others []string
+		want   string
+	}{
+		{RoleUser, nil, RoleUser},
+		{RoleUser, []string{RoleAuditor}, RoleAuditor},
+		{RoleUser, []string{RoleAdmin, RoleAuditor}, RoleAdmin},
+		{RoleAdmin, []string{RoleUser}, RoleAdmin},
+		{RoleAuditor, []string{RoleUser, ""}, RoleAuditor},
+		{RoleUser, []string{"owner"}, RoleUser},
+	}
+	for _, tt := range tests {
+		if got := HighestRole(tt.role, tt.others...); got != tt.want {
+			t.Errorf("HighestRole(%q, %v) = %q, want %q", tt.role, tt.others, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,26 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// IdempotencyKey records the first request a user made under an
+// Idempotency-Key header, and its response once complete
+type IdempotencyKey struct {
+	UserID      uuid.UUID       `json:"user_id" db:"user_id"`
+	Key         string          `json:"key" db:"key"`
+	Method      string          `json:"method" db:"method"`
+	Path        string          `json:"path" db:"path"`
+	RequestHash string          `json:"request_hash" db:"request_hash"`
+	Status      int             `json:"status" db:"status"` // 0 while the request is in progress
+	Headers     json.RawMessage `json:"headers,omitempty" db:"headers"`
+	Body        []byte          `json:"body,omitempty" db:"body"`
+	CreatedAt   time.Time       `json:"created_at" db:"created_at"`
+	ExpiresAt   time.Time       `json:"expires_at" db:"expires_at"`
+}
+
+// MaxIdempotencyKeyLength is the longest Idempotency-Key header accepted
+const MaxIdempotencyKeyLength = 255
@@ -0,0 +1,61 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Investigation is an auditor's case grouping the sessions, system audit events,
+// annotations and notes that belong to one incident
+type Investigation struct {
+	ID          uuid.UUID  `json:"id" db:"id"`
+	Title       string     `json:"title" db:"title"`
+	Description *string    `json:"description,omitempty" db:"description"`
+	Status      string     `json:"status" db:"status"`
+	OwnerID     *uuid.UUID `json:"owner_id,omitempty" db:"owner_id"`
+	OwnerEmail  *string    `json:"owner_email,omitempty" db:"owner_email"`
+	CreatedBy   *uuid.UUID `json:"created_by,omitempty" db:"created_by"`
+	ItemCount   int        `json:"item_count" db:"item_count"`
+	Version     int        `json:"version" db:"version"`
+	CreatedAt   time.Time  `json:"created_at" db:"created_at"`
+	UpdatedAt   time.Time  `json:"updated_at" db:"updated_at"`
+	ClosedAt    *time.Time `json:"closed_at,omitempty" db:"closed_at"`
+}
+
+// InvestigationItem is a piece of evidence attached to an investigation. The
+// reference matching ItemType is set, or Note for notes.
+type InvestigationItem struct {
+	ID               uuid.UUID  `json:"id" db:"id"`
+	InvestigationID  uuid.UUID  `json:"investigation_id" db:"investigation_id"`
+	ItemType         string     `json:"item_type" db:"item_type"`
+	AuditLogID       *uuid.UUID `json:"audit_log_id,omitempty" db:"audit_log_id"`
+	SystemAuditLogID *uuid.UUID `json:"system_audit_log_id,omitempty" db:"system_audit_log_id"`
+	AnnotationID     *uuid.UUID `json:"annotation_id,omitempty" db:"annotation_id"`
+	Note             *string    `json:"note,omitempty" db:"note"`
+	AddedBy          *uuid.UUID `json:"added_by,omitempty" db:"added_by"`
+	AddedByEmail     *string    `json:"added_by_email,omitempty" db:"added_by_email"`
+	CreatedAt        time.Time  `json:"created_at" db:"created_at"`
+}
+
+// Investigation statuses
+const (
+	InvestigationOpen       = "open"
+	InvestigationInProgress = "in_progress"
+	InvestigationClosed     = "closed"
+)
+
+// Investigation item types
+const (
+	InvestigationItemSession     = "session"
+	InvestigationItemSystemEvent = "system_event"
+	InvestigationItemAnnotation  = "annotation"
+	InvestigationItemNote        = "note"
+)
+
+// System audit event types for investigations
+const (
+	EventTypeInvestigationCreated  = "investigation_created"
+	EventTypeInvestigationUpdated  = "investigation_updated"
+	EventTypeInvestigationExported = "investigation_exported"
+)
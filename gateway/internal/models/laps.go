@@ -0,0 +1,48 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// LAPSMachine is a Windows target whose built-in Administrator password is
+// rotated by OpenPAM and kept in Vault, in the manner of Microsoft LAPS
+type LAPSMachine struct {
+	TargetID        uuid.UUID  `json:"target_id" db:"target_id"`
+	TargetName      string     `json:"target_name,omitempty" db:"target_name"`
+	AccountName     string     `json:"account_name" db:"account_name"`
+	CredentialID    *uuid.UUID `json:"credential_id,omitempty" db:"credential_id"`
+	VaultPath       string     `json:"vault_path" db:"vault_path"`
+	Enabled         bool       `json:"enabled" db:"enabled"`
+	LastRotatedAt   *time.Time `json:"last_rotated_at,omitempty" db:"last_rotated_at"`
+	NextRotationAt  time.Time  `json:"next_rotation_at" db:"next_rotation_at"`
+	LastAttemptAt   *time.Time `json:"last_attempt_at,omitempty" db:"last_attempt_at"`
+	LastError       *string    `json:"last_error,omitempty" db:"last_error"`
+	Failures        int        `json:"failures" db:"failures"`
+	LastRetrievedAt *time.Time `json:"last_retrieved_at,omitempty" db:"last_retrieved_at"`
+	EnrolledBy      *uuid.UUID `json:"enrolled_by,omitempty" db:"enrolled_by"`
+	EnrolledAt      time.Time  `json:"enrolled_at" db:"enrolled_at"`
+	Overdue         bool       `json:"overdue" db:"-"`
+}
+
+// LAPSPassword is a machine's current Administrator password, as retrieved by an admin
+type LAPSPassword struct {
+	TargetID       uuid.UUID  `json:"target_id"`
+	TargetName     string     `json:"target_name"`
+	AccountName    string     `json:"account_name"`
+	Password       string     `json:"password"`
+	RotatedAt      *time.Time `json:"rotated_at,omitempty"`
+	NextRotationAt time.Time  `json:"next_rotation_at"`
+}
+
+// CredentialTagLAPS tags the credentials of LAPS-managed Administrator accounts
+const CredentialTagLAPS = "laps"
+
+// System audit event types for LAPS
+const (
+	EventTypeLAPSEnrolled   = "laps_enrolled"
+	EventTypeLAPSUnenrolled = "laps_unenrolled"
+	EventTypeLAPSRotated    = "laps_rotated"
+	EventTypeLAPSRetrieved  = "laps_password_retrieved"
+)
@@ -0,0 +1,58 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// MaintenanceConflict is a scheduled access whose window overlaps a target's
+// maintenance window
+type MaintenanceConflict struct {
+	ScheduleID     uuid.UUID `json:"schedule_id" db:"schedule_id"`
+	UserID         uuid.UUID `json:"user_id" db:"user_id"`
+	UserEmail      string    `json:"user_email" db:"user_email"`
+	StartTime      time.Time `json:"start_time" db:"start_time"`
+	EndTime        time.Time `json:"end_time" db:"end_time"`
+	ApprovalStatus string    `json:"approval_status" db:"approval_status"`
+}
+
+// System audit event types for target maintenance
+const (
+	EventTypeMaintenanceSet      = "target_maintenance_set"
+	EventTypeMaintenanceCleared  = "target_maintenance_cleared"
+	EventTypeMaintenanceOverride = "target_maintenance_override"
+)
+
+// MaintenanceWindow is a target's maintenance window, as shown on the calendar
+type MaintenanceWindow struct {
+	TargetID   uuid.UUID  `json:"target_id"`
+	TargetName string     `json:"target_name"`
+	Start      time.Time  `json:"start"`
+	End        *time.Time `json:"end,omitempty"` // Unset: until cleared
+	Reason     *string    `json:"reason,omitempty"`
+	SetBy      *uuid.UUID `json:"set_by,omitempty"`
+}
+
+// InMaintenance reports whether the target's maintenance window includes now
+func (t *Target) InMaintenance(now time.Time) bool {
+	if t.MaintenanceStart == nil || now.Before(*t.MaintenanceStart) {
+		return false
+	}
+	return t.MaintenanceEnd == nil || now.Before(*t.MaintenanceEnd)
+}
+
+// Maintenance returns the target's maintenance window, or nil if none is set
+func (t *Target) Maintenance() *MaintenanceWindow {
+	if t.MaintenanceStart == nil {
+		return nil
+	}
+	return &MaintenanceWindow{
+		TargetID:   t.ID,
+		TargetName: t.Name,
+		Start:      *t.MaintenanceStart,
+		End:        t.MaintenanceEnd,
+		Reason:     t.MaintenanceReason,
+		SetBy:      t.MaintenanceBy,
+	}
+}
@@ -0,0 +1,40 @@
+package models
+
+import (
+	"testing"
+	"time"
+)
+
+func TestTarget_InMaintenance(t *testing.T) {
+	now := time.Date(2025, 3, 10, 12, 0, 0, 0, time.UTC)
+	at := func(d time.Duration) *time.Time {
+		v := now.Add(d)
+		return &v
+	}
+
+	tests := []struct {
+		name  string
+		start *time.Time
+		end   *time.Time
+		want  bool
+	}{
+		{name: "No window", want: false},
+		{name: "End without a start", end: at(time.Hour), want: false},
+		{name: "Starts later", start: at(time.Hour), end: at(2 * time.Hour), want: false},
+		{name: "Starts now", start: at(0), end: at(time.Hour), want: true},
+		{name: "Running", start: at(-time.Hour), end: at(time.Hour), want: true},
+		{name: "Open-ended", start: at(-24 * time.Hour), want: true},
+		{name: "Open-ended, starts later", start: at(time.Minute), want: false},
+		{name: "Ends now", start: at(-time.Hour), end: at(0), want: false},
+		{name: "Ended", start: at(-2 * time.Hour), end: at(-time.Hour), want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			target := &Target{MaintenanceStart: tt.start, MaintenanceEnd: tt.end}
+			if got := target.InMaintenance(now); got != tt.want {
+				t.Errorf("InMaintenance() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -2,76 +2,146 @@ package models
 
 import (
 	"database/sql"
+	"fmt"
 	"time"
+	"unicode/utf8"
 
 	"github.com/google/uuid"
+	"github.com/lib/pq"
 )
 
 // Zone represents a network zone (hub or satellite gateway)
 type Zone struct {
-	ID          uuid.UUID `json:"id" db:"id"`
-	Name        string    `json:"name" db:"name"`
-	Type        string    `json:"type" db:"type"` // "hub" or "satellite"
-	Description string    `json:"description,omitempty" db:"description"`
-	CreatedAt   time.Time `json:"created_at" db:"created_at"`
-	UpdatedAt   time.Time `json:"updated_at" db:"updated_at"`
+	ID          uuid.UUID       `json:"id" db:"id"`
+	Name        string          `json:"name" db:"name"`
+	Type        string          `json:"type" db:"type"` // "hub" or "satellite"
+	Description string          `json:"description,omitempty" db:"description"`
+	Settings    SessionSettings `json:"settings" db:"settings"`
+	Version     int             `json:"version" db:"version"`
+	CreatedAt   time.Time       `json:"created_at" db:"created_at"`
+	UpdatedAt   time.Time       `json:"updated_at" db:"updated_at"`
 }
 
 // Target represents a server/system that users can connect to
 type Target struct {
-	ID          uuid.UUID `json:"id" db:"id"`
-	ZoneID      uuid.UUID `json:"zone_id" db:"zone_id"`
-	Name        string    `json:"name" db:"name"`
-	Hostname    string    `json:"hostname" db:"hostname"`
-	Protocol    string    `json:"protocol" db:"protocol"` // "ssh" or "rdp"
-	Port        int       `json:"port" db:"port"`
-	Description string    `json:"description,omitempty" db:"description"`
-	Enabled     bool      `json:"enabled" db:"enabled"`
-	CreatedAt   time.Time `json:"created_at" db:"created_at"`
-	UpdatedAt   time.Time `json:"updated_at" db:"updated_at"`
+	ID                uuid.UUID       `json:"id" db:"id"`
+	ZoneID            uuid.UUID       `json:"zone_id" db:"zone_id"`
+	Name              string          `json:"name" db:"name"`
+	Hostname          string          `json:"hostname" db:"hostname"`
+	Protocol          string          `json:"protocol" db:"protocol"` // "ssh", "rdp", "aws" or "azure"
+	Port              int             `json:"port" db:"port"`
+	OwnerTeam         string          `json:"owner_team,omitempty" db:"owner_team"`
+	Environment       string          `json:"environment,omitempty" db:"environment"`           // Such as "production" or "staging"
+	ComplianceScope   pq.StringArray  `json:"compliance_scope,omitempty" db:"compliance_scope"` // Such as "pci-dss" or "sox"
+	Labels            Labels          `json:"labels,omitempty" db:"labels"`
+	RiskTier          *string         `json:"risk_tier,omitempty" db:"risk_tier"`               // Unset: from the labels' tiers, or medium
+	ConnectionNotes   string          `json:"connection_notes,omitempty" db:"connection_notes"` // Markdown shown to users before they connect
+	Enabled           bool            `json:"enabled" db:"enabled"`
+	KeepaliveInterval *int            `json:"keepalive_interval,omitempty" db:"keepalive_interval"` // SSH keep-alive seconds (nil = default, 0 = off)
+	Ephemeral         bool            `json:"ephemeral" db:"ephemeral"`
+	ExpiresAt         *time.Time      `json:"expires_at,omitempty" db:"expires_at"` // Set for ephemeral targets
+	Settings          SessionSettings `json:"settings" db:"settings"`
+	RDP               RDPSettings     `json:"rdp_settings" db:"rdp_settings"`
+	MaintenanceStart  *time.Time      `json:"maintenance_start,omitempty" db:"maintenance_start"`
+	MaintenanceEnd    *time.Time      `json:"maintenance_end,omitempty" db:"maintenance_end"` // Unset: until cleared
+	MaintenanceReason *string         `json:"maintenance_reason,omitempty" db:"maintenance_reason"`
+	MaintenanceBy     *uuid.UUID      `json:"maintenance_by,omitempty" db:"maintenance_by"`
+	DeletedAt         *time.Time      `json:"-" db:"deleted_at"`
+	Version           int             `json:"version" db:"version"`
+	CreatedAt         time.Time       `json:"created_at" db:"created_at"`
+	UpdatedAt         time.Time       `json:"updated_at" db:"updated_at"`
+}
+
+// Expired reports whether an ephemeral target has passed its expiry time
+func (t *Target) Expired(now time.Time) bool {
+	return t.ExpiresAt != nil && !now.Before(*t.ExpiresAt)
 }
 
 // Credential maps a target to its credentials stored in Vault
 type Credential struct {
-	ID              uuid.UUID `json:"id" db:"id"`
-	TargetID        uuid.UUID `json:"target_id" db:"target_id"`
-	Username        string    `json:"username" db:"username"`
-	VaultSecretPath string    `json:"vault_secret_path" db:"vault_secret_path"`
-	Description     string    `json:"description,omitempty" db:"description"`
-	CreatedAt       time.Time `json:"created_at" db:"created_at"`
-	UpdatedAt       time.Time `json:"updated_at" db:"updated_at"`
+	ID              uuid.UUID      `json:"id" db:"id"`
+	TargetID        uuid.UUID      `json:"target_id" db:"target_id"`
+	Username        string         `json:"username" db:"username"`
+	VaultSecretPath string         `json:"vault_secret_path" db:"vault_secret_path"`
+	Description     string         `json:"description,omitempty" db:"description"`
+	IsDefault       bool           `json:"is_default" db:"is_default"`
+	SortOrder       int            `json:"sort_order" db:"sort_order"`
+	Tags            pq.StringArray `json:"tags" db:"tags"`
+	Version         int            `json:"version" db:"version"`
+	CreatedAt       time.Time      `json:"created_at" db:"created_at"`
+	UpdatedAt       time.Time      `json:"updated_at" db:"updated_at"`
+
+	// Set when the secret holds a client certificate for smart card logon
+	CertificateSubject   *string    `json:"certificate_subject,omitempty" db:"certificate_subject"`
+	CertificateExpiresAt *time.Time `json:"certificate_expires_at,omitempty" db:"certificate_expires_at"`
+	CertificateAlertedAt *time.Time `json:"-" db:"certificate_alerted_at"` // When the expiry alert was sent
+
+	// Failed logons to the target with this credential since its last successful one
+	AuthFailures      int        `json:"auth_failures" db:"auth_failures"`
+	LastAuthFailureAt *time.Time `json:"last_auth_failure_at,omitempty" db:"last_auth_failure_at"`
+	LastAuthFailure   *string    `json:"last_auth_failure,omitempty" db:"last_auth_failure"`
+	QuarantinedAt     *time.Time `json:"quarantined_at,omitempty" db:"quarantined_at"` // Set while use is blocked until the secret is rotated
+}
+
+// Quarantined reports whether the credential is blocked after repeated failed logons
+func (c *Credential) Quarantined() bool {
+	return c.QuarantinedAt != nil
+}
+
+// HasCertificate reports whether the credential logs in with a client certificate
+func (c *Credential) HasCertificate() bool {
+	return c.CertificateExpiresAt != nil
+}
+
+// HasTag reports whether the credential carries the given tag
+func (c *Credential) HasTag(tag string) bool {
+	for _, t := range c.Tags {
+		if t == tag {
+			return true
+		}
+	}
+	return false
 }
 
 // User stores user information from EntraID/AD
 type User struct {
-	ID          uuid.UUID    `json:"id" db:"id"`
-	EntraID     string       `json:"entra_id" db:"entra_id"`
-	Email       string       `json:"email" db:"email"`
-	DisplayName string       `json:"display_name,omitempty" db:"display_name"`
-	Enabled     bool         `json:"enabled" db:"enabled"`
-	Role        string       `json:"role" db:"role"`
-	Source      string       `json:"source" db:"source"`
-	CreatedAt   time.Time    `json:"created_at" db:"created_at"`
-	UpdatedAt   time.Time    `json:"updated_at" db:"updated_at"`
-	LastLoginAt sql.NullTime `json:"last_login_at,omitempty" db:"last_login_at"`
+	ID          uuid.UUID  `json:"id" db:"id"`
+	EntraID     string     `json:"entra_id" db:"entra_id"`
+	Email       string     `json:"email" db:"email"`
+	DisplayName string     `json:"display_name,omitempty" db:"display_name"`
+	Enabled     bool       `json:"enabled" db:"enabled"`
+	Role        string     `json:"role" db:"role"`
+	Source      string     `json:"source" db:"source"`
+	Attributes  Labels     `json:"attributes,omitempty" db:"attributes"` // Such as "department", for policy conditions
+	Version     int        `json:"version" db:"version"`
+	CreatedAt   time.Time  `json:"created_at" db:"created_at"`
+	UpdatedAt   time.Time  `json:"updated_at" db:"updated_at"`
+	LastLoginAt *time.Time `json:"last_login_at,omitempty" db:"last_login_at"`
 }
 
 // AuditLog records all connection sessions
 type AuditLog struct {
-	ID            uuid.UUID     `json:"id" db:"id"`
-	UserID        uuid.UUID     `json:"user_id" db:"user_id"`
-	TargetID      uuid.UUID     `json:"target_id" db:"target_id"`
-	CredentialID  uuid.NullUUID `json:"credential_id,omitempty" db:"credential_id"`
-	StartTime     time.Time     `json:"start_time" db:"start_time"`
-	EndTime       sql.NullTime  `json:"end_time,omitempty" db:"end_time"`
-	BytesSent     int64         `json:"bytes_sent" db:"bytes_sent"`
-	BytesReceived int64         `json:"bytes_received" db:"bytes_received"`
-	SessionStatus string        `json:"session_status" db:"session_status"` // "active", "completed", "failed", "terminated"
-	ClientIP      *string       `json:"client_ip,omitempty" db:"client_ip"`
-	ErrorMessage  *string       `json:"error_message,omitempty" db:"error_message"`
-	RecordingPath *string       `json:"recording_path,omitempty" db:"recording_path"`
-	Protocol      string        `json:"protocol" db:"protocol"`
-	CreatedAt     time.Time     `json:"created_at" db:"created_at"`
+	ID             uuid.UUID     `json:"id" db:"id"`
+	UserID         uuid.UUID     `json:"user_id" db:"user_id"`
+	TargetID       uuid.UUID     `json:"target_id" db:"target_id"`
+	CredentialID   uuid.NullUUID `json:"credential_id,omitempty" db:"credential_id"`
+	StartTime      time.Time     `json:"start_time" db:"start_time"`
+	EndTime        sql.NullTime  `json:"end_time,omitempty" db:"end_time"`
+	BytesSent      int64         `json:"bytes_sent" db:"bytes_sent"`
+	BytesReceived  int64         `json:"bytes_received" db:"bytes_received"`
+	SessionStatus  string        `json:"session_status" db:"session_status"` // "active", "completed", "failed", "terminated"
+	ClientIP       *string       `json:"client_ip,omitempty" db:"client_ip"`
+	ErrorMessage   *string       `json:"error_message,omitempty" db:"error_message"`
+	RecordingPath  *string       `json:"recording_path,omitempty" db:"recording_path"`
+	RecordingState *string       `json:"recording_state,omitempty" db:"recording_state"` // See the RecordingState constants
+	RecordingError *string       `json:"recording_error,omitempty" db:"recording_error"` // Why the recording failed
+	Protocol       string        `json:"protocol" db:"protocol"`
+	Purpose        *string       `json:"purpose,omitempty" db:"purpose"`   // See the Purpose constants
+	Reason         *string       `json:"reason,omitempty" db:"reason"`     // Free text, such as a change ticket
+	Metadata       JSONB         `json:"metadata,omitempty" db:"metadata"` // Set when the session ends
+	BannerVersion  *string       `json:"banner_version,omitempty" db:"banner_version"`
+	BannerAckedAt  *time.Time    `json:"banner_acknowledged_at,omitempty" db:"banner_acknowledged_at"`
+	CreatedAt      time.Time     `json:"created_at" db:"created_at"`
 }
 
 // SessionStatus constants
@@ -82,18 +152,59 @@ const (
 	SessionStatusTerminated = "terminated"
 )
 
+// Purpose constants, the categories a user tags a session with when connecting
+const (
+	PurposeChange      = "change"
+	PurposeIncident    = "incident"
+	PurposeMaintenance = "maintenance"
+	PurposeOther       = "other"
+)
+
+// MaxReasonLength is the longest reason a session or request may give
+const MaxReasonLength = 500
+
+// ValidatePurpose checks a purpose and reason given together. Both are
+// optional here; whether a session needs them is a session setting.
+func ValidatePurpose(purpose, reason string) error {
+	switch purpose {
+	case "", PurposeChange, PurposeIncident, PurposeMaintenance, PurposeOther:
+	default:
+		return fmt.Errorf("purpose must be one of %s, %s, %s or %s", PurposeChange, PurposeIncident, PurposeMaintenance, PurposeOther)
+	}
+	if purpose == "" && reason != "" {
+		return fmt.Errorf("a reason needs a purpose")
+	}
+	if utf8.RuneCountInString(reason) > MaxReasonLength {
+		return fmt.Errorf("reason must be at most %d characters", MaxReasonLength)
+	}
+	return nil
+}
+
 // ZoneType constants
 const (
 	ZoneTypeHub       = "hub"
 	ZoneTypeSatellite = "satellite"
 )
 
-// Protocol constants
+// Protocol constants. AWS and Azure targets are cloud consoles: sessions to
+// them are brokered credentials and sign-in URLs rather than proxied streams.
 const (
-	ProtocolSSH = "ssh"
-	ProtocolRDP = "rdp"
+	ProtocolSSH   = "ssh"
+	ProtocolRDP   = "rdp"
+	ProtocolAWS   = "aws"
+	ProtocolAzure = "azure"
 )
 
+// ValidProtocol reports whether p is a known target protocol
+func ValidProtocol(p string) bool {
+	return p == ProtocolSSH || p == ProtocolRDP || CloudProtocol(p)
+}
+
+// CloudProtocol reports whether p is a cloud console protocol
+func CloudProtocol(p string) bool {
+	return p == ProtocolAWS || p == ProtocolAzure
+}
+
 // SystemAuditLog records system events (logins, user changes, etc.)
 type SystemAuditLog struct {
 	ID           uuid.UUID     `json:"id" db:"id"`
@@ -108,7 +219,8 @@ type SystemAuditLog struct {
 	Status       string        `json:"status" db:"status"`
 	IPAddress    *string       `json:"ip_address,omitempty" db:"ip_address"`
 	UserAgent    *string       `json:"user_agent,omitempty" db:"user_agent"`
-	Details      *string       `json:"details,omitempty" db:"details"` // JSONB stored as string
+	Details      *string       `json:"details,omitempty" db:"details"`           // JSONB stored as string
+	ElevationID  uuid.NullUUID `json:"elevation_id,omitempty" db:"elevation_id"` // Set when the actor held an elevated role
 	CreatedAt    time.Time     `json:"created_at" db:"created_at"`
 }
 
@@ -146,6 +258,25 @@ const (
 	EventTypeZoneCreated       = "zone_created"
 	EventTypeZoneUpdated       = "zone_updated"
 	EventTypeZoneDeleted       = "zone_deleted"
+
+	EventTypeFlightRecorderViewed = "flight_recorder_viewed"
+	EventTypeSessionQueueJumped   = "session_queue_jumped"
+
+	EventTypeCertificateUploaded = "credential_certificate_uploaded"
+	EventTypeCertificateExpiring = "credential_certificate_expiring"
+
+	EventTypeCredentialAuthFailures = "credential_auth_failures"
+	EventTypeCredentialQuarantined  = "credential_quarantined"
+	EventTypeCredentialReleased     = "credential_released"
+
+	EventTypeAuditPartitionsDropped = "audit_partitions_dropped"
+
+	// Recorded by the identity service when a sync finds a member added to or
+	// removed from a watched AD group
+	EventTypeADPrivilegedGroupChanged = "ad_privileged_group_changed"
+
+	EventTypeADPasswordExpiring = "ad_password_expiring"
+	EventTypeADAccountStale     = "ad_account_stale"
 )
 
 // Audit Status constants
@@ -0,0 +1,78 @@
+package models
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// OnCallMapping links an external on-call schedule to the zone whose targets
+// the engineers on call are given access to. The sync keeps an approved access
+// schedule per shift and target, tagged with the mapping's ID in its metadata.
+type OnCallMapping struct {
+	ID                 uuid.UUID         `json:"id" db:"id"`
+	Name               string            `json:"name" db:"name"`
+	Provider           string            `json:"provider" db:"provider"`
+	ExternalScheduleID string            `json:"external_schedule_id" db:"external_schedule_id"`
+	ZoneID             uuid.UUID         `json:"zone_id" db:"zone_id"`
+	Enabled            bool              `json:"enabled" db:"enabled"`
+	NextSyncAt         time.Time         `json:"next_sync_at" db:"next_sync_at"`
+	LastSyncedAt       *time.Time        `json:"last_synced_at,omitempty" db:"last_synced_at"`
+	LastSyncStatus     *string           `json:"last_sync_status,omitempty" db:"last_sync_status"`
+	LastSyncError      *string           `json:"last_sync_error,omitempty" db:"last_sync_error"`
+	LastSyncResult     *OnCallSyncResult `json:"last_sync_result,omitempty" db:"last_sync_result"`
+	CreatedBy          *uuid.UUID        `json:"created_by,omitempty" db:"created_by"`
+	Version            int               `json:"version" db:"version"`
+	CreatedAt          time.Time         `json:"created_at" db:"created_at"`
+	UpdatedAt          time.Time         `json:"updated_at" db:"updated_at"`
+}
+
+// OnCallSyncResult summarises what a sync of an on-call mapping changed
+type OnCallSyncResult struct {
+	Shifts       int      `json:"shifts"`                  // Shifts found in the provider's schedule
+	Created      int      `json:"created"`                 // Access schedules created for new shifts
+	Updated      int      `json:"updated"`                 // Access schedules whose end moved with their shift
+	Revoked      int      `json:"revoked"`                 // Access schedules of shifts that are gone
+	Unchanged    int      `json:"unchanged"`               // Access schedules left as they were
+	UnknownUsers []string `json:"unknown_users,omitempty"` // On-call emails without an enabled OpenPAM user
+}
+
+// Value implements the driver.Valuer interface
+func (r OnCallSyncResult) Value() (driver.Value, error) {
+	return json.Marshal(r)
+}
+
+// Scan implements the sql.Scanner interface
+func (r *OnCallSyncResult) Scan(value interface{}) error {
+	b, ok := value.([]byte)
+	if !ok {
+		return errors.New("type assertion to []byte failed")
+	}
+	return json.Unmarshal(b, r)
+}
+
+// On-call provider constants
+const (
+	OnCallProviderPagerDuty = "pagerduty"
+	OnCallProviderOpsgenie  = "opsgenie"
+)
+
+// On-call sync status constants
+const (
+	OnCallSyncSuccess = "success"
+	OnCallSyncPartial = "partial" // Synced, but some on-call engineers have no OpenPAM user
+	OnCallSyncFailed  = "failed"
+)
+
+// ScheduleMetadataOnCallMapping is the schedule metadata key holding the ID of
+// the on-call mapping that maintains the schedule
+const ScheduleMetadataOnCallMapping = "oncall_mapping_id"
+
+// System audit event types for on-call sync
+const (
+	EventTypeOnCallSynced     = "oncall_synced"
+	EventTypeOnCallSyncFailed = "oncall_sync_failed"
+)
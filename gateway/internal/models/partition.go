@@ -0,0 +1,18 @@
+package models
+
+import "time"
+
+// PartitionedTables maps the audit tables partitioned by month to the column
+// they are partitioned on
+var PartitionedTables = map[string]string{
+	"audit_logs":        "start_time",
+	"system_audit_logs": "timestamp",
+}
+
+// PartitionChanges is what a maintenance pass did to a partitioned table
+type PartitionChanges struct {
+	Table   string      `json:"table"`
+	Created []time.Time `json:"created,omitempty"` // Months whose partitions were created
+	Dropped []time.Time `json:"dropped,omitempty"` // Months dropped past the retention
+	Purged  int64       `json:"purged,omitempty"`  // Rows past the retention deleted from the default partition
+}
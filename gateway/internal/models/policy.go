@@ -0,0 +1,39 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Credential rule effects
+const (
+	RuleEffectAllow = "allow"
+	RuleEffectDeny  = "deny"
+)
+
+// CredentialTagPrivileged is the conventional tag for high-privilege accounts such as root
+const CredentialTagPrivileged = "privileged"
+
+// CredentialRule grants or denies use of credentials to a subject.
+//
+// The subject is a user, a role and/or a group (all nil means everyone). The
+// object is a specific credential or every credential carrying a tag,
+// optionally limited to one target.
+type CredentialRule struct {
+	ID            uuid.UUID       `json:"id" db:"id"`
+	Name          string          `json:"name" db:"name"`
+	Description   *string         `json:"description,omitempty" db:"description"`
+	Effect        string          `json:"effect" db:"effect"` // "allow" or "deny"
+	UserID        *uuid.UUID      `json:"user_id,omitempty" db:"user_id"`
+	Role          *string         `json:"role,omitempty" db:"role"`
+	GroupID       *uuid.UUID      `json:"group_id,omitempty" db:"group_id"`
+	TargetID      *uuid.UUID      `json:"target_id,omitempty" db:"target_id"`
+	CredentialID  *uuid.UUID      `json:"credential_id,omitempty" db:"credential_id"`
+	CredentialTag *string         `json:"credential_tag,omitempty" db:"credential_tag"`
+	Condition     *string         `json:"condition,omitempty" db:"condition"` // CEL expression that must hold for the rule to apply
+	Enabled       bool            `json:"enabled" db:"enabled"`
+	Settings      SessionSettings `json:"settings" db:"settings"` // Overrides for sessions using a credential the rule allows
+	CreatedAt     time.Time       `json:"created_at" db:"created_at"`
+	UpdatedAt     time.Time       `json:"updated_at" db:"updated_at"`
+}
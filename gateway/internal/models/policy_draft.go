@@ -0,0 +1,58 @@
+package models
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// PolicyDraft is a proposed replacement for the whole set of credential
+// rules. It can be evaluated against real users and targets before it is
+// published, which makes its rules the live ones.
+type PolicyDraft struct {
+	ID              uuid.UUID  `json:"id" db:"id"`
+	Name            string     `json:"name" db:"name"`
+	Description     *string    `json:"description,omitempty" db:"description"`
+	Rules           DraftRules `json:"rules" db:"rules"`
+	BaseFingerprint string     `json:"base_fingerprint" db:"base_fingerprint"`
+	Status          string     `json:"status" db:"status"`
+	CreatedBy       *uuid.UUID `json:"created_by,omitempty" db:"created_by"`
+	UpdatedBy       *uuid.UUID `json:"updated_by,omitempty" db:"updated_by"`
+	PublishedBy     *uuid.UUID `json:"published_by,omitempty" db:"published_by"`
+	PublishedAt     *time.Time `json:"published_at,omitempty" db:"published_at"`
+	CreatedAt       time.Time  `json:"created_at" db:"created_at"`
+	UpdatedAt       time.Time  `json:"updated_at" db:"updated_at"`
+}
+
+// DraftRules are the credential rules of a draft
+type DraftRules []*CredentialRule
+
+// Value implements the driver.Valuer interface
+func (r DraftRules) Value() (driver.Value, error) {
+	if r == nil {
+		return []byte("[]"), nil
+	}
+	return json.Marshal(r)
+}
+
+// Scan implements the sql.Scanner interface
+func (r *DraftRules) Scan(value interface{}) error {
+	b, ok := value.([]byte)
+	if !ok {
+		return errors.New("type assertion to []byte failed")
+	}
+	return json.Unmarshal(b, r)
+}
+
+// Policy draft statuses
+const (
+	PolicyDraftStatusDraft     = "draft"
+	PolicyDraftStatusPublished = "published"
+	PolicyDraftStatusDiscarded = "discarded"
+)
+
+// System audit event type for a published policy draft
+const EventTypePolicyDraftPublished = "policy_draft_published"
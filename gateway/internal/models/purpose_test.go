@@ -0,0 +1,45 @@
+package models
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestValidatePurpose(t *testing.T) {
+	tests := []struct {
+		name    string
+		purpose string
+		reason  string
+		wantErr bool
+	}{
+		{"none", "", "", false},
+		{"purpose only", PurposeMaintenance, "", false},
+		{"with reason", PurposeChange, "CHG-1234", false},
+		{"unknown purpose", "curiosity", "", true},
+		{"reason without purpose", "", "CHG-1234", true},
+		{"reason too long", PurposeIncident, strings.Repeat("x", MaxReasonLength+1), true},
+		{"multibyte reason", PurposeOther, strings.Repeat("é", MaxReasonLength), false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidatePurpose(tt.purpose, tt.reason)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ValidatePurpose() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestSchedulePurpose(t *testing.T) {
+	s := &Schedule{}
+	s.SetPurpose("", "ignored")
+	if s.Metadata != nil {
+		t.Errorf("metadata = %v, want none without a purpose", s.Metadata)
+	}
+
+	s.SetPurpose(PurposeChange, "CHG-1234")
+	if purpose, reason := s.Purpose(); purpose != PurposeChange || reason != "CHG-1234" {
+		t.Errorf("Purpose() = %q, %q", purpose, reason)
+	}
+}
@@ -0,0 +1,114 @@
+package models
+
+import (
+	"crypto/x509"
+	"database/sql/driver"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// RDP authentication packages
+const (
+	RDPAuthNTLM     = "ntlm"
+	RDPAuthKerberos = "kerberos"
+)
+
+// RDP security modes
+const (
+	RDPSecurityAny = "any" // Whatever the target offers, strongest first
+	RDPSecurityNLA = "nla"
+	RDPSecurityTLS = "tls"
+	RDPSecurityRDP = "rdp" // Standard RDP encryption, without TLS
+)
+
+// RDPSettings are the connection parameters of an RDP target
+type RDPSettings struct {
+	Auth     string `json:"auth,omitempty"`     // Authentication package for NLA: "ntlm" (default) or "kerberos"
+	Domain   string `json:"domain,omitempty"`   // AD domain of the target's credentials; the realm for Kerberos
+	Security string `json:"security,omitempty"` // Security mode: "any" (default), "nla", "tls" or "rdp"
+
+	// The target's TLS certificate is checked against a CA or a pinned
+	// fingerprint when either is set, and not checked otherwise
+	CACertificate   string `json:"ca_certificate,omitempty"`   // PEM CA bundle the certificate must chain to
+	CertFingerprint string `json:"cert_fingerprint,omitempty"` // SHA-256 fingerprint of the certificate, in hex
+}
+
+// VerifiesCertificate reports whether the target's certificate is checked
+func (s *RDPSettings) VerifiesCertificate() bool {
+	return s.CACertificate != "" || s.CertFingerprint != ""
+}
+
+// CertPool returns the CA bundle, or nil when none is set
+func (s *RDPSettings) CertPool() (*x509.CertPool, error) {
+	if s.CACertificate == "" {
+		return nil, nil
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM([]byte(s.CACertificate)) {
+		return nil, fmt.Errorf("ca_certificate holds no PEM certificates")
+	}
+	return pool, nil
+}
+
+// Fingerprint returns the pinned fingerprint as lowercase hex, accepting an
+// optional "sha256:" prefix and colon separators
+func (s *RDPSettings) Fingerprint() (string, error) {
+	fp := strings.ToLower(strings.TrimPrefix(strings.ToLower(s.CertFingerprint), "sha256:"))
+	fp = strings.ReplaceAll(fp, ":", "")
+	if b, err := hex.DecodeString(fp); err != nil || len(b) != 32 {
+		return "", fmt.Errorf("cert_fingerprint must be a SHA-256 fingerprint in hex")
+	}
+	return fp, nil
+}
+
+// Validate checks the settings
+func (s *RDPSettings) Validate() error {
+	switch s.Security {
+	case "", RDPSecurityAny, RDPSecurityNLA, RDPSecurityTLS:
+	case RDPSecurityRDP:
+		if s.VerifiesCertificate() {
+			return fmt.Errorf("certificates can't be verified with rdp security, which doesn't use TLS")
+		}
+	default:
+		return fmt.Errorf("unknown RDP security mode %q", s.Security)
+	}
+	if _, err := s.CertPool(); err != nil {
+		return err
+	}
+	if s.CertFingerprint != "" {
+		if _, err := s.Fingerprint(); err != nil {
+			return err
+		}
+	}
+
+	switch s.Auth {
+	case "", RDPAuthNTLM:
+	case RDPAuthKerberos:
+		if s.Domain == "" {
+			return fmt.Errorf("domain is required for Kerberos authentication")
+		}
+		if s.Security == RDPSecurityTLS || s.Security == RDPSecurityRDP {
+			return fmt.Errorf("Kerberos authentication needs nla security")
+		}
+	default:
+		return fmt.Errorf("unknown RDP authentication package %q", s.Auth)
+	}
+	return nil
+}
+
+// Value implements the driver.Valuer interface
+func (s RDPSettings) Value() (driver.Value, error) {
+	return json.Marshal(s)
+}
+
+// Scan implements the sql.Scanner interface
+func (s *RDPSettings) Scan(value interface{}) error {
+	b, ok := value.([]byte)
+	if !ok {
+		return errors.New("type assertion to []byte failed")
+	}
+	return json.Unmarshal(b, s)
+}
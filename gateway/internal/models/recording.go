@@ -0,0 +1,45 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Recording formats
+const (
+	RecordingFormatSSH       = "ssh"       // Terminal output with a .timing file alongside
+	RecordingFormatGuacamole = "guacamole" // Timestamped Guacamole instructions of an RDP session
+)
+
+// Recording states of a session, set when it ends
+const (
+	RecordingStateStarted    = "started"     // Recorded, unless the recording failed to be catalogued
+	RecordingStateFailed     = "failed"      // The recording couldn't be started or finished
+	RecordingStateDisabled   = "disabled"    // The session's settings turn recording off
+	RecordingStateNotStarted = "not_started" // The session ended before its recording was to start
+)
+
+// Recording is a catalogued session recording
+type Recording struct {
+	ID         uuid.UUID `json:"id" db:"id"`
+	SessionID  uuid.UUID `json:"session_id" db:"session_id"`
+	Location   string    `json:"location" db:"location"` // File path, or object key in remote storage
+	Format     string    `json:"format" db:"format"`
+	Size       int64     `json:"size" db:"size"`
+	DurationMs int64     `json:"duration_ms" db:"duration_ms"`
+	SHA256     string    `json:"sha256" db:"sha256"` // Hex digest of the stored file
+	Encrypted  bool      `json:"encrypted" db:"encrypted"`
+	StartedAt  time.Time `json:"started_at" db:"started_at"`
+	CreatedAt  time.Time `json:"created_at" db:"created_at"`
+}
+
+// RecordingFilter narrows a recording search; zero fields match everything
+type RecordingFilter struct {
+	SessionID *uuid.UUID
+	Format    string
+	From      *time.Time // Started at or after
+	To        *time.Time // Started before
+	Limit     int
+	Offset    int
+}
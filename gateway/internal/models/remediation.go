@@ -0,0 +1,45 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// RemediationRun is an AWX/Ansible Tower job template launched after a session
+// ended or violated a policy, such as a playbook that rotates keys or verifies
+// the target's configuration. The session's details are passed as extra vars.
+type RemediationRun struct {
+	ID            uuid.UUID       `json:"id" db:"id"`
+	AuditLogID    uuid.UUID       `json:"audit_log_id" db:"audit_log_id"`
+	EventID       int64           `json:"event_id" db:"event_id"` // Event log entry that triggered the run
+	Trigger       string          `json:"trigger" db:"trigger_type"`
+	TemplateID    int             `json:"template_id" db:"template_id"`
+	ExtraVars     json.RawMessage `json:"extra_vars" db:"extra_vars"`
+	Status        string          `json:"status" db:"status"`
+	AWXJobID      *int64          `json:"awx_job_id,omitempty" db:"awx_job_id"`
+	JobURL        *string         `json:"job_url,omitempty" db:"job_url"`
+	Attempts      int             `json:"attempts" db:"attempts"` // Launch attempts
+	NextAttemptAt time.Time       `json:"-" db:"next_attempt_at"`
+	Error         *string         `json:"error,omitempty" db:"error"`
+	CreatedAt     time.Time       `json:"created_at" db:"created_at"`
+	UpdatedAt     time.Time       `json:"updated_at" db:"updated_at"`
+	FinishedAt    *time.Time      `json:"finished_at,omitempty" db:"finished_at"`
+}
+
+// Remediation triggers
+const (
+	RemediationTriggerSessionEnd = "session_end"
+	RemediationTriggerViolation  = "policy_violation"
+)
+
+// Remediation run status constants. A run is queued until the job is launched,
+// then follows the AWX job; AWX's "error" status is reported as failed.
+const (
+	RemediationStatusQueued     = "queued"
+	RemediationStatusRunning    = "running"
+	RemediationStatusSuccessful = "successful"
+	RemediationStatusFailed     = "failed"
+	RemediationStatusCanceled   = "canceled"
+)
@@ -0,0 +1,137 @@
+package models
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+)
+
+// ScheduledReport is a report rendered on a cron schedule and emailed to its recipients
+type ScheduledReport struct {
+	ID             uuid.UUID      `json:"id" db:"id"`
+	Name           string         `json:"name" db:"name"`
+	ReportType     string         `json:"report_type" db:"report_type"`
+	Format         string         `json:"format" db:"format"`
+	CronExpression string         `json:"cron_expression" db:"cron_expression"`
+	Timezone       string         `json:"timezone" db:"timezone"`
+	Filters        ReportFilters  `json:"filters" db:"filters"`
+	Recipients     pq.StringArray `json:"recipients" db:"recipients"`
+	Enabled        bool           `json:"enabled" db:"enabled"`
+	NextRunAt      *time.Time     `json:"next_run_at,omitempty" db:"next_run_at"`
+	LastRunAt      *time.Time     `json:"last_run_at,omitempty" db:"last_run_at"`
+	CreatedBy      *uuid.UUID     `json:"created_by,omitempty" db:"created_by"`
+	Version        int            `json:"version" db:"version"`
+	CreatedAt      time.Time      `json:"created_at" db:"created_at"`
+	UpdatedAt      time.Time      `json:"updated_at" db:"updated_at"`
+}
+
+// ReportFilters narrows the rows included in a report. Filters that don't apply
+// to the report type are ignored.
+type ReportFilters struct {
+	UserID          *uuid.UUID `json:"user_id,omitempty"`          // session_activity, system_audit
+	TargetID        *uuid.UUID `json:"target_id,omitempty"`        // session_activity
+	Status          string     `json:"status,omitempty"`           // session_activity, system_audit
+	Protocol        string     `json:"protocol,omitempty"`         // session_activity
+	Environment     string     `json:"environment,omitempty"`      // session_activity
+	ComplianceScope string     `json:"compliance_scope,omitempty"` // session_activity
+	EventType       string     `json:"event_type,omitempty"`       // system_audit
+	Role            string     `json:"role,omitempty"`             // access_review
+	Lookback        string     `json:"lookback,omitempty"`         // Period covered by the first run, e.g. "168h"
+}
+
+// Value implements the driver.Valuer interface
+func (f ReportFilters) Value() (driver.Value, error) {
+	return json.Marshal(f)
+}
+
+// Scan implements the sql.Scanner interface
+func (f *ReportFilters) Scan(value interface{}) error {
+	b, ok := value.([]byte)
+	if !ok {
+		return errors.New("type assertion to []byte failed")
+	}
+	return json.Unmarshal(b, f)
+}
+
+// ReportRun records one attempt to render and send a scheduled report
+type ReportRun struct {
+	ID           uuid.UUID  `json:"id" db:"id"`
+	ReportID     uuid.UUID  `json:"report_id" db:"report_id"`
+	Status       string     `json:"status" db:"status"`
+	PeriodStart  time.Time  `json:"period_start" db:"period_start"`
+	PeriodEnd    time.Time  `json:"period_end" db:"period_end"`
+	RowCount     int        `json:"row_count" db:"row_count"`
+	ErrorMessage *string    `json:"error_message,omitempty" db:"error_message"`
+	StartedAt    time.Time  `json:"started_at" db:"started_at"`
+	FinishedAt   *time.Time `json:"finished_at,omitempty" db:"finished_at"`
+}
+
+// AccessReviewEntry summarises one user's access during a report period
+type AccessReviewEntry struct {
+	Email         string         `db:"email"`
+	DisplayName   string         `db:"display_name"`
+	Role          string         `db:"role"`
+	Enabled       bool           `db:"enabled"`
+	LastLoginAt   *time.Time     `db:"last_login_at"`
+	Sessions      int            `db:"sessions"`
+	TargetNames   pq.StringArray `db:"target_names"`
+	LastSessionAt *time.Time     `db:"last_session_at"`
+}
+
+// SessionActivityEntry is a session with the user and target it belongs to
+type SessionActivityEntry struct {
+	StartTime       time.Time      `db:"start_time"`
+	EndTime         *time.Time     `db:"end_time"`
+	UserEmail       string         `db:"user_email"`
+	TargetName      string         `db:"target_name"`
+	Hostname        string         `db:"hostname"`
+	Environment     string         `db:"environment"`
+	OwnerTeam       string         `db:"owner_team"`
+	ComplianceScope pq.StringArray `db:"compliance_scope"`
+	RiskTier        string         `db:"risk_tier"`
+	Protocol        string         `db:"protocol"`
+	SessionStatus   string         `db:"session_status"`
+	ClientIP        *string        `db:"client_ip"`
+	BytesSent       int64          `db:"bytes_sent"`
+	BytesReceived   int64          `db:"bytes_received"`
+	Annotations     pq.StringArray `db:"annotations"` // Auditor annotations and bookmarks in playback order
+}
+
+// SystemAuditEntry is a system audit log entry with the acting user's email
+type SystemAuditEntry struct {
+	Timestamp    time.Time `db:"timestamp"`
+	EventType    string    `db:"event_type"`
+	UserEmail    *string   `db:"user_email"`
+	Action       string    `db:"action"`
+	Status       string    `db:"status"`
+	ResourceType *string   `db:"resource_type"`
+	ResourceName *string   `db:"resource_name"`
+	IPAddress    *string   `db:"ip_address"`
+}
+
+// Report type constants
+const (
+	ReportTypeAccessReview    = "access_review"
+	ReportTypeSessionActivity = "session_activity"
+	ReportTypeSystemAudit     = "system_audit"
+)
+
+// Report format constants
+const (
+	ReportFormatCSV = "csv"
+	ReportFormatPDF = "pdf"
+)
+
+// Report run status constants
+const (
+	ReportRunStatusRunning   = "running"
+	ReportRunStatusSucceeded = "succeeded"
+	ReportRunStatusFailed    = "failed"
+)
+
+// EventTypeReportFailed is the system audit event recorded when a scheduled report fails
+const EventTypeReportFailed = "report_failed"
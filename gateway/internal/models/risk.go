@@ -0,0 +1,113 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Risk tiers of targets, lowest first. A target's tier decides how many
+// approvals requests for it need.
+const (
+	RiskTierLow      = "low"
+	RiskTierMedium   = "medium"
+	RiskTierHigh     = "high"
+	RiskTierCritical = "critical"
+)
+
+// RiskTiers lists the risk tiers, lowest first
+var RiskTiers = []string{RiskTierLow, RiskTierMedium, RiskTierHigh, RiskTierCritical}
+
+// DefaultRiskTier is the tier of targets with no tier of their own or from
+// their labels
+const DefaultRiskTier = RiskTierMedium
+
+// ValidRiskTier reports whether tier is a known risk tier
+func ValidRiskTier(tier string) bool {
+	for _, t := range RiskTiers {
+		if t == tier {
+			return true
+		}
+	}
+	return false
+}
+
+// RiskTierLabel puts the targets carrying a label in a tier. An empty Value
+// matches the label with any value. A target with several such labels gets
+// the highest of their tiers.
+type RiskTierLabel struct {
+	Key       string     `json:"key" db:"label_key"`
+	Value     string     `json:"value,omitempty" db:"label_value"`
+	Tier      string     `json:"tier" db:"tier"`
+	CreatedBy *uuid.UUID `json:"created_by,omitempty" db:"created_by"`
+	CreatedAt time.Time  `json:"created_at" db:"created_at"`
+}
+
+// ApprovalQuorum is what a schedule request for a target of a tier needs to
+// be approved: Approvals from any approvers, plus GroupApprovals from members
+// of GroupID. Requests of AutoApprove tiers are approved when they are made.
+type ApprovalQuorum struct {
+	Tier           string     `json:"tier" db:"tier"`
+	AutoApprove    bool       `json:"auto_approve" db:"auto_approve"`
+	Approvals      int        `json:"approvals" db:"approvals"`
+	GroupID        *uuid.UUID `json:"group_id,omitempty" db:"group_id"`
+	GroupApprovals int        `json:"group_approvals" db:"group_approvals"`
+	Version        int        `json:"version" db:"version"`
+	UpdatedBy      *uuid.UUID `json:"updated_by,omitempty" db:"updated_by"`
+	UpdatedAt      time.Time  `json:"updated_at" db:"updated_at"`
+}
+
+// MaxQuorumApprovals limits the approvals a quorum can ask for
+const MaxQuorumApprovals = 10
+
+// Validate checks the quorum's settings
+func (q *ApprovalQuorum) Validate() error {
+	switch {
+	case q.Approvals < 0 || q.GroupApprovals < 0:
+		return errors.New("approvals can't be negative")
+	case q.Approvals+q.GroupApprovals > MaxQuorumApprovals:
+		return fmt.Errorf("a quorum can ask for at most %d approvals", MaxQuorumApprovals)
+	case q.GroupApprovals > 0 && q.GroupID == nil:
+		return errors.New("group_approvals needs a group_id")
+	case q.GroupID != nil && q.GroupApprovals == 0:
+		return errors.New("a group_id needs group_approvals")
+	case !q.AutoApprove && q.Approvals+q.GroupApprovals == 0:
+		return errors.New("a tier that isn't auto-approved needs at least one approval")
+	}
+	return nil
+}
+
+// Progress counts a schedule's approvals towards the quorum. approvals are
+// all of them, and groupApprovals those by members of the quorum's group.
+// Group members' approvals count towards the group first.
+func (q *ApprovalQuorum) Progress(approvals, groupApprovals int) *QuorumProgress {
+	p := &QuorumProgress{
+		Tier:                   q.Tier,
+		Approvals:              approvals,
+		RequiredApprovals:      q.Approvals + q.GroupApprovals,
+		GroupApprovals:         min(groupApprovals, q.GroupApprovals),
+		RequiredGroupApprovals: q.GroupApprovals,
+	}
+	p.Approved = q.AutoApprove || p.Approvals >= p.RequiredApprovals && p.GroupApprovals >= p.RequiredGroupApprovals
+	return p
+}
+
+// QuorumProgress is how far a schedule request is from its quorum
+type QuorumProgress struct {
+	Tier                   string `json:"risk_tier"`
+	Approvals              int    `json:"approvals"`
+	RequiredApprovals      int    `json:"required_approvals"` // Including the group's
+	GroupApprovals         int    `json:"group_approvals,omitempty"`
+	RequiredGroupApprovals int    `json:"required_group_approvals,omitempty"`
+	Approved               bool   `json:"approved"`
+}
+
+// System audit event types for risk tiers and approvals towards a quorum
+const (
+	EventTypeScheduleApprovalRecorded = "schedule_approval_recorded" // An approval that didn't complete the quorum
+	EventTypeApprovalQuorumUpdated    = "approval_quorum_updated"
+	EventTypeRiskTierLabelSet         = "risk_tier_label_set"
+	EventTypeRiskTierLabelDeleted     = "risk_tier_label_deleted"
+)
@@ -0,0 +1,67 @@
+package models
+
+import (
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+func TestApprovalQuorum_Validate(t *testing.T) {
+	group := uuid.New()
+	valid := []ApprovalQuorum{
+		{Tier: RiskTierLow, AutoApprove: true},
+		{Tier: RiskTierMedium, Approvals: 1},
+		{Tier: RiskTierCritical, Approvals: 2, GroupID: &group, GroupApprovals: 1},
+	}
+	for _, q := range valid {
+		if err := q.Validate(); err != nil {
+			t.Errorf("Validate(%+v) error = %v", q, err)
+		}
+	}
+
+	invalid := []ApprovalQuorum{
+		{Tier: RiskTierMedium},
+		{Tier: RiskTierMedium, Approvals: -1},
+		{Tier: RiskTierHigh, Approvals: MaxQuorumApprovals, GroupID: &group, GroupApprovals: 1},
+		{Tier: RiskTierHigh, Approvals: 1, GroupApprovals: 1},
+		{Tier: RiskTierHigh, Approvals: 1, GroupID: &group},
+	}
+	for _, q := range invalid {
+		if err := q.Validate(); err == nil {
+			t.Errorf("Validate(%+v) accepted the quorum", q)
+		}
+	}
+}
+
+func TestApprovalQuorum_Progress(t *testing.T) {
+	group := uuid.New()
+	critical := &ApprovalQuorum{Tier: RiskTierCritical, Approvals: 2, GroupID: &group, GroupApprovals: 1}
+
+	tests := []struct {
+		name           string
+		quorum         *ApprovalQuorum
+		approvals      int
+		groupApprovals int
+		want           bool
+	}{
+		{name: "auto-approved", quorum: &ApprovalQuorum{Tier: RiskTierLow, AutoApprove: true}, want: true},
+		{name: "one approver", quorum: &ApprovalQuorum{Tier: RiskTierMedium, Approvals: 1}, approvals: 1, want: true},
+		{name: "no approvals yet", quorum: &ApprovalQuorum{Tier: RiskTierMedium, Approvals: 1}},
+		{name: "enough approvers, no group member", quorum: critical, approvals: 3},
+		{name: "group member short of total", quorum: critical, approvals: 2, groupApprovals: 1},
+		{name: "two approvers and a group member", quorum: critical, approvals: 3, groupApprovals: 1, want: true},
+		{name: "group members count as approvers", quorum: critical, approvals: 3, groupApprovals: 3, want: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := tt.quorum.Progress(tt.approvals, tt.groupApprovals)
+			if p.Approved != tt.want {
+				t.Errorf("Progress(%d, %d).Approved = %v, want %v", tt.approvals, tt.groupApprovals, p.Approved, tt.want)
+			}
+			if p.RequiredApprovals != tt.quorum.Approvals+tt.quorum.GroupApprovals || p.GroupApprovals > tt.quorum.GroupApprovals {
+				t.Errorf("Progress() = %+v", p)
+			}
+		})
+	}
+}
@@ -0,0 +1,192 @@
+package models
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// SatelliteConfig is the configuration the hub pushes to the satellites of a zone
+type SatelliteConfig struct {
+	ZoneID    uuid.UUID     `json:"zone_id" db:"zone_id"`
+	Revision  int           `json:"revision" db:"revision"`
+	Values    ConfigValues  `json:"values" db:"config_values"` // Environment variable overrides
+	UpdatedBy uuid.NullUUID `json:"updated_by" db:"updated_by"`
+	UpdatedAt time.Time     `json:"updated_at" db:"updated_at"`
+}
+
+// ConfigValues maps environment variable names to values
+type ConfigValues map[string]string
+
+// Value implements the driver.Valuer interface
+func (v ConfigValues) Value() (driver.Value, error) {
+	if v == nil {
+		return []byte("{}"), nil
+	}
+	return json.Marshal(v)
+}
+
+// Scan implements the sql.Scanner interface
+func (v *ConfigValues) Scan(value interface{}) error {
+	b, ok := value.([]byte)
+	if !ok {
+		return errors.New("type assertion to []byte failed")
+	}
+	return json.Unmarshal(b, v)
+}
+
+// Rollout statuses
+const (
+	RolloutStatusActive    = "active"
+	RolloutStatusPaused    = "paused"
+	RolloutStatusCompleted = "completed"
+	RolloutStatusFailed    = "failed"
+	RolloutStatusCancelled = "cancelled"
+)
+
+// SatelliteRollout delivers a signed satellite build to zones stage by stage
+type SatelliteRollout struct {
+	ID           uuid.UUID     `json:"id" db:"id"`
+	Version      string        `json:"version" db:"version"`
+	URL          string        `json:"url" db:"url"`
+	SHA256       string        `json:"sha256" db:"sha256"` // Hex digest of the binary
+	Size         int64         `json:"size" db:"size"`     // Binary size in bytes
+	Stages       RolloutStages `json:"stages" db:"stages"`
+	CurrentStage int           `json:"current_stage" db:"current_stage"`
+	Status       string        `json:"status" db:"status"`
+	Error        *string       `json:"error,omitempty" db:"error"`
+	CreatedBy    uuid.NullUUID `json:"created_by" db:"created_by"`
+	CreatedAt    time.Time     `json:"created_at" db:"created_at"`
+	UpdatedAt    time.Time     `json:"updated_at" db:"updated_at"`
+}
+
+// InCurrentStage reports whether the zone is in the stage being rolled out
+func (r *SatelliteRollout) InCurrentStage(zoneID uuid.UUID) bool {
+	if r.CurrentStage >= len(r.Stages) {
+		return false
+	}
+	for _, id := range r.Stages[r.CurrentStage] {
+		if id == zoneID {
+			return true
+		}
+	}
+	return false
+}
+
+// RolloutStages lists the zones of each rollout stage, in order
+type RolloutStages [][]uuid.UUID
+
+// Value implements the driver.Valuer interface
+func (s RolloutStages) Value() (driver.Value, error) {
+	if s == nil {
+		return []byte("[]"), nil
+	}
+	return json.Marshal(s)
+}
+
+// Scan implements the sql.Scanner interface
+func (s *RolloutStages) Scan(value interface{}) error {
+	b, ok := value.([]byte)
+	if !ok {
+		return errors.New("type assertion to []byte failed")
+	}
+	return json.Unmarshal(b, s)
+}
+
+// Satellite update states
+const (
+	UpdateStateApplying   = "applying"    // Installed and restarting, waiting for the health check
+	UpdateStateHealthy    = "healthy"     // Passed the health check
+	UpdateStateRolledBack = "rolled_back" // Failed the health check and was reverted
+	UpdateStateFailed     = "failed"      // Could not be downloaded, verified or installed
+)
+
+// SatelliteStatus is the last status a satellite reported to the hub
+type SatelliteStatus struct {
+	ZoneID         uuid.UUID     `json:"zone_id" db:"zone_id"`
+	Version        string        `json:"version" db:"version"`
+	ConfigRevision int           `json:"config_revision" db:"config_revision"`
+	RolloutID      uuid.NullUUID `json:"rollout_id" db:"rollout_id"`
+	UpdateState    *string       `json:"update_state,omitempty" db:"update_state"`
+	UpdateError    *string       `json:"update_error,omitempty" db:"update_error"`
+	ReportedAt     time.Time     `json:"reported_at" db:"reported_at"`
+}
+
+// Satellite management audit event types
+const (
+	EventTypeSatelliteConfigUpdated = "satellite_config_updated"
+	EventTypeRolloutCreated         = "satellite_rollout_created"
+	EventTypeRolloutUpdated         = "satellite_rollout_updated"
+)
+
+// SatelliteMetricsSnapshot is a satellite's runtime metrics at one point in time
+type SatelliteMetricsSnapshot struct {
+	CollectedAt           time.Time  `json:"collected_at"`
+	Version               string     `json:"version"`
+	UptimeSeconds         int64      `json:"uptime_seconds"`
+	Goroutines            int        `json:"goroutines"`
+	HeapAllocBytes        uint64     `json:"heap_alloc_bytes"`
+	SysBytes              uint64     `json:"sys_bytes"`
+	NumGC                 uint32     `json:"num_gc"`
+	ActiveConnections     int64      `json:"active_connections"`
+	SpooledSessions       int        `json:"spooled_sessions"`                   // Offline sessions waiting for upload
+	PolicyBundleExpiresAt *time.Time `json:"policy_bundle_expires_at,omitempty"` // Expiry of the cached policy bundle
+	LogsDropped           int64      `json:"logs_dropped"`                       // Log messages not forwarded since start
+}
+
+// Value implements the driver.Valuer interface
+func (m SatelliteMetricsSnapshot) Value() (driver.Value, error) {
+	return json.Marshal(m)
+}
+
+// Scan implements the sql.Scanner interface
+func (m *SatelliteMetricsSnapshot) Scan(value interface{}) error {
+	b, ok := value.([]byte)
+	if !ok {
+		return errors.New("type assertion to []byte failed")
+	}
+	return json.Unmarshal(b, m)
+}
+
+// SatelliteMetrics is a metrics snapshot stored by the hub
+type SatelliteMetrics struct {
+	ID          int64                    `json:"id" db:"id"`
+	ZoneID      uuid.UUID                `json:"zone_id" db:"zone_id"`
+	Metrics     SatelliteMetricsSnapshot `json:"metrics" db:"metrics"`
+	CollectedAt time.Time                `json:"collected_at" db:"collected_at"`
+	ReceivedAt  time.Time                `json:"received_at" db:"received_at"`
+}
+
+// SatelliteLog is a log message a satellite forwarded to the hub
+type SatelliteLog struct {
+	ID         int64     `json:"id" db:"id"`
+	ZoneID     uuid.UUID `json:"zone_id" db:"zone_id"`
+	LoggedAt   time.Time `json:"logged_at" db:"logged_at"`
+	Level      string    `json:"level" db:"level"` // "DEBUG", "INFO", "WARN" or "ERROR"
+	Message    string    `json:"message" db:"message"`
+	Fields     LogFields `json:"fields" db:"fields"`
+	ReceivedAt time.Time `json:"received_at" db:"received_at"`
+}
+
+// LogFields holds a log message's fields as text
+type LogFields map[string]string
+
+// Value implements the driver.Valuer interface
+func (f LogFields) Value() (driver.Value, error) {
+	if f == nil {
+		return []byte("{}"), nil
+	}
+	return json.Marshal(f)
+}
+
+// Scan implements the sql.Scanner interface
+func (f *LogFields) Scan(value interface{}) error {
+	b, ok := value.([]byte)
+	if !ok {
+		return errors.New("type assertion to []byte failed")
+	}
+	return json.Unmarshal(b, f)
+}
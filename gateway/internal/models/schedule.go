@@ -6,6 +6,7 @@ import (
 	"errors"
 	"time"
 
+	"github.com/VanCannon/openpam/gateway/internal/recurrence"
 	"github.com/google/uuid"
 )
 
@@ -30,6 +31,7 @@ type Schedule struct {
 	Timezone        string         `json:"timezone" db:"timezone"`
 	Status          ScheduleStatus `json:"status" db:"status"`
 	CreatedBy       *uuid.UUID     `json:"created_by,omitempty" db:"created_by"`
+	UpdatedBy       *uuid.UUID     `json:"updated_by,omitempty" db:"updated_by"`
 	CreatedAt       time.Time      `json:"created_at" db:"created_at"`
 	UpdatedAt       time.Time      `json:"updated_at" db:"updated_at"`
 	Metadata        JSONB          `json:"metadata,omitempty" db:"metadata"`
@@ -37,6 +39,157 @@ type Schedule struct {
 	RejectionReason *string        `json:"rejection_reason,omitempty" db:"rejection_reason"`
 	ApprovedBy      *uuid.UUID     `json:"approved_by,omitempty" db:"approved_by"`
 	ApprovedAt      *time.Time     `json:"approved_at,omitempty" db:"approved_at"`
+	BatchID         *uuid.UUID     `json:"batch_id,omitempty" db:"batch_id"`   // Set when created in a linked bulk request
+	RiskTier        *string        `json:"risk_tier,omitempty" db:"risk_tier"` // The target's tier when requested
+	Version         int            `json:"version" db:"version"`
+
+	// The window the requester asked for, set when an approver changed it
+	RequestedStartTime *time.Time `json:"requested_start_time,omitempty" db:"requested_start_time"`
+	RequestedEndTime   *time.Time `json:"requested_end_time,omitempty" db:"requested_end_time"`
+}
+
+// System audit event types for schedules starting and ending
+const (
+	EventTypeScheduleActivated = "schedule_activated"
+	EventTypeScheduleExpired   = "schedule_expired"
+)
+
+// ScheduleBatch links the schedules created by one bulk request so they can
+// be approved or revoked together
+type ScheduleBatch struct {
+	ID        uuid.UUID  `json:"id" db:"id"`
+	Name      *string    `json:"name,omitempty" db:"name"`
+	CreatedBy *uuid.UUID `json:"created_by,omitempty" db:"created_by"`
+	CreatedAt time.Time  `json:"created_at" db:"created_at"`
+}
+
+// System audit event types for bulk schedules
+const (
+	EventTypeScheduleBatchCreated = "schedule_batch_created"
+	EventTypeScheduleRevoked      = "schedule_revoked"
+)
+
+// ScheduleExtension is a request to move the end of a running schedule's
+// window. The approved extensions of a schedule, oldest first, form its
+// extension chain: each moves the end from PreviousEndTime to NewEndTime.
+type ScheduleExtension struct {
+	ID              uuid.UUID  `json:"id" db:"id"`
+	ScheduleID      uuid.UUID  `json:"schedule_id" db:"schedule_id"`
+	RequestedBy     *uuid.UUID `json:"requested_by,omitempty" db:"requested_by"`
+	Minutes         int        `json:"minutes" db:"minutes"`
+	Reason          *string    `json:"reason,omitempty" db:"reason"`
+	Status          string     `json:"status" db:"status"`
+	AutoApproved    bool       `json:"auto_approved" db:"auto_approved"`
+	DecidedBy       *uuid.UUID `json:"decided_by,omitempty" db:"decided_by"`
+	DecidedAt       *time.Time `json:"decided_at,omitempty" db:"decided_at"`
+	RejectionReason *string    `json:"rejection_reason,omitempty" db:"rejection_reason"`
+	PreviousEndTime *time.Time `json:"previous_end_time,omitempty" db:"previous_end_time"` // Set once approved
+	NewEndTime      *time.Time `json:"new_end_time,omitempty" db:"new_end_time"`
+	CreatedAt       time.Time  `json:"created_at" db:"created_at"`
+}
+
+// In converts the extension's times to loc for display
+func (e *ScheduleExtension) In(loc *time.Location) {
+	e.CreatedAt = e.CreatedAt.In(loc)
+	e.DecidedAt = timeIn(e.DecidedAt, loc)
+	e.PreviousEndTime = timeIn(e.PreviousEndTime, loc)
+	e.NewEndTime = timeIn(e.NewEndTime, loc)
+}
+
+// Schedule extension status constants
+const (
+	ExtensionStatusPending  = "pending"
+	ExtensionStatusApproved = "approved"
+	ExtensionStatusRejected = "rejected"
+)
+
+// System audit event types for schedule extensions
+const (
+	EventTypeScheduleExtensionRequested = "schedule_extension_requested"
+	EventTypeScheduleExtended           = "schedule_extended"
+	EventTypeScheduleExtensionRejected  = "schedule_extension_rejected"
+)
+
+// Location returns the timezone the schedule's recurrence is evaluated in,
+// UTC when it is unset or unknown
+func (s *Schedule) Location() *time.Location {
+	if s.Timezone == "" {
+		return time.UTC
+	}
+	loc, err := time.LoadLocation(s.Timezone)
+	if err != nil {
+		return time.UTC
+	}
+	return loc
+}
+
+// In converts the schedule's times to loc for display
+func (s *Schedule) In(loc *time.Location) {
+	s.StartTime = s.StartTime.In(loc)
+	s.EndTime = s.EndTime.In(loc)
+	s.CreatedAt = s.CreatedAt.In(loc)
+	s.UpdatedAt = s.UpdatedAt.In(loc)
+	s.ApprovedAt = timeIn(s.ApprovedAt, loc)
+	s.RequestedStartTime = timeIn(s.RequestedStartTime, loc)
+	s.RequestedEndTime = timeIn(s.RequestedEndTime, loc)
+}
+
+// timeIn converts an optional time to loc
+func timeIn(t *time.Time, loc *time.Location) *time.Time {
+	if t == nil {
+		return nil
+	}
+	converted := t.In(loc)
+	return &converted
+}
+
+// NextWindow returns the first window of the schedule that ends after now.
+// A recurring schedule's windows repeat from its start and end times by its
+// recurrence rule; a rule that doesn't parse is taken as no recurrence. It
+// returns false when the schedule has no window left.
+func (s *Schedule) NextWindow(now time.Time) (start, end time.Time, ok bool) {
+	if s.RecurrenceRule != nil && *s.RecurrenceRule != "" {
+		if rule, err := recurrence.Parse(*s.RecurrenceRule); err == nil {
+			length := s.EndTime.Sub(s.StartTime)
+			start, ok := rule.Next(s.StartTime.In(s.Location()), length, now)
+			return start, start.Add(length), ok
+		}
+	}
+	return s.StartTime, s.EndTime, s.EndTime.After(now)
+}
+
+// WindowAt returns the window of the schedule that includes now
+func (s *Schedule) WindowAt(now time.Time) (start, end time.Time, ok bool) {
+	start, end, ok = s.NextWindow(now)
+	return start, end, ok && !now.Before(start)
+}
+
+// Ended reports whether the schedule has no window left after now
+func (s *Schedule) Ended(now time.Time) bool {
+	_, _, ok := s.NextWindow(now)
+	return !ok
+}
+
+// SetPurpose records in the schedule's metadata the purpose and reason the
+// requester gave, for approvers to see
+func (s *Schedule) SetPurpose(purpose, reason string) {
+	if purpose == "" {
+		return
+	}
+	if s.Metadata == nil {
+		s.Metadata = JSONB{}
+	}
+	s.Metadata["purpose"] = purpose
+	if reason != "" {
+		s.Metadata["reason"] = reason
+	}
+}
+
+// Purpose returns the purpose and reason the requester gave, if any
+func (s *Schedule) Purpose() (purpose, reason string) {
+	purpose, _ = s.Metadata["purpose"].(string)
+	reason, _ = s.Metadata["reason"].(string)
+	return purpose, reason
 }
 
 // JSONB is a wrapper for JSONB fields
@@ -0,0 +1,105 @@
+package models
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+// SessionSettings are the session controls set on a zone, a target or a
+// credential rule. Unset fields inherit from the level above.
+type SessionSettings struct {
+	Recording         *bool    `json:"recording,omitempty"`          // Whether sessions are recorded
+	RecordingRequired *bool    `json:"recording_required,omitempty"` // Whether sessions are refused when their recording can't start
+	IdleTimeout       *int     `json:"idle_timeout,omitempty"`       // Seconds without client input before a session is closed (0 = never)
+	MaxDuration       *int     `json:"max_duration,omitempty"`       // Seconds a session may last (0 = unlimited)
+	AllowedProtocols  []string `json:"allowed_protocols,omitempty"`  // Protocols sessions may use (empty = all)
+	MaxSessions       *int     `json:"max_sessions,omitempty"`       // Sessions the target may have at once (0 = unlimited)
+	QueueWait         *int     `json:"queue_wait,omitempty"`         // Seconds a user may wait for a free session slot (0 = refused at once)
+	RequirePurpose    *bool    `json:"require_purpose,omitempty"`    // Whether users must give a purpose when connecting
+
+	// RDP audio redirection
+	AudioOutput    *bool `json:"audio_output,omitempty"`    // Whether the target's sound is played to the client
+	AudioInput     *bool `json:"audio_input,omitempty"`     // Whether the client's microphone is passed to the target
+	AudioRecording *bool `json:"audio_recording,omitempty"` // Whether audio is kept in session recordings
+
+	// How the session is identified to the target, so its logs can be matched
+	// to the audit log: one of the InjectMetadata constants
+	InjectMetadata *string `json:"inject_metadata,omitempty"`
+
+	// Pre-session banner, only valid on zones and targets
+	Banner         *string `json:"banner,omitempty"`          // Notice shown before connecting, such as a monitoring notice ("" = none)
+	BannerRequired *bool   `json:"banner_required,omitempty"` // Whether sessions are refused until the user acknowledges the banner
+
+	// Satellite tunnel parameters, only valid on zones
+	TunnelDialTimeout  *int `json:"tunnel_dial_timeout,omitempty"`  // Seconds a satellite waits for a target to accept
+	TunnelSyncInterval *int `json:"tunnel_sync_interval,omitempty"` // Seconds between policy bundle pushes
+}
+
+// How sessions are identified to their targets. Any mode but off names RDP
+// sessions' client after the session.
+const (
+	InjectMetadataOff    = "off"
+	InjectMetadataEnv    = "env"    // SSH: OPENPAM_USER and OPENPAM_SESSION, or the banner line where the server refuses them
+	InjectMetadataBanner = "banner" // SSH: a comment line naming the user and session, typed into the shell
+)
+
+// Validate checks the settings. Tunnel parameters are only accepted on zones.
+func (s *SessionSettings) Validate(zone bool) error {
+	if s.IdleTimeout != nil && *s.IdleTimeout < 0 {
+		return fmt.Errorf("idle_timeout must not be negative")
+	}
+	if s.MaxDuration != nil && *s.MaxDuration < 0 {
+		return fmt.Errorf("max_duration must not be negative")
+	}
+	if s.MaxSessions != nil && *s.MaxSessions < 0 {
+		return fmt.Errorf("max_sessions must not be negative")
+	}
+	if s.QueueWait != nil && *s.QueueWait < 0 {
+		return fmt.Errorf("queue_wait must not be negative")
+	}
+	if s.Banner != nil && len(*s.Banner) > MaxBannerLength {
+		return fmt.Errorf("banner must be at most %d characters", MaxBannerLength)
+	}
+	if s.InjectMetadata != nil {
+		switch *s.InjectMetadata {
+		case InjectMetadataOff, InjectMetadataEnv, InjectMetadataBanner:
+		default:
+			return fmt.Errorf("unknown inject_metadata mode %q", *s.InjectMetadata)
+		}
+	}
+	for _, p := range s.AllowedProtocols {
+		if !ValidProtocol(p) {
+			return fmt.Errorf("unknown protocol %q in allowed_protocols", p)
+		}
+	}
+
+	if !zone {
+		if s.TunnelDialTimeout != nil || s.TunnelSyncInterval != nil {
+			return fmt.Errorf("tunnel settings can only be set on a zone")
+		}
+		return nil
+	}
+	if s.TunnelDialTimeout != nil && *s.TunnelDialTimeout <= 0 {
+		return fmt.Errorf("tunnel_dial_timeout must be positive")
+	}
+	if s.TunnelSyncInterval != nil && *s.TunnelSyncInterval <= 0 {
+		return fmt.Errorf("tunnel_sync_interval must be positive")
+	}
+	return nil
+}
+
+// Value implements the driver.Valuer interface
+func (s SessionSettings) Value() (driver.Value, error) {
+	return json.Marshal(s)
+}
+
+// Scan implements the sql.Scanner interface
+func (s *SessionSettings) Scan(value interface{}) error {
+	b, ok := value.([]byte)
+	if !ok {
+		return errors.New("type assertion to []byte failed")
+	}
+	return json.Unmarshal(b, s)
+}
@@ -0,0 +1,120 @@
+package models
+
+import (
+	"fmt"
+
+	"github.com/VanCannon/openpam/pkg/types"
+	"github.com/google/uuid"
+)
+
+// Shared returns the user in the representation shared with other services
+func (u *User) Shared() types.User {
+	return types.User{
+		ID:          u.ID.String(),
+		EntraID:     u.EntraID,
+		Email:       u.Email,
+		DisplayName: u.DisplayName,
+		Role:        u.Role,
+		Enabled:     u.Enabled,
+		Source:      u.Source,
+		CreatedAt:   u.CreatedAt,
+		LastLoginAt: u.LastLoginAt,
+	}
+}
+
+// Shared returns the target in the representation shared with other services
+func (t *Target) Shared() types.Target {
+	return types.Target{
+		ID:        t.ID.String(),
+		ZoneID:    t.ZoneID.String(),
+		Name:      t.Name,
+		Hostname:  t.Hostname,
+		Protocol:  t.Protocol,
+		Port:      t.Port,
+		Enabled:   t.Enabled,
+		CreatedAt: t.CreatedAt,
+		UpdatedAt: t.UpdatedAt,
+
+		OwnerTeam:       t.OwnerTeam,
+		Environment:     t.Environment,
+		ComplianceScope: t.ComplianceScope,
+		Labels:          t.Labels,
+		ConnectionNotes: t.ConnectionNotes,
+	}
+}
+
+// Shared returns the schedule in the representation shared with other services
+func (s *Schedule) Shared() types.Schedule {
+	return types.Schedule{
+		ID:              s.ID.String(),
+		UserID:          s.UserID.String(),
+		TargetID:        s.TargetID.String(),
+		StartTime:       s.StartTime,
+		EndTime:         s.EndTime,
+		RecurrenceRule:  s.RecurrenceRule,
+		Timezone:        s.Timezone,
+		Status:          string(s.Status),
+		ApprovalStatus:  s.ApprovalStatus,
+		RejectionReason: s.RejectionReason,
+		ApprovedBy:      uuidString(s.ApprovedBy),
+		ApprovedAt:      s.ApprovedAt,
+		CreatedBy:       uuidString(s.CreatedBy),
+		CreatedAt:       s.CreatedAt,
+		UpdatedAt:       s.UpdatedAt,
+		Metadata:        s.Metadata,
+	}
+}
+
+// ScheduleFromShared converts a schedule received from another service
+func ScheduleFromShared(in types.Schedule) (*Schedule, error) {
+	s := &Schedule{
+		StartTime:       in.StartTime,
+		EndTime:         in.EndTime,
+		RecurrenceRule:  in.RecurrenceRule,
+		Timezone:        in.Timezone,
+		Status:          ScheduleStatus(in.Status),
+		ApprovalStatus:  in.ApprovalStatus,
+		RejectionReason: in.RejectionReason,
+		ApprovedAt:      in.ApprovedAt,
+		CreatedAt:       in.CreatedAt,
+		UpdatedAt:       in.UpdatedAt,
+		Metadata:        in.Metadata,
+	}
+
+	var err error
+	if s.ID, err = uuid.Parse(in.ID); err != nil {
+		return nil, fmt.Errorf("invalid schedule id: %w", err)
+	}
+	if s.UserID, err = uuid.Parse(in.UserID); err != nil {
+		return nil, fmt.Errorf("invalid user id: %w", err)
+	}
+	if s.TargetID, err = uuid.Parse(in.TargetID); err != nil {
+		return nil, fmt.Errorf("invalid target id: %w", err)
+	}
+	if s.ApprovedBy, err = parseOptionalUUID(in.ApprovedBy); err != nil {
+		return nil, fmt.Errorf("invalid approver id: %w", err)
+	}
+	if s.CreatedBy, err = parseOptionalUUID(in.CreatedBy); err != nil {
+		return nil, fmt.Errorf("invalid creator id: %w", err)
+	}
+	return s, nil
+}
+
+func uuidString(id *uuid.UUID) *string {
+	if id == nil {
+		return nil
+	}
+	s := id.String()
+	return &s
+}
+
+func parseOptionalUUID(s *string) (*uuid.UUID, error) {
+	if s == nil {
+		return nil, nil
+	}
+	id, err := uuid.Parse(*s)
+	if err != nil {
+		return nil, err
+	}
+	return &id, nil
+}
@@ -0,0 +1,61 @@
+package models
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/VanCannon/openpam/pkg/types"
+	"github.com/google/uuid"
+)
+
+// The gateway's API payloads must stay compatible with the shared types
+func TestSharedContracts(t *testing.T) {
+	for _, tt := range []struct {
+		payload, canonical interface{}
+	}{
+		{User{}, types.User{}},
+		{Target{}, types.Target{}},
+		{Schedule{}, types.Schedule{}},
+	} {
+		if err := types.CheckContract(tt.payload, tt.canonical); err != nil {
+			t.Error(err)
+		}
+	}
+}
+
+func TestScheduleShared_RoundTrip(t *testing.T) {
+	approver := uuid.New()
+	rule := "FREQ=DAILY"
+	now := time.Now().UTC().Truncate(time.Second)
+	s := &Schedule{
+		ID:             uuid.New(),
+		UserID:         uuid.New(),
+		TargetID:       uuid.New(),
+		StartTime:      now,
+		EndTime:        now.Add(time.Hour),
+		RecurrenceRule: &rule,
+		Timezone:       "Europe/Paris",
+		Status:         ScheduleStatusActive,
+		ApprovalStatus: types.ApprovalStatusApproved,
+		ApprovedBy:     &approver,
+		ApprovedAt:     &now,
+		CreatedAt:      now,
+		UpdatedAt:      now,
+		Metadata:       JSONB{"ticket": "CHG-1"},
+	}
+
+	got, err := ScheduleFromShared(s.Shared())
+	if err != nil {
+		t.Fatalf("ScheduleFromShared() error = %v", err)
+	}
+	if !reflect.DeepEqual(got, s) {
+		t.Errorf("round trip = %+v, want %+v", got, s)
+	}
+
+	shared := s.Shared()
+	shared.UserID = "not-a-uuid"
+	if _, err := ScheduleFromShared(shared); err == nil {
+		t.Error("ScheduleFromShared() accepted an invalid user id")
+	}
+}
@@ -0,0 +1,86 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// SSHKey is a public key in the authorized_keys file of a target account that
+// OpenPAM keeps track of: either one it generated and deployed, whose private
+// key is held in Vault behind a credential, or one found on the target that an
+// admin approved. Any other key found on the account is drift.
+type SSHKey struct {
+	ID           uuid.UUID  `json:"id" db:"id"`
+	TargetID     uuid.UUID  `json:"target_id" db:"target_id"`
+	TargetName   string     `json:"target_name,omitempty" db:"target_name"`
+	Username     string     `json:"username" db:"username"`
+	KeyType      string     `json:"key_type" db:"key_type"`
+	Fingerprint  string     `json:"fingerprint" db:"fingerprint"`
+	PublicKey    string     `json:"public_key" db:"public_key"`
+	Source       string     `json:"source" db:"source"`
+	CredentialID *uuid.UUID `json:"credential_id,omitempty" db:"credential_id"`
+	Status       string     `json:"status" db:"status"`
+	CreatedBy    *uuid.UUID `json:"created_by,omitempty" db:"created_by"`
+	CreatedAt    time.Time  `json:"created_at" db:"created_at"`
+	RemovedAt    *time.Time `json:"removed_at,omitempty" db:"removed_at"`
+}
+
+// SSH key source constants
+const (
+	SSHKeySourceManaged  = "managed"
+	SSHKeySourceApproved = "approved"
+)
+
+// SSH key status constants
+const (
+	SSHKeyActive  = "active"
+	SSHKeyRemoved = "removed"
+)
+
+// SSHKeyDrift is a difference between the keys tracked for an account and the
+// keys a discovery scan found: an unauthorized key added out-of-band, or a
+// tracked key that was removed from the target
+type SSHKeyDrift struct {
+	ID          uuid.UUID  `json:"id" db:"id"`
+	TargetID    uuid.UUID  `json:"target_id" db:"target_id"`
+	TargetName  string     `json:"target_name,omitempty" db:"target_name"`
+	Username    string     `json:"username" db:"username"`
+	Kind        string     `json:"kind" db:"kind"`
+	KeyType     string     `json:"key_type" db:"key_type"`
+	Fingerprint string     `json:"fingerprint" db:"fingerprint"`
+	PublicKey   string     `json:"public_key" db:"public_key"`
+	Comment     string     `json:"comment,omitempty" db:"comment"`
+	SSHKeyID    *uuid.UUID `json:"ssh_key_id,omitempty" db:"ssh_key_id"`
+	ScanID      *uuid.UUID `json:"scan_id,omitempty" db:"scan_id"`
+	DetectedAt  time.Time  `json:"detected_at" db:"detected_at"`
+	ResolvedAt  *time.Time `json:"resolved_at,omitempty" db:"resolved_at"`
+	Resolution  *string    `json:"resolution,omitempty" db:"resolution"`
+	ResolvedBy  *uuid.UUID `json:"resolved_by,omitempty" db:"resolved_by"`
+}
+
+// SSH key drift kinds
+const (
+	SSHKeyDriftUnauthorized = "unauthorized"
+	SSHKeyDriftMissing      = "missing"
+)
+
+// SSH key drift resolutions
+const (
+	SSHKeyDriftApproved   = "approved"
+	SSHKeyDriftRemoved    = "removed"
+	SSHKeyDriftRedeployed = "redeployed"
+	SSHKeyDriftCleared    = "cleared" // A later scan no longer saw it
+)
+
+// CredentialTagSSHKey tags the credentials holding the private keys of managed SSH keys
+const CredentialTagSSHKey = "ssh-key"
+
+// System audit event types for SSH key management
+const (
+	EventTypeSSHKeyDeployed = "ssh_key_deployed"
+	EventTypeSSHKeyRotated  = "ssh_key_rotated"
+	EventTypeSSHKeyRemoved  = "ssh_key_removed"
+	EventTypeSSHKeyApproved = "ssh_key_approved"
+	EventTypeSSHKeyDrift    = "ssh_key_drift"
+)
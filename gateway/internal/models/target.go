@@ -0,0 +1,162 @@
+package models
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// Limits of target metadata
+const (
+	MaxTargetLabels          = 50
+	MaxUserAttributes        = 50
+	MaxLabelValueLength      = 256
+	MaxOwnerTeamLength       = 100
+	MaxConnectionNotesLength = 10000
+)
+
+// metadataKey matches label keys, environments and compliance scopes: lower
+// case, starting with a letter or digit, such as "pci-dss" or "team.payments"
+var metadataKey = regexp.MustCompile(`^[a-z0-9][a-z0-9._/-]{0,62}$`)
+
+// Labels are custom key-value pairs on a target, or the attributes of a user
+type Labels map[string]string
+
+// Value implements the driver.Valuer interface
+func (l Labels) Value() (driver.Value, error) {
+	if l == nil {
+		return []byte("{}"), nil
+	}
+	return json.Marshal(l)
+}
+
+// Scan implements the sql.Scanner interface
+func (l *Labels) Scan(value interface{}) error {
+	b, ok := value.([]byte)
+	if !ok {
+		return errors.New("type assertion to []byte failed")
+	}
+	return json.Unmarshal(b, l)
+}
+
+// Keys returns the label keys in order
+func (l Labels) Keys() []string {
+	keys := make([]string, 0, len(l))
+	for k := range l {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// ParseLabelSelector parses a "key=value" label filter; a bare key matches
+// any value
+func ParseLabelSelector(s string) (key, value string, err error) {
+	key, value, _ = strings.Cut(s, "=")
+	key = strings.ToLower(strings.TrimSpace(key))
+	if !metadataKey.MatchString(key) {
+		return "", "", fmt.Errorf("invalid label %q", s)
+	}
+	return key, strings.TrimSpace(value), nil
+}
+
+// NormalizeMetadata trims the target's metadata, lower-cases its environment
+// and compliance scopes, sorts the scopes, and checks the result
+func (t *Target) NormalizeMetadata() error {
+	t.OwnerTeam = strings.TrimSpace(t.OwnerTeam)
+	if utf8.RuneCountInString(t.OwnerTeam) > MaxOwnerTeamLength {
+		return fmt.Errorf("owner_team must be at most %d characters", MaxOwnerTeamLength)
+	}
+
+	t.Environment = strings.ToLower(strings.TrimSpace(t.Environment))
+	if t.Environment != "" && !metadataKey.MatchString(t.Environment) {
+		return fmt.Errorf("invalid environment %q", t.Environment)
+	}
+
+	if t.RiskTier != nil && *t.RiskTier == "" {
+		t.RiskTier = nil
+	}
+	if t.RiskTier != nil && !ValidRiskTier(*t.RiskTier) {
+		return fmt.Errorf("invalid risk_tier %q", *t.RiskTier)
+	}
+
+	seen := make(map[string]bool)
+	scopes := t.ComplianceScope[:0]
+	for _, scope := range t.ComplianceScope {
+		scope = strings.ToLower(strings.TrimSpace(scope))
+		if !metadataKey.MatchString(scope) {
+			return fmt.Errorf("invalid compliance scope %q", scope)
+		}
+		if !seen[scope] {
+			seen[scope] = true
+			scopes = append(scopes, scope)
+		}
+	}
+	sort.Strings(scopes)
+	t.ComplianceScope = scopes
+
+	if len(t.Labels) > MaxTargetLabels {
+		return fmt.Errorf("a target can have at most %d labels", MaxTargetLabels)
+	}
+	labels := make(Labels, len(t.Labels))
+	for k, v := range t.Labels {
+		k = strings.ToLower(strings.TrimSpace(k))
+		if !metadataKey.MatchString(k) {
+			return fmt.Errorf("invalid label key %q", k)
+		}
+		v = strings.TrimSpace(v)
+		if utf8.RuneCountInString(v) > MaxLabelValueLength {
+			return fmt.Errorf("label %s must be at most %d characters", k, MaxLabelValueLength)
+		}
+		labels[k] = v
+	}
+	t.Labels = labels
+
+	if utf8.RuneCountInString(t.ConnectionNotes) > MaxConnectionNotesLength {
+		return fmt.Errorf("connection_notes must be at most %d characters", MaxConnectionNotesLength)
+	}
+	return nil
+}
+
+// NormalizeAttributes trims the user's attributes and lower-cases their keys,
+// which follow the rules of label keys, and checks the result
+func (u *User) NormalizeAttributes() error {
+	if len(u.Attributes) > MaxUserAttributes {
+		return fmt.Errorf("a user can have at most %d attributes", MaxUserAttributes)
+	}
+	attributes := make(Labels, len(u.Attributes))
+	for k, v := range u.Attributes {
+		k = strings.ToLower(strings.TrimSpace(k))
+		if !metadataKey.MatchString(k) {
+			return fmt.Errorf("invalid attribute key %q", k)
+		}
+		v = strings.TrimSpace(v)
+		if utf8.RuneCountInString(v) > MaxLabelValueLength {
+			return fmt.Errorf("attribute %s must be at most %d characters", k, MaxLabelValueLength)
+		}
+		attributes[k] = v
+	}
+	u.Attributes = attributes
+	return nil
+}
+
+// Limits of a user's launcher
+const (
+	MaxFavoriteTargets = 200
+	MaxRecentTargets   = 50
+)
+
+// LauncherTarget is a target on a user's launcher, with when they starred or
+// last connected to it
+type LauncherTarget struct {
+	Target
+	FavoritedAt *time.Time `json:"favorited_at,omitempty" db:"favorited_at"`
+	LastUsedAt  *time.Time `json:"last_used_at,omitempty" db:"last_used_at"`
+	Sessions    int        `json:"sessions,omitempty" db:"sessions"`
+}
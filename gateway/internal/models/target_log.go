@@ -0,0 +1,27 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// SessionTargetLog is a line of a target's own auth or audit log, forwarded to
+// the gateway and matched to a session it logged during
+type SessionTargetLog struct {
+	ID         uuid.UUID `json:"id" db:"id"`
+	AuditLogID uuid.UUID `json:"audit_log_id" db:"audit_log_id"`
+	Host       string    `json:"host" db:"host"`                 // As the target named itself, or the address it forwarded from
+	Program    *string   `json:"program,omitempty" db:"program"` // Such as "sshd" or "sudo"
+	Message    string    `json:"message" db:"message"`
+	LoggedAt   time.Time `json:"logged_at" db:"logged_at"` // When the target logged the line
+	ReceivedAt time.Time `json:"received_at" db:"received_at"`
+	MatchedBy  string    `json:"matched_by" db:"matched_by"` // One of the TargetLogMatch constants
+}
+
+// How a target log line was matched to its session, from most to least certain
+const (
+	TargetLogMatchSessionID  = "session_id"  // The line names the session's ID, such as OPENPAM_SESSION
+	TargetLogMatchClientName = "client_name" // The line names the session's RDP client name
+	TargetLogMatchSource     = "source"      // The line came from the session's target while it was open
+)
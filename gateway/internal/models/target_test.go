@@ -0,0 +1,64 @@
+package models
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestNormalizeMetadata(t *testing.T) {
+	target := &Target{
+		OwnerTeam:       "  Payments SRE ",
+		Environment:     "Production",
+		ComplianceScope: []string{"SOX", "pci-dss", "sox"},
+		Labels:          Labels{"Tier": " 1 ", "cost-center": "4410"},
+	}
+	if err := target.NormalizeMetadata(); err != nil {
+		t.Fatalf("NormalizeMetadata() error = %v", err)
+	}
+
+	if target.OwnerTeam != "Payments SRE" || target.Environment != "production" {
+		t.Errorf("owner team %q, environment %q", target.OwnerTeam, target.Environment)
+	}
+	if want := []string{"pci-dss", "sox"}; !reflect.DeepEqual([]string(target.ComplianceScope), want) {
+		t.Errorf("compliance scope = %v, want %v", target.ComplianceScope, want)
+	}
+	if want := (Labels{"tier": "1", "cost-center": "4410"}); !reflect.DeepEqual(target.Labels, want) {
+		t.Errorf("labels = %v, want %v", target.Labels, want)
+	}
+
+	invalid := []*Target{
+		{Environment: "prod east"},
+		{ComplianceScope: []string{""}},
+		{Labels: Labels{"-tier": "1"}},
+		{Labels: Labels{"tier": strings.Repeat("x", MaxLabelValueLength+1)}},
+		{OwnerTeam: strings.Repeat("x", MaxOwnerTeamLength+1)},
+		{ConnectionNotes: strings.Repeat("x", MaxConnectionNotesLength+1)},
+	}
+	for _, target := range invalid {
+		if err := target.NormalizeMetadata(); err == nil {
+			t.Errorf("NormalizeMetadata() accepted %+v", target)
+		}
+	}
+}
+
+func TestParseLabelSelector(t *testing.T) {
+	tests := []struct {
+		in         string
+		key, value string
+		wantErr    bool
+	}{
+		{"tier=1", "tier", "1", false},
+		{"Team.Owner = payments", "team.owner", "payments", false},
+		{"tier", "tier", "", false},
+		{"=1", "", "", true},
+		{"bad key=1", "", "", true},
+	}
+
+	for _, tt := range tests {
+		key, value, err := ParseLabelSelector(tt.in)
+		if (err != nil) != tt.wantErr || key != tt.key || value != tt.value {
+			t.Errorf("ParseLabelSelector(%q) = %q, %q, %v", tt.in, key, value, err)
+		}
+	}
+}
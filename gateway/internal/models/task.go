@@ -0,0 +1,107 @@
+package models
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Task is a pre-approved command that users can run on a target without an
+// interactive session, e.g. restarting a service
+type Task struct {
+	ID              uuid.UUID      `json:"id" db:"id"`
+	Name            string         `json:"name" db:"name"`
+	Description     *string        `json:"description,omitempty" db:"description"`
+	TargetID        uuid.UUID      `json:"target_id" db:"target_id"`
+	CredentialID    *uuid.UUID     `json:"credential_id,omitempty" db:"credential_id"` // Nil selects the user's allowed credential
+	CommandTemplate string         `json:"command_template" db:"command_template"`     // Parameters are referenced as {{name}}
+	Parameters      TaskParameters `json:"parameters" db:"parameters"`
+	TimeoutSeconds  int            `json:"timeout_seconds" db:"timeout_seconds"`
+	RequireSchedule bool           `json:"require_schedule" db:"require_schedule"` // Only runnable within an approved schedule window
+	Enabled         bool           `json:"enabled" db:"enabled"`
+	CreatedBy       *uuid.UUID     `json:"created_by,omitempty" db:"created_by"`
+	Version         int            `json:"version" db:"version"`
+	CreatedAt       time.Time      `json:"created_at" db:"created_at"`
+	UpdatedAt       time.Time      `json:"updated_at" db:"updated_at"`
+}
+
+// TaskParameter declares a value the user supplies when running a task
+type TaskParameter struct {
+	Name        string  `json:"name"`
+	Description string  `json:"description,omitempty"`
+	Pattern     string  `json:"pattern,omitempty"` // Regular expression the whole value must match
+	Default     *string `json:"default,omitempty"` // Used when no value is given; without it the parameter is required
+}
+
+// TaskParameters is the JSONB list of a task's parameters
+type TaskParameters []TaskParameter
+
+// Value implements the driver.Valuer interface
+func (p TaskParameters) Value() (driver.Value, error) {
+	if p == nil {
+		return []byte("[]"), nil
+	}
+	return json.Marshal(p)
+}
+
+// Scan implements the sql.Scanner interface
+func (p *TaskParameters) Scan(value interface{}) error {
+	b, ok := value.([]byte)
+	if !ok {
+		return errors.New("type assertion to []byte failed")
+	}
+	return json.Unmarshal(b, p)
+}
+
+// TaskValues holds the parameter values of an execution
+type TaskValues map[string]string
+
+// Value implements the driver.Valuer interface
+func (v TaskValues) Value() (driver.Value, error) {
+	if v == nil {
+		return []byte("{}"), nil
+	}
+	return json.Marshal(v)
+}
+
+// Scan implements the sql.Scanner interface
+func (v *TaskValues) Scan(value interface{}) error {
+	b, ok := value.([]byte)
+	if !ok {
+		return errors.New("type assertion to []byte failed")
+	}
+	return json.Unmarshal(b, v)
+}
+
+// TaskExecution records one run of a task with the exact command and its output
+type TaskExecution struct {
+	ID              uuid.UUID  `json:"id" db:"id"`
+	TaskID          *uuid.UUID `json:"task_id,omitempty" db:"task_id"`
+	TaskName        string     `json:"task_name" db:"task_name"`
+	UserID          uuid.UUID  `json:"user_id" db:"user_id"`
+	TargetID        uuid.UUID  `json:"target_id" db:"target_id"`
+	CredentialID    *uuid.UUID `json:"credential_id,omitempty" db:"credential_id"`
+	Parameters      TaskValues `json:"parameters" db:"parameters"`
+	Command         string     `json:"command" db:"command"`
+	Status          string     `json:"status" db:"status"`
+	ExitCode        *int       `json:"exit_code,omitempty" db:"exit_code"`
+	Output          string     `json:"output" db:"output"`
+	OutputTruncated bool       `json:"output_truncated" db:"output_truncated"`
+	ErrorMessage    *string    `json:"error_message,omitempty" db:"error_message"`
+	ClientIP        *string    `json:"client_ip,omitempty" db:"client_ip"`
+	StartedAt       time.Time  `json:"started_at" db:"started_at"`
+	FinishedAt      *time.Time `json:"finished_at,omitempty" db:"finished_at"`
+}
+
+// Task execution status constants
+const (
+	TaskExecutionRunning   = "running"
+	TaskExecutionSucceeded = "succeeded"
+	TaskExecutionFailed    = "failed"
+)
+
+// EventTypeTaskExecuted is the system audit event type for task executions
+const EventTypeTaskExecuted = "task_executed"
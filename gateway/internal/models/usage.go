@@ -0,0 +1,83 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Usage metrics a quota can limit
+const (
+	UsageMetricAPICalls = "api_calls"
+	UsageMetricSessions = "sessions"
+	UsageMetricBytes    = "bytes" // Proxied in both directions
+)
+
+// UsageMetrics lists the metrics a quota can limit
+var UsageMetrics = []string{UsageMetricAPICalls, UsageMetricSessions, UsageMetricBytes}
+
+// DefaultUsageAlertPercent is how close to its limit usage gets before an
+// alert, unless the quota says otherwise
+const DefaultUsageAlertPercent = 80
+
+// System audit events of usage quotas
+const (
+	EventTypeUsageQuota        = "usage_quota"         // Usage nearing or reaching a quota
+	EventTypeUsageQuotaChanged = "usage_quota_changed" // A quota added or removed
+)
+
+// Usage is what a user, or one of their API keys, used in a day (UTC)
+type Usage struct {
+	Day           time.Time  `json:"day" db:"day"`
+	UserID        uuid.UUID  `json:"user_id" db:"user_id"`
+	APIKeyID      *uuid.UUID `json:"api_key_id,omitempty" db:"api_key_id"` // nil for use signed in
+	APICalls      int64      `json:"api_calls" db:"api_calls"`
+	Sessions      int64      `json:"sessions" db:"sessions"`
+	BytesSent     int64      `json:"bytes_sent" db:"bytes_sent"`
+	BytesReceived int64      `json:"bytes_received" db:"bytes_received"`
+}
+
+// Value returns the usage of metric
+func (u *Usage) Value(metric string) int64 {
+	switch metric {
+	case UsageMetricAPICalls:
+		return u.APICalls
+	case UsageMetricSessions:
+		return u.Sessions
+	case UsageMetricBytes:
+		return u.BytesSent + u.BytesReceived
+	}
+	return 0
+}
+
+// Add adds other's counts to u
+func (u *Usage) Add(other *Usage) {
+	u.APICalls += other.APICalls
+	u.Sessions += other.Sessions
+	u.BytesSent += other.BytesSent
+	u.BytesReceived += other.BytesReceived
+}
+
+// UsageQuota caps a user's daily usage of a metric, or one API key's
+type UsageQuota struct {
+	ID           uuid.UUID     `json:"id" db:"id"`
+	UserID       uuid.UUID     `json:"user_id" db:"user_id"`
+	APIKeyID     *uuid.UUID    `json:"api_key_id,omitempty" db:"api_key_id"` // nil covers all of the user's usage
+	Metric       string        `json:"metric" db:"metric"`
+	DailyLimit   int64         `json:"daily_limit" db:"daily_limit"`
+	AlertPercent int           `json:"alert_percent" db:"alert_percent"`
+	AlertedOn    *time.Time    `json:"alerted_on,omitempty" db:"alerted_on"`
+	CreatedBy    uuid.NullUUID `json:"created_by,omitempty" db:"created_by"`
+	CreatedAt    time.Time     `json:"created_at" db:"created_at"`
+}
+
+// Covers reports whether the quota applies to use by userID with apiKeyID,
+// uuid.Nil for use signed in
+func (q *UsageQuota) Covers(userID, apiKeyID uuid.UUID) bool {
+	return q.UserID == userID && (q.APIKeyID == nil || *q.APIKeyID == apiKeyID)
+}
+
+// AlertAt is the usage that triggers the quota's alert
+func (q *UsageQuota) AlertAt() int64 {
+	return q.DailyLimit * int64(q.AlertPercent) / 100
+}
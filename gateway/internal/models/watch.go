@@ -0,0 +1,253 @@
+package models
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+)
+
+// Limits of watch rules
+const (
+	MaxWatchWindow     = 24 * time.Hour
+	MaxWatchThreshold  = 1000
+	MaxWatchRecipients = 20
+)
+
+// Watch rule actions, carried out when a rule fires
+const (
+	WatchActionNotify            = "notify"             // Email the rule's recipients
+	WatchActionOpenInvestigation = "open_investigation" // Open an investigation holding the event
+	WatchActionDisableUser       = "disable_user"       // Disable the event's user
+)
+
+// What watch rules count events per
+const (
+	WatchGroupAll    = ""
+	WatchGroupUser   = "user"
+	WatchGroupIP     = "ip"
+	WatchGroupTarget = "target"
+)
+
+// System audit event types for watch rules
+const (
+	EventTypeWatchRuleChanged = "watch_rule_changed"
+	EventTypeWatchAlert       = "watch_alert"
+)
+
+// WatchRule raises an alert when audit events matching all of its conditions
+// happen Threshold times within its window, such as more than three failed
+// logins by one user in five minutes, or any session to a PCI target outside
+// business hours. Unset conditions match every event.
+type WatchRule struct {
+	ID            uuid.UUID      `json:"id" db:"id"`
+	Name          string         `json:"name" db:"name"`
+	Description   *string        `json:"description,omitempty" db:"description"`
+	Enabled       bool           `json:"enabled" db:"enabled"`
+	EventTypes    pq.StringArray `json:"event_types" db:"event_types"` // Stream event types, or prefixes ending in "*"
+	UserID        *uuid.UUID     `json:"user_id,omitempty" db:"user_id"`
+	TargetTag     *string        `json:"target_tag,omitempty" db:"target_tag"` // Compliance scope, or label as key or key=value
+	Status        *string        `json:"status,omitempty" db:"status"`         // System audit status or session status
+	OutsideHours  *WorkingHours  `json:"outside_hours,omitempty" db:"outside_hours"`
+	Threshold     int            `json:"threshold" db:"threshold"`
+	WindowSeconds int            `json:"window_seconds" db:"window_seconds"`
+	GroupBy       string         `json:"group_by" db:"group_by"`
+	Actions       pq.StringArray `json:"actions" db:"actions"`
+	Recipients    pq.StringArray `json:"recipients" db:"recipients"`
+	CreatedAt     time.Time      `json:"created_at" db:"created_at"`
+	UpdatedAt     time.Time      `json:"updated_at" db:"updated_at"`
+}
+
+// Window is how far back matching events count towards the threshold
+func (r *WatchRule) Window() time.Duration {
+	return time.Duration(r.WindowSeconds) * time.Second
+}
+
+// Validate checks the rule, defaulting its threshold to a single event
+func (r *WatchRule) Validate() error {
+	r.Name = strings.TrimSpace(r.Name)
+	if r.Name == "" {
+		return errors.New("name is required")
+	}
+
+	if len(r.EventTypes) == 0 {
+		return errors.New("at least one event type is required")
+	}
+	for _, t := range r.EventTypes {
+		if strings.TrimSpace(t) == "" || t == "*" {
+			return fmt.Errorf("invalid event type %q", t)
+		}
+	}
+
+	if r.TargetTag != nil {
+		if _, _, err := ParseLabelSelector(*r.TargetTag); err != nil {
+			return fmt.Errorf("invalid target_tag %q", *r.TargetTag)
+		}
+	}
+	if r.OutsideHours != nil {
+		if err := r.OutsideHours.Validate(); err != nil {
+			return fmt.Errorf("invalid outside_hours: %w", err)
+		}
+	}
+
+	if r.Threshold == 0 {
+		r.Threshold = 1
+	}
+	if r.Threshold < 1 || r.Threshold > MaxWatchThreshold {
+		return fmt.Errorf("threshold must be between 1 and %d", MaxWatchThreshold)
+	}
+	if r.WindowSeconds < 0 || r.Window() > MaxWatchWindow {
+		return fmt.Errorf("window_seconds must be between 0 and %d", int(MaxWatchWindow.Seconds()))
+	}
+	if r.Threshold > 1 && r.WindowSeconds == 0 {
+		return errors.New("a threshold above 1 needs a window")
+	}
+
+	switch r.GroupBy {
+	case WatchGroupAll, WatchGroupUser, WatchGroupIP, WatchGroupTarget:
+	default:
+		return fmt.Errorf("invalid group_by %q: must be 'user', 'ip' or 'target'", r.GroupBy)
+	}
+
+	if len(r.Actions) == 0 {
+		return errors.New("at least one action is required")
+	}
+	for _, action := range r.Actions {
+		switch action {
+		case WatchActionNotify, WatchActionOpenInvestigation, WatchActionDisableUser:
+		default:
+			return fmt.Errorf("invalid action %q", action)
+		}
+	}
+	if r.HasAction(WatchActionNotify) && len(r.Recipients) == 0 {
+		return errors.New("the notify action needs recipients")
+	}
+	if len(r.Recipients) > MaxWatchRecipients {
+		return fmt.Errorf("a rule can notify at most %d recipients", MaxWatchRecipients)
+	}
+	return nil
+}
+
+// HasAction reports whether the rule carries out action when it fires
+func (r *WatchRule) HasAction(action string) bool {
+	for _, a := range r.Actions {
+		if a == action {
+			return true
+		}
+	}
+	return false
+}
+
+// WorkingHours are the hours of the week work is expected in. Days are
+// numbered from Sunday (0) to Saturday (6); End before Start spans midnight.
+type WorkingHours struct {
+	Start    string `json:"start"` // "09:00"
+	End      string `json:"end"`   // "17:00"
+	Days     []int  `json:"days"`  // Monday to Friday if empty
+	Timezone string `json:"timezone,omitempty"`
+}
+
+// Validate checks the hours and time zone
+func (h *WorkingHours) Validate() error {
+	if _, err := parseClock(h.Start); err != nil {
+		return fmt.Errorf("invalid start %q", h.Start)
+	}
+	if _, err := parseClock(h.End); err != nil {
+		return fmt.Errorf("invalid end %q", h.End)
+	}
+	if h.Start == h.End {
+		return errors.New("start and end must differ")
+	}
+	for _, d := range h.Days {
+		if d < 0 || d > 6 {
+			return fmt.Errorf("invalid day %d", d)
+		}
+	}
+	if _, err := time.LoadLocation(h.Timezone); err != nil {
+		return fmt.Errorf("invalid timezone %q", h.Timezone)
+	}
+	return nil
+}
+
+// Contains reports whether t falls within the working hours. A shift that
+// spans midnight belongs to the day it starts on.
+func (h *WorkingHours) Contains(t time.Time) bool {
+	if loc, err := time.LoadLocation(h.Timezone); err == nil {
+		t = t.In(loc)
+	}
+	start, err := parseClock(h.Start)
+	if err != nil {
+		return false
+	}
+	end, err := parseClock(h.End)
+	if err != nil {
+		return false
+	}
+
+	minute := t.Hour()*60 + t.Minute()
+	day := t.Weekday()
+	if start < end {
+		return h.workday(day) && minute >= start && minute < end
+	}
+	if minute >= start {
+		return h.workday(day)
+	}
+	return minute < end && h.workday((day+6)%7)
+}
+
+func (h *WorkingHours) workday(day time.Weekday) bool {
+	if len(h.Days) == 0 {
+		return day >= time.Monday && day <= time.Friday
+	}
+	for _, d := range h.Days {
+		if time.Weekday(d) == day {
+			return true
+		}
+	}
+	return false
+}
+
+// parseClock parses "HH:MM" into minutes after midnight
+func parseClock(s string) (int, error) {
+	t, err := time.Parse("15:04", s)
+	if err != nil {
+		return 0, err
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+// Value implements the driver.Valuer interface
+func (h WorkingHours) Value() (driver.Value, error) {
+	return json.Marshal(h)
+}
+
+// Scan implements the sql.Scanner interface
+func (h *WorkingHours) Scan(value interface{}) error {
+	b, ok := value.([]byte)
+	if !ok {
+		return errors.New("type assertion to []byte failed")
+	}
+	return json.Unmarshal(b, h)
+}
+
+// WatchAlert is a watch rule firing, with the actions that were carried out
+type WatchAlert struct {
+	ID              uuid.UUID      `json:"id" db:"id"`
+	RuleID          uuid.UUID      `json:"rule_id" db:"rule_id"`
+	RuleName        string         `json:"rule_name" db:"rule_name"`
+	EventID         int64          `json:"event_id" db:"event_id"` // Event that reached the threshold
+	EventType       string         `json:"event_type" db:"event_type"`
+	GroupKey        string         `json:"group_key,omitempty" db:"group_key"`
+	EventCount      int            `json:"event_count" db:"event_count"`
+	UserID          *uuid.UUID     `json:"user_id,omitempty" db:"user_id"`
+	TargetID        *uuid.UUID     `json:"target_id,omitempty" db:"target_id"`
+	InvestigationID *uuid.UUID     `json:"investigation_id,omitempty" db:"investigation_id"`
+	Actions         pq.StringArray `json:"actions" db:"actions"`
+	Errors          pq.StringArray `json:"errors,omitempty" db:"errors"`
+	CreatedAt       time.Time      `json:"created_at" db:"created_at"`
+}
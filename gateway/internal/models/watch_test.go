@@ -0,0 +1,94 @@
+package models
+
+import (
+	"testing"
+	"time"
+)
+
+func TestWorkingHours_Contains(t *testing.T) {
+	// 2026-03-02 is a Monday
+	monday := time.Date(2026, 3, 2, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name  string
+		hours WorkingHours
+		at    time.Time
+		want  bool
+	}{
+		{name: "Weekday morning", hours: WorkingHours{Start: "09:00", End: "17:00"}, at: monday.Add(9 * time.Hour), want: true},
+		{name: "Weekday at end", hours: WorkingHours{Start: "09:00", End: "17:00"}, at: monday.Add(17 * time.Hour)},
+		{name: "Weekday night", hours: WorkingHours{Start: "09:00", End: "17:00"}, at: monday.Add(22 * time.Hour)},
+		{name: "Sunday", hours: WorkingHours{Start: "09:00", End: "17:00"}, at: monday.Add(-12 * time.Hour)},
+		{name: "Sunday when listed", hours: WorkingHours{Start: "09:00", End: "17:00", Days: []int{0}}, at: monday.Add(-12 * time.Hour), want: true},
+		{
+			name:  "In the zone's hours",
+			hours: WorkingHours{Start: "09:00", End: "17:00", Timezone: "America/New_York"},
+			at:    monday.Add(15 * time.Hour), // 10:00 in New York
+			want:  true,
+		},
+		{
+			name:  "Outside the zone's hours",
+			hours: WorkingHours{Start: "09:00", End: "17:00", Timezone: "America/New_York"},
+			at:    monday.Add(10 * time.Hour), // 05:00 in New York
+		},
+		{name: "Night shift evening", hours: WorkingHours{Start: "22:00", End: "06:00"}, at: monday.Add(23 * time.Hour), want: true},
+		{name: "Night shift after midnight", hours: WorkingHours{Start: "22:00", End: "06:00"}, at: monday.Add(29 * time.Hour), want: true},
+		{name: "Night shift starting Friday ends Saturday", hours: WorkingHours{Start: "22:00", End: "06:00"}, at: monday.AddDate(0, 0, 5).Add(3 * time.Hour), want: true},
+		{name: "Night shift doesn't start Saturday", hours: WorkingHours{Start: "22:00", End: "06:00"}, at: monday.AddDate(0, 0, 5).Add(23 * time.Hour)},
+		{name: "Night shift daytime", hours: WorkingHours{Start: "22:00", End: "06:00"}, at: monday.Add(12 * time.Hour)},
+	}
+
+	for _, tt := range tests {
+		if got := tt.hours.Contains(tt.at); got != tt.want {
+			t.Errorf("%s: Contains(%v) = %v, want %v", tt.name, tt.at, got, tt.want)
+		}
+	}
+}
+
+func TestWatchRule_Validate(t *testing.T) {
+	valid := func() WatchRule {
+		return WatchRule{
+			Name:       "Failed logins",
+			EventTypes: []string{"system.login_failed"},
+			Actions:    []string{WatchActionOpenInvestigation},
+		}
+	}
+	tag := "bad tag!"
+
+	tests := []struct {
+		name   string
+		modify func(r *WatchRule)
+		ok     bool
+	}{
+		{name: "Valid", modify: func(r *WatchRule) {}, ok: true},
+		{name: "Threshold with window", modify: func(r *WatchRule) { r.Threshold, r.WindowSeconds = 3, 300 }, ok: true},
+		{name: "No name", modify: func(r *WatchRule) { r.Name = " " }},
+		{name: "No event types", modify: func(r *WatchRule) { r.EventTypes = nil }},
+		{name: "Every event", modify: func(r *WatchRule) { r.EventTypes = []string{"*"} }},
+		{name: "Threshold without window", modify: func(r *WatchRule) { r.Threshold = 3 }},
+		{name: "Window too long", modify: func(r *WatchRule) { r.Threshold, r.WindowSeconds = 3, 2*24*3600 }},
+		{name: "Unknown grouping", modify: func(r *WatchRule) { r.GroupBy = "zone" }},
+		{name: "Unknown action", modify: func(r *WatchRule) { r.Actions = []string{"page"} }},
+		{name: "Notify without recipients", modify: func(r *WatchRule) { r.Actions = []string{WatchActionNotify} }},
+		{name: "Invalid tag", modify: func(r *WatchRule) { r.TargetTag = &tag }},
+		{name: "Invalid hours", modify: func(r *WatchRule) { r.OutsideHours = &WorkingHours{Start: "9am", End: "17:00"} }},
+		{name: "Invalid time zone", modify: func(r *WatchRule) {
+			r.OutsideHours = &WorkingHours{Start: "09:00", End: "17:00", Timezone: "Mars/Olympus"}
+		}},
+	}
+
+	for _, tt := range tests {
+		rule := valid()
+		tt.modify(&rule)
+		err := rule.Validate()
+		if (err == nil) != tt.ok {
+			t.Errorf("%s: Validate() error = %v, want ok %v", tt.name, err, tt.ok)
+		}
+	}
+
+	rule := valid()
+	rule.Validate()
+	if rule.Threshold != 1 {
+		t.Errorf("default threshold = %d, want 1", rule.Threshold)
+	}
+}
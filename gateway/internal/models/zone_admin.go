@@ -0,0 +1,25 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// ZoneAdmin assigns a user to administer one zone: its targets, their
+// credentials, and the schedules requested for them. Global admins manage
+// every zone and need no assignment.
+type ZoneAdmin struct {
+	ZoneID      uuid.UUID  `json:"zone_id" db:"zone_id"`
+	UserID      uuid.UUID  `json:"user_id" db:"user_id"`
+	Email       string     `json:"email" db:"email"`
+	DisplayName string     `json:"display_name,omitempty" db:"display_name"`
+	CreatedBy   *uuid.UUID `json:"created_by,omitempty" db:"created_by"`
+	CreatedAt   time.Time  `json:"created_at" db:"created_at"`
+}
+
+// Zone admin system audit event types
+const (
+	EventTypeZoneAdminAssigned = "zone_admin_assigned"
+	EventTypeZoneAdminRemoved  = "zone_admin_removed"
+)
@@ -0,0 +1,242 @@
+// Package notice sends structured notices from the gateway to the client of a
+// running session, such as how long is left before the session ends, so the
+// frontend can warn users instead of them being disconnected by surprise. The
+// proxies deliver the notices over the session's own WebSocket.
+package notice
+
+import (
+	"context"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/VanCannon/openpam/gateway/internal/schedule"
+	"github.com/VanCannon/openpam/gateway/internal/settings"
+	"github.com/google/uuid"
+)
+
+// Notice types
+const (
+	TypeTimeRemaining    = "time_remaining"    // The session ends soon, at EndsAt
+	TypeIdleWarning      = "idle_warning"      // The session is closed at EndsAt unless there is input
+	TypeAccessExtended   = "access_extended"   // The schedule window was extended to EndsAt
+	TypeMonitorJoined    = "monitor_joined"    // By started watching the session live
+	TypeClipboardBlocked = "clipboard_blocked" // A clipboard transfer was refused
+)
+
+// What ends a session, for time_remaining notices
+const (
+	ReasonSchedule    = "schedule"     // The schedule window ends
+	ReasonMaxDuration = "max_duration" // The session reaches its maximum duration
+)
+
+// Notice is a message to the user of a session
+type Notice struct {
+	Type    string     `json:"type"`
+	Message string     `json:"message"`
+	EndsAt  *time.Time `json:"ends_at,omitempty"`
+	Reason  string     `json:"reason,omitempty"` // One of the Reason constants, for time_remaining
+	By      string     `json:"by,omitempty"`     // Who joined, for monitor_joined
+	Time    time.Time  `json:"time"`
+}
+
+// Warnings are given this long before a session ends
+var warnBefore = []time.Duration{10 * time.Minute, 5 * time.Minute, time.Minute}
+
+// idleWarnBefore is how long before the idle timeout the user is warned
+const idleWarnBefore = time.Minute
+
+// queueSize is how many notices a session holds for a slow client; more are dropped
+const queueSize = 16
+
+type ctxKey struct{}
+
+// Hub holds the notice queues of the sessions running on this gateway, so
+// notices can be sent to a session from outside its connection
+type Hub struct {
+	interval time.Duration // How often sessions are checked for warnings
+
+	mu       sync.Mutex
+	sessions map[uuid.UUID]chan Notice
+}
+
+// NewHub creates a new notice hub
+func NewHub() *Hub {
+	return &Hub{
+		interval: time.Second,
+		sessions: make(map[uuid.UUID]chan Notice),
+	}
+}
+
+// Start opens the notice queue of a session and warns its user before the
+// session ends or is closed for inactivity. ctx must carry the session's
+// settings and schedule window. The returned stop function closes the queue.
+func (h *Hub) Start(ctx context.Context, sessionID uuid.UUID) (context.Context, func()) {
+	queue := make(chan Notice, queueSize)
+
+	h.mu.Lock()
+	h.sessions[sessionID] = queue
+	h.mu.Unlock()
+
+	ctx, cancel := context.WithCancel(context.WithValue(ctx, ctxKey{}, queue))
+	go h.watch(ctx, queue)
+
+	var once sync.Once
+	return ctx, func() {
+		once.Do(func() {
+			cancel()
+			h.mu.Lock()
+			delete(h.sessions, sessionID)
+			h.mu.Unlock()
+		})
+	}
+}
+
+// Send queues n for a session, reporting false if the session isn't running
+// on this gateway or its queue is full
+func (h *Hub) Send(sessionID uuid.UUID, n Notice) bool {
+	h.mu.Lock()
+	queue, ok := h.sessions[sessionID]
+	h.mu.Unlock()
+	if !ok {
+		return false
+	}
+	return enqueue(queue, n)
+}
+
+// Send queues n for the session in ctx, if it has a notice queue
+func Send(ctx context.Context, n Notice) {
+	if queue, ok := ctx.Value(ctxKey{}).(chan Notice); ok {
+		enqueue(queue, n)
+	}
+}
+
+// Notices returns the notice queue of the session in ctx, or nil if it has
+// none. The proxy delivers what it receives to the client.
+func Notices(ctx context.Context) <-chan Notice {
+	if queue, ok := ctx.Value(ctxKey{}).(chan Notice); ok {
+		return queue
+	}
+	return nil
+}
+
+// enqueue adds n to queue without waiting; notices are advisory, so they are
+// dropped rather than stall the sender
+func enqueue(queue chan Notice, n Notice) bool {
+	if n.Time.IsZero() {
+		n.Time = time.Now()
+	}
+	select {
+	case queue <- n:
+		return true
+	default:
+		return false
+	}
+}
+
+// watch warns the user as the session's end and idle timeout approach
+func (h *Hub) watch(ctx context.Context, queue chan Notice) {
+	ticker := time.NewTicker(h.interval)
+	defer ticker.Stop()
+
+	// Nil for sessions outside a schedule window, which then never receives
+	changes := schedule.WindowChanges(ctx)
+
+	var w warner
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case end := <-changes:
+			enqueue(queue, Notice{
+				Type:    TypeAccessExtended,
+				Message: "Your access has been extended until " + end.UTC().Format(time.RFC1123),
+				EndsAt:  &end,
+			})
+		case now := <-ticker.C:
+			for _, n := range w.check(ctx, now) {
+				enqueue(queue, n)
+			}
+		}
+	}
+}
+
+// warner tracks the warnings given for a session
+type warner struct {
+	warned     int // How many of warnBefore have been warned of
+	idleWarned bool
+}
+
+// check returns the notices due at now
+func (w *warner) check(ctx context.Context, now time.Time) []Notice {
+	var notices []Notice
+
+	if end, reason, ok := sessionEnd(ctx); ok {
+		remaining := end.Sub(now)
+		due := 0
+		for _, before := range warnBefore {
+			if remaining <= before {
+				due++
+			}
+		}
+		// Only the nearest warning is given when several fall due at once,
+		// such as for a session opened five minutes before its window ends.
+		// An extension makes the warnings due again.
+		if due > w.warned && remaining > 0 {
+			notices = append(notices, Notice{
+				Type:    TypeTimeRemaining,
+				Message: "Your session ends in " + minutes(remaining),
+				EndsAt:  &end,
+				Reason:  reason,
+				Time:    now,
+			})
+		}
+		w.warned = due
+	}
+
+	if deadline, ok := settings.IdleDeadline(ctx); ok {
+		remaining := deadline.Sub(now)
+		if remaining > idleWarnBefore {
+			w.idleWarned = false
+		} else if !w.idleWarned && remaining > 0 {
+			w.idleWarned = true
+			notices = append(notices, Notice{
+				Type:    TypeIdleWarning,
+				Message: "Your session will be closed for inactivity in " + minutes(remaining),
+				EndsAt:  &deadline,
+				Time:    now,
+			})
+		}
+	}
+
+	return notices
+}
+
+// sessionEnd returns the earlier of the session's schedule window end and
+// maximum duration, and which one it is
+func sessionEnd(ctx context.Context) (time.Time, string, bool) {
+	end, reason := time.Time{}, ""
+	if windowEnd, ok := schedule.End(ctx); ok {
+		end, reason = windowEnd, ReasonSchedule
+	}
+	if deadline, ok := settings.Deadline(ctx); ok && (end.IsZero() || deadline.Before(end)) {
+		end, reason = deadline, ReasonMaxDuration
+	}
+	return end, reason, !end.IsZero()
+}
+
+// minutes describes d in whole minutes, rounded up, or in seconds under a minute
+func minutes(d time.Duration) string {
+	if d < time.Minute {
+		s := int((d + time.Second - 1) / time.Second)
+		if s == 1 {
+			return "1 second"
+		}
+		return strconv.Itoa(s) + " seconds"
+	}
+	m := int((d + time.Minute - 1) / time.Minute)
+	if m == 1 {
+		return "1 minute"
+	}
+	return strconv.Itoa(m) + " minutes"
+}
@@ -0,0 +1,102 @@
+package notice
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/VanCannon/openpam/gateway/internal/settings"
+	"github.com/google/uuid"
+)
+
+func TestWarner_TimeRemaining(t *testing.T) {
+	ctx, stop := settings.Start(context.Background(), &settings.Effective{MaxDuration: 3600})
+	defer stop()
+	end, _ := settings.Deadline(ctx)
+
+	var w warner
+	steps := []struct {
+		before time.Duration
+		want   string
+	}{
+		{30 * time.Minute, ""},
+		{10 * time.Minute, "Your session ends in 10 minutes"},
+		{9 * time.Minute, ""},
+		{5 * time.Minute, "Your session ends in 5 minutes"},
+		{30 * time.Second, "Your session ends in 30 seconds"},
+		{10 * time.Second, ""},
+	}
+	for _, step := range steps {
+		notices := w.check(ctx, end.Add(-step.before))
+		got := ""
+		if len(notices) == 1 {
+			got = notices[0].Message
+			if notices[0].Type != TypeTimeRemaining || notices[0].Reason != ReasonMaxDuration || !notices[0].EndsAt.Equal(end) {
+				t.Errorf("%s before the end: notice = %+v", step.before, notices[0])
+			}
+		} else if len(notices) > 1 {
+			t.Errorf("%s before the end: %d notices, want at most 1", step.before, len(notices))
+		}
+		if got != step.want {
+			t.Errorf("%s before the end: notice %q, want %q", step.before, got, step.want)
+		}
+	}
+}
+
+func TestWarner_Idle(t *testing.T) {
+	ctx, stop := settings.Start(context.Background(), &settings.Effective{IdleTimeout: 600})
+	defer stop()
+	deadline, _ := settings.IdleDeadline(ctx)
+
+	var w warner
+	if notices := w.check(ctx, deadline.Add(-2*time.Minute)); len(notices) != 0 {
+		t.Errorf("notices 2m before the idle timeout = %+v, want none", notices)
+	}
+	notices := w.check(ctx, deadline.Add(-time.Minute))
+	if len(notices) != 1 || notices[0].Type != TypeIdleWarning {
+		t.Fatalf("notices 1m before the idle timeout = %+v, want an idle warning", notices)
+	}
+	if notices := w.check(ctx, deadline.Add(-30*time.Second)); len(notices) != 0 {
+		t.Errorf("notices after the warning = %+v, want none", notices)
+	}
+
+	// Input postpones the timeout, so the next approach is warned of again
+	settings.Touch(ctx)
+	deadline, _ = settings.IdleDeadline(ctx)
+	w.check(ctx, deadline.Add(-5*time.Minute))
+	if notices := w.check(ctx, deadline.Add(-time.Minute)); len(notices) != 1 {
+		t.Errorf("notices after new input = %+v, want an idle warning", notices)
+	}
+}
+
+func TestHub_Send(t *testing.T) {
+	hub := NewHub()
+	sessionID := uuid.New()
+
+	if hub.Send(sessionID, Notice{Type: TypeMonitorJoined}) {
+		t.Error("Send() to a session that isn't running = true")
+	}
+
+	ctx, stop := hub.Start(context.Background(), sessionID)
+	if !hub.Send(sessionID, Notice{Type: TypeMonitorJoined, By: "admin@example.com"}) {
+		t.Fatal("Send() to a running session = false")
+	}
+	Send(ctx, Notice{Type: TypeClipboardBlocked})
+
+	notices := Notices(ctx)
+	for _, want := range []string{TypeMonitorJoined, TypeClipboardBlocked} {
+		select {
+		case n := <-notices:
+			if n.Type != want || n.Time.IsZero() {
+				t.Errorf("notice = %+v, want %s with a time", n, want)
+			}
+		default:
+			t.Fatalf("no %s notice queued", want)
+		}
+	}
+
+	stop()
+	if hub.Send(sessionID, Notice{Type: TypeMonitorJoined}) {
+		t.Error("Send() after the session stopped = true")
+	}
+}
@@ -0,0 +1,39 @@
+package notify
+
+import (
+	"context"
+	"errors"
+)
+
+// ErrNotConfigured is returned when a message is sent through a channel that has
+// no configuration
+var ErrNotConfigured = errors.New("notification channel not configured")
+
+// Message is a notification addressed to one or more recipients
+type Message struct {
+	To          []string
+	Subject     string
+	Body        string // Plain text
+	Actions     []Action
+	Attachments []Attachment
+}
+
+// Action is a link the recipient can follow, shown as a button where the
+// channel supports it and appended to the body otherwise
+type Action struct {
+	Label string
+	URL   string
+	Style string // "primary" or "danger"; empty for the default look
+}
+
+// Attachment is a file sent with a message
+type Attachment struct {
+	Filename    string
+	ContentType string
+	Data        []byte
+}
+
+// Notifier delivers messages
+type Notifier interface {
+	Send(ctx context.Context, msg *Message) error
+}
@@ -0,0 +1,171 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// maxSlackText is the longest text Slack accepts in a section block
+const maxSlackText = 3000
+
+// SlackConfig holds Slack app settings
+type SlackConfig struct {
+	BotToken string // Bot token with the chat:write and users:read.email scopes
+	APIURL   string // Defaults to https://slack.com/api
+}
+
+// SlackNotifier sends messages as Slack direct messages. Recipients are email
+// addresses, matched to the Slack users with the same address. Attachments are
+// not sent.
+type SlackNotifier struct {
+	config SlackConfig
+	client *http.Client
+}
+
+// NewSlackNotifier creates a notifier that posts through a Slack app.
+// Messages fail with ErrNotConfigured if no bot token is set.
+func NewSlackNotifier(cfg SlackConfig) *SlackNotifier {
+	if cfg.APIURL == "" {
+		cfg.APIURL = "https://slack.com/api"
+	}
+	cfg.APIURL = strings.TrimRight(cfg.APIURL, "/")
+
+	return &SlackNotifier{
+		config: cfg,
+		client: &http.Client{Timeout: 15 * time.Second},
+	}
+}
+
+// slackResponse is the envelope of every Slack Web API response
+type slackResponse struct {
+	OK    bool   `json:"ok"`
+	Error string `json:"error"`
+	User  struct {
+		ID string `json:"id"`
+	} `json:"user"`
+}
+
+// Send delivers the message to each recipient, stopping at the first failure
+func (n *SlackNotifier) Send(ctx context.Context, msg *Message) error {
+	if n.config.BotToken == "" {
+		return ErrNotConfigured
+	}
+	if len(msg.To) == 0 {
+		return fmt.Errorf("message has no recipients")
+	}
+
+	blocks := slackBlocks(msg)
+	for _, to := range msg.To {
+		userID, err := n.lookupUser(ctx, to)
+		if err != nil {
+			return err
+		}
+
+		payload := map[string]interface{}{
+			"channel": userID,
+			"text":    msg.Subject, // Shown in notifications
+			"blocks":  blocks,
+		}
+		if _, err := n.call(ctx, http.MethodPost, "chat.postMessage", payload); err != nil {
+			return fmt.Errorf("failed to message %s on Slack: %w", to, err)
+		}
+	}
+
+	return nil
+}
+
+// lookupUser returns the Slack user ID for an email address
+func (n *SlackNotifier) lookupUser(ctx context.Context, email string) (string, error) {
+	resp, err := n.call(ctx, http.MethodGet, "users.lookupByEmail?email="+url.QueryEscape(email), nil)
+	if err != nil {
+		return "", fmt.Errorf("failed to find Slack user %s: %w", email, err)
+	}
+	return resp.User.ID, nil
+}
+
+// call invokes a Slack Web API method
+func (n *SlackNotifier) call(ctx context.Context, httpMethod, method string, payload interface{}) (*slackResponse, error) {
+	var body *bytes.Reader
+	if payload != nil {
+		data, err := json.Marshal(payload)
+		if err != nil {
+			return nil, err
+		}
+		body = bytes.NewReader(data)
+	} else {
+		body = bytes.NewReader(nil)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, httpMethod, n.config.APIURL+"/"+method, body)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+n.config.BotToken)
+	if payload != nil {
+		req.Header.Set("Content-Type", "application/json; charset=utf-8")
+	}
+
+	resp, err := n.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("Slack API returned status %d", resp.StatusCode)
+	}
+
+	var result slackResponse
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("failed to decode Slack response: %w", err)
+	}
+	if !result.OK {
+		return nil, fmt.Errorf("Slack API error: %s", result.Error)
+	}
+	return &result, nil
+}
+
+// slackBlocks lays the message out as a section with the subject and body,
+// followed by a button per action
+func slackBlocks(msg *Message) []interface{} {
+	text := "*" + msg.Subject + "*\n" + msg.Body
+	for len(text) > maxSlackText {
+		_, size := utf8.DecodeLastRuneInString(text)
+		text = text[:len(text)-size]
+	}
+
+	blocks := []interface{}{
+		map[string]interface{}{
+			"type": "section",
+			"text": map[string]string{"type": "mrkdwn", "text": text},
+		},
+	}
+
+	if len(msg.Actions) > 0 {
+		var buttons []interface{}
+		for _, action := range msg.Actions {
+			button := map[string]interface{}{
+				"type": "button",
+				"text": map[string]string{"type": "plain_text", "text": action.Label},
+				"url":  action.URL,
+			}
+			if action.Style == "primary" || action.Style == "danger" {
+				button["style"] = action.Style
+			}
+			buttons = append(buttons, button)
+		}
+		blocks = append(blocks, map[string]interface{}{
+			"type":     "actions",
+			"elements": buttons,
+		})
+	}
+
+	return blocks
+}
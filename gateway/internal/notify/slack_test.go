@@ -0,0 +1,68 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestSlackNotifier_SendsDirectMessages(t *testing.T) {
+	var posted []map[string]interface{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer xoxb-test" {
+			t.Errorf("Authorization = %q", r.Header.Get("Authorization"))
+		}
+		switch r.URL.Path {
+		case "/users.lookupByEmail":
+			if r.URL.Query().Get("email") != "admin@example.com" {
+				w.Write([]byte(`{"ok":false,"error":"users_not_found"}`))
+				return
+			}
+			w.Write([]byte(`{"ok":true,"user":{"id":"U123"}}`))
+		case "/chat.postMessage":
+			var payload map[string]interface{}
+			json.NewDecoder(r.Body).Decode(&payload)
+			posted = append(posted, payload)
+			w.Write([]byte(`{"ok":true}`))
+		default:
+			t.Errorf("unexpected call %s", r.URL.Path)
+		}
+	}))
+	defer srv.Close()
+
+	n := NewSlackNotifier(SlackConfig{BotToken: "xoxb-test", APIURL: srv.URL})
+	msg := &Message{
+		To:      []string{"admin@example.com"},
+		Subject: "Access request",
+		Body:    "alice@example.com requests access.",
+		Actions: []Action{{Label: "Approve", URL: "https://pam.example.com/a", Style: "primary"}},
+	}
+	if err := n.Send(context.Background(), msg); err != nil {
+		t.Fatalf("Send() error = %v", err)
+	}
+
+	if len(posted) != 1 || posted[0]["channel"] != "U123" || posted[0]["text"] != "Access request" {
+		t.Fatalf("posted = %v", posted)
+	}
+	blocks := posted[0]["blocks"].([]interface{})
+	actions := blocks[1].(map[string]interface{})["elements"].([]interface{})
+	button := actions[0].(map[string]interface{})
+	if button["url"] != "https://pam.example.com/a" || button["style"] != "primary" {
+		t.Errorf("button = %v", button)
+	}
+
+	msg.To = []string{"unknown@example.com"}
+	if err := n.Send(context.Background(), msg); err == nil {
+		t.Error("expected error for a recipient without a Slack account")
+	}
+}
+
+func TestSlackNotifier_NotConfigured(t *testing.T) {
+	err := NewSlackNotifier(SlackConfig{}).Send(context.Background(), &Message{To: []string{"admin@example.com"}})
+	if !errors.Is(err, ErrNotConfigured) {
+		t.Errorf("Send() error = %v, want ErrNotConfigured", err)
+	}
+}
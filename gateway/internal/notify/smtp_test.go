@@ -0,0 +1,131 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"errors"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/mail"
+	"testing"
+	"time"
+)
+
+func TestBuildMessage_WithAttachment(t *testing.T) {
+	msg := &Message{
+		To:      []string{"auditor@example.com", "security@example.com"},
+		Subject: "Weekly access review",
+		Body:    "Report attached.",
+		Attachments: []Attachment{
+			{Filename: "access-review.csv", ContentType: "text/csv", Data: bytes.Repeat([]byte("a,b\n"), 100)},
+		},
+	}
+
+	raw, err := buildMessage("openpam@example.com", msg, time.Date(2024, 1, 1, 9, 0, 0, 0, time.UTC))
+	if err != nil {
+		t.Fatalf("buildMessage() error = %v", err)
+	}
+
+	parsed, err := mail.ReadMessage(bytes.NewReader(raw))
+	if err != nil {
+		t.Fatalf("ReadMessage() error = %v", err)
+	}
+
+	if got := parsed.Header.Get("To"); got != "auditor@example.com, security@example.com" {
+		t.Errorf("To = %q", got)
+	}
+
+	mediaType, params, err := mime.ParseMediaType(parsed.Header.Get("Content-Type"))
+	if err != nil || mediaType != "multipart/mixed" {
+		t.Fatalf("Content-Type = %q, %v", mediaType, err)
+	}
+
+	reader := multipart.NewReader(parsed.Body, params["boundary"])
+
+	body, err := reader.NextPart()
+	if err != nil {
+		t.Fatalf("NextPart() error = %v", err)
+	}
+	if text := decodePart(t, body); string(text) != msg.Body {
+		t.Errorf("body = %q, want %q", text, msg.Body)
+	}
+
+	attachment, err := reader.NextPart()
+	if err != nil {
+		t.Fatalf("NextPart() error = %v", err)
+	}
+	if attachment.FileName() != "access-review.csv" {
+		t.Errorf("filename = %q", attachment.FileName())
+	}
+	data := decodePart(t, attachment)
+	if !bytes.Equal(data, msg.Attachments[0].Data) {
+		t.Errorf("attachment data does not round-trip")
+	}
+
+	if _, err := reader.NextPart(); err != io.EOF {
+		t.Errorf("expected end of message, got %v", err)
+	}
+}
+
+func TestBuildMessage_RejectsHeaderInjection(t *testing.T) {
+	msg := &Message{To: []string{"auditor@example.com\r\nBcc: attacker@example.com"}, Subject: "Report"}
+
+	if _, err := buildMessage("openpam@example.com", msg, time.Now()); err == nil {
+		t.Error("expected error for recipient containing a line break")
+	}
+}
+
+func TestSMTPNotifier_NotConfigured(t *testing.T) {
+	n := NewSMTPNotifier(SMTPConfig{})
+
+	err := n.Send(context.Background(), &Message{To: []string{"auditor@example.com"}})
+	if !errors.Is(err, ErrNotConfigured) {
+		t.Errorf("Send() error = %v, want ErrNotConfigured", err)
+	}
+}
+
+func decodePart(t *testing.T, part *multipart.Part) []byte {
+	t.Helper()
+	if enc := part.Header.Get("Content-Transfer-Encoding"); enc != "base64" {
+		t.Fatalf("Content-Transfer-Encoding = %q, want base64", enc)
+	}
+	data, err := io.ReadAll(base64.NewDecoder(base64.StdEncoding, part))
+	if err != nil {
+		t.Fatalf("failed to decode part: %v", err)
+	}
+	return data
+}
+
+func TestBuildMessage_AppendsActions(t *testing.T) {
+	msg := &Message{
+		To:      []string{"admin@example.com"},
+		Subject: "Access request",
+		Body:    "alice@example.com requests access.\n",
+		Actions: []Action{
+			{Label: "Approve", URL: "https://pam.example.com/approvals/apt_x?action=approve"},
+			{Label: "Reject", URL: "https://pam.example.com/approvals/apt_x?action=reject"},
+		},
+	}
+
+	raw, err := buildMessage("openpam@example.com", msg, time.Now())
+	if err != nil {
+		t.Fatalf("buildMessage() error = %v", err)
+	}
+	parsed, err := mail.ReadMessage(bytes.NewReader(raw))
+	if err != nil {
+		t.Fatalf("ReadMessage() error = %v", err)
+	}
+	body, err := io.ReadAll(base64.NewDecoder(base64.StdEncoding, parsed.Body))
+	if err != nil {
+		t.Fatalf("decode body: %v", err)
+	}
+
+	want := "alice@example.com requests access.\n\n" +
+		"Approve: https://pam.example.com/approvals/apt_x?action=approve\n" +
+		"Reject: https://pam.example.com/approvals/apt_x?action=reject\n"
+	if string(body) != want {
+		t.Errorf("body = %q, want %q", body, want)
+	}
+}
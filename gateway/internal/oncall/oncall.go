@@ -0,0 +1,64 @@
+// Package oncall gives the engineers on call in PagerDuty or Opsgenie access
+// to the targets of a zone for the length of their shifts. Each mapping of an
+// external schedule to a zone is synced periodically into approved access
+// schedules, one per shift and target, which are revoked when the shift is
+// taken away and end with it.
+package oncall
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"strings"
+	"time"
+)
+
+// ErrNotConfigured is returned for mappings of a provider without credentials
+var ErrNotConfigured = errors.New("on-call provider is not configured")
+
+// Shift is a period someone is on call
+type Shift struct {
+	Email string
+	Start time.Time
+	End   time.Time
+}
+
+// Provider reads shifts from an external on-call schedule
+type Provider interface {
+	// Shifts returns the shifts of the schedule that overlap from..to
+	Shifts(ctx context.Context, scheduleID string, from, to time.Time) ([]Shift, error)
+}
+
+// mergeShifts joins the overlapping and back-to-back shifts of each person,
+// so consecutive shifts and the same shift reported twice give one window.
+// Emails are lowercased; the result is ordered by email and start.
+func mergeShifts(shifts []Shift) []Shift {
+	sorted := make([]Shift, 0, len(shifts))
+	for _, shift := range shifts {
+		if shift.Email == "" || !shift.End.After(shift.Start) {
+			continue
+		}
+		shift.Email = strings.ToLower(shift.Email)
+		shift.Start = shift.Start.UTC()
+		shift.End = shift.End.UTC()
+		sorted = append(sorted, shift)
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		if sorted[i].Email != sorted[j].Email {
+			return sorted[i].Email < sorted[j].Email
+		}
+		return sorted[i].Start.Before(sorted[j].Start)
+	})
+
+	var merged []Shift
+	for _, shift := range sorted {
+		if n := len(merged); n > 0 && merged[n-1].Email == shift.Email && !shift.Start.After(merged[n-1].End) {
+			if shift.End.After(merged[n-1].End) {
+				merged[n-1].End = shift.End
+			}
+			continue
+		}
+		merged = append(merged, shift)
+	}
+	return merged
+}
@@ -0,0 +1,122 @@
+package oncall
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// OpsgenieConfig holds Opsgenie API settings
+type OpsgenieConfig struct {
+	APIKey string // API integration key with read access
+	APIURL string // Defaults to https://api.opsgenie.com; https://api.eu.opsgenie.com for the EU instance
+}
+
+// Opsgenie reads shifts from Opsgenie schedules
+type Opsgenie struct {
+	config OpsgenieConfig
+	client *http.Client
+}
+
+// NewOpsgenie creates an Opsgenie provider. Requests fail with
+// ErrNotConfigured if no API key is set.
+func NewOpsgenie(cfg OpsgenieConfig) *Opsgenie {
+	if cfg.APIURL == "" {
+		cfg.APIURL = "https://api.opsgenie.com"
+	}
+	cfg.APIURL = strings.TrimRight(cfg.APIURL, "/")
+
+	return &Opsgenie{
+		config: cfg,
+		client: &http.Client{Timeout: 15 * time.Second},
+	}
+}
+
+// opsgenieTimeline is the schedule timeline response
+type opsgenieTimeline struct {
+	Data struct {
+		FinalTimeline struct {
+			Rotations []struct {
+				Periods []struct {
+					StartDate time.Time `json:"startDate"`
+					EndDate   time.Time `json:"endDate"`
+					Recipient struct {
+						Type string `json:"type"`
+						Name string `json:"name"` // The username, which is the email address
+					} `json:"recipient"`
+				} `json:"periods"`
+			} `json:"rotations"`
+		} `json:"finalTimeline"`
+	} `json:"data"`
+}
+
+// Shifts returns the periods of the schedule's final timeline, overrides
+// included, that overlap from..to. The timeline is read in whole days from
+// midnight UTC, so shifts cut by its end only move when the day does.
+func (o *Opsgenie) Shifts(ctx context.Context, scheduleID string, from, to time.Time) ([]Shift, error) {
+	if o.config.APIKey == "" {
+		return nil, ErrNotConfigured
+	}
+
+	day := from.UTC().Truncate(24 * time.Hour)
+	days := int((to.Sub(day) + 24*time.Hour - 1) / (24 * time.Hour))
+	if days < 1 {
+		days = 1
+	}
+
+	query := url.Values{
+		"identifierType": {"id"},
+		"date":           {day.Format(time.RFC3339)},
+		"interval":       {strconv.Itoa(days)},
+		"intervalUnit":   {"days"},
+	}
+
+	var timeline opsgenieTimeline
+	if err := o.get(ctx, "/v2/schedules/"+url.PathEscape(scheduleID)+"/timeline?"+query.Encode(), &timeline); err != nil {
+		return nil, err
+	}
+
+	var shifts []Shift
+	for _, rotation := range timeline.Data.FinalTimeline.Rotations {
+		for _, period := range rotation.Periods {
+			// Escalations and teams can be on a rotation too; only people get access
+			if period.Recipient.Type != "user" {
+				continue
+			}
+			if !period.EndDate.After(from) || !period.StartDate.Before(to) {
+				continue
+			}
+			shifts = append(shifts, Shift{Email: period.Recipient.Name, Start: period.StartDate, End: period.EndDate})
+		}
+	}
+	return shifts, nil
+}
+
+// get calls an Opsgenie API endpoint and decodes its response into out
+func (o *Opsgenie) get(ctx context.Context, path string, out interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, o.config.APIURL+path, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "GenieKey "+o.config.APIKey)
+
+	resp, err := o.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("Opsgenie API returned status %d", resp.StatusCode)
+	}
+
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("failed to decode Opsgenie response: %w", err)
+	}
+	return nil
+}
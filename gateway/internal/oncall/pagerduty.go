@@ -0,0 +1,120 @@
+package oncall
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// pagerDutyPageSize is the number of on-call entries requested per page
+const pagerDutyPageSize = 100
+
+// PagerDutyConfig holds PagerDuty REST API settings
+type PagerDutyConfig struct {
+	APIToken string // Read-only REST API key
+	APIURL   string // Defaults to https://api.pagerduty.com
+}
+
+// PagerDuty reads shifts from PagerDuty schedules
+type PagerDuty struct {
+	config PagerDutyConfig
+	client *http.Client
+}
+
+// NewPagerDuty creates a PagerDuty provider. Requests fail with
+// ErrNotConfigured if no API token is set.
+func NewPagerDuty(cfg PagerDutyConfig) *PagerDuty {
+	if cfg.APIURL == "" {
+		cfg.APIURL = "https://api.pagerduty.com"
+	}
+	cfg.APIURL = strings.TrimRight(cfg.APIURL, "/")
+
+	return &PagerDuty{
+		config: cfg,
+		client: &http.Client{Timeout: 15 * time.Second},
+	}
+}
+
+// pagerDutyOnCalls is a page of the /oncalls response
+type pagerDutyOnCalls struct {
+	OnCalls []struct {
+		User struct {
+			Email string `json:"email"`
+		} `json:"user"`
+		Start *time.Time `json:"start"`
+		End   *time.Time `json:"end"`
+	} `json:"oncalls"`
+	More bool `json:"more"`
+}
+
+// Shifts returns the on-call entries of the schedule between from and to. The
+// schedule appears once per escalation policy that uses it, so the same shift
+// may be returned more than once.
+func (p *PagerDuty) Shifts(ctx context.Context, scheduleID string, from, to time.Time) ([]Shift, error) {
+	if p.config.APIToken == "" {
+		return nil, ErrNotConfigured
+	}
+
+	var shifts []Shift
+	for offset := 0; ; offset += pagerDutyPageSize {
+		query := url.Values{
+			"schedule_ids[]": {scheduleID},
+			"include[]":      {"users"},
+			"since":          {from.UTC().Format(time.RFC3339)},
+			"until":          {to.UTC().Format(time.RFC3339)},
+			"limit":          {strconv.Itoa(pagerDutyPageSize)},
+			"offset":         {strconv.Itoa(offset)},
+		}
+
+		var page pagerDutyOnCalls
+		if err := p.get(ctx, "/oncalls?"+query.Encode(), &page); err != nil {
+			return nil, err
+		}
+
+		for _, oc := range page.OnCalls {
+			// Entries without times are permanent on-call, bounded here by the window
+			shift := Shift{Email: oc.User.Email, Start: from, End: to}
+			if oc.Start != nil {
+				shift.Start = *oc.Start
+			}
+			if oc.End != nil {
+				shift.End = *oc.End
+			}
+			shifts = append(shifts, shift)
+		}
+
+		if !page.More || len(page.OnCalls) == 0 {
+			return shifts, nil
+		}
+	}
+}
+
+// get calls a PagerDuty REST API endpoint and decodes its response into out
+func (p *PagerDuty) get(ctx context.Context, path string, out interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, p.config.APIURL+path, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Token token="+p.config.APIToken)
+	req.Header.Set("Accept", "application/vnd.pagerduty+json;version=2")
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("PagerDuty API returned status %d", resp.StatusCode)
+	}
+
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("failed to decode PagerDuty response: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,77 @@
+package oncall
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestPagerDuty_Shifts(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Token token=pd-test" {
+			t.Errorf("Authorization = %q", r.Header.Get("Authorization"))
+		}
+		q := r.URL.Query()
+		if r.URL.Path != "/oncalls" || q.Get("schedule_ids[]") != "PSCHED1" || q.Get("include[]") != "users" {
+			t.Errorf("unexpected call %s", r.URL)
+		}
+		switch q.Get("offset") {
+		case "0":
+			w.Write([]byte(`{"oncalls":[{"user":{"email":"alice@example.com"},"start":"2025-01-24T08:00:00Z","end":"2025-01-24T20:00:00Z"}],"more":true}`))
+		default:
+			w.Write([]byte(`{"oncalls":[{"user":{"email":"bob@example.com"},"start":"2025-01-24T20:00:00Z","end":"2025-01-25T08:00:00Z"}],"more":false}`))
+		}
+	}))
+	defer srv.Close()
+
+	from := time.Date(2025, 1, 24, 12, 0, 0, 0, time.UTC)
+	p := NewPagerDuty(PagerDutyConfig{APIToken: "pd-test", APIURL: srv.URL + "/"})
+	shifts, err := p.Shifts(context.Background(), "PSCHED1", from, from.Add(24*time.Hour))
+	if err != nil {
+		t.Fatalf("Shifts() error = %v", err)
+	}
+
+	if len(shifts) != 2 || shifts[0].Email != "alice@example.com" || shifts[1].Email != "bob@example.com" {
+		t.Fatalf("shifts = %+v", shifts)
+	}
+	if !shifts[1].End.Equal(time.Date(2025, 1, 25, 8, 0, 0, 0, time.UTC)) {
+		t.Errorf("end = %v", shifts[1].End)
+	}
+
+	if _, err := NewPagerDuty(PagerDutyConfig{}).Shifts(context.Background(), "PSCHED1", from, from); !errors.Is(err, ErrNotConfigured) {
+		t.Errorf("error without a token = %v", err)
+	}
+}
+
+func TestOpsgenie_Shifts(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "GenieKey og-test" {
+			t.Errorf("Authorization = %q", r.Header.Get("Authorization"))
+		}
+		q := r.URL.Query()
+		if r.URL.Path != "/v2/schedules/sched-1/timeline" || q.Get("date") != "2025-01-24T00:00:00Z" || q.Get("interval") != "2" {
+			t.Errorf("unexpected call %s", r.URL)
+		}
+		w.Write([]byte(`{"data":{"finalTimeline":{"rotations":[{"periods":[
+			{"startDate":"2025-01-24T00:00:00Z","endDate":"2025-01-24T06:00:00Z","recipient":{"type":"user","name":"early@example.com"}},
+			{"startDate":"2025-01-24T06:00:00Z","endDate":"2025-01-25T06:00:00Z","recipient":{"type":"user","name":"alice@example.com"}},
+			{"startDate":"2025-01-25T06:00:00Z","endDate":"2025-01-26T00:00:00Z","recipient":{"type":"escalation","name":"Ops_escalation"}}
+		]}]}}}`))
+	}))
+	defer srv.Close()
+
+	from := time.Date(2025, 1, 24, 12, 0, 0, 0, time.UTC)
+	o := NewOpsgenie(OpsgenieConfig{APIKey: "og-test", APIURL: srv.URL})
+	shifts, err := o.Shifts(context.Background(), "sched-1", from, from.Add(24*time.Hour))
+	if err != nil {
+		t.Fatalf("Shifts() error = %v", err)
+	}
+
+	// Periods that ended before the window and ones not for a user are left out
+	if len(shifts) != 1 || shifts[0].Email != "alice@example.com" {
+		t.Fatalf("shifts = %+v", shifts)
+	}
+}
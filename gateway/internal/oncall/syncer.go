@@ -0,0 +1,370 @@
+package oncall
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/VanCannon/openpam/gateway/internal/models"
+	"github.com/VanCannon/openpam/gateway/internal/worker"
+	"github.com/VanCannon/openpam/pkg/logger"
+	"github.com/google/uuid"
+)
+
+// MappingStore is the subset of the on-call mapping repository the syncer needs
+type MappingStore interface {
+	ClaimDue(ctx context.Context, now time.Time, interval time.Duration) ([]*models.OnCallMapping, error)
+	RecordSync(ctx context.Context, id uuid.UUID, at time.Time, status string, result *models.OnCallSyncResult, syncErr *string) error
+}
+
+// ScheduleStore is the subset of the schedule repository the syncer needs
+type ScheduleStore interface {
+	ListByOnCallMapping(ctx context.Context, mappingID uuid.UUID, now time.Time) ([]models.Schedule, error)
+	Create(ctx context.Context, schedule *models.Schedule) error
+	UpdateEndTime(ctx context.Context, id uuid.UUID, end time.Time) error
+	Revoke(ctx context.Context, id uuid.UUID, reason string) (*models.Schedule, error)
+}
+
+// UserStore looks up the OpenPAM users of on-call engineers
+type UserStore interface {
+	ListByEmails(ctx context.Context, emails []string) ([]*models.User, error)
+}
+
+// TargetStore lists the targets of a mapping's zone
+type TargetStore interface {
+	ListByZones(ctx context.Context, zoneIDs []uuid.UUID) ([]*models.Target, error)
+}
+
+// SessionChecker re-evaluates running sessions after their schedule changed
+type SessionChecker interface {
+	Recheck(userID, targetID uuid.UUID)
+}
+
+// AuditRecorder records system audit events
+type AuditRecorder interface {
+	CreateSimple(ctx context.Context, eventType string, userID *uuid.UUID, action string, status string, ipAddress *string, details map[string]interface{}) error
+}
+
+// Syncer keeps the access schedules of each enabled on-call mapping in line
+// with the shifts of its external schedule from now until the lookahead.
+// Shifts become approved schedules for every target in the mapping's zone;
+// schedules whose shift moved are updated and those whose shift is gone are
+// revoked, ending any sessions they allowed. Access ends with the shift
+// through the schedule's window.
+type Syncer struct {
+	providers map[string]Provider
+	mappings  MappingStore
+	schedules ScheduleStore
+	users     UserStore
+	targets   TargetStore
+	sessions  SessionChecker
+	audit     AuditRecorder
+	interval  time.Duration
+	lookahead time.Duration
+	logger    *logger.Logger
+
+	loop worker.Loop
+}
+
+// NewSyncer creates a syncer that syncs each mapping every interval. Providers
+// are keyed by models.OnCallProvider*.
+func NewSyncer(providers map[string]Provider, mappings MappingStore, schedules ScheduleStore, users UserStore, targets TargetStore, sessions SessionChecker, audit AuditRecorder, interval, lookahead time.Duration, log *logger.Logger) *Syncer {
+	if interval <= 0 {
+		interval = 5 * time.Minute
+	}
+	if lookahead < interval {
+		lookahead = interval
+	}
+
+	return &Syncer{
+		providers: providers,
+		mappings:  mappings,
+		schedules: schedules,
+		users:     users,
+		targets:   targets,
+		sessions:  sessions,
+		audit:     audit,
+		interval:  interval,
+		lookahead: lookahead,
+		logger:    log,
+	}
+}
+
+// Configured reports whether a provider has credentials
+func (s *Syncer) Configured(provider string) bool {
+	_, ok := s.providers[provider]
+	return ok
+}
+
+// Start runs the syncer in the background until Stop is called
+func (s *Syncer) Start() {
+	s.loop.Start(s.run)
+}
+
+// Stop stops the syncer and waits for an in-progress pass to finish.
+// It is safe to call even if the syncer was never started.
+func (s *Syncer) Stop() {
+	s.loop.Stop()
+}
+
+func (s *Syncer) run() {
+	// Check for due mappings more often than they are synced, so new and
+	// edited mappings don't wait for a whole interval
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+
+	for {
+		s.SyncDue(time.Now())
+
+		select {
+		case <-s.loop.Stopping():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// SyncDue syncs the mappings due at now
+func (s *Syncer) SyncDue(now time.Time) {
+	ctx, cancel := context.WithTimeout(context.Background(), s.interval)
+	defer cancel()
+
+	due, err := s.mappings.ClaimDue(ctx, now, s.interval)
+	if err != nil {
+		s.logger.Error("Failed to claim due on-call mappings", map[string]interface{}{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	for _, mapping := range due {
+		s.Sync(ctx, mapping, now)
+	}
+}
+
+// Sync brings the schedules of a mapping in line with its provider's shifts
+// and records the outcome on the mapping and in the audit log
+func (s *Syncer) Sync(ctx context.Context, mapping *models.OnCallMapping, now time.Time) (*models.OnCallSyncResult, error) {
+	result, err := s.sync(ctx, mapping, now)
+
+	status := models.OnCallSyncSuccess
+	eventType := models.EventTypeOnCallSynced
+	var syncErr *string
+	switch {
+	case err != nil:
+		status = models.OnCallSyncFailed
+		eventType = models.EventTypeOnCallSyncFailed
+		msg := err.Error()
+		syncErr = &msg
+	case len(result.UnknownUsers) > 0:
+		status = models.OnCallSyncPartial
+	}
+
+	if recordErr := s.mappings.RecordSync(ctx, mapping.ID, now, status, result, syncErr); recordErr != nil {
+		s.logger.Error("Failed to record on-call sync", map[string]interface{}{
+			"mapping_id": mapping.ID.String(),
+			"error":      recordErr.Error(),
+		})
+	}
+
+	// Syncs that change nothing are only kept on the mapping
+	if err != nil || result.Created+result.Updated+result.Revoked > 0 || len(result.UnknownUsers) > 0 {
+		details := map[string]interface{}{
+			"mapping_id":           mapping.ID.String(),
+			"provider":             mapping.Provider,
+			"external_schedule_id": mapping.ExternalScheduleID,
+			"zone_id":              mapping.ZoneID.String(),
+		}
+		if err != nil {
+			details["error"] = err.Error()
+		} else {
+			details["created"] = result.Created
+			details["updated"] = result.Updated
+			details["revoked"] = result.Revoked
+			if len(result.UnknownUsers) > 0 {
+				details["unknown_users"] = result.UnknownUsers
+			}
+		}
+		auditStatus := "success"
+		if err != nil {
+			auditStatus = "failure"
+		}
+		if auditErr := s.audit.CreateSimple(ctx, eventType, nil, "sync_oncall", auditStatus, nil, details); auditErr != nil {
+			s.logger.Error("Failed to record on-call sync event", map[string]interface{}{
+				"mapping_id": mapping.ID.String(),
+				"error":      auditErr.Error(),
+			})
+		}
+	}
+
+	if err != nil {
+		s.logger.Error("On-call sync failed", map[string]interface{}{
+			"mapping_id": mapping.ID.String(),
+			"provider":   mapping.Provider,
+			"error":      err.Error(),
+		})
+		return nil, err
+	}
+	return result, nil
+}
+
+// window is the access one shift gives to one target
+type window struct {
+	userID   uuid.UUID
+	targetID uuid.UUID
+	start    time.Time
+}
+
+func (s *Syncer) sync(ctx context.Context, mapping *models.OnCallMapping, now time.Time) (*models.OnCallSyncResult, error) {
+	provider, ok := s.providers[mapping.Provider]
+	if !ok {
+		return nil, fmt.Errorf("%s: %w", mapping.Provider, ErrNotConfigured)
+	}
+
+	shifts, err := provider.Shifts(ctx, mapping.ExternalScheduleID, now, now.Add(s.lookahead))
+	if err != nil {
+		return nil, fmt.Errorf("failed to get on-call shifts: %w", err)
+	}
+	shifts = mergeShifts(shifts)
+
+	targets, err := s.targets.ListByZones(ctx, []uuid.UUID{mapping.ZoneID})
+	if err != nil {
+		return nil, err
+	}
+
+	var emails []string
+	for i, shift := range shifts {
+		if i == 0 || shifts[i-1].Email != shift.Email {
+			emails = append(emails, shift.Email)
+		}
+	}
+	users := make(map[string]*models.User)
+	if len(emails) > 0 {
+		list, err := s.users.ListByEmails(ctx, emails)
+		if err != nil {
+			return nil, err
+		}
+		for _, user := range list {
+			if user.Enabled {
+				users[strings.ToLower(user.Email)] = user
+			}
+		}
+	}
+
+	result := &models.OnCallSyncResult{Shifts: len(shifts)}
+
+	// The windows the shifts give, in shift order, and where each ends
+	var wanted []window
+	ends := make(map[window]time.Time)
+	for i, shift := range shifts {
+		user := users[shift.Email]
+		if user == nil {
+			if i == 0 || shifts[i-1].Email != shift.Email {
+				result.UnknownUsers = append(result.UnknownUsers, shift.Email)
+			}
+			continue
+		}
+		if !shift.End.After(now) {
+			continue
+		}
+		for _, target := range targets {
+			w := window{userID: user.ID, targetID: target.ID, start: shift.Start}
+			wanted = append(wanted, w)
+			ends[w] = shift.End
+		}
+	}
+
+	existing, err := s.schedules.ListByOnCallMapping(ctx, mapping.ID, now)
+	if err != nil {
+		return nil, err
+	}
+
+	kept := make(map[window]bool)
+	var stale []*models.Schedule
+	for i := range existing {
+		sched := &existing[i]
+		w := window{userID: sched.UserID, targetID: sched.TargetID, start: sched.StartTime.UTC()}
+		end, ok := ends[w]
+		if !ok || kept[w] {
+			// Revoked last, so a session moving to the next shift keeps its access
+			stale = append(stale, sched)
+			continue
+		}
+		kept[w] = true
+
+		if sched.EndTime.Equal(end) {
+			result.Unchanged++
+			continue
+		}
+		if err := s.schedules.UpdateEndTime(ctx, sched.ID, end); err != nil {
+			return result, err
+		}
+		result.Updated++
+		s.sessions.Recheck(sched.UserID, sched.TargetID)
+	}
+
+	for _, w := range wanted {
+		if kept[w] {
+			continue
+		}
+		sched := &models.Schedule{
+			ID:        uuid.New(),
+			UserID:    w.userID,
+			TargetID:  w.targetID,
+			StartTime: w.start,
+			EndTime:   ends[w],
+			Timezone:  "UTC",
+			Status:    models.ScheduleStatusPending,
+			CreatedAt: now,
+			UpdatedAt: now,
+			Metadata: models.JSONB{
+				models.ScheduleMetadataOnCallMapping: mapping.ID.String(),
+				"oncall_provider":                    mapping.Provider,
+				"oncall_schedule_id":                 mapping.ExternalScheduleID,
+			},
+			ApprovalStatus: models.ApprovalStatusApproved,
+			ApprovedAt:     &now,
+		}
+		if err := s.schedules.Create(ctx, sched); err != nil {
+			return result, fmt.Errorf("failed to create on-call schedule: %w", err)
+		}
+		kept[w] = true
+		result.Created++
+	}
+
+	for _, sched := range stale {
+		revoked, err := s.schedules.Revoke(ctx, sched.ID, "No longer on call")
+		if err != nil {
+			return result, err
+		}
+		if revoked != nil {
+			result.Revoked++
+			s.sessions.Recheck(sched.UserID, sched.TargetID)
+		}
+	}
+
+	return result, nil
+}
+
+// Release revokes the schedules a mapping maintains, for when it is disabled
+// or deleted, and returns how many were revoked
+func (s *Syncer) Release(ctx context.Context, mappingID uuid.UUID, reason string) (int, error) {
+	existing, err := s.schedules.ListByOnCallMapping(ctx, mappingID, time.Now())
+	if err != nil {
+		return 0, err
+	}
+
+	revoked := 0
+	for i := range existing {
+		sched, err := s.schedules.Revoke(ctx, existing[i].ID, reason)
+		if err != nil {
+			return revoked, err
+		}
+		if sched != nil {
+			revoked++
+			s.sessions.Recheck(sched.UserID, sched.TargetID)
+		}
+	}
+	return revoked, nil
+}
@@ -0,0 +1,219 @@
+package oncall
+
+import (
+	"context"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/VanCannon/openpam/gateway/internal/models"
+	"github.com/VanCannon/openpam/pkg/logger"
+	"github.com/google/uuid"
+)
+
+type fakeProvider struct {
+	shifts []Shift
+}
+
+func (f *fakeProvider) Shifts(ctx context.Context, scheduleID string, from, to time.Time) ([]Shift, error) {
+	return f.shifts, nil
+}
+
+type fakeMappings struct {
+	status string
+}
+
+func (f *fakeMappings) ClaimDue(ctx context.Context, now time.Time, interval time.Duration) ([]*models.OnCallMapping, error) {
+	return nil, nil
+}
+
+func (f *fakeMappings) RecordSync(ctx context.Context, id uuid.UUID, at time.Time, status string, result *models.OnCallSyncResult, syncErr *string) error {
+	f.status = status
+	return nil
+}
+
+type fakeSchedules struct {
+	schedules map[uuid.UUID]*models.Schedule
+}
+
+func (f *fakeSchedules) ListByOnCallMapping(ctx context.Context, mappingID uuid.UUID, now time.Time) ([]models.Schedule, error) {
+	var list []models.Schedule
+	for _, s := range f.schedules {
+		if s.Metadata[models.ScheduleMetadataOnCallMapping] == mappingID.String() && s.Status != models.ScheduleStatusCancelled && s.EndTime.After(now) {
+			list = append(list, *s)
+		}
+	}
+	return list, nil
+}
+
+func (f *fakeSchedules) Create(ctx context.Context, schedule *models.Schedule) error {
+	copied := *schedule
+	f.schedules[schedule.ID] = &copied
+	return nil
+}
+
+func (f *fakeSchedules) UpdateEndTime(ctx context.Context, id uuid.UUID, end time.Time) error {
+	f.schedules[id].EndTime = end
+	return nil
+}
+
+func (f *fakeSchedules) Revoke(ctx context.Context, id uuid.UUID, reason string) (*models.Schedule, error) {
+	s := f.schedules[id]
+	if s.Status == models.ScheduleStatusCancelled {
+		return nil, nil
+	}
+	s.Status = models.ScheduleStatusCancelled
+	copied := *s
+	return &copied, nil
+}
+
+func (f *fakeSchedules) active() []*models.Schedule {
+	var list []*models.Schedule
+	for _, s := range f.schedules {
+		if s.Status != models.ScheduleStatusCancelled {
+			list = append(list, s)
+		}
+	}
+	return list
+}
+
+type fakeUsers []*models.User
+
+func (f fakeUsers) ListByEmails(ctx context.Context, emails []string) ([]*models.User, error) {
+	return f, nil
+}
+
+type fakeTargets []*models.Target
+
+func (f fakeTargets) ListByZones(ctx context.Context, zoneIDs []uuid.UUID) ([]*models.Target, error) {
+	return f, nil
+}
+
+type fakeSessions struct {
+	rechecked int
+}
+
+func (f *fakeSessions) Recheck(userID, targetID uuid.UUID) {
+	f.rechecked++
+}
+
+type fakeAudit struct{}
+
+func (fakeAudit) CreateSimple(ctx context.Context, eventType string, userID *uuid.UUID, action string, status string, ipAddress *string, details map[string]interface{}) error {
+	return nil
+}
+
+func TestMergeShifts(t *testing.T) {
+	base := time.Date(2025, 1, 24, 0, 0, 0, 0, time.UTC)
+	merged := mergeShifts([]Shift{
+		{Email: "Bob@example.com", Start: base.Add(12 * time.Hour), End: base.Add(24 * time.Hour)},
+		{Email: "alice@example.com", Start: base, End: base.Add(8 * time.Hour)},
+		{Email: "alice@example.com", Start: base, End: base.Add(8 * time.Hour)}, // Reported twice
+		{Email: "alice@example.com", Start: base.Add(8 * time.Hour), End: base.Add(16 * time.Hour)},
+		{Email: "bob@example.com", Start: base.Add(30 * time.Hour), End: base.Add(36 * time.Hour)},
+		{Email: "", Start: base, End: base.Add(time.Hour)},
+	})
+
+	want := []Shift{
+		{Email: "alice@example.com", Start: base, End: base.Add(16 * time.Hour)},
+		{Email: "bob@example.com", Start: base.Add(12 * time.Hour), End: base.Add(24 * time.Hour)},
+		{Email: "bob@example.com", Start: base.Add(30 * time.Hour), End: base.Add(36 * time.Hour)},
+	}
+	if len(merged) != len(want) {
+		t.Fatalf("merged = %+v", merged)
+	}
+	for i := range want {
+		if merged[i].Email != want[i].Email || !merged[i].Start.Equal(want[i].Start) || !merged[i].End.Equal(want[i].End) {
+			t.Errorf("merged[%d] = %+v, want %+v", i, merged[i], want[i])
+		}
+	}
+}
+
+func TestSyncer_Sync(t *testing.T) {
+	now := time.Now().UTC().Truncate(time.Second)
+	alice := &models.User{ID: uuid.New(), Email: "alice@example.com", Enabled: true}
+	bob := &models.User{ID: uuid.New(), Email: "bob@example.com", Enabled: true}
+	targets := fakeTargets{{ID: uuid.New()}, {ID: uuid.New()}}
+
+	provider := &fakeProvider{shifts: []Shift{
+		{Email: "alice@example.com", Start: now.Add(-4 * time.Hour), End: now.Add(8 * time.Hour)},
+		{Email: "bob@example.com", Start: now.Add(8 * time.Hour), End: now.Add(20 * time.Hour)},
+		{Email: "carol@example.com", Start: now.Add(20 * time.Hour), End: now.Add(32 * time.Hour)},
+	}}
+	mappings := &fakeMappings{}
+	schedules := &fakeSchedules{schedules: make(map[uuid.UUID]*models.Schedule)}
+	sessions := &fakeSessions{}
+	s := NewSyncer(map[string]Provider{models.OnCallProviderPagerDuty: provider}, mappings, schedules,
+		fakeUsers{alice, bob}, targets, sessions, fakeAudit{}, 5*time.Minute, 24*time.Hour, logger.New(logger.LevelError, io.Discard))
+
+	mapping := &models.OnCallMapping{ID: uuid.New(), Provider: models.OnCallProviderPagerDuty, ExternalScheduleID: "PSCHED1"}
+
+	// First sync: a schedule per known engineer's shift and target
+	result, err := s.Sync(context.Background(), mapping, now)
+	if err != nil {
+		t.Fatalf("Sync() error = %v", err)
+	}
+	if result.Created != 4 || len(result.UnknownUsers) != 1 || result.UnknownUsers[0] != "carol@example.com" {
+		t.Fatalf("result = %+v", result)
+	}
+	if mappings.status != models.OnCallSyncPartial {
+		t.Errorf("status = %q, want partial", mappings.status)
+	}
+	for _, sched := range schedules.active() {
+		if sched.ApprovalStatus != models.ApprovalStatusApproved {
+			t.Errorf("schedule was created %s", sched.ApprovalStatus)
+		}
+	}
+
+	// Nothing changed: nothing to do
+	result, _ = s.Sync(context.Background(), mapping, now)
+	if result.Created+result.Updated+result.Revoked != 0 || result.Unchanged != 4 {
+		t.Fatalf("resync result = %+v", result)
+	}
+
+	// Alice hands over early to Bob, whose shift is moved up
+	provider.shifts = []Shift{
+		{Email: "alice@example.com", Start: now.Add(-4 * time.Hour), End: now.Add(time.Hour)},
+		{Email: "bob@example.com", Start: now.Add(time.Hour), End: now.Add(20 * time.Hour)},
+	}
+	result, _ = s.Sync(context.Background(), mapping, now)
+	if result.Updated != 2 || result.Created != 2 || result.Revoked != 2 {
+		t.Fatalf("handover result = %+v", result)
+	}
+	if sessions.rechecked != 4 {
+		t.Errorf("rechecked %d sessions, want 4", sessions.rechecked)
+	}
+	for _, sched := range schedules.active() {
+		if sched.UserID == alice.ID && !sched.EndTime.Equal(now.Add(time.Hour)) {
+			t.Errorf("alice's access ends %v", sched.EndTime)
+		}
+		if sched.UserID == bob.ID && !sched.StartTime.Equal(now.Add(time.Hour)) {
+			t.Errorf("bob's access starts %v", sched.StartTime)
+		}
+	}
+	if mappings.status != models.OnCallSyncSuccess {
+		t.Errorf("status = %q, want success", mappings.status)
+	}
+
+	// Releasing the mapping revokes everything it maintains
+	if n, err := s.Release(context.Background(), mapping.ID, "Mapping deleted"); err != nil || n != 4 {
+		t.Errorf("Release() = %d, %v", n, err)
+	}
+	if len(schedules.active()) != 0 {
+		t.Error("schedules were left after release")
+	}
+}
+
+func TestSyncer_NotConfigured(t *testing.T) {
+	mappings := &fakeMappings{}
+	s := NewSyncer(nil, mappings, &fakeSchedules{}, fakeUsers{}, fakeTargets{}, &fakeSessions{}, fakeAudit{},
+		time.Minute, time.Hour, logger.New(logger.LevelError, io.Discard))
+
+	mapping := &models.OnCallMapping{ID: uuid.New(), Provider: models.OnCallProviderOpsgenie}
+	if _, err := s.Sync(context.Background(), mapping, time.Now()); err == nil {
+		t.Fatal("sync of an unconfigured provider succeeded")
+	}
+	if mappings.status != models.OnCallSyncFailed {
+		t.Errorf("status = %q, want failed", mappings.status)
+	}
+}
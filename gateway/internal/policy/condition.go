@@ -0,0 +1,155 @@
+package policy
+
+import (
+	"fmt"
+	"maps"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/VanCannon/openpam/gateway/internal/models"
+	"github.com/google/cel-go/cel"
+)
+
+// MaxConditionLength limits the length of a rule's condition
+const MaxConditionLength = 2000
+
+// conditionCostLimit bounds the work one evaluation of a condition may do, so
+// an expression looping over large lists can't stall a decision
+const conditionCostLimit = 100000
+
+// Condition is a compiled rule condition: a CEL expression over the user, the
+// target, the credential and the time of a request, such as
+//
+//	user.department == target.labels.owner_team && time.hour >= 8 && time.hour < 18
+type Condition struct {
+	expr    string
+	program cel.Program
+}
+
+// conditionEnv declares the variables conditions can use. They are maps, so a
+// condition testing an attribute or label that isn't set fails to evaluate;
+// has(user.department) tests whether it is.
+var conditionEnv = sync.OnceValues(func() (*cel.Env, error) {
+	return cel.NewEnv(
+		cel.Variable("user", cel.MapType(cel.StringType, cel.DynType)),
+		cel.Variable("target", cel.MapType(cel.StringType, cel.DynType)),
+		cel.Variable("credential", cel.MapType(cel.StringType, cel.DynType)),
+		cel.Variable("time", cel.MapType(cel.StringType, cel.DynType)),
+	)
+})
+
+// compiled caches conditions by expression, as rules are evaluated far more
+// often than they change
+var compiled sync.Map
+
+// CompileCondition parses and checks a condition. It must be a boolean
+// expression over the declared variables.
+func CompileCondition(expr string) (*Condition, error) {
+	if c, ok := compiled.Load(expr); ok {
+		return c.(*Condition), nil
+	}
+
+	if utf8.RuneCountInString(expr) > MaxConditionLength {
+		return nil, fmt.Errorf("condition must be at most %d characters", MaxConditionLength)
+	}
+	env, err := conditionEnv()
+	if err != nil {
+		return nil, fmt.Errorf("failed to set up conditions: %w", err)
+	}
+	ast, iss := env.Compile(expr)
+	if iss.Err() != nil {
+		return nil, iss.Err()
+	}
+	if ast.OutputType() != cel.BoolType {
+		return nil, fmt.Errorf("condition must be a boolean expression, not %s", ast.OutputType())
+	}
+	program, err := env.Program(ast, cel.CostLimit(conditionCostLimit))
+	if err != nil {
+		return nil, err
+	}
+
+	c, _ := compiled.LoadOrStore(expr, &Condition{expr: expr, program: program})
+	return c.(*Condition), nil
+}
+
+// String returns the condition's expression
+func (c *Condition) String() string {
+	return c.expr
+}
+
+// Eval evaluates the condition for the subject using the credential on the
+// target at a time
+func (c *Condition) Eval(subject Subject, target *models.Target, cred *models.Credential, at time.Time) (bool, error) {
+	out, _, err := c.program.Eval(conditionVars(subject, target, cred, at))
+	if err != nil {
+		return false, err
+	}
+	result, ok := out.Value().(bool)
+	if !ok {
+		return false, fmt.Errorf("condition returned %v, not a boolean", out.Value())
+	}
+	return result, nil
+}
+
+// conditionVars are the variables a condition is evaluated with. The user's
+// attributes are also fields of user itself, unless they clash with one of
+// the fields below.
+func conditionVars(subject Subject, target *models.Target, cred *models.Credential, at time.Time) map[string]any {
+	groups := make([]string, len(subject.Groups))
+	for i, id := range subject.Groups {
+		groups[i] = id.String()
+	}
+	attributes := subject.Attributes
+	if attributes == nil {
+		attributes = map[string]string{}
+	}
+
+	user := make(map[string]any, len(attributes)+5)
+	for k, v := range attributes {
+		user[k] = v
+	}
+	maps.Copy(user, map[string]any{
+		"id":         subject.UserID.String(),
+		"email":      subject.Email,
+		"role":       subject.Role,
+		"groups":     groups,
+		"attributes": attributes,
+	})
+
+	labels := map[string]string(target.Labels)
+	if labels == nil {
+		labels = map[string]string{}
+	}
+
+	at = at.UTC()
+	return map[string]any{
+		"user": user,
+		"target": map[string]any{
+			"id":               target.ID.String(),
+			"name":             target.Name,
+			"hostname":         target.Hostname,
+			"protocol":         target.Protocol,
+			"port":             target.Port,
+			"zone_id":          target.ZoneID.String(),
+			"owner_team":       target.OwnerTeam,
+			"environment":      target.Environment,
+			"compliance_scope": []string(target.ComplianceScope),
+			"labels":           labels,
+		},
+		"credential": map[string]any{
+			"id":       cred.ID.String(),
+			"username": cred.Username,
+			"tags":     []string(cred.Tags),
+		},
+		"time": map[string]any{
+			"now":     at,
+			"hour":    at.Hour(),
+			"minute":  at.Minute(),
+			"weekday": int(at.Weekday()), // 0 is Sunday
+			"day":     at.Day(),
+			"month":   int(at.Month()),
+			"year":    at.Year(),
+		},
+	}
+}
@@ -0,0 +1,137 @@
+package policy
+
+import (
+	"context"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/VanCannon/openpam/gateway/internal/models"
+	"github.com/VanCannon/openpam/pkg/logger"
+	"github.com/google/uuid"
+)
+
+func TestCompileCondition(t *testing.T) {
+	tests := []struct {
+		expr    string
+		wantErr string
+	}{
+		{expr: `user.department == target.labels.owner_team && time.hour >= 8 && time.hour < 18`},
+		{expr: `has(user.department) && "privileged" in credential.tags`},
+		{expr: `time.now.getDayOfWeek("Europe/Berlin") in [1, 2, 3, 4, 5]`},
+		{expr: `user.department ==`, wantErr: "Syntax error"},
+		{expr: `employee.department == "ops"`, wantErr: "undeclared reference"},
+		{expr: `time.hour + 1`, wantErr: "boolean expression"},
+		{expr: strings.Repeat("true && ", MaxConditionLength) + "true", wantErr: "at most"},
+	}
+
+	for _, tt := range tests {
+		_, err := CompileCondition(tt.expr)
+		if tt.wantErr == "" {
+			if err != nil {
+				t.Errorf("CompileCondition(%q) error = %v", tt.expr, err)
+			}
+			continue
+		}
+		if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+			t.Errorf("CompileCondition(%.40q) error = %v, want one about %q", tt.expr, err, tt.wantErr)
+		}
+	}
+}
+
+func TestCondition_Eval(t *testing.T) {
+	target := &models.Target{ID: uuid.New(), Name: "db-1", Labels: models.Labels{"owner_team": "payments"}}
+	cred := &models.Credential{ID: uuid.New(), Username: "root", Tags: []string{models.CredentialTagPrivileged}}
+	subject := Subject{UserID: uuid.New(), Role: models.RoleUser, Attributes: map[string]string{"department": "payments", "role": "dba"}}
+	workday := time.Date(2026, 3, 4, 10, 30, 0, 0, time.UTC) // A Wednesday
+	evening := time.Date(2026, 3, 4, 20, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name    string
+		expr    string
+		subject Subject
+		at      time.Time
+		want    bool
+		wantErr bool
+	}{
+		{name: "own team in hours", expr: `user.department == target.labels.owner_team && time.hour >= 8 && time.hour < 18`, subject: subject, at: workday, want: true},
+		{name: "own team after hours", expr: `user.department == target.labels.owner_team && time.hour >= 8 && time.hour < 18`, subject: subject, at: evening},
+		{name: "weekday", expr: `time.weekday == 3`, subject: subject, at: workday, want: true},
+		{name: "fields win over attributes", expr: `user.role == "user" && user.attributes.role == "dba"`, subject: subject, at: workday, want: true},
+		{name: "credential tags", expr: `"privileged" in credential.tags`, subject: subject, at: workday, want: true},
+		{name: "attribute not set", expr: `user.department == "payments"`, subject: Subject{UserID: subject.UserID}, at: workday, wantErr: true},
+		{name: "has attribute", expr: `has(user.department)`, subject: Subject{UserID: subject.UserID}, at: workday},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			condition, err := CompileCondition(tt.expr)
+			if err != nil {
+				t.Fatalf("CompileCondition() error = %v", err)
+			}
+			got, err := condition.Eval(tt.subject, target, cred, tt.at)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Eval() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("Eval() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// staticUsers is a UserStore over a fixed set of users
+type staticUsers map[uuid.UUID]*models.User
+
+func (s staticUsers) GetByID(ctx context.Context, id uuid.UUID) (*models.User, error) {
+	return s[id], nil
+}
+
+func TestEngine_Conditions(t *testing.T) {
+	target := &models.Target{ID: uuid.New(), Enabled: true, Labels: models.Labels{"owner_team": "payments"}}
+	root := &models.Credential{ID: uuid.New(), TargetID: target.ID, Username: "root"}
+	app := &models.Credential{ID: uuid.New(), TargetID: target.ID, Username: "app"}
+	creds := []*models.Credential{root, app}
+
+	alice := &models.User{ID: uuid.New(), Email: "alice@example.com", Role: models.RoleUser, Attributes: models.Labels{"department": "payments"}}
+	bob := &models.User{ID: uuid.New(), Email: "bob@example.com", Role: models.RoleUser, Attributes: models.Labels{}}
+
+	ownTeam := `user.department == target.labels.owner_team`
+	contractors := `user.employment == "contractor"`
+	rules := RuleSet{
+		{ID: uuid.New(), Name: "owning team", Effect: models.RuleEffectAllow, CredentialID: &root.ID, Condition: &ownTeam, Enabled: true},
+		{ID: uuid.New(), Name: "no contractors", Effect: models.RuleEffectDeny, CredentialID: &app.ID, Condition: &contractors, Enabled: true},
+	}
+	engine := NewEngine(rules, logger.New(logger.LevelError, io.Discard))
+	engine.ResolveUsers(staticUsers{alice.ID: alice, bob.ID: bob})
+	ctx := context.Background()
+
+	// Alice's department owns the target. Neither has an employment
+	// attribute, so the deny rule fails closed for both.
+	got, err := engine.AllowedCredentials(ctx, Subject{UserID: alice.ID, Role: alice.Role}, target, creds)
+	if err != nil || len(got) != 1 || got[0] != root {
+		t.Errorf("alice: AllowedCredentials() = %v, %v; want root", got, err)
+	}
+	if got, _ := engine.AllowedCredentials(ctx, Subject{UserID: bob.ID, Role: bob.Role}, target, creds); len(got) != 0 {
+		t.Errorf("bob: AllowedCredentials() = %v, want none", got)
+	}
+
+	trace, err := engine.Explain(ctx, Subject{UserID: bob.ID, Role: bob.Role}, target, creds, time.Now())
+	if err != nil {
+		t.Fatalf("Explain() error = %v", err)
+	}
+	owning := trace.Credentials[0].Rules[0]
+	if owning.Applies || !strings.HasPrefix(owning.Reason, "condition failed:") || owning.Condition == nil || *owning.Condition != ownTeam {
+		t.Errorf("owning team rule trace = %+v", owning)
+	}
+	if deny := trace.Credentials[1].Rules[0]; !deny.Applies {
+		t.Errorf("no contractors rule trace = %+v, want it to apply", deny)
+	}
+
+	bob.Attributes["department"] = "sales"
+	trace, _ = engine.Explain(ctx, Subject{UserID: bob.ID, Role: bob.Role}, target, creds, time.Now())
+	if reason := trace.Credentials[0].Rules[0].Reason; reason != "condition is false" {
+		t.Errorf("reason = %q, want the condition to be false", reason)
+	}
+}
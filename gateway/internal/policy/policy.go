@@ -0,0 +1,322 @@
+package policy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/VanCannon/openpam/gateway/internal/models"
+	"github.com/VanCannon/openpam/pkg/logger"
+	"github.com/google/uuid"
+)
+
+var (
+	// ErrNoCredentials is returned when the subject may not use any credential on the target
+	ErrNoCredentials = errors.New("no credentials available for this target")
+
+	// ErrCredentialNotAllowed is returned when a requested credential is unknown or not permitted
+	ErrCredentialNotAllowed = errors.New("credential not allowed for this target")
+
+	// ErrAmbiguousCredential is returned when several credentials are available, none is
+	// the default and the client didn't choose one
+	ErrAmbiguousCredential = errors.New("multiple credentials available and none is default; specify credential_id")
+)
+
+// Subject identifies who is requesting access. Groups are the groups the user
+// is a member of; when nil, the engine looks them up if a rule needs them.
+// Email and Attributes are what rule conditions know of the user; when
+// Attributes is nil, the engine looks the user up if a rule has a condition.
+type Subject struct {
+	UserID     uuid.UUID
+	Role       string
+	Groups     []uuid.UUID
+	Email      string
+	Attributes map[string]string
+}
+
+// RuleStore provides the credential rules that apply to a target
+type RuleStore interface {
+	ListEnabledForTarget(ctx context.Context, targetID uuid.UUID) ([]*models.CredentialRule, error)
+}
+
+// GroupStore lists the groups a user is a member of
+type GroupStore interface {
+	ListGroupIDsByUser(ctx context.Context, userID uuid.UUID) ([]uuid.UUID, error)
+}
+
+// UserStore looks up users, for the attributes rule conditions test
+type UserStore interface {
+	GetByID(ctx context.Context, id uuid.UUID) (*models.User, error)
+}
+
+// Engine decides which targets and credentials a subject may use
+type Engine struct {
+	rules  RuleStore
+	groups GroupStore
+	users  UserStore
+	now    func() time.Time
+	logger *logger.Logger
+}
+
+// NewEngine creates a new policy engine
+func NewEngine(rules RuleStore, log *logger.Logger) *Engine {
+	return &Engine{
+		rules:  rules,
+		now:    time.Now,
+		logger: log,
+	}
+}
+
+// ResolveGroups makes the engine look up the group memberships of subjects
+// that don't carry them. Without it, rules naming a group only apply to
+// subjects whose Groups are set.
+func (e *Engine) ResolveGroups(groups GroupStore) {
+	e.groups = groups
+}
+
+// ResolveUsers makes the engine look up the email and attributes of subjects
+// that don't carry them. Without it, conditions only see the attributes of
+// subjects whose Attributes are set.
+func (e *Engine) ResolveUsers(users UserStore) {
+	e.users = users
+}
+
+// withGroups fills in the subject's groups when one of the rules names a
+// group, or has a condition that may test them
+func (e *Engine) withGroups(ctx context.Context, subject Subject, rules []*models.CredentialRule) (Subject, error) {
+	if subject.Groups != nil || e.groups == nil {
+		return subject, nil
+	}
+	if !slices.ContainsFunc(rules, func(rule *models.CredentialRule) bool { return rule.GroupID != nil || rule.Condition != nil }) {
+		return subject, nil
+	}
+
+	groups, err := e.groups.ListGroupIDsByUser(ctx, subject.UserID)
+	if err != nil {
+		return subject, fmt.Errorf("failed to load group memberships: %w", err)
+	}
+	subject.Groups = groups
+	return subject, nil
+}
+
+// withAttributes fills in the subject's email and attributes when one of the
+// rules has a condition
+func (e *Engine) withAttributes(ctx context.Context, subject Subject, rules []*models.CredentialRule) (Subject, error) {
+	if subject.Attributes != nil || e.users == nil {
+		return subject, nil
+	}
+	if !slices.ContainsFunc(rules, func(rule *models.CredentialRule) bool { return rule.Condition != nil }) {
+		return subject, nil
+	}
+
+	user, err := e.users.GetByID(ctx, subject.UserID)
+	if err != nil {
+		return subject, fmt.Errorf("failed to load user attributes: %w", err)
+	}
+	if subject.Email == "" {
+		subject.Email = user.Email
+	}
+	subject.Attributes = map[string]string(user.Attributes)
+	if subject.Attributes == nil {
+		subject.Attributes = map[string]string{}
+	}
+	return subject, nil
+}
+
+// resolve fills in what the rules need to know of the subject
+func (e *Engine) resolve(ctx context.Context, subject Subject, rules []*models.CredentialRule) (Subject, error) {
+	subject, err := e.withGroups(ctx, subject, rules)
+	if err != nil {
+		return subject, err
+	}
+	return e.withAttributes(ctx, subject, rules)
+}
+
+// AllowedCredentials filters the target's credentials down to those the subject may use.
+// The input order is preserved, so callers get the repository's selection order back.
+func (e *Engine) AllowedCredentials(ctx context.Context, subject Subject, target *models.Target, creds []*models.Credential) ([]*models.Credential, error) {
+	// Disabled targets can't be connected to, and auditors have read-only access
+	if !target.Enabled || subject.Role == models.RoleAuditor {
+		return []*models.Credential{}, nil
+	}
+
+	rules, err := e.rules.ListEnabledForTarget(ctx, target.ID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load credential rules: %w", err)
+	}
+	subject, err = e.resolve(ctx, subject, rules)
+	if err != nil {
+		return nil, err
+	}
+
+	now := e.now()
+	allowed := make([]*models.Credential, 0, len(creds))
+	for _, cred := range creds {
+		if cred.TargetID != target.ID {
+			continue
+		}
+		if rule, ok := credentialAllowed(rules, subject, target, cred, now); !ok {
+			fields := map[string]interface{}{
+				"user_id":       subject.UserID.String(),
+				"target_id":     target.ID.String(),
+				"credential_id": cred.ID.String(),
+			}
+			if rule != nil {
+				fields["rule"] = rule.Name
+			}
+			e.logger.Debug("Credential excluded by policy", fields)
+			continue
+		}
+		allowed = append(allowed, cred)
+	}
+
+	return allowed, nil
+}
+
+// GrantingRules returns the enabled allow rules that give the subject the
+// credential on the target. Their session settings apply to the session.
+func (e *Engine) GrantingRules(ctx context.Context, subject Subject, target *models.Target, cred *models.Credential) ([]*models.CredentialRule, error) {
+	rules, err := e.rules.ListEnabledForTarget(ctx, target.ID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load credential rules: %w", err)
+	}
+	subject, err = e.resolve(ctx, subject, rules)
+	if err != nil {
+		return nil, err
+	}
+
+	now := e.now()
+	granting := []*models.CredentialRule{}
+	for _, rule := range rules {
+		if rule.Effect == models.RuleEffectAllow && ruleMatchesCredential(rule, target, cred) && ruleAppliesTo(rule, subject, target, cred, now) {
+			granting = append(granting, rule)
+		}
+	}
+	return granting, nil
+}
+
+// credentialAllowed evaluates the rules for one credential.
+//
+// A matching deny rule always wins. If any allow rule matches the credential, the
+// credential is restricted to the subjects of those rules. A credential no rule
+// refers to is usable by everyone, except certificate credentials, which need an
+// allow rule to be used at all. On denial the deciding deny rule is returned,
+// or nil when the subject simply isn't covered by a restricting allow rule.
+func credentialAllowed(rules []*models.CredentialRule, subject Subject, target *models.Target, cred *models.Credential, at time.Time) (*models.CredentialRule, bool) {
+	restricted := false
+	granted := false
+
+	for _, rule := range rules {
+		if !ruleMatchesCredential(rule, target, cred) {
+			continue
+		}
+
+		applies := ruleAppliesTo(rule, subject, target, cred, at)
+		switch rule.Effect {
+		case models.RuleEffectDeny:
+			if applies {
+				return rule, false
+			}
+		case models.RuleEffectAllow:
+			restricted = true
+			if applies {
+				granted = true
+			}
+		}
+	}
+
+	return nil, granted || !restricted && !cred.HasCertificate()
+}
+
+// ruleMatchesCredential reports whether the rule's object covers the credential
+func ruleMatchesCredential(rule *models.CredentialRule, target *models.Target, cred *models.Credential) bool {
+	if !rule.Enabled {
+		return false
+	}
+	if rule.TargetID != nil && *rule.TargetID != target.ID {
+		return false
+	}
+	if rule.CredentialID != nil && *rule.CredentialID == cred.ID {
+		return true
+	}
+	if rule.CredentialTag != nil && cred.HasTag(*rule.CredentialTag) {
+		return true
+	}
+	return false
+}
+
+// ruleAppliesTo reports whether the subject using the credential on the
+// target at a time is covered by the rule
+func ruleAppliesTo(rule *models.CredentialRule, subject Subject, target *models.Target, cred *models.Credential, at time.Time) bool {
+	return ruleMismatch(rule, subject, target, cred, at) == ""
+}
+
+// ruleMismatch says why the rule doesn't apply to the subject, or "" if it
+// does. A condition that fails to evaluate fails closed: an allow rule doesn't
+// apply, and a deny rule does.
+func ruleMismatch(rule *models.CredentialRule, subject Subject, target *models.Target, cred *models.Credential, at time.Time) string {
+	switch {
+	case rule.UserID != nil && *rule.UserID != subject.UserID:
+		return "rule is for another user"
+	case rule.Role != nil && *rule.Role != subject.Role:
+		return "rule is for the " + *rule.Role + " role"
+	case rule.GroupID != nil && !slices.Contains(subject.Groups, *rule.GroupID):
+		return "subject is not in the rule's group"
+	case rule.Condition == nil:
+		return ""
+	}
+
+	holds, err := evalCondition(*rule.Condition, subject, target, cred, at)
+	switch {
+	case err != nil && rule.Effect == models.RuleEffectDeny:
+		return ""
+	case err != nil:
+		return "condition failed: " + err.Error()
+	case !holds:
+		return "condition is false"
+	}
+	return ""
+}
+
+// evalCondition compiles and evaluates a rule's condition
+func evalCondition(expr string, subject Subject, target *models.Target, cred *models.Credential, at time.Time) (bool, error) {
+	condition, err := CompileCondition(expr)
+	if err != nil {
+		return false, err
+	}
+	return condition.Eval(subject, target, cred, at)
+}
+
+// SelectCredential picks the credential to use for a session from the allowed set.
+//
+// An explicitly requested credential must be in the allowed set. Otherwise the
+// target's default is used, or the only credential if there is exactly one. Any
+// other case is ambiguous and the client has to choose.
+func SelectCredential(allowed []*models.Credential, requested *uuid.UUID) (*models.Credential, error) {
+	if len(allowed) == 0 {
+		return nil, ErrNoCredentials
+	}
+
+	if requested != nil {
+		for _, cred := range allowed {
+			if cred.ID == *requested {
+				return cred, nil
+			}
+		}
+		return nil, ErrCredentialNotAllowed
+	}
+
+	for _, cred := range allowed {
+		if cred.IsDefault {
+			return cred, nil
+		}
+	}
+
+	if len(allowed) == 1 {
+		return allowed[0], nil
+	}
+
+	return nil, ErrAmbiguousCredential
+}
@@ -0,0 +1,228 @@
+package policy
+
+import (
+	"context"
+	"errors"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/VanCannon/openpam/gateway/internal/models"
+	"github.com/VanCannon/openpam/pkg/logger"
+	"github.com/google/uuid"
+)
+
+func TestSelectCredential(t *testing.T) {
+	first := &models.Credential{ID: uuid.New(), Username: "alice"}
+	second := &models.Credential{ID: uuid.New(), Username: "bob"}
+	defaultCred := &models.Credential{ID: uuid.New(), Username: "root", IsDefault: true}
+	unknown := uuid.New()
+
+	tests := []struct {
+		name      string
+		allowed   []*models.Credential
+		requested *uuid.UUID
+		want      *models.Credential
+		wantErr   error
+	}{
+		{name: "No credentials", allowed: nil, wantErr: ErrNoCredentials},
+		{name: "Single credential", allowed: []*models.Credential{first}, want: first},
+		{name: "Default wins", allowed: []*models.Credential{first, defaultCred, second}, want: defaultCred},
+		{name: "Requested wins over default", allowed: []*models.Credential{defaultCred, second}, requested: &second.ID, want: second},
+		{name: "Requested not allowed", allowed: []*models.Credential{first}, requested: &unknown, wantErr: ErrCredentialNotAllowed},
+		{name: "Ambiguous", allowed: []*models.Credential{first, second}, wantErr: ErrAmbiguousCredential},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := SelectCredential(tt.allowed, tt.requested)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("SelectCredential() error = %v, want %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("SelectCredential() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// staticRules is a RuleStore backed by a fixed slice
+type staticRules []*models.CredentialRule
+
+func (s staticRules) ListEnabledForTarget(ctx context.Context, targetID uuid.UUID) ([]*models.CredentialRule, error) {
+	return s, nil
+}
+
+func TestEngine_AllowedCredentials(t *testing.T) {
+	engine := NewEngine(staticRules(nil), logger.New(logger.LevelError, io.Discard))
+	ctx := context.Background()
+
+	target := &models.Target{ID: uuid.New(), Enabled: true}
+	own := &models.Credential{ID: uuid.New(), TargetID: target.ID}
+	other := &models.Credential{ID: uuid.New(), TargetID: uuid.New()}
+	creds := []*models.Credential{own, other}
+
+	if got, _ := engine.AllowedCredentials(ctx, Subject{Role: models.RoleUser}, target, creds); len(got) != 1 || got[0] != own {
+		t.Errorf("user: got %v, want only the target's credential", got)
+	}
+
+	if got, _ := engine.AllowedCredentials(ctx, Subject{Role: models.RoleAuditor}, target, creds); len(got) != 0 {
+		t.Errorf("auditor: got %d credentials, want none", len(got))
+	}
+
+	disabled := &models.Target{ID: target.ID, Enabled: false}
+	if got, _ := engine.AllowedCredentials(ctx, Subject{Role: models.RoleAdmin}, disabled, creds); len(got) != 0 {
+		t.Errorf("disabled target: got %d credentials, want none", len(got))
+	}
+}
+
+func TestEngine_CredentialRules(t *testing.T) {
+	target := &models.Target{ID: uuid.New(), Enabled: true}
+	root := &models.Credential{ID: uuid.New(), TargetID: target.ID, Username: "root", Tags: []string{models.CredentialTagPrivileged}}
+	app := &models.Credential{ID: uuid.New(), TargetID: target.ID, Username: "app"}
+	creds := []*models.Credential{root, app}
+
+	alice := uuid.New()
+	bob := uuid.New()
+	privileged := models.CredentialTagPrivileged
+	adminRole := models.RoleAdmin
+	otherTarget := uuid.New()
+	ops := uuid.New()
+
+	tests := []struct {
+		name    string
+		rules   []*models.CredentialRule
+		subject Subject
+		want    []*models.Credential
+	}{
+		{
+			name:    "No rules allows everything",
+			subject: Subject{UserID: alice, Role: models.RoleUser},
+			want:    []*models.Credential{root, app},
+		},
+		{
+			name: "Allow rule on tag restricts to its subjects",
+			rules: []*models.CredentialRule{
+				{Name: "admins use privileged", Effect: models.RuleEffectAllow, Role: &adminRole, CredentialTag: &privileged, Enabled: true},
+			},
+			subject: Subject{UserID: alice, Role: models.RoleUser},
+			want:    []*models.Credential{app},
+		},
+		{
+			name: "Allow rule grants matching user",
+			rules: []*models.CredentialRule{
+				{Name: "alice uses root", Effect: models.RuleEffectAllow, UserID: &alice, CredentialID: &root.ID, Enabled: true},
+			},
+			subject: Subject{UserID: alice, Role: models.RoleUser},
+			want:    []*models.Credential{root, app},
+		},
+		{
+			name: "Deny wins over allow",
+			rules: []*models.CredentialRule{
+				{Name: "users use root", Effect: models.RuleEffectAllow, CredentialID: &root.ID, Enabled: true},
+				{Name: "not bob", Effect: models.RuleEffectDeny, UserID: &bob, CredentialID: &root.ID, Enabled: true},
+			},
+			subject: Subject{UserID: bob, Role: models.RoleUser},
+			want:    []*models.Credential{app},
+		},
+		{
+			name: "Rule scoped to another target is ignored",
+			rules: []*models.CredentialRule{
+				{Name: "elsewhere", Effect: models.RuleEffectDeny, TargetID: &otherTarget, CredentialTag: &privileged, Enabled: true},
+			},
+			subject: Subject{UserID: bob, Role: models.RoleUser},
+			want:    []*models.Credential{root, app},
+		},
+		{
+			name: "Allow rule grants group members",
+			rules: []*models.CredentialRule{
+				{Name: "ops use root", Effect: models.RuleEffectAllow, GroupID: &ops, CredentialID: &root.ID, Enabled: true},
+			},
+			subject: Subject{UserID: bob, Role: models.RoleUser, Groups: []uuid.UUID{ops}},
+			want:    []*models.Credential{root, app},
+		},
+		{
+			name: "Allow rule for a group excludes non-members",
+			rules: []*models.CredentialRule{
+				{Name: "ops use root", Effect: models.RuleEffectAllow, GroupID: &ops, CredentialID: &root.ID, Enabled: true},
+			},
+			subject: Subject{UserID: alice, Role: models.RoleUser, Groups: []uuid.UUID{}},
+			want:    []*models.Credential{app},
+		},
+		{
+			name: "Disabled rule is ignored",
+			rules: []*models.CredentialRule{
+				{Name: "off", Effect: models.RuleEffectDeny, CredentialTag: &privileged, Enabled: false},
+			},
+			subject: Subject{UserID: bob, Role: models.RoleUser},
+			want:    []*models.Credential{root, app},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			engine := NewEngine(staticRules(tt.rules), logger.New(logger.LevelError, io.Discard))
+			got, err := engine.AllowedCredentials(context.Background(), tt.subject, target, creds)
+			if err != nil {
+				t.Fatalf("AllowedCredentials() error = %v", err)
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("got %d credentials, want %d", len(got), len(tt.want))
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Errorf("credential %d = %s, want %s", i, got[i].Username, tt.want[i].Username)
+				}
+			}
+		})
+	}
+}
+
+// staticGroups is a GroupStore backed by a fixed map of user to groups
+type staticGroups map[uuid.UUID][]uuid.UUID
+
+func (s staticGroups) ListGroupIDsByUser(ctx context.Context, userID uuid.UUID) ([]uuid.UUID, error) {
+	return s[userID], nil
+}
+
+func TestEngine_ResolveGroups(t *testing.T) {
+	target := &models.Target{ID: uuid.New(), Enabled: true}
+	root := &models.Credential{ID: uuid.New(), TargetID: target.ID, Username: "root"}
+	alice := uuid.New()
+	ops := uuid.New()
+
+	engine := NewEngine(staticRules{
+		{Name: "not ops", Effect: models.RuleEffectDeny, GroupID: &ops, CredentialID: &root.ID, Enabled: true},
+	}, logger.New(logger.LevelError, io.Discard))
+	engine.ResolveGroups(staticGroups{alice: {ops}})
+
+	got, err := engine.AllowedCredentials(context.Background(), Subject{UserID: alice, Role: models.RoleUser}, target, []*models.Credential{root})
+	if err != nil {
+		t.Fatalf("AllowedCredentials() error = %v", err)
+	}
+	if len(got) != 0 {
+		t.Errorf("got %d credentials, want the group's deny rule to exclude root", len(got))
+	}
+}
+
+func TestEngine_CertificateCredentials(t *testing.T) {
+	target := &models.Target{ID: uuid.New(), Enabled: true}
+	expires := time.Now().Add(90 * 24 * time.Hour)
+	card := &models.Credential{ID: uuid.New(), TargetID: target.ID, Username: "alice", CertificateExpiresAt: &expires}
+	alice := uuid.New()
+
+	engine := NewEngine(staticRules(nil), logger.New(logger.LevelError, io.Discard))
+	if got, _ := engine.AllowedCredentials(context.Background(), Subject{UserID: alice, Role: models.RoleAdmin}, target, []*models.Credential{card}); len(got) != 0 {
+		t.Errorf("no rules: got %d credentials, want none", len(got))
+	}
+
+	engine = NewEngine(staticRules{
+		{Name: "alice-card", Effect: models.RuleEffectAllow, UserID: &alice, CredentialID: &card.ID, Enabled: true},
+	}, logger.New(logger.LevelError, io.Discard))
+	if got, _ := engine.AllowedCredentials(context.Background(), Subject{UserID: alice, Role: models.RoleUser}, target, []*models.Credential{card}); len(got) != 1 {
+		t.Errorf("granted: got %d credentials, want the certificate credential", len(got))
+	}
+	if got, _ := engine.AllowedCredentials(context.Background(), Subject{UserID: uuid.New(), Role: models.RoleAdmin}, target, []*models.Credential{card}); len(got) != 0 {
+		t.Errorf("other user: got %d credentials, want none", len(got))
+	}
+}
@@ -0,0 +1,156 @@
+package policy
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/VanCannon/openpam/gateway/internal/models"
+	"github.com/google/uuid"
+)
+
+// RuleSet is a RuleStore over a fixed set of rules, such as a draft policy
+// being tried out before it is published
+type RuleSet []*models.CredentialRule
+
+// ListEnabledForTarget returns the enabled rules of the set that apply to the
+// target, the way the credential rule repository does
+func (s RuleSet) ListEnabledForTarget(ctx context.Context, targetID uuid.UUID) ([]*models.CredentialRule, error) {
+	rules := []*models.CredentialRule{}
+	for _, rule := range s {
+		if rule.Enabled && (rule.TargetID == nil || *rule.TargetID == targetID) {
+			rules = append(rules, rule)
+		}
+	}
+	return rules, nil
+}
+
+// Credential decisions of a trace
+const (
+	DecisionDenied       = "denied"       // A deny rule applies to the subject
+	DecisionGranted      = "granted"      // An allow rule applies to the subject
+	DecisionNotGranted   = "not_granted"  // Allow rules restrict the credential to other subjects
+	DecisionUnrestricted = "unrestricted" // No rule refers to the credential
+	DecisionNeedsGrant   = "needs_grant"  // Certificate credentials need an allow rule
+)
+
+// Trace explains whether a subject can reach a target at a given time, and
+// which rules decided each of the target's credentials
+type Trace struct {
+	At          time.Time         `json:"at"`
+	Allowed     bool              `json:"allowed"`
+	Reason      string            `json:"reason"`
+	Credentials []CredentialTrace `json:"credentials"`
+}
+
+// CredentialTrace is the decision on one credential and the rules behind it
+type CredentialTrace struct {
+	CredentialID uuid.UUID   `json:"credential_id"`
+	Username     string      `json:"username"`
+	Allowed      bool        `json:"allowed"`
+	Decision     string      `json:"decision"`
+	Rules        []RuleTrace `json:"rules"`
+}
+
+// RuleTrace is one rule that refers to a credential, and whether it applies
+// to the subject. Reason says why it doesn't, such as its condition being
+// false at the time.
+type RuleTrace struct {
+	RuleID    *uuid.UUID `json:"rule_id,omitempty"`
+	Name      string     `json:"name"`
+	Effect    string     `json:"effect"`
+	Condition *string    `json:"condition,omitempty"`
+	Applies   bool       `json:"applies"`
+	Reason    string     `json:"reason,omitempty"`
+}
+
+// Explain evaluates the subject's access to the target at a time, like
+// AllowedCredentials does for connections, and traces the decision. Targets
+// under maintenance at that time refuse access, though admins may override it
+// when connecting.
+func (e *Engine) Explain(ctx context.Context, subject Subject, target *models.Target, creds []*models.Credential, at time.Time) (*Trace, error) {
+	trace := &Trace{At: at, Credentials: []CredentialTrace{}}
+
+	switch {
+	case !target.Enabled:
+		trace.Reason = "target is disabled"
+		return trace, nil
+	case target.Expired(at):
+		trace.Reason = "target has expired"
+		return trace, nil
+	case subject.Role == models.RoleAuditor:
+		trace.Reason = "auditors have read-only access"
+		return trace, nil
+	}
+
+	rules, err := e.rules.ListEnabledForTarget(ctx, target.ID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load credential rules: %w", err)
+	}
+	subject, err = e.resolve(ctx, subject, rules)
+	if err != nil {
+		return nil, err
+	}
+
+	allowed := 0
+	for _, cred := range creds {
+		if cred.TargetID != target.ID {
+			continue
+		}
+		ct := explainCredential(rules, subject, target, cred, at)
+		if ct.Allowed {
+			allowed++
+		}
+		trace.Credentials = append(trace.Credentials, ct)
+	}
+
+	switch {
+	case allowed == 0:
+		trace.Reason = "no credential of the target is allowed"
+	case target.InMaintenance(at):
+		trace.Reason = "target is under maintenance"
+	default:
+		trace.Allowed = true
+		trace.Reason = fmt.Sprintf("%d of %d credentials allowed", allowed, len(trace.Credentials))
+	}
+	return trace, nil
+}
+
+// explainCredential traces credentialAllowed's decision on one credential
+func explainCredential(rules []*models.CredentialRule, subject Subject, target *models.Target, cred *models.Credential, at time.Time) CredentialTrace {
+	ct := CredentialTrace{CredentialID: cred.ID, Username: cred.Username, Rules: []RuleTrace{}}
+	denied, restricted, granted := false, false, false
+
+	for _, rule := range rules {
+		if !ruleMatchesCredential(rule, target, cred) {
+			continue
+		}
+
+		rt := RuleTrace{RuleID: &rule.ID, Name: rule.Name, Effect: rule.Effect, Condition: rule.Condition}
+		rt.Reason = ruleMismatch(rule, subject, target, cred, at)
+		rt.Applies = rt.Reason == ""
+		ct.Rules = append(ct.Rules, rt)
+
+		switch rule.Effect {
+		case models.RuleEffectDeny:
+			denied = denied || rt.Applies
+		case models.RuleEffectAllow:
+			restricted = true
+			granted = granted || rt.Applies
+		}
+	}
+
+	switch {
+	case denied:
+		ct.Decision = DecisionDenied
+	case granted:
+		ct.Decision, ct.Allowed = DecisionGranted, true
+	case restricted:
+		ct.Decision = DecisionNotGranted
+	case cred.HasCertificate():
+		ct.Decision = DecisionNeedsGrant
+	default:
+		ct.Decision, ct.Allowed = DecisionUnrestricted, true
+	}
+	return ct
+}
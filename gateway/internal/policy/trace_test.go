@@ -0,0 +1,117 @@
+package policy
+
+import (
+	"context"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/VanCannon/openpam/gateway/internal/models"
+	"github.com/VanCannon/openpam/pkg/logger"
+	"github.com/google/uuid"
+)
+
+func TestRuleSet_ListEnabledForTarget(t *testing.T) {
+	target := uuid.New()
+	other := uuid.New()
+	global := &models.CredentialRule{Name: "global", Enabled: true}
+	scoped := &models.CredentialRule{Name: "scoped", TargetID: &target, Enabled: true}
+	elsewhere := &models.CredentialRule{Name: "elsewhere", TargetID: &other, Enabled: true}
+	disabled := &models.CredentialRule{Name: "disabled"}
+
+	got, _ := RuleSet{global, scoped, elsewhere, disabled}.ListEnabledForTarget(context.Background(), target)
+	if len(got) != 2 || got[0] != global || got[1] != scoped {
+		t.Errorf("got %v, want the global and the target's rule", got)
+	}
+}
+
+func TestEngine_Explain(t *testing.T) {
+	target := &models.Target{ID: uuid.New(), Enabled: true}
+	root := &models.Credential{ID: uuid.New(), TargetID: target.ID, Username: "root"}
+	app := &models.Credential{ID: uuid.New(), TargetID: target.ID, Username: "app"}
+	creds := []*models.Credential{root, app}
+
+	alice := uuid.New()
+	bob := uuid.New()
+	allow := &models.CredentialRule{ID: uuid.New(), Name: "alice uses root", Effect: models.RuleEffectAllow, UserID: &alice, CredentialID: &root.ID, Enabled: true}
+	deny := &models.CredentialRule{ID: uuid.New(), Name: "not bob", Effect: models.RuleEffectDeny, UserID: &bob, CredentialID: &app.ID, Enabled: true}
+	engine := NewEngine(RuleSet{allow, deny}, logger.New(logger.LevelError, io.Discard))
+	now := time.Now()
+
+	trace, err := engine.Explain(context.Background(), Subject{UserID: bob, Role: models.RoleUser}, target, creds, now)
+	if err != nil {
+		t.Fatalf("Explain() error = %v", err)
+	}
+	if trace.Allowed || len(trace.Credentials) != 2 {
+		t.Fatalf("bob: got %+v, want access refused with both credentials traced", trace)
+	}
+
+	rootTrace, appTrace := trace.Credentials[0], trace.Credentials[1]
+	if rootTrace.Decision != DecisionNotGranted || len(rootTrace.Rules) != 1 || rootTrace.Rules[0].Applies || rootTrace.Rules[0].Reason != "rule is for another user" {
+		t.Errorf("root: got %+v, want not granted by alice's rule", rootTrace)
+	}
+	if appTrace.Decision != DecisionDenied || len(appTrace.Rules) != 1 || *appTrace.Rules[0].RuleID != deny.ID || !appTrace.Rules[0].Applies {
+		t.Errorf("app: got %+v, want denied by the deny rule", appTrace)
+	}
+
+	trace, _ = engine.Explain(context.Background(), Subject{UserID: alice, Role: models.RoleUser}, target, creds, now)
+	if !trace.Allowed || trace.Credentials[0].Decision != DecisionGranted || trace.Credentials[1].Decision != DecisionUnrestricted {
+		t.Errorf("alice: got %+v, want root granted and app unrestricted", trace)
+	}
+
+	// The time of the evaluation decides maintenance and expiry
+	start, end := now.Add(time.Hour), now.Add(2*time.Hour)
+	maintained := &models.Target{ID: target.ID, Enabled: true, MaintenanceStart: &start, MaintenanceEnd: &end}
+	if trace, _ := engine.Explain(context.Background(), Subject{UserID: alice, Role: models.RoleUser}, maintained, creds, now); !trace.Allowed {
+		t.Errorf("before maintenance: got %q, want access", trace.Reason)
+	}
+	if trace, _ := engine.Explain(context.Background(), Subject{UserID: alice, Role: models.RoleUser}, maintained, creds, start.Add(time.Minute)); trace.Allowed || trace.Reason != "target is under maintenance" {
+		t.Errorf("during maintenance: got %q, want access refused", trace.Reason)
+	}
+	expiring := &models.Target{ID: target.ID, Enabled: true, ExpiresAt: &end}
+	if trace, _ := engine.Explain(context.Background(), Subject{UserID: alice, Role: models.RoleUser}, expiring, creds, end); trace.Allowed || trace.Reason != "target has expired" {
+		t.Errorf("after expiry: got %q, want access refused", trace.Reason)
+	}
+}
+
+// TestEngine_ExplainAgrees checks that traces reach the decisions connections get
+func TestEngine_ExplainAgrees(t *testing.T) {
+	target := &models.Target{ID: uuid.New(), Enabled: true}
+	expires := time.Now().Add(90 * 24 * time.Hour)
+	root := &models.Credential{ID: uuid.New(), TargetID: target.ID, Username: "root", Tags: []string{models.CredentialTagPrivileged}}
+	app := &models.Credential{ID: uuid.New(), TargetID: target.ID, Username: "app"}
+	card := &models.Credential{ID: uuid.New(), TargetID: target.ID, Username: "card", CertificateExpiresAt: &expires}
+	creds := []*models.Credential{root, app, card}
+
+	alice := uuid.New()
+	ops := uuid.New()
+	privileged := models.CredentialTagPrivileged
+	adminRole := models.RoleAdmin
+	rules := RuleSet{
+		{Name: "admins use privileged", Effect: models.RuleEffectAllow, Role: &adminRole, CredentialTag: &privileged, Enabled: true},
+		{Name: "ops use the card", Effect: models.RuleEffectAllow, GroupID: &ops, CredentialID: &card.ID, Enabled: true},
+		{Name: "not alice", Effect: models.RuleEffectDeny, UserID: &alice, CredentialID: &app.ID, Enabled: true},
+	}
+	engine := NewEngine(rules, logger.New(logger.LevelError, io.Discard))
+
+	subjects := []Subject{
+		{UserID: alice, Role: models.RoleUser, Groups: []uuid.UUID{}},
+		{UserID: alice, Role: models.RoleAdmin, Groups: []uuid.UUID{ops}},
+		{UserID: uuid.New(), Role: models.RoleUser, Groups: []uuid.UUID{ops}},
+		{UserID: uuid.New(), Role: models.RoleAuditor},
+	}
+	for _, subject := range subjects {
+		allowed, _ := engine.AllowedCredentials(context.Background(), subject, target, creds)
+		trace, _ := engine.Explain(context.Background(), subject, target, creds, time.Now())
+
+		traced := 0
+		for _, ct := range trace.Credentials {
+			if ct.Allowed {
+				traced++
+			}
+		}
+		if traced != len(allowed) || trace.Allowed != (len(allowed) > 0) {
+			t.Errorf("%s %s: trace allows %d, connections %d", subject.Role, subject.UserID, traced, len(allowed))
+		}
+	}
+}
@@ -0,0 +1,148 @@
+// Package protocol holds the session protocols the connection handler serves.
+// Each protocol parses its own connect parameters and runs the session; the
+// handler only authorizes, audits and looks the protocol up by name. New
+// protocols plug in by registering a Handler, and recording or policy hooks by
+// registering Middleware around the sessions of one protocol or of all of them.
+package protocol
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"sort"
+
+	"github.com/VanCannon/openpam/gateway/internal/models"
+	"github.com/VanCannon/openpam/gateway/internal/settings"
+	"github.com/VanCannon/openpam/gateway/internal/vault"
+	"github.com/VanCannon/openpam/gateway/internal/wsconn"
+	"github.com/google/uuid"
+	"github.com/gorilla/websocket"
+)
+
+// Session is an authorized session whose WebSocket is open
+type Session struct {
+	Conn       *websocket.Conn
+	UserID     uuid.UUID
+	UserEmail  string
+	Target     *models.Target
+	Credential *models.Credential
+	Secret     *vault.Credentials  // The credential's secret, injected into the logon
+	AuditLog   *models.AuditLog    // Already created; the handler records the outcome
+	Settings   *settings.Effective // Resolved zone, target and credential rule settings
+	Params     any                 // What the protocol's ValidateParams returned
+}
+
+// Handler serves the sessions of one protocol
+type Handler interface {
+	// Name is the protocol in the connect path, such as "ssh"
+	Name() string
+
+	// ValidateParams parses the connect query string before the WebSocket
+	// is upgraded. An error is answered with 400.
+	ValidateParams(query url.Values) (any, error)
+
+	// Handle proxies the session until it ends. A failure that stops the
+	// session before its pump starts must be sent to the client as a close
+	// frame here; the connection handler only closes the socket.
+	Handle(ctx context.Context, s *Session) error
+}
+
+// HandleFunc runs a session
+type HandleFunc func(ctx context.Context, s *Session) error
+
+// Middleware wraps the sessions of a protocol, to act before they start or on
+// how they ended. Returning an error without calling next refuses the session.
+type Middleware func(next HandleFunc) HandleFunc
+
+// ErrUnknownProtocol is returned for a protocol nothing is registered for
+var ErrUnknownProtocol = errors.New("unknown protocol")
+
+// AuthenticationError marks the target rejecting the injected credential, so
+// the failure counts against it
+type AuthenticationError struct {
+	Err error
+}
+
+func (e *AuthenticationError) Error() string { return e.Err.Error() }
+func (e *AuthenticationError) Unwrap() error { return e.Err }
+
+// AuthenticationFailed reports whether a session ended because the target
+// rejected its credential
+func AuthenticationFailed(err error) bool {
+	var authErr *AuthenticationError
+	return errors.As(err, &authErr)
+}
+
+// recordingRefused closes sessions that must be recorded when their recording
+// couldn't start
+var recordingRefused = wsconn.CloseReason{
+	Reason:  wsconn.ReasonRecordingFailed,
+	Message: "The session must be recorded and its recording could not start",
+}
+
+// Registry maps protocol names to their handlers and middleware. Everything
+// is registered at startup, before sessions are served.
+type Registry struct {
+	handlers   map[string]Handler
+	middleware map[string][]Middleware
+	global     []Middleware
+}
+
+// NewRegistry creates an empty registry
+func NewRegistry() *Registry {
+	return &Registry{
+		handlers:   make(map[string]Handler),
+		middleware: make(map[string][]Middleware),
+	}
+}
+
+// Register adds a protocol. It panics if the name is already taken.
+func (r *Registry) Register(h Handler) {
+	if _, ok := r.handlers[h.Name()]; ok {
+		panic(fmt.Sprintf("protocol: %s registered twice", h.Name()))
+	}
+	r.handlers[h.Name()] = h
+}
+
+// Use wraps every session of the named protocol in mw. Middleware runs in
+// the order it was added, inside any added with UseAll.
+func (r *Registry) Use(name string, mw ...Middleware) {
+	r.middleware[name] = append(r.middleware[name], mw...)
+}
+
+// UseAll wraps the sessions of every protocol in mw
+func (r *Registry) UseAll(mw ...Middleware) {
+	r.global = append(r.global, mw...)
+}
+
+// Lookup returns the handler of a protocol
+func (r *Registry) Lookup(name string) (Handler, bool) {
+	h, ok := r.handlers[name]
+	return h, ok
+}
+
+// Names returns the registered protocols, sorted
+func (r *Registry) Names() []string {
+	names := make([]string, 0, len(r.handlers))
+	for name := range r.handlers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Serve runs a session of the named protocol through its middleware
+func (r *Registry) Serve(ctx context.Context, name string, s *Session) error {
+	h, ok := r.handlers[name]
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrUnknownProtocol, name)
+	}
+
+	next := HandleFunc(h.Handle)
+	chain := append(append([]Middleware(nil), r.global...), r.middleware[name]...)
+	for i := len(chain) - 1; i >= 0; i-- {
+		next = chain[i](next)
+	}
+	return next(ctx, s)
+}
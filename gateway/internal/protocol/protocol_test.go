@@ -0,0 +1,140 @@
+package protocol
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"reflect"
+	"testing"
+)
+
+type fakeHandler struct {
+	name  string
+	calls *[]string
+}
+
+func (f fakeHandler) Name() string { return f.name }
+
+func (f fakeHandler) ValidateParams(query url.Values) (any, error) {
+	if query.Get("bad") != "" {
+		return nil, errors.New("bad parameter")
+	}
+	return query.Get("opt"), nil
+}
+
+func (f fakeHandler) Handle(ctx context.Context, s *Session) error {
+	*f.calls = append(*f.calls, f.name)
+	return nil
+}
+
+func recordMiddleware(name string, calls *[]string) Middleware {
+	return func(next HandleFunc) HandleFunc {
+		return func(ctx context.Context, s *Session) error {
+			*calls = append(*calls, name+" before")
+			err := next(ctx, s)
+			*calls = append(*calls, name+" after")
+			return err
+		}
+	}
+}
+
+func TestRegistry_MiddlewareOrder(t *testing.T) {
+	var calls []string
+	r := NewRegistry()
+	r.Register(fakeHandler{name: "ssh", calls: &calls})
+	r.Register(fakeHandler{name: "vnc", calls: &calls})
+	r.Use("ssh", recordMiddleware("recording", &calls), recordMiddleware("policy", &calls))
+	r.UseAll(recordMiddleware("all", &calls))
+
+	if err := r.Serve(context.Background(), "ssh", &Session{}); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"all before", "recording before", "policy before", "ssh", "policy after", "recording after", "all after"}
+	if !reflect.DeepEqual(calls, want) {
+		t.Errorf("ssh calls = %v, want %v", calls, want)
+	}
+
+	// Middleware of other protocols doesn't apply
+	calls = nil
+	if err := r.Serve(context.Background(), "vnc", &Session{}); err != nil {
+		t.Fatal(err)
+	}
+	want = []string{"all before", "vnc", "all after"}
+	if !reflect.DeepEqual(calls, want) {
+		t.Errorf("vnc calls = %v, want %v", calls, want)
+	}
+}
+
+func TestRegistry_MiddlewareRefuses(t *testing.T) {
+	var calls []string
+	r := NewRegistry()
+	r.Register(fakeHandler{name: "ssh", calls: &calls})
+
+	denied := errors.New("denied by policy")
+	r.Use("ssh", func(next HandleFunc) HandleFunc {
+		return func(ctx context.Context, s *Session) error {
+			return denied
+		}
+	})
+
+	if err := r.Serve(context.Background(), "ssh", &Session{}); !errors.Is(err, denied) {
+		t.Errorf("err = %v, want %v", err, denied)
+	}
+	if len(calls) != 0 {
+		t.Errorf("handler ran after middleware refused: %v", calls)
+	}
+}
+
+func TestRegistry_Lookup(t *testing.T) {
+	var calls []string
+	r := NewRegistry()
+	r.Register(fakeHandler{name: "telnet", calls: &calls})
+	r.Register(fakeHandler{name: "ssh", calls: &calls})
+
+	if got := r.Names(); !reflect.DeepEqual(got, []string{"ssh", "telnet"}) {
+		t.Errorf("Names() = %v", got)
+	}
+
+	h, ok := r.Lookup("ssh")
+	if !ok {
+		t.Fatal("ssh not found")
+	}
+	if _, err := h.ValidateParams(url.Values{"bad": {"1"}}); err == nil {
+		t.Error("invalid params accepted")
+	}
+
+	if _, ok := r.Lookup("k8s"); ok {
+		t.Error("unregistered protocol found")
+	}
+	if err := r.Serve(context.Background(), "k8s", &Session{}); !errors.Is(err, ErrUnknownProtocol) {
+		t.Errorf("err = %v, want ErrUnknownProtocol", err)
+	}
+}
+
+func TestRegistry_RegisterTwicePanics(t *testing.T) {
+	var calls []string
+	r := NewRegistry()
+	r.Register(fakeHandler{name: "ssh", calls: &calls})
+
+	defer func() {
+		if recover() == nil {
+			t.Error("registering ssh twice did not panic")
+		}
+	}()
+	r.Register(fakeHandler{name: "ssh", calls: &calls})
+}
+
+func TestAuthenticationFailed(t *testing.T) {
+	inner := errors.New("unable to authenticate")
+	err := &AuthenticationError{Err: inner}
+
+	if !AuthenticationFailed(err) {
+		t.Error("AuthenticationError not recognized")
+	}
+	if !errors.Is(err, inner) || err.Error() != inner.Error() {
+		t.Error("AuthenticationError doesn't wrap its cause")
+	}
+	if AuthenticationFailed(inner) {
+		t.Error("plain error recognized as authentication failure")
+	}
+}
@@ -0,0 +1,68 @@
+package protocol
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+
+	"github.com/VanCannon/openpam/gateway/internal/models"
+	"github.com/VanCannon/openpam/gateway/internal/rdp"
+	"github.com/VanCannon/openpam/gateway/internal/recordings"
+	"github.com/VanCannon/openpam/gateway/internal/wsconn"
+	"github.com/VanCannon/openpam/pkg/logger"
+)
+
+// RDP serves desktop sessions through guacd
+type RDP struct {
+	proxy  *rdp.Proxy
+	logger *logger.Logger
+}
+
+// NewRDP creates the RDP protocol handler
+func NewRDP(proxy *rdp.Proxy, log *logger.Logger) *RDP {
+	return &RDP{proxy: proxy, logger: log}
+}
+
+// Name returns "rdp"
+func (p *RDP) Name() string {
+	return models.ProtocolRDP
+}
+
+// ValidateParams reads the resolution and monitor layout
+func (p *RDP) ValidateParams(query url.Values) (any, error) {
+	return rdp.DisplayFromQuery(query), nil
+}
+
+// Handle proxies the session to the target through guacd
+func (p *RDP) Handle(ctx context.Context, s *Session) error {
+	display, _ := s.Params.(rdp.Display)
+
+	p.logger.Info("Starting RDP proxy", map[string]interface{}{
+		"target":   s.Target.Hostname,
+		"port":     s.Target.Port,
+		"username": s.Secret.Username,
+		"width":    display.Width,
+		"height":   display.Height,
+	})
+
+	err := p.proxy.Handle(ctx, s.Conn, s.Target, s.Secret, s.AuditLog, display)
+	if err == nil {
+		return nil
+	}
+
+	err = fmt.Errorf("RDP proxy error: %w", err)
+
+	// The pump never started, so tell the client why here
+	var hsErr *rdp.HandshakeError
+	if errors.As(err, &hsErr) {
+		wsconn.WriteClose(s.Conn, wsconn.CloseHandshakeFailed, hsErr.CloseReason())
+		if hsErr.Reason == wsconn.ReasonAuthenticationFailed {
+			return &AuthenticationError{Err: err}
+		}
+	}
+	if errors.Is(err, recordings.ErrNotRecorded) {
+		wsconn.WriteClose(s.Conn, wsconn.CloseRecordingFailed, recordingRefused)
+	}
+	return err
+}
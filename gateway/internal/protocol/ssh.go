@@ -0,0 +1,62 @@
+package protocol
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+
+	"github.com/VanCannon/openpam/gateway/internal/models"
+	"github.com/VanCannon/openpam/gateway/internal/recordings"
+	"github.com/VanCannon/openpam/gateway/internal/ssh"
+	"github.com/VanCannon/openpam/gateway/internal/wsconn"
+	"github.com/VanCannon/openpam/pkg/logger"
+)
+
+// SSH serves terminal sessions through the SSH proxy
+type SSH struct {
+	proxy  *ssh.Proxy
+	logger *logger.Logger
+}
+
+// NewSSH creates the SSH protocol handler
+func NewSSH(proxy *ssh.Proxy, log *logger.Logger) *SSH {
+	return &SSH{proxy: proxy, logger: log}
+}
+
+// Name returns "ssh"
+func (p *SSH) Name() string {
+	return models.ProtocolSSH
+}
+
+// ValidateParams reads the initial terminal settings. Anything missing can
+// come from the client's init message.
+func (p *SSH) ValidateParams(query url.Values) (any, error) {
+	return ssh.PtyOptionsFromQuery(query), nil
+}
+
+// Handle proxies the session to the target's SSH server
+func (p *SSH) Handle(ctx context.Context, s *Session) error {
+	pty, _ := s.Params.(ssh.PtyOptions)
+
+	p.logger.Info("Starting SSH proxy", map[string]interface{}{
+		"target":   s.Target.Hostname,
+		"port":     s.Target.Port,
+		"username": s.Secret.Username,
+	})
+
+	err := p.proxy.Handle(ctx, s.Conn, s.Target, s.Secret, s.AuditLog, s.UserEmail, pty)
+	if err == nil {
+		return nil
+	}
+
+	err = fmt.Errorf("SSH proxy error: %w", err)
+	if errors.Is(err, ssh.ErrAuthenticationFailed) {
+		wsconn.WriteClose(s.Conn, wsconn.CloseHandshakeFailed, wsconn.CloseReason{Reason: wsconn.ReasonAuthenticationFailed, Message: "The target rejected the credentials"})
+		return &AuthenticationError{Err: err}
+	}
+	if errors.Is(err, recordings.ErrNotRecorded) {
+		wsconn.WriteClose(s.Conn, wsconn.CloseRecordingFailed, recordingRefused)
+	}
+	return err
+}
@@ -0,0 +1,231 @@
+// Package queue counts the sessions running on each target and, when a target
+// has reached its session limit, holds the users waiting for a slot in line.
+// Slots are counted per gateway.
+package queue
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+var (
+	// ErrBusy is returned when the target has no free slot and the session
+	// may not wait for one
+	ErrBusy = errors.New("target has reached its session limit")
+	// ErrWaitExceeded is returned when no slot freed up within the wait
+	ErrWaitExceeded = errors.New("no session slot freed up in time")
+)
+
+// Request asks for a session slot on a target
+type Request struct {
+	TargetID  uuid.UUID
+	UserID    uuid.UUID
+	UserEmail string
+	Limit     int           // Sessions the target may have at once (0 = unlimited)
+	MaxWait   time.Duration // How long to wait for a slot (0 = don't wait)
+	Jump      bool          // Wait ahead of everyone who didn't jump the queue
+}
+
+// Ticket is a place in a target's queue
+type Ticket struct {
+	ID        uuid.UUID `json:"id"`
+	UserID    uuid.UUID `json:"user_id"`
+	UserEmail string    `json:"user_email"`
+	Position  int       `json:"position"` // 1 is next in line
+	Jumped    bool      `json:"jumped"`
+	QueuedAt  time.Time `json:"queued_at"`
+	Deadline  time.Time `json:"deadline"` // When the user stops waiting
+}
+
+// Status is a target's slots and queue
+type Status struct {
+	TargetID uuid.UUID `json:"target_id"`
+	Running  int       `json:"running"`
+	Waiting  []*Ticket `json:"waiting"`
+}
+
+type waiter struct {
+	ticket  Ticket
+	limit   int
+	granted chan struct{}
+}
+
+type target struct {
+	running int
+	waiting []*waiter
+	changed chan struct{} // Closed and replaced whenever the target changes
+}
+
+// Queue holds the session slots of every target
+type Queue struct {
+	mu      sync.Mutex
+	targets map[uuid.UUID]*target
+}
+
+// New creates an empty queue
+func New() *Queue {
+	return &Queue{targets: make(map[uuid.UUID]*target)}
+}
+
+// Acquire takes a slot on the target, waiting in line for one to free up if
+// the request allows. It returns the function releasing the slot, which must
+// be called when the session ends. Every session takes a slot, limited or
+// not, so that the running count is right for requests that are.
+func (q *Queue) Acquire(ctx context.Context, req Request) (func(), error) {
+	q.mu.Lock()
+	t := q.target(req.TargetID)
+	if fits(t.running, req.Limit) && (len(t.waiting) == 0 || req.Jump && !t.waiting[0].ticket.Jumped) {
+		t.running++
+		t.notify()
+		q.mu.Unlock()
+		return q.releaser(req.TargetID), nil
+	}
+	if req.MaxWait <= 0 {
+		q.mu.Unlock()
+		return nil, ErrBusy
+	}
+
+	now := time.Now()
+	w := &waiter{
+		ticket: Ticket{
+			ID:        uuid.New(),
+			UserID:    req.UserID,
+			UserEmail: req.UserEmail,
+			Jumped:    req.Jump,
+			QueuedAt:  now,
+			Deadline:  now.Add(req.MaxWait),
+		},
+		limit:   req.Limit,
+		granted: make(chan struct{}),
+	}
+	// Jumpers wait behind earlier jumpers only
+	at := len(t.waiting)
+	if req.Jump {
+		at = 0
+		for at < len(t.waiting) && t.waiting[at].ticket.Jumped {
+			at++
+		}
+	}
+	t.waiting = append(t.waiting, nil)
+	copy(t.waiting[at+1:], t.waiting[at:])
+	t.waiting[at] = w
+	// Limits may differ between requests, so this one may fit where those ahead don't
+	t.dispatch()
+	q.mu.Unlock()
+
+	timer := time.NewTimer(req.MaxWait)
+	defer timer.Stop()
+
+	var err error
+	select {
+	case <-w.granted:
+		return q.releaser(req.TargetID), nil
+	case <-timer.C:
+		err = ErrWaitExceeded
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	select {
+	case <-w.granted:
+		// Granted as we gave up; hand the slot on
+		t.running--
+		t.dispatch()
+	default:
+		for i, other := range t.waiting {
+			if other == w {
+				t.waiting = append(t.waiting[:i], t.waiting[i+1:]...)
+				break
+			}
+		}
+		// Those behind may fit where this one didn't
+		t.dispatch()
+	}
+	return nil, err
+}
+
+// Status returns the target's slots and queue
+func (q *Queue) Status(targetID uuid.UUID) *Status {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	status := &Status{TargetID: targetID, Waiting: []*Ticket{}}
+	if t, ok := q.targets[targetID]; ok {
+		status.Running = t.running
+		for i, w := range t.waiting {
+			ticket := w.ticket
+			ticket.Position = i + 1
+			status.Waiting = append(status.Waiting, &ticket)
+		}
+	}
+	return status
+}
+
+// Changed returns a channel that is closed the next time the target's slots
+// or queue change
+func (q *Queue) Changed(targetID uuid.UUID) <-chan struct{} {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.target(targetID).changed
+}
+
+func (q *Queue) releaser(targetID uuid.UUID) func() {
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			q.mu.Lock()
+			defer q.mu.Unlock()
+			t := q.targets[targetID]
+			t.running--
+			t.dispatch()
+		})
+	}
+}
+
+// dispatch grants free slots to waiters in line order. A waiter whose limit
+// doesn't fit yet doesn't hold up those behind it with a higher one. Callers
+// hold the lock.
+func (t *target) dispatch() {
+	waiting := t.waiting[:0]
+	for _, w := range t.waiting {
+		if fits(t.running, w.limit) {
+			t.running++
+			close(w.granted)
+			continue
+		}
+		waiting = append(waiting, w)
+	}
+	// Clear the tail so granted waiters can be collected
+	for i := len(waiting); i < len(t.waiting); i++ {
+		t.waiting[i] = nil
+	}
+	t.waiting = waiting
+	t.notify()
+}
+
+// target returns the target's entry, creating it. Entries are kept, since
+// watchers may hold their channel. Callers hold the lock.
+func (q *Queue) target(targetID uuid.UUID) *target {
+	t, ok := q.targets[targetID]
+	if !ok {
+		t = &target{changed: make(chan struct{})}
+		q.targets[targetID] = t
+	}
+	return t
+}
+
+// notify wakes the target's watchers. Callers hold the lock.
+func (t *target) notify() {
+	close(t.changed)
+	t.changed = make(chan struct{})
+}
+
+func fits(running, limit int) bool {
+	return limit <= 0 || running < limit
+}
@@ -0,0 +1,135 @@
+package queue
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// acquireAsync waits for a slot in the background
+func acquireAsync(q *Queue, req Request) <-chan error {
+	done := make(chan error, 1)
+	go func() {
+		_, err := q.Acquire(context.Background(), req)
+		done <- err
+	}()
+	return done
+}
+
+// waitQueued waits until n requests are waiting on the target
+func waitQueued(t *testing.T, q *Queue, targetID uuid.UUID, n int) *Status {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for {
+		status := q.Status(targetID)
+		if len(status.Waiting) == n {
+			return status
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("%d waiting, want %d", len(status.Waiting), n)
+		}
+		select {
+		case <-q.Changed(targetID):
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+}
+
+func TestAcquire_Limit(t *testing.T) {
+	q := New()
+	targetID := uuid.New()
+	req := Request{TargetID: targetID, Limit: 1}
+
+	release, err := q.Acquire(context.Background(), req)
+	if err != nil {
+		t.Fatalf("Acquire: %v", err)
+	}
+	if _, err := q.Acquire(context.Background(), req); !errors.Is(err, ErrBusy) {
+		t.Errorf("err = %v, want ErrBusy", err)
+	}
+
+	// Unlimited sessions still count
+	unlimited, err := q.Acquire(context.Background(), Request{TargetID: targetID})
+	if err != nil {
+		t.Fatalf("Acquire unlimited: %v", err)
+	}
+	if running := q.Status(targetID).Running; running != 2 {
+		t.Errorf("Running = %d, want 2", running)
+	}
+
+	release()
+	release() // Releasing twice frees one slot
+	unlimited()
+	if _, err := q.Acquire(context.Background(), req); err != nil {
+		t.Errorf("Acquire after release: %v", err)
+	}
+}
+
+func TestAcquire_Queue(t *testing.T) {
+	q := New()
+	targetID := uuid.New()
+	req := Request{TargetID: targetID, Limit: 1, MaxWait: time.Second}
+
+	release, _ := q.Acquire(context.Background(), req)
+
+	first, second := req, req
+	first.UserEmail, second.UserEmail = "first@example.com", "second@example.com"
+	firstDone := acquireAsync(q, first)
+	waitQueued(t, q, targetID, 1)
+	acquireAsync(q, second)
+
+	jump := req
+	jump.UserEmail, jump.Jump = "admin@example.com", true
+	jumpDone := acquireAsync(q, jump)
+
+	status := waitQueued(t, q, targetID, 3)
+	var order []string
+	for _, ticket := range status.Waiting {
+		order = append(order, ticket.UserEmail)
+	}
+	if order[0] != "admin@example.com" || order[1] != "first@example.com" || order[2] != "second@example.com" {
+		t.Fatalf("queue = %v, want admin, first, second", order)
+	}
+
+	release()
+	if err := <-jumpDone; err != nil {
+		t.Fatalf("jumped Acquire: %v", err)
+	}
+	select {
+	case err := <-firstDone:
+		t.Fatalf("first granted while the slot is taken: %v", err)
+	case <-time.After(20 * time.Millisecond):
+	}
+	if status := q.Status(targetID); status.Running != 1 || status.Waiting[0].Position != 1 || status.Waiting[0].UserEmail != "first@example.com" {
+		t.Errorf("status = %+v, want first next in line", status)
+	}
+}
+
+func TestAcquire_WaitExceeded(t *testing.T) {
+	q := New()
+	targetID := uuid.New()
+
+	release, _ := q.Acquire(context.Background(), Request{TargetID: targetID, Limit: 1})
+	defer release()
+
+	start := time.Now()
+	_, err := q.Acquire(context.Background(), Request{TargetID: targetID, Limit: 1, MaxWait: 50 * time.Millisecond})
+	if !errors.Is(err, ErrWaitExceeded) {
+		t.Errorf("err = %v, want ErrWaitExceeded", err)
+	}
+	if time.Since(start) < 50*time.Millisecond {
+		t.Error("gave up before the wait was over")
+	}
+	if waiting := len(q.Status(targetID).Waiting); waiting != 0 {
+		t.Errorf("%d still waiting, want 0", waiting)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := q.Acquire(ctx, Request{TargetID: targetID, Limit: 1, MaxWait: time.Second}); !errors.Is(err, context.Canceled) {
+		t.Errorf("err = %v, want context.Canceled", err)
+	}
+}
@@ -0,0 +1,56 @@
+package rdp
+
+import (
+	"strconv"
+)
+
+// micStreamOffset moves recorded microphone streams clear of the stream
+// indexes guacd allocates, so playback doesn't mix them up with target sound
+const micStreamOffset = 1000
+
+// audioPolicy is the audio redirection allowed in a session
+type audioPolicy struct {
+	output bool // The target's sound is played to the client
+	input  bool // The client's microphone is passed to the target
+	record bool // Audio is kept in the recording
+}
+
+// audioStream reports whether instr opens, carries or ends an audio stream,
+// tracking the streams opened in streams
+func audioStream(instr *Instruction, streams map[string]bool) bool {
+	if instr.Len() < 2 {
+		return false
+	}
+	stream := string(instr.Element(1))
+
+	switch instr.Opcode() {
+	case "audio":
+		streams[stream] = true
+		return true
+	case "blob":
+		return streams[stream]
+	case "end":
+		if streams[stream] {
+			delete(streams, stream)
+			return true
+		}
+	}
+	return false
+}
+
+// recordMicrophone writes an instruction of a client microphone stream to
+// the recording, under an offset stream index
+func (p *Proxy) recordMicrophone(recorder *Recorder, sessionID string, instr *Instruction) {
+	args := instr.Args()
+	index, err := strconv.Atoi(args[0])
+	if err != nil {
+		return
+	}
+	args[0] = strconv.Itoa(index + micStreamOffset)
+
+	if err := recorder.WriteInstruction(sessionID, instr.Opcode(), args...); err != nil {
+		p.logger.Error("Failed to record instruction", map[string]interface{}{
+			"error": err.Error(),
+		})
+	}
+}
@@ -0,0 +1,141 @@
+package rdp
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Display size limits. RDP desktops can't exceed 8192 pixels either way.
+const (
+	minDisplaySize = 200
+	maxDisplaySize = 8192
+	maxMonitors    = 16
+
+	defaultWidth  = 1024
+	defaultHeight = 768
+	defaultDPI    = 96
+)
+
+// Monitor is one display of a client's monitor layout, in desktop pixels
+// relative to the top left of the primary monitor
+type Monitor struct {
+	Left   int
+	Top    int
+	Width  int
+	Height int
+}
+
+// Layout is a client's monitor layout; the first monitor is the primary
+type Layout []Monitor
+
+var monitorPattern = regexp.MustCompile(`^(\d+)x(\d+)([+-]\d+)([+-]\d+)$`)
+
+// ParseLayout parses a layout descriptor of comma-separated monitors given as
+// WIDTHxHEIGHT+LEFT+TOP, e.g. "1920x1080+0+0,1280x1024+1920+0"
+func ParseLayout(s string) (Layout, error) {
+	parts := strings.Split(s, ",")
+	if len(parts) > maxMonitors {
+		return nil, fmt.Errorf("at most %d monitors are supported", maxMonitors)
+	}
+
+	layout := make(Layout, 0, len(parts))
+	for _, part := range parts {
+		m := monitorPattern.FindStringSubmatch(strings.TrimSpace(part))
+		if m == nil {
+			return nil, fmt.Errorf("invalid monitor %q, want WIDTHxHEIGHT+LEFT+TOP", part)
+		}
+		var mon Monitor
+		mon.Width, _ = strconv.Atoi(m[1])
+		mon.Height, _ = strconv.Atoi(m[2])
+		mon.Left, _ = strconv.Atoi(m[3])
+		mon.Top, _ = strconv.Atoi(m[4])
+		if !validDisplaySize(mon.Width) || !validDisplaySize(mon.Height) {
+			return nil, fmt.Errorf("invalid monitor size %dx%d", mon.Width, mon.Height)
+		}
+		layout = append(layout, mon)
+	}
+
+	if w, h := layout.Size(); w > maxDisplaySize || h > maxDisplaySize {
+		return nil, fmt.Errorf("monitor layout spans %dx%d, more than %d pixels either way", w, h, maxDisplaySize)
+	}
+	return layout, nil
+}
+
+// Size returns the size of the desktop spanning all monitors
+func (l Layout) Size() (width, height int) {
+	if len(l) == 0 {
+		return 0, 0
+	}
+	left, top := l[0].Left, l[0].Top
+	right, bottom := left+l[0].Width, top+l[0].Height
+	for _, m := range l[1:] {
+		left = min(left, m.Left)
+		top = min(top, m.Top)
+		right = max(right, m.Left+m.Width)
+		bottom = max(bottom, m.Top+m.Height)
+	}
+	return right - left, bottom - top
+}
+
+// Display is the client's initial display
+type Display struct {
+	Width  int
+	Height int
+	DPI    int
+	Layout Layout // nil for a single monitor
+
+	// Quality the session connects at; unset uses the quality of the user's
+	// last session from the same address
+	Quality Quality
+}
+
+// DisplayFromQuery reads width, height, dpi and monitors from the connection
+// query string. A monitor layout sets the size to the desktop spanning it.
+// Missing or invalid values fall back to the defaults.
+func DisplayFromQuery(query url.Values) Display {
+	d := Display{Width: defaultWidth, Height: defaultHeight, DPI: defaultDPI}
+
+	if w, err := strconv.Atoi(query.Get("width")); err == nil && validDisplaySize(w) {
+		d.Width = w
+	}
+	if h, err := strconv.Atoi(query.Get("height")); err == nil && validDisplaySize(h) {
+		d.Height = h
+	}
+	if dpi, err := strconv.Atoi(query.Get("dpi")); err == nil && dpi >= 48 && dpi <= 480 {
+		d.DPI = dpi
+	}
+	if s := query.Get("monitors"); s != "" {
+		if layout, err := ParseLayout(s); err == nil {
+			d.Layout = layout
+			d.Width, d.Height = layout.Size()
+		}
+	}
+
+	return d
+}
+
+func validDisplaySize(n int) bool {
+	return n >= minDisplaySize && n <= maxDisplaySize
+}
+
+// clientResize returns the arguments of a size instruction from the client,
+// clamped to the display limits, or false when they aren't a size
+func clientResize(args []string) ([]string, bool) {
+	if len(args) < 2 {
+		return nil, false
+	}
+	w, err1 := strconv.Atoi(args[0])
+	h, err2 := strconv.Atoi(args[1])
+	if err1 != nil || err2 != nil || w <= 0 || h <= 0 {
+		return nil, false
+	}
+
+	clamped := []string{
+		strconv.Itoa(min(max(w, minDisplaySize), maxDisplaySize)),
+		strconv.Itoa(min(max(h, minDisplaySize), maxDisplaySize)),
+	}
+	return append(clamped, args[2:]...), true
+}
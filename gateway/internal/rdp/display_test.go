@@ -0,0 +1,75 @@
+package rdp
+
+import (
+	"net/url"
+	"reflect"
+	"testing"
+)
+
+func TestParseLayout(t *testing.T) {
+	layout, err := ParseLayout("1920x1080+0+0, 1280x1024+1920+0,1920x1080-1920+200")
+	if err != nil {
+		t.Fatalf("ParseLayout() error = %v", err)
+	}
+	want := Layout{
+		{Left: 0, Top: 0, Width: 1920, Height: 1080},
+		{Left: 1920, Top: 0, Width: 1280, Height: 1024},
+		{Left: -1920, Top: 200, Width: 1920, Height: 1080},
+	}
+	if !reflect.DeepEqual(layout, want) {
+		t.Errorf("layout = %+v, want %+v", layout, want)
+	}
+	if w, h := layout.Size(); w != 5120 || h != 1280 {
+		t.Errorf("Size() = %dx%d, want 5120x1280", w, h)
+	}
+
+	for _, s := range []string{"", "1920x1080", "1920x1080+0+0,100x100+1920+0", "8000x1000+0+0,1000x1000+8000+0"} {
+		if _, err := ParseLayout(s); err == nil {
+			t.Errorf("ParseLayout(%q) succeeded", s)
+		}
+	}
+}
+
+func TestDisplayFromQuery(t *testing.T) {
+	tests := []struct {
+		query string
+		want  Display
+	}{
+		{"", Display{Width: 1024, Height: 768, DPI: 96}},
+		{"width=1600&height=900&dpi=120", Display{Width: 1600, Height: 900, DPI: 120}},
+		{"width=-1&height=100000&dpi=5", Display{Width: 1024, Height: 768, DPI: 96}},
+		{"width=1600&height=900&monitors=1920x1080%2B0%2B0,1920x1080%2B1920%2B0", Display{
+			Width: 3840, Height: 1080, DPI: 96,
+			Layout: Layout{{Width: 1920, Height: 1080}, {Left: 1920, Width: 1920, Height: 1080}},
+		}},
+		{"width=1600&height=900&monitors=bogus", Display{Width: 1600, Height: 900, DPI: 96}},
+	}
+
+	for _, tt := range tests {
+		query, _ := url.ParseQuery(tt.query)
+		if got := DisplayFromQuery(query); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("DisplayFromQuery(%q) = %+v, want %+v", tt.query, got, tt.want)
+		}
+	}
+}
+
+func TestClientResize(t *testing.T) {
+	tests := []struct {
+		args []string
+		want []string
+		ok   bool
+	}{
+		{[]string{"1280", "720", "96"}, []string{"1280", "720", "96"}, true},
+		{[]string{"20000", "50"}, []string{"8192", "200"}, true},
+		{[]string{"0", "720"}, nil, false},
+		{[]string{"wide", "720"}, nil, false},
+		{[]string{"1280"}, nil, false},
+	}
+
+	for _, tt := range tests {
+		got, ok := clientResize(tt.args)
+		if ok != tt.ok || !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("clientResize(%v) = %v, %v, want %v, %v", tt.args, got, ok, tt.want, tt.ok)
+		}
+	}
+}
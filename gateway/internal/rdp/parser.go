@@ -0,0 +1,263 @@
+package rdp
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"unicode/utf8"
+)
+
+const (
+	// maxElementLength bounds the declared length of a single instruction
+	// element so a corrupt stream cannot make the parser allocate without limit.
+	maxElementLength = 4 << 20
+
+	// initialInstructionBuffer is the starting capacity of the parser's
+	// reusable instruction buffer. Most guacd instructions fit in this.
+	initialInstructionBuffer = 4096
+)
+
+var (
+	// ErrInvalidLength is returned when an element length prefix is malformed
+	ErrInvalidLength = errors.New("invalid element length")
+
+	// ErrElementTooLarge is returned when an element exceeds maxElementLength
+	ErrElementTooLarge = errors.New("element length exceeds limit")
+)
+
+// Instruction is a single decoded Guacamole instruction.
+//
+// Instructions returned by Parser.Next reference the parser's internal buffer
+// and are only valid until the next call to Next. Use Clone to obtain a copy
+// that may be retained or handed to another goroutine.
+type Instruction struct {
+	// raw holds the instruction exactly as received, including the trailing ';'
+	raw []byte
+	// bounds holds start/end offsets into raw for each element
+	bounds []int
+}
+
+var instructionPool = sync.Pool{
+	New: func() interface{} {
+		return &Instruction{
+			raw:    make([]byte, 0, initialInstructionBuffer),
+			bounds: make([]int, 0, 32),
+		}
+	},
+}
+
+// Raw returns the wire encoding of the instruction
+func (i *Instruction) Raw() []byte {
+	return i.raw
+}
+
+// Len returns the number of elements, including the opcode
+func (i *Instruction) Len() int {
+	return len(i.bounds) / 2
+}
+
+// Element returns the i-th element without copying
+func (i *Instruction) Element(n int) []byte {
+	return i.raw[i.bounds[2*n]:i.bounds[2*n+1]]
+}
+
+// Opcode returns the instruction opcode
+func (i *Instruction) Opcode() string {
+	if i.Len() == 0 {
+		return ""
+	}
+	return string(i.Element(0))
+}
+
+// Args returns the instruction arguments as strings
+func (i *Instruction) Args() []string {
+	n := i.Len()
+	if n <= 1 {
+		return []string{}
+	}
+	args := make([]string, n-1)
+	for j := 1; j < n; j++ {
+		args[j-1] = string(i.Element(j))
+	}
+	return args
+}
+
+// Clone returns a pooled copy of the instruction that does not alias the
+// parser buffer. Call Release once the copy is no longer needed.
+func (i *Instruction) Clone() *Instruction {
+	c := instructionPool.Get().(*Instruction)
+	c.raw = append(c.raw[:0], i.raw...)
+	c.bounds = append(c.bounds[:0], i.bounds...)
+	return c
+}
+
+// Release returns a cloned instruction to the pool
+func (i *Instruction) Release() {
+	// Don't let one oversized instruction pin a large buffer in the pool
+	if cap(i.raw) > 64*1024 {
+		return
+	}
+	i.raw = i.raw[:0]
+	i.bounds = i.bounds[:0]
+	instructionPool.Put(i)
+}
+
+// Parser is a streaming Guacamole protocol decoder.
+//
+// It parses length prefixes byte by byte and reuses a single buffer for
+// every instruction, so steady-state parsing does not allocate.
+type Parser struct {
+	reader *bufio.Reader
+	instr  Instruction
+}
+
+// NewParser creates a parser reading from the given buffered reader
+func NewParser(reader *bufio.Reader) *Parser {
+	return &Parser{
+		reader: reader,
+		instr: Instruction{
+			raw:    make([]byte, 0, initialInstructionBuffer),
+			bounds: make([]int, 0, 32),
+		},
+	}
+}
+
+// Reset discards any state and switches the parser to a new reader
+func (p *Parser) Reset(reader *bufio.Reader) {
+	p.reader = reader
+	p.instr.raw = p.instr.raw[:0]
+	p.instr.bounds = p.instr.bounds[:0]
+}
+
+// Next reads the next complete instruction from the stream.
+// The returned instruction is only valid until the next call to Next.
+func (p *Parser) Next() (*Instruction, error) {
+	p.instr.raw = p.instr.raw[:0]
+	p.instr.bounds = p.instr.bounds[:0]
+
+	for {
+		length, err := p.readLength()
+		if err != nil {
+			return nil, err
+		}
+
+		start := len(p.instr.raw)
+		if err := p.readElement(length); err != nil {
+			return nil, err
+		}
+		p.instr.bounds = append(p.instr.bounds, start, len(p.instr.raw))
+
+		delim, err := p.reader.ReadByte()
+		if err != nil {
+			return nil, unexpectedEOF(err)
+		}
+		p.instr.raw = append(p.instr.raw, delim)
+
+		switch delim {
+		case ';':
+			return &p.instr, nil
+		case ',':
+			continue
+		default:
+			return nil, fmt.Errorf("unexpected delimiter: %c", delim)
+		}
+	}
+}
+
+// readLength parses a decimal length prefix up to and including the '.'
+func (p *Parser) readLength() (int, error) {
+	length := 0
+	digits := 0
+
+	for {
+		c, err := p.reader.ReadByte()
+		if err != nil {
+			// A clean EOF between instructions is reported as io.EOF
+			if digits == 0 && len(p.instr.raw) == 0 {
+				return 0, err
+			}
+			return 0, unexpectedEOF(err)
+		}
+		p.instr.raw = append(p.instr.raw, c)
+
+		if c == '.' {
+			if digits == 0 {
+				return 0, ErrInvalidLength
+			}
+			return length, nil
+		}
+		if c < '0' || c > '9' {
+			return 0, fmt.Errorf("%w: unexpected byte %q", ErrInvalidLength, c)
+		}
+
+		length = length*10 + int(c-'0')
+		digits++
+		if length > maxElementLength {
+			return 0, ErrElementTooLarge
+		}
+	}
+}
+
+// readElement appends an element of the given length to the buffer.
+// Guacamole lengths count Unicode characters, not bytes, so multi-byte
+// sequences extend the read beyond the declared length.
+func (p *Parser) readElement(chars int) error {
+	pos := len(p.instr.raw)
+
+	for chars > 0 {
+		// Every remaining character occupies at least one byte
+		if have := len(p.instr.raw) - pos; have < chars {
+			if err := p.fill(chars - have); err != nil {
+				return err
+			}
+		}
+
+		for chars > 0 && pos < len(p.instr.raw) {
+			c := p.instr.raw[pos]
+			if c < utf8.RuneSelf {
+				pos++
+				chars--
+				continue
+			}
+			if !utf8.FullRune(p.instr.raw[pos:]) {
+				// Continuation bytes of this character are still in the stream
+				if err := p.fill(1); err != nil {
+					return err
+				}
+				continue
+			}
+			_, size := utf8.DecodeRune(p.instr.raw[pos:])
+			pos += size
+			chars--
+		}
+	}
+
+	return nil
+}
+
+// fill reads exactly n more bytes into the instruction buffer
+func (p *Parser) fill(n int) error {
+	off := len(p.instr.raw)
+	if cap(p.instr.raw)-off < n {
+		grown := make([]byte, off, 2*cap(p.instr.raw)+n)
+		copy(grown, p.instr.raw)
+		p.instr.raw = grown
+	}
+	p.instr.raw = p.instr.raw[:off+n]
+
+	if _, err := io.ReadFull(p.reader, p.instr.raw[off:]); err != nil {
+		p.instr.raw = p.instr.raw[:off]
+		return unexpectedEOF(err)
+	}
+	return nil
+}
+
+// unexpectedEOF converts io.EOF encountered mid-instruction to io.ErrUnexpectedEOF
+func unexpectedEOF(err error) error {
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
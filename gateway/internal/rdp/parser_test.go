@@ -0,0 +1,252 @@
+package rdp
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParser_Next(t *testing.T) {
+	tests := []struct {
+		name           string
+		input          string
+		expectedOpcode string
+		expectedArgs   []string
+	}{
+		{
+			name:           "Sync",
+			input:          "4.sync,8.12345678;",
+			expectedOpcode: "sync",
+			expectedArgs:   []string{"12345678"},
+		},
+		{
+			name:           "No args",
+			input:          "3.nop;",
+			expectedOpcode: "nop",
+			expectedArgs:   []string{},
+		},
+		{
+			name:           "Empty opcode",
+			input:          "0.;",
+			expectedOpcode: "",
+			expectedArgs:   []string{},
+		},
+		{
+			name:           "Multi-byte characters counted as one",
+			input:          "4.name,5.héllo,2.日本;",
+			expectedOpcode: "name",
+			expectedArgs:   []string{"héllo", "日本"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			parser := NewParser(bufio.NewReader(strings.NewReader(tt.input)))
+			instr, err := parser.Next()
+			if err != nil {
+				t.Fatalf("Next() error = %v", err)
+			}
+			if instr.Opcode() != tt.expectedOpcode {
+				t.Errorf("opcode = %v, want %v", instr.Opcode(), tt.expectedOpcode)
+			}
+			if !reflect.DeepEqual(instr.Args(), tt.expectedArgs) {
+				t.Errorf("args = %v, want %v", instr.Args(), tt.expectedArgs)
+			}
+			if string(instr.Raw()) != tt.input {
+				t.Errorf("raw = %q, want %q", instr.Raw(), tt.input)
+			}
+		})
+	}
+}
+
+func TestParser_Stream(t *testing.T) {
+	input := "4.sync,3.100;3.img,1.1;4.sync,3.200;"
+	parser := NewParser(bufio.NewReaderSize(strings.NewReader(input), 16))
+
+	var opcodes []string
+	for {
+		instr, err := parser.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("Next() error = %v", err)
+		}
+		opcodes = append(opcodes, instr.Opcode())
+	}
+
+	expected := []string{"sync", "img", "sync"}
+	if !reflect.DeepEqual(opcodes, expected) {
+		t.Errorf("opcodes = %v, want %v", opcodes, expected)
+	}
+}
+
+func TestParser_Errors(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		wantErr error
+	}{
+		{name: "Truncated element", input: "4.sy", wantErr: io.ErrUnexpectedEOF},
+		{name: "Missing terminator", input: "4.sync", wantErr: io.ErrUnexpectedEOF},
+		{name: "Non-numeric length", input: "x.sync;", wantErr: ErrInvalidLength},
+		{name: "Missing length", input: ".sync;", wantErr: ErrInvalidLength},
+		{name: "Oversized length", input: "99999999.x;", wantErr: ErrElementTooLarge},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			parser := NewParser(bufio.NewReader(strings.NewReader(tt.input)))
+			if _, err := parser.Next(); !errors.Is(err, tt.wantErr) {
+				t.Errorf("Next() error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestInstruction_CloneIsIndependent(t *testing.T) {
+	parser := NewParser(bufio.NewReader(strings.NewReader("4.sync,1.1;4.sync,1.2;")))
+
+	first, err := parser.Next()
+	if err != nil {
+		t.Fatalf("Next() error = %v", err)
+	}
+	clone := first.Clone()
+	defer clone.Release()
+
+	if _, err := parser.Next(); err != nil {
+		t.Fatalf("Next() error = %v", err)
+	}
+
+	if got := clone.Args(); !reflect.DeepEqual(got, []string{"1"}) {
+		t.Errorf("clone args = %v, want [1]", got)
+	}
+}
+
+// simulatedFrameStream builds a guacd-like stream of frames, each made of
+// several image blobs followed by a sync, roughly what a busy 60fps session produces.
+func simulatedFrameStream(frames int) []byte {
+	var buf bytes.Buffer
+	blob := strings.Repeat("QUFBQUFBQUFBQUFB", 64) // 1KB of base64 image data
+
+	for i := 0; i < frames; i++ {
+		for s := 0; s < 4; s++ {
+			stream := fmt.Sprintf("%d", s+1)
+			fmt.Fprintf(&buf, "3.img,%d.%s,2.12,1.0,9.image/png,3.%03d,3.%03d;", len(stream), stream, s*64, s*64)
+			fmt.Fprintf(&buf, "4.blob,%d.%s,%d.%s;", len(stream), stream, len(blob), blob)
+			fmt.Fprintf(&buf, "3.end,%d.%s;", len(stream), stream)
+		}
+		ts := fmt.Sprintf("%d", 1000+i*16)
+		fmt.Fprintf(&buf, "4.sync,%d.%s;", len(ts), ts)
+	}
+
+	return buf.Bytes()
+}
+
+// legacyReadInstruction is the previous ReadString/Sscanf based reader,
+// kept here only as a benchmark baseline.
+func legacyReadInstruction(reader *bufio.Reader) (string, []string, error) {
+	var elements []string
+	var length int
+
+	for {
+		lenStr, err := reader.ReadString('.')
+		if err != nil {
+			return "", nil, err
+		}
+		lenStr = strings.TrimSuffix(lenStr, ".")
+
+		if _, err := fmt.Sscanf(lenStr, "%d", &length); err != nil {
+			return "", nil, fmt.Errorf("invalid length: %w", err)
+		}
+
+		content := make([]byte, length)
+		if _, err := io.ReadFull(reader, content); err != nil {
+			return "", nil, err
+		}
+		elements = append(elements, string(content))
+
+		delim, err := reader.ReadByte()
+		if err != nil {
+			return "", nil, err
+		}
+		if delim == ';' {
+			break
+		} else if delim != ',' {
+			return "", nil, fmt.Errorf("unexpected delimiter: %c", delim)
+		}
+	}
+
+	return elements[0], elements[1:], nil
+}
+
+func BenchmarkLegacyReadInstruction(b *testing.B) {
+	stream := simulatedFrameStream(60)
+	reader := bytes.NewReader(stream)
+	bufReader := bufio.NewReader(reader)
+
+	b.SetBytes(int64(len(stream)))
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		reader.Reset(stream)
+		bufReader.Reset(reader)
+		for {
+			if _, _, err := legacyReadInstruction(bufReader); err != nil {
+				break
+			}
+		}
+	}
+}
+
+func BenchmarkParser(b *testing.B) {
+	stream := simulatedFrameStream(60)
+	reader := bytes.NewReader(stream)
+	bufReader := bufio.NewReader(reader)
+	parser := NewParser(bufReader)
+
+	b.SetBytes(int64(len(stream)))
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		reader.Reset(stream)
+		bufReader.Reset(reader)
+		parser.Reset(bufReader)
+		for {
+			if _, err := parser.Next(); err != nil {
+				break
+			}
+		}
+	}
+}
+
+func BenchmarkParserCloneRelease(b *testing.B) {
+	stream := simulatedFrameStream(60)
+	reader := bytes.NewReader(stream)
+	bufReader := bufio.NewReader(reader)
+	parser := NewParser(bufReader)
+
+	b.SetBytes(int64(len(stream)))
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		reader.Reset(stream)
+		bufReader.Reset(reader)
+		parser.Reset(bufReader)
+		for {
+			instr, err := parser.Next()
+			if err != nil {
+				break
+			}
+			instr.Clone().Release()
+		}
+	}
+}
@@ -4,17 +4,25 @@ import (
 	"bufio"
 	"bytes"
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net"
 	"strings"
 	"sync"
 
-	"github.com/VanCannon/openpam/gateway/internal/logger"
+	"github.com/VanCannon/openpam/gateway/internal/evidence"
 	"github.com/VanCannon/openpam/gateway/internal/models"
+	"github.com/VanCannon/openpam/gateway/internal/notice"
+	"github.com/VanCannon/openpam/gateway/internal/recordings"
+	"github.com/VanCannon/openpam/gateway/internal/settings"
 	"github.com/VanCannon/openpam/gateway/internal/ssh"
 	"github.com/VanCannon/openpam/gateway/internal/vault"
+	"github.com/VanCannon/openpam/gateway/internal/wsconn"
+	"github.com/VanCannon/openpam/pkg/logger"
 
+	"github.com/google/uuid"
 	"github.com/gorilla/websocket"
 )
 
@@ -24,15 +32,50 @@ type Proxy struct {
 	logger       *logger.Logger
 	recorder     *Recorder
 	monitor      *ssh.Monitor
+	wsConfig     wsconn.Config
+
+	blockClipboard bool               // Refuse clipboard transfers in both directions
+	kerberos       KerberosConfig     // How guacd reaches the KDC of Kerberos targets
+	violations     *evidence.Capturer // nil disables violation reporting
+	qualities      *qualityHistory    // Quality each user's link last supported
+}
+
+// ErrSmartcardUnsupported is returned when a session uses a certificate
+// credential but guacd has no smart card logon parameters
+var ErrSmartcardUnsupported = errors.New("guacd does not support smart card logon")
+
+// supportsSmartcard reports whether guacd's args include the smart card parameters
+func supportsSmartcard(args []string) bool {
+	return hasArg(args, "smartcard-certificate")
+}
+
+// hasArg reports whether guacd accepts the named connection parameter
+func hasArg(args []string, name string) bool {
+	for _, arg := range args {
+		if arg == name {
+			return true
+		}
+	}
+	return false
+}
+
+// KerberosConfig holds how guacd reaches the KDCs of targets using Kerberos
+type KerberosConfig struct {
+	KDCURL string // KDC or KDC proxy URL; guacd locates the KDC through DNS when empty
 }
 
 // NewProxy creates a new RDP proxy
-func NewProxy(guacdAddress string, log *logger.Logger, recorder *Recorder, monitor *ssh.Monitor) *Proxy {
+func NewProxy(guacdAddress string, log *logger.Logger, recorder *Recorder, monitor *ssh.Monitor, wsConfig wsconn.Config, blockClipboard bool, kerberos KerberosConfig, violations *evidence.Capturer) *Proxy {
 	return &Proxy{
-		guacdAddress: guacdAddress,
-		logger:       log,
-		recorder:     recorder,
-		monitor:      monitor,
+		guacdAddress:   guacdAddress,
+		logger:         log,
+		recorder:       recorder,
+		monitor:        monitor,
+		wsConfig:       wsConfig,
+		blockClipboard: blockClipboard,
+		kerberos:       kerberos,
+		violations:     violations,
+		qualities:      newQualityHistory(),
 	}
 }
 
@@ -43,13 +86,36 @@ func (p *Proxy) Handle(
 	target *models.Target,
 	creds *vault.Credentials,
 	auditLog *models.AuditLog,
-	width int,
-	height int,
+	display Display,
 ) error {
 	p.logger.Info("RDP Handle() called", map[string]interface{}{
 		"session_id": auditLog.ID.String(),
 		"target":     target.Hostname,
+		"monitors":   max(len(display.Layout), 1),
 	})
+	width, height := display.Width, display.Height
+	dpi := fmt.Sprintf("%d", display.DPI)
+
+	// Keep recent instructions for monitors that join later
+	if p.monitor != nil {
+		p.monitor.Start(auditLog.ID.String(), models.ProtocolRDP)
+		defer p.monitor.End(auditLog.ID.String())
+	}
+
+	// guacd can't be given a CA, so the gateway checks the certificate itself
+	// and pins guacd to it
+	var fingerprint string
+	if target.RDP.VerifiesCertificate() {
+		fp, err := verifyTargetCertificate(ctx, target)
+		if err != nil {
+			p.logger.Warn("RDP target certificate check failed", map[string]interface{}{
+				"target": target.Hostname,
+				"error":  err.Error(),
+			})
+			return err
+		}
+		fingerprint = fp
+	}
 
 	// Connect to guacd
 	guacdConn, err := net.Dial("tcp", p.guacdAddress)
@@ -66,17 +132,41 @@ func (p *Proxy) Handle(
 		"target":  target.Hostname,
 	})
 
-	// Start recording if recorder is available
-	if p.recorder != nil {
-		if err := p.recorder.StartRecording(ctx, auditLog.ID.String()); err != nil {
+	// Start recording if the session is recorded. A session that must be
+	// recorded is refused before the handshake if its recording can't start.
+	var recorder *Recorder
+	if settings.RecordingEnabled(ctx) {
+		err := recordings.ErrUnavailable
+		if p.recorder != nil {
+			err = p.recorder.StartRecording(ctx, auditLog.ID.String())
+		}
+		if err != nil {
 			p.logger.Error("Failed to start recording", map[string]interface{}{
-				"error": err.Error(),
+				"session_id": auditLog.ID.String(),
+				"error":      err.Error(),
 			})
+			if err := recordings.Failed(ctx, err); err != nil {
+				return err
+			}
 		} else {
-			defer p.recorder.StopRecording(auditLog.ID.String())
+			recorder = p.recorder
+			recordings.Started(ctx)
+			defer func() {
+				if err := recorder.StopRecording(auditLog.ID.String()); err != nil {
+					p.logger.Error("Failed to finish recording", map[string]interface{}{
+						"session_id": auditLog.ID.String(),
+						"error":      err.Error(),
+					})
+					recordings.Failed(ctx, err)
+				}
+			}()
 		}
 	}
 
+	// Audio redirection allowed by the session settings
+	var audio audioPolicy
+	audio.output, audio.input, audio.record = settings.Audio(ctx)
+
 	// 1. Handshake with guacd
 	// ... (rest of handshake logic remains the same until proxy loop)
 
@@ -90,6 +180,9 @@ func (p *Proxy) Handle(
 	if err != nil {
 		return fmt.Errorf("failed to read args from guacd: %w", err)
 	}
+	if opcode == "error" {
+		return guacdHandshakeError(args)
+	}
 	if opcode != "args" {
 		return fmt.Errorf("expected args instruction, got: %s", opcode)
 	}
@@ -98,29 +191,43 @@ func (p *Proxy) Handle(
 		"args": args,
 	})
 
+	// Smart card logon needs a guacd built with FreeRDP's smart card emulation.
+	// Without it the session is refused rather than falling back to a password.
+	if creds.Certificate != "" && !supportsSmartcard(args) {
+		return ErrSmartcardUnsupported
+	}
+
 	// Construct "size" instruction (client screen size)
 	// We must record and broadcast this so monitors/replay know the screen size
-	if p.recorder != nil {
-		p.recorder.WriteInstruction(auditLog.ID.String(), "size", "0", fmt.Sprintf("%d", width), fmt.Sprintf("%d", height), "96")
+	if recorder != nil {
+		recorder.WriteInstruction(auditLog.ID.String(), "size", "0", fmt.Sprintf("%d", width), fmt.Sprintf("%d", height), dpi)
 	}
 
 	// Keep track of header messages to send to new subscribers
 	var headerBuilder strings.Builder
 
+	// Size instruction, e.g. 4.size,1.0,4.1024,3.768,2.96;
+	sizeMsg := sizeInstruction(fmt.Sprintf("%d", width), fmt.Sprintf("%d", height), dpi)
+
 	if p.monitor != nil {
-		// Broadcast size: 4.size,1.0,4.1024,3.768,2.96;
-		msg := fmt.Sprintf("4.size,1.0,%d.%d,%d.%d,2.96;", len(fmt.Sprintf("%d", width)), width, len(fmt.Sprintf("%d", height)), height)
+		// Broadcast size
+		msg := sizeMsg
 		headerBuilder.WriteString(msg)
 		p.monitor.SetHeader(auditLog.ID.String(), []byte(headerBuilder.String()))
 		p.monitor.Broadcast(auditLog.ID.String(), []byte(msg))
 	}
 
-	if err := p.sendInstruction(guacdConn, "size", fmt.Sprintf("%d", width), fmt.Sprintf("%d", height), "96"); err != nil {
+	if err := p.sendInstruction(guacdConn, "size", fmt.Sprintf("%d", width), fmt.Sprintf("%d", height), dpi); err != nil {
 		return fmt.Errorf("failed to send size to guacd: %w", err)
 	}
 
-	// Construct "audio" and "video" instructions (supported formats)
-	if err := p.sendInstruction(guacdConn, "audio", "audio/L16", "rate=44100", "channels=2"); err != nil {
+	// Construct "audio" and "video" instructions (supported formats).
+	// Without audio output no formats are offered, so guacd sends no sound.
+	audioFormats := []string{}
+	if audio.output {
+		audioFormats = append(audioFormats, "audio/L16", "rate=44100", "channels=2")
+	}
+	if err := p.sendInstruction(guacdConn, "audio", audioFormats...); err != nil {
 		return fmt.Errorf("failed to send audio to guacd: %w", err)
 	}
 	if err := p.sendInstruction(guacdConn, "video", "image/jpeg", "image/png", "image/webp"); err != nil {
@@ -132,25 +239,43 @@ func (p *Proxy) Handle(
 		return fmt.Errorf("failed to send image to guacd: %w", err)
 	}
 
-	// Connection parameters - optimized for performance
-	config := map[string]string{
-		"hostname":                   target.Hostname,
-		"port":                       fmt.Sprintf("%d", target.Port),
-		"username":                   creds.Username,
-		"password":                   creds.Password,
-		"ignore-cert":                "true",
-		"security":                   "any",
-		"disable-bitmap-caching":     "false", // Enable bitmap caching for better performance
-		"enable-wallpaper":           "false", // Disable wallpaper for better performance
-		"enable-theming":             "true",  // Keep theming for usability
-		"enable-menu-animations":     "false", // Disable animations for better performance
-		"enable-font-smoothing":      "false", // Disable font smoothing for better performance
-		"enable-desktop-composition": "false", // Disable desktop composition for better performance
-		"color-depth":                "24",    // Use 24-bit color (good balance of quality and performance)
-		"width":                      fmt.Sprintf("%d", width),
-		"height":                     fmt.Sprintf("%d", height),
-		"dpi":                        "96",
-		"resize-method":              "display-update",
+	// Sessions start at the quality the user's link last supported and
+	// adapt to it from there
+	linkKey := historyKey(auditLog.UserID.String(), auditLog.ClientIP)
+	if display.Quality == "" {
+		display.Quality = p.qualities.get(linkKey)
+	}
+	link := newLinkMonitor(display.Quality, func(from, to Quality) {
+		p.logger.Info("RDP quality changed", map[string]interface{}{
+			"session_id": auditLog.ID.String(),
+			"from":       from,
+			"to":         to,
+		})
+	})
+	defer func() {
+		p.qualities.set(linkKey, link.current())
+		if auditLog.Metadata == nil {
+			auditLog.Metadata = models.JSONB{}
+		}
+		auditLog.Metadata["rdp_quality"] = link.metadata()
+	}()
+
+	config := p.connectParams(target, creds, display, audio)
+
+	// Name the client after the session, so the target's logon events and
+	// session list can be matched to the audit log
+	if settings.InjectMetadata(ctx) != models.InjectMetadataOff {
+		config["client-name"] = ClientName(auditLog.ID)
+		if auditLog.Metadata == nil {
+			auditLog.Metadata = models.JSONB{}
+		}
+		auditLog.Metadata["injected_metadata"] = "client_name"
+	}
+
+	// Older guacd can't be pinned; it then trusts the check made above
+	if fingerprint != "" && hasArg(args, "cert-fingerprints") {
+		config["ignore-cert"] = "false"
+		config["cert-fingerprints"] = certFingerprintParam(fingerprint)
 	}
 
 	// Respond to "args" with "connect"
@@ -178,6 +303,9 @@ func (p *Proxy) Handle(
 	if err != nil {
 		return fmt.Errorf("failed to read ready from guacd: %w", err)
 	}
+	if opcode == "error" {
+		return guacdHandshakeError(readyArgs)
+	}
 	if opcode != "ready" {
 		return fmt.Errorf("expected ready instruction, got: %s", opcode)
 	}
@@ -185,8 +313,9 @@ func (p *Proxy) Handle(
 	p.logger.Info("Guacamole connection established (ready received)")
 
 	// Record and broadcast "ready"
-	if p.recorder != nil {
-		p.recorder.WriteInstruction(auditLog.ID.String(), "ready", readyArgs...)
+	var readyMsg string
+	if recorder != nil {
+		recorder.WriteInstruction(auditLog.ID.String(), "ready", readyArgs...)
 	}
 	if p.monitor != nil {
 		var sb strings.Builder
@@ -197,19 +326,25 @@ func (p *Proxy) Handle(
 		sb.WriteString(";")
 		msg := sb.String()
 
+		readyMsg = msg
 		headerBuilder.WriteString(msg)
 		p.monitor.SetHeader(auditLog.ID.String(), []byte(headerBuilder.String()))
 		p.monitor.Broadcast(auditLog.ID.String(), []byte(msg))
 	}
 
+	// From here on all client writes go through the pump so a slow client can't stall guacd reads
+	pump := wsconn.NewWritePump(wsConn, p.wsConfig, p.logger)
+	defer pump.Stop()
+	ws := &wsWriter{pump}
+
 	// Send "ready" to client
-	if err := p.sendInstruction(&wsWriter{wsConn}, "ready", readyArgs...); err != nil {
+	if err := p.sendInstruction(ws, "ready", readyArgs...); err != nil {
 		return fmt.Errorf("failed to send ready to client: %w", err)
 	}
 
 	// Send "size" to client to ensure display is sized correctly
 	// layer 0, width, height
-	if err := p.sendInstruction(&wsWriter{wsConn}, "size", "0", fmt.Sprintf("%d", width), fmt.Sprintf("%d", height)); err != nil {
+	if err := p.sendInstruction(ws, "size", "0", fmt.Sprintf("%d", width), fmt.Sprintf("%d", height)); err != nil {
 		return fmt.Errorf("failed to send size to client: %w", err)
 	}
 
@@ -226,50 +361,83 @@ func (p *Proxy) Handle(
 	// Use sync.Once to ensure clean shutdown happens only once
 	var shutdownOnce sync.Once
 
+	// Keep the latest display instructions as evidence for violations
+	var tail *evidence.Tail
+	if p.violations != nil {
+		tail = p.violations.NewTail()
+	}
+
 	// Shutdown function that signals stop before closing
 	shutdown := func() {
 		shutdownOnce.Do(func() {
 			close(stopChan) // Signal all goroutines to stop
 			// Close connections immediately to unblock any goroutines stuck in blocking I/O
+			pump.Stop()
 			wsConn.Close()
 			guacdConn.Close()
 		})
 	}
 
-	// Create instruction queue for async processing
-	type instruction struct {
-		opcode string
-		args   []string
+	// Notices for the user, such as the session ending soon, go out as an
+	// instruction Guacamole clients ignore unless they look for it
+	if notices := notice.Notices(ctx); notices != nil {
+		go func() {
+			for {
+				select {
+				case <-stopChan:
+					return
+				case n := <-notices:
+					data, err := json.Marshal(n)
+					if err != nil {
+						continue
+					}
+					if err := p.sendInstruction(ws, noticeOpcode, string(data)); err != nil {
+						return
+					}
+				}
+			}
+		}()
 	}
-	instrChan := make(chan instruction, 500) // Buffer for async processing
+
+	// Create instruction queue for async processing.
+	// Queued instructions are pooled clones and must be released by the worker.
+	instrChan := make(chan *Instruction, 500) // Buffer for async processing
 
 	// Background worker for recording and broadcasting
 	go func() {
 		defer wg.Done()
+
+		// Target audio streams, left out of the recording unless audio is recorded
+		audioStreams := make(map[string]bool)
+
 		for instr := range instrChan {
-			// Record instruction in background (don't wait)
-			if p.recorder != nil {
+			switch {
+			case recorder == nil || !audio.record && audioStream(instr, audioStreams):
+			case instr.Opcode() == "size":
+				// Resizes are recorded in order so later drawing plays back at the new size
+				if err := recorder.WriteInstruction(auditLog.ID.String(), instr.Opcode(), instr.Args()...); err != nil {
+					p.logger.Error("Failed to record instruction", map[string]interface{}{
+						"error": err.Error(),
+					})
+				}
+			default:
+				// Record instruction in background (don't wait)
 				go func(op string, a []string) {
-					if err := p.recorder.WriteInstruction(auditLog.ID.String(), op, a...); err != nil {
+					if err := recorder.WriteInstruction(auditLog.ID.String(), op, a...); err != nil {
 						p.logger.Error("Failed to record instruction", map[string]interface{}{
 							"error": err.Error(),
 						})
 					}
-				}(instr.opcode, instr.args)
+				}(instr.Opcode(), instr.Args())
 			}
 
-			// Broadcast to monitor in background (don't wait)
+			// Broadcast the original encoding to monitors and their scrollback.
+			// Broadcast copies it before the clone goes back to the pool.
 			if p.monitor != nil {
-				go func(op string, a []string) {
-					var sb strings.Builder
-					sb.WriteString(fmt.Sprintf("%d.%s", len(op), op))
-					for _, arg := range a {
-						sb.WriteString(fmt.Sprintf(",%d.%s", len(arg), arg))
-					}
-					sb.WriteString(";")
-					p.monitor.Broadcast(auditLog.ID.String(), []byte(sb.String()))
-				}(instr.opcode, instr.args)
+				p.monitor.Broadcast(auditLog.ID.String(), instr.Raw())
 			}
+
+			instr.Release()
 		}
 	}()
 
@@ -279,8 +447,9 @@ func (p *Proxy) Handle(
 		defer close(instrChan) // Close instruction queue when done
 
 		// We parse instructions here to record them
+		parser := NewParser(guacdReader)
 		for {
-			opcode, args, err := p.readInstruction(guacdReader)
+			instr, err := parser.Next()
 			if err != nil {
 				if err != io.EOF {
 					// Only log real errors, not normal EOF
@@ -295,18 +464,43 @@ func (p *Proxy) Handle(
 				return
 			}
 
+			// A resized default layer is the new display size. Monitors that
+			// join later start from it.
+			resized := instr.Opcode() == "size" && instr.Len() > 3 && string(instr.Element(1)) == "0"
+			if resized && p.monitor != nil {
+				p.monitor.SetHeader(auditLog.ID.String(), []byte(sizeInstruction(string(instr.Element(2)), string(instr.Element(3)), dpi)+readyMsg))
+			}
+
 			// Queue instruction for async recording/broadcasting (non-blocking)
-			// If queue is full, skip this instruction to keep stream flowing
-			select {
-			case instrChan <- instruction{opcode: opcode, args: args}:
-			default:
-				// Queue is full, skip this instruction
-				// This is acceptable as we prioritize live stream over recording
+			// If queue is full, skip this instruction to keep stream flowing.
+			// Resizes are never skipped, or playback would render at the wrong size.
+			if recorder != nil || p.monitor != nil {
+				queued := instr.Clone()
+				if resized {
+					instrChan <- queued
+				} else {
+					select {
+					case instrChan <- queued:
+					default:
+						// Queue is full, skip this instruction
+						// This is acceptable as we prioritize live stream over recording
+						queued.Release()
+					}
+				}
+			}
+
+			if tail != nil {
+				tail.Write(instr.Raw())
+			}
+
+			// Each frame ends with a sync the client acknowledges
+			if instr.Opcode() == "sync" && instr.Len() > 1 {
+				link.frameSent(string(instr.Element(1)), pump.Backlog())
 			}
 
-			// Forward to WebSocket immediately (don't wait for recording)
-			if err := p.sendInstruction(&wsWriter{wsConn}, opcode, args...); err != nil {
-				if !strings.Contains(err.Error(), "use of closed network connection") {
+			// Forward the instruction as received (don't wait for recording)
+			if _, err := ws.Write(instr.Raw()); err != nil {
+				if !errors.Is(err, wsconn.ErrClosed) && !strings.Contains(err.Error(), "use of closed network connection") {
 					p.logger.Error("ws write error", map[string]interface{}{"error": err.Error()})
 					errChan <- err
 				}
@@ -314,8 +508,18 @@ func (p *Proxy) Handle(
 				return
 			}
 
-			// Estimate bytes received (rough approximation since we re-serialized)
-			bytesReceived += 100 // Placeholder
+			bytesReceived += int64(len(instr.Raw()))
+
+			// guacd reports a failed RDP logon after ready, once the client
+			// has been forwarded the error too
+			if instr.Opcode() == "error" {
+				if hsErr := guacdHandshakeError(instr.Args()); hsErr.Reason == wsconn.ReasonAuthenticationFailed {
+					select {
+					case errChan <- hsErr:
+					default:
+					}
+				}
+			}
 		}
 	}()
 
@@ -323,12 +527,27 @@ func (p *Proxy) Handle(
 	go func() {
 		defer wg.Done()
 
+		// Reuse the reader chain and parser across messages
+		msgReader := bytes.NewReader(nil)
+		bufReader := bufio.NewReader(msgReader)
+		parser := NewParser(bufReader)
+
+		// Client clipboard streams being refused; their blobs are dropped too
+		blockedStreams := make(map[string]bool)
+
+		// Client microphone streams, recorded with the session when audio is
+		micStreams := make(map[string]bool)
+
 		for {
 			_, message, err := wsConn.ReadMessage()
 			if err != nil {
 				if websocket.IsUnexpectedCloseError(err, websocket.CloseNormalClosure, websocket.CloseGoingAway, websocket.CloseAbnormalClosure) {
 					p.logger.Error("ws read error", map[string]interface{}{"error": err.Error()})
 					errChan <- err
+				} else if wsconn.IsTimeout(err) {
+					// The client stopped answering pings - the connection is dead, not closed
+					p.logger.Warn("WebSocket client stopped responding to pings")
+					errChan <- fmt.Errorf("client connection lost: %w", err)
 				} else {
 					p.logger.Info("WebSocket closed normally")
 				}
@@ -337,9 +556,11 @@ func (p *Proxy) Handle(
 			}
 
 			// Parse and filter instructions
-			reader := bufio.NewReader(bytes.NewReader(message))
+			msgReader.Reset(message)
+			bufReader.Reset(msgReader)
+			parser.Reset(bufReader)
 			for {
-				opcode, args, err := p.readInstruction(reader)
+				instr, err := parser.Next()
 				if err != nil {
 					if err != io.EOF && err.Error() != "EOF" {
 						p.logger.Error("Error parsing instruction from ws", map[string]interface{}{"error": err.Error()})
@@ -348,9 +569,9 @@ func (p *Proxy) Handle(
 				}
 
 				// Ignore internal "empty" opcode (used for keep-alive/internal)
-				if opcode == "" {
+				if len(instr.Element(0)) == 0 {
 					// Respond to keep-alive
-					err = p.sendInstruction(&wsWriter{wsConn}, "nop")
+					err = p.sendInstruction(ws, "nop")
 					if err != nil {
 						shutdown()
 						return
@@ -358,8 +579,42 @@ func (p *Proxy) Handle(
 					continue
 				}
 
+				if p.blockClipboard && p.refuseClipboard(ctx, instr, blockedStreams, ws, auditLog, sizeMsg, tail) {
+					continue
+				}
+				if !audio.input && p.refuseAudioInput(instr, blockedStreams, ws) {
+					continue
+				}
+				if audio.input && audio.record && recorder != nil && audioStream(instr, micStreams) {
+					p.recordMicrophone(recorder, auditLog.ID.String(), instr)
+				}
+
+				// Clients acknowledge every frame with sync, which isn't user
+				// input. On a poor link some are held back to slow guacd down.
+				if instr.Opcode() != "sync" {
+					settings.Touch(ctx)
+				} else if instr.Len() > 1 && !link.frameAcked(string(instr.Element(1))) {
+					continue
+				}
+
+				// Resizes are kept within the display limits; guacd answers with
+				// the new size of the default layer, which is what gets recorded
+				raw := instr.Raw()
+				if instr.Opcode() == "size" {
+					args, ok := clientResize(instr.Args())
+					if !ok {
+						continue
+					}
+					raw = encodeInstruction("size", args...)
+					p.logger.Debug("Client resized display", map[string]interface{}{
+						"session_id": auditLog.ID.String(),
+						"width":      args[0],
+						"height":     args[1],
+					})
+				}
+
 				// Forward instruction to guacd
-				err = p.sendInstruction(guacdConn, opcode, args...)
+				_, err = guacdConn.Write(raw)
 				if err != nil {
 					if !strings.Contains(err.Error(), "use of closed network connection") {
 						p.logger.Error("guacd write error", map[string]interface{}{"error": err.Error()})
@@ -382,7 +637,10 @@ func (p *Proxy) Handle(
 	select {
 	case <-ctx.Done():
 		p.logger.Info("RDP session cancelled by context")
-		finalErr = ctx.Err()
+		finalErr = context.Cause(ctx)
+		if code, text, ok := wsconn.CloseFor(finalErr); ok {
+			pump.Close(code, text)
+		}
 	case err := <-errChan:
 		finalErr = err
 	case <-doneChan:
@@ -397,14 +655,168 @@ func (p *Proxy) Handle(
 	return finalErr
 }
 
-// wsWriter wraps websocket.Conn to satisfy io.Writer
+// connectParams returns the guacd connection parameters for a session to target
+func (p *Proxy) connectParams(target *models.Target, creds *vault.Credentials, display Display, audio audioPolicy) map[string]string {
+	// Connection parameters - optimized for performance
+	config := map[string]string{
+		"hostname":                   target.Hostname,
+		"port":                       fmt.Sprintf("%d", target.Port),
+		"username":                   creds.Username,
+		"password":                   creds.Password,
+		"ignore-cert":                "true",
+		"security":                   "any",
+		"disable-bitmap-caching":     "false", // Enable bitmap caching for better performance
+		"enable-wallpaper":           "false", // Disable wallpaper for better performance
+		"enable-theming":             fmt.Sprintf("%t", display.Quality.profile().theming),
+		"enable-menu-animations":     "false", // Disable animations for better performance
+		"enable-font-smoothing":      "false", // Disable font smoothing for better performance
+		"enable-desktop-composition": "false", // Disable desktop composition for better performance
+		"color-depth":                display.Quality.profile().colorDepth,
+		"width":                      fmt.Sprintf("%d", display.Width),
+		"height":                     fmt.Sprintf("%d", display.Height),
+		"dpi":                        fmt.Sprintf("%d", display.DPI),
+		"resize-method":              "display-update",
+		"disable-audio":              fmt.Sprintf("%t", !audio.output),
+		"enable-audio-input":         fmt.Sprintf("%t", audio.input),
+	}
+
+	// Let guacd enforce the clipboard block too, so copies from the target never reach the client
+	if p.blockClipboard {
+		config["disable-copy"] = "true"
+		config["disable-paste"] = "true"
+	}
+
+	if target.RDP.Domain != "" {
+		config["domain"] = target.RDP.Domain
+	}
+	if target.RDP.Security != "" {
+		config["security"] = target.RDP.Security
+	}
+
+	// Certificate credentials log in with an emulated smart card holding the
+	// client certificate; the secret's password, if any, is the card's PIN
+	if creds.Certificate != "" {
+		config["smartcard-certificate"] = creds.Certificate
+		config["smartcard-private-key"] = creds.PrivateKey
+	}
+
+	// Kerberos targets get the user's credentials passed through to their KDC,
+	// so the session is signed in to with a ticket instead of NTLM
+	if target.RDP.Auth == models.RDPAuthKerberos {
+		config["security"] = "nla"
+		config["auth-pkg"] = "kerberos"
+		if p.kerberos.KDCURL != "" {
+			config["kdc-url"] = p.kerberos.KDCURL
+		}
+	}
+
+	return config
+}
+
+// ClientName is the RDP client name of a session: "OP" and the first 13 hex
+// digits of its ID, as client names are at most 15 characters
+func ClientName(sessionID uuid.UUID) string {
+	return "OP" + strings.ToUpper(strings.ReplaceAll(sessionID.String(), "-", "")[:13])
+}
+
+// refuseClipboard drops client clipboard streams and their data, telling the
+// client the transfer is forbidden. It reports whether instr was dropped.
+func (p *Proxy) refuseClipboard(ctx context.Context, instr *Instruction, blocked map[string]bool, ws io.Writer, auditLog *models.AuditLog, sizeMsg string, tail *evidence.Tail) bool {
+	arg := func(n int) string {
+		if n < instr.Len() {
+			return string(instr.Element(n))
+		}
+		return ""
+	}
+
+	switch string(instr.Element(0)) {
+	case "clipboard":
+		stream := arg(1)
+		blocked[stream] = true
+
+		// 0x0303 CLIENT_FORBIDDEN makes the client abandon the stream
+		if err := p.sendInstruction(ws, "ack", stream, "Clipboard is disabled", "771"); err != nil {
+			p.logger.Debug("Failed to refuse clipboard stream", map[string]interface{}{"error": err.Error()})
+		}
+		notice.Send(ctx, notice.Notice{
+			Type:    notice.TypeClipboardBlocked,
+			Message: "Copying to the remote session is disabled by policy",
+		})
+
+		if p.violations != nil {
+			var frame []byte
+			if tail != nil {
+				frame = append([]byte(sizeMsg), tail.Bytes()...)
+			}
+			p.violations.Report(evidence.Violation{
+				SessionID:    auditLog.ID,
+				UserID:       auditLog.UserID,
+				TargetID:     auditLog.TargetID,
+				Type:         models.ViolationClipboardBlocked,
+				Blocked:      true,
+				Details:      map[string]interface{}{"mimetype": arg(2)},
+				EvidenceKind: models.EvidenceRDPStream,
+				ContentType:  "application/vnd.guacamole",
+				Evidence:     frame,
+			})
+		}
+		return true
+
+	}
+	return blockedStream(instr, blocked)
+}
+
+// refuseAudioInput drops client microphone streams and their data, telling
+// the client the transfer is forbidden. It reports whether instr was dropped.
+func (p *Proxy) refuseAudioInput(instr *Instruction, blocked map[string]bool, ws io.Writer) bool {
+	if instr.Opcode() != "audio" {
+		return blockedStream(instr, blocked)
+	}
+
+	stream := ""
+	if instr.Len() > 1 {
+		stream = string(instr.Element(1))
+	}
+	blocked[stream] = true
+
+	// 0x0303 CLIENT_FORBIDDEN makes the client abandon the stream
+	if err := p.sendInstruction(ws, "ack", stream, "Microphone is disabled", "771"); err != nil {
+		p.logger.Debug("Failed to refuse audio input stream", map[string]interface{}{"error": err.Error()})
+	}
+	return true
+}
+
+// blockedStream reports whether instr carries data of a refused client
+// stream, forgetting the stream once it ends
+func blockedStream(instr *Instruction, blocked map[string]bool) bool {
+	if instr.Len() < 2 {
+		return false
+	}
+	stream := string(instr.Element(1))
+
+	switch instr.Opcode() {
+	case "blob":
+		return blocked[stream]
+	case "end":
+		if blocked[stream] {
+			delete(blocked, stream)
+			return true
+		}
+	}
+	return false
+}
+
+// noticeOpcode is the instruction notices are sent to the client in, with the
+// notice as JSON
+const noticeOpcode = "openpam-notice"
+
+// wsWriter adapts a write pump to io.Writer, sending each write as a text message
 type wsWriter struct {
-	*websocket.Conn
+	pump *wsconn.WritePump
 }
 
 func (w *wsWriter) Write(p []byte) (int, error) {
-	err := w.Conn.WriteMessage(websocket.TextMessage, p)
-	if err != nil {
+	if err := w.pump.Write(websocket.TextMessage, p); err != nil {
 		return 0, err
 	}
 	return len(p), nil
@@ -412,6 +824,17 @@ func (w *wsWriter) Write(p []byte) (int, error) {
 
 // sendInstruction sends a Guacamole instruction to the writer
 func (p *Proxy) sendInstruction(w io.Writer, opcode string, args ...string) error {
+	_, err := w.Write(encodeInstruction(opcode, args...))
+	return err
+}
+
+// sizeInstruction encodes the size of the default layer, as sent before ready
+func sizeInstruction(width, height, dpi string) string {
+	return string(encodeInstruction("size", "0", width, height, dpi))
+}
+
+// encodeInstruction encodes a Guacamole instruction
+func encodeInstruction(opcode string, args ...string) []byte {
 	var sb strings.Builder
 
 	// Opcode
@@ -424,53 +847,20 @@ func (p *Proxy) sendInstruction(w io.Writer, opcode string, args ...string) erro
 
 	sb.WriteString(";")
 
-	_, err := w.Write([]byte(sb.String()))
-	return err
+	return []byte(sb.String())
 }
 
-// readInstruction reads a Guacamole instruction from the reader
+// readInstruction reads a single Guacamole instruction from the reader.
+// It is used for the handshake and other low-volume paths; the session loop
+// uses a long-lived Parser instead to avoid per-instruction allocations.
 func (p *Proxy) readInstruction(reader *bufio.Reader) (string, []string, error) {
-	var elements []string
-	var currentElement strings.Builder
-	var length int
-
-	for {
-		// Read length
-		lenStr, err := reader.ReadString('.')
-		if err != nil {
-			return "", nil, err
-		}
-		lenStr = strings.TrimSuffix(lenStr, ".")
-
-		if _, err := fmt.Sscanf(lenStr, "%d", &length); err != nil {
-			return "", nil, fmt.Errorf("invalid length: %w", err)
-		}
-
-		// Read content
-		content := make([]byte, length)
-		if _, err := io.ReadFull(reader, content); err != nil {
-			return "", nil, err
-		}
-		currentElement.Write(content)
-		elements = append(elements, currentElement.String())
-		currentElement.Reset()
-
-		// Check delimiter
-		delim, err := reader.ReadByte()
-		if err != nil {
-			return "", nil, err
-		}
-
-		if delim == ';' {
-			break
-		} else if delim != ',' {
-			return "", nil, fmt.Errorf("unexpected delimiter: %c", delim)
-		}
+	instr, err := NewParser(reader).Next()
+	if err != nil {
+		return "", nil, err
 	}
-
-	if len(elements) == 0 {
+	if instr.Len() == 0 {
 		return "", nil, fmt.Errorf("empty instruction")
 	}
 
-	return elements[0], elements[1:], nil
+	return instr.Opcode(), instr.Args(), nil
 }
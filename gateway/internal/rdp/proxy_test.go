@@ -2,9 +2,14 @@ package rdp
 
 import (
 	"bufio"
+	"context"
 	"reflect"
 	"strings"
 	"testing"
+
+	"github.com/VanCannon/openpam/gateway/internal/models"
+	"github.com/VanCannon/openpam/gateway/internal/vault"
+	"github.com/google/uuid"
 )
 
 func TestReadInstruction(t *testing.T) {
@@ -52,3 +57,177 @@ func TestReadInstruction(t *testing.T) {
 		})
 	}
 }
+
+func TestRefuseClipboard(t *testing.T) {
+	proxy := &Proxy{blockClipboard: true}
+	input := "9.clipboard,1.3,10.text/plain;4.blob,1.3,8.c2VjcmV0;3.end,1.3;5.mouse,2.10,2.20,1.0;4.blob,1.4,4.AAAA;"
+
+	var acks strings.Builder
+	blocked := make(map[string]bool)
+	var forwarded []string
+
+	parser := NewParser(bufio.NewReader(strings.NewReader(input)))
+	for {
+		instr, err := parser.Next()
+		if err != nil {
+			break
+		}
+		if !proxy.refuseClipboard(context.Background(), instr, blocked, &acks, &models.AuditLog{}, "", nil) {
+			forwarded = append(forwarded, instr.Opcode())
+		}
+	}
+
+	if want := []string{"mouse", "blob"}; !reflect.DeepEqual(forwarded, want) {
+		t.Errorf("forwarded = %v, want %v", forwarded, want)
+	}
+	if want := "3.ack,1.3,21.Clipboard is disabled,3.771;"; acks.String() != want {
+		t.Errorf("ack = %q, want %q", acks.String(), want)
+	}
+	if len(blocked) != 0 {
+		t.Errorf("stream still blocked after end: %v", blocked)
+	}
+}
+
+func TestRefuseAudioInput(t *testing.T) {
+	proxy := &Proxy{}
+	input := "5.audio,1.2,31.audio/L16;rate=44100,channels=1;4.blob,1.2,4.AAAA;3.end,1.2;3.key,5.65307,1.1;"
+
+	var acks strings.Builder
+	blocked := make(map[string]bool)
+	var forwarded []string
+
+	parser := NewParser(bufio.NewReader(strings.NewReader(input)))
+	for {
+		instr, err := parser.Next()
+		if err != nil {
+			break
+		}
+		if !proxy.refuseAudioInput(instr, blocked, &acks) {
+			forwarded = append(forwarded, instr.Opcode())
+		}
+	}
+
+	if want := []string{"key"}; !reflect.DeepEqual(forwarded, want) {
+		t.Errorf("forwarded = %v, want %v", forwarded, want)
+	}
+	if want := "3.ack,1.2,22.Microphone is disabled,3.771;"; acks.String() != want {
+		t.Errorf("ack = %q, want %q", acks.String(), want)
+	}
+	if len(blocked) != 0 {
+		t.Errorf("stream still blocked after end: %v", blocked)
+	}
+}
+
+func TestAudioStream(t *testing.T) {
+	input := "5.audio,1.1,9.audio/L16;4.blob,1.1,4.AAAA;4.blob,1.7,4.BBBB;3.end,1.1;4.blob,1.1,4.CCCC;"
+	want := []bool{true, true, false, true, false}
+
+	streams := make(map[string]bool)
+	parser := NewParser(bufio.NewReader(strings.NewReader(input)))
+	for i, w := range want {
+		instr, err := parser.Next()
+		if err != nil {
+			t.Fatalf("Next() error = %v", err)
+		}
+		if got := audioStream(instr, streams); got != w {
+			t.Errorf("instruction %d: audioStream() = %t, want %t", i, got, w)
+		}
+	}
+}
+
+func TestConnectParams_Audio(t *testing.T) {
+	proxy := &Proxy{}
+	creds := &vault.Credentials{Username: "alice", Password: "secret"}
+	target := &models.Target{Hostname: "ws1", Port: 3389}
+
+	params := proxy.connectParams(target, creds, Display{Width: 1024, Height: 768, DPI: 96}, audioPolicy{output: true})
+	if params["disable-audio"] != "false" || params["enable-audio-input"] != "false" {
+		t.Errorf("default audio params = %q, %q", params["disable-audio"], params["enable-audio-input"])
+	}
+
+	params = proxy.connectParams(target, creds, Display{Width: 1024, Height: 768, DPI: 96}, audioPolicy{input: true})
+	if params["disable-audio"] != "true" || params["enable-audio-input"] != "true" {
+		t.Errorf("microphone only audio params = %q, %q", params["disable-audio"], params["enable-audio-input"])
+	}
+}
+
+func TestConnectParams_Kerberos(t *testing.T) {
+	proxy := &Proxy{kerberos: KerberosConfig{KDCURL: "https://kdcproxy.corp.example.com/KdcProxy"}}
+	creds := &vault.Credentials{Username: "alice", Password: "secret"}
+
+	params := proxy.connectParams(&models.Target{Hostname: "ws1", Port: 3389}, creds, Display{Width: 1024, Height: 768, DPI: 96}, audioPolicy{output: true})
+	if params["security"] != "any" || params["auth-pkg"] != "" || params["domain"] != "" {
+		t.Errorf("NTLM target params = %v", params)
+	}
+
+	target := &models.Target{Hostname: "ws1", Port: 3389, RDP: models.RDPSettings{Auth: models.RDPAuthKerberos, Domain: "CORP.EXAMPLE.COM"}}
+	params = proxy.connectParams(target, creds, Display{Width: 1024, Height: 768, DPI: 96}, audioPolicy{output: true})
+	want := map[string]string{
+		"security": "nla",
+		"auth-pkg": "kerberos",
+		"domain":   "CORP.EXAMPLE.COM",
+		"kdc-url":  "https://kdcproxy.corp.example.com/KdcProxy",
+		"username": "alice",
+		"password": "secret",
+	}
+	for k, v := range want {
+		if params[k] != v {
+			t.Errorf("params[%q] = %q, want %q", k, params[k], v)
+		}
+	}
+}
+
+func TestConnectParams_Security(t *testing.T) {
+	proxy := &Proxy{}
+	creds := &vault.Credentials{Username: "alice", Password: "secret"}
+
+	target := &models.Target{Hostname: "ws1", Port: 3389, RDP: models.RDPSettings{Security: models.RDPSecurityTLS}}
+	if params := proxy.connectParams(target, creds, Display{Width: 1024, Height: 768, DPI: 96}, audioPolicy{output: true}); params["security"] != "tls" {
+		t.Errorf("security = %q, want tls", params["security"])
+	}
+}
+
+func TestClientName(t *testing.T) {
+	id := uuid.MustParse("7c9e6679-7425-40de-944b-e07fc1f90ae7")
+	if got := ClientName(id); got != "OP7C9E667974254" {
+		t.Errorf("ClientName() = %q, want OP7C9E667974254", got)
+	}
+	if len(ClientName(uuid.New())) > 15 {
+		t.Error("ClientName() is longer than RDP allows")
+	}
+}
+
+func TestConnectParams_Smartcard(t *testing.T) {
+	proxy := &Proxy{}
+	creds := &vault.Credentials{Username: "alice", Password: "1234", Certificate: "CERT", PrivateKey: "KEY"}
+
+	params := proxy.connectParams(&models.Target{Hostname: "ws1", Port: 3389}, creds, Display{Width: 1024, Height: 768, DPI: 96}, audioPolicy{output: true})
+	if params["smartcard-certificate"] != "CERT" || params["smartcard-private-key"] != "KEY" || params["password"] != "1234" {
+		t.Errorf("params = %v", params)
+	}
+
+	if supportsSmartcard([]string{"VERSION_1_5_0", "hostname", "password"}) {
+		t.Error("supportsSmartcard() = true without the smart card args")
+	}
+	if !supportsSmartcard([]string{"VERSION_1_5_0", "hostname", "smartcard-certificate", "smartcard-private-key"}) {
+		t.Error("supportsSmartcard() = false with the smart card args")
+	}
+}
+
+func TestConnectParams_Quality(t *testing.T) {
+	proxy := &Proxy{}
+	target := &models.Target{Hostname: "ws1", Port: 3389}
+	creds := &vault.Credentials{Username: "alice", Password: "secret"}
+
+	for quality, want := range map[Quality][2]string{
+		"":            {"24", "true"},
+		QualityHigh:   {"24", "true"},
+		QualityMedium: {"16", "false"},
+		QualityLow:    {"8", "false"},
+	} {
+		params := proxy.connectParams(target, creds, Display{Width: 1024, Height: 768, DPI: 96, Quality: quality}, audioPolicy{output: true})
+		if params["color-depth"] != want[0] || params["enable-theming"] != want[1] {
+			t.Errorf("quality %q: color-depth %s, enable-theming %s", quality, params["color-depth"], params["enable-theming"])
+		}
+	}
+}
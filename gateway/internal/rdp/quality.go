@@ -0,0 +1,233 @@
+package rdp
+
+import (
+	"net"
+	"sync"
+	"time"
+)
+
+// Quality is the display quality of an RDP session, adapted to the client's link
+type Quality string
+
+const (
+	QualityHigh   Quality = "high"
+	QualityMedium Quality = "medium"
+	QualityLow    Quality = "low"
+)
+
+// qualityProfile is what a quality level sets. Color depth and theming are
+// fixed when the session connects; the frame interval applies from the
+// moment the level is chosen.
+type qualityProfile struct {
+	colorDepth    string
+	theming       bool
+	frameInterval time.Duration // Least time between frames the client acknowledges to guacd
+}
+
+var qualityProfiles = map[Quality]qualityProfile{
+	QualityHigh:   {colorDepth: "24", theming: true},
+	QualityMedium: {colorDepth: "16", frameInterval: 66 * time.Millisecond},
+	QualityLow:    {colorDepth: "8", frameInterval: 200 * time.Millisecond},
+}
+
+// profile returns the profile of q; unset qualities are high
+func (q Quality) profile() qualityProfile {
+	if p, ok := qualityProfiles[q]; ok {
+		return p
+	}
+	return qualityProfiles[QualityHigh]
+}
+
+// rank orders qualities from best to worst
+func (q Quality) rank() int {
+	switch q {
+	case QualityMedium:
+		return 1
+	case QualityLow:
+		return 2
+	default:
+		return 0
+	}
+}
+
+// Link limits of each quality. A session drops to a lower quality as soon as
+// the smoothed round trip or client backlog passes them, and only moves back
+// up once the link has been better for qualityDwell.
+const (
+	mediumRTT     = 150 * time.Millisecond
+	lowRTT        = 400 * time.Millisecond
+	mediumBacklog = 0.25
+	lowBacklog    = 0.5
+
+	qualityDwell = 10 * time.Second
+	smoothing    = 0.2 // Weight of each new sample
+	maxPending   = 64  // Unacknowledged frames tracked before starting over
+)
+
+// linkMonitor measures a session's link from the frames guacd sends: the time
+// the client takes to acknowledge each one, and the backlog of the write pump
+// when it is sent. guacd adapts its frame rate and switches to lossy encoding
+// when acknowledgements lag, so on a poor link the monitor paces them.
+type linkMonitor struct {
+	mu sync.Mutex
+
+	initial   Quality
+	quality   Quality
+	changes   int
+	changedAt time.Time
+
+	rtt     time.Duration // Smoothed time from a frame to its acknowledgement
+	backlog float64       // Smoothed write pump backlog
+	samples int
+
+	pending map[string]time.Time // Frame timestamps sent to the client, not yet acknowledged
+	lastAck time.Time            // When an acknowledgement was last passed to guacd
+
+	now      func() time.Time
+	onChange func(from, to Quality)
+}
+
+func newLinkMonitor(initial Quality, onChange func(from, to Quality)) *linkMonitor {
+	if _, ok := qualityProfiles[initial]; !ok {
+		initial = QualityHigh
+	}
+	return &linkMonitor{
+		initial:  initial,
+		quality:  initial,
+		pending:  make(map[string]time.Time),
+		now:      time.Now,
+		onChange: onChange,
+	}
+}
+
+// frameSent notes a sync instruction sent to the client with the write
+// pump's backlog at the time
+func (m *linkMonitor) frameSent(timestamp string, backlog float64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	// A client that stops acknowledging leaves frames pending; its backlog
+	// shows the problem meanwhile
+	if len(m.pending) >= maxPending {
+		clear(m.pending)
+	}
+	m.pending[timestamp] = m.now()
+
+	m.backlog += smoothing * (backlog - m.backlog)
+	m.adapt()
+}
+
+// frameAcked notes the client's sync for a frame and reports whether to pass
+// it on to guacd. On a poor link acknowledgements are passed on at most once
+// per frame interval, which guacd sees as lag and answers with fewer frames.
+func (m *linkMonitor) frameAcked(timestamp string) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := m.now()
+	if sent, ok := m.pending[timestamp]; ok {
+		delete(m.pending, timestamp)
+		sample := now.Sub(sent)
+		if m.samples == 0 {
+			m.rtt = sample
+		} else {
+			m.rtt += time.Duration(smoothing * float64(sample-m.rtt))
+		}
+		m.samples++
+		m.adapt()
+	}
+
+	if interval := m.quality.profile().frameInterval; interval > 0 && now.Sub(m.lastAck) < interval {
+		return false
+	}
+	m.lastAck = now
+	return true
+}
+
+// adapt moves the session to the quality its link supports
+func (m *linkMonitor) adapt() {
+	target := QualityHigh
+	switch {
+	case m.rtt >= lowRTT || m.backlog >= lowBacklog:
+		target = QualityLow
+	case m.rtt >= mediumRTT || m.backlog >= mediumBacklog:
+		target = QualityMedium
+	}
+
+	now := m.now()
+	if target == m.quality || target.rank() < m.quality.rank() && now.Sub(m.changedAt) < qualityDwell {
+		return
+	}
+
+	from := m.quality
+	m.quality = target
+	m.changes++
+	m.changedAt = now
+	if m.onChange != nil {
+		m.onChange(from, target)
+	}
+}
+
+// current returns the session's current quality
+func (m *linkMonitor) current() Quality {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.quality
+}
+
+// metadata describes the session's quality for its audit log
+func (m *linkMonitor) metadata() map[string]interface{} {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return map[string]interface{}{
+		"initial": m.initial,
+		"final":   m.quality,
+		"changes": m.changes,
+		"rtt_ms":  m.rtt.Milliseconds(),
+		"backlog": float64(int(m.backlog*100)) / 100,
+	}
+}
+
+// maxQualityHistory caps the links remembered; the history starts over when full
+const maxQualityHistory = 10000
+
+// qualityHistory remembers the quality each user's last session from a client
+// address ended at, so the next one connects at it
+type qualityHistory struct {
+	mu        sync.Mutex
+	qualities map[string]Quality
+}
+
+func newQualityHistory() *qualityHistory {
+	return &qualityHistory{qualities: make(map[string]Quality)}
+}
+
+func historyKey(userID string, clientAddr *string) string {
+	if clientAddr == nil {
+		return userID
+	}
+	host, _, err := net.SplitHostPort(*clientAddr)
+	if err != nil {
+		host = *clientAddr
+	}
+	return userID + "|" + host
+}
+
+// get returns the quality to start a session at
+func (h *qualityHistory) get(key string) Quality {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if q, ok := h.qualities[key]; ok {
+		return q
+	}
+	return QualityHigh
+}
+
+func (h *qualityHistory) set(key string, q Quality) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if len(h.qualities) >= maxQualityHistory {
+		clear(h.qualities)
+	}
+	h.qualities[key] = q
+}
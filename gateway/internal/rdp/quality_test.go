@@ -0,0 +1,100 @@
+package rdp
+
+import (
+	"strconv"
+	"testing"
+	"time"
+)
+
+// fakeLink returns a link monitor on a clock advanced by the test
+func fakeLink(initial Quality) (*linkMonitor, *time.Time, *[]Quality) {
+	now := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	var changes []Quality
+	m := newLinkMonitor(initial, func(from, to Quality) { changes = append(changes, to) })
+	m.now = func() time.Time { return now }
+	return m, &now, &changes
+}
+
+// frames sends n frames acknowledged after rtt
+func frames(m *linkMonitor, now *time.Time, n int, rtt time.Duration, backlog float64) {
+	for i := 0; i < n; i++ {
+		ts := strconv.FormatInt(now.UnixMilli(), 10)
+		m.frameSent(ts, backlog)
+		*now = now.Add(rtt)
+		m.frameAcked(ts)
+		*now = now.Add(time.Second)
+	}
+}
+
+func TestLinkMonitor_Adapts(t *testing.T) {
+	m, now, changes := fakeLink(QualityHigh)
+
+	frames(m, now, 5, 20*time.Millisecond, 0)
+	if q := m.current(); q != QualityHigh {
+		t.Fatalf("quality on a fast link = %s", q)
+	}
+
+	// A slow link drops the quality at once
+	frames(m, now, 10, 600*time.Millisecond, 0)
+	if q := m.current(); q != QualityLow {
+		t.Fatalf("quality on a slow link = %s, want low", q)
+	}
+
+	// It recovers once the link has been good for a while
+	frames(m, now, 30, 20*time.Millisecond, 0)
+	if q := m.current(); q != QualityHigh {
+		t.Errorf("quality after recovering = %s, want high", q)
+	}
+
+	// A client falling behind is a poor link too, whatever its round trip
+	frames(m, now, 10, 20*time.Millisecond, 0.4)
+	if q := m.current(); q != QualityMedium {
+		t.Errorf("quality with a backlog = %s, want medium", q)
+	}
+
+	md := m.metadata()
+	if md["initial"] != QualityHigh || md["final"] != QualityMedium || md["changes"] != len(*changes) {
+		t.Errorf("metadata = %v, changes %v", md, *changes)
+	}
+}
+
+func TestLinkMonitor_PacesAcknowledgements(t *testing.T) {
+	m, now, _ := fakeLink(QualityLow)
+
+	var forwarded int
+	for i := 0; i < 10; i++ {
+		if m.frameAcked(strconv.Itoa(i)) {
+			forwarded++
+		}
+		*now = now.Add(50 * time.Millisecond)
+	}
+	// 500ms at one acknowledgement per 200ms
+	if forwarded != 3 {
+		t.Errorf("forwarded %d acknowledgements, want 3", forwarded)
+	}
+
+	m, now, _ = fakeLink(QualityHigh)
+	for i := 0; i < 10; i++ {
+		if !m.frameAcked(strconv.Itoa(i)) {
+			t.Fatal("acknowledgement held back on a good link")
+		}
+		*now = now.Add(time.Millisecond)
+	}
+}
+
+func TestQualityHistory(t *testing.T) {
+	h := newQualityHistory()
+	addr := "203.0.113.7:51234"
+	other := "203.0.113.7:60000"
+
+	if q := h.get(historyKey("u1", &addr)); q != QualityHigh {
+		t.Errorf("unknown link quality = %s", q)
+	}
+	h.set(historyKey("u1", &addr), QualityLow)
+	if q := h.get(historyKey("u1", &other)); q != QualityLow {
+		t.Errorf("quality from the same address = %s, want low", q)
+	}
+	if q := h.get(historyKey("u2", &addr)); q != QualityHigh {
+		t.Errorf("another user's quality = %s, want high", q)
+	}
+}
@@ -4,11 +4,11 @@ import (
 	"bufio"
 	"context"
 	"fmt"
-	"os"
-	"path/filepath"
 	"strings"
 	"sync"
 	"time"
+
+	"github.com/VanCannon/openpam/gateway/internal/recordings"
 )
 
 const (
@@ -20,16 +20,16 @@ const (
 
 // Recorder records RDP sessions in Guacamole protocol format
 type Recorder struct {
-	recordingsPath string
-	sessions       map[string]*RecordingSession
-	mu             sync.RWMutex
+	storage  recordings.Storage
+	sessions map[string]*RecordingSession
+	mu       sync.RWMutex
+	catalog  *recordings.Catalog // nil leaves recordings uncatalogued
 }
 
 // RecordingSession represents an active recording session
 type RecordingSession struct {
 	SessionID       string
-	FilePath        string
-	File            *os.File
+	File            *recordings.File
 	Writer          *bufio.Writer // Buffered writer for better performance
 	StartTime       time.Time
 	LastRealTime    time.Time
@@ -38,17 +38,14 @@ type RecordingSession struct {
 	mu              sync.Mutex
 }
 
-// NewRecorder creates a new session recorder
-func NewRecorder(recordingsPath string) (*Recorder, error) {
-	// Create recordings directory if it doesn't exist
-	if err := os.MkdirAll(recordingsPath, 0750); err != nil {
-		return nil, fmt.Errorf("failed to create recordings directory: %w", err)
-	}
-
+// NewRecorder creates a new session recorder writing to storage. Finished
+// recordings are added to catalog unless it is nil.
+func NewRecorder(storage recordings.Storage, catalog *recordings.Catalog) *Recorder {
 	return &Recorder{
-		recordingsPath: recordingsPath,
-		sessions:       make(map[string]*RecordingSession),
-	}, nil
+		storage:  storage,
+		sessions: make(map[string]*RecordingSession),
+		catalog:  catalog,
+	}
 }
 
 // StartRecording starts recording a session
@@ -59,10 +56,9 @@ func (r *Recorder) StartRecording(ctx context.Context, sessionID string) error {
 	// Generate filename with timestamp
 	timestamp := time.Now().Format("20060102-150405")
 	filename := fmt.Sprintf("%s-%s.guac", sessionID, timestamp)
-	filePath := filepath.Join(r.recordingsPath, filename)
 
-	// Create recording file
-	file, err := os.Create(filePath)
+	// Recordings outlive the request that started them
+	file, err := recordings.Create(context.Background(), r.storage, filename)
 	if err != nil {
 		return fmt.Errorf("failed to create recording file: %w", err)
 	}
@@ -72,7 +68,6 @@ func (r *Recorder) StartRecording(ctx context.Context, sessionID string) error {
 
 	session := &RecordingSession{
 		SessionID:        sessionID,
-		FilePath:         filePath,
 		File:             file,
 		Writer:           writer,
 		StartTime:        time.Now(),
@@ -150,14 +145,20 @@ func (r *Recorder) WriteInstruction(sessionID string, opcode string, args ...str
 
 // StopRecording stops recording a session
 func (r *Recorder) StopRecording(sessionID string) error {
+	// Finish outside the lock; completing an upload waits on the storage
 	r.mu.Lock()
-	defer r.mu.Unlock()
-
 	session, exists := r.sessions[sessionID]
+	delete(r.sessions, sessionID)
+	r.mu.Unlock()
+
 	if !exists {
 		return fmt.Errorf("session not found: %s", sessionID)
 	}
 
+	// Writers that looked the session up before it was removed finish first
+	session.mu.Lock()
+	defer session.mu.Unlock()
+
 	// Flush any remaining data in buffer
 	if err := session.Writer.Flush(); err != nil {
 		return fmt.Errorf("failed to flush recording buffer: %w", err)
@@ -168,7 +169,9 @@ func (r *Recorder) StopRecording(sessionID string) error {
 		return fmt.Errorf("failed to close recording file: %w", err)
 	}
 
-	delete(r.sessions, sessionID)
+	if r.catalog != nil {
+		r.catalog.Add(session.File)
+	}
 
 	return nil
 }
@@ -5,6 +5,8 @@ import (
 	"os"
 	"strings"
 	"testing"
+
+	"github.com/VanCannon/openpam/gateway/internal/recordings"
 )
 
 func TestRecorder_OutputFormat(t *testing.T) {
@@ -14,10 +16,11 @@ func TestRecorder_OutputFormat(t *testing.T) {
 	}
 	defer os.RemoveAll(tmpDir)
 
-	recorder, err := NewRecorder(tmpDir)
+	storage, err := recordings.NewLocal(tmpDir)
 	if err != nil {
-		t.Fatalf("Failed to create recorder: %v", err)
+		t.Fatalf("Failed to open storage: %v", err)
 	}
+	recorder := NewRecorder(storage, nil)
 
 	sessionID := "test-format"
 	ctx := context.Background()
@@ -3,9 +3,12 @@ package rdp
 import (
 	"context"
 	"os"
+	"path/filepath"
 	"strings"
 	"testing"
 	"time"
+
+	"github.com/VanCannon/openpam/gateway/internal/recordings"
 )
 
 func TestRecorder_IdleTimeOptimization(t *testing.T) {
@@ -16,10 +19,11 @@ func TestRecorder_IdleTimeOptimization(t *testing.T) {
 	}
 	defer os.RemoveAll(tmpDir)
 
-	recorder, err := NewRecorder(tmpDir)
+	storage, err := recordings.NewLocal(tmpDir)
 	if err != nil {
-		t.Fatalf("Failed to create recorder: %v", err)
+		t.Fatalf("Failed to open storage: %v", err)
 	}
+	recorder := NewRecorder(storage, nil)
 
 	sessionID := "test-session"
 	ctx := context.Background()
@@ -63,7 +67,7 @@ func TestRecorder_IdleTimeOptimization(t *testing.T) {
 	}
 
 	// Read the file and verify timestamps
-	content, err := os.ReadFile(session.FilePath)
+	content, err := os.ReadFile(filepath.Join(tmpDir, session.File.Name()))
 	if err != nil {
 		t.Fatalf("Failed to read recording file: %v", err)
 	}
@@ -74,7 +78,7 @@ func TestRecorder_IdleTimeOptimization(t *testing.T) {
 	}
 
 	// Verify line 1: timestamp 0
-	if !strings.HasPrefix(lines[0], "0,size") {
+	if !strings.HasPrefix(lines[0], "0,4.size") {
 		t.Errorf("Line 1 mismatch: %s", lines[0])
 	}
 
@@ -88,7 +92,7 @@ func TestRecorder_IdleTimeOptimization(t *testing.T) {
 	// T2: Manually subtract 100ms from LastRealTime. LastRealTime = Now - 100ms.
 	// T3: WriteInstruction. Now - (Now - 100ms) = 100ms.
 	// So timestamp should be 0 + 100 = 100.
-	if !strings.HasPrefix(lines[1], "100,mouse") {
+	if !strings.HasPrefix(lines[1], "100,5.mouse") {
 		t.Errorf("Line 2 mismatch: %s", lines[1])
 	}
 
@@ -98,7 +102,7 @@ func TestRecorder_IdleTimeOptimization(t *testing.T) {
 	// Delta (10s) > MaxIdleTime (5s).
 	// CurrentTime += 5s.
 	// Previous CurrentTime was 100. New is 5100.
-	if !strings.HasPrefix(lines[2], "5100,key") {
+	if !strings.HasPrefix(lines[2], "5100,3.key") {
 		t.Errorf("Line 3 mismatch: %s", lines[2])
 	}
 }
@@ -0,0 +1,208 @@
+package rdp
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/VanCannon/openpam/gateway/internal/models"
+	"github.com/VanCannon/openpam/gateway/internal/wsconn"
+)
+
+// certCheckTimeout bounds the gateway's own TLS handshake with a target
+const certCheckTimeout = 10 * time.Second
+
+// HandshakeError is a failure to set up the RDP session, reported to the
+// client in the close frame
+type HandshakeError struct {
+	Reason  string // wsconn close reason
+	Status  int    // Guacamole status code from guacd; 0 when the gateway refused the target
+	Message string
+}
+
+func (e *HandshakeError) Error() string {
+	if e.Status != 0 {
+		return fmt.Sprintf("RDP handshake failed (status 0x%04X): %s", e.Status, e.Message)
+	}
+	return "RDP handshake failed: " + e.Message
+}
+
+// CloseReason returns the close frame text sent to the client
+func (e *HandshakeError) CloseReason() wsconn.CloseReason {
+	return wsconn.CloseReason{Reason: e.Reason, Status: e.Status, Message: e.Message}
+}
+
+// guacdHandshakeError converts an error instruction sent by guacd instead of
+// ready into a HandshakeError
+func guacdHandshakeError(args []string) *HandshakeError {
+	e := &HandshakeError{Reason: wsconn.ReasonHandshakeFailed, Message: "guacd refused the connection"}
+	if len(args) > 0 && args[0] != "" {
+		e.Message = args[0]
+	}
+	if len(args) > 1 {
+		status, _ := strconv.ParseInt(args[1], 0, 32)
+		e.Status = int(status)
+	}
+
+	switch e.Status {
+	case 0x0301, 0x0303: // CLIENT_UNAUTHORIZED, CLIENT_FORBIDDEN
+		e.Reason = wsconn.ReasonAuthenticationFailed
+	case 0x0202, 0x0207, 0x0208: // UPSTREAM_TIMEOUT, UPSTREAM_NOT_FOUND, UPSTREAM_UNAVAILABLE
+		e.Reason = wsconn.ReasonTargetUnreachable
+	}
+	return e
+}
+
+// RDP protocol negotiation (MS-RDPBCGR 2.2.1.1 and 2.2.1.2)
+const (
+	negReq      = 0x01
+	negRsp      = 0x02
+	negFailure  = 0x03
+	protoSSL    = 0x01
+	protoHybrid = 0x02
+)
+
+// verifyTargetCertificate connects to the target the way an RDP client does,
+// negotiating TLS, and checks its certificate against the CA or pinned
+// fingerprint of the target's settings. It returns the certificate's SHA-256
+// fingerprint so guacd can be pinned to the certificate that was checked.
+func verifyTargetCertificate(ctx context.Context, target *models.Target) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, certCheckTimeout)
+	defer cancel()
+
+	address := net.JoinHostPort(target.Hostname, strconv.Itoa(target.Port))
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "tcp", address)
+	if err != nil {
+		return "", &HandshakeError{Reason: wsconn.ReasonTargetUnreachable, Message: err.Error()}
+	}
+	defer conn.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+
+	if err := negotiateTLS(conn); err != nil {
+		return "", &HandshakeError{Reason: wsconn.ReasonHandshakeFailed, Message: err.Error()}
+	}
+
+	tlsConn := tls.Client(conn, &tls.Config{
+		ServerName:         target.Hostname,
+		InsecureSkipVerify: true, // Checked below against the target's own trust settings
+	})
+	if err := tlsConn.HandshakeContext(ctx); err != nil {
+		return "", &HandshakeError{Reason: wsconn.ReasonHandshakeFailed, Message: fmt.Sprintf("TLS handshake failed: %v", err)}
+	}
+
+	certs := tlsConn.ConnectionState().PeerCertificates
+	if len(certs) == 0 {
+		return "", &HandshakeError{Reason: wsconn.ReasonCertificateRejected, Message: "target presented no certificate"}
+	}
+	if err := checkCertificate(&target.RDP, target.Hostname, certs); err != nil {
+		return "", &HandshakeError{Reason: wsconn.ReasonCertificateRejected, Message: err.Error()}
+	}
+
+	sum := sha256.Sum256(certs[0].Raw)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// negotiateTLS sends an X.224 Connection Request asking for TLS or NLA and
+// reads the Connection Confirm, leaving conn ready for the TLS handshake
+func negotiateTLS(conn net.Conn) error {
+	// TPKT header, X.224 Connection Request and RDP_NEG_REQ
+	req := []byte{
+		0x03, 0x00, 0x00, 0x13,
+		0x0E, 0xE0, 0x00, 0x00, 0x00, 0x00, 0x00,
+		negReq, 0x00, 0x08, 0x00, protoSSL | protoHybrid, 0x00, 0x00, 0x00,
+	}
+	if _, err := conn.Write(req); err != nil {
+		return fmt.Errorf("failed to send connection request: %w", err)
+	}
+
+	header := make([]byte, 4)
+	if _, err := io.ReadFull(conn, header); err != nil {
+		return fmt.Errorf("failed to read connection confirm: %w", err)
+	}
+	length := int(binary.BigEndian.Uint16(header[2:]))
+	if header[0] != 0x03 || length < 11 {
+		return errors.New("target did not answer with an RDP connection confirm")
+	}
+	body := make([]byte, length-4)
+	if _, err := io.ReadFull(conn, body); err != nil {
+		return fmt.Errorf("failed to read connection confirm: %w", err)
+	}
+	if body[1]&0xF0 != 0xD0 {
+		return errors.New("target did not answer with an RDP connection confirm")
+	}
+
+	neg := body[7:]
+	if len(neg) < 8 {
+		return errors.New("target only supports standard RDP security, which has no certificate")
+	}
+	switch neg[0] {
+	case negRsp:
+		if binary.LittleEndian.Uint32(neg[4:8])&(protoSSL|protoHybrid) == 0 {
+			return errors.New("target only supports standard RDP security, which has no certificate")
+		}
+		return nil
+	case negFailure:
+		return fmt.Errorf("target refused TLS (failure code %d)", binary.LittleEndian.Uint32(neg[4:8]))
+	}
+	return fmt.Errorf("unexpected negotiation response type %d", neg[0])
+}
+
+// checkCertificate verifies the target's certificate chain against the
+// settings' CA bundle and pinned fingerprint; both must match when both are set
+func checkCertificate(s *models.RDPSettings, hostname string, certs []*x509.Certificate) error {
+	leaf := certs[0]
+
+	if s.CertFingerprint != "" {
+		want, err := s.Fingerprint()
+		if err != nil {
+			return err
+		}
+		sum := sha256.Sum256(leaf.Raw)
+		if hex.EncodeToString(sum[:]) != want {
+			return errors.New("certificate does not match the pinned fingerprint")
+		}
+	}
+
+	pool, err := s.CertPool()
+	if err != nil {
+		return err
+	}
+	if pool != nil {
+		intermediates := x509.NewCertPool()
+		for _, cert := range certs[1:] {
+			intermediates.AddCert(cert)
+		}
+		opts := x509.VerifyOptions{
+			Roots:         pool,
+			Intermediates: intermediates,
+			DNSName:       hostname,
+		}
+		if _, err := leaf.Verify(opts); err != nil {
+			return fmt.Errorf("certificate is not trusted: %v", err)
+		}
+	}
+	return nil
+}
+
+// certFingerprintParam formats a SHA-256 fingerprint the way guacd's
+// cert-fingerprints parameter expects it
+func certFingerprintParam(fingerprint string) string {
+	pairs := make([]string, 0, len(fingerprint)/2)
+	for i := 0; i+1 < len(fingerprint); i += 2 {
+		pairs = append(pairs, fingerprint[i:i+2])
+	}
+	return "sha256:" + strings.Join(pairs, ":")
+}
@@ -0,0 +1,159 @@
+package rdp
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"io"
+	"math/big"
+	"net"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/VanCannon/openpam/gateway/internal/models"
+	"github.com/VanCannon/openpam/gateway/internal/wsconn"
+)
+
+// testCertificate returns a self-signed certificate for localhost
+func testCertificate(t *testing.T) (tls.Certificate, string) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "localhost"},
+		DNSNames:              []string{"localhost"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}, string(certPEM)
+}
+
+// fakeRDPServer answers the X.224 negotiation with TLS selected, then
+// completes a TLS handshake with cert
+func fakeRDPServer(t *testing.T, cert tls.Certificate) *models.Target {
+	t.Helper()
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				req := make([]byte, 19)
+				if _, err := io.ReadFull(conn, req); err != nil {
+					return
+				}
+				conn.Write([]byte{
+					0x03, 0x00, 0x00, 0x13,
+					0x0E, 0xD0, 0x00, 0x00, 0x12, 0x34, 0x00,
+					negRsp, 0x00, 0x08, 0x00, protoSSL, 0x00, 0x00, 0x00,
+				})
+				tlsConn := tls.Server(conn, &tls.Config{Certificates: []tls.Certificate{cert}})
+				tlsConn.Handshake()
+			}()
+		}
+	}()
+
+	_, port, _ := net.SplitHostPort(ln.Addr().String())
+	p, _ := strconv.Atoi(port)
+	return &models.Target{Hostname: "localhost", Port: p}
+}
+
+func TestVerifyTargetCertificate(t *testing.T) {
+	cert, certPEM := testCertificate(t)
+	other, otherPEM := testCertificate(t)
+
+	sum := sha256.Sum256(cert.Certificate[0])
+	fingerprint := hex.EncodeToString(sum[:])
+	sum = sha256.Sum256(other.Certificate[0])
+	otherFingerprint := hex.EncodeToString(sum[:])
+
+	tests := []struct {
+		name     string
+		settings models.RDPSettings
+		wantErr  bool
+	}{
+		{"trusted CA", models.RDPSettings{CACertificate: certPEM}, false},
+		{"untrusted CA", models.RDPSettings{CACertificate: otherPEM}, true},
+		{"pinned fingerprint", models.RDPSettings{CertFingerprint: "SHA256:" + fingerprint}, false},
+		{"wrong fingerprint", models.RDPSettings{CertFingerprint: otherFingerprint}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			target := fakeRDPServer(t, cert)
+			target.RDP = tt.settings
+
+			got, err := verifyTargetCertificate(context.Background(), target)
+			if tt.wantErr {
+				var hsErr *HandshakeError
+				if !errors.As(err, &hsErr) || hsErr.Reason != wsconn.ReasonCertificateRejected {
+					t.Fatalf("verifyTargetCertificate() error = %v, want a rejected certificate", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("verifyTargetCertificate() error = %v", err)
+			}
+			if got != fingerprint {
+				t.Errorf("fingerprint = %s, want %s", got, fingerprint)
+			}
+		})
+	}
+}
+
+func TestGuacdHandshakeError(t *testing.T) {
+	tests := []struct {
+		args   []string
+		reason string
+		status int
+	}{
+		{[]string{"Authentication failure", "769"}, wsconn.ReasonAuthenticationFailed, 0x0301},
+		{[]string{"Server unreachable", "519"}, wsconn.ReasonTargetUnreachable, 0x0207},
+		{[]string{"Security negotiation failed", "515"}, wsconn.ReasonHandshakeFailed, 0x0203},
+		{nil, wsconn.ReasonHandshakeFailed, 0},
+	}
+
+	for _, tt := range tests {
+		e := guacdHandshakeError(tt.args)
+		if e.Reason != tt.reason || e.Status != tt.status {
+			t.Errorf("guacdHandshakeError(%v) = %+v, want reason %s, status %d", tt.args, e, tt.reason, tt.status)
+		}
+	}
+}
+
+func TestCertFingerprintParam(t *testing.T) {
+	if got := certFingerprintParam("ab01cd"); got != "sha256:ab:01:cd" {
+		t.Errorf("certFingerprintParam() = %q", got)
+	}
+}
@@ -0,0 +1,271 @@
+package recordings
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/xml"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// azureVersion is the Blob service API version requests are made with
+const azureVersion = "2021-08-06"
+
+// Azure keeps recordings as block blobs in an Azure Blob Storage container,
+// authorized by a SAS token
+type Azure struct {
+	cfg    Config
+	base   string // URL of the container, ending in "/"
+	sas    string
+	client *http.Client
+}
+
+func newAzure(cfg Config) *Azure {
+	cfg.Prefix = dirPrefix(cfg.Prefix)
+
+	client := cfg.Client
+	if client == nil {
+		client = &http.Client{Timeout: 5 * time.Minute}
+	}
+	return &Azure{
+		cfg:    cfg,
+		base:   strings.TrimRight(cfg.Endpoint, "/") + "/" + cfg.Bucket + "/",
+		sas:    strings.TrimPrefix(cfg.SASToken, "?"),
+		client: client,
+	}
+}
+
+// Open streams the blob name
+func (a *Azure) Open(name string) (fs.File, error) {
+	if err := checkOpen("open", name); err != nil {
+		return nil, err
+	}
+	resp, err := a.do(context.Background(), http.MethodGet, a.blob(name), nil, nil, nil)
+	if err != nil {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: err}
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, statusError("open", name, resp)
+	}
+	return &object{info: objectInfoFrom(name, resp), body: resp.Body}, nil
+}
+
+// Stat describes the blob name without reading it
+func (a *Azure) Stat(name string) (fs.FileInfo, error) {
+	if err := checkOpen("stat", name); err != nil {
+		return nil, err
+	}
+	resp, err := a.do(context.Background(), http.MethodHead, a.blob(name), nil, nil, nil)
+	if err != nil {
+		return nil, &fs.PathError{Op: "stat", Path: name, Err: err}
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, statusError("stat", name, resp)
+	}
+	resp.Body.Close()
+	return objectInfoFrom(name, resp), nil
+}
+
+type enumerationResults struct {
+	Blobs []struct {
+		Name       string `xml:"Name"`
+		Properties struct {
+			ContentLength int64  `xml:"Content-Length"`
+			LastModified  string `xml:"Last-Modified"`
+		} `xml:"Properties"`
+	} `xml:"Blobs>Blob"`
+	NextMarker string `xml:"NextMarker"`
+}
+
+// ReadDir lists the blobs under the prefix
+func (a *Azure) ReadDir(name string) ([]fs.DirEntry, error) {
+	if err := checkDir(name); err != nil {
+		return nil, err
+	}
+
+	entries := []fs.DirEntry{}
+	marker := ""
+	for {
+		query := url.Values{"restype": {"container"}, "comp": {"list"}, "delimiter": {"/"}}
+		if a.cfg.Prefix != "" {
+			query.Set("prefix", a.cfg.Prefix)
+		}
+		if marker != "" {
+			query.Set("marker", marker)
+		}
+
+		resp, err := a.do(context.Background(), http.MethodGet, "", query, nil, nil)
+		if err != nil {
+			return nil, &fs.PathError{Op: "readdir", Path: name, Err: err}
+		}
+		if resp.StatusCode != http.StatusOK {
+			return nil, statusError("readdir", name, resp)
+		}
+		var result enumerationResults
+		err = xml.NewDecoder(resp.Body).Decode(&result)
+		resp.Body.Close()
+		if err != nil {
+			return nil, &fs.PathError{Op: "readdir", Path: name, Err: fmt.Errorf("failed to decode response: %w", err)}
+		}
+
+		for _, b := range result.Blobs {
+			info := &objectInfo{name: strings.TrimPrefix(b.Name, a.cfg.Prefix), size: b.Properties.ContentLength}
+			info.modTime, _ = http.ParseTime(b.Properties.LastModified)
+			entries = append(entries, info)
+		}
+		if result.NextMarker == "" {
+			return sortEntries(entries), nil
+		}
+		marker = result.NextMarker
+	}
+}
+
+// Create starts writing the blob name. Blobs smaller than a part are put in
+// one request when closed; larger ones are streamed as blocks and committed
+// when closed.
+func (a *Azure) Create(ctx context.Context, name string) (Upload, error) {
+	if err := checkOpen("create", name); err != nil {
+		return nil, err
+	}
+	u := &azureUpload{azure: a, ctx: ctx, blob: a.blob(name)}
+	u.streamer = newStreamer(a.cfg.PartSize, u.putBlock)
+	return u, nil
+}
+
+// Remove deletes the blob name
+func (a *Azure) Remove(ctx context.Context, name string) error {
+	if err := checkOpen("remove", name); err != nil {
+		return err
+	}
+	resp, err := a.do(ctx, http.MethodDelete, a.blob(name), nil, nil, nil)
+	if err != nil {
+		return &fs.PathError{Op: "remove", Path: name, Err: err}
+	}
+	if resp.StatusCode != http.StatusAccepted {
+		return statusError("remove", name, resp)
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// Location is the URL of the blob name, without the SAS token
+func (a *Azure) Location(name string) string {
+	return a.base + a.cfg.Prefix + name
+}
+
+// blob is the escaped path of the blob name in the container
+func (a *Azure) blob(name string) string {
+	segments := strings.Split(a.cfg.Prefix+name, "/")
+	for i, segment := range segments {
+		segments[i] = url.PathEscape(segment)
+	}
+	return strings.Join(segments, "/")
+}
+
+// do sends a request for blob, relative to the container, with the SAS token
+// added to query
+func (a *Azure) do(ctx context.Context, method, blob string, query url.Values, body []byte, header http.Header) (*http.Response, error) {
+	rawQuery := a.sas
+	if len(query) > 0 {
+		rawQuery = query.Encode() + "&" + a.sas
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, a.base+blob+"?"+rawQuery, bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("failed to build request: %w", err)
+	}
+	for name, values := range header {
+		req.Header[name] = values
+	}
+	req.Header.Set("x-ms-version", azureVersion)
+
+	return a.client.Do(req)
+}
+
+// azureUpload writes a block blob, streaming it as blocks once it outgrows a
+// part. Blocks that are never committed are discarded by Azure.
+type azureUpload struct {
+	*streamer
+	azure  *Azure
+	ctx    context.Context
+	blob   string
+	blocks []string
+}
+
+// blockID is the ID of the nth block; all IDs of a blob must be the same length
+func blockID(n int) string {
+	return base64.StdEncoding.EncodeToString([]byte(fmt.Sprintf("block-%08d", n)))
+}
+
+// putBlock uploads a block, uncommitted until the upload is closed
+func (u *azureUpload) putBlock(part int, data []byte) error {
+	id := blockID(part)
+	query := url.Values{"comp": {"block"}, "blockid": {id}}
+	resp, err := u.azure.do(u.ctx, http.MethodPut, u.blob, query, data, nil)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusCreated {
+		return statusError("put", u.blob, resp)
+	}
+	resp.Body.Close()
+	u.blocks = append(u.blocks, id)
+	return nil
+}
+
+// Close uploads what is left and commits the blocks
+func (u *azureUpload) Close() error {
+	sent, rest, err := u.finish()
+	if err != nil {
+		return err
+	}
+
+	if sent == 0 {
+		header := http.Header{"X-Ms-Blob-Type": {"BlockBlob"}}
+		resp, err := u.azure.do(u.ctx, http.MethodPut, u.blob, nil, rest, header)
+		if err != nil {
+			return err
+		}
+		if resp.StatusCode != http.StatusCreated {
+			return statusError("put", u.blob, resp)
+		}
+		resp.Body.Close()
+		return nil
+	}
+
+	if len(rest) > 0 {
+		if err := u.putBlock(sent+1, rest); err != nil {
+			return fmt.Errorf("failed to upload part %d: %w", sent+1, err)
+		}
+	}
+
+	list := struct {
+		XMLName xml.Name `xml:"BlockList"`
+		Latest  []string `xml:"Latest"`
+	}{Latest: u.blocks}
+	body, err := xml.Marshal(list)
+	if err != nil {
+		return fmt.Errorf("failed to encode block list: %w", err)
+	}
+	resp, err := u.azure.do(u.ctx, http.MethodPut, u.blob, url.Values{"comp": {"blocklist"}}, append([]byte(xml.Header), body...), nil)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusCreated {
+		return statusError("put", u.blob, resp)
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// Abort gives up on the blob; its uncommitted blocks are left for Azure to
+// discard
+func (u *azureUpload) Abort() error {
+	_, _, err := u.finish()
+	return err
+}
@@ -0,0 +1,275 @@
+// Package recordings stores session recordings and keeps their catalog: where
+// each one is stored, its format, size, duration and checksum.
+package recordings
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"io/fs"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/VanCannon/openpam/gateway/internal/models"
+	"github.com/VanCannon/openpam/pkg/logger"
+	"github.com/google/uuid"
+)
+
+// Store is where catalog entries are kept
+type Store interface {
+	Upsert(ctx context.Context, rec *models.Recording) error
+}
+
+// ErrNotRecording is returned for files that aren't named like a recording
+var ErrNotRecording = errors.New("not a session recording")
+
+// Recorders name files SESSION-YYYYMMDD-HHMMSS.EXT, in local time
+var namePattern = regexp.MustCompile(`^([0-9a-f-]{36})-(\d{8}-\d{6})\.(log|guac)$`)
+
+// tailSize is how much of the end of a file is read to find its duration
+const tailSize = 64 * 1024
+
+// Describe builds the catalog entry of the recording name in fsys, catalogued
+// at location
+func Describe(fsys fs.FS, name, location string) (*models.Recording, error) {
+	if _, _, _, err := parseName(name); err != nil {
+		return nil, err
+	}
+
+	f, err := fsys.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	d := newDigest()
+	if _, err := io.Copy(d, f); err != nil {
+		return nil, fmt.Errorf("failed to read recording: %w", err)
+	}
+	return d.entry(name, location)
+}
+
+// parseName reads the session, start and format of a recording from its name
+func parseName(name string) (uuid.UUID, time.Time, string, error) {
+	m := namePattern.FindStringSubmatch(name)
+	if m == nil {
+		return uuid.Nil, time.Time{}, "", ErrNotRecording
+	}
+	sessionID, err := uuid.Parse(m[1])
+	if err != nil {
+		return uuid.Nil, time.Time{}, "", ErrNotRecording
+	}
+	startedAt, err := time.ParseInLocation("20060102-150405", m[2], time.Local)
+	if err != nil {
+		return uuid.Nil, time.Time{}, "", ErrNotRecording
+	}
+	format := models.RecordingFormatSSH
+	if m[3] == "guac" {
+		format = models.RecordingFormatGuacamole
+	}
+	return sessionID, startedAt, format, nil
+}
+
+// digest hashes and counts what is written to it and keeps the end of it
+type digest struct {
+	hash hash.Hash
+	size int64
+	tail []byte
+}
+
+func newDigest() *digest {
+	return &digest{hash: sha256.New()}
+}
+
+func (d *digest) Write(p []byte) (int, error) {
+	d.hash.Write(p)
+	d.size += int64(len(p))
+	d.tail = append(d.tail, p...)
+	if len(d.tail) > 2*tailSize {
+		d.tail = append(d.tail[:0], d.tail[len(d.tail)-tailSize:]...)
+	}
+	return len(p), nil
+}
+
+// entry builds the catalog entry of the recording name from what was written
+func (d *digest) entry(name, location string) (*models.Recording, error) {
+	sessionID, startedAt, format, err := parseName(name)
+	if err != nil {
+		return nil, err
+	}
+
+	tail := d.tail
+	if len(tail) > tailSize {
+		tail = tail[len(tail)-tailSize:]
+	}
+	return &models.Recording{
+		SessionID:  sessionID,
+		Location:   location,
+		Format:     format,
+		Size:       d.size,
+		DurationMs: duration(format, tail),
+		SHA256:     hex.EncodeToString(d.hash.Sum(nil)),
+		StartedAt:  startedAt,
+	}, nil
+}
+
+// File is a recording being written to storage. It keeps the checksum, size
+// and end of what is written, so it is catalogued without being read back.
+type File struct {
+	name     string
+	location string
+	upload   Upload
+	digest   *digest
+}
+
+// Create starts writing the recording name to storage
+func Create(ctx context.Context, storage Storage, name string) (*File, error) {
+	upload, err := storage.Create(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	return &File{
+		name:     name,
+		location: storage.Location(name),
+		upload:   upload,
+		digest:   newDigest(),
+	}, nil
+}
+
+// Name is the name of the recording in storage
+func (f *File) Name() string {
+	return f.name
+}
+
+// Location is where the catalog finds the recording
+func (f *File) Location() string {
+	return f.location
+}
+
+func (f *File) Write(p []byte) (int, error) {
+	n, err := f.upload.Write(p)
+	f.digest.Write(p[:n])
+	return n, err
+}
+
+// WriteString writes s to the recording
+func (f *File) WriteString(s string) (int, error) {
+	return f.Write([]byte(s))
+}
+
+// Close completes the recording
+func (f *File) Close() error {
+	return f.upload.Close()
+}
+
+// Describe builds the catalog entry of what was written
+func (f *File) Describe() (*models.Recording, error) {
+	return f.digest.entry(f.name, f.location)
+}
+
+// duration reads a recording's length from the end of it: the footer of SSH
+// recordings, and the timestamp of the last instruction of Guacamole ones.
+// Recordings cut short have no footer and get 0.
+func duration(format string, tail []byte) int64 {
+	lines := bytes.Split(bytes.TrimRight(tail, "\n"), []byte("\n"))
+
+	for i := len(lines) - 1; i >= 0; i-- {
+		line := string(lines[i])
+		switch format {
+		case models.RecordingFormatSSH:
+			if s, ok := strings.CutPrefix(line, "Duration: "); ok {
+				if d, err := time.ParseDuration(s); err == nil {
+					return d.Milliseconds()
+				}
+			}
+		case models.RecordingFormatGuacamole:
+			if ts, _, ok := strings.Cut(line, ","); ok {
+				if ms, err := strconv.ParseInt(ts, 10, 64); err == nil {
+					return ms
+				}
+			}
+		}
+	}
+	return 0
+}
+
+// Catalog adds finished recordings to the store
+type Catalog struct {
+	store  Store
+	logger *logger.Logger
+}
+
+// NewCatalog creates a new recordings catalog
+func NewCatalog(store Store, log *logger.Logger) *Catalog {
+	return &Catalog{
+		store:  store,
+		logger: log,
+	}
+}
+
+// Add catalogs the finished recording f. Failures are logged; the recording
+// is kept either way and can be catalogued by a backfill.
+func (c *Catalog) Add(f *File) {
+	rec, err := f.Describe()
+	if err == nil {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		err = c.store.Upsert(ctx, rec)
+	}
+	if err != nil {
+		c.logger.Error("Failed to catalog recording", map[string]interface{}{
+			"location": f.Location(),
+			"error":    err.Error(),
+		})
+	}
+}
+
+// BackfillResult counts the files a backfill went through
+type BackfillResult struct {
+	Catalogued int
+	Skipped    int      // Files that aren't recordings, such as timing files
+	Failed     []string // Recordings that couldn't be catalogued, with the error
+}
+
+// Backfill catalogs the recordings in storage. Entries already in the catalog
+// are refreshed, so it can be run again safely.
+func Backfill(ctx context.Context, storage Storage, store Store) (*BackfillResult, error) {
+	entries, err := storage.ReadDir(".")
+	if err != nil {
+		return nil, fmt.Errorf("failed to list recordings: %w", err)
+	}
+
+	result := &BackfillResult{}
+	for _, entry := range entries {
+		if err := ctx.Err(); err != nil {
+			return result, err
+		}
+		if entry.IsDir() {
+			continue
+		}
+
+		location := storage.Location(entry.Name())
+		rec, err := Describe(storage, entry.Name(), location)
+		if errors.Is(err, ErrNotRecording) {
+			result.Skipped++
+			continue
+		}
+		if err == nil {
+			err = store.Upsert(ctx, rec)
+		}
+		if err != nil {
+			result.Failed = append(result.Failed, fmt.Sprintf("%s: %v", location, err))
+			continue
+		}
+		result.Catalogued++
+	}
+
+	return result, nil
+}
@@ -0,0 +1,170 @@
+package recordings
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/VanCannon/openpam/gateway/internal/models"
+	"github.com/VanCannon/openpam/pkg/logger"
+)
+
+const sessionID = "0b6f1c1e-9a57-4c3b-8d0e-2f4a5b6c7d8e"
+
+type fakeStore struct {
+	recs map[string]*models.Recording
+	err  error
+}
+
+func (s *fakeStore) Upsert(ctx context.Context, rec *models.Recording) error {
+	if s.err != nil {
+		return s.err
+	}
+	s.recs[rec.Location] = rec
+	return nil
+}
+
+func writeFile(t *testing.T, dir, name, content string) string {
+	t.Helper()
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestDescribe(t *testing.T) {
+	dir := t.TempDir()
+	describe := func(path string) (*models.Recording, error) {
+		return Describe(os.DirFS(dir), filepath.Base(path), path)
+	}
+
+	ssh := "=== SSH Session Recording ===\n$ ls\n\n=============================\nEnd Time: 2026-01-02T03:05:06Z\nDuration: 1m2.5s\n=============================\n"
+	path := writeFile(t, dir, sessionID+"-20260102-030405.log", ssh)
+
+	rec, err := describe(path)
+	if err != nil {
+		t.Fatalf("Describe() error = %v", err)
+	}
+	sum := sha256.Sum256([]byte(ssh))
+	want := time.Date(2026, 1, 2, 3, 4, 5, 0, time.Local)
+	if rec.SessionID.String() != sessionID || rec.Format != models.RecordingFormatSSH || rec.Size != int64(len(ssh)) ||
+		rec.SHA256 != hex.EncodeToString(sum[:]) || rec.DurationMs != 62500 || !rec.StartedAt.Equal(want) {
+		t.Errorf("SSH recording = %+v", rec)
+	}
+
+	guac := "0,4.size,1.0,4.1024,3.768;\n120,5.mouse,3.100,3.100;\n5120,3.key,2.65,1.1;\n"
+	path = writeFile(t, dir, sessionID+"-20260102-030405.guac", guac)
+
+	rec, err = describe(path)
+	if err != nil {
+		t.Fatalf("Describe() error = %v", err)
+	}
+	if rec.Format != models.RecordingFormatGuacamole || rec.DurationMs != 5120 {
+		t.Errorf("Guacamole recording = %+v", rec)
+	}
+
+	// A recording cut short has no footer
+	path = writeFile(t, dir, sessionID+"-20260102-040405.log", "=== SSH Session Recording ===\n$ ls\n")
+	if rec, err := describe(path); err != nil || rec.DurationMs != 0 {
+		t.Errorf("Describe() = %+v, %v, want no duration", rec, err)
+	}
+
+	for _, name := range []string{sessionID + "-20260102-030405.timing", "flight-recorder.json", "not-a-uuid-20260102-030405.log"} {
+		if _, err := describe(filepath.Join(dir, name)); !errors.Is(err, ErrNotRecording) {
+			t.Errorf("Describe(%s) error = %v, want ErrNotRecording", name, err)
+		}
+	}
+}
+
+func TestBackfill(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, dir, sessionID+"-20260102-030405.log", "$ ls\n")
+	writeFile(t, dir, sessionID+"-20260102-030405.timing", "0 5\n")
+	writeFile(t, dir, sessionID+"-20260102-040405.guac", "0,4.sync,1.0;\n")
+	os.Mkdir(filepath.Join(dir, "exports"), 0750)
+	storage, err := NewLocal(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	store := &fakeStore{recs: map[string]*models.Recording{}}
+	result, err := Backfill(context.Background(), storage, store)
+	if err != nil {
+		t.Fatalf("Backfill() error = %v", err)
+	}
+	if result.Catalogued != 2 || result.Skipped != 1 || len(result.Failed) != 0 || len(store.recs) != 2 {
+		t.Errorf("result = %+v, catalogued %d", result, len(store.recs))
+	}
+
+	// Running it again refreshes the same entries
+	if result, err = Backfill(context.Background(), storage, store); err != nil || result.Catalogued != 2 || len(store.recs) != 2 {
+		t.Errorf("second Backfill() = %+v, %v", result, err)
+	}
+
+	store.err = errors.New("database unavailable")
+	if result, err = Backfill(context.Background(), storage, store); err != nil || len(result.Failed) != 2 {
+		t.Errorf("Backfill() with a failing store = %+v, %v", result, err)
+	}
+}
+
+func TestCatalog_Add(t *testing.T) {
+	storage, err := NewLocal(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	f, err := Create(context.Background(), storage, sessionID+"-20260102-030405.guac")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.WriteString("0,4.sync,1.0;\n")
+	if err := f.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	store := &fakeStore{recs: map[string]*models.Recording{}}
+	NewCatalog(store, logger.New(logger.LevelError, io.Discard)).Add(f)
+
+	rec := store.recs[f.Location()]
+	if rec == nil || rec.Format != models.RecordingFormatGuacamole || rec.Size != 14 || rec.DurationMs != 0 {
+		t.Errorf("catalog = %+v", store.recs)
+	}
+}
+
+func TestFile_LongRecording(t *testing.T) {
+	storage, err := NewLocal(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	f, err := Create(context.Background(), storage, sessionID+"-20260102-030405.log")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The footer is found at the end of recordings far longer than the tail kept
+	line := strings.Repeat("x", 1000) + "\n"
+	for i := 0; i < 500; i++ {
+		f.WriteString(line)
+	}
+	f.WriteString("Duration: 2s\n")
+	f.Close()
+
+	written, err := f.Describe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	read, err := Describe(storage, f.Name(), f.Location())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if written.DurationMs != 2000 || *written != *read {
+		t.Errorf("written %+v, read back %+v", written, read)
+	}
+}
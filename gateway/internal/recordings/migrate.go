@@ -0,0 +1,104 @@
+package recordings
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+)
+
+// Relocator moves catalog entries to where their recordings were copied
+type Relocator interface {
+	Relocate(ctx context.Context, from, to string) error
+}
+
+// MigrateResult counts the files a migration went through
+type MigrateResult struct {
+	Copied  int
+	Skipped int      // Files already in the destination, with the same size
+	Removed int      // Originals removed after they were copied
+	Failed  []string // Files that couldn't be copied or relocated, with the error
+}
+
+// Migrate copies the recordings and timing files in from to to and points
+// the catalog entries of the recordings at the copies. Files already copied
+// are skipped, so it can be run again safely. With remove, originals are
+// removed once their copy is complete and catalogued.
+func Migrate(ctx context.Context, from, to Storage, catalog Relocator, remove bool) (*MigrateResult, error) {
+	entries, err := from.ReadDir(".")
+	if err != nil {
+		return nil, fmt.Errorf("failed to list recordings: %w", err)
+	}
+
+	result := &MigrateResult{}
+	for _, entry := range entries {
+		if err := ctx.Err(); err != nil {
+			return result, err
+		}
+		if entry.IsDir() {
+			continue
+		}
+		name := entry.Name()
+
+		copied, err := migrateFile(ctx, from, to, name)
+		if err == nil {
+			// Entries already relocated by an earlier run are left alone
+			if _, _, _, nameErr := parseName(name); nameErr == nil {
+				err = catalog.Relocate(ctx, from.Location(name), to.Location(name))
+			}
+		}
+		if err != nil {
+			result.Failed = append(result.Failed, fmt.Sprintf("%s: %v", from.Location(name), err))
+			continue
+		}
+		if copied {
+			result.Copied++
+		} else {
+			result.Skipped++
+		}
+
+		if remove {
+			if err := from.Remove(ctx, name); err != nil {
+				result.Failed = append(result.Failed, fmt.Sprintf("%s: failed to remove original: %v", from.Location(name), err))
+				continue
+			}
+			result.Removed++
+		}
+	}
+
+	return result, nil
+}
+
+// migrateFile copies name unless to already has a file of the same size. It
+// reports whether it copied.
+func migrateFile(ctx context.Context, from, to Storage, name string) (bool, error) {
+	src, err := from.Open(name)
+	if err != nil {
+		return false, err
+	}
+	defer src.Close()
+
+	info, err := src.Stat()
+	if err != nil {
+		return false, err
+	}
+	if existing, err := fs.Stat(to, name); err == nil && existing.Size() == info.Size() {
+		return false, nil
+	} else if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return false, err
+	}
+
+	dst, err := to.Create(ctx, name)
+	if err != nil {
+		return false, err
+	}
+	if _, err := io.Copy(dst, src); err != nil {
+		dst.Abort()
+		return false, fmt.Errorf("failed to copy: %w", err)
+	}
+	if err := dst.Close(); err != nil {
+		return false, fmt.Errorf("failed to complete copy: %w", err)
+	}
+	return true, nil
+}
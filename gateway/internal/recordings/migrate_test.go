@@ -0,0 +1,51 @@
+package recordings
+
+import (
+	"context"
+	"io/fs"
+	"testing"
+)
+
+type fakeRelocator struct {
+	moved map[string]string
+}
+
+func (r *fakeRelocator) Relocate(ctx context.Context, from, to string) error {
+	r.moved[from] = to
+	return nil
+}
+
+func TestMigrate(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, dir, sessionID+"-20260102-030405.log", "$ ls\n")
+	writeFile(t, dir, sessionID+"-20260102-030405.timing", "0 5\n")
+	from, err := NewLocal(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fake := newFakeS3()
+	to := newTestS3(t, fake)
+	catalog := &fakeRelocator{moved: map[string]string{}}
+
+	result, err := Migrate(context.Background(), from, to, catalog, false)
+	if err != nil {
+		t.Fatalf("Migrate() error = %v", err)
+	}
+	if result.Copied != 2 || len(result.Failed) != 0 || len(fake.objects) != 2 {
+		t.Errorf("result = %+v, objects %d", result, len(fake.objects))
+	}
+	name := sessionID + "-20260102-030405.log"
+	if catalog.moved[from.Location(name)] != to.Location(name) || len(catalog.moved) != 1 {
+		t.Errorf("relocated %v, want only the recording moved", catalog.moved)
+	}
+
+	// Running it again skips what was copied; removing leaves nothing behind
+	result, err = Migrate(context.Background(), from, to, catalog, true)
+	if err != nil || result.Skipped != 2 || result.Removed != 2 {
+		t.Errorf("second Migrate() = %+v, %v", result, err)
+	}
+	if entries, _ := fs.ReadDir(from, "."); len(entries) != 0 {
+		t.Errorf("originals left: %v", entries)
+	}
+}
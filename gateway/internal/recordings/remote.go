@@ -0,0 +1,151 @@
+package recordings
+
+import (
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+)
+
+// streamer cuts what is written into parts and hands them, in order, to put
+// in the background, so sessions don't wait on the network while recording.
+// A couple of parts may be queued; past that, writes wait for uploads to
+// catch up.
+type streamer struct {
+	size  int
+	buf   []byte
+	put   func(part int, data []byte) error
+	queue chan []byte
+	done  chan struct{}
+	sent  int   // Parts handed to put
+	err   error // First failure of put, read once done is closed
+	ended bool
+}
+
+func newStreamer(size int, put func(part int, data []byte) error) *streamer {
+	return &streamer{size: size, put: put}
+}
+
+// Write buffers p and queues every full part
+func (s *streamer) Write(p []byte) (int, error) {
+	s.buf = append(s.buf, p...)
+	for len(s.buf) >= s.size {
+		part := make([]byte, s.size)
+		copy(part, s.buf)
+		s.buf = append(s.buf[:0], s.buf[s.size:]...)
+
+		if s.sent == 0 {
+			s.queue = make(chan []byte, 2)
+			s.done = make(chan struct{})
+			go s.run()
+		}
+		s.sent++
+		s.queue <- part
+	}
+	return len(p), nil
+}
+
+func (s *streamer) run() {
+	defer close(s.done)
+	part := 1
+	for data := range s.queue {
+		if s.err == nil {
+			if err := s.put(part, data); err != nil {
+				s.err = fmt.Errorf("failed to upload part %d: %w", part, err)
+			}
+		}
+		part++
+	}
+}
+
+// finish waits for the queued parts to be uploaded. It returns how many were
+// and what is left to upload.
+func (s *streamer) finish() (sent int, rest []byte, err error) {
+	if s.sent > 0 && !s.ended {
+		close(s.queue)
+		<-s.done
+	}
+	s.ended = true
+	return s.sent, s.buf, s.err
+}
+
+// objectInfo describes an object; it is both its fs.FileInfo and its fs.DirEntry
+type objectInfo struct {
+	name    string
+	size    int64
+	modTime time.Time
+}
+
+func (o *objectInfo) Name() string               { return o.name }
+func (o *objectInfo) Size() int64                { return o.size }
+func (o *objectInfo) Mode() fs.FileMode          { return 0444 }
+func (o *objectInfo) ModTime() time.Time         { return o.modTime }
+func (o *objectInfo) IsDir() bool                { return false }
+func (o *objectInfo) Sys() any                   { return nil }
+func (o *objectInfo) Type() fs.FileMode          { return 0 }
+func (o *objectInfo) Info() (fs.FileInfo, error) { return o, nil }
+
+// objectInfoFrom reads an object's size and modification time from the
+// headers of a GET or HEAD
+func objectInfoFrom(name string, resp *http.Response) *objectInfo {
+	info := &objectInfo{name: name, size: resp.ContentLength}
+	if t, err := http.ParseTime(resp.Header.Get("Last-Modified")); err == nil {
+		info.modTime = t
+	}
+	return info
+}
+
+// object is an object opened for reading, streamed from the response body
+type object struct {
+	info *objectInfo
+	body io.ReadCloser
+}
+
+func (o *object) Stat() (fs.FileInfo, error) { return o.info, nil }
+func (o *object) Read(p []byte) (int, error) { return o.body.Read(p) }
+func (o *object) Close() error               { return o.body.Close() }
+
+// statusError turns an unexpected response into an error, mapping 404 to
+// fs.ErrNotExist. It closes the body.
+func statusError(op, name string, resp *http.Response) error {
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return &fs.PathError{Op: op, Path: name, Err: fs.ErrNotExist}
+	}
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+	return &fs.PathError{Op: op, Path: name, Err: fmt.Errorf("storage returned status %d: %s", resp.StatusCode, body)}
+}
+
+// sortEntries sorts listed objects by name, as fs.ReadDir does
+func sortEntries(entries []fs.DirEntry) []fs.DirEntry {
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Name() < entries[j].Name() })
+	return entries
+}
+
+// dirPrefix makes a prefix of object names end in "/"
+func dirPrefix(prefix string) string {
+	prefix = strings.Trim(prefix, "/")
+	if prefix == "" {
+		return ""
+	}
+	return prefix + "/"
+}
+
+// checkOpen validates the name of a recording to read
+func checkOpen(op, name string) error {
+	if !validName(name) {
+		return &fs.PathError{Op: op, Path: name, Err: fs.ErrInvalid}
+	}
+	return nil
+}
+
+// checkDir validates the directory of a listing: recordings are all at the top
+func checkDir(name string) error {
+	if name != "." {
+		return &fs.PathError{Op: "readdir", Path: name, Err: fs.ErrNotExist}
+	}
+	return nil
+}
@@ -0,0 +1,313 @@
+package recordings
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/VanCannon/openpam/gateway/internal/awssig"
+)
+
+// S3 keeps recordings as objects in a bucket of S3 or a store speaking its
+// API: MinIO, or Google Cloud Storage through its XML API
+type S3 struct {
+	cfg    Config
+	base   string // URL of the bucket, ending in "/"
+	client *http.Client
+}
+
+func newS3(cfg Config) *S3 {
+	endpoint := strings.TrimRight(cfg.Endpoint, "/")
+	if cfg.Backend == BackendGCS {
+		if endpoint == "" {
+			endpoint = "https://storage.googleapis.com"
+		}
+		if cfg.Region == "" {
+			cfg.Region = "auto"
+		}
+	}
+	if cfg.Region == "" {
+		cfg.Region = "us-east-1"
+	}
+	cfg.Prefix = dirPrefix(cfg.Prefix)
+
+	// AWS buckets are addressed by host; other stores by path
+	base := endpoint + "/" + cfg.Bucket + "/"
+	if endpoint == "" {
+		base = "https://" + cfg.Bucket + ".s3." + cfg.Region + ".amazonaws.com/"
+	}
+
+	client := cfg.Client
+	if client == nil {
+		client = &http.Client{Timeout: 5 * time.Minute}
+	}
+	return &S3{cfg: cfg, base: base, client: client}
+}
+
+// Open streams the object name
+func (s *S3) Open(name string) (fs.File, error) {
+	if err := checkOpen("open", name); err != nil {
+		return nil, err
+	}
+	resp, err := s.do(context.Background(), http.MethodGet, s.key(name), nil)
+	if err != nil {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: err}
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, statusError("open", name, resp)
+	}
+	return &object{info: objectInfoFrom(name, resp), body: resp.Body}, nil
+}
+
+// Stat describes the object name without reading it
+func (s *S3) Stat(name string) (fs.FileInfo, error) {
+	if err := checkOpen("stat", name); err != nil {
+		return nil, err
+	}
+	resp, err := s.do(context.Background(), http.MethodHead, s.key(name), nil)
+	if err != nil {
+		return nil, &fs.PathError{Op: "stat", Path: name, Err: err}
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, statusError("stat", name, resp)
+	}
+	resp.Body.Close()
+	return objectInfoFrom(name, resp), nil
+}
+
+type listBucketResult struct {
+	Contents []struct {
+		Key          string `xml:"Key"`
+		Size         int64  `xml:"Size"`
+		LastModified string `xml:"LastModified"`
+	} `xml:"Contents"`
+	IsTruncated           bool   `xml:"IsTruncated"`
+	NextContinuationToken string `xml:"NextContinuationToken"`
+}
+
+// ReadDir lists the objects under the prefix
+func (s *S3) ReadDir(name string) ([]fs.DirEntry, error) {
+	if err := checkDir(name); err != nil {
+		return nil, err
+	}
+
+	entries := []fs.DirEntry{}
+	token := ""
+	for {
+		query := url.Values{"list-type": {"2"}, "delimiter": {"/"}}
+		if s.cfg.Prefix != "" {
+			query.Set("prefix", s.cfg.Prefix)
+		}
+		if token != "" {
+			query.Set("continuation-token", token)
+		}
+
+		var result listBucketResult
+		if err := s.call(context.Background(), http.MethodGet, "?"+query.Encode(), nil, &result); err != nil {
+			return nil, &fs.PathError{Op: "readdir", Path: name, Err: err}
+		}
+		for _, c := range result.Contents {
+			info := &objectInfo{name: strings.TrimPrefix(c.Key, s.cfg.Prefix), size: c.Size}
+			info.modTime, _ = time.Parse(time.RFC3339, c.LastModified)
+			entries = append(entries, info)
+		}
+		if !result.IsTruncated || result.NextContinuationToken == "" {
+			return sortEntries(entries), nil
+		}
+		token = result.NextContinuationToken
+	}
+}
+
+// Create starts writing the object name. Objects smaller than a part are put
+// in one request when closed; larger ones are streamed as a multipart upload.
+func (s *S3) Create(ctx context.Context, name string) (Upload, error) {
+	if err := checkOpen("create", name); err != nil {
+		return nil, err
+	}
+	u := &s3Upload{s3: s, ctx: ctx, key: s.key(name)}
+	u.streamer = newStreamer(s.cfg.PartSize, u.putPart)
+	return u, nil
+}
+
+// Remove deletes the object name
+func (s *S3) Remove(ctx context.Context, name string) error {
+	if err := checkOpen("remove", name); err != nil {
+		return err
+	}
+	resp, err := s.do(ctx, http.MethodDelete, s.key(name), nil)
+	if err != nil {
+		return &fs.PathError{Op: "remove", Path: name, Err: err}
+	}
+	if resp.StatusCode != http.StatusNoContent && resp.StatusCode != http.StatusOK {
+		return statusError("remove", name, resp)
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// Location is the s3:// or gs:// URL of the object name
+func (s *S3) Location(name string) string {
+	scheme := "s3"
+	if s.cfg.Backend == BackendGCS {
+		scheme = "gs"
+	}
+	return scheme + "://" + s.cfg.Bucket + "/" + s.cfg.Prefix + name
+}
+
+// key is the escaped key of the object name
+func (s *S3) key(name string) string {
+	segments := strings.Split(s.cfg.Prefix+name, "/")
+	for i, segment := range segments {
+		segments[i] = url.PathEscape(segment)
+	}
+	return strings.Join(segments, "/")
+}
+
+// do sends a signed request for ref, an object key with an optional query,
+// relative to the bucket
+func (s *S3) do(ctx context.Context, method, ref string, body []byte) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, s.base+ref, bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("failed to build request: %w", err)
+	}
+	req.Header.Set("X-Amz-Content-Sha256", awssig.PayloadHash(body))
+	awssig.Sign(req, body, s.cfg.AccessKey, s.cfg.SecretKey, s.cfg.Region, "s3", time.Now())
+
+	return s.client.Do(req)
+}
+
+// call sends a request expecting 200 and decodes the XML response into out
+func (s *S3) call(ctx context.Context, method, ref string, body []byte, out interface{}) error {
+	resp, err := s.do(ctx, method, ref, body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return statusError(strings.ToLower(method), ref, resp)
+	}
+	defer resp.Body.Close()
+
+	if out == nil {
+		return nil
+	}
+	if err := xml.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("failed to decode response: %w", err)
+	}
+	return nil
+}
+
+// s3Upload writes an object, streaming it as a multipart upload once it
+// outgrows a part
+type s3Upload struct {
+	*streamer
+	s3       *S3
+	ctx      context.Context
+	key      string
+	uploadID string
+	etags    []string
+}
+
+type completedPart struct {
+	PartNumber int    `xml:"PartNumber"`
+	ETag       string `xml:"ETag"`
+}
+
+// putPart uploads a part, starting the multipart upload with the first one
+func (u *s3Upload) putPart(part int, data []byte) error {
+	if u.uploadID == "" {
+		var result struct {
+			UploadID string `xml:"UploadId"`
+		}
+		if err := u.s3.call(u.ctx, http.MethodPost, u.key+"?uploads", nil, &result); err != nil {
+			return fmt.Errorf("failed to start multipart upload: %w", err)
+		}
+		u.uploadID = result.UploadID
+	}
+
+	query := url.Values{"partNumber": {strconv.Itoa(part)}, "uploadId": {u.uploadID}}
+	resp, err := u.s3.do(u.ctx, http.MethodPut, u.key+"?"+query.Encode(), data)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return statusError("put", u.key, resp)
+	}
+	resp.Body.Close()
+	u.etags = append(u.etags, resp.Header.Get("ETag"))
+	return nil
+}
+
+// Close uploads what is left and completes the object
+func (u *s3Upload) Close() error {
+	sent, rest, err := u.finish()
+	if err != nil {
+		u.abort()
+		return err
+	}
+
+	if sent == 0 {
+		resp, err := u.s3.do(u.ctx, http.MethodPut, u.key, rest)
+		if err != nil {
+			return err
+		}
+		if resp.StatusCode != http.StatusOK {
+			return statusError("put", u.key, resp)
+		}
+		resp.Body.Close()
+		return nil
+	}
+
+	if len(rest) > 0 {
+		if err := u.putPart(sent+1, rest); err != nil {
+			u.abort()
+			return fmt.Errorf("failed to upload part %d: %w", sent+1, err)
+		}
+	}
+
+	complete := struct {
+		XMLName xml.Name        `xml:"CompleteMultipartUpload"`
+		Parts   []completedPart `xml:"Part"`
+	}{}
+	for i, etag := range u.etags {
+		complete.Parts = append(complete.Parts, completedPart{PartNumber: i + 1, ETag: etag})
+	}
+	body, err := xml.Marshal(complete)
+	if err != nil {
+		return fmt.Errorf("failed to encode parts: %w", err)
+	}
+	if err := u.s3.call(u.ctx, http.MethodPost, u.key+"?"+url.Values{"uploadId": {u.uploadID}}.Encode(), body, nil); err != nil {
+		u.abort()
+		return fmt.Errorf("failed to complete multipart upload: %w", err)
+	}
+	return nil
+}
+
+// Abort gives up on the object, discarding the parts already uploaded
+func (u *s3Upload) Abort() error {
+	if _, _, err := u.finish(); err != nil {
+		u.abort()
+		return err
+	}
+	return u.abort()
+}
+
+func (u *s3Upload) abort() error {
+	if u.uploadID == "" {
+		return nil
+	}
+	resp, err := u.s3.do(context.Background(), http.MethodDelete, u.key+"?"+url.Values{"uploadId": {u.uploadID}}.Encode(), nil)
+	if err != nil {
+		return err
+	}
+	io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+	return nil
+}
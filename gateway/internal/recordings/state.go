@@ -0,0 +1,85 @@
+package recordings
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/VanCannon/openpam/gateway/internal/models"
+)
+
+var (
+	// ErrNotRecorded refuses a session that must be recorded when its
+	// recording can't be started
+	ErrNotRecorded = errors.New("session recording could not be started")
+
+	// ErrUnavailable is why sessions aren't recorded when the recording
+	// storage couldn't be opened
+	ErrUnavailable = errors.New("recording storage is unavailable")
+)
+
+type stateKey struct{}
+
+// State is what the proxies reported about a session's recording
+type State struct {
+	required bool
+
+	mu     sync.Mutex
+	state  string
+	reason string
+}
+
+// Track returns a context the proxies report a session's recording on, and
+// the State they report to. recorded tells whether the session's settings
+// record it; required sessions are refused when their recording fails.
+func Track(ctx context.Context, recorded, required bool) (context.Context, *State) {
+	s := &State{required: required, state: models.RecordingStateNotStarted}
+	if !recorded {
+		s.state = models.RecordingStateDisabled
+	}
+	return context.WithValue(ctx, stateKey{}, s), s
+}
+
+// Started records that the recording of the session in ctx started
+func Started(ctx context.Context) {
+	if s, ok := ctx.Value(stateKey{}).(*State); ok {
+		s.mu.Lock()
+		s.state = models.RecordingStateStarted
+		s.mu.Unlock()
+	}
+}
+
+// Failed records that the recording of the session in ctx failed with err. It
+// returns ErrNotRecorded, wrapping err, when the session must be recorded and
+// should be refused, and nil when it may go on without a recording.
+func Failed(ctx context.Context, err error) error {
+	s, ok := ctx.Value(stateKey{}).(*State)
+	if !ok {
+		return nil
+	}
+
+	s.mu.Lock()
+	s.state = models.RecordingStateFailed
+	s.reason = err.Error()
+	s.mu.Unlock()
+
+	if s.required {
+		return fmt.Errorf("%w: %w", ErrNotRecorded, err)
+	}
+	return nil
+}
+
+// Result returns the recording state of the session, one of the
+// models.RecordingState constants, and why its recording failed
+func (s *State) Result() (state *string, reason *string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	st := s.state
+	if s.reason == "" {
+		return &st, nil
+	}
+	r := s.reason
+	return &st, &r
+}
@@ -0,0 +1,58 @@
+package recordings
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/VanCannon/openpam/gateway/internal/models"
+)
+
+func TestTrack(t *testing.T) {
+	storageErr := errors.New("disk full")
+
+	tests := []struct {
+		name       string
+		recorded   bool
+		required   bool
+		report     func(ctx context.Context) error
+		wantState  string
+		wantReason string
+		wantRefuse bool
+	}{
+		{"started", true, false, func(ctx context.Context) error { Started(ctx); return nil }, models.RecordingStateStarted, "", false},
+		{"not started", true, false, func(ctx context.Context) error { return nil }, models.RecordingStateNotStarted, "", false},
+		{"disabled", false, false, func(ctx context.Context) error { return nil }, models.RecordingStateDisabled, "", false},
+		{"failed", true, false, func(ctx context.Context) error { return Failed(ctx, storageErr) }, models.RecordingStateFailed, "disk full", false},
+		{"failed when required", true, true, func(ctx context.Context) error { return Failed(ctx, storageErr) }, models.RecordingStateFailed, "disk full", true},
+		{"lost after starting", true, true, func(ctx context.Context) error { Started(ctx); Failed(ctx, storageErr); return nil }, models.RecordingStateFailed, "disk full", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, state := Track(context.Background(), tt.recorded, tt.required)
+
+			err := tt.report(ctx)
+			if refused := errors.Is(err, ErrNotRecorded); refused != tt.wantRefuse {
+				t.Errorf("refused = %t (%v), want %t", refused, err, tt.wantRefuse)
+			}
+			if tt.wantRefuse && !errors.Is(err, storageErr) {
+				t.Errorf("error = %v, want it to wrap the recorder's", err)
+			}
+
+			got, reason := state.Result()
+			if *got != tt.wantState {
+				t.Errorf("state = %s, want %s", *got, tt.wantState)
+			}
+			if (reason == nil) != (tt.wantReason == "") || reason != nil && *reason != tt.wantReason {
+				t.Errorf("reason = %v, want %q", reason, tt.wantReason)
+			}
+		})
+	}
+}
+
+func TestFailed_Untracked(t *testing.T) {
+	// Sessions started without tracking go on without their recording
+	if err := Failed(context.Background(), errors.New("disk full")); err != nil {
+		t.Errorf("Failed() = %v, want nil", err)
+	}
+}
@@ -0,0 +1,182 @@
+package recordings
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// Storage is where recordings are kept. Recordings are files named by the
+// recorders, without directories. Reading goes through fs.FS, so playback,
+// transcripts, exports and investigation bundles work the same whatever the
+// backend.
+type Storage interface {
+	fs.FS
+
+	// ReadDir lists the recordings, sorted by name
+	ReadDir(name string) ([]fs.DirEntry, error)
+
+	// Create starts writing the recording name. It is complete once the
+	// upload is closed.
+	Create(ctx context.Context, name string) (Upload, error)
+
+	// Remove deletes the recording name
+	Remove(ctx context.Context, name string) error
+
+	// Location is what the catalog records for name: a file path, or the URL
+	// of an object
+	Location(name string) string
+}
+
+// Upload is a recording being written. Close completes it; Abort gives up on
+// it, keeping whatever the backend already made visible.
+type Upload interface {
+	io.Writer
+	Close() error
+	Abort() error
+}
+
+// Storage backends
+const (
+	BackendLocal = "local"
+	BackendS3    = "s3"    // Amazon S3 or an S3-compatible store such as MinIO
+	BackendGCS   = "gcs"   // Google Cloud Storage through its S3-compatible XML API, with HMAC keys
+	BackendAzure = "azure" // Azure Blob Storage, with a SAS token
+)
+
+// MinPartSize is the smallest part of a multipart upload S3 accepts
+const MinPartSize = 5 << 20
+
+// Config selects the storage backend and how to reach it
+type Config struct {
+	Backend   string
+	Dir       string // Local directory
+	Bucket    string // S3 or GCS bucket, or Azure container
+	Prefix    string // Prepended to object names, e.g. "zone-a/"
+	Endpoint  string // S3-compatible endpoint or Azure account URL; defaults to AWS or GCS
+	Region    string
+	AccessKey string // S3 or GCS HMAC key
+	SecretKey string
+	SASToken  string       // Azure shared access signature
+	PartSize  int          // Bytes uploaded at a time while a session is recorded
+	Client    *http.Client // nil uses a default client
+}
+
+// Validate checks the settings of the selected backend
+func (c Config) Validate() error {
+	switch c.Backend {
+	case BackendLocal:
+		if c.Dir == "" {
+			return fmt.Errorf("local storage requires a directory")
+		}
+		return nil
+	case BackendS3, BackendGCS:
+		if c.AccessKey == "" || c.SecretKey == "" {
+			return fmt.Errorf("%s storage requires an access key and a secret key", c.Backend)
+		}
+	case BackendAzure:
+		if c.Endpoint == "" {
+			return fmt.Errorf("azure storage requires the account URL as the endpoint")
+		}
+		if c.SASToken == "" {
+			return fmt.Errorf("azure storage requires a SAS token")
+		}
+	default:
+		return fmt.Errorf("invalid backend: %s (must be 'local', 's3', 'gcs' or 'azure')", c.Backend)
+	}
+
+	if c.Bucket == "" {
+		return fmt.Errorf("%s storage requires a bucket", c.Backend)
+	}
+	if c.PartSize < MinPartSize {
+		return fmt.Errorf("part size must be at least %d bytes", MinPartSize)
+	}
+	return nil
+}
+
+// New opens the storage selected by cfg. Local storage creates its directory.
+func New(cfg Config) (Storage, error) {
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+
+	switch cfg.Backend {
+	case BackendS3, BackendGCS:
+		return newS3(cfg), nil
+	case BackendAzure:
+		return newAzure(cfg), nil
+	default:
+		return NewLocal(cfg.Dir)
+	}
+}
+
+// NameOf returns the name of the recording at a catalogued location
+func NameOf(location string) string {
+	return path.Base(filepath.ToSlash(location))
+}
+
+// Local keeps recordings in a directory
+type Local struct {
+	fs.FS
+	dir string
+}
+
+// NewLocal opens the directory dir as recording storage, creating it if needed
+func NewLocal(dir string) (*Local, error) {
+	if err := os.MkdirAll(dir, 0750); err != nil {
+		return nil, fmt.Errorf("failed to create recordings directory: %w", err)
+	}
+	return &Local{FS: os.DirFS(dir), dir: dir}, nil
+}
+
+// ReadDir lists the files in the directory
+func (l *Local) ReadDir(name string) ([]fs.DirEntry, error) {
+	return fs.ReadDir(l.FS, name)
+}
+
+// Create creates the file name, replacing one that exists
+func (l *Local) Create(ctx context.Context, name string) (Upload, error) {
+	if !validName(name) {
+		return nil, &fs.PathError{Op: "create", Path: name, Err: fs.ErrInvalid}
+	}
+	file, err := os.Create(filepath.Join(l.dir, name))
+	if err != nil {
+		return nil, err
+	}
+	return &localUpload{File: file}, nil
+}
+
+// Remove deletes the file name
+func (l *Local) Remove(ctx context.Context, name string) error {
+	if !validName(name) {
+		return &fs.PathError{Op: "remove", Path: name, Err: fs.ErrInvalid}
+	}
+	return os.Remove(filepath.Join(l.dir, name))
+}
+
+// Location is the path of the file name
+func (l *Local) Location(name string) string {
+	return filepath.Join(l.dir, name)
+}
+
+// localUpload writes straight to the file, so a recording cut short by a
+// crash is still there
+type localUpload struct {
+	*os.File
+}
+
+// Abort closes the file and keeps what was written
+func (u *localUpload) Abort() error {
+	return u.File.Close()
+}
+
+// validName reports whether name is a file at the top of the storage
+func validName(name string) bool {
+	return fs.ValidPath(name) && name != "." && !strings.Contains(name, "/")
+}
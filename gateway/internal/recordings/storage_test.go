@@ -0,0 +1,213 @@
+package recordings
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestConfig_Validate(t *testing.T) {
+	s3 := Config{Backend: BackendS3, Bucket: "recordings", AccessKey: "AKID", SecretKey: "secret", PartSize: MinPartSize}
+
+	tests := []struct {
+		name    string
+		cfg     Config
+		wantErr bool
+	}{
+		{"local", Config{Backend: BackendLocal, Dir: "./recordings"}, false},
+		{"local without directory", Config{Backend: BackendLocal}, true},
+		{"s3", s3, false},
+		{"s3 without keys", Config{Backend: BackendS3, Bucket: "recordings", PartSize: MinPartSize}, true},
+		{"s3 without bucket", Config{Backend: BackendS3, AccessKey: "AKID", SecretKey: "secret", PartSize: MinPartSize}, true},
+		{"parts too small", Config{Backend: BackendGCS, Bucket: "recordings", AccessKey: "GOOG", SecretKey: "secret", PartSize: 1024}, true},
+		{"azure", Config{Backend: BackendAzure, Bucket: "recordings", Endpoint: "https://acct.blob.core.windows.net", SASToken: "sv=x&sig=y", PartSize: MinPartSize}, false},
+		{"azure without token", Config{Backend: BackendAzure, Bucket: "recordings", Endpoint: "https://acct.blob.core.windows.net", PartSize: MinPartSize}, true},
+		{"unknown backend", Config{Backend: "ftp"}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.cfg.Validate(); (err != nil) != tt.wantErr {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+// fakeS3 serves the part of the S3 API the storage uses, keeping objects in
+// memory. Keys are relative to the bucket.
+type fakeS3 struct {
+	mu      sync.Mutex
+	objects map[string][]byte
+	uploads map[string]map[int][]byte
+	parts   int // Parts uploaded in multipart uploads
+}
+
+func newFakeS3() *fakeS3 {
+	return &fakeS3{objects: map[string][]byte{}, uploads: map[string]map[int][]byte{}}
+}
+
+func (f *fakeS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if !strings.HasPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256 Credential=AKID/") {
+		w.WriteHeader(http.StatusForbidden)
+		return
+	}
+	key := strings.TrimPrefix(r.URL.Path, "/bucket/")
+	query := r.URL.Query()
+	body, _ := io.ReadAll(r.Body)
+
+	switch {
+	case r.Method == http.MethodGet && query.Get("list-type") == "2":
+		var keys []string
+		for k := range f.objects {
+			if strings.HasPrefix(k, query.Get("prefix")) {
+				keys = append(keys, k)
+			}
+		}
+		sort.Strings(keys)
+		fmt.Fprint(w, "<ListBucketResult>")
+		for _, k := range keys {
+			fmt.Fprintf(w, "<Contents><Key>%s</Key><Size>%d</Size><LastModified>2026-01-02T03:04:05.000Z</LastModified></Contents>", k, len(f.objects[k]))
+		}
+		fmt.Fprint(w, "<IsTruncated>false</IsTruncated></ListBucketResult>")
+	case r.Method == http.MethodPost && query.Has("uploads"):
+		id := fmt.Sprintf("upload-%d", len(f.uploads)+1)
+		f.uploads[id] = map[int][]byte{}
+		fmt.Fprintf(w, "<InitiateMultipartUploadResult><UploadId>%s</UploadId></InitiateMultipartUploadResult>", id)
+	case r.Method == http.MethodPut && query.Has("partNumber"):
+		var n int
+		fmt.Sscanf(query.Get("partNumber"), "%d", &n)
+		f.uploads[query.Get("uploadId")][n] = body
+		f.parts++
+		w.Header().Set("ETag", fmt.Sprintf(`"etag-%d"`, n))
+	case r.Method == http.MethodPost && query.Has("uploadId"):
+		var complete struct {
+			Parts []completedPart `xml:"Part"`
+		}
+		xml.Unmarshal(body, &complete)
+		var object []byte
+		for _, p := range complete.Parts {
+			object = append(object, f.uploads[query.Get("uploadId")][p.PartNumber]...)
+		}
+		f.objects[key] = object
+		delete(f.uploads, query.Get("uploadId"))
+		fmt.Fprint(w, "<CompleteMultipartUploadResult/>")
+	case r.Method == http.MethodPut:
+		f.objects[key] = body
+	case r.Method == http.MethodGet || r.Method == http.MethodHead:
+		object, ok := f.objects[key]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Length", fmt.Sprint(len(object)))
+		w.Write(object)
+	case r.Method == http.MethodDelete:
+		delete(f.objects, key)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		w.WriteHeader(http.StatusBadRequest)
+	}
+}
+
+// newTestS3 opens storage in the fake's bucket, under the prefix "zone-a"
+func newTestS3(t *testing.T, fake *fakeS3) Storage {
+	t.Helper()
+	srv := httptest.NewServer(fake)
+	t.Cleanup(srv.Close)
+
+	storage, err := New(Config{
+		Backend:   BackendS3,
+		Endpoint:  srv.URL,
+		Bucket:    "bucket",
+		Prefix:    "zone-a",
+		AccessKey: "AKID",
+		SecretKey: "secret",
+		PartSize:  MinPartSize,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return storage
+}
+
+func TestS3(t *testing.T) {
+	fake := newFakeS3()
+	storage := newTestS3(t, fake)
+	testStorage(t, storage)
+
+	if fake.parts != 3 {
+		t.Errorf("uploaded %d parts, want the long recording streamed in 3", fake.parts)
+	}
+	if _, ok := fake.objects["zone-a/short.log"]; ok {
+		t.Error("removed object still in the bucket")
+	}
+	if loc := storage.Location("long.log"); loc != "s3://bucket/zone-a/long.log" {
+		t.Errorf("Location() = %s", loc)
+	}
+}
+
+func TestLocal(t *testing.T) {
+	storage, err := New(Config{Backend: BackendLocal, Dir: t.TempDir()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	testStorage(t, storage)
+}
+
+// testStorage writes, lists, reads and removes a short recording and one
+// spanning several parts
+func testStorage(t *testing.T, storage Storage) {
+	t.Helper()
+	ctx := context.Background()
+
+	long := bytes.Repeat([]byte("0123456789abcdef"), (2*MinPartSize+MinPartSize/2)/16)
+	for name, content := range map[string][]byte{"short.log": []byte("$ ls\n"), "long.log": long} {
+		u, err := storage.Create(ctx, name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i := 0; i < len(content); i += 4096 {
+			u.Write(content[i:min(i+4096, len(content))])
+		}
+		if err := u.Close(); err != nil {
+			t.Fatalf("Close(%s) error = %v", name, err)
+		}
+	}
+
+	entries, err := storage.ReadDir(".")
+	if err != nil || len(entries) != 2 || entries[0].Name() != "long.log" || entries[1].Name() != "short.log" {
+		t.Fatalf("ReadDir() = %v, %v", entries, err)
+	}
+
+	got, err := fs.ReadFile(storage, "long.log")
+	if err != nil || !bytes.Equal(got, long) {
+		t.Errorf("ReadFile(long.log) = %d bytes, %v; want %d bytes", len(got), err, len(long))
+	}
+	if info, err := fs.Stat(storage, "short.log"); err != nil || info.Size() != 5 {
+		t.Errorf("Stat(short.log) = %v, %v", info, err)
+	}
+
+	if err := storage.Remove(ctx, "short.log"); err != nil {
+		t.Fatalf("Remove() error = %v", err)
+	}
+	if _, err := storage.Open("short.log"); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("Open() of a removed recording error = %v, want fs.ErrNotExist", err)
+	}
+	if _, err := storage.Open("../etc/passwd"); err == nil {
+		t.Error("Open() outside the storage succeeded")
+	}
+}
@@ -0,0 +1,246 @@
+// Package recurrence evaluates the iCalendar recurrence rules (RFC 5545 RRULE)
+// that recurring schedules repeat their window with. It supports the daily,
+// weekly and monthly rules schedules are requested with: FREQ, INTERVAL,
+// BYDAY, COUNT and UNTIL.
+package recurrence
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Frequency is how often a rule repeats
+type Frequency string
+
+const (
+	Daily   Frequency = "DAILY"
+	Weekly  Frequency = "WEEKLY"
+	Monthly Frequency = "MONTHLY"
+)
+
+// maxPeriods bounds how many periods are stepped through looking for an
+// occurrence, so a rule that never matches doesn't loop forever
+const maxPeriods = 100000
+
+var weekdays = map[string]time.Weekday{
+	"SU": time.Sunday,
+	"MO": time.Monday,
+	"TU": time.Tuesday,
+	"WE": time.Wednesday,
+	"TH": time.Thursday,
+	"FR": time.Friday,
+	"SA": time.Saturday,
+}
+
+// Rule is a parsed recurrence rule
+type Rule struct {
+	Freq     Frequency
+	Interval int
+	ByDay    []time.Weekday
+	Count    int        // Occurrences including the first, or 0 for no limit
+	Until    *time.Time // Last time an occurrence may start
+	// UntilDate is set when UNTIL is a date rather than a time; occurrences
+	// may then start any time on that day in the schedule's timezone
+	UntilDate bool
+}
+
+// Parse parses a recurrence rule such as "FREQ=WEEKLY;BYDAY=MO,WE;COUNT=10".
+// An "RRULE:" prefix is accepted.
+func Parse(rule string) (*Rule, error) {
+	r := &Rule{Interval: 1}
+	rule = strings.TrimPrefix(strings.TrimSpace(rule), "RRULE:")
+
+	for _, part := range strings.Split(rule, ";") {
+		if part == "" {
+			continue
+		}
+		name, value, ok := strings.Cut(part, "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid recurrence rule part %q", part)
+		}
+
+		switch strings.ToUpper(name) {
+		case "FREQ":
+			switch f := Frequency(strings.ToUpper(value)); f {
+			case Daily, Weekly, Monthly:
+				r.Freq = f
+			default:
+				return nil, fmt.Errorf("unsupported recurrence frequency %q", value)
+			}
+		case "INTERVAL":
+			n, err := strconv.Atoi(value)
+			if err != nil || n < 1 {
+				return nil, fmt.Errorf("invalid recurrence interval %q", value)
+			}
+			r.Interval = n
+		case "COUNT":
+			n, err := strconv.Atoi(value)
+			if err != nil || n < 1 {
+				return nil, fmt.Errorf("invalid recurrence count %q", value)
+			}
+			r.Count = n
+		case "UNTIL":
+			until, dateOnly, err := parseUntil(value)
+			if err != nil {
+				return nil, err
+			}
+			r.Until, r.UntilDate = &until, dateOnly
+		case "BYDAY":
+			for _, day := range strings.Split(value, ",") {
+				wd, ok := weekdays[strings.ToUpper(day)]
+				if !ok {
+					return nil, fmt.Errorf("unsupported recurrence day %q", day)
+				}
+				r.ByDay = append(r.ByDay, wd)
+			}
+		case "WKST":
+			// Weeks start on Monday, the default
+			if strings.ToUpper(value) != "MO" {
+				return nil, fmt.Errorf("unsupported recurrence week start %q", value)
+			}
+		default:
+			return nil, fmt.Errorf("unsupported recurrence rule part %s", name)
+		}
+	}
+
+	if r.Freq == "" {
+		return nil, fmt.Errorf("recurrence rule has no FREQ")
+	}
+	if r.Count > 0 && r.Until != nil {
+		return nil, fmt.Errorf("recurrence rule must not have both COUNT and UNTIL")
+	}
+	if r.Freq == Monthly && len(r.ByDay) > 0 {
+		return nil, fmt.Errorf("BYDAY is not supported for monthly recurrence")
+	}
+
+	return r, nil
+}
+
+// parseUntil parses an UNTIL value, either a UTC date-time or a date
+func parseUntil(value string) (time.Time, bool, error) {
+	if t, err := time.Parse("20060102T150405Z", value); err == nil {
+		return t, false, nil
+	}
+	if t, err := time.Parse("20060102", value); err == nil {
+		return t, true, nil
+	}
+	return time.Time{}, false, fmt.Errorf("invalid recurrence until %q", value)
+}
+
+// Next returns the start of the first occurrence that ends after at, for a
+// window of the given length first starting at first. Occurrences keep the
+// wall-clock time of first in its location, across daylight saving changes.
+// It returns false when no occurrence ends after at.
+func (r *Rule) Next(first time.Time, length time.Duration, at time.Time) (time.Time, bool) {
+	n := 0
+	k := 0
+	if r.Count == 0 {
+		k = r.skip(first, length, at)
+	}
+
+	for end := k + maxPeriods; k < end; k++ {
+		period, ok := r.period(first, k)
+		if !ok {
+			continue
+		}
+
+		for _, start := range r.expand(first, period) {
+			if start.Before(first) {
+				continue
+			}
+			if r.past(start) {
+				return time.Time{}, false
+			}
+			n++
+			if r.Count > 0 && n > r.Count {
+				return time.Time{}, false
+			}
+			if start.Add(length).After(at) {
+				return start, true
+			}
+		}
+	}
+
+	return time.Time{}, false
+}
+
+// period returns the start of the kth period. Monthly periods whose day
+// doesn't exist in the month, such as the 31st, are skipped.
+func (r *Rule) period(first time.Time, k int) (time.Time, bool) {
+	switch r.Freq {
+	case Daily:
+		return first.AddDate(0, 0, k*r.Interval), true
+	case Weekly:
+		return first.AddDate(0, 0, 7*k*r.Interval), true
+	default:
+		p := first.AddDate(0, k*r.Interval, 0)
+		return p, p.Day() == first.Day()
+	}
+}
+
+// expand returns the occurrence starts within a period, in order
+func (r *Rule) expand(first, period time.Time) []time.Time {
+	if len(r.ByDay) == 0 {
+		return []time.Time{period}
+	}
+
+	if r.Freq == Daily {
+		if r.onDay(period.Weekday()) {
+			return []time.Time{period}
+		}
+		return nil
+	}
+
+	// The days of the period's week, starting on Monday
+	monday := period.AddDate(0, 0, -((int(period.Weekday()) + 6) % 7))
+	var starts []time.Time
+	for d := 0; d < 7; d++ {
+		day := monday.AddDate(0, 0, d)
+		if r.onDay(day.Weekday()) {
+			starts = append(starts, day)
+		}
+	}
+	return starts
+}
+
+func (r *Rule) onDay(wd time.Weekday) bool {
+	for _, d := range r.ByDay {
+		if d == wd {
+			return true
+		}
+	}
+	return false
+}
+
+// past reports whether an occurrence starting at start is after UNTIL
+func (r *Rule) past(start time.Time) bool {
+	if r.Until == nil {
+		return false
+	}
+	if r.UntilDate {
+		y, m, d := r.Until.Date()
+		return start.After(time.Date(y, m, d, 23, 59, 59, 0, start.Location()))
+	}
+	return start.After(*r.Until)
+}
+
+// skip returns a period at or before the first one with an occurrence ending
+// after at, so long-running rules aren't stepped through from the start
+func (r *Rule) skip(first time.Time, length time.Duration, at time.Time) int {
+	// Leave a period and a couple of days of slack for daylight saving
+	// changes and weekly BYDAY occurrences before the period's start
+	from := at.Add(-length)
+	var k int
+	switch r.Freq {
+	case Daily:
+		k = int(from.Sub(first)/(24*time.Hour))/r.Interval - 2
+	case Weekly:
+		k = int(from.Sub(first)/(7*24*time.Hour))/r.Interval - 1
+	default:
+		months := (from.Year()-first.Year())*12 + int(from.Month()) - int(first.Month())
+		k = months/r.Interval - 1
+	}
+	return max(k, 0)
+}
@@ -0,0 +1,85 @@
+package recurrence
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParse(t *testing.T) {
+	r, err := Parse("RRULE:FREQ=WEEKLY;INTERVAL=2;BYDAY=MO,FR;COUNT=6")
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	if r.Freq != Weekly || r.Interval != 2 || r.Count != 6 || len(r.ByDay) != 2 || r.ByDay[1] != time.Friday {
+		t.Errorf("rule = %+v", r)
+	}
+
+	for _, bad := range []string{
+		"", "INTERVAL=2", "FREQ=HOURLY", "FREQ=DAILY;COUNT=0", "FREQ=DAILY;BYDAY=1MO",
+		"FREQ=DAILY;COUNT=2;UNTIL=20250101", "FREQ=MONTHLY;BYDAY=MO", "FREQ=DAILY;BYHOUR=9",
+	} {
+		if _, err := Parse(bad); err == nil {
+			t.Errorf("Parse(%q) succeeded", bad)
+		}
+	}
+}
+
+func TestNext(t *testing.T) {
+	// Weekdays from 09:00 to 17:00, starting Monday 3 March 2025
+	first := time.Date(2025, 3, 3, 9, 0, 0, 0, time.UTC)
+	length := 8 * time.Hour
+	weekdays, _ := Parse("FREQ=WEEKLY;BYDAY=MO,TU,WE,TH,FR")
+
+	tests := []struct {
+		rule string
+		at   time.Time
+		want time.Time // Zero when no occurrence is left
+	}{
+		{"FREQ=DAILY", time.Date(2025, 3, 10, 12, 0, 0, 0, time.UTC), time.Date(2025, 3, 10, 9, 0, 0, 0, time.UTC)},
+		{"FREQ=DAILY", time.Date(2025, 3, 10, 18, 0, 0, 0, time.UTC), time.Date(2025, 3, 11, 9, 0, 0, 0, time.UTC)},
+		{"FREQ=DAILY;INTERVAL=3", time.Date(2025, 3, 4, 12, 0, 0, 0, time.UTC), time.Date(2025, 3, 6, 9, 0, 0, 0, time.UTC)},
+		{"FREQ=DAILY;COUNT=3", time.Date(2025, 3, 5, 12, 0, 0, 0, time.UTC), time.Date(2025, 3, 5, 9, 0, 0, 0, time.UTC)},
+		{"FREQ=DAILY;COUNT=3", time.Date(2025, 3, 5, 18, 0, 0, 0, time.UTC), time.Time{}},
+		{"FREQ=DAILY;UNTIL=20250305", time.Date(2025, 3, 5, 10, 0, 0, 0, time.UTC), time.Date(2025, 3, 5, 9, 0, 0, 0, time.UTC)},
+		{"FREQ=DAILY;UNTIL=20250304T000000Z", time.Date(2025, 3, 3, 18, 0, 0, 0, time.UTC), time.Time{}},
+		{"FREQ=WEEKLY;BYDAY=MO,TU,WE,TH,FR", time.Date(2025, 3, 8, 12, 0, 0, 0, time.UTC), time.Date(2025, 3, 10, 9, 0, 0, 0, time.UTC)},
+		{"FREQ=WEEKLY;BYDAY=MO,TU,WE,TH,FR", time.Date(2027, 6, 2, 10, 0, 0, 0, time.UTC), time.Date(2027, 6, 2, 9, 0, 0, 0, time.UTC)},
+		{"FREQ=MONTHLY", time.Date(2025, 4, 3, 16, 0, 0, 0, time.UTC), time.Date(2025, 4, 3, 9, 0, 0, 0, time.UTC)},
+	}
+	for _, tt := range tests {
+		r, err := Parse(tt.rule)
+		if err != nil {
+			t.Fatalf("Parse(%q): %v", tt.rule, err)
+		}
+		got, ok := r.Next(first, length, tt.at)
+		if tt.want.IsZero() {
+			if ok {
+				t.Errorf("%s at %s: next = %s, want none", tt.rule, tt.at, got)
+			}
+			continue
+		}
+		if !ok || !got.Equal(tt.want) {
+			t.Errorf("%s at %s: next = %s (%v), want %s", tt.rule, tt.at, got, ok, tt.want)
+		}
+	}
+
+	// Before the first occurrence, the first one is next
+	if got, ok := weekdays.Next(first, length, first.Add(-time.Hour)); !ok || !got.Equal(first) {
+		t.Errorf("next before first = %s", got)
+	}
+}
+
+func TestNext_KeepsWallClock(t *testing.T) {
+	loc, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Skip("timezone data not available")
+	}
+	r, _ := Parse("FREQ=DAILY")
+
+	// Daylight saving time starts on 9 March 2025
+	first := time.Date(2025, 3, 7, 9, 0, 0, 0, loc)
+	got, ok := r.Next(first, time.Hour, time.Date(2025, 3, 10, 0, 0, 0, 0, time.UTC))
+	if want := time.Date(2025, 3, 10, 9, 0, 0, 0, loc); !ok || !got.Equal(want) {
+		t.Errorf("next = %s, want %s", got, want)
+	}
+}
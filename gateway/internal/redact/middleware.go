@@ -0,0 +1,80 @@
+package redact
+
+import (
+	"bytes"
+	"net/http"
+	"strings"
+)
+
+const (
+	// Header asks for a redacted response when set to "true"
+	Header = "X-OpenPAM-Redact"
+
+	// QueryParam asks for a redacted response when set to "true", for links
+	// that can't carry headers
+	QueryParam = "redact"
+
+	// RedactedHeader marks a response whose JSON body was redacted
+	RedactedHeader = "X-OpenPAM-Redacted"
+)
+
+// Requested reports whether the request asks for a redacted view
+func Requested(r *http.Request) bool {
+	return r.Header.Get(Header) == "true" || r.URL.Query().Get(QueryParam) == "true"
+}
+
+// Middleware returns a middleware that redacts the JSON responses of requests
+// asking for it. Other responses, WebSocket upgrades and event streams are
+// passed through unchanged.
+func (rd *Redactor) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !Requested(r) || r.Header.Get("Upgrade") != "" || strings.Contains(r.Header.Get("Accept"), "text/event-stream") {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		buf := &bufferedWriter{header: w.Header(), status: http.StatusOK}
+		next.ServeHTTP(buf, r)
+
+		body := buf.body.Bytes()
+		if strings.Contains(w.Header().Get("Content-Type"), "json") && len(body) > 0 {
+			if redacted, err := rd.JSON(body); err == nil {
+				body = append(redacted, '\n')
+				w.Header().Set(RedactedHeader, "true")
+				w.Header().Del("Content-Length")
+			} else {
+				// Never leak what couldn't be redacted
+				w.Header().Del("Content-Type")
+				http.Error(w, "Failed to redact response", http.StatusInternalServerError)
+				return
+			}
+		}
+
+		w.WriteHeader(buf.status)
+		w.Write(body)
+	})
+}
+
+// bufferedWriter holds a response back until it has been redacted
+type bufferedWriter struct {
+	header      http.Header
+	status      int
+	wroteHeader bool
+	body        bytes.Buffer
+}
+
+func (b *bufferedWriter) Header() http.Header {
+	return b.header
+}
+
+func (b *bufferedWriter) WriteHeader(status int) {
+	if !b.wroteHeader {
+		b.status = status
+		b.wroteHeader = true
+	}
+}
+
+func (b *bufferedWriter) Write(p []byte) (int, error) {
+	b.wroteHeader = true
+	return b.body.Write(p)
+}
@@ -0,0 +1,173 @@
+// Package redact pseudonymizes personal and infrastructure details in API
+// responses, so real data can be shown on screen shares and demos. Emails,
+// display names, hostnames and IP addresses are replaced with stable
+// pseudonyms: the same value always maps to the same pseudonym, across
+// requests and gateway replicas sharing a secret, so lists and details still
+// line up.
+package redact
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net"
+	"regexp"
+	"strings"
+)
+
+var (
+	emailPattern = regexp.MustCompile(`[A-Za-z0-9._%+\-]+@[A-Za-z0-9.\-]+\.[A-Za-z]{2,}`)
+	ipv4Pattern  = regexp.MustCompile(`\b(?:(?:25[0-5]|2[0-4][0-9]|1[0-9]{2}|[1-9]?[0-9])\.){3}(?:25[0-5]|2[0-4][0-9]|1[0-9]{2}|[1-9]?[0-9])\b`)
+)
+
+// hostKeys are the JSON fields holding hostnames
+var hostKeys = map[string]bool{
+	"hostname":        true,
+	"host":            true,
+	"target_hostname": true,
+	"target_host":     true,
+	"dns_hostname":    true,
+	"fqdn":            true,
+}
+
+// nameKeys are the JSON fields holding people's names
+var nameKeys = map[string]bool{
+	"display_name":   true,
+	"user_name":      true,
+	"requester_name": true,
+	"approver_name":  true,
+	"owner_name":     true,
+}
+
+// ipKeys are the JSON fields holding IP addresses, which may be IPv6
+var ipKeys = map[string]bool{
+	"ip_address": true,
+	"client_ip":  true,
+	"ip":         true,
+}
+
+// Redactor pseudonymizes values with a keyed hash
+type Redactor struct {
+	secret []byte
+}
+
+// New creates a redactor. Pseudonyms depend on secret, so they can't be
+// reversed by hashing guesses without it.
+func New(secret string) *Redactor {
+	return &Redactor{secret: []byte(secret)}
+}
+
+// digest returns a keyed hash of a value of the given kind
+func (r *Redactor) digest(kind, value string) []byte {
+	h := hmac.New(sha256.New, r.secret)
+	h.Write([]byte("openpam-redact\x00" + kind + "\x00"))
+	h.Write([]byte(strings.ToLower(value)))
+	return h.Sum(nil)
+}
+
+// Email returns the pseudonym of an email address
+func (r *Redactor) Email(email string) string {
+	return "user-" + hex.EncodeToString(r.digest("email", email)[:4]) + "@example.com"
+}
+
+// Name returns the pseudonym of a person's name
+func (r *Redactor) Name(name string) string {
+	return "User " + strings.ToUpper(hex.EncodeToString(r.digest("name", name)[:3]))
+}
+
+// Host returns the pseudonym of a hostname, keeping IP addresses in IP form
+func (r *Redactor) Host(host string) string {
+	if net.ParseIP(host) != nil {
+		return r.IP(host)
+	}
+	return "host-" + hex.EncodeToString(r.digest("host", host)[:4]) + ".example.net"
+}
+
+// IP returns the pseudonym of an IP address. IPv4 addresses map into the
+// 198.18.0.0/15 benchmarking range and IPv6 addresses into 2001:db8::/32, so
+// pseudonyms still read as addresses but never name a real host.
+func (r *Redactor) IP(ip string) string {
+	parsed := net.ParseIP(ip)
+	if parsed == nil {
+		return ipv4Pattern.ReplaceAllStringFunc(ip, r.IP)
+	}
+	d := r.digest("ip", parsed.String())
+	if parsed.To4() != nil {
+		return fmt.Sprintf("198.%d.%d.%d", 18+d[0]&1, d[1], d[2])
+	}
+	return fmt.Sprintf("2001:db8:%x:%x::%x", uint16(d[0])<<8|uint16(d[1]), uint16(d[2])<<8|uint16(d[3]), uint16(d[4])<<8|uint16(d[5]))
+}
+
+// Text replaces the email and IPv4 addresses found in free text
+func (r *Redactor) Text(s string) string {
+	s = emailPattern.ReplaceAllStringFunc(s, r.Email)
+	return ipv4Pattern.ReplaceAllStringFunc(s, r.IP)
+}
+
+// Value redacts a decoded JSON value, found under key in its parent object
+func (r *Redactor) Value(key string, v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for k, item := range v {
+			v[k] = r.Value(k, item)
+		}
+		return v
+	case []interface{}:
+		for i, item := range v {
+			v[i] = r.Value(key, item)
+		}
+		return v
+	case string:
+		return r.field(key, v)
+	default:
+		return v
+	}
+}
+
+// field redacts a string field according to what its key says it holds
+func (r *Redactor) field(key, value string) string {
+	if value == "" {
+		return value
+	}
+
+	lower := strings.ToLower(key)
+	switch {
+	case lower == "email" || strings.HasSuffix(lower, "_email"):
+		return r.Email(value)
+	case hostKeys[lower]:
+		return r.Host(value)
+	case nameKeys[lower]:
+		return r.Name(value)
+	case ipKeys[lower]:
+		if host, port, err := net.SplitHostPort(value); err == nil {
+			return net.JoinHostPort(r.IP(host), port)
+		}
+		return r.IP(value)
+	}
+
+	// JSON stored as text, such as audit event details
+	if lower == "details" && strings.HasPrefix(value, "{") {
+		var nested interface{}
+		if err := json.Unmarshal([]byte(value), &nested); err == nil {
+			if out, err := json.Marshal(r.Value("", nested)); err == nil {
+				return string(out)
+			}
+		}
+	}
+
+	return r.Text(value)
+}
+
+// JSON redacts a JSON document
+func (r *Redactor) JSON(data []byte) ([]byte, error) {
+	dec := json.NewDecoder(strings.NewReader(string(data)))
+	dec.UseNumber()
+
+	var doc interface{}
+	if err := dec.Decode(&doc); err != nil {
+		return nil, err
+	}
+	return json.Marshal(r.Value("", doc))
+}
@@ -0,0 +1,136 @@
+package redact
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestRedactor_Pseudonyms(t *testing.T) {
+	r := New("secret")
+
+	if r.Email("alice@corp.com") != r.Email("Alice@Corp.com") {
+		t.Error("email pseudonyms should not depend on case")
+	}
+	if r.Email("alice@corp.com") == r.Email("bob@corp.com") {
+		t.Error("different emails got the same pseudonym")
+	}
+	if r.Email("alice@corp.com") == New("other").Email("alice@corp.com") {
+		t.Error("pseudonyms should depend on the secret")
+	}
+	if !strings.HasSuffix(r.Email("alice@corp.com"), "@example.com") {
+		t.Errorf("email pseudonym = %q", r.Email("alice@corp.com"))
+	}
+
+	ip := r.IP("10.1.2.3")
+	if !strings.HasPrefix(ip, "198.18.") && !strings.HasPrefix(ip, "198.19.") {
+		t.Errorf("IPv4 pseudonym = %q, want 198.18.0.0/15", ip)
+	}
+	if v6 := r.IP("fe80::1"); !strings.HasPrefix(v6, "2001:db8:") {
+		t.Errorf("IPv6 pseudonym = %q", v6)
+	}
+	if r.Host("10.1.2.3") != ip {
+		t.Error("IP hostnames should be pseudonymized as IPs")
+	}
+}
+
+func TestRedactor_JSON(t *testing.T) {
+	r := New("secret")
+
+	in := `{
+		"logs": [{
+			"user_email": "alice@corp.com",
+			"display_name": "Alice Smith",
+			"hostname": "prod-db-01.corp.com",
+			"ip_address": "10.1.2.3:51234",
+			"action": "alice@corp.com connected from 10.1.2.3",
+			"details": "{\"target_host\":\"prod-db-01.corp.com\",\"count\":3}",
+			"port": 22,
+			"id": "2b1f5b6c-3a8e-4d1e-9c47-2b2a4a1e9b10"
+		}],
+		"count": 1
+	}`
+	out, err := r.JSON([]byte(in))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var doc struct {
+		Logs []map[string]interface{} `json:"logs"`
+	}
+	if err := json.Unmarshal(out, &doc); err != nil {
+		t.Fatal(err)
+	}
+	log := doc.Logs[0]
+
+	for _, leaked := range []string{"alice", "Alice", "prod-db-01", "10.1.2.3"} {
+		if strings.Contains(string(out), leaked) {
+			t.Errorf("%q leaked into %s", leaked, out)
+		}
+	}
+	if log["user_email"] != r.Email("alice@corp.com") {
+		t.Errorf("user_email = %v", log["user_email"])
+	}
+	if log["action"] != r.Email("alice@corp.com")+" connected from "+r.IP("10.1.2.3") {
+		t.Errorf("action = %v", log["action"])
+	}
+	if log["ip_address"] != r.IP("10.1.2.3")+":51234" {
+		t.Errorf("ip_address = %v", log["ip_address"])
+	}
+	if !strings.Contains(log["details"].(string), r.Host("prod-db-01.corp.com")) {
+		t.Errorf("details = %v", log["details"])
+	}
+	if log["port"] != 22.0 || log["id"] != "2b1f5b6c-3a8e-4d1e-9c47-2b2a4a1e9b10" {
+		t.Errorf("unrelated fields changed: %v", log)
+	}
+}
+
+func TestMiddleware(t *testing.T) {
+	r := New("secret")
+	handler := r.Middleware(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.URL.Path == "/csv" {
+			w.Header().Set("Content-Type", "text/csv")
+			w.Write([]byte("alice@corp.com\n"))
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(map[string]string{"email": "alice@corp.com"})
+	}))
+
+	tests := []struct {
+		name     string
+		path     string
+		header   bool
+		redacted bool
+	}{
+		{"not requested", "/users", false, false},
+		{"header", "/users", true, true},
+		{"query", "/users?redact=true", false, true},
+		{"not JSON", "/csv", true, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", tt.path, nil)
+			if tt.header {
+				req.Header.Set(Header, "true")
+			}
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+
+			leaked := strings.Contains(rec.Body.String(), "alice@corp.com")
+			if leaked == tt.redacted {
+				t.Errorf("body = %q, redacted = %v", rec.Body.String(), tt.redacted)
+			}
+			if (rec.Header().Get(RedactedHeader) == "true") != tt.redacted {
+				t.Errorf("%s = %q", RedactedHeader, rec.Header().Get(RedactedHeader))
+			}
+			if tt.path != "/csv" && rec.Code != http.StatusCreated {
+				t.Errorf("status = %d, want 201", rec.Code)
+			}
+		})
+	}
+}
@@ -0,0 +1,161 @@
+package remediation
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// permanentError is a launch AWX refused in a way retrying won't fix, such as
+// a missing job template or extra vars it doesn't accept
+type permanentError struct {
+	err error
+}
+
+func (e *permanentError) Error() string { return e.err.Error() }
+func (e *permanentError) Unwrap() error { return e.err }
+
+func isPermanent(err error) bool {
+	var p *permanentError
+	return errors.As(err, &p)
+}
+
+// job is the part of an AWX job the runner reads
+type job struct {
+	ID          int64  `json:"id"`
+	Status      string `json:"status"` // new, pending, waiting, running, successful, failed, error or canceled
+	Explanation string `json:"job_explanation"`
+}
+
+// finished reports whether the job reached a final status
+func (j *job) finished() bool {
+	switch j.Status {
+	case "successful", "failed", "error", "canceled":
+		return true
+	}
+	return false
+}
+
+// launchResponse is the part of a job template launch response the runner reads
+type launchResponse struct {
+	ID            int64                  `json:"id"`
+	Job           int64                  `json:"job"`
+	IgnoredFields map[string]interface{} `json:"ignored_fields"`
+}
+
+// client calls the AWX (or Ansible Tower) REST API
+type client struct {
+	baseURL string
+	token   string
+	http    *http.Client
+}
+
+func newClient(cfg Config) (*client, error) {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if cfg.CAFile != "" {
+		pem, err := os.ReadFile(cfg.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read CA file: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in %s", cfg.CAFile)
+		}
+		transport.TLSClientConfig = &tls.Config{RootCAs: pool, MinVersion: tls.VersionTLS12}
+	}
+
+	return &client{
+		baseURL: strings.TrimRight(cfg.URL, "/"),
+		token:   cfg.Token,
+		http:    &http.Client{Transport: transport, Timeout: 30 * time.Second},
+	}, nil
+}
+
+// launch starts a job from a job template with the given extra vars and
+// returns the job's ID. AWX drops extra vars unless the template prompts for
+// them on launch; ignored lists the fields it dropped.
+func (c *client) launch(ctx context.Context, templateID int, extraVars json.RawMessage) (id int64, ignored []string, err error) {
+	body, err := json.Marshal(map[string]json.RawMessage{"extra_vars": extraVars})
+	if err != nil {
+		return 0, nil, &permanentError{fmt.Errorf("failed to encode launch request: %w", err)}
+	}
+
+	var resp launchResponse
+	if err := c.do(ctx, http.MethodPost, fmt.Sprintf("/api/v2/job_templates/%d/launch/", templateID), body, &resp); err != nil {
+		return 0, nil, err
+	}
+
+	id = resp.Job
+	if id == 0 {
+		id = resp.ID
+	}
+	if id == 0 {
+		return 0, nil, fmt.Errorf("launch response has no job ID")
+	}
+	for field := range resp.IgnoredFields {
+		ignored = append(ignored, field)
+	}
+	return id, ignored, nil
+}
+
+// job retrieves a job's status
+func (c *client) job(ctx context.Context, id int64) (*job, error) {
+	var j job
+	if err := c.do(ctx, http.MethodGet, fmt.Sprintf("/api/v2/jobs/%d/", id), nil, &j); err != nil {
+		return nil, err
+	}
+	return &j, nil
+}
+
+// jobURL is where a job's output is shown in the AWX interface
+func (c *client) jobURL(id int64) string {
+	return fmt.Sprintf("%s/#/jobs/playbook/%d/output", c.baseURL, id)
+}
+
+// do sends a request and decodes the JSON response into out. Client errors
+// other than timeouts and rate limiting are permanent.
+func (c *client) do(ctx context.Context, method, path string, body []byte, out interface{}) error {
+	var reader io.Reader
+	if body != nil {
+		reader = bytes.NewReader(body)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, c.baseURL+path, reader)
+	if err != nil {
+		return &permanentError{err}
+	}
+	req.Header.Set("Authorization", "Bearer "+c.token)
+	req.Header.Set("Accept", "application/json")
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	data, _ := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		err := fmt.Errorf("AWX returned %d: %s", resp.StatusCode, bytes.TrimSpace(data))
+		if resp.StatusCode >= 400 && resp.StatusCode < 500 &&
+			resp.StatusCode != http.StatusRequestTimeout && resp.StatusCode != http.StatusTooManyRequests {
+			return &permanentError{err}
+		}
+		return err
+	}
+
+	if err := json.Unmarshal(data, out); err != nil {
+		return fmt.Errorf("failed to decode AWX response: %w", err)
+	}
+	return nil
+}
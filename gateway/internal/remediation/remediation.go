@@ -0,0 +1,517 @@
+// Package remediation launches AWX or Ansible Tower job templates after a
+// privileged session ends or violates a policy, such as a hardening playbook
+// that rotates keys or verifies the target's configuration, and tracks the
+// jobs' results against the session.
+package remediation
+
+import (
+	"context"
+	"encoding/json"
+	"expvar"
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/VanCannon/openpam/gateway/internal/models"
+	"github.com/VanCannon/openpam/gateway/internal/worker"
+	"github.com/VanCannon/openpam/pkg/logger"
+	"github.com/google/uuid"
+)
+
+const (
+	// cursorName identifies the runner's position in the event log
+	cursorName = "remediation"
+
+	// batchSize is how many events are read from the event log at a time
+	batchSize = 200
+
+	// maxLaunchAttempts is how often launching a job is tried before the run fails
+	maxLaunchAttempts = 5
+
+	// maxBackoff caps the wait between launch attempts
+	maxBackoff = 30 * time.Minute
+
+	// pollBatch is how many running jobs are checked per interval
+	pollBatch = 100
+)
+
+// retryBackoff is the wait before the second launch attempt; it doubles with every attempt
+var retryBackoff = time.Minute
+
+// Published at /api/v1/admin/metrics
+var (
+	jobsLaunched = expvar.NewInt("remediation_jobs_launched")
+	jobsFailed   = expvar.NewInt("remediation_jobs_failed")
+)
+
+// Config holds the AWX server and the job templates to launch
+type Config struct {
+	URL                string // AWX or Ansible Tower; remediation is disabled if empty
+	Token              string // OAuth2 token of a user allowed to launch the templates
+	CAFile             string // PEM bundle to verify AWX's certificate with
+	SessionEndTemplate int    // Job template launched when a session ends; 0 for none
+	ViolationTemplate  int    // Job template launched on a policy violation; 0 for none
+	Interval           time.Duration
+}
+
+// Validate checks the settings of enabled remediation
+func (c Config) Validate() error {
+	if c.URL == "" {
+		return nil
+	}
+	parsed, err := url.Parse(c.URL)
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+		return fmt.Errorf("invalid URL %q (must be an http or https URL)", c.URL)
+	}
+	if c.Token == "" {
+		return fmt.Errorf("a token is required")
+	}
+	if c.SessionEndTemplate < 0 || c.ViolationTemplate < 0 {
+		return fmt.Errorf("job template IDs cannot be negative")
+	}
+	if c.SessionEndTemplate == 0 && c.ViolationTemplate == 0 {
+		return fmt.Errorf("set a session end or policy violation job template")
+	}
+	_, err = newClient(c)
+	return err
+}
+
+// EventSource is the subset of the event repository the runner needs
+type EventSource interface {
+	ListSince(ctx context.Context, afterID int64, limit int) ([]*models.Event, error)
+	LatestID(ctx context.Context) (int64, error)
+}
+
+// CursorStore keeps the runner's position in the event log
+type CursorStore interface {
+	Advance(ctx context.Context, name string, fn func(lastID int64) (int64, error)) (bool, error)
+}
+
+// Store is the subset of the remediation repository the runner needs
+type Store interface {
+	Create(ctx context.Context, run *models.RemediationRun) error
+	Launch(ctx context.Context, fn func(run *models.RemediationRun) error) (bool, error)
+	ListRunning(ctx context.Context, limit int) ([]*models.RemediationRun, error)
+	Finish(ctx context.Context, id uuid.UUID, status string, errMsg *string) error
+	Touch(ctx context.Context, id uuid.UUID) error
+}
+
+// SessionLookup loads the current state of a session
+type SessionLookup interface {
+	GetByID(ctx context.Context, id uuid.UUID) (*models.AuditLog, error)
+}
+
+// TargetLookup loads a session's target
+type TargetLookup interface {
+	GetByID(ctx context.Context, id uuid.UUID) (*models.Target, error)
+}
+
+// UserLookup loads a session's user
+type UserLookup interface {
+	GetByID(ctx context.Context, id uuid.UUID) (*models.User, error)
+}
+
+// Runner follows the event log and launches the configured job template for
+// every ended session and policy violation.
+//
+// Only events logged after remediation was first enabled trigger runs. Runs
+// are queued in the database, keyed by the event that triggered them, and
+// launched by whichever replica locks them first; a launch AWX can't accept
+// right now is retried with backoff. Launched jobs are then polled until they
+// finish and their outcome is stored with the run.
+type Runner struct {
+	config   Config
+	client   *client
+	events   EventSource
+	cursors  CursorStore
+	store    Store
+	sessions SessionLookup
+	targets  TargetLookup
+	users    UserLookup
+	logger   *logger.Logger
+
+	loop worker.Loop
+}
+
+// NewRunner creates a runner. It returns nil if no AWX server is configured.
+func NewRunner(cfg Config, events EventSource, cursors CursorStore, store Store, sessions SessionLookup, targets TargetLookup, users UserLookup, log *logger.Logger) (*Runner, error) {
+	if cfg.URL == "" {
+		return nil, nil
+	}
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	if cfg.Interval <= 0 {
+		cfg.Interval = 30 * time.Second
+	}
+
+	client, err := newClient(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Runner{
+		config:   cfg,
+		client:   client,
+		events:   events,
+		cursors:  cursors,
+		store:    store,
+		sessions: sessions,
+		targets:  targets,
+		users:    users,
+		logger:   log,
+	}, nil
+}
+
+// Start runs remediation in the background until Stop is called
+func (r *Runner) Start() {
+	r.loop.Start(r.run)
+}
+
+// Stop stops the runner and waits for it to finish. Jobs already launched
+// keep running in AWX and are picked up again on the next start.
+// It is safe to call even if the runner was never started.
+func (r *Runner) Stop() {
+	r.loop.Stop()
+}
+
+func (r *Runner) run() {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		select {
+		case <-r.loop.Stopping():
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	ticker := time.NewTicker(r.config.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-r.loop.Stopping():
+			return
+		case <-ticker.C:
+			r.tick(ctx)
+		}
+	}
+}
+
+// tick queues runs for new events, launches the runs that are due and checks
+// on the jobs that are running
+func (r *Runner) tick(ctx context.Context) {
+	if err := r.queuePending(ctx); err != nil && ctx.Err() == nil {
+		r.logger.Error("Failed to queue remediation runs", map[string]interface{}{
+			"error": err.Error(),
+		})
+	}
+	r.launchDue(ctx)
+	r.poll(ctx)
+}
+
+// queuePending queues a run for every event that triggers one, until the
+// runner has caught up with the event log
+func (r *Runner) queuePending(ctx context.Context) error {
+	for ctx.Err() == nil {
+		more := false
+		_, err := r.cursors.Advance(ctx, cursorName, func(lastID int64) (int64, error) {
+			// Sessions that ended before remediation was enabled are left alone
+			if lastID == 0 {
+				return r.events.LatestID(ctx)
+			}
+
+			events, err := r.events.ListSince(ctx, lastID, batchSize)
+			if err != nil {
+				return lastID, err
+			}
+			if len(events) == 0 {
+				return lastID, nil
+			}
+
+			for _, event := range events {
+				run := r.runFor(ctx, event)
+				if run == nil {
+					continue
+				}
+				if err := r.store.Create(ctx, run); err != nil {
+					return lastID, err
+				}
+			}
+
+			more = len(events) == batchSize
+			return events[len(events)-1].ID, nil
+		})
+		if err != nil || !more {
+			return err
+		}
+	}
+	return ctx.Err()
+}
+
+// runFor returns the run an event triggers, or nil if it triggers none
+func (r *Runner) runFor(ctx context.Context, event *models.Event) *models.RemediationRun {
+	switch {
+	case strings.HasPrefix(event.Type, models.StreamEventSessionPrefix):
+		if r.config.SessionEndTemplate == 0 || event.Type == models.StreamEventSessionStarted {
+			return nil
+		}
+		var log models.AuditLog
+		if err := json.Unmarshal(event.Payload, &log); err != nil {
+			r.skip(event, err)
+			return nil
+		}
+		if log.SessionStatus == models.SessionStatusActive {
+			return nil
+		}
+		return r.newRun(ctx, event, models.RemediationTriggerSessionEnd, r.config.SessionEndTemplate, log.ID, nil)
+
+	case event.Type == models.StreamEventSystemPrefix+models.EventTypePolicyViolation:
+		if r.config.ViolationTemplate == 0 {
+			return nil
+		}
+		var log models.SystemAuditLog
+		if err := json.Unmarshal(event.Payload, &log); err != nil {
+			r.skip(event, err)
+			return nil
+		}
+		if !log.ResourceID.Valid {
+			return nil
+		}
+		violation := map[string]interface{}{
+			"openpam_violation_id":      log.ID.String(),
+			"openpam_violation_type":    log.Action,
+			"openpam_violation_blocked": log.Status == models.AuditStatusFailure,
+		}
+		if log.Details != nil {
+			var details map[string]interface{}
+			if err := json.Unmarshal([]byte(*log.Details), &details); err == nil {
+				if rule, ok := details["rule"].(string); ok {
+					violation["openpam_violation_rule"] = rule
+				}
+			}
+		}
+		return r.newRun(ctx, event, models.RemediationTriggerViolation, r.config.ViolationTemplate, log.ResourceID.UUID, violation)
+	}
+	return nil
+}
+
+// newRun builds a run with the session's details as extra vars. Details that
+// can't be loaded are left out rather than holding up the run.
+func (r *Runner) newRun(ctx context.Context, event *models.Event, trigger string, templateID int, sessionID uuid.UUID, extra map[string]interface{}) *models.RemediationRun {
+	vars := map[string]interface{}{
+		"openpam_trigger":    trigger,
+		"openpam_event_id":   event.ID,
+		"openpam_session_id": sessionID.String(),
+	}
+	for k, v := range extra {
+		vars[k] = v
+	}
+
+	session, err := r.sessions.GetByID(ctx, sessionID)
+	if err != nil {
+		r.logger.Warn("Failed to load session for remediation", map[string]interface{}{
+			"session_id": sessionID.String(),
+			"error":      err.Error(),
+		})
+	} else {
+		vars["openpam_session_status"] = session.SessionStatus
+		vars["openpam_protocol"] = session.Protocol
+		vars["openpam_start_time"] = session.StartTime.UTC().Format(time.RFC3339)
+		if session.EndTime.Valid {
+			vars["openpam_end_time"] = session.EndTime.Time.UTC().Format(time.RFC3339)
+		}
+		if session.ClientIP != nil {
+			vars["openpam_client_ip"] = *session.ClientIP
+		}
+
+		vars["openpam_user_id"] = session.UserID.String()
+		if user, err := r.users.GetByID(ctx, session.UserID); err == nil {
+			vars["openpam_user_email"] = user.Email
+		}
+
+		vars["openpam_target_id"] = session.TargetID.String()
+		if target, err := r.targets.GetByID(ctx, session.TargetID); err == nil {
+			vars["openpam_target_name"] = target.Name
+			vars["openpam_target_hostname"] = target.Hostname
+			vars["openpam_target_port"] = target.Port
+		}
+	}
+
+	extraVars, err := json.Marshal(vars)
+	if err != nil {
+		r.skip(event, err)
+		return nil
+	}
+
+	return &models.RemediationRun{
+		AuditLogID: sessionID,
+		EventID:    event.ID,
+		Trigger:    trigger,
+		TemplateID: templateID,
+		ExtraVars:  extraVars,
+	}
+}
+
+// launchDue launches queued runs until none is due
+func (r *Runner) launchDue(ctx context.Context) {
+	for ctx.Err() == nil {
+		launched, err := r.store.Launch(ctx, func(run *models.RemediationRun) error {
+			return r.launch(ctx, run)
+		})
+		if err != nil {
+			if ctx.Err() == nil {
+				r.logger.Error("Failed to launch remediation run", map[string]interface{}{
+					"error": err.Error(),
+				})
+			}
+			return
+		}
+		if !launched {
+			return
+		}
+	}
+}
+
+// launch launches a run's job template and records the job, or schedules
+// another attempt
+func (r *Runner) launch(ctx context.Context, run *models.RemediationRun) error {
+
+	fields := map[string]interface{}{
+		"run_id":      run.ID.String(),
+		"session_id":  run.AuditLogID.String(),
+		"trigger":     run.Trigger,
+		"template_id": run.TemplateID,
+	}
+
+	run.Attempts++
+	jobID, ignored, err := r.client.launch(ctx, run.TemplateID, run.ExtraVars)
+	if err != nil && ctx.Err() != nil {
+		// Shutting down; leave the run queued as it was
+		return err
+	}
+	if err != nil {
+		msg := err.Error()
+		run.Error = &msg
+		fields["attempt"] = run.Attempts
+		fields["error"] = msg
+
+		if isPermanent(err) || run.Attempts >= maxLaunchAttempts {
+			now := time.Now()
+			run.Status = models.RemediationStatusFailed
+			run.FinishedAt = &now
+			jobsFailed.Add(1)
+			r.logger.Error("Failed to launch remediation job", fields)
+			return nil
+		}
+
+		backoff := min(retryBackoff<<(run.Attempts-1), maxBackoff)
+		run.NextAttemptAt = time.Now().Add(backoff)
+		fields["retry_in"] = backoff.String()
+		r.logger.Warn("Failed to launch remediation job; will retry", fields)
+		return nil
+	}
+
+	jobURL := r.client.jobURL(jobID)
+	run.Status = models.RemediationStatusRunning
+	run.AWXJobID = &jobID
+	run.JobURL = &jobURL
+	run.Error = nil
+	jobsLaunched.Add(1)
+
+	fields["awx_job_id"] = jobID
+	r.logger.Info("Remediation job launched", fields)
+	if len(ignored) > 0 {
+		sort.Strings(ignored)
+		fields["ignored_fields"] = ignored
+		r.logger.Warn("AWX ignored launch fields; enable prompt on launch for extra variables in the job template", fields)
+	}
+	return nil
+}
+
+// poll checks on running jobs and records the outcome of those that finished
+func (r *Runner) poll(ctx context.Context) {
+	runs, err := r.store.ListRunning(ctx, pollBatch)
+	if err != nil {
+		if ctx.Err() == nil {
+			r.logger.Error("Failed to list running remediation runs", map[string]interface{}{
+				"error": err.Error(),
+			})
+		}
+		return
+	}
+
+	for _, run := range runs {
+		if ctx.Err() != nil {
+			return
+		}
+		if err := r.check(ctx, run); err != nil && ctx.Err() == nil {
+			r.logger.Warn("Failed to check remediation job", map[string]interface{}{
+				"run_id": run.ID.String(),
+				"error":  err.Error(),
+			})
+		}
+	}
+}
+
+// check records the outcome of a run's job once it has finished
+func (r *Runner) check(ctx context.Context, run *models.RemediationRun) error {
+	if run.AWXJobID == nil {
+		return fmt.Errorf("run has no job")
+	}
+
+	j, err := r.client.job(ctx, *run.AWXJobID)
+	if err != nil {
+		// Check the others first next time
+		if touchErr := r.store.Touch(ctx, run.ID); touchErr != nil {
+			return touchErr
+		}
+		return err
+	}
+	if !j.finished() {
+		return r.store.Touch(ctx, run.ID)
+	}
+
+	status := models.RemediationStatusSuccessful
+	var errMsg *string
+	switch j.Status {
+	case "canceled":
+		status = models.RemediationStatusCanceled
+	case "failed", "error":
+		status = models.RemediationStatusFailed
+		msg := "AWX job " + j.Status
+		if j.Explanation != "" {
+			msg += ": " + j.Explanation
+		}
+		errMsg = &msg
+		jobsFailed.Add(1)
+	}
+
+	if err := r.store.Finish(ctx, run.ID, status, errMsg); err != nil {
+		return err
+	}
+
+	fields := map[string]interface{}{
+		"run_id":     run.ID.String(),
+		"session_id": run.AuditLogID.String(),
+		"awx_job_id": *run.AWXJobID,
+		"status":     status,
+	}
+	if status == models.RemediationStatusSuccessful {
+		r.logger.Info("Remediation job finished", fields)
+	} else {
+		r.logger.Warn("Remediation job did not succeed", fields)
+	}
+	return nil
+}
+
+func (r *Runner) skip(event *models.Event, err error) {
+	r.logger.Warn("Skipping malformed event in remediation", map[string]interface{}{
+		"event_id": event.ID,
+		"type":     event.Type,
+		"error":    err.Error(),
+	})
+}
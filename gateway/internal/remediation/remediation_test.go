@@ -0,0 +1,470 @@
+package remediation
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/VanCannon/openpam/gateway/internal/models"
+	"github.com/VanCannon/openpam/pkg/logger"
+	"github.com/google/uuid"
+)
+
+func init() {
+	retryBackoff = time.Millisecond
+}
+
+// memoryEvents is an EventSource backed by a slice ordered by ID
+type memoryEvents []*models.Event
+
+func (m memoryEvents) ListSince(ctx context.Context, afterID int64, limit int) ([]*models.Event, error) {
+	var result []*models.Event
+	for _, event := range m {
+		if event.ID > afterID && len(result) < limit {
+			result = append(result, event)
+		}
+	}
+	return result, nil
+}
+
+func (m memoryEvents) LatestID(ctx context.Context) (int64, error) {
+	if len(m) == 0 {
+		return 0, nil
+	}
+	return m[len(m)-1].ID, nil
+}
+
+// memoryCursor is a CursorStore holding one position
+type memoryCursor struct {
+	lastID int64
+}
+
+func (m *memoryCursor) Advance(ctx context.Context, name string, fn func(int64) (int64, error)) (bool, error) {
+	next, err := fn(m.lastID)
+	if err != nil {
+		return true, err
+	}
+	m.lastID = next
+	return true, nil
+}
+
+// memoryStore is a Store keeping runs in creation order
+type memoryStore struct {
+	runs []*models.RemediationRun
+}
+
+func (m *memoryStore) Create(ctx context.Context, run *models.RemediationRun) error {
+	for _, existing := range m.runs {
+		if existing.EventID == run.EventID {
+			return nil
+		}
+	}
+	run.ID = uuid.New()
+	run.Status = models.RemediationStatusQueued
+	run.NextAttemptAt = time.Now()
+	copy := *run
+	m.runs = append(m.runs, &copy)
+	return nil
+}
+
+func (m *memoryStore) Launch(ctx context.Context, fn func(*models.RemediationRun) error) (bool, error) {
+	for _, run := range m.runs {
+		if run.Status != models.RemediationStatusQueued || run.NextAttemptAt.After(time.Now()) {
+			continue
+		}
+		locked := *run
+		if err := fn(&locked); err != nil {
+			return true, err
+		}
+		*run = locked
+		return true, nil
+	}
+	return false, nil
+}
+
+func (m *memoryStore) ListRunning(ctx context.Context, limit int) ([]*models.RemediationRun, error) {
+	var runs []*models.RemediationRun
+	for _, run := range m.runs {
+		if run.Status == models.RemediationStatusRunning && len(runs) < limit {
+			copy := *run
+			runs = append(runs, &copy)
+		}
+	}
+	return runs, nil
+}
+
+func (m *memoryStore) Finish(ctx context.Context, id uuid.UUID, status string, errMsg *string) error {
+	for _, run := range m.runs {
+		if run.ID == id && run.Status == models.RemediationStatusRunning {
+			now := time.Now()
+			run.Status = status
+			run.Error = errMsg
+			run.FinishedAt = &now
+		}
+	}
+	return nil
+}
+
+func (m *memoryStore) Touch(ctx context.Context, id uuid.UUID) error {
+	return nil
+}
+
+// memoryDirectory looks up sessions, targets and users from maps
+type memoryDirectory struct {
+	sessions map[uuid.UUID]*models.AuditLog
+	targets  map[uuid.UUID]*models.Target
+	users    map[uuid.UUID]*models.User
+}
+
+type sessionLookup memoryDirectory
+type targetLookup memoryDirectory
+type userLookup memoryDirectory
+
+func (d *sessionLookup) GetByID(ctx context.Context, id uuid.UUID) (*models.AuditLog, error) {
+	if log, ok := d.sessions[id]; ok {
+		return log, nil
+	}
+	return nil, fmt.Errorf("audit log not found")
+}
+
+func (d *targetLookup) GetByID(ctx context.Context, id uuid.UUID) (*models.Target, error) {
+	if target, ok := d.targets[id]; ok {
+		return target, nil
+	}
+	return nil, fmt.Errorf("target not found")
+}
+
+func (d *userLookup) GetByID(ctx context.Context, id uuid.UUID) (*models.User, error) {
+	if user, ok := d.users[id]; ok {
+		return user, nil
+	}
+	return nil, fmt.Errorf("user not found")
+}
+
+// awx is a fake AWX API. launchStatus decides the response to the n-th
+// launch; jobs holds the status reported for each launched job.
+type awx struct {
+	mu           sync.Mutex
+	launches     []map[string]interface{} // Extra vars of each launch
+	templates    []int
+	auth         string
+	jobs         map[int64]string
+	launchStatus func(n int) int
+}
+
+func newAWX(t *testing.T) (*awx, *httptest.Server) {
+	a := &awx{jobs: make(map[int64]string)}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		a.mu.Lock()
+		defer a.mu.Unlock()
+		a.auth = r.Header.Get("Authorization")
+
+		path := strings.Trim(r.URL.Path, "/")
+		parts := strings.Split(path, "/")
+
+		switch {
+		case r.Method == http.MethodPost && len(parts) == 5 && parts[2] == "job_templates" && parts[4] == "launch":
+			status := http.StatusCreated
+			if a.launchStatus != nil {
+				status = a.launchStatus(len(a.launches) + 1)
+			}
+			var body struct {
+				ExtraVars map[string]interface{} `json:"extra_vars"`
+			}
+			if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+				t.Errorf("bad launch body: %v", err)
+			}
+			template, _ := strconv.Atoi(parts[3])
+			a.launches = append(a.launches, body.ExtraVars)
+			a.templates = append(a.templates, template)
+			if status != http.StatusCreated {
+				w.WriteHeader(status)
+				return
+			}
+
+			id := int64(100 + len(a.launches))
+			a.jobs[id] = "pending"
+			w.WriteHeader(http.StatusCreated)
+			json.NewEncoder(w).Encode(map[string]interface{}{"job": id, "id": id})
+
+		case r.Method == http.MethodGet && len(parts) == 4 && parts[2] == "jobs":
+			id, _ := strconv.ParseInt(parts[3], 10, 64)
+			status, ok := a.jobs[id]
+			if !ok {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			json.NewEncoder(w).Encode(map[string]interface{}{"id": id, "status": status})
+
+		default:
+			t.Errorf("unexpected request %s %s", r.Method, r.URL.Path)
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	t.Cleanup(srv.Close)
+	return a, srv
+}
+
+func (a *awx) setStatus(id int64, status string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.jobs[id] = status
+}
+
+func event(t *testing.T, id int64, eventType string, payload interface{}) *models.Event {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &models.Event{ID: id, Type: eventType, Payload: data, CreatedAt: time.Now()}
+}
+
+// fixture is a session that ended with a policy violation
+type fixture struct {
+	session *models.AuditLog
+	dir     *memoryDirectory
+	events  memoryEvents
+}
+
+func newFixture(t *testing.T) *fixture {
+	user := &models.User{ID: uuid.New(), Email: "alice@example.com"}
+	target := &models.Target{ID: uuid.New(), Name: "db-1", Hostname: "db-1.internal", Port: 22}
+	start := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	session := &models.AuditLog{
+		ID:            uuid.New(),
+		UserID:        user.ID,
+		TargetID:      target.ID,
+		StartTime:     start,
+		EndTime:       sql.NullTime{Time: start.Add(time.Hour), Valid: true},
+		SessionStatus: models.SessionStatusCompleted,
+		Protocol:      models.ProtocolSSH,
+	}
+
+	active := *session
+	active.SessionStatus = models.SessionStatusActive
+	active.EndTime = sql.NullTime{}
+
+	resourceType := "session"
+	details := `{"rule":"aws-keys"}`
+	violation := &models.SystemAuditLog{
+		ID:           uuid.New(),
+		EventType:    models.EventTypePolicyViolation,
+		ResourceType: &resourceType,
+		ResourceID:   uuid.NullUUID{UUID: session.ID, Valid: true},
+		Action:       models.ViolationDLPMatch,
+		Status:       models.AuditStatusFailure,
+		Details:      &details,
+	}
+
+	return &fixture{
+		session: session,
+		dir: &memoryDirectory{
+			sessions: map[uuid.UUID]*models.AuditLog{session.ID: session},
+			targets:  map[uuid.UUID]*models.Target{target.ID: target},
+			users:    map[uuid.UUID]*models.User{user.ID: user},
+		},
+		events: memoryEvents{
+			event(t, 1, "system.login_success", map[string]string{}),
+			event(t, 2, models.StreamEventSessionStarted, &active),
+			event(t, 3, models.StreamEventSystemPrefix+models.EventTypePolicyViolation, violation),
+			event(t, 4, models.StreamEventSessionPrefix+models.SessionStatusCompleted, session),
+		},
+	}
+}
+
+func newTestRunner(t *testing.T, url string, f *fixture, cursor *memoryCursor, store *memoryStore) *Runner {
+	r, err := NewRunner(Config{
+		URL:                url,
+		Token:              "secret",
+		SessionEndTemplate: 10,
+		ViolationTemplate:  20,
+	}, f.events, cursor, store,
+		(*sessionLookup)(f.dir), (*targetLookup)(f.dir), (*userLookup)(f.dir),
+		logger.New(logger.LevelError, io.Discard))
+	if err != nil {
+		t.Fatalf("NewRunner: %v", err)
+	}
+	return r
+}
+
+func TestRunner_LaunchesAndTracksJobs(t *testing.T) {
+	a, srv := newAWX(t)
+	f := newFixture(t)
+	store := &memoryStore{}
+	cursor := &memoryCursor{lastID: 1}
+	r := newTestRunner(t, srv.URL, f, cursor, store)
+
+	r.tick(context.Background())
+
+	if cursor.lastID != 4 {
+		t.Errorf("cursor = %d, want 4", cursor.lastID)
+	}
+	if a.auth != "Bearer secret" {
+		t.Errorf("Authorization = %q", a.auth)
+	}
+	if len(a.launches) != 2 || a.templates[0] != 20 || a.templates[1] != 10 {
+		t.Fatalf("launched templates %v, want [20 10]", a.templates)
+	}
+
+	violation := a.launches[0]
+	for key, want := range map[string]interface{}{
+		"openpam_trigger":           models.RemediationTriggerViolation,
+		"openpam_violation_type":    models.ViolationDLPMatch,
+		"openpam_violation_rule":    "aws-keys",
+		"openpam_violation_blocked": true,
+		"openpam_session_id":        f.session.ID.String(),
+	} {
+		if violation[key] != want {
+			t.Errorf("violation %s = %v, want %v", key, violation[key], want)
+		}
+	}
+
+	ended := a.launches[1]
+	for key, want := range map[string]interface{}{
+		"openpam_trigger":         models.RemediationTriggerSessionEnd,
+		"openpam_session_id":      f.session.ID.String(),
+		"openpam_session_status":  models.SessionStatusCompleted,
+		"openpam_protocol":        models.ProtocolSSH,
+		"openpam_user_email":      "alice@example.com",
+		"openpam_target_name":     "db-1",
+		"openpam_target_hostname": "db-1.internal",
+		"openpam_target_port":     float64(22),
+		"openpam_start_time":      "2024-05-01T10:00:00Z",
+		"openpam_end_time":        "2024-05-01T11:00:00Z",
+	} {
+		if ended[key] != want {
+			t.Errorf("session end %s = %v, want %v", key, ended[key], want)
+		}
+	}
+
+	for _, run := range store.runs {
+		if run.Status != models.RemediationStatusRunning || run.AWXJobID == nil || run.JobURL == nil {
+			t.Fatalf("run %+v not running", run)
+		}
+		if run.AuditLogID != f.session.ID {
+			t.Errorf("run tracked against %s, want session %s", run.AuditLogID, f.session.ID)
+		}
+	}
+	if want := srv.URL + "/#/jobs/playbook/101/output"; *store.runs[0].JobURL != want {
+		t.Errorf("job URL = %s, want %s", *store.runs[0].JobURL, want)
+	}
+
+	// Jobs that haven't finished stay running
+	r.tick(context.Background())
+	if store.runs[0].Status != models.RemediationStatusRunning {
+		t.Errorf("status = %s before the job finished", store.runs[0].Status)
+	}
+
+	a.setStatus(101, "successful")
+	a.setStatus(102, "error")
+	r.tick(context.Background())
+
+	if store.runs[0].Status != models.RemediationStatusSuccessful || store.runs[0].FinishedAt == nil {
+		t.Errorf("violation run status = %s, want successful", store.runs[0].Status)
+	}
+	if store.runs[1].Status != models.RemediationStatusFailed || store.runs[1].Error == nil {
+		t.Errorf("session end run status = %s, want failed with an error", store.runs[1].Status)
+	}
+	if len(a.launches) != 2 {
+		t.Errorf("%d launches, want events to launch once", len(a.launches))
+	}
+}
+
+func TestRunner_RetriesLaunch(t *testing.T) {
+	a, srv := newAWX(t)
+	f := newFixture(t)
+	f.events = f.events[:3] // The violation only
+	store := &memoryStore{}
+	r := newTestRunner(t, srv.URL, f, &memoryCursor{lastID: 1}, store)
+
+	a.launchStatus = func(n int) int {
+		if n == 1 {
+			return http.StatusServiceUnavailable
+		}
+		return http.StatusCreated
+	}
+
+	r.tick(context.Background())
+	run := store.runs[0]
+	if run.Status != models.RemediationStatusQueued || run.Attempts != 1 || run.Error == nil {
+		t.Fatalf("after a failed launch: status %s, attempts %d", run.Status, run.Attempts)
+	}
+
+	time.Sleep(5 * time.Millisecond)
+	r.tick(context.Background())
+	run = store.runs[0]
+	if run.Status != models.RemediationStatusRunning || run.Attempts != 2 || run.Error != nil {
+		t.Errorf("after a retry: status %s, attempts %d", run.Status, run.Attempts)
+	}
+}
+
+func TestRunner_FailsRefusedLaunch(t *testing.T) {
+	a, srv := newAWX(t)
+	f := newFixture(t)
+	store := &memoryStore{}
+	r := newTestRunner(t, srv.URL, f, &memoryCursor{lastID: 1}, store)
+
+	a.launchStatus = func(n int) int { return http.StatusBadRequest }
+
+	r.tick(context.Background())
+	r.tick(context.Background())
+
+	if len(a.launches) != 2 {
+		t.Errorf("%d launches, want refused launches not to be retried", len(a.launches))
+	}
+	for _, run := range store.runs {
+		if run.Status != models.RemediationStatusFailed || run.FinishedAt == nil {
+			t.Errorf("status = %s, want failed", run.Status)
+		}
+	}
+}
+
+func TestRunner_StartsAtEndOfLog(t *testing.T) {
+	a, srv := newAWX(t)
+	f := newFixture(t)
+	store := &memoryStore{}
+	cursor := &memoryCursor{}
+	r := newTestRunner(t, srv.URL, f, cursor, store)
+
+	r.tick(context.Background())
+
+	if cursor.lastID != 4 {
+		t.Errorf("cursor = %d, want the latest event", cursor.lastID)
+	}
+	if len(store.runs) != 0 || len(a.launches) != 0 {
+		t.Errorf("events from before remediation was enabled launched %d jobs", len(a.launches))
+	}
+}
+
+func TestConfig_Validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  Config
+		wantErr bool
+	}{
+		{"disabled", Config{}, false},
+		{"valid", Config{URL: "https://awx.example.com", Token: "t", SessionEndTemplate: 1}, false},
+		{"no token", Config{URL: "https://awx.example.com", SessionEndTemplate: 1}, true},
+		{"no template", Config{URL: "https://awx.example.com", Token: "t"}, true},
+		{"negative template", Config{URL: "https://awx.example.com", Token: "t", SessionEndTemplate: 1, ViolationTemplate: -1}, true},
+		{"bad URL", Config{URL: "awx.example.com", Token: "t", SessionEndTemplate: 1}, true},
+		{"missing CA file", Config{URL: "https://awx.example.com", Token: "t", SessionEndTemplate: 1, CAFile: "/nonexistent"}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.config.Validate(); (err != nil) != tt.wantErr {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
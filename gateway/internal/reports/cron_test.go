@@ -0,0 +1,84 @@
+package reports
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseCron_Invalid(t *testing.T) {
+	tests := []string{
+		"",
+		"* * * *",
+		"60 * * * *",
+		"* 24 * * *",
+		"* * 0 * *",
+		"* * * 13 *",
+		"* * * * 8",
+		"*/0 * * * *",
+		"5-1 * * * *",
+		"a * * * *",
+		"@yearly",
+	}
+
+	for _, expr := range tests {
+		t.Run(expr, func(t *testing.T) {
+			if _, err := ParseCron(expr); err == nil {
+				t.Errorf("ParseCron(%q) expected error", expr)
+			}
+		})
+	}
+}
+
+func TestCron_Next(t *testing.T) {
+	// Wednesday
+	from := time.Date(2024, 1, 10, 10, 30, 0, 0, time.UTC)
+
+	tests := []struct {
+		expr string
+		want time.Time
+	}{
+		{expr: "* * * * *", want: time.Date(2024, 1, 10, 10, 31, 0, 0, time.UTC)},
+		{expr: "*/15 * * * *", want: time.Date(2024, 1, 10, 10, 45, 0, 0, time.UTC)},
+		{expr: "0 9 * * *", want: time.Date(2024, 1, 11, 9, 0, 0, 0, time.UTC)},
+		{expr: "0 8 * * mon", want: time.Date(2024, 1, 15, 8, 0, 0, 0, time.UTC)},
+		{expr: "0 8 * * 1-5", want: time.Date(2024, 1, 11, 8, 0, 0, 0, time.UTC)},
+		{expr: "0 0 * * 7", want: time.Date(2024, 1, 14, 0, 0, 0, 0, time.UTC)},
+		{expr: "@weekly", want: time.Date(2024, 1, 15, 0, 0, 0, 0, time.UTC)},
+		{expr: "@monthly", want: time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC)},
+		{expr: "0 6 1 jan,jul *", want: time.Date(2024, 7, 1, 6, 0, 0, 0, time.UTC)},
+		{expr: "0 0 29 2 *", want: time.Date(2024, 2, 29, 0, 0, 0, 0, time.UTC)},
+		// Day of month and day of week are ORed when both are restricted
+		{expr: "0 0 13 * fri", want: time.Date(2024, 1, 12, 0, 0, 0, 0, time.UTC)},
+		{expr: "0 0 30 2 *", want: time.Time{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			c, err := ParseCron(tt.expr)
+			if err != nil {
+				t.Fatalf("ParseCron() error = %v", err)
+			}
+			if got := c.Next(from); !got.Equal(tt.want) {
+				t.Errorf("Next() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCron_NextInLocation(t *testing.T) {
+	loc, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Skip("time zone database not available")
+	}
+
+	c, err := ParseCron("0 9 * * *")
+	if err != nil {
+		t.Fatalf("ParseCron() error = %v", err)
+	}
+
+	got := c.Next(time.Date(2024, 1, 10, 15, 0, 0, 0, time.UTC).In(loc))
+	want := time.Date(2024, 1, 11, 14, 0, 0, 0, time.UTC)
+	if !got.Equal(want) {
+		t.Errorf("Next() = %v, want %v", got, want)
+	}
+}
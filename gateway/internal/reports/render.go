@@ -0,0 +1,196 @@
+package reports
+
+import (
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+// Table is the rendered content of a report
+type Table struct {
+	Title    string
+	Subtitle string
+	Columns  []string
+	Rows     [][]string
+}
+
+// RenderCSV renders the table as CSV with a header row
+func RenderCSV(table *Table) ([]byte, error) {
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+
+	if err := w.Write(table.Columns); err != nil {
+		return nil, fmt.Errorf("failed to write CSV header: %w", err)
+	}
+	for _, row := range table.Rows {
+		if err := w.Write(sanitizeCSVRow(row)); err != nil {
+			return nil, fmt.Errorf("failed to write CSV row: %w", err)
+		}
+	}
+
+	w.Flush()
+	if err := w.Error(); err != nil {
+		return nil, fmt.Errorf("failed to write CSV: %w", err)
+	}
+
+	return buf.Bytes(), nil
+}
+
+// sanitizeCSVRow prefixes cells that a spreadsheet would evaluate as a formula.
+// Report data includes user-controlled values such as display names.
+func sanitizeCSVRow(row []string) []string {
+	out := make([]string, len(row))
+	for i, cell := range row {
+		if cell != "" && strings.ContainsRune("=+-@\t\r", rune(cell[0])) {
+			cell = "'" + cell
+		}
+		out[i] = cell
+	}
+	return out
+}
+
+// PDF layout: landscape A4 in points, monospaced so columns line up without
+// font metrics
+const (
+	pdfPageWidth     = 842
+	pdfPageHeight    = 595
+	pdfMargin        = 36
+	pdfFontSize      = 7
+	pdfLineHeight    = 9
+	pdfMaxCellChars  = 40
+	pdfColumnPadding = 2
+
+	// pdfLineChars is how many characters fit across the page; Courier glyphs are
+	// 0.6 of the font size wide
+	pdfLineChars = (pdfPageWidth - 2*pdfMargin) * 10 / (6 * pdfFontSize)
+)
+
+// RenderPDF renders the table as a simple paginated PDF. Columns are sized to
+// their content, long cells are truncated and columns that don't fit the page
+// width are cut off; the CSV format has the complete data.
+func RenderPDF(table *Table) ([]byte, error) {
+	widths := make([]int, len(table.Columns))
+	for i, col := range table.Columns {
+		widths[i] = min(utf8.RuneCountInString(col), pdfMaxCellChars)
+	}
+	for _, row := range table.Rows {
+		for i := range widths {
+			if i < len(row) {
+				widths[i] = max(widths[i], min(utf8.RuneCountInString(row[i]), pdfMaxCellChars))
+			}
+		}
+	}
+
+	formatRow := func(cells []string) string {
+		var b strings.Builder
+		for i, width := range widths {
+			cell := ""
+			if i < len(cells) {
+				cell = cells[i]
+			}
+			if utf8.RuneCountInString(cell) > width {
+				cell = string([]rune(cell)[:width-1]) + "~"
+			}
+			b.WriteString(cell)
+			b.WriteString(strings.Repeat(" ", width-utf8.RuneCountInString(cell)+pdfColumnPadding))
+		}
+		line := strings.TrimRight(b.String(), " ")
+		if utf8.RuneCountInString(line) > pdfLineChars {
+			line = string([]rune(line)[:pdfLineChars])
+		}
+		return line
+	}
+
+	header := []string{table.Title}
+	if table.Subtitle != "" {
+		header = append(header, table.Subtitle)
+	}
+	header = append(header, "", formatRow(table.Columns), strings.Repeat("-", min(pdfLineChars, len(formatRow(table.Columns)))))
+
+	linesPerPage := (pdfPageHeight-2*pdfMargin)/pdfLineHeight - len(header) - 2
+	var pages [][]string
+	for start := 0; start < len(table.Rows) || start == 0; start += linesPerPage {
+		end := min(start+linesPerPage, len(table.Rows))
+		page := append([]string{}, header...)
+		for _, row := range table.Rows[start:end] {
+			page = append(page, formatRow(row))
+		}
+		pages = append(pages, page)
+		if end == len(table.Rows) {
+			break
+		}
+	}
+
+	return writePDF(pages), nil
+}
+
+// writePDF writes pages of text lines as a PDF document
+func writePDF(pages [][]string) []byte {
+	var buf bytes.Buffer
+	var offsets []int
+
+	// Objects 1-3 are the catalog, page tree and font; each page then takes a
+	// page object and a content stream
+	object := func(body string) {
+		offsets = append(offsets, buf.Len())
+		fmt.Fprintf(&buf, "%d 0 obj\n%s\nendobj\n", len(offsets), body)
+	}
+
+	buf.WriteString("%PDF-1.4\n")
+
+	kids := make([]string, len(pages))
+	for i := range pages {
+		kids[i] = fmt.Sprintf("%d 0 R", 4+2*i)
+	}
+
+	object("<< /Type /Catalog /Pages 2 0 R >>")
+	object(fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>", strings.Join(kids, " "), len(pages)))
+	object("<< /Type /Font /Subtype /Type1 /BaseFont /Courier /Encoding /WinAnsiEncoding >>")
+
+	for i, lines := range pages {
+		var content strings.Builder
+		fmt.Fprintf(&content, "BT\n/F1 %d Tf\n%d TL\n%d %d Td\n", pdfFontSize, pdfLineHeight, pdfMargin, pdfPageHeight-pdfMargin-pdfFontSize)
+		for _, line := range lines {
+			fmt.Fprintf(&content, "(%s) '\n", pdfEscape(line))
+		}
+		content.WriteString("ET\n")
+		fmt.Fprintf(&content, "BT\n/F1 %d Tf\n%d %d Td\n(%s) Tj\nET\n", pdfFontSize, pdfPageWidth-pdfMargin-80, pdfMargin/2, pdfEscape(fmt.Sprintf("Page %d of %d", i+1, len(pages))))
+
+		object(fmt.Sprintf("<< /Type /Page /Parent 2 0 R /MediaBox [0 0 %d %d] /Resources << /Font << /F1 3 0 R >> >> /Contents %d 0 R >>",
+			pdfPageWidth, pdfPageHeight, 5+2*i))
+		object(fmt.Sprintf("<< /Length %d >>\nstream\n%sendstream", content.Len(), content.String()))
+	}
+
+	xref := buf.Len()
+	fmt.Fprintf(&buf, "xref\n0 %d\n0000000000 65535 f \n", len(offsets)+1)
+	for _, offset := range offsets {
+		fmt.Fprintf(&buf, "%010d 00000 n \n", offset)
+	}
+	fmt.Fprintf(&buf, "trailer\n<< /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(offsets)+1, xref)
+
+	return buf.Bytes()
+}
+
+// pdfEscape escapes a string for a PDF literal. Characters outside Latin-1 can't
+// be shown with the standard fonts and are replaced.
+func pdfEscape(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		switch {
+		case r == '(' || r == ')' || r == '\\':
+			b.WriteByte('\\')
+			b.WriteRune(r)
+		case r < 0x20:
+			b.WriteByte(' ')
+		case r < 0x80:
+			b.WriteRune(r)
+		case r <= 0xff:
+			fmt.Fprintf(&b, "\\%03o", r)
+		default:
+			b.WriteByte('?')
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,80 @@
+package reports
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"strconv"
+	"testing"
+)
+
+func TestRenderCSV_NeutralisesFormulas(t *testing.T) {
+	table := &Table{
+		Columns: []string{"Email", "Name"},
+		Rows: [][]string{
+			{"alice@example.com", "=HYPERLINK(\"http://evil\")"},
+			{"bob@example.com", "Bob"},
+		},
+	}
+
+	data, err := RenderCSV(table)
+	if err != nil {
+		t.Fatalf("RenderCSV() error = %v", err)
+	}
+
+	want := "Email,Name\nalice@example.com,\"'=HYPERLINK(\"\"http://evil\"\")\"\nbob@example.com,Bob\n"
+	if string(data) != want {
+		t.Errorf("RenderCSV() =\n%s\nwant\n%s", data, want)
+	}
+}
+
+func TestRenderPDF_Paginates(t *testing.T) {
+	table := &Table{Title: "Access Review (Q1)", Columns: []string{"Email", "Role"}}
+	for i := 0; i < 200; i++ {
+		table.Rows = append(table.Rows, []string{fmt.Sprintf("user%d@example.com", i), "user"})
+	}
+
+	data, err := RenderPDF(table)
+	if err != nil {
+		t.Fatalf("RenderPDF() error = %v", err)
+	}
+
+	if !bytes.HasPrefix(data, []byte("%PDF-1.4\n")) || !bytes.HasSuffix(data, []byte("%%EOF\n")) {
+		t.Fatal("output is not a complete PDF document")
+	}
+
+	count := regexp.MustCompile(`/Count (\d+)`).FindSubmatch(data)
+	if count == nil {
+		t.Fatal("page tree not found")
+	}
+	if pages, _ := strconv.Atoi(string(count[1])); pages < 2 {
+		t.Errorf("200 rows rendered on %d pages, want several", pages)
+	}
+
+	if !bytes.Contains(data, []byte(`(Access Review \(Q1\)) '`)) {
+		t.Error("title not escaped in content stream")
+	}
+
+	// The cross-reference offsets must point at the objects
+	xref := regexp.MustCompile(`startxref\n(\d+)`).FindSubmatch(data)
+	offset, _ := strconv.Atoi(string(xref[1]))
+	if !bytes.HasPrefix(data[offset:], []byte("xref\n")) {
+		t.Error("startxref does not point at the xref table")
+	}
+	for i, m := range regexp.MustCompile(`(\d{10}) 00000 n`).FindAllSubmatch(data, -1) {
+		objOffset, _ := strconv.Atoi(string(m[1]))
+		if !bytes.HasPrefix(data[objOffset:], []byte(fmt.Sprintf("%d 0 obj", i+1))) {
+			t.Errorf("xref entry %d does not point at object %d", i+1, i+1)
+		}
+	}
+}
+
+func TestRenderPDF_Empty(t *testing.T) {
+	data, err := RenderPDF(&Table{Title: "Empty", Columns: []string{"Email"}})
+	if err != nil {
+		t.Fatalf("RenderPDF() error = %v", err)
+	}
+	if !bytes.Contains(data, []byte("/Count 1")) {
+		t.Error("empty report should still render one page")
+	}
+}
@@ -0,0 +1,298 @@
+package reports
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/VanCannon/openpam/gateway/internal/models"
+	"github.com/VanCannon/openpam/gateway/internal/notify"
+	"github.com/VanCannon/openpam/gateway/internal/worker"
+	"github.com/VanCannon/openpam/pkg/logger"
+	"github.com/google/uuid"
+)
+
+const (
+	// defaultLookback is the period covered by a report's first run
+	defaultLookback = 7 * 24 * time.Hour
+
+	// runTimeout bounds generating and sending a single report
+	runTimeout = 5 * time.Minute
+)
+
+// Store is the subset of the report repository the scheduler needs
+type Store interface {
+	Source
+	ClaimDue(ctx context.Context, now time.Time, next func(*models.ScheduledReport) (*time.Time, error)) ([]*models.ScheduledReport, error)
+	CreateRun(ctx context.Context, run *models.ReportRun) error
+	FinishRun(ctx context.Context, run *models.ReportRun) error
+}
+
+// AuditRecorder records system audit events
+type AuditRecorder interface {
+	CreateSimple(ctx context.Context, eventType string, userID *uuid.UUID, action string, status string, ipAddress *string, details map[string]interface{}) error
+}
+
+// NextRun returns the first run time of the report after t
+func NextRun(report *models.ScheduledReport, t time.Time) (*time.Time, error) {
+	cron, err := ParseCron(report.CronExpression)
+	if err != nil {
+		return nil, err
+	}
+
+	loc, err := time.LoadLocation(report.Timezone)
+	if err != nil {
+		return nil, fmt.Errorf("invalid timezone: %s", report.Timezone)
+	}
+
+	next := cron.Next(t.In(loc))
+	if next.IsZero() {
+		return nil, fmt.Errorf("cron expression never matches")
+	}
+
+	next = next.UTC()
+	return &next, nil
+}
+
+// Scheduler runs due reports and emails them to their recipients.
+//
+// Due reports are claimed with row locks, so with several gateway replicas each
+// run happens on exactly one of them. Every run is recorded in the run history;
+// failed runs are also recorded as system audit events and alerted by email.
+type Scheduler struct {
+	store           Store
+	notifier        notify.Notifier
+	audit           AuditRecorder
+	interval        time.Duration
+	alertRecipients []string
+	logger          *logger.Logger
+
+	loop worker.Loop
+}
+
+// NewScheduler creates a scheduler that checks for due reports every interval.
+// Failure alerts go to alertRecipients, or to the report's own recipients if none
+// are configured.
+func NewScheduler(store Store, notifier notify.Notifier, audit AuditRecorder, interval time.Duration, alertRecipients []string, log *logger.Logger) *Scheduler {
+	if interval <= 0 {
+		interval = time.Minute
+	}
+
+	return &Scheduler{
+		store:           store,
+		notifier:        notifier,
+		audit:           audit,
+		interval:        interval,
+		alertRecipients: alertRecipients,
+		logger:          log,
+	}
+}
+
+// Start runs the scheduler in the background until Stop is called
+func (s *Scheduler) Start() {
+	s.loop.Start(s.run)
+}
+
+// Stop stops the scheduler and waits for in-progress runs to finish.
+// It is safe to call even if the scheduler was never started.
+func (s *Scheduler) Stop() {
+	s.loop.Stop()
+}
+
+func (s *Scheduler) run() {
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.loop.Stopping():
+			return
+		case <-ticker.C:
+			s.runDue(time.Now())
+		}
+	}
+}
+
+// runDue claims and runs every report due at now
+func (s *Scheduler) runDue(now time.Time) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	reports, err := s.store.ClaimDue(ctx, now, func(report *models.ScheduledReport) (*time.Time, error) {
+		next, err := NextRun(report, now)
+		if err != nil {
+			s.logger.Error("Disabling report with invalid schedule", map[string]interface{}{
+				"report_id": report.ID.String(),
+				"cron":      report.CronExpression,
+				"timezone":  report.Timezone,
+				"error":     err.Error(),
+			})
+		}
+		return next, err
+	})
+	cancel()
+
+	if err != nil {
+		s.logger.Error("Failed to claim due reports", map[string]interface{}{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	for _, report := range reports {
+		s.execute(report, now)
+	}
+}
+
+// execute generates and sends one report and records the run
+func (s *Scheduler) execute(report *models.ScheduledReport, now time.Time) {
+	ctx, cancel := context.WithTimeout(context.Background(), runTimeout)
+	defer cancel()
+
+	run := &models.ReportRun{
+		ReportID:    report.ID,
+		Status:      models.ReportRunStatusRunning,
+		PeriodStart: periodStart(report, now),
+		PeriodEnd:   now,
+	}
+
+	if err := s.store.CreateRun(ctx, run); err != nil {
+		s.logger.Error("Failed to record report run", map[string]interface{}{
+			"report_id": report.ID.String(),
+			"error":     err.Error(),
+		})
+	}
+
+	rows, err := s.deliver(ctx, report, run)
+	run.RowCount = rows
+	if err != nil {
+		msg := err.Error()
+		run.Status = models.ReportRunStatusFailed
+		run.ErrorMessage = &msg
+		s.alert(ctx, report, run)
+	} else {
+		run.Status = models.ReportRunStatusSucceeded
+		s.logger.Info("Scheduled report sent", map[string]interface{}{
+			"report_id":  report.ID.String(),
+			"name":       report.Name,
+			"rows":       rows,
+			"recipients": len(report.Recipients),
+		})
+	}
+
+	if err := s.store.FinishRun(ctx, run); err != nil {
+		s.logger.Error("Failed to record report run result", map[string]interface{}{
+			"report_id": report.ID.String(),
+			"run_id":    run.ID.String(),
+			"error":     err.Error(),
+		})
+	}
+}
+
+// deliver renders the report for the run's period and emails it, returning the row count
+func (s *Scheduler) deliver(ctx context.Context, report *models.ScheduledReport, run *models.ReportRun) (int, error) {
+	loc, err := time.LoadLocation(report.Timezone)
+	if err != nil {
+		return 0, fmt.Errorf("invalid timezone: %s", report.Timezone)
+	}
+
+	table, err := Generate(ctx, s.store, report, run.PeriodStart, run.PeriodEnd, loc)
+	if err != nil {
+		return 0, fmt.Errorf("failed to generate report: %w", err)
+	}
+
+	data, contentType, err := Render(report.Format, table)
+	if err != nil {
+		return len(table.Rows), fmt.Errorf("failed to render report: %w", err)
+	}
+
+	msg := &notify.Message{
+		To:      report.Recipients,
+		Subject: fmt.Sprintf("OpenPAM report: %s", report.Name),
+		Body: fmt.Sprintf("The scheduled report %q is attached.\n\nPeriod: %s\nRows: %d\n",
+			report.Name, table.Subtitle, len(table.Rows)),
+		Attachments: []notify.Attachment{{
+			Filename:    fmt.Sprintf("%s-%s.%s", filenameSlug(report.Name), run.PeriodEnd.In(loc).Format("2006-01-02"), report.Format),
+			ContentType: contentType,
+			Data:        data,
+		}},
+	}
+
+	if err := s.notifier.Send(ctx, msg); err != nil {
+		return len(table.Rows), fmt.Errorf("failed to send report: %w", err)
+	}
+
+	return len(table.Rows), nil
+}
+
+// alert reports a failed run in the log, the system audit log and by email
+func (s *Scheduler) alert(ctx context.Context, report *models.ScheduledReport, run *models.ReportRun) {
+	s.logger.Error("Scheduled report failed", map[string]interface{}{
+		"report_id": report.ID.String(),
+		"name":      report.Name,
+		"run_id":    run.ID.String(),
+		"error":     *run.ErrorMessage,
+	})
+
+	err := s.audit.CreateSimple(ctx, models.EventTypeReportFailed, report.CreatedBy,
+		"Scheduled report failed", models.AuditStatusFailure, nil,
+		map[string]interface{}{
+			"report_id":   report.ID.String(),
+			"report_name": report.Name,
+			"run_id":      run.ID.String(),
+			"error":       *run.ErrorMessage,
+		},
+	)
+	if err != nil {
+		s.logger.Error("Failed to record report failure", map[string]interface{}{
+			"report_id": report.ID.String(),
+			"error":     err.Error(),
+		})
+	}
+
+	recipients := s.alertRecipients
+	if len(recipients) == 0 {
+		recipients = report.Recipients
+	}
+
+	msg := &notify.Message{
+		To:      recipients,
+		Subject: fmt.Sprintf("OpenPAM report failed: %s", report.Name),
+		Body: fmt.Sprintf("The scheduled report %q could not be delivered.\n\nRun: %s\nError: %s\n",
+			report.Name, run.ID, *run.ErrorMessage),
+	}
+	if err := s.notifier.Send(ctx, msg); err != nil {
+		s.logger.Error("Failed to send report failure alert", map[string]interface{}{
+			"report_id": report.ID.String(),
+			"error":     err.Error(),
+		})
+	}
+}
+
+// periodStart is where the report period begins: the previous run, or the
+// lookback before now for the first run
+func periodStart(report *models.ScheduledReport, now time.Time) time.Time {
+	if report.LastRunAt != nil {
+		return *report.LastRunAt
+	}
+
+	lookback := defaultLookback
+	if report.Filters.Lookback != "" {
+		if d, err := time.ParseDuration(report.Filters.Lookback); err == nil && d > 0 {
+			lookback = d
+		}
+	}
+
+	return now.Add(-lookback)
+}
+
+var nonFilenameChars = regexp.MustCompile(`[^a-z0-9]+`)
+
+// filenameSlug turns a report name into a safe attachment filename
+func filenameSlug(name string) string {
+	slug := strings.Trim(nonFilenameChars.ReplaceAllString(strings.ToLower(name), "-"), "-")
+	if slug == "" {
+		return "report"
+	}
+	return slug
+}
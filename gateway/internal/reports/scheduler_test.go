@@ -0,0 +1,191 @@
+package reports
+
+import (
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/VanCannon/openpam/gateway/internal/models"
+	"github.com/VanCannon/openpam/gateway/internal/notify"
+	"github.com/VanCannon/openpam/pkg/logger"
+	"github.com/google/uuid"
+)
+
+type fakeStore struct {
+	due      []*models.ScheduledReport
+	nextRuns map[uuid.UUID]*time.Time
+	runs     []*models.ReportRun
+	sessions []*models.SessionActivityEntry
+	from, to time.Time
+}
+
+func (f *fakeStore) AccessReview(ctx context.Context, from, to time.Time, filters models.ReportFilters) ([]*models.AccessReviewEntry, error) {
+	return nil, nil
+}
+
+func (f *fakeStore) SessionActivity(ctx context.Context, from, to time.Time, filters models.ReportFilters) ([]*models.SessionActivityEntry, error) {
+	f.from, f.to = from, to
+	return f.sessions, nil
+}
+
+func (f *fakeStore) SystemAudit(ctx context.Context, from, to time.Time, filters models.ReportFilters) ([]*models.SystemAuditEntry, error) {
+	return nil, errors.New("database unavailable")
+}
+
+func (f *fakeStore) ClaimDue(ctx context.Context, now time.Time, next func(*models.ScheduledReport) (*time.Time, error)) ([]*models.ScheduledReport, error) {
+	f.nextRuns = make(map[uuid.UUID]*time.Time)
+	for _, report := range f.due {
+		f.nextRuns[report.ID], _ = next(report)
+	}
+	due := f.due
+	f.due = nil
+	return due, nil
+}
+
+func (f *fakeStore) CreateRun(ctx context.Context, run *models.ReportRun) error {
+	run.ID = uuid.New()
+	f.runs = append(f.runs, run)
+	return nil
+}
+
+func (f *fakeStore) FinishRun(ctx context.Context, run *models.ReportRun) error {
+	return nil
+}
+
+type fakeNotifier struct {
+	sent []*notify.Message
+	err  error
+}
+
+func (f *fakeNotifier) Send(ctx context.Context, msg *notify.Message) error {
+	f.sent = append(f.sent, msg)
+	return f.err
+}
+
+type fakeAudit struct {
+	events []string
+}
+
+func (f *fakeAudit) CreateSimple(ctx context.Context, eventType string, userID *uuid.UUID, action string, status string, ipAddress *string, details map[string]interface{}) error {
+	f.events = append(f.events, eventType)
+	return nil
+}
+
+func TestScheduler_SendsDueReport(t *testing.T) {
+	now := time.Date(2024, 1, 15, 8, 0, 0, 0, time.UTC)
+	lastRun := now.Add(-7 * 24 * time.Hour)
+
+	report := &models.ScheduledReport{
+		ID:             uuid.New(),
+		Name:           "Weekly Session Activity",
+		ReportType:     models.ReportTypeSessionActivity,
+		Format:         models.ReportFormatCSV,
+		CronExpression: "0 8 * * mon",
+		Timezone:       "UTC",
+		Recipients:     []string{"auditor@example.com"},
+		LastRunAt:      &lastRun,
+	}
+	store := &fakeStore{
+		due: []*models.ScheduledReport{report},
+		sessions: []*models.SessionActivityEntry{
+			{StartTime: now.Add(-time.Hour), UserEmail: "alice@example.com", TargetName: "web-01", Protocol: "ssh", SessionStatus: "completed",
+				Annotations: []string{"[00:01:05] sudo su - (auditor@example.com)"}},
+		},
+	}
+	notifier := &fakeNotifier{}
+	audit := &fakeAudit{}
+
+	s := NewScheduler(store, notifier, audit, time.Minute, nil, logger.New(logger.LevelError, io.Discard))
+	s.runDue(now)
+
+	if want := now.Add(7 * 24 * time.Hour); !store.nextRuns[report.ID].Equal(want) {
+		t.Errorf("next run = %v, want %v", store.nextRuns[report.ID], want)
+	}
+	if !store.from.Equal(lastRun) || !store.to.Equal(now) {
+		t.Errorf("report period = %v to %v, want %v to %v", store.from, store.to, lastRun, now)
+	}
+
+	if len(store.runs) != 1 || store.runs[0].Status != models.ReportRunStatusSucceeded || store.runs[0].RowCount != 1 {
+		t.Fatalf("unexpected runs: %+v", store.runs)
+	}
+
+	if len(notifier.sent) != 1 {
+		t.Fatalf("sent %d messages, want 1", len(notifier.sent))
+	}
+	attachment := notifier.sent[0].Attachments[0]
+	if attachment.Filename != "weekly-session-activity-2024-01-15.csv" {
+		t.Errorf("filename = %q", attachment.Filename)
+	}
+	if !strings.Contains(string(attachment.Data), "alice@example.com,web-01") {
+		t.Errorf("attachment missing session row:\n%s", attachment.Data)
+	}
+	if !strings.Contains(string(attachment.Data), "[00:01:05] sudo su - (auditor@example.com)") {
+		t.Errorf("attachment missing session annotations:\n%s", attachment.Data)
+	}
+
+	if len(audit.events) != 0 {
+		t.Errorf("unexpected audit events: %v", audit.events)
+	}
+}
+
+func TestScheduler_AlertsOnFailure(t *testing.T) {
+	now := time.Date(2024, 1, 15, 8, 0, 0, 0, time.UTC)
+
+	report := &models.ScheduledReport{
+		ID:             uuid.New(),
+		Name:           "System Audit",
+		ReportType:     models.ReportTypeSystemAudit,
+		Format:         models.ReportFormatPDF,
+		CronExpression: "@daily",
+		Timezone:       "UTC",
+		Recipients:     []string{"auditor@example.com"},
+	}
+	store := &fakeStore{due: []*models.ScheduledReport{report}}
+	notifier := &fakeNotifier{}
+	audit := &fakeAudit{}
+
+	s := NewScheduler(store, notifier, audit, time.Minute, []string{"secops@example.com"}, logger.New(logger.LevelError, io.Discard))
+	s.runDue(now)
+
+	if len(store.runs) != 1 || store.runs[0].Status != models.ReportRunStatusFailed {
+		t.Fatalf("unexpected runs: %+v", store.runs)
+	}
+	if store.runs[0].ErrorMessage == nil || !strings.Contains(*store.runs[0].ErrorMessage, "database unavailable") {
+		t.Errorf("error message = %v", store.runs[0].ErrorMessage)
+	}
+	if want := now.Add(-defaultLookback); !store.runs[0].PeriodStart.Equal(want) {
+		t.Errorf("first run period start = %v, want %v", store.runs[0].PeriodStart, want)
+	}
+
+	if len(audit.events) != 1 || audit.events[0] != models.EventTypeReportFailed {
+		t.Errorf("audit events = %v, want [%s]", audit.events, models.EventTypeReportFailed)
+	}
+
+	if len(notifier.sent) != 1 || notifier.sent[0].To[0] != "secops@example.com" {
+		t.Fatalf("expected a failure alert to secops@example.com, got %+v", notifier.sent)
+	}
+}
+
+func TestNextRun_Timezone(t *testing.T) {
+	if _, err := time.LoadLocation("Europe/Berlin"); err != nil {
+		t.Skip("time zone database not available")
+	}
+
+	report := &models.ScheduledReport{CronExpression: "0 9 * * *", Timezone: "Europe/Berlin"}
+
+	next, err := NextRun(report, time.Date(2024, 1, 10, 12, 0, 0, 0, time.UTC))
+	if err != nil {
+		t.Fatalf("NextRun() error = %v", err)
+	}
+	if want := time.Date(2024, 1, 11, 8, 0, 0, 0, time.UTC); !next.Equal(want) {
+		t.Errorf("NextRun() = %v, want %v", next, want)
+	}
+
+	report.Timezone = "Mars/Olympus_Mons"
+	if _, err := NextRun(report, time.Now()); err == nil {
+		t.Error("expected error for unknown timezone")
+	}
+}
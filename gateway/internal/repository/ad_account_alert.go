@@ -0,0 +1,53 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/VanCannon/openpam/gateway/internal/database"
+)
+
+// ADAccountAlertRepository remembers which AD accounts were alerted on
+type ADAccountAlertRepository struct {
+	db *database.DB
+}
+
+// NewADAccountAlertRepository creates a new AD account alert repository
+func NewADAccountAlertRepository(db *database.DB) *ADAccountAlertRepository {
+	return &ADAccountAlertRepository{db: db}
+}
+
+// ListADAccountAlerts returns, per AD user ID, the time the last alert of
+// kind on the account was about
+func (r *ADAccountAlertRepository) ListADAccountAlerts(ctx context.Context, kind string) (map[string]time.Time, error) {
+	var rows []struct {
+		ADUserID string    `db:"ad_user_id"`
+		Since    time.Time `db:"since"`
+	}
+	if err := r.db.SelectContext(ctx, &rows, `SELECT ad_user_id, since FROM ad_account_alerts WHERE kind = $1`, kind); err != nil {
+		return nil, fmt.Errorf("failed to list AD account alerts: %w", err)
+	}
+
+	alerts := make(map[string]time.Time, len(rows))
+	for _, row := range rows {
+		alerts[row.ADUserID] = row.Since
+	}
+	return alerts, nil
+}
+
+// MarkADAccountAlerted records that an AD account was alerted on about since
+func (r *ADAccountAlertRepository) MarkADAccountAlerted(ctx context.Context, kind, adUserID string, since, at time.Time) error {
+	query := `
+		INSERT INTO ad_account_alerts (kind, ad_user_id, since, alerted_at)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (kind, ad_user_id) DO UPDATE
+		SET since = EXCLUDED.since, alerted_at = EXCLUDED.alerted_at
+	`
+
+	if _, err := r.db.ExecContext(ctx, query, kind, adUserID, since, at); err != nil {
+		return fmt.Errorf("failed to mark AD account alerted: %w", err)
+	}
+
+	return nil
+}
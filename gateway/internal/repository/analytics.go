@@ -0,0 +1,263 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/VanCannon/openpam/gateway/internal/database"
+	"github.com/VanCannon/openpam/gateway/internal/models"
+	"github.com/google/uuid"
+)
+
+// analyticsLock is the advisory lock held while a replica refreshes the
+// analytics views
+const analyticsLock = 0x6f70616e // "opan"
+
+// AnalyticsRepository reads the pre-aggregated analytics views and refreshes them
+type AnalyticsRepository struct {
+	db *database.DB
+}
+
+// NewAnalyticsRepository creates a new analytics repository
+func NewAnalyticsRepository(db *database.DB) *AnalyticsRepository {
+	return &AnalyticsRepository{db: db}
+}
+
+// AnalyticsFilter narrows session use to a period and, optionally, a target, the
+// targets of a zone or the members of a group
+type AnalyticsFilter struct {
+	From     time.Time
+	To       time.Time
+	TargetID *uuid.UUID
+	ZoneID   *uuid.UUID
+	GroupID  string
+}
+
+// where returns the conditions and arguments of a filter on
+// analytics_session_hours h joined with targets t
+func (f AnalyticsFilter) where() (string, []interface{}) {
+	args := []interface{}{f.From, f.To}
+	query := " WHERE h.hour >= $1 AND h.hour < $2"
+
+	if f.TargetID != nil {
+		args = append(args, *f.TargetID)
+		query += fmt.Sprintf(" AND h.target_id = $%d", len(args))
+	}
+	if f.ZoneID != nil {
+		args = append(args, *f.ZoneID)
+		query += fmt.Sprintf(" AND t.zone_id = $%d", len(args))
+	}
+	if f.GroupID != "" {
+		args = append(args, f.GroupID)
+		query += fmt.Sprintf(" AND h.user_id IN (SELECT user_id FROM group_members WHERE group_id = $%d)", len(args))
+	}
+	return query, args
+}
+
+// Refresh refreshes every analytics view and records when. Views are refreshed
+// concurrently, so they can be read meanwhile, except for their first fill.
+// When another replica is refreshing them it returns nil.
+func (r *AnalyticsRepository) Refresh(ctx context.Context) ([]models.AnalyticsRefresh, error) {
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	var locked bool
+	if err := tx.GetContext(ctx, &locked, `SELECT pg_try_advisory_xact_lock($1)`, analyticsLock); err != nil {
+		return nil, fmt.Errorf("failed to lock analytics: %w", err)
+	}
+	if !locked {
+		return nil, nil
+	}
+
+	refreshes := make([]models.AnalyticsRefresh, 0, len(models.AnalyticsViews))
+	for _, view := range models.AnalyticsViews {
+		var populated bool
+		if err := tx.GetContext(ctx, &populated, `SELECT ispopulated FROM pg_matviews WHERE matviewname = $1`, view); err != nil {
+			return nil, fmt.Errorf("failed to look up %s: %w", view, err)
+		}
+
+		// Only a filled view can be refreshed concurrently
+		refresh := `REFRESH MATERIALIZED VIEW ` + view
+		if populated {
+			refresh = `REFRESH MATERIALIZED VIEW CONCURRENTLY ` + view
+		}
+
+		started := time.Now()
+		if _, err := tx.ExecContext(ctx, refresh); err != nil {
+			return nil, fmt.Errorf("failed to refresh %s: %w", view, err)
+		}
+
+		done := models.AnalyticsRefresh{
+			View:        view,
+			RefreshedAt: time.Now(),
+			DurationMS:  int(time.Since(started).Milliseconds()),
+		}
+		_, err := tx.ExecContext(ctx, `
+			INSERT INTO analytics_refreshes (view_name, refreshed_at, duration_ms)
+			VALUES ($1, $2, $3)
+			ON CONFLICT (view_name) DO UPDATE
+			SET refreshed_at = EXCLUDED.refreshed_at, duration_ms = EXCLUDED.duration_ms
+		`, done.View, done.RefreshedAt, done.DurationMS)
+		if err != nil {
+			return nil, fmt.Errorf("failed to record refresh of %s: %w", view, err)
+		}
+		refreshes = append(refreshes, done)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return refreshes, nil
+}
+
+// Refreshes returns when each analytics view was last refreshed. Views never
+// refreshed are left out.
+func (r *AnalyticsRepository) Refreshes(ctx context.Context) ([]models.AnalyticsRefresh, error) {
+	var refreshes []models.AnalyticsRefresh
+	err := r.db.SelectContext(ctx, &refreshes, `
+		SELECT view_name, refreshed_at, duration_ms
+		FROM analytics_refreshes
+		ORDER BY view_name
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list analytics refreshes: %w", err)
+	}
+
+	return refreshes, nil
+}
+
+// Hours returns the session use of each UTC hour matching filter that had any,
+// in order
+func (r *AnalyticsRepository) Hours(ctx context.Context, filter AnalyticsFilter) ([]models.UsageHour, error) {
+	where, args := filter.where()
+	query := `
+		SELECT h.hour, SUM(h.sessions)::INT AS sessions, SUM(h.seconds)::BIGINT AS seconds
+		FROM analytics_session_hours h
+		JOIN targets t ON t.id = h.target_id
+	` + where + `
+		GROUP BY h.hour
+		ORDER BY h.hour
+	`
+
+	var hours []models.UsageHour
+	if err := r.db.SelectContext(ctx, &hours, query, args...); err != nil {
+		return nil, fmt.Errorf("failed to list usage hours: %w", err)
+	}
+
+	return hours, nil
+}
+
+// Targets returns the session use of the limit most-used targets matching
+// filter, by session time
+func (r *AnalyticsRepository) Targets(ctx context.Context, filter AnalyticsFilter, limit int) ([]models.TargetUsage, error) {
+	where, args := filter.where()
+	args = append(args, limit)
+	query := `
+		SELECT t.id AS target_id, t.name AS target_name, t.zone_id,
+		       SUM(h.sessions)::INT AS sessions, SUM(h.seconds)::BIGINT AS seconds,
+		       COUNT(DISTINCT h.user_id)::INT AS users
+		FROM analytics_session_hours h
+		JOIN targets t ON t.id = h.target_id
+	` + where + fmt.Sprintf(`
+		GROUP BY t.id, t.name, t.zone_id
+		ORDER BY seconds DESC, t.name
+		LIMIT $%d
+	`, len(args))
+
+	var targets []models.TargetUsage
+	if err := r.db.SelectContext(ctx, &targets, query, args...); err != nil {
+		return nil, fmt.Errorf("failed to list target usage: %w", err)
+	}
+
+	return targets, nil
+}
+
+// Groups returns the session use of each group's current members from from
+// until to, most used first. Groups without members are left out.
+func (r *AnalyticsRepository) Groups(ctx context.Context, from, to time.Time) ([]models.GroupUsage, error) {
+	var groups []models.GroupUsage
+	err := r.db.SelectContext(ctx, &groups, `
+		SELECT g.id AS group_id, g.name AS group_name,
+		       COUNT(DISTINCT m.user_id)::INT AS members,
+		       COUNT(DISTINCT h.user_id)::INT AS users,
+		       COUNT(DISTINCT h.target_id)::INT AS targets,
+		       COALESCE(SUM(h.sessions), 0)::INT AS sessions,
+		       COALESCE(SUM(h.seconds), 0)::BIGINT AS seconds
+		FROM groups g
+		JOIN group_members m ON m.group_id = g.id
+		LEFT JOIN analytics_session_hours h ON h.user_id = m.user_id AND h.hour >= $1 AND h.hour < $2
+		GROUP BY g.id, g.name
+		ORDER BY seconds DESC, g.name
+	`, from, to)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list group usage: %w", err)
+	}
+
+	return groups, nil
+}
+
+// GroupHours returns the session use of each group's current members in each
+// UTC hour from from until to that they had any
+func (r *AnalyticsRepository) GroupHours(ctx context.Context, from, to time.Time) ([]models.GroupUsageHour, error) {
+	var hours []models.GroupUsageHour
+	err := r.db.SelectContext(ctx, &hours, `
+		SELECT m.group_id, h.hour, SUM(h.sessions)::INT AS sessions, SUM(h.seconds)::BIGINT AS seconds
+		FROM analytics_session_hours h
+		JOIN group_members m ON m.user_id = h.user_id
+		WHERE h.hour >= $1 AND h.hour < $2
+		GROUP BY m.group_id, h.hour
+		ORDER BY m.group_id, h.hour
+	`, from, to)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list group usage hours: %w", err)
+	}
+
+	return hours, nil
+}
+
+// Turnaround returns how long decisions on access requests took per zone,
+// over the UTC days from the one of from up to the one of to
+func (r *AnalyticsRepository) Turnaround(ctx context.Context, from, to time.Time) ([]models.ApprovalTurnaround, error) {
+	var zones []models.ApprovalTurnaround
+	err := r.db.SelectContext(ctx, &zones, `
+		SELECT d.zone_id, z.name AS zone_name,
+		       SUM(d.approved)::INT AS approved,
+		       SUM(d.rejected)::INT AS rejected,
+		       (SUM(d.total_seconds) / NULLIF(SUM(d.approved + d.rejected), 0))::BIGINT AS average_seconds,
+		       MAX(d.max_seconds)::BIGINT AS max_seconds,
+		       SUM(d.within_15m)::INT AS within_15m,
+		       SUM(d.within_1h)::INT AS within_1h,
+		       SUM(d.within_4h)::INT AS within_4h,
+		       SUM(d.within_1d)::INT AS within_1d
+		FROM analytics_approval_days d
+		JOIN zones z ON z.id = d.zone_id
+		WHERE d.day >= $1::DATE AND d.day < $2::DATE
+		GROUP BY d.zone_id, z.name
+		ORDER BY z.name
+	`, from.UTC().Format(time.DateOnly), to.UTC().AddDate(0, 0, 1).Format(time.DateOnly))
+	if err != nil {
+		return nil, fmt.Errorf("failed to list approval turnaround: %w", err)
+	}
+
+	return zones, nil
+}
+
+// Pending returns how many access requests await a decision, and since when
+func (r *AnalyticsRepository) Pending(ctx context.Context) (*models.PendingRequests, error) {
+	var pending models.PendingRequests
+	err := r.db.GetContext(ctx, &pending, `
+		SELECT COUNT(*)::INT AS count, MIN(created_at) AS oldest
+		FROM schedules
+		WHERE approval_status = $1
+	`, models.ApprovalStatusPending)
+	if err != nil {
+		return nil, fmt.Errorf("failed to count pending requests: %w", err)
+	}
+
+	return &pending, nil
+}
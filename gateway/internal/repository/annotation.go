@@ -0,0 +1,153 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/VanCannon/openpam/gateway/internal/actor"
+	"github.com/VanCannon/openpam/gateway/internal/database"
+	"github.com/VanCannon/openpam/gateway/internal/models"
+	"github.com/google/uuid"
+)
+
+// AnnotationRepository handles session annotations and bookmarks
+type AnnotationRepository struct {
+	db *database.DB
+}
+
+// NewAnnotationRepository creates a new annotation repository
+func NewAnnotationRepository(db *database.DB) *AnnotationRepository {
+	return &AnnotationRepository{db: db}
+}
+
+const annotationColumns = `
+	n.id, n.audit_log_id, n.author_id, u.email AS author_email, n.kind, n.offset_ms,
+	n.label, n.note, n.created_at, n.updated_at
+`
+
+// Create creates a new annotation
+func (r *AnnotationRepository) Create(ctx context.Context, annotation *models.SessionAnnotation) error {
+	query := `
+		INSERT INTO session_annotations (id, audit_log_id, author_id, kind, offset_ms, label, note, created_at, updated_at, created_by, updated_by)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $10)
+	`
+
+	annotation.ID = uuid.New()
+	annotation.CreatedAt = time.Now()
+	annotation.UpdatedAt = annotation.CreatedAt
+
+	_, err := r.db.ExecContext(ctx, query,
+		annotation.ID,
+		annotation.AuditLogID,
+		annotation.AuthorID,
+		annotation.Kind,
+		annotation.OffsetMs,
+		annotation.Label,
+		annotation.Note,
+		annotation.CreatedAt,
+		annotation.UpdatedAt,
+		actor.UserID(ctx),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to create annotation: %w", err)
+	}
+
+	return nil
+}
+
+// GetByID retrieves an annotation by ID
+func (r *AnnotationRepository) GetByID(ctx context.Context, id uuid.UUID) (*models.SessionAnnotation, error) {
+	query := `
+		SELECT ` + annotationColumns + `
+		FROM session_annotations n
+		LEFT JOIN users u ON n.author_id = u.id
+		WHERE n.id = $1
+	`
+
+	var annotation models.SessionAnnotation
+	err := r.db.GetContext(ctx, &annotation, query, id)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("annotation not found")
+		}
+		return nil, fmt.Errorf("failed to get annotation: %w", err)
+	}
+
+	return &annotation, nil
+}
+
+// ListBySession retrieves the annotations of a session in playback order
+func (r *AnnotationRepository) ListBySession(ctx context.Context, auditLogID uuid.UUID) ([]*models.SessionAnnotation, error) {
+	query := `
+		SELECT ` + annotationColumns + `
+		FROM session_annotations n
+		LEFT JOIN users u ON n.author_id = u.id
+		WHERE n.audit_log_id = $1
+		ORDER BY n.offset_ms, n.created_at
+	`
+
+	var annotations []*models.SessionAnnotation
+	err := r.db.SelectContext(ctx, &annotations, query, auditLogID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list annotations: %w", err)
+	}
+
+	return annotations, nil
+}
+
+// Update updates the position and text of an annotation
+func (r *AnnotationRepository) Update(ctx context.Context, annotation *models.SessionAnnotation) error {
+	query := `
+		UPDATE session_annotations
+		SET offset_ms = $1, label = $2, note = $3, updated_at = $4, updated_by = $6
+		WHERE id = $5
+	`
+
+	annotation.UpdatedAt = time.Now()
+
+	result, err := r.db.ExecContext(ctx, query,
+		annotation.OffsetMs,
+		annotation.Label,
+		annotation.Note,
+		annotation.UpdatedAt,
+		annotation.ID,
+		actor.UserID(ctx),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to update annotation: %w", err)
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+
+	if rows == 0 {
+		return fmt.Errorf("annotation not found")
+	}
+
+	return nil
+}
+
+// Delete deletes an annotation
+func (r *AnnotationRepository) Delete(ctx context.Context, id uuid.UUID) error {
+	query := `DELETE FROM session_annotations WHERE id = $1`
+
+	result, err := r.db.ExecContext(ctx, query, id)
+	if err != nil {
+		return fmt.Errorf("failed to delete annotation: %w", err)
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+
+	if rows == 0 {
+		return fmt.Errorf("annotation not found")
+	}
+
+	return nil
+}
@@ -0,0 +1,139 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/VanCannon/openpam/gateway/internal/database"
+	"github.com/VanCannon/openpam/gateway/internal/models"
+	"github.com/google/uuid"
+)
+
+// APIKeyRepository handles API key data operations
+type APIKeyRepository struct {
+	db *database.DB
+}
+
+// NewAPIKeyRepository creates a new API key repository
+func NewAPIKeyRepository(db *database.DB) *APIKeyRepository {
+	return &APIKeyRepository{db: db}
+}
+
+// Create creates a new API key
+func (r *APIKeyRepository) Create(ctx context.Context, key *models.APIKey) error {
+	query := `
+		INSERT INTO api_keys (id, name, key_prefix, key_hash, user_id, role, created_at, expires_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+	`
+
+	key.ID = uuid.New()
+	key.CreatedAt = time.Now()
+
+	_, err := r.db.ExecContext(ctx, query,
+		key.ID,
+		key.Name,
+		key.KeyPrefix,
+		key.KeyHash,
+		key.UserID,
+		key.Role,
+		key.CreatedAt,
+		key.ExpiresAt,
+	)
+
+	if err != nil {
+		return fmt.Errorf("failed to create API key: %w", err)
+	}
+
+	return nil
+}
+
+// GetByHash retrieves an API key by the hash of its value
+func (r *APIKeyRepository) GetByHash(ctx context.Context, hash string) (*models.APIKey, error) {
+	query := `
+		SELECT id, name, key_prefix, key_hash, user_id, role, created_at, expires_at, last_used_at, revoked_at
+		FROM api_keys
+		WHERE key_hash = $1
+	`
+
+	var key models.APIKey
+	err := r.db.GetContext(ctx, &key, query, hash)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("API key not found")
+		}
+		return nil, fmt.Errorf("failed to get API key: %w", err)
+	}
+
+	return &key, nil
+}
+
+// GetByID retrieves an API key by ID
+func (r *APIKeyRepository) GetByID(ctx context.Context, id uuid.UUID) (*models.APIKey, error) {
+	query := `
+		SELECT id, name, key_prefix, key_hash, user_id, role, created_at, expires_at, last_used_at, revoked_at
+		FROM api_keys
+		WHERE id = $1
+	`
+
+	var key models.APIKey
+	err := r.db.GetContext(ctx, &key, query, id)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("API key not found")
+		}
+		return nil, fmt.Errorf("failed to get API key: %w", err)
+	}
+
+	return &key, nil
+}
+
+// List retrieves all API keys, newest first
+func (r *APIKeyRepository) List(ctx context.Context) ([]*models.APIKey, error) {
+	query := `
+		SELECT id, name, key_prefix, key_hash, user_id, role, created_at, expires_at, last_used_at, revoked_at
+		FROM api_keys
+		ORDER BY created_at DESC
+	`
+
+	var keys []*models.APIKey
+	err := r.db.SelectContext(ctx, &keys, query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list API keys: %w", err)
+	}
+
+	return keys, nil
+}
+
+// TouchLastUsed records that a key was just used
+func (r *APIKeyRepository) TouchLastUsed(ctx context.Context, id uuid.UUID) error {
+	query := `UPDATE api_keys SET last_used_at = $1 WHERE id = $2`
+
+	if _, err := r.db.ExecContext(ctx, query, time.Now(), id); err != nil {
+		return fmt.Errorf("failed to update API key last used: %w", err)
+	}
+
+	return nil
+}
+
+// Revoke revokes an API key
+func (r *APIKeyRepository) Revoke(ctx context.Context, id uuid.UUID) error {
+	query := `UPDATE api_keys SET revoked_at = $1 WHERE id = $2 AND revoked_at IS NULL`
+
+	result, err := r.db.ExecContext(ctx, query, time.Now(), id)
+	if err != nil {
+		return fmt.Errorf("failed to revoke API key: %w", err)
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+
+	if rows == 0 {
+		return fmt.Errorf("API key not found")
+	}
+
+	return nil
+}
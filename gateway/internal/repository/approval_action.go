@@ -0,0 +1,84 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/VanCannon/openpam/gateway/internal/database"
+	"github.com/VanCannon/openpam/gateway/internal/models"
+	"github.com/google/uuid"
+)
+
+// ApprovalActionRepository handles approval link data operations
+type ApprovalActionRepository struct {
+	db *database.DB
+}
+
+// NewApprovalActionRepository creates a new approval action repository
+func NewApprovalActionRepository(db *database.DB) *ApprovalActionRepository {
+	return &ApprovalActionRepository{db: db}
+}
+
+// Create stores a new approval action
+func (r *ApprovalActionRepository) Create(ctx context.Context, action *models.ApprovalAction) error {
+	query := `
+		INSERT INTO approval_actions (id, schedule_id, approver_id, channel, expires_at, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6)
+	`
+
+	action.ID = uuid.New()
+	action.CreatedAt = time.Now()
+
+	_, err := r.db.ExecContext(ctx, query,
+		action.ID,
+		action.ScheduleID,
+		action.ApproverID,
+		action.Channel,
+		action.ExpiresAt,
+		action.CreatedAt,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to create approval action: %w", err)
+	}
+
+	return nil
+}
+
+// GetByID retrieves an approval action by ID
+func (r *ApprovalActionRepository) GetByID(ctx context.Context, id uuid.UUID) (*models.ApprovalAction, error) {
+	query := `
+		SELECT id, schedule_id, approver_id, channel, expires_at, used_at, decision, created_at
+		FROM approval_actions
+		WHERE id = $1
+	`
+
+	var action models.ApprovalAction
+	if err := r.db.GetContext(ctx, &action, query, id); err != nil {
+		return nil, fmt.Errorf("failed to get approval action: %w", err)
+	}
+
+	return &action, nil
+}
+
+// Redeem marks an approval action used for decision. It reports false if the
+// action was already used or has expired, so each link decides at most once.
+func (r *ApprovalActionRepository) Redeem(ctx context.Context, id uuid.UUID, decision string) (bool, error) {
+	query := `
+		UPDATE approval_actions
+		SET used_at = $1, decision = $2
+		WHERE id = $3 AND used_at IS NULL AND expires_at > $1
+	`
+
+	result, err := r.db.ExecContext(ctx, query, time.Now(), decision, id)
+	if err != nil {
+		return false, fmt.Errorf("failed to redeem approval action: %w", err)
+	}
+
+	n, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("failed to get rows affected: %w", err)
+	}
+
+	return n == 1, nil
+}
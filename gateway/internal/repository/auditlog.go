@@ -20,21 +20,28 @@ func NewAuditLogRepository(db *database.DB) *AuditLogRepository {
 	return &AuditLogRepository{db: db}
 }
 
-// Create creates a new audit log entry
+// Create creates a new audit log entry and records a session started event
 func (r *AuditLogRepository) Create(ctx context.Context, log *models.AuditLog) error {
 	query := `
 		INSERT INTO audit_logs (
 			id, user_id, target_id, credential_id, start_time, session_status,
-			client_ip, bytes_sent, bytes_received, created_at
+			client_ip, bytes_sent, bytes_received, purpose, reason, banner_version,
+			banner_acknowledged_at, created_at
 		)
-		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14)
 	`
 
 	log.ID = uuid.New()
 	log.StartTime = time.Now()
 	log.CreatedAt = time.Now()
 
-	_, err := r.db.ExecContext(ctx, query,
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, query,
 		log.ID,
 		log.UserID,
 		log.TargetID,
@@ -44,6 +51,10 @@ func (r *AuditLogRepository) Create(ctx context.Context, log *models.AuditLog) e
 		log.ClientIP,
 		log.BytesSent,
 		log.BytesReceived,
+		log.Purpose,
+		log.Reason,
+		log.BannerVersion,
+		log.BannerAckedAt,
 		log.CreatedAt,
 	)
 
@@ -51,29 +62,121 @@ func (r *AuditLogRepository) Create(ctx context.Context, log *models.AuditLog) e
 		return fmt.Errorf("failed to create audit log: %w", err)
 	}
 
+	if err := appendEvent(ctx, tx, models.StreamEventSessionStarted, log); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
 	return nil
 }
 
-// UpdateStatus updates the status and end time of an audit log
+// Import stores a session recorded elsewhere, such as by a satellite while the
+// hub was unreachable, keeping its ID and times. It records the session's start
+// and end events and reports false if the session was already stored.
+func (r *AuditLogRepository) Import(ctx context.Context, log *models.AuditLog) (bool, error) {
+	query := `
+		INSERT INTO audit_logs (
+			id, user_id, target_id, credential_id, start_time, end_time, session_status,
+			client_ip, bytes_sent, bytes_received, error_message, recording_path,
+			recording_state, recording_error, purpose, reason, metadata, created_at
+		)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, $18)
+		ON CONFLICT (id, start_time) DO NOTHING
+	`
+
+	log.CreatedAt = time.Now()
+	if log.Metadata == nil {
+		log.Metadata = models.JSONB{}
+	}
+
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return false, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	result, err := tx.ExecContext(ctx, query,
+		log.ID,
+		log.UserID,
+		log.TargetID,
+		log.CredentialID,
+		log.StartTime,
+		log.EndTime,
+		log.SessionStatus,
+		log.ClientIP,
+		log.BytesSent,
+		log.BytesReceived,
+		log.ErrorMessage,
+		log.RecordingPath,
+		log.RecordingState,
+		log.RecordingError,
+		log.Purpose,
+		log.Reason,
+		log.Metadata,
+		log.CreatedAt,
+	)
+	if err != nil {
+		return false, fmt.Errorf("failed to import audit log: %w", err)
+	}
+
+	if n, _ := result.RowsAffected(); n == 0 {
+		return false, nil
+	}
+
+	if err := appendEvent(ctx, tx, models.StreamEventSessionStarted, log); err != nil {
+		return false, err
+	}
+	if log.EndTime.Valid {
+		if err := appendEvent(ctx, tx, models.StreamEventSessionPrefix+log.SessionStatus, log); err != nil {
+			return false, err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return false, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return true, nil
+}
+
+// UpdateStatus updates the status and end time of an audit log and records
+// a session event named after the new status. Its metadata is merged into
+// what is stored.
 func (r *AuditLogRepository) UpdateStatus(ctx context.Context, log *models.AuditLog) error {
 	query := `
 		UPDATE audit_logs
 		SET end_time = $1, bytes_sent = $2, bytes_received = $3,
-		    session_status = $4, error_message = $5, recording_path = $6
-		WHERE id = $7
+		    session_status = $4, error_message = $5, recording_path = $6,
+		    recording_state = $7, recording_error = $8, metadata = metadata || $9
+		WHERE id = $10
 	`
 
 	endTime := time.Now()
 	log.EndTime.Time = endTime
 	log.EndTime.Valid = true
+	if log.Metadata == nil {
+		log.Metadata = models.JSONB{}
+	}
 
-	_, err := r.db.ExecContext(ctx, query,
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, query,
 		log.EndTime,
 		log.BytesSent,
 		log.BytesReceived,
 		log.SessionStatus,
 		log.ErrorMessage,
 		log.RecordingPath,
+		log.RecordingState,
+		log.RecordingError,
+		log.Metadata,
 		log.ID,
 	)
 
@@ -81,6 +184,14 @@ func (r *AuditLogRepository) UpdateStatus(ctx context.Context, log *models.Audit
 		return fmt.Errorf("failed to update audit log: %w", err)
 	}
 
+	if err := appendEvent(ctx, tx, models.StreamEventSessionPrefix+log.SessionStatus, log); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
 	return nil
 }
 
@@ -89,7 +200,10 @@ func (r *AuditLogRepository) GetByID(ctx context.Context, id uuid.UUID) (*models
 	query := `
 		SELECT a.id, a.user_id, a.target_id, a.credential_id, a.start_time, a.end_time,
 		       a.bytes_sent, a.bytes_received, a.session_status, a.client_ip,
-		       a.error_message, a.recording_path, a.created_at, t.protocol
+		       a.error_message, a.recording_path, a.recording_state, a.recording_error,
+		       a.purpose, a.reason, a.metadata,
+		       a.banner_version, a.banner_acknowledged_at,
+		       a.created_at, t.protocol
 		FROM audit_logs a
 		JOIN targets t ON a.target_id = t.id
 		WHERE a.id = $1
@@ -109,7 +223,10 @@ func (r *AuditLogRepository) ListByUser(ctx context.Context, userID uuid.UUID, l
 	query := `
 		SELECT a.id, a.user_id, a.target_id, a.credential_id, a.start_time, a.end_time,
 		       a.bytes_sent, a.bytes_received, a.session_status, a.client_ip,
-		       a.error_message, a.recording_path, a.created_at, t.protocol
+		       a.error_message, a.recording_path, a.recording_state, a.recording_error,
+		       a.purpose, a.reason, a.metadata,
+		       a.banner_version, a.banner_acknowledged_at,
+		       a.created_at, t.protocol
 		FROM audit_logs a
 		JOIN targets t ON a.target_id = t.id
 		WHERE a.user_id = $1
@@ -131,7 +248,10 @@ func (r *AuditLogRepository) ListByTarget(ctx context.Context, targetID uuid.UUI
 	query := `
 		SELECT a.id, a.user_id, a.target_id, a.credential_id, a.start_time, a.end_time,
 		       a.bytes_sent, a.bytes_received, a.session_status, a.client_ip,
-		       a.error_message, a.recording_path, a.created_at, t.protocol
+		       a.error_message, a.recording_path, a.recording_state, a.recording_error,
+		       a.purpose, a.reason, a.metadata,
+		       a.banner_version, a.banner_acknowledged_at,
+		       a.created_at, t.protocol
 		FROM audit_logs a
 		JOIN targets t ON a.target_id = t.id
 		WHERE a.target_id = $1
@@ -148,20 +268,88 @@ func (r *AuditLogRepository) ListByTarget(ctx context.Context, targetID uuid.UUI
 	return logs, nil
 }
 
+// LastByTargets retrieves the most recent session of each of the given targets
+func (r *AuditLogRepository) LastByTargets(ctx context.Context, targetIDs []uuid.UUID) ([]*models.AuditLog, error) {
+	query := `
+		SELECT DISTINCT ON (a.target_id)
+		       a.id, a.user_id, a.target_id, a.credential_id, a.start_time, a.end_time,
+		       a.bytes_sent, a.bytes_received, a.session_status, a.client_ip,
+		       a.error_message, a.recording_path, a.recording_state, a.recording_error,
+		       a.purpose, a.reason, a.metadata,
+		       a.banner_version, a.banner_acknowledged_at,
+		       a.created_at, t.protocol
+		FROM audit_logs a
+		JOIN targets t ON a.target_id = t.id
+		WHERE a.target_id = ANY($1::uuid[])
+		ORDER BY a.target_id, a.start_time DESC
+	`
+
+	var logs []*models.AuditLog
+	err := r.db.SelectContext(ctx, &logs, query, uuidArray(targetIDs))
+	if err != nil {
+		return nil, fmt.Errorf("failed to list last sessions by target: %w", err)
+	}
+
+	return logs, nil
+}
+
+// AuditLogFilter narrows Search
+type AuditLogFilter struct {
+	UserID   *uuid.UUID
+	TargetID *uuid.UUID
+	Status   string
+	Purpose  string
+	Reason   string // Matched case-insensitively anywhere in the reason
+	Limit    int
+	Offset   int
+}
+
 // List retrieves all audit logs with pagination
 func (r *AuditLogRepository) List(ctx context.Context, limit, offset int) ([]*models.AuditLog, error) {
+	return r.Search(ctx, AuditLogFilter{Limit: limit, Offset: offset})
+}
+
+// Search retrieves the audit logs matching filter, newest first
+func (r *AuditLogRepository) Search(ctx context.Context, filter AuditLogFilter) ([]*models.AuditLog, error) {
 	query := `
 		SELECT a.id, a.user_id, a.target_id, a.credential_id, a.start_time, a.end_time,
 		       a.bytes_sent, a.bytes_received, a.session_status, a.client_ip,
-		       a.error_message, a.recording_path, a.created_at, t.protocol
+		       a.error_message, a.recording_path, a.recording_state, a.recording_error,
+		       a.purpose, a.reason, a.metadata,
+		       a.banner_version, a.banner_acknowledged_at,
+		       a.created_at, t.protocol
 		FROM audit_logs a
 		JOIN targets t ON a.target_id = t.id
-		ORDER BY a.start_time DESC
-		LIMIT $1 OFFSET $2
+		WHERE 1=1
 	`
+	var args []interface{}
+
+	if filter.UserID != nil {
+		args = append(args, *filter.UserID)
+		query += fmt.Sprintf(" AND a.user_id = $%d", len(args))
+	}
+	if filter.TargetID != nil {
+		args = append(args, *filter.TargetID)
+		query += fmt.Sprintf(" AND a.target_id = $%d", len(args))
+	}
+	if filter.Status != "" {
+		args = append(args, filter.Status)
+		query += fmt.Sprintf(" AND a.session_status = $%d", len(args))
+	}
+	if filter.Purpose != "" {
+		args = append(args, filter.Purpose)
+		query += fmt.Sprintf(" AND a.purpose = $%d", len(args))
+	}
+	if filter.Reason != "" {
+		args = append(args, "%"+filter.Reason+"%")
+		query += fmt.Sprintf(" AND a.reason ILIKE $%d", len(args))
+	}
+
+	args = append(args, filter.Limit, filter.Offset)
+	query += fmt.Sprintf(" ORDER BY a.start_time DESC LIMIT $%d OFFSET $%d", len(args)-1, len(args))
 
 	var logs []*models.AuditLog
-	err := r.db.SelectContext(ctx, &logs, query, limit, offset)
+	err := r.db.SelectContext(ctx, &logs, query, args...)
 	if err != nil {
 		return nil, fmt.Errorf("failed to list audit logs: %w", err)
 	}
@@ -174,7 +362,10 @@ func (r *AuditLogRepository) ListActive(ctx context.Context) ([]*models.AuditLog
 	query := `
 		SELECT a.id, a.user_id, a.target_id, a.credential_id, a.start_time, a.end_time,
 		       a.bytes_sent, a.bytes_received, a.session_status, a.client_ip,
-		       a.error_message, a.recording_path, a.created_at, t.protocol
+		       a.error_message, a.recording_path, a.recording_state, a.recording_error,
+		       a.purpose, a.reason, a.metadata,
+		       a.banner_version, a.banner_acknowledged_at,
+		       a.created_at, t.protocol
 		FROM audit_logs a
 		JOIN targets t ON a.target_id = t.id
 		WHERE a.session_status = $1
@@ -189,3 +380,64 @@ func (r *AuditLogRepository) ListActive(ctx context.Context) ([]*models.AuditLog
 
 	return logs, nil
 }
+
+// ListBetween retrieves the sessions that were open at some point between from
+// and to, including those still active
+func (r *AuditLogRepository) ListBetween(ctx context.Context, from, to time.Time) ([]*models.AuditLog, error) {
+	query := `
+		SELECT a.id, a.user_id, a.target_id, a.credential_id, a.start_time, a.end_time,
+		       a.bytes_sent, a.bytes_received, a.session_status, a.client_ip,
+		       a.error_message, a.recording_path, a.recording_state, a.recording_error,
+		       a.purpose, a.reason, a.metadata,
+		       a.banner_version, a.banner_acknowledged_at,
+		       a.created_at, t.protocol
+		FROM audit_logs a
+		JOIN targets t ON a.target_id = t.id
+		WHERE a.start_time <= $2 AND (a.end_time IS NULL OR a.end_time >= $1)
+		ORDER BY a.start_time
+	`
+
+	var logs []*models.AuditLog
+	err := r.db.SelectContext(ctx, &logs, query, from, to)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list sessions between: %w", err)
+	}
+
+	return logs, nil
+}
+
+// ListUnrecorded retrieves the SSH and RDP sessions started between from and
+// to that ended without a catalogued recording, oldest first. Sessions whose
+// settings turn recording off are left out, as are those that failed before
+// their recording was to start.
+func (r *AuditLogRepository) ListUnrecorded(ctx context.Context, from, to time.Time) ([]*models.AuditLog, error) {
+	query := `
+		SELECT a.id, a.user_id, a.target_id, a.credential_id, a.start_time, a.end_time,
+		       a.bytes_sent, a.bytes_received, a.session_status, a.client_ip,
+		       a.error_message, a.recording_path, a.recording_state, a.recording_error,
+		       a.purpose, a.reason, a.metadata,
+		       a.banner_version, a.banner_acknowledged_at,
+		       a.created_at, t.protocol
+		FROM audit_logs a
+		JOIN targets t ON a.target_id = t.id
+		WHERE a.start_time >= $1 AND a.start_time < $2
+		  AND a.end_time IS NOT NULL
+		  AND t.protocol IN ($3, $4)
+		  AND a.recording_state IS DISTINCT FROM $5
+		  AND (a.recording_state IS DISTINCT FROM $6 OR a.session_status <> $7)
+		  AND NOT EXISTS (SELECT 1 FROM recordings rec WHERE rec.session_id = a.id)
+		ORDER BY a.start_time
+	`
+
+	var logs []*models.AuditLog
+	err := r.db.SelectContext(ctx, &logs, query, from, to,
+		models.ProtocolSSH, models.ProtocolRDP,
+		models.RecordingStateDisabled,
+		models.RecordingStateNotStarted, models.SessionStatusFailed,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list unrecorded sessions: %w", err)
+	}
+
+	return logs, nil
+}
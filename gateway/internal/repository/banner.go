@@ -0,0 +1,64 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/VanCannon/openpam/gateway/internal/database"
+	"github.com/VanCannon/openpam/gateway/internal/models"
+	"github.com/google/uuid"
+)
+
+// BannerRepository handles acknowledgments of pre-session banners
+type BannerRepository struct {
+	db *database.DB
+}
+
+// NewBannerRepository creates a new banner repository
+func NewBannerRepository(db *database.DB) *BannerRepository {
+	return &BannerRepository{db: db}
+}
+
+// Acknowledge records a user accepting a target's banner
+func (r *BannerRepository) Acknowledge(ctx context.Context, ack *models.BannerAcknowledgment) error {
+	query := `
+		INSERT INTO banner_acknowledgments (id, user_id, target_id, banner_version, client_ip, acknowledged_at)
+		VALUES ($1, $2, $3, $4, $5, $6)
+	`
+
+	ack.ID = uuid.New()
+	ack.AcknowledgedAt = time.Now()
+
+	_, err := r.db.ExecContext(ctx, query, ack.ID, ack.UserID, ack.TargetID, ack.BannerVersion, ack.ClientIP, ack.AcknowledgedAt)
+	if err != nil {
+		return fmt.Errorf("failed to record banner acknowledgment: %w", err)
+	}
+
+	return nil
+}
+
+// Latest returns the user's most recent acknowledgment of version of the
+// target's banner given after since, or nil if there is none
+func (r *BannerRepository) Latest(ctx context.Context, userID, targetID uuid.UUID, version string, since time.Time) (*models.BannerAcknowledgment, error) {
+	query := `
+		SELECT id, user_id, target_id, banner_version, client_ip, acknowledged_at
+		FROM banner_acknowledgments
+		WHERE user_id = $1 AND target_id = $2 AND banner_version = $3 AND acknowledged_at > $4
+		ORDER BY acknowledged_at DESC
+		LIMIT 1
+	`
+
+	var ack models.BannerAcknowledgment
+	err := r.db.GetContext(ctx, &ack, query, userID, targetID, version, since)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get banner acknowledgment: %w", err)
+	}
+
+	return &ack, nil
+}
@@ -0,0 +1,96 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/VanCannon/openpam/gateway/internal/database"
+	"github.com/VanCannon/openpam/gateway/internal/models"
+	"github.com/google/uuid"
+)
+
+// CalendarFeedRepository handles users' calendar feeds
+type CalendarFeedRepository struct {
+	db *database.DB
+}
+
+// NewCalendarFeedRepository creates a new calendar feed repository
+func NewCalendarFeedRepository(db *database.DB) *CalendarFeedRepository {
+	return &CalendarFeedRepository{db: db}
+}
+
+// Create gives a user a new feed, replacing the one they had and with it
+// revoking its URL
+func (r *CalendarFeedRepository) Create(ctx context.Context, feed *models.CalendarFeed) error {
+	query := `
+		INSERT INTO calendar_feeds (user_id, feed_id, include_pending, created_at)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (user_id) DO UPDATE
+		SET feed_id = EXCLUDED.feed_id, include_pending = EXCLUDED.include_pending,
+		    created_at = EXCLUDED.created_at, last_fetched_at = NULL
+	`
+
+	feed.FeedID = uuid.New()
+	feed.CreatedAt = time.Now()
+	feed.LastFetchedAt = nil
+
+	_, err := r.db.ExecContext(ctx, query, feed.UserID, feed.FeedID, feed.IncludePending, feed.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to create calendar feed: %w", err)
+	}
+
+	return nil
+}
+
+// GetByUser retrieves a user's feed
+func (r *CalendarFeedRepository) GetByUser(ctx context.Context, userID uuid.UUID) (*models.CalendarFeed, error) {
+	query := `
+		SELECT user_id, feed_id, include_pending, created_at, last_fetched_at
+		FROM calendar_feeds
+		WHERE user_id = $1
+	`
+
+	var feed models.CalendarFeed
+	if err := r.db.GetContext(ctx, &feed, query, userID); err != nil {
+		return nil, fmt.Errorf("failed to get calendar feed: %w", err)
+	}
+
+	return &feed, nil
+}
+
+// GetByFeedID retrieves the feed a URL's token names
+func (r *CalendarFeedRepository) GetByFeedID(ctx context.Context, feedID uuid.UUID) (*models.CalendarFeed, error) {
+	query := `
+		SELECT user_id, feed_id, include_pending, created_at, last_fetched_at
+		FROM calendar_feeds
+		WHERE feed_id = $1
+	`
+
+	var feed models.CalendarFeed
+	if err := r.db.GetContext(ctx, &feed, query, feedID); err != nil {
+		return nil, fmt.Errorf("failed to get calendar feed: %w", err)
+	}
+
+	return &feed, nil
+}
+
+// Fetched records that a calendar app fetched the feed
+func (r *CalendarFeedRepository) Fetched(ctx context.Context, feedID uuid.UUID, at time.Time) error {
+	if _, err := r.db.ExecContext(ctx, `UPDATE calendar_feeds SET last_fetched_at = $1 WHERE feed_id = $2`, at, feedID); err != nil {
+		return fmt.Errorf("failed to update calendar feed: %w", err)
+	}
+	return nil
+}
+
+// Delete removes a user's feed, revoking its URL. It reports false if the
+// user had none.
+func (r *CalendarFeedRepository) Delete(ctx context.Context, userID uuid.UUID) (bool, error) {
+	result, err := r.db.ExecContext(ctx, `DELETE FROM calendar_feeds WHERE user_id = $1`, userID)
+	if err != nil {
+		return false, fmt.Errorf("failed to delete calendar feed: %w", err)
+	}
+
+	n, _ := result.RowsAffected()
+	return n > 0, nil
+}
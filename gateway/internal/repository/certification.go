@@ -0,0 +1,485 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/VanCannon/openpam/gateway/internal/actor"
+	"github.com/VanCannon/openpam/gateway/internal/database"
+	"github.com/VanCannon/openpam/gateway/internal/models"
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+)
+
+// ErrAlreadyDecided is returned when a certification item has already been decided
+// or its campaign is no longer active
+var ErrAlreadyDecided = errors.New("certification item already decided")
+
+// CertificationRepository handles certification campaigns and their items
+type CertificationRepository struct {
+	db *database.DB
+}
+
+// NewCertificationRepository creates a new certification repository
+func NewCertificationRepository(db *database.DB) *CertificationRepository {
+	return &CertificationRepository{db: db}
+}
+
+const campaignColumns = `
+	id, name, description, status, scope, reviewer_ids, revoke_undecided, due_at,
+	created_by, created_at, completed_at
+`
+
+const itemColumns = `
+	i.id, i.campaign_id, i.user_id, u.email AS user_email, i.entitlement_type, i.entitlement_id,
+	i.entitlement_description, i.reviewer_id, i.decision, i.comment, i.decided_by, i.decided_at,
+	i.executed_at, i.created_at
+`
+
+// ListEntitlements returns the current entitlements in scope as undecided items,
+// ordered by user
+func (r *CertificationRepository) ListEntitlements(ctx context.Context, scope models.CertificationScope) ([]*models.CertificationItem, error) {
+	userIDs := uuidArray(scope.UserIDs)
+	roles := pq.StringArray(scope.Roles)
+	anyTarget := len(scope.TargetIDs) == 0 && len(scope.ZoneIDs) == 0
+	targetIDs := uuidArray(scope.TargetIDs)
+	zoneIDs := uuidArray(scope.ZoneIDs)
+
+	var items []*models.CertificationItem
+
+	if scope.IncludesType(models.EntitlementTypeRole) {
+		query := `
+			SELECT u.id AS user_id, u.email AS user_email, 'Role: ' || u.role AS entitlement_description
+			FROM users u
+			WHERE u.enabled AND u.role <> 'user'
+			  AND (cardinality($1::uuid[]) = 0 OR u.id = ANY($1::uuid[]))
+			  AND (cardinality($2::text[]) = 0 OR u.role = ANY($2::text[]))
+			ORDER BY u.email
+		`
+
+		var roleItems []*models.CertificationItem
+		if err := r.db.SelectContext(ctx, &roleItems, query, userIDs, roles); err != nil {
+			return nil, fmt.Errorf("failed to list role entitlements: %w", err)
+		}
+		items = append(items, withType(roleItems, models.EntitlementTypeRole)...)
+	}
+
+	if scope.IncludesType(models.EntitlementTypeCredentialRule) {
+		query := `
+			SELECT u.id AS user_id, u.email AS user_email, cr.id AS entitlement_id,
+			       'Credential rule: ' || cr.name || COALESCE(' (target ' || t.name || ')', '') AS entitlement_description
+			FROM credential_rules cr
+			JOIN users u ON cr.user_id = u.id
+			LEFT JOIN targets t ON cr.target_id = t.id
+			WHERE cr.enabled AND cr.effect = 'allow'
+			  AND (cardinality($1::uuid[]) = 0 OR u.id = ANY($1::uuid[]))
+			  AND (cardinality($2::text[]) = 0 OR u.role = ANY($2::text[]))
+			  AND ($3 OR cr.target_id IS NULL OR cr.target_id = ANY($4::uuid[]) OR t.zone_id = ANY($5::uuid[]))
+			ORDER BY u.email, cr.name
+		`
+
+		var ruleItems []*models.CertificationItem
+		if err := r.db.SelectContext(ctx, &ruleItems, query, userIDs, roles, anyTarget, targetIDs, zoneIDs); err != nil {
+			return nil, fmt.Errorf("failed to list credential rule entitlements: %w", err)
+		}
+		items = append(items, withType(ruleItems, models.EntitlementTypeCredentialRule)...)
+	}
+
+	if scope.IncludesType(models.EntitlementTypeSchedule) {
+		query := `
+			SELECT u.id AS user_id, u.email AS user_email, s.id AS entitlement_id,
+			       'Scheduled access to ' || t.name || ' until ' ||
+			       to_char(s.end_time AT TIME ZONE 'UTC', 'YYYY-MM-DD HH24:MI "UTC"') AS entitlement_description
+			FROM schedules s
+			JOIN users u ON s.user_id = u.id
+			JOIN targets t ON s.target_id = t.id
+			WHERE s.approval_status = 'approved' AND s.status IN ('pending', 'active') AND s.end_time > NOW()
+			  AND (cardinality($1::uuid[]) = 0 OR u.id = ANY($1::uuid[]))
+			  AND (cardinality($2::text[]) = 0 OR u.role = ANY($2::text[]))
+			  AND ($3 OR s.target_id = ANY($4::uuid[]) OR t.zone_id = ANY($5::uuid[]))
+			ORDER BY u.email, s.end_time
+		`
+
+		var scheduleItems []*models.CertificationItem
+		if err := r.db.SelectContext(ctx, &scheduleItems, query, userIDs, roles, anyTarget, targetIDs, zoneIDs); err != nil {
+			return nil, fmt.Errorf("failed to list schedule entitlements: %w", err)
+		}
+		items = append(items, withType(scheduleItems, models.EntitlementTypeSchedule)...)
+	}
+
+	return items, nil
+}
+
+// CreateCampaign creates a campaign together with its items
+func (r *CertificationRepository) CreateCampaign(ctx context.Context, campaign *models.CertificationCampaign, items []*models.CertificationItem) error {
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	campaign.ID = uuid.New()
+	campaign.Status = models.CampaignStatusActive
+	campaign.CreatedAt = time.Now()
+
+	_, err = tx.ExecContext(ctx, `
+		INSERT INTO certification_campaigns (
+			id, name, description, status, scope, reviewer_ids, revoke_undecided, due_at, created_by, created_at
+		) VALUES ($1, $2, $3, $4, $5, $6::uuid[], $7, $8, $9, $10)
+	`,
+		campaign.ID,
+		campaign.Name,
+		campaign.Description,
+		campaign.Status,
+		campaign.Scope,
+		campaign.ReviewerIDs,
+		campaign.RevokeUndecided,
+		campaign.DueAt,
+		campaign.CreatedBy,
+		campaign.CreatedAt,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to create campaign: %w", err)
+	}
+
+	for _, item := range items {
+		item.ID = uuid.New()
+		item.CampaignID = campaign.ID
+		item.Decision = models.CertificationPending
+		item.CreatedAt = campaign.CreatedAt
+
+		_, err := tx.ExecContext(ctx, `
+			INSERT INTO certification_items (
+				id, campaign_id, user_id, entitlement_type, entitlement_id, entitlement_description,
+				reviewer_id, decision, created_at
+			) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+		`,
+			item.ID,
+			item.CampaignID,
+			item.UserID,
+			item.EntitlementType,
+			item.EntitlementID,
+			item.EntitlementDescription,
+			item.ReviewerID,
+			item.Decision,
+			item.CreatedAt,
+		)
+		if err != nil {
+			return fmt.Errorf("failed to create certification item: %w", err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return nil
+}
+
+// GetCampaign retrieves a campaign by ID
+func (r *CertificationRepository) GetCampaign(ctx context.Context, id uuid.UUID) (*models.CertificationCampaign, error) {
+	query := `SELECT ` + campaignColumns + ` FROM certification_campaigns WHERE id = $1`
+
+	var campaign models.CertificationCampaign
+	err := r.db.GetContext(ctx, &campaign, query, id)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("campaign not found")
+		}
+		return nil, fmt.Errorf("failed to get campaign: %w", err)
+	}
+
+	return &campaign, nil
+}
+
+// ListCampaigns retrieves all campaigns, newest first
+func (r *CertificationRepository) ListCampaigns(ctx context.Context) ([]*models.CertificationCampaign, error) {
+	query := `SELECT ` + campaignColumns + ` FROM certification_campaigns ORDER BY created_at DESC`
+
+	var campaigns []*models.CertificationCampaign
+	err := r.db.SelectContext(ctx, &campaigns, query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list campaigns: %w", err)
+	}
+
+	return campaigns, nil
+}
+
+// ListOverdue returns the IDs of active campaigns due at or before now
+func (r *CertificationRepository) ListOverdue(ctx context.Context, now time.Time) ([]uuid.UUID, error) {
+	query := `SELECT id FROM certification_campaigns WHERE status = $1 AND due_at <= $2`
+
+	var ids []uuid.UUID
+	err := r.db.SelectContext(ctx, &ids, query, models.CampaignStatusActive, now)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list overdue campaigns: %w", err)
+	}
+
+	return ids, nil
+}
+
+// Progress counts a campaign's items by decision
+func (r *CertificationRepository) Progress(ctx context.Context, campaignID uuid.UUID) (*models.CertificationProgress, error) {
+	query := `
+		SELECT COUNT(*) AS total,
+		       COUNT(*) FILTER (WHERE decision = 'pending') AS pending,
+		       COUNT(*) FILTER (WHERE decision = 'certified') AS certified,
+		       COUNT(*) FILTER (WHERE decision = 'revoked') AS revoked,
+		       COUNT(*) FILTER (WHERE decision = 'not_reviewed') AS not_reviewed
+		FROM certification_items
+		WHERE campaign_id = $1
+	`
+
+	var progress models.CertificationProgress
+	err := r.db.GetContext(ctx, &progress, query, campaignID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get campaign progress: %w", err)
+	}
+
+	return &progress, nil
+}
+
+// GetItem retrieves a certification item by ID
+func (r *CertificationRepository) GetItem(ctx context.Context, id uuid.UUID) (*models.CertificationItem, error) {
+	query := `
+		SELECT ` + itemColumns + `
+		FROM certification_items i
+		JOIN users u ON i.user_id = u.id
+		WHERE i.id = $1
+	`
+
+	var item models.CertificationItem
+	err := r.db.GetContext(ctx, &item, query, id)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("certification item not found")
+		}
+		return nil, fmt.Errorf("failed to get certification item: %w", err)
+	}
+
+	return &item, nil
+}
+
+// ListItems retrieves all items of a campaign ordered by user
+func (r *CertificationRepository) ListItems(ctx context.Context, campaignID uuid.UUID) ([]*models.CertificationItem, error) {
+	query := `
+		SELECT ` + itemColumns + `
+		FROM certification_items i
+		JOIN users u ON i.user_id = u.id
+		WHERE i.campaign_id = $1
+		ORDER BY u.email, i.entitlement_type, i.entitlement_description
+	`
+
+	var items []*models.CertificationItem
+	err := r.db.SelectContext(ctx, &items, query, campaignID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list certification items: %w", err)
+	}
+
+	return items, nil
+}
+
+// ListPendingForReviewer retrieves the undecided items of active campaigns assigned
+// to the reviewer, plus unassigned items if includeUnassigned is set
+func (r *CertificationRepository) ListPendingForReviewer(ctx context.Context, reviewerID uuid.UUID, includeUnassigned bool) ([]*models.CertificationItem, error) {
+	query := `
+		SELECT ` + itemColumns + `
+		FROM certification_items i
+		JOIN users u ON i.user_id = u.id
+		JOIN certification_campaigns c ON i.campaign_id = c.id
+		WHERE c.status = 'active' AND i.decision = 'pending'
+		  AND (i.reviewer_id = $1 OR ($2 AND i.reviewer_id IS NULL))
+		  AND i.user_id <> $1
+		ORDER BY c.due_at, u.email
+	`
+
+	var items []*models.CertificationItem
+	err := r.db.SelectContext(ctx, &items, query, reviewerID, includeUnassigned)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list pending certification items: %w", err)
+	}
+
+	return items, nil
+}
+
+// Decide records a decision on a pending item of an active campaign. Revocations
+// are applied in the same transaction, so a revoked item is never left standing.
+// ErrAlreadyDecided is returned if the item was decided first by someone else or
+// its campaign has closed.
+func (r *CertificationRepository) Decide(ctx context.Context, item *models.CertificationItem, decision string, comment *string, decidedBy uuid.UUID) error {
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	now := time.Now()
+	var executedAt *time.Time
+	if decision == models.CertificationRevoked {
+		if err := revokeEntitlement(ctx, tx, item); err != nil {
+			return err
+		}
+		executedAt = &now
+	}
+
+	result, err := tx.ExecContext(ctx, `
+		UPDATE certification_items
+		SET decision = $1, comment = $2, decided_by = $3, decided_at = $4, executed_at = $5
+		WHERE id = $6 AND decision = 'pending'
+		  AND campaign_id IN (SELECT id FROM certification_campaigns WHERE status = 'active')
+	`, decision, comment, decidedBy, now, executedAt, item.ID)
+	if err != nil {
+		return fmt.Errorf("failed to record decision: %w", err)
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+
+	if rows == 0 {
+		return ErrAlreadyDecided
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	item.Decision = decision
+	item.Comment = comment
+	item.DecidedBy = &decidedBy
+	item.DecidedAt = &now
+	item.ExecutedAt = executedAt
+	return nil
+}
+
+// Complete closes an active campaign. Undecided items are revoked if the campaign
+// says so, and otherwise marked as not reviewed. The items revoked on close are
+// returned. The campaign is locked, so concurrent calls complete it only once.
+func (r *CertificationRepository) Complete(ctx context.Context, campaignID uuid.UUID) ([]*models.CertificationItem, error) {
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	var revokeUndecided bool
+	err = tx.GetContext(ctx, &revokeUndecided,
+		`SELECT revoke_undecided FROM certification_campaigns WHERE id = $1 AND status = 'active' FOR UPDATE`,
+		campaignID,
+	)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("active campaign not found")
+		}
+		return nil, fmt.Errorf("failed to lock campaign: %w", err)
+	}
+
+	now := time.Now()
+	var revoked []*models.CertificationItem
+
+	if revokeUndecided {
+		query := `
+			SELECT ` + itemColumns + `
+			FROM certification_items i
+			JOIN users u ON i.user_id = u.id
+			WHERE i.campaign_id = $1 AND i.decision = 'pending'
+		`
+		if err := tx.SelectContext(ctx, &revoked, query, campaignID); err != nil {
+			return nil, fmt.Errorf("failed to list undecided items: %w", err)
+		}
+
+		comment := "Not reviewed before the campaign closed"
+		for _, item := range revoked {
+			if err := revokeEntitlement(ctx, tx, item); err != nil {
+				return nil, err
+			}
+			item.Decision = models.CertificationRevoked
+			item.Comment = &comment
+			item.DecidedAt = &now
+			item.ExecutedAt = &now
+		}
+
+		_, err := tx.ExecContext(ctx, `
+			UPDATE certification_items
+			SET decision = 'revoked', comment = $1, decided_at = $2, executed_at = $2
+			WHERE campaign_id = $3 AND decision = 'pending'
+		`, comment, now, campaignID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to revoke undecided items: %w", err)
+		}
+	} else {
+		_, err := tx.ExecContext(ctx, `
+			UPDATE certification_items SET decision = 'not_reviewed'
+			WHERE campaign_id = $1 AND decision = 'pending'
+		`, campaignID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to close undecided items: %w", err)
+		}
+	}
+
+	_, err = tx.ExecContext(ctx,
+		`UPDATE certification_campaigns SET status = $1, completed_at = $2 WHERE id = $3`,
+		models.CampaignStatusCompleted, now, campaignID,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to complete campaign: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return revoked, nil
+}
+
+// revokeEntitlement removes the entitlement an item refers to. An entitlement that
+// has already gone (e.g. the schedule ended) needs no action.
+func revokeEntitlement(ctx context.Context, tx *sqlx.Tx, item *models.CertificationItem) error {
+	var err error
+
+	switch item.EntitlementType {
+	case models.EntitlementTypeRole:
+		_, err = tx.ExecContext(ctx,
+			`UPDATE users SET role = $1, updated_at = NOW(), updated_by = $3, version = version + 1 WHERE id = $2 AND role <> $1`,
+			models.RoleUser, item.UserID, actor.UserID(ctx),
+		)
+	case models.EntitlementTypeCredentialRule:
+		_, err = tx.ExecContext(ctx,
+			`UPDATE credential_rules SET enabled = false, updated_at = NOW(), updated_by = $2 WHERE id = $1`,
+			item.EntitlementID, actor.UserID(ctx),
+		)
+	case models.EntitlementTypeSchedule:
+		_, err = tx.ExecContext(ctx,
+			`UPDATE schedules SET status = $1, updated_at = NOW(), updated_by = $3, version = version + 1 WHERE id = $2 AND status IN ('pending', 'active')`,
+			models.ScheduleStatusCancelled, item.EntitlementID, actor.UserID(ctx),
+		)
+	default:
+		return fmt.Errorf("unknown entitlement type: %s", item.EntitlementType)
+	}
+
+	if err != nil {
+		return fmt.Errorf("failed to revoke %s: %w", item.EntitlementType, err)
+	}
+
+	return nil
+}
+
+func withType(items []*models.CertificationItem, entitlementType string) []*models.CertificationItem {
+	for _, item := range items {
+		item.EntitlementType = entitlementType
+	}
+	return items
+}
+
+func uuidArray(ids []uuid.UUID) pq.StringArray {
+	out := make(pq.StringArray, len(ids))
+	for i, id := range ids {
+		out[i] = id.String()
+	}
+	return out
+}
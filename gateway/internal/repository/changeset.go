@@ -0,0 +1,163 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/VanCannon/openpam/gateway/internal/database"
+	"github.com/VanCannon/openpam/gateway/internal/models"
+	"github.com/google/uuid"
+)
+
+// ErrChangeSetClosed is returned when a change set was already decided
+var ErrChangeSetClosed = errors.New("change set is no longer pending")
+
+// ChangeSetRepository handles change set data operations
+type ChangeSetRepository struct {
+	db *database.DB
+}
+
+// NewChangeSetRepository creates a new change set repository
+func NewChangeSetRepository(db *database.DB) *ChangeSetRepository {
+	return &ChangeSetRepository{db: db}
+}
+
+const changeSetColumns = `
+	c.id, c.category, c.kind, c.method, c.path, c.body, c.if_match, c.before, c.diff, c.status,
+	c.requested_by, COALESCE(u.email, '') AS requested_email, c.decided_by, c.decided_at,
+	c.rejection_reason, c.error, c.created_at
+`
+
+// returningChangeSet lists the columns of an updated change set, without the joined email
+const returningChangeSet = `
+	RETURNING id, category, kind, method, path, body, if_match, before, diff, status,
+	          requested_by, decided_by, decided_at, rejection_reason, error, created_at
+`
+
+// Create stages a new change set
+func (r *ChangeSetRepository) Create(ctx context.Context, cs *models.ChangeSet) error {
+	query := `
+		INSERT INTO change_sets (
+			id, category, kind, method, path, body, if_match, before, diff, status,
+			requested_by, created_at
+		)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)
+	`
+
+	cs.ID = uuid.New()
+	cs.Status = models.ChangeSetStatusPending
+	cs.CreatedAt = time.Now()
+
+	_, err := r.db.ExecContext(ctx, query,
+		cs.ID,
+		cs.Category,
+		cs.Kind,
+		cs.Method,
+		cs.Path,
+		nullJSON(cs.Body),
+		cs.IfMatch,
+		nullJSON(cs.Before),
+		cs.Diff,
+		cs.Status,
+		cs.RequestedBy,
+		cs.CreatedAt,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to create change set: %w", err)
+	}
+
+	return nil
+}
+
+// nullJSON stores an empty JSON document as NULL
+func nullJSON(doc []byte) interface{} {
+	if len(doc) == 0 {
+		return nil
+	}
+	return doc
+}
+
+// GetByID retrieves a change set by ID
+func (r *ChangeSetRepository) GetByID(ctx context.Context, id uuid.UUID) (*models.ChangeSet, error) {
+	query := `
+		SELECT ` + changeSetColumns + `
+		FROM change_sets c
+		LEFT JOIN users u ON c.requested_by = u.id
+		WHERE c.id = $1
+	`
+
+	var cs models.ChangeSet
+	if err := r.db.GetContext(ctx, &cs, query, id); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("change set not found")
+		}
+		return nil, fmt.Errorf("failed to get change set: %w", err)
+	}
+
+	return &cs, nil
+}
+
+// List retrieves change sets, newest first. An empty status lists every status.
+func (r *ChangeSetRepository) List(ctx context.Context, status string, limit int) ([]*models.ChangeSet, error) {
+	query := `
+		SELECT ` + changeSetColumns + `
+		FROM change_sets c
+		LEFT JOIN users u ON c.requested_by = u.id
+		WHERE ($1 = '' OR c.status = $1)
+		ORDER BY c.created_at DESC
+		LIMIT $2
+	`
+
+	var sets []*models.ChangeSet
+	if err := r.db.SelectContext(ctx, &sets, query, status, limit); err != nil {
+		return nil, fmt.Errorf("failed to list change sets: %w", err)
+	}
+
+	return sets, nil
+}
+
+// Decide approves or rejects a pending change set. An approved change set is
+// left approved until Finish records whether applying it worked.
+// ErrChangeSetClosed is returned if it was decided first by someone else.
+func (r *ChangeSetRepository) Decide(ctx context.Context, id uuid.UUID, approve bool, decidedBy uuid.UUID, reason *string, now time.Time) (*models.ChangeSet, error) {
+	status := models.ChangeSetStatusRejected
+	if approve {
+		status = models.ChangeSetStatusApproved
+	}
+
+	query := `
+		UPDATE change_sets
+		SET status = $1, decided_by = $2, decided_at = $3, rejection_reason = $4
+		WHERE id = $5 AND status = 'pending'
+	` + returningChangeSet
+
+	var cs models.ChangeSet
+	err := r.db.GetContext(ctx, &cs, query, status, decidedBy, now, reason, id)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, ErrChangeSetClosed
+		}
+		return nil, fmt.Errorf("failed to decide change set: %w", err)
+	}
+
+	return &cs, nil
+}
+
+// Finish records the outcome of applying an approved change set: applied
+// without an error, failed with one
+func (r *ChangeSetRepository) Finish(ctx context.Context, id uuid.UUID, applyErr *string) error {
+	status := models.ChangeSetStatusApplied
+	if applyErr != nil {
+		status = models.ChangeSetStatusFailed
+	}
+
+	query := `UPDATE change_sets SET status = $1, error = $2 WHERE id = $3 AND status = 'approved'`
+	if _, err := r.db.ExecContext(ctx, query, status, applyErr, id); err != nil {
+		return fmt.Errorf("failed to finish change set: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,107 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/VanCannon/openpam/gateway/internal/database"
+	"github.com/VanCannon/openpam/gateway/internal/models"
+	"github.com/google/uuid"
+)
+
+// CloudSessionRepository handles the record of brokered cloud console sessions
+type CloudSessionRepository struct {
+	db *database.DB
+}
+
+// NewCloudSessionRepository creates a new cloud session repository
+func NewCloudSessionRepository(db *database.DB) *CloudSessionRepository {
+	return &CloudSessionRepository{db: db}
+}
+
+const cloudSessionColumns = `
+	c.id, c.target_id, t.name AS target_name, c.credential_id, c.user_id, u.email AS user_email,
+	c.provider, c.role, c.session_name, c.external_id, c.justification, c.status, c.error,
+	c.client_ip, c.started_at, c.expires_at
+`
+
+// Create records a cloud session, granted or failed
+func (r *CloudSessionRepository) Create(ctx context.Context, session *models.CloudSession) error {
+	query := `
+		INSERT INTO cloud_sessions (
+			id, target_id, credential_id, user_id, provider, role, session_name, external_id,
+			justification, status, error, client_ip, started_at, expires_at
+		)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14)
+	`
+
+	if session.ID == uuid.Nil {
+		session.ID = uuid.New()
+	}
+
+	_, err := r.db.ExecContext(ctx, query,
+		session.ID,
+		session.TargetID,
+		session.CredentialID,
+		session.UserID,
+		session.Provider,
+		session.Role,
+		session.SessionName,
+		session.ExternalID,
+		session.Justification,
+		session.Status,
+		session.Error,
+		session.ClientIP,
+		session.StartedAt,
+		session.ExpiresAt,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to create cloud session: %w", err)
+	}
+
+	return nil
+}
+
+// CloudSessionFilter narrows ListSessions
+type CloudSessionFilter struct {
+	TargetID *uuid.UUID
+	UserID   *uuid.UUID
+	Provider string
+	Limit    int
+}
+
+// ListSessions retrieves cloud sessions, newest first
+func (r *CloudSessionRepository) ListSessions(ctx context.Context, filter CloudSessionFilter) ([]*models.CloudSession, error) {
+	query := `
+		SELECT ` + cloudSessionColumns + `
+		FROM cloud_sessions c
+		LEFT JOIN targets t ON c.target_id = t.id
+		LEFT JOIN users u ON c.user_id = u.id
+		WHERE 1=1
+	`
+	var args []interface{}
+
+	if filter.TargetID != nil {
+		args = append(args, *filter.TargetID)
+		query += fmt.Sprintf(" AND c.target_id = $%d", len(args))
+	}
+	if filter.UserID != nil {
+		args = append(args, *filter.UserID)
+		query += fmt.Sprintf(" AND c.user_id = $%d", len(args))
+	}
+	if filter.Provider != "" {
+		args = append(args, filter.Provider)
+		query += fmt.Sprintf(" AND c.provider = $%d", len(args))
+	}
+
+	args = append(args, filter.Limit)
+	query += fmt.Sprintf(" ORDER BY c.started_at DESC LIMIT $%d", len(args))
+
+	var sessions []*models.CloudSession
+	err := r.db.SelectContext(ctx, &sessions, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list cloud sessions: %w", err)
+	}
+
+	return sessions, nil
+}
@@ -6,9 +6,12 @@ import (
 	"fmt"
 	"time"
 
+	"github.com/VanCannon/openpam/gateway/internal/actor"
 	"github.com/VanCannon/openpam/gateway/internal/database"
 	"github.com/VanCannon/openpam/gateway/internal/models"
 	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
 )
 
 // CredentialRepository handles credential data operations
@@ -21,38 +24,78 @@ func NewCredentialRepository(db *database.DB) *CredentialRepository {
 	return &CredentialRepository{db: db}
 }
 
-// Create creates a new credential
+// CheckTargetZone returns ErrOutsideZones if the actor may not add credentials
+// to a target
+func (r *CredentialRepository) CheckTargetZone(ctx context.Context, targetID uuid.UUID) error {
+	return checkZone(ctx, r.db, targetZoneQuery, targetID)
+}
+
+// CheckZone returns ErrOutsideZones if the actor may not change a credential
+func (r *CredentialRepository) CheckZone(ctx context.Context, id uuid.UUID) error {
+	return checkZone(ctx, r.db, credentialZoneQuery, id)
+}
+
+// Create creates a new credential.
+// If the credential is the target's default, any previous default is cleared.
 func (r *CredentialRepository) Create(ctx context.Context, cred *models.Credential) error {
+	if err := checkZone(ctx, r.db, targetZoneQuery, cred.TargetID); err != nil {
+		return err
+	}
+
 	query := `
-		INSERT INTO credentials (id, target_id, username, vault_secret_path, description, created_at, updated_at)
-		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		INSERT INTO credentials (id, target_id, username, vault_secret_path, description, is_default, sort_order, tags, created_at, updated_at,
+		                         created_by, updated_by)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $11)
 	`
 
 	cred.ID = uuid.New()
+	cred.Version = 1
 	cred.CreatedAt = time.Now()
 	cred.UpdatedAt = time.Now()
 
-	_, err := r.db.ExecContext(ctx, query,
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if cred.IsDefault {
+		if err := clearDefault(ctx, tx, cred.TargetID, cred.ID); err != nil {
+			return err
+		}
+	}
+
+	_, err = tx.ExecContext(ctx, query,
 		cred.ID,
 		cred.TargetID,
 		cred.Username,
 		cred.VaultSecretPath,
 		cred.Description,
+		cred.IsDefault,
+		cred.SortOrder,
+		nonNilTags(cred.Tags),
 		cred.CreatedAt,
 		cred.UpdatedAt,
+		actor.UserID(ctx),
 	)
 
 	if err != nil {
 		return fmt.Errorf("failed to create credential: %w", err)
 	}
 
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
 	return nil
 }
 
 // GetByID retrieves a credential by ID
 func (r *CredentialRepository) GetByID(ctx context.Context, id uuid.UUID) (*models.Credential, error) {
 	query := `
-		SELECT id, target_id, username, vault_secret_path, description, created_at, updated_at
+		SELECT id, target_id, username, vault_secret_path, description, is_default, sort_order, tags, version, created_at, updated_at,
+		       certificate_subject, certificate_expires_at, certificate_alerted_at,
+		       auth_failures, last_auth_failure_at, last_auth_failure, quarantined_at
 		FROM credentials
 		WHERE id = $1
 	`
@@ -69,13 +112,16 @@ func (r *CredentialRepository) GetByID(ctx context.Context, id uuid.UUID) (*mode
 	return &cred, nil
 }
 
-// GetByTargetID retrieves all credentials for a target
+// GetByTargetID retrieves all credentials for a target in selection order:
+// the default first, then by sort order and username
 func (r *CredentialRepository) GetByTargetID(ctx context.Context, targetID uuid.UUID) ([]*models.Credential, error) {
 	query := `
-		SELECT id, target_id, username, vault_secret_path, description, created_at, updated_at
+		SELECT id, target_id, username, vault_secret_path, description, is_default, sort_order, tags, version, created_at, updated_at,
+		       certificate_subject, certificate_expires_at, certificate_alerted_at,
+		       auth_failures, last_auth_failure_at, last_auth_failure, quarantined_at
 		FROM credentials
 		WHERE target_id = $1
-		ORDER BY username ASC
+		ORDER BY is_default DESC, sort_order ASC, username ASC
 	`
 
 	var creds []*models.Credential
@@ -87,22 +133,74 @@ func (r *CredentialRepository) GetByTargetID(ctx context.Context, targetID uuid.
 	return creds, nil
 }
 
-// Update updates a credential
+// CountByTargets counts the credentials of each of the given targets. Targets
+// without credentials are left out.
+func (r *CredentialRepository) CountByTargets(ctx context.Context, targetIDs []uuid.UUID) (map[uuid.UUID]int, error) {
+	query := `
+		SELECT target_id, COUNT(*) AS count
+		FROM credentials
+		WHERE target_id = ANY($1::uuid[])
+		GROUP BY target_id
+	`
+
+	var rows []struct {
+		TargetID uuid.UUID `db:"target_id"`
+		Count    int       `db:"count"`
+	}
+	if err := r.db.SelectContext(ctx, &rows, query, uuidArray(targetIDs)); err != nil {
+		return nil, fmt.Errorf("failed to count credentials by target: %w", err)
+	}
+
+	counts := make(map[uuid.UUID]int, len(rows))
+	for _, row := range rows {
+		counts[row.TargetID] = row.Count
+	}
+	return counts, nil
+}
+
+// Update updates a credential if it is still at cred.Version, and advances the version.
+// If the credential becomes the target's default, any previous default is cleared.
+// Pointing it at a new secret clears its failed logons and any quarantine.
+// ErrVersionConflict is returned when someone else updated the credential first.
 func (r *CredentialRepository) Update(ctx context.Context, cred *models.Credential) error {
+	if err := checkZone(ctx, r.db, credentialZoneQuery, cred.ID); err != nil {
+		return err
+	}
+
 	query := `
 		UPDATE credentials
-		SET username = $1, vault_secret_path = $2, description = $3, updated_at = $4
-		WHERE id = $5
+		SET username = $1, vault_secret_path = $2, description = $3, is_default = $4, sort_order = $5, tags = $6, updated_at = $7,
+		    updated_by = $10, version = version + 1,
+		    auth_failures = CASE WHEN vault_secret_path = $2 THEN auth_failures ELSE 0 END,
+		    quarantined_at = CASE WHEN vault_secret_path = $2 THEN quarantined_at END
+		WHERE id = $8 AND version = $9
 	`
 
 	cred.UpdatedAt = time.Now()
 
-	result, err := r.db.ExecContext(ctx, query,
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if cred.IsDefault {
+		if err := clearDefault(ctx, tx, cred.TargetID, cred.ID); err != nil {
+			return err
+		}
+	}
+
+	result, err := tx.ExecContext(ctx, query,
 		cred.Username,
 		cred.VaultSecretPath,
 		cred.Description,
+		cred.IsDefault,
+		cred.SortOrder,
+		nonNilTags(cred.Tags),
 		cred.UpdatedAt,
 		cred.ID,
+		cred.Version,
+		actor.UserID(ctx),
 	)
 
 	if err != nil {
@@ -115,7 +213,31 @@ func (r *CredentialRepository) Update(ctx context.Context, cred *models.Credenti
 	}
 
 	if rows == 0 {
-		return fmt.Errorf("credential not found")
+		return versionMiss(ctx, tx, "credentials", "", cred.ID, fmt.Errorf("credential not found"))
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	cred.Version++
+	return nil
+}
+
+// nonNilTags avoids writing NULL into the NOT NULL tags column
+func nonNilTags(tags pq.StringArray) pq.StringArray {
+	if tags == nil {
+		return pq.StringArray{}
+	}
+	return tags
+}
+
+// clearDefault unsets the default flag on every other credential of the target
+func clearDefault(ctx context.Context, tx *sqlx.Tx, targetID, keepID uuid.UUID) error {
+	query := `UPDATE credentials SET is_default = false, updated_at = $1, updated_by = $4, version = version + 1 WHERE target_id = $2 AND id <> $3 AND is_default`
+
+	if _, err := tx.ExecContext(ctx, query, time.Now(), targetID, keepID, actor.UserID(ctx)); err != nil {
+		return fmt.Errorf("failed to clear default credential: %w", err)
 	}
 
 	return nil
@@ -123,6 +245,10 @@ func (r *CredentialRepository) Update(ctx context.Context, cred *models.Credenti
 
 // Delete deletes a credential
 func (r *CredentialRepository) Delete(ctx context.Context, id uuid.UUID) error {
+	if err := checkZone(ctx, r.db, credentialZoneQuery, id); err != nil {
+		return err
+	}
+
 	query := `DELETE FROM credentials WHERE id = $1`
 
 	result, err := r.db.ExecContext(ctx, query, id)
@@ -141,3 +267,111 @@ func (r *CredentialRepository) Delete(ctx context.Context, id uuid.UUID) error {
 
 	return nil
 }
+
+// SetCertificate records the client certificate stored with a credential's
+// secret, and re-arms its expiry alert
+func (r *CredentialRepository) SetCertificate(ctx context.Context, id uuid.UUID, subject string, expiresAt time.Time) error {
+	query := `
+		UPDATE credentials
+		SET certificate_subject = $2, certificate_expires_at = $3, certificate_alerted_at = NULL,
+		    updated_at = $4, updated_by = $5, version = version + 1
+		WHERE id = $1
+	`
+
+	result, err := r.db.ExecContext(ctx, query, id, subject, expiresAt, time.Now(), actor.UserID(ctx))
+	if err != nil {
+		return fmt.Errorf("failed to set credential certificate: %w", err)
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+
+	if rows == 0 {
+		return fmt.Errorf("credential not found")
+	}
+
+	return nil
+}
+
+// ListCertificatesExpiring retrieves the credentials whose certificates expire
+// before the given time and haven't been alerted on, soonest first
+func (r *CredentialRepository) ListCertificatesExpiring(ctx context.Context, before time.Time) ([]*models.Credential, error) {
+	query := `
+		SELECT id, target_id, username, vault_secret_path, description, is_default, sort_order, tags, version, created_at, updated_at,
+		       certificate_subject, certificate_expires_at, certificate_alerted_at,
+		       auth_failures, last_auth_failure_at, last_auth_failure, quarantined_at
+		FROM credentials
+		WHERE certificate_expires_at < $1 AND certificate_alerted_at IS NULL
+		ORDER BY certificate_expires_at ASC
+	`
+
+	var creds []*models.Credential
+	err := r.db.SelectContext(ctx, &creds, query, before)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list expiring certificates: %w", err)
+	}
+
+	return creds, nil
+}
+
+// MarkCertificateAlerted records that a credential's certificate expiry was alerted on
+func (r *CredentialRepository) MarkCertificateAlerted(ctx context.Context, id uuid.UUID, at time.Time) error {
+	query := `UPDATE credentials SET certificate_alerted_at = $2 WHERE id = $1`
+
+	if _, err := r.db.ExecContext(ctx, query, id, at); err != nil {
+		return fmt.Errorf("failed to mark certificate alerted: %w", err)
+	}
+
+	return nil
+}
+
+// clearAuthFailures ends a credential's failed logon streak and any quarantine
+const clearAuthFailures = `auth_failures = 0, quarantined_at = NULL`
+
+// RecordAuthFailure adds a failed logon to a credential's streak and returns
+// the new streak. The credential is quarantined when the streak reaches
+// quarantineAfter; 0 never quarantines.
+func (r *CredentialRepository) RecordAuthFailure(ctx context.Context, id uuid.UUID, message string, quarantineAfter int) (int, error) {
+	query := `
+		UPDATE credentials
+		SET auth_failures = auth_failures + 1, last_auth_failure_at = NOW(), last_auth_failure = $2,
+		    quarantined_at = CASE WHEN quarantined_at IS NULL AND $3 > 0 AND auth_failures + 1 >= $3 THEN NOW()
+		                          ELSE quarantined_at END
+		WHERE id = $1
+		RETURNING auth_failures
+	`
+
+	var failures int
+	if err := r.db.GetContext(ctx, &failures, query, id, message, quarantineAfter); err != nil {
+		if err == sql.ErrNoRows {
+			return 0, fmt.Errorf("credential not found")
+		}
+		return 0, fmt.Errorf("failed to record authentication failure: %w", err)
+	}
+
+	return failures, nil
+}
+
+// ClearAuthFailures ends a credential's failed logon streak after a
+// successful logon or a rotation, and releases it from quarantine
+func (r *CredentialRepository) ClearAuthFailures(ctx context.Context, id uuid.UUID) error {
+	query := `UPDATE credentials SET ` + clearAuthFailures + ` WHERE id = $1`
+
+	result, err := r.db.ExecContext(ctx, query, id)
+	if err != nil {
+		return fmt.Errorf("failed to clear authentication failures: %w", err)
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+
+	if rows == 0 {
+		return fmt.Errorf("credential not found")
+	}
+
+	return nil
+}
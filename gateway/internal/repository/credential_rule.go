@@ -0,0 +1,176 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/VanCannon/openpam/gateway/internal/actor"
+	"github.com/VanCannon/openpam/gateway/internal/database"
+	"github.com/VanCannon/openpam/gateway/internal/models"
+	"github.com/google/uuid"
+)
+
+// CredentialRuleRepository handles credential access rule data operations
+type CredentialRuleRepository struct {
+	db *database.DB
+}
+
+// NewCredentialRuleRepository creates a new credential rule repository
+func NewCredentialRuleRepository(db *database.DB) *CredentialRuleRepository {
+	return &CredentialRuleRepository{db: db}
+}
+
+const credentialRuleColumns = `id, name, description, effect, user_id, role, target_id, credential_id, credential_tag, enabled, settings, created_at, updated_at, group_id, condition`
+
+// Create creates a new credential rule
+func (r *CredentialRuleRepository) Create(ctx context.Context, rule *models.CredentialRule) error {
+	query := `
+		INSERT INTO credential_rules (` + credentialRuleColumns + `, created_by, updated_by)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $16)
+	`
+
+	rule.ID = uuid.New()
+	rule.CreatedAt = time.Now()
+	rule.UpdatedAt = time.Now()
+
+	_, err := r.db.ExecContext(ctx, query,
+		rule.ID,
+		rule.Name,
+		rule.Description,
+		rule.Effect,
+		rule.UserID,
+		rule.Role,
+		rule.TargetID,
+		rule.CredentialID,
+		rule.CredentialTag,
+		rule.Enabled,
+		rule.Settings,
+		rule.CreatedAt,
+		rule.UpdatedAt,
+		rule.GroupID,
+		rule.Condition,
+		actor.UserID(ctx),
+	)
+
+	if err != nil {
+		return fmt.Errorf("failed to create credential rule: %w", err)
+	}
+
+	return nil
+}
+
+// GetByID retrieves a credential rule by ID
+func (r *CredentialRuleRepository) GetByID(ctx context.Context, id uuid.UUID) (*models.CredentialRule, error) {
+	query := `SELECT ` + credentialRuleColumns + ` FROM credential_rules WHERE id = $1`
+
+	var rule models.CredentialRule
+	err := r.db.GetContext(ctx, &rule, query, id)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("credential rule not found")
+		}
+		return nil, fmt.Errorf("failed to get credential rule: %w", err)
+	}
+
+	return &rule, nil
+}
+
+// List retrieves all credential rules
+func (r *CredentialRuleRepository) List(ctx context.Context) ([]*models.CredentialRule, error) {
+	query := `SELECT ` + credentialRuleColumns + ` FROM credential_rules ORDER BY name ASC`
+
+	var rules []*models.CredentialRule
+	err := r.db.SelectContext(ctx, &rules, query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list credential rules: %w", err)
+	}
+
+	return rules, nil
+}
+
+// ListEnabledForTarget retrieves the enabled rules that apply to a target,
+// including rules that are not scoped to any target
+func (r *CredentialRuleRepository) ListEnabledForTarget(ctx context.Context, targetID uuid.UUID) ([]*models.CredentialRule, error) {
+	query := `
+		SELECT ` + credentialRuleColumns + `
+		FROM credential_rules
+		WHERE enabled = true AND (target_id IS NULL OR target_id = $1)
+	`
+
+	var rules []*models.CredentialRule
+	err := r.db.SelectContext(ctx, &rules, query, targetID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list credential rules for target: %w", err)
+	}
+
+	return rules, nil
+}
+
+// Update updates a credential rule
+func (r *CredentialRuleRepository) Update(ctx context.Context, rule *models.CredentialRule) error {
+	query := `
+		UPDATE credential_rules
+		SET name = $1, description = $2, effect = $3, user_id = $4, role = $5, target_id = $6,
+		    credential_id = $7, credential_tag = $8, enabled = $9, settings = $10, updated_at = $11,
+		    updated_by = $13, group_id = $14, condition = $15
+		WHERE id = $12
+	`
+
+	rule.UpdatedAt = time.Now()
+
+	result, err := r.db.ExecContext(ctx, query,
+		rule.Name,
+		rule.Description,
+		rule.Effect,
+		rule.UserID,
+		rule.Role,
+		rule.TargetID,
+		rule.CredentialID,
+		rule.CredentialTag,
+		rule.Enabled,
+		rule.Settings,
+		rule.UpdatedAt,
+		rule.ID,
+		actor.UserID(ctx),
+		rule.GroupID,
+		rule.Condition,
+	)
+
+	if err != nil {
+		return fmt.Errorf("failed to update credential rule: %w", err)
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+
+	if rows == 0 {
+		return fmt.Errorf("credential rule not found")
+	}
+
+	return nil
+}
+
+// Delete deletes a credential rule
+func (r *CredentialRuleRepository) Delete(ctx context.Context, id uuid.UUID) error {
+	query := `DELETE FROM credential_rules WHERE id = $1`
+
+	result, err := r.db.ExecContext(ctx, query, id)
+	if err != nil {
+		return fmt.Errorf("failed to delete credential rule: %w", err)
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+
+	if rows == 0 {
+		return fmt.Errorf("credential rule not found")
+	}
+
+	return nil
+}
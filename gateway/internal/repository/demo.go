@@ -0,0 +1,93 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/VanCannon/openpam/gateway/internal/database"
+	"github.com/google/uuid"
+)
+
+// demoTables are the tables demo data is seeded into, in the order their rows
+// are removed: rows referring to others first
+var demoTables = []string{"recordings", "audit_logs", "schedules", "credentials", "targets", "users", "zones"}
+
+// DemoRepository keeps track of the rows created by the demo data seeder
+type DemoRepository struct {
+	db *database.DB
+}
+
+// NewDemoRepository creates a new demo repository
+func NewDemoRepository(db *database.DB) *DemoRepository {
+	return &DemoRepository{db: db}
+}
+
+// Mark records that the row id of table is demo data
+func (r *DemoRepository) Mark(ctx context.Context, table string, id uuid.UUID) error {
+	query := `
+		INSERT INTO demo_records (table_name, record_id)
+		VALUES ($1, $2)
+		ON CONFLICT DO NOTHING
+	`
+
+	if _, err := r.db.ExecContext(ctx, query, table, id); err != nil {
+		return fmt.Errorf("failed to mark demo record: %w", err)
+	}
+	return nil
+}
+
+// IDs returns the IDs of the demo rows of table
+func (r *DemoRepository) IDs(ctx context.Context, table string) ([]uuid.UUID, error) {
+	var ids []uuid.UUID
+	query := `SELECT record_id FROM demo_records WHERE table_name = $1 ORDER BY created_at`
+	if err := r.db.SelectContext(ctx, &ids, query, table); err != nil {
+		return nil, fmt.Errorf("failed to list demo records: %w", err)
+	}
+	return ids, nil
+}
+
+// Count returns how many demo rows there are
+func (r *DemoRepository) Count(ctx context.Context) (int, error) {
+	var count int
+	if err := r.db.GetContext(ctx, &count, `SELECT COUNT(*) FROM demo_records`); err != nil {
+		return 0, fmt.Errorf("failed to count demo records: %w", err)
+	}
+	return count, nil
+}
+
+// Remove deletes every demo row, in one transaction, and returns how many rows
+// were deleted from each table. Sessions to demo targets are removed with
+// them, as they were made to try the demo out.
+func (r *DemoRepository) Remove(ctx context.Context) (map[string]int64, error) {
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	removed := make(map[string]int64, len(demoTables))
+	for _, table := range demoTables {
+		query := fmt.Sprintf(`
+			DELETE FROM %s
+			WHERE id IN (SELECT record_id FROM demo_records WHERE table_name = $1)
+		`, table)
+		if table == "audit_logs" {
+			query += ` OR target_id IN (SELECT record_id FROM demo_records WHERE table_name = 'targets')`
+		}
+
+		result, err := tx.ExecContext(ctx, query, table)
+		if err != nil {
+			return nil, fmt.Errorf("failed to remove demo %s: %w", table, err)
+		}
+		removed[table], _ = result.RowsAffected()
+	}
+
+	if _, err := tx.ExecContext(ctx, `DELETE FROM demo_records`); err != nil {
+		return nil, fmt.Errorf("failed to remove demo records: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return removed, nil
+}
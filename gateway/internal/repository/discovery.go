@@ -0,0 +1,378 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/VanCannon/openpam/gateway/internal/database"
+	"github.com/VanCannon/openpam/gateway/internal/models"
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+)
+
+// ErrScanRunning is returned when a target already has a discovery scan running
+var ErrScanRunning = errors.New("a discovery scan is already running for this target")
+
+// DiscoveryRepository handles discovery scans and the accounts they find
+type DiscoveryRepository struct {
+	db *database.DB
+}
+
+// NewDiscoveryRepository creates a new discovery repository
+func NewDiscoveryRepository(db *database.DB) *DiscoveryRepository {
+	return &DiscoveryRepository{db: db}
+}
+
+const discoveryScanColumns = `
+	id, target_id, credential_id, status, started_by, accounts_found, unmanaged_privileged,
+	warnings, error, started_at, finished_at
+`
+
+const discoveredAccountColumns = `
+	a.id, a.target_id, t.name AS target_name, a.username, a.uid, a.home, a.shell, a.groups,
+	a.privileged, a.privilege_reasons, a.sudo_rules, a.authorized_keys, a.login_enabled,
+	a.system_account, a.last_logon, a.credential_id, a.credential_id IS NOT NULL AS managed,
+	a.rotated_at, a.first_seen_at, a.last_seen_at, a.removed_at
+`
+
+// CreateScan records a running scan.
+// ErrScanRunning is returned if the target is already being scanned.
+func (r *DiscoveryRepository) CreateScan(ctx context.Context, scan *models.DiscoveryScan) error {
+	query := `
+		INSERT INTO discovery_scans (id, target_id, credential_id, status, started_by, started_at)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		ON CONFLICT DO NOTHING
+	`
+
+	scan.ID = uuid.New()
+	scan.Status = models.DiscoveryScanRunning
+	scan.StartedAt = time.Now()
+
+	result, err := r.db.ExecContext(ctx, query,
+		scan.ID,
+		scan.TargetID,
+		scan.CredentialID,
+		scan.Status,
+		scan.StartedBy,
+		scan.StartedAt,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to create discovery scan: %w", err)
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+	if rows == 0 {
+		return ErrScanRunning
+	}
+
+	return nil
+}
+
+// FinishScan stores the outcome of a scan
+func (r *DiscoveryRepository) FinishScan(ctx context.Context, scan *models.DiscoveryScan) error {
+	query := `
+		UPDATE discovery_scans
+		SET status = $1, accounts_found = $2, unmanaged_privileged = $3, warnings = $4, error = $5, finished_at = $6
+		WHERE id = $7
+	`
+
+	now := time.Now()
+	scan.FinishedAt = &now
+
+	warnings := scan.Warnings
+	if warnings == nil {
+		warnings = pq.StringArray{}
+	}
+
+	_, err := r.db.ExecContext(ctx, query,
+		scan.Status,
+		scan.AccountsFound,
+		scan.UnmanagedPrivileged,
+		warnings,
+		scan.Error,
+		scan.FinishedAt,
+		scan.ID,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to finish discovery scan: %w", err)
+	}
+
+	return nil
+}
+
+// FailStaleScans fails the scans left running since before the cutoff by a
+// replica that stopped, so their targets can be scanned again
+func (r *DiscoveryRepository) FailStaleScans(ctx context.Context, before time.Time) (int64, error) {
+	query := `
+		UPDATE discovery_scans
+		SET status = 'failed', error = 'scan was interrupted', finished_at = NOW()
+		WHERE status = 'running' AND started_at < $1
+	`
+
+	result, err := r.db.ExecContext(ctx, query, before)
+	if err != nil {
+		return 0, fmt.Errorf("failed to fail stale discovery scans: %w", err)
+	}
+
+	return result.RowsAffected()
+}
+
+// ListScans retrieves the scans of a target, newest first
+func (r *DiscoveryRepository) ListScans(ctx context.Context, targetID uuid.UUID, limit int) ([]*models.DiscoveryScan, error) {
+	query := `
+		SELECT ` + discoveryScanColumns + `
+		FROM discovery_scans
+		WHERE target_id = $1
+		ORDER BY started_at DESC
+		LIMIT $2
+	`
+
+	var scans []*models.DiscoveryScan
+	err := r.db.SelectContext(ctx, &scans, query, targetID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list discovery scans: %w", err)
+	}
+
+	return scans, nil
+}
+
+// ListDueTargets retrieves the enabled targets that haven't been scanned since
+// the cutoff, oldest scan first
+func (r *DiscoveryRepository) ListDueTargets(ctx context.Context, before time.Time, limit int) ([]uuid.UUID, error) {
+	query := `
+		SELECT t.id
+		FROM targets t
+		LEFT JOIN LATERAL (
+			SELECT MAX(started_at) AS last_started
+			FROM discovery_scans s
+			WHERE s.target_id = t.id
+		) s ON true
+		WHERE t.enabled = true AND t.deleted_at IS NULL AND t.protocol IN ('ssh', 'rdp')
+			AND EXISTS (SELECT 1 FROM credentials c WHERE c.target_id = t.id)
+			AND (s.last_started IS NULL OR s.last_started < $1)
+		ORDER BY s.last_started NULLS FIRST
+		LIMIT $2
+	`
+
+	var ids []uuid.UUID
+	err := r.db.SelectContext(ctx, &ids, query, before, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list targets due for discovery: %w", err)
+	}
+
+	return ids, nil
+}
+
+// SaveAccounts stores the accounts a scan found on its target. Accounts found
+// before are updated, accounts no longer found are marked removed, and every
+// account is linked to the target's credential for the same username, if any.
+// It returns the number of privileged accounts left unmanaged.
+func (r *DiscoveryRepository) SaveAccounts(ctx context.Context, scan *models.DiscoveryScan, accounts []*models.DiscoveredAccount) (int, error) {
+	upsert := `
+		INSERT INTO discovered_accounts (
+			id, target_id, username, uid, home, shell, groups, privileged, privilege_reasons,
+			sudo_rules, authorized_keys, login_enabled, system_account, last_logon, last_scan_id,
+			first_seen_at, last_seen_at
+		)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $16)
+		ON CONFLICT (target_id, username) DO UPDATE SET
+			uid = EXCLUDED.uid,
+			home = EXCLUDED.home,
+			shell = EXCLUDED.shell,
+			groups = EXCLUDED.groups,
+			privileged = EXCLUDED.privileged,
+			privilege_reasons = EXCLUDED.privilege_reasons,
+			sudo_rules = EXCLUDED.sudo_rules,
+			authorized_keys = EXCLUDED.authorized_keys,
+			login_enabled = EXCLUDED.login_enabled,
+			system_account = EXCLUDED.system_account,
+			last_logon = EXCLUDED.last_logon,
+			last_scan_id = EXCLUDED.last_scan_id,
+			last_seen_at = EXCLUDED.last_seen_at,
+			removed_at = NULL
+	`
+
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return 0, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	now := time.Now()
+	for _, a := range accounts {
+		_, err := tx.ExecContext(ctx, upsert,
+			uuid.New(),
+			scan.TargetID,
+			a.Username,
+			a.UID,
+			a.Home,
+			a.Shell,
+			nonNilTags(a.Groups),
+			a.Privileged,
+			nonNilTags(a.PrivilegeReasons),
+			nonNilTags(a.SudoRules),
+			a.AuthorizedKeys,
+			a.LoginEnabled,
+			a.SystemAccount,
+			a.LastLogon,
+			scan.ID,
+			now,
+		)
+		if err != nil {
+			return 0, fmt.Errorf("failed to save discovered account %s: %w", a.Username, err)
+		}
+	}
+
+	_, err = tx.ExecContext(ctx, `
+		UPDATE discovered_accounts
+		SET removed_at = $3
+		WHERE target_id = $1 AND last_scan_id IS DISTINCT FROM $2 AND removed_at IS NULL
+	`, scan.TargetID, scan.ID, now)
+	if err != nil {
+		return 0, fmt.Errorf("failed to mark removed accounts: %w", err)
+	}
+
+	// Windows usernames are case-insensitive, and Linux ones rarely differ by case
+	_, err = tx.ExecContext(ctx, `
+		UPDATE discovered_accounts a
+		SET credential_id = (
+			SELECT c.id FROM credentials c
+			WHERE c.target_id = a.target_id AND LOWER(c.username) = LOWER(a.username)
+			ORDER BY c.is_default DESC, c.created_at
+			LIMIT 1
+		)
+		WHERE a.target_id = $1
+	`, scan.TargetID)
+	if err != nil {
+		return 0, fmt.Errorf("failed to link discovered accounts to credentials: %w", err)
+	}
+
+	var unmanaged int
+	err = tx.GetContext(ctx, &unmanaged, `
+		SELECT COUNT(*) FROM discovered_accounts
+		WHERE target_id = $1 AND privileged AND credential_id IS NULL AND removed_at IS NULL
+	`, scan.TargetID)
+	if err != nil {
+		return 0, fmt.Errorf("failed to count unmanaged accounts: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return unmanaged, nil
+}
+
+// DiscoveredAccountFilter narrows the discovered accounts listed
+type DiscoveredAccountFilter struct {
+	TargetID       *uuid.UUID
+	Privileged     *bool
+	Managed        *bool
+	IncludeRemoved bool
+}
+
+// ListAccounts retrieves discovered accounts, unmanaged privileged accounts first
+func (r *DiscoveryRepository) ListAccounts(ctx context.Context, filter DiscoveredAccountFilter) ([]*models.DiscoveredAccount, error) {
+	query := `
+		SELECT ` + discoveredAccountColumns + `
+		FROM discovered_accounts a
+		JOIN targets t ON a.target_id = t.id
+		WHERE t.deleted_at IS NULL
+	`
+	var args []interface{}
+
+	if filter.TargetID != nil {
+		args = append(args, *filter.TargetID)
+		query += fmt.Sprintf(" AND a.target_id = $%d", len(args))
+	}
+	if filter.Privileged != nil {
+		args = append(args, *filter.Privileged)
+		query += fmt.Sprintf(" AND a.privileged = $%d", len(args))
+	}
+	if filter.Managed != nil {
+		args = append(args, *filter.Managed)
+		query += fmt.Sprintf(" AND (a.credential_id IS NOT NULL) = $%d", len(args))
+	}
+	if !filter.IncludeRemoved {
+		query += " AND a.removed_at IS NULL"
+	}
+
+	query += " ORDER BY (a.privileged AND a.credential_id IS NULL) DESC, t.name, a.username"
+
+	var accounts []*models.DiscoveredAccount
+	err := r.db.SelectContext(ctx, &accounts, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list discovered accounts: %w", err)
+	}
+
+	return accounts, nil
+}
+
+// GetAccount retrieves a discovered account by ID
+func (r *DiscoveryRepository) GetAccount(ctx context.Context, id uuid.UUID) (*models.DiscoveredAccount, error) {
+	query := `
+		SELECT ` + discoveredAccountColumns + `
+		FROM discovered_accounts a
+		JOIN targets t ON a.target_id = t.id
+		WHERE a.id = $1
+	`
+
+	var account models.DiscoveredAccount
+	err := r.db.GetContext(ctx, &account, query, id)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("discovered account not found")
+		}
+		return nil, fmt.Errorf("failed to get discovered account: %w", err)
+	}
+
+	return &account, nil
+}
+
+// ListDueRotations retrieves the onboarded accounts whose password was last
+// rotated before the cutoff, longest unrotated first
+func (r *DiscoveryRepository) ListDueRotations(ctx context.Context, before time.Time, limit int) ([]*models.DiscoveredAccount, error) {
+	query := `
+		SELECT ` + discoveredAccountColumns + `
+		FROM discovered_accounts a
+		JOIN targets t ON a.target_id = t.id
+		JOIN credentials c ON a.credential_id = c.id
+		WHERE t.enabled = true AND t.deleted_at IS NULL AND a.removed_at IS NULL
+			AND $1 = ANY(c.tags) AND a.rotated_at < $2
+		ORDER BY a.rotated_at
+		LIMIT $3
+	`
+
+	var accounts []*models.DiscoveredAccount
+	err := r.db.SelectContext(ctx, &accounts, query, models.CredentialTagDiscovered, before, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list accounts due for rotation: %w", err)
+	}
+
+	return accounts, nil
+}
+
+// SetRotated links a discovered account to the credential managing it and
+// records that its password was just set, which releases the credential
+// from quarantine
+func (r *DiscoveryRepository) SetRotated(ctx context.Context, id, credentialID uuid.UUID) error {
+	query := `
+		WITH rotated AS (
+			UPDATE discovered_accounts SET credential_id = $1, rotated_at = NOW() WHERE id = $2
+		)
+		UPDATE credentials SET ` + clearAuthFailures + ` WHERE id = $1
+	`
+
+	_, err := r.db.ExecContext(ctx, query, credentialID, id)
+	if err != nil {
+		return fmt.Errorf("failed to update discovered account: %w", err)
+	}
+
+	return nil
+}
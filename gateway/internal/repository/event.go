@@ -0,0 +1,118 @@
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/VanCannon/openpam/gateway/internal/database"
+	"github.com/VanCannon/openpam/gateway/internal/models"
+	"github.com/jmoiron/sqlx"
+)
+
+// EventRepository handles event log data operations
+type EventRepository struct {
+	db *database.DB
+}
+
+// NewEventRepository creates a new event repository
+func NewEventRepository(db *database.DB) *EventRepository {
+	return &EventRepository{db: db}
+}
+
+// Append records an event and notifies listeners
+func (r *EventRepository) Append(ctx context.Context, eventType string, payload interface{}) error {
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if err := appendEvent(ctx, tx, eventType, payload); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return nil
+}
+
+// GetByID retrieves an event by ID
+func (r *EventRepository) GetByID(ctx context.Context, id int64) (*models.Event, error) {
+	query := `SELECT id, type, payload, created_at FROM events WHERE id = $1`
+
+	var event models.Event
+	if err := r.db.GetContext(ctx, &event, query, id); err != nil {
+		return nil, fmt.Errorf("failed to get event: %w", err)
+	}
+
+	return &event, nil
+}
+
+// ListSince retrieves up to limit events with an ID greater than afterID, oldest first
+func (r *EventRepository) ListSince(ctx context.Context, afterID int64, limit int) ([]*models.Event, error) {
+	query := `
+		SELECT id, type, payload, created_at
+		FROM events
+		WHERE id > $1
+		ORDER BY id ASC
+		LIMIT $2
+	`
+
+	var events []*models.Event
+	if err := r.db.SelectContext(ctx, &events, query, afterID, limit); err != nil {
+		return nil, fmt.Errorf("failed to list events: %w", err)
+	}
+
+	return events, nil
+}
+
+// LatestID returns the ID of the newest event, or 0 if there are none
+func (r *EventRepository) LatestID(ctx context.Context) (int64, error) {
+	var id int64
+	if err := r.db.GetContext(ctx, &id, `SELECT COALESCE(MAX(id), 0) FROM events`); err != nil {
+		return 0, fmt.Errorf("failed to get latest event ID: %w", err)
+	}
+
+	return id, nil
+}
+
+// DeleteBefore removes events created before the cutoff and returns how many were removed
+func (r *EventRepository) DeleteBefore(ctx context.Context, cutoff time.Time) (int64, error) {
+	result, err := r.db.ExecContext(ctx, `DELETE FROM events WHERE created_at < $1`, cutoff)
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete old events: %w", err)
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("failed to get rows affected: %w", err)
+	}
+
+	return rows, nil
+}
+
+// appendEvent records an event inside tx. The notification is only delivered when
+// tx commits, so listeners never see an event whose source change was rolled back.
+func appendEvent(ctx context.Context, tx *sqlx.Tx, eventType string, payload interface{}) error {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("failed to marshal event payload: %w", err)
+	}
+
+	var id int64
+	query := `INSERT INTO events (type, payload, created_at) VALUES ($1, $2, $3) RETURNING id`
+	if err := tx.QueryRowxContext(ctx, query, eventType, string(data), time.Now()).Scan(&id); err != nil {
+		return fmt.Errorf("failed to append event: %w", err)
+	}
+
+	if _, err := tx.ExecContext(ctx, `SELECT pg_notify($1, $2)`, models.StreamEventChannel, strconv.FormatInt(id, 10)); err != nil {
+		return fmt.Errorf("failed to notify event: %w", err)
+	}
+
+	return nil
+}
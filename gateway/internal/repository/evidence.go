@@ -0,0 +1,92 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/VanCannon/openpam/gateway/internal/database"
+	"github.com/VanCannon/openpam/gateway/internal/models"
+	"github.com/google/uuid"
+)
+
+// EvidenceRepository handles evidence captured on policy violations
+type EvidenceRepository struct {
+	db *database.DB
+}
+
+// NewEvidenceRepository creates a new evidence repository
+func NewEvidenceRepository(db *database.DB) *EvidenceRepository {
+	return &EvidenceRepository{db: db}
+}
+
+// CreateEvidence stores captured evidence. The ID is set by the caller because
+// it is bound into the encryption.
+func (r *EvidenceRepository) CreateEvidence(ctx context.Context, evidence *models.ViolationEvidence) error {
+	query := `
+		INSERT INTO violation_evidence (
+			id, system_audit_log_id, audit_log_id, violation_type, kind, content_type, size, sha256, ciphertext, created_at
+		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+	`
+
+	evidence.CreatedAt = time.Now()
+
+	_, err := r.db.ExecContext(ctx, query,
+		evidence.ID,
+		evidence.SystemAuditLogID,
+		evidence.AuditLogID,
+		evidence.ViolationType,
+		evidence.Kind,
+		evidence.ContentType,
+		evidence.Size,
+		evidence.SHA256,
+		evidence.Ciphertext,
+		evidence.CreatedAt,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to create evidence: %w", err)
+	}
+
+	return nil
+}
+
+// GetByID retrieves evidence, including its ciphertext, by ID
+func (r *EvidenceRepository) GetByID(ctx context.Context, id uuid.UUID) (*models.ViolationEvidence, error) {
+	query := `
+		SELECT id, system_audit_log_id, audit_log_id, violation_type, kind, content_type, size, sha256, ciphertext, created_at
+		FROM violation_evidence
+		WHERE id = $1
+	`
+
+	var evidence models.ViolationEvidence
+	err := r.db.GetContext(ctx, &evidence, query, id)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("evidence not found")
+		}
+		return nil, fmt.Errorf("failed to get evidence: %w", err)
+	}
+
+	return &evidence, nil
+}
+
+// ListBySession retrieves the evidence captured in a session, oldest first.
+// The ciphertext is left out; it is returned by GetByID.
+func (r *EvidenceRepository) ListBySession(ctx context.Context, auditLogID uuid.UUID) ([]*models.ViolationEvidence, error) {
+	query := `
+		SELECT id, system_audit_log_id, audit_log_id, violation_type, kind, content_type, size, sha256,
+		       ''::bytea AS ciphertext, created_at
+		FROM violation_evidence
+		WHERE audit_log_id = $1
+		ORDER BY created_at
+	`
+
+	var evidence []*models.ViolationEvidence
+	err := r.db.SelectContext(ctx, &evidence, query, auditLogID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list evidence: %w", err)
+	}
+
+	return evidence, nil
+}
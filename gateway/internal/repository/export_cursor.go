@@ -0,0 +1,70 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/VanCannon/openpam/gateway/internal/database"
+)
+
+// ExportCursorRepository stores how far each exporter has read the event log
+type ExportCursorRepository struct {
+	db *database.DB
+}
+
+// NewExportCursorRepository creates a new export cursor repository
+func NewExportCursorRepository(db *database.DB) *ExportCursorRepository {
+	return &ExportCursorRepository{db: db}
+}
+
+// Advance locks the named cursor, calls fn with the last exported event ID and
+// stores the ID fn returns. When another replica holds the cursor it returns
+// false without calling fn, so each event is exported by one replica at a time.
+// The cursor is left unchanged if fn fails.
+func (r *ExportCursorRepository) Advance(ctx context.Context, name string, fn func(lastID int64) (int64, error)) (bool, error) {
+	if _, err := r.db.ExecContext(ctx,
+		`INSERT INTO export_cursors (name) VALUES ($1) ON CONFLICT (name) DO NOTHING`, name,
+	); err != nil {
+		return false, fmt.Errorf("failed to create export cursor: %w", err)
+	}
+
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return false, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	var lastID int64
+	err = tx.QueryRowxContext(ctx,
+		`SELECT last_event_id FROM export_cursors WHERE name = $1 FOR UPDATE SKIP LOCKED`, name,
+	).Scan(&lastID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to lock export cursor: %w", err)
+	}
+
+	nextID, err := fn(lastID)
+	if err != nil {
+		return true, err
+	}
+
+	if nextID != lastID {
+		if _, err := tx.ExecContext(ctx,
+			`UPDATE export_cursors SET last_event_id = $1, updated_at = $2 WHERE name = $3`,
+			nextID, time.Now(), name,
+		); err != nil {
+			return true, fmt.Errorf("failed to update export cursor: %w", err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return true, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return true, nil
+}
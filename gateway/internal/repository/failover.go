@@ -0,0 +1,58 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/VanCannon/openpam/gateway/internal/database"
+	"github.com/VanCannon/openpam/gateway/internal/models"
+)
+
+// FailoverRepository handles the history of standby gateways changing state
+type FailoverRepository struct {
+	db *database.DB
+}
+
+// NewFailoverRepository creates a new failover repository
+func NewFailoverRepository(db *database.DB) *FailoverRepository {
+	return &FailoverRepository{db: db}
+}
+
+// Record adds a state change to the history
+func (r *FailoverRepository) Record(ctx context.Context, event *models.FailoverEvent) error {
+	query := `
+		INSERT INTO failover_events (id, node, from_state, to_state, reason, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6)
+	`
+
+	_, err := r.db.ExecContext(ctx, query,
+		event.ID,
+		event.Node,
+		event.FromState,
+		event.ToState,
+		event.Reason,
+		event.CreatedAt,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to record failover event: %w", err)
+	}
+
+	return nil
+}
+
+// List retrieves the most recent state changes, newest first
+func (r *FailoverRepository) List(ctx context.Context, limit int) ([]*models.FailoverEvent, error) {
+	query := `
+		SELECT id, node, from_state, to_state, reason, created_at
+		FROM failover_events
+		ORDER BY created_at DESC
+		LIMIT $1
+	`
+
+	var events []*models.FailoverEvent
+	if err := r.db.SelectContext(ctx, &events, query, limit); err != nil {
+		return nil, fmt.Errorf("failed to list failover events: %w", err)
+	}
+
+	return events, nil
+}
@@ -0,0 +1,123 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/VanCannon/openpam/gateway/internal/database"
+	"github.com/VanCannon/openpam/gateway/internal/models"
+	"github.com/google/uuid"
+)
+
+// ErrTooManyFavorites is returned when a user has starred the maximum number of targets
+var ErrTooManyFavorites = fmt.Errorf("a user can star at most %d targets", models.MaxFavoriteTargets)
+
+// recentWindow bounds how far back audit history is read for recent targets
+const recentWindow = "90 days"
+
+// FavoriteRepository handles users' favorite and recently used targets
+type FavoriteRepository struct {
+	db *database.DB
+}
+
+// NewFavoriteRepository creates a new favorite repository
+func NewFavoriteRepository(db *database.DB) *FavoriteRepository {
+	return &FavoriteRepository{db: db}
+}
+
+// Add stars a target for a user. Starring a target twice is a no-op.
+func (r *FavoriteRepository) Add(ctx context.Context, userID, targetID uuid.UUID) error {
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	// Concurrent requests for the same user wait on the user's row, so each one
+	// counts the favorites added before it
+	if _, err := tx.ExecContext(ctx, `SELECT 1 FROM users WHERE id = $1 FOR UPDATE`, userID); err != nil {
+		return fmt.Errorf("failed to lock user: %w", err)
+	}
+
+	var count int
+	var exists bool
+	err = tx.QueryRowContext(ctx, `
+		SELECT COUNT(*), COUNT(*) FILTER (WHERE target_id = $2) > 0
+		FROM target_favorites
+		WHERE user_id = $1
+	`, userID, targetID).Scan(&count, &exists)
+	if err != nil {
+		return fmt.Errorf("failed to count favorites: %w", err)
+	}
+	if exists {
+		return nil
+	}
+	if count >= models.MaxFavoriteTargets {
+		return ErrTooManyFavorites
+	}
+
+	query := `INSERT INTO target_favorites (user_id, target_id) VALUES ($1, $2)`
+	if _, err := tx.ExecContext(ctx, query, userID, targetID); err != nil {
+		return fmt.Errorf("failed to add favorite: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return nil
+}
+
+// Remove unstars a target for a user
+func (r *FavoriteRepository) Remove(ctx context.Context, userID, targetID uuid.UUID) error {
+	query := `DELETE FROM target_favorites WHERE user_id = $1 AND target_id = $2`
+
+	if _, err := r.db.ExecContext(ctx, query, userID, targetID); err != nil {
+		return fmt.Errorf("failed to remove favorite: %w", err)
+	}
+	return nil
+}
+
+// List retrieves a user's enabled favorite targets, most recently starred first
+func (r *FavoriteRepository) List(ctx context.Context, userID uuid.UUID) ([]*models.LauncherTarget, error) {
+	query := `
+		SELECT ` + targetColumns + `, favorited_at
+		FROM targets
+		JOIN (
+			SELECT target_id, created_at AS favorited_at
+			FROM target_favorites
+			WHERE user_id = $1
+		) f ON f.target_id = targets.id
+		WHERE enabled = true AND deleted_at IS NULL
+		ORDER BY favorited_at DESC
+	`
+
+	targets := []*models.LauncherTarget{}
+	if err := r.db.SelectContext(ctx, &targets, query, userID); err != nil {
+		return nil, fmt.Errorf("failed to list favorites: %w", err)
+	}
+	return targets, nil
+}
+
+// Recent retrieves the enabled targets a user most recently connected to,
+// with their number of sessions over the recent window
+func (r *FavoriteRepository) Recent(ctx context.Context, userID uuid.UUID, limit int) ([]*models.LauncherTarget, error) {
+	query := `
+		SELECT ` + targetColumns + `, last_used_at, sessions
+		FROM targets
+		JOIN (
+			SELECT target_id, MAX(start_time) AS last_used_at, COUNT(*) AS sessions
+			FROM audit_logs
+			WHERE user_id = $1 AND start_time > NOW() - INTERVAL '` + recentWindow + `'
+			GROUP BY target_id
+		) u ON u.target_id = targets.id
+		WHERE enabled = true AND deleted_at IS NULL
+		ORDER BY last_used_at DESC
+		LIMIT $2
+	`
+
+	targets := []*models.LauncherTarget{}
+	if err := r.db.SelectContext(ctx, &targets, query, userID, limit); err != nil {
+		return nil, fmt.Errorf("failed to list recent targets: %w", err)
+	}
+	return targets, nil
+}
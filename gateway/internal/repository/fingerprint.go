@@ -0,0 +1,121 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/VanCannon/openpam/gateway/internal/database"
+	"github.com/VanCannon/openpam/gateway/internal/models"
+	"github.com/google/uuid"
+)
+
+// FingerprintRepository handles the fingerprints of targets
+type FingerprintRepository struct {
+	db *database.DB
+}
+
+// NewFingerprintRepository creates a new fingerprint repository
+func NewFingerprintRepository(db *database.DB) *FingerprintRepository {
+	return &FingerprintRepository{db: db}
+}
+
+const targetFingerprintColumns = `f.target_id, t.name AS target_name, f.host, f.services, f.os, f.os_version,
+	f.os_family, f.os_source, f.suggested_protocol, f.suggested_port, f.probed_at`
+
+// Save stores a target's fingerprint, replacing the one before
+func (r *FingerprintRepository) Save(ctx context.Context, targetID uuid.UUID, fp *models.Fingerprint) error {
+	_, err := r.db.ExecContext(ctx, `
+		INSERT INTO target_fingerprints (target_id, host, services, os, os_version, os_family, os_source, suggested_protocol, suggested_port, probed_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+		ON CONFLICT (target_id) DO UPDATE SET
+			host = EXCLUDED.host,
+			services = EXCLUDED.services,
+			os = EXCLUDED.os,
+			os_version = EXCLUDED.os_version,
+			os_family = EXCLUDED.os_family,
+			os_source = EXCLUDED.os_source,
+			suggested_protocol = EXCLUDED.suggested_protocol,
+			suggested_port = EXCLUDED.suggested_port,
+			probed_at = EXCLUDED.probed_at
+	`,
+		targetID,
+		fp.Host,
+		fp.Services,
+		fp.OS,
+		fp.OSVersion,
+		fp.OSFamily,
+		fp.OSSource,
+		fp.SuggestedProtocol,
+		fp.SuggestedPort,
+		fp.ProbedAt,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to save fingerprint: %w", err)
+	}
+
+	return nil
+}
+
+// Get retrieves a target's fingerprint
+func (r *FingerprintRepository) Get(ctx context.Context, targetID uuid.UUID) (*models.TargetFingerprint, error) {
+	query := `
+		SELECT ` + targetFingerprintColumns + `
+		FROM target_fingerprints f
+		JOIN targets t ON f.target_id = t.id
+		WHERE f.target_id = $1
+	`
+
+	var fp models.TargetFingerprint
+	err := r.db.GetContext(ctx, &fp, query, targetID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("fingerprint not found")
+		}
+		return nil, fmt.Errorf("failed to get fingerprint: %w", err)
+	}
+
+	return &fp, nil
+}
+
+// FingerprintFilter narrows a fingerprint listing; empty fields match all
+type FingerprintFilter struct {
+	OSFamily string
+	Product  string // Case-insensitive, such as "openssh"
+	Version  string // Prefix of the product's version, such as "8."
+}
+
+// List retrieves the fingerprints of the targets that aren't deleted, by target name
+func (r *FingerprintRepository) List(ctx context.Context, filter FingerprintFilter) ([]*models.TargetFingerprint, error) {
+	query := `
+		SELECT ` + targetFingerprintColumns + `
+		FROM target_fingerprints f
+		JOIN targets t ON f.target_id = t.id
+		WHERE t.deleted_at IS NULL
+	`
+	var args []interface{}
+
+	if filter.OSFamily != "" {
+		args = append(args, filter.OSFamily)
+		query += fmt.Sprintf(" AND f.os_family = $%d", len(args))
+	}
+	if filter.Product != "" {
+		args = append(args, filter.Product)
+		service := fmt.Sprintf("lower(s->>'product') = lower($%d)", len(args))
+		if filter.Version != "" {
+			args = append(args, filter.Version)
+			service += fmt.Sprintf(" AND starts_with(s->>'version', $%d)", len(args))
+		}
+		query += " AND EXISTS (SELECT 1 FROM jsonb_array_elements(f.services) s WHERE " + service + ")"
+	}
+
+	query += " ORDER BY t.name"
+
+	var fps []*models.TargetFingerprint
+	err := r.db.SelectContext(ctx, &fps, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list fingerprints: %w", err)
+	}
+
+	return fps, nil
+}
@@ -2,6 +2,8 @@ package repository
 
 import (
 	"context"
+	"database/sql"
+	"errors"
 	"fmt"
 
 	"github.com/VanCannon/openpam/gateway/internal/database"
@@ -9,6 +11,18 @@ import (
 	"github.com/google/uuid"
 )
 
+// ErrGroupNotFound is returned when a group doesn't exist
+var ErrGroupNotFound = errors.New("group not found")
+
+// ErrNotMember is returned when removing a user who isn't in the group
+var ErrNotMember = errors.New("user is not a member of the group")
+
+// ErrGroupInQuorum is returned when deleting a group a risk tier's approval
+// quorum needs approvals from
+var ErrGroupInQuorum = errors.New("group is required by an approval quorum")
+
+const groupColumns = `g.id, g.name, COALESCE(g.dn, '') as dn, COALESCE(g.description, '') as description, g.role, g.source, g.created_at`
+
 type GroupRepository struct {
 	db *database.DB
 }
@@ -41,7 +55,17 @@ func (r *GroupRepository) GetByDN(ctx context.Context, dn string) (*models.Group
 	return &group, nil
 }
 
+// Delete deletes a group. ErrGroupInQuorum is returned while an approval
+// quorum needs the group's approvals.
 func (r *GroupRepository) Delete(ctx context.Context, id uuid.UUID) error {
+	var inQuorum bool
+	if err := r.db.GetContext(ctx, &inQuorum, `SELECT EXISTS (SELECT 1 FROM approval_quorums WHERE group_id = $1)`, id); err != nil {
+		return fmt.Errorf("failed to check approval quorums: %w", err)
+	}
+	if inQuorum {
+		return ErrGroupInQuorum
+	}
+
 	query := `DELETE FROM groups WHERE id = $1`
 
 	_, err := r.db.ExecContext(ctx, query, id)
@@ -51,3 +75,139 @@ func (r *GroupRepository) Delete(ctx context.Context, id uuid.UUID) error {
 
 	return nil
 }
+
+// Create creates a local group, whose members are managed in OpenPAM
+func (r *GroupRepository) Create(ctx context.Context, group *models.Group) error {
+	query := `
+		INSERT INTO groups (id, name, description, role, source, created_at)
+		VALUES ($1, $2, $3, $4, $5, NOW())
+		RETURNING created_at
+	`
+
+	group.ID = uuid.New()
+	group.Source = models.GroupSourceLocal
+
+	err := r.db.GetContext(ctx, &group.CreatedAt, query, group.ID, group.Name, group.Description, group.Role, group.Source)
+	if err != nil {
+		return fmt.Errorf("failed to create group: %w", err)
+	}
+
+	return nil
+}
+
+// GetByID retrieves a group by ID
+func (r *GroupRepository) GetByID(ctx context.Context, id uuid.UUID) (*models.Group, error) {
+	query := `SELECT ` + groupColumns + ` FROM groups g WHERE g.id = $1`
+
+	var group models.Group
+	err := r.db.GetContext(ctx, &group, query, id)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrGroupNotFound
+		}
+		return nil, fmt.Errorf("failed to get group: %w", err)
+	}
+
+	return &group, nil
+}
+
+// AddMember adds a user to a group. Adding an existing member changes nothing.
+func (r *GroupRepository) AddMember(ctx context.Context, groupID, userID uuid.UUID, source string) error {
+	query := `
+		INSERT INTO group_members (group_id, user_id, source)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (group_id, user_id) DO NOTHING
+	`
+
+	_, err := r.db.ExecContext(ctx, query, groupID, userID, source)
+	if err != nil {
+		return fmt.Errorf("failed to add group member: %w", err)
+	}
+
+	return nil
+}
+
+// RemoveMember removes a user from a group
+func (r *GroupRepository) RemoveMember(ctx context.Context, groupID, userID uuid.UUID) error {
+	query := `DELETE FROM group_members WHERE group_id = $1 AND user_id = $2`
+
+	result, err := r.db.ExecContext(ctx, query, groupID, userID)
+	if err != nil {
+		return fmt.Errorf("failed to remove group member: %w", err)
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+	if rows == 0 {
+		return ErrNotMember
+	}
+
+	return nil
+}
+
+// ListMembers retrieves the members of a group, ordered by email
+func (r *GroupRepository) ListMembers(ctx context.Context, groupID uuid.UUID) ([]*models.GroupMember, error) {
+	query := `
+		SELECT m.group_id, m.user_id, u.email, COALESCE(u.display_name, '') AS display_name, m.source, m.created_at
+		FROM group_members m
+		JOIN users u ON u.id = m.user_id
+		WHERE m.group_id = $1
+		ORDER BY u.email
+	`
+
+	members := []*models.GroupMember{}
+	err := r.db.SelectContext(ctx, &members, query, groupID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list group members: %w", err)
+	}
+
+	return members, nil
+}
+
+// ListMemberIDs retrieves the IDs of a group's members
+func (r *GroupRepository) ListMemberIDs(ctx context.Context, groupID uuid.UUID) ([]uuid.UUID, error) {
+	query := `SELECT user_id FROM group_members WHERE group_id = $1`
+
+	ids := []uuid.UUID{}
+	err := r.db.SelectContext(ctx, &ids, query, groupID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list group member IDs: %w", err)
+	}
+
+	return ids, nil
+}
+
+// ListByUser retrieves the groups a user is a member of, ordered by name
+func (r *GroupRepository) ListByUser(ctx context.Context, userID uuid.UUID) ([]models.Group, error) {
+	query := `
+		SELECT ` + groupColumns + `
+		FROM groups g
+		JOIN group_members m ON m.group_id = g.id
+		WHERE m.user_id = $1
+		ORDER BY g.name
+	`
+
+	groups := []models.Group{}
+	err := r.db.SelectContext(ctx, &groups, query, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list user groups: %w", err)
+	}
+
+	return groups, nil
+}
+
+// ListGroupIDsByUser retrieves the IDs of the groups a user is a member of, so
+// the repository can back the policy engine
+func (r *GroupRepository) ListGroupIDsByUser(ctx context.Context, userID uuid.UUID) ([]uuid.UUID, error) {
+	query := `SELECT group_id FROM group_members WHERE user_id = $1`
+
+	ids := []uuid.UUID{}
+	err := r.db.SelectContext(ctx, &ids, query, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list user group IDs: %w", err)
+	}
+
+	return ids, nil
+}
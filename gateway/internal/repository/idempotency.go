@@ -0,0 +1,97 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/VanCannon/openpam/gateway/internal/database"
+	"github.com/VanCannon/openpam/gateway/internal/models"
+	"github.com/google/uuid"
+)
+
+// IdempotencyRepository handles the requests recorded under idempotency keys
+type IdempotencyRepository struct {
+	db *database.DB
+}
+
+// NewIdempotencyRepository creates a new idempotency repository
+func NewIdempotencyRepository(db *database.DB) *IdempotencyRepository {
+	return &IdempotencyRepository{db: db}
+}
+
+// Reserve records a request under its key unless the user already made one
+// under it. It returns the earlier request, or nil if the key was free; an
+// expired key is free.
+func (r *IdempotencyRepository) Reserve(ctx context.Context, key *models.IdempotencyKey) (*models.IdempotencyKey, error) {
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, `DELETE FROM idempotency_keys WHERE user_id = $1 AND key = $2 AND expires_at <= $3`,
+		key.UserID, key.Key, key.CreatedAt); err != nil {
+		return nil, fmt.Errorf("failed to free expired idempotency key: %w", err)
+	}
+
+	result, err := tx.ExecContext(ctx, `
+		INSERT INTO idempotency_keys (user_id, key, method, path, request_hash, status, created_at, expires_at)
+		VALUES ($1, $2, $3, $4, $5, 0, $6, $7)
+		ON CONFLICT (user_id, key) DO NOTHING
+	`, key.UserID, key.Key, key.Method, key.Path, key.RequestHash, key.CreatedAt, key.ExpiresAt)
+	if err != nil {
+		return nil, fmt.Errorf("failed to reserve idempotency key: %w", err)
+	}
+
+	var existing *models.IdempotencyKey
+	if inserted, _ := result.RowsAffected(); inserted == 0 {
+		existing = &models.IdempotencyKey{}
+		err := tx.GetContext(ctx, existing, `
+			SELECT user_id, key, method, path, request_hash, status, headers, body, created_at, expires_at
+			FROM idempotency_keys
+			WHERE user_id = $1 AND key = $2
+		`, key.UserID, key.Key)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get idempotency key: %w", err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return existing, nil
+}
+
+// Complete stores the response to the request recorded under a key
+func (r *IdempotencyRepository) Complete(ctx context.Context, key *models.IdempotencyKey) error {
+	query := `
+		UPDATE idempotency_keys
+		SET status = $3, headers = $4, body = $5
+		WHERE user_id = $1 AND key = $2
+	`
+
+	if _, err := r.db.ExecContext(ctx, query, key.UserID, key.Key, key.Status, string(key.Headers), key.Body); err != nil {
+		return fmt.Errorf("failed to complete idempotency key: %w", err)
+	}
+	return nil
+}
+
+// Release frees a key whose request wasn't completed, so it can be retried
+func (r *IdempotencyRepository) Release(ctx context.Context, userID uuid.UUID, key string) error {
+	query := `DELETE FROM idempotency_keys WHERE user_id = $1 AND key = $2 AND status = 0`
+
+	if _, err := r.db.ExecContext(ctx, query, userID, key); err != nil {
+		return fmt.Errorf("failed to release idempotency key: %w", err)
+	}
+	return nil
+}
+
+// DeleteExpired deletes the keys that expired before cutoff
+func (r *IdempotencyRepository) DeleteExpired(ctx context.Context, cutoff time.Time) (int64, error) {
+	result, err := r.db.ExecContext(ctx, `DELETE FROM idempotency_keys WHERE expires_at < $1`, cutoff)
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete expired idempotency keys: %w", err)
+	}
+	return result.RowsAffected()
+}
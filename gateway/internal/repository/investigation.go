@@ -0,0 +1,233 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/VanCannon/openpam/gateway/internal/actor"
+	"github.com/VanCannon/openpam/gateway/internal/database"
+	"github.com/VanCannon/openpam/gateway/internal/models"
+	"github.com/google/uuid"
+)
+
+// ErrAlreadyAttached is returned when the evidence is already part of the investigation
+var ErrAlreadyAttached = errors.New("item already attached to investigation")
+
+// InvestigationRepository handles investigations and their evidence
+type InvestigationRepository struct {
+	db *database.DB
+}
+
+// NewInvestigationRepository creates a new investigation repository
+func NewInvestigationRepository(db *database.DB) *InvestigationRepository {
+	return &InvestigationRepository{db: db}
+}
+
+const investigationColumns = `
+	i.id, i.title, i.description, i.status, i.owner_id, u.email AS owner_email, i.created_by,
+	(SELECT COUNT(*) FROM investigation_items it WHERE it.investigation_id = i.id) AS item_count,
+	i.version, i.created_at, i.updated_at, i.closed_at
+`
+
+// Create creates a new investigation
+func (r *InvestigationRepository) Create(ctx context.Context, inv *models.Investigation) error {
+	query := `
+		INSERT INTO investigations (id, title, description, status, owner_id, created_by, updated_by, version, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $6, $7, $8, $9)
+	`
+
+	inv.ID = uuid.New()
+	if inv.CreatedBy == nil {
+		inv.CreatedBy = actor.UserID(ctx)
+	}
+	inv.Version = 1
+	inv.CreatedAt = time.Now()
+	inv.UpdatedAt = inv.CreatedAt
+
+	_, err := r.db.ExecContext(ctx, query,
+		inv.ID,
+		inv.Title,
+		inv.Description,
+		inv.Status,
+		inv.OwnerID,
+		inv.CreatedBy,
+		inv.Version,
+		inv.CreatedAt,
+		inv.UpdatedAt,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to create investigation: %w", err)
+	}
+
+	return nil
+}
+
+// GetByID retrieves an investigation by ID
+func (r *InvestigationRepository) GetByID(ctx context.Context, id uuid.UUID) (*models.Investigation, error) {
+	query := `
+		SELECT ` + investigationColumns + `
+		FROM investigations i
+		LEFT JOIN users u ON i.owner_id = u.id
+		WHERE i.id = $1
+	`
+
+	var inv models.Investigation
+	err := r.db.GetContext(ctx, &inv, query, id)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("investigation not found")
+		}
+		return nil, fmt.Errorf("failed to get investigation: %w", err)
+	}
+
+	return &inv, nil
+}
+
+// List retrieves investigations, most recently updated first, optionally
+// filtered by status and owner
+func (r *InvestigationRepository) List(ctx context.Context, status string, ownerID *uuid.UUID, limit, offset int) ([]*models.Investigation, error) {
+	query := `
+		SELECT ` + investigationColumns + `
+		FROM investigations i
+		LEFT JOIN users u ON i.owner_id = u.id
+		WHERE ($1 = '' OR i.status = $1) AND ($2::uuid IS NULL OR i.owner_id = $2)
+		ORDER BY i.updated_at DESC
+		LIMIT $3 OFFSET $4
+	`
+
+	var invs []*models.Investigation
+	err := r.db.SelectContext(ctx, &invs, query, status, ownerID, limit, offset)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list investigations: %w", err)
+	}
+
+	return invs, nil
+}
+
+// Update updates an investigation if it is still at the version the caller read.
+// Closing sets closed_at; reopening clears it.
+func (r *InvestigationRepository) Update(ctx context.Context, inv *models.Investigation) error {
+	query := `
+		UPDATE investigations
+		SET title = $1, description = $2, status = $3, owner_id = $4, updated_at = $5, updated_by = $8,
+		    closed_at = CASE WHEN $3 = 'closed' THEN COALESCE(closed_at, $5) END,
+		    version = version + 1
+		WHERE id = $6 AND version = $7
+		RETURNING closed_at
+	`
+
+	inv.UpdatedAt = time.Now()
+
+	err := r.db.GetContext(ctx, &inv.ClosedAt, query,
+		inv.Title,
+		inv.Description,
+		inv.Status,
+		inv.OwnerID,
+		inv.UpdatedAt,
+		inv.ID,
+		inv.Version,
+		actor.UserID(ctx),
+	)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return versionMiss(ctx, r.db, "investigations", "", inv.ID, fmt.Errorf("investigation not found"))
+		}
+		return fmt.Errorf("failed to update investigation: %w", err)
+	}
+
+	inv.Version++
+	return nil
+}
+
+// AddItem attaches evidence or a note to an investigation. Attaching the same
+// session, event or annotation twice returns ErrAlreadyAttached.
+func (r *InvestigationRepository) AddItem(ctx context.Context, item *models.InvestigationItem) error {
+	query := `
+		INSERT INTO investigation_items (
+			id, investigation_id, item_type, audit_log_id, system_audit_log_id, annotation_id, note, added_by, created_at
+		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+		ON CONFLICT DO NOTHING
+	`
+
+	item.ID = uuid.New()
+	item.CreatedAt = time.Now()
+
+	result, err := r.db.ExecContext(ctx, query,
+		item.ID,
+		item.InvestigationID,
+		item.ItemType,
+		item.AuditLogID,
+		item.SystemAuditLogID,
+		item.AnnotationID,
+		item.Note,
+		item.AddedBy,
+		item.CreatedAt,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to add investigation item: %w", err)
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+
+	if rows == 0 {
+		return ErrAlreadyAttached
+	}
+
+	return r.touch(ctx, item.InvestigationID)
+}
+
+// ListItems retrieves the items of an investigation in the order they were added
+func (r *InvestigationRepository) ListItems(ctx context.Context, investigationID uuid.UUID) ([]*models.InvestigationItem, error) {
+	query := `
+		SELECT it.id, it.investigation_id, it.item_type, it.audit_log_id, it.system_audit_log_id,
+		       it.annotation_id, it.note, it.added_by, u.email AS added_by_email, it.created_at
+		FROM investigation_items it
+		LEFT JOIN users u ON it.added_by = u.id
+		WHERE it.investigation_id = $1
+		ORDER BY it.created_at
+	`
+
+	var items []*models.InvestigationItem
+	err := r.db.SelectContext(ctx, &items, query, investigationID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list investigation items: %w", err)
+	}
+
+	return items, nil
+}
+
+// RemoveItem detaches an item from an investigation
+func (r *InvestigationRepository) RemoveItem(ctx context.Context, investigationID, itemID uuid.UUID) error {
+	query := `DELETE FROM investigation_items WHERE id = $1 AND investigation_id = $2`
+
+	result, err := r.db.ExecContext(ctx, query, itemID, investigationID)
+	if err != nil {
+		return fmt.Errorf("failed to remove investigation item: %w", err)
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+
+	if rows == 0 {
+		return fmt.Errorf("investigation item not found")
+	}
+
+	return r.touch(ctx, investigationID)
+}
+
+// touch marks an investigation as updated when its evidence changes
+func (r *InvestigationRepository) touch(ctx context.Context, id uuid.UUID) error {
+	_, err := r.db.ExecContext(ctx, `UPDATE investigations SET updated_at = $1, updated_by = $3 WHERE id = $2`, time.Now(), id, actor.UserID(ctx))
+	if err != nil {
+		return fmt.Errorf("failed to update investigation: %w", err)
+	}
+	return nil
+}
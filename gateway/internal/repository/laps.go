@@ -0,0 +1,212 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/VanCannon/openpam/gateway/internal/database"
+	"github.com/VanCannon/openpam/gateway/internal/models"
+	"github.com/google/uuid"
+)
+
+// LAPSRepository handles the Windows machines enrolled in LAPS-style password rotation
+type LAPSRepository struct {
+	db *database.DB
+}
+
+// NewLAPSRepository creates a new LAPS repository
+func NewLAPSRepository(db *database.DB) *LAPSRepository {
+	return &LAPSRepository{db: db}
+}
+
+const lapsMachineColumns = `
+	m.target_id, t.name AS target_name, m.account_name, m.credential_id, m.vault_path, m.enabled,
+	m.last_rotated_at, m.next_rotation_at, m.last_attempt_at, m.last_error, m.failures,
+	m.last_retrieved_at, m.enrolled_by, m.enrolled_at
+`
+
+// Enroll records a machine whose password was just set, enrolling it again if
+// it was unenrolled
+func (r *LAPSRepository) Enroll(ctx context.Context, machine *models.LAPSMachine) error {
+	query := `
+		INSERT INTO laps_machines (
+			target_id, account_name, credential_id, vault_path, enabled, last_rotated_at,
+			next_rotation_at, last_attempt_at, enrolled_by, enrolled_at
+		)
+		VALUES ($1, $2, $3, $4, true, $5, $6, $5, $7, $5)
+		ON CONFLICT (target_id) DO UPDATE SET
+			account_name = EXCLUDED.account_name,
+			credential_id = EXCLUDED.credential_id,
+			vault_path = EXCLUDED.vault_path,
+			enabled = true,
+			last_rotated_at = EXCLUDED.last_rotated_at,
+			next_rotation_at = EXCLUDED.next_rotation_at,
+			last_attempt_at = EXCLUDED.last_attempt_at,
+			last_error = NULL,
+			failures = 0,
+			enrolled_by = EXCLUDED.enrolled_by,
+			enrolled_at = EXCLUDED.enrolled_at
+	`
+
+	now := time.Now()
+	machine.Enabled = true
+	machine.LastRotatedAt = &now
+	machine.LastAttemptAt = &now
+	machine.EnrolledAt = now
+
+	_, err := r.db.ExecContext(ctx, query,
+		machine.TargetID,
+		machine.AccountName,
+		machine.CredentialID,
+		machine.VaultPath,
+		now,
+		machine.NextRotationAt,
+		machine.EnrolledBy,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to enroll LAPS machine: %w", err)
+	}
+
+	return nil
+}
+
+// Unenroll stops rotating a machine's password. The credential and the
+// password in Vault are kept.
+func (r *LAPSRepository) Unenroll(ctx context.Context, targetID uuid.UUID) error {
+	_, err := r.db.ExecContext(ctx, `UPDATE laps_machines SET enabled = false WHERE target_id = $1`, targetID)
+	if err != nil {
+		return fmt.Errorf("failed to unenroll LAPS machine: %w", err)
+	}
+
+	return nil
+}
+
+// GetMachine retrieves an enrolled machine by target ID
+func (r *LAPSRepository) GetMachine(ctx context.Context, targetID uuid.UUID) (*models.LAPSMachine, error) {
+	query := `
+		SELECT ` + lapsMachineColumns + `
+		FROM laps_machines m
+		JOIN targets t ON m.target_id = t.id
+		WHERE m.target_id = $1
+	`
+
+	var machine models.LAPSMachine
+	err := r.db.GetContext(ctx, &machine, query, targetID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("LAPS machine not found")
+		}
+		return nil, fmt.Errorf("failed to get LAPS machine: %w", err)
+	}
+
+	return &machine, nil
+}
+
+// ListMachines retrieves the enrolled machines by name. If overdueBefore is
+// set, only the enabled machines whose rotation was due before then are listed,
+// longest overdue first.
+func (r *LAPSRepository) ListMachines(ctx context.Context, overdueBefore *time.Time) ([]*models.LAPSMachine, error) {
+	query := `
+		SELECT ` + lapsMachineColumns + `
+		FROM laps_machines m
+		JOIN targets t ON m.target_id = t.id
+		WHERE t.deleted_at IS NULL
+	`
+	var args []interface{}
+
+	if overdueBefore != nil {
+		args = append(args, *overdueBefore)
+		query += " AND m.enabled = true AND m.next_rotation_at < $1 ORDER BY m.next_rotation_at"
+	} else {
+		query += " ORDER BY t.name"
+	}
+
+	var machines []*models.LAPSMachine
+	err := r.db.SelectContext(ctx, &machines, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list LAPS machines: %w", err)
+	}
+
+	return machines, nil
+}
+
+// ListDueMachines retrieves the enabled machines due for rotation, leaving out
+// those that failed since retryBefore
+func (r *LAPSRepository) ListDueMachines(ctx context.Context, now, retryBefore time.Time, limit int) ([]*models.LAPSMachine, error) {
+	query := `
+		SELECT ` + lapsMachineColumns + `
+		FROM laps_machines m
+		JOIN targets t ON m.target_id = t.id
+		WHERE m.enabled = true AND t.enabled = true AND t.deleted_at IS NULL
+			AND m.next_rotation_at <= $1
+			AND (m.failures = 0 OR m.last_attempt_at < $2)
+		ORDER BY m.next_rotation_at
+		LIMIT $3
+	`
+
+	var machines []*models.LAPSMachine
+	err := r.db.SelectContext(ctx, &machines, query, now, retryBefore, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list LAPS machines due for rotation: %w", err)
+	}
+
+	return machines, nil
+}
+
+// RecordRotation records a successful rotation and schedules the next one.
+// The credential holding the new password is released from quarantine.
+func (r *LAPSRepository) RecordRotation(ctx context.Context, targetID uuid.UUID, accountName string, credentialID *uuid.UUID, next time.Time) error {
+	query := `
+		WITH rotated AS (
+			UPDATE laps_machines
+			SET account_name = $1, credential_id = $2, last_rotated_at = NOW(), last_attempt_at = NOW(),
+				next_rotation_at = $3, last_error = NULL, failures = 0
+			WHERE target_id = $4
+		)
+		UPDATE credentials SET ` + clearAuthFailures + ` WHERE id = $2
+	`
+
+	_, err := r.db.ExecContext(ctx, query, accountName, credentialID, next, targetID)
+	if err != nil {
+		return fmt.Errorf("failed to record LAPS rotation: %w", err)
+	}
+
+	return nil
+}
+
+// RecordFailure records a failed rotation; the machine stays due
+func (r *LAPSRepository) RecordFailure(ctx context.Context, targetID uuid.UUID, message string) error {
+	query := `
+		UPDATE laps_machines
+		SET last_attempt_at = NOW(), last_error = $1, failures = failures + 1
+		WHERE target_id = $2
+	`
+
+	_, err := r.db.ExecContext(ctx, query, message, targetID)
+	if err != nil {
+		return fmt.Errorf("failed to record LAPS failure: %w", err)
+	}
+
+	return nil
+}
+
+// RecordRetrieval records that a machine's password was read. If rotateBy is
+// set, the next rotation is brought forward to it.
+func (r *LAPSRepository) RecordRetrieval(ctx context.Context, targetID uuid.UUID, rotateBy *time.Time) error {
+	query := `
+		UPDATE laps_machines
+		SET last_retrieved_at = NOW(),
+			next_rotation_at = CASE WHEN $1::timestamptz IS NULL THEN next_rotation_at
+				ELSE LEAST(next_rotation_at, $1::timestamptz) END
+		WHERE target_id = $2
+	`
+
+	_, err := r.db.ExecContext(ctx, query, rotateBy, targetID)
+	if err != nil {
+		return fmt.Errorf("failed to record LAPS retrieval: %w", err)
+	}
+
+	return nil
+}
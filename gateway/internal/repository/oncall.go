@@ -0,0 +1,197 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/VanCannon/openpam/gateway/internal/actor"
+	"github.com/VanCannon/openpam/gateway/internal/database"
+	"github.com/VanCannon/openpam/gateway/internal/models"
+	"github.com/google/uuid"
+)
+
+// OnCallRepository handles the mappings of external on-call schedules to zones
+type OnCallRepository struct {
+	db *database.DB
+}
+
+// NewOnCallRepository creates a new on-call mapping repository
+func NewOnCallRepository(db *database.DB) *OnCallRepository {
+	return &OnCallRepository{db: db}
+}
+
+const onCallColumns = `
+	id, name, provider, external_schedule_id, zone_id, enabled, next_sync_at, last_synced_at,
+	last_sync_status, last_sync_error, last_sync_result, created_by, version, created_at, updated_at
+`
+
+// Create creates a new on-call mapping, due to be synced right away
+func (r *OnCallRepository) Create(ctx context.Context, mapping *models.OnCallMapping) error {
+	query := `
+		INSERT INTO oncall_mappings (
+			id, name, provider, external_schedule_id, zone_id, enabled, next_sync_at,
+			created_by, updated_by, created_at, updated_at
+		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $8, $9, $10)
+	`
+
+	mapping.ID = uuid.New()
+	if mapping.CreatedBy == nil {
+		mapping.CreatedBy = actor.UserID(ctx)
+	}
+	mapping.Version = 1
+	mapping.CreatedAt = time.Now()
+	mapping.UpdatedAt = mapping.CreatedAt
+	mapping.NextSyncAt = mapping.CreatedAt
+
+	_, err := r.db.ExecContext(ctx, query,
+		mapping.ID,
+		mapping.Name,
+		mapping.Provider,
+		mapping.ExternalScheduleID,
+		mapping.ZoneID,
+		mapping.Enabled,
+		mapping.NextSyncAt,
+		mapping.CreatedBy,
+		mapping.CreatedAt,
+		mapping.UpdatedAt,
+	)
+
+	if err != nil {
+		return fmt.Errorf("failed to create on-call mapping: %w", err)
+	}
+
+	return nil
+}
+
+// GetByID retrieves an on-call mapping by ID
+func (r *OnCallRepository) GetByID(ctx context.Context, id uuid.UUID) (*models.OnCallMapping, error) {
+	query := `SELECT ` + onCallColumns + ` FROM oncall_mappings WHERE id = $1`
+
+	var mapping models.OnCallMapping
+	err := r.db.GetContext(ctx, &mapping, query, id)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("on-call mapping not found")
+		}
+		return nil, fmt.Errorf("failed to get on-call mapping: %w", err)
+	}
+
+	return &mapping, nil
+}
+
+// List retrieves all on-call mappings ordered by name
+func (r *OnCallRepository) List(ctx context.Context) ([]*models.OnCallMapping, error) {
+	query := `SELECT ` + onCallColumns + ` FROM oncall_mappings ORDER BY name`
+
+	var mappings []*models.OnCallMapping
+	err := r.db.SelectContext(ctx, &mappings, query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list on-call mappings: %w", err)
+	}
+
+	return mappings, nil
+}
+
+// Update updates an on-call mapping if it is still at mapping.Version and
+// makes it due to be synced right away
+func (r *OnCallRepository) Update(ctx context.Context, mapping *models.OnCallMapping) error {
+	query := `
+		UPDATE oncall_mappings
+		SET name = $1, provider = $2, external_schedule_id = $3, zone_id = $4, enabled = $5,
+		    next_sync_at = $6, updated_at = $6, updated_by = $9, version = version + 1
+		WHERE id = $7 AND version = $8
+	`
+
+	mapping.UpdatedAt = time.Now()
+	mapping.NextSyncAt = mapping.UpdatedAt
+
+	result, err := r.db.ExecContext(ctx, query,
+		mapping.Name,
+		mapping.Provider,
+		mapping.ExternalScheduleID,
+		mapping.ZoneID,
+		mapping.Enabled,
+		mapping.UpdatedAt,
+		mapping.ID,
+		mapping.Version,
+		actor.UserID(ctx),
+	)
+
+	if err != nil {
+		return fmt.Errorf("failed to update on-call mapping: %w", err)
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+
+	if rows == 0 {
+		return versionMiss(ctx, r.db, "oncall_mappings", "", mapping.ID, fmt.Errorf("on-call mapping not found"))
+	}
+
+	mapping.Version++
+	return nil
+}
+
+// Delete deletes an on-call mapping. The schedules it maintained are left to
+// the caller.
+func (r *OnCallRepository) Delete(ctx context.Context, id uuid.UUID) error {
+	query := `DELETE FROM oncall_mappings WHERE id = $1`
+
+	result, err := r.db.ExecContext(ctx, query, id)
+	if err != nil {
+		return fmt.Errorf("failed to delete on-call mapping: %w", err)
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+
+	if rows == 0 {
+		return fmt.Errorf("on-call mapping not found")
+	}
+
+	return nil
+}
+
+// ClaimDue returns the enabled mappings due to be synced at now and moves
+// their next sync interval later. Rows locked by another replica are skipped,
+// so each sync is claimed by one replica.
+func (r *OnCallRepository) ClaimDue(ctx context.Context, now time.Time, interval time.Duration) ([]*models.OnCallMapping, error) {
+	query := `
+		UPDATE oncall_mappings
+		SET next_sync_at = $2
+		WHERE id IN (
+			SELECT id FROM oncall_mappings
+			WHERE enabled AND next_sync_at <= $1
+			ORDER BY next_sync_at
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING ` + onCallColumns
+
+	var mappings []*models.OnCallMapping
+	if err := r.db.SelectContext(ctx, &mappings, query, now, now.Add(interval)); err != nil {
+		return nil, fmt.Errorf("failed to claim due on-call mappings: %w", err)
+	}
+
+	return mappings, nil
+}
+
+// RecordSync stores the outcome of a sync of a mapping
+func (r *OnCallRepository) RecordSync(ctx context.Context, id uuid.UUID, at time.Time, status string, result *models.OnCallSyncResult, syncErr *string) error {
+	query := `
+		UPDATE oncall_mappings
+		SET last_synced_at = $1, last_sync_status = $2, last_sync_result = $3, last_sync_error = $4
+		WHERE id = $5
+	`
+
+	if _, err := r.db.ExecContext(ctx, query, at, status, result, syncErr, id); err != nil {
+		return fmt.Errorf("failed to record on-call sync: %w", err)
+	}
+
+	return nil
+}
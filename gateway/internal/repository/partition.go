@@ -0,0 +1,123 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"time"
+
+	"github.com/VanCannon/openpam/gateway/internal/database"
+	"github.com/VanCannon/openpam/gateway/internal/models"
+)
+
+// partitionLock is the advisory lock held while a replica maintains partitions
+const partitionLock = 0x6f70706d // "oppm"
+
+// partitionName matches the monthly partitions create_audit_partition makes
+var partitionName = regexp.MustCompile(`_y(\d{4})m(\d{2})$`)
+
+// PartitionRepository manages the monthly partitions of the audit tables
+type PartitionRepository struct {
+	db *database.DB
+}
+
+// NewPartitionRepository creates a new partition repository
+func NewPartitionRepository(db *database.DB) *PartitionRepository {
+	return &PartitionRepository{db: db}
+}
+
+// Maintain makes sure table has a partition for every month from the one of
+// now through the one of through, and drops the months before dropBefore,
+// with the rows referring to theirs. Rows before dropBefore that ended up in
+// the default partition are deleted. A zero dropBefore keeps everything.
+// When another replica is maintaining partitions it returns nil changes.
+func (r *PartitionRepository) Maintain(ctx context.Context, table string, now, through, dropBefore time.Time) (*models.PartitionChanges, error) {
+	column, ok := models.PartitionedTables[table]
+	if !ok {
+		return nil, fmt.Errorf("%s is not a partitioned table", table)
+	}
+
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	var locked bool
+	if err := tx.GetContext(ctx, &locked, `SELECT pg_try_advisory_xact_lock($1)`, partitionLock); err != nil {
+		return nil, fmt.Errorf("failed to lock partitions: %w", err)
+	}
+	if !locked {
+		return nil, nil
+	}
+
+	changes := &models.PartitionChanges{Table: table}
+
+	for month := monthOf(now); !month.After(monthOf(through)); month = month.AddDate(0, 1, 0) {
+		var created bool
+		if err := tx.GetContext(ctx, &created, `SELECT create_audit_partition($1, $2::date)`, table, month.Format(time.DateOnly)); err != nil {
+			return nil, fmt.Errorf("failed to create partition of %s for %s: %w", table, month.Format("2006-01"), err)
+		}
+		if created {
+			changes.Created = append(changes.Created, month)
+		}
+	}
+
+	if !dropBefore.IsZero() {
+		var partitions []string
+		err := tx.SelectContext(ctx, &partitions, `
+			SELECT c.relname FROM pg_inherits i
+			JOIN pg_class c ON c.oid = i.inhrelid
+			WHERE i.inhparent = $1::regclass
+			ORDER BY c.relname
+		`, table)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list partitions of %s: %w", table, err)
+		}
+
+		cutoff := monthOf(dropBefore)
+		for _, name := range partitions {
+			month, ok := partitionMonth(name)
+			if !ok || !month.Before(cutoff) {
+				continue
+			}
+			if _, err := tx.ExecContext(ctx, `SELECT drop_audit_partition($1, $2::date)`, table, month.Format(time.DateOnly)); err != nil {
+				return nil, fmt.Errorf("failed to drop partition %s: %w", name, err)
+			}
+			changes.Dropped = append(changes.Dropped, month)
+		}
+
+		// The default partition only holds stragglers, so deleting rows is fine
+		result, err := tx.ExecContext(ctx,
+			fmt.Sprintf(`DELETE FROM %s_default WHERE %s < $1`, table, column), cutoff)
+		if err != nil {
+			return nil, fmt.Errorf("failed to purge default partition of %s: %w", table, err)
+		}
+		changes.Purged, _ = result.RowsAffected()
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return changes, nil
+}
+
+// monthOf returns the first instant of t's month in UTC
+func monthOf(t time.Time) time.Time {
+	t = t.UTC()
+	return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC)
+}
+
+// partitionMonth returns the month a partition named by create_audit_partition holds
+func partitionMonth(name string) (time.Time, bool) {
+	m := partitionName.FindStringSubmatch(name)
+	if m == nil {
+		return time.Time{}, false
+	}
+	month, err := time.Parse("200601", m[1]+m[2])
+	if err != nil {
+		return time.Time{}, false
+	}
+	return month, true
+}
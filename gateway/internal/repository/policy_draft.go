@@ -0,0 +1,284 @@
+package repository
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/VanCannon/openpam/gateway/internal/actor"
+	"github.com/VanCannon/openpam/gateway/internal/database"
+	"github.com/VanCannon/openpam/gateway/internal/models"
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+)
+
+var (
+	// ErrDraftClosed is returned when a draft was already published or discarded
+	ErrDraftClosed = errors.New("policy draft is no longer open")
+
+	// ErrDraftStale is returned when the live rules changed since the draft was started
+	ErrDraftStale = errors.New("credential rules changed since the draft was started")
+)
+
+// PolicyDraftRepository handles policy draft data operations
+type PolicyDraftRepository struct {
+	db *database.DB
+}
+
+// NewPolicyDraftRepository creates a new policy draft repository
+func NewPolicyDraftRepository(db *database.DB) *PolicyDraftRepository {
+	return &PolicyDraftRepository{db: db}
+}
+
+const policyDraftColumns = `
+	id, name, description, rules, base_fingerprint, status, created_by, updated_by,
+	published_by, published_at, created_at, updated_at
+`
+
+// liveRules loads the live credential rules in ID order with their fingerprint,
+// which changes whenever a rule is created, updated or deleted
+func liveRules(ctx context.Context, q sqlx.QueryerContext) ([]*models.CredentialRule, string, error) {
+	var rules []*models.CredentialRule
+	query := `SELECT ` + credentialRuleColumns + ` FROM credential_rules ORDER BY id`
+	if err := sqlx.SelectContext(ctx, q, &rules, query); err != nil {
+		return nil, "", fmt.Errorf("failed to list credential rules: %w", err)
+	}
+
+	h := sha256.New()
+	for _, rule := range rules {
+		fmt.Fprintf(h, "%s:%d\n", rule.ID, rule.UpdatedAt.UnixMicro())
+	}
+	return rules, hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// Create starts a draft from a copy of the live rules
+func (r *PolicyDraftRepository) Create(ctx context.Context, draft *models.PolicyDraft) error {
+	rules, fingerprint, err := liveRules(ctx, r.db)
+	if err != nil {
+		return err
+	}
+
+	query := `
+		INSERT INTO policy_drafts (
+			id, name, description, rules, base_fingerprint, status, created_by, updated_by, created_at, updated_at
+		)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $7, $8, $8)
+	`
+
+	draft.ID = uuid.New()
+	draft.Rules = rules
+	draft.BaseFingerprint = fingerprint
+	draft.Status = models.PolicyDraftStatusDraft
+	draft.CreatedBy = actor.UserID(ctx)
+	draft.UpdatedBy = draft.CreatedBy
+	draft.CreatedAt = time.Now()
+	draft.UpdatedAt = draft.CreatedAt
+
+	_, err = r.db.ExecContext(ctx, query,
+		draft.ID,
+		draft.Name,
+		draft.Description,
+		draft.Rules,
+		draft.BaseFingerprint,
+		draft.Status,
+		draft.CreatedBy,
+		draft.CreatedAt,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to create policy draft: %w", err)
+	}
+
+	return nil
+}
+
+// GetByID retrieves a policy draft by ID
+func (r *PolicyDraftRepository) GetByID(ctx context.Context, id uuid.UUID) (*models.PolicyDraft, error) {
+	query := `SELECT ` + policyDraftColumns + ` FROM policy_drafts WHERE id = $1`
+
+	var draft models.PolicyDraft
+	if err := r.db.GetContext(ctx, &draft, query, id); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("policy draft not found")
+		}
+		return nil, fmt.Errorf("failed to get policy draft: %w", err)
+	}
+
+	return &draft, nil
+}
+
+// List retrieves drafts, most recently updated first. An empty status lists every status.
+func (r *PolicyDraftRepository) List(ctx context.Context, status string) ([]*models.PolicyDraft, error) {
+	query := `
+		SELECT ` + policyDraftColumns + `
+		FROM policy_drafts
+		WHERE ($1 = '' OR status = $1)
+		ORDER BY updated_at DESC
+		LIMIT 200
+	`
+
+	var drafts []*models.PolicyDraft
+	if err := r.db.SelectContext(ctx, &drafts, query, status); err != nil {
+		return nil, fmt.Errorf("failed to list policy drafts: %w", err)
+	}
+
+	return drafts, nil
+}
+
+// Update saves an open draft's name, description and rules. ErrDraftClosed is
+// returned if it was published or discarded.
+func (r *PolicyDraftRepository) Update(ctx context.Context, draft *models.PolicyDraft) error {
+	query := `
+		UPDATE policy_drafts
+		SET name = $1, description = $2, rules = $3, updated_by = $4, updated_at = $5
+		WHERE id = $6 AND status = 'draft'
+	`
+
+	draft.UpdatedBy = actor.UserID(ctx)
+	draft.UpdatedAt = time.Now()
+
+	result, err := r.db.ExecContext(ctx, query,
+		draft.Name,
+		draft.Description,
+		draft.Rules,
+		draft.UpdatedBy,
+		draft.UpdatedAt,
+		draft.ID,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to update policy draft: %w", err)
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+	if rows == 0 {
+		return ErrDraftClosed
+	}
+
+	return nil
+}
+
+// Discard closes an open draft without publishing it
+func (r *PolicyDraftRepository) Discard(ctx context.Context, id uuid.UUID) error {
+	query := `
+		UPDATE policy_drafts
+		SET status = 'discarded', updated_by = $1, updated_at = $2
+		WHERE id = $3 AND status = 'draft'
+	`
+
+	result, err := r.db.ExecContext(ctx, query, actor.UserID(ctx), time.Now(), id)
+	if err != nil {
+		return fmt.Errorf("failed to discard policy draft: %w", err)
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+	if rows == 0 {
+		return ErrDraftClosed
+	}
+
+	return nil
+}
+
+// Publish replaces the live credential rules with the draft's and closes it.
+// Rules missing from the draft are deleted, and the others created or updated
+// under the same IDs. ErrDraftStale is returned if the live rules changed since
+// the draft was started, and ErrDraftClosed if it is no longer open.
+func (r *PolicyDraftRepository) Publish(ctx context.Context, id uuid.UUID) (*models.PolicyDraft, error) {
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	// Hold off other rule changes until the draft is in place
+	if _, err := tx.ExecContext(ctx, `LOCK TABLE credential_rules IN SHARE ROW EXCLUSIVE MODE`); err != nil {
+		return nil, fmt.Errorf("failed to lock credential rules: %w", err)
+	}
+
+	var draft models.PolicyDraft
+	query := `SELECT ` + policyDraftColumns + ` FROM policy_drafts WHERE id = $1 AND status = 'draft' FOR UPDATE`
+	if err := tx.GetContext(ctx, &draft, query, id); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, ErrDraftClosed
+		}
+		return nil, fmt.Errorf("failed to get policy draft: %w", err)
+	}
+
+	_, fingerprint, err := liveRules(ctx, tx)
+	if err != nil {
+		return nil, err
+	}
+	if fingerprint != draft.BaseFingerprint {
+		return nil, ErrDraftStale
+	}
+
+	ids := make([]uuid.UUID, len(draft.Rules))
+	for i, rule := range draft.Rules {
+		ids[i] = rule.ID
+	}
+	if _, err := tx.ExecContext(ctx, `DELETE FROM credential_rules WHERE NOT (id = ANY($1::uuid[]))`, uuidArray(ids)); err != nil {
+		return nil, fmt.Errorf("failed to delete credential rules: %w", err)
+	}
+
+	now := time.Now()
+	publishedBy := actor.UserID(ctx)
+	for _, rule := range draft.Rules {
+		_, err := tx.ExecContext(ctx, `
+			INSERT INTO credential_rules (`+credentialRuleColumns+`, created_by, updated_by)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $12, $13, $14, $15, $15)
+			ON CONFLICT (id) DO UPDATE
+			SET name = EXCLUDED.name, description = EXCLUDED.description, effect = EXCLUDED.effect,
+			    user_id = EXCLUDED.user_id, role = EXCLUDED.role, target_id = EXCLUDED.target_id,
+			    credential_id = EXCLUDED.credential_id, credential_tag = EXCLUDED.credential_tag,
+			    enabled = EXCLUDED.enabled, settings = EXCLUDED.settings, group_id = EXCLUDED.group_id,
+			    condition = EXCLUDED.condition,
+			    updated_at = EXCLUDED.updated_at, updated_by = EXCLUDED.updated_by
+		`,
+			rule.ID,
+			rule.Name,
+			rule.Description,
+			rule.Effect,
+			rule.UserID,
+			rule.Role,
+			rule.TargetID,
+			rule.CredentialID,
+			rule.CredentialTag,
+			rule.Enabled,
+			rule.Settings,
+			now,
+			rule.GroupID,
+			rule.Condition,
+			publishedBy,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to publish credential rule %q: %w", rule.Name, err)
+		}
+	}
+
+	_, err = tx.ExecContext(ctx, `
+		UPDATE policy_drafts
+		SET status = 'published', published_by = $1, published_at = $2, updated_at = $2
+		WHERE id = $3
+	`, publishedBy, now, id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to close policy draft: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit policy draft: %w", err)
+	}
+
+	draft.Status = models.PolicyDraftStatusPublished
+	draft.PublishedBy = publishedBy
+	draft.PublishedAt = &now
+	draft.UpdatedAt = now
+	return &draft, nil
+}
@@ -0,0 +1,143 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/VanCannon/openpam/gateway/internal/database"
+	"github.com/VanCannon/openpam/gateway/internal/models"
+	"github.com/google/uuid"
+)
+
+// RecordingRepository handles the recordings catalog
+type RecordingRepository struct {
+	db *database.DB
+}
+
+// NewRecordingRepository creates a new recording repository
+func NewRecordingRepository(db *database.DB) *RecordingRepository {
+	return &RecordingRepository{db: db}
+}
+
+// Upsert catalogs a recording, replacing the entry for the same location
+func (r *RecordingRepository) Upsert(ctx context.Context, rec *models.Recording) error {
+	query := `
+		INSERT INTO recordings (
+			id, session_id, location, format, size, duration_ms, sha256, encrypted, started_at, created_at
+		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+		ON CONFLICT (location) DO UPDATE SET
+			session_id = EXCLUDED.session_id,
+			format = EXCLUDED.format,
+			size = EXCLUDED.size,
+			duration_ms = EXCLUDED.duration_ms,
+			sha256 = EXCLUDED.sha256,
+			encrypted = EXCLUDED.encrypted,
+			started_at = EXCLUDED.started_at
+		RETURNING id, created_at
+	`
+
+	if rec.ID == uuid.Nil {
+		rec.ID = uuid.New()
+	}
+	rec.CreatedAt = time.Now()
+
+	err := r.db.QueryRowContext(ctx, query,
+		rec.ID,
+		rec.SessionID,
+		rec.Location,
+		rec.Format,
+		rec.Size,
+		rec.DurationMs,
+		rec.SHA256,
+		rec.Encrypted,
+		rec.StartedAt,
+		rec.CreatedAt,
+	).Scan(&rec.ID, &rec.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to catalog recording: %w", err)
+	}
+
+	return nil
+}
+
+// Relocate points the entry catalogued at from to the recording's new
+// location, after it was copied to another storage
+func (r *RecordingRepository) Relocate(ctx context.Context, from, to string) error {
+	query := `UPDATE recordings SET location = $2 WHERE location = $1`
+
+	if _, err := r.db.ExecContext(ctx, query, from, to); err != nil {
+		return fmt.Errorf("failed to relocate recording: %w", err)
+	}
+
+	return nil
+}
+
+// GetBySessionID retrieves the latest recording of a session
+func (r *RecordingRepository) GetBySessionID(ctx context.Context, sessionID uuid.UUID) (*models.Recording, error) {
+	query := `
+		SELECT id, session_id, location, format, size, duration_ms, sha256, encrypted, started_at, created_at
+		FROM recordings
+		WHERE session_id = $1
+		ORDER BY started_at DESC
+		LIMIT 1
+	`
+
+	var rec models.Recording
+	err := r.db.GetContext(ctx, &rec, query, sessionID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("recording not found")
+		}
+		return nil, fmt.Errorf("failed to get recording: %w", err)
+	}
+
+	return &rec, nil
+}
+
+// List searches the catalog, newest first
+func (r *RecordingRepository) List(ctx context.Context, filter models.RecordingFilter) ([]*models.Recording, error) {
+	var conditions []string
+	var args []interface{}
+	add := func(condition string, arg interface{}) {
+		args = append(args, arg)
+		conditions = append(conditions, fmt.Sprintf(condition, len(args)))
+	}
+
+	if filter.SessionID != nil {
+		add("session_id = $%d", *filter.SessionID)
+	}
+	if filter.Format != "" {
+		add("format = $%d", filter.Format)
+	}
+	if filter.From != nil {
+		add("started_at >= $%d", *filter.From)
+	}
+	if filter.To != nil {
+		add("started_at < $%d", *filter.To)
+	}
+
+	query := `
+		SELECT id, session_id, location, format, size, duration_ms, sha256, encrypted, started_at, created_at
+		FROM recordings
+	`
+	if len(conditions) > 0 {
+		query += " WHERE " + strings.Join(conditions, " AND ")
+	}
+
+	limit := filter.Limit
+	if limit <= 0 {
+		limit = 100
+	}
+	args = append(args, limit, filter.Offset)
+	query += fmt.Sprintf(" ORDER BY started_at DESC LIMIT $%d OFFSET $%d", len(args)-1, len(args))
+
+	var recs []*models.Recording
+	if err := r.db.SelectContext(ctx, &recs, query, args...); err != nil {
+		return nil, fmt.Errorf("failed to list recordings: %w", err)
+	}
+
+	return recs, nil
+}
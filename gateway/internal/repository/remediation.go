@@ -0,0 +1,180 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/VanCannon/openpam/gateway/internal/database"
+	"github.com/VanCannon/openpam/gateway/internal/models"
+	"github.com/google/uuid"
+)
+
+// RemediationRepository handles the AWX jobs launched after sessions
+type RemediationRepository struct {
+	db *database.DB
+}
+
+// NewRemediationRepository creates a new remediation repository
+func NewRemediationRepository(db *database.DB) *RemediationRepository {
+	return &RemediationRepository{db: db}
+}
+
+const remediationColumns = `
+	id, audit_log_id, event_id, trigger_type, template_id, extra_vars, status, awx_job_id, job_url,
+	attempts, next_attempt_at, error, created_at, updated_at, finished_at
+`
+
+// Create queues a run. A run already queued for the same event is left as it
+// is, so events read twice from the event log launch one job.
+func (r *RemediationRepository) Create(ctx context.Context, run *models.RemediationRun) error {
+	query := `
+		INSERT INTO remediation_runs (
+			id, audit_log_id, event_id, trigger_type, template_id, extra_vars, status,
+			next_attempt_at, created_at, updated_at
+		)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+		ON CONFLICT (event_id) DO NOTHING
+	`
+
+	now := time.Now()
+	run.ID = uuid.New()
+	run.Status = models.RemediationStatusQueued
+	run.NextAttemptAt = now
+	run.CreatedAt = now
+	run.UpdatedAt = now
+
+	_, err := r.db.ExecContext(ctx, query,
+		run.ID,
+		run.AuditLogID,
+		run.EventID,
+		run.Trigger,
+		run.TemplateID,
+		[]byte(run.ExtraVars),
+		run.Status,
+		run.NextAttemptAt,
+		run.CreatedAt,
+		run.UpdatedAt,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to create remediation run: %w", err)
+	}
+
+	return nil
+}
+
+// Launch locks the next queued run that is due, calls fn with it and stores
+// the status, job and error fn leaves on the run. When no run is due it
+// returns false without calling fn. Runs locked by another replica are
+// skipped, so each run is launched by one replica. The run is left unchanged
+// if fn fails.
+func (r *RemediationRepository) Launch(ctx context.Context, fn func(run *models.RemediationRun) error) (bool, error) {
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return false, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	var run models.RemediationRun
+	err = tx.GetContext(ctx, &run, `
+		SELECT `+remediationColumns+`
+		FROM remediation_runs
+		WHERE status = 'queued' AND next_attempt_at <= NOW()
+		ORDER BY next_attempt_at
+		LIMIT 1
+		FOR UPDATE SKIP LOCKED
+	`)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to lock remediation run: %w", err)
+	}
+
+	if err := fn(&run); err != nil {
+		return true, err
+	}
+
+	run.UpdatedAt = time.Now()
+	if _, err := tx.ExecContext(ctx, `
+		UPDATE remediation_runs
+		SET status = $1, awx_job_id = $2, job_url = $3, attempts = $4, next_attempt_at = $5,
+		    error = $6, updated_at = $7, finished_at = $8
+		WHERE id = $9
+	`, run.Status, run.AWXJobID, run.JobURL, run.Attempts, run.NextAttemptAt,
+		run.Error, run.UpdatedAt, run.FinishedAt, run.ID,
+	); err != nil {
+		return true, fmt.Errorf("failed to update remediation run: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return true, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return true, nil
+}
+
+// ListRunning retrieves launched runs whose job hasn't finished, least
+// recently checked first
+func (r *RemediationRepository) ListRunning(ctx context.Context, limit int) ([]*models.RemediationRun, error) {
+	query := `
+		SELECT ` + remediationColumns + `
+		FROM remediation_runs
+		WHERE status = 'running'
+		ORDER BY updated_at
+		LIMIT $1
+	`
+
+	var runs []*models.RemediationRun
+	if err := r.db.SelectContext(ctx, &runs, query, limit); err != nil {
+		return nil, fmt.Errorf("failed to list running remediation runs: %w", err)
+	}
+
+	return runs, nil
+}
+
+// Finish records the outcome of a run's job. A run that already finished is
+// left unchanged.
+func (r *RemediationRepository) Finish(ctx context.Context, id uuid.UUID, status string, errMsg *string) error {
+	query := `
+		UPDATE remediation_runs
+		SET status = $1, error = $2, updated_at = $3, finished_at = $3
+		WHERE id = $4 AND status = 'running'
+	`
+
+	if _, err := r.db.ExecContext(ctx, query, status, errMsg, time.Now(), id); err != nil {
+		return fmt.Errorf("failed to finish remediation run: %w", err)
+	}
+
+	return nil
+}
+
+// Touch marks a running run as checked, so the next check starts with others
+func (r *RemediationRepository) Touch(ctx context.Context, id uuid.UUID) error {
+	query := `UPDATE remediation_runs SET updated_at = $1 WHERE id = $2 AND status = 'running'`
+
+	if _, err := r.db.ExecContext(ctx, query, time.Now(), id); err != nil {
+		return fmt.Errorf("failed to update remediation run: %w", err)
+	}
+
+	return nil
+}
+
+// ListBySession retrieves the runs launched for a session, oldest first
+func (r *RemediationRepository) ListBySession(ctx context.Context, auditLogID uuid.UUID) ([]*models.RemediationRun, error) {
+	query := `
+		SELECT ` + remediationColumns + `
+		FROM remediation_runs
+		WHERE audit_log_id = $1
+		ORDER BY created_at
+	`
+
+	runs := []*models.RemediationRun{}
+	if err := r.db.SelectContext(ctx, &runs, query, auditLogID); err != nil {
+		return nil, fmt.Errorf("failed to list remediation runs: %w", err)
+	}
+
+	return runs, nil
+}
@@ -0,0 +1,421 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/VanCannon/openpam/gateway/internal/actor"
+	"github.com/VanCannon/openpam/gateway/internal/database"
+	"github.com/VanCannon/openpam/gateway/internal/models"
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+)
+
+// ReportRepository handles scheduled reports, their run history and the queries
+// reports are built from
+type ReportRepository struct {
+	db *database.DB
+}
+
+// NewReportRepository creates a new report repository
+func NewReportRepository(db *database.DB) *ReportRepository {
+	return &ReportRepository{db: db}
+}
+
+const reportColumns = `
+	id, name, report_type, format, cron_expression, timezone, filters, recipients, enabled,
+	next_run_at, last_run_at, created_by, version, created_at, updated_at
+`
+
+// Create creates a new scheduled report
+func (r *ReportRepository) Create(ctx context.Context, report *models.ScheduledReport) error {
+	query := `
+		INSERT INTO scheduled_reports (
+			id, name, report_type, format, cron_expression, timezone, filters, recipients,
+			enabled, next_run_at, created_by, updated_by, created_at, updated_at
+		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $11, $12, $13)
+	`
+
+	report.ID = uuid.New()
+	if report.CreatedBy == nil {
+		report.CreatedBy = actor.UserID(ctx)
+	}
+	report.Version = 1
+	report.CreatedAt = time.Now()
+	report.UpdatedAt = time.Now()
+
+	_, err := r.db.ExecContext(ctx, query,
+		report.ID,
+		report.Name,
+		report.ReportType,
+		report.Format,
+		report.CronExpression,
+		report.Timezone,
+		report.Filters,
+		report.Recipients,
+		report.Enabled,
+		report.NextRunAt,
+		report.CreatedBy,
+		report.CreatedAt,
+		report.UpdatedAt,
+	)
+
+	if err != nil {
+		return fmt.Errorf("failed to create scheduled report: %w", err)
+	}
+
+	return nil
+}
+
+// GetByID retrieves a scheduled report by ID
+func (r *ReportRepository) GetByID(ctx context.Context, id uuid.UUID) (*models.ScheduledReport, error) {
+	query := `SELECT ` + reportColumns + ` FROM scheduled_reports WHERE id = $1`
+
+	var report models.ScheduledReport
+	err := r.db.GetContext(ctx, &report, query, id)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("scheduled report not found")
+		}
+		return nil, fmt.Errorf("failed to get scheduled report: %w", err)
+	}
+
+	return &report, nil
+}
+
+// List retrieves all scheduled reports ordered by name
+func (r *ReportRepository) List(ctx context.Context) ([]*models.ScheduledReport, error) {
+	query := `SELECT ` + reportColumns + ` FROM scheduled_reports ORDER BY name`
+
+	var reports []*models.ScheduledReport
+	err := r.db.SelectContext(ctx, &reports, query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list scheduled reports: %w", err)
+	}
+
+	return reports, nil
+}
+
+// Update updates a scheduled report if it is still at report.Version
+func (r *ReportRepository) Update(ctx context.Context, report *models.ScheduledReport) error {
+	query := `
+		UPDATE scheduled_reports
+		SET name = $1, report_type = $2, format = $3, cron_expression = $4, timezone = $5,
+		    filters = $6, recipients = $7, enabled = $8, next_run_at = $9, updated_at = $10,
+		    updated_by = $13, version = version + 1
+		WHERE id = $11 AND version = $12
+	`
+
+	report.UpdatedAt = time.Now()
+
+	result, err := r.db.ExecContext(ctx, query,
+		report.Name,
+		report.ReportType,
+		report.Format,
+		report.CronExpression,
+		report.Timezone,
+		report.Filters,
+		report.Recipients,
+		report.Enabled,
+		report.NextRunAt,
+		report.UpdatedAt,
+		report.ID,
+		report.Version,
+		actor.UserID(ctx),
+	)
+
+	if err != nil {
+		return fmt.Errorf("failed to update scheduled report: %w", err)
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+
+	if rows == 0 {
+		return versionMiss(ctx, r.db, "scheduled_reports", "", report.ID, fmt.Errorf("scheduled report not found"))
+	}
+
+	report.Version++
+	return nil
+}
+
+// Delete deletes a scheduled report and its run history
+func (r *ReportRepository) Delete(ctx context.Context, id uuid.UUID) error {
+	query := `DELETE FROM scheduled_reports WHERE id = $1`
+
+	result, err := r.db.ExecContext(ctx, query, id)
+	if err != nil {
+		return fmt.Errorf("failed to delete scheduled report: %w", err)
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+
+	if rows == 0 {
+		return fmt.Errorf("scheduled report not found")
+	}
+
+	return nil
+}
+
+// RunNow makes an enabled report due immediately
+func (r *ReportRepository) RunNow(ctx context.Context, id uuid.UUID) error {
+	query := `UPDATE scheduled_reports SET next_run_at = $1 WHERE id = $2 AND enabled`
+
+	result, err := r.db.ExecContext(ctx, query, time.Now(), id)
+	if err != nil {
+		return fmt.Errorf("failed to schedule report run: %w", err)
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+
+	if rows == 0 {
+		return fmt.Errorf("scheduled report not found")
+	}
+
+	return nil
+}
+
+// ClaimDue locks the enabled reports due at now, moves each to the next run time
+// returned by next and sets its last run to now. Rows locked by another replica are
+// skipped, so every run is claimed exactly once. The returned reports keep their
+// previous LastRunAt, which is where the new report period starts.
+func (r *ReportRepository) ClaimDue(ctx context.Context, now time.Time, next func(*models.ScheduledReport) (*time.Time, error)) ([]*models.ScheduledReport, error) {
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	query := `
+		SELECT ` + reportColumns + `
+		FROM scheduled_reports
+		WHERE enabled AND next_run_at <= $1
+		ORDER BY next_run_at
+		FOR UPDATE SKIP LOCKED
+	`
+
+	var reports []*models.ScheduledReport
+	if err := tx.SelectContext(ctx, &reports, query, now); err != nil {
+		return nil, fmt.Errorf("failed to select due reports: %w", err)
+	}
+
+	for _, report := range reports {
+		nextRun, err := next(report)
+		if err != nil {
+			// Disable rather than retry a schedule that can't be evaluated
+			nextRun = nil
+		}
+
+		_, err = tx.ExecContext(ctx,
+			`UPDATE scheduled_reports SET next_run_at = $1, last_run_at = $2, enabled = $3 WHERE id = $4`,
+			nextRun, now, nextRun != nil, report.ID,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to advance report schedule: %w", err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return reports, nil
+}
+
+// CreateRun records the start of a report run
+func (r *ReportRepository) CreateRun(ctx context.Context, run *models.ReportRun) error {
+	query := `
+		INSERT INTO report_runs (id, report_id, status, period_start, period_end, started_at)
+		VALUES ($1, $2, $3, $4, $5, $6)
+	`
+
+	run.ID = uuid.New()
+	run.StartedAt = time.Now()
+
+	_, err := r.db.ExecContext(ctx, query,
+		run.ID,
+		run.ReportID,
+		run.Status,
+		run.PeriodStart,
+		run.PeriodEnd,
+		run.StartedAt,
+	)
+
+	if err != nil {
+		return fmt.Errorf("failed to create report run: %w", err)
+	}
+
+	return nil
+}
+
+// FinishRun records the outcome of a report run
+func (r *ReportRepository) FinishRun(ctx context.Context, run *models.ReportRun) error {
+	query := `
+		UPDATE report_runs
+		SET status = $1, row_count = $2, error_message = $3, finished_at = $4
+		WHERE id = $5
+	`
+
+	now := time.Now()
+	run.FinishedAt = &now
+
+	_, err := r.db.ExecContext(ctx, query,
+		run.Status,
+		run.RowCount,
+		run.ErrorMessage,
+		run.FinishedAt,
+		run.ID,
+	)
+
+	if err != nil {
+		return fmt.Errorf("failed to finish report run: %w", err)
+	}
+
+	return nil
+}
+
+// ListRuns retrieves the run history of a report, newest first
+func (r *ReportRepository) ListRuns(ctx context.Context, reportID uuid.UUID, limit, offset int) ([]*models.ReportRun, error) {
+	query := `
+		SELECT id, report_id, status, period_start, period_end, row_count, error_message, started_at, finished_at
+		FROM report_runs
+		WHERE report_id = $1
+		ORDER BY started_at DESC
+		LIMIT $2 OFFSET $3
+	`
+
+	var runs []*models.ReportRun
+	err := r.db.SelectContext(ctx, &runs, query, reportID, limit, offset)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list report runs: %w", err)
+	}
+
+	return runs, nil
+}
+
+// AccessReview summarises every user's role and the targets they connected to
+// between from and to
+func (r *ReportRepository) AccessReview(ctx context.Context, from, to time.Time, filters models.ReportFilters) ([]*models.AccessReviewEntry, error) {
+	query := `
+		SELECT u.email, COALESCE(u.display_name, '') AS display_name, u.role, u.enabled, u.last_login_at,
+		       COUNT(a.id) AS sessions,
+		       COALESCE(ARRAY_AGG(DISTINCT t.name) FILTER (WHERE t.name IS NOT NULL), '{}') AS target_names,
+		       MAX(a.start_time) AS last_session_at
+		FROM users u
+		LEFT JOIN audit_logs a ON a.user_id = u.id AND a.start_time >= $1 AND a.start_time < $2
+		LEFT JOIN targets t ON a.target_id = t.id
+		WHERE ($3 = '' OR u.role = $3)
+		GROUP BY u.id
+		ORDER BY u.email
+	`
+
+	var entries []*models.AccessReviewEntry
+	err := r.db.SelectContext(ctx, &entries, query, from, to, filters.Role)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query access review: %w", err)
+	}
+
+	return entries, nil
+}
+
+// SessionActivity lists sessions started between from and to
+func (r *ReportRepository) SessionActivity(ctx context.Context, from, to time.Time, filters models.ReportFilters) ([]*models.SessionActivityEntry, error) {
+	query := `
+		SELECT a.start_time, a.end_time, u.email AS user_email, t.name AS target_name, t.hostname,
+		       t.environment, t.owner_team, t.compliance_scope, ` + riskTierExpr + ` AS risk_tier,
+		       t.protocol, a.session_status, a.client_ip, a.bytes_sent, a.bytes_received,
+		       ARRAY(
+		           SELECT concat_ws(' ', '[' || to_char(n.offset_ms * INTERVAL '1 millisecond', 'HH24:MI:SS') || ']',
+		                            n.label, n.note, '(' || au.email || ')')
+		           FROM session_annotations n
+		           LEFT JOIN users au ON n.author_id = au.id
+		           WHERE n.audit_log_id = a.id
+		           ORDER BY n.offset_ms, n.created_at
+		       ) AS annotations
+		FROM audit_logs a
+		JOIN users u ON a.user_id = u.id
+		JOIN targets t ON a.target_id = t.id
+		WHERE a.start_time >= $1 AND a.start_time < $2
+	`
+	args := []interface{}{from, to}
+
+	if filters.UserID != nil {
+		args = append(args, *filters.UserID)
+		query += fmt.Sprintf(" AND a.user_id = $%d", len(args))
+	}
+	if filters.TargetID != nil {
+		args = append(args, *filters.TargetID)
+		query += fmt.Sprintf(" AND a.target_id = $%d", len(args))
+	}
+	if filters.Status != "" {
+		args = append(args, filters.Status)
+		query += fmt.Sprintf(" AND a.session_status = $%d", len(args))
+	}
+	if filters.Protocol != "" {
+		args = append(args, filters.Protocol)
+		query += fmt.Sprintf(" AND t.protocol = $%d", len(args))
+	}
+	if filters.Environment != "" {
+		args = append(args, filters.Environment)
+		query += fmt.Sprintf(" AND t.environment = $%d", len(args))
+	}
+	if filters.ComplianceScope != "" {
+		args = append(args, pq.StringArray{filters.ComplianceScope})
+		query += fmt.Sprintf(" AND t.compliance_scope @> $%d", len(args))
+	}
+
+	query += " ORDER BY a.start_time"
+
+	var entries []*models.SessionActivityEntry
+	err := r.db.SelectContext(ctx, &entries, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query session activity: %w", err)
+	}
+
+	return entries, nil
+}
+
+// SystemAudit lists system audit events between from and to
+func (r *ReportRepository) SystemAudit(ctx context.Context, from, to time.Time, filters models.ReportFilters) ([]*models.SystemAuditEntry, error) {
+	query := `
+		SELECT s.timestamp, s.event_type, u.email AS user_email, s.action, s.status,
+		       s.resource_type, s.resource_name, s.ip_address
+		FROM system_audit_logs s
+		LEFT JOIN users u ON s.user_id = u.id
+		WHERE s.timestamp >= $1 AND s.timestamp < $2
+	`
+	args := []interface{}{from, to}
+
+	if filters.UserID != nil {
+		args = append(args, *filters.UserID)
+		query += fmt.Sprintf(" AND (s.user_id = $%d OR s.target_user_id = $%d)", len(args), len(args))
+	}
+	if filters.EventType != "" {
+		args = append(args, filters.EventType)
+		query += fmt.Sprintf(" AND s.event_type = $%d", len(args))
+	}
+	if filters.Status != "" {
+		args = append(args, filters.Status)
+		query += fmt.Sprintf(" AND s.status = $%d", len(args))
+	}
+
+	query += " ORDER BY s.timestamp"
+
+	var entries []*models.SystemAuditEntry
+	err := r.db.SelectContext(ctx, &entries, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query system audit: %w", err)
+	}
+
+	return entries, nil
+}
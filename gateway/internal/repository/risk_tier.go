@@ -0,0 +1,178 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/VanCannon/openpam/gateway/internal/actor"
+	"github.com/VanCannon/openpam/gateway/internal/database"
+	"github.com/VanCannon/openpam/gateway/internal/models"
+	"github.com/google/uuid"
+)
+
+// riskTierExpr resolves the risk tier of the target aliased t: its own tier,
+// else the highest tier of its labels, else the default tier
+const riskTierExpr = `COALESCE(t.risk_tier, (
+		SELECT l.tier FROM risk_tier_labels l
+		WHERE t.labels ->> l.label_key = l.label_value
+		   OR (l.label_value = '' AND t.labels ->> l.label_key IS NOT NULL)
+		ORDER BY array_position(ARRAY['low', 'medium', 'high', 'critical']::varchar[], l.tier) DESC
+		LIMIT 1
+	), '` + models.DefaultRiskTier + `')`
+
+// RiskTierRepository handles risk tiers and the approval quorums they need
+type RiskTierRepository struct {
+	db *database.DB
+}
+
+// NewRiskTierRepository creates a new risk tier repository
+func NewRiskTierRepository(db *database.DB) *RiskTierRepository {
+	return &RiskTierRepository{db: db}
+}
+
+const quorumColumns = `tier, auto_approve, approvals, group_id, group_approvals, version, updated_by, updated_at`
+
+// ListQuorums lists the approval quorums of all tiers, lowest tier first
+func (r *RiskTierRepository) ListQuorums(ctx context.Context) ([]*models.ApprovalQuorum, error) {
+	query := `SELECT ` + quorumColumns + ` FROM approval_quorums
+		ORDER BY array_position(ARRAY['low', 'medium', 'high', 'critical']::varchar[], tier)`
+
+	var quorums []*models.ApprovalQuorum
+	if err := r.db.SelectContext(ctx, &quorums, query); err != nil {
+		return nil, fmt.Errorf("failed to list approval quorums: %w", err)
+	}
+
+	return quorums, nil
+}
+
+// GetQuorum returns the approval quorum of a tier
+func (r *RiskTierRepository) GetQuorum(ctx context.Context, tier string) (*models.ApprovalQuorum, error) {
+	query := `SELECT ` + quorumColumns + ` FROM approval_quorums WHERE tier = $1`
+
+	var quorum models.ApprovalQuorum
+	if err := r.db.GetContext(ctx, &quorum, query, tier); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, fmt.Errorf("approval quorum not found")
+		}
+		return nil, fmt.Errorf("failed to get approval quorum: %w", err)
+	}
+
+	return &quorum, nil
+}
+
+// UpdateQuorum changes a tier's quorum if it is still at quorum.Version
+func (r *RiskTierRepository) UpdateQuorum(ctx context.Context, quorum *models.ApprovalQuorum) error {
+	query := `
+		UPDATE approval_quorums
+		SET auto_approve = $1, approvals = $2, group_id = $3, group_approvals = $4,
+		    version = version + 1, updated_by = $5, updated_at = $6
+		WHERE tier = $7 AND version = $8
+		RETURNING version
+	`
+
+	quorum.UpdatedBy = actor.UserID(ctx)
+	quorum.UpdatedAt = time.Now()
+
+	err := r.db.GetContext(ctx, &quorum.Version, query,
+		quorum.AutoApprove, quorum.Approvals, quorum.GroupID, quorum.GroupApprovals,
+		quorum.UpdatedBy, quorum.UpdatedAt, quorum.Tier, quorum.Version,
+	)
+	if errors.Is(err, sql.ErrNoRows) {
+		var exists bool
+		if err := r.db.GetContext(ctx, &exists, `SELECT EXISTS (SELECT 1 FROM approval_quorums WHERE tier = $1)`, quorum.Tier); err != nil {
+			return fmt.Errorf("failed to check approval quorum version: %w", err)
+		}
+		if !exists {
+			return fmt.Errorf("approval quorum not found")
+		}
+		return ErrVersionConflict
+	}
+	if err != nil {
+		return fmt.Errorf("failed to update approval quorum: %w", err)
+	}
+
+	return nil
+}
+
+// ListLabels lists the labels that put targets in a tier
+func (r *RiskTierRepository) ListLabels(ctx context.Context) ([]*models.RiskTierLabel, error) {
+	query := `
+		SELECT label_key, label_value, tier, created_by, created_at
+		FROM risk_tier_labels
+		ORDER BY label_key, label_value
+	`
+
+	var labels []*models.RiskTierLabel
+	if err := r.db.SelectContext(ctx, &labels, query); err != nil {
+		return nil, fmt.Errorf("failed to list risk tier labels: %w", err)
+	}
+
+	return labels, nil
+}
+
+// SetLabel puts the targets carrying a label in a tier, replacing the label's
+// previous tier
+func (r *RiskTierRepository) SetLabel(ctx context.Context, label *models.RiskTierLabel) error {
+	query := `
+		INSERT INTO risk_tier_labels (label_key, label_value, tier, created_by, created_at)
+		VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT (label_key, label_value) DO UPDATE
+		SET tier = EXCLUDED.tier, created_by = EXCLUDED.created_by, created_at = EXCLUDED.created_at
+	`
+
+	label.CreatedBy = actor.UserID(ctx)
+	label.CreatedAt = time.Now()
+
+	_, err := r.db.ExecContext(ctx, query, label.Key, label.Value, label.Tier, label.CreatedBy, label.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to set risk tier label: %w", err)
+	}
+
+	return nil
+}
+
+// DeleteLabel stops a label from putting targets in a tier
+func (r *RiskTierRepository) DeleteLabel(ctx context.Context, key, value string) error {
+	result, err := r.db.ExecContext(ctx, `DELETE FROM risk_tier_labels WHERE label_key = $1 AND label_value = $2`, key, value)
+	if err != nil {
+		return fmt.Errorf("failed to delete risk tier label: %w", err)
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+	if rows == 0 {
+		return fmt.Errorf("risk tier label not found")
+	}
+
+	return nil
+}
+
+// TargetTier resolves the risk tier of a target: its own tier, else the
+// highest tier of its labels, else the default tier
+func (r *RiskTierRepository) TargetTier(ctx context.Context, targetID uuid.UUID) (string, error) {
+	query := `SELECT ` + riskTierExpr + ` FROM targets t WHERE t.id = $1`
+
+	var tier string
+	if err := r.db.GetContext(ctx, &tier, query, targetID); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return "", fmt.Errorf("target not found")
+		}
+		return "", fmt.Errorf("failed to resolve target risk tier: %w", err)
+	}
+
+	return tier, nil
+}
+
+// TargetQuorum returns the approval quorum of a target's risk tier
+func (r *RiskTierRepository) TargetQuorum(ctx context.Context, targetID uuid.UUID) (*models.ApprovalQuorum, error) {
+	tier, err := r.TargetTier(ctx, targetID)
+	if err != nil {
+		return nil, err
+	}
+	return r.GetQuorum(ctx, tier)
+}
@@ -0,0 +1,94 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"os"
+	"testing"
+
+	"github.com/VanCannon/openpam/gateway/internal/database"
+	"github.com/VanCannon/openpam/gateway/internal/models"
+	"github.com/jmoiron/sqlx"
+)
+
+// testDB connects to the PostgreSQL database in TEST_DATABASE_URL and
+// migrates it, skipping the test when none is set
+func testDB(t *testing.T) *database.DB {
+	t.Helper()
+
+	dsn := os.Getenv("TEST_DATABASE_URL")
+	if dsn == "" {
+		t.Skip("TEST_DATABASE_URL not set")
+	}
+	conn, err := sqlx.Connect("postgres", dsn)
+	if err != nil {
+		t.Fatalf("failed to connect to test database: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	db := &database.DB{DB: conn}
+	migrator, err := database.NewMigrator(db)
+	if err != nil {
+		t.Fatalf("NewMigrator() error = %v", err)
+	}
+	if err := migrator.Up(); err != nil {
+		t.Fatalf("failed to migrate test database: %v", err)
+	}
+	return db
+}
+
+func TestRiskTierRepository_QuorumGroupDeleted(t *testing.T) {
+	db := testDB(t)
+	ctx := context.Background()
+	groups, riskTiers := NewGroupRepository(db), NewRiskTierRepository(db)
+
+	group := &models.Group{Name: "security-team-quorum-test", Role: models.RoleUser}
+	if err := groups.Create(ctx, group); err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+	t.Cleanup(func() { db.ExecContext(ctx, `DELETE FROM groups WHERE id = $1`, group.ID) })
+
+	original, err := riskTiers.GetQuorum(ctx, models.RiskTierCritical)
+	if err != nil {
+		t.Fatalf("GetQuorum() error = %v", err)
+	}
+	t.Cleanup(func() {
+		db.ExecContext(ctx, `UPDATE approval_quorums SET approvals = $1, group_id = $2, group_approvals = $3 WHERE tier = $4`,
+			original.Approvals, original.GroupID, original.GroupApprovals, original.Tier)
+	})
+
+	quorum := *original
+	quorum.GroupID, quorum.GroupApprovals = &group.ID, 1
+	if err := riskTiers.UpdateQuorum(ctx, &quorum); err != nil {
+		t.Fatalf("UpdateQuorum() error = %v", err)
+	}
+
+	// The group can't be deleted while the quorum needs it...
+	if err := groups.Delete(ctx, group.ID); !errors.Is(err, ErrGroupInQuorum) {
+		t.Errorf("Delete() error = %v, want ErrGroupInQuorum", err)
+	}
+	if _, err := db.ExecContext(ctx, `DELETE FROM groups WHERE id = $1`, group.ID); err == nil {
+		t.Error("database deleted a group a quorum needs")
+	}
+	got, err := riskTiers.GetQuorum(ctx, models.RiskTierCritical)
+	if err != nil {
+		t.Fatalf("GetQuorum() error = %v", err)
+	}
+	if got.GroupID == nil || *got.GroupID != group.ID || got.GroupApprovals != 1 {
+		t.Errorf("quorum = %+v, want the group kept", got)
+	}
+
+	// ...nor can the quorum ask for group approvals without a group
+	if _, err := db.ExecContext(ctx, `UPDATE approval_quorums SET group_id = NULL WHERE tier = $1`, models.RiskTierCritical); err == nil {
+		t.Error("quorum kept group_approvals without a group")
+	}
+
+	// Once the quorum stops needing it, it can be deleted
+	got.GroupID, got.GroupApprovals = nil, 0
+	if err := riskTiers.UpdateQuorum(ctx, got); err != nil {
+		t.Fatalf("UpdateQuorum() error = %v", err)
+	}
+	if err := groups.Delete(ctx, group.ID); err != nil {
+		t.Errorf("Delete() after the quorum changed error = %v", err)
+	}
+}
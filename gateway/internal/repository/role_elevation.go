@@ -0,0 +1,215 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/VanCannon/openpam/gateway/internal/database"
+	"github.com/VanCannon/openpam/gateway/internal/models"
+	"github.com/google/uuid"
+)
+
+var (
+	// ErrElevationOpen is returned when the user already has a pending or active elevation
+	ErrElevationOpen = errors.New("user already has an open role elevation")
+
+	// ErrElevationClosed is returned when an elevation was already decided, ended or expired
+	ErrElevationClosed = errors.New("role elevation is no longer open")
+)
+
+// RoleElevationRepository handles role elevation data operations
+type RoleElevationRepository struct {
+	db *database.DB
+}
+
+// NewRoleElevationRepository creates a new role elevation repository
+func NewRoleElevationRepository(db *database.DB) *RoleElevationRepository {
+	return &RoleElevationRepository{db: db}
+}
+
+const elevationColumns = `
+	e.id, e.user_id, COALESCE(u.email, '') AS user_email, e.role, e.justification, e.duration_hours,
+	e.status, e.decided_by, e.decided_at, e.rejection_reason, e.starts_at, e.expires_at,
+	e.ended_by, e.ended_at, e.created_at
+`
+
+// returningElevation lists the columns of an updated elevation, without the joined email
+const returningElevation = `
+	RETURNING id, user_id, role, justification, duration_hours, status, decided_by, decided_at,
+	          rejection_reason, starts_at, expires_at, ended_by, ended_at, created_at
+`
+
+// Create stores a new elevation. Elevations granted without approval are
+// created active, with their start and expiry set by the caller.
+// ErrElevationOpen is returned if the user already has an open elevation.
+func (r *RoleElevationRepository) Create(ctx context.Context, el *models.RoleElevation) error {
+	query := `
+		INSERT INTO role_elevations (
+			id, user_id, role, justification, duration_hours, status,
+			decided_at, starts_at, expires_at, created_at
+		)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+		ON CONFLICT DO NOTHING
+	`
+
+	el.ID = uuid.New()
+	el.CreatedAt = time.Now()
+
+	result, err := r.db.ExecContext(ctx, query,
+		el.ID,
+		el.UserID,
+		el.Role,
+		el.Justification,
+		el.DurationHours,
+		el.Status,
+		el.DecidedAt,
+		el.StartsAt,
+		el.ExpiresAt,
+		el.CreatedAt,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to create role elevation: %w", err)
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+	if rows == 0 {
+		return ErrElevationOpen
+	}
+
+	return nil
+}
+
+// GetByID retrieves a role elevation by ID
+func (r *RoleElevationRepository) GetByID(ctx context.Context, id uuid.UUID) (*models.RoleElevation, error) {
+	query := `
+		SELECT ` + elevationColumns + `
+		FROM role_elevations e
+		LEFT JOIN users u ON e.user_id = u.id
+		WHERE e.id = $1
+	`
+
+	var el models.RoleElevation
+	if err := r.db.GetContext(ctx, &el, query, id); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("role elevation not found")
+		}
+		return nil, fmt.Errorf("failed to get role elevation: %w", err)
+	}
+
+	return &el, nil
+}
+
+// List retrieves elevations, newest first. A nil userID lists every user's
+// elevations and an empty status every status.
+func (r *RoleElevationRepository) List(ctx context.Context, userID *uuid.UUID, status string, limit int) ([]*models.RoleElevation, error) {
+	query := `
+		SELECT ` + elevationColumns + `
+		FROM role_elevations e
+		LEFT JOIN users u ON e.user_id = u.id
+		WHERE ($1::uuid IS NULL OR e.user_id = $1)
+		  AND ($2 = '' OR e.status = $2)
+		ORDER BY e.created_at DESC
+		LIMIT $3
+	`
+
+	var elevations []*models.RoleElevation
+	if err := r.db.SelectContext(ctx, &elevations, query, userID, status, limit); err != nil {
+		return nil, fmt.Errorf("failed to list role elevations: %w", err)
+	}
+
+	return elevations, nil
+}
+
+// GetActive returns the elevation the user holds at now, or nil if none
+func (r *RoleElevationRepository) GetActive(ctx context.Context, userID uuid.UUID, now time.Time) (*models.RoleElevation, error) {
+	query := `
+		SELECT ` + elevationColumns + `
+		FROM role_elevations e
+		LEFT JOIN users u ON e.user_id = u.id
+		WHERE e.user_id = $1 AND e.status = 'active' AND e.expires_at > $2
+	`
+
+	var el models.RoleElevation
+	if err := r.db.GetContext(ctx, &el, query, userID, now); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get active role elevation: %w", err)
+	}
+
+	return &el, nil
+}
+
+// Decide approves or rejects a pending elevation. An approved elevation starts
+// at now and lasts its requested duration. ErrElevationClosed is returned if
+// the elevation was decided first by someone else or withdrawn.
+func (r *RoleElevationRepository) Decide(ctx context.Context, id uuid.UUID, approve bool, decidedBy uuid.UUID, reason *string, now time.Time) (*models.RoleElevation, error) {
+	status := models.ElevationStatusRejected
+	var startsAt *time.Time
+	if approve {
+		status = models.ElevationStatusActive
+		startsAt = &now
+	}
+
+	query := `
+		UPDATE role_elevations
+		SET status = $1, decided_by = $2, decided_at = $3, rejection_reason = $4,
+		    starts_at = $5::timestamptz, expires_at = $5::timestamptz + duration_hours * INTERVAL '1 hour'
+		WHERE id = $6 AND status = 'pending'
+	` + returningElevation
+
+	var el models.RoleElevation
+	err := r.db.GetContext(ctx, &el, query, status, decidedBy, now, reason, startsAt, id)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, ErrElevationClosed
+		}
+		return nil, fmt.Errorf("failed to decide role elevation: %w", err)
+	}
+
+	return &el, nil
+}
+
+// Revoke ends an active elevation early, or withdraws a pending one.
+// ErrElevationClosed is returned if it had already ended.
+func (r *RoleElevationRepository) Revoke(ctx context.Context, id uuid.UUID, endedBy uuid.UUID, now time.Time) (*models.RoleElevation, error) {
+	query := `
+		UPDATE role_elevations
+		SET status = 'revoked', ended_by = $1, ended_at = $2
+		WHERE id = $3 AND (status = 'pending' OR (status = 'active' AND expires_at > $2))
+	` + returningElevation
+
+	var el models.RoleElevation
+	err := r.db.GetContext(ctx, &el, query, endedBy, now, id)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, ErrElevationClosed
+		}
+		return nil, fmt.Errorf("failed to revoke role elevation: %w", err)
+	}
+
+	return &el, nil
+}
+
+// ExpireDue marks the active elevations that expired at or before now as
+// expired and returns them
+func (r *RoleElevationRepository) ExpireDue(ctx context.Context, now time.Time) ([]*models.RoleElevation, error) {
+	query := `
+		UPDATE role_elevations
+		SET status = 'expired', ended_at = expires_at
+		WHERE status = 'active' AND expires_at <= $1
+	` + returningElevation
+
+	var elevations []*models.RoleElevation
+	if err := r.db.SelectContext(ctx, &elevations, query, now); err != nil {
+		return nil, fmt.Errorf("failed to expire role elevations: %w", err)
+	}
+
+	return elevations, nil
+}
@@ -0,0 +1,360 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/VanCannon/openpam/gateway/internal/actor"
+	"github.com/VanCannon/openpam/gateway/internal/database"
+	"github.com/VanCannon/openpam/gateway/internal/models"
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+)
+
+// SatelliteRepository handles the configuration, rollouts and reported status
+// of managed satellites
+type SatelliteRepository struct {
+	db *database.DB
+}
+
+// NewSatelliteRepository creates a new satellite repository
+func NewSatelliteRepository(db *database.DB) *SatelliteRepository {
+	return &SatelliteRepository{db: db}
+}
+
+// GetConfig retrieves the configuration pushed to a zone's satellites
+func (r *SatelliteRepository) GetConfig(ctx context.Context, zoneID uuid.UUID) (*models.SatelliteConfig, error) {
+	query := `
+		SELECT zone_id, revision, config_values, updated_by, updated_at
+		FROM satellite_configs
+		WHERE zone_id = $1
+	`
+
+	var cfg models.SatelliteConfig
+	err := r.db.GetContext(ctx, &cfg, query, zoneID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("satellite config not found")
+		}
+		return nil, fmt.Errorf("failed to get satellite config: %w", err)
+	}
+
+	return &cfg, nil
+}
+
+// SaveConfig stores a zone's satellite configuration as its next revision
+func (r *SatelliteRepository) SaveConfig(ctx context.Context, cfg *models.SatelliteConfig) error {
+	query := `
+		INSERT INTO satellite_configs (zone_id, revision, config_values, updated_by, updated_at)
+		VALUES ($1, 1, $2, $3, $4)
+		ON CONFLICT (zone_id) DO UPDATE
+		SET revision = satellite_configs.revision + 1, config_values = EXCLUDED.config_values,
+		    updated_by = EXCLUDED.updated_by, updated_at = EXCLUDED.updated_at
+		RETURNING revision
+	`
+
+	cfg.UpdatedAt = time.Now()
+	if id := actor.UserID(ctx); !cfg.UpdatedBy.Valid && id != nil {
+		cfg.UpdatedBy = uuid.NullUUID{UUID: *id, Valid: true}
+	}
+
+	err := r.db.QueryRowContext(ctx, query,
+		cfg.ZoneID,
+		cfg.Values,
+		cfg.UpdatedBy,
+		cfg.UpdatedAt,
+	).Scan(&cfg.Revision)
+
+	if err != nil {
+		return fmt.Errorf("failed to save satellite config: %w", err)
+	}
+
+	return nil
+}
+
+const rolloutColumns = `
+	id, version, url, sha256, size, stages, current_stage, status, error,
+	created_by, created_at, updated_at
+`
+
+// CreateRollout creates a new rollout
+func (r *SatelliteRepository) CreateRollout(ctx context.Context, rollout *models.SatelliteRollout) error {
+	query := `
+		INSERT INTO satellite_rollouts (
+			id, version, url, sha256, size, stages, current_stage, status, created_by, updated_by, created_at, updated_at
+		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $9, $10, $11)
+	`
+
+	rollout.ID = uuid.New()
+	if id := actor.UserID(ctx); !rollout.CreatedBy.Valid && id != nil {
+		rollout.CreatedBy = uuid.NullUUID{UUID: *id, Valid: true}
+	}
+	rollout.CreatedAt = time.Now()
+	rollout.UpdatedAt = time.Now()
+
+	_, err := r.db.ExecContext(ctx, query,
+		rollout.ID,
+		rollout.Version,
+		rollout.URL,
+		rollout.SHA256,
+		rollout.Size,
+		rollout.Stages,
+		rollout.CurrentStage,
+		rollout.Status,
+		rollout.CreatedBy,
+		rollout.CreatedAt,
+		rollout.UpdatedAt,
+	)
+
+	if err != nil {
+		return fmt.Errorf("failed to create rollout: %w", err)
+	}
+
+	return nil
+}
+
+// GetRollout retrieves a rollout by ID
+func (r *SatelliteRepository) GetRollout(ctx context.Context, id uuid.UUID) (*models.SatelliteRollout, error) {
+	query := `SELECT ` + rolloutColumns + ` FROM satellite_rollouts WHERE id = $1`
+
+	var rollout models.SatelliteRollout
+	err := r.db.GetContext(ctx, &rollout, query, id)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("rollout not found")
+		}
+		return nil, fmt.Errorf("failed to get rollout: %w", err)
+	}
+
+	return &rollout, nil
+}
+
+// ListRollouts retrieves rollouts, newest first
+func (r *SatelliteRepository) ListRollouts(ctx context.Context, limit, offset int) ([]*models.SatelliteRollout, error) {
+	query := `SELECT ` + rolloutColumns + ` FROM satellite_rollouts ORDER BY created_at DESC LIMIT $1 OFFSET $2`
+
+	var rollouts []*models.SatelliteRollout
+	err := r.db.SelectContext(ctx, &rollouts, query, limit, offset)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list rollouts: %w", err)
+	}
+
+	return rollouts, nil
+}
+
+// ListActiveRollouts retrieves the rollouts in progress, oldest first
+func (r *SatelliteRepository) ListActiveRollouts(ctx context.Context) ([]*models.SatelliteRollout, error) {
+	query := `SELECT ` + rolloutColumns + ` FROM satellite_rollouts WHERE status = $1 ORDER BY created_at`
+
+	var rollouts []*models.SatelliteRollout
+	err := r.db.SelectContext(ctx, &rollouts, query, models.RolloutStatusActive)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list active rollouts: %w", err)
+	}
+
+	return rollouts, nil
+}
+
+// UpdateRollout stores a rollout's progress
+func (r *SatelliteRepository) UpdateRollout(ctx context.Context, rollout *models.SatelliteRollout) error {
+	query := `
+		UPDATE satellite_rollouts
+		SET current_stage = $1, status = $2, error = $3, updated_at = $4, updated_by = $6
+		WHERE id = $5
+	`
+
+	rollout.UpdatedAt = time.Now()
+
+	result, err := r.db.ExecContext(ctx, query,
+		rollout.CurrentStage,
+		rollout.Status,
+		rollout.Error,
+		rollout.UpdatedAt,
+		rollout.ID,
+		actor.UserID(ctx),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to update rollout: %w", err)
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+	if rows == 0 {
+		return fmt.Errorf("rollout not found")
+	}
+
+	return nil
+}
+
+// SaveStatus stores the status a satellite reported
+func (r *SatelliteRepository) SaveStatus(ctx context.Context, status *models.SatelliteStatus) error {
+	query := `
+		INSERT INTO satellite_status (zone_id, version, config_revision, rollout_id, update_state, update_error, reported_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		ON CONFLICT (zone_id) DO UPDATE
+		SET version = EXCLUDED.version, config_revision = EXCLUDED.config_revision,
+		    rollout_id = EXCLUDED.rollout_id, update_state = EXCLUDED.update_state,
+		    update_error = EXCLUDED.update_error, reported_at = EXCLUDED.reported_at
+	`
+
+	_, err := r.db.ExecContext(ctx, query,
+		status.ZoneID,
+		status.Version,
+		status.ConfigRevision,
+		status.RolloutID,
+		status.UpdateState,
+		status.UpdateError,
+		status.ReportedAt,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to save satellite status: %w", err)
+	}
+
+	return nil
+}
+
+// ListStatus retrieves the last status of every satellite
+func (r *SatelliteRepository) ListStatus(ctx context.Context) ([]*models.SatelliteStatus, error) {
+	query := `
+		SELECT zone_id, version, config_revision, rollout_id, update_state, update_error, reported_at
+		FROM satellite_status
+		ORDER BY zone_id
+	`
+
+	var statuses []*models.SatelliteStatus
+	err := r.db.SelectContext(ctx, &statuses, query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list satellite status: %w", err)
+	}
+
+	return statuses, nil
+}
+
+// SaveMetrics stores a satellite's metrics snapshot
+func (r *SatelliteRepository) SaveMetrics(ctx context.Context, metrics *models.SatelliteMetrics) error {
+	query := `
+		INSERT INTO satellite_metrics (zone_id, metrics, collected_at, received_at)
+		VALUES ($1, $2, $3, $4)
+		RETURNING id
+	`
+
+	err := r.db.QueryRowContext(ctx, query,
+		metrics.ZoneID,
+		metrics.Metrics,
+		metrics.CollectedAt,
+		metrics.ReceivedAt,
+	).Scan(&metrics.ID)
+
+	if err != nil {
+		return fmt.Errorf("failed to save satellite metrics: %w", err)
+	}
+
+	return nil
+}
+
+// SaveLogs stores a batch of log messages forwarded by a satellite
+func (r *SatelliteRepository) SaveLogs(ctx context.Context, logs []*models.SatelliteLog) error {
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	for _, l := range logs {
+		err := tx.QueryRowContext(ctx, `
+			INSERT INTO satellite_logs (zone_id, logged_at, level, message, fields, received_at)
+			VALUES ($1, $2, $3, $4, $5, $6)
+			RETURNING id
+		`,
+			l.ZoneID,
+			l.LoggedAt,
+			l.Level,
+			l.Message,
+			l.Fields,
+			l.ReceivedAt,
+		).Scan(&l.ID)
+		if err != nil {
+			return fmt.Errorf("failed to save satellite log: %w", err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return nil
+}
+
+// DeleteDiagnosticsBefore removes a zone's metrics and logs received before the cutoff
+func (r *SatelliteRepository) DeleteDiagnosticsBefore(ctx context.Context, zoneID uuid.UUID, cutoff time.Time) error {
+	if _, err := r.db.ExecContext(ctx, `DELETE FROM satellite_metrics WHERE zone_id = $1 AND received_at < $2`, zoneID, cutoff); err != nil {
+		return fmt.Errorf("failed to delete old satellite metrics: %w", err)
+	}
+	if _, err := r.db.ExecContext(ctx, `DELETE FROM satellite_logs WHERE zone_id = $1 AND received_at < $2`, zoneID, cutoff); err != nil {
+		return fmt.Errorf("failed to delete old satellite logs: %w", err)
+	}
+
+	return nil
+}
+
+// ListMetrics retrieves a zone's metrics snapshots collected since the given
+// time, newest first
+func (r *SatelliteRepository) ListMetrics(ctx context.Context, zoneID uuid.UUID, since time.Time, limit int) ([]*models.SatelliteMetrics, error) {
+	query := `
+		SELECT id, zone_id, metrics, collected_at, received_at
+		FROM satellite_metrics
+		WHERE zone_id = $1 AND collected_at >= $2
+		ORDER BY collected_at DESC
+		LIMIT $3
+	`
+
+	var metrics []*models.SatelliteMetrics
+	err := r.db.SelectContext(ctx, &metrics, query, zoneID, since, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list satellite metrics: %w", err)
+	}
+
+	return metrics, nil
+}
+
+// SatelliteLogFilter narrows the log messages listed for a zone
+type SatelliteLogFilter struct {
+	Since  time.Time
+	Levels []string // Empty lists every level
+	Search string   // Substring of the message, case-insensitive
+	Limit  int
+}
+
+// ListLogs retrieves a zone's forwarded log messages, newest first
+func (r *SatelliteRepository) ListLogs(ctx context.Context, zoneID uuid.UUID, filter SatelliteLogFilter) ([]*models.SatelliteLog, error) {
+	query := `
+		SELECT id, zone_id, logged_at, level, message, fields, received_at
+		FROM satellite_logs
+		WHERE zone_id = $1 AND logged_at >= $2
+	`
+	args := []interface{}{zoneID, filter.Since}
+
+	if len(filter.Levels) > 0 {
+		args = append(args, pq.Array(filter.Levels))
+		query += fmt.Sprintf(" AND level = ANY($%d)", len(args))
+	}
+	if filter.Search != "" {
+		args = append(args, "%"+filter.Search+"%")
+		query += fmt.Sprintf(" AND message ILIKE $%d", len(args))
+	}
+
+	args = append(args, filter.Limit)
+	query += fmt.Sprintf(" ORDER BY logged_at DESC, id DESC LIMIT $%d", len(args))
+
+	var logs []*models.SatelliteLog
+	err := r.db.SelectContext(ctx, &logs, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list satellite logs: %w", err)
+	}
+
+	return logs, nil
+}
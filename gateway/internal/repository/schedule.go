@@ -2,12 +2,16 @@ package repository
 
 import (
 	"context"
+	"database/sql"
+	"errors"
 	"fmt"
 	"time"
 
+	"github.com/VanCannon/openpam/gateway/internal/actor"
 	"github.com/VanCannon/openpam/gateway/internal/database"
 	"github.com/VanCannon/openpam/gateway/internal/models"
 	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
 )
 
 // ScheduleRepository handles database operations for schedules
@@ -24,15 +28,20 @@ func NewScheduleRepository(db *database.DB) *ScheduleRepository {
 
 // Create creates a new schedule
 func (r *ScheduleRepository) Create(ctx context.Context, schedule *models.Schedule) error {
+	schedule.Version = 1
+	if schedule.CreatedBy == nil {
+		schedule.CreatedBy = actor.UserID(ctx)
+	}
+	schedule.UpdatedBy = schedule.CreatedBy
 	query := `
 		INSERT INTO schedules (
 			id, user_id, target_id, start_time, end_time, recurrence_rule, timezone,
-			status, created_by, created_at, updated_at, metadata,
-			approval_status, rejection_reason, approved_by, approved_at
+			status, created_by, updated_by, created_at, updated_at, metadata,
+			approval_status, rejection_reason, approved_by, approved_at, batch_id, risk_tier
 		) VALUES (
 			:id, :user_id, :target_id, :start_time, :end_time, :recurrence_rule, :timezone,
-			:status, :created_by, :created_at, :updated_at, :metadata,
-			:approval_status, :rejection_reason, :approved_by, :approved_at
+			:status, :created_by, :updated_by, :created_at, :updated_at, :metadata,
+			:approval_status, :rejection_reason, :approved_by, :approved_at, :batch_id, :risk_tier
 		)
 	`
 	_, err := r.db.NamedExecContext(ctx, query, schedule)
@@ -49,7 +58,8 @@ func (r *ScheduleRepository) GetByID(ctx context.Context, id uuid.UUID) (*models
 	return &schedule, nil
 }
 
-// List retrieves a list of schedules based on filters
+// List retrieves a list of schedules based on filters. A zone admin only
+// gets their own schedules and those of targets in their zones.
 func (r *ScheduleRepository) List(ctx context.Context, userID *uuid.UUID, targetID *uuid.UUID, status *models.ScheduleStatus, approvalStatus *string) ([]models.Schedule, error) {
 	query := `SELECT * FROM schedules WHERE 1=1`
 	args := []interface{}{}
@@ -79,6 +89,12 @@ func (r *ScheduleRepository) List(ctx context.Context, userID *uuid.UUID, target
 		argIdx++
 	}
 
+	if zones := zoneScope(ctx); zones != nil {
+		query += fmt.Sprintf(" AND (user_id = $%d OR target_id IN (SELECT id FROM targets WHERE zone_id = ANY($%d::uuid[])))", argIdx, argIdx+1)
+		args = append(args, actor.UserID(ctx), zones)
+		argIdx += 2
+	}
+
 	query += " ORDER BY created_at DESC"
 
 	var schedules []models.Schedule
@@ -88,19 +104,84 @@ func (r *ScheduleRepository) List(ctx context.Context, userID *uuid.UUID, target
 	return schedules, nil
 }
 
+// ListPendingByTargets retrieves the upcoming schedules of the given targets
+// that have yet to start or are awaiting approval, soonest first. userID, if set, limits
+// them to that user's.
+func (r *ScheduleRepository) ListPendingByTargets(ctx context.Context, targetIDs []uuid.UUID, userID *uuid.UUID) ([]models.Schedule, error) {
+	query := `
+		SELECT * FROM schedules
+		WHERE target_id = ANY($1::uuid[])
+		  AND (status = $2 OR approval_status = $3)
+		  AND status <> $4 AND (end_time > NOW() OR recurrence_rule IS NOT NULL)
+		  AND ($5::uuid IS NULL OR user_id = $5)
+		ORDER BY start_time ASC
+	`
+
+	var schedules []models.Schedule
+	if err := r.db.SelectContext(ctx, &schedules, query, uuidArray(targetIDs),
+		models.ScheduleStatusPending, models.ApprovalStatusPending, models.ScheduleStatusCancelled, userID); err != nil {
+		return nil, err
+	}
+	return schedules, nil
+}
+
+// CalendarFilter selects the schedules shown in a user's calendar feed
+type CalendarFilter struct {
+	UserID  uuid.UUID
+	Pending bool // Also the user's requests awaiting approval
+
+	// Requests awaiting approval that the user can decide, when Pending is set
+	AllRequests  bool        // Every user's, for admins
+	RequestZones []uuid.UUID // Those for targets in these zones, for zone admins
+}
+
+// ListForCalendar retrieves the user's approved schedules that have a window
+// left, and the requests awaiting approval that filter asks for, soonest first
+func (r *ScheduleRepository) ListForCalendar(ctx context.Context, filter CalendarFilter) ([]models.Schedule, error) {
+	query := `
+		SELECT * FROM schedules
+		WHERE status NOT IN ($1, $2)
+		  AND (end_time > NOW() OR recurrence_rule IS NOT NULL)
+		  AND (
+		    (user_id = $3 AND (approval_status = $4 OR ($5 AND approval_status = $6)))
+		    OR ($5 AND approval_status = $6 AND (
+		      $7 OR target_id IN (SELECT id FROM targets WHERE zone_id = ANY($8::uuid[]))
+		    ))
+		  )
+		ORDER BY start_time ASC
+	`
+
+	var schedules []models.Schedule
+	if err := r.db.SelectContext(ctx, &schedules, query,
+		models.ScheduleStatusCancelled, models.ScheduleStatusExpired,
+		filter.UserID, models.ApprovalStatusApproved,
+		filter.Pending, models.ApprovalStatusPending,
+		filter.AllRequests, uuidArray(filter.RequestZones)); err != nil {
+		return nil, fmt.Errorf("failed to list calendar schedules: %w", err)
+	}
+	return schedules, nil
+}
+
 // UpdateStatus updates the status of a schedule
 func (r *ScheduleRepository) UpdateStatus(ctx context.Context, id uuid.UUID, status models.ScheduleStatus) error {
-	query := `UPDATE schedules SET status = $1, updated_at = $2 WHERE id = $3`
-	_, err := r.db.ExecContext(ctx, query, status, time.Now(), id)
+	query := `UPDATE schedules SET status = $1, updated_at = $2, updated_by = $4, version = version + 1 WHERE id = $3`
+	_, err := r.db.ExecContext(ctx, query, status, time.Now(), id, actor.UserID(ctx))
 	return err
 }
 
-// UpdateApprovalStatus updates the approval status of a schedule
-func (r *ScheduleRepository) UpdateApprovalStatus(ctx context.Context, id uuid.UUID, status string, reason *string, approvedBy *uuid.UUID) error {
+// UpdateApprovalStatus updates the approval status of a schedule if it is still at
+// the given version. ErrVersionConflict is returned when the schedule was changed
+// since the caller read it, e.g. by another admin deciding on it first.
+func (r *ScheduleRepository) UpdateApprovalStatus(ctx context.Context, id uuid.UUID, version int, status string, reason *string, approvedBy *uuid.UUID) error {
+	if err := checkZone(ctx, r.db, scheduleZoneQuery, id); err != nil {
+		return err
+	}
+
 	query := `
 		UPDATE schedules 
-		SET approval_status = $1, rejection_reason = $2, approved_by = $3, approved_at = $4, updated_at = $5 
-		WHERE id = $6
+		SET approval_status = $1, rejection_reason = $2, approved_by = $3, approved_at = $4, updated_at = $5,
+		    updated_by = $8, version = version + 1
+		WHERE id = $6 AND version = $7
 	`
 	var approvedAt *time.Time
 	if status == models.ApprovalStatusApproved {
@@ -108,6 +189,379 @@ func (r *ScheduleRepository) UpdateApprovalStatus(ctx context.Context, id uuid.U
 		approvedAt = &now
 	}
 
-	_, err := r.db.ExecContext(ctx, query, status, reason, approvedBy, approvedAt, time.Now(), id)
-	return err
+	result, err := r.db.ExecContext(ctx, query, status, reason, approvedBy, approvedAt, time.Now(), id, version, actor.UserID(ctx))
+	if err != nil {
+		return err
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+
+	if rows == 0 {
+		return versionMiss(ctx, r.db, "schedules", "", id, fmt.Errorf("schedule not found"))
+	}
+
+	return nil
+}
+
+// ErrAlreadyApproved is returned when an approver approves a schedule again
+var ErrAlreadyApproved = errors.New("schedule already approved by this approver")
+
+// ErrSelfApproval is returned when the requester of a schedule approves it
+var ErrSelfApproval = errors.New("a schedule can't be approved by its requester")
+
+// ErrNotPending is returned when a schedule that was already approved or
+// rejected is approved
+var ErrNotPending = errors.New("schedule is no longer pending approval")
+
+// checkApprovable checks an approver may vote on a schedule in the given
+// approval status requested by requesterID
+func checkApprovable(status string, requesterID, approverID uuid.UUID) error {
+	if requesterID == approverID {
+		return ErrSelfApproval
+	}
+	if status != models.ApprovalStatusPending {
+		return ErrNotPending
+	}
+	return nil
+}
+
+// ApprovalWindow is the window an approver approves a schedule for instead of
+// the requested one
+type ApprovalWindow struct {
+	Start time.Time
+	End   time.Time
+}
+
+// RecordApproval records an approver's approval of a schedule if it is still
+// at the given version, and approves the schedule once its approvals meet the
+// quorum. Approving another window moves the schedule to it, keeping the
+// window first requested in requested_start_time and requested_end_time, and
+// discards the approvals given for the previous window. The requester can't
+// approve their own schedule, and only pending schedules can be approved.
+func (r *ScheduleRepository) RecordApproval(ctx context.Context, id uuid.UUID, version int, approverID uuid.UUID, channel string, quorum *models.ApprovalQuorum, window *ApprovalWindow) (*models.QuorumProgress, error) {
+	if err := checkZone(ctx, r.db, scheduleZoneQuery, id); err != nil {
+		return nil, err
+	}
+
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	var current struct {
+		Version        int       `db:"version"`
+		UserID         uuid.UUID `db:"user_id"`
+		ApprovalStatus string    `db:"approval_status"`
+	}
+	if err := tx.GetContext(ctx, &current, `SELECT version, user_id, approval_status FROM schedules WHERE id = $1 FOR UPDATE`, id); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("schedule not found")
+		}
+		return nil, fmt.Errorf("failed to lock schedule: %w", err)
+	}
+	if current.Version != version {
+		return nil, ErrVersionConflict
+	}
+	if err := checkApprovable(current.ApprovalStatus, current.UserID, approverID); err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	if window != nil {
+		_, err := tx.ExecContext(ctx, `
+			UPDATE schedules
+			SET requested_start_time = COALESCE(requested_start_time, start_time),
+			    requested_end_time = COALESCE(requested_end_time, end_time),
+			    start_time = $1, end_time = $2
+			WHERE id = $3
+		`, window.Start, window.End, id)
+		if err != nil {
+			return nil, fmt.Errorf("failed to change schedule window: %w", err)
+		}
+		if _, err := tx.ExecContext(ctx, `DELETE FROM schedule_approvals WHERE schedule_id = $1`, id); err != nil {
+			return nil, fmt.Errorf("failed to discard schedule approvals: %w", err)
+		}
+	}
+
+	result, err := tx.ExecContext(ctx, `
+		INSERT INTO schedule_approvals (schedule_id, approver_id, channel, approved_at)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (schedule_id, approver_id) DO NOTHING
+	`, id, approverID, channel, now)
+	if err != nil {
+		return nil, fmt.Errorf("failed to record schedule approval: %w", err)
+	}
+	if rows, err := result.RowsAffected(); err != nil {
+		return nil, fmt.Errorf("failed to get rows affected: %w", err)
+	} else if rows == 0 {
+		return nil, ErrAlreadyApproved
+	}
+
+	progress, err := approvalProgress(ctx, tx, id, quorum)
+	if err != nil {
+		return nil, err
+	}
+
+	if progress.Approved {
+		_, err = tx.ExecContext(ctx, `
+			UPDATE schedules
+			SET approval_status = $1, rejection_reason = NULL, approved_by = $2, approved_at = $3, updated_at = $3,
+			    updated_by = $4, version = version + 1
+			WHERE id = $5
+		`, models.ApprovalStatusApproved, approverID, now, actor.UserID(ctx), id)
+	} else {
+		_, err = tx.ExecContext(ctx, `
+			UPDATE schedules SET updated_at = $1, updated_by = $2, version = version + 1 WHERE id = $3
+		`, now, actor.UserID(ctx), id)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to update schedule: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit schedule approval: %w", err)
+	}
+	return progress, nil
+}
+
+// ApprovalProgress counts the approvals recorded for a schedule towards the quorum
+func (r *ScheduleRepository) ApprovalProgress(ctx context.Context, id uuid.UUID, quorum *models.ApprovalQuorum) (*models.QuorumProgress, error) {
+	return approvalProgress(ctx, r.db, id, quorum)
+}
+
+func approvalProgress(ctx context.Context, q sqlx.QueryerContext, id uuid.UUID, quorum *models.ApprovalQuorum) (*models.QuorumProgress, error) {
+	var counts struct {
+		Approvals      int `db:"approvals"`
+		GroupApprovals int `db:"group_approvals"`
+	}
+	query := `
+		SELECT COUNT(*) AS approvals, COUNT(m.user_id) AS group_approvals
+		FROM schedule_approvals a
+		LEFT JOIN group_members m ON m.user_id = a.approver_id AND m.group_id = $2
+		WHERE a.schedule_id = $1
+	`
+	if err := sqlx.GetContext(ctx, q, &counts, query, id, quorum.GroupID); err != nil {
+		return nil, fmt.Errorf("failed to count schedule approvals: %w", err)
+	}
+	return quorum.Progress(counts.Approvals, counts.GroupApprovals), nil
+}
+
+// CreateBatch creates a batch to link the schedules of a bulk request
+func (r *ScheduleRepository) CreateBatch(ctx context.Context, batch *models.ScheduleBatch) error {
+	batch.ID = uuid.New()
+	batch.CreatedAt = time.Now().UTC()
+	if batch.CreatedBy == nil {
+		batch.CreatedBy = actor.UserID(ctx)
+	}
+
+	query := `INSERT INTO schedule_batches (id, name, created_by, created_at) VALUES ($1, $2, $3, $4)`
+	if _, err := r.db.ExecContext(ctx, query, batch.ID, batch.Name, batch.CreatedBy, batch.CreatedAt); err != nil {
+		return fmt.Errorf("failed to create schedule batch: %w", err)
+	}
+	return nil
+}
+
+// GetBatch retrieves a schedule batch by ID
+func (r *ScheduleRepository) GetBatch(ctx context.Context, id uuid.UUID) (*models.ScheduleBatch, error) {
+	var batch models.ScheduleBatch
+	if err := r.db.GetContext(ctx, &batch, `SELECT * FROM schedule_batches WHERE id = $1`, id); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("schedule batch not found")
+		}
+		return nil, fmt.Errorf("failed to get schedule batch: %w", err)
+	}
+	return &batch, nil
+}
+
+// ListByBatch retrieves the schedules of a batch
+func (r *ScheduleRepository) ListByBatch(ctx context.Context, batchID uuid.UUID) ([]models.Schedule, error) {
+	query := `SELECT * FROM schedules WHERE batch_id = $1 ORDER BY created_at ASC, user_id, target_id`
+
+	var schedules []models.Schedule
+	if err := r.db.SelectContext(ctx, &schedules, query, batchID); err != nil {
+		return nil, fmt.Errorf("failed to list batch schedules: %w", err)
+	}
+	return schedules, nil
+}
+
+// RevokeBatch cancels the schedules of a batch that haven't ended or been
+// cancelled and returns them. Those still awaiting approval are rejected with
+// reason; the reason is kept in the metadata of all of them as revoke_reason.
+func (r *ScheduleRepository) RevokeBatch(ctx context.Context, batchID uuid.UUID, reason string) ([]models.Schedule, error) {
+	schedules, err := r.revoke(ctx, "batch_id", batchID, reason)
+	if err != nil {
+		return nil, fmt.Errorf("failed to revoke batch schedules: %w", err)
+	}
+	return schedules, nil
+}
+
+// Revoke cancels a schedule the way RevokeBatch does, returning nil if it had
+// already ended or been cancelled
+func (r *ScheduleRepository) Revoke(ctx context.Context, id uuid.UUID, reason string) (*models.Schedule, error) {
+	schedules, err := r.revoke(ctx, "id", id, reason)
+	if err != nil {
+		return nil, fmt.Errorf("failed to revoke schedule: %w", err)
+	}
+	if len(schedules) == 0 {
+		return nil, nil
+	}
+	return &schedules[0], nil
+}
+
+// revoke cancels the schedules whose column matches value and that haven't
+// ended or been cancelled
+func (r *ScheduleRepository) revoke(ctx context.Context, column string, value uuid.UUID, reason string) ([]models.Schedule, error) {
+	query := `
+		UPDATE schedules
+		SET status = $1,
+		    approval_status = CASE WHEN approval_status = $2 THEN $3 ELSE approval_status END,
+		    rejection_reason = CASE WHEN approval_status = $2 THEN $4 ELSE rejection_reason END,
+		    metadata = COALESCE(metadata, '{}'::jsonb) || jsonb_build_object('revoke_reason', $4::text),
+		    updated_at = $5, updated_by = $6, version = version + 1
+		WHERE ` + column + ` = $7 AND status IN ($8, $9)
+		RETURNING *
+	`
+
+	var schedules []models.Schedule
+	err := r.db.SelectContext(ctx, &schedules, query,
+		models.ScheduleStatusCancelled, models.ApprovalStatusPending, models.ApprovalStatusRejected, reason,
+		time.Now(), actor.UserID(ctx), value, models.ScheduleStatusPending, models.ScheduleStatusActive)
+	return schedules, err
+}
+
+// ListByOnCallMapping retrieves the schedules maintained by an on-call mapping
+// that haven't ended by now or been cancelled
+func (r *ScheduleRepository) ListByOnCallMapping(ctx context.Context, mappingID uuid.UUID, now time.Time) ([]models.Schedule, error) {
+	query := `
+		SELECT * FROM schedules
+		WHERE metadata ? '` + models.ScheduleMetadataOnCallMapping + `'
+		  AND metadata->>'` + models.ScheduleMetadataOnCallMapping + `' = $1
+		  AND status IN ($2, $3) AND end_time > $4
+		ORDER BY start_time
+	`
+
+	var schedules []models.Schedule
+	err := r.db.SelectContext(ctx, &schedules, query, mappingID.String(),
+		models.ScheduleStatusPending, models.ScheduleStatusActive, now)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list on-call schedules: %w", err)
+	}
+	return schedules, nil
+}
+
+// UpdateEndTime moves the end of a schedule's window
+func (r *ScheduleRepository) UpdateEndTime(ctx context.Context, id uuid.UUID, end time.Time) error {
+	query := `
+		UPDATE schedules SET end_time = $1, updated_at = $2, updated_by = $3, version = version + 1
+		WHERE id = $4
+	`
+
+	if _, err := r.db.ExecContext(ctx, query, end, time.Now(), actor.UserID(ctx), id); err != nil {
+		return fmt.Errorf("failed to update schedule end: %w", err)
+	}
+	return nil
+}
+
+// HasActiveWindow reports whether the user has an approved schedule for the target
+// whose window includes now
+func (r *ScheduleRepository) HasActiveWindow(ctx context.Context, userID, targetID uuid.UUID, now time.Time) (bool, error) {
+	end, err := r.ActiveWindowEnd(ctx, userID, targetID, now)
+	return end != nil, err
+}
+
+// ActiveWindowEnd returns the latest end of the user's approved schedule windows
+// for the target that include now, or nil when there is none. The windows of
+// recurring schedules are their occurrences.
+func (r *ScheduleRepository) ActiveWindowEnd(ctx context.Context, userID, targetID uuid.UUID, now time.Time) (*time.Time, error) {
+	query := `
+		SELECT * FROM schedules
+		WHERE user_id = $1 AND target_id = $2
+		  AND approval_status = $3 AND status IN ($4, $5)
+		  AND start_time <= $6 AND (end_time > $6 OR recurrence_rule IS NOT NULL)
+	`
+
+	var schedules []models.Schedule
+	err := r.db.SelectContext(ctx, &schedules, query, userID, targetID,
+		models.ApprovalStatusApproved, models.ScheduleStatusPending, models.ScheduleStatusActive, now)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check schedule window: %w", err)
+	}
+
+	var latest *time.Time
+	for i := range schedules {
+		if _, end, ok := schedules[i].WindowAt(now); ok && (latest == nil || end.After(*latest)) {
+			latest = &end
+		}
+	}
+
+	return latest, nil
+}
+
+// ListStarted retrieves the approved schedules that are pending or active and
+// have started by now, for their status to be brought in line with their windows
+func (r *ScheduleRepository) ListStarted(ctx context.Context, now time.Time) ([]models.Schedule, error) {
+	query := `
+		SELECT * FROM schedules
+		WHERE approval_status = $1 AND status IN ($2, $3) AND start_time <= $4
+		ORDER BY start_time ASC
+	`
+
+	var schedules []models.Schedule
+	err := r.db.SelectContext(ctx, &schedules, query,
+		models.ApprovalStatusApproved, models.ScheduleStatusPending, models.ScheduleStatusActive, now)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list started schedules: %w", err)
+	}
+
+	return schedules, nil
+}
+
+// TransitionStatus changes the status of a schedule if it is still from,
+// reporting whether it did. It is used by background jobs, so updated_by is
+// cleared.
+func (r *ScheduleRepository) TransitionStatus(ctx context.Context, id uuid.UUID, from, to models.ScheduleStatus) (bool, error) {
+	query := `
+		UPDATE schedules SET status = $1, updated_at = $2, updated_by = NULL, version = version + 1
+		WHERE id = $3 AND status = $4
+	`
+	result, err := r.db.ExecContext(ctx, query, to, time.Now(), id, from)
+	if err != nil {
+		return false, fmt.Errorf("failed to update schedule status: %w", err)
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("failed to get rows affected: %w", err)
+	}
+
+	return rows > 0, nil
+}
+
+// ListOverlapping retrieves the pending and approved schedules for a target
+// whose windows overlap start to end, with their users' emails. A nil end is
+// open-ended.
+func (r *ScheduleRepository) ListOverlapping(ctx context.Context, targetID uuid.UUID, start time.Time, end *time.Time) ([]*models.MaintenanceConflict, error) {
+	query := `
+		SELECT s.id AS schedule_id, s.user_id, u.email AS user_email, s.start_time, s.end_time, s.approval_status
+		FROM schedules s
+		JOIN users u ON s.user_id = u.id
+		WHERE s.target_id = $1
+		  AND s.approval_status IN ($2, $3) AND s.status IN ($4, $5)
+		  AND s.end_time > $6 AND ($7::timestamptz IS NULL OR s.start_time < $7)
+		ORDER BY s.start_time
+	`
+
+	var conflicts []*models.MaintenanceConflict
+	err := r.db.SelectContext(ctx, &conflicts, query, targetID,
+		models.ApprovalStatusPending, models.ApprovalStatusApproved,
+		models.ScheduleStatusPending, models.ScheduleStatusActive, start, end)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list overlapping schedules: %w", err)
+	}
+
+	return conflicts, nil
 }
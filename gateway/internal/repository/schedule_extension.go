@@ -0,0 +1,188 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/VanCannon/openpam/gateway/internal/actor"
+	"github.com/VanCannon/openpam/gateway/internal/database"
+	"github.com/VanCannon/openpam/gateway/internal/models"
+	"github.com/google/uuid"
+)
+
+var (
+	// ErrExtensionPending is returned when the schedule already has an extension waiting for a decision
+	ErrExtensionPending = errors.New("schedule already has a pending extension")
+
+	// ErrExtensionClosed is returned when an extension was already decided
+	ErrExtensionClosed = errors.New("schedule extension is no longer pending")
+
+	// ErrScheduleNotRunning is returned when extending a schedule that isn't
+	// approved or whose window has already ended
+	ErrScheduleNotRunning = errors.New("schedule is not running")
+)
+
+// ScheduleExtensionRepository handles schedule extension data operations
+type ScheduleExtensionRepository struct {
+	db *database.DB
+}
+
+// NewScheduleExtensionRepository creates a new schedule extension repository
+func NewScheduleExtensionRepository(db *database.DB) *ScheduleExtensionRepository {
+	return &ScheduleExtensionRepository{db: db}
+}
+
+// Create stores a new pending extension. ErrExtensionPending is returned if
+// the schedule already has one.
+func (r *ScheduleExtensionRepository) Create(ctx context.Context, ext *models.ScheduleExtension) error {
+	query := `
+		INSERT INTO schedule_extensions (id, schedule_id, requested_by, minutes, reason, status, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		ON CONFLICT DO NOTHING
+	`
+
+	ext.ID = uuid.New()
+	ext.Status = models.ExtensionStatusPending
+	ext.CreatedAt = time.Now()
+
+	result, err := r.db.ExecContext(ctx, query,
+		ext.ID, ext.ScheduleID, ext.RequestedBy, ext.Minutes, ext.Reason, ext.Status, ext.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to create schedule extension: %w", err)
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+	if rows == 0 {
+		return ErrExtensionPending
+	}
+
+	return nil
+}
+
+// GetByID retrieves a schedule extension by ID
+func (r *ScheduleExtensionRepository) GetByID(ctx context.Context, id uuid.UUID) (*models.ScheduleExtension, error) {
+	var ext models.ScheduleExtension
+	if err := r.db.GetContext(ctx, &ext, `SELECT * FROM schedule_extensions WHERE id = $1`, id); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("schedule extension not found")
+		}
+		return nil, fmt.Errorf("failed to get schedule extension: %w", err)
+	}
+	return &ext, nil
+}
+
+// ListBySchedule retrieves a schedule's extensions, oldest first
+func (r *ScheduleExtensionRepository) ListBySchedule(ctx context.Context, scheduleID uuid.UUID) ([]*models.ScheduleExtension, error) {
+	query := `SELECT * FROM schedule_extensions WHERE schedule_id = $1 ORDER BY created_at ASC`
+
+	var extensions []*models.ScheduleExtension
+	if err := r.db.SelectContext(ctx, &extensions, query, scheduleID); err != nil {
+		return nil, fmt.Errorf("failed to list schedule extensions: %w", err)
+	}
+	return extensions, nil
+}
+
+// ListPending retrieves the extensions waiting for a decision, oldest first
+func (r *ScheduleExtensionRepository) ListPending(ctx context.Context) ([]*models.ScheduleExtension, error) {
+	query := `SELECT * FROM schedule_extensions WHERE status = $1 ORDER BY created_at ASC`
+
+	var extensions []*models.ScheduleExtension
+	if err := r.db.SelectContext(ctx, &extensions, query, models.ExtensionStatusPending); err != nil {
+		return nil, fmt.Errorf("failed to list pending schedule extensions: %w", err)
+	}
+	return extensions, nil
+}
+
+// Approve approves a pending extension and moves the end of its schedule by
+// the extension's minutes, in one transaction. decidedBy is nil when the
+// extension is approved by policy. ErrExtensionClosed is returned if it was
+// decided first by someone else, and ErrScheduleNotRunning if the schedule's
+// window ended or it was cancelled meanwhile.
+func (r *ScheduleExtensionRepository) Approve(ctx context.Context, id uuid.UUID, decidedBy *uuid.UUID, now time.Time) (*models.ScheduleExtension, error) {
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	var ext models.ScheduleExtension
+	err = tx.GetContext(ctx, &ext, `SELECT * FROM schedule_extensions WHERE id = $1 AND status = $2 FOR UPDATE`,
+		id, models.ExtensionStatusPending)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, ErrExtensionClosed
+		}
+		return nil, fmt.Errorf("failed to get schedule extension: %w", err)
+	}
+
+	var previousEnd time.Time
+	err = tx.GetContext(ctx, &previousEnd, `
+		SELECT end_time FROM schedules
+		WHERE id = $1 AND approval_status = $2 AND status IN ($3, $4) AND end_time > $5
+		FOR UPDATE
+	`, ext.ScheduleID, models.ApprovalStatusApproved, models.ScheduleStatusPending, models.ScheduleStatusActive, now)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, ErrScheduleNotRunning
+		}
+		return nil, fmt.Errorf("failed to get schedule: %w", err)
+	}
+	newEnd := previousEnd.Add(time.Duration(ext.Minutes) * time.Minute)
+
+	_, err = tx.ExecContext(ctx, `
+		UPDATE schedules SET end_time = $1, updated_at = $2, updated_by = $3, version = version + 1
+		WHERE id = $4
+	`, newEnd, now, actor.UserID(ctx), ext.ScheduleID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to extend schedule: %w", err)
+	}
+
+	ext.Status = models.ExtensionStatusApproved
+	ext.AutoApproved = decidedBy == nil
+	ext.DecidedBy = decidedBy
+	ext.DecidedAt = &now
+	ext.PreviousEndTime = &previousEnd
+	ext.NewEndTime = &newEnd
+	_, err = tx.ExecContext(ctx, `
+		UPDATE schedule_extensions
+		SET status = $1, auto_approved = $2, decided_by = $3, decided_at = $4, previous_end_time = $5, new_end_time = $6
+		WHERE id = $7
+	`, ext.Status, ext.AutoApproved, ext.DecidedBy, ext.DecidedAt, ext.PreviousEndTime, ext.NewEndTime, ext.ID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to approve schedule extension: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return &ext, nil
+}
+
+// Reject rejects a pending extension. ErrExtensionClosed is returned if it
+// was decided first by someone else.
+func (r *ScheduleExtensionRepository) Reject(ctx context.Context, id uuid.UUID, decidedBy uuid.UUID, reason string, now time.Time) (*models.ScheduleExtension, error) {
+	query := `
+		UPDATE schedule_extensions
+		SET status = $1, decided_by = $2, decided_at = $3, rejection_reason = $4
+		WHERE id = $5 AND status = $6
+		RETURNING *
+	`
+
+	var ext models.ScheduleExtension
+	err := r.db.GetContext(ctx, &ext, query, models.ExtensionStatusRejected, decidedBy, now, reason, id, models.ExtensionStatusPending)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, ErrExtensionClosed
+		}
+		return nil, fmt.Errorf("failed to reject schedule extension: %w", err)
+	}
+
+	return &ext, nil
+}
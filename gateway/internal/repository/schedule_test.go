@@ -0,0 +1,33 @@
+package repository
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/VanCannon/openpam/gateway/internal/models"
+	"github.com/google/uuid"
+)
+
+func TestCheckApprovable(t *testing.T) {
+	requester, approver := uuid.New(), uuid.New()
+
+	tests := []struct {
+		name     string
+		status   string
+		approver uuid.UUID
+		want     error
+	}{
+		{"pending", models.ApprovalStatusPending, approver, nil},
+		{"requester approves", models.ApprovalStatusPending, requester, ErrSelfApproval},
+		{"already approved", models.ApprovalStatusApproved, approver, ErrNotPending},
+		{"already rejected", models.ApprovalStatusRejected, approver, ErrNotPending},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := checkApprovable(tt.status, requester, tt.approver); !errors.Is(err, tt.want) {
+				t.Errorf("checkApprovable() = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
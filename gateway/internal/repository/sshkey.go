@@ -0,0 +1,338 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/VanCannon/openpam/gateway/internal/database"
+	"github.com/VanCannon/openpam/gateway/internal/models"
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+)
+
+var (
+	// ErrSSHKeyExists is returned when the key is already tracked for the account
+	ErrSSHKeyExists = errors.New("key is already tracked for this account")
+
+	// ErrDriftResolved is returned when resolving drift that was already resolved
+	ErrDriftResolved = errors.New("drift is already resolved")
+)
+
+// SSHKeyRepository handles tracked SSH keys and the drift found from them
+type SSHKeyRepository struct {
+	db *database.DB
+}
+
+// NewSSHKeyRepository creates a new SSH key repository
+func NewSSHKeyRepository(db *database.DB) *SSHKeyRepository {
+	return &SSHKeyRepository{db: db}
+}
+
+const sshKeyColumns = `
+	k.id, k.target_id, t.name AS target_name, k.username, k.key_type, k.fingerprint, k.public_key,
+	k.source, k.credential_id, k.status, k.created_by, k.created_at, k.removed_at
+`
+
+const sshKeyDriftColumns = `
+	d.id, d.target_id, t.name AS target_name, d.username, d.kind, d.key_type, d.fingerprint,
+	d.public_key, d.comment,
+	d.ssh_key_id, d.scan_id, d.detected_at, d.resolved_at, d.resolution, d.resolved_by
+`
+
+// CreateKey starts tracking an active key.
+// ErrSSHKeyExists is returned if the account already has an active key with the same fingerprint.
+func (r *SSHKeyRepository) CreateKey(ctx context.Context, key *models.SSHKey) error {
+	return r.createKey(ctx, r.db, key)
+}
+
+func (r *SSHKeyRepository) createKey(ctx context.Context, db sqlx.ExecerContext, key *models.SSHKey) error {
+	query := `
+		INSERT INTO ssh_keys (
+			id, target_id, username, key_type, fingerprint, public_key, source, credential_id,
+			status, created_by, created_at
+		)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)
+		ON CONFLICT DO NOTHING
+	`
+
+	key.ID = uuid.New()
+	key.Status = models.SSHKeyActive
+	key.CreatedAt = time.Now()
+
+	result, err := db.ExecContext(ctx, query,
+		key.ID,
+		key.TargetID,
+		key.Username,
+		key.KeyType,
+		key.Fingerprint,
+		key.PublicKey,
+		key.Source,
+		key.CredentialID,
+		key.Status,
+		key.CreatedBy,
+		key.CreatedAt,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to create SSH key: %w", err)
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+	if rows == 0 {
+		return ErrSSHKeyExists
+	}
+
+	return nil
+}
+
+// ReplaceKey removes a key and starts tracking its replacement, atomically
+func (r *SSHKeyRepository) ReplaceKey(ctx context.Context, oldID uuid.UUID, key *models.SSHKey) error {
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if err := markKeyRemoved(ctx, tx, oldID); err != nil {
+		return err
+	}
+	if err := r.createKey(ctx, tx, key); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return nil
+}
+
+// RemoveKey stops tracking a key
+func (r *SSHKeyRepository) RemoveKey(ctx context.Context, id uuid.UUID) error {
+	return markKeyRemoved(ctx, r.db, id)
+}
+
+func markKeyRemoved(ctx context.Context, db sqlx.ExecerContext, id uuid.UUID) error {
+	_, err := db.ExecContext(ctx, `UPDATE ssh_keys SET status = 'removed', removed_at = NOW() WHERE id = $1`, id)
+	if err != nil {
+		return fmt.Errorf("failed to remove SSH key: %w", err)
+	}
+
+	return nil
+}
+
+// GetKey retrieves a tracked key by ID
+func (r *SSHKeyRepository) GetKey(ctx context.Context, id uuid.UUID) (*models.SSHKey, error) {
+	query := `
+		SELECT ` + sshKeyColumns + `
+		FROM ssh_keys k
+		JOIN targets t ON k.target_id = t.id
+		WHERE k.id = $1
+	`
+
+	var key models.SSHKey
+	err := r.db.GetContext(ctx, &key, query, id)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("SSH key not found")
+		}
+		return nil, fmt.Errorf("failed to get SSH key: %w", err)
+	}
+
+	return &key, nil
+}
+
+// SSHKeyFilter narrows the tracked keys listed
+type SSHKeyFilter struct {
+	TargetID       *uuid.UUID
+	Username       string
+	Source         string
+	IncludeRemoved bool
+}
+
+// ListKeys retrieves tracked keys by target and account, newest first
+func (r *SSHKeyRepository) ListKeys(ctx context.Context, filter SSHKeyFilter) ([]*models.SSHKey, error) {
+	query := `
+		SELECT ` + sshKeyColumns + `
+		FROM ssh_keys k
+		JOIN targets t ON k.target_id = t.id
+		WHERE t.deleted_at IS NULL
+	`
+	var args []interface{}
+
+	if filter.TargetID != nil {
+		args = append(args, *filter.TargetID)
+		query += fmt.Sprintf(" AND k.target_id = $%d", len(args))
+	}
+	if filter.Username != "" {
+		args = append(args, filter.Username)
+		query += fmt.Sprintf(" AND k.username = $%d", len(args))
+	}
+	if filter.Source != "" {
+		args = append(args, filter.Source)
+		query += fmt.Sprintf(" AND k.source = $%d", len(args))
+	}
+	if !filter.IncludeRemoved {
+		query += " AND k.status = 'active'"
+	}
+
+	query += " ORDER BY t.name, k.username, k.created_at DESC"
+
+	var keys []*models.SSHKey
+	err := r.db.SelectContext(ctx, &keys, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list SSH keys: %w", err)
+	}
+
+	return keys, nil
+}
+
+// ListActiveKeys retrieves the keys tracked on a target
+func (r *SSHKeyRepository) ListActiveKeys(ctx context.Context, targetID uuid.UUID) ([]*models.SSHKey, error) {
+	return r.ListKeys(ctx, SSHKeyFilter{TargetID: &targetID})
+}
+
+// OpenDrift records drift found by a scan. Drift that is already open is
+// attributed to the new scan instead; only newly found drift returns true.
+func (r *SSHKeyRepository) OpenDrift(ctx context.Context, drift *models.SSHKeyDrift) (bool, error) {
+	query := `
+		INSERT INTO ssh_key_drift (
+			id, target_id, username, kind, key_type, fingerprint, public_key, comment, ssh_key_id,
+			scan_id, detected_at
+		)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)
+		ON CONFLICT (target_id, username, fingerprint, kind) WHERE resolved_at IS NULL
+		DO UPDATE SET scan_id = EXCLUDED.scan_id
+		RETURNING id, detected_at, (xmax = 0) AS inserted
+	`
+
+	var row struct {
+		ID         uuid.UUID `db:"id"`
+		DetectedAt time.Time `db:"detected_at"`
+		Inserted   bool      `db:"inserted"`
+	}
+	err := r.db.GetContext(ctx, &row, query,
+		uuid.New(),
+		drift.TargetID,
+		drift.Username,
+		drift.Kind,
+		drift.KeyType,
+		drift.Fingerprint,
+		drift.PublicKey,
+		drift.Comment,
+		drift.SSHKeyID,
+		drift.ScanID,
+		time.Now(),
+	)
+	if err != nil {
+		return false, fmt.Errorf("failed to record SSH key drift: %w", err)
+	}
+
+	drift.ID = row.ID
+	drift.DetectedAt = row.DetectedAt
+	return row.Inserted, nil
+}
+
+// ClearDrift resolves the target's open drift that the scan no longer found,
+// except for accounts whose keys the scan couldn't read
+func (r *SSHKeyRepository) ClearDrift(ctx context.Context, targetID, scanID uuid.UUID, unread []string) (int64, error) {
+	query := `
+		UPDATE ssh_key_drift
+		SET resolved_at = NOW(), resolution = 'cleared'
+		WHERE target_id = $1 AND resolved_at IS NULL
+			AND scan_id IS DISTINCT FROM $2 AND NOT (username = ANY($3))
+	`
+
+	if unread == nil {
+		unread = []string{}
+	}
+	result, err := r.db.ExecContext(ctx, query, targetID, scanID, pq.StringArray(unread))
+	if err != nil {
+		return 0, fmt.Errorf("failed to clear SSH key drift: %w", err)
+	}
+
+	return result.RowsAffected()
+}
+
+// GetDrift retrieves drift by ID
+func (r *SSHKeyRepository) GetDrift(ctx context.Context, id uuid.UUID) (*models.SSHKeyDrift, error) {
+	query := `
+		SELECT ` + sshKeyDriftColumns + `
+		FROM ssh_key_drift d
+		JOIN targets t ON d.target_id = t.id
+		WHERE d.id = $1
+	`
+
+	var drift models.SSHKeyDrift
+	err := r.db.GetContext(ctx, &drift, query, id)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("SSH key drift not found")
+		}
+		return nil, fmt.Errorf("failed to get SSH key drift: %w", err)
+	}
+
+	return &drift, nil
+}
+
+// ListDrift retrieves drift, newest first. Only open drift is listed unless
+// includeResolved is set.
+func (r *SSHKeyRepository) ListDrift(ctx context.Context, targetID *uuid.UUID, includeResolved bool, limit int) ([]*models.SSHKeyDrift, error) {
+	query := `
+		SELECT ` + sshKeyDriftColumns + `
+		FROM ssh_key_drift d
+		JOIN targets t ON d.target_id = t.id
+		WHERE t.deleted_at IS NULL
+	`
+	var args []interface{}
+
+	if targetID != nil {
+		args = append(args, *targetID)
+		query += fmt.Sprintf(" AND d.target_id = $%d", len(args))
+	}
+	if !includeResolved {
+		query += " AND d.resolved_at IS NULL"
+	}
+
+	args = append(args, limit)
+	query += fmt.Sprintf(" ORDER BY d.detected_at DESC LIMIT $%d", len(args))
+
+	var drift []*models.SSHKeyDrift
+	err := r.db.SelectContext(ctx, &drift, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list SSH key drift: %w", err)
+	}
+
+	return drift, nil
+}
+
+// ResolveDrift closes open drift.
+// ErrDriftResolved is returned if it was already resolved.
+func (r *SSHKeyRepository) ResolveDrift(ctx context.Context, id uuid.UUID, resolution string, resolvedBy *uuid.UUID) error {
+	query := `
+		UPDATE ssh_key_drift
+		SET resolved_at = NOW(), resolution = $1, resolved_by = $2
+		WHERE id = $3 AND resolved_at IS NULL
+	`
+
+	result, err := r.db.ExecContext(ctx, query, resolution, resolvedBy, id)
+	if err != nil {
+		return fmt.Errorf("failed to resolve SSH key drift: %w", err)
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+	if rows == 0 {
+		return ErrDriftResolved
+	}
+
+	return nil
+}
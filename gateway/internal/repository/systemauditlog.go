@@ -7,6 +7,7 @@ import (
 	"time"
 
 	"github.com/VanCannon/openpam/gateway/internal/database"
+	"github.com/VanCannon/openpam/gateway/internal/elevation"
 	"github.com/VanCannon/openpam/gateway/internal/models"
 	"github.com/google/uuid"
 )
@@ -21,21 +22,31 @@ func NewSystemAuditLogRepository(db *database.DB) *SystemAuditLogRepository {
 	return &SystemAuditLogRepository{db: db}
 }
 
-// Create creates a new system audit log entry
+// Create creates a new system audit log entry and records a matching "system." event
 func (r *SystemAuditLogRepository) Create(ctx context.Context, log *models.SystemAuditLog) error {
 	query := `
 		INSERT INTO system_audit_logs (
 			id, timestamp, event_type, user_id, target_user_id, resource_type,
-			resource_id, resource_name, action, status, ip_address, user_agent, details, created_at
+			resource_id, resource_name, action, status, ip_address, user_agent, details, elevation_id, created_at
 		)
-		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15)
 	`
 
 	log.ID = uuid.New()
 	log.Timestamp = time.Now()
 	log.CreatedAt = time.Now()
+	// Tag events caused by a user acting under an elevated role
+	if !log.ElevationID.Valid {
+		log.ElevationID = elevation.IDFromContext(ctx)
+	}
+
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
 
-	_, err := r.db.ExecContext(ctx, query,
+	_, err = tx.ExecContext(ctx, query,
 		log.ID,
 		log.Timestamp,
 		log.EventType,
@@ -49,6 +60,7 @@ func (r *SystemAuditLogRepository) Create(ctx context.Context, log *models.Syste
 		log.IPAddress,
 		log.UserAgent,
 		log.Details,
+		log.ElevationID,
 		log.CreatedAt,
 	)
 
@@ -56,6 +68,14 @@ func (r *SystemAuditLogRepository) Create(ctx context.Context, log *models.Syste
 		return fmt.Errorf("failed to create system audit log: %w", err)
 	}
 
+	if err := appendEvent(ctx, tx, models.StreamEventSystemPrefix+log.EventType, log); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
 	return nil
 }
 
@@ -95,7 +115,7 @@ func (r *SystemAuditLogRepository) CreateSimple(
 func (r *SystemAuditLogRepository) List(ctx context.Context, limit, offset int) ([]*models.SystemAuditLog, error) {
 	query := `
 		SELECT id, timestamp, event_type, user_id, target_user_id, resource_type,
-		       resource_id, resource_name, action, status, ip_address, user_agent, details, created_at
+		       resource_id, resource_name, action, status, ip_address, user_agent, details, elevation_id, created_at
 		FROM system_audit_logs
 		ORDER BY timestamp DESC
 		LIMIT $1 OFFSET $2
@@ -114,7 +134,7 @@ func (r *SystemAuditLogRepository) List(ctx context.Context, limit, offset int)
 func (r *SystemAuditLogRepository) ListByUser(ctx context.Context, userID uuid.UUID, limit, offset int) ([]*models.SystemAuditLog, error) {
 	query := `
 		SELECT id, timestamp, event_type, user_id, target_user_id, resource_type,
-		       resource_id, resource_name, action, status, ip_address, user_agent, details, created_at
+		       resource_id, resource_name, action, status, ip_address, user_agent, details, elevation_id, created_at
 		FROM system_audit_logs
 		WHERE user_id = $1 OR target_user_id = $1
 		ORDER BY timestamp DESC
@@ -134,7 +154,7 @@ func (r *SystemAuditLogRepository) ListByUser(ctx context.Context, userID uuid.U
 func (r *SystemAuditLogRepository) ListByEventType(ctx context.Context, eventType string, limit, offset int) ([]*models.SystemAuditLog, error) {
 	query := `
 		SELECT id, timestamp, event_type, user_id, target_user_id, resource_type,
-		       resource_id, resource_name, action, status, ip_address, user_agent, details, created_at
+		       resource_id, resource_name, action, status, ip_address, user_agent, details, elevation_id, created_at
 		FROM system_audit_logs
 		WHERE event_type = $1
 		ORDER BY timestamp DESC
@@ -154,7 +174,7 @@ func (r *SystemAuditLogRepository) ListByEventType(ctx context.Context, eventTyp
 func (r *SystemAuditLogRepository) ListByResource(ctx context.Context, resourceType string, resourceID uuid.UUID, limit, offset int) ([]*models.SystemAuditLog, error) {
 	query := `
 		SELECT id, timestamp, event_type, user_id, target_user_id, resource_type,
-		       resource_id, resource_name, action, status, ip_address, user_agent, details, created_at
+		       resource_id, resource_name, action, status, ip_address, user_agent, details, elevation_id, created_at
 		FROM system_audit_logs
 		WHERE resource_type = $1 AND resource_id = $2
 		ORDER BY timestamp DESC
@@ -170,11 +190,31 @@ func (r *SystemAuditLogRepository) ListByResource(ctx context.Context, resourceT
 	return logs, nil
 }
 
+// ListByElevation retrieves the system audit logs recorded under a role elevation
+func (r *SystemAuditLogRepository) ListByElevation(ctx context.Context, elevationID uuid.UUID, limit, offset int) ([]*models.SystemAuditLog, error) {
+	query := `
+		SELECT id, timestamp, event_type, user_id, target_user_id, resource_type,
+		       resource_id, resource_name, action, status, ip_address, user_agent, details, elevation_id, created_at
+		FROM system_audit_logs
+		WHERE elevation_id = $1
+		ORDER BY timestamp DESC
+		LIMIT $2 OFFSET $3
+	`
+
+	var logs []*models.SystemAuditLog
+	err := r.db.SelectContext(ctx, &logs, query, elevationID, limit, offset)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list system audit logs by elevation: %w", err)
+	}
+
+	return logs, nil
+}
+
 // GetByID retrieves a system audit log by ID
 func (r *SystemAuditLogRepository) GetByID(ctx context.Context, id uuid.UUID) (*models.SystemAuditLog, error) {
 	query := `
 		SELECT id, timestamp, event_type, user_id, target_user_id, resource_type,
-		       resource_id, resource_name, action, status, ip_address, user_agent, details, created_at
+		       resource_id, resource_name, action, status, ip_address, user_agent, details, elevation_id, created_at
 		FROM system_audit_logs
 		WHERE id = $1
 	`
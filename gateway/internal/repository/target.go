@@ -6,11 +6,18 @@ import (
 	"fmt"
 	"time"
 
+	"github.com/VanCannon/openpam/gateway/internal/actor"
 	"github.com/VanCannon/openpam/gateway/internal/database"
 	"github.com/VanCannon/openpam/gateway/internal/models"
 	"github.com/google/uuid"
+	"github.com/lib/pq"
 )
 
+// targetColumns are the columns a target is read from
+const targetColumns = `id, zone_id, name, hostname, protocol, port, owner_team, environment, compliance_scope, labels,
+		       connection_notes, enabled, keepalive_interval, ephemeral, expires_at, settings, rdp_settings,
+		       maintenance_start, maintenance_end, maintenance_reason, maintenance_by, deleted_at, version, created_at, updated_at, risk_tier`
+
 // TargetRepository handles target data operations
 type TargetRepository struct {
 	db *database.DB
@@ -24,11 +31,17 @@ func NewTargetRepository(db *database.DB) *TargetRepository {
 // Create creates a new target
 func (r *TargetRepository) Create(ctx context.Context, target *models.Target) error {
 	query := `
-		INSERT INTO targets (id, zone_id, name, hostname, protocol, port, description, enabled, created_at, updated_at)
-		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+		INSERT INTO targets (id, zone_id, name, hostname, protocol, port, owner_team, environment, compliance_scope, labels,
+		                     connection_notes, enabled, keepalive_interval, ephemeral, expires_at, settings, rdp_settings, created_at, updated_at,
+		                     created_by, updated_by, risk_tier)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, $18, $19, $20, $20, $21)
 	`
 
+	if target.ComplianceScope == nil {
+		target.ComplianceScope = pq.StringArray{}
+	}
 	target.ID = uuid.New()
+	target.Version = 1
 	target.CreatedAt = time.Now()
 	target.UpdatedAt = time.Now()
 
@@ -39,10 +52,21 @@ func (r *TargetRepository) Create(ctx context.Context, target *models.Target) er
 		target.Hostname,
 		target.Protocol,
 		target.Port,
-		target.Description,
+		target.OwnerTeam,
+		target.Environment,
+		target.ComplianceScope,
+		target.Labels,
+		target.ConnectionNotes,
 		target.Enabled,
+		target.KeepaliveInterval,
+		target.Ephemeral,
+		target.ExpiresAt,
+		target.Settings,
+		target.RDP,
 		target.CreatedAt,
 		target.UpdatedAt,
+		actor.UserID(ctx),
+		target.RiskTier,
 	)
 
 	if err != nil {
@@ -55,9 +79,9 @@ func (r *TargetRepository) Create(ctx context.Context, target *models.Target) er
 // GetByID retrieves a target by ID
 func (r *TargetRepository) GetByID(ctx context.Context, id uuid.UUID) (*models.Target, error) {
 	query := `
-		SELECT id, zone_id, name, hostname, protocol, port, description, enabled, created_at, updated_at
+		SELECT ` + targetColumns + `
 		FROM targets
-		WHERE id = $1
+		WHERE id = $1 AND deleted_at IS NULL
 	`
 
 	var target models.Target
@@ -72,18 +96,68 @@ func (r *TargetRepository) GetByID(ctx context.Context, id uuid.UUID) (*models.T
 	return &target, nil
 }
 
+// TargetFilter narrows Search. Labels maps label keys to the value they
+// must have, or to "" for any value.
+type TargetFilter struct {
+	ZoneID          *uuid.UUID
+	OwnerTeam       string
+	Environment     string
+	ComplianceScope string
+	Labels          map[string]string
+	Search          string // Matched case-insensitively in the name, hostname and connection notes
+	Limit           int
+	Offset          int
+}
+
 // List retrieves all enabled targets with pagination
 func (r *TargetRepository) List(ctx context.Context, limit, offset int) ([]*models.Target, error) {
+	return r.Search(ctx, TargetFilter{Limit: limit, Offset: offset})
+}
+
+// Search retrieves the enabled targets matching filter, by name
+func (r *TargetRepository) Search(ctx context.Context, filter TargetFilter) ([]*models.Target, error) {
 	query := `
-		SELECT id, zone_id, name, hostname, protocol, port, description, enabled, created_at, updated_at
+		SELECT ` + targetColumns + `
 		FROM targets
-		WHERE enabled = true
-		ORDER BY name ASC
-		LIMIT $1 OFFSET $2
+		WHERE enabled = true AND deleted_at IS NULL
 	`
+	var args []interface{}
+
+	if filter.ZoneID != nil {
+		args = append(args, *filter.ZoneID)
+		query += fmt.Sprintf(" AND zone_id = $%d", len(args))
+	}
+	if filter.OwnerTeam != "" {
+		args = append(args, filter.OwnerTeam)
+		query += fmt.Sprintf(" AND owner_team = $%d", len(args))
+	}
+	if filter.Environment != "" {
+		args = append(args, filter.Environment)
+		query += fmt.Sprintf(" AND environment = $%d", len(args))
+	}
+	if filter.ComplianceScope != "" {
+		args = append(args, pq.StringArray{filter.ComplianceScope})
+		query += fmt.Sprintf(" AND compliance_scope @> $%d", len(args))
+	}
+	for _, key := range models.Labels(filter.Labels).Keys() {
+		if value := filter.Labels[key]; value != "" {
+			args = append(args, models.Labels{key: value})
+			query += fmt.Sprintf(" AND labels @> $%d", len(args))
+		} else {
+			args = append(args, key)
+			query += fmt.Sprintf(" AND labels ? $%d", len(args))
+		}
+	}
+	if filter.Search != "" {
+		args = append(args, "%"+filter.Search+"%")
+		query += fmt.Sprintf(" AND (name ILIKE $%d OR hostname ILIKE $%d OR connection_notes ILIKE $%d)", len(args), len(args), len(args))
+	}
+
+	args = append(args, filter.Limit, filter.Offset)
+	query += fmt.Sprintf(" ORDER BY name ASC LIMIT $%d OFFSET $%d", len(args)-1, len(args))
 
 	var targets []*models.Target
-	err := r.db.SelectContext(ctx, &targets, query, limit, offset)
+	err := r.db.SelectContext(ctx, &targets, query, args...)
 	if err != nil {
 		return nil, fmt.Errorf("failed to list targets: %w", err)
 	}
@@ -94,9 +168,9 @@ func (r *TargetRepository) List(ctx context.Context, limit, offset int) ([]*mode
 // ListByZone retrieves targets for a specific zone
 func (r *TargetRepository) ListByZone(ctx context.Context, zoneID uuid.UUID) ([]*models.Target, error) {
 	query := `
-		SELECT id, zone_id, name, hostname, protocol, port, description, enabled, created_at, updated_at
+		SELECT ` + targetColumns + `
 		FROM targets
-		WHERE zone_id = $1 AND enabled = true
+		WHERE zone_id = $1 AND enabled = true AND deleted_at IS NULL
 		ORDER BY name ASC
 	`
 
@@ -109,15 +183,64 @@ func (r *TargetRepository) ListByZone(ctx context.Context, zoneID uuid.UUID) ([]
 	return targets, nil
 }
 
-// Update updates a target
+// ListByIDs retrieves the targets with the given IDs, enabled or not
+func (r *TargetRepository) ListByIDs(ctx context.Context, ids []uuid.UUID) ([]*models.Target, error) {
+	query := `
+		SELECT ` + targetColumns + `
+		FROM targets
+		WHERE id = ANY($1::uuid[]) AND deleted_at IS NULL
+	`
+
+	var targets []*models.Target
+	err := r.db.SelectContext(ctx, &targets, query, uuidArray(ids))
+	if err != nil {
+		return nil, fmt.Errorf("failed to list targets by ID: %w", err)
+	}
+
+	return targets, nil
+}
+
+// ListByZones retrieves the targets of the given zones
+func (r *TargetRepository) ListByZones(ctx context.Context, zoneIDs []uuid.UUID) ([]*models.Target, error) {
+	query := `
+		SELECT ` + targetColumns + `
+		FROM targets
+		WHERE zone_id = ANY($1::uuid[]) AND enabled = true AND deleted_at IS NULL
+		ORDER BY name ASC
+	`
+
+	var targets []*models.Target
+	err := r.db.SelectContext(ctx, &targets, query, uuidArray(zoneIDs))
+	if err != nil {
+		return nil, fmt.Errorf("failed to list targets by zones: %w", err)
+	}
+
+	return targets, nil
+}
+
+// Update updates a target if it is still at target.Version, and advances the version.
+// ErrVersionConflict is returned when someone else updated the target first, and
+// ErrOutsideZones when a zone admin moves a target out of or into another zone.
 func (r *TargetRepository) Update(ctx context.Context, target *models.Target) error {
+	if err := checkZone(ctx, r.db, targetZoneQuery, target.ID); err != nil {
+		return err
+	}
+	if !actor.ManagesZone(ctx, target.ZoneID) {
+		return ErrOutsideZones
+	}
+
 	query := `
 		UPDATE targets
 		SET zone_id = $1, name = $2, hostname = $3, protocol = $4, port = $5,
-		    description = $6, enabled = $7, updated_at = $8
-		WHERE id = $9
+		    owner_team = $6, environment = $7, compliance_scope = $8, labels = $9, connection_notes = $10,
+		    enabled = $11, keepalive_interval = $12, expires_at = $13, settings = $14, rdp_settings = $15,
+		    updated_at = $16, updated_by = $19, risk_tier = $20, version = version + 1
+		WHERE id = $17 AND version = $18 AND deleted_at IS NULL
 	`
 
+	if target.ComplianceScope == nil {
+		target.ComplianceScope = pq.StringArray{}
+	}
 	target.UpdatedAt = time.Now()
 
 	result, err := r.db.ExecContext(ctx, query,
@@ -126,10 +249,21 @@ func (r *TargetRepository) Update(ctx context.Context, target *models.Target) er
 		target.Hostname,
 		target.Protocol,
 		target.Port,
-		target.Description,
+		target.OwnerTeam,
+		target.Environment,
+		target.ComplianceScope,
+		target.Labels,
+		target.ConnectionNotes,
 		target.Enabled,
+		target.KeepaliveInterval,
+		target.ExpiresAt,
+		target.Settings,
+		target.RDP,
 		target.UpdatedAt,
 		target.ID,
+		target.Version,
+		actor.UserID(ctx),
+		target.RiskTier,
 	)
 
 	if err != nil {
@@ -142,17 +276,80 @@ func (r *TargetRepository) Update(ctx context.Context, target *models.Target) er
 	}
 
 	if rows == 0 {
-		return fmt.Errorf("target not found")
+		return versionMiss(ctx, r.db, "targets", " AND deleted_at IS NULL", target.ID, fmt.Errorf("target not found"))
 	}
 
+	target.Version++
 	return nil
 }
 
-// Delete deletes a target
+// SetMaintenance sets a target's maintenance window, or clears it when start
+// is nil, and advances the target's version
+func (r *TargetRepository) SetMaintenance(ctx context.Context, target *models.Target) error {
+	query := `
+		UPDATE targets
+		SET maintenance_start = $1, maintenance_end = $2, maintenance_reason = $3, maintenance_by = $4,
+		    updated_at = $5, updated_by = $7, version = version + 1
+		WHERE id = $6 AND deleted_at IS NULL
+		RETURNING version
+	`
+
+	if target.MaintenanceStart == nil {
+		target.MaintenanceEnd = nil
+		target.MaintenanceReason = nil
+		target.MaintenanceBy = nil
+	}
+	target.UpdatedAt = time.Now()
+
+	err := r.db.GetContext(ctx, &target.Version, query,
+		target.MaintenanceStart,
+		target.MaintenanceEnd,
+		target.MaintenanceReason,
+		target.MaintenanceBy,
+		target.UpdatedAt,
+		target.ID,
+		actor.UserID(ctx),
+	)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return fmt.Errorf("target not found")
+		}
+		return fmt.Errorf("failed to set target maintenance: %w", err)
+	}
+
+	return nil
+}
+
+// ListMaintenance retrieves the targets whose maintenance windows overlap from
+// to to, soonest first
+func (r *TargetRepository) ListMaintenance(ctx context.Context, from, to time.Time) ([]*models.Target, error) {
+	query := `
+		SELECT ` + targetColumns + `
+		FROM targets
+		WHERE deleted_at IS NULL AND maintenance_start IS NOT NULL
+		  AND maintenance_start < $2 AND (maintenance_end IS NULL OR maintenance_end > $1)
+		ORDER BY maintenance_start ASC, name ASC
+	`
+
+	var targets []*models.Target
+	err := r.db.SelectContext(ctx, &targets, query, from, to)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list target maintenance: %w", err)
+	}
+
+	return targets, nil
+}
+
+// Delete soft-deletes a target. The row is kept so audit logs that reference it
+// remain intact, but it is disabled and no longer returned by any lookup.
 func (r *TargetRepository) Delete(ctx context.Context, id uuid.UUID) error {
-	query := `DELETE FROM targets WHERE id = $1`
+	if err := checkZone(ctx, r.db, targetZoneQuery, id); err != nil {
+		return err
+	}
+
+	query := `UPDATE targets SET enabled = false, deleted_at = $1, updated_at = $1, updated_by = $3 WHERE id = $2 AND deleted_at IS NULL`
 
-	result, err := r.db.ExecContext(ctx, query, id)
+	result, err := r.db.ExecContext(ctx, query, time.Now(), id, actor.UserID(ctx))
 	if err != nil {
 		return fmt.Errorf("failed to delete target: %w", err)
 	}
@@ -168,3 +365,47 @@ func (r *TargetRepository) Delete(ctx context.Context, id uuid.UUID) error {
 
 	return nil
 }
+
+// DisableExpired disables ephemeral targets whose expiry time has passed
+// and returns how many were disabled
+func (r *TargetRepository) DisableExpired(ctx context.Context, now time.Time) (int64, error) {
+	query := `
+		UPDATE targets
+		SET enabled = false, updated_at = $1, updated_by = NULL
+		WHERE ephemeral = true AND enabled = true AND deleted_at IS NULL AND expires_at <= $1
+	`
+
+	result, err := r.db.ExecContext(ctx, query, now)
+	if err != nil {
+		return 0, fmt.Errorf("failed to disable expired targets: %w", err)
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("failed to get rows affected: %w", err)
+	}
+
+	return rows, nil
+}
+
+// DeleteExpired soft-deletes ephemeral targets that expired before the cutoff
+// and returns how many were deleted
+func (r *TargetRepository) DeleteExpired(ctx context.Context, cutoff time.Time) (int64, error) {
+	query := `
+		UPDATE targets
+		SET enabled = false, deleted_at = NOW(), updated_at = NOW(), updated_by = NULL
+		WHERE ephemeral = true AND deleted_at IS NULL AND expires_at <= $1
+	`
+
+	result, err := r.db.ExecContext(ctx, query, cutoff)
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete expired targets: %w", err)
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("failed to get rows affected: %w", err)
+	}
+
+	return rows, nil
+}
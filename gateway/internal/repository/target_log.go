@@ -0,0 +1,78 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/VanCannon/openpam/gateway/internal/database"
+	"github.com/VanCannon/openpam/gateway/internal/models"
+	"github.com/google/uuid"
+)
+
+// TargetLogRepository handles the target log lines attached to sessions
+type TargetLogRepository struct {
+	db *database.DB
+}
+
+// NewTargetLogRepository creates a new target log repository
+func NewTargetLogRepository(db *database.DB) *TargetLogRepository {
+	return &TargetLogRepository{db: db}
+}
+
+// CreateBatch stores matched lines together
+func (r *TargetLogRepository) CreateBatch(ctx context.Context, logs []*models.SessionTargetLog) error {
+	if len(logs) == 0 {
+		return nil
+	}
+
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	for _, l := range logs {
+		l.ID = uuid.New()
+
+		_, err := tx.ExecContext(ctx, `
+			INSERT INTO session_target_logs (id, audit_log_id, host, program, message, logged_at, received_at, matched_by)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		`,
+			l.ID,
+			l.AuditLogID,
+			l.Host,
+			l.Program,
+			l.Message,
+			l.LoggedAt,
+			l.ReceivedAt,
+			l.MatchedBy,
+		)
+		if err != nil {
+			return fmt.Errorf("failed to create target log: %w", err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return nil
+}
+
+// ListBySession retrieves the target log lines of a session in the order they were logged
+func (r *TargetLogRepository) ListBySession(ctx context.Context, auditLogID uuid.UUID) ([]*models.SessionTargetLog, error) {
+	query := `
+		SELECT id, audit_log_id, host, program, message, logged_at, received_at, matched_by
+		FROM session_target_logs
+		WHERE audit_log_id = $1
+		ORDER BY logged_at, received_at
+	`
+
+	var logs []*models.SessionTargetLog
+	err := r.db.SelectContext(ctx, &logs, query, auditLogID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list target logs: %w", err)
+	}
+
+	return logs, nil
+}
@@ -0,0 +1,261 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/VanCannon/openpam/gateway/internal/actor"
+	"github.com/VanCannon/openpam/gateway/internal/database"
+	"github.com/VanCannon/openpam/gateway/internal/models"
+	"github.com/google/uuid"
+)
+
+// TaskRepository handles privileged tasks and their executions
+type TaskRepository struct {
+	db *database.DB
+}
+
+// NewTaskRepository creates a new task repository
+func NewTaskRepository(db *database.DB) *TaskRepository {
+	return &TaskRepository{db: db}
+}
+
+const taskColumns = `
+	id, name, description, target_id, credential_id, command_template, parameters,
+	timeout_seconds, require_schedule, enabled, created_by, version, created_at, updated_at
+`
+
+const taskExecutionColumns = `
+	id, task_id, task_name, user_id, target_id, credential_id, parameters, command, status,
+	exit_code, output, output_truncated, error_message, client_ip, started_at, finished_at
+`
+
+// Create creates a new task
+func (r *TaskRepository) Create(ctx context.Context, task *models.Task) error {
+	query := `
+		INSERT INTO tasks (` + taskColumns + `, updated_by)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $11)
+	`
+
+	task.ID = uuid.New()
+	if task.CreatedBy == nil {
+		task.CreatedBy = actor.UserID(ctx)
+	}
+	task.Version = 1
+	task.CreatedAt = time.Now()
+	task.UpdatedAt = task.CreatedAt
+
+	_, err := r.db.ExecContext(ctx, query,
+		task.ID,
+		task.Name,
+		task.Description,
+		task.TargetID,
+		task.CredentialID,
+		task.CommandTemplate,
+		task.Parameters,
+		task.TimeoutSeconds,
+		task.RequireSchedule,
+		task.Enabled,
+		task.CreatedBy,
+		task.Version,
+		task.CreatedAt,
+		task.UpdatedAt,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to create task: %w", err)
+	}
+
+	return nil
+}
+
+// GetByID retrieves a task by ID
+func (r *TaskRepository) GetByID(ctx context.Context, id uuid.UUID) (*models.Task, error) {
+	query := `SELECT ` + taskColumns + ` FROM tasks WHERE id = $1`
+
+	var task models.Task
+	err := r.db.GetContext(ctx, &task, query, id)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("task not found")
+		}
+		return nil, fmt.Errorf("failed to get task: %w", err)
+	}
+
+	return &task, nil
+}
+
+// List retrieves tasks ordered by name, optionally only the enabled ones
+func (r *TaskRepository) List(ctx context.Context, enabledOnly bool) ([]*models.Task, error) {
+	query := `SELECT ` + taskColumns + ` FROM tasks WHERE enabled OR NOT $1 ORDER BY name ASC`
+
+	var tasks []*models.Task
+	err := r.db.SelectContext(ctx, &tasks, query, enabledOnly)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list tasks: %w", err)
+	}
+
+	return tasks, nil
+}
+
+// Update updates a task if it is still at the version the caller read
+func (r *TaskRepository) Update(ctx context.Context, task *models.Task) error {
+	query := `
+		UPDATE tasks
+		SET name = $1, description = $2, target_id = $3, credential_id = $4, command_template = $5,
+		    parameters = $6, timeout_seconds = $7, require_schedule = $8, enabled = $9,
+		    updated_at = $10, updated_by = $13, version = version + 1
+		WHERE id = $11 AND version = $12
+	`
+
+	task.UpdatedAt = time.Now()
+
+	result, err := r.db.ExecContext(ctx, query,
+		task.Name,
+		task.Description,
+		task.TargetID,
+		task.CredentialID,
+		task.CommandTemplate,
+		task.Parameters,
+		task.TimeoutSeconds,
+		task.RequireSchedule,
+		task.Enabled,
+		task.UpdatedAt,
+		task.ID,
+		task.Version,
+		actor.UserID(ctx),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to update task: %w", err)
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+
+	if rows == 0 {
+		return versionMiss(ctx, r.db, "tasks", "", task.ID, fmt.Errorf("task not found"))
+	}
+
+	task.Version++
+	return nil
+}
+
+// Delete deletes a task. Its executions are kept.
+func (r *TaskRepository) Delete(ctx context.Context, id uuid.UUID) error {
+	query := `DELETE FROM tasks WHERE id = $1`
+
+	result, err := r.db.ExecContext(ctx, query, id)
+	if err != nil {
+		return fmt.Errorf("failed to delete task: %w", err)
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+
+	if rows == 0 {
+		return fmt.Errorf("task not found")
+	}
+
+	return nil
+}
+
+// CreateExecution records the start of a task execution
+func (r *TaskRepository) CreateExecution(ctx context.Context, exec *models.TaskExecution) error {
+	query := `
+		INSERT INTO task_executions (
+			id, task_id, task_name, user_id, target_id, credential_id, parameters, command,
+			status, client_ip, started_at
+		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)
+	`
+
+	exec.ID = uuid.New()
+	exec.StartedAt = time.Now()
+
+	_, err := r.db.ExecContext(ctx, query,
+		exec.ID,
+		exec.TaskID,
+		exec.TaskName,
+		exec.UserID,
+		exec.TargetID,
+		exec.CredentialID,
+		exec.Parameters,
+		exec.Command,
+		exec.Status,
+		exec.ClientIP,
+		exec.StartedAt,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to create task execution: %w", err)
+	}
+
+	return nil
+}
+
+// FinishExecution records the outcome of a task execution
+func (r *TaskRepository) FinishExecution(ctx context.Context, exec *models.TaskExecution) error {
+	query := `
+		UPDATE task_executions
+		SET status = $1, exit_code = $2, output = $3, output_truncated = $4, error_message = $5, finished_at = $6
+		WHERE id = $7
+	`
+
+	now := time.Now()
+	exec.FinishedAt = &now
+
+	_, err := r.db.ExecContext(ctx, query,
+		exec.Status,
+		exec.ExitCode,
+		exec.Output,
+		exec.OutputTruncated,
+		exec.ErrorMessage,
+		exec.FinishedAt,
+		exec.ID,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to finish task execution: %w", err)
+	}
+
+	return nil
+}
+
+// GetExecution retrieves a task execution by ID
+func (r *TaskRepository) GetExecution(ctx context.Context, id uuid.UUID) (*models.TaskExecution, error) {
+	query := `SELECT ` + taskExecutionColumns + ` FROM task_executions WHERE id = $1`
+
+	var exec models.TaskExecution
+	err := r.db.GetContext(ctx, &exec, query, id)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("task execution not found")
+		}
+		return nil, fmt.Errorf("failed to get task execution: %w", err)
+	}
+
+	return &exec, nil
+}
+
+// ListExecutions retrieves executions, newest first, optionally of one task or
+// one user. The output is left out; it is returned by GetExecution.
+func (r *TaskRepository) ListExecutions(ctx context.Context, taskID, userID *uuid.UUID, limit, offset int) ([]*models.TaskExecution, error) {
+	query := `
+		SELECT id, task_id, task_name, user_id, target_id, credential_id, parameters, command, status,
+		       exit_code, '' AS output, output_truncated, error_message, client_ip, started_at, finished_at
+		FROM task_executions
+		WHERE ($1::uuid IS NULL OR task_id = $1) AND ($2::uuid IS NULL OR user_id = $2)
+		ORDER BY started_at DESC
+		LIMIT $3 OFFSET $4
+	`
+
+	var execs []*models.TaskExecution
+	err := r.db.SelectContext(ctx, &execs, query, taskID, userID, limit, offset)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list task executions: %w", err)
+	}
+
+	return execs, nil
+}
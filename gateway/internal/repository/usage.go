@@ -0,0 +1,173 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/VanCannon/openpam/gateway/internal/database"
+	"github.com/VanCannon/openpam/gateway/internal/models"
+	"github.com/google/uuid"
+)
+
+// ErrQuotaExists is returned when a quota already limits the same metric for
+// the same user or API key
+var ErrQuotaExists = errors.New("a quota already limits this metric")
+
+// usageColumns selects a usage row, with the nil UUID of use signed in as NULL
+const usageColumns = `day, user_id, NULLIF(api_key_id, '00000000-0000-0000-0000-000000000000') AS api_key_id,
+		       api_calls, sessions, bytes_sent, bytes_received`
+
+// UsageFilter narrows the usage listed
+type UsageFilter struct {
+	UserID   *uuid.UUID
+	APIKeyID *uuid.UUID
+	From     time.Time // First day included
+	To       time.Time // Last day included
+}
+
+// UsageRepository handles daily usage and its quotas
+type UsageRepository struct {
+	db *database.DB
+}
+
+// NewUsageRepository creates a new usage repository
+func NewUsageRepository(db *database.DB) *UsageRepository {
+	return &UsageRepository{db: db}
+}
+
+// Add adds usage to the days it happened on
+func (r *UsageRepository) Add(ctx context.Context, usage []*models.Usage) error {
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	query := `
+		INSERT INTO usage_daily (day, user_id, api_key_id, api_calls, sessions, bytes_sent, bytes_received)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		ON CONFLICT (day, user_id, api_key_id) DO UPDATE SET
+			api_calls = usage_daily.api_calls + EXCLUDED.api_calls,
+			sessions = usage_daily.sessions + EXCLUDED.sessions,
+			bytes_sent = usage_daily.bytes_sent + EXCLUDED.bytes_sent,
+			bytes_received = usage_daily.bytes_received + EXCLUDED.bytes_received
+	`
+	for _, u := range usage {
+		apiKeyID := uuid.Nil
+		if u.APIKeyID != nil {
+			apiKeyID = *u.APIKeyID
+		}
+		if _, err := tx.ExecContext(ctx, query, u.Day, u.UserID, apiKeyID, u.APICalls, u.Sessions, u.BytesSent, u.BytesReceived); err != nil {
+			return fmt.Errorf("failed to add usage: %w", err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return nil
+}
+
+// Day retrieves everyone's usage on day
+func (r *UsageRepository) Day(ctx context.Context, day time.Time) ([]*models.Usage, error) {
+	query := `SELECT ` + usageColumns + ` FROM usage_daily WHERE day = $1`
+
+	var usage []*models.Usage
+	if err := r.db.SelectContext(ctx, &usage, query, day); err != nil {
+		return nil, fmt.Errorf("failed to get usage: %w", err)
+	}
+	return usage, nil
+}
+
+// List retrieves the usage matching filter, newest day first
+func (r *UsageRepository) List(ctx context.Context, filter UsageFilter) ([]*models.Usage, error) {
+	query := `
+		SELECT ` + usageColumns + `
+		FROM usage_daily
+		WHERE day BETWEEN $1 AND $2
+		  AND ($3::uuid IS NULL OR user_id = $3)
+		  AND ($4::uuid IS NULL OR api_key_id = $4)
+		ORDER BY day DESC, user_id, api_key_id
+	`
+
+	var usage []*models.Usage
+	if err := r.db.SelectContext(ctx, &usage, query, filter.From, filter.To, filter.UserID, filter.APIKeyID); err != nil {
+		return nil, fmt.Errorf("failed to list usage: %w", err)
+	}
+	return usage, nil
+}
+
+// CreateQuota adds a quota
+func (r *UsageRepository) CreateQuota(ctx context.Context, quota *models.UsageQuota) error {
+	query := `
+		INSERT INTO usage_quotas (id, user_id, api_key_id, metric, daily_limit, alert_percent, created_by, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		ON CONFLICT DO NOTHING
+	`
+
+	quota.ID = uuid.New()
+	quota.CreatedAt = time.Now()
+	result, err := r.db.ExecContext(ctx, query,
+		quota.ID,
+		quota.UserID,
+		quota.APIKeyID,
+		quota.Metric,
+		quota.DailyLimit,
+		quota.AlertPercent,
+		quota.CreatedBy,
+		quota.CreatedAt,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to create quota: %w", err)
+	}
+	if created, _ := result.RowsAffected(); created == 0 {
+		return ErrQuotaExists
+	}
+	return nil
+}
+
+// ListQuotas retrieves every quota
+func (r *UsageRepository) ListQuotas(ctx context.Context) ([]*models.UsageQuota, error) {
+	query := `
+		SELECT id, user_id, api_key_id, metric, daily_limit, alert_percent, alerted_on, created_by, created_at
+		FROM usage_quotas
+		ORDER BY created_at
+	`
+
+	var quotas []*models.UsageQuota
+	if err := r.db.SelectContext(ctx, &quotas, query); err != nil {
+		return nil, fmt.Errorf("failed to list quotas: %w", err)
+	}
+	return quotas, nil
+}
+
+// DeleteQuota removes a quota
+func (r *UsageRepository) DeleteQuota(ctx context.Context, id uuid.UUID) error {
+	result, err := r.db.ExecContext(ctx, `DELETE FROM usage_quotas WHERE id = $1`, id)
+	if err != nil {
+		return fmt.Errorf("failed to delete quota: %w", err)
+	}
+	if deleted, _ := result.RowsAffected(); deleted == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// MarkAlerted records that a quota's alert was sent on day. It reports false
+// if it already was, by this gateway or another.
+func (r *UsageRepository) MarkAlerted(ctx context.Context, id uuid.UUID, day time.Time) (bool, error) {
+	query := `
+		UPDATE usage_quotas SET alerted_on = $2
+		WHERE id = $1 AND (alerted_on IS NULL OR alerted_on < $2)
+	`
+
+	result, err := r.db.ExecContext(ctx, query, id, day)
+	if err != nil {
+		return false, fmt.Errorf("failed to mark quota alerted: %w", err)
+	}
+	marked, _ := result.RowsAffected()
+	return marked > 0, nil
+}
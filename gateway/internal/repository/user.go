@@ -4,11 +4,14 @@ import (
 	"context"
 	"database/sql"
 	"fmt"
+	"strings"
 	"time"
 
+	"github.com/VanCannon/openpam/gateway/internal/actor"
 	"github.com/VanCannon/openpam/gateway/internal/database"
 	"github.com/VanCannon/openpam/gateway/internal/models"
 	"github.com/google/uuid"
+	"github.com/lib/pq"
 )
 
 // UserRepository handles user data operations
@@ -24,11 +27,12 @@ func NewUserRepository(db *database.DB) *UserRepository {
 // Create creates a new user
 func (r *UserRepository) Create(ctx context.Context, user *models.User) error {
 	query := `
-		INSERT INTO users (id, entra_id, email, display_name, enabled, role, source, created_at, updated_at)
-		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+		INSERT INTO users (id, entra_id, email, display_name, enabled, role, source, created_at, updated_at, created_by, updated_by)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $10)
 	`
 
 	user.ID = uuid.New()
+	user.Version = 1
 	user.CreatedAt = time.Now()
 	user.UpdatedAt = time.Now()
 	if user.Role == "" {
@@ -48,6 +52,7 @@ func (r *UserRepository) Create(ctx context.Context, user *models.User) error {
 		user.Source,
 		user.CreatedAt,
 		user.UpdatedAt,
+		actor.UserID(ctx),
 	)
 
 	if err != nil {
@@ -60,7 +65,7 @@ func (r *UserRepository) Create(ctx context.Context, user *models.User) error {
 // GetByID retrieves a user by ID
 func (r *UserRepository) GetByID(ctx context.Context, id uuid.UUID) (*models.User, error) {
 	query := `
-		SELECT id, entra_id, email, display_name, enabled, role, source, created_at, updated_at, last_login_at
+		SELECT id, entra_id, email, display_name, enabled, role, source, attributes, version, created_at, updated_at, last_login_at
 		FROM users
 		WHERE id = $1
 	`
@@ -80,7 +85,7 @@ func (r *UserRepository) GetByID(ctx context.Context, id uuid.UUID) (*models.Use
 // GetByEntraID retrieves a user by EntraID
 func (r *UserRepository) GetByEntraID(ctx context.Context, entraID string) (*models.User, error) {
 	query := `
-		SELECT id, entra_id, email, display_name, enabled, role, source, created_at, updated_at, last_login_at
+		SELECT id, entra_id, email, display_name, enabled, role, source, attributes, version, created_at, updated_at, last_login_at
 		FROM users
 		WHERE entra_id = $1
 	`
@@ -100,7 +105,7 @@ func (r *UserRepository) GetByEntraID(ctx context.Context, entraID string) (*mod
 // GetByEmail retrieves a user by email
 func (r *UserRepository) GetByEmail(ctx context.Context, email string) (*models.User, error) {
 	query := `
-		SELECT id, entra_id, email, display_name, enabled, role, source, created_at, updated_at, last_login_at
+		SELECT id, entra_id, email, display_name, enabled, role, source, attributes, version, created_at, updated_at, last_login_at
 		FROM users
 		WHERE email = $1
 	`
@@ -117,12 +122,13 @@ func (r *UserRepository) GetByEmail(ctx context.Context, email string) (*models.
 	return &user, nil
 }
 
-// Update updates a user
+// Update updates a user if it is still at user.Version, and advances the version.
+// ErrVersionConflict is returned when someone else updated the user first.
 func (r *UserRepository) Update(ctx context.Context, user *models.User) error {
 	query := `
 		UPDATE users
-		SET email = $1, display_name = $2, enabled = $3, role = $4, source = $5, updated_at = $6
-		WHERE id = $7
+		SET email = $1, display_name = $2, enabled = $3, role = $4, source = $5, updated_at = $6, updated_by = $9, attributes = $10, version = version + 1
+		WHERE id = $7 AND version = $8
 	`
 
 	user.UpdatedAt = time.Now()
@@ -135,6 +141,9 @@ func (r *UserRepository) Update(ctx context.Context, user *models.User) error {
 		user.Source,
 		user.UpdatedAt,
 		user.ID,
+		user.Version,
+		actor.UserID(ctx),
+		user.Attributes,
 	)
 
 	if err != nil {
@@ -147,9 +156,10 @@ func (r *UserRepository) Update(ctx context.Context, user *models.User) error {
 	}
 
 	if rows == 0 {
-		return fmt.Errorf("user not found")
+		return versionMiss(ctx, r.db, "users", "", user.ID, fmt.Errorf("user not found"))
 	}
 
+	user.Version++
 	return nil
 }
 
@@ -211,7 +221,7 @@ func (r *UserRepository) Delete(ctx context.Context, id uuid.UUID) error {
 // List retrieves all users with pagination
 func (r *UserRepository) List(ctx context.Context, limit, offset int) ([]*models.User, error) {
 	query := `
-		SELECT id, entra_id, email, display_name, enabled, role, source, created_at, updated_at, last_login_at
+		SELECT id, entra_id, email, display_name, enabled, role, source, attributes, version, created_at, updated_at, last_login_at
 		FROM users
 		ORDER BY created_at DESC
 		LIMIT $1 OFFSET $2
@@ -226,6 +236,61 @@ func (r *UserRepository) List(ctx context.Context, limit, offset int) ([]*models
 	return users, nil
 }
 
+// ListByIDs retrieves the users with the given IDs, enabled or not
+func (r *UserRepository) ListByIDs(ctx context.Context, ids []uuid.UUID) ([]*models.User, error) {
+	query := `
+		SELECT id, entra_id, email, display_name, enabled, role, source, attributes, version, created_at, updated_at, last_login_at
+		FROM users
+		WHERE id = ANY($1::uuid[])
+	`
+
+	var users []*models.User
+	if err := r.db.SelectContext(ctx, &users, query, uuidArray(ids)); err != nil {
+		return nil, fmt.Errorf("failed to list users by ID: %w", err)
+	}
+
+	return users, nil
+}
+
+// ListByEmails retrieves the users with the given email addresses, compared
+// case-insensitively, enabled or not
+func (r *UserRepository) ListByEmails(ctx context.Context, emails []string) ([]*models.User, error) {
+	query := `
+		SELECT id, entra_id, email, display_name, enabled, role, source, attributes, version, created_at, updated_at, last_login_at
+		FROM users
+		WHERE lower(email) = ANY($1)
+	`
+
+	lowered := make(pq.StringArray, len(emails))
+	for i, email := range emails {
+		lowered[i] = strings.ToLower(email)
+	}
+
+	var users []*models.User
+	if err := r.db.SelectContext(ctx, &users, query, lowered); err != nil {
+		return nil, fmt.Errorf("failed to list users by email: %w", err)
+	}
+
+	return users, nil
+}
+
+// ListEnabledByRole retrieves the enabled users with a role
+func (r *UserRepository) ListEnabledByRole(ctx context.Context, role string) ([]*models.User, error) {
+	query := `
+		SELECT id, entra_id, email, display_name, enabled, role, source, attributes, version, created_at, updated_at, last_login_at
+		FROM users
+		WHERE role = $1 AND enabled
+		ORDER BY email
+	`
+
+	var users []*models.User
+	if err := r.db.SelectContext(ctx, &users, query, role); err != nil {
+		return nil, fmt.Errorf("failed to list users by role: %w", err)
+	}
+
+	return users, nil
+}
+
 // GetOrCreate retrieves a user by EntraID or creates a new one
 func (r *UserRepository) GetOrCreate(ctx context.Context, entraID, email, displayName string) (*models.User, error) {
 	// Try to get existing user
@@ -251,7 +316,8 @@ func (r *UserRepository) GetOrCreate(ctx context.Context, entraID, email, displa
 	}
 
 	// Update last login
-	user.LastLoginAt = sql.NullTime{Time: time.Now(), Valid: true}
+	now := time.Now()
+	user.LastLoginAt = &now
 	if err := r.UpdateLastLogin(ctx, user.ID); err != nil {
 		return nil, fmt.Errorf("failed to update last login: %w", err)
 	}
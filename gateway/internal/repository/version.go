@@ -0,0 +1,32 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+)
+
+// ErrVersionConflict is returned by versioned updates when the row has been
+// modified since the caller read it
+var ErrVersionConflict = errors.New("version conflict")
+
+// versionMiss explains why a versioned update matched no rows: the row either
+// doesn't exist (notFound is returned) or has moved on to another version.
+// table and condition are fixed strings from the calling repository.
+func versionMiss(ctx context.Context, q sqlx.QueryerContext, table, condition string, id uuid.UUID, notFound error) error {
+	query := `SELECT EXISTS (SELECT 1 FROM ` + table + ` WHERE id = $1` + condition + `)`
+
+	var exists bool
+	if err := sqlx.GetContext(ctx, q, &exists, query, id); err != nil {
+		return fmt.Errorf("failed to check %s version: %w", table, err)
+	}
+
+	if !exists {
+		return notFound
+	}
+
+	return ErrVersionConflict
+}
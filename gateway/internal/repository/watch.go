@@ -0,0 +1,283 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/VanCannon/openpam/gateway/internal/actor"
+	"github.com/VanCannon/openpam/gateway/internal/database"
+	"github.com/VanCannon/openpam/gateway/internal/models"
+	"github.com/google/uuid"
+)
+
+// WatchRepository handles watch rule and alert data operations
+type WatchRepository struct {
+	db *database.DB
+}
+
+// NewWatchRepository creates a new watch repository
+func NewWatchRepository(db *database.DB) *WatchRepository {
+	return &WatchRepository{db: db}
+}
+
+const watchRuleColumns = `id, name, description, enabled, event_types, user_id, target_tag, status, outside_hours,
+	threshold, window_seconds, group_by, actions, recipients, created_at, updated_at`
+
+// Create creates a new watch rule
+func (r *WatchRepository) Create(ctx context.Context, rule *models.WatchRule) error {
+	query := `
+		INSERT INTO watch_rules (` + watchRuleColumns + `, created_by, updated_by)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, $17)
+	`
+
+	rule.ID = uuid.New()
+	rule.CreatedAt = time.Now()
+	rule.UpdatedAt = rule.CreatedAt
+
+	_, err := r.db.ExecContext(ctx, query,
+		rule.ID,
+		rule.Name,
+		rule.Description,
+		rule.Enabled,
+		rule.EventTypes,
+		rule.UserID,
+		rule.TargetTag,
+		rule.Status,
+		rule.OutsideHours,
+		rule.Threshold,
+		rule.WindowSeconds,
+		rule.GroupBy,
+		rule.Actions,
+		rule.Recipients,
+		rule.CreatedAt,
+		rule.UpdatedAt,
+		actor.UserID(ctx),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to create watch rule: %w", err)
+	}
+
+	return nil
+}
+
+// GetByID retrieves a watch rule by ID
+func (r *WatchRepository) GetByID(ctx context.Context, id uuid.UUID) (*models.WatchRule, error) {
+	query := `SELECT ` + watchRuleColumns + ` FROM watch_rules WHERE id = $1`
+
+	var rule models.WatchRule
+	if err := r.db.GetContext(ctx, &rule, query, id); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("watch rule not found")
+		}
+		return nil, fmt.Errorf("failed to get watch rule: %w", err)
+	}
+
+	return &rule, nil
+}
+
+// List retrieves all watch rules
+func (r *WatchRepository) List(ctx context.Context) ([]*models.WatchRule, error) {
+	query := `SELECT ` + watchRuleColumns + ` FROM watch_rules ORDER BY name ASC`
+
+	var rules []*models.WatchRule
+	if err := r.db.SelectContext(ctx, &rules, query); err != nil {
+		return nil, fmt.Errorf("failed to list watch rules: %w", err)
+	}
+
+	return rules, nil
+}
+
+// ListEnabled retrieves the enabled watch rules
+func (r *WatchRepository) ListEnabled(ctx context.Context) ([]*models.WatchRule, error) {
+	query := `SELECT ` + watchRuleColumns + ` FROM watch_rules WHERE enabled = true ORDER BY name ASC`
+
+	var rules []*models.WatchRule
+	if err := r.db.SelectContext(ctx, &rules, query); err != nil {
+		return nil, fmt.Errorf("failed to list enabled watch rules: %w", err)
+	}
+
+	return rules, nil
+}
+
+// Update updates a watch rule. Events already counted towards the old
+// conditions are forgotten.
+func (r *WatchRepository) Update(ctx context.Context, rule *models.WatchRule) error {
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	query := `
+		UPDATE watch_rules
+		SET name = $1, description = $2, enabled = $3, event_types = $4, user_id = $5, target_tag = $6,
+		    status = $7, outside_hours = $8, threshold = $9, window_seconds = $10, group_by = $11,
+		    actions = $12, recipients = $13, updated_at = $14, updated_by = $15
+		WHERE id = $16
+	`
+
+	rule.UpdatedAt = time.Now()
+
+	result, err := tx.ExecContext(ctx, query,
+		rule.Name,
+		rule.Description,
+		rule.Enabled,
+		rule.EventTypes,
+		rule.UserID,
+		rule.TargetTag,
+		rule.Status,
+		rule.OutsideHours,
+		rule.Threshold,
+		rule.WindowSeconds,
+		rule.GroupBy,
+		rule.Actions,
+		rule.Recipients,
+		rule.UpdatedAt,
+		actor.UserID(ctx),
+		rule.ID,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to update watch rule: %w", err)
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+	if rows == 0 {
+		return fmt.Errorf("watch rule not found")
+	}
+
+	if _, err := tx.ExecContext(ctx, `DELETE FROM watch_hits WHERE rule_id = $1`, rule.ID); err != nil {
+		return fmt.Errorf("failed to clear watch hits: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return nil
+}
+
+// Delete deletes a watch rule with its alerts
+func (r *WatchRepository) Delete(ctx context.Context, id uuid.UUID) error {
+	result, err := r.db.ExecContext(ctx, `DELETE FROM watch_rules WHERE id = $1`, id)
+	if err != nil {
+		return fmt.Errorf("failed to delete watch rule: %w", err)
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+	if rows == 0 {
+		return fmt.Errorf("watch rule not found")
+	}
+
+	return nil
+}
+
+// Hit counts a matching event towards a rule's threshold and returns how many
+// of the group's events happened since the start of the window. Once the count
+// reaches threshold the group's events are cleared, so the rule fires again
+// only after as many new ones.
+func (r *WatchRepository) Hit(ctx context.Context, ruleID uuid.UUID, groupKey string, eventID int64, at, since time.Time, threshold int) (int, error) {
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return 0, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, `
+		INSERT INTO watch_hits (rule_id, group_key, event_id, occurred_at)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT DO NOTHING
+	`, ruleID, groupKey, eventID, at); err != nil {
+		return 0, fmt.Errorf("failed to record watch hit: %w", err)
+	}
+
+	var count int
+	if err := tx.GetContext(ctx, &count, `
+		SELECT COUNT(*) FROM watch_hits WHERE rule_id = $1 AND group_key = $2 AND occurred_at > $3
+	`, ruleID, groupKey, since); err != nil {
+		return 0, fmt.Errorf("failed to count watch hits: %w", err)
+	}
+
+	if count >= threshold {
+		if _, err := tx.ExecContext(ctx,
+			`DELETE FROM watch_hits WHERE rule_id = $1 AND group_key = $2`, ruleID, groupKey,
+		); err != nil {
+			return 0, fmt.Errorf("failed to clear watch hits: %w", err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return count, nil
+}
+
+// PruneHits deletes the counted events that happened before cutoff
+func (r *WatchRepository) PruneHits(ctx context.Context, cutoff time.Time) (int64, error) {
+	result, err := r.db.ExecContext(ctx, `DELETE FROM watch_hits WHERE occurred_at < $1`, cutoff)
+	if err != nil {
+		return 0, fmt.Errorf("failed to prune watch hits: %w", err)
+	}
+	return result.RowsAffected()
+}
+
+const watchAlertColumns = `id, rule_id, rule_name, event_id, event_type, group_key, event_count, user_id, target_id,
+	investigation_id, actions, errors, created_at`
+
+// CreateAlert records a rule firing
+func (r *WatchRepository) CreateAlert(ctx context.Context, alert *models.WatchAlert) error {
+	query := `
+		INSERT INTO watch_alerts (` + watchAlertColumns + `)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13)
+	`
+
+	alert.ID = uuid.New()
+	alert.CreatedAt = time.Now()
+
+	_, err := r.db.ExecContext(ctx, query,
+		alert.ID,
+		alert.RuleID,
+		alert.RuleName,
+		alert.EventID,
+		alert.EventType,
+		alert.GroupKey,
+		alert.EventCount,
+		alert.UserID,
+		alert.TargetID,
+		alert.InvestigationID,
+		alert.Actions,
+		alert.Errors,
+		alert.CreatedAt,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to create watch alert: %w", err)
+	}
+
+	return nil
+}
+
+// ListAlerts retrieves alerts newest first, optionally of one rule
+func (r *WatchRepository) ListAlerts(ctx context.Context, ruleID *uuid.UUID, limit, offset int) ([]*models.WatchAlert, error) {
+	query := `
+		SELECT ` + watchAlertColumns + `
+		FROM watch_alerts
+		WHERE ($1::uuid IS NULL OR rule_id = $1)
+		ORDER BY created_at DESC
+		LIMIT $2 OFFSET $3
+	`
+
+	var alerts []*models.WatchAlert
+	if err := r.db.SelectContext(ctx, &alerts, query, ruleID, limit, offset); err != nil {
+		return nil, fmt.Errorf("failed to list watch alerts: %w", err)
+	}
+
+	return alerts, nil
+}
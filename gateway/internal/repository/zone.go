@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"time"
 
+	"github.com/VanCannon/openpam/gateway/internal/actor"
 	"github.com/VanCannon/openpam/gateway/internal/database"
 	"github.com/VanCannon/openpam/gateway/internal/models"
 	"github.com/google/uuid"
@@ -24,11 +25,12 @@ func NewZoneRepository(db *database.DB) *ZoneRepository {
 // Create creates a new zone
 func (r *ZoneRepository) Create(ctx context.Context, zone *models.Zone) error {
 	query := `
-		INSERT INTO zones (id, name, type, description, created_at, updated_at)
-		VALUES ($1, $2, $3, $4, $5, $6)
+		INSERT INTO zones (id, name, type, description, settings, created_at, updated_at, created_by, updated_by)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $8)
 	`
 
 	zone.ID = uuid.New()
+	zone.Version = 1
 	zone.CreatedAt = time.Now()
 	zone.UpdatedAt = time.Now()
 
@@ -37,8 +39,10 @@ func (r *ZoneRepository) Create(ctx context.Context, zone *models.Zone) error {
 		zone.Name,
 		zone.Type,
 		zone.Description,
+		zone.Settings,
 		zone.CreatedAt,
 		zone.UpdatedAt,
+		actor.UserID(ctx),
 	)
 
 	if err != nil {
@@ -51,7 +55,7 @@ func (r *ZoneRepository) Create(ctx context.Context, zone *models.Zone) error {
 // GetByID retrieves a zone by ID
 func (r *ZoneRepository) GetByID(ctx context.Context, id uuid.UUID) (*models.Zone, error) {
 	query := `
-		SELECT id, name, type, description, created_at, updated_at
+		SELECT id, name, type, description, settings, version, created_at, updated_at
 		FROM zones
 		WHERE id = $1
 	`
@@ -71,7 +75,7 @@ func (r *ZoneRepository) GetByID(ctx context.Context, id uuid.UUID) (*models.Zon
 // GetByName retrieves a zone by name
 func (r *ZoneRepository) GetByName(ctx context.Context, name string) (*models.Zone, error) {
 	query := `
-		SELECT id, name, type, description, created_at, updated_at
+		SELECT id, name, type, description, settings, version, created_at, updated_at
 		FROM zones
 		WHERE name = $1
 	`
@@ -91,7 +95,7 @@ func (r *ZoneRepository) GetByName(ctx context.Context, name string) (*models.Zo
 // List retrieves all zones
 func (r *ZoneRepository) List(ctx context.Context) ([]*models.Zone, error) {
 	query := `
-		SELECT id, name, type, description, created_at, updated_at
+		SELECT id, name, type, description, settings, version, created_at, updated_at
 		FROM zones
 		ORDER BY name ASC
 	`
@@ -105,12 +109,30 @@ func (r *ZoneRepository) List(ctx context.Context) ([]*models.Zone, error) {
 	return zones, nil
 }
 
-// Update updates a zone
+// ListByIDs retrieves the zones with the given IDs
+func (r *ZoneRepository) ListByIDs(ctx context.Context, ids []uuid.UUID) ([]*models.Zone, error) {
+	query := `
+		SELECT id, name, type, description, settings, version, created_at, updated_at
+		FROM zones
+		WHERE id = ANY($1::uuid[])
+	`
+
+	var zones []*models.Zone
+	err := r.db.SelectContext(ctx, &zones, query, uuidArray(ids))
+	if err != nil {
+		return nil, fmt.Errorf("failed to list zones by ID: %w", err)
+	}
+
+	return zones, nil
+}
+
+// Update updates a zone if it is still at zone.Version, and advances the version.
+// ErrVersionConflict is returned when someone else updated the zone first.
 func (r *ZoneRepository) Update(ctx context.Context, zone *models.Zone) error {
 	query := `
 		UPDATE zones
-		SET name = $1, type = $2, description = $3, updated_at = $4
-		WHERE id = $5
+		SET name = $1, type = $2, description = $3, settings = $4, updated_at = $5, updated_by = $8, version = version + 1
+		WHERE id = $6 AND version = $7
 	`
 
 	zone.UpdatedAt = time.Now()
@@ -119,8 +141,11 @@ func (r *ZoneRepository) Update(ctx context.Context, zone *models.Zone) error {
 		zone.Name,
 		zone.Type,
 		zone.Description,
+		zone.Settings,
 		zone.UpdatedAt,
 		zone.ID,
+		zone.Version,
+		actor.UserID(ctx),
 	)
 
 	if err != nil {
@@ -133,9 +158,10 @@ func (r *ZoneRepository) Update(ctx context.Context, zone *models.Zone) error {
 	}
 
 	if rows == 0 {
-		return fmt.Errorf("zone not found")
+		return versionMiss(ctx, r.db, "zones", "", zone.ID, fmt.Errorf("zone not found"))
 	}
 
+	zone.Version++
 	return nil
 }
 
@@ -0,0 +1,82 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/VanCannon/openpam/gateway/internal/actor"
+	"github.com/VanCannon/openpam/gateway/internal/database"
+	"github.com/VanCannon/openpam/gateway/internal/models"
+	"github.com/google/uuid"
+)
+
+// ZoneAdminRepository handles zone admin assignments
+type ZoneAdminRepository struct {
+	db *database.DB
+}
+
+// NewZoneAdminRepository creates a new zone admin repository
+func NewZoneAdminRepository(db *database.DB) *ZoneAdminRepository {
+	return &ZoneAdminRepository{db: db}
+}
+
+// Assign makes a user an admin of a zone. Assigning them again changes nothing.
+func (r *ZoneAdminRepository) Assign(ctx context.Context, zoneID, userID uuid.UUID) error {
+	query := `
+		INSERT INTO zone_admins (zone_id, user_id, created_by)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (zone_id, user_id) DO NOTHING
+	`
+
+	if _, err := r.db.ExecContext(ctx, query, zoneID, userID, actor.UserID(ctx)); err != nil {
+		return fmt.Errorf("failed to assign zone admin: %w", err)
+	}
+
+	return nil
+}
+
+// Remove removes a user's assignment as admin of a zone
+func (r *ZoneAdminRepository) Remove(ctx context.Context, zoneID, userID uuid.UUID) error {
+	result, err := r.db.ExecContext(ctx, `DELETE FROM zone_admins WHERE zone_id = $1 AND user_id = $2`, zoneID, userID)
+	if err != nil {
+		return fmt.Errorf("failed to remove zone admin: %w", err)
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+	if rows == 0 {
+		return fmt.Errorf("zone admin not found")
+	}
+
+	return nil
+}
+
+// ListByZone retrieves the admins of a zone
+func (r *ZoneAdminRepository) ListByZone(ctx context.Context, zoneID uuid.UUID) ([]*models.ZoneAdmin, error) {
+	query := `
+		SELECT za.zone_id, za.user_id, u.email, COALESCE(u.display_name, '') AS display_name, za.created_by, za.created_at
+		FROM zone_admins za
+		JOIN users u ON u.id = za.user_id
+		WHERE za.zone_id = $1
+		ORDER BY u.email ASC
+	`
+
+	var admins []*models.ZoneAdmin
+	if err := r.db.SelectContext(ctx, &admins, query, zoneID); err != nil {
+		return nil, fmt.Errorf("failed to list zone admins: %w", err)
+	}
+
+	return admins, nil
+}
+
+// ZonesOf retrieves the zones a user is an admin of
+func (r *ZoneAdminRepository) ZonesOf(ctx context.Context, userID uuid.UUID) ([]uuid.UUID, error) {
+	var zones []uuid.UUID
+	if err := r.db.SelectContext(ctx, &zones, `SELECT zone_id FROM zone_admins WHERE user_id = $1`, userID); err != nil {
+		return nil, fmt.Errorf("failed to list zones of zone admin: %w", err)
+	}
+
+	return zones, nil
+}
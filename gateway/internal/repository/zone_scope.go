@@ -0,0 +1,56 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/VanCannon/openpam/gateway/internal/actor"
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+)
+
+// ErrOutsideZones is returned when a zone admin changes something outside the
+// zones they are an admin of
+var ErrOutsideZones = errors.New("outside the zones you administer")
+
+// Queries for the zone of what a scoped change is made to
+const (
+	targetZoneQuery     = `SELECT zone_id FROM targets WHERE id = $1`
+	credentialZoneQuery = `SELECT t.zone_id FROM credentials c JOIN targets t ON t.id = c.target_id WHERE c.id = $1`
+	scheduleZoneQuery   = `SELECT t.zone_id FROM schedules s JOIN targets t ON t.id = s.target_id WHERE s.id = $1`
+)
+
+// checkZone returns ErrOutsideZones if the actor is limited to some zones and
+// the row with id, looked up by zoneQuery, is in another. A row that doesn't
+// exist passes, for the change itself to report.
+func checkZone(ctx context.Context, q sqlx.QueryerContext, zoneQuery string, id uuid.UUID) error {
+	if _, scoped := actor.ZoneScope(ctx); !scoped {
+		return nil
+	}
+
+	var zoneID uuid.UUID
+	if err := sqlx.GetContext(ctx, q, &zoneID, zoneQuery, id); err != nil {
+		if err == sql.ErrNoRows {
+			return nil
+		}
+		return fmt.Errorf("failed to check zone: %w", err)
+	}
+
+	if !actor.ManagesZone(ctx, zoneID) {
+		return ErrOutsideZones
+	}
+	return nil
+}
+
+// zoneScope returns the zones the actor is limited to as a query argument, or
+// nil when it isn't limited. Queries compare against it with
+// "($n::uuid[] IS NULL OR zone_id = ANY($n))".
+func zoneScope(ctx context.Context) interface{} {
+	zones, scoped := actor.ZoneScope(ctx)
+	if !scoped {
+		return nil
+	}
+	return uuidArray(zones)
+}
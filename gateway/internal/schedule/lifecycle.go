@@ -0,0 +1,162 @@
+// Package schedule moves approved schedules through their lifecycle as time
+// passes: pending until their window starts, active while it lasts and
+// expired once no window is left.
+package schedule
+
+import (
+	"context"
+	"time"
+
+	"github.com/VanCannon/openpam/gateway/internal/models"
+	"github.com/VanCannon/openpam/gateway/internal/worker"
+	"github.com/VanCannon/openpam/pkg/logger"
+	"github.com/google/uuid"
+)
+
+// Store is the subset of the schedule repository the lifecycle needs
+type Store interface {
+	ListStarted(ctx context.Context, now time.Time) ([]models.Schedule, error)
+	TransitionStatus(ctx context.Context, id uuid.UUID, from, to models.ScheduleStatus) (bool, error)
+}
+
+// AuditRecorder records system audit events
+type AuditRecorder interface {
+	CreateSimple(ctx context.Context, eventType string, userID *uuid.UUID, action string, status string, ipAddress *string, details map[string]interface{}) error
+}
+
+// Lifecycle activates approved schedules when a window starts, returns
+// recurring ones to pending between their occurrences and expires them when
+// no window is left. Access checks go by the windows themselves, so the status
+// is what the schedule list and calendar show rather than what grants access.
+type Lifecycle struct {
+	store    Store
+	audit    AuditRecorder
+	interval time.Duration
+	logger   *logger.Logger
+
+	loop worker.Loop
+}
+
+// NewLifecycle creates a lifecycle that updates schedules every interval
+func NewLifecycle(store Store, audit AuditRecorder, interval time.Duration, log *logger.Logger) *Lifecycle {
+	if interval <= 0 {
+		interval = time.Minute
+	}
+
+	return &Lifecycle{
+		store:    store,
+		audit:    audit,
+		interval: interval,
+		logger:   log,
+	}
+}
+
+// Start runs the lifecycle in the background until Stop is called
+func (l *Lifecycle) Start() {
+	l.loop.Start(l.run)
+}
+
+// Stop stops the lifecycle and waits for an in-progress pass to finish.
+// It is safe to call even if the lifecycle was never started.
+func (l *Lifecycle) Stop() {
+	l.loop.Stop()
+}
+
+func (l *Lifecycle) run() {
+	ticker := time.NewTicker(l.interval)
+	defer ticker.Stop()
+
+	for {
+		l.Advance(time.Now())
+
+		select {
+		case <-l.loop.Stopping():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Advance updates the status of every started approved schedule to match its
+// windows at now
+func (l *Lifecycle) Advance(now time.Time) {
+	ctx, cancel := context.WithTimeout(context.Background(), l.interval)
+	defer cancel()
+
+	schedules, err := l.store.ListStarted(ctx, now)
+	if err != nil {
+		l.logger.Error("Failed to list started schedules", map[string]interface{}{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	for i := range schedules {
+		s := &schedules[i]
+		to := Status(s, now)
+		if to == s.Status {
+			continue
+		}
+
+		changed, err := l.store.TransitionStatus(ctx, s.ID, s.Status, to)
+		if err != nil {
+			l.logger.Error("Failed to update schedule status", map[string]interface{}{
+				"schedule_id": s.ID.String(),
+				"status":      string(to),
+				"error":       err.Error(),
+			})
+			continue
+		}
+		// Cancelled or changed since it was listed
+		if !changed {
+			continue
+		}
+
+		l.logger.Info("Schedule status changed", map[string]interface{}{
+			"schedule_id": s.ID.String(),
+			"from":        string(s.Status),
+			"to":          string(to),
+		})
+		l.record(ctx, s, to)
+	}
+}
+
+// record audits a schedule becoming active or expiring
+func (l *Lifecycle) record(ctx context.Context, s *models.Schedule, status models.ScheduleStatus) {
+	var eventType, action string
+	switch status {
+	case models.ScheduleStatusActive:
+		eventType, action = models.EventTypeScheduleActivated, "Schedule activated"
+	case models.ScheduleStatusExpired:
+		eventType, action = models.EventTypeScheduleExpired, "Schedule expired"
+	default:
+		return
+	}
+
+	userID := s.UserID
+	err := l.audit.CreateSimple(ctx, eventType, &userID, action, models.AuditStatusSuccess, nil, map[string]interface{}{
+		"schedule_id": s.ID.String(),
+		"target_id":   s.TargetID.String(),
+	})
+	if err != nil {
+		l.logger.Error("Failed to record schedule status change", map[string]interface{}{
+			"schedule_id": s.ID.String(),
+			"error":       err.Error(),
+		})
+	}
+}
+
+// Status returns the status an approved schedule should have at now: active
+// inside one of its windows, pending before the next and expired after the
+// last
+func Status(s *models.Schedule, now time.Time) models.ScheduleStatus {
+	start, _, ok := s.NextWindow(now)
+	switch {
+	case !ok:
+		return models.ScheduleStatusExpired
+	case now.Before(start):
+		return models.ScheduleStatusPending
+	default:
+		return models.ScheduleStatusActive
+	}
+}
@@ -0,0 +1,84 @@
+package schedule
+
+import (
+	"context"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/VanCannon/openpam/gateway/internal/models"
+	"github.com/VanCannon/openpam/pkg/logger"
+	"github.com/google/uuid"
+)
+
+type fakeStore struct {
+	schedules []models.Schedule
+	changed   map[uuid.UUID]models.ScheduleStatus
+}
+
+func (f *fakeStore) ListStarted(ctx context.Context, now time.Time) ([]models.Schedule, error) {
+	return f.schedules, nil
+}
+
+func (f *fakeStore) TransitionStatus(ctx context.Context, id uuid.UUID, from, to models.ScheduleStatus) (bool, error) {
+	f.changed[id] = to
+	return true, nil
+}
+
+type fakeAudit struct {
+	events []string
+}
+
+func (f *fakeAudit) CreateSimple(ctx context.Context, eventType string, userID *uuid.UUID, action string, status string, ipAddress *string, details map[string]interface{}) error {
+	f.events = append(f.events, eventType)
+	return nil
+}
+
+func TestStatus(t *testing.T) {
+	now := time.Date(2025, 3, 5, 12, 0, 0, 0, time.UTC)
+	daily := "FREQ=DAILY;COUNT=5"
+
+	tests := []struct {
+		name       string
+		start, end time.Time
+		rule       *string
+		want       models.ScheduleStatus
+	}{
+		{"in window", now.Add(-time.Hour), now.Add(time.Hour), nil, models.ScheduleStatusActive},
+		{"not started", now.Add(time.Hour), now.Add(2 * time.Hour), nil, models.ScheduleStatusPending},
+		{"ended", now.Add(-2 * time.Hour), now.Add(-time.Hour), nil, models.ScheduleStatusExpired},
+		{"in an occurrence", now.AddDate(0, 0, -2).Add(-time.Hour), now.AddDate(0, 0, -2).Add(time.Hour), &daily, models.ScheduleStatusActive},
+		{"between occurrences", now.AddDate(0, 0, -2).Add(2 * time.Hour), now.AddDate(0, 0, -2).Add(3 * time.Hour), &daily, models.ScheduleStatusPending},
+		{"after the last occurrence", now.AddDate(0, 0, -5).Add(-time.Hour), now.AddDate(0, 0, -5).Add(time.Hour), &daily, models.ScheduleStatusExpired},
+	}
+	for _, tt := range tests {
+		s := &models.Schedule{StartTime: tt.start, EndTime: tt.end, RecurrenceRule: tt.rule}
+		if got := Status(s, now); got != tt.want {
+			t.Errorf("%s: status = %s, want %s", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestLifecycle_Advance(t *testing.T) {
+	now := time.Now()
+	starting := models.Schedule{ID: uuid.New(), StartTime: now.Add(-time.Minute), EndTime: now.Add(time.Hour), Status: models.ScheduleStatusPending}
+	running := models.Schedule{ID: uuid.New(), StartTime: now.Add(-time.Minute), EndTime: now.Add(time.Hour), Status: models.ScheduleStatusActive}
+	ended := models.Schedule{ID: uuid.New(), StartTime: now.Add(-time.Hour), EndTime: now.Add(-time.Minute), Status: models.ScheduleStatusActive}
+	store := &fakeStore{schedules: []models.Schedule{starting, running, ended}, changed: make(map[uuid.UUID]models.ScheduleStatus)}
+	audit := &fakeAudit{}
+
+	l := NewLifecycle(store, audit, time.Minute, logger.New(logger.LevelError, io.Discard))
+	l.Advance(now)
+
+	if len(store.changed) != 2 || store.changed[starting.ID] != models.ScheduleStatusActive || store.changed[ended.ID] != models.ScheduleStatusExpired {
+		t.Errorf("changed = %v", store.changed)
+	}
+	if len(audit.events) != 2 || audit.events[0] != models.EventTypeScheduleActivated || audit.events[1] != models.EventTypeScheduleExpired {
+		t.Errorf("recorded %v", audit.events)
+	}
+}
+
+func TestLifecycle_StopWithoutStart(t *testing.T) {
+	l := NewLifecycle(&fakeStore{}, &fakeAudit{}, time.Minute, logger.New(logger.LevelError, io.Discard))
+	l.Stop()
+}
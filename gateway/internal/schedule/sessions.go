@@ -0,0 +1,212 @@
+package schedule
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/VanCannon/openpam/gateway/internal/wsconn"
+	"github.com/VanCannon/openpam/pkg/logger"
+	"github.com/google/uuid"
+)
+
+// WindowLookup finds the end of a user's current schedule window on a target
+type WindowLookup interface {
+	ActiveWindowEnd(ctx context.Context, userID, targetID uuid.UUID, now time.Time) (*time.Time, error)
+}
+
+// Sessions ends the sessions opened inside a schedule window when the window
+// ends. Extending the window moves the end of the user's running sessions on
+// the target; a session whose end arrives also checks for an extension made
+// elsewhere, such as through another gateway, before it is ended.
+type Sessions struct {
+	windows WindowLookup
+	logger  *logger.Logger
+
+	mu      sync.Mutex
+	running map[sessionKey]map[*session]struct{}
+}
+
+type sessionKey struct {
+	userID, targetID uuid.UUID
+}
+
+type sessionCtxKey struct{}
+
+// session is a running session's schedule window
+type session struct {
+	key     sessionKey
+	cancel  context.CancelCauseFunc
+	changes chan time.Time
+
+	mu    sync.Mutex
+	end   time.Time
+	timer *time.Timer
+}
+
+// NewSessions creates a registry of sessions bound to schedule windows
+func NewSessions(windows WindowLookup, log *logger.Logger) *Sessions {
+	return &Sessions{
+		windows: windows,
+		logger:  log,
+		running: make(map[sessionKey]map[*session]struct{}),
+	}
+}
+
+// Start binds a session to the user's current schedule window on the target.
+// The returned context is cancelled with a schedule_ended *wsconn.CloseError
+// when the window ends. Sessions opened outside of a window aren't bound and
+// get ctx back. The returned stop function must be called when the session
+// has ended.
+func (s *Sessions) Start(ctx context.Context, userID, targetID uuid.UUID) (context.Context, func(), error) {
+	end, err := s.windows.ActiveWindowEnd(ctx, userID, targetID, time.Now())
+	if err != nil {
+		return ctx, func() {}, err
+	}
+	if end == nil {
+		return ctx, func() {}, nil
+	}
+
+	ctx, cancel := context.WithCancelCause(ctx)
+	sess := &session{
+		key:     sessionKey{userID, targetID},
+		cancel:  cancel,
+		changes: make(chan time.Time, 1),
+		end:     *end,
+	}
+	sess.mu.Lock()
+	sess.timer = time.AfterFunc(time.Until(sess.end), func() { s.expire(sess) })
+	sess.mu.Unlock()
+
+	s.mu.Lock()
+	if s.running[sess.key] == nil {
+		s.running[sess.key] = make(map[*session]struct{})
+	}
+	s.running[sess.key][sess] = struct{}{}
+	s.mu.Unlock()
+
+	var once sync.Once
+	return context.WithValue(ctx, sessionCtxKey{}, sess), func() {
+		once.Do(func() {
+			sess.mu.Lock()
+			sess.timer.Stop()
+			sess.mu.Unlock()
+
+			s.mu.Lock()
+			delete(s.running[sess.key], sess)
+			if len(s.running[sess.key]) == 0 {
+				delete(s.running, sess.key)
+			}
+			s.mu.Unlock()
+			cancel(nil)
+		})
+	}, nil
+}
+
+// Extend moves the end of the user's running sessions on the target to end,
+// if it is later than their current end, and returns how many were extended
+func (s *Sessions) Extend(userID, targetID uuid.UUID, end time.Time) int {
+	extended := 0
+	for _, sess := range s.sessions(userID, targetID) {
+		if sess.moveEnd(end, false) {
+			extended++
+		}
+	}
+	return extended
+}
+
+// Recheck looks up the user's schedule window on the target again for their
+// running sessions there, such as after a schedule was revoked. Sessions end
+// right away if no window is left and otherwise at the end of the window.
+func (s *Sessions) Recheck(userID, targetID uuid.UUID) {
+	for _, sess := range s.sessions(userID, targetID) {
+		go s.expire(sess)
+	}
+}
+
+// sessions returns the user's running sessions on the target
+func (s *Sessions) sessions(userID, targetID uuid.UUID) []*session {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	sessions := make([]*session, 0, len(s.running[sessionKey{userID, targetID}]))
+	for sess := range s.running[sessionKey{userID, targetID}] {
+		sessions = append(sessions, sess)
+	}
+	return sessions
+}
+
+// expire ends a session whose window has ended, unless the window has been
+// extended meanwhile
+func (s *Sessions) expire(sess *session) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	end, err := s.windows.ActiveWindowEnd(ctx, sess.key.userID, sess.key.targetID, time.Now())
+	if err != nil {
+		// The window is over as far as is known, so the session ends
+		s.logger.Warn("Failed to check for a schedule extension", map[string]interface{}{
+			"user_id":   sess.key.userID.String(),
+			"target_id": sess.key.targetID.String(),
+			"error":     err.Error(),
+		})
+	}
+	if end != nil {
+		sess.moveEnd(*end, true)
+		return
+	}
+
+	sess.cancel(&wsconn.CloseError{
+		Code: wsconn.CloseScheduleEnded,
+		CloseReason: wsconn.CloseReason{
+			Reason:  wsconn.ReasonScheduleEnded,
+			Message: "Your scheduled access to this target has ended",
+		},
+	})
+}
+
+// moveEnd moves the session's end, reporting whether it moved. The end is
+// only brought forward if shorten is set.
+func (sess *session) moveEnd(end time.Time, shorten bool) bool {
+	sess.mu.Lock()
+	defer sess.mu.Unlock()
+
+	if end.Equal(sess.end) || (end.Before(sess.end) && !shorten) {
+		return false
+	}
+	later := end.After(sess.end)
+	sess.end = end
+	sess.timer.Reset(time.Until(end))
+	if !later {
+		return true
+	}
+
+	// Only the latest end matters to the proxy
+	select {
+	case <-sess.changes:
+	default:
+	}
+	sess.changes <- end
+	return true
+}
+
+// WindowChanges returns a channel that receives the new end of the session in
+// ctx each time its schedule window is extended, or nil if the session isn't
+// bound to one. A proxy uses it to tell the user.
+func WindowChanges(ctx context.Context) <-chan time.Time {
+	if sess, ok := ctx.Value(sessionCtxKey{}).(*session); ok {
+		return sess.changes
+	}
+	return nil
+}
+
+// End returns the end of the schedule window of the session in ctx, and false
+// if the session isn't bound to one
+func End(ctx context.Context) (time.Time, bool) {
+	if sess, ok := ctx.Value(sessionCtxKey{}).(*session); ok {
+		sess.mu.Lock()
+		defer sess.mu.Unlock()
+		return sess.end, true
+	}
+	return time.Time{}, false
+}
@@ -0,0 +1,163 @@
+package schedule
+
+import (
+	"context"
+	"errors"
+	"io"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/VanCannon/openpam/gateway/internal/wsconn"
+	"github.com/VanCannon/openpam/pkg/logger"
+	"github.com/google/uuid"
+)
+
+type fakeWindows struct {
+	mu  sync.Mutex
+	end *time.Time
+}
+
+func (f *fakeWindows) ActiveWindowEnd(ctx context.Context, userID, targetID uuid.UUID, now time.Time) (*time.Time, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.end == nil || !f.end.After(now) {
+		return nil, nil
+	}
+	end := *f.end
+	return &end, nil
+}
+
+func (f *fakeWindows) set(end time.Time) {
+	f.mu.Lock()
+	f.end = &end
+	f.mu.Unlock()
+}
+
+func TestSessions_OutsideWindow(t *testing.T) {
+	s := NewSessions(&fakeWindows{}, logger.New(logger.LevelError, io.Discard))
+
+	ctx := context.Background()
+	got, stop, err := s.Start(ctx, uuid.New(), uuid.New())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stop()
+	if got != ctx || WindowChanges(got) != nil {
+		t.Error("a session outside of a window should not be bound")
+	}
+}
+
+func TestSessions_Expire(t *testing.T) {
+	windows := &fakeWindows{}
+	windows.set(time.Now().Add(50 * time.Millisecond))
+	s := NewSessions(windows, logger.New(logger.LevelError, io.Discard))
+
+	ctx, stop, err := s.Start(context.Background(), uuid.New(), uuid.New())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stop()
+
+	select {
+	case <-ctx.Done():
+	case <-time.After(2 * time.Second):
+		t.Fatal("session was not ended with its window")
+	}
+	var closeErr *wsconn.CloseError
+	if !errors.As(context.Cause(ctx), &closeErr) || closeErr.Code != wsconn.CloseScheduleEnded {
+		t.Errorf("cause = %v, want schedule_ended", context.Cause(ctx))
+	}
+}
+
+func TestSessions_Extend(t *testing.T) {
+	windows := &fakeWindows{}
+	windows.set(time.Now().Add(50 * time.Millisecond))
+	s := NewSessions(windows, logger.New(logger.LevelError, io.Discard))
+
+	userID, targetID := uuid.New(), uuid.New()
+	ctx, stop, err := s.Start(context.Background(), userID, targetID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stop()
+
+	end := time.Now().Add(time.Hour)
+	windows.set(end)
+	if n := s.Extend(userID, targetID, end); n != 1 {
+		t.Fatalf("extended %d sessions, want 1", n)
+	}
+	if n := s.Extend(uuid.New(), targetID, end); n != 0 {
+		t.Errorf("extended %d sessions of another user", n)
+	}
+
+	select {
+	case got := <-WindowChanges(ctx):
+		if !got.Equal(end) {
+			t.Errorf("new end = %v, want %v", got, end)
+		}
+	default:
+		t.Error("no window change was reported")
+	}
+
+	select {
+	case <-ctx.Done():
+		t.Error("extended session was ended")
+	case <-time.After(150 * time.Millisecond):
+	}
+}
+
+func TestSessions_Recheck(t *testing.T) {
+	windows := &fakeWindows{}
+	windows.set(time.Now().Add(time.Hour))
+	s := NewSessions(windows, logger.New(logger.LevelError, io.Discard))
+
+	userID, targetID := uuid.New(), uuid.New()
+	ctx, stop, err := s.Start(context.Background(), userID, targetID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stop()
+
+	// Still in a window: the session goes on
+	s.Recheck(userID, targetID)
+	select {
+	case <-ctx.Done():
+		t.Fatal("session in a window was ended")
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	// Revoked: the session ends right away
+	windows.mu.Lock()
+	windows.end = nil
+	windows.mu.Unlock()
+	s.Recheck(userID, targetID)
+	select {
+	case <-ctx.Done():
+	case <-time.After(2 * time.Second):
+		t.Fatal("revoked session was not ended")
+	}
+}
+
+func TestSessions_ExtendedElsewhere(t *testing.T) {
+	windows := &fakeWindows{}
+	windows.set(time.Now().Add(50 * time.Millisecond))
+	s := NewSessions(windows, logger.New(logger.LevelError, io.Discard))
+
+	ctx, stop, err := s.Start(context.Background(), uuid.New(), uuid.New())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stop()
+
+	// Extended through another gateway; found when the old end arrives
+	windows.set(time.Now().Add(time.Hour))
+
+	select {
+	case <-WindowChanges(ctx):
+	case <-ctx.Done():
+		t.Fatal("session was ended despite the extension")
+	case <-time.After(2 * time.Second):
+		t.Fatal("extension was not picked up")
+	}
+}
@@ -0,0 +1,167 @@
+package searchexport
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// document is one entry of a bulk request
+type document struct {
+	Index string
+	ID    string
+	Body  interface{}
+}
+
+// bulkResponse is the part of a _bulk response the client reads
+type bulkResponse struct {
+	Errors bool `json:"errors"`
+	Items  []map[string]struct {
+		Status int             `json:"status"`
+		Error  json.RawMessage `json:"error"`
+	} `json:"items"`
+}
+
+// client sends bulk requests to Elasticsearch or OpenSearch, which share the
+// _bulk API, moving on to the next endpoint when one can't be reached
+type client struct {
+	endpoints []string
+	username  string
+	password  string
+	apiKey    string
+	http      *http.Client
+	next      int // Endpoint to try first
+}
+
+func newClient(cfg Config) (*client, error) {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if cfg.CAFile != "" {
+		pem, err := os.ReadFile(cfg.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read CA file: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in %s", cfg.CAFile)
+		}
+		transport.TLSClientConfig = &tls.Config{RootCAs: pool, MinVersion: tls.VersionTLS12}
+	}
+
+	endpoints := make([]string, len(cfg.URLs))
+	for i, u := range cfg.URLs {
+		endpoints[i] = strings.TrimRight(u, "/")
+	}
+
+	return &client{
+		endpoints: endpoints,
+		username:  cfg.Username,
+		password:  cfg.Password,
+		apiKey:    cfg.APIKey,
+		http:      &http.Client{Transport: transport, Timeout: 30 * time.Second},
+	}, nil
+}
+
+// itemError is a document the cluster refused
+type itemError struct {
+	doc       document
+	status    int
+	reason    string
+	retryable bool
+}
+
+// bulk indexes docs and returns the documents that failed. An error means the
+// request as a whole failed and nothing can be assumed to be indexed.
+func (c *client) bulk(ctx context.Context, docs []document) ([]itemError, error) {
+	var body bytes.Buffer
+	enc := json.NewEncoder(&body)
+	for _, d := range docs {
+		action := map[string]map[string]string{"index": {"_index": d.Index, "_id": d.ID}}
+		if err := enc.Encode(action); err != nil {
+			return nil, fmt.Errorf("failed to encode bulk action: %w", err)
+		}
+		if err := enc.Encode(d.Body); err != nil {
+			return nil, fmt.Errorf("failed to encode document %s: %w", d.ID, err)
+		}
+	}
+
+	var lastErr error
+	for range c.endpoints {
+		endpoint := c.endpoints[c.next]
+		resp, err := c.send(ctx, endpoint, body.Bytes())
+		if err == nil {
+			return c.failures(docs, resp)
+		}
+		lastErr = fmt.Errorf("%s: %w", endpoint, err)
+		if ctx.Err() != nil {
+			break
+		}
+		c.next = (c.next + 1) % len(c.endpoints)
+	}
+	return nil, lastErr
+}
+
+// send posts a bulk request to one endpoint
+func (c *client) send(ctx context.Context, endpoint string, body []byte) (*bulkResponse, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint+"/_bulk", bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-ndjson")
+	switch {
+	case c.apiKey != "":
+		req.Header.Set("Authorization", "ApiKey "+c.apiKey)
+	case c.username != "":
+		req.SetBasicAuth(c.username, c.password)
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return nil, fmt.Errorf("bulk request failed with status %d: %s", resp.StatusCode, strings.TrimSpace(string(msg)))
+	}
+
+	var result bulkResponse
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("failed to decode bulk response: %w", err)
+	}
+	return &result, nil
+}
+
+// failures matches the response items to the documents sent
+func (c *client) failures(docs []document, resp *bulkResponse) ([]itemError, error) {
+	if !resp.Errors {
+		return nil, nil
+	}
+	if len(resp.Items) != len(docs) {
+		return nil, fmt.Errorf("bulk response has %d items for %d documents", len(resp.Items), len(docs))
+	}
+
+	var failed []itemError
+	for i, item := range resp.Items {
+		for _, result := range item {
+			if result.Status < 300 {
+				continue
+			}
+			failed = append(failed, itemError{
+				doc:       docs[i],
+				status:    result.Status,
+				reason:    string(result.Error),
+				retryable: result.Status == http.StatusTooManyRequests || result.Status >= 500,
+			})
+		}
+	}
+	return failed, nil
+}
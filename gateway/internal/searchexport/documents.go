@@ -0,0 +1,245 @@
+package searchexport
+
+import (
+	"bytes"
+	"fmt"
+	"time"
+
+	"github.com/VanCannon/openpam/gateway/internal/models"
+	"github.com/VanCannon/openpam/gateway/internal/siem"
+	"github.com/VanCannon/openpam/gateway/internal/transcript"
+)
+
+// Index kinds. Documents go to "<prefix>-<kind>-<yyyy.mm.dd>", dated by when the
+// session started or the event happened, so an index template and lifecycle
+// policy matching "<prefix>-<kind>-*" can roll them over and expire them.
+const (
+	KindSessions    = "sessions"
+	KindSystem      = "system"
+	KindCommands    = "commands"
+	KindTranscripts = "transcripts"
+)
+
+// indexName returns the daily index for documents of kind dated t
+func (e *Exporter) indexName(kind string, t time.Time) string {
+	return fmt.Sprintf("%s-%s-%s", e.config.IndexPrefix, kind, t.UTC().Format("2006.01.02"))
+}
+
+// sessionDoc is an audit log as indexed
+type sessionDoc struct {
+	Timestamp       time.Time  `json:"@timestamp"`
+	SessionID       string     `json:"session_id"`
+	UserID          string     `json:"user_id"`
+	TargetID        string     `json:"target_id"`
+	CredentialID    string     `json:"credential_id,omitempty"`
+	Protocol        string     `json:"protocol,omitempty"`
+	Status          string     `json:"status"`
+	StartTime       time.Time  `json:"start_time"`
+	EndTime         *time.Time `json:"end_time,omitempty"`
+	DurationSeconds *float64   `json:"duration_seconds,omitempty"`
+	BytesSent       int64      `json:"bytes_sent"`
+	BytesReceived   int64      `json:"bytes_received"`
+	ClientIP        string     `json:"client_ip,omitempty"`
+	ErrorMessage    string     `json:"error_message,omitempty"`
+	RecordingPath   string     `json:"recording_path,omitempty"`
+	Purpose         string     `json:"purpose,omitempty"`
+	Reason          string     `json:"reason,omitempty"`
+	Zone            string     `json:"zone,omitempty"`
+}
+
+// systemDoc is a system audit log as indexed. Details stay a JSON string, as
+// their shape differs between event types.
+type systemDoc struct {
+	Timestamp    time.Time `json:"@timestamp"`
+	ID           string    `json:"id"`
+	EventType    string    `json:"event_type"`
+	UserID       string    `json:"user_id,omitempty"`
+	TargetUserID string    `json:"target_user_id,omitempty"`
+	ResourceType string    `json:"resource_type,omitempty"`
+	ResourceID   string    `json:"resource_id,omitempty"`
+	ResourceName string    `json:"resource_name,omitempty"`
+	Action       string    `json:"action"`
+	Status       string    `json:"status"`
+	IPAddress    string    `json:"ip_address,omitempty"`
+	UserAgent    string    `json:"user_agent,omitempty"`
+	Details      string    `json:"details,omitempty"`
+	ElevationID  string    `json:"elevation_id,omitempty"`
+	Zone         string    `json:"zone,omitempty"`
+}
+
+// cefDoc is an event as a CEF record, in the message field where ingest
+// pipelines such as Elasticsearch's CEF processor look for it
+type cefDoc struct {
+	Timestamp time.Time `json:"@timestamp"`
+	Message   string    `json:"message"`
+}
+
+// ocsfDoc is an event in the OCSF schema, with a timestamp to search by
+type ocsfDoc struct {
+	Timestamp time.Time `json:"@timestamp"`
+	*siem.OCSFEvent
+}
+
+// commandDoc is a command typed in an SSH session
+type commandDoc struct {
+	Timestamp time.Time `json:"@timestamp"`
+	SessionID string    `json:"session_id"`
+	UserID    string    `json:"user_id"`
+	TargetID  string    `json:"target_id"`
+	Sequence  int       `json:"sequence"`
+	Prompt    string    `json:"prompt"`
+	Command   string    `json:"command"`
+	Timed     bool      `json:"timed"` // False when the time is the session start, see transcript.Transcript
+	Zone      string    `json:"zone,omitempty"`
+}
+
+// transcriptDoc is the plain-text transcript of an SSH session
+type transcriptDoc struct {
+	Timestamp time.Time  `json:"@timestamp"`
+	SessionID string     `json:"session_id"`
+	UserID    string     `json:"user_id"`
+	TargetID  string     `json:"target_id"`
+	StartTime time.Time  `json:"start_time"`
+	EndTime   *time.Time `json:"end_time,omitempty"`
+	Timed     bool       `json:"timed"`
+	Lines     int        `json:"lines"`
+	Commands  int        `json:"commands"`
+	Text      string     `json:"text"`
+	Zone      string     `json:"zone,omitempty"`
+}
+
+func (e *Exporter) sessionDocument(log *models.AuditLog) document {
+	// Indexed under the session ID, so the end of a session replaces its start
+	index, id := e.indexName(KindSessions, log.StartTime), log.ID.String()
+	switch e.config.Format {
+	case siem.FormatCEF:
+		return document{Index: index, ID: id, Body: cefDoc{Timestamp: log.StartTime, Message: siem.CEFSession(log, e.config.Zone)}}
+	case siem.FormatOCSF:
+		return document{Index: index, ID: id, Body: ocsfDoc{Timestamp: log.StartTime, OCSFEvent: siem.OCSFSession(log, e.config.Zone)}}
+	}
+
+	doc := sessionDoc{
+		Timestamp:     log.StartTime,
+		SessionID:     log.ID.String(),
+		UserID:        log.UserID.String(),
+		TargetID:      log.TargetID.String(),
+		Protocol:      log.Protocol,
+		Status:        log.SessionStatus,
+		StartTime:     log.StartTime,
+		BytesSent:     log.BytesSent,
+		BytesReceived: log.BytesReceived,
+		ClientIP:      deref(log.ClientIP),
+		ErrorMessage:  deref(log.ErrorMessage),
+		RecordingPath: deref(log.RecordingPath),
+		Purpose:       deref(log.Purpose),
+		Reason:        deref(log.Reason),
+		Zone:          e.config.Zone,
+	}
+	if log.CredentialID.Valid {
+		doc.CredentialID = log.CredentialID.UUID.String()
+	}
+	if log.EndTime.Valid {
+		end := log.EndTime.Time
+		duration := end.Sub(log.StartTime).Seconds()
+		doc.EndTime = &end
+		doc.DurationSeconds = &duration
+	}
+
+	return document{Index: index, ID: id, Body: doc}
+}
+
+func (e *Exporter) systemDocument(log *models.SystemAuditLog) document {
+	index, id := e.indexName(KindSystem, log.Timestamp), log.ID.String()
+	switch e.config.Format {
+	case siem.FormatCEF:
+		return document{Index: index, ID: id, Body: cefDoc{Timestamp: log.Timestamp, Message: siem.CEFSystem(log, e.config.Zone)}}
+	case siem.FormatOCSF:
+		return document{Index: index, ID: id, Body: ocsfDoc{Timestamp: log.Timestamp, OCSFEvent: siem.OCSFSystem(log, e.config.Zone)}}
+	}
+
+	doc := systemDoc{
+		Timestamp:    log.Timestamp,
+		ID:           log.ID.String(),
+		EventType:    log.EventType,
+		ResourceType: deref(log.ResourceType),
+		ResourceName: deref(log.ResourceName),
+		Action:       log.Action,
+		Status:       log.Status,
+		IPAddress:    deref(log.IPAddress),
+		UserAgent:    deref(log.UserAgent),
+		Details:      deref(log.Details),
+		Zone:         e.config.Zone,
+	}
+	if log.UserID.Valid {
+		doc.UserID = log.UserID.UUID.String()
+	}
+	if log.TargetUserID.Valid {
+		doc.TargetUserID = log.TargetUserID.UUID.String()
+	}
+	if log.ResourceID.Valid {
+		doc.ResourceID = log.ResourceID.UUID.String()
+	}
+	if log.ElevationID.Valid {
+		doc.ElevationID = log.ElevationID.UUID.String()
+	}
+
+	return document{Index: index, ID: id, Body: doc}
+}
+
+// transcriptDocuments returns the transcript of an SSH session and a document
+// for every command typed in it
+func (e *Exporter) transcriptDocuments(log *models.AuditLog, t *transcript.Transcript) []document {
+	var text bytes.Buffer
+	t.WriteText(&text)
+
+	docs := make([]document, 0, 1)
+	commands := 0
+	for _, line := range t.Lines {
+		if line.Command == "" {
+			continue
+		}
+		commands++
+		doc := commandDoc{
+			Timestamp: line.Time,
+			SessionID: log.ID.String(),
+			UserID:    log.UserID.String(),
+			TargetID:  log.TargetID.String(),
+			Sequence:  commands,
+			Prompt:    line.Prompt,
+			Command:   line.Command,
+			Timed:     t.Timed,
+			Zone:      e.config.Zone,
+		}
+		docs = append(docs, document{
+			Index: e.indexName(KindCommands, log.StartTime),
+			ID:    fmt.Sprintf("%s-%d", doc.SessionID, doc.Sequence),
+			Body:  doc,
+		})
+	}
+
+	docs = append(docs, document{
+		Index: e.indexName(KindTranscripts, log.StartTime),
+		ID:    log.ID.String(),
+		Body: transcriptDoc{
+			Timestamp: log.StartTime,
+			SessionID: log.ID.String(),
+			UserID:    log.UserID.String(),
+			TargetID:  log.TargetID.String(),
+			StartTime: t.StartTime,
+			EndTime:   t.EndTime,
+			Timed:     t.Timed,
+			Lines:     len(t.Lines),
+			Commands:  commands,
+			Text:      text.String(),
+			Zone:      e.config.Zone,
+		},
+	})
+	return docs
+}
+
+func deref(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return *s
+}
@@ -0,0 +1,348 @@
+// Package searchexport indexes audit data into Elasticsearch or OpenSearch for
+// centralized search: sessions, system audit events, and the transcripts and
+// commands of SSH sessions.
+package searchexport
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"expvar"
+	"fmt"
+	"io/fs"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/VanCannon/openpam/gateway/internal/models"
+	"github.com/VanCannon/openpam/gateway/internal/siem"
+	"github.com/VanCannon/openpam/gateway/internal/transcript"
+	"github.com/VanCannon/openpam/gateway/internal/worker"
+	"github.com/VanCannon/openpam/pkg/logger"
+	"github.com/google/uuid"
+)
+
+const (
+	// cursorName identifies the exporter's position in the event log
+	cursorName = "search"
+
+	// maxBackoff caps the wait between retries of a failed batch
+	maxBackoff = 30 * time.Second
+
+	// batchTimeout bounds reading, indexing and retrying one batch
+	batchTimeout = 10 * time.Minute
+)
+
+// retryBackoff is the wait before the first retry of a failed batch; it doubles with every retry
+var retryBackoff = time.Second
+
+// Published at /api/v1/admin/metrics
+var (
+	documentsIndexed  = expvar.NewInt("search_export_documents_indexed")
+	documentsRejected = expvar.NewInt("search_export_documents_rejected")
+	batchesFailed     = expvar.NewInt("search_export_batches_failed")
+)
+
+// Config holds the cluster and batching settings
+type Config struct {
+	URLs        []string // Cluster endpoints, tried in order; export is disabled if empty
+	Username    string   // Basic auth, when APIKey is empty
+	Password    string
+	APIKey      string // Sent as "Authorization: ApiKey <key>"
+	CAFile      string // PEM bundle to verify the cluster's certificate with
+	IndexPrefix string
+	BatchSize   int           // Events read from the event log per bulk request
+	Interval    time.Duration // How often the event log is checked for new events
+	MaxRetries  int           // Retries of a failed bulk request before waiting for the next interval
+	Zone        string        // Zone name added to every document
+	Format      string        // Shape of session and system documents, see the siem package; native if empty
+}
+
+// Validate checks the settings of an enabled exporter
+func (c Config) Validate() error {
+	if len(c.URLs) == 0 {
+		return nil
+	}
+	for _, u := range c.URLs {
+		parsed, err := url.Parse(u)
+		if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+			return fmt.Errorf("invalid endpoint %q (must be an http or https URL)", u)
+		}
+	}
+	if c.IndexPrefix == "" || c.IndexPrefix != strings.ToLower(c.IndexPrefix) || strings.ContainsAny(c.IndexPrefix, ` "*\<|,>/?#:`) {
+		return fmt.Errorf("invalid index prefix %q (must be lowercase without spaces or special characters)", c.IndexPrefix)
+	}
+	if c.BatchSize <= 0 {
+		return fmt.Errorf("batch size must be positive")
+	}
+	if c.Format != "" {
+		if err := siem.ValidateFormat(c.Format); err != nil {
+			return err
+		}
+	}
+	if c.APIKey != "" && c.Username != "" {
+		return fmt.Errorf("set either an API key or a username, not both")
+	}
+	_, err := newClient(c)
+	return err
+}
+
+// EventSource is the subset of the event repository the exporter needs
+type EventSource interface {
+	ListSince(ctx context.Context, afterID int64, limit int) ([]*models.Event, error)
+}
+
+// SessionLookup loads the current state of a session
+type SessionLookup interface {
+	GetByID(ctx context.Context, id uuid.UUID) (*models.AuditLog, error)
+}
+
+// CursorStore keeps the exporter's position in the event log
+type CursorStore interface {
+	Advance(ctx context.Context, name string, fn func(lastID int64) (int64, error)) (bool, error)
+}
+
+// Exporter follows the event log and indexes what it describes.
+//
+// Its position is kept in the database and locked while a batch is indexed, so
+// with several gateway replicas one of them exports at a time and a restart
+// resumes where the last batch ended. A batch that can't be indexed is retried
+// with backoff, then again on the next interval; the position only moves once
+// the cluster has accepted it, so nothing is lost while the cluster is down for
+// less than the event retention. Documents are indexed under stable IDs, so
+// exporting an event twice overwrites rather than duplicates.
+type Exporter struct {
+	config     Config
+	client     *client
+	events     EventSource
+	sessions   SessionLookup
+	cursors    CursorStore
+	recordings fs.FS
+	logger     *logger.Logger
+
+	loop worker.Loop
+}
+
+// NewExporter creates an exporter that reads SSH recordings from recordings.
+// It returns nil if no endpoints are configured.
+func NewExporter(cfg Config, events EventSource, sessions SessionLookup, cursors CursorStore, recordings fs.FS, log *logger.Logger) (*Exporter, error) {
+	if len(cfg.URLs) == 0 {
+		return nil, nil
+	}
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	if cfg.Interval <= 0 {
+		cfg.Interval = 10 * time.Second
+	}
+
+	client, err := newClient(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Exporter{
+		config:     cfg,
+		client:     client,
+		events:     events,
+		sessions:   sessions,
+		cursors:    cursors,
+		recordings: recordings,
+		logger:     log,
+	}, nil
+}
+
+// Start exports in the background until Stop is called
+func (e *Exporter) Start() {
+	e.loop.Start(e.run)
+}
+
+// Stop stops exporting and waits for the current batch to be abandoned.
+// It is safe to call even if the exporter was never started.
+func (e *Exporter) Stop() {
+	e.loop.Stop()
+}
+
+func (e *Exporter) run() {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		select {
+		case <-e.loop.Stopping():
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	ticker := time.NewTicker(e.config.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-e.loop.Stopping():
+			return
+		case <-ticker.C:
+			e.exportPending(ctx)
+		}
+	}
+}
+
+// exportPending exports batches until the exporter has caught up
+func (e *Exporter) exportPending(ctx context.Context) {
+	for ctx.Err() == nil {
+		more, err := e.exportBatch(ctx)
+		if err != nil {
+			if ctx.Err() == nil {
+				batchesFailed.Add(1)
+				e.logger.Error("Search export failed; retrying next interval", map[string]interface{}{
+					"error": err.Error(),
+				})
+			}
+			return
+		}
+		if !more {
+			return
+		}
+	}
+}
+
+// exportBatch indexes the next batch of events and reports whether more are waiting
+func (e *Exporter) exportBatch(ctx context.Context) (bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, batchTimeout)
+	defer cancel()
+
+	more := false
+	_, err := e.cursors.Advance(ctx, cursorName, func(lastID int64) (int64, error) {
+		events, err := e.events.ListSince(ctx, lastID, e.config.BatchSize)
+		if err != nil {
+			return lastID, err
+		}
+		if len(events) == 0 {
+			return lastID, nil
+		}
+
+		var docs []document
+		for _, event := range events {
+			docs = append(docs, e.documents(ctx, event)...)
+		}
+		if len(docs) > 0 {
+			if err := e.index(ctx, docs); err != nil {
+				return lastID, err
+			}
+		}
+
+		more = len(events) == e.config.BatchSize
+		return events[len(events)-1].ID, nil
+	})
+	return more, err
+}
+
+// documents returns the documents for an event, if it is one the exporter indexes
+func (e *Exporter) documents(ctx context.Context, event *models.Event) []document {
+	switch {
+	case strings.HasPrefix(event.Type, models.StreamEventSessionPrefix):
+		var log models.AuditLog
+		if err := json.Unmarshal(event.Payload, &log); err != nil {
+			e.skip(event, err)
+			return nil
+		}
+		// The event payload lacks fields that come from the target, such as the
+		// protocol. Indexing the current state is safe: a later event of the
+		// same session overwrites the document anyway.
+		if current, err := e.sessions.GetByID(ctx, log.ID); err == nil {
+			log = *current
+		}
+
+		docs := []document{e.sessionDocument(&log)}
+		if event.Type != models.StreamEventSessionStarted {
+			docs = append(docs, e.transcript(&log)...)
+		}
+		return docs
+
+	case strings.HasPrefix(event.Type, models.StreamEventSystemPrefix):
+		var log models.SystemAuditLog
+		if err := json.Unmarshal(event.Payload, &log); err != nil {
+			e.skip(event, err)
+			return nil
+		}
+		return []document{e.systemDocument(&log)}
+	}
+	return nil
+}
+
+// transcript returns the transcript and command documents of an ended SSH session
+func (e *Exporter) transcript(log *models.AuditLog) []document {
+	if e.recordings == nil || (log.Protocol != "" && log.Protocol != models.ProtocolSSH) {
+		return nil
+	}
+
+	t, err := transcript.Load(e.recordings, log.ID.String())
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		e.logger.Warn("Failed to render transcript for search export", map[string]interface{}{
+			"session_id": log.ID.String(),
+			"error":      err.Error(),
+		})
+		return nil
+	}
+	return e.transcriptDocuments(log, t)
+}
+
+func (e *Exporter) skip(event *models.Event, err error) {
+	e.logger.Warn("Skipping malformed event in search export", map[string]interface{}{
+		"event_id": event.ID,
+		"type":     event.Type,
+		"error":    err.Error(),
+	})
+}
+
+// index sends docs in a bulk request, retrying the request or the documents the
+// cluster asks to be retried. Documents it rejects outright, such as ones that
+// don't fit the index mapping, are logged and dropped rather than holding up
+// the export.
+func (e *Exporter) index(ctx context.Context, docs []document) error {
+	backoff := retryBackoff
+	for attempt := 0; ; attempt++ {
+		failed, err := e.client.bulk(ctx, docs)
+		if err == nil {
+			var retry []document
+			for _, f := range failed {
+				if f.retryable {
+					retry = append(retry, f.doc)
+					continue
+				}
+				documentsRejected.Add(1)
+				e.logger.Warn("Search cluster rejected document", map[string]interface{}{
+					"index":  f.doc.Index,
+					"id":     f.doc.ID,
+					"status": f.status,
+					"error":  f.reason,
+				})
+			}
+			documentsIndexed.Add(int64(len(docs) - len(failed)))
+			if len(retry) == 0 {
+				return nil
+			}
+			docs = retry
+			err = fmt.Errorf("cluster asked to retry %d documents", len(retry))
+		}
+
+		if attempt >= e.config.MaxRetries {
+			return err
+		}
+		e.logger.Warn("Retrying search export", map[string]interface{}{
+			"attempt":   attempt + 1,
+			"documents": len(docs),
+			"error":     err.Error(),
+		})
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(backoff):
+		}
+		backoff = min(backoff*2, maxBackoff)
+	}
+}
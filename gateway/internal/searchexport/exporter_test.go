@@ -0,0 +1,371 @@
+package searchexport
+
+import (
+	"bufio"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/VanCannon/openpam/gateway/internal/models"
+	"github.com/VanCannon/openpam/gateway/internal/siem"
+	"github.com/VanCannon/openpam/pkg/logger"
+	"github.com/google/uuid"
+)
+
+func init() {
+	retryBackoff = time.Millisecond
+}
+
+// memoryEvents is an EventSource backed by a slice ordered by ID
+type memoryEvents []*models.Event
+
+func (m memoryEvents) ListSince(ctx context.Context, afterID int64, limit int) ([]*models.Event, error) {
+	var result []*models.Event
+	for _, event := range m {
+		if event.ID > afterID && len(result) < limit {
+			result = append(result, event)
+		}
+	}
+	return result, nil
+}
+
+// memorySessions is a SessionLookup that knows every session's protocol
+type memorySessions map[uuid.UUID]*models.AuditLog
+
+func (m memorySessions) GetByID(ctx context.Context, id uuid.UUID) (*models.AuditLog, error) {
+	if log, ok := m[id]; ok {
+		copy := *log
+		return &copy, nil
+	}
+	return nil, fmt.Errorf("audit log not found")
+}
+
+// memoryCursor is a CursorStore holding one position
+type memoryCursor struct {
+	lastID int64
+}
+
+func (m *memoryCursor) Advance(ctx context.Context, name string, fn func(int64) (int64, error)) (bool, error) {
+	next, err := fn(m.lastID)
+	if err != nil {
+		return true, err
+	}
+	m.lastID = next
+	return true, nil
+}
+
+// cluster is a fake _bulk endpoint. respond decides the status of each item
+// of the n-th request; a nil result answers 200 with every item created.
+type cluster struct {
+	mu       sync.Mutex
+	requests int
+	indexed  map[string]map[string]interface{} // "<index>/<id>" to document
+	auth     string
+	respond  func(request int, ids []string) (status int, items []int)
+}
+
+func newCluster(t *testing.T) (*cluster, *httptest.Server) {
+	c := &cluster{indexed: make(map[string]map[string]interface{})}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		c.requests++
+		c.auth = r.Header.Get("Authorization")
+
+		if r.URL.Path != "/_bulk" || r.Header.Get("Content-Type") != "application/x-ndjson" {
+			t.Errorf("unexpected request %s %s", r.URL.Path, r.Header.Get("Content-Type"))
+		}
+
+		var keys []string
+		var docs []map[string]interface{}
+		scanner := bufio.NewScanner(r.Body)
+		scanner.Buffer(nil, 1<<20)
+		for scanner.Scan() {
+			var action map[string]map[string]string
+			if err := json.Unmarshal(scanner.Bytes(), &action); err != nil {
+				t.Fatalf("bad action line: %v", err)
+			}
+			scanner.Scan()
+			var doc map[string]interface{}
+			if err := json.Unmarshal(scanner.Bytes(), &doc); err != nil {
+				t.Fatalf("bad document line: %v", err)
+			}
+			keys = append(keys, action["index"]["_index"]+"/"+action["index"]["_id"])
+			docs = append(docs, doc)
+		}
+
+		status, statuses := http.StatusOK, []int(nil)
+		if c.respond != nil {
+			status, statuses = c.respond(c.requests, keys)
+		}
+		if status != http.StatusOK {
+			w.WriteHeader(status)
+			return
+		}
+
+		resp := bulkResponse{}
+		for i, key := range keys {
+			itemStatus := http.StatusCreated
+			if statuses != nil {
+				itemStatus = statuses[i]
+			}
+			if itemStatus < 300 {
+				c.indexed[key] = docs[i]
+			} else {
+				resp.Errors = true
+			}
+			resp.Items = append(resp.Items, map[string]struct {
+				Status int             `json:"status"`
+				Error  json.RawMessage `json:"error"`
+			}{"index": {Status: itemStatus, Error: json.RawMessage(`{"type":"test"}`)}})
+		}
+		json.NewEncoder(w).Encode(resp)
+	}))
+	t.Cleanup(srv.Close)
+	return c, srv
+}
+
+func event(t *testing.T, id int64, eventType string, payload interface{}) *models.Event {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &models.Event{ID: id, Type: eventType, Payload: data, CreatedAt: time.Now()}
+}
+
+func newTestExporter(t *testing.T, url string, events memoryEvents, sessions memorySessions, cursor *memoryCursor, recordings fstest.MapFS) *Exporter {
+	e, err := NewExporter(Config{
+		URLs:        []string{url},
+		APIKey:      "secret",
+		IndexPrefix: "openpam",
+		BatchSize:   2,
+		MaxRetries:  2,
+		Zone:        "hub",
+	}, events, sessions, cursor, recordings, logger.New(logger.LevelError, io.Discard))
+	if err != nil {
+		t.Fatalf("NewExporter: %v", err)
+	}
+	return e
+}
+
+func TestExporter_IndexesEvents(t *testing.T) {
+	c, srv := newCluster(t)
+
+	start := time.Date(2026, 3, 2, 9, 14, 5, 0, time.UTC)
+	session := &models.AuditLog{
+		ID:            uuid.New(),
+		UserID:        uuid.New(),
+		TargetID:      uuid.New(),
+		StartTime:     start,
+		SessionStatus: models.SessionStatusActive,
+		Protocol:      models.ProtocolSSH,
+	}
+	ended := *session
+	ended.SessionStatus = models.SessionStatusCompleted
+	ended.EndTime = sql.NullTime{Time: start.Add(time.Minute), Valid: true}
+	ended.Protocol = "" // Not part of the event payload
+
+	login := &models.SystemAuditLog{
+		ID:        uuid.New(),
+		Timestamp: start.Add(-time.Hour),
+		EventType: "login_success",
+		Action:    "User logged in",
+		Status:    models.AuditStatusSuccess,
+	}
+
+	events := memoryEvents{
+		event(t, 1, models.StreamEventSystemPrefix+login.EventType, login),
+		event(t, 2, models.StreamEventSessionStarted, session),
+		event(t, 4, models.StreamEventSessionPrefix+models.SessionStatusCompleted, &ended),
+		event(t, 5, "other.event", map[string]string{}),
+	}
+	current := ended
+	current.Protocol = models.ProtocolSSH
+	sessions := memorySessions{session.ID: &current}
+
+	recording := "=== SSH Session Recording ===\n" +
+		"Session ID: " + session.ID.String() + "\n" +
+		"Start Time: 2026-03-02T09:14:05Z\n" +
+		"=============================\n\n" +
+		"user@web:~$ uptime\r\n up 3 days\r\nuser@web:~$ exit\r\n"
+	recordings := fstest.MapFS{
+		session.ID.String() + "-20260302-091405.log":    {Data: []byte(recording)},
+		session.ID.String() + "-20260302-091405.timing": {Data: []byte("0 20\n2000 12\n5000 18\n")},
+	}
+
+	cursor := &memoryCursor{}
+	e := newTestExporter(t, srv.URL, events, sessions, cursor, recordings)
+	e.exportPending(context.Background())
+
+	if cursor.lastID != 5 {
+		t.Errorf("cursor = %d, want 5", cursor.lastID)
+	}
+	if c.auth != "ApiKey secret" {
+		t.Errorf("Authorization = %q", c.auth)
+	}
+
+	id := session.ID.String()
+	sessionDoc, ok := c.indexed["openpam-sessions-2026.03.02/"+id]
+	if !ok {
+		t.Fatalf("session not indexed; got %v", keys(c.indexed))
+	}
+	if sessionDoc["status"] != models.SessionStatusCompleted || sessionDoc["protocol"] != models.ProtocolSSH || sessionDoc["duration_seconds"] != 60.0 {
+		t.Errorf("session document = %v", sessionDoc)
+	}
+	if _, ok := c.indexed["openpam-system-2026.03.02/"+login.ID.String()]; !ok {
+		t.Errorf("system event not indexed; got %v", keys(c.indexed))
+	}
+
+	transcriptDoc, ok := c.indexed["openpam-transcripts-2026.03.02/"+id]
+	if !ok || transcriptDoc["commands"] != 2.0 || transcriptDoc["timed"] != true {
+		t.Errorf("transcript document = %v", transcriptDoc)
+	}
+	second, ok := c.indexed["openpam-commands-2026.03.02/"+id+"-2"]
+	if !ok || second["command"] != "exit" || second["@timestamp"] != "2026-03-02T09:14:10Z" || second["zone"] != "hub" {
+		t.Errorf("command document = %v", second)
+	}
+	if len(c.indexed) != 5 {
+		t.Errorf("indexed %d documents: %v", len(c.indexed), keys(c.indexed))
+	}
+}
+
+func TestExporter_Formats(t *testing.T) {
+	start := time.Date(2026, 3, 2, 9, 14, 5, 0, time.UTC)
+	login := &models.SystemAuditLog{
+		ID:        uuid.New(),
+		Timestamp: start,
+		EventType: models.EventTypeLoginFailed,
+		Action:    "login",
+		Status:    models.AuditStatusFailure,
+	}
+	events := memoryEvents{event(t, 1, models.StreamEventSystemPrefix+login.EventType, login)}
+	key := "openpam-system-2026.03.02/" + login.ID.String()
+
+	for _, format := range []string{siem.FormatCEF, siem.FormatOCSF} {
+		c, srv := newCluster(t)
+		e := newTestExporter(t, srv.URL, events, memorySessions{}, &memoryCursor{}, nil)
+		e.config.Format = format
+		e.exportPending(context.Background())
+
+		doc, ok := c.indexed[key]
+		if !ok {
+			t.Fatalf("%s: event not indexed; got %v", format, keys(c.indexed))
+		}
+		if doc["@timestamp"] != "2026-03-02T09:14:05Z" {
+			t.Errorf("%s: @timestamp = %v", format, doc["@timestamp"])
+		}
+		switch format {
+		case siem.FormatCEF:
+			if msg, _ := doc["message"].(string); !strings.HasPrefix(msg, "CEF:0|OpenPAM|") || !strings.Contains(msg, "|login_failed|") {
+				t.Errorf("cef document = %v", doc)
+			}
+		case siem.FormatOCSF:
+			if doc["class_uid"] != 3002.0 || doc["status_id"] != 2.0 {
+				t.Errorf("ocsf document = %v", doc)
+			}
+		}
+	}
+}
+
+func TestExporter_RetriesFailures(t *testing.T) {
+	c, srv := newCluster(t)
+	c.respond = func(request int, ids []string) (int, []int) {
+		switch request {
+		case 1:
+			return http.StatusServiceUnavailable, nil
+		case 2:
+			// The first document is throttled, the second doesn't fit the mapping
+			return http.StatusOK, []int{http.StatusTooManyRequests, http.StatusBadRequest}
+		}
+		return http.StatusOK, nil
+	}
+
+	events := memoryEvents{
+		event(t, 1, "system.login_success", &models.SystemAuditLog{ID: uuid.New(), Timestamp: time.Now()}),
+		event(t, 2, "system.logout", &models.SystemAuditLog{ID: uuid.New(), Timestamp: time.Now()}),
+	}
+	cursor := &memoryCursor{}
+	e := newTestExporter(t, srv.URL, events, memorySessions{}, cursor, nil)
+	e.exportPending(context.Background())
+
+	if c.requests != 3 {
+		t.Errorf("requests = %d, want 3", c.requests)
+	}
+	if len(c.indexed) != 1 {
+		t.Errorf("indexed %v, want the throttled document only", keys(c.indexed))
+	}
+	if cursor.lastID != 2 {
+		t.Errorf("cursor = %d, want 2", cursor.lastID)
+	}
+}
+
+func TestExporter_KeepsPositionWhenClusterIsDown(t *testing.T) {
+	c, srv := newCluster(t)
+	c.respond = func(int, []string) (int, []int) {
+		return http.StatusBadGateway, nil
+	}
+
+	events := memoryEvents{
+		event(t, 1, "system.login_success", &models.SystemAuditLog{ID: uuid.New(), Timestamp: time.Now()}),
+	}
+	cursor := &memoryCursor{}
+	e := newTestExporter(t, srv.URL, events, memorySessions{}, cursor, nil)
+	e.exportPending(context.Background())
+
+	if c.requests != 3 {
+		t.Errorf("requests = %d, want 1 plus 2 retries", c.requests)
+	}
+	if cursor.lastID != 0 {
+		t.Errorf("cursor moved to %d while the cluster was down", cursor.lastID)
+	}
+
+	// The next interval picks up from the same place
+	c.respond = nil
+	e.exportPending(context.Background())
+	if cursor.lastID != 1 || len(c.indexed) != 1 {
+		t.Errorf("cursor = %d, indexed = %v after recovery", cursor.lastID, keys(c.indexed))
+	}
+}
+
+func TestConfig_Validate(t *testing.T) {
+	valid := Config{URLs: []string{"https://es:9200"}, IndexPrefix: "openpam", BatchSize: 100}
+	if err := valid.Validate(); err != nil {
+		t.Errorf("valid config: %v", err)
+	}
+	if err := (Config{}).Validate(); err != nil {
+		t.Errorf("disabled config: %v", err)
+	}
+
+	invalid := map[string]func(*Config){
+		"endpoint":     func(c *Config) { c.URLs = []string{"es:9200"} },
+		"prefix":       func(c *Config) { c.IndexPrefix = "OpenPAM" },
+		"batch size":   func(c *Config) { c.BatchSize = 0 },
+		"two auths":    func(c *Config) { c.APIKey, c.Username = "key", "user" },
+		"missing CA":   func(c *Config) { c.CAFile = "/nonexistent/ca.pem" },
+		"empty prefix": func(c *Config) { c.IndexPrefix = "" },
+	}
+	for name, modify := range invalid {
+		cfg := valid
+		modify(&cfg)
+		if err := cfg.Validate(); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
+
+func keys(m map[string]map[string]interface{}) []string {
+	var result []string
+	for k := range m {
+		result = append(result, k)
+	}
+	return result
+}
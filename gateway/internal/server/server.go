@@ -2,21 +2,70 @@ package server
 
 import (
 	"context"
+	"errors"
+	"expvar"
 	"fmt"
 	"net/http"
 	"time"
 
+	"github.com/VanCannon/openpam/gateway/internal/adaccounts"
+	"github.com/VanCannon/openpam/gateway/internal/analytics"
+	"github.com/VanCannon/openpam/gateway/internal/approval"
+	"github.com/VanCannon/openpam/gateway/internal/auditpartition"
 	"github.com/VanCannon/openpam/gateway/internal/auth"
+	"github.com/VanCannon/openpam/gateway/internal/authfail"
+	"github.com/VanCannon/openpam/gateway/internal/build"
+	"github.com/VanCannon/openpam/gateway/internal/calendar"
+	"github.com/VanCannon/openpam/gateway/internal/certexpiry"
+	"github.com/VanCannon/openpam/gateway/internal/certification"
+	"github.com/VanCannon/openpam/gateway/internal/cloud"
 	"github.com/VanCannon/openpam/gateway/internal/config"
 	"github.com/VanCannon/openpam/gateway/internal/database"
+	"github.com/VanCannon/openpam/gateway/internal/demo"
+	"github.com/VanCannon/openpam/gateway/internal/discovery"
+	"github.com/VanCannon/openpam/gateway/internal/dualcontrol"
+	"github.com/VanCannon/openpam/gateway/internal/elevation"
+	"github.com/VanCannon/openpam/gateway/internal/ephemeral"
+	"github.com/VanCannon/openpam/gateway/internal/events"
+	"github.com/VanCannon/openpam/gateway/internal/evidence"
+	"github.com/VanCannon/openpam/gateway/internal/failover"
+	"github.com/VanCannon/openpam/gateway/internal/fingerprint"
+	"github.com/VanCannon/openpam/gateway/internal/flightrec"
 	"github.com/VanCannon/openpam/gateway/internal/handlers"
-	"github.com/VanCannon/openpam/gateway/internal/logger"
+	"github.com/VanCannon/openpam/gateway/internal/harness"
+	"github.com/VanCannon/openpam/gateway/internal/i18n"
+	"github.com/VanCannon/openpam/gateway/internal/idempotency"
+	"github.com/VanCannon/openpam/gateway/internal/keys"
+	"github.com/VanCannon/openpam/gateway/internal/license"
 	"github.com/VanCannon/openpam/gateway/internal/middleware"
 	"github.com/VanCannon/openpam/gateway/internal/models"
+	"github.com/VanCannon/openpam/gateway/internal/notice"
+	"github.com/VanCannon/openpam/gateway/internal/notify"
+	"github.com/VanCannon/openpam/gateway/internal/oncall"
+	"github.com/VanCannon/openpam/gateway/internal/policy"
+	"github.com/VanCannon/openpam/gateway/internal/protocol"
+	"github.com/VanCannon/openpam/gateway/internal/queue"
 	"github.com/VanCannon/openpam/gateway/internal/rdp"
+	"github.com/VanCannon/openpam/gateway/internal/recordings"
+	"github.com/VanCannon/openpam/gateway/internal/redact"
+	"github.com/VanCannon/openpam/gateway/internal/remediation"
+	"github.com/VanCannon/openpam/gateway/internal/reports"
 	"github.com/VanCannon/openpam/gateway/internal/repository"
+	"github.com/VanCannon/openpam/gateway/internal/schedule"
+	"github.com/VanCannon/openpam/gateway/internal/searchexport"
+	"github.com/VanCannon/openpam/gateway/internal/settings"
 	"github.com/VanCannon/openpam/gateway/internal/ssh"
+	"github.com/VanCannon/openpam/gateway/internal/targetlog"
+	"github.com/VanCannon/openpam/gateway/internal/task"
+	"github.com/VanCannon/openpam/gateway/internal/tunnel"
+	"github.com/VanCannon/openpam/gateway/internal/usage"
 	"github.com/VanCannon/openpam/gateway/internal/vault"
+	"github.com/VanCannon/openpam/gateway/internal/watch"
+	"github.com/VanCannon/openpam/gateway/internal/wsconn"
+	"github.com/VanCannon/openpam/pkg/logger"
+	"github.com/VanCannon/openpam/pkg/recovery"
+	"github.com/VanCannon/openpam/pkg/servicetoken"
+	"github.com/google/uuid"
 )
 
 // Server represents the OpenPAM gateway server
@@ -29,25 +78,50 @@ type Server struct {
 	router            *http.ServeMux
 	authHandler       *handlers.AuthHandler
 	userHandler       *handlers.UserHandler
+	dualControl       *dualcontrol.Controller
 	groupHandler      *handlers.GroupHandler
 	targetHandler     *handlers.TargetHandler
 	connectionHandler *handlers.ConnectionHandler
 	scheduleHandler   *handlers.ScheduleHandler
+	approvalHandler   *handlers.ApprovalHandler
 	tokenManager      *auth.TokenManager
+	apiKeyAuth        *auth.APIKeyAuthenticator
+	reconnectAuth     *auth.ReconnectAuthenticator
+	wsSessions        *wsconn.Tracker
 	sessionStore      auth.SessionStore
+	targetCollector   *ephemeral.Collector
+	certMonitor       *certexpiry.Monitor
+	adAccountMonitor  *adaccounts.Monitor // nil when not enabled
+	auditPartitions   *auditpartition.Manager
+	analytics         *analytics.Refresher
+	eventBroker       *events.Broker
+	reportScheduler   *reports.Scheduler
+	searchExporter    *searchexport.Exporter // nil when not configured
+	remediation       *remediation.Runner    // nil when not configured
+	watchEngine       *watch.Engine
+	discovery         *discovery.Scanner
+	campaignCloser    *certification.Closer
+	elevations        *repository.RoleElevationRepository
+	zoneAdmins        *repository.ZoneAdminRepository
+	elevationExpirer  *elevation.Expirer
+	scheduleLifecycle *schedule.Lifecycle
+	onCallSyncer      *oncall.Syncer
+	license           *license.Monitor
+	failover          *failover.Monitor
+	idempotency       *idempotency.Cache
+	usage             *usage.Meter
+	violations        *evidence.Capturer
+	satellite         *tunnel.SatelliteClient
+	stopSatellite     context.CancelFunc
+	harness           *harness.Harness // nil unless the test harness is enabled
 }
 
 // New creates a new server instance
-func New(cfg *config.Config, db *database.DB, vaultClient *vault.Client, log *logger.Logger) *Server {
+func New(cfg *config.Config, db *database.DB, vaultClient *vault.Client, signingKeys *keys.Ring, stores *auth.Stores, log *logger.Logger) *Server {
 	// Initialize authentication components
-	tokenManager := auth.NewTokenManager(cfg.Session.Secret, cfg.Session.Timeout)
-	sessionStore := auth.NewMemorySessionStore()
-	stateStore := auth.NewMemoryStateStore()
-
-	// Start session cleanup
-	ctx := context.Background()
-	sessionStore.StartCleanup(ctx, 15*time.Minute)
-	stateStore.StartCleanup(ctx, 15*time.Minute)
+	tokenManager := auth.NewKeyedTokenManager(signingKeys, cfg.Session.Secret, cfg.Session.Timeout)
+	sessionStore := stores.Sessions
+	stateStore := stores.States
 
 	// Initialize EntraID client
 	entraIDClient := auth.NewEntraIDClient(auth.EntraIDConfig{
@@ -60,34 +134,116 @@ func New(cfg *config.Config, db *database.DB, vaultClient *vault.Client, log *lo
 	// Initialize repositories
 	userRepo := repository.NewUserRepository(db)
 	groupRepo := repository.NewGroupRepository(db)
+	bannerRepo := repository.NewBannerRepository(db)
 	zoneRepo := repository.NewZoneRepository(db)
 	targetRepo := repository.NewTargetRepository(db)
 	credRepo := repository.NewCredentialRepository(db)
+	credRuleRepo := repository.NewCredentialRuleRepository(db)
+	apiKeyRepo := repository.NewAPIKeyRepository(db)
 	auditRepo := repository.NewAuditLogRepository(db)
 	systemAuditRepo := repository.NewSystemAuditLogRepository(db)
+	eventRepo := repository.NewEventRepository(db)
+	reportRepo := repository.NewReportRepository(db)
+	certRepo := repository.NewCertificationRepository(db)
+	taskRepo := repository.NewTaskRepository(db)
+	annotationRepo := repository.NewAnnotationRepository(db)
+	favoriteRepo := repository.NewFavoriteRepository(db)
+	investigationRepo := repository.NewInvestigationRepository(db)
+	evidenceRepo := repository.NewEvidenceRepository(db)
+	scheduleRepo := repository.NewScheduleRepository(db)
+	satelliteRepo := repository.NewSatelliteRepository(db)
+	recordingRepo := repository.NewRecordingRepository(db)
 
 	// Initialize protocol handlers
-	sshRecorder, err := ssh.NewRecorder("./recordings")
+	recordingCatalog := recordings.NewCatalog(recordingRepo, log)
+	var sshRecorder *ssh.Recorder
+	var rdpRecorder *rdp.Recorder
+	// The settings were validated with the config; local storage may still fail to create its directory
+	recordingStorage, err := recordings.New(cfg.RecordingStorage())
 	if err != nil {
-		log.Error("Failed to create SSH recorder", map[string]interface{}{
+		log.Error("Failed to open recording storage", map[string]interface{}{
 			"error": err.Error(),
 		})
-		sshRecorder = nil // Continue without recording
+		// Continue without recording
+	} else {
+		sshRecorder = ssh.NewRecorder(recordingStorage, recordingCatalog)
+		rdpRecorder = rdp.NewRecorder(recordingStorage, recordingCatalog)
 	}
 
-	rdpRecorder, err := rdp.NewRecorder("./recordings")
-	if err != nil {
-		log.Error("Failed to create RDP recorder", map[string]interface{}{
-			"error": err.Error(),
-		})
-		rdpRecorder = nil // Continue without recording
+	// Create session monitor for live monitoring
+	sshMonitor := ssh.NewMonitor(ssh.MonitorConfig{
+		SSH: ssh.ScrollbackLimits{MaxBytes: cfg.Monitor.SSHScrollbackBytes, MaxAge: cfg.Monitor.SSHScrollbackAge},
+		RDP: ssh.ScrollbackLimits{MaxBytes: cfg.Monitor.RDPScrollbackBytes, MaxAge: cfg.Monitor.RDPScrollbackAge},
+	})
+
+	// Outbound WebSocket behaviour shared by both proxies
+	wsConfig := wsconn.Config{
+		WriteTimeout:  cfg.WebSocket.WriteTimeout,
+		PingInterval:  cfg.WebSocket.PingInterval,
+		PongTimeout:   cfg.WebSocket.PongTimeout,
+		QueueSize:     cfg.WebSocket.QueueSize,
+		MaxBatchBytes: cfg.WebSocket.MaxBatchBytes,
+
+		CompressionThreshold: cfg.WebSocket.CompressionThreshold,
+	}
+	wsCompression := wsconn.Compression{
+		Enabled: cfg.WebSocket.Compression,
+		Level:   cfg.WebSocket.CompressionLevel,
 	}
 
-	// Create session monitor for live monitoring
-	sshMonitor := ssh.NewMonitor()
+	// Live WebSocket sessions are closed with a reconnect token on shutdown
+	wsSessions := wsconn.NewTracker()
+	// Notices such as expiry warnings reach users over their session's WebSocket
+	sessionNotices := notice.NewHub()
+	reconnectAuth := auth.NewReconnectAuthenticator(cfg.Session.Secret, cfg.WebSocket.ReconnectTTL, userRepo)
 
-	sshProxy := ssh.NewProxy(log, sshRecorder, sshMonitor)
-	rdpProxy := rdp.NewProxy("localhost:4822", log, rdpRecorder, sshMonitor) // guacd address
+	sshKeepalive := ssh.KeepaliveConfig{
+		Interval:  cfg.SSH.KeepaliveInterval,
+		MaxMissed: cfg.SSH.KeepaliveMaxMissed,
+	}
+	rdpKerberos := rdp.KerberosConfig{
+		KDCURL: cfg.RDP.KerberosKDCURL,
+	}
+
+	// Policy violations in sessions, with encrypted evidence of what led up to them.
+	// The rules and key were checked when the config was loaded.
+	dlpRules, _ := evidence.ParseRules(cfg.Evidence.DLPRules)
+	var evidenceSealer *evidence.Sealer
+	if key, err := evidence.ParseKey(cfg.Evidence.EncryptionKey); err == nil {
+		evidenceSealer, _ = evidence.NewSealer(key)
+	} else {
+		log.Warn("EVIDENCE_ENCRYPTION_KEY not set, policy violations are recorded without evidence")
+	}
+	violations := evidence.NewCapturer(evidenceRepo, systemAuditRepo, evidenceSealer, evidence.Config{
+		CaptureBytes: cfg.Evidence.CaptureBytes,
+		DLPRules:     dlpRules,
+	}, log)
+
+	sshProxy := ssh.NewProxy(log, sshRecorder, sshMonitor, wsConfig, sshKeepalive, violations)
+	// The test harness's guacd stand-in takes all RDP sessions while it runs
+	guacdAddress := "localhost:4822"
+	if cfg.Harness.Enabled {
+		guacdAddress = cfg.Harness.GuacdAddress
+	}
+	rdpProxy := rdp.NewProxy(guacdAddress, log, rdpRecorder, sshMonitor, wsConfig, cfg.Evidence.BlockRDPClipboard, rdpKerberos, violations)
+
+	// Protocols served on /api/ws/connect/{protocol}/{target_id}
+	protocols := protocol.NewRegistry()
+	protocols.Register(protocol.NewSSH(sshProxy, log))
+	protocols.Register(protocol.NewRDP(rdpProxy, log))
+
+	// Access decisions for targets and credentials
+	policyEngine := policy.NewEngine(credRuleRepo, log)
+	policyEngine.ResolveGroups(groupRepo)
+	policyEngine.ResolveUsers(userRepo)
+	settingsResolver := settings.NewResolver(zoneRepo, policyEngine)
+
+	// Expired licenses first get a grace period, then turn the gateway read-only
+	licenseMonitor := license.NewMonitor(cfg.License.URL, cfg.LicensePolicy(), cfg.License.PremiumProtocols, cfg.License.RefreshInterval, log)
+
+	// A standby stays passive while the primary is healthy and takes over when it isn't
+	failoverRepo := repository.NewFailoverRepository(db)
+	failoverMonitor := failover.New(cfg.Standby(), failoverRepo, systemAuditRepo, log)
 
 	// Initialize handlers
 	authHandler := handlers.NewAuthHandler(
@@ -102,30 +258,313 @@ func New(cfg *config.Config, db *database.DB, vaultClient *vault.Client, log *lo
 		cfg.DevMode,
 		cfg.Server.FrontendURL,
 		cfg.Identity.URL,
+		licenseMonitor,
 	)
 
 	userHandler := handlers.NewUserHandler(userRepo, log)
-	groupHandler := handlers.NewGroupHandler(groupRepo, log)
+	groupHandler := handlers.NewGroupHandler(groupRepo, userRepo, log)
 
-	targetHandler := handlers.NewTargetHandler(targetRepo, log)
+	targetHandler := handlers.NewTargetHandler(targetRepo, handlers.EphemeralTTL{
+		Default: cfg.Ephemeral.DefaultTTL,
+		Max:     cfg.Ephemeral.MaxTTL,
+	}, log)
 	zoneHandler := handlers.NewZoneHandler(zoneRepo, log)
-	credHandler := handlers.NewCredentialHandler(credRepo, log)
-	auditHandler := handlers.NewAuditLogHandler(auditRepo, sshRecorder, log)
+	zoneAdminRepo := repository.NewZoneAdminRepository(db)
+	zoneAdminHandler := handlers.NewZoneAdminHandler(zoneAdminRepo, zoneRepo, userRepo, systemAuditRepo, log)
+	credHandler := handlers.NewCredentialHandler(credRepo, targetRepo, userRepo, systemAuditRepo, policyEngine, vaultClient, log)
+	credRuleHandler := handlers.NewCredentialRuleHandler(credRuleRepo, log)
+	changeSetRepo := repository.NewChangeSetRepository(db)
+	dualControl := dualcontrol.New(changeSetRepo, systemAuditRepo, cfg.Dual.Categories, log)
+	changeSetHandler := handlers.NewChangeSetHandler(changeSetRepo, dualControl, systemAuditRepo, log)
+	policyDraftRepo := repository.NewPolicyDraftRepository(db)
+	policyDraftHandler := handlers.NewPolicyDraftHandler(policyDraftRepo, userRepo, targetRepo, credRepo, groupRepo, scheduleRepo, policyEngine, systemAuditRepo, log)
+	settingsHandler := handlers.NewSettingsHandler(targetRepo, credRepo, userRepo, policyEngine, settingsResolver, log)
+	bannerHandler := handlers.NewBannerHandler(targetRepo, bannerRepo, settingsResolver, log)
+	apiKeyHandler := handlers.NewAPIKeyHandler(apiKeyRepo, log)
+	auditHandler := handlers.NewAuditLogHandler(auditRepo, recordingRepo, recordingStorage, log)
+	annotationHandler := handlers.NewAnnotationHandler(annotationRepo, auditRepo, log)
+	favoriteHandler := handlers.NewFavoriteHandler(favoriteRepo, targetRepo, log)
+	evidenceHandler := handlers.NewEvidenceHandler(evidenceRepo, systemAuditRepo, violations, log)
+	investigationHandler := handlers.NewInvestigationHandler(investigationRepo, auditRepo, systemAuditRepo, annotationRepo, userRepo, recordingStorage, log)
 	systemAuditHandler := handlers.NewSystemAuditLogHandler(systemAuditRepo, log)
-	monitorHandler := handlers.NewMonitorHandler(auditRepo, userRepo, sshMonitor, sshRecorder, log, cfg.DevMode)
+	// Live audit events, shared across replicas through PostgreSQL LISTEN/NOTIFY
+	eventBroker := events.NewBroker(eventRepo, db.DSN(), cfg.Events.Retention, log)
+	eventStreamHandler := handlers.NewEventStreamHandler(eventBroker, cfg.Events.Heartbeat, log)
+	reportHandler := handlers.NewReportHandler(reportRepo, log)
+	// Index audit data into Elasticsearch/OpenSearch; the settings were validated with the config
+	searchExporter, _ := searchexport.NewExporter(cfg.SearchExport(), eventRepo, auditRepo,
+		repository.NewExportCursorRepository(db), recordingStorage, log)
+	// Launch AWX playbooks after sessions end or violate a policy; the settings were validated with the config
+	remediationRepo := repository.NewRemediationRepository(db)
+	remediationRunner, _ := remediation.NewRunner(cfg.Remediation(), eventRepo, repository.NewExportCursorRepository(db),
+		remediationRepo, auditRepo, targetRepo, userRepo, log)
+	remediationHandler := handlers.NewRemediationHandler(remediationRepo, log)
+	// Targets' own logs are attached to the sessions they were logged during
+	targetLogRepo := repository.NewTargetLogRepository(db)
+	targetLogCorrelator := targetlog.NewCorrelator(auditRepo, targetRepo, targetLogRepo, cfg.TargetLog.Grace, log)
+	targetLogHandler := handlers.NewTargetLogHandler(targetLogCorrelator, targetLogRepo, auditRepo, cfg.TargetLog.Token, log)
+	// Watch rules alert on audit events as they are logged
+	watchRepo := repository.NewWatchRepository(db)
+	watchHandler := handlers.NewWatchHandler(watchRepo, systemAuditRepo, log)
+
+	// Access certification campaigns close automatically once they are due
+	campaignCloser := certification.NewCloser(certRepo, systemAuditRepo, time.Minute, log)
+	certHandler := handlers.NewCertificationHandler(certRepo, userRepo, systemAuditRepo, campaignCloser, log)
+	// Time-boxed role elevations lapse on their own; the expirer records their end
+	elevationRepo := repository.NewRoleElevationRepository(db)
+	elevationExpirer := elevation.NewExpirer(elevationRepo, systemAuditRepo, time.Minute, log)
+	elevationHandler := handlers.NewElevationHandler(elevationRepo, systemAuditRepo, cfg.ElevationPolicy(), log)
+	capabilitiesHandler := handlers.NewCapabilitiesHandler(licenseMonitor, log)
+	signingKeyHandler := handlers.NewSigningKeyHandler(signingKeys)
+	failoverHandler := handlers.NewFailoverHandler(failoverMonitor, failoverRepo, log)
+	accessHandler := handlers.NewAccessHandler(userRepo, targetRepo, credRepo, scheduleRepo, bannerRepo, policyEngine, settingsResolver, licenseMonitor, log)
+	monitorHandler := handlers.NewMonitorHandler(auditRepo, userRepo, sshMonitor, sshRecorder, wsSessions, sessionNotices, reconnectAuth, log, cfg.DevMode)
+
+	// Targets at their session limit queue new sessions for a free slot
+	sessionQueue := queue.New()
+	queueHandler := handlers.NewQueueHandler(sessionQueue, targetRepo, cfg.Events.Heartbeat, log)
+
+	// Hub and satellite zones are linked by a reverse tunnel. The hub pushes signed
+	// policy bundles so a satellite can keep authorizing sessions through a WAN
+	// outage, and imports the audit the satellite recorded in the meantime. The
+	// same key signs the configuration and builds the hub pushes to satellites.
+	// Keys and zone settings were checked when the config was loaded.
+	var hub *tunnel.HubServer
+	var satellite *tunnel.SatelliteClient
+	var offline handlers.OfflineAuthorizer
+	switch cfg.Zone.Type {
+	case models.ZoneTypeHub:
+		hubSync := tunnel.HubSyncConfig{
+			Bundles:    tunnel.NewBundleBuilder(zoneRepo, targetRepo, credRepo, credRuleRepo, scheduleRepo, groupRepo, cfg.Zone.PolicyBundleTTL),
+			Interval:   cfg.Zone.PolicySyncInterval,
+			Audit:      auditRepo,
+			Management: satelliteRepo,
+
+			Diagnostics:          satelliteRepo,
+			DiagnosticsRetention: cfg.Zone.DiagnosticsRetention,
+		}
+		if cfg.Zone.PolicySigningKey != "" {
+			hubSync.SigningKey, _ = tunnel.ParseSigningKey(cfg.Zone.PolicySigningKey)
+		}
+		if cfg.Signing.Responses {
+			hubSync.Keys = signingKeys
+		}
+		hub = tunnel.NewHubServer(log, cfg.Zone.Token, hubSync)
+	case models.ZoneTypeSatellite:
+		zoneID, _ := uuid.Parse(cfg.Zone.ID)
+		verifyKey, _ := tunnel.ParseVerifyKey(cfg.Zone.PolicyVerifyKey)
+		cache := tunnel.NewPolicyCache(cfg.Zone.PolicyCachePath, zoneID, verifyKey, tunnel.OfflinePolicy(cfg.Zone.OfflinePolicy), log)
+		if cfg.Zone.HubJWKSURL != "" {
+			cache.RequireJWS(servicetoken.NewKeySet(cfg.Zone.HubJWKSURL))
+		}
+		if verifyKey == nil {
+			log.Warn("POLICY_VERIFY_KEY not set, policy bundles from the hub will be rejected")
+		} else if err := cache.Load(); err != nil {
+			log.Warn("Failed to load cached policy bundle", map[string]interface{}{
+				"error": err.Error(),
+			})
+		}
+		var updater *tunnel.Updater
+		if verifyKey != nil {
+			updater = tunnel.NewUpdater(tunnel.UpdaterConfig{
+				VerifyKey:     verifyKey,
+				ZoneID:        zoneID,
+				ConfigPath:    cfg.Zone.SatelliteConfigPath,
+				StateDir:      cfg.Zone.UpdateStateDir,
+				AutoUpdate:    cfg.Zone.AutoUpdate,
+				HealthTimeout: cfg.Zone.UpdateHealthTimeout,
+			}, log)
+		}
+		satellite = tunnel.NewSatelliteClient(cfg.Zone.HubAddress, cfg.Zone.ID, cfg.Zone.Name, cfg.Zone.Token, cache, tunnel.NewAuditSpool(cfg.Zone.OfflineAuditDir), updater, log)
+		logLevel, _ := logger.ParseLevel(cfg.Zone.LogForwardLevel)
+		satellite.ForwardDiagnostics(tunnel.DiagnosticsConfig{
+			MetricsInterval: cfg.Zone.MetricsInterval,
+			LogLevel:        logLevel,
+			LogInterval:     cfg.Zone.LogForwardInterval,
+			LogBatch:        cfg.Zone.LogForwardBatch,
+			LogBuffer:       cfg.Zone.LogForwardBuffer,
+		})
+		offline = satellite
+	}
+
+	// Sessions opened in a schedule window end with it; extensions postpone the end
+	scheduleSessions := schedule.NewSessions(scheduleRepo, log)
+
+	// Scheduled reports and approval links are emailed through the notification subsystem
+	mailer := notify.NewSMTPNotifier(notify.SMTPConfig{
+		Host:     cfg.SMTP.Host,
+		Port:     cfg.SMTP.Port,
+		Username: cfg.SMTP.Username,
+		Password: cfg.SMTP.Password,
+		From:     cfg.SMTP.From,
+	})
+
+	// Logons targets reject are counted per credential, alerted on and can quarantine it
+	authFailures := authfail.NewTracker(credRepo, systemAuditRepo, mailer, authfail.Config{
+		AlertThreshold:      cfg.AuthFail.AlertThreshold,
+		QuarantineThreshold: cfg.AuthFail.QuarantineThreshold,
+		AlertRecipients:     cfg.AuthFail.AlertRecipients,
+	}, log)
+
+	// API calls, sessions and bytes proxied are metered per user and API key,
+	// and limited by the quotas admins set
+	usageRepo := repository.NewUsageRepository(db)
+	usageMeter := usage.New(usageRepo, systemAuditRepo, userRepo, mailer, usage.Config{
+		Interval:        cfg.Usage.FlushInterval,
+		AlertRecipients: cfg.Usage.AlertRecipients,
+	}, log)
+	usageHandler := handlers.NewUsageHandler(usageRepo, apiKeyRepo, usageMeter, systemAuditRepo, log)
+
+	// Alert on AD passwords about to expire and stale AD accounts
+	var adAccountMonitor *adaccounts.Monitor
+	if cfg.ADAlerts.Enabled {
+		adAccountMonitor = adaccounts.NewMonitor(adaccounts.NewIdentityReports(cfg.Identity.URL, tokenManager),
+			repository.NewADAccountAlertRepository(db), systemAuditRepo, mailer, adaccounts.Config{
+				Interval:           cfg.ADAlerts.Interval,
+				PasswordExpiryDays: cfg.ADAlerts.PasswordExpiryDays,
+				StaleDays:          cfg.ADAlerts.StaleDays,
+				AlertRecipients:    cfg.ADAlerts.AlertRecipients,
+			}, log)
+	}
+
+	// Utilization, team and approval analytics read views refreshed in the background
+	analyticsRepo := repository.NewAnalyticsRepository(db)
+	analyticsRefresher := analytics.NewRefresher(analyticsRepo, cfg.Analytics.RefreshInterval, log)
+	workingHours := analytics.DefaultWorkingHours
+	workingHours.Start, workingHours.End = cfg.Analytics.WorkStart, cfg.Analytics.WorkEnd
+	analyticsHandler := handlers.NewAnalyticsHandler(analyticsRepo, analyticsRefresher, workingHours, log)
 
 	connectionHandler := handlers.NewConnectionHandler(
 		vaultClient,
 		targetRepo,
 		credRepo,
 		auditRepo,
-		sshProxy,
-		rdpProxy,
+		systemAuditRepo,
+		policyEngine,
+		settingsResolver,
+		offline,
+		protocols,
+		wsSessions,
+		scheduleSessions,
+		sessionNotices,
+		sessionQueue,
+		reconnectAuth,
+		wsCompression,
+		authFailures,
+		bannerRepo,
+		usageMeter,
 		log,
 	)
 
-	scheduleRepo := repository.NewScheduleRepository(db)
-	scheduleHandler := handlers.NewScheduleHandler(scheduleRepo, log)
+	// Approvers get single-use links to decide schedule requests by email or Slack
+	approvalTokens := auth.NewApprovalTokens(cfg.Session.Secret)
+	approvalChannelNames := cfg.Approvals.Channels
+	if len(approvalChannelNames) == 0 {
+		approvalChannelNames = []string{models.ApprovalChannelEmail, models.ApprovalChannelSlack}
+	}
+	approvalChannels := make(map[string]notify.Notifier)
+	for _, channel := range approvalChannelNames {
+		switch {
+		case channel == models.ApprovalChannelEmail && cfg.SMTP.Host != "":
+			approvalChannels[channel] = mailer
+		case channel == models.ApprovalChannelSlack && cfg.Slack.BotToken != "":
+			approvalChannels[channel] = notify.NewSlackNotifier(notify.SlackConfig{BotToken: cfg.Slack.BotToken})
+		}
+	}
+	approvalActionRepo := repository.NewApprovalActionRepository(db)
+	approvalNotifier := approval.NewNotifier(approvalActionRepo, userRepo, targetRepo, approvalTokens, approvalChannels, cfg.Server.FrontendURL, cfg.Approvals.LinkTTL, log)
+
+	// Requests need the approval quorum of their target's risk tier
+	riskTierRepo := repository.NewRiskTierRepository(db)
+	riskTierHandler := handlers.NewRiskTierHandler(riskTierRepo, groupRepo, systemAuditRepo, log)
+	scheduleHandler := handlers.NewScheduleHandler(scheduleRepo, riskTierRepo, systemAuditRepo, approvalNotifier, log)
+	approvalHandler := handlers.NewApprovalHandler(approvalActionRepo, scheduleRepo, userRepo, targetRepo, scheduleHandler, approvalTokens, cfg.Approvals.StepUp, log)
+
+	// Privileged tasks run pre-approved commands over SSH or WinRM
+	taskRunner := task.NewRunner(task.WinRMConfig{
+		Port:               cfg.Tasks.WinRMPort,
+		HTTPS:              cfg.Tasks.WinRMHTTPS,
+		InsecureSkipVerify: cfg.Tasks.WinRMInsecureSkipVerify,
+	}, cfg.Tasks.MaxOutputBytes)
+	taskHandler := handlers.NewTaskHandler(
+		taskRepo,
+		targetRepo,
+		credRepo,
+		scheduleRepo,
+		systemAuditRepo,
+		vaultClient,
+		policyEngine,
+		taskRunner,
+		cfg.Tasks.MaxTimeout,
+		log,
+	)
+
+	// Local account discovery and onboarding, SSH key management and LAPS, over
+	// the same SSH and WinRM executors
+	discoveryRepo := repository.NewDiscoveryRepository(db)
+	sshKeyRepo := repository.NewSSHKeyRepository(db)
+	lapsRepo := repository.NewLAPSRepository(db)
+	// Fingerprints take the OS of domain-joined hosts from the identity service's AD sync
+	fingerprintRepo := repository.NewFingerprintRepository(db)
+	prober := fingerprint.NewProber(fingerprintRepo, fingerprint.NewIdentityComputers(cfg.Identity.URL, tokenManager),
+		cfg.Discovery.FingerprintTimeout, log)
+	fingerprintHandler := handlers.NewFingerprintHandler(prober, fingerprintRepo, targetRepo, log)
+	accountScanner := discovery.NewScanner(cfg.AccountDiscovery(), discoveryRepo, sshKeyRepo, lapsRepo, targetRepo, credRepo,
+		vaultClient, taskRunner, prober, systemAuditRepo, mailer, log)
+	discoveryHandler := handlers.NewDiscoveryHandler(discoveryRepo, accountScanner, log)
+	sshKeyHandler := handlers.NewSSHKeyHandler(sshKeyRepo, accountScanner, log)
+	lapsHandler := handlers.NewLAPSHandler(accountScanner, log)
+
+	maintenanceHandler := handlers.NewMaintenanceHandler(targetRepo, scheduleRepo, systemAuditRepo, mailer, log)
+
+	scheduleExtensionHandler := handlers.NewScheduleExtensionHandler(
+		scheduleRepo,
+		repository.NewScheduleExtensionRepository(db),
+		systemAuditRepo,
+		scheduleSessions,
+		cfg.Schedules.ExtendAutoApprove,
+		cfg.Schedules.ExtendMax,
+		log,
+	)
+	scheduleBatchHandler := handlers.NewScheduleBatchHandler(scheduleRepo, riskTierRepo, userRepo, targetRepo, systemAuditRepo, scheduleSessions, log)
+
+	// On-call engineers get scheduled access to mapped zones; providers
+	// without credentials are left out
+	onCallProviders := make(map[string]oncall.Provider)
+	if cfg.OnCall.PagerDutyToken != "" {
+		onCallProviders[models.OnCallProviderPagerDuty] = oncall.NewPagerDuty(oncall.PagerDutyConfig{
+			APIToken: cfg.OnCall.PagerDutyToken,
+			APIURL:   cfg.OnCall.PagerDutyURL,
+		})
+	}
+	if cfg.OnCall.OpsgenieKey != "" {
+		onCallProviders[models.OnCallProviderOpsgenie] = oncall.NewOpsgenie(oncall.OpsgenieConfig{
+			APIKey: cfg.OnCall.OpsgenieKey,
+			APIURL: cfg.OnCall.OpsgenieURL,
+		})
+	}
+	onCallRepo := repository.NewOnCallRepository(db)
+	onCallSyncer := oncall.NewSyncer(onCallProviders, onCallRepo, scheduleRepo, userRepo, targetRepo, scheduleSessions, systemAuditRepo, cfg.OnCall.SyncInterval, cfg.OnCall.Lookahead, log)
+	onCallHandler := handlers.NewOnCallHandler(onCallRepo, zoneRepo, scheduleRepo, onCallSyncer, log)
+
+	// Cloud console targets: AWS STS role sessions and Azure PIM activations
+	cloudSessionHandler := handlers.NewCloudSessionHandler(
+		targetRepo,
+		credRepo,
+		scheduleRepo,
+		userRepo,
+		repository.NewCloudSessionRepository(db),
+		systemAuditRepo,
+		vaultClient,
+		policyEngine,
+		settingsResolver,
+		cloud.NewBroker(cfg.CloudSessions()),
+		log,
+	)
+
+	// Evaluate watch rules as audit events are logged, alerting by email
+	watchEngine := watch.NewEngine(watch.Config{Interval: cfg.Watch.Interval}, eventRepo, repository.NewExportCursorRepository(db),
+		watchRepo, targetRepo, userRepo, investigationRepo, systemAuditRepo, mailer, log)
 
 	s := &Server{
 		config:            cfg,
@@ -135,12 +574,120 @@ func New(cfg *config.Config, db *database.DB, vaultClient *vault.Client, log *lo
 		router:            http.NewServeMux(),
 		authHandler:       authHandler,
 		userHandler:       userHandler,
+		dualControl:       dualControl,
 		groupHandler:      groupHandler,
 		targetHandler:     targetHandler,
 		connectionHandler: connectionHandler,
 		scheduleHandler:   scheduleHandler,
+		approvalHandler:   approvalHandler,
 		tokenManager:      tokenManager,
+		apiKeyAuth:        auth.NewAPIKeyAuthenticator(apiKeyRepo),
+		reconnectAuth:     reconnectAuth,
+		wsSessions:        wsSessions,
 		sessionStore:      sessionStore,
+		targetCollector:   ephemeral.NewCollector(targetRepo, cfg.Ephemeral.GCInterval, cfg.Ephemeral.Retention, log),
+		certMonitor: certexpiry.NewMonitor(credRepo, systemAuditRepo, mailer, certexpiry.Config{
+			Interval:        cfg.RDP.CertificateCheckInterval,
+			Warning:         cfg.RDP.CertificateExpiryWarning,
+			AlertRecipients: cfg.RDP.CertificateAlertRecipients,
+		}, log),
+		auditPartitions: auditpartition.NewManager(repository.NewPartitionRepository(db), systemAuditRepo, auditpartition.Config{
+			Ahead:     cfg.Audit.PartitionsAhead,
+			Retention: cfg.Audit.RetentionMonths,
+		}, log),
+		analytics:         analyticsRefresher,
+		eventBroker:       eventBroker,
+		reportScheduler:   reports.NewScheduler(reportRepo, mailer, systemAuditRepo, cfg.Reports.PollInterval, cfg.Reports.AlertRecipients, log),
+		campaignCloser:    campaignCloser,
+		elevations:        elevationRepo,
+		zoneAdmins:        zoneAdminRepo,
+		elevationExpirer:  elevationExpirer,
+		scheduleLifecycle: schedule.NewLifecycle(scheduleRepo, systemAuditRepo, time.Minute, log),
+		onCallSyncer:      onCallSyncer,
+		license:           licenseMonitor,
+		failover:          failoverMonitor,
+		idempotency:       idempotency.New(repository.NewIdempotencyRepository(db), cfg.Idem.TTL, log),
+		usage:             usageMeter,
+		searchExporter:    searchExporter,
+		adAccountMonitor:  adAccountMonitor,
+		remediation:       remediationRunner,
+		watchEngine:       watchEngine,
+		discovery:         accountScanner,
+		violations:        violations,
+		satellite:         satellite,
+	}
+
+	// Synthetic SSH and RDP targets for load testing (development mode only)
+	if cfg.Harness.Enabled {
+		testHarness, err := harness.New(harness.Config{
+			SSHAddress:   cfg.Harness.SSHAddress,
+			GuacdAddress: cfg.Harness.GuacdAddress,
+		}, log)
+		if err != nil {
+			log.Error("Failed to create test harness", map[string]interface{}{
+				"error": err.Error(),
+			})
+		} else {
+			seedCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+			if _, err := testHarness.Seed(seedCtx, zoneRepo, targetRepo, credRepo); err != nil {
+				log.Error("Failed to seed synthetic targets", map[string]interface{}{
+					"error": err.Error(),
+				})
+			}
+			cancel()
+
+			s.harness = testHarness
+			harnessHandler := handlers.NewHarnessHandler(wsSessions)
+			s.router.Handle("GET /api/v1/harness/stats", s.requireRole(models.RoleAdmin, harnessHandler.HandleStats()))
+		}
+	}
+
+	// Demo data for evaluators (development mode only)
+	if cfg.Demo.Seed {
+		seeder := demo.New(demo.Stores{
+			Zones:       zoneRepo,
+			Targets:     targetRepo,
+			Credentials: credRepo,
+			Users:       userRepo,
+			Schedules:   scheduleRepo,
+			Audit:       auditRepo,
+			Recordings:  recordingRepo,
+			Records:     repository.NewDemoRepository(db),
+		}, recordingStorage, cfg.DemoSeed())
+		seedCtx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		summary, err := seeder.Seed(seedCtx)
+		cancel()
+		switch {
+		case errors.Is(err, demo.ErrSeeded):
+		case err != nil:
+			log.Error("Failed to seed demo data", map[string]interface{}{
+				"error": err.Error(),
+			})
+		default:
+			log.Warn("Seeded demo data; remove it with make demo-remove", map[string]interface{}{
+				"targets":  summary.Targets,
+				"users":    summary.Users,
+				"sessions": summary.Sessions,
+			})
+		}
+	}
+
+	// Satellites connect here; without a shared token the endpoint stays off
+	if hub != nil && cfg.Zone.Token != "" {
+		s.router.Handle("GET /api/tunnel", hub.HandleSatelliteConnection())
+	}
+
+	// Satellite configuration and staged updates (admin only, hub only)
+	if hub != nil {
+		satelliteHandler := handlers.NewSatelliteHandler(satelliteRepo, zoneRepo, systemAuditRepo, hub, log)
+		s.router.Handle("GET /api/v1/satellites", s.requireRole(models.RoleAdmin, satelliteHandler.HandleList()))
+		s.router.Handle("GET /api/v1/zones/{id}/diagnostics", s.requireRole(models.RoleAdmin, satelliteHandler.HandleDiagnostics()))
+		s.router.Handle("/api/v1/zones/{id}/satellite-config", s.requireRole(models.RoleAdmin, satelliteHandler.HandleConfig()))
+		s.router.Handle("/api/v1/satellite-rollouts", s.requireRole(models.RoleAdmin, satelliteHandler.HandleRollouts()))
+		s.router.Handle("GET /api/v1/satellite-rollouts/{id}", s.requireRole(models.RoleAdmin, satelliteHandler.HandleGetRollout()))
+		s.router.Handle("POST /api/v1/satellite-rollouts/{id}/pause", s.requireRole(models.RoleAdmin, satelliteHandler.HandlePause()))
+		s.router.Handle("POST /api/v1/satellite-rollouts/{id}/resume", s.requireRole(models.RoleAdmin, satelliteHandler.HandleResume()))
+		s.router.Handle("POST /api/v1/satellite-rollouts/{id}/cancel", s.requireRole(models.RoleAdmin, satelliteHandler.HandleCancel()))
 	}
 
 	// Zone routes - support both GET and POST on /api/v1/zones
@@ -159,34 +706,328 @@ func New(cfg *config.Config, db *database.DB, vaultClient *vault.Client, log *lo
 	s.router.Handle("/api/v1/zones/update", s.requireAuth(zoneHandler.HandleUpdate()))
 	s.router.Handle("/api/v1/zones/delete", s.requireAuth(zoneHandler.HandleDelete()))
 
-	s.router.Handle("/api/v1/targets/create", s.requireAuth(targetHandler.HandleCreate()))
+	// Zone admins manage the targets, credentials and schedules of their zones (assigned by admins)
+	s.router.Handle("GET /api/v1/zones/{id}/admins", s.requireRole(models.RoleAdmin, zoneAdminHandler.HandleList()))
+	s.router.Handle("POST /api/v1/zones/{id}/admins", s.requireRole(models.RoleAdmin, zoneAdminHandler.HandleAssign()))
+	s.router.Handle("DELETE /api/v1/zones/{id}/admins/{user_id}", s.requireRole(models.RoleAdmin, zoneAdminHandler.HandleRemove()))
+
+	// Creates sent with an Idempotency-Key header are safe to retry
+	s.router.Handle("/api/v1/targets/create", s.requireAuth(s.idempotency.Wrap(targetHandler.HandleCreate())))
 	s.router.Handle("/api/v1/targets/get", s.requireAuth(targetHandler.HandleGet()))
 	s.router.Handle("/api/v1/targets/update", s.requireAuth(targetHandler.HandleUpdate()))
 	s.router.Handle("/api/v1/targets/delete", s.requireAuth(targetHandler.HandleDelete()))
+	s.router.Handle("/api/v1/targets/ephemeral", s.requireAuth(s.idempotency.Wrap(targetHandler.HandleCreateEphemeral())))
 
 	s.router.Handle("/api/v1/credentials", s.requireAuth(credHandler.HandleListByTarget()))
-	s.router.Handle("/api/v1/credentials/create", s.requireAuth(credHandler.HandleCreate()))
-	s.router.Handle("/api/v1/credentials/update", s.requireAuth(credHandler.HandleUpdate()))
-	s.router.Handle("/api/v1/credentials/delete", s.requireAuth(credHandler.HandleDelete()))
+	s.router.Handle("/api/v1/credentials/create", s.requireAuth(s.idempotency.Wrap(dualControl.Guard("/api/v1/credentials/create", credHandler.HandleCreate(),
+		dualcontrol.Kind{Method: http.MethodPost, Category: models.ChangeCategoryCredentials, Name: models.ChangeKindCredentialCreate, Check: credHandler.CheckZone}))))
+	s.router.Handle("/api/v1/credentials/update", s.requireAuth(dualControl.Guard("/api/v1/credentials/update", credHandler.HandleUpdate(),
+		dualcontrol.Kind{Method: http.MethodPut, Category: models.ChangeCategoryCredentials, Name: models.ChangeKindCredentialUpdate, Current: credHandler.Current, Check: credHandler.CheckZone})))
+	s.router.Handle("/api/v1/credentials/delete", s.requireAuth(dualControl.Guard("/api/v1/credentials/delete", credHandler.HandleDelete(),
+		dualcontrol.Kind{Method: http.MethodDelete, Category: models.ChangeCategoryCredentials, Name: models.ChangeKindCredentialDelete, Current: credHandler.Current, Check: credHandler.CheckZone})))
+	s.router.Handle("PUT /api/v1/credentials/{id}/certificate", s.requireRole(models.RoleAdmin, credHandler.HandleSetCertificate()))
+	s.router.Handle("DELETE /api/v1/credentials/{id}/quarantine", s.requireRole(models.RoleAdmin, credHandler.HandleRelease()))
+	s.router.Handle("GET /api/v1/targets/{id}/credentials", s.requireAuth(credHandler.HandleListAllowed()))
+	s.router.Handle("GET /api/v1/targets/{id}/effective-settings", s.requireAuth(settingsHandler.HandleEffective()))
+	s.router.Handle("GET /api/v1/targets/{id}/banner", s.requireAuth(bannerHandler.HandleGet()))
+	s.router.Handle("POST /api/v1/targets/{id}/banner/acknowledge", s.requireAuth(bannerHandler.HandleAcknowledge()))
+	s.router.Handle("GET /api/v1/targets/{id}/queue", s.requireAuth(queueHandler.HandleStream()))
+
+	// The current user's favorite and recently used targets for their launcher
+	s.router.Handle("GET /api/v1/favorites", s.requireAuth(favoriteHandler.HandleList()))
+	s.router.Handle("PUT /api/v1/favorites/{target_id}", s.requireAuth(favoriteHandler.HandleAdd()))
+	s.router.Handle("DELETE /api/v1/favorites/{target_id}", s.requireAuth(favoriteHandler.HandleRemove()))
+	s.router.Handle("GET /api/v1/targets/recent", s.requireAuth(favoriteHandler.HandleRecent()))
+
+	// API keys for automation (admin only)
+	s.router.Handle("/api/v1/api-keys", s.requireRole(models.RoleAdmin, apiKeyHandler.HandleKeys()))
+	s.router.Handle("/api/v1/api-keys/{id}", s.requireRole(models.RoleAdmin, apiKeyHandler.HandleRevoke()))
+
+	// Daily usage: users see their own, admins and auditors anyone's; admins set quotas
+	s.router.Handle("GET /api/v1/usage", s.requireAuth(usageHandler.HandleList()))
+	s.router.Handle("GET /api/v1/usage/quotas", s.requireRole(models.RoleAdmin, usageHandler.HandleListQuotas()))
+	s.router.Handle("POST /api/v1/usage/quotas", s.requireRole(models.RoleAdmin, usageHandler.HandleCreateQuota()))
+	s.router.Handle("DELETE /api/v1/usage/quotas/{id}", s.requireRole(models.RoleAdmin, usageHandler.HandleDeleteQuota()))
+
+	// Analytics (admin and auditor only); admins can refresh them right away
+	s.router.Handle("GET /api/v1/analytics/utilization", s.requireAnyRole([]string{models.RoleAdmin, models.RoleAuditor}, analyticsHandler.HandleUtilization()))
+	s.router.Handle("GET /api/v1/analytics/teams", s.requireAnyRole([]string{models.RoleAdmin, models.RoleAuditor}, analyticsHandler.HandleTeams()))
+	s.router.Handle("GET /api/v1/analytics/approvals", s.requireAnyRole([]string{models.RoleAdmin, models.RoleAuditor}, analyticsHandler.HandleApprovals()))
+	s.router.Handle("POST /api/v1/analytics/refresh", s.requireRole(models.RoleAdmin, analyticsHandler.HandleRefresh()))
+
+	// Credential access rules (admin only)
+	s.router.Handle("/api/v1/credential-rules", s.requireRole(models.RoleAdmin, dualControl.Guard("/api/v1/credential-rules", credRuleHandler.HandleRules(),
+		dualcontrol.Kind{Method: http.MethodPost, Category: models.ChangeCategoryCredentialRules, Name: models.ChangeKindCredentialRuleCreate})))
+	s.router.Handle("/api/v1/credential-rules/{id}", s.requireRole(models.RoleAdmin, dualControl.Guard("/api/v1/credential-rules/{id}", credRuleHandler.HandleRule(),
+		dualcontrol.Kind{Method: http.MethodPut, Category: models.ChangeCategoryCredentialRules, Name: models.ChangeKindCredentialRuleUpdate, Current: credRuleHandler.Current},
+		dualcontrol.Kind{Method: http.MethodDelete, Category: models.ChangeCategoryCredentialRules, Name: models.ChangeKindCredentialRuleDelete, Current: credRuleHandler.Current})))
+
+	// Drafts of the credential rules, evaluated against real users and targets before publishing (admin only)
+	s.router.Handle("GET /api/v1/policy-drafts", s.requireRole(models.RoleAdmin, policyDraftHandler.HandleList()))
+	s.router.Handle("POST /api/v1/policy-drafts", s.requireRole(models.RoleAdmin, policyDraftHandler.HandleCreate()))
+	s.router.Handle("GET /api/v1/policy-drafts/{id}", s.requireRole(models.RoleAdmin, policyDraftHandler.HandleGet()))
+	s.router.Handle("PUT /api/v1/policy-drafts/{id}", s.requireRole(models.RoleAdmin, policyDraftHandler.HandleUpdate()))
+	s.router.Handle("DELETE /api/v1/policy-drafts/{id}", s.requireRole(models.RoleAdmin, policyDraftHandler.HandleDiscard()))
+	s.router.Handle("POST /api/v1/policy-drafts/{id}/evaluate", s.requireRole(models.RoleAdmin, policyDraftHandler.HandleEvaluateDraft()))
+	s.router.Handle("POST /api/v1/policy-drafts/{id}/publish", s.requireRole(models.RoleAdmin, dualControl.Guard("POST /api/v1/policy-drafts/{id}/publish", policyDraftHandler.HandlePublish(),
+		dualcontrol.Kind{Method: http.MethodPost, Category: models.ChangeCategoryCredentialRules, Name: models.ChangeKindPolicyPublish})))
+	s.router.Handle("POST /api/v1/policy/evaluate", s.requireRole(models.RoleAdmin, policyDraftHandler.HandleEvaluate()))
+
+	// Changes staged under dual control, for a second admin to approve or reject
+	s.router.Handle("GET /api/v1/change-sets", s.requireRole(models.RoleAdmin, changeSetHandler.HandleList()))
+	s.router.Handle("GET /api/v1/change-sets/{id}", s.requireRole(models.RoleAdmin, changeSetHandler.HandleGet()))
+	s.router.Handle("POST /api/v1/change-sets/{id}/approve", s.requireRole(models.RoleAdmin, changeSetHandler.HandleApprove()))
+	s.router.Handle("POST /api/v1/change-sets/{id}/reject", s.requireRole(models.RoleAdmin, changeSetHandler.HandleReject()))
+
+	// Watch rules over the audit events, and the alerts they raised
+	s.router.Handle("GET /api/v1/watch-rules", s.requireAnyRole([]string{models.RoleAdmin, models.RoleAuditor}, watchHandler.HandleList()))
+	s.router.Handle("POST /api/v1/watch-rules", s.requireRole(models.RoleAdmin, watchHandler.HandleCreate()))
+	s.router.Handle("PUT /api/v1/watch-rules/{id}", s.requireRole(models.RoleAdmin, watchHandler.HandleUpdate()))
+	s.router.Handle("DELETE /api/v1/watch-rules/{id}", s.requireRole(models.RoleAdmin, watchHandler.HandleDelete()))
+	s.router.Handle("GET /api/v1/watch-alerts", s.requireAnyRole([]string{models.RoleAdmin, models.RoleAuditor}, watchHandler.HandleListAlerts()))
 
 	s.router.Handle("/api/v1/audit-logs", s.requireAuth(auditHandler.HandleList()))
 	s.router.Handle("/api/v1/audit-logs/", s.requireAuth(auditHandler.HandleGet()))
 	s.router.Handle("/api/v1/audit-logs/user", s.requireAuth(auditHandler.HandleListByUser()))
 	s.router.Handle("/api/v1/audit-logs/active", s.requireAuth(auditHandler.HandleListActive()))
 	s.router.Handle("/api/v1/audit-logs/recording", s.requireAuth(auditHandler.HandleGetRecording()))
+	s.router.Handle("GET /api/v1/recordings", s.requireAnyRole([]string{models.RoleAdmin, models.RoleAuditor}, auditHandler.HandleListRecordings()))
+	s.router.Handle("GET /api/v1/recordings/missing", s.requireAnyRole([]string{models.RoleAdmin, models.RoleAuditor}, auditHandler.HandleListUnrecorded()))
+
+	// Session annotations and bookmarks (admin and auditor only)
+	s.router.Handle("GET /api/v1/audit-logs/{id}/annotations", s.requireAnyRole([]string{models.RoleAdmin, models.RoleAuditor}, annotationHandler.HandleList()))
+	s.router.Handle("POST /api/v1/audit-logs/{id}/annotations", s.requireAnyRole([]string{models.RoleAdmin, models.RoleAuditor}, annotationHandler.HandleCreate()))
+	s.router.Handle("PUT /api/v1/annotations/{id}", s.requireAnyRole([]string{models.RoleAdmin, models.RoleAuditor}, annotationHandler.HandleUpdate()))
+	s.router.Handle("DELETE /api/v1/annotations/{id}", s.requireAnyRole([]string{models.RoleAdmin, models.RoleAuditor}, annotationHandler.HandleDelete()))
+
+	// Evidence captured on policy violations (admin and auditor only)
+	s.router.Handle("GET /api/v1/audit-logs/{id}/transcript", s.requireAnyRole([]string{models.RoleAdmin, models.RoleAuditor}, auditHandler.HandleGetTranscript()))
+	s.router.Handle("GET /api/v1/audit-logs/{id}/evidence", s.requireAnyRole([]string{models.RoleAdmin, models.RoleAuditor}, evidenceHandler.HandleListBySession()))
+	s.router.Handle("GET /api/v1/evidence/{id}", s.requireAnyRole([]string{models.RoleAdmin, models.RoleAuditor}, evidenceHandler.HandleGet()))
+
+	// AWX remediation jobs launched for a session, and their results
+	s.router.Handle("GET /api/v1/audit-logs/{id}/remediations", s.requireAnyRole([]string{models.RoleAdmin, models.RoleAuditor}, remediationHandler.HandleListBySession()))
+
+	// Lines of the target's own logs matched to a session (admin and auditor only).
+	// Targets forward them with a shared token; without one the endpoint stays off.
+	s.router.Handle("GET /api/v1/audit-logs/{id}/target-logs", s.requireAnyRole([]string{models.RoleAdmin, models.RoleAuditor}, targetLogHandler.HandleListBySession()))
+	if cfg.TargetLog.Token != "" {
+		s.router.Handle("POST /api/v1/target-logs", targetLogHandler.HandleIngest())
+	}
+
+	// Investigations grouping sessions, events, annotations and notes (admin and auditor only)
+	s.router.Handle("GET /api/v1/investigations", s.requireAnyRole([]string{models.RoleAdmin, models.RoleAuditor}, investigationHandler.HandleList()))
+	s.router.Handle("POST /api/v1/investigations", s.requireAnyRole([]string{models.RoleAdmin, models.RoleAuditor}, investigationHandler.HandleCreate()))
+	s.router.Handle("GET /api/v1/investigations/{id}", s.requireAnyRole([]string{models.RoleAdmin, models.RoleAuditor}, investigationHandler.HandleGet()))
+	s.router.Handle("PUT /api/v1/investigations/{id}", s.requireAnyRole([]string{models.RoleAdmin, models.RoleAuditor}, investigationHandler.HandleUpdate()))
+	s.router.Handle("POST /api/v1/investigations/{id}/items", s.requireAnyRole([]string{models.RoleAdmin, models.RoleAuditor}, investigationHandler.HandleAddItem()))
+	s.router.Handle("DELETE /api/v1/investigations/{id}/items/{item_id}", s.requireAnyRole([]string{models.RoleAdmin, models.RoleAuditor}, investigationHandler.HandleRemoveItem()))
+	s.router.Handle("GET /api/v1/investigations/{id}/export", s.requireAnyRole([]string{models.RoleAdmin, models.RoleAuditor}, investigationHandler.HandleExport()))
 
 	// System audit logs (admin and auditor only)
 	s.router.Handle("/api/v1/system-audit-logs", s.requireAuth(systemAuditHandler.HandleList()))
 	s.router.Handle("/api/v1/system-audit-logs/", s.requireAuth(systemAuditHandler.HandleGet()))
 
+	// Live audit and system audit event stream (admin and auditor only)
+	s.router.Handle("GET /api/v1/events/stream", s.requireAnyRole([]string{models.RoleAdmin, models.RoleAuditor}, eventStreamHandler.HandleStream()))
+
+	// Scheduled reports (admin and auditor only)
+	reportRoles := []string{models.RoleAdmin, models.RoleAuditor}
+	s.router.Handle("/api/v1/reports", s.requireAnyRole(reportRoles, reportHandler.HandleReports()))
+	s.router.Handle("/api/v1/reports/{id}", s.requireAnyRole(reportRoles, reportHandler.HandleReport()))
+	s.router.Handle("POST /api/v1/reports/{id}/run", s.requireAnyRole(reportRoles, reportHandler.HandleRunNow()))
+	s.router.Handle("GET /api/v1/reports/{id}/runs", s.requireAnyRole(reportRoles, reportHandler.HandleListRuns()))
+
+	// Access certification campaigns. Admins launch and close campaigns, auditors
+	// can follow them and export evidence, and any user can be a reviewer.
+	certRoles := []string{models.RoleAdmin, models.RoleAuditor}
+	s.router.Handle("/api/v1/certifications", s.requireRole(models.RoleAdmin, certHandler.HandleCampaigns()))
+	s.router.Handle("GET /api/v1/certifications/my-items", s.requireAuth(certHandler.HandleMyItems()))
+	s.router.Handle("POST /api/v1/certifications/items/{id}/decision", s.requireAuth(certHandler.HandleDecide()))
+	s.router.Handle("GET /api/v1/certifications/{id}", s.requireAnyRole(certRoles, certHandler.HandleGet()))
+	s.router.Handle("GET /api/v1/certifications/{id}/items", s.requireAnyRole(certRoles, certHandler.HandleListItems()))
+	s.router.Handle("GET /api/v1/certifications/{id}/report", s.requireAnyRole(certRoles, certHandler.HandleReport()))
+	s.router.Handle("POST /api/v1/certifications/{id}/close", s.requireRole(models.RoleAdmin, certHandler.HandleClose()))
+
+	// Time-boxed role elevation
+	s.router.Handle("/api/v1/elevations", s.requireAuth(elevationHandler.HandleElevations()))
+	s.router.Handle("GET /api/v1/elevations/{id}", s.requireAuth(elevationHandler.HandleGet()))
+	s.router.Handle("POST /api/v1/elevations/{id}/approve", s.requireRole(models.RoleAdmin, elevationHandler.HandleApprove()))
+	s.router.Handle("POST /api/v1/elevations/{id}/reject", s.requireRole(models.RoleAdmin, elevationHandler.HandleReject()))
+	s.router.Handle("POST /api/v1/elevations/{id}/revoke", s.requireAuth(elevationHandler.HandleRevoke()))
+
+	// What the gateway allows under the current license, with the banner to show
+	capabilities := capabilitiesHandler.HandleGet()
+	if cfg.Signing.Responses {
+		// Signed, so a proxy in front of the gateway cannot spoof entitlements
+		capabilities = signingKeys.Middleware(capabilities).ServeHTTP
+	}
+	s.router.Handle("GET /api/v1/capabilities", s.requireAuth(capabilities))
+
+	// Public keys that verify session tokens and other signed artifacts
+	s.router.Handle("GET /.well-known/jwks.json", signingKeyHandler.HandleJWKS())
+	s.router.Handle("GET /api/v1/signing-keys", s.requireRole(models.RoleAdmin, signingKeyHandler.HandleList()))
+
+	// This gateway's role and state in an active/standby pair, with the failover history
+	s.router.Handle("GET /api/v1/admin/failover", s.requireRole(models.RoleAdmin, failoverHandler.HandleGet()))
+
+	// Why a user can or can't connect to a target; users ask about themselves
+	s.router.Handle("GET /api/v1/access/explain", s.requireAuth(accessHandler.HandleExplain()))
+
+	// Optional read-only GraphQL endpoint over the same repositories; fields
+	// apply the REST API's access rules
+	if cfg.GraphQL.Enabled {
+		graphqlHandler := handlers.NewGraphQLHandler(zoneRepo, targetRepo, credRepo, auditRepo, scheduleRepo, cfg.GraphQL.MaxDepth, log)
+		s.router.Handle("POST /api/v1/graphql", s.requireAuth(graphqlHandler.HandleQuery()))
+		s.router.Handle("GET /api/v1/graphql", s.requireAuth(graphqlHandler.HandleSchema()))
+	}
+
+	// Enumeration labels and API messages in the caller's language; no auth, so
+	// clients can localize the sign-in page
+	enumHandler := handlers.NewEnumHandler()
+	s.router.HandleFunc("GET /api/v1/enums", enumHandler.HandleList())
+	s.router.HandleFunc("GET /api/v1/enums/{name}", enumHandler.HandleGet())
+	s.router.HandleFunc("GET /api/v1/messages", enumHandler.HandleMessages())
+
+	// Privileged tasks. Admins define them; any user can run them subject to their
+	// schedule windows and credential rules.
+	s.router.Handle("GET /api/v1/tasks", s.requireAuth(taskHandler.HandleList()))
+	s.router.Handle("POST /api/v1/tasks", s.requireRole(models.RoleAdmin, taskHandler.HandleCreate()))
+	s.router.Handle("GET /api/v1/tasks/{id}", s.requireAuth(taskHandler.HandleGet()))
+	s.router.Handle("PUT /api/v1/tasks/{id}", s.requireRole(models.RoleAdmin, taskHandler.HandleUpdate()))
+	s.router.Handle("DELETE /api/v1/tasks/{id}", s.requireRole(models.RoleAdmin, taskHandler.HandleDelete()))
+	s.router.Handle("POST /api/v1/tasks/{id}/execute", s.requireAuth(taskHandler.HandleExecute()))
+	s.router.Handle("GET /api/v1/tasks/{id}/executions", s.requireAnyRole([]string{models.RoleAdmin, models.RoleAuditor}, taskHandler.HandleListExecutions()))
+	s.router.Handle("GET /api/v1/task-executions/{id}", s.requireAuth(taskHandler.HandleGetExecution()))
+
+	// Local account discovery and onboarding of the accounts found (admin only)
+	s.router.Handle("POST /api/v1/targets/{id}/discovery-scans", s.requireRole(models.RoleAdmin, discoveryHandler.HandleStartScan()))
+	s.router.Handle("GET /api/v1/targets/{id}/discovery-scans", s.requireRole(models.RoleAdmin, discoveryHandler.HandleListScans()))
+	s.router.Handle("GET /api/v1/discovered-accounts", s.requireRole(models.RoleAdmin, discoveryHandler.HandleListAccounts()))
+	s.router.Handle("POST /api/v1/discovered-accounts/{id}/onboard", s.requireRole(models.RoleAdmin, discoveryHandler.HandleOnboard()))
+	s.router.Handle("POST /api/v1/discovered-accounts/{id}/rotate", s.requireRole(models.RoleAdmin, discoveryHandler.HandleRotate()))
+
+	// Fingerprinting of hosts and targets (admin only; auditors can read the stored fingerprints)
+	s.router.Handle("POST /api/v1/fingerprints", s.requireRole(models.RoleAdmin, fingerprintHandler.HandleProbe()))
+	s.router.Handle("GET /api/v1/fingerprints", s.requireAnyRole([]string{models.RoleAdmin, models.RoleAuditor}, fingerprintHandler.HandleListFingerprints()))
+	s.router.Handle("POST /api/v1/targets/{id}/fingerprint", s.requireRole(models.RoleAdmin, fingerprintHandler.HandleProbeTarget()))
+	s.router.Handle("GET /api/v1/targets/{id}/fingerprint", s.requireAnyRole([]string{models.RoleAdmin, models.RoleAuditor}, fingerprintHandler.HandleGetTargetFingerprint()))
+
+	// SSH key management on targets and authorized_keys drift (admin only)
+	s.router.Handle("GET /api/v1/ssh-keys", s.requireRole(models.RoleAdmin, sshKeyHandler.HandleListKeys()))
+	s.router.Handle("POST /api/v1/targets/{id}/ssh-keys", s.requireRole(models.RoleAdmin, sshKeyHandler.HandleDeploy()))
+	s.router.Handle("POST /api/v1/ssh-keys/{id}/rotate", s.requireRole(models.RoleAdmin, sshKeyHandler.HandleRotate()))
+	s.router.Handle("DELETE /api/v1/ssh-keys/{id}", s.requireRole(models.RoleAdmin, sshKeyHandler.HandleRemove()))
+	s.router.Handle("GET /api/v1/ssh-key-drift", s.requireRole(models.RoleAdmin, sshKeyHandler.HandleListDrift()))
+	s.router.Handle("POST /api/v1/ssh-key-drift/{id}/approve", s.requireRole(models.RoleAdmin, sshKeyHandler.HandleApproveDrift()))
+	s.router.Handle("POST /api/v1/ssh-key-drift/{id}/revert", s.requireRole(models.RoleAdmin, sshKeyHandler.HandleRevertDrift()))
+
+	// LAPS-style Administrator password rotation on Windows targets (admin only;
+	// auditors can see which machines are overdue but not read passwords)
+	s.router.Handle("GET /api/v1/laps/machines", s.requireAnyRole([]string{models.RoleAdmin, models.RoleAuditor}, lapsHandler.HandleList()))
+	s.router.Handle("POST /api/v1/laps/machines", s.requireRole(models.RoleAdmin, lapsHandler.HandleEnroll()))
+	s.router.Handle("GET /api/v1/laps/machines/{id}", s.requireAnyRole([]string{models.RoleAdmin, models.RoleAuditor}, lapsHandler.HandleGet()))
+	s.router.Handle("DELETE /api/v1/laps/machines/{id}", s.requireRole(models.RoleAdmin, lapsHandler.HandleUnenroll()))
+	s.router.Handle("POST /api/v1/laps/machines/{id}/rotate", s.requireRole(models.RoleAdmin, lapsHandler.HandleRotate()))
+	s.router.Handle("POST /api/v1/laps/machines/{id}/password", s.requireRole(models.RoleAdmin, lapsHandler.HandleRetrieve()))
+
+	// Target maintenance windows; everyone can see them on the schedule calendar
+	s.router.Handle("PATCH /api/v1/targets/{id}/maintenance", s.requireRole(models.RoleAdmin, maintenanceHandler.HandleSet()))
+	s.router.Handle("GET /api/v1/schedules/maintenance", s.requireAuth(maintenanceHandler.HandleCalendar()))
+
+	// Calendar feeds of users' access windows; calendar apps fetch them with the
+	// signed token in the feed URL instead of signing in
+	calendarHandler := handlers.NewCalendarHandler(
+		repository.NewCalendarFeedRepository(db),
+		scheduleRepo,
+		userRepo,
+		zoneAdminRepo,
+		calendar.NewBuilder(targetRepo, userRepo, cfg.Server.FrontendURL),
+		auth.NewCalendarTokens(cfg.Session.Secret),
+		cfg.Server.FrontendURL,
+		log,
+	)
+	s.router.Handle("GET /api/v1/schedules/calendar-feed", s.requireAuth(calendarHandler.HandleGetFeed()))
+	s.router.Handle("POST /api/v1/schedules/calendar-feed", s.requireAuth(calendarHandler.HandleCreateFeed()))
+	s.router.Handle("DELETE /api/v1/schedules/calendar-feed", s.requireAuth(calendarHandler.HandleDeleteFeed()))
+	s.router.Handle("GET /api/v1/schedules/calendar.ics", calendarHandler.HandleServeFeed())
+
+	// Schedule extensions; owners extend their running schedules and admins
+	// decide the ones longer than the auto-approval limit
+	s.router.Handle("POST /api/v1/schedules/{id}/extend", s.requireAuth(scheduleExtensionHandler.HandleExtend()))
+	s.router.Handle("GET /api/v1/schedules/{id}/extensions", s.requireAuth(scheduleExtensionHandler.HandleList()))
+	s.router.Handle("GET /api/v1/schedules/extensions", s.requireRole(models.RoleAdmin, scheduleExtensionHandler.HandleListPending()))
+	s.router.Handle("POST /api/v1/schedules/extensions/{id}/approve", s.requireRole(models.RoleAdmin, scheduleExtensionHandler.HandleApprove()))
+	s.router.Handle("POST /api/v1/schedules/extensions/{id}/reject", s.requireRole(models.RoleAdmin, scheduleExtensionHandler.HandleReject()))
+
+	// Bulk schedules for teams; linked batches are approved or revoked as a whole
+	s.router.Handle("POST /api/v1/schedules/bulk", s.requireRole(models.RoleAdmin, s.idempotency.Wrap(scheduleBatchHandler.HandleBulkCreate())))
+	s.router.Handle("GET /api/v1/schedule-batches/{id}", s.requireRole(models.RoleAdmin, scheduleBatchHandler.HandleGetBatch()))
+	s.router.Handle("POST /api/v1/schedule-batches/{id}/approve", s.requireRole(models.RoleAdmin, scheduleBatchHandler.HandleApproveBatch()))
+	s.router.Handle("POST /api/v1/schedule-batches/{id}/revoke", s.requireRole(models.RoleAdmin, scheduleBatchHandler.HandleRevokeBatch()))
+
+	// Risk tiers of targets and the approval quorums their requests need
+	s.router.Handle("GET /api/v1/risk-tiers", s.requireAnyRole([]string{models.RoleAdmin, models.RoleAuditor}, riskTierHandler.HandleList()))
+	s.router.Handle("PUT /api/v1/risk-tiers/{tier}/quorum", s.requireRole(models.RoleAdmin, riskTierHandler.HandleUpdateQuorum()))
+	s.router.Handle("PUT /api/v1/risk-tier-labels", s.requireRole(models.RoleAdmin, riskTierHandler.HandleSetLabel()))
+	s.router.Handle("DELETE /api/v1/risk-tier-labels", s.requireRole(models.RoleAdmin, riskTierHandler.HandleDeleteLabel()))
+
+	// On-call mappings (admin only); each keeps schedules for its engineers' shifts
+	s.router.Handle("/api/v1/oncall/mappings", s.requireRole(models.RoleAdmin, onCallHandler.HandleMappings()))
+	s.router.Handle("/api/v1/oncall/mappings/{id}", s.requireRole(models.RoleAdmin, onCallHandler.HandleMapping()))
+	s.router.Handle("POST /api/v1/oncall/mappings/{id}/sync", s.requireRole(models.RoleAdmin, onCallHandler.HandleSync()))
+
+	// Cloud console sessions; users only see their own unless admin or auditor
+	s.router.Handle("POST /api/v1/targets/{id}/cloud-sessions", s.requireAuth(cloudSessionHandler.HandleStart()))
+	s.router.Handle("GET /api/v1/cloud-sessions", s.requireAuth(cloudSessionHandler.HandleList()))
+
 	// Live session monitoring WebSocket endpoint
 	s.router.Handle("/api/ws/monitor/", s.requireAuth(monitorHandler.HandleMonitor()))
 
 	s.setupRoutes()
 
+	// The license mode is enforced ahead of every handler
+	var handler http.Handler = licenseMonitor.Middleware(s.router)
+
+	// A passive standby refuses new sessions and changes until it takes over
+	handler = failoverMonitor.Middleware(handler)
+
+	// Redacted view: JSON responses are pseudonymized for requests asking for it,
+	// so every handler honors it without knowing about it
+	handler = redact.New(cfg.Session.Secret).Middleware(handler)
+
+	// Plain text errors are localized and given a stable code, so clients can
+	// match on them whatever the language
+	handler = i18n.Middleware(handler)
+
+	// Request bodies are capped by route class before any handler reads them
+	handler = cfg.BodyLimits().Middleware(handler)
+
+	// Opt-in recorder of recent API exchanges for debugging production issues
+	if cfg.Flight.Enabled {
+		recorder := flightrec.New(flightrec.Config{
+			Service: "gateway",
+			Size:    cfg.Flight.Size,
+			MaxBody: cfg.Flight.MaxBody,
+			DumpDir: cfg.Flight.DumpDir,
+			Exclude: append([]string{"/health", "/ready", "/api/v1/auth/", "/api/tunnel", "/api/v1/admin/flight-recorder"}, cfg.Flight.Exclude...),
+		})
+		flightHandler := handlers.NewFlightRecorderHandler(recorder, systemAuditRepo, log)
+		s.router.Handle("/api/v1/admin/flight-recorder", s.requireRole(models.RoleAdmin, flightHandler.HandleRecorder()))
+		s.router.Handle("POST /api/v1/admin/flight-recorder/dump", s.requireRole(models.RoleAdmin, flightHandler.HandleDump()))
+		handler = recorder.Middleware(log)(handler)
+	}
+
+	// Recover panics outside the flight recorder so it captures them first
+	reporter, _ := recovery.NewReporter(cfg.Errors.SentryDSN, "gateway", cfg.Errors.Environment, build.Version)
+	s.router.Handle("GET /api/v1/admin/metrics", s.requireRole(models.RoleAdmin, expvar.Handler().ServeHTTP))
+	handler = recovery.RequestID(recovery.Middleware("gateway", func(message string, fields map[string]interface{}) {
+		log.Error(message, fields)
+	}, reporter)(handler))
+
 	s.httpServer = &http.Server{
 		Addr:         fmt.Sprintf("%s:%d", cfg.Server.Host, cfg.Server.Port),
-		Handler:      middleware.CORS([]string{"http://localhost:3000", "http://127.0.0.1:3000", "http://localhost:3001", "http://127.0.0.1:3001"})(s.router),
+		Handler:      middleware.CORS([]string{"http://localhost:3000", "http://127.0.0.1:3000", "http://localhost:3001", "http://127.0.0.1:3001"})(handler),
 		ReadTimeout:  cfg.Server.ReadTimeout,
 		WriteTimeout: cfg.Server.WriteTimeout,
 		IdleTimeout:  cfg.Server.IdleTimeout,
@@ -219,24 +1060,39 @@ func (s *Server) setupRoutes() {
 	// List users - accessible by admin and auditor (auditor needs it for session audit display)
 	s.router.Handle("/api/v1/users", s.requireAnyRole([]string{models.RoleAdmin, models.RoleAuditor}, s.userHandler.HandleList()))
 	// User modification routes (admin only)
-	s.router.Handle("/api/v1/users/{id}/role", s.requireRole(models.RoleAdmin, s.userHandler.HandleUpdateRole()))
+	s.router.Handle("/api/v1/users/{id}/role", s.requireRole(models.RoleAdmin, s.dualControl.Guard("/api/v1/users/{id}/role", s.userHandler.HandleUpdateRole(),
+		dualcontrol.Kind{Category: models.ChangeCategoryUserRoles, Name: models.ChangeKindUserRole, Current: s.userHandler.Current})))
 	s.router.Handle("/api/v1/users/{id}/enabled", s.requireRole(models.RoleAdmin, s.userHandler.HandleUpdateEnabled()))
+	s.router.Handle("PUT /api/v1/users/{id}/attributes", s.requireRole(models.RoleAdmin, s.userHandler.HandleUpdateAttributes()))
 	s.router.Handle("/api/v1/users/{id}", s.requireRole(models.RoleAdmin, s.userHandler.HandleDelete()))
 
 	// Group management routes (admin only)
 	s.router.Handle("/api/v1/groups", s.requireRole(models.RoleAdmin, s.groupHandler.HandleList()))
+	s.router.Handle("POST /api/v1/groups", s.requireRole(models.RoleAdmin, s.groupHandler.HandleCreate()))
 	s.router.Handle("/api/v1/groups/{id}", s.requireRole(models.RoleAdmin, s.groupHandler.HandleDelete()))
+	s.router.Handle("GET /api/v1/groups/{id}/members", s.requireRole(models.RoleAdmin, s.groupHandler.HandleListMembers()))
+	s.router.Handle("PUT /api/v1/groups/{id}/members/{user_id}", s.requireRole(models.RoleAdmin, s.groupHandler.HandleAddMember()))
+	s.router.Handle("DELETE /api/v1/groups/{id}/members/{user_id}", s.requireRole(models.RoleAdmin, s.groupHandler.HandleRemoveMember()))
+	s.router.Handle("GET /api/v1/users/{id}/groups", s.requireRole(models.RoleAdmin, s.groupHandler.HandleListUserGroups()))
 
-	s.router.Handle("/api/v1/targets", s.requireAuth(s.targetHandler.HandleTargets()))
+	s.router.Handle("/api/v1/targets", s.requireAuth(s.idempotency.Wrap(s.targetHandler.HandleTargets())))
 
 	// Schedule routes
 	// Users can request schedules
-	s.router.Handle("/api/v1/schedules/request", s.requireAuth(s.scheduleHandler.HandleRequestSchedule()))
+	s.router.Handle("/api/v1/schedules/request", s.requireAuth(s.idempotency.Wrap(s.scheduleHandler.HandleRequestSchedule())))
 	// Anyone authenticated can list schedules (filtered by role in handler)
 	s.router.Handle("/api/v1/schedules", s.requireAuth(s.scheduleHandler.HandleListSchedules()))
-	// Admin-only routes for approval/rejection
-	s.router.Handle("/api/v1/schedules/approve", s.requireRole(models.RoleAdmin, s.scheduleHandler.HandleApproveSchedule()))
-	s.router.Handle("/api/v1/schedules/reject", s.requireRole(models.RoleAdmin, s.scheduleHandler.HandleRejectSchedule()))
+	// Approval and rejection by admins, or zone admins for their zones' targets (checked in the repository)
+	s.router.Handle("/api/v1/schedules/approve", s.requireAuth(s.scheduleHandler.HandleApproveSchedule()))
+	s.router.Handle("/api/v1/schedules/reject", s.requireAuth(s.scheduleHandler.HandleRejectSchedule()))
+
+	// Approval links sent by email or chat; the token in the path authorizes the decision
+	approvalAuth := func(handler http.Handler) http.Handler {
+		return middleware.OptionalAuth(s.tokenManager)(middleware.Actor(handler))
+	}
+	s.router.Handle("GET /api/v1/approvals/{token}", s.approvalHandler.HandleGetApproval())
+	s.router.Handle("POST /api/v1/approvals/{token}/approve", approvalAuth(s.approvalHandler.HandleApprove()))
+	s.router.Handle("POST /api/v1/approvals/{token}/reject", approvalAuth(s.approvalHandler.HandleReject()))
 
 	// WebSocket endpoint for connections (auth required)
 	s.router.Handle("/api/ws/connect/", s.requireAuth(s.connectionHandler.HandleConnect()))
@@ -244,20 +1100,25 @@ func (s *Server) setupRoutes() {
 
 // requireAuth wraps a handler with authentication middleware
 func (s *Server) requireAuth(handler http.HandlerFunc) http.Handler {
-	return middleware.RequireAuth(s.tokenManager, s.logger)(handler)
+	return s.authenticate(handler)
 }
 
 // requireRole wraps a handler with authentication and role-based access control
 func (s *Server) requireRole(role string, handler http.HandlerFunc) http.Handler {
-	return middleware.RequireAuth(s.tokenManager, s.logger)(
-		middleware.RequireRole(role, s.logger)(handler),
-	)
+	return s.authenticate(middleware.RequireRole(role, s.logger)(handler))
 }
 
 // requireAnyRole wraps a handler with authentication and allows any of the specified roles
 func (s *Server) requireAnyRole(roles []string, handler http.HandlerFunc) http.Handler {
-	return middleware.RequireAuth(s.tokenManager, s.logger)(
-		middleware.RequireAnyRole(roles, s.logger)(handler),
+	return s.authenticate(middleware.RequireAnyRole(roles, s.logger)(handler))
+}
+
+// authenticate authenticates the request, applies the user's active role elevation,
+// records the user as the actor of the changes it makes and limits those changes
+// to the zones a non-admin administers
+func (s *Server) authenticate(handler http.Handler) http.Handler {
+	return middleware.RequireAuth(s.tokenManager, s.apiKeyAuth, s.reconnectAuth, s.logger)(
+		s.usage.Middleware(middleware.Elevate(s.elevations, s.logger)(middleware.Actor(middleware.ZoneScope(s.zoneAdmins, s.logger)(handler)))),
 	)
 }
 
@@ -269,6 +1130,85 @@ func (s *Server) Start() error {
 		"zone_name": s.config.Zone.Name,
 	})
 
+	// Expire and clean up ephemeral targets in the background
+	s.targetCollector.Start()
+
+	// Alert on smart card certificates before they expire
+	s.certMonitor.Start()
+
+	// Alert on AD accounts that need attention
+	if s.adAccountMonitor != nil {
+		s.adAccountMonitor.Start()
+	}
+
+	// Create upcoming audit log months and drop those past retention
+	s.auditPartitions.Start()
+
+	// Refresh the analytics views
+	s.analytics.Start()
+
+	// Push audit events to event stream subscribers
+	s.eventBroker.Start()
+
+	// Send scheduled reports when they are due
+	s.reportScheduler.Start()
+
+	// Close certification campaigns when they are due
+	s.campaignCloser.Start()
+
+	// Close role elevations once they expire
+	s.elevationExpirer.Start()
+
+	// Activate and expire approved schedules as their windows start and end
+	s.scheduleLifecycle.Start()
+
+	// Keep on-call engineers' access in line with their shifts
+	s.onCallSyncer.Start()
+
+	// Keep track of the license and whether it has expired
+	s.license.Start()
+
+	// Watch the primary when running as its standby
+	s.failover.Start()
+
+	// Forget idempotency keys once they expire
+	s.idempotency.Start()
+
+	// Store metered usage and alert on quotas
+	s.usage.Start()
+
+	// Ship audit data to the search cluster
+	if s.searchExporter != nil {
+		s.searchExporter.Start()
+	}
+
+	// Run remediation playbooks after sessions
+	if s.remediation != nil {
+		s.remediation.Start()
+	}
+
+	// Evaluate watch rules against the audit events
+	s.watchEngine.Start()
+
+	// Serve the synthetic targets of the test harness
+	if s.harness != nil {
+		if err := s.harness.Start(); err != nil {
+			s.logger.Error("Failed to start test harness", map[string]interface{}{
+				"error": err.Error(),
+			})
+		}
+	}
+
+	// Scan targets for local accounts and rotate onboarded passwords
+	s.discovery.Start()
+
+	// Keep a satellite connected to its hub
+	if s.satellite != nil {
+		ctx, cancel := context.WithCancel(context.Background())
+		s.stopSatellite = cancel
+		go s.satellite.Run(ctx)
+	}
+
 	if err := s.httpServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
 		return fmt.Errorf("failed to start server: %w", err)
 	}
@@ -280,6 +1220,18 @@ func (s *Server) Start() error {
 func (s *Server) Shutdown(ctx context.Context) error {
 	s.logger.Info("Shutting down server...")
 
+	// End event streams first; Shutdown waits for active requests to finish
+	s.eventBroker.Stop()
+
+	// WebSockets are hijacked, so Shutdown doesn't wait for them. Close them
+	// with a reconnect token and give the proxies time to record the sessions.
+	if err := s.wsSessions.Shutdown(ctx); err != nil {
+		s.logger.Warn("WebSocket sessions still open at shutdown", map[string]interface{}{
+			"sessions": s.wsSessions.Count(),
+			"error":    err.Error(),
+		})
+	}
+
 	// Shutdown HTTP server
 	if err := s.httpServer.Shutdown(ctx); err != nil {
 		s.logger.Error("Error shutting down HTTP server", map[string]interface{}{
@@ -288,6 +1240,38 @@ func (s *Server) Shutdown(ctx context.Context) error {
 		return err
 	}
 
+	s.targetCollector.Stop()
+	s.certMonitor.Stop()
+	if s.adAccountMonitor != nil {
+		s.adAccountMonitor.Stop()
+	}
+	s.auditPartitions.Stop()
+	s.analytics.Stop()
+	s.reportScheduler.Stop()
+	s.campaignCloser.Stop()
+	s.elevationExpirer.Stop()
+	s.scheduleLifecycle.Stop()
+	s.onCallSyncer.Stop()
+	s.license.Stop()
+	s.failover.Stop()
+	s.idempotency.Stop()
+	s.usage.Stop()
+	if s.searchExporter != nil {
+		s.searchExporter.Stop()
+	}
+	if s.remediation != nil {
+		s.remediation.Stop()
+	}
+	s.watchEngine.Stop()
+	if s.harness != nil {
+		s.harness.Stop()
+	}
+	s.discovery.Stop()
+	s.violations.Wait()
+	if s.stopSatellite != nil {
+		s.stopSatellite()
+	}
+
 	// Close database connection
 	if err := s.db.Close(); err != nil {
 		s.logger.Error("Error closing database", map[string]interface{}{
@@ -323,6 +1307,14 @@ func (s *Server) handleReady() http.HandlerFunc {
 		ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
 		defer cancel()
 
+		// A passive standby isn't ready for sessions, so load balancers send them to the primary
+		if !s.failover.Active() {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusServiceUnavailable)
+			w.Write([]byte(`{"status":"standby"}`))
+			return
+		}
+
 		// Check database
 		if err := s.db.HealthCheck(ctx); err != nil {
 			s.logger.Error("Database health check failed", map[string]interface{}{
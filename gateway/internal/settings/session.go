@@ -0,0 +1,131 @@
+package settings
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"time"
+
+	"github.com/VanCannon/openpam/gateway/internal/models"
+)
+
+var (
+	// ErrIdleTimeout ends a session that had no client input for its idle timeout
+	ErrIdleTimeout = errors.New("session idle timeout reached")
+
+	// ErrMaxDuration ends a session that reached its maximum duration
+	ErrMaxDuration = errors.New("session maximum duration reached")
+)
+
+type sessionKey struct{}
+
+// session tracks a running session's activity against its settings
+type session struct {
+	eff       *Effective
+	started   time.Time
+	lastInput atomic.Int64
+}
+
+// Start returns a context for a session that is cancelled, with ErrIdleTimeout
+// or ErrMaxDuration as its cause, when one of the session limits is reached.
+// The proxies report client input with Touch. The returned stop function
+// releases the session's resources.
+func Start(ctx context.Context, eff *Effective) (context.Context, func()) {
+	s := &session{eff: eff, started: time.Now()}
+	s.lastInput.Store(s.started.UnixNano())
+
+	ctx = context.WithValue(ctx, sessionKey{}, s)
+	var stopDeadline context.CancelFunc = func() {}
+	if eff.MaxDuration > 0 {
+		ctx, stopDeadline = context.WithTimeoutCause(ctx, time.Duration(eff.MaxDuration)*time.Second, ErrMaxDuration)
+	}
+	ctx, cancel := context.WithCancelCause(ctx)
+
+	if eff.IdleTimeout > 0 {
+		go s.watchIdle(ctx, cancel, time.Duration(eff.IdleTimeout)*time.Second)
+	}
+
+	return ctx, func() {
+		cancel(nil)
+		stopDeadline()
+	}
+}
+
+// watchIdle cancels the session once no input has arrived for timeout
+func (s *session) watchIdle(ctx context.Context, cancel context.CancelCauseFunc, timeout time.Duration) {
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-timer.C:
+			idle := time.Since(time.Unix(0, s.lastInput.Load()))
+			if idle >= timeout {
+				cancel(ErrIdleTimeout)
+				return
+			}
+			timer.Reset(timeout - idle)
+		}
+	}
+}
+
+// Touch records client input on the session in ctx
+func Touch(ctx context.Context) {
+	if s, ok := ctx.Value(sessionKey{}).(*session); ok {
+		s.lastInput.Store(time.Now().UnixNano())
+	}
+}
+
+// Deadline returns when the session in ctx reaches its maximum duration, and
+// false if it has none
+func Deadline(ctx context.Context) (time.Time, bool) {
+	if s, ok := ctx.Value(sessionKey{}).(*session); ok && s.eff.MaxDuration > 0 {
+		return s.started.Add(time.Duration(s.eff.MaxDuration) * time.Second), true
+	}
+	return time.Time{}, false
+}
+
+// IdleDeadline returns when the session in ctx reaches its idle timeout
+// without further input, and false if it has none
+func IdleDeadline(ctx context.Context) (time.Time, bool) {
+	if s, ok := ctx.Value(sessionKey{}).(*session); ok && s.eff.IdleTimeout > 0 {
+		return time.Unix(0, s.lastInput.Load()).Add(time.Duration(s.eff.IdleTimeout) * time.Second), true
+	}
+	return time.Time{}, false
+}
+
+// RecordingEnabled reports whether the session in ctx is recorded. Sessions
+// started without settings are recorded.
+func RecordingEnabled(ctx context.Context) bool {
+	if s, ok := ctx.Value(sessionKey{}).(*session); ok {
+		return s.eff.Recording
+	}
+	return true
+}
+
+// Audio returns whether the session in ctx plays the target's sound, passes
+// the client's microphone through and records audio. Sessions started without
+// settings only play sound.
+func Audio(ctx context.Context) (output, input, record bool) {
+	if s, ok := ctx.Value(sessionKey{}).(*session); ok {
+		return s.eff.AudioOutput, s.eff.AudioInput, s.eff.AudioRecording
+	}
+	return true, false, false
+}
+
+// InjectMetadata returns how the session in ctx is identified to its target,
+// one of the models.InjectMetadata constants. Sessions started without
+// settings are not.
+func InjectMetadata(ctx context.Context) string {
+	if s, ok := ctx.Value(sessionKey{}).(*session); ok {
+		return s.eff.InjectMetadata
+	}
+	return models.InjectMetadataOff
+}
+
+// Limited reports whether err is a session limit being reached
+func Limited(err error) bool {
+	return errors.Is(err, ErrIdleTimeout) || errors.Is(err, ErrMaxDuration)
+}
@@ -0,0 +1,228 @@
+package settings
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"github.com/VanCannon/openpam/gateway/internal/models"
+	"github.com/VanCannon/openpam/gateway/internal/policy"
+	"github.com/google/uuid"
+)
+
+// Sources of an effective setting
+const (
+	SourceDefault = "default"
+	SourceZone    = "zone"
+	SourceTarget  = "target"
+)
+
+// Effective is the session configuration that applies once zone, target and
+// credential rule settings have been merged
+type Effective struct {
+	Recording          bool     `json:"recording"`
+	RecordingRequired  bool     `json:"recording_required"`
+	IdleTimeout        int      `json:"idle_timeout"`
+	MaxDuration        int      `json:"max_duration"`
+	AllowedProtocols   []string `json:"allowed_protocols"`
+	MaxSessions        int      `json:"max_sessions"`
+	QueueWait          int      `json:"queue_wait"`
+	RequirePurpose     bool     `json:"require_purpose"`
+	AudioOutput        bool     `json:"audio_output"`
+	AudioInput         bool     `json:"audio_input"`
+	AudioRecording     bool     `json:"audio_recording"`
+	InjectMetadata     string   `json:"inject_metadata"`
+	Banner             string   `json:"banner,omitempty"`
+	BannerVersion      string   `json:"banner_version,omitempty"` // Identifies the banner text acknowledgments are given for
+	BannerRequired     bool     `json:"banner_required"`
+	TunnelDialTimeout  int      `json:"tunnel_dial_timeout,omitempty"`
+	TunnelSyncInterval int      `json:"tunnel_sync_interval,omitempty"`
+
+	// Sources names the level each setting came from: default, zone, target
+	// or policy:<rule name>
+	Sources map[string]string `json:"sources"`
+}
+
+// RequiresAcknowledgment reports whether sessions are refused until the user
+// has acknowledged the banner
+func (e *Effective) RequiresAcknowledgment() bool {
+	return e.BannerRequired && e.Banner != ""
+}
+
+// Allows reports whether sessions may use protocol
+func (e *Effective) Allows(protocol string) bool {
+	if len(e.AllowedProtocols) == 0 {
+		return true
+	}
+	for _, p := range e.AllowedProtocols {
+		if p == protocol {
+			return true
+		}
+	}
+	return false
+}
+
+// Resolve merges the settings of a zone, a target and the credential rules that
+// grant the session. Each level overrides the one before it; among rules,
+// global rules apply before target rules, each in name order.
+func Resolve(zone, target *models.SessionSettings, rules []*models.CredentialRule) *Effective {
+	eff := &Effective{
+		Recording:        true,
+		AudioOutput:      true,
+		InjectMetadata:   models.InjectMetadataOff,
+		AllowedProtocols: []string{models.ProtocolSSH, models.ProtocolRDP, models.ProtocolAWS, models.ProtocolAzure},
+		Sources: map[string]string{
+			"recording":          SourceDefault,
+			"recording_required": SourceDefault,
+			"idle_timeout":       SourceDefault,
+			"max_duration":       SourceDefault,
+			"allowed_protocols":  SourceDefault,
+			"max_sessions":       SourceDefault,
+			"queue_wait":         SourceDefault,
+			"require_purpose":    SourceDefault,
+			"audio_output":       SourceDefault,
+			"audio_input":        SourceDefault,
+			"audio_recording":    SourceDefault,
+			"inject_metadata":    SourceDefault,
+			"banner":             SourceDefault,
+			"banner_required":    SourceDefault,
+		},
+	}
+
+	if zone != nil {
+		eff.apply(zone, SourceZone)
+		if zone.TunnelDialTimeout != nil {
+			eff.TunnelDialTimeout = *zone.TunnelDialTimeout
+			eff.Sources["tunnel_dial_timeout"] = SourceZone
+		}
+		if zone.TunnelSyncInterval != nil {
+			eff.TunnelSyncInterval = *zone.TunnelSyncInterval
+			eff.Sources["tunnel_sync_interval"] = SourceZone
+		}
+	}
+	if target != nil {
+		eff.apply(target, SourceTarget)
+	}
+
+	ordered := make([]*models.CredentialRule, len(rules))
+	copy(ordered, rules)
+	sort.SliceStable(ordered, func(i, j int) bool {
+		gi, gj := ordered[i].TargetID == nil, ordered[j].TargetID == nil
+		if gi != gj {
+			return gi
+		}
+		return ordered[i].Name < ordered[j].Name
+	})
+	for _, rule := range ordered {
+		eff.apply(&rule.Settings, "policy:"+rule.Name)
+	}
+
+	// Sessions that must be recorded are, whatever turned recording off
+	if eff.RecordingRequired && !eff.Recording {
+		eff.Recording = true
+		eff.Sources["recording"] = eff.Sources["recording_required"]
+	}
+
+	if eff.Banner != "" {
+		eff.BannerVersion = models.BannerVersion(eff.Banner)
+	}
+
+	return eff
+}
+
+func (e *Effective) apply(s *models.SessionSettings, source string) {
+	if s.Recording != nil {
+		e.Recording = *s.Recording
+		e.Sources["recording"] = source
+	}
+	if s.RecordingRequired != nil {
+		e.RecordingRequired = *s.RecordingRequired
+		e.Sources["recording_required"] = source
+	}
+	if s.IdleTimeout != nil {
+		e.IdleTimeout = *s.IdleTimeout
+		e.Sources["idle_timeout"] = source
+	}
+	if s.MaxDuration != nil {
+		e.MaxDuration = *s.MaxDuration
+		e.Sources["max_duration"] = source
+	}
+	if len(s.AllowedProtocols) > 0 {
+		e.AllowedProtocols = s.AllowedProtocols
+		e.Sources["allowed_protocols"] = source
+	}
+	if s.MaxSessions != nil {
+		e.MaxSessions = *s.MaxSessions
+		e.Sources["max_sessions"] = source
+	}
+	if s.QueueWait != nil {
+		e.QueueWait = *s.QueueWait
+		e.Sources["queue_wait"] = source
+	}
+	if s.RequirePurpose != nil {
+		e.RequirePurpose = *s.RequirePurpose
+		e.Sources["require_purpose"] = source
+	}
+	if s.AudioOutput != nil {
+		e.AudioOutput = *s.AudioOutput
+		e.Sources["audio_output"] = source
+	}
+	if s.AudioInput != nil {
+		e.AudioInput = *s.AudioInput
+		e.Sources["audio_input"] = source
+	}
+	if s.AudioRecording != nil {
+		e.AudioRecording = *s.AudioRecording
+		e.Sources["audio_recording"] = source
+	}
+	if s.InjectMetadata != nil {
+		e.InjectMetadata = *s.InjectMetadata
+		e.Sources["inject_metadata"] = source
+	}
+	if s.Banner != nil {
+		e.Banner = *s.Banner
+		e.Sources["banner"] = source
+	}
+	if s.BannerRequired != nil {
+		e.BannerRequired = *s.BannerRequired
+		e.Sources["banner_required"] = source
+	}
+}
+
+// ZoneGetter provides a target's zone
+type ZoneGetter interface {
+	GetByID(ctx context.Context, id uuid.UUID) (*models.Zone, error)
+}
+
+// Resolver works out the effective settings of a session
+type Resolver struct {
+	zones  ZoneGetter
+	policy *policy.Engine
+}
+
+// NewResolver creates a new settings resolver
+func NewResolver(zones ZoneGetter, engine *policy.Engine) *Resolver {
+	return &Resolver{
+		zones:  zones,
+		policy: engine,
+	}
+}
+
+// Resolve returns the settings for the subject's session on the target with
+// cred. Without a credential only the zone and target levels apply.
+func (r *Resolver) Resolve(ctx context.Context, subject policy.Subject, target *models.Target, cred *models.Credential) (*Effective, error) {
+	zone, err := r.zones.GetByID(ctx, target.ZoneID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get zone: %w", err)
+	}
+
+	var rules []*models.CredentialRule
+	if cred != nil {
+		rules, err = r.policy.GrantingRules(ctx, subject, target, cred)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return Resolve(&zone.Settings, &target.Settings, rules), nil
+}
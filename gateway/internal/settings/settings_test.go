@@ -0,0 +1,172 @@
+package settings
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/VanCannon/openpam/gateway/internal/models"
+	"github.com/google/uuid"
+)
+
+func intPtr(v int) *int    { return &v }
+func boolPtr(v bool) *bool { return &v }
+
+func TestResolve(t *testing.T) {
+	targetID := uuid.New()
+	env := models.InjectMetadataEnv
+
+	zone := &models.SessionSettings{
+		Recording:         boolPtr(true),
+		IdleTimeout:       intPtr(900),
+		MaxDuration:       intPtr(28800),
+		AllowedProtocols:  []string{models.ProtocolSSH},
+		TunnelDialTimeout: intPtr(5),
+	}
+	target := &models.SessionSettings{
+		IdleTimeout:    intPtr(300),
+		MaxSessions:    intPtr(1),
+		QueueWait:      intPtr(600),
+		RequirePurpose: boolPtr(true),
+		InjectMetadata: &env,
+	}
+	rules := []*models.CredentialRule{
+		{Name: "b-target", TargetID: &targetID, Settings: models.SessionSettings{MaxDuration: intPtr(3600)}},
+		{Name: "a-global", Settings: models.SessionSettings{MaxDuration: intPtr(7200), Recording: boolPtr(false)}},
+	}
+
+	eff := Resolve(zone, target, rules)
+
+	if eff.Recording {
+		t.Error("Recording = true, want the global rule's false")
+	}
+	if eff.IdleTimeout != 300 || eff.Sources["idle_timeout"] != SourceTarget {
+		t.Errorf("IdleTimeout = %d from %s, want 300 from target", eff.IdleTimeout, eff.Sources["idle_timeout"])
+	}
+	// Target rules apply after global rules
+	if eff.MaxDuration != 3600 || eff.Sources["max_duration"] != "policy:b-target" {
+		t.Errorf("MaxDuration = %d from %s, want 3600 from policy:b-target", eff.MaxDuration, eff.Sources["max_duration"])
+	}
+	if eff.MaxSessions != 1 || eff.QueueWait != 600 || eff.Sources["max_sessions"] != SourceTarget {
+		t.Errorf("MaxSessions = %d, QueueWait = %d, want 1 and 600 from target", eff.MaxSessions, eff.QueueWait)
+	}
+	if !eff.RequirePurpose || eff.Sources["require_purpose"] != SourceTarget {
+		t.Errorf("RequirePurpose = %t from %s, want true from target", eff.RequirePurpose, eff.Sources["require_purpose"])
+	}
+	if eff.TunnelDialTimeout != 5 || eff.Sources["tunnel_dial_timeout"] != SourceZone {
+		t.Errorf("TunnelDialTimeout = %d, want 5 from zone", eff.TunnelDialTimeout)
+	}
+	if !eff.Allows(models.ProtocolSSH) || eff.Allows(models.ProtocolRDP) {
+		t.Errorf("AllowedProtocols = %v, want only ssh", eff.AllowedProtocols)
+	}
+	if eff.InjectMetadata != models.InjectMetadataEnv || eff.Sources["inject_metadata"] != SourceTarget {
+		t.Errorf("InjectMetadata = %q from %s, want env from target", eff.InjectMetadata, eff.Sources["inject_metadata"])
+	}
+}
+
+func TestResolve_Banner(t *testing.T) {
+	zoneBanner := "Sessions in this zone are recorded."
+	zone := &models.SessionSettings{Banner: &zoneBanner, BannerRequired: boolPtr(true)}
+
+	eff := Resolve(zone, &models.SessionSettings{}, nil)
+	if eff.Banner != zoneBanner || eff.BannerVersion != models.BannerVersion(zoneBanner) || !eff.RequiresAcknowledgment() {
+		t.Errorf("banner = %q version %q required %t, want the zone's, required", eff.Banner, eff.BannerVersion, eff.RequiresAcknowledgment())
+	}
+
+	// A target can clear the zone's banner, which leaves nothing to acknowledge
+	none := ""
+	eff = Resolve(zone, &models.SessionSettings{Banner: &none}, nil)
+	if eff.Sources["banner"] != SourceTarget || eff.BannerVersion != "" || eff.RequiresAcknowledgment() {
+		t.Errorf("cleared banner: version %q required %t, want none", eff.BannerVersion, eff.RequiresAcknowledgment())
+	}
+
+	// Another text is another version
+	targetBanner := "Authorized use only."
+	eff = Resolve(zone, &models.SessionSettings{Banner: &targetBanner}, nil)
+	if eff.BannerVersion == models.BannerVersion(zoneBanner) {
+		t.Error("changed banner kept the previous version")
+	}
+}
+
+func TestResolve_RecordingRequired(t *testing.T) {
+	target := &models.SessionSettings{RecordingRequired: boolPtr(true)}
+	rules := []*models.CredentialRule{
+		{Name: "unrecorded", Settings: models.SessionSettings{Recording: boolPtr(false)}},
+	}
+
+	eff := Resolve(&models.SessionSettings{}, target, rules)
+
+	// A rule can't turn off the recording of a target that requires it
+	if !eff.Recording || !eff.RecordingRequired || eff.Sources["recording"] != SourceTarget {
+		t.Errorf("Recording = %t, RecordingRequired = %t from %s, want both from target", eff.Recording, eff.RecordingRequired, eff.Sources["recording"])
+	}
+}
+
+func TestResolve_Defaults(t *testing.T) {
+	eff := Resolve(&models.SessionSettings{}, &models.SessionSettings{}, nil)
+
+	if !eff.Recording || eff.IdleTimeout != 0 || eff.MaxDuration != 0 {
+		t.Errorf("defaults = %+v, want recording with no limits", eff)
+	}
+	if !eff.Allows(models.ProtocolSSH) || !eff.Allows(models.ProtocolRDP) {
+		t.Errorf("AllowedProtocols = %v, want all", eff.AllowedProtocols)
+	}
+	if !eff.AudioOutput || eff.AudioInput || eff.AudioRecording {
+		t.Errorf("audio = %t, %t, %t, want output only", eff.AudioOutput, eff.AudioInput, eff.AudioRecording)
+	}
+	if eff.InjectMetadata != models.InjectMetadataOff {
+		t.Errorf("InjectMetadata = %q, want off", eff.InjectMetadata)
+	}
+	for field, source := range eff.Sources {
+		if source != SourceDefault {
+			t.Errorf("Sources[%s] = %s, want default", field, source)
+		}
+	}
+}
+
+func TestStart_IdleTimeout(t *testing.T) {
+	ctx, stop := Start(context.Background(), &Effective{Recording: false, IdleTimeout: 1})
+	defer stop()
+
+	if RecordingEnabled(ctx) {
+		t.Error("RecordingEnabled() = true, want false")
+	}
+
+	// Input keeps the session alive past its idle timeout
+	deadline := time.Now().Add(1500 * time.Millisecond)
+	for time.Now().Before(deadline) {
+		Touch(ctx)
+		time.Sleep(100 * time.Millisecond)
+	}
+	if ctx.Err() != nil {
+		t.Fatalf("session ended while active: %v", context.Cause(ctx))
+	}
+
+	select {
+	case <-ctx.Done():
+	case <-time.After(3 * time.Second):
+		t.Fatal("idle session was not ended")
+	}
+	if cause := context.Cause(ctx); cause != ErrIdleTimeout {
+		t.Errorf("Cause() = %v, want %v", cause, ErrIdleTimeout)
+	}
+}
+
+func TestStart_MaxDuration(t *testing.T) {
+	ctx, stop := Start(context.Background(), &Effective{MaxDuration: 1})
+	defer stop()
+
+	select {
+	case <-ctx.Done():
+	case <-time.After(3 * time.Second):
+		t.Fatal("session outlived its maximum duration")
+	}
+	if cause := context.Cause(ctx); !Limited(cause) || cause != ErrMaxDuration {
+		t.Errorf("Cause() = %v, want %v", cause, ErrMaxDuration)
+	}
+
+	// Sessions without settings are recorded
+	if !RecordingEnabled(context.Background()) {
+		t.Error("RecordingEnabled() without a session = false")
+	}
+}
@@ -0,0 +1,152 @@
+package siem
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/VanCannon/openpam/gateway/internal/models"
+)
+
+// CEF severities, on CEF's scale of 0 to 10
+const (
+	cefSeverityInfo    = 3
+	cefSeverityFailure = 6
+	cefSeverityAlert   = 8
+)
+
+// cefExtension builds the key=value pairs of a CEF record in order, leaving
+// out empty values
+type cefExtension struct {
+	b strings.Builder
+}
+
+func (e *cefExtension) add(key, value string) {
+	if value == "" {
+		return
+	}
+	if e.b.Len() > 0 {
+		e.b.WriteByte(' ')
+	}
+	e.b.WriteString(key)
+	e.b.WriteByte('=')
+	e.b.WriteString(cefExtensionEscaper.Replace(value))
+}
+
+// label adds a custom string field with its label, e.g. cs1Label=zone cs1=eu
+func (e *cefExtension) label(key, label, value string) {
+	if value == "" {
+		return
+	}
+	e.add(key+"Label", label)
+	e.add(key, value)
+}
+
+func (e *cefExtension) time(key string, t time.Time) {
+	if t.IsZero() {
+		return
+	}
+	e.add(key, strconv.FormatInt(t.UnixMilli(), 10))
+}
+
+var (
+	cefHeaderEscaper    = strings.NewReplacer(`\`, `\\`, `|`, `\|`, "\r", " ", "\n", " ")
+	cefExtensionEscaper = strings.NewReplacer(`\`, `\\`, `=`, `\=`, "\r\n", `\n`, "\n", `\n`, "\r", `\n`)
+)
+
+// cefRecord joins the header and extension of a CEF record
+func cefRecord(signatureID, name string, severity int, ext *cefExtension) string {
+	header := []string{
+		"CEF:0",
+		cefHeaderEscaper.Replace(vendor),
+		cefHeaderEscaper.Replace(product),
+		cefHeaderEscaper.Replace(productVersion),
+		cefHeaderEscaper.Replace(signatureID),
+		cefHeaderEscaper.Replace(name),
+		strconv.Itoa(severity),
+	}
+	return strings.Join(header, "|") + "|" + ext.b.String()
+}
+
+// CEFSession formats a session event as a CEF record. The signature ID is
+// the session event type, such as session_started or session_failed.
+func CEFSession(log *models.AuditLog, zone string) string {
+	eventType := sessionEventType(log)
+
+	severity := cefSeverityInfo
+	outcome := "success"
+	if sessionFailed(log) {
+		severity = cefSeverityFailure
+		outcome = "failure"
+	}
+
+	at := log.StartTime
+	if log.EndTime.Valid {
+		at = log.EndTime.Time
+	}
+
+	var ext cefExtension
+	ext.time("rt", at)
+	ext.add("externalId", log.ID.String())
+	ext.add("suid", log.UserID.String())
+	ext.add("src", deref(log.ClientIP))
+	ext.add("app", log.Protocol)
+	ext.time("start", log.StartTime)
+	if log.EndTime.Valid {
+		ext.time("end", log.EndTime.Time)
+		ext.add("in", strconv.FormatInt(log.BytesReceived, 10))
+		ext.add("out", strconv.FormatInt(log.BytesSent, 10))
+	}
+	ext.add("outcome", outcome)
+	ext.add("reason", deref(log.ErrorMessage))
+	ext.add("filePath", deref(log.RecordingPath))
+	ext.label("cs1", "targetId", log.TargetID.String())
+	if log.CredentialID.Valid {
+		ext.label("cs2", "credentialId", log.CredentialID.UUID.String())
+	}
+	ext.label("cs3", "purpose", deref(log.Purpose))
+	ext.label("cs4", "justification", deref(log.Reason))
+	ext.label("cs5", "zone", zone)
+	ext.label("cs6", "mappingVersion", MappingVersion)
+
+	return cefRecord(eventType, title(eventType), severity, &ext)
+}
+
+// CEFSystem formats a system audit event as a CEF record. The signature ID is
+// the system audit event type, such as login_failed.
+func CEFSystem(log *models.SystemAuditLog, zone string) string {
+	severity := cefSeverityInfo
+	switch {
+	case systemAlert(log):
+		severity = cefSeverityAlert
+	case systemFailed(log):
+		severity = cefSeverityFailure
+	}
+
+	var ext cefExtension
+	ext.time("rt", log.Timestamp)
+	ext.add("externalId", log.ID.String())
+	if log.UserID.Valid {
+		ext.add("suid", log.UserID.UUID.String())
+	}
+	if log.TargetUserID.Valid {
+		ext.add("duid", log.TargetUserID.UUID.String())
+	}
+	ext.add("src", deref(log.IPAddress))
+	ext.add("requestClientApplication", deref(log.UserAgent))
+	ext.add("act", log.Action)
+	ext.add("outcome", log.Status)
+	ext.add("msg", deref(log.Details))
+	ext.label("cs1", "resourceType", deref(log.ResourceType))
+	if log.ResourceID.Valid {
+		ext.label("cs2", "resourceId", log.ResourceID.UUID.String())
+	}
+	ext.label("cs3", "resourceName", deref(log.ResourceName))
+	if log.ElevationID.Valid {
+		ext.label("cs4", "elevationId", log.ElevationID.UUID.String())
+	}
+	ext.label("cs5", "zone", zone)
+	ext.label("cs6", "mappingVersion", MappingVersion)
+
+	return cefRecord(log.EventType, title(log.EventType), severity, &ext)
+}
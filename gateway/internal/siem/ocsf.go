@@ -0,0 +1,393 @@
+package siem
+
+import (
+	"encoding/json"
+	"strings"
+	"time"
+
+	"github.com/VanCannon/openpam/gateway/internal/models"
+)
+
+// OCSFVersion is the version of the OCSF schema events are mapped onto
+const OCSFVersion = "1.1.0"
+
+// OCSF categories and classes OpenPAM events belong to
+const (
+	ocsfCategoryIAM     = 3
+	ocsfCategoryNetwork = 4
+
+	ocsfClassAccountChange    = 3001
+	ocsfClassAuthentication   = 3002
+	ocsfClassEntityManagement = 3004
+	ocsfClassUserAccessMgmt   = 3005
+	ocsfClassNetworkActivity  = 4001
+	ocsfClassRDPActivity      = 4005
+	ocsfClassSSHActivity      = 4007
+)
+
+// OCSF activities, which are numbered per class
+const (
+	ocsfNetworkActivityOpen  = 1
+	ocsfNetworkActivityClose = 2
+	ocsfNetworkActivityReset = 3
+	ocsfNetworkActivityFail  = 4
+
+	ocsfAuthActivityLogon  = 1
+	ocsfAuthActivityLogoff = 2
+
+	ocsfAccountActivityCreate = 1
+	ocsfAccountActivityDelete = 6
+
+	ocsfAccessActivityAssign = 1
+	ocsfAccessActivityRevoke = 2
+
+	ocsfEntityActivityCreate = 1
+	ocsfEntityActivityRead   = 2
+	ocsfEntityActivityUpdate = 3
+	ocsfEntityActivityDelete = 4
+
+	ocsfActivityOther     = 99
+	ocsfActivityOtherName = "Other"
+)
+
+// OCSF statuses and severities
+const (
+	ocsfStatusUnknown = 0
+	ocsfStatusSuccess = 1
+	ocsfStatusFailure = 2
+
+	ocsfSeverityInformational = 1
+	ocsfSeverityMedium        = 3
+	ocsfSeverityHigh          = 4
+)
+
+var ocsfCategoryNames = map[int]string{
+	ocsfCategoryIAM:     "Identity & Access Management",
+	ocsfCategoryNetwork: "Network Activity",
+}
+
+var ocsfClassNames = map[int]string{
+	ocsfClassAccountChange:    "Account Change",
+	ocsfClassAuthentication:   "Authentication",
+	ocsfClassEntityManagement: "Entity Management",
+	ocsfClassUserAccessMgmt:   "User Access Management",
+	ocsfClassNetworkActivity:  "Network Activity",
+	ocsfClassRDPActivity:      "RDP Activity",
+	ocsfClassSSHActivity:      "SSH Activity",
+}
+
+var ocsfSeverityNames = map[int]string{
+	ocsfSeverityInformational: "Informational",
+	ocsfSeverityMedium:        "Medium",
+	ocsfSeverityHigh:          "High",
+}
+
+var ocsfStatusNames = map[int]string{
+	ocsfStatusUnknown: "Unknown",
+	ocsfStatusSuccess: "Success",
+	ocsfStatusFailure: "Failure",
+}
+
+// OCSFEvent is an event in the OCSF schema. Only the attributes OpenPAM fills
+// are declared; what has no place in the schema goes in Unmapped.
+type OCSFEvent struct {
+	CategoryUID  int    `json:"category_uid"`
+	CategoryName string `json:"category_name"`
+	ClassUID     int    `json:"class_uid"`
+	ClassName    string `json:"class_name"`
+	ActivityID   int    `json:"activity_id"`
+	ActivityName string `json:"activity_name"`
+	TypeUID      int    `json:"type_uid"`
+	Time         int64  `json:"time"` // Milliseconds since the epoch
+	SeverityID   int    `json:"severity_id"`
+	Severity     string `json:"severity"`
+	StatusID     int    `json:"status_id"`
+	Status       string `json:"status"`
+	StatusDetail string `json:"status_detail,omitempty"`
+	Message      string `json:"message"`
+
+	Metadata    OCSFMetadata           `json:"metadata"`
+	Actor       *OCSFActor             `json:"actor,omitempty"`
+	User        *OCSFUser              `json:"user,omitempty"`
+	Entity      *OCSFEntity            `json:"entity,omitempty"`
+	SrcEndpoint *OCSFEndpoint          `json:"src_endpoint,omitempty"`
+	DstEndpoint *OCSFEndpoint          `json:"dst_endpoint,omitempty"`
+	HTTPRequest *OCSFHTTPRequest       `json:"http_request,omitempty"`
+	Traffic     *OCSFTraffic           `json:"traffic,omitempty"`
+	StartTime   int64                  `json:"start_time,omitempty"`
+	EndTime     int64                  `json:"end_time,omitempty"`
+	Duration    int64                  `json:"duration,omitempty"` // Milliseconds
+	Unmapped    map[string]interface{} `json:"unmapped,omitempty"`
+}
+
+// OCSFMetadata describes the event's source. LogVersion is MappingVersion.
+type OCSFMetadata struct {
+	Version    string      `json:"version"`
+	Product    OCSFProduct `json:"product"`
+	UID        string      `json:"uid"`
+	EventCode  string      `json:"event_code"`
+	LogName    string      `json:"log_name"`
+	LogVersion string      `json:"log_version"`
+}
+
+// OCSFProduct is the product that logged the event
+type OCSFProduct struct {
+	Name       string `json:"name"`
+	VendorName string `json:"vendor_name"`
+	Version    string `json:"version"`
+}
+
+// OCSFActor is who performed the activity
+type OCSFActor struct {
+	User *OCSFUser `json:"user,omitempty"`
+}
+
+// OCSFUser is an OpenPAM user, identified by ID
+type OCSFUser struct {
+	UID string `json:"uid"`
+}
+
+// OCSFEntity is the resource an Entity Management event acted on
+type OCSFEntity struct {
+	UID  string `json:"uid,omitempty"`
+	Name string `json:"name,omitempty"`
+	Type string `json:"type,omitempty"`
+}
+
+// OCSFEndpoint is one end of a connection. A target is identified by ID.
+type OCSFEndpoint struct {
+	UID string `json:"uid,omitempty"`
+	IP  string `json:"ip,omitempty"`
+}
+
+// OCSFHTTPRequest is the request behind a system audit event
+type OCSFHTTPRequest struct {
+	UserAgent string `json:"user_agent"`
+}
+
+// OCSFTraffic counts the bytes of a session
+type OCSFTraffic struct {
+	BytesIn  int64 `json:"bytes_in"`
+	BytesOut int64 `json:"bytes_out"`
+}
+
+// newOCSFEvent fills the attributes every event has
+func newOCSFEvent(category, class, activity int, activityName string, at time.Time, severity, status int) *OCSFEvent {
+	return &OCSFEvent{
+		CategoryUID:  category,
+		CategoryName: ocsfCategoryNames[category],
+		ClassUID:     class,
+		ClassName:    ocsfClassNames[class],
+		ActivityID:   activity,
+		ActivityName: activityName,
+		TypeUID:      class*100 + activity,
+		Time:         at.UnixMilli(),
+		SeverityID:   severity,
+		Severity:     ocsfSeverityNames[severity],
+		StatusID:     status,
+		Status:       ocsfStatusNames[status],
+		Metadata: OCSFMetadata{
+			Version:    OCSFVersion,
+			Product:    OCSFProduct{Name: product, VendorName: vendor, Version: productVersion},
+			LogVersion: MappingVersion,
+		},
+	}
+}
+
+// OCSFSession maps a session event onto SSH Activity, RDP Activity or, for
+// cloud console sessions, Network Activity. Starting a session opens the
+// connection, and ending it closes it, resets it when it was terminated, or
+// fails it.
+func OCSFSession(log *models.AuditLog, zone string) *OCSFEvent {
+	class := ocsfClassNetworkActivity
+	switch log.Protocol {
+	case models.ProtocolSSH:
+		class = ocsfClassSSHActivity
+	case models.ProtocolRDP:
+		class = ocsfClassRDPActivity
+	}
+
+	activity, activityName := ocsfNetworkActivityOpen, "Open"
+	severity, status := ocsfSeverityInformational, ocsfStatusSuccess
+	at := log.StartTime
+	switch log.SessionStatus {
+	case models.SessionStatusCompleted:
+		activity, activityName = ocsfNetworkActivityClose, "Close"
+	case models.SessionStatusTerminated:
+		activity, activityName = ocsfNetworkActivityReset, "Reset"
+	case models.SessionStatusFailed:
+		activity, activityName = ocsfNetworkActivityFail, "Fail"
+		severity, status = ocsfSeverityMedium, ocsfStatusFailure
+	}
+	if log.EndTime.Valid {
+		at = log.EndTime.Time
+	}
+
+	eventType := sessionEventType(log)
+	event := newOCSFEvent(ocsfCategoryNetwork, class, activity, activityName, at, severity, status)
+	event.Message = title(eventType)
+	event.StatusDetail = deref(log.ErrorMessage)
+	event.Metadata.UID = log.ID.String()
+	event.Metadata.EventCode = eventType
+	event.Metadata.LogName = "sessions"
+	event.Actor = &OCSFActor{User: &OCSFUser{UID: log.UserID.String()}}
+	event.DstEndpoint = &OCSFEndpoint{UID: log.TargetID.String()}
+	if ip := deref(log.ClientIP); ip != "" {
+		event.SrcEndpoint = &OCSFEndpoint{IP: ip}
+	}
+	event.StartTime = log.StartTime.UnixMilli()
+	if log.EndTime.Valid {
+		event.EndTime = log.EndTime.Time.UnixMilli()
+		event.Duration = log.EndTime.Time.Sub(log.StartTime).Milliseconds()
+		event.Traffic = &OCSFTraffic{BytesIn: log.BytesReceived, BytesOut: log.BytesSent}
+	}
+
+	unmapped := map[string]interface{}{"protocol": log.Protocol}
+	if log.CredentialID.Valid {
+		unmapped["credential_id"] = log.CredentialID.UUID.String()
+	}
+	addUnmapped(unmapped, "purpose", deref(log.Purpose))
+	addUnmapped(unmapped, "reason", deref(log.Reason))
+	addUnmapped(unmapped, "recording_path", deref(log.RecordingPath))
+	addUnmapped(unmapped, "recording_state", deref(log.RecordingState))
+	addUnmapped(unmapped, "recording_error", deref(log.RecordingError))
+	addUnmapped(unmapped, "zone", zone)
+	event.Unmapped = unmapped
+
+	return event
+}
+
+// OCSFSystem maps a system audit event onto an Identity & Access Management
+// class: Authentication for logins and logouts, Account Change for changes to
+// users, User Access Management for permission changes, role elevations and
+// privileged AD group changes, and Entity Management for everything else.
+func OCSFSystem(log *models.SystemAuditLog, zone string) *OCSFEvent {
+	class, activity, activityName := ocsfSystemActivity(log)
+
+	severity := ocsfSeverityInformational
+	switch {
+	case systemAlert(log):
+		severity = ocsfSeverityHigh
+	case systemFailed(log):
+		severity = ocsfSeverityMedium
+	}
+
+	status := ocsfStatusUnknown
+	switch log.Status {
+	case models.AuditStatusSuccess:
+		status = ocsfStatusSuccess
+	case models.AuditStatusFailure:
+		status = ocsfStatusFailure
+	}
+
+	event := newOCSFEvent(ocsfCategoryIAM, class, activity, activityName, log.Timestamp, severity, status)
+	event.Message = title(log.EventType)
+	event.Metadata.UID = log.ID.String()
+	event.Metadata.EventCode = log.EventType
+	event.Metadata.LogName = "system"
+	if ip := deref(log.IPAddress); ip != "" {
+		event.SrcEndpoint = &OCSFEndpoint{IP: ip}
+	}
+	if ua := deref(log.UserAgent); ua != "" {
+		event.HTTPRequest = &OCSFHTTPRequest{UserAgent: ua}
+	}
+
+	switch class {
+	case ocsfClassAuthentication:
+		// The user signing in or out is the subject, not an actor
+		if log.UserID.Valid {
+			event.User = &OCSFUser{UID: log.UserID.UUID.String()}
+		}
+	default:
+		if log.UserID.Valid {
+			event.Actor = &OCSFActor{User: &OCSFUser{UID: log.UserID.UUID.String()}}
+		}
+		if log.TargetUserID.Valid {
+			event.User = &OCSFUser{UID: log.TargetUserID.UUID.String()}
+		}
+	}
+
+	if class == ocsfClassEntityManagement && (log.ResourceID.Valid || log.ResourceType != nil || log.ResourceName != nil) {
+		event.Entity = &OCSFEntity{Name: deref(log.ResourceName), Type: deref(log.ResourceType)}
+		if log.ResourceID.Valid {
+			event.Entity.UID = log.ResourceID.UUID.String()
+		}
+	}
+
+	unmapped := map[string]interface{}{"action": log.Action}
+	if class != ocsfClassEntityManagement {
+		addUnmapped(unmapped, "resource_type", deref(log.ResourceType))
+		if log.ResourceID.Valid {
+			unmapped["resource_id"] = log.ResourceID.UUID.String()
+		}
+		addUnmapped(unmapped, "resource_name", deref(log.ResourceName))
+	}
+	if log.ElevationID.Valid {
+		unmapped["elevation_id"] = log.ElevationID.UUID.String()
+	}
+	if details := deref(log.Details); details != "" {
+		// Details are JSON, kept as an object rather than a string where they parse
+		if json.Valid([]byte(details)) {
+			unmapped["details"] = json.RawMessage(details)
+		} else {
+			unmapped["details"] = details
+		}
+	}
+	addUnmapped(unmapped, "zone", zone)
+	event.Unmapped = unmapped
+
+	return event
+}
+
+// ocsfSystemActivity returns the class and activity of a system audit event
+func ocsfSystemActivity(log *models.SystemAuditLog) (class, activity int, name string) {
+	switch log.EventType {
+	case models.EventTypeLoginSuccess, models.EventTypeLoginFailed:
+		return ocsfClassAuthentication, ocsfAuthActivityLogon, "Logon"
+	case models.EventTypeLogout:
+		return ocsfClassAuthentication, ocsfAuthActivityLogoff, "Logoff"
+
+	case models.EventTypeUserCreated:
+		return ocsfClassAccountChange, ocsfAccountActivityCreate, "Create"
+	case models.EventTypeUserDeleted:
+		return ocsfClassAccountChange, ocsfAccountActivityDelete, "Delete"
+	case models.EventTypeUserUpdated:
+		return ocsfClassAccountChange, ocsfActivityOther, ocsfActivityOtherName
+
+	case models.EventTypeElevationApproved:
+		return ocsfClassUserAccessMgmt, ocsfAccessActivityAssign, "Assign Privileges"
+	case models.EventTypeElevationExpired, models.EventTypeElevationRevoked, models.EventTypeEntitlementRevoked:
+		return ocsfClassUserAccessMgmt, ocsfAccessActivityRevoke, "Revoke Privileges"
+	case models.EventTypePermissionChanged, models.EventTypeElevationRequested, models.EventTypeElevationRejected:
+		return ocsfClassUserAccessMgmt, ocsfActivityOther, ocsfActivityOtherName
+	case models.EventTypeADPrivilegedGroupChanged:
+		if log.Action == "member_removed" {
+			return ocsfClassUserAccessMgmt, ocsfAccessActivityRevoke, "Revoke Privileges"
+		}
+		return ocsfClassUserAccessMgmt, ocsfAccessActivityAssign, "Assign Privileges"
+	}
+
+	// Other events are named after what happened to a resource, such as
+	// target_created or laps_password_retrieved
+	switch {
+	case strings.HasSuffix(log.EventType, "_created") || strings.HasSuffix(log.EventType, "_enrolled") ||
+		strings.HasSuffix(log.EventType, "_onboarded") || strings.HasSuffix(log.EventType, "_deployed"):
+		return ocsfClassEntityManagement, ocsfEntityActivityCreate, "Create"
+	case strings.HasSuffix(log.EventType, "_viewed") || strings.HasSuffix(log.EventType, "_retrieved") ||
+		strings.HasSuffix(log.EventType, "_exported"):
+		return ocsfClassEntityManagement, ocsfEntityActivityRead, "Read"
+	case strings.HasSuffix(log.EventType, "_updated") || strings.HasSuffix(log.EventType, "_rotated") ||
+		strings.HasSuffix(log.EventType, "_changed"):
+		return ocsfClassEntityManagement, ocsfEntityActivityUpdate, "Update"
+	case strings.HasSuffix(log.EventType, "_deleted") || strings.HasSuffix(log.EventType, "_removed") ||
+		strings.HasSuffix(log.EventType, "_unenrolled") || strings.HasSuffix(log.EventType, "_dropped"):
+		return ocsfClassEntityManagement, ocsfEntityActivityDelete, "Delete"
+	}
+	return ocsfClassEntityManagement, ocsfActivityOther, ocsfActivityOtherName
+}
+
+func addUnmapped(unmapped map[string]interface{}, key, value string) {
+	if value != "" {
+		unmapped[key] = value
+	}
+}
@@ -0,0 +1,218 @@
+package siem
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/VanCannon/openpam/gateway/internal/models"
+	"github.com/google/uuid"
+)
+
+// Run with -update to rewrite the golden files after changing a mapping, and
+// bump MappingVersion if a field moved
+var update = flag.Bool("update", false, "rewrite the golden files in testdata")
+
+func init() {
+	productVersion = "1.4.2"
+}
+
+func ptr(s string) *string { return &s }
+
+var (
+	start  = time.Date(2026, 3, 2, 9, 30, 0, 0, time.UTC)
+	userID = uuid.MustParse("11111111-1111-1111-1111-111111111111")
+)
+
+func sessions() map[string]*models.AuditLog {
+	base := func(status string) *models.AuditLog {
+		return &models.AuditLog{
+			ID:            uuid.MustParse("22222222-2222-2222-2222-222222222222"),
+			UserID:        userID,
+			TargetID:      uuid.MustParse("33333333-3333-3333-3333-333333333333"),
+			CredentialID:  uuid.NullUUID{UUID: uuid.MustParse("44444444-4444-4444-4444-444444444444"), Valid: true},
+			StartTime:     start,
+			SessionStatus: status,
+			ClientIP:      ptr("203.0.113.7"),
+			Protocol:      models.ProtocolSSH,
+			Purpose:       ptr("change"),
+			Reason:        ptr("CHG-1042 patch | reboot"),
+		}
+	}
+
+	started := base(models.SessionStatusActive)
+
+	completed := base(models.SessionStatusCompleted)
+	completed.EndTime = sql.NullTime{Time: start.Add(15 * time.Minute), Valid: true}
+	completed.BytesSent = 20480
+	completed.BytesReceived = 4096
+	completed.RecordingPath = ptr("recordings/22222222-2222-2222-2222-222222222222.cast")
+
+	failed := base(models.SessionStatusFailed)
+	failed.Protocol = models.ProtocolRDP
+	failed.EndTime = sql.NullTime{Time: start.Add(2 * time.Second), Valid: true}
+	failed.ErrorMessage = ptr("authentication failed: user=admin\nretry later")
+
+	return map[string]*models.AuditLog{
+		"session_started":   started,
+		"session_completed": completed,
+		"session_failed":    failed,
+	}
+}
+
+func systemEvents() map[string]*models.SystemAuditLog {
+	base := func(eventType, action, status string) *models.SystemAuditLog {
+		return &models.SystemAuditLog{
+			ID:        uuid.MustParse("55555555-5555-5555-5555-555555555555"),
+			Timestamp: start,
+			EventType: eventType,
+			UserID:    uuid.NullUUID{UUID: userID, Valid: true},
+			Action:    action,
+			Status:    status,
+			IPAddress: ptr("198.51.100.20"),
+			UserAgent: ptr("Mozilla/5.0"),
+		}
+	}
+
+	loginFailed := base(models.EventTypeLoginFailed, "login", models.AuditStatusFailure)
+	loginFailed.Details = ptr(`{"reason":"invalid_state"}`)
+
+	userCreated := base(models.EventTypeUserCreated, "create", models.AuditStatusSuccess)
+	userCreated.TargetUserID = uuid.NullUUID{UUID: uuid.MustParse("66666666-6666-6666-6666-666666666666"), Valid: true}
+
+	elevation := base(models.EventTypeElevationApproved, "approve", models.AuditStatusSuccess)
+	elevation.TargetUserID = uuid.NullUUID{UUID: uuid.MustParse("66666666-6666-6666-6666-666666666666"), Valid: true}
+	elevation.ResourceType = ptr("elevation")
+	elevation.ResourceID = uuid.NullUUID{UUID: uuid.MustParse("77777777-7777-7777-7777-777777777777"), Valid: true}
+
+	targetDeleted := base(models.EventTypeTargetDeleted, "delete", models.AuditStatusSuccess)
+	targetDeleted.ResourceType = ptr("target")
+	targetDeleted.ResourceID = uuid.NullUUID{UUID: uuid.MustParse("33333333-3333-3333-3333-333333333333"), Valid: true}
+	targetDeleted.ResourceName = ptr("db=primary")
+	targetDeleted.ElevationID = uuid.NullUUID{UUID: uuid.MustParse("88888888-8888-8888-8888-888888888888"), Valid: true}
+
+	alert := base(models.EventTypeWatchAlert, "alert", models.AuditStatusSuccess)
+	alert.UserID = uuid.NullUUID{}
+	alert.IPAddress = nil
+	alert.UserAgent = nil
+	alert.Details = ptr(`{"rule_name":"Brute force","event_count":4}`)
+
+	adGroup := base(models.EventTypeADPrivilegedGroupChanged, "member_added", models.AuditStatusSuccess)
+	adGroup.UserID = uuid.NullUUID{}
+	adGroup.IPAddress = nil
+	adGroup.UserAgent = nil
+	adGroup.ResourceType = ptr("ad_group")
+	adGroup.ResourceID = uuid.NullUUID{UUID: uuid.MustParse("99999999-9999-9999-9999-999999999999"), Valid: true}
+	adGroup.ResourceName = ptr("Domain Admins")
+	adGroup.Details = ptr(`{"group_dn":"CN=Domain Admins,CN=Users,DC=corp,DC=example","member_dn":"CN=Eve,OU=Staff,DC=corp,DC=example","sam_account_name":"eve","direct":true}`)
+
+	return map[string]*models.SystemAuditLog{
+		"ad_privileged_group_changed": adGroup,
+		"login_failed":                loginFailed,
+		"user_created":                userCreated,
+		"role_elevation_approved":     elevation,
+		"target_deleted":              targetDeleted,
+		"watch_alert":                 alert,
+	}
+}
+
+// golden compares got with testdata/name, or rewrites it with -update
+func golden(t *testing.T, name string, got []byte) {
+	t.Helper()
+	path := filepath.Join("testdata", name)
+	if *update {
+		if err := os.WriteFile(path, got, 0644); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+
+	want, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("%v (run the tests with -update to create it)", err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("%s changed; if that's intended, run with -update and bump MappingVersion\ngot:\n%s\nwant:\n%s", name, got, want)
+	}
+}
+
+func ocsfJSON(t *testing.T, event *OCSFEvent) []byte {
+	data, err := json.MarshalIndent(event, "", "  ")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return append(data, '\n')
+}
+
+func TestSessionGolden(t *testing.T) {
+	for name, log := range sessions() {
+		golden(t, name+".cef", []byte(CEFSession(log, "eu-west")+"\n"))
+		golden(t, name+".ocsf.json", ocsfJSON(t, OCSFSession(log, "eu-west")))
+	}
+}
+
+func TestSystemGolden(t *testing.T) {
+	for name, log := range systemEvents() {
+		golden(t, name+".cef", []byte(CEFSystem(log, "eu-west")+"\n"))
+		golden(t, name+".ocsf.json", ocsfJSON(t, OCSFSystem(log, "eu-west")))
+	}
+}
+
+func TestCEFEscaping(t *testing.T) {
+	log := systemEvents()["target_deleted"]
+	log.EventType = "odd|type"
+	log.Details = ptr("a=b\\c\r\nd")
+
+	record := CEFSystem(log, "")
+	if !strings.HasPrefix(record, `CEF:0|OpenPAM|OpenPAM Gateway|1.4.2|odd\|type|Odd\|type|3|`) {
+		t.Errorf("header not escaped: %s", record)
+	}
+	if !strings.Contains(record, `msg=a\=b\\c\nd `) {
+		t.Errorf("extension not escaped: %s", record)
+	}
+	if strings.Contains(record, "cs5Label") {
+		t.Errorf("empty zone written: %s", record)
+	}
+}
+
+func TestOCSFSystemActivity(t *testing.T) {
+	tests := []struct {
+		eventType string
+		class     int
+		activity  int
+	}{
+		{models.EventTypeLoginSuccess, ocsfClassAuthentication, ocsfAuthActivityLogon},
+		{models.EventTypeLogout, ocsfClassAuthentication, ocsfAuthActivityLogoff},
+		{models.EventTypeUserDeleted, ocsfClassAccountChange, ocsfAccountActivityDelete},
+		{models.EventTypeElevationRevoked, ocsfClassUserAccessMgmt, ocsfAccessActivityRevoke},
+		{models.EventTypeLAPSRetrieved, ocsfClassEntityManagement, ocsfEntityActivityRead},
+		{models.EventTypeAccountRotated, ocsfClassEntityManagement, ocsfEntityActivityUpdate},
+		{models.EventTypeSSHKeyRemoved, ocsfClassEntityManagement, ocsfEntityActivityDelete},
+		{models.EventTypeZoneCreated, ocsfClassEntityManagement, ocsfEntityActivityCreate},
+		{models.EventTypeScheduleApproved, ocsfClassEntityManagement, ocsfActivityOther},
+	}
+
+	for _, tt := range tests {
+		class, activity, _ := ocsfSystemActivity(&models.SystemAuditLog{EventType: tt.eventType})
+		if class != tt.class || activity != tt.activity {
+			t.Errorf("%s: got class %d activity %d, want %d and %d", tt.eventType, class, activity, tt.class, tt.activity)
+		}
+	}
+}
+
+func TestValidateFormat(t *testing.T) {
+	for _, format := range []string{FormatNative, FormatCEF, FormatOCSF} {
+		if err := ValidateFormat(format); err != nil {
+			t.Errorf("ValidateFormat(%q) = %v", format, err)
+		}
+	}
+	if err := ValidateFormat("leef"); err == nil {
+		t.Error("ValidateFormat accepted an unknown format")
+	}
+}
@@ -0,0 +1,85 @@
+package ssh
+
+import (
+	"time"
+
+	"github.com/VanCannon/openpam/gateway/internal/models"
+	"golang.org/x/crypto/ssh"
+)
+
+// KeepaliveConfig controls SSH keep-alive requests sent to targets
+type KeepaliveConfig struct {
+	// Interval is the default interval for targets that don't set their own (0 disables)
+	Interval time.Duration
+	// MaxMissed is the number of unanswered keep-alives before the target is considered dead
+	MaxMissed int
+}
+
+// intervalFor returns the keep-alive interval for a target, preferring the target's own setting
+func (c KeepaliveConfig) intervalFor(target *models.Target) time.Duration {
+	if target.KeepaliveInterval != nil {
+		return time.Duration(*target.KeepaliveInterval) * time.Second
+	}
+	return c.Interval
+}
+
+func (c KeepaliveConfig) maxMissed() int {
+	if c.MaxMissed <= 0 {
+		return 3
+	}
+	return c.MaxMissed
+}
+
+// keepAlive sends OpenSSH keep-alive requests until stop is closed.
+//
+// Each request waits up to one interval for a reply. After MaxMissed consecutive
+// unanswered requests, or if the request fails outright, the target connection is
+// closed and dead is closed so the session can be finalized straight away.
+func (p *Proxy) keepAlive(client *ssh.Client, interval time.Duration, dead chan<- struct{}, stop <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	missed := 0
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+
+		reply := make(chan error, 1)
+		go func() {
+			_, _, err := client.SendRequest("keepalive@openssh.com", true, nil)
+			reply <- err
+		}()
+
+		timer := time.NewTimer(interval)
+		select {
+		case <-stop:
+			timer.Stop()
+			return
+		case err := <-reply:
+			timer.Stop()
+			if err != nil {
+				p.logger.Warn("SSH keep-alive failed", map[string]interface{}{
+					"error": err.Error(),
+				})
+				missed = p.keepalive.maxMissed()
+			} else {
+				missed = 0
+			}
+		case <-timer.C:
+			missed++
+			p.logger.Debug("SSH keep-alive unanswered", map[string]interface{}{
+				"missed": missed,
+			})
+		}
+
+		if missed >= p.keepalive.maxMissed() {
+			// Signal before closing so the session reports the dead target, not a generic error
+			close(dead)
+			client.Close()
+			return
+		}
+	}
+}
@@ -0,0 +1,46 @@
+package ssh
+
+import (
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// Environment variables a session's metadata is passed to the target in
+const (
+	EnvUser    = "OPENPAM_USER"
+	EnvSession = "OPENPAM_SESSION"
+)
+
+// Metadata identifies a session to its target, so the target's logs of the
+// shared account can be matched to the OpenPAM user and audit log
+type Metadata struct {
+	User    string // Email of the OpenPAM user
+	Session string // Audit log ID
+}
+
+// setenv passes the metadata as environment variables. Servers refuse the
+// variables their AcceptEnv doesn't list; it reports whether both were taken.
+func (m Metadata) setenv(session *ssh.Session) bool {
+	return session.Setenv(EnvUser, m.User) == nil && session.Setenv(EnvSession, m.Session) == nil
+}
+
+// bannerLine is a shell comment naming the user and session. Typed into the
+// shell, it lands in the shell history and in TTY audit logs.
+func (m Metadata) bannerLine() string {
+	return fmt.Sprintf("# openpam user=%s session=%s\n", bannerValue(m.User), bannerValue(m.Session))
+}
+
+// bannerValue keeps a value on one word of one line
+func bannerValue(s string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r == ' ' || r == '\t':
+			return '_'
+		case r < 0x20 || r == 0x7f:
+			return -1
+		}
+		return r
+	}, s)
+}
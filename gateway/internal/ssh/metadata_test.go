@@ -0,0 +1,12 @@
+package ssh
+
+import "testing"
+
+func TestMetadata_BannerLine(t *testing.T) {
+	m := Metadata{User: "alice smith@example.com\n; rm -rf /", Session: "7c9e6679-7425-40de-944b-e07fc1f90ae7"}
+
+	want := "# openpam user=alice_smith@example.com;_rm_-rf_/ session=7c9e6679-7425-40de-944b-e07fc1f90ae7\n"
+	if got := m.bannerLine(); got != want {
+		t.Errorf("bannerLine() = %q, want %q", got, want)
+	}
+}
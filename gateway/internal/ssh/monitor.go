@@ -1,34 +1,133 @@
 package ssh
 
 import (
+	"bytes"
 	"sync"
+	"time"
+
+	"github.com/VanCannon/openpam/gateway/internal/models"
 )
 
+// ScrollbackLimits bound the recent output kept for monitors that join a
+// session late. Output is dropped once either limit is exceeded; zero
+// MaxBytes keeps none, zero MaxAge keeps it regardless of age.
+type ScrollbackLimits struct {
+	MaxBytes int
+	MaxAge   time.Duration
+}
+
+// MonitorConfig sets the scrollback kept for each protocol
+type MonitorConfig struct {
+	SSH ScrollbackLimits
+	RDP ScrollbackLimits
+}
+
+// DefaultMonitorConfig returns the default scrollback limits
+func DefaultMonitorConfig() MonitorConfig {
+	return MonitorConfig{
+		SSH: ScrollbackLimits{MaxBytes: 64 * 1024, MaxAge: 15 * time.Minute},
+		RDP: ScrollbackLimits{MaxBytes: 1 << 20, MaxAge: 30 * time.Second},
+	}
+}
+
+// chunk is one broadcast kept in a session's scrollback
+type chunk struct {
+	at   time.Time
+	data []byte
+}
+
+// monitoredSession holds a session's subscribers and what new subscribers are sent
+type monitoredSession struct {
+	live        bool // Between Start and End
+	limits      ScrollbackLimits
+	header      []byte
+	scrollback  []chunk
+	bytes       int
+	subscribers []chan []byte
+}
+
+// trim drops scrollback beyond the session's limits
+func (s *monitoredSession) trim(now time.Time) {
+	drop := 0
+	for drop < len(s.scrollback) {
+		c := s.scrollback[drop]
+		if s.bytes <= s.limits.MaxBytes && (s.limits.MaxAge <= 0 || now.Sub(c.at) <= s.limits.MaxAge) {
+			break
+		}
+		s.bytes -= len(c.data)
+		drop++
+	}
+	if drop > 0 {
+		clear(s.scrollback[:drop])
+		s.scrollback = s.scrollback[drop:]
+	}
+}
+
 // Monitor manages live session monitoring by broadcasting session data to multiple subscribers
 type Monitor struct {
-	// subscribers maps session ID to a list of subscriber channels
-	subscribers map[string][]chan []byte
-	// headers maps session ID to a header message (sent to new subscribers)
-	headers map[string][]byte
-	mu      sync.RWMutex
+	config   MonitorConfig
+	sessions map[string]*monitoredSession
+	mu       sync.RWMutex
 }
 
 // NewMonitor creates a new session monitor
-func NewMonitor() *Monitor {
+func NewMonitor(config MonitorConfig) *Monitor {
 	return &Monitor{
-		subscribers: make(map[string][]chan []byte),
-		headers:     make(map[string][]byte),
+		config:   config,
+		sessions: make(map[string]*monitoredSession),
+	}
+}
+
+// session returns the state for a session, creating it if needed. The caller must hold the write lock.
+func (m *Monitor) session(sessionID string) *monitoredSession {
+	s, ok := m.sessions[sessionID]
+	if !ok {
+		s = &monitoredSession{}
+		m.sessions[sessionID] = s
+	}
+	return s
+}
+
+// Start begins keeping scrollback for a session with the protocol's limits
+func (m *Monitor) Start(sessionID, protocol string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	s := m.session(sessionID)
+	s.live = true
+	switch protocol {
+	case models.ProtocolSSH:
+		s.limits = m.config.SSH
+	case models.ProtocolRDP:
+		s.limits = m.config.RDP
+	}
+}
+
+// End discards a session's state and closes its subscribers' channels, so
+// monitors learn the session is over
+func (m *Monitor) End(sessionID string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	s, ok := m.sessions[sessionID]
+	if !ok {
+		return
+	}
+	for _, ch := range s.subscribers {
+		close(ch)
 	}
+	delete(m.sessions, sessionID)
 }
 
 // SetHeader sets the header message for a session, which is sent to all new subscribers
 func (m *Monitor) SetHeader(sessionID string, data []byte) {
 	m.mu.Lock()
 	defer m.mu.Unlock()
-	m.headers[sessionID] = data
+	m.session(sessionID).header = data
 }
 
-// Subscribe adds a new subscriber for a session and returns a channel to receive data
+// Subscribe adds a new subscriber for a session and returns a channel to receive data.
+// The session's header and scrollback are queued on it first.
 func (m *Monitor) Subscribe(sessionID string) chan []byte {
 	m.mu.Lock()
 	defer m.mu.Unlock()
@@ -36,15 +135,23 @@ func (m *Monitor) Subscribe(sessionID string) chan []byte {
 	// Create a buffered channel to prevent blocking if subscriber is slow
 	ch := make(chan []byte, 100)
 
-	if m.subscribers[sessionID] == nil {
-		m.subscribers[sessionID] = []chan []byte{}
-	}
-
-	m.subscribers[sessionID] = append(m.subscribers[sessionID], ch)
+	s := m.session(sessionID)
+	s.subscribers = append(s.subscribers, ch)
 
 	// Send header if exists
-	if header, ok := m.headers[sessionID]; ok {
-		ch <- header
+	if s.header != nil {
+		ch <- s.header
+	}
+
+	// Catch up with recent output in a single message
+	s.trim(time.Now())
+	if len(s.scrollback) > 0 {
+		var buf bytes.Buffer
+		buf.Grow(s.bytes)
+		for _, c := range s.scrollback {
+			buf.Write(c.data)
+		}
+		ch <- buf.Bytes()
 	}
 
 	return ch
@@ -55,24 +162,23 @@ func (m *Monitor) Unsubscribe(sessionID string, ch chan []byte) {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
-	subs, ok := m.subscribers[sessionID]
+	s, ok := m.sessions[sessionID]
 	if !ok {
 		return
 	}
 
 	// Find and remove the channel
-	for i, subscriber := range subs {
+	for i, subscriber := range s.subscribers {
 		if subscriber == ch {
 			// Close the channel
 			close(ch)
 
 			// Remove from slice
-			m.subscribers[sessionID] = append(subs[:i], subs[i+1:]...)
+			s.subscribers = append(s.subscribers[:i], s.subscribers[i+1:]...)
 
-			// Clean up empty session entries
-			if len(m.subscribers[sessionID]) == 0 {
-				delete(m.subscribers, sessionID)
-				delete(m.headers, sessionID)
+			// Clean up sessions that aren't running
+			if len(s.subscribers) == 0 && !s.live {
+				delete(m.sessions, sessionID)
 			}
 
 			return
@@ -80,21 +186,31 @@ func (m *Monitor) Unsubscribe(sessionID string, ch chan []byte) {
 	}
 }
 
-// Broadcast sends data to all subscribers of a session
+// Broadcast sends data to all subscribers of a session and keeps it in the
+// session's scrollback. The data is copied, so callers may reuse their buffer.
 func (m *Monitor) Broadcast(sessionID string, data []byte) {
-	m.mu.RLock()
-	defer m.mu.RUnlock()
+	m.mu.Lock()
+	defer m.mu.Unlock()
 
-	subs, ok := m.subscribers[sessionID]
-	if !ok || len(subs) == 0 {
+	s, ok := m.sessions[sessionID]
+	if !ok || (len(s.subscribers) == 0 && s.limits.MaxBytes <= 0) {
 		return
 	}
 
+	msg := make([]byte, len(data))
+	copy(msg, data)
+
+	if s.limits.MaxBytes > 0 {
+		s.scrollback = append(s.scrollback, chunk{at: time.Now(), data: msg})
+		s.bytes += len(msg)
+		s.trim(time.Now())
+	}
+
 	// Send to all subscribers
 	// Use non-blocking send to prevent slow subscribers from blocking the session
-	for _, ch := range subs {
+	for _, ch := range s.subscribers {
 		select {
-		case ch <- data:
+		case ch <- msg:
 			// Successfully sent
 		default:
 			// Channel buffer is full, skip this send
@@ -108,8 +224,8 @@ func (m *Monitor) HasSubscribers(sessionID string) bool {
 	m.mu.RLock()
 	defer m.mu.RUnlock()
 
-	subs, ok := m.subscribers[sessionID]
-	return ok && len(subs) > 0
+	s, ok := m.sessions[sessionID]
+	return ok && len(s.subscribers) > 0
 }
 
 // SubscriberCount returns the number of active subscribers for a session
@@ -117,9 +233,9 @@ func (m *Monitor) SubscriberCount(sessionID string) int {
 	m.mu.RLock()
 	defer m.mu.RUnlock()
 
-	subs, ok := m.subscribers[sessionID]
+	s, ok := m.sessions[sessionID]
 	if !ok {
 		return 0
 	}
-	return len(subs)
+	return len(s.subscribers)
 }
@@ -0,0 +1,84 @@
+package ssh
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/VanCannon/openpam/gateway/internal/models"
+)
+
+// drain returns everything queued on ch without blocking
+func drain(ch chan []byte) string {
+	var sb strings.Builder
+	for {
+		select {
+		case data, ok := <-ch:
+			if !ok {
+				return sb.String()
+			}
+			sb.Write(data)
+		default:
+			return sb.String()
+		}
+	}
+}
+
+func TestMonitor_ScrollbackForLateSubscribers(t *testing.T) {
+	m := NewMonitor(MonitorConfig{SSH: ScrollbackLimits{MaxBytes: 8}})
+	m.Start("s1", models.ProtocolSSH)
+
+	buf := []byte("abcd")
+	m.Broadcast("s1", buf)
+	copy(buf, "efgh") // Callers reuse their read buffer
+	m.Broadcast("s1", buf)
+	m.Broadcast("s1", []byte("ij"))
+
+	// The oldest chunk is dropped to stay within MaxBytes
+	ch := m.Subscribe("s1")
+	if got := drain(ch); got != "efghij" {
+		t.Errorf("scrollback = %q, want %q", got, "efghij")
+	}
+
+	m.Broadcast("s1", []byte("kl"))
+	if got := drain(ch); got != "kl" {
+		t.Errorf("live output = %q, want %q", got, "kl")
+	}
+
+	// Ending the session closes subscribers and discards its state
+	m.End("s1")
+	if _, ok := <-ch; ok {
+		t.Error("subscriber channel should be closed when the session ends")
+	}
+	m.Unsubscribe("s1", ch) // Must not close the channel twice
+	if got := drain(m.Subscribe("s1")); got != "" {
+		t.Errorf("scrollback after end = %q, want none", got)
+	}
+}
+
+func TestMonitor_ScrollbackAgeAndHeader(t *testing.T) {
+	m := NewMonitor(MonitorConfig{RDP: ScrollbackLimits{MaxBytes: 1 << 20, MaxAge: 20 * time.Millisecond}})
+	m.Start("s1", models.ProtocolRDP)
+	m.SetHeader("s1", []byte("4.size,1.0,4.1024,3.768;"))
+	m.Broadcast("s1", []byte("3.nop;"))
+
+	time.Sleep(40 * time.Millisecond)
+	m.Broadcast("s1", []byte("4.sync,1.1;"))
+
+	if got, want := drain(m.Subscribe("s1")), "4.size,1.0,4.1024,3.768;4.sync,1.1;"; got != want {
+		t.Errorf("catch-up = %q, want %q", got, want)
+	}
+}
+
+func TestMonitor_NoScrollbackWithoutStart(t *testing.T) {
+	m := NewMonitor(DefaultMonitorConfig())
+	m.Broadcast("s1", []byte("lost"))
+	ch := m.Subscribe("s1")
+	if got := drain(ch); got != "" {
+		t.Errorf("unstarted session kept %q", got)
+	}
+	m.Unsubscribe("s1", ch)
+	if m.SubscriberCount("s1") != 0 {
+		t.Error("subscriber not removed")
+	}
+}
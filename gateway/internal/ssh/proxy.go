@@ -3,44 +3,82 @@ package ssh
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"strings"
 	"sync"
 	"time"
 
-	"github.com/VanCannon/openpam/gateway/internal/logger"
+	"github.com/VanCannon/openpam/gateway/internal/evidence"
 	"github.com/VanCannon/openpam/gateway/internal/models"
+	"github.com/VanCannon/openpam/gateway/internal/notice"
+	"github.com/VanCannon/openpam/gateway/internal/recordings"
+	"github.com/VanCannon/openpam/gateway/internal/settings"
 	"github.com/VanCannon/openpam/gateway/internal/vault"
+	"github.com/VanCannon/openpam/gateway/internal/wsconn"
+	"github.com/VanCannon/openpam/pkg/logger"
 	"github.com/gorilla/websocket"
 	"golang.org/x/crypto/ssh"
 )
 
+// ErrAuthenticationFailed is returned when the target rejects the session's credentials
+var ErrAuthenticationFailed = errors.New("SSH authentication failed")
+
 // Proxy handles SSH protocol proxying over WebSocket
 type Proxy struct {
-	logger   *logger.Logger
-	recorder *Recorder
-	monitor  *Monitor
+	logger     *logger.Logger
+	recorder   *Recorder
+	monitor    *Monitor
+	wsConfig   wsconn.Config
+	keepalive  KeepaliveConfig
+	violations *evidence.Capturer // nil disables violation detection
 }
 
 // NewProxy creates a new SSH proxy
-func NewProxy(log *logger.Logger, recorder *Recorder, monitor *Monitor) *Proxy {
+func NewProxy(log *logger.Logger, recorder *Recorder, monitor *Monitor, wsConfig wsconn.Config, keepalive KeepaliveConfig, violations *evidence.Capturer) *Proxy {
 	return &Proxy{
-		logger:   log,
-		recorder: recorder,
-		monitor:  monitor,
+		logger:     log,
+		recorder:   recorder,
+		monitor:    monitor,
+		wsConfig:   wsConfig,
+		keepalive:  keepalive,
+		violations: violations,
 	}
 }
 
-// Handle proxies an SSH connection over WebSocket
+// Handle proxies an SSH connection over WebSocket for user, the email of the
+// OpenPAM user
 func (p *Proxy) Handle(
 	ctx context.Context,
 	wsConn *websocket.Conn,
 	target *models.Target,
 	creds *vault.Credentials,
 	auditLog *models.AuditLog,
+	user string,
+	pty PtyOptions,
 ) error {
+	// All writes to the client go through the pump so a slow client can't stall the SSH reads.
+	// It also pings the client, so it must be in place before reading starts.
+	pump := wsconn.NewWritePump(wsConn, p.wsConfig, p.logger)
+	defer pump.Stop()
+
+	// Keep recent output for monitors that join later
+	if p.monitor != nil {
+		p.monitor.Start(auditLog.ID.String(), models.ProtocolSSH)
+		defer p.monitor.End(auditLog.ID.String())
+	}
+
+	// Read client messages on a dedicated goroutine so we can wait for an
+	// optional init message without putting a deadline on the WebSocket
+	messages := make(chan wsMessage, 16)
+	stopReading := make(chan struct{})
+	defer close(stopReading)
+	var readErr error // Set by the reader before messages is closed; read only after
+	go p.readMessages(wsConn, messages, stopReading, &readErr)
+
 	// Build SSH client config
-	config, err := p.buildSSHConfig(creds)
+	config, err := ClientConfig(creds)
 	if err != nil {
 		return fmt.Errorf("failed to build SSH config: %w", err)
 	}
@@ -49,6 +87,10 @@ func (p *Proxy) Handle(
 	addr := fmt.Sprintf("%s:%d", target.Hostname, target.Port)
 	sshConn, err := ssh.Dial("tcp", addr, config)
 	if err != nil {
+		// x/crypto/ssh has no error type for rejected credentials
+		if strings.Contains(err.Error(), "unable to authenticate") {
+			return fmt.Errorf("%w: %w", ErrAuthenticationFailed, err)
+		}
 		return fmt.Errorf("failed to connect to SSH server: %w", err)
 	}
 	defer sshConn.Close()
@@ -64,6 +106,19 @@ func (p *Proxy) Handle(
 	}
 	defer session.Close()
 
+	// Identify the session to the target, for its logs of the shared account
+	meta := Metadata{User: user, Session: auditLog.ID.String()}
+	injected := settings.InjectMetadata(ctx)
+	if injected == models.InjectMetadataEnv && !meta.setenv(session) {
+		injected = models.InjectMetadataBanner
+	}
+	if injected != models.InjectMetadataOff {
+		if auditLog.Metadata == nil {
+			auditLog.Metadata = models.JSONB{}
+		}
+		auditLog.Metadata["injected_metadata"] = injected
+	}
+
 	// Set up terminal modes
 	modes := ssh.TerminalModes{
 		ssh.ECHO:          1,
@@ -71,9 +126,25 @@ func (p *Proxy) Handle(
 		ssh.TTY_OP_OSPEED: 14400,
 	}
 
+	// Complete the terminal settings from the client's init message if the query didn't carry them
+	var pending *wsMessage
+	if !pty.hasSize() {
+		var connected bool
+		pending, connected = awaitInitMessage(messages, &pty)
+		if !connected {
+			return fmt.Errorf("client disconnected before session start")
+		}
+	}
+	pty = pty.withDefaults()
+
 	// Request PTY
-	p.logger.Info("Requesting PTY", map[string]interface{}{"target": target.Hostname})
-	if err := session.RequestPty("xterm-256color", 40, 80, modes); err != nil {
+	p.logger.Info("Requesting PTY", map[string]interface{}{
+		"target": target.Hostname,
+		"term":   pty.Term,
+		"cols":   pty.Cols,
+		"rows":   pty.Rows,
+	})
+	if err := session.RequestPty(pty.Term, pty.Rows, pty.Cols, modes); err != nil {
 		return fmt.Errorf("failed to request PTY: %w", err)
 	}
 
@@ -93,6 +164,37 @@ func (p *Proxy) Handle(
 		return fmt.Errorf("failed to get stderr pipe: %w", err)
 	}
 
+	// Set up recording if enabled, before the shell so a session that must be
+	// recorded is refused before the user can type into it
+	var recWriter io.Writer
+	if settings.RecordingEnabled(ctx) {
+		if p.recorder == nil {
+			err = recordings.ErrUnavailable
+		} else {
+			recWriter, err = p.recorder.StartRecording(ctx, auditLog.ID.String())
+		}
+		if err != nil {
+			p.logger.Error("Failed to start recording", map[string]interface{}{
+				"session_id": auditLog.ID.String(),
+				"error":      err.Error(),
+			})
+			if err := recordings.Failed(ctx, err); err != nil {
+				return err
+			}
+		} else {
+			recordings.Started(ctx)
+			defer func() {
+				if err := p.recorder.StopRecording(auditLog.ID.String()); err != nil {
+					p.logger.Error("Failed to finish recording", map[string]interface{}{
+						"session_id": auditLog.ID.String(),
+						"error":      err.Error(),
+					})
+					recordings.Failed(ctx, err)
+				}
+			}()
+		}
+	}
+
 	// Start shell
 	p.logger.Info("Starting shell", map[string]interface{}{"target": target.Hostname})
 	if err := session.Shell(); err != nil {
@@ -100,87 +202,52 @@ func (p *Proxy) Handle(
 	}
 	p.logger.Info("Shell started", map[string]interface{}{"target": target.Hostname})
 
-	// Set up recording if enabled
-	var recWriter io.Writer
-	if p.recorder != nil {
-		recWriter, err = p.recorder.StartRecording(ctx, auditLog.ID.String())
-		if err != nil {
-			p.logger.Error("Failed to start recording", map[string]interface{}{
-				"error": err.Error(),
+	// The shell reads the line ahead of anything the user types
+	if injected == models.InjectMetadataBanner {
+		if _, err := io.WriteString(stdin, meta.bannerLine()); err != nil {
+			p.logger.Error("Failed to send session metadata", map[string]interface{}{
+				"session_id": auditLog.ID.String(),
+				"error":      err.Error(),
 			})
 		}
-		defer p.recorder.StopRecording(auditLog.ID.String())
+	}
+
+	// Detect a dead target connection with keep-alives
+	targetDead := make(chan struct{})
+	if interval := p.keepalive.intervalFor(target); interval > 0 {
+		stopKeepAlive := make(chan struct{})
+		defer close(stopKeepAlive)
+		go p.keepAlive(sshConn, interval, targetDead, stopKeepAlive)
 	}
 
 	// Proxy data between WebSocket and SSH
 	var wg sync.WaitGroup
 	var bytesSent, bytesReceived int64
-	var wsMutex sync.Mutex // Mutex to synchronize WebSocket writes
 	wsClosedChan := make(chan struct{}) // Signal when WebSocket closes
+	readerDone := false                 // Set before wsClosedChan once messages is drained, making readErr safe to read
 
 	// WebSocket -> SSH (user input)
 	wg.Add(1)
 	go func() {
 		defer wg.Done()
-		defer stdin.Close() // Close SSH stdin when WebSocket closes
+		defer stdin.Close()       // Close SSH stdin when WebSocket closes
 		defer close(wsClosedChan) // Signal that WebSocket closed
 		p.logger.Info("Starting WebSocket -> SSH loop")
-		for {
-			messageType, data, err := wsConn.ReadMessage()
-			if err != nil {
-				// Check if it's a normal WebSocket close
-				if websocket.IsCloseError(err, websocket.CloseNormalClosure, websocket.CloseGoingAway) {
-					p.logger.Info("WebSocket closed by client (user clicked X)")
-				} else {
-					p.logger.Debug("WebSocket read error", map[string]interface{}{
-						"error": err.Error(),
-					})
-				}
-				return
-			}
 
-			p.logger.Debug("Received data from WebSocket", map[string]interface{}{
-				"bytes":        len(data),
-				"message_type": messageType,
-			})
-
-			// Handle text messages as potential control messages
-			if messageType == websocket.TextMessage {
-				// Try to parse as JSON control message
-				var controlMsg struct {
-					Type string `json:"type"`
-					Cols int    `json:"cols"`
-					Rows int    `json:"rows"`
-				}
-				if err := json.Unmarshal(data, &controlMsg); err == nil && controlMsg.Type == "resize" {
-					p.logger.Debug("Handling terminal resize", map[string]interface{}{
-						"cols": controlMsg.Cols,
-						"rows": controlMsg.Rows,
-					})
-					// Handle resize
-					if err := session.WindowChange(controlMsg.Rows, controlMsg.Cols); err != nil {
-						p.logger.Error("Failed to resize terminal", map[string]interface{}{
-							"error": err.Error(),
-						})
-					}
-					continue
-				}
-				// If not a control message, treat as terminal input
+		// Input that arrived while we were waiting for an init message
+		if pending != nil {
+			if !p.handleClientMessage(session, stdin, *pending, &bytesSent) {
+				return
 			}
+		}
 
-			bytesSent += int64(len(data))
-
-			// Write to SSH stdin
-			if _, err := stdin.Write(data); err != nil {
-				p.logger.Error("Failed to write to SSH stdin", map[string]interface{}{
-					"error": err.Error(),
-				})
+		for msg := range messages {
+			settings.Touch(ctx)
+			if !p.handleClientMessage(session, stdin, msg, &bytesSent) {
 				return
 			}
-
-			// Don't record input - the terminal echo in stdout already captures it
-			// Recording input here causes duplicate keystrokes in the replay
 		}
+		readerDone = true
 	}()
 
 	// SSH stdout -> WebSocket
@@ -189,6 +256,15 @@ func (p *Proxy) Handle(
 		defer wg.Done()
 		p.logger.Info("Starting SSH stdout -> WebSocket loop")
 		buffer := make([]byte, 4096)
+
+		// Keep the latest output as evidence and check it against the DLP rules
+		var tail *evidence.Tail
+		var scanner *evidence.Scanner
+		if p.violations != nil {
+			tail = p.violations.NewTail()
+			scanner = p.violations.NewScanner()
+		}
+
 		for {
 			p.logger.Debug("Waiting to read from SSH stdout...")
 			n, err := stdout.Read(buffer)
@@ -214,11 +290,7 @@ func (p *Proxy) Handle(
 
 			// Send to WebSocket
 			p.logger.Debug("Sending data to WebSocket", map[string]interface{}{"bytes": n})
-			wsMutex.Lock()
-			err = wsConn.WriteMessage(websocket.BinaryMessage, data)
-			wsMutex.Unlock()
-
-			if err != nil {
+			if err := pump.Write(websocket.BinaryMessage, data); err != nil {
 				p.logger.Error("Failed to write to WebSocket", map[string]interface{}{
 					"error": err.Error(),
 				})
@@ -235,6 +307,24 @@ func (p *Proxy) Handle(
 			if p.monitor != nil {
 				p.monitor.Broadcast(auditLog.ID.String(), data)
 			}
+
+			if tail != nil {
+				tail.Write(data)
+				if scanner != nil {
+					for _, rule := range scanner.Scan(data) {
+						p.violations.Report(evidence.Violation{
+							SessionID:    auditLog.ID,
+							UserID:       auditLog.UserID,
+							TargetID:     auditLog.TargetID,
+							Type:         models.ViolationDLPMatch,
+							Rule:         rule.Name,
+							EvidenceKind: models.EvidenceTerminalOutput,
+							ContentType:  "text/plain; charset=utf-8",
+							Evidence:     tail.Bytes(),
+						})
+					}
+				}
+			}
 		}
 	}()
 
@@ -257,11 +347,7 @@ func (p *Proxy) Handle(
 			data := buffer[:n]
 
 			// Send to WebSocket
-			wsMutex.Lock()
-			err = wsConn.WriteMessage(websocket.BinaryMessage, data)
-			wsMutex.Unlock()
-
-			if err != nil {
+			if err := pump.Write(websocket.BinaryMessage, data); err != nil {
 				p.logger.Error("Failed to write stderr to WebSocket", map[string]interface{}{
 					"error": err.Error(),
 				})
@@ -270,6 +356,27 @@ func (p *Proxy) Handle(
 		}
 	}()
 
+	// Notices for the user, such as the session ending soon, go out as JSON
+	// text messages; terminal output is always binary
+	if notices := notice.Notices(ctx); notices != nil {
+		go func() {
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case n := <-notices:
+					msg, err := json.Marshal(map[string]interface{}{"type": "notice", "notice": n})
+					if err != nil {
+						continue
+					}
+					if err := pump.Write(websocket.TextMessage, msg); err != nil {
+						return
+					}
+				}
+			}
+		}()
+	}
+
 	// Wait for session to complete or context cancellation
 	done := make(chan error, 1)
 	go func() {
@@ -279,9 +386,35 @@ func (p *Proxy) Handle(
 	select {
 	case <-ctx.Done():
 		p.logger.Info("SSH session cancelled by context")
+		cause := context.Cause(ctx)
+		if code, text, ok := wsconn.CloseFor(cause); ok {
+			pump.Close(code, text)
+		}
 		wsConn.Close()
 		wg.Wait()
-		return ctx.Err()
+		auditLog.BytesSent = bytesSent
+		auditLog.BytesReceived = bytesReceived
+		return cause
+	case <-targetDead:
+		// Target stopped answering keep-alives - end the session now rather than on the next write
+		p.logger.Warn("SSH target unreachable, terminating session", map[string]interface{}{
+			"target": target.Hostname,
+		})
+		pump.Close(wsconn.CloseTargetUnreachable, wsconn.CloseReason{Reason: wsconn.ReasonTargetUnreachable}.Text())
+		wg.Wait()
+		auditLog.BytesSent = bytesSent
+		auditLog.BytesReceived = bytesReceived
+		return fmt.Errorf("SSH target unreachable: no reply to %d keep-alives", p.keepalive.maxMissed())
+	case <-pump.Done():
+		// Client stopped accepting data (slow consumer or write timeout)
+		p.logger.Warn("WebSocket writer stopped, terminating SSH session", map[string]interface{}{
+			"error": pump.Err().Error(),
+		})
+		session.Close()
+		wg.Wait()
+		auditLog.BytesSent = bytesSent
+		auditLog.BytesReceived = bytesReceived
+		return fmt.Errorf("websocket write failed: %w", pump.Err())
 	case <-wsClosedChan:
 		// WebSocket closed by client (user clicked X) - terminate SSH session
 		p.logger.Info("WebSocket closed by client, terminating SSH session")
@@ -289,12 +422,20 @@ func (p *Proxy) Handle(
 		wg.Wait()
 		auditLog.BytesSent = bytesSent
 		auditLog.BytesReceived = bytesReceived
+		// The reader also stops when the pump drops a slow client, which is not a user close
+		if errors.Is(pump.Err(), wsconn.ErrSlowConsumer) {
+			return fmt.Errorf("websocket write failed: %w", pump.Err())
+		}
+		// A read timeout means the client stopped answering pings
+		if readerDone && wsconn.IsTimeout(readErr) {
+			return fmt.Errorf("client connection lost: %w", readErr)
+		}
 		// Treat user-initiated close as successful completion
 		return nil
 	case err := <-done:
 		// SSH session ended - close WebSocket immediately to unblock goroutines
 		p.logger.Info("SSH session ended, closing WebSocket")
-		wsConn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, "SSH session ended"))
+		pump.Close(wsconn.CloseNormal, wsconn.CloseReason{Reason: wsconn.ReasonSessionEnded}.Text())
 		wsConn.Close()
 
 		wg.Wait() // Wait for goroutines to finish (they'll exit when WebSocket closes)
@@ -330,8 +471,89 @@ func (p *Proxy) Handle(
 	}
 }
 
-// buildSSHConfig creates SSH client configuration
-func (p *Proxy) buildSSHConfig(creds *vault.Credentials) (*ssh.ClientConfig, error) {
+// wsMessage is a single message read from the client
+type wsMessage struct {
+	messageType int
+	data        []byte
+}
+
+// readMessages reads client messages until the WebSocket closes or stop is closed,
+// then closes the channel. The read error that ended the loop is stored in readErr
+// before the channel is closed, so it is safe to read once the channel is drained.
+func (p *Proxy) readMessages(wsConn *websocket.Conn, messages chan<- wsMessage, stop <-chan struct{}, readErr *error) {
+	defer close(messages)
+	for {
+		messageType, data, err := wsConn.ReadMessage()
+		if err != nil {
+			// Check if it's a normal WebSocket close
+			if websocket.IsCloseError(err, websocket.CloseNormalClosure, websocket.CloseGoingAway) {
+				p.logger.Info("WebSocket closed by client (user clicked X)")
+			} else if wsconn.IsTimeout(err) {
+				p.logger.Warn("WebSocket client stopped responding to pings")
+			} else {
+				p.logger.Debug("WebSocket read error", map[string]interface{}{
+					"error": err.Error(),
+				})
+			}
+			*readErr = err
+			return
+		}
+		select {
+		case messages <- wsMessage{messageType: messageType, data: data}:
+		case <-stop:
+			return
+		}
+	}
+}
+
+// handleClientMessage applies a control message or forwards terminal input to the SSH session.
+// It returns false if the session can no longer accept input.
+func (p *Proxy) handleClientMessage(session *ssh.Session, stdin io.Writer, msg wsMessage, bytesSent *int64) bool {
+	p.logger.Debug("Received data from WebSocket", map[string]interface{}{
+		"bytes":        len(msg.data),
+		"message_type": msg.messageType,
+	})
+
+	// Handle text messages as potential control messages
+	if msg.messageType == websocket.TextMessage {
+		// Try to parse as JSON control message
+		var controlMsg controlMessage
+		if err := json.Unmarshal(msg.data, &controlMsg); err == nil && (controlMsg.Type == "resize" || controlMsg.Type == "init") {
+			if !validDimension(controlMsg.Cols) || !validDimension(controlMsg.Rows) {
+				return true
+			}
+			p.logger.Debug("Handling terminal resize", map[string]interface{}{
+				"cols": controlMsg.Cols,
+				"rows": controlMsg.Rows,
+			})
+			// Handle resize
+			if err := session.WindowChange(controlMsg.Rows, controlMsg.Cols); err != nil {
+				p.logger.Error("Failed to resize terminal", map[string]interface{}{
+					"error": err.Error(),
+				})
+			}
+			return true
+		}
+		// If not a control message, treat as terminal input
+	}
+
+	*bytesSent += int64(len(msg.data))
+
+	// Write to SSH stdin
+	if _, err := stdin.Write(msg.data); err != nil {
+		p.logger.Error("Failed to write to SSH stdin", map[string]interface{}{
+			"error": err.Error(),
+		})
+		return false
+	}
+
+	// Don't record input - the terminal echo in stdout already captures it
+	// Recording input here causes duplicate keystrokes in the replay
+	return true
+}
+
+// ClientConfig creates the SSH client configuration for logging in with creds
+func ClientConfig(creds *vault.Credentials) (*ssh.ClientConfig, error) {
 	config := &ssh.ClientConfig{
 		User:            creds.Username,
 		HostKeyCallback: ssh.InsecureIgnoreHostKey(), // TODO: Implement proper host key verification
@@ -0,0 +1,138 @@
+package ssh
+
+import (
+	"encoding/json"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+const (
+	// DefaultTerm is the terminal type requested when the client doesn't specify one
+	DefaultTerm = "xterm-256color"
+	// DefaultCols is the terminal width used when the client doesn't specify one
+	DefaultCols = 80
+	// DefaultRows is the terminal height used when the client doesn't specify one
+	DefaultRows = 40
+
+	maxTermDimension = 1000
+	maxTermLength    = 64
+
+	// initMessageTimeout is how long to wait for an initial control message
+	// when the client didn't send the terminal size in the query string
+	initMessageTimeout = 2 * time.Second
+)
+
+// PtyOptions describes the pseudo-terminal requested on the target
+type PtyOptions struct {
+	Term string
+	Cols int
+	Rows int
+}
+
+// controlMessage is a JSON control message sent by the client over a text frame
+type controlMessage struct {
+	Type string `json:"type"` // "init" or "resize"
+	Cols int    `json:"cols"`
+	Rows int    `json:"rows"`
+	Term string `json:"term,omitempty"`
+}
+
+// PtyOptionsFromQuery reads cols, rows and term from the connection query string.
+// Missing or invalid values are left zero so they can be filled from an init message.
+func PtyOptionsFromQuery(query url.Values) PtyOptions {
+	var opts PtyOptions
+
+	if cols, err := strconv.Atoi(query.Get("cols")); err == nil && validDimension(cols) {
+		opts.Cols = cols
+	}
+	if rows, err := strconv.Atoi(query.Get("rows")); err == nil && validDimension(rows) {
+		opts.Rows = rows
+	}
+	if term := query.Get("term"); validTerm(term) {
+		opts.Term = term
+	}
+
+	return opts
+}
+
+// hasSize reports whether both dimensions are known
+func (o PtyOptions) hasSize() bool {
+	return o.Cols > 0 && o.Rows > 0
+}
+
+// merge fills unset fields from a control message
+func (o *PtyOptions) merge(msg controlMessage) {
+	if o.Cols == 0 && validDimension(msg.Cols) {
+		o.Cols = msg.Cols
+	}
+	if o.Rows == 0 && validDimension(msg.Rows) {
+		o.Rows = msg.Rows
+	}
+	if o.Term == "" && validTerm(msg.Term) {
+		o.Term = msg.Term
+	}
+}
+
+// withDefaults fills any remaining unset fields with defaults
+func (o PtyOptions) withDefaults() PtyOptions {
+	if o.Cols == 0 {
+		o.Cols = DefaultCols
+	}
+	if o.Rows == 0 {
+		o.Rows = DefaultRows
+	}
+	if o.Term == "" {
+		o.Term = DefaultTerm
+	}
+	return o
+}
+
+// awaitInitMessage waits briefly for the client's first message and uses it to
+// complete the PTY options. If the first message is not a control message it is
+// returned so it can be delivered to the shell once it starts. It returns false
+// if the client disconnected while waiting.
+func awaitInitMessage(messages <-chan wsMessage, opts *PtyOptions) (*wsMessage, bool) {
+	timer := time.NewTimer(initMessageTimeout)
+	defer timer.Stop()
+
+	select {
+	case msg, ok := <-messages:
+		if !ok {
+			return nil, false
+		}
+		if msg.messageType == websocket.TextMessage {
+			var ctrl controlMessage
+			if err := json.Unmarshal(msg.data, &ctrl); err == nil && (ctrl.Type == "init" || ctrl.Type == "resize") {
+				opts.merge(ctrl)
+				return nil, true
+			}
+		}
+		return &msg, true
+	case <-timer.C:
+		// Client didn't send anything; defaults will be used
+		return nil, true
+	}
+}
+
+func validDimension(n int) bool {
+	return n > 0 && n <= maxTermDimension
+}
+
+// validTerm accepts terminal names made of letters, digits, '-', '+', '.' and '_'
+func validTerm(term string) bool {
+	if term == "" || len(term) > maxTermLength {
+		return false
+	}
+	for _, c := range term {
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9':
+		case c == '-' || c == '+' || c == '.' || c == '_':
+		default:
+			return false
+		}
+	}
+	return true
+}
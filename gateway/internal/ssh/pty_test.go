@@ -0,0 +1,130 @@
+package ssh
+
+import (
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/websocket"
+)
+
+func TestPtyOptionsFromQuery(t *testing.T) {
+	tests := []struct {
+		name  string
+		query string
+		want  PtyOptions
+	}{
+		{name: "size and term", query: "cols=120&rows=50&term=xterm", want: PtyOptions{Term: "xterm", Cols: 120, Rows: 50}},
+		{name: "largest size", query: "cols=1000&rows=1000", want: PtyOptions{Cols: 1000, Rows: 1000}},
+		{name: "nothing", query: ""},
+		{name: "zero size", query: "cols=0&rows=0"},
+		{name: "negative size", query: "cols=-80&rows=-24"},
+		{name: "oversized", query: "cols=1001&rows=100000"},
+		{name: "size not a number", query: "cols=wide&rows=24", want: PtyOptions{Rows: 24}},
+		{name: "term with a space", query: "term=xterm+256color%20x"},
+		{name: "term with an escape", query: "term=xterm%1b%5b"},
+		{name: "term too long", query: "term=" + strings.Repeat("x", maxTermLength+1)},
+		{name: "longest term", query: "term=" + strings.Repeat("x", maxTermLength), want: PtyOptions{Term: strings.Repeat("x", maxTermLength)}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			query, err := url.ParseQuery(tt.query)
+			if err != nil {
+				t.Fatalf("failed to parse query: %v", err)
+			}
+			if got := PtyOptionsFromQuery(query); got != tt.want {
+				t.Errorf("PtyOptionsFromQuery() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPtyOptions_WithDefaults(t *testing.T) {
+	tests := []struct {
+		name  string
+		query string
+		want  PtyOptions
+	}{
+		{name: "from the client", query: "cols=132&rows=43&term=vt100", want: PtyOptions{Term: "vt100", Cols: 132, Rows: 43}},
+		{name: "nothing", query: "", want: PtyOptions{Term: DefaultTerm, Cols: DefaultCols, Rows: DefaultRows}},
+		{name: "empty term", query: "cols=100&rows=30&term=", want: PtyOptions{Term: DefaultTerm, Cols: 100, Rows: 30}},
+		{name: "invalid term", query: "cols=100&rows=30&term=xterm%3Breset", want: PtyOptions{Term: DefaultTerm, Cols: 100, Rows: 30}},
+		{name: "zero size", query: "cols=0&rows=0&term=xterm", want: PtyOptions{Term: "xterm", Cols: DefaultCols, Rows: DefaultRows}},
+		{name: "oversized", query: "cols=5000&rows=20", want: PtyOptions{Term: DefaultTerm, Cols: DefaultCols, Rows: 20}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			query, err := url.ParseQuery(tt.query)
+			if err != nil {
+				t.Fatalf("failed to parse query: %v", err)
+			}
+			if got := PtyOptionsFromQuery(query).withDefaults(); got != tt.want {
+				t.Errorf("withDefaults() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPtyOptions_Merge(t *testing.T) {
+	tests := []struct {
+		name string
+		opts PtyOptions
+		msg  controlMessage
+		want PtyOptions
+	}{
+		{name: "fills unset", msg: controlMessage{Type: "init", Cols: 120, Rows: 50, Term: "screen"}, want: PtyOptions{Term: "screen", Cols: 120, Rows: 50}},
+		{name: "keeps the query", opts: PtyOptions{Term: "xterm", Cols: 100, Rows: 30}, msg: controlMessage{Type: "init", Cols: 120, Rows: 50, Term: "screen"}, want: PtyOptions{Term: "xterm", Cols: 100, Rows: 30}},
+		{name: "ignores invalid", msg: controlMessage{Type: "init", Cols: 0, Rows: 1001, Term: "bad term"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := tt.opts
+			opts.merge(tt.msg)
+			if opts != tt.want {
+				t.Errorf("merge() = %+v, want %+v", opts, tt.want)
+			}
+		})
+	}
+}
+
+func TestAwaitInitMessage(t *testing.T) {
+	t.Run("init message", func(t *testing.T) {
+		messages := make(chan wsMessage, 1)
+		messages <- wsMessage{messageType: websocket.TextMessage, data: []byte(`{"type":"init","cols":120,"rows":50,"term":"xterm"}`)}
+
+		var opts PtyOptions
+		pending, ok := awaitInitMessage(messages, &opts)
+		if !ok || pending != nil {
+			t.Fatalf("awaitInitMessage() = %v, %v, want the init message consumed", pending, ok)
+		}
+		if want := (PtyOptions{Term: "xterm", Cols: 120, Rows: 50}); opts != want {
+			t.Errorf("options = %+v, want %+v", opts, want)
+		}
+	})
+
+	t.Run("input first", func(t *testing.T) {
+		messages := make(chan wsMessage, 1)
+		messages <- wsMessage{messageType: websocket.TextMessage, data: []byte("ls\n")}
+
+		var opts PtyOptions
+		pending, ok := awaitInitMessage(messages, &opts)
+		if !ok || pending == nil || string(pending.data) != "ls\n" {
+			t.Fatalf("awaitInitMessage() = %v, %v, want the input kept for the shell", pending, ok)
+		}
+		if opts != (PtyOptions{}) {
+			t.Errorf("options = %+v, want none from input", opts)
+		}
+	})
+
+	t.Run("disconnected", func(t *testing.T) {
+		messages := make(chan wsMessage)
+		close(messages)
+
+		if _, ok := awaitInitMessage(messages, &PtyOptions{}); ok {
+			t.Error("awaitInitMessage() = true after the client disconnected")
+		}
+	})
+}
@@ -4,38 +4,59 @@ import (
 	"context"
 	"fmt"
 	"io"
-	"os"
-	"path/filepath"
+	"strings"
 	"sync"
 	"time"
+
+	"github.com/VanCannon/openpam/gateway/internal/recordings"
 )
 
 // Recorder records SSH sessions for audit purposes
 type Recorder struct {
-	recordingsPath string
-	sessions       map[string]*RecordingSession
-	mu             sync.RWMutex
+	storage  recordings.Storage
+	sessions map[string]*RecordingSession
+	mu       sync.RWMutex
+	catalog  *recordings.Catalog // nil leaves recordings uncatalogued
 }
 
 // RecordingSession represents an active recording session
 type RecordingSession struct {
 	SessionID string
-	FilePath  string
-	File      *os.File
+	File      *recordings.File
+	Timing    recordings.Upload // Offset in milliseconds and size of every write, for transcripts
 	StartTime time.Time
+	writer    *timedWriter
+}
+
+// timedWriter writes session output to the recording and notes when each
+// write happened in the timing file. Writes come from the proxy and from
+// monitors joining, so they are serialized to keep both files in step.
+type timedWriter struct {
+	mu     sync.Mutex
+	file   *recordings.File
+	timing recordings.Upload
+	start  time.Time
 }
 
-// NewRecorder creates a new session recorder
-func NewRecorder(recordingsPath string) (*Recorder, error) {
-	// Create recordings directory if it doesn't exist
-	if err := os.MkdirAll(recordingsPath, 0750); err != nil {
-		return nil, fmt.Errorf("failed to create recordings directory: %w", err)
+func (w *timedWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	n, err := w.file.Write(p)
+	if n > 0 && w.timing != nil {
+		fmt.Fprintf(w.timing, "%d %d\n", time.Since(w.start).Milliseconds(), n)
 	}
+	return n, err
+}
 
+// NewRecorder creates a new session recorder writing to storage. Finished
+// recordings are added to catalog unless it is nil.
+func NewRecorder(storage recordings.Storage, catalog *recordings.Catalog) *Recorder {
 	return &Recorder{
-		recordingsPath: recordingsPath,
-		sessions:       make(map[string]*RecordingSession),
-	}, nil
+		storage:  storage,
+		sessions: make(map[string]*RecordingSession),
+		catalog:  catalog,
+	}
 }
 
 // StartRecording starts recording a session
@@ -44,41 +65,50 @@ func (r *Recorder) StartRecording(ctx context.Context, sessionID string) (io.Wri
 	defer r.mu.Unlock()
 
 	// Generate filename with timestamp
-	timestamp := time.Now().Format("20060102-150405")
+	now := time.Now()
+	timestamp := now.Format("20060102-150405")
 	filename := fmt.Sprintf("%s-%s.log", sessionID, timestamp)
-	filePath := filepath.Join(r.recordingsPath, filename)
 
-	// Create recording file
-	file, err := os.Create(filePath)
+	// Recordings outlive the request that started them
+	file, err := recordings.Create(context.Background(), r.storage, filename)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create recording file: %w", err)
 	}
 
+	// The timing file is only needed for transcripts, so recording goes on without it
+	timing, err := r.storage.Create(context.Background(), strings.TrimSuffix(filename, ".log")+".timing")
+	if err != nil {
+		timing = nil
+	}
+
 	// Write session header
 	header := fmt.Sprintf("=== SSH Session Recording ===\n")
 	header += fmt.Sprintf("Session ID: %s\n", sessionID)
-	header += fmt.Sprintf("Start Time: %s\n", time.Now().Format(time.RFC3339))
+	header += fmt.Sprintf("Start Time: %s\n", now.Format(time.RFC3339))
 	header += fmt.Sprintf("=============================\n\n")
 	file.WriteString(header)
 
 	session := &RecordingSession{
 		SessionID: sessionID,
-		FilePath:  filePath,
 		File:      file,
-		StartTime: time.Now(),
+		Timing:    timing,
+		StartTime: now,
+		writer:    &timedWriter{file: file, timing: timing, start: now},
 	}
 
 	r.sessions[sessionID] = session
 
-	return file, nil
+	return session.writer, nil
 }
 
 // StopRecording stops recording a session
 func (r *Recorder) StopRecording(sessionID string) error {
+	// Finish outside the lock; completing an upload waits on the storage
 	r.mu.Lock()
-	defer r.mu.Unlock()
-
 	session, exists := r.sessions[sessionID]
+	delete(r.sessions, sessionID)
+	r.mu.Unlock()
+
 	if !exists {
 		return fmt.Errorf("session not found: %s", sessionID)
 	}
@@ -88,19 +118,27 @@ func (r *Recorder) StopRecording(sessionID string) error {
 	footer += fmt.Sprintf("End Time: %s\n", time.Now().Format(time.RFC3339))
 	footer += fmt.Sprintf("Duration: %s\n", time.Since(session.StartTime).String())
 	footer += fmt.Sprintf("=============================\n")
+	session.writer.mu.Lock()
 	session.File.WriteString(footer)
+	session.writer.mu.Unlock()
+
+	if session.Timing != nil {
+		session.Timing.Close()
+	}
 
 	// Close file
 	if err := session.File.Close(); err != nil {
 		return fmt.Errorf("failed to close recording file: %w", err)
 	}
 
-	delete(r.sessions, sessionID)
+	if r.catalog != nil {
+		r.catalog.Add(session.File)
+	}
 
 	return nil
 }
 
-// GetRecordingPath returns the path to a recording file
+// GetRecordingPath returns where a recording is stored
 func (r *Recorder) GetRecordingPath(sessionID string) (string, error) {
 	r.mu.RLock()
 	defer r.mu.RUnlock()
@@ -110,7 +148,7 @@ func (r *Recorder) GetRecordingPath(sessionID string) (string, error) {
 		return "", fmt.Errorf("session not found: %s", sessionID)
 	}
 
-	return session.FilePath, nil
+	return session.File.Location(), nil
 }
 
 // GetWriter returns the writer for an active recording session
@@ -123,5 +161,5 @@ func (r *Recorder) GetWriter(sessionID string) io.Writer {
 		return nil
 	}
 
-	return session.File
+	return session.writer
 }
@@ -0,0 +1,232 @@
+// Package targetlog attaches lines of targets' own auth and audit logs to the
+// sessions they were logged during, so a session can be reviewed from the
+// target's side as well as from the client's.
+package targetlog
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/VanCannon/openpam/gateway/internal/models"
+	"github.com/VanCannon/openpam/gateway/internal/rdp"
+	"github.com/VanCannon/openpam/pkg/logger"
+	"github.com/google/uuid"
+)
+
+// MaxLines is the most lines one batch may carry
+const MaxLines = 1000
+
+// SessionStore is the subset of the audit log repository the correlator needs
+type SessionStore interface {
+	ListBetween(ctx context.Context, from, to time.Time) ([]*models.AuditLog, error)
+}
+
+// TargetStore is the subset of the target repository the correlator needs
+type TargetStore interface {
+	GetByID(ctx context.Context, id uuid.UUID) (*models.Target, error)
+}
+
+// LogStore stores the matched lines
+type LogStore interface {
+	CreateBatch(ctx context.Context, logs []*models.SessionTargetLog) error
+}
+
+// Line is a line a target logged
+type Line struct {
+	Host    string    `json:"host"`    // The target's name for itself; the forwarder's address when empty
+	Time    time.Time `json:"time"`    // When the target logged it; when it was received when zero
+	Program string    `json:"program"` // Such as "sshd" or "sudo"
+	Message string    `json:"message"`
+}
+
+// Correlator matches target log lines to sessions: by the session ID or RDP
+// client name the gateway injected into the session, or else by the line
+// coming from the session's target while the session was open
+type Correlator struct {
+	sessions SessionStore
+	targets  TargetStore
+	store    LogStore
+	grace    time.Duration
+	lookup   func(ctx context.Context, host string) ([]string, error)
+	logger   *logger.Logger
+}
+
+// NewCorrelator creates a correlator. Lines are matched to sessions by source
+// up to grace before they start and after they end, to allow for clock skew.
+func NewCorrelator(sessions SessionStore, targets TargetStore, store LogStore, grace time.Duration, log *logger.Logger) *Correlator {
+	return &Correlator{
+		sessions: sessions,
+		targets:  targets,
+		store:    store,
+		grace:    grace,
+		lookup:   net.DefaultResolver.LookupHost,
+		logger:   log,
+	}
+}
+
+var (
+	sessionIDPattern  = regexp.MustCompile(`[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}`)
+	clientNamePattern = regexp.MustCompile(`\bOP[0-9A-F]{13}\b`)
+)
+
+// candidate is a session lines may be matched to, with the names and
+// addresses of its target
+type candidate struct {
+	session *models.AuditLog
+	hosts   map[string]bool
+}
+
+// Ingest matches lines forwarded from source, the address they came from, and
+// stores those that matched. It returns how many lines matched a session.
+func (c *Correlator) Ingest(ctx context.Context, source string, lines []Line) (int, error) {
+	if len(lines) == 0 {
+		return 0, nil
+	}
+
+	now := time.Now()
+	from, to := now, now
+	for i := range lines {
+		if lines[i].Time.IsZero() {
+			lines[i].Time = now
+		}
+		if lines[i].Host == "" {
+			lines[i].Host = source
+		}
+		if lines[i].Time.Before(from) {
+			from = lines[i].Time
+		}
+		if lines[i].Time.After(to) {
+			to = lines[i].Time
+		}
+	}
+
+	sessions, err := c.sessions.ListBetween(ctx, from.Add(-c.grace), to.Add(c.grace))
+	if err != nil {
+		return 0, fmt.Errorf("failed to list sessions: %w", err)
+	}
+	candidates := c.candidates(ctx, sessions)
+
+	var matched []*models.SessionTargetLog
+	lineCount := 0
+	for _, line := range lines {
+		sessionIDs, matchedBy := c.match(line, candidates)
+		if len(sessionIDs) == 0 {
+			continue
+		}
+		lineCount++
+
+		var program *string
+		if line.Program != "" {
+			program = &line.Program
+		}
+		for _, id := range sessionIDs {
+			matched = append(matched, &models.SessionTargetLog{
+				AuditLogID: id,
+				Host:       line.Host,
+				Program:    program,
+				Message:    line.Message,
+				LoggedAt:   line.Time,
+				ReceivedAt: now,
+				MatchedBy:  matchedBy,
+			})
+		}
+	}
+
+	if err := c.store.CreateBatch(ctx, matched); err != nil {
+		return 0, err
+	}
+
+	return lineCount, nil
+}
+
+// candidates resolves the targets of sessions. Targets are looked up once
+// however many of the sessions went to them.
+func (c *Correlator) candidates(ctx context.Context, sessions []*models.AuditLog) []candidate {
+	hostsByTarget := make(map[uuid.UUID]map[string]bool)
+	candidates := make([]candidate, 0, len(sessions))
+	for _, session := range sessions {
+		hosts, ok := hostsByTarget[session.TargetID]
+		if !ok {
+			hosts = c.targetHosts(ctx, session.TargetID)
+			hostsByTarget[session.TargetID] = hosts
+		}
+		candidates = append(candidates, candidate{session: session, hosts: hosts})
+	}
+	return candidates
+}
+
+// targetHosts returns the names and addresses a target's lines may come from
+func (c *Correlator) targetHosts(ctx context.Context, targetID uuid.UUID) map[string]bool {
+	hosts := make(map[string]bool)
+
+	target, err := c.targets.GetByID(ctx, targetID)
+	if err != nil {
+		c.logger.Warn("Failed to get target of session", map[string]interface{}{
+			"target_id": targetID.String(),
+			"error":     err.Error(),
+		})
+		return hosts
+	}
+
+	hostname := strings.ToLower(target.Hostname)
+	hosts[hostname] = true
+	// A target's log names it by its short host name
+	if short, _, ok := strings.Cut(hostname, "."); ok && net.ParseIP(hostname) == nil {
+		hosts[short] = true
+	}
+	if net.ParseIP(hostname) == nil {
+		if addrs, err := c.lookup(ctx, hostname); err == nil {
+			for _, addr := range addrs {
+				hosts[addr] = true
+			}
+		}
+	}
+
+	return hosts
+}
+
+// match returns the sessions line belongs to and how it was matched to them
+func (c *Correlator) match(line Line, candidates []candidate) ([]uuid.UUID, string) {
+	// The IDs injected into the session are certain, wherever the line came from
+	for _, s := range sessionIDPattern.FindAllString(line.Message, -1) {
+		id, err := uuid.Parse(s)
+		if err != nil {
+			continue
+		}
+		for _, cand := range candidates {
+			if cand.session.ID == id {
+				return []uuid.UUID{id}, models.TargetLogMatchSessionID
+			}
+		}
+	}
+	for _, name := range clientNamePattern.FindAllString(line.Message, -1) {
+		for _, cand := range candidates {
+			if rdp.ClientName(cand.session.ID) == name {
+				return []uuid.UUID{cand.session.ID}, models.TargetLogMatchClientName
+			}
+		}
+	}
+
+	// Otherwise the line belongs to every session open on its target at the
+	// time. The host the line names wins over the forwarder, which may be a
+	// relay for many targets.
+	host := strings.ToLower(line.Host)
+	var ids []uuid.UUID
+	for _, cand := range candidates {
+		if !cand.hosts[host] {
+			continue
+		}
+		if line.Time.Before(cand.session.StartTime.Add(-c.grace)) {
+			continue
+		}
+		if cand.session.EndTime.Valid && line.Time.After(cand.session.EndTime.Time.Add(c.grace)) {
+			continue
+		}
+		ids = append(ids, cand.session.ID)
+	}
+	return ids, models.TargetLogMatchSource
+}
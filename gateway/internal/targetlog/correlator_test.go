@@ -0,0 +1,99 @@
+package targetlog
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/VanCannon/openpam/gateway/internal/models"
+	"github.com/VanCannon/openpam/gateway/internal/rdp"
+	"github.com/VanCannon/openpam/pkg/logger"
+	"github.com/google/uuid"
+)
+
+type fakeSessions struct{ sessions []*models.AuditLog }
+
+func (f *fakeSessions) ListBetween(ctx context.Context, from, to time.Time) ([]*models.AuditLog, error) {
+	return f.sessions, nil
+}
+
+type fakeTargets struct{ targets map[uuid.UUID]*models.Target }
+
+func (f *fakeTargets) GetByID(ctx context.Context, id uuid.UUID) (*models.Target, error) {
+	if t, ok := f.targets[id]; ok {
+		return t, nil
+	}
+	return nil, errors.New("target not found")
+}
+
+type fakeStore struct{ logs []*models.SessionTargetLog }
+
+func (f *fakeStore) CreateBatch(ctx context.Context, logs []*models.SessionTargetLog) error {
+	f.logs = append(f.logs, logs...)
+	return nil
+}
+
+func TestCorrelator_Ingest(t *testing.T) {
+	now := time.Now()
+	web := &models.Target{ID: uuid.New(), Hostname: "web-01.example.com"}
+	db := &models.Target{ID: uuid.New(), Hostname: "10.0.0.5"}
+
+	alice := &models.AuditLog{ID: uuid.New(), TargetID: web.ID, StartTime: now.Add(-time.Hour)}
+	bob := &models.AuditLog{ID: uuid.New(), TargetID: web.ID, StartTime: now.Add(-2 * time.Hour),
+		EndTime: sql.NullTime{Time: now.Add(-30 * time.Minute), Valid: true}}
+	carol := &models.AuditLog{ID: uuid.New(), TargetID: db.ID, StartTime: now.Add(-time.Hour)}
+
+	store := &fakeStore{}
+	c := NewCorrelator(
+		&fakeSessions{sessions: []*models.AuditLog{alice, bob, carol}},
+		&fakeTargets{targets: map[uuid.UUID]*models.Target{web.ID: web, db.ID: db}},
+		store, time.Minute, logger.New(logger.LevelError, io.Discard))
+	c.lookup = func(ctx context.Context, host string) ([]string, error) {
+		return []string{"10.0.0.8"}, nil
+	}
+
+	matched, err := c.Ingest(context.Background(), "10.0.0.8", []Line{
+		// Names carol's session, though it came from web-01
+		{Host: "web-01", Time: now, Program: "sshd", Message: "Accepted password for root, OPENPAM_SESSION=" + carol.ID.String()},
+		// From web-01 while only alice's session was open on it
+		{Host: "web-01", Time: now, Program: "sudo", Message: "root : COMMAND=/bin/ls"},
+		// From web-01 while both sessions were open on it
+		{Time: now.Add(-45 * time.Minute), Message: "pam_unix(sshd:session): session opened"},
+		// Names alice's RDP client
+		{Host: "dc-01", Time: now, Message: "Logon from workstation " + rdp.ClientName(alice.ID)},
+		// From a host no session is open on
+		{Host: "mail-01", Time: now, Message: "postfix started"},
+	})
+	if err != nil {
+		t.Fatalf("Ingest() error = %v", err)
+	}
+	if matched != 4 {
+		t.Errorf("matched = %d, want 4", matched)
+	}
+
+	want := []struct {
+		session   uuid.UUID
+		matchedBy string
+	}{
+		{carol.ID, models.TargetLogMatchSessionID},
+		{alice.ID, models.TargetLogMatchSource},
+		{alice.ID, models.TargetLogMatchSource},
+		{bob.ID, models.TargetLogMatchSource},
+		{alice.ID, models.TargetLogMatchClientName},
+	}
+	if len(store.logs) != len(want) {
+		t.Fatalf("stored %d lines, want %d", len(store.logs), len(want))
+	}
+	for i, w := range want {
+		if store.logs[i].AuditLogID != w.session || store.logs[i].MatchedBy != w.matchedBy {
+			t.Errorf("line %d matched %s by %s, want %s by %s", i,
+				store.logs[i].AuditLogID, store.logs[i].MatchedBy, w.session, w.matchedBy)
+		}
+	}
+	if store.logs[2].Host != "10.0.0.8" {
+		t.Errorf("Host = %q, want the forwarder's address", store.logs[2].Host)
+	}
+}
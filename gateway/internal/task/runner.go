@@ -0,0 +1,118 @@
+package task
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/VanCannon/openpam/gateway/internal/models"
+	"github.com/VanCannon/openpam/gateway/internal/vault"
+)
+
+// Executor runs a command on a target, writing its combined output to out, and
+// returns the command's exit code
+type Executor interface {
+	Run(ctx context.Context, target *models.Target, creds *vault.Credentials, command string, out io.Writer) (int, error)
+}
+
+// Result is the outcome of a command
+type Result struct {
+	ExitCode  int
+	Output    string
+	Truncated bool
+}
+
+// Runner runs task commands with the executor for the target's protocol
+type Runner struct {
+	executors map[string]Executor
+	maxOutput int
+}
+
+// NewRunner creates a runner that runs commands on SSH targets over SSH and on
+// RDP (Windows) targets over WinRM. At most maxOutput bytes of output are kept.
+func NewRunner(winrm WinRMConfig, maxOutput int) *Runner {
+	if maxOutput <= 0 {
+		maxOutput = 1 << 20
+	}
+
+	return &Runner{
+		executors: map[string]Executor{
+			models.ProtocolSSH: &SSHExecutor{},
+			models.ProtocolRDP: NewWinRMExecutor(winrm),
+		},
+		maxOutput: maxOutput,
+	}
+}
+
+// Quoter returns the quoting for parameter values on targets of the protocol
+func (r *Runner) Quoter(protocol string) Quoter {
+	if protocol == models.ProtocolRDP {
+		return CmdQuote
+	}
+	return ShellQuote
+}
+
+// Run runs the command, giving up after timeout. The output collected so far is
+// returned even if the command fails to complete.
+func (r *Runner) Run(ctx context.Context, target *models.Target, creds *vault.Credentials, command string, timeout time.Duration) (*Result, error) {
+	executor, ok := r.executors[target.Protocol]
+	if !ok {
+		return nil, fmt.Errorf("tasks are not supported for protocol %s", target.Protocol)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	out := &cappedBuffer{limit: r.maxOutput}
+	exitCode, err := executor.Run(ctx, target, creds, command, out)
+
+	result := &Result{
+		ExitCode:  exitCode,
+		Output:    out.String(),
+		Truncated: out.truncated,
+	}
+
+	if err != nil && ctx.Err() == context.DeadlineExceeded {
+		return result, fmt.Errorf("task timed out after %s", timeout)
+	}
+
+	return result, err
+}
+
+// cappedBuffer keeps the first limit bytes written to it and discards the rest,
+// so a chatty command can't exhaust memory. It is safe for concurrent writes from
+// the stdout and stderr streams.
+type cappedBuffer struct {
+	mu        sync.Mutex
+	buf       bytes.Buffer
+	limit     int
+	truncated bool
+}
+
+func (b *cappedBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if room := b.limit - b.buf.Len(); len(p) > room {
+		b.buf.Write(p[:max(room, 0)])
+		b.truncated = true
+	} else {
+		b.buf.Write(p)
+	}
+
+	// Report everything as written so the remote command isn't blocked
+	return len(p), nil
+}
+
+// String returns the output as text that can be stored in PostgreSQL
+func (b *cappedBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	s := strings.ToValidUTF8(b.buf.String(), "�")
+	return strings.ReplaceAll(s, "\x00", "")
+}
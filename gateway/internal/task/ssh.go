@@ -0,0 +1,69 @@
+package task
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+
+	"github.com/VanCannon/openpam/gateway/internal/models"
+	openpamssh "github.com/VanCannon/openpam/gateway/internal/ssh"
+	"github.com/VanCannon/openpam/gateway/internal/vault"
+	"golang.org/x/crypto/ssh"
+)
+
+// SSHExecutor runs commands over an SSH exec channel, without a terminal
+type SSHExecutor struct{}
+
+// Run runs the command through the login shell of the target account
+func (e *SSHExecutor) Run(ctx context.Context, target *models.Target, creds *vault.Credentials, command string, out io.Writer) (int, error) {
+	config, err := openpamssh.ClientConfig(creds)
+	if err != nil {
+		return -1, fmt.Errorf("failed to build SSH config: %w", err)
+	}
+
+	addr := net.JoinHostPort(target.Hostname, strconv.Itoa(target.Port))
+	var dialer net.Dialer
+	netConn, err := dialer.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return -1, fmt.Errorf("failed to connect to SSH server: %w", err)
+	}
+
+	// The handshake has its own timeout but must also stop with the context
+	stop := context.AfterFunc(ctx, func() { netConn.Close() })
+	defer stop()
+
+	sshConn, chans, reqs, err := ssh.NewClientConn(netConn, addr, config)
+	if err != nil {
+		netConn.Close()
+		return -1, fmt.Errorf("failed to connect to SSH server: %w", err)
+	}
+	client := ssh.NewClient(sshConn, chans, reqs)
+	defer client.Close()
+
+	session, err := client.NewSession()
+	if err != nil {
+		return -1, fmt.Errorf("failed to create SSH session: %w", err)
+	}
+	defer session.Close()
+
+	session.Stdout = out
+	session.Stderr = out
+
+	err = session.Run(command)
+	if ctx.Err() != nil {
+		return -1, ctx.Err()
+	}
+
+	var exitErr *ssh.ExitError
+	if errors.As(err, &exitErr) {
+		return exitErr.ExitStatus(), nil
+	}
+	if err != nil {
+		return -1, fmt.Errorf("failed to run command: %w", err)
+	}
+
+	return 0, nil
+}
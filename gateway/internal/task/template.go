@@ -0,0 +1,145 @@
+// Package task runs privileged tasks: pre-approved command templates executed on
+// a target over SSH or WinRM, without giving the user an interactive session.
+package task
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/VanCannon/openpam/gateway/internal/models"
+)
+
+// DefaultPattern is the pattern of parameters that don't declare one
+const DefaultPattern = `[A-Za-z0-9._-]+`
+
+var (
+	placeholderRe   = regexp.MustCompile(`\{\{\s*([A-Za-z_][A-Za-z0-9_]*)\s*\}\}`)
+	parameterNameRe = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+)
+
+// Quoter quotes a parameter value for the target's shell, or rejects it
+type Quoter func(value string) (string, error)
+
+// Validate checks a command template and its parameters: every placeholder must
+// be declared, every parameter used, and patterns and defaults must be valid
+func Validate(template string, params []models.TaskParameter) error {
+	if strings.TrimSpace(template) == "" {
+		return fmt.Errorf("command template is empty")
+	}
+
+	declared := make(map[string]bool)
+	for _, p := range params {
+		if !parameterNameRe.MatchString(p.Name) {
+			return fmt.Errorf("invalid parameter name %q", p.Name)
+		}
+		if declared[p.Name] {
+			return fmt.Errorf("duplicate parameter %q", p.Name)
+		}
+		declared[p.Name] = true
+
+		re, err := compilePattern(p.Pattern)
+		if err != nil {
+			return fmt.Errorf("parameter %q: invalid pattern: %w", p.Name, err)
+		}
+		if p.Default != nil && !re.MatchString(*p.Default) {
+			return fmt.Errorf("parameter %q: default does not match its pattern", p.Name)
+		}
+	}
+
+	used := make(map[string]bool)
+	for _, m := range placeholderRe.FindAllStringSubmatch(template, -1) {
+		if !declared[m[1]] {
+			return fmt.Errorf("placeholder {{%s}} is not a declared parameter", m[1])
+		}
+		used[m[1]] = true
+	}
+
+	for _, p := range params {
+		if !used[p.Name] {
+			return fmt.Errorf("parameter %q is not used in the command template", p.Name)
+		}
+	}
+
+	if strings.Contains(placeholderRe.ReplaceAllString(template, ""), "{{") {
+		return fmt.Errorf("command template has a malformed placeholder")
+	}
+
+	return nil
+}
+
+// Render substitutes the parameter values into the template. Every value must
+// match its parameter's pattern and is quoted for the target's shell, so a value
+// can never change the shape of the command. The values used, including defaults,
+// are returned for the audit record.
+func Render(template string, params []models.TaskParameter, values map[string]string, quote Quoter) (string, models.TaskValues, error) {
+	declared := make(map[string]bool, len(params))
+	for _, p := range params {
+		declared[p.Name] = true
+	}
+	for name := range values {
+		if !declared[name] {
+			return "", nil, fmt.Errorf("unknown parameter %q", name)
+		}
+	}
+
+	used := make(models.TaskValues, len(params))
+	quoted := make(map[string]string, len(params))
+	for _, p := range params {
+		value, ok := values[p.Name]
+		if !ok {
+			if p.Default == nil {
+				return "", nil, fmt.Errorf("missing parameter %q", p.Name)
+			}
+			value = *p.Default
+		}
+
+		re, err := compilePattern(p.Pattern)
+		if err != nil {
+			return "", nil, fmt.Errorf("parameter %q: invalid pattern: %w", p.Name, err)
+		}
+		if !re.MatchString(value) {
+			return "", nil, fmt.Errorf("parameter %q does not match the allowed pattern", p.Name)
+		}
+
+		q, err := quote(value)
+		if err != nil {
+			return "", nil, fmt.Errorf("parameter %q: %w", p.Name, err)
+		}
+
+		used[p.Name] = value
+		quoted[p.Name] = q
+	}
+
+	command := placeholderRe.ReplaceAllStringFunc(template, func(m string) string {
+		return quoted[placeholderRe.FindStringSubmatch(m)[1]]
+	})
+
+	return command, used, nil
+}
+
+// compilePattern compiles a parameter pattern anchored to the whole value
+func compilePattern(pattern string) (*regexp.Regexp, error) {
+	if pattern == "" {
+		pattern = DefaultPattern
+	}
+	return regexp.Compile(`^(?:` + pattern + `)$`)
+}
+
+// ShellQuote quotes a value as a single POSIX shell word
+func ShellQuote(value string) (string, error) {
+	if strings.ContainsRune(value, 0) {
+		return "", fmt.Errorf("value contains a NUL byte")
+	}
+	return "'" + strings.ReplaceAll(value, "'", `'\''`) + "'", nil
+}
+
+// CmdQuote quotes a value as a single cmd.exe argument. cmd.exe has no escape
+// that works inside quotes for every character, so the characters it interprets
+// there are rejected instead.
+func CmdQuote(value string) (string, error) {
+	if i := strings.IndexAny(value, "\"%!^&|<>\r\n\x00"); i >= 0 {
+		return "", fmt.Errorf("value contains a character not allowed on Windows targets: %q", value[i])
+	}
+	return `"` + value + `"`, nil
+}
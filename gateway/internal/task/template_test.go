@@ -0,0 +1,119 @@
+package task
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/VanCannon/openpam/gateway/internal/models"
+)
+
+func TestValidate(t *testing.T) {
+	def := "nginx"
+	bad := "nginx; reboot"
+
+	tests := []struct {
+		name     string
+		template string
+		params   []models.TaskParameter
+		wantErr  string
+	}{
+		{
+			name:     "valid",
+			template: "sudo systemctl restart {{ service }}",
+			params:   []models.TaskParameter{{Name: "service", Default: &def}},
+		},
+		{
+			name:     "undeclared placeholder",
+			template: "systemctl restart {{service}}",
+			wantErr:  "not a declared parameter",
+		},
+		{
+			name:     "unused parameter",
+			template: "uptime",
+			params:   []models.TaskParameter{{Name: "service"}},
+			wantErr:  "not used",
+		},
+		{
+			name:     "default must match pattern",
+			template: "systemctl restart {{service}}",
+			params:   []models.TaskParameter{{Name: "service", Default: &bad}},
+			wantErr:  "default does not match",
+		},
+		{
+			name:     "malformed placeholder",
+			template: "systemctl restart {{service}} {{ other",
+			params:   []models.TaskParameter{{Name: "service"}},
+			wantErr:  "malformed placeholder",
+		},
+		{
+			name:     "invalid pattern",
+			template: "echo {{n}}",
+			params:   []models.TaskParameter{{Name: "n", Pattern: "("}},
+			wantErr:  "invalid pattern",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := Validate(tt.template, tt.params)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("Validate() error = %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Validate() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestRender(t *testing.T) {
+	lines := "100"
+	params := []models.TaskParameter{
+		{Name: "service", Pattern: `[a-z][a-z0-9@.-]*`},
+		{Name: "lines", Pattern: `[0-9]{1,4}`, Default: &lines},
+	}
+	template := "journalctl -u {{service}} -n {{lines}}"
+
+	command, used, err := Render(template, params, map[string]string{"service": "nginx"}, ShellQuote)
+	if err != nil {
+		t.Fatalf("Render() error = %v", err)
+	}
+	if want := "journalctl -u 'nginx' -n '100'"; command != want {
+		t.Errorf("Render() = %q, want %q", command, want)
+	}
+	if used["lines"] != "100" {
+		t.Errorf("default not recorded: %v", used)
+	}
+
+	// Values outside the pattern never reach the command
+	if _, _, err := Render(template, params, map[string]string{"service": "nginx; reboot"}, ShellQuote); err == nil {
+		t.Error("Render() accepted a value outside the pattern")
+	}
+	if _, _, err := Render(template, params, map[string]string{}, ShellQuote); err == nil {
+		t.Error("Render() accepted a missing required parameter")
+	}
+	if _, _, err := Render(template, params, map[string]string{"service": "nginx", "extra": "x"}, ShellQuote); err == nil {
+		t.Error("Render() accepted an unknown parameter")
+	}
+}
+
+func TestQuoting(t *testing.T) {
+	quoted, err := ShellQuote("it's")
+	if err != nil || quoted != `'it'\''s'` {
+		t.Errorf("ShellQuote() = %q, %v", quoted, err)
+	}
+
+	quoted, err = CmdQuote(`C:\Program Files\App`)
+	if err != nil || quoted != `"C:\Program Files\App"` {
+		t.Errorf("CmdQuote() = %q, %v", quoted, err)
+	}
+
+	for _, value := range []string{`a" & calc`, "%PATH%", "a|b", "a\nb"} {
+		if _, err := CmdQuote(value); err == nil {
+			t.Errorf("CmdQuote(%q) accepted a special character", value)
+		}
+	}
+}
@@ -0,0 +1,345 @@
+package task
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/VanCannon/openpam/gateway/internal/models"
+	"github.com/VanCannon/openpam/gateway/internal/vault"
+	"github.com/google/uuid"
+)
+
+// WinRMConfig configures how Windows targets are reached. Targets store their RDP
+// port, so WinRM uses its own port for all targets.
+type WinRMConfig struct {
+	Port               int
+	HTTPS              bool
+	InsecureSkipVerify bool
+}
+
+// WinRMExecutor runs commands in a remote cmd.exe shell over WS-Management with
+// Basic authentication. The target's WinRM listener must allow Basic auth, which
+// should only be used over HTTPS.
+type WinRMExecutor struct {
+	config WinRMConfig
+	client *http.Client
+}
+
+// NewWinRMExecutor creates a WinRM executor
+func NewWinRMExecutor(config WinRMConfig) *WinRMExecutor {
+	if config.Port == 0 {
+		config.Port = 5986
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = &tls.Config{InsecureSkipVerify: config.InsecureSkipVerify}
+
+	return &WinRMExecutor{
+		config: config,
+		client: &http.Client{Transport: transport},
+	}
+}
+
+const (
+	wsmanShellURI  = "http://schemas.microsoft.com/wbem/wsman/1/windows/shell"
+	wsmanCmdURI    = wsmanShellURI + "/cmd"
+	wsmanDoneState = wsmanShellURI + "/CommandState/Done"
+
+	actionCreate  = "http://schemas.xmlsoap.org/ws/2004/09/transfer/Create"
+	actionDelete  = "http://schemas.xmlsoap.org/ws/2004/09/transfer/Delete"
+	actionCommand = wsmanShellURI + "/Command"
+	actionReceive = wsmanShellURI + "/Receive"
+	actionSignal  = wsmanShellURI + "/Signal"
+
+	// wsmanTimedOut is the fault code of a Receive that saw no output before its
+	// operation timeout; the command is still running
+	wsmanTimedOut = "2150858793"
+
+	// receiveTimeout is how long the target holds a Receive open waiting for output
+	receiveTimeout = 20 * time.Second
+)
+
+// Run runs the command and streams its output until it completes
+func (e *WinRMExecutor) Run(ctx context.Context, target *models.Target, creds *vault.Credentials, command string, out io.Writer) (int, error) {
+	if creds.Password == "" {
+		return -1, fmt.Errorf("WinRM requires a password credential")
+	}
+
+	scheme := "http"
+	if e.config.HTTPS {
+		scheme = "https"
+	}
+	session := &winrmSession{
+		executor: e,
+		endpoint: scheme + "://" + net.JoinHostPort(target.Hostname, strconv.Itoa(e.config.Port)) + "/wsman",
+		creds:    creds,
+	}
+
+	resp, err := session.call(ctx, actionCreate, "", winrmOptions(map[string]string{
+		"WINRS_NOPROFILE": "TRUE",
+		"WINRS_CODEPAGE":  "65001",
+	}), `<rsp:Shell><rsp:InputStreams>stdin</rsp:InputStreams><rsp:OutputStreams>stdout stderr</rsp:OutputStreams></rsp:Shell>`)
+	if err != nil {
+		return -1, fmt.Errorf("failed to open WinRM shell: %w", err)
+	}
+	if resp.ShellID == "" {
+		return -1, fmt.Errorf("failed to open WinRM shell: no shell ID in response")
+	}
+	session.shellID = resp.ShellID
+
+	// Clean up even if the context has ended
+	defer func() {
+		cleanupCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		session.call(cleanupCtx, actionDelete, session.shellID, "", "")
+	}()
+
+	resp, err = session.call(ctx, actionCommand, session.shellID, winrmOptions(map[string]string{
+		"WINRS_CONSOLEMODE_STDIN": "TRUE",
+		"WINRS_SKIP_CMD_SHELL":    "FALSE",
+	}), `<rsp:CommandLine><rsp:Command>`+xmlEscape(command)+`</rsp:Command></rsp:CommandLine>`)
+	if err != nil {
+		return -1, fmt.Errorf("failed to start command: %w", err)
+	}
+	if resp.CommandID == "" {
+		return -1, fmt.Errorf("failed to start command: no command ID in response")
+	}
+	commandID := resp.CommandID
+
+	for {
+		resp, err := session.call(ctx, actionReceive, session.shellID, "",
+			`<rsp:Receive><rsp:DesiredStream CommandId="`+xmlEscape(commandID)+`">stdout stderr</rsp:DesiredStream></rsp:Receive>`)
+		if err != nil {
+			if fault, ok := err.(*wsmanFault); ok && fault.Code == wsmanTimedOut {
+				continue
+			}
+			if ctx.Err() != nil {
+				session.terminate(commandID)
+				return -1, ctx.Err()
+			}
+			return -1, fmt.Errorf("failed to receive output: %w", err)
+		}
+
+		for _, chunk := range resp.Output {
+			out.Write(chunk)
+		}
+
+		if resp.Done {
+			return resp.ExitCode, nil
+		}
+	}
+}
+
+// winrmSession is one shell on one target
+type winrmSession struct {
+	executor *WinRMExecutor
+	endpoint string
+	creds    *vault.Credentials
+	shellID  string
+}
+
+// terminate stops a running command, e.g. after a timeout
+func (s *winrmSession) terminate(commandID string) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	s.call(ctx, actionSignal, s.shellID, "",
+		`<rsp:Signal CommandId="`+xmlEscape(commandID)+`"><rsp:Code>`+wsmanShellURI+`/signal/terminate</rsp:Code></rsp:Signal>`)
+}
+
+// call sends one WS-Management request and parses the response
+func (s *winrmSession) call(ctx context.Context, action, shellID, options, body string) (*wsmanResponse, error) {
+	var header strings.Builder
+	header.WriteString(`<wsa:To>` + xmlEscape(s.endpoint) + `</wsa:To>`)
+	header.WriteString(`<wsman:ResourceURI s:mustUnderstand="true">` + wsmanCmdURI + `</wsman:ResourceURI>`)
+	header.WriteString(`<wsa:ReplyTo><wsa:Address s:mustUnderstand="true">http://schemas.xmlsoap.org/ws/2004/08/addressing/role/anonymous</wsa:Address></wsa:ReplyTo>`)
+	header.WriteString(`<wsa:Action s:mustUnderstand="true">` + action + `</wsa:Action>`)
+	header.WriteString(`<wsman:MaxEnvelopeSize s:mustUnderstand="true">153600</wsman:MaxEnvelopeSize>`)
+	header.WriteString(`<wsa:MessageID>uuid:` + uuid.NewString() + `</wsa:MessageID>`)
+	header.WriteString(`<wsman:OperationTimeout>PT` + strconv.Itoa(int(receiveTimeout.Seconds())) + `S</wsman:OperationTimeout>`)
+	if shellID != "" {
+		header.WriteString(`<wsman:SelectorSet><wsman:Selector Name="ShellId">` + xmlEscape(shellID) + `</wsman:Selector></wsman:SelectorSet>`)
+	}
+	header.WriteString(options)
+
+	envelope := `<s:Envelope xmlns:s="http://www.w3.org/2003/05/soap-envelope"` +
+		` xmlns:wsa="http://schemas.xmlsoap.org/ws/2004/08/addressing"` +
+		` xmlns:wsman="http://schemas.dmtf.org/wbem/wsman/1/wsman.xsd"` +
+		` xmlns:rsp="` + wsmanShellURI + `">` +
+		`<s:Header>` + header.String() + `</s:Header><s:Body>` + body + `</s:Body></s:Envelope>`
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.endpoint, strings.NewReader(envelope))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/soap+xml;charset=UTF-8")
+	req.SetBasicAuth(s.creds.Username, s.creds.Password)
+
+	resp, err := s.executor.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, 16<<20))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response: %w", err)
+	}
+
+	if resp.StatusCode == http.StatusUnauthorized {
+		return nil, fmt.Errorf("authentication failed")
+	}
+
+	parsed, err := parseWSManResponse(data)
+	if err != nil {
+		return nil, fmt.Errorf("invalid response (HTTP %d): %w", resp.StatusCode, err)
+	}
+	if parsed.Fault != nil {
+		return nil, parsed.Fault
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected HTTP status %d", resp.StatusCode)
+	}
+
+	return parsed, nil
+}
+
+// wsmanFault is a SOAP fault returned by the target
+type wsmanFault struct {
+	Code    string
+	Message string
+}
+
+func (f *wsmanFault) Error() string {
+	if f.Code != "" {
+		return fmt.Sprintf("WinRM fault %s: %s", f.Code, f.Message)
+	}
+	return "WinRM fault: " + f.Message
+}
+
+// wsmanResponse holds the parts of a response the executor uses
+type wsmanResponse struct {
+	ShellID   string
+	CommandID string
+	Output    [][]byte
+	Done      bool
+	ExitCode  int
+	Fault     *wsmanFault
+}
+
+// parseWSManResponse extracts the fields of interest by element name, which keeps
+// it independent of the namespace prefixes a server chooses
+func parseWSManResponse(data []byte) (*wsmanResponse, error) {
+	resp := &wsmanResponse{}
+	decoder := xml.NewDecoder(bytes.NewReader(data))
+
+	var path []string
+	var text strings.Builder
+
+	for {
+		tok, err := decoder.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		switch t := tok.(type) {
+		case xml.StartElement:
+			path = append(path, t.Name.Local)
+			text.Reset()
+
+			switch t.Name.Local {
+			case "Fault":
+				if resp.Fault == nil {
+					resp.Fault = &wsmanFault{}
+				}
+			case "WSManFault":
+				if resp.Fault == nil {
+					resp.Fault = &wsmanFault{}
+				}
+				resp.Fault.Code = attr(t, "Code")
+			case "CommandState":
+				if attr(t, "State") == wsmanDoneState {
+					resp.Done = true
+				}
+			case "Selector":
+				if attr(t, "Name") == "ShellId" && resp.ShellID == "" {
+					path[len(path)-1] = "ShellId"
+				}
+			}
+		case xml.CharData:
+			text.Write(t)
+		case xml.EndElement:
+			value := strings.TrimSpace(text.String())
+
+			switch path[len(path)-1] {
+			case "ShellId":
+				if resp.ShellID == "" {
+					resp.ShellID = value
+				}
+			case "CommandId":
+				resp.CommandID = value
+			case "Stream":
+				if value != "" {
+					chunk, err := base64.StdEncoding.DecodeString(value)
+					if err != nil {
+						return nil, fmt.Errorf("invalid output stream: %w", err)
+					}
+					resp.Output = append(resp.Output, chunk)
+				}
+			case "ExitCode":
+				code, err := strconv.Atoi(value)
+				if err != nil {
+					return nil, fmt.Errorf("invalid exit code %q", value)
+				}
+				resp.ExitCode = code
+			case "Text", "Message":
+				if resp.Fault != nil && value != "" && resp.Fault.Message == "" {
+					resp.Fault.Message = value
+				}
+			}
+
+			path = path[:len(path)-1]
+			text.Reset()
+		}
+	}
+
+	return resp, nil
+}
+
+func attr(el xml.StartElement, name string) string {
+	for _, a := range el.Attr {
+		if a.Name.Local == name {
+			return a.Value
+		}
+	}
+	return ""
+}
+
+// winrmOptions renders a WS-Management option set
+func winrmOptions(options map[string]string) string {
+	var b strings.Builder
+	b.WriteString(`<wsman:OptionSet>`)
+	for name, value := range options {
+		b.WriteString(`<wsman:Option Name="` + xmlEscape(name) + `">` + xmlEscape(value) + `</wsman:Option>`)
+	}
+	b.WriteString(`</wsman:OptionSet>`)
+	return b.String()
+}
+
+func xmlEscape(s string) string {
+	var b strings.Builder
+	xml.EscapeText(&b, []byte(s))
+	return b.String()
+}
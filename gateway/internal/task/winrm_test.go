@@ -0,0 +1,131 @@
+package task
+
+import (
+	"context"
+	"encoding/base64"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/VanCannon/openpam/gateway/internal/models"
+	"github.com/VanCannon/openpam/gateway/internal/vault"
+)
+
+// fakeWinRM answers the WS-Management calls of one command run
+type fakeWinRM struct {
+	receives int
+	commands []string
+	deleted  bool
+}
+
+func (f *fakeWinRM) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if user, pass, ok := r.BasicAuth(); !ok || user != "admin" || pass != "secret" {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	body, _ := io.ReadAll(r.Body)
+	req := string(body)
+	w.Header().Set("Content-Type", "application/soap+xml;charset=UTF-8")
+
+	envelope := func(content string) {
+		io.WriteString(w, `<s:Envelope xmlns:s="http://www.w3.org/2003/05/soap-envelope" xmlns:rsp="http://schemas.microsoft.com/wbem/wsman/1/windows/shell" xmlns:w="http://schemas.dmtf.org/wbem/wsman/1/wsman.xsd"><s:Body>`+content+`</s:Body></s:Envelope>`)
+	}
+
+	switch {
+	case strings.Contains(req, actionCreate):
+		envelope(`<rsp:Shell><rsp:ShellId>shell-1</rsp:ShellId></rsp:Shell>`)
+	case strings.Contains(req, actionCommand):
+		start := strings.Index(req, "<rsp:Command>") + len("<rsp:Command>")
+		f.commands = append(f.commands, req[start:strings.Index(req, "</rsp:Command>")])
+		envelope(`<rsp:CommandResponse><rsp:CommandId>cmd-1</rsp:CommandId></rsp:CommandResponse>`)
+	case strings.Contains(req, actionReceive):
+		f.receives++
+		switch f.receives {
+		case 1:
+			envelope(`<rsp:ReceiveResponse><rsp:Stream Name="stdout" CommandId="cmd-1">` +
+				base64.StdEncoding.EncodeToString([]byte("SERVICE_NAME: Spooler\r\n")) + `</rsp:Stream></rsp:ReceiveResponse>`)
+		case 2:
+			// No output within the operation timeout
+			w.WriteHeader(http.StatusInternalServerError)
+			envelope(`<s:Fault><s:Reason><s:Text>timed out</s:Text></s:Reason><s:Detail><w:WSManFault Code="2150858793"/></s:Detail></s:Fault>`)
+		default:
+			envelope(`<rsp:ReceiveResponse><rsp:Stream Name="stderr" CommandId="cmd-1">` +
+				base64.StdEncoding.EncodeToString([]byte("warning\r\n")) + `</rsp:Stream>` +
+				`<rsp:CommandState CommandId="cmd-1" State="http://schemas.microsoft.com/wbem/wsman/1/windows/shell/CommandState/Done"><rsp:ExitCode>2</rsp:ExitCode></rsp:CommandState></rsp:ReceiveResponse>`)
+		}
+	case strings.Contains(req, actionDelete):
+		f.deleted = true
+		envelope(``)
+	default:
+		w.WriteHeader(http.StatusBadRequest)
+	}
+}
+
+func TestWinRMExecutor_Run(t *testing.T) {
+	fake := &fakeWinRM{}
+	server := httptest.NewServer(fake)
+	defer server.Close()
+
+	host, port, _ := net.SplitHostPort(strings.TrimPrefix(server.URL, "http://"))
+	portNum, _ := strconv.Atoi(port)
+
+	executor := NewWinRMExecutor(WinRMConfig{Port: portNum})
+	target := &models.Target{Hostname: host, Protocol: models.ProtocolRDP}
+	creds := &vault.Credentials{Username: "admin", Password: "secret"}
+
+	var out strings.Builder
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	exitCode, err := executor.Run(ctx, target, creds, `sc query "Spooler" & echo <done>`, &out)
+	if err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+
+	if exitCode != 2 {
+		t.Errorf("exit code = %d, want 2", exitCode)
+	}
+	if want := "SERVICE_NAME: Spooler\r\nwarning\r\n"; out.String() != want {
+		t.Errorf("output = %q, want %q", out.String(), want)
+	}
+	if len(fake.commands) != 1 || !strings.Contains(fake.commands[0], "&amp; echo &lt;done&gt;") {
+		t.Errorf("command not escaped in envelope: %v", fake.commands)
+	}
+	if !fake.deleted {
+		t.Error("shell was not deleted")
+	}
+}
+
+func TestWinRMExecutor_AuthFailure(t *testing.T) {
+	server := httptest.NewServer(&fakeWinRM{})
+	defer server.Close()
+
+	host, port, _ := net.SplitHostPort(strings.TrimPrefix(server.URL, "http://"))
+	portNum, _ := strconv.Atoi(port)
+
+	executor := NewWinRMExecutor(WinRMConfig{Port: portNum})
+	target := &models.Target{Hostname: host, Protocol: models.ProtocolRDP}
+
+	_, err := executor.Run(context.Background(), target, &vault.Credentials{Username: "admin", Password: "wrong"}, "dir", io.Discard)
+	if err == nil || !strings.Contains(err.Error(), "authentication failed") {
+		t.Errorf("Run() error = %v, want authentication failure", err)
+	}
+}
+
+func TestCappedBuffer(t *testing.T) {
+	buf := &cappedBuffer{limit: 5}
+	buf.Write([]byte("abc"))
+	n, err := buf.Write([]byte("defg"))
+	if n != 4 || err != nil {
+		t.Errorf("Write() = %d, %v; want all bytes reported written", n, err)
+	}
+	if buf.String() != "abcde" || !buf.truncated {
+		t.Errorf("buffer = %q truncated=%v", buf.String(), buf.truncated)
+	}
+}
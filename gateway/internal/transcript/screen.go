@@ -0,0 +1,208 @@
+package transcript
+
+import (
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// screen applies terminal output to a line at a time. It follows carriage
+// returns, backspaces, cursor movement within the line and erasing, which is
+// what shells use to edit the command line, and drops every other control or
+// escape sequence. Full-screen programs come out as their text only.
+type screen struct {
+	lines []Line
+	line  []rune
+	col   int
+	start time.Time // When the current line was first written to
+	last  time.Time // When output was last written
+
+	state   int
+	params  []byte // CSI parameters
+	pending []byte // Partial UTF-8 sequence
+}
+
+// maxColumns bounds cursor movement so a stray sequence can't grow a line without limit
+const maxColumns = 4096
+
+// Escape sequence parser states
+const (
+	stateText = iota
+	stateEscape
+	stateCSI
+	stateString // OSC, DCS and similar, ended by BEL or ST
+	stateStringEscape
+	stateCharset // ESC ( and friends take one more byte
+)
+
+func newScreen() *screen {
+	return &screen{}
+}
+
+// write applies output received at t
+func (s *screen) write(data []byte, t time.Time) {
+	s.last = t
+	if len(s.pending) > 0 {
+		data = append(s.pending, data...)
+		s.pending = nil
+	}
+
+	for i := 0; i < len(data); {
+		b := data[i]
+		switch s.state {
+		case stateEscape:
+			switch b {
+			case '[':
+				s.state = stateCSI
+				s.params = s.params[:0]
+			case ']', 'P', 'X', '^', '_':
+				s.state = stateString
+			case '(', ')', '*', '+', '#', '%':
+				s.state = stateCharset
+			default:
+				s.state = stateText
+			}
+			i++
+			continue
+		case stateCSI:
+			if b >= 0x40 && b <= 0x7e {
+				s.csi(b)
+				s.state = stateText
+			} else {
+				s.params = append(s.params, b)
+			}
+			i++
+			continue
+		case stateString:
+			switch b {
+			case 0x07:
+				s.state = stateText
+			case 0x1b:
+				s.state = stateStringEscape
+			}
+			i++
+			continue
+		case stateStringEscape:
+			s.state = stateText
+			if b != '\\' {
+				s.state = stateString
+			}
+			i++
+			continue
+		case stateCharset:
+			s.state = stateText
+			i++
+			continue
+		}
+
+		switch b {
+		case 0x1b:
+			s.state = stateEscape
+		case '\n':
+			s.flush()
+		case '\r':
+			s.col = 0
+		case '\b':
+			if s.col > 0 {
+				s.col--
+			}
+		case '\t':
+			s.put(' ', t)
+			for s.col%8 != 0 {
+				s.put(' ', t)
+			}
+		default:
+			if b < 0x20 || b == 0x7f {
+				break
+			}
+			if b < utf8.RuneSelf {
+				s.put(rune(b), t)
+				break
+			}
+			if !utf8.FullRune(data[i:]) {
+				s.pending = append(s.pending[:0], data[i:]...)
+				return
+			}
+			r, size := utf8.DecodeRune(data[i:])
+			s.put(r, t)
+			i += size
+			continue
+		}
+		i++
+	}
+}
+
+// put writes a character at the cursor
+func (s *screen) put(r rune, t time.Time) {
+	if len(s.line) == 0 || s.start.IsZero() {
+		s.start = t
+	}
+	if s.col >= maxColumns {
+		return
+	}
+	for len(s.line) < s.col {
+		s.line = append(s.line, ' ')
+	}
+	if s.col < len(s.line) {
+		s.line[s.col] = r
+	} else {
+		s.line = append(s.line, r)
+	}
+	s.col++
+}
+
+// csi applies the control sequences that edit the current line
+func (s *screen) csi(final byte) {
+	n := 1
+	if p := strings.TrimLeft(string(s.params), "?>"); p != "" {
+		if v, err := strconv.Atoi(strings.SplitN(p, ";", 2)[0]); err == nil {
+			n = v
+		}
+	}
+
+	switch final {
+	case 'C': // Cursor forward
+		s.col = min(s.col+max(n, 1), maxColumns)
+	case 'D': // Cursor back
+		s.col = max(s.col-max(n, 1), 0)
+	case 'G': // Cursor to column
+		s.col = min(max(n-1, 0), maxColumns)
+	case 'K': // Erase in line
+		if len(s.params) == 0 || s.params[0] == '0' {
+			if s.col < len(s.line) {
+				s.line = s.line[:s.col]
+			}
+		} else if s.params[0] == '2' {
+			s.line = s.line[:0]
+		}
+	case 'P': // Delete characters
+		if s.col < len(s.line) {
+			end := min(s.col+max(n, 1), len(s.line))
+			s.line = append(s.line[:s.col], s.line[end:]...)
+		}
+	case '@': // Insert blanks
+		if s.col < len(s.line) {
+			blanks := make([]rune, max(n, 1))
+			for i := range blanks {
+				blanks[i] = ' '
+			}
+			s.line = append(s.line[:s.col], append(blanks, s.line[s.col:]...)...)
+		}
+	}
+}
+
+// flush ends the current line
+func (s *screen) flush() {
+	text := strings.TrimRight(string(s.line), " ")
+	if text != "" || len(s.lines) > 0 {
+		at := s.start
+		if at.IsZero() {
+			at = s.last
+		}
+		s.lines = append(s.lines, Line{Time: at, Text: text})
+	}
+	s.line = s.line[:0]
+	s.col = 0
+	s.start = time.Time{}
+}
@@ -0,0 +1,204 @@
+// Package transcript turns SSH session recordings into plain-text transcripts:
+// terminal control sequences are applied and stripped, shell prompts are
+// normalized and every line carries the time it was written.
+package transcript
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Recording file layout written by ssh.Recorder
+const (
+	headerEnd   = "=============================\n\n"
+	footerStart = "\n=============================\nEnd Time: "
+	startPrefix = "Start Time: "
+)
+
+// TimingSuffix names the file next to an SSH recording that holds, for every
+// write, the milliseconds since the session started and the bytes written
+const TimingSuffix = ".timing"
+
+// Line is one line of a transcript
+type Line struct {
+	Time    time.Time `json:"time"`
+	Text    string    `json:"text"`
+	Prompt  string    `json:"prompt,omitempty"`  // Shell prompt, when the line is a command
+	Command string    `json:"command,omitempty"` // Command typed at the prompt
+}
+
+// Transcript is a cleaned SSH session
+type Transcript struct {
+	SessionID string     `json:"session_id"`
+	StartTime time.Time  `json:"start_time"`
+	EndTime   *time.Time `json:"end_time,omitempty"`
+	Timed     bool       `json:"timed"` // False when the recording has no timing file and lines carry the start time
+	Lines     []Line     `json:"lines"`
+}
+
+// Find returns the names of a session's SSH recording and timing file in
+// recordings. timing is "" for recordings made without one.
+func Find(recordings fs.FS, sessionID string) (recording, timing string, err error) {
+	entries, err := fs.ReadDir(recordings, ".")
+	if err != nil {
+		return "", "", fmt.Errorf("failed to read recordings: %w", err)
+	}
+
+	prefix := sessionID + "-"
+	for _, e := range entries {
+		if !e.IsDir() && strings.HasPrefix(e.Name(), prefix) && strings.HasSuffix(e.Name(), ".log") {
+			recording = e.Name()
+			break
+		}
+	}
+	if recording == "" {
+		return "", "", fs.ErrNotExist
+	}
+
+	timing = strings.TrimSuffix(recording, ".log") + TimingSuffix
+	if _, err := fs.Stat(recordings, timing); err != nil {
+		timing = ""
+	}
+	return recording, timing, nil
+}
+
+// Load renders the transcript of a session's SSH recording in recordings
+func Load(recordings fs.FS, sessionID string) (*Transcript, error) {
+	recording, timing, err := Find(recordings, sessionID)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := fs.ReadFile(recordings, recording)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read recording: %w", err)
+	}
+
+	var timingData []byte
+	if timing != "" {
+		if timingData, err = fs.ReadFile(recordings, timing); err != nil {
+			return nil, fmt.Errorf("failed to read timing: %w", err)
+		}
+	}
+
+	t, err := Render(data, timingData)
+	if err != nil {
+		return nil, err
+	}
+	t.SessionID = sessionID
+	return t, nil
+}
+
+// Render builds a transcript from an SSH recording and its timing data, which
+// may be nil
+func Render(recording, timing []byte) (*Transcript, error) {
+	t := &Transcript{}
+
+	// Header: the start time, then the session output up to the footer
+	i := bytes.Index(recording, []byte(headerEnd))
+	if i < 0 {
+		return nil, fmt.Errorf("not an SSH recording")
+	}
+	for _, line := range strings.Split(string(recording[:i]), "\n") {
+		if v, ok := strings.CutPrefix(line, startPrefix); ok {
+			t.StartTime, _ = time.Parse(time.RFC3339, v)
+		}
+	}
+	body := recording[i+len(headerEnd):]
+
+	if j := bytes.LastIndex(body, []byte(footerStart)); j >= 0 {
+		footer := string(body[j+len(footerStart):])
+		if end, _, ok := strings.Cut(footer, "\n"); ok {
+			if at, err := time.Parse(time.RFC3339, end); err == nil {
+				t.EndTime = &at
+			}
+		}
+		body = body[:j]
+	}
+
+	s := newScreen()
+	if len(timing) == 0 {
+		s.write(body, t.StartTime)
+	} else {
+		t.Timed = true
+		scanner := bufio.NewScanner(bytes.NewReader(timing))
+		for scanner.Scan() {
+			offset, size, ok := strings.Cut(scanner.Text(), " ")
+			ms, err1 := strconv.ParseInt(offset, 10, 64)
+			n, err2 := strconv.Atoi(size)
+			if !ok || err1 != nil || err2 != nil || n < 0 {
+				return nil, fmt.Errorf("malformed timing entry %q", scanner.Text())
+			}
+			n = min(n, len(body))
+			s.write(body[:n], t.StartTime.Add(time.Duration(ms)*time.Millisecond))
+			body = body[n:]
+		}
+		if err := scanner.Err(); err != nil {
+			return nil, fmt.Errorf("failed to read timing: %w", err)
+		}
+		// Output the timing file missed, e.g. after a crash
+		if len(body) > 0 {
+			s.write(body, s.last)
+		}
+	}
+	if len(s.line) > 0 {
+		s.flush()
+	}
+
+	for _, l := range s.lines {
+		t.Lines = append(t.Lines, normalize(l))
+	}
+	return t, nil
+}
+
+// WriteText writes the transcript with an RFC 3339 timestamp before each line
+func (t *Transcript) WriteText(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	fmt.Fprintf(bw, "# SSH session %s\n", t.SessionID)
+	fmt.Fprintf(bw, "# Started %s\n", t.StartTime.UTC().Format(time.RFC3339))
+	if t.EndTime != nil {
+		fmt.Fprintf(bw, "# Ended %s\n", t.EndTime.UTC().Format(time.RFC3339))
+	}
+	if !t.Timed {
+		fmt.Fprintf(bw, "# Recorded without timing; lines show the session start time\n")
+	}
+	bw.WriteString("\n")
+	for _, l := range t.Lines {
+		fmt.Fprintf(bw, "[%s] %s\n", l.Time.UTC().Format(time.RFC3339), l.Text)
+	}
+	return bw.Flush()
+}
+
+// WriteJSON writes the transcript as JSON
+func (t *Transcript) WriteJSON(w io.Writer) error {
+	return json.NewEncoder(w).Encode(t)
+}
+
+// promptPattern matches common shell prompts: user@host:dir$, [user@host dir]#,
+// an optional (venv) prefix, a bare $ and PowerShell's PS C:\>. A bare # is
+// left alone; it is far more often a comment in a file being displayed.
+var promptPattern = regexp.MustCompile(`^((?:\([^)]*\)\s*)?(?:\[[^\]]*\]\s?[$#%>]|[\w.-]+@[\w.-]+(?::\S*)?\s?[$#%>]|\$|PS [^>]*>))(?:\s+(.*))?$`)
+
+// normalize detects a shell prompt and rewrites the line as the prompt, one
+// space and the command
+func normalize(l Line) Line {
+	m := promptPattern.FindStringSubmatch(l.Text)
+	if m == nil {
+		return l
+	}
+	l.Prompt = m[1]
+	l.Command = strings.TrimSpace(m[2])
+	l.Text = l.Prompt
+	if l.Command != "" {
+		l.Text += " " + l.Command
+	}
+	return l
+}
@@ -0,0 +1,158 @@
+package transcript
+
+import (
+	"bytes"
+	"errors"
+	"io/fs"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+const testStart = "2026-03-02T09:14:05Z"
+
+func recording(body string) []byte {
+	return []byte("=== SSH Session Recording ===\n" +
+		"Session ID: 7c9e6679-7425-40de-944b-e07fc1f90ae7\n" +
+		"Start Time: " + testStart + "\n" +
+		"=============================\n\n" +
+		body +
+		"\n=============================\nEnd Time: 2026-03-02T09:20:41Z\n")
+}
+
+func texts(t *Transcript) []string {
+	var out []string
+	for _, l := range t.Lines {
+		out = append(out, l.Text)
+	}
+	return out
+}
+
+func TestRender_StripsEscapesAndAppliesEditing(t *testing.T) {
+	body := "\x1b]0;admin@web-01: ~\x07\x1b[01;32madmin@web-01\x1b[00m:~$ lss\b \b -la\r\n" +
+		"total 0\r\n" +
+		"\x1b[?2004hadmin@web-01:~$ cat x\x1b[K\r\n" +
+		"progress 10%\rprogress 100%\r\n"
+
+	tr, err := Render(recording(body), nil)
+	if err != nil {
+		t.Fatalf("Render: %v", err)
+	}
+
+	want := []string{
+		"admin@web-01:~$ ls -la",
+		"total 0",
+		"admin@web-01:~$ cat x",
+		"progress 100%",
+	}
+	got := texts(tr)
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Fatalf("lines = %q, want %q", got, want)
+	}
+
+	if tr.Lines[0].Prompt != "admin@web-01:~$" || tr.Lines[0].Command != "ls -la" {
+		t.Errorf("prompt/command = %q/%q", tr.Lines[0].Prompt, tr.Lines[0].Command)
+	}
+	if tr.Lines[1].Prompt != "" {
+		t.Errorf("output line detected as prompt: %q", tr.Lines[1].Prompt)
+	}
+	if tr.Timed {
+		t.Error("Timed = true without timing data")
+	}
+	if tr.EndTime == nil || tr.EndTime.Format(time.RFC3339) != "2026-03-02T09:20:41Z" {
+		t.Errorf("EndTime = %v", tr.EndTime)
+	}
+}
+
+func TestRender_NormalizesPrompts(t *testing.T) {
+	tests := []struct {
+		line, prompt, command string
+	}{
+		{"[root@db-01 ~]#   systemctl status", "[root@db-01 ~]#", "systemctl status"},
+		{"(venv) dev@box:/srv$ make", "(venv) dev@box:/srv$", "make"},
+		{"$ echo hi", "$", "echo hi"},
+		{`PS C:\Users\admin> Get-Process`, `PS C:\Users\admin>`, "Get-Process"},
+		{"# this is a comment", "", ""},
+	}
+
+	for _, tt := range tests {
+		l := normalize(Line{Text: tt.line})
+		if l.Prompt != tt.prompt || l.Command != tt.command {
+			t.Errorf("normalize(%q) = %q/%q, want %q/%q", tt.line, l.Prompt, l.Command, tt.prompt, tt.command)
+		}
+	}
+}
+
+func TestRender_TimesEachLine(t *testing.T) {
+	body := "$ uptime\r\n" + "up 3 days\r\n" + "$ exit\r\n"
+	timing := "0 10\n" + "1500 11\n" + "4000 8\n"
+
+	tr, err := Render(recording(body), []byte(timing))
+	if err != nil {
+		t.Fatalf("Render: %v", err)
+	}
+	if !tr.Timed {
+		t.Error("Timed = false with timing data")
+	}
+
+	start, _ := time.Parse(time.RFC3339, testStart)
+	want := []time.Duration{0, 1500 * time.Millisecond, 4 * time.Second}
+	if len(tr.Lines) != len(want) {
+		t.Fatalf("lines = %q", texts(tr))
+	}
+	for i, d := range want {
+		if got := tr.Lines[i].Time.Sub(start); got != d {
+			t.Errorf("line %d at +%v, want +%v", i, got, d)
+		}
+	}
+}
+
+func TestRender_SplitMultibyteWrite(t *testing.T) {
+	body := "caf\xc3\xa9\r\n"
+	tr, err := Render(recording(body), []byte("0 4\n10 3\n"))
+	if err != nil {
+		t.Fatalf("Render: %v", err)
+	}
+	if got := texts(tr); len(got) != 1 || got[0] != "café" {
+		t.Errorf("lines = %q", got)
+	}
+}
+
+func TestRender_RejectsOtherFiles(t *testing.T) {
+	if _, err := Render([]byte("not a recording"), nil); err == nil {
+		t.Error("Render accepted a file without a header")
+	}
+	if _, err := Render(recording("$ ls\r\n"), []byte("garbage\n")); err == nil {
+		t.Error("Render accepted malformed timing")
+	}
+}
+
+func TestLoad(t *testing.T) {
+	const id = "7c9e6679-7425-40de-944b-e07fc1f90ae7"
+	fsys := fstest.MapFS{
+		id + "-20260302-091405.log":    {Data: recording("$ ls\r\n")},
+		id + "-20260302-091405.timing": {Data: []byte("250 6\n")},
+		"other-20260302-091405.guac":   {Data: []byte("4.size;")},
+	}
+
+	tr, err := Load(fsys, id)
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if tr.SessionID != id || !tr.Timed || len(tr.Lines) != 1 {
+		t.Fatalf("transcript = %+v", tr)
+	}
+
+	var buf bytes.Buffer
+	if err := tr.WriteText(&buf); err != nil {
+		t.Fatalf("WriteText: %v", err)
+	}
+	if !strings.Contains(buf.String(), "[2026-03-02T09:14:05Z] $ ls\n") {
+		t.Errorf("text = %q", buf.String())
+	}
+
+	if _, err := Load(fsys, "other"); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("Load of a session without an SSH recording: err = %v, want fs.ErrNotExist", err)
+	}
+}
@@ -0,0 +1,241 @@
+package tunnel
+
+import (
+	"context"
+	"crypto/ed25519"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/VanCannon/openpam/gateway/internal/models"
+	"github.com/google/uuid"
+)
+
+// PolicyBundle is the snapshot of policy a satellite needs to authorize
+// sessions in its zone while the hub is unreachable
+type PolicyBundle struct {
+	ZoneID      uuid.UUID                `json:"zone_id"`
+	Zone        *models.Zone             `json:"zone,omitempty"`
+	IssuedAt    time.Time                `json:"issued_at"`
+	ExpiresAt   time.Time                `json:"expires_at"`
+	Targets     []*models.Target         `json:"targets"`
+	Credentials []*models.Credential     `json:"credentials"`
+	Rules       []*models.CredentialRule `json:"rules"`
+	Schedules   []models.Schedule        `json:"schedules"`
+	Groups      GroupMembers             `json:"groups,omitempty"` // Members of the groups the rules name
+}
+
+// GroupMembers maps groups to the IDs of their members
+type GroupMembers map[uuid.UUID][]uuid.UUID
+
+// Expired reports whether the bundle may no longer be used to authorize sessions
+func (b *PolicyBundle) Expired(now time.Time) bool {
+	return !now.Before(b.ExpiresAt)
+}
+
+// ParseSigningKey decodes a base64 Ed25519 seed, as used by the hub to sign bundles
+func ParseSigningKey(encoded string) (ed25519.PrivateKey, error) {
+	seed, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, fmt.Errorf("invalid signing key encoding: %w", err)
+	}
+	if len(seed) != ed25519.SeedSize {
+		return nil, fmt.Errorf("signing key must be %d bytes, got %d", ed25519.SeedSize, len(seed))
+	}
+	return ed25519.NewKeyFromSeed(seed), nil
+}
+
+// ParseVerifyKey decodes a base64 Ed25519 public key, as used by satellites to
+// verify bundles
+func ParseVerifyKey(encoded string) (ed25519.PublicKey, error) {
+	key, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, fmt.Errorf("invalid verify key encoding: %w", err)
+	}
+	if len(key) != ed25519.PublicKeySize {
+		return nil, fmt.Errorf("verify key must be %d bytes, got %d", ed25519.PublicKeySize, len(key))
+	}
+	return ed25519.PublicKey(key), nil
+}
+
+// SignBundle encodes and signs a bundle
+func SignBundle(bundle *PolicyBundle, key ed25519.PrivateKey) (*PolicyBundlePayload, error) {
+	data, sig, err := sign(bundle, key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode policy bundle: %w", err)
+	}
+	return &PolicyBundlePayload{
+		Bundle:    data,
+		Signature: sig,
+	}, nil
+}
+
+// VerifyBundle checks a bundle's signature and decodes it
+func VerifyBundle(payload *PolicyBundlePayload, key ed25519.PublicKey) (*PolicyBundle, error) {
+	var bundle PolicyBundle
+	if err := verify(payload.Bundle, payload.Signature, key, &bundle); err != nil {
+		return nil, fmt.Errorf("policy bundle %w", err)
+	}
+	return &bundle, nil
+}
+
+// sign encodes v and signs the encoding
+func sign(v interface{}, key ed25519.PrivateKey) (json.RawMessage, []byte, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, nil, err
+	}
+	return data, ed25519.Sign(key, data), nil
+}
+
+// verify checks the signature over data and decodes it into v
+func verify(data json.RawMessage, sig []byte, key ed25519.PublicKey, v interface{}) error {
+	if !ed25519.Verify(key, data, sig) {
+		return fmt.Errorf("signature is invalid")
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		return fmt.Errorf("could not be decoded: %w", err)
+	}
+	return nil
+}
+
+// ZoneGetter gets a zone
+type ZoneGetter interface {
+	GetByID(ctx context.Context, id uuid.UUID) (*models.Zone, error)
+}
+
+// TargetLister lists the targets in a zone
+type TargetLister interface {
+	ListByZone(ctx context.Context, zoneID uuid.UUID) ([]*models.Target, error)
+}
+
+// CredentialLister lists a target's credentials
+type CredentialLister interface {
+	GetByTargetID(ctx context.Context, targetID uuid.UUID) ([]*models.Credential, error)
+}
+
+// RuleLister lists the enabled credential rules that apply to a target
+type RuleLister interface {
+	ListEnabledForTarget(ctx context.Context, targetID uuid.UUID) ([]*models.CredentialRule, error)
+}
+
+// ScheduleLister lists schedules
+type ScheduleLister interface {
+	List(ctx context.Context, userID *uuid.UUID, targetID *uuid.UUID, status *models.ScheduleStatus, approvalStatus *string) ([]models.Schedule, error)
+}
+
+// MemberLister lists the members of a group
+type MemberLister interface {
+	ListMemberIDs(ctx context.Context, groupID uuid.UUID) ([]uuid.UUID, error)
+}
+
+// BundleBuilder builds policy bundles from the hub's database
+type BundleBuilder struct {
+	zones       ZoneGetter
+	targets     TargetLister
+	credentials CredentialLister
+	rules       RuleLister
+	schedules   ScheduleLister
+	members     MemberLister
+	validity    time.Duration
+}
+
+// NewBundleBuilder creates a builder whose bundles are valid for validity after
+// they are issued
+func NewBundleBuilder(zones ZoneGetter, targets TargetLister, credentials CredentialLister, rules RuleLister, schedules ScheduleLister, members MemberLister, validity time.Duration) *BundleBuilder {
+	return &BundleBuilder{
+		zones:       zones,
+		targets:     targets,
+		credentials: credentials,
+		rules:       rules,
+		schedules:   schedules,
+		members:     members,
+		validity:    validity,
+	}
+}
+
+// Build collects the zone and its settings, the zone's enabled targets with
+// their credentials, the rules that apply to them with the members of the
+// groups they name, and the approved schedules that haven't ended yet
+func (b *BundleBuilder) Build(ctx context.Context, zoneID uuid.UUID, now time.Time) (*PolicyBundle, error) {
+	zone, err := b.zones.GetByID(ctx, zoneID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get zone: %w", err)
+	}
+
+	targets, err := b.targets.ListByZone(ctx, zoneID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list zone targets: %w", err)
+	}
+
+	bundle := &PolicyBundle{
+		ZoneID:      zoneID,
+		Zone:        zone,
+		IssuedAt:    now,
+		ExpiresAt:   now.Add(b.validity),
+		Targets:     []*models.Target{},
+		Credentials: []*models.Credential{},
+		Rules:       []*models.CredentialRule{},
+		Schedules:   []models.Schedule{},
+		Groups:      GroupMembers{},
+	}
+
+	approved := models.ApprovalStatusApproved
+	seenRules := make(map[uuid.UUID]bool)
+	for _, target := range targets {
+		if !target.Enabled || target.Expired(now) {
+			continue
+		}
+		bundle.Targets = append(bundle.Targets, target)
+
+		creds, err := b.credentials.GetByTargetID(ctx, target.ID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list credentials for target %s: %w", target.ID, err)
+		}
+		for _, cred := range creds {
+			// Raw passwords stay on the hub
+			if strings.HasPrefix(cred.VaultSecretPath, "raw:") {
+				cred.VaultSecretPath = "raw:"
+			}
+			bundle.Credentials = append(bundle.Credentials, cred)
+		}
+
+		rules, err := b.rules.ListEnabledForTarget(ctx, target.ID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list rules for target %s: %w", target.ID, err)
+		}
+		for _, rule := range rules {
+			if seenRules[rule.ID] {
+				continue
+			}
+			seenRules[rule.ID] = true
+			bundle.Rules = append(bundle.Rules, rule)
+
+			if rule.GroupID == nil {
+				continue
+			}
+			if _, ok := bundle.Groups[*rule.GroupID]; ok {
+				continue
+			}
+			members, err := b.members.ListMemberIDs(ctx, *rule.GroupID)
+			if err != nil {
+				return nil, fmt.Errorf("failed to list members of group %s: %w", *rule.GroupID, err)
+			}
+			bundle.Groups[*rule.GroupID] = members
+		}
+
+		schedules, err := b.schedules.List(ctx, nil, &target.ID, nil, &approved)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list schedules for target %s: %w", target.ID, err)
+		}
+		for _, schedule := range schedules {
+			if !schedule.Ended(now) && (schedule.Status == models.ScheduleStatusPending || schedule.Status == models.ScheduleStatusActive) {
+				bundle.Schedules = append(bundle.Schedules, schedule)
+			}
+		}
+	}
+
+	return bundle, nil
+}
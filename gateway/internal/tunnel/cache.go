@@ -0,0 +1,307 @@
+package tunnel
+
+import (
+	"context"
+	"crypto/ed25519"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/VanCannon/openpam/gateway/internal/models"
+	"github.com/VanCannon/openpam/gateway/internal/policy"
+	"github.com/VanCannon/openpam/gateway/internal/settings"
+	"github.com/VanCannon/openpam/pkg/logger"
+	"github.com/VanCannon/openpam/pkg/servicetoken"
+	"github.com/google/uuid"
+)
+
+// OfflinePolicy decides what a satellite may authorize while the hub is unreachable
+type OfflinePolicy string
+
+const (
+	// OfflineDeny refuses every session
+	OfflineDeny OfflinePolicy = "deny"
+
+	// OfflineCached authorizes sessions with the cached credential rules
+	OfflineCached OfflinePolicy = "cached"
+
+	// OfflineScheduled authorizes sessions with the cached credential rules, and
+	// only inside a cached approved schedule window
+	OfflineScheduled OfflinePolicy = "scheduled"
+)
+
+var (
+	// ErrOfflineDenied is returned when the offline policy refuses all sessions
+	ErrOfflineDenied = errors.New("hub unreachable and offline access is disabled")
+
+	// ErrNoBundle is returned when no unexpired policy bundle is cached
+	ErrNoBundle = errors.New("hub unreachable and no valid policy bundle is cached")
+
+	// ErrTargetNotCached is returned for targets that aren't in the cached bundle
+	ErrTargetNotCached = errors.New("target not available offline")
+
+	// ErrOutsideSchedule is returned when the offline policy requires a schedule
+	// window and the subject has none
+	ErrOutsideSchedule = errors.New("no approved schedule window for this target")
+)
+
+// ValidOfflinePolicy reports whether p is a known offline policy
+func ValidOfflinePolicy(p OfflinePolicy) bool {
+	switch p {
+	case OfflineDeny, OfflineCached, OfflineScheduled:
+		return true
+	}
+	return false
+}
+
+// PolicyCache holds the latest policy bundle pushed to a satellite. The signed
+// bundle is also written to disk so it survives a restart during an outage.
+type PolicyCache struct {
+	path     string
+	zoneID   uuid.UUID
+	key      ed25519.PublicKey
+	offline  OfflinePolicy
+	engine   *policy.Engine
+	settings *settings.Resolver
+	keySet   *servicetoken.KeySet // Hub keys pushed bundles must also be signed by; nil skips the check
+	logger   *logger.Logger
+
+	mu     sync.RWMutex
+	bundle *PolicyBundle
+}
+
+// NewPolicyCache creates a cache for zoneID's bundles, verified with key and
+// persisted at path
+func NewPolicyCache(path string, zoneID uuid.UUID, key ed25519.PublicKey, offline OfflinePolicy, log *logger.Logger) *PolicyCache {
+	c := &PolicyCache{
+		path:    path,
+		zoneID:  zoneID,
+		key:     key,
+		offline: offline,
+		logger:  log,
+	}
+	c.engine = policy.NewEngine(c, log)
+	c.engine.ResolveGroups(c)
+	c.settings = settings.NewResolver(c, c.engine)
+	return c
+}
+
+// RequireJWS makes pushed bundles valid only with a detached JWS by one of the
+// hub's published keys, besides the Ed25519 signature
+func (c *PolicyCache) RequireJWS(keySet *servicetoken.KeySet) {
+	c.keySet = keySet
+}
+
+// Load reads the persisted bundle, if there is one
+func (c *PolicyCache) Load() error {
+	data, err := os.ReadFile(c.path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return fmt.Errorf("failed to read policy cache: %w", err)
+	}
+
+	var payload PolicyBundlePayload
+	if err := json.Unmarshal(data, &payload); err != nil {
+		return fmt.Errorf("failed to decode policy cache: %w", err)
+	}
+
+	bundle, err := c.verify(&payload)
+	if err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	c.bundle = bundle
+	c.mu.Unlock()
+	return nil
+}
+
+// Store verifies a bundle pushed by the hub, makes it current and persists it.
+// Bundles older than the current one are ignored.
+func (c *PolicyCache) Store(payload *PolicyBundlePayload) error {
+	// The persisted bundle was checked when it arrived, so a restart during
+	// an outage does not need the hub's keys
+	if c.keySet != nil {
+		if err := c.keySet.VerifyDetached(payload.JWS, payload.Bundle); err != nil {
+			return fmt.Errorf("policy bundle JWS: %w", err)
+		}
+	}
+	bundle, err := c.verify(payload)
+	if err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.bundle != nil && bundle.IssuedAt.Before(c.bundle.IssuedAt) {
+		return nil
+	}
+
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("failed to encode policy cache: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(c.path), 0700); err != nil {
+		return fmt.Errorf("failed to create policy cache directory: %w", err)
+	}
+	tmp := c.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return fmt.Errorf("failed to write policy cache: %w", err)
+	}
+	if err := os.Rename(tmp, c.path); err != nil {
+		return fmt.Errorf("failed to write policy cache: %w", err)
+	}
+
+	c.bundle = bundle
+	return nil
+}
+
+func (c *PolicyCache) verify(payload *PolicyBundlePayload) (*PolicyBundle, error) {
+	bundle, err := VerifyBundle(payload, c.key)
+	if err != nil {
+		return nil, err
+	}
+	if bundle.ZoneID != c.zoneID {
+		return nil, fmt.Errorf("policy bundle is for zone %s, not %s", bundle.ZoneID, c.zoneID)
+	}
+	return bundle, nil
+}
+
+// Bundle returns the current bundle, or nil if none has been received
+func (c *PolicyCache) Bundle() *PolicyBundle {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.bundle
+}
+
+// ListEnabledForTarget returns the cached rules that apply to a target, so the
+// cache can back a policy engine
+func (c *PolicyCache) ListEnabledForTarget(ctx context.Context, targetID uuid.UUID) ([]*models.CredentialRule, error) {
+	bundle := c.Bundle()
+	if bundle == nil {
+		return nil, ErrNoBundle
+	}
+
+	rules := []*models.CredentialRule{}
+	for _, rule := range bundle.Rules {
+		if rule.Enabled && (rule.TargetID == nil || *rule.TargetID == targetID) {
+			rules = append(rules, rule)
+		}
+	}
+	return rules, nil
+}
+
+// ListGroupIDsByUser returns the cached groups the user is a member of, so the
+// cache can resolve the groups rules name. Bundles from hubs that don't send
+// group members leave every user in none.
+func (c *PolicyCache) ListGroupIDsByUser(ctx context.Context, userID uuid.UUID) ([]uuid.UUID, error) {
+	bundle := c.Bundle()
+	if bundle == nil {
+		return nil, ErrNoBundle
+	}
+
+	groups := []uuid.UUID{}
+	for groupID, members := range bundle.Groups {
+		if slices.Contains(members, userID) {
+			groups = append(groups, groupID)
+		}
+	}
+	return groups, nil
+}
+
+// GetByID returns the cached zone, so the cache can back a settings resolver.
+// Bundles from hubs that don't send the zone give it no settings.
+func (c *PolicyCache) GetByID(ctx context.Context, id uuid.UUID) (*models.Zone, error) {
+	bundle := c.Bundle()
+	if bundle == nil {
+		return nil, ErrNoBundle
+	}
+	if bundle.Zone == nil || bundle.Zone.ID != id {
+		return &models.Zone{ID: id}, nil
+	}
+	return bundle.Zone, nil
+}
+
+// Settings resolves a session's settings from the cached zone, target and rules
+func (c *PolicyCache) Settings(ctx context.Context, subject policy.Subject, target *models.Target, cred *models.Credential) (*settings.Effective, error) {
+	return c.settings.Resolve(ctx, subject, target, cred)
+}
+
+// DialTimeout returns how long the satellite waits for a target to accept a
+// connection, from the cached zone settings or def
+func (c *PolicyCache) DialTimeout(def time.Duration) time.Duration {
+	bundle := c.Bundle()
+	if bundle == nil || bundle.Zone == nil || bundle.Zone.Settings.TunnelDialTimeout == nil {
+		return def
+	}
+	return time.Duration(*bundle.Zone.Settings.TunnelDialTimeout) * time.Second
+}
+
+// Authorize decides, from the cached bundle and the offline policy, whether the
+// subject may open a session on the target and with which credential
+func (c *PolicyCache) Authorize(ctx context.Context, subject policy.Subject, targetID uuid.UUID, requested *uuid.UUID, now time.Time) (*models.Target, *models.Credential, error) {
+	if c.offline == OfflineDeny {
+		return nil, nil, ErrOfflineDenied
+	}
+
+	bundle := c.Bundle()
+	if bundle == nil || bundle.Expired(now) {
+		return nil, nil, ErrNoBundle
+	}
+
+	var target *models.Target
+	for _, t := range bundle.Targets {
+		if t.ID == targetID {
+			target = t
+			break
+		}
+	}
+	if target == nil || target.Expired(now) {
+		return nil, nil, ErrTargetNotCached
+	}
+
+	if c.offline == OfflineScheduled && !inSchedule(bundle.Schedules, subject.UserID, targetID, now) {
+		return nil, nil, ErrOutsideSchedule
+	}
+
+	var creds []*models.Credential
+	for _, cred := range bundle.Credentials {
+		if cred.TargetID == targetID {
+			creds = append(creds, cred)
+		}
+	}
+
+	allowed, err := c.engine.AllowedCredentials(ctx, subject, target, creds)
+	if err != nil {
+		return nil, nil, err
+	}
+	cred, err := policy.SelectCredential(allowed, requested)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return target, cred, nil
+}
+
+// inSchedule reports whether one of the schedules gives the user a window on
+// the target that includes now
+func inSchedule(schedules []models.Schedule, userID, targetID uuid.UUID, now time.Time) bool {
+	for i := range schedules {
+		s := &schedules[i]
+		if s.UserID != userID || s.TargetID != targetID {
+			continue
+		}
+		if _, _, ok := s.WindowAt(now); ok {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,216 @@
+package tunnel
+
+import (
+	"context"
+	"crypto/ed25519"
+	"database/sql"
+	"io"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/VanCannon/openpam/gateway/internal/models"
+	"github.com/VanCannon/openpam/gateway/internal/policy"
+	"github.com/VanCannon/openpam/pkg/logger"
+	"github.com/google/uuid"
+)
+
+func testBundle(zoneID uuid.UUID, now time.Time) (*PolicyBundle, *models.Credential, uuid.UUID) {
+	userID := uuid.New()
+	target := &models.Target{ID: uuid.New(), ZoneID: zoneID, Protocol: models.ProtocolSSH, Enabled: true}
+	cred := &models.Credential{ID: uuid.New(), TargetID: target.ID, IsDefault: true}
+
+	return &PolicyBundle{
+		ZoneID:      zoneID,
+		IssuedAt:    now,
+		ExpiresAt:   now.Add(time.Hour),
+		Targets:     []*models.Target{target},
+		Credentials: []*models.Credential{cred},
+		Rules:       []*models.CredentialRule{},
+		Schedules: []models.Schedule{{
+			UserID:    userID,
+			TargetID:  target.ID,
+			StartTime: now.Add(-time.Minute),
+			EndTime:   now.Add(10 * time.Minute),
+		}},
+	}, cred, userID
+}
+
+func newTestCache(t *testing.T, zoneID uuid.UUID, offline OfflinePolicy) (*PolicyCache, ed25519.PrivateKey) {
+	pub, priv, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatalf("GenerateKey() error = %v", err)
+	}
+	path := filepath.Join(t.TempDir(), "bundle.json")
+	return NewPolicyCache(path, zoneID, pub, offline, logger.New(logger.LevelError, io.Discard)), priv
+}
+
+func TestVerifyBundle_RejectsTampering(t *testing.T) {
+	pub, priv, _ := ed25519.GenerateKey(nil)
+	bundle, _, _ := testBundle(uuid.New(), time.Now())
+
+	payload, err := SignBundle(bundle, priv)
+	if err != nil {
+		t.Fatalf("SignBundle() error = %v", err)
+	}
+	if _, err := VerifyBundle(payload, pub); err != nil {
+		t.Fatalf("VerifyBundle() error = %v", err)
+	}
+
+	payload.Bundle[len(payload.Bundle)-2] ^= 1
+	if _, err := VerifyBundle(payload, pub); err == nil {
+		t.Error("VerifyBundle() accepted a modified bundle")
+	}
+}
+
+func TestPolicyCache_Authorize(t *testing.T) {
+	now := time.Now()
+	zoneID := uuid.New()
+	ctx := context.Background()
+
+	tests := []struct {
+		name    string
+		offline OfflinePolicy
+		outside bool
+		wantErr error
+	}{
+		{name: "deny", offline: OfflineDeny, wantErr: ErrOfflineDenied},
+		{name: "cached", offline: OfflineCached},
+		{name: "cached outside schedule", offline: OfflineCached, outside: true},
+		{name: "scheduled", offline: OfflineScheduled},
+		{name: "scheduled outside schedule", offline: OfflineScheduled, outside: true, wantErr: ErrOutsideSchedule},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cache, key := newTestCache(t, zoneID, tt.offline)
+			bundle, cred, userID := testBundle(zoneID, now)
+			if tt.outside {
+				bundle.Schedules = nil
+			}
+			payload, _ := SignBundle(bundle, key)
+			if err := cache.Store(payload); err != nil {
+				t.Fatalf("Store() error = %v", err)
+			}
+
+			subject := policy.Subject{UserID: userID, Role: models.RoleUser}
+			_, got, err := cache.Authorize(ctx, subject, bundle.Targets[0].ID, nil, now)
+			if err != tt.wantErr {
+				t.Fatalf("Authorize() error = %v, want %v", err, tt.wantErr)
+			}
+			if err == nil && got.ID != cred.ID {
+				t.Errorf("Authorize() credential = %s, want %s", got.ID, cred.ID)
+			}
+		})
+	}
+}
+
+func TestPolicyCache_ExpiredAndUnknown(t *testing.T) {
+	now := time.Now()
+	zoneID := uuid.New()
+	cache, key := newTestCache(t, zoneID, OfflineCached)
+	bundle, _, userID := testBundle(zoneID, now)
+	payload, _ := SignBundle(bundle, key)
+	cache.Store(payload)
+
+	subject := policy.Subject{UserID: userID, Role: models.RoleUser}
+	if _, _, err := cache.Authorize(context.Background(), subject, uuid.New(), nil, now); err != ErrTargetNotCached {
+		t.Errorf("unknown target: error = %v, want %v", err, ErrTargetNotCached)
+	}
+	if _, _, err := cache.Authorize(context.Background(), subject, bundle.Targets[0].ID, nil, now.Add(2*time.Hour)); err != ErrNoBundle {
+		t.Errorf("expired bundle: error = %v, want %v", err, ErrNoBundle)
+	}
+}
+
+func TestPolicyCache_GroupRules(t *testing.T) {
+	now := time.Now()
+	zoneID := uuid.New()
+	cache, key := newTestCache(t, zoneID, OfflineCached)
+	bundle, cred, userID := testBundle(zoneID, now)
+
+	// The credential is restricted to a group the user is in
+	ops := uuid.New()
+	bundle.Rules = []*models.CredentialRule{
+		{ID: uuid.New(), Name: "ops only", Effect: models.RuleEffectAllow, GroupID: &ops, CredentialID: &cred.ID, Enabled: true},
+	}
+	bundle.Groups = GroupMembers{ops: {userID}}
+	payload, _ := SignBundle(bundle, key)
+	if err := cache.Store(payload); err != nil {
+		t.Fatalf("Store() error = %v", err)
+	}
+
+	member := policy.Subject{UserID: userID, Role: models.RoleUser}
+	if _, _, err := cache.Authorize(context.Background(), member, bundle.Targets[0].ID, nil, now); err != nil {
+		t.Errorf("member: error = %v", err)
+	}
+	other := policy.Subject{UserID: uuid.New(), Role: models.RoleUser}
+	if _, _, err := cache.Authorize(context.Background(), other, bundle.Targets[0].ID, nil, now); err != policy.ErrNoCredentials {
+		t.Errorf("non-member: error = %v, want %v", err, policy.ErrNoCredentials)
+	}
+}
+
+func TestPolicyCache_StoreAndLoad(t *testing.T) {
+	now := time.Now()
+	zoneID := uuid.New()
+	cache, key := newTestCache(t, zoneID, OfflineCached)
+
+	// Bundles for another zone are refused
+	other, _, _ := testBundle(uuid.New(), now)
+	payload, _ := SignBundle(other, key)
+	if err := cache.Store(payload); err == nil {
+		t.Fatal("Store() accepted another zone's bundle")
+	}
+
+	bundle, _, _ := testBundle(zoneID, now)
+	payload, _ = SignBundle(bundle, key)
+	if err := cache.Store(payload); err != nil {
+		t.Fatalf("Store() error = %v", err)
+	}
+
+	// An older bundle doesn't replace the current one
+	older, _, _ := testBundle(zoneID, now.Add(-time.Hour))
+	payload, _ = SignBundle(older, key)
+	cache.Store(payload)
+	if got := cache.Bundle(); got.Targets[0].ID != bundle.Targets[0].ID {
+		t.Error("older bundle replaced the current one")
+	}
+
+	// A restarted satellite picks the bundle up from disk
+	reloaded := NewPolicyCache(cache.path, zoneID, cache.key, OfflineCached, cache.logger)
+	if err := reloaded.Load(); err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if got := reloaded.Bundle(); got == nil || got.Targets[0].ID != bundle.Targets[0].ID {
+		t.Error("Load() did not restore the stored bundle")
+	}
+}
+
+func TestAuditSpool(t *testing.T) {
+	spool := NewAuditSpool(filepath.Join(t.TempDir(), "spool"))
+
+	session := &models.AuditLog{ID: uuid.New(), StartTime: time.Now(), SessionStatus: models.SessionStatusActive}
+	if err := spool.Save(session); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+
+	// Active sessions wait for their final state
+	if pending, _ := spool.Pending(); len(pending) != 0 {
+		t.Fatalf("Pending() = %d sessions, want 0", len(pending))
+	}
+
+	session.SessionStatus = models.SessionStatusCompleted
+	session.EndTime = sql.NullTime{Time: time.Now(), Valid: true}
+	spool.Save(session)
+
+	pending, err := spool.Pending()
+	if err != nil || len(pending) != 1 || pending[0].SessionStatus != models.SessionStatusCompleted {
+		t.Fatalf("Pending() = %v, %v", pending, err)
+	}
+
+	if err := spool.Remove([]uuid.UUID{session.ID}); err != nil {
+		t.Fatalf("Remove() error = %v", err)
+	}
+	if pending, _ := spool.Pending(); len(pending) != 0 {
+		t.Errorf("Pending() after Remove() = %d sessions", len(pending))
+	}
+}
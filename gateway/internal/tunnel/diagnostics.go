@@ -0,0 +1,380 @@
+package tunnel
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/VanCannon/openpam/gateway/internal/build"
+	"github.com/VanCannon/openpam/gateway/internal/models"
+	"github.com/VanCannon/openpam/pkg/logger"
+	"github.com/google/uuid"
+)
+
+const (
+	// maxLogBatch and maxLogBatchBytes bound a logs message the hub accepts
+	maxLogBatch      = 1000
+	maxLogBatchBytes = 4 << 20
+)
+
+// LogEntry is a log message a satellite forwards to the hub
+type LogEntry struct {
+	Time    time.Time         `json:"time"`
+	Level   string            `json:"level"`
+	Message string            `json:"message"`
+	Fields  map[string]string `json:"fields,omitempty"`
+}
+
+// DiagnosticsConfig configures the metrics and logs a satellite sends to the hub
+type DiagnosticsConfig struct {
+	MetricsInterval time.Duration // How often metrics are sent; 0 disables them
+	LogLevel        logger.Level  // Least severe level forwarded
+	LogInterval     time.Duration // How often buffered messages are sent
+	LogBatch        int           // Most messages sent per interval; 0 disables forwarding
+	LogBuffer       int           // Most messages kept while waiting or offline
+}
+
+// logForwarder buffers log messages until they are sent to the hub. When the
+// buffer is full the oldest messages are dropped.
+type logForwarder struct {
+	mu       sync.Mutex
+	entries  []LogEntry
+	capacity int
+	dropped  int          // Dropped since the last batch
+	total    atomic.Int64 // Dropped since start
+}
+
+func newLogForwarder(capacity int) *logForwarder {
+	if capacity <= 0 {
+		capacity = 5000
+	}
+	return &logForwarder{capacity: capacity}
+}
+
+// hook receives messages from the logger. It must not log.
+func (f *logForwarder) hook(e logger.Entry) {
+	entry := LogEntry{
+		Time:    e.Time,
+		Level:   e.Level.String(),
+		Message: e.Message,
+	}
+	if len(e.Fields) > 0 {
+		entry.Fields = make(map[string]string, len(e.Fields))
+		for k, v := range e.Fields {
+			entry.Fields[k] = fmt.Sprint(v)
+		}
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if len(f.entries) >= f.capacity {
+		f.entries = f.entries[1:]
+		f.drop(1)
+	}
+	f.entries = append(f.entries, entry)
+}
+
+// take removes up to n of the oldest messages, with the number dropped since
+// the last batch
+func (f *logForwarder) take(n int) ([]LogEntry, int) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	n = min(n, len(f.entries))
+	batch := make([]LogEntry, n)
+	copy(batch, f.entries)
+	f.entries = f.entries[n:]
+
+	dropped := f.dropped
+	f.dropped = 0
+	return batch, dropped
+}
+
+// drop counts messages that will never reach the hub. The caller holds f.mu.
+func (f *logForwarder) drop(n int) {
+	f.dropped += n
+	f.total.Add(int64(n))
+}
+
+// encodeLogs compresses a batch of log messages
+func encodeLogs(entries []LogEntry) ([]byte, error) {
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	if err := json.NewEncoder(zw).Encode(entries); err != nil {
+		return nil, fmt.Errorf("failed to encode logs: %w", err)
+	}
+	if err := zw.Close(); err != nil {
+		return nil, fmt.Errorf("failed to compress logs: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// decodeLogs decompresses a batch of log messages, refusing oversized batches
+func decodeLogs(data []byte) ([]LogEntry, error) {
+	zr, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decompress logs: %w", err)
+	}
+	defer zr.Close()
+
+	raw, err := io.ReadAll(io.LimitReader(zr, maxLogBatchBytes+1))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decompress logs: %w", err)
+	}
+	if len(raw) > maxLogBatchBytes {
+		return nil, fmt.Errorf("log batch exceeds %d bytes", maxLogBatchBytes)
+	}
+
+	var entries []LogEntry
+	if err := json.Unmarshal(raw, &entries); err != nil {
+		return nil, fmt.Errorf("failed to decode logs: %w", err)
+	}
+	if len(entries) > maxLogBatch {
+		return nil, fmt.Errorf("log batch exceeds %d messages", maxLogBatch)
+	}
+	return entries, nil
+}
+
+// ForwardDiagnostics sends metrics and log messages to the hub while the
+// satellite is connected. Call it before Run.
+func (s *SatelliteClient) ForwardDiagnostics(cfg DiagnosticsConfig) {
+	if cfg.LogInterval <= 0 {
+		cfg.LogInterval = 10 * time.Second
+	}
+	s.diagnostics = cfg
+	if cfg.LogBatch > 0 {
+		s.forwarder = newLogForwarder(cfg.LogBuffer)
+		s.logger.AddHook(cfg.LogLevel, s.forwarder.hook)
+	}
+}
+
+// runDiagnostics sends metrics and buffered logs until ctx is cancelled
+func (s *SatelliteClient) runDiagnostics(ctx context.Context) {
+	var metricsC, logsC <-chan time.Time
+	if s.diagnostics.MetricsInterval > 0 {
+		ticker := time.NewTicker(s.diagnostics.MetricsInterval)
+		defer ticker.Stop()
+		metricsC = ticker.C
+	}
+	if s.forwarder != nil {
+		ticker := time.NewTicker(s.diagnostics.LogInterval)
+		defer ticker.Stop()
+		logsC = ticker.C
+	}
+	if metricsC == nil && logsC == nil {
+		return
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-metricsC:
+			if s.Online() {
+				s.sendMetrics()
+			}
+		case <-logsC:
+			if s.Online() {
+				s.sendLogs()
+			}
+		}
+	}
+}
+
+// metrics takes a snapshot of the satellite's runtime metrics
+func (s *SatelliteClient) metrics() models.SatelliteMetricsSnapshot {
+	var mem runtime.MemStats
+	runtime.ReadMemStats(&mem)
+
+	now := time.Now()
+	snapshot := models.SatelliteMetricsSnapshot{
+		CollectedAt:       now,
+		Version:           build.Version,
+		UptimeSeconds:     int64(now.Sub(s.started).Seconds()),
+		Goroutines:        runtime.NumGoroutine(),
+		HeapAllocBytes:    mem.HeapAlloc,
+		SysBytes:          mem.Sys,
+		NumGC:             mem.NumGC,
+		ActiveConnections: s.active.Load(),
+	}
+	if pending, err := s.spool.Pending(); err == nil {
+		snapshot.SpooledSessions = len(pending)
+	}
+	if bundle := s.cache.Bundle(); bundle != nil {
+		expires := bundle.ExpiresAt
+		snapshot.PolicyBundleExpiresAt = &expires
+	}
+	if s.forwarder != nil {
+		snapshot.LogsDropped = s.forwarder.total.Load()
+	}
+	return snapshot
+}
+
+// sendMetrics sends a metrics snapshot to the hub
+func (s *SatelliteClient) sendMetrics() {
+	msg := NewMessage(MessageTypeMetrics)
+	if err := msg.SetPayload(MetricsPayload{Metrics: s.metrics()}); err != nil {
+		return
+	}
+	data, _ := msg.Encode()
+	if err := s.write(data); err != nil {
+		s.logger.Warn("Failed to send metrics to hub", map[string]interface{}{
+			"error": err.Error(),
+		})
+	}
+}
+
+// sendLogs sends the oldest buffered log messages to the hub, at most
+// LogBatch per interval. Messages that fail to send are dropped rather than
+// retried, so a hub that keeps refusing them can't grow the buffer.
+func (s *SatelliteClient) sendLogs() {
+	entries, dropped := s.forwarder.take(s.diagnostics.LogBatch)
+	if len(entries) == 0 && dropped == 0 {
+		return
+	}
+
+	err := func() error {
+		data, err := encodeLogs(entries)
+		if err != nil {
+			return err
+		}
+		msg := NewMessage(MessageTypeLogs)
+		if err := msg.SetPayload(LogsPayload{Entries: data, Count: len(entries), Dropped: dropped}); err != nil {
+			return err
+		}
+		encoded, err := msg.Encode()
+		if err != nil {
+			return err
+		}
+		return s.write(encoded)
+	}()
+	if err != nil {
+		s.forwarder.mu.Lock()
+		s.forwarder.drop(len(entries) + dropped)
+		s.forwarder.mu.Unlock()
+	}
+}
+
+// DiagnosticsStore keeps the metrics and log messages satellites send
+type DiagnosticsStore interface {
+	SaveMetrics(ctx context.Context, metrics *models.SatelliteMetrics) error
+	SaveLogs(ctx context.Context, logs []*models.SatelliteLog) error
+	DeleteDiagnosticsBefore(ctx context.Context, zoneID uuid.UUID, cutoff time.Time) error
+}
+
+// handleMetrics stores a satellite's metrics snapshot and prunes the zone's
+// diagnostics past their retention
+func (h *HubServer) handleMetrics(ctx context.Context, satellite *SatelliteConnection, msg *Message) {
+	zoneID, err := uuid.Parse(satellite.ZoneID)
+	if h.sync.Diagnostics == nil || err != nil {
+		return
+	}
+
+	var payload MetricsPayload
+	if err := msg.GetPayload(&payload); err != nil {
+		h.logger.Error("Invalid metrics payload", map[string]interface{}{
+			"zone_name": satellite.ZoneName,
+			"error":     err.Error(),
+		})
+		return
+	}
+
+	metrics := &models.SatelliteMetrics{
+		ZoneID:      zoneID,
+		Metrics:     payload.Metrics,
+		CollectedAt: payload.Metrics.CollectedAt,
+		ReceivedAt:  time.Now(),
+	}
+	if metrics.CollectedAt.IsZero() {
+		metrics.CollectedAt = metrics.ReceivedAt
+	}
+	if err := h.sync.Diagnostics.SaveMetrics(ctx, metrics); err != nil {
+		h.logger.Error("Failed to save satellite metrics", map[string]interface{}{
+			"zone_name": satellite.ZoneName,
+			"error":     err.Error(),
+		})
+	}
+
+	if h.sync.DiagnosticsRetention > 0 {
+		cutoff := time.Now().Add(-h.sync.DiagnosticsRetention)
+		if err := h.sync.Diagnostics.DeleteDiagnosticsBefore(ctx, zoneID, cutoff); err != nil {
+			h.logger.Error("Failed to prune satellite diagnostics", map[string]interface{}{
+				"zone_name": satellite.ZoneName,
+				"error":     err.Error(),
+			})
+		}
+	}
+}
+
+// handleLogs stores a batch of log messages forwarded by a satellite
+func (h *HubServer) handleLogs(ctx context.Context, satellite *SatelliteConnection, msg *Message) {
+	zoneID, err := uuid.Parse(satellite.ZoneID)
+	if h.sync.Diagnostics == nil || err != nil {
+		return
+	}
+
+	var payload LogsPayload
+	if err := msg.GetPayload(&payload); err != nil {
+		h.logger.Error("Invalid logs payload", map[string]interface{}{
+			"zone_name": satellite.ZoneName,
+			"error":     err.Error(),
+		})
+		return
+	}
+	entries, err := decodeLogs(payload.Entries)
+	if err != nil {
+		h.logger.Error("Invalid logs payload", map[string]interface{}{
+			"zone_name": satellite.ZoneName,
+			"error":     err.Error(),
+		})
+		return
+	}
+
+	now := time.Now()
+	logs := make([]*models.SatelliteLog, 0, len(entries)+1)
+	for _, e := range entries {
+		level, err := logger.ParseLevel(e.Level)
+		if err != nil {
+			continue
+		}
+		loggedAt := e.Time
+		if loggedAt.IsZero() {
+			loggedAt = now
+		}
+		logs = append(logs, &models.SatelliteLog{
+			ZoneID:     zoneID,
+			LoggedAt:   loggedAt,
+			Level:      level.String(),
+			Message:    e.Message,
+			Fields:     e.Fields,
+			ReceivedAt: now,
+		})
+	}
+	if payload.Dropped > 0 {
+		logs = append(logs, &models.SatelliteLog{
+			ZoneID:     zoneID,
+			LoggedAt:   now,
+			Level:      logger.LevelWarn.String(),
+			Message:    "Satellite dropped log messages",
+			Fields:     models.LogFields{"count": fmt.Sprint(payload.Dropped)},
+			ReceivedAt: now,
+		})
+	}
+	if len(logs) == 0 {
+		return
+	}
+
+	if err := h.sync.Diagnostics.SaveLogs(ctx, logs); err != nil {
+		h.logger.Error("Failed to save satellite logs", map[string]interface{}{
+			"zone_name": satellite.ZoneName,
+			"error":     err.Error(),
+		})
+	}
+}
@@ -0,0 +1,62 @@
+package tunnel
+
+import (
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/VanCannon/openpam/pkg/logger"
+)
+
+func TestLogForwarder(t *testing.T) {
+	f := newLogForwarder(3)
+	log := logger.New(logger.LevelError, io.Discard)
+	log.AddHook(logger.LevelInfo, f.hook)
+
+	log.Debug("not forwarded")
+	for _, msg := range []string{"one", "two", "three", "four"} {
+		log.Info(msg, map[string]interface{}{"n": len(msg)})
+	}
+
+	// The oldest message made room for the newest
+	batch, dropped := f.take(2)
+	if len(batch) != 2 || batch[0].Message != "two" || batch[1].Message != "three" || dropped != 1 {
+		t.Fatalf("take(2) = %+v, %d; want two and three with 1 dropped", batch, dropped)
+	}
+	if batch[0].Level != "INFO" || batch[0].Fields["n"] != "3" {
+		t.Errorf("entry = %+v, want INFO with n=3", batch[0])
+	}
+
+	batch, dropped = f.take(10)
+	if len(batch) != 1 || batch[0].Message != "four" || dropped != 0 {
+		t.Errorf("take(10) = %+v, %d; want four", batch, dropped)
+	}
+	if f.total.Load() != 1 {
+		t.Errorf("total dropped = %d, want 1", f.total.Load())
+	}
+}
+
+func TestEncodeLogs(t *testing.T) {
+	entries := []LogEntry{{Level: "WARN", Message: strings.Repeat("x", 10000)}}
+	data, err := encodeLogs(entries)
+	if err != nil {
+		t.Fatalf("encodeLogs() error = %v", err)
+	}
+	if len(data) > 1000 {
+		t.Errorf("encodeLogs() = %d bytes, want it compressed", len(data))
+	}
+
+	decoded, err := decodeLogs(data)
+	if err != nil {
+		t.Fatalf("decodeLogs() error = %v", err)
+	}
+	if len(decoded) != 1 || decoded[0].Message != entries[0].Message {
+		t.Errorf("decodeLogs() = %d entries, want the original", len(decoded))
+	}
+
+	// Batches beyond the hub's limits are refused
+	data, _ = encodeLogs(make([]LogEntry, maxLogBatch+1))
+	if _, err := decodeLogs(data); err == nil {
+		t.Error("decodeLogs() accepted an oversized batch")
+	}
+}
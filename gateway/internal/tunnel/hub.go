@@ -2,13 +2,19 @@ package tunnel
 
 import (
 	"context"
+	"crypto/ed25519"
+	"crypto/subtle"
 	"fmt"
 	"net/http"
+	"strings"
 	"sync"
+	"time"
 
-	"github.com/VanCannon/openpam/gateway/internal/logger"
-	"github.com/gorilla/websocket"
+	"github.com/VanCannon/openpam/gateway/internal/keys"
+	"github.com/VanCannon/openpam/gateway/internal/models"
+	"github.com/VanCannon/openpam/pkg/logger"
 	"github.com/google/uuid"
+	"github.com/gorilla/websocket"
 )
 
 var upgrader = websocket.Upgrader{
@@ -19,9 +25,31 @@ var upgrader = websocket.Upgrader{
 	},
 }
 
+// AuditImporter stores sessions a satellite recorded while offline. It reports
+// false for sessions that were already stored.
+type AuditImporter interface {
+	Import(ctx context.Context, log *models.AuditLog) (bool, error)
+}
+
+// HubSyncConfig configures the policy bundles pushed to satellites, the
+// import of the audit they record while offline and their management
+type HubSyncConfig struct {
+	Bundles    *BundleBuilder
+	SigningKey ed25519.PrivateKey // nil disables bundle, config and update pushes
+	Keys       *keys.Ring         // Also signs bundles as a detached JWS; nil leaves that out
+	Interval   time.Duration
+	Audit      AuditImporter
+	Management ManagementStore // nil disables config and update pushes
+
+	Diagnostics          DiagnosticsStore // nil discards satellite metrics and logs
+	DiagnosticsRetention time.Duration    // How long metrics and logs are kept; 0 keeps them
+}
+
 // HubServer manages satellite connections
 type HubServer struct {
 	logger     *logger.Logger
+	token      string
+	sync       HubSyncConfig
 	satellites map[string]*SatelliteConnection
 	mu         sync.RWMutex
 }
@@ -32,13 +60,42 @@ type SatelliteConnection struct {
 	ZoneName    string
 	Conn        *websocket.Conn
 	Connections map[string]chan []byte // connection_id -> data channel
+	Status      *StatusPayload         // Last status reported, nil until the first report
 	mu          sync.RWMutex
+	writeMu     sync.Mutex
 }
 
-// NewHubServer creates a new hub server
-func NewHubServer(log *logger.Logger) *HubServer {
+// send writes an encoded message to the satellite; writes are serialized
+func (s *SatelliteConnection) send(data []byte) error {
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+	return s.Conn.WriteMessage(websocket.TextMessage, data)
+}
+
+// sendMessage encodes and sends a message with the given payload
+func (s *SatelliteConnection) sendMessage(msgType MessageType, payload interface{}) error {
+	msg := NewMessage(msgType)
+	if err := msg.SetPayload(payload); err != nil {
+		return err
+	}
+	data, err := msg.Encode()
+	if err != nil {
+		return err
+	}
+	return s.send(data)
+}
+
+// NewHubServer creates a new hub server. Satellites must present token as a
+// bearer token when they connect.
+func NewHubServer(log *logger.Logger, token string, sync HubSyncConfig) *HubServer {
+	if sync.Interval <= 0 {
+		sync.Interval = 5 * time.Minute
+	}
+
 	return &HubServer{
 		logger:     log,
+		token:      token,
+		sync:       sync,
 		satellites: make(map[string]*SatelliteConnection),
 	}
 }
@@ -46,6 +103,15 @@ func NewHubServer(log *logger.Logger) *HubServer {
 // HandleSatelliteConnection handles a new satellite WebSocket connection
 func (h *HubServer) HandleSatelliteConnection() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
+		token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if h.token == "" || subtle.ConstantTimeCompare([]byte(token), []byte(h.token)) != 1 {
+			h.logger.Warn("Rejected satellite connection", map[string]interface{}{
+				"remote_addr": r.RemoteAddr,
+			})
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
 		conn, err := upgrader.Upgrade(w, r, nil)
 		if err != nil {
 			h.logger.Error("Failed to upgrade satellite connection", map[string]interface{}{
@@ -105,14 +171,18 @@ func (h *HubServer) HandleSatelliteConnection() http.HandlerFunc {
 			Message:  "Registration successful",
 		})
 		ackData, _ := ackMsg.Encode()
-		conn.WriteMessage(websocket.TextMessage, ackData)
+		satellite.send(ackData)
 
 		h.logger.Info("Satellite registered successfully", map[string]interface{}{
 			"zone_name": payload.ZoneName,
 		})
 
+		ctx, cancel := context.WithCancel(context.Background())
+		go h.pushBundles(ctx, satellite)
+
 		// Handle messages from satellite
-		h.handleSatelliteMessages(context.Background(), satellite)
+		h.handleSatelliteMessages(ctx, satellite)
+		cancel()
 
 		// Cleanup on disconnect
 		h.mu.Lock()
@@ -152,6 +222,14 @@ func (h *HubServer) handleSatelliteMessages(ctx context.Context, satellite *Sate
 			h.handleSatelliteData(satellite, msg)
 		case MessageTypeClose:
 			h.handleSatelliteClose(satellite, msg)
+		case MessageTypeAuditUpload:
+			h.handleAuditUpload(ctx, satellite, msg)
+		case MessageTypeStatus:
+			h.handleStatus(ctx, satellite, msg)
+		case MessageTypeMetrics:
+			h.handleMetrics(ctx, satellite, msg)
+		case MessageTypeLogs:
+			h.handleLogs(ctx, satellite, msg)
 		case MessageTypePong:
 			// Keepalive response
 		default:
@@ -193,7 +271,7 @@ func (h *HubServer) RequestDial(zoneID, targetHost string, targetPort int, proto
 	})
 
 	msgData, _ := dialMsg.Encode()
-	if err := satellite.Conn.WriteMessage(websocket.TextMessage, msgData); err != nil {
+	if err := satellite.send(msgData); err != nil {
 		satellite.mu.Lock()
 		delete(satellite.Connections, connectionID)
 		satellite.mu.Unlock()
@@ -218,7 +296,7 @@ func (h *HubServer) SendData(zoneID, connectionID string, data []byte) error {
 	dataMsg.SetPayload(DataPayload{Data: data})
 
 	msgData, _ := dataMsg.Encode()
-	return satellite.Conn.WriteMessage(websocket.TextMessage, msgData)
+	return satellite.send(msgData)
 }
 
 // CloseConnection closes a tunnel connection
@@ -243,7 +321,7 @@ func (h *HubServer) CloseConnection(zoneID, connectionID string) error {
 	closeMsg.SetPayload(ClosePayload{Reason: "connection closed"})
 
 	msgData, _ := closeMsg.Encode()
-	return satellite.Conn.WriteMessage(websocket.TextMessage, msgData)
+	return satellite.send(msgData)
 }
 
 // handleDialResponse processes dial response from satellite
@@ -312,3 +390,151 @@ func (h *HubServer) GetSatellite(zoneID string) (*SatelliteConnection, bool) {
 	satellite, exists := h.satellites[zoneID]
 	return satellite, exists
 }
+
+// pushBundles sends the satellite its zone's policy bundle on registration and
+// then every sync interval until ctx is cancelled
+func (h *HubServer) pushBundles(ctx context.Context, satellite *SatelliteConnection) {
+	if h.sync.SigningKey == nil || h.sync.Bundles == nil {
+		return
+	}
+
+	zoneID, err := uuid.Parse(satellite.ZoneID)
+	if err != nil {
+		h.logger.Warn("Satellite zone ID is not a UUID; policy bundles disabled", map[string]interface{}{
+			"zone_id": satellite.ZoneID,
+		})
+		return
+	}
+
+	interval := h.sync.Interval
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		bundle, err := h.pushBundle(ctx, satellite, zoneID)
+		if err != nil {
+			h.logger.Error("Failed to push policy bundle", map[string]interface{}{
+				"zone_name": satellite.ZoneName,
+				"error":     err.Error(),
+			})
+		}
+
+		// A zone can set its own sync interval
+		if bundle != nil {
+			next := h.sync.Interval
+			if bundle.Zone != nil && bundle.Zone.Settings.TunnelSyncInterval != nil {
+				next = time.Duration(*bundle.Zone.Settings.TunnelSyncInterval) * time.Second
+			}
+			if next != interval {
+				interval = next
+				ticker.Reset(interval)
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// pushBundle builds, signs and sends one policy bundle
+func (h *HubServer) pushBundle(ctx context.Context, satellite *SatelliteConnection, zoneID uuid.UUID) (*PolicyBundle, error) {
+	bundle, err := h.sync.Bundles.Build(ctx, zoneID, time.Now())
+	if err != nil {
+		return nil, err
+	}
+
+	payload, err := SignBundle(bundle, h.sync.SigningKey)
+	if err != nil {
+		return nil, err
+	}
+	if h.sync.Keys != nil {
+		if payload.JWS, err = h.sync.Keys.SignDetached(ctx, payload.Bundle); err != nil {
+			return nil, err
+		}
+	}
+
+	msg := NewMessage(MessageTypePolicyBundle)
+	if err := msg.SetPayload(payload); err != nil {
+		return nil, err
+	}
+	data, err := msg.Encode()
+	if err != nil {
+		return nil, err
+	}
+	return bundle, satellite.send(data)
+}
+
+// handleAuditUpload stores the sessions a satellite recorded while offline and
+// acknowledges them. Sessions on targets outside the satellite's zone are
+// refused and never acknowledged.
+func (h *HubServer) handleAuditUpload(ctx context.Context, satellite *SatelliteConnection, msg *Message) {
+	if h.sync.Audit == nil || h.sync.Bundles == nil {
+		return
+	}
+
+	var payload AuditUploadPayload
+	if err := msg.GetPayload(&payload); err != nil {
+		h.logger.Error("Failed to parse audit upload", map[string]interface{}{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	zoneID, err := uuid.Parse(satellite.ZoneID)
+	if err != nil {
+		return
+	}
+	targets, err := h.sync.Bundles.targets.ListByZone(ctx, zoneID)
+	if err != nil {
+		h.logger.Error("Failed to list zone targets for audit upload", map[string]interface{}{
+			"zone_name": satellite.ZoneName,
+			"error":     err.Error(),
+		})
+		return
+	}
+	inZone := make(map[uuid.UUID]bool, len(targets))
+	for _, t := range targets {
+		inZone[t.ID] = true
+	}
+
+	ack := AuditUploadAckPayload{SessionIDs: []uuid.UUID{}}
+	imported := 0
+	for _, session := range payload.Sessions {
+		if !inZone[session.TargetID] {
+			h.logger.Warn("Refused offline session for target outside zone", map[string]interface{}{
+				"zone_name":  satellite.ZoneName,
+				"session_id": session.ID.String(),
+				"target_id":  session.TargetID.String(),
+			})
+			continue
+		}
+
+		created, err := h.sync.Audit.Import(ctx, session)
+		if err != nil {
+			h.logger.Error("Failed to import offline session", map[string]interface{}{
+				"zone_name":  satellite.ZoneName,
+				"session_id": session.ID.String(),
+				"error":      err.Error(),
+			})
+			continue
+		}
+		if created {
+			imported++
+		}
+		ack.SessionIDs = append(ack.SessionIDs, session.ID)
+	}
+
+	h.logger.Info("Imported offline audit from satellite", map[string]interface{}{
+		"zone_name": satellite.ZoneName,
+		"received":  len(payload.Sessions),
+		"imported":  imported,
+	})
+
+	ackMsg := NewMessage(MessageTypeAuditUploadAck)
+	ackMsg.SetPayload(ack)
+	data, _ := ackMsg.Encode()
+	satellite.send(data)
+}
@@ -0,0 +1,449 @@
+package tunnel
+
+import (
+	"context"
+	"crypto/ed25519"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/VanCannon/openpam/gateway/internal/models"
+	"github.com/google/uuid"
+)
+
+// Update kinds reported in UpdateStatus
+const (
+	UpdateKindBinary = "binary"
+	UpdateKindConfig = "config"
+)
+
+// PushableConfig lists the environment variables the hub may set on a
+// satellite. Identity, trust and secret settings are left to the satellite's
+// own environment so a pushed configuration can't take the satellite over.
+var PushableConfig = map[string]bool{
+	"OFFLINE_POLICY":             true,
+	"POLICY_CACHE_PATH":          true,
+	"OFFLINE_AUDIT_DIR":          true,
+	"VAULT_ADDR":                 true,
+	"SERVER_READ_TIMEOUT":        true,
+	"SERVER_WRITE_TIMEOUT":       true,
+	"SERVER_IDLE_TIMEOUT":        true,
+	"DB_MAX_OPEN_CONNS":          true,
+	"DB_MAX_IDLE_CONNS":          true,
+	"DB_CONN_MAX_LIFETIME":       true,
+	"DB_CONN_MAX_IDLE_TIME":      true,
+	"WS_WRITE_TIMEOUT":           true,
+	"WS_PING_INTERVAL":           true,
+	"WS_PONG_TIMEOUT":            true,
+	"WS_WRITE_QUEUE_SIZE":        true,
+	"WS_MAX_BATCH_BYTES":         true,
+	"SSH_KEEPALIVE_INTERVAL":     true,
+	"SSH_KEEPALIVE_MAX_MISSED":   true,
+	"EVIDENCE_CAPTURE_BYTES":     true,
+	"DLP_RULES":                  true,
+	"RDP_BLOCK_CLIPBOARD":        true,
+	"UPDATE_HEALTH_TIMEOUT":      true,
+	"SATELLITE_METRICS_INTERVAL": true,
+	"SATELLITE_LOG_LEVEL":        true,
+	"SATELLITE_LOG_INTERVAL":     true,
+	"SATELLITE_LOG_BATCH":        true,
+	"SATELLITE_LOG_BUFFER":       true,
+	"RECORDINGS_STORAGE":         true,
+	"RECORDINGS_DIR":             true,
+	"RECORDINGS_BUCKET":          true,
+	"RECORDINGS_PREFIX":          true,
+	"RECORDINGS_ENDPOINT":        true,
+	"RECORDINGS_REGION":          true,
+	"RECORDINGS_PART_SIZE":       true,
+	"BODY_LIMIT_DEFAULT":         true,
+	"BODY_LIMIT_AUTH":            true,
+	"BODY_LIMIT_BULK":            true,
+	"IDEMPOTENCY_TTL":            true,
+	"USAGE_FLUSH_INTERVAL":       true,
+}
+
+// ValidateConfigValues checks that every value is one the hub may push
+func ValidateConfigValues(values map[string]string) error {
+	var refused []string
+	for key := range values {
+		if !PushableConfig[key] {
+			refused = append(refused, key)
+		}
+	}
+	if len(refused) > 0 {
+		sort.Strings(refused)
+		return fmt.Errorf("settings can't be pushed to satellites: %s", strings.Join(refused, ", "))
+	}
+	return nil
+}
+
+// ConfigDocument is a zone's satellite configuration as signed by the hub and
+// stored by the satellite
+type ConfigDocument struct {
+	ZoneID   uuid.UUID         `json:"zone_id"`
+	Revision int               `json:"revision"`
+	Values   map[string]string `json:"values"`
+}
+
+// SignConfig encodes and signs a configuration document
+func SignConfig(doc *ConfigDocument, key ed25519.PrivateKey) (*ConfigUpdatePayload, error) {
+	data, sig, err := sign(doc, key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode satellite config: %w", err)
+	}
+	return &ConfigUpdatePayload{Config: data, Signature: sig}, nil
+}
+
+// VerifyConfig checks a configuration document's signature and decodes it
+func VerifyConfig(payload *ConfigUpdatePayload, key ed25519.PublicKey) (*ConfigDocument, error) {
+	var doc ConfigDocument
+	if err := verify(payload.Config, payload.Signature, key, &doc); err != nil {
+		return nil, fmt.Errorf("satellite config %w", err)
+	}
+	return &doc, nil
+}
+
+// LoadConfigDocument reads the configuration stored at path. A missing file is
+// an empty configuration at revision 0.
+func LoadConfigDocument(path string) (*ConfigDocument, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return &ConfigDocument{Values: map[string]string{}}, nil
+		}
+		return nil, fmt.Errorf("failed to read satellite config: %w", err)
+	}
+
+	var doc ConfigDocument
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("failed to decode satellite config: %w", err)
+	}
+	return &doc, nil
+}
+
+// ApplyConfigOverrides sets the environment variables of the configuration
+// stored at path, so they take precedence when the configuration is loaded
+func ApplyConfigOverrides(path string) error {
+	doc, err := LoadConfigDocument(path)
+	if err != nil {
+		return err
+	}
+	for key, value := range doc.Values {
+		if PushableConfig[key] {
+			os.Setenv(key, value)
+		}
+	}
+	return nil
+}
+
+// UpdateManifest describes a satellite build to install, as signed by the hub
+type UpdateManifest struct {
+	RolloutID uuid.UUID `json:"rollout_id"`
+	Version   string    `json:"version"`
+	URL       string    `json:"url"`
+	SHA256    string    `json:"sha256"`
+	Size      int64     `json:"size"`
+}
+
+// SignManifest encodes and signs an update manifest
+func SignManifest(manifest *UpdateManifest, key ed25519.PrivateKey) (*UpdateManifestPayload, error) {
+	data, sig, err := sign(manifest, key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode update manifest: %w", err)
+	}
+	return &UpdateManifestPayload{Manifest: data, Signature: sig}, nil
+}
+
+// VerifyManifest checks an update manifest's signature and decodes it
+func VerifyManifest(payload *UpdateManifestPayload, key ed25519.PublicKey) (*UpdateManifest, error) {
+	var manifest UpdateManifest
+	if err := verify(payload.Manifest, payload.Signature, key, &manifest); err != nil {
+		return nil, fmt.Errorf("update manifest %w", err)
+	}
+	return &manifest, nil
+}
+
+// ManagementStore keeps the configuration, rollouts and reported status of
+// managed satellites
+type ManagementStore interface {
+	GetConfig(ctx context.Context, zoneID uuid.UUID) (*models.SatelliteConfig, error)
+	ListActiveRollouts(ctx context.Context) ([]*models.SatelliteRollout, error)
+	UpdateRollout(ctx context.Context, rollout *models.SatelliteRollout) error
+	SaveStatus(ctx context.Context, status *models.SatelliteStatus) error
+	ListStatus(ctx context.Context) ([]*models.SatelliteStatus, error)
+}
+
+// ManagementEnabled reports whether the hub can push configuration and updates
+func (h *HubServer) ManagementEnabled() bool {
+	return h.sync.Management != nil && h.sync.SigningKey != nil
+}
+
+// handleStatus records a satellite's status, then sends it whatever
+// configuration or update it is missing and moves rollouts along
+func (h *HubServer) handleStatus(ctx context.Context, satellite *SatelliteConnection, msg *Message) {
+	var payload StatusPayload
+	if err := msg.GetPayload(&payload); err != nil {
+		h.logger.Error("Invalid status payload", map[string]interface{}{
+			"zone_name": satellite.ZoneName,
+			"error":     err.Error(),
+		})
+		return
+	}
+
+	satellite.mu.Lock()
+	satellite.Status = &payload
+	satellite.mu.Unlock()
+
+	if !h.ManagementEnabled() {
+		return
+	}
+	zoneID, err := uuid.Parse(satellite.ZoneID)
+	if err != nil {
+		return
+	}
+
+	status := &models.SatelliteStatus{
+		ZoneID:         zoneID,
+		Version:        payload.Version,
+		ConfigRevision: payload.ConfigRevision,
+		ReportedAt:     time.Now(),
+	}
+	if u := payload.Update; u != nil {
+		status.UpdateState = &u.State
+		if u.RolloutID != uuid.Nil {
+			status.RolloutID = uuid.NullUUID{UUID: u.RolloutID, Valid: true}
+		}
+		if u.Error != "" {
+			status.UpdateError = &u.Error
+		}
+	}
+	if err := h.sync.Management.SaveStatus(ctx, status); err != nil {
+		h.logger.Error("Failed to save satellite status", map[string]interface{}{
+			"zone_name": satellite.ZoneName,
+			"error":     err.Error(),
+		})
+	}
+
+	h.Reconcile(ctx)
+}
+
+// Reconcile brings every connected satellite in line with its zone's
+// configuration and the active rollouts, advancing rollouts whose current
+// stage has finished
+func (h *HubServer) Reconcile(ctx context.Context) {
+	if !h.ManagementEnabled() {
+		return
+	}
+
+	// Advancing a stage can make satellites in the next one due for the update
+	for {
+		rollouts, err := h.sync.Management.ListActiveRollouts(ctx)
+		if err != nil {
+			h.logger.Error("Failed to list rollouts", map[string]interface{}{
+				"error": err.Error(),
+			})
+			return
+		}
+
+		h.mu.RLock()
+		satellites := make([]*SatelliteConnection, 0, len(h.satellites))
+		for _, satellite := range h.satellites {
+			satellites = append(satellites, satellite)
+		}
+		h.mu.RUnlock()
+
+		for _, satellite := range satellites {
+			h.reconcileSatellite(ctx, satellite, rollouts)
+		}
+
+		advanced, err := h.advanceRollouts(ctx, rollouts)
+		if err != nil {
+			h.logger.Error("Failed to advance rollouts", map[string]interface{}{
+				"error": err.Error(),
+			})
+			return
+		}
+		if !advanced {
+			return
+		}
+	}
+}
+
+// reconcileSatellite pushes a newer configuration or a due update to one
+// satellite, and fails rollouts the satellite could not install
+func (h *HubServer) reconcileSatellite(ctx context.Context, satellite *SatelliteConnection, rollouts []*models.SatelliteRollout) {
+	satellite.mu.RLock()
+	status := satellite.Status
+	satellite.mu.RUnlock()
+
+	zoneID, err := uuid.Parse(satellite.ZoneID)
+	if status == nil || err != nil {
+		return
+	}
+
+	// A satellite restarting into an update is left alone until it reports back
+	if status.Update != nil && status.Update.State == models.UpdateStateApplying {
+		return
+	}
+
+	if cfg, err := h.sync.Management.GetConfig(ctx, zoneID); err == nil && cfg.Revision > status.ConfigRevision && !configFailed(status, cfg.Revision) {
+		if err := h.pushConfig(satellite, cfg); err != nil {
+			h.logger.Error("Failed to push satellite config", map[string]interface{}{
+				"zone_name": satellite.ZoneName,
+				"error":     err.Error(),
+			})
+		}
+		return
+	}
+
+	for _, rollout := range rollouts {
+		if !rollout.InCurrentStage(zoneID) || status.Version == rollout.Version {
+			continue
+		}
+
+		if u := status.Update; u != nil && u.RolloutID == rollout.ID &&
+			(u.State == models.UpdateStateRolledBack || u.State == models.UpdateStateFailed) {
+			h.failRollout(ctx, rollout, fmt.Sprintf("zone %s: %s", satellite.ZoneName, u.Error))
+			continue
+		}
+
+		if err := h.pushManifest(satellite, rollout); err != nil {
+			h.logger.Error("Failed to push update manifest", map[string]interface{}{
+				"zone_name": satellite.ZoneName,
+				"error":     err.Error(),
+			})
+		}
+		// One update at a time
+		return
+	}
+}
+
+// configFailed reports whether the satellite already rolled back the revision
+func configFailed(status *StatusPayload, revision int) bool {
+	u := status.Update
+	return u != nil && u.Kind == UpdateKindConfig && u.ConfigRevision == revision &&
+		(u.State == models.UpdateStateRolledBack || u.State == models.UpdateStateFailed)
+}
+
+// advanceRollouts moves each rollout whose current stage is fully on the new
+// version to its next stage. It reports whether any rollout moved.
+func (h *HubServer) advanceRollouts(ctx context.Context, rollouts []*models.SatelliteRollout) (bool, error) {
+	if len(rollouts) == 0 {
+		return false, nil
+	}
+
+	statuses, err := h.sync.Management.ListStatus(ctx)
+	if err != nil {
+		return false, err
+	}
+	byZone := make(map[uuid.UUID]*models.SatelliteStatus, len(statuses))
+	for _, status := range statuses {
+		byZone[status.ZoneID] = status
+	}
+
+	advanced := false
+	for _, rollout := range rollouts {
+		if rollout.Status != models.RolloutStatusActive || !stageDone(rollout, byZone) {
+			continue
+		}
+
+		rollout.CurrentStage++
+		if rollout.CurrentStage >= len(rollout.Stages) {
+			rollout.Status = models.RolloutStatusCompleted
+		}
+		if err := h.sync.Management.UpdateRollout(ctx, rollout); err != nil {
+			return advanced, err
+		}
+		advanced = true
+
+		h.logger.Info("Rollout advanced", map[string]interface{}{
+			"rollout_id": rollout.ID.String(),
+			"version":    rollout.Version,
+			"stage":      rollout.CurrentStage,
+			"status":     rollout.Status,
+		})
+	}
+	return advanced, nil
+}
+
+// stageDone reports whether every zone in the rollout's current stage runs
+// the rollout's version and has passed its health check
+func stageDone(rollout *models.SatelliteRollout, byZone map[uuid.UUID]*models.SatelliteStatus) bool {
+	if rollout.CurrentStage >= len(rollout.Stages) {
+		return true
+	}
+	for _, zoneID := range rollout.Stages[rollout.CurrentStage] {
+		status, ok := byZone[zoneID]
+		if !ok || status.Version != rollout.Version {
+			return false
+		}
+		if status.UpdateState != nil && *status.UpdateState == models.UpdateStateApplying {
+			return false
+		}
+	}
+	return true
+}
+
+// failRollout halts a rollout after a satellite failed to install it
+func (h *HubServer) failRollout(ctx context.Context, rollout *models.SatelliteRollout, reason string) {
+	if rollout.Status != models.RolloutStatusActive {
+		return
+	}
+	rollout.Status = models.RolloutStatusFailed
+	rollout.Error = &reason
+	if err := h.sync.Management.UpdateRollout(ctx, rollout); err != nil {
+		h.logger.Error("Failed to update rollout", map[string]interface{}{
+			"rollout_id": rollout.ID.String(),
+			"error":      err.Error(),
+		})
+		return
+	}
+
+	h.logger.Warn("Rollout halted", map[string]interface{}{
+		"rollout_id": rollout.ID.String(),
+		"version":    rollout.Version,
+		"reason":     reason,
+	})
+}
+
+// pushConfig signs and sends a zone's configuration to its satellite
+func (h *HubServer) pushConfig(satellite *SatelliteConnection, cfg *models.SatelliteConfig) error {
+	payload, err := SignConfig(&ConfigDocument{
+		ZoneID:   cfg.ZoneID,
+		Revision: cfg.Revision,
+		Values:   cfg.Values,
+	}, h.sync.SigningKey)
+	if err != nil {
+		return err
+	}
+
+	h.logger.Info("Pushing satellite config", map[string]interface{}{
+		"zone_name": satellite.ZoneName,
+		"revision":  cfg.Revision,
+	})
+	return satellite.sendMessage(MessageTypeConfigUpdate, payload)
+}
+
+// pushManifest signs and sends a rollout's manifest to a satellite
+func (h *HubServer) pushManifest(satellite *SatelliteConnection, rollout *models.SatelliteRollout) error {
+	payload, err := SignManifest(&UpdateManifest{
+		RolloutID: rollout.ID,
+		Version:   rollout.Version,
+		URL:       rollout.URL,
+		SHA256:    rollout.SHA256,
+		Size:      rollout.Size,
+	}, h.sync.SigningKey)
+	if err != nil {
+		return err
+	}
+
+	h.logger.Info("Pushing satellite update", map[string]interface{}{
+		"zone_name":  satellite.ZoneName,
+		"rollout_id": rollout.ID.String(),
+		"version":    rollout.Version,
+	})
+	return satellite.sendMessage(MessageTypeUpdateManifest, payload)
+}
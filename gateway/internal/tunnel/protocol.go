@@ -3,6 +3,9 @@ package tunnel
 import (
 	"encoding/json"
 	"fmt"
+
+	"github.com/VanCannon/openpam/gateway/internal/models"
+	"github.com/google/uuid"
 )
 
 // MessageType represents the type of tunnel message
@@ -32,13 +35,37 @@ const (
 
 	// MessageTypePong is the response to ping
 	MessageTypePong MessageType = "pong"
+
+	// MessageTypePolicyBundle is sent by hub with the zone's signed policy bundle
+	MessageTypePolicyBundle MessageType = "policy_bundle"
+
+	// MessageTypeAuditUpload is sent by satellite with sessions it recorded while offline
+	MessageTypeAuditUpload MessageType = "audit_upload"
+
+	// MessageTypeAuditUploadAck is sent by hub with the uploaded sessions it has stored
+	MessageTypeAuditUploadAck MessageType = "audit_upload_ack"
+
+	// MessageTypeStatus is sent by satellite with its version, configuration revision and update state
+	MessageTypeStatus MessageType = "status"
+
+	// MessageTypeConfigUpdate is sent by hub with the zone's signed satellite configuration
+	MessageTypeConfigUpdate MessageType = "config_update"
+
+	// MessageTypeUpdateManifest is sent by hub with a signed manifest of the build to install
+	MessageTypeUpdateManifest MessageType = "update_manifest"
+
+	// MessageTypeMetrics is sent by satellite with a snapshot of its runtime metrics
+	MessageTypeMetrics MessageType = "metrics"
+
+	// MessageTypeLogs is sent by satellite with a compressed batch of its log messages
+	MessageTypeLogs MessageType = "logs"
 )
 
 // Message represents a tunnel protocol message
 type Message struct {
-	Type        MessageType     `json:"type"`
-	ConnectionID string         `json:"connection_id,omitempty"`
-	Payload     json.RawMessage `json:"payload,omitempty"`
+	Type         MessageType     `json:"type"`
+	ConnectionID string          `json:"connection_id,omitempty"`
+	Payload      json.RawMessage `json:"payload,omitempty"`
 }
 
 // RegisterPayload is sent by satellite to register with hub
@@ -80,6 +107,65 @@ type ClosePayload struct {
 	Reason string `json:"reason,omitempty"`
 }
 
+// PolicyBundlePayload carries an encoded PolicyBundle and the hub's signature over it
+type PolicyBundlePayload struct {
+	Bundle    json.RawMessage `json:"bundle"`
+	Signature []byte          `json:"signature"`
+	JWS       string          `json:"jws,omitempty"` // Detached JWS over Bundle by the hub's signing key, when it signs responses
+}
+
+// AuditUploadPayload carries sessions a satellite recorded while offline
+type AuditUploadPayload struct {
+	Sessions []*models.AuditLog `json:"sessions"`
+}
+
+// AuditUploadAckPayload lists the uploaded sessions the hub has stored
+type AuditUploadAckPayload struct {
+	SessionIDs []uuid.UUID `json:"session_ids"`
+}
+
+// StatusPayload is sent by satellite to report what it is running
+type StatusPayload struct {
+	Version        string        `json:"version"`
+	ConfigRevision int           `json:"config_revision"`
+	Update         *UpdateStatus `json:"update,omitempty"`
+}
+
+// UpdateStatus describes the satellite's last binary or configuration update
+type UpdateStatus struct {
+	Kind           string    `json:"kind"` // "binary" or "config"
+	RolloutID      uuid.UUID `json:"rollout_id,omitempty"`
+	Version        string    `json:"version,omitempty"`
+	ConfigRevision int       `json:"config_revision,omitempty"`
+	State          string    `json:"state"`
+	Error          string    `json:"error,omitempty"`
+}
+
+// ConfigUpdatePayload carries an encoded ConfigDocument and the hub's signature over it
+type ConfigUpdatePayload struct {
+	Config    json.RawMessage `json:"config"`
+	Signature []byte          `json:"signature"`
+}
+
+// UpdateManifestPayload carries an encoded UpdateManifest and the hub's signature over it
+type UpdateManifestPayload struct {
+	Manifest  json.RawMessage `json:"manifest"`
+	Signature []byte          `json:"signature"`
+}
+
+// MetricsPayload is sent by satellite with a snapshot of its runtime metrics
+type MetricsPayload struct {
+	Metrics models.SatelliteMetricsSnapshot `json:"metrics"`
+}
+
+// LogsPayload is sent by satellite with log messages. Entries holds the
+// gzip-compressed JSON array of LogEntry.
+type LogsPayload struct {
+	Entries []byte `json:"entries"`
+	Count   int    `json:"count"`
+	Dropped int    `json:"dropped"` // Messages discarded since the last batch
+}
+
 // NewMessage creates a new message with the given type
 func NewMessage(msgType MessageType) *Message {
 	return &Message{
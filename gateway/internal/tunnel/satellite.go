@@ -4,31 +4,138 @@ import (
 	"context"
 	"fmt"
 	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"sync/atomic"
 	"time"
 
-	"github.com/VanCannon/openpam/gateway/internal/logger"
+	"github.com/VanCannon/openpam/gateway/internal/build"
+	"github.com/VanCannon/openpam/gateway/internal/models"
+	"github.com/VanCannon/openpam/gateway/internal/policy"
+	"github.com/VanCannon/openpam/gateway/internal/settings"
+	"github.com/VanCannon/openpam/pkg/logger"
+	"github.com/google/uuid"
 	"github.com/gorilla/websocket"
 )
 
+const (
+	// reconnectMin and reconnectMax bound the delay between attempts to reach the hub
+	reconnectMin = 5 * time.Second
+	reconnectMax = time.Minute
+)
+
 // SatelliteClient connects to the hub and maintains a reverse tunnel
 type SatelliteClient struct {
-	hubAddress string
-	zoneID     string
-	zoneName   string
-	logger     *logger.Logger
-	conn       *websocket.Conn
+	hubAddress  string
+	zoneID      string
+	zoneName    string
+	token       string
+	cache       *PolicyCache
+	spool       *AuditSpool
+	updater     *Updater
+	logger      *logger.Logger
+	conn        *websocket.Conn
 	connections map[string]net.Conn
+
+	diagnostics DiagnosticsConfig
+	forwarder   *logForwarder // nil unless logs are forwarded
+	started     time.Time
+	active      atomic.Int64 // Proxied connections open
+
+	writeMu sync.Mutex
+	online  atomic.Bool
+	done    chan struct{}
 }
 
-// NewSatelliteClient creates a new satellite client
-func NewSatelliteClient(hubAddress, zoneID, zoneName string, log *logger.Logger) *SatelliteClient {
-	return &SatelliteClient{
+// NewSatelliteClient creates a new satellite client. Policy bundles pushed by
+// the hub are kept in cache, and sessions recorded while offline are uploaded
+// from spool once the hub is reachable again. Configuration and builds pushed
+// by the hub are installed by updater; nil refuses them.
+func NewSatelliteClient(hubAddress, zoneID, zoneName, token string, cache *PolicyCache, spool *AuditSpool, updater *Updater, log *logger.Logger) *SatelliteClient {
+	s := &SatelliteClient{
 		hubAddress:  hubAddress,
 		zoneID:      zoneID,
 		zoneName:    zoneName,
+		token:       token,
+		cache:       cache,
+		spool:       spool,
+		updater:     updater,
 		logger:      log,
 		connections: make(map[string]net.Conn),
+		started:     time.Now(),
 	}
+	if updater != nil {
+		updater.onChange = s.sendStatus
+	}
+	return s
+}
+
+// Run keeps the satellite connected to the hub until ctx is cancelled,
+// reconnecting with backoff whenever the connection drops
+func (s *SatelliteClient) Run(ctx context.Context) {
+	if s.updater != nil {
+		if err := s.updater.Start(); err != nil {
+			s.logger.Error("Failed to resume satellite update", map[string]interface{}{
+				"error": err.Error(),
+			})
+		}
+	}
+
+	go s.runDiagnostics(ctx)
+
+	delay := reconnectMin
+	for {
+		if err := s.Connect(ctx); err != nil {
+			s.logger.Warn("Hub unreachable", map[string]interface{}{
+				"error": err.Error(),
+				"retry": delay.String(),
+			})
+		} else {
+			delay = reconnectMin
+			select {
+			case <-s.done:
+			case <-ctx.Done():
+				s.Close()
+				return
+			}
+		}
+
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+			return
+		}
+		delay = min(delay*2, reconnectMax)
+	}
+}
+
+// Online reports whether the satellite is registered with the hub
+func (s *SatelliteClient) Online() bool {
+	return s.online.Load()
+}
+
+// Authorize decides from the cached policy bundle whether a session may start
+// while the hub is unreachable
+func (s *SatelliteClient) Authorize(ctx context.Context, subject policy.Subject, targetID uuid.UUID, requested *uuid.UUID) (*models.Target, *models.Credential, error) {
+	return s.cache.Authorize(ctx, subject, targetID, requested, time.Now())
+}
+
+// Settings resolves a session's settings from the cached policy bundle
+func (s *SatelliteClient) Settings(ctx context.Context, subject policy.Subject, target *models.Target, cred *models.Credential) (*settings.Effective, error) {
+	return s.cache.Settings(ctx, subject, target, cred)
+}
+
+// RecordSession spools a session authorized or ended while offline. Ended
+// sessions are uploaded straight away if the hub is reachable.
+func (s *SatelliteClient) RecordSession(log *models.AuditLog) error {
+	if err := s.spool.Save(log); err != nil {
+		return err
+	}
+	if log.EndTime.Valid && s.Online() {
+		go s.uploadAudit()
+	}
+	return nil
 }
 
 // Connect establishes connection to the hub
@@ -43,12 +150,18 @@ func (s *SatelliteClient) Connect(ctx context.Context) error {
 		HandshakeTimeout: 10 * time.Second,
 	}
 
-	conn, _, err := dialer.DialContext(ctx, s.hubAddress, nil)
+	header := http.Header{}
+	if s.token != "" {
+		header.Set("Authorization", "Bearer "+s.token)
+	}
+
+	conn, _, err := dialer.DialContext(ctx, s.hubAddress, header)
 	if err != nil {
 		return fmt.Errorf("failed to connect to hub: %w", err)
 	}
 
 	s.conn = conn
+	s.done = make(chan struct{})
 
 	// Send registration message
 	if err := s.register(); err != nil {
@@ -70,7 +183,7 @@ func (s *SatelliteClient) register() error {
 	payload := RegisterPayload{
 		ZoneID:   s.zoneID,
 		ZoneName: s.zoneName,
-		Version:  "0.1.0",
+		Version:  build.Version,
 	}
 
 	if err := msg.SetPayload(payload); err != nil {
@@ -82,11 +195,24 @@ func (s *SatelliteClient) register() error {
 		return err
 	}
 
+	return s.write(data)
+}
+
+// write sends an encoded message to the hub. Connections, uploads and the
+// message handler all write, so writes are serialized.
+func (s *SatelliteClient) write(data []byte) error {
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
 	return s.conn.WriteMessage(websocket.TextMessage, data)
 }
 
 // handleMessages processes messages from the hub
 func (s *SatelliteClient) handleMessages(ctx context.Context) {
+	defer func() {
+		s.online.Store(false)
+		close(s.done)
+	}()
+
 	for {
 		select {
 		case <-ctx.Done():
@@ -131,6 +257,14 @@ func (s *SatelliteClient) handleMessage(ctx context.Context, msg *Message) error
 		return s.handleClose(msg)
 	case MessageTypePing:
 		return s.handlePing()
+	case MessageTypePolicyBundle:
+		return s.handlePolicyBundle(msg)
+	case MessageTypeAuditUploadAck:
+		return s.handleAuditUploadAck(msg)
+	case MessageTypeConfigUpdate:
+		return s.handleConfigUpdate(msg)
+	case MessageTypeUpdateManifest:
+		return s.handleUpdateManifest(ctx, msg)
 	default:
 		s.logger.Warn("Unknown message type", map[string]interface{}{
 			"type": msg.Type,
@@ -151,9 +285,138 @@ func (s *SatelliteClient) handleRegisterAck(msg *Message) error {
 	}
 
 	s.logger.Info("Registration accepted by hub")
+	s.online.Store(true)
+
+	// Reaching the hub is the health check of an update we restarted into
+	if s.updater != nil {
+		s.updater.Healthy()
+	}
+	go s.sendStatus()
+	if s.diagnostics.MetricsInterval > 0 {
+		go s.sendMetrics()
+	}
+
+	// Hand over whatever was recorded while the hub was unreachable
+	go s.uploadAudit()
 	return nil
 }
 
+// sendStatus reports the satellite's version, configuration revision and last
+// update to the hub
+func (s *SatelliteClient) sendStatus() {
+	status := StatusPayload{Version: build.Version}
+	if s.updater != nil {
+		status = s.updater.Status()
+	}
+
+	msg := NewMessage(MessageTypeStatus)
+	if err := msg.SetPayload(status); err != nil {
+		return
+	}
+	data, _ := msg.Encode()
+	if err := s.write(data); err != nil {
+		s.logger.Error("Failed to send status to hub", map[string]interface{}{
+			"error": err.Error(),
+		})
+	}
+}
+
+// handleConfigUpdate installs a configuration pushed by the hub
+func (s *SatelliteClient) handleConfigUpdate(msg *Message) error {
+	if s.updater == nil {
+		return fmt.Errorf("satellite config refused: POLICY_VERIFY_KEY is not set")
+	}
+
+	var payload ConfigUpdatePayload
+	if err := msg.GetPayload(&payload); err != nil {
+		return err
+	}
+	return s.updater.ApplyConfig(&payload)
+}
+
+// handleUpdateManifest installs a build pushed by the hub. The download runs
+// in the background so the tunnel keeps serving sessions meanwhile.
+func (s *SatelliteClient) handleUpdateManifest(ctx context.Context, msg *Message) error {
+	if s.updater == nil {
+		return fmt.Errorf("update manifest refused: POLICY_VERIFY_KEY is not set")
+	}
+
+	var payload UpdateManifestPayload
+	if err := msg.GetPayload(&payload); err != nil {
+		return err
+	}
+	go func() {
+		if err := s.updater.ApplyUpdate(ctx, &payload); err != nil {
+			s.logger.Error("Failed to apply satellite update", map[string]interface{}{
+				"error": err.Error(),
+			})
+		}
+	}()
+	return nil
+}
+
+// handlePolicyBundle verifies and caches a policy bundle pushed by the hub
+func (s *SatelliteClient) handlePolicyBundle(msg *Message) error {
+	var payload PolicyBundlePayload
+	if err := msg.GetPayload(&payload); err != nil {
+		return err
+	}
+
+	if err := s.cache.Store(&payload); err != nil {
+		return fmt.Errorf("rejected policy bundle: %w", err)
+	}
+
+	bundle := s.cache.Bundle()
+	s.logger.Info("Policy bundle cached", map[string]interface{}{
+		"issued_at":  bundle.IssuedAt,
+		"expires_at": bundle.ExpiresAt,
+		"targets":    len(bundle.Targets),
+		"rules":      len(bundle.Rules),
+		"schedules":  len(bundle.Schedules),
+	})
+	return nil
+}
+
+// uploadAudit sends the spooled sessions to the hub
+func (s *SatelliteClient) uploadAudit() {
+	sessions, err := s.spool.Pending()
+	if err != nil {
+		s.logger.Error("Failed to read offline audit spool", map[string]interface{}{
+			"error": err.Error(),
+		})
+		return
+	}
+	if len(sessions) == 0 {
+		return
+	}
+
+	msg := NewMessage(MessageTypeAuditUpload)
+	if err := msg.SetPayload(AuditUploadPayload{Sessions: sessions}); err != nil {
+		return
+	}
+	data, _ := msg.Encode()
+	if err := s.write(data); err != nil {
+		s.logger.Error("Failed to upload offline audit", map[string]interface{}{
+			"sessions": len(sessions),
+			"error":    err.Error(),
+		})
+		return
+	}
+
+	s.logger.Info("Uploaded offline audit", map[string]interface{}{
+		"sessions": len(sessions),
+	})
+}
+
+// handleAuditUploadAck drops the sessions the hub has stored from the spool
+func (s *SatelliteClient) handleAuditUploadAck(msg *Message) error {
+	var payload AuditUploadAckPayload
+	if err := msg.GetPayload(&payload); err != nil {
+		return err
+	}
+	return s.spool.Remove(payload.SessionIDs)
+}
+
 // handleDialRequest dials a target and establishes connection
 func (s *SatelliteClient) handleDialRequest(ctx context.Context, msg *Message) error {
 	var payload DialRequestPayload
@@ -169,8 +432,8 @@ func (s *SatelliteClient) handleDialRequest(ctx context.Context, msg *Message) e
 	})
 
 	// Dial the target
-	addr := fmt.Sprintf("%s:%d", payload.TargetHost, payload.TargetPort)
-	conn, err := net.DialTimeout("tcp", addr, 10*time.Second)
+	addr := net.JoinHostPort(payload.TargetHost, strconv.Itoa(payload.TargetPort))
+	conn, err := net.DialTimeout("tcp", addr, s.cache.DialTimeout(10*time.Second))
 
 	response := NewMessage(MessageTypeDialResponse)
 	response.ConnectionID = msg.ConnectionID
@@ -183,6 +446,7 @@ func (s *SatelliteClient) handleDialRequest(ctx context.Context, msg *Message) e
 		response.SetPayload(responsePayload)
 	} else {
 		s.connections[msg.ConnectionID] = conn
+		s.active.Add(1)
 		responsePayload := DialResponsePayload{
 			Success: true,
 		}
@@ -193,7 +457,7 @@ func (s *SatelliteClient) handleDialRequest(ctx context.Context, msg *Message) e
 	}
 
 	data, _ := response.Encode()
-	return s.conn.WriteMessage(websocket.TextMessage, data)
+	return s.write(data)
 }
 
 // proxyConnection proxies data between target and hub
@@ -201,13 +465,14 @@ func (s *SatelliteClient) proxyConnection(ctx context.Context, connectionID stri
 	defer func() {
 		targetConn.Close()
 		delete(s.connections, connectionID)
+		s.active.Add(-1)
 
 		// Send close message
 		closeMsg := NewMessage(MessageTypeClose)
 		closeMsg.ConnectionID = connectionID
 		closeMsg.SetPayload(ClosePayload{Reason: "connection closed"})
 		data, _ := closeMsg.Encode()
-		s.conn.WriteMessage(websocket.TextMessage, data)
+		s.write(data)
 	}()
 
 	// Read from target and send to hub
@@ -228,7 +493,7 @@ func (s *SatelliteClient) proxyConnection(ctx context.Context, connectionID stri
 			dataMsg.SetPayload(DataPayload{Data: buffer[:n]})
 
 			msgData, _ := dataMsg.Encode()
-			if err := s.conn.WriteMessage(websocket.TextMessage, msgData); err != nil {
+			if err := s.write(msgData); err != nil {
 				return
 			}
 		}
@@ -267,7 +532,7 @@ func (s *SatelliteClient) handleClose(msg *Message) error {
 func (s *SatelliteClient) handlePing() error {
 	pongMsg := NewMessage(MessageTypePong)
 	data, _ := pongMsg.Encode()
-	return s.conn.WriteMessage(websocket.TextMessage, data)
+	return s.write(data)
 }
 
 // Close closes the satellite client
@@ -0,0 +1,105 @@
+package tunnel
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/VanCannon/openpam/gateway/internal/models"
+	"github.com/google/uuid"
+)
+
+// AuditSpool keeps the sessions a satellite records while the hub is
+// unreachable until the hub has stored them. Each session is one file, so a
+// session's final state simply replaces its start.
+type AuditSpool struct {
+	dir string
+	mu  sync.Mutex
+}
+
+// NewAuditSpool creates a spool in dir
+func NewAuditSpool(dir string) *AuditSpool {
+	return &AuditSpool{dir: dir}
+}
+
+// Save writes a session's current state to the spool
+func (s *AuditSpool) Save(log *models.AuditLog) error {
+	data, err := json.Marshal(log)
+	if err != nil {
+		return fmt.Errorf("failed to encode session: %w", err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := os.MkdirAll(s.dir, 0700); err != nil {
+		return fmt.Errorf("failed to create audit spool: %w", err)
+	}
+	path := s.path(log.ID)
+	if err := os.WriteFile(path+".tmp", data, 0600); err != nil {
+		return fmt.Errorf("failed to write session to audit spool: %w", err)
+	}
+	if err := os.Rename(path+".tmp", path); err != nil {
+		return fmt.Errorf("failed to write session to audit spool: %w", err)
+	}
+	return nil
+}
+
+// Pending returns the spooled sessions that have ended, oldest first. Active
+// sessions are held back so the hub only ever receives their final state.
+func (s *AuditSpool) Pending() ([]*models.AuditLog, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to read audit spool: %w", err)
+	}
+
+	var sessions []*models.AuditLog
+	for _, entry := range entries {
+		if !strings.HasSuffix(entry.Name(), ".json") {
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join(s.dir, entry.Name()))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read audit spool: %w", err)
+		}
+		var log models.AuditLog
+		if err := json.Unmarshal(data, &log); err != nil {
+			return nil, fmt.Errorf("failed to decode spooled session %s: %w", entry.Name(), err)
+		}
+		if log.EndTime.Valid {
+			sessions = append(sessions, &log)
+		}
+	}
+
+	sort.Slice(sessions, func(i, j int) bool {
+		return sessions[i].StartTime.Before(sessions[j].StartTime)
+	})
+	return sessions, nil
+}
+
+// Remove drops sessions the hub has stored
+func (s *AuditSpool) Remove(ids []uuid.UUID) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, id := range ids {
+		if err := os.Remove(s.path(id)); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("failed to remove spooled session: %w", err)
+		}
+	}
+	return nil
+}
+
+func (s *AuditSpool) path(id uuid.UUID) string {
+	return filepath.Join(s.dir, id.String()+".json")
+}
@@ -0,0 +1,482 @@
+package tunnel
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/VanCannon/openpam/gateway/internal/build"
+	"github.com/VanCannon/openpam/gateway/internal/models"
+	"github.com/VanCannon/openpam/pkg/logger"
+	"github.com/google/uuid"
+)
+
+// UpdaterConfig configures how a satellite installs what the hub pushes
+type UpdaterConfig struct {
+	VerifyKey     ed25519.PublicKey
+	ZoneID        uuid.UUID
+	ConfigPath    string        // Where the pushed configuration is kept
+	StateDir      string        // Where the update state is kept across restarts
+	Executable    string        // Binary replaced by updates; empty is the running binary
+	AutoUpdate    bool          // Whether binary updates are installed
+	HealthTimeout time.Duration // How long an update has to reconnect to the hub
+	Restart       func()        // Restarts the satellite; defaults to a graceful exit
+	HTTPClient    *http.Client  // Downloads builds; defaults to a client with a 10m timeout
+}
+
+// updateState is the update in progress or last finished, kept on disk so it
+// survives the restart that applies it
+type updateState struct {
+	UpdateStatus
+	Attempts int `json:"attempts"` // Starts of the update before it became healthy
+}
+
+// failed reports whether the update was rolled back or could not be installed
+func (s *updateState) failed() bool {
+	return s.State == models.UpdateStateRolledBack || s.State == models.UpdateStateFailed
+}
+
+// Updater installs configuration and builds pushed by the hub on a satellite.
+// An update is installed, the satellite restarts into it, and the update must
+// reconnect to the hub within the health timeout. Otherwise, or if the
+// satellite restarts again first, the previous binary or configuration is
+// restored and the satellite restarts once more.
+type Updater struct {
+	cfg    UpdaterConfig
+	logger *logger.Logger
+
+	mu             sync.Mutex
+	state          *updateState
+	configRevision int
+	healthTimer    *time.Timer
+
+	onChange func() // Reports the new status to the hub
+}
+
+// NewUpdater creates a new updater
+func NewUpdater(cfg UpdaterConfig, log *logger.Logger) *Updater {
+	if cfg.HealthTimeout <= 0 {
+		cfg.HealthTimeout = 2 * time.Minute
+	}
+	if cfg.Restart == nil {
+		cfg.Restart = restartProcess
+	}
+	if cfg.HTTPClient == nil {
+		cfg.HTTPClient = &http.Client{Timeout: 10 * time.Minute}
+	}
+	return &Updater{
+		cfg:    cfg,
+		logger: log,
+	}
+}
+
+// Start resumes an update the satellite restarted into, and rolls it back if
+// this is not its first start
+func (u *Updater) Start() error {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	doc, err := LoadConfigDocument(u.cfg.ConfigPath)
+	if err != nil {
+		return err
+	}
+	u.configRevision = doc.Revision
+
+	state, err := u.loadState()
+	if err != nil {
+		return err
+	}
+	u.state = state
+	if state == nil || state.State != models.UpdateStateApplying {
+		return nil
+	}
+
+	if state.Attempts > 0 {
+		u.rollback("restarted before reconnecting to the hub")
+		return nil
+	}
+
+	state.Attempts++
+	if err := u.saveState(); err != nil {
+		return err
+	}
+	u.healthTimer = time.AfterFunc(u.cfg.HealthTimeout, func() {
+		u.mu.Lock()
+		defer u.mu.Unlock()
+		if u.state != nil && u.state.State == models.UpdateStateApplying {
+			u.rollback(fmt.Sprintf("no connection to the hub within %s", u.cfg.HealthTimeout))
+		}
+	})
+
+	u.logger.Info("Waiting for update health check", map[string]interface{}{
+		"kind":    state.Kind,
+		"version": state.Version,
+		"timeout": u.cfg.HealthTimeout.String(),
+	})
+	return nil
+}
+
+// Healthy marks an update in progress as good. The satellite calls it once it
+// has registered with the hub.
+func (u *Updater) Healthy() {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	if u.state == nil || u.state.State != models.UpdateStateApplying {
+		return
+	}
+	if u.healthTimer != nil {
+		u.healthTimer.Stop()
+	}
+
+	if u.state.Kind == UpdateKindBinary && u.state.Version != build.Version {
+		u.rollback(fmt.Sprintf("installed binary reports version %s, expected %s", build.Version, u.state.Version))
+		return
+	}
+
+	u.state.State = models.UpdateStateHealthy
+	if err := u.saveState(); err != nil {
+		u.logger.Error("Failed to save update state", map[string]interface{}{
+			"error": err.Error(),
+		})
+	}
+	u.logger.Info("Update passed health check", map[string]interface{}{
+		"kind":            u.state.Kind,
+		"version":         u.state.Version,
+		"config_revision": u.state.ConfigRevision,
+	})
+}
+
+// Status returns what the satellite runs and how its last update went
+func (u *Updater) Status() StatusPayload {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	status := StatusPayload{
+		Version:        build.Version,
+		ConfigRevision: u.configRevision,
+	}
+	if u.state != nil {
+		update := u.state.UpdateStatus
+		status.Update = &update
+	}
+	return status
+}
+
+// ApplyConfig verifies and installs a configuration pushed by the hub, then
+// restarts the satellite so it takes effect
+func (u *Updater) ApplyConfig(payload *ConfigUpdatePayload) error {
+	doc, err := VerifyConfig(payload, u.cfg.VerifyKey)
+	if err != nil {
+		return err
+	}
+	if doc.ZoneID != u.cfg.ZoneID {
+		return fmt.Errorf("satellite config is for zone %s, not %s", doc.ZoneID, u.cfg.ZoneID)
+	}
+	if err := ValidateConfigValues(doc.Values); err != nil {
+		return err
+	}
+
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	if doc.Revision <= u.configRevision {
+		return nil
+	}
+	if u.state != nil {
+		if u.state.State == models.UpdateStateApplying {
+			return fmt.Errorf("an update is already being applied")
+		}
+		if u.state.Kind == UpdateKindConfig && u.state.ConfigRevision == doc.Revision && u.state.failed() {
+			return nil
+		}
+	}
+
+	u.state = &updateState{UpdateStatus: UpdateStatus{
+		Kind:           UpdateKindConfig,
+		ConfigRevision: doc.Revision,
+		State:          models.UpdateStateApplying,
+	}}
+
+	data, err := json.Marshal(doc)
+	if err != nil {
+		return u.fail(fmt.Errorf("failed to encode satellite config: %w", err))
+	}
+	if err := backup(u.cfg.ConfigPath); err != nil {
+		return u.fail(err)
+	}
+	if err := writeFile(u.cfg.ConfigPath, data, 0600); err != nil {
+		return u.fail(err)
+	}
+	if err := u.saveState(); err != nil {
+		return u.fail(err)
+	}
+
+	u.logger.Info("Satellite config installed, restarting", map[string]interface{}{
+		"revision": doc.Revision,
+	})
+	u.restart()
+	return nil
+}
+
+// ApplyUpdate verifies a manifest pushed by the hub, downloads and installs
+// its build, then restarts the satellite into it
+func (u *Updater) ApplyUpdate(ctx context.Context, payload *UpdateManifestPayload) error {
+	manifest, err := VerifyManifest(payload, u.cfg.VerifyKey)
+	if err != nil {
+		return err
+	}
+
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	if manifest.Version == build.Version {
+		return nil
+	}
+	// Don't retry a rollout this satellite already failed or rolled back, or
+	// interrupt an update in progress
+	if u.state != nil {
+		if u.state.State == models.UpdateStateApplying {
+			return nil
+		}
+		if u.state.RolloutID == manifest.RolloutID && u.state.failed() {
+			return nil
+		}
+	}
+
+	u.state = &updateState{UpdateStatus: UpdateStatus{
+		Kind:      UpdateKindBinary,
+		RolloutID: manifest.RolloutID,
+		Version:   manifest.Version,
+		State:     models.UpdateStateApplying,
+	}}
+
+	if !u.cfg.AutoUpdate {
+		return u.fail(fmt.Errorf("automatic updates are disabled on this satellite"))
+	}
+
+	exe, err := u.executable()
+	if err != nil {
+		return u.fail(err)
+	}
+
+	u.logger.Info("Downloading satellite update", map[string]interface{}{
+		"version": manifest.Version,
+		"url":     manifest.URL,
+	})
+	download := exe + ".download"
+	if err := u.download(ctx, manifest, download); err != nil {
+		os.Remove(download)
+		return u.fail(err)
+	}
+
+	if err := os.Rename(exe, exe+".previous"); err != nil {
+		os.Remove(download)
+		return u.fail(fmt.Errorf("failed to keep the current binary: %w", err))
+	}
+	if err := os.Rename(download, exe); err != nil {
+		os.Rename(exe+".previous", exe)
+		return u.fail(fmt.Errorf("failed to install the new binary: %w", err))
+	}
+	if err := u.saveState(); err != nil {
+		return u.fail(err)
+	}
+
+	u.logger.Info("Satellite update installed, restarting", map[string]interface{}{
+		"version": manifest.Version,
+	})
+	u.restart()
+	return nil
+}
+
+// download fetches the manifest's build to path and checks its size and digest
+func (u *Updater) download(ctx context.Context, manifest *UpdateManifest, path string) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, manifest.URL, nil)
+	if err != nil {
+		return fmt.Errorf("invalid update URL: %w", err)
+	}
+	resp, err := u.cfg.HTTPClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to download update: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("failed to download update: %s", resp.Status)
+	}
+
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0755)
+	if err != nil {
+		return fmt.Errorf("failed to write update: %w", err)
+	}
+	defer f.Close()
+
+	hash := sha256.New()
+	n, err := io.Copy(io.MultiWriter(f, hash), io.LimitReader(resp.Body, manifest.Size+1))
+	if err != nil {
+		return fmt.Errorf("failed to download update: %w", err)
+	}
+	if n != manifest.Size {
+		return fmt.Errorf("update is %d bytes, manifest says %d", n, manifest.Size)
+	}
+	if sum := hex.EncodeToString(hash.Sum(nil)); sum != manifest.SHA256 {
+		return fmt.Errorf("update digest %s does not match the manifest", sum)
+	}
+	return f.Close()
+}
+
+// rollback restores what the update replaced and restarts the satellite.
+// The caller holds u.mu.
+func (u *Updater) rollback(reason string) {
+	u.logger.Warn("Rolling back satellite update", map[string]interface{}{
+		"kind":    u.state.Kind,
+		"version": u.state.Version,
+		"reason":  reason,
+	})
+
+	var err error
+	switch u.state.Kind {
+	case UpdateKindBinary:
+		var exe string
+		if exe, err = u.executable(); err == nil {
+			err = os.Rename(exe+".previous", exe)
+		}
+	case UpdateKindConfig:
+		err = restore(u.cfg.ConfigPath)
+	}
+
+	u.state.State = models.UpdateStateRolledBack
+	u.state.Error = reason
+	if err != nil {
+		u.state.State = models.UpdateStateFailed
+		u.state.Error = fmt.Sprintf("%s; rollback failed: %v", reason, err)
+	}
+	if err := u.saveState(); err != nil {
+		u.logger.Error("Failed to save update state", map[string]interface{}{
+			"error": err.Error(),
+		})
+	}
+
+	u.restart()
+}
+
+// restart reports the update state to the hub, then restarts the satellite.
+// It runs once the caller has released u.mu.
+func (u *Updater) restart() {
+	go func() {
+		if u.onChange != nil {
+			u.onChange()
+		}
+		u.cfg.Restart()
+	}()
+}
+
+// fail records an update that could not be installed and reports it. The
+// caller holds u.mu.
+func (u *Updater) fail(err error) error {
+	u.state.State = models.UpdateStateFailed
+	u.state.Error = err.Error()
+	if saveErr := u.saveState(); saveErr != nil {
+		u.logger.Error("Failed to save update state", map[string]interface{}{
+			"error": saveErr.Error(),
+		})
+	}
+	if u.onChange != nil {
+		go u.onChange()
+	}
+	return err
+}
+
+func (u *Updater) executable() (string, error) {
+	if u.cfg.Executable != "" {
+		return u.cfg.Executable, nil
+	}
+	exe, err := os.Executable()
+	if err != nil {
+		return "", fmt.Errorf("failed to locate the running binary: %w", err)
+	}
+	return filepath.EvalSymlinks(exe)
+}
+
+func (u *Updater) statePath() string {
+	return filepath.Join(u.cfg.StateDir, "update-state.json")
+}
+
+func (u *Updater) loadState() (*updateState, error) {
+	data, err := os.ReadFile(u.statePath())
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to read update state: %w", err)
+	}
+	var state updateState
+	if err := json.Unmarshal(data, &state); err != nil {
+		return nil, fmt.Errorf("failed to decode update state: %w", err)
+	}
+	return &state, nil
+}
+
+func (u *Updater) saveState() error {
+	data, err := json.Marshal(u.state)
+	if err != nil {
+		return fmt.Errorf("failed to encode update state: %w", err)
+	}
+	return writeFile(u.statePath(), data, 0600)
+}
+
+// writeFile replaces path atomically
+func writeFile(path string, data []byte, perm os.FileMode) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return fmt.Errorf("failed to create %s: %w", filepath.Dir(path), err)
+	}
+	if err := os.WriteFile(path+".tmp", data, perm); err != nil {
+		return fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	if err := os.Rename(path+".tmp", path); err != nil {
+		return fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	return nil
+}
+
+// backup keeps a copy of path so restore can bring it back. A missing file is
+// backed up as an empty marker, which restore turns back into no file.
+func backup(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to read %s: %w", path, err)
+	}
+	return writeFile(path+".previous", data, 0600)
+}
+
+// restore brings back the copy of path made by backup
+func restore(path string) error {
+	data, err := os.ReadFile(path + ".previous")
+	if err != nil {
+		return fmt.Errorf("failed to read %s.previous: %w", path, err)
+	}
+	if len(data) == 0 {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return nil
+	}
+	return writeFile(path, data, 0600)
+}
+
+// restartProcess stops the satellite gracefully. Satellites run under a
+// supervisor (systemd, Docker) that starts them again.
+func restartProcess() {
+	if p, err := os.FindProcess(os.Getpid()); err == nil {
+		p.Signal(syscall.SIGTERM)
+	}
+}
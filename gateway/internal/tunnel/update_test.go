@@ -0,0 +1,197 @@
+package tunnel
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/VanCannon/openpam/gateway/internal/build"
+	"github.com/VanCannon/openpam/gateway/internal/models"
+	"github.com/VanCannon/openpam/pkg/logger"
+	"github.com/google/uuid"
+)
+
+// newTestUpdater creates an updater in a temporary directory whose restarts
+// are counted instead of exiting the test
+func newTestUpdater(t *testing.T, zoneID uuid.UUID) (*Updater, ed25519.PrivateKey, chan struct{}) {
+	pub, priv, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatalf("GenerateKey() error = %v", err)
+	}
+	dir := t.TempDir()
+	exe := filepath.Join(dir, "openpam")
+	if err := os.WriteFile(exe, []byte("current"), 0755); err != nil {
+		t.Fatalf("WriteFile() error = %v", err)
+	}
+
+	restarts := make(chan struct{}, 4)
+	u := NewUpdater(UpdaterConfig{
+		VerifyKey:     pub,
+		ZoneID:        zoneID,
+		ConfigPath:    filepath.Join(dir, "satellite-config.json"),
+		StateDir:      filepath.Join(dir, "update"),
+		Executable:    exe,
+		AutoUpdate:    true,
+		HealthTimeout: time.Minute,
+		Restart:       func() { restarts <- struct{}{} },
+	}, logger.New(logger.LevelError, io.Discard))
+	if err := u.Start(); err != nil {
+		t.Fatalf("Start() error = %v", err)
+	}
+	return u, priv, restarts
+}
+
+// restarted simulates the satellite restarting: a new updater over the same files
+func restarted(t *testing.T, u *Updater) *Updater {
+	next := NewUpdater(u.cfg, u.logger)
+	if err := next.Start(); err != nil {
+		t.Fatalf("Start() error = %v", err)
+	}
+	return next
+}
+
+func waitRestart(t *testing.T, restarts chan struct{}) {
+	select {
+	case <-restarts:
+	case <-time.After(2 * time.Second):
+		t.Fatal("satellite was not restarted")
+	}
+}
+
+func TestUpdater_ConfigRollback(t *testing.T) {
+	zoneID := uuid.New()
+	u, priv, restarts := newTestUpdater(t, zoneID)
+
+	payload, err := SignConfig(&ConfigDocument{ZoneID: zoneID, Revision: 1, Values: map[string]string{"OFFLINE_POLICY": "cached"}}, priv)
+	if err != nil {
+		t.Fatalf("SignConfig() error = %v", err)
+	}
+	if err := u.ApplyConfig(payload); err != nil {
+		t.Fatalf("ApplyConfig() error = %v", err)
+	}
+	waitRestart(t, restarts)
+
+	// The new configuration is loaded on start and must reach the hub
+	u = restarted(t, u)
+	if status := u.Status(); status.ConfigRevision != 1 || status.Update.State != models.UpdateStateApplying {
+		t.Fatalf("Status() = %+v, want revision 1 applying", status)
+	}
+
+	// Restarting again before reconnecting rolls the configuration back
+	u = restarted(t, u)
+	waitRestart(t, restarts)
+	u = restarted(t, u)
+	status := u.Status()
+	if status.ConfigRevision != 0 || status.Update.State != models.UpdateStateRolledBack {
+		t.Fatalf("Status() = %+v, want revision 0 rolled back", status)
+	}
+
+	// A revision that was rolled back is not installed again
+	if err := u.ApplyConfig(payload); err != nil {
+		t.Fatalf("ApplyConfig() error = %v", err)
+	}
+	select {
+	case <-restarts:
+		t.Error("rolled back config was installed again")
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func TestUpdater_ConfigRejectsOtherZones(t *testing.T) {
+	u, priv, _ := newTestUpdater(t, uuid.New())
+
+	payload, _ := SignConfig(&ConfigDocument{ZoneID: uuid.New(), Revision: 1}, priv)
+	if err := u.ApplyConfig(payload); err == nil {
+		t.Error("ApplyConfig() accepted another zone's config")
+	}
+}
+
+func TestUpdater_BinaryUpdate(t *testing.T) {
+	binary := []byte("new build")
+	sum := sha256.Sum256(binary)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(binary)
+	}))
+	defer server.Close()
+
+	u, priv, restarts := newTestUpdater(t, uuid.New())
+	manifest := &UpdateManifest{
+		RolloutID: uuid.New(),
+		Version:   build.Version,
+		URL:       server.URL,
+		SHA256:    hex.EncodeToString(sum[:]),
+		Size:      int64(len(binary)),
+	}
+
+	// The running version is already installed
+	payload, _ := SignManifest(manifest, priv)
+	if err := u.ApplyUpdate(context.Background(), payload); err != nil || u.Status().Update != nil {
+		t.Fatalf("ApplyUpdate() of the running version = %v, %+v", err, u.Status().Update)
+	}
+
+	manifest.Version = build.Version + "-next"
+	payload, _ = SignManifest(manifest, priv)
+	if err := u.ApplyUpdate(context.Background(), payload); err != nil {
+		t.Fatalf("ApplyUpdate() error = %v", err)
+	}
+	waitRestart(t, restarts)
+
+	exe := u.cfg.Executable
+	if data, _ := os.ReadFile(exe); string(data) != string(binary) {
+		t.Errorf("installed binary = %q, want %q", data, binary)
+	}
+
+	// This binary still reports the old version, so the health check fails
+	u = restarted(t, u)
+	u.Healthy()
+	waitRestart(t, restarts)
+	if data, _ := os.ReadFile(exe); string(data) != "current" {
+		t.Errorf("binary after rollback = %q, want the previous one", data)
+	}
+	if state := u.Status().Update; state.State != models.UpdateStateRolledBack || state.RolloutID != manifest.RolloutID {
+		t.Errorf("Update = %+v, want rolled back", state)
+	}
+}
+
+func TestUpdater_BinaryDigestMismatch(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("tampered"))
+	}))
+	defer server.Close()
+
+	u, priv, _ := newTestUpdater(t, uuid.New())
+	payload, _ := SignManifest(&UpdateManifest{
+		RolloutID: uuid.New(),
+		Version:   "9.9.9",
+		URL:       server.URL,
+		SHA256:    hex.EncodeToString(make([]byte, 32)),
+		Size:      int64(len("tampered")),
+	}, priv)
+
+	if err := u.ApplyUpdate(context.Background(), payload); err == nil {
+		t.Fatal("ApplyUpdate() installed a build with the wrong digest")
+	}
+	if data, _ := os.ReadFile(u.cfg.Executable); string(data) != "current" {
+		t.Errorf("binary = %q, want it untouched", data)
+	}
+	if state := u.Status().Update; state.State != models.UpdateStateFailed {
+		t.Errorf("Update = %+v, want failed", state)
+	}
+}
+
+func TestValidateConfigValues(t *testing.T) {
+	if err := ValidateConfigValues(map[string]string{"OFFLINE_POLICY": "deny", "WS_PING_INTERVAL": "10s"}); err != nil {
+		t.Errorf("ValidateConfigValues() error = %v", err)
+	}
+	if err := ValidateConfigValues(map[string]string{"POLICY_VERIFY_KEY": "x", "VAULT_TOKEN": "y"}); err == nil {
+		t.Error("ValidateConfigValues() accepted trust and secret settings")
+	}
+}
@@ -0,0 +1,423 @@
+// Package usage meters what each user and API key uses of the gateway per day
+// (UTC): API calls, sessions started and bytes proxied. Counts are kept in
+// memory and added to the daily aggregates in the database every interval.
+// Quotas refuse use past their daily limit and alert as it gets close.
+package usage
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/VanCannon/openpam/gateway/internal/middleware"
+	"github.com/VanCannon/openpam/gateway/internal/models"
+	"github.com/VanCannon/openpam/gateway/internal/notify"
+	"github.com/VanCannon/openpam/gateway/internal/worker"
+	"github.com/VanCannon/openpam/pkg/logger"
+	"github.com/google/uuid"
+)
+
+// Store persists daily usage and quotas
+type Store interface {
+	Add(ctx context.Context, usage []*models.Usage) error
+	Day(ctx context.Context, day time.Time) ([]*models.Usage, error)
+	ListQuotas(ctx context.Context) ([]*models.UsageQuota, error)
+	MarkAlerted(ctx context.Context, id uuid.UUID, day time.Time) (bool, error)
+}
+
+// AuditStore records events in the system audit log
+type AuditStore interface {
+	CreateSimple(ctx context.Context, eventType string, userID *uuid.UUID, action string, status string, ipAddress *string, details map[string]interface{}) error
+}
+
+// UserStore looks up who is alerted about their quotas
+type UserStore interface {
+	GetByID(ctx context.Context, id uuid.UUID) (*models.User, error)
+}
+
+// Config holds how often usage is stored and who hears about quotas
+type Config struct {
+	Interval        time.Duration // How often counts are stored and quotas reloaded
+	AlertRecipients []string      // Emailed, besides the user, when usage nears a quota
+}
+
+// account is who used something on a day: a user, with one of their API keys
+// or uuid.Nil when signed in
+type account struct {
+	day    string
+	user   uuid.UUID
+	apiKey uuid.UUID
+}
+
+// Meter counts usage and enforces quotas
+type Meter struct {
+	store    Store
+	audit    AuditStore
+	users    UserStore
+	notifier notify.Notifier
+	config   Config
+	logger   *logger.Logger
+
+	mu       sync.Mutex
+	pending  map[account]*models.Usage // Not yet stored
+	flushing map[account]*models.Usage // Being stored
+	stored   map[account]*models.Usage // Today's usage as of the last flush, from every gateway
+	quotas   []*models.UsageQuota
+	now      func() time.Time
+
+	loop worker.Loop
+}
+
+// New creates a meter
+func New(store Store, audit AuditStore, users UserStore, notifier notify.Notifier, cfg Config, log *logger.Logger) *Meter {
+	if cfg.Interval <= 0 {
+		cfg.Interval = 30 * time.Second
+	}
+	return &Meter{
+		store:    store,
+		audit:    audit,
+		users:    users,
+		notifier: notifier,
+		config:   cfg,
+		logger:   log,
+		pending:  make(map[account]*models.Usage),
+		stored:   make(map[account]*models.Usage),
+		now:      time.Now,
+	}
+}
+
+// Start stores counts in the background until Stop is called
+func (m *Meter) Start() {
+	m.loop.Start(m.run)
+}
+
+// Stop stops the meter once the last counts are stored. It is safe to call
+// even if the meter was never started.
+func (m *Meter) Stop() {
+	m.loop.Stop()
+}
+
+func (m *Meter) run() {
+	ticker := time.NewTicker(m.config.Interval)
+	defer ticker.Stop()
+
+	for {
+		m.Flush()
+
+		select {
+		case <-m.loop.Stopping():
+			m.Flush()
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// day returns the UTC day of t as a key and a date
+func day(t time.Time) (string, time.Time) {
+	t = t.UTC()
+	return t.Format(time.DateOnly), time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+}
+
+// Flush stores the counts since the last flush, then reloads today's usage
+// and the quotas and sends the alerts due
+func (m *Meter) Flush() {
+	ctx, cancel := context.WithTimeout(context.Background(), m.config.Interval)
+	defer cancel()
+
+	// Counts being stored still count against quotas until today's usage is
+	// reloaded with them
+	m.mu.Lock()
+	pending := m.pending
+	m.pending = make(map[account]*models.Usage)
+	m.flushing = pending
+	m.mu.Unlock()
+
+	if len(pending) > 0 {
+		usage := make([]*models.Usage, 0, len(pending))
+		for _, u := range pending {
+			usage = append(usage, u)
+		}
+		if err := m.store.Add(ctx, usage); err != nil {
+			m.logger.Error("Failed to store usage", map[string]interface{}{
+				"error": err.Error(),
+			})
+			// Kept for the next flush
+			m.settle(pending, true)
+			return
+		}
+	}
+
+	today, date := day(m.now())
+	usage, err := m.store.Day(ctx, date)
+	if err != nil {
+		m.logger.Error("Failed to load today's usage", map[string]interface{}{
+			"error": err.Error(),
+		})
+		m.settle(pending, false)
+		return
+	}
+	quotas, err := m.store.ListQuotas(ctx)
+	if err != nil {
+		m.logger.Error("Failed to load usage quotas", map[string]interface{}{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	stored := make(map[account]*models.Usage, len(usage))
+	for _, u := range usage {
+		acct := account{day: today, user: u.UserID}
+		if u.APIKeyID != nil {
+			acct.apiKey = *u.APIKeyID
+		}
+		stored[acct] = u
+	}
+
+	m.mu.Lock()
+	m.stored = stored
+	m.flushing = nil
+	m.quotas = quotas
+	m.mu.Unlock()
+
+	m.alert(ctx, today, date)
+}
+
+// settle moves the counts that were being stored back to the pending ones,
+// or to the stored ones if they were stored
+func (m *Meter) settle(flushing map[account]*models.Usage, toPending bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	counts := m.stored
+	if toPending {
+		counts = m.pending
+	}
+	for acct, u := range flushing {
+		if total, ok := counts[acct]; ok {
+			total.Add(u)
+		} else {
+			counts[acct] = u
+		}
+	}
+	m.flushing = nil
+}
+
+// Reload reloads the quotas after they were changed
+func (m *Meter) Reload(ctx context.Context) error {
+	quotas, err := m.store.ListQuotas(ctx)
+	if err != nil {
+		return err
+	}
+	m.mu.Lock()
+	m.quotas = quotas
+	m.mu.Unlock()
+	return nil
+}
+
+// count applies add to the pending usage of acct. m.mu must be held.
+func (m *Meter) count(acct account, add func(u *models.Usage)) {
+	u, ok := m.pending[acct]
+	if !ok {
+		date, _ := time.Parse(time.DateOnly, acct.day)
+		u = &models.Usage{Day: date, UserID: acct.user}
+		if acct.apiKey != uuid.Nil {
+			apiKey := acct.apiKey
+			u.APIKeyID = &apiKey
+		}
+		m.pending[acct] = u
+	}
+	add(u)
+}
+
+// used returns today's usage of metric that quota covers. m.mu must be held.
+func (m *Meter) used(today string, quota *models.UsageQuota) int64 {
+	var total int64
+	for _, counts := range []map[account]*models.Usage{m.stored, m.flushing, m.pending} {
+		for acct, u := range counts {
+			if acct.day == today && quota.Covers(acct.user, acct.apiKey) {
+				total += u.Value(quota.Metric)
+			}
+		}
+	}
+	return total
+}
+
+// exceeded returns the first of metrics whose quota for the user and key
+// has been reached today, or nil
+func (m *Meter) exceeded(userID, apiKeyID uuid.UUID, metrics ...string) *models.UsageQuota {
+	today, _ := day(m.now())
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, quota := range m.quotas {
+		for _, metric := range metrics {
+			if quota.Metric == metric && quota.Covers(userID, apiKeyID) && m.used(today, quota) >= quota.DailyLimit {
+				return quota
+			}
+		}
+	}
+	return nil
+}
+
+// APICall counts an API call. It reports false, counting nothing, if a quota
+// on API calls has been reached.
+func (m *Meter) APICall(userID, apiKeyID uuid.UUID) bool {
+	if m.exceeded(userID, apiKeyID, models.UsageMetricAPICalls) != nil {
+		return false
+	}
+	m.record(userID, apiKeyID, func(u *models.Usage) { u.APICalls++ })
+	return true
+}
+
+// AllowSession reports whether a session may start, which it can't once a
+// quota on sessions or bytes has been reached
+func (m *Meter) AllowSession(userID, apiKeyID uuid.UUID) bool {
+	return m.exceeded(userID, apiKeyID, models.UsageMetricSessions, models.UsageMetricBytes) == nil
+}
+
+// SessionStarted counts a session
+func (m *Meter) SessionStarted(userID, apiKeyID uuid.UUID) {
+	m.record(userID, apiKeyID, func(u *models.Usage) { u.Sessions++ })
+}
+
+// Proxied counts the bytes of a session, on the day it ended
+func (m *Meter) Proxied(userID, apiKeyID uuid.UUID, sent, received int64) {
+	m.record(userID, apiKeyID, func(u *models.Usage) {
+		u.BytesSent += sent
+		u.BytesReceived += received
+	})
+}
+
+func (m *Meter) record(userID, apiKeyID uuid.UUID, add func(u *models.Usage)) {
+	today, _ := day(m.now())
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.count(account{day: today, user: userID, apiKey: apiKeyID}, add)
+}
+
+// Middleware counts the calls of authenticated users and refuses them with
+// 429 Too Many Requests once their quota is reached, until the next day
+func (m *Meter) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		userID, apiKeyID, ok := Caller(r.Context())
+		if ok && !m.APICall(userID, apiKeyID) {
+			w.Header().Set("Retry-After", strconv.Itoa(m.untilTomorrow()))
+			http.Error(w, "Daily API call quota reached", http.StatusTooManyRequests)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// untilTomorrow returns the seconds until quotas reset
+func (m *Meter) untilTomorrow() int {
+	_, today := day(m.now())
+	return int(today.AddDate(0, 0, 1).Sub(m.now()).Seconds()) + 1
+}
+
+// Caller returns the authenticated user of ctx and their API key, uuid.Nil
+// when signed in
+func Caller(ctx context.Context) (uuid.UUID, uuid.UUID, bool) {
+	userID, err := uuid.Parse(middleware.GetUserID(ctx))
+	if err != nil {
+		return uuid.Nil, uuid.Nil, false
+	}
+	apiKeyID, _ := uuid.Parse(middleware.GetAPIKeyID(ctx))
+	return userID, apiKeyID, true
+}
+
+// alert sends the alerts of the quotas whose usage reached their alert
+// threshold today, once a day each
+func (m *Meter) alert(ctx context.Context, today string, date time.Time) {
+	type due struct {
+		quota *models.UsageQuota
+		used  int64
+	}
+
+	var alerts []due
+	m.mu.Lock()
+	for _, quota := range m.quotas {
+		if quota.AlertedOn != nil && !quota.AlertedOn.Before(date) {
+			continue
+		}
+		if used := m.used(today, quota); used >= quota.AlertAt() {
+			alerts = append(alerts, due{quota, used})
+		}
+	}
+	m.mu.Unlock()
+
+	for _, a := range alerts {
+		// Another gateway may have sent it already
+		marked, err := m.store.MarkAlerted(ctx, a.quota.ID, date)
+		if err != nil {
+			m.logger.Error("Failed to mark usage quota alerted", map[string]interface{}{
+				"quota_id": a.quota.ID.String(),
+				"error":    err.Error(),
+			})
+			continue
+		}
+		if !marked {
+			continue
+		}
+		alertedOn := date
+		a.quota.AlertedOn = &alertedOn
+		m.send(ctx, a.quota, a.used)
+	}
+}
+
+// send records and emails an alert about a quota
+func (m *Meter) send(ctx context.Context, quota *models.UsageQuota, used int64) {
+	details := map[string]interface{}{
+		"quota_id":    quota.ID.String(),
+		"metric":      quota.Metric,
+		"used":        used,
+		"daily_limit": quota.DailyLimit,
+	}
+	scope := "all usage"
+	if quota.APIKeyID != nil {
+		details["api_key_id"] = quota.APIKeyID.String()
+		scope = "API key " + quota.APIKeyID.String()
+	}
+	userID := quota.UserID
+	if err := m.audit.CreateSimple(ctx, models.EventTypeUsageQuota, &userID, "quota_alert", models.AuditStatusSuccess, nil, details); err != nil {
+		m.logger.Error("Failed to audit usage quota alert", map[string]interface{}{
+			"quota_id": quota.ID.String(),
+			"error":    err.Error(),
+		})
+	}
+
+	recipients := append([]string{}, m.config.AlertRecipients...)
+	if user, err := m.users.GetByID(ctx, quota.UserID); err == nil && user.Email != "" {
+		recipients = append(recipients, user.Email)
+	}
+	if len(recipients) == 0 {
+		return
+	}
+
+	state := "is nearing"
+	if used >= quota.DailyLimit {
+		state = "has reached"
+	}
+	var body strings.Builder
+	fmt.Fprintf(&body, "Today's usage of %s for %s %s its daily quota.\n\n", quota.Metric, scope, state)
+	fmt.Fprintf(&body, "Used: %d of %d (alert at %d%%)\n", used, quota.DailyLimit, quota.AlertPercent)
+	fmt.Fprintf(&body, "Quotas reset at midnight UTC. Requests past the limit are refused until then.\n")
+
+	msg := &notify.Message{
+		To:      recipients,
+		Subject: fmt.Sprintf("OpenPAM: %s quota at %d%%", quota.Metric, used*100/quota.DailyLimit),
+		Body:    body.String(),
+	}
+	if err := m.notifier.Send(ctx, msg); err != nil {
+		m.logger.Error("Failed to send usage quota alert", map[string]interface{}{
+			"quota_id": quota.ID.String(),
+			"error":    err.Error(),
+		})
+	}
+}
@@ -0,0 +1,188 @@
+package usage
+
+import (
+	"context"
+	"errors"
+	"io"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/VanCannon/openpam/gateway/internal/models"
+	"github.com/VanCannon/openpam/gateway/internal/notify"
+	"github.com/VanCannon/openpam/pkg/logger"
+	"github.com/google/uuid"
+)
+
+// fakeStore keeps usage the way the repository adds it up
+type fakeStore struct {
+	mu      sync.Mutex
+	usage   map[account]*models.Usage
+	quotas  []*models.UsageQuota
+	failAdd bool
+}
+
+func (s *fakeStore) Add(ctx context.Context, usage []*models.Usage) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.failAdd {
+		return errors.New("database unavailable")
+	}
+	for _, u := range usage {
+		acct := account{day: u.Day.Format(time.DateOnly), user: u.UserID}
+		if u.APIKeyID != nil {
+			acct.apiKey = *u.APIKeyID
+		}
+		if total, ok := s.usage[acct]; ok {
+			total.Add(u)
+		} else {
+			copied := *u
+			s.usage[acct] = &copied
+		}
+	}
+	return nil
+}
+
+func (s *fakeStore) Day(ctx context.Context, day time.Time) ([]*models.Usage, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var usage []*models.Usage
+	for acct, u := range s.usage {
+		if acct.day == day.Format(time.DateOnly) {
+			copied := *u
+			usage = append(usage, &copied)
+		}
+	}
+	return usage, nil
+}
+
+func (s *fakeStore) ListQuotas(ctx context.Context) ([]*models.UsageQuota, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var quotas []*models.UsageQuota
+	for _, q := range s.quotas {
+		copied := *q
+		quotas = append(quotas, &copied)
+	}
+	return quotas, nil
+}
+
+func (s *fakeStore) MarkAlerted(ctx context.Context, id uuid.UUID, day time.Time) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, q := range s.quotas {
+		if q.ID == id && (q.AlertedOn == nil || q.AlertedOn.Before(day)) {
+			q.AlertedOn = &day
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+type fakeAudit struct{ events []string }
+
+func (a *fakeAudit) CreateSimple(ctx context.Context, eventType string, userID *uuid.UUID, action string, status string, ipAddress *string, details map[string]interface{}) error {
+	a.events = append(a.events, eventType)
+	return nil
+}
+
+type fakeUsers struct{}
+
+func (fakeUsers) GetByID(ctx context.Context, id uuid.UUID) (*models.User, error) {
+	return &models.User{ID: id, Email: "user@example.com"}, nil
+}
+
+type fakeNotifier struct{ sent []*notify.Message }
+
+func (n *fakeNotifier) Send(ctx context.Context, msg *notify.Message) error {
+	n.sent = append(n.sent, msg)
+	return nil
+}
+
+func newMeter(store *fakeStore) (*Meter, *fakeAudit, *fakeNotifier) {
+	audit, notifier := &fakeAudit{}, &fakeNotifier{}
+	m := New(store, audit, fakeUsers{}, notifier, Config{Interval: time.Second}, logger.New(logger.LevelError, io.Discard))
+	return m, audit, notifier
+}
+
+func TestMeter_APICallQuota(t *testing.T) {
+	userID, apiKeyID := uuid.New(), uuid.New()
+	store := &fakeStore{
+		usage:  map[account]*models.Usage{},
+		quotas: []*models.UsageQuota{{ID: uuid.New(), UserID: userID, APIKeyID: &apiKeyID, Metric: models.UsageMetricAPICalls, DailyLimit: 5, AlertPercent: 80}},
+	}
+	m, audit, notifier := newMeter(store)
+	m.Flush()
+
+	for i := 0; i < 5; i++ {
+		if !m.APICall(userID, apiKeyID) {
+			t.Fatalf("call %d refused under the quota", i+1)
+		}
+	}
+	if m.APICall(userID, apiKeyID) {
+		t.Error("call past the quota allowed")
+	}
+	if !m.APICall(userID, uuid.Nil) {
+		t.Error("call signed in refused by the API key's quota")
+	}
+
+	// The limit holds once the calls are stored, and alerts are sent once
+	m.Flush()
+	m.Flush()
+	if m.APICall(userID, apiKeyID) {
+		t.Error("call past the quota allowed after a flush")
+	}
+	if len(notifier.sent) != 1 || len(audit.events) != 1 {
+		t.Errorf("sent %d alerts and audited %v, want 1", len(notifier.sent), audit.events)
+	}
+
+	today, _ := day(time.Now())
+	stored := store.usage[account{day: today, user: userID, apiKey: apiKeyID}]
+	if stored == nil || stored.APICalls != 5 {
+		t.Errorf("stored %+v, want 5 calls", stored)
+	}
+}
+
+func TestMeter_SessionQuotas(t *testing.T) {
+	userID := uuid.New()
+	store := &fakeStore{
+		usage: map[account]*models.Usage{},
+		quotas: []*models.UsageQuota{
+			{ID: uuid.New(), UserID: userID, Metric: models.UsageMetricSessions, DailyLimit: 2, AlertPercent: 100},
+			{ID: uuid.New(), UserID: userID, Metric: models.UsageMetricBytes, DailyLimit: 1000, AlertPercent: 100},
+		},
+	}
+	m, _, _ := newMeter(store)
+	m.Flush()
+
+	// A user's quota covers their API keys too
+	m.SessionStarted(userID, uuid.New())
+	if !m.AllowSession(userID, uuid.Nil) {
+		t.Fatal("session refused under the quotas")
+	}
+	m.Proxied(userID, uuid.Nil, 600, 400)
+	if m.AllowSession(userID, uuid.Nil) {
+		t.Error("session allowed past the bytes quota")
+	}
+	if !m.AllowSession(uuid.New(), uuid.Nil) {
+		t.Error("another user's session refused")
+	}
+}
+
+func TestMeter_KeepsCountsStoreRefused(t *testing.T) {
+	userID := uuid.New()
+	store := &fakeStore{usage: map[account]*models.Usage{}, failAdd: true}
+	m, _, _ := newMeter(store)
+
+	m.APICall(userID, uuid.Nil)
+	m.Flush()
+
+	store.failAdd = false
+	m.APICall(userID, uuid.Nil)
+	m.Flush()
+
+	today, _ := day(time.Now())
+	if stored := store.usage[account{day: today, user: userID}]; stored == nil || stored.APICalls != 2 {
+		t.Errorf("stored %+v, want 2 calls", stored)
+	}
+}
@@ -0,0 +1,52 @@
+package validate
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// Limits caps the size of request bodies by route class
+type Limits struct {
+	Default int64            // Bytes allowed on routes without a class of their own
+	Routes  map[string]int64 // Bytes allowed under each path prefix; the longest match wins
+}
+
+// Validate checks that every limit is positive
+func (l Limits) Validate() error {
+	if l.Default <= 0 {
+		return fmt.Errorf("default body limit must be positive")
+	}
+	for prefix, limit := range l.Routes {
+		if limit <= 0 {
+			return fmt.Errorf("body limit for %s must be positive", prefix)
+		}
+	}
+	return nil
+}
+
+// For returns the body limit of path
+func (l Limits) For(path string) int64 {
+	limit, matched := l.Default, ""
+	for prefix, routeLimit := range l.Routes {
+		if strings.HasPrefix(path, prefix) && len(prefix) > len(matched) {
+			limit, matched = routeLimit, prefix
+		}
+	}
+	return limit
+}
+
+// Middleware caps each request body at its route's limit. Reading past it
+// fails, which Decode reports as 413 Payload Too Large.
+func (l Limits) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.ContentLength > l.For(r.URL.Path) {
+			WriteProblem(w, r, http.StatusRequestEntityTooLarge, "payload_too_large", nil)
+			return
+		}
+		if r.Body != nil && r.Body != http.NoBody {
+			r.Body = http.MaxBytesReader(w, r.Body, l.For(r.URL.Path))
+		}
+		next.ServeHTTP(w, r)
+	})
+}
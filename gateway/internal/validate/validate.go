@@ -0,0 +1,200 @@
+// Package validate decodes JSON request bodies strictly and checks them.
+// Bodies are capped by route class, unknown fields are refused, and every
+// invalid field is reported at once in an RFC 7807 problem response.
+package validate
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/VanCannon/openpam/gateway/internal/i18n"
+	"github.com/VanCannon/openpam/pkg/recovery"
+)
+
+// FieldError is the problem with one field of a request body, or with the
+// whole body when Field is empty
+type FieldError struct {
+	Field   string `json:"field,omitempty"`
+	Message string `json:"message"`
+}
+
+// Errors collects the problems of a request body
+type Errors []FieldError
+
+// Add reports a problem with field
+func (e *Errors) Add(field, message string) {
+	*e = append(*e, FieldError{Field: field, Message: message})
+}
+
+// Check reports message for field unless ok
+func (e *Errors) Check(ok bool, field, message string) {
+	if !ok {
+		e.Add(field, message)
+	}
+}
+
+// Required reports field if value is blank
+func (e *Errors) Required(field, value string) {
+	e.Check(strings.TrimSpace(value) != "", field, "is required")
+}
+
+// MaxLength reports field if value is longer than max characters
+func (e *Errors) MaxLength(field, value string, max int) {
+	e.Check(len([]rune(value)) <= max, field, fmt.Sprintf("must be at most %d characters", max))
+}
+
+// OneOf reports field unless value is one of allowed
+func (e *Errors) OneOf(field, value string, allowed ...string) {
+	for _, a := range allowed {
+		if value == a {
+			return
+		}
+	}
+	e.Add(field, "must be one of "+strings.Join(allowed, ", "))
+}
+
+// Range reports field unless min <= value <= max
+func (e *Errors) Range(field string, value, min, max int) {
+	e.Check(value >= min && value <= max, field, fmt.Sprintf("must be between %d and %d", min, max))
+}
+
+func (e Errors) Error() string {
+	parts := make([]string, len(e))
+	for i, fe := range e {
+		parts[i] = fe.Field + " " + fe.Message
+	}
+	return strings.Join(parts, "; ")
+}
+
+// Validator is implemented by request bodies that check their own fields.
+// Validate returns nil when the body is valid.
+type Validator interface {
+	Validate() Errors
+}
+
+// Problem is the response to a rejected request body, with the problem of
+// each invalid field
+type Problem struct {
+	recovery.Problem
+	Errors Errors `json:"errors,omitempty"`
+}
+
+// Decode reads the JSON body of r into v. Unknown fields, trailing data and
+// bodies over the route's limit are refused, and v is validated if it is a
+// Validator. On failure the problem is written to w and false returned.
+func Decode(w http.ResponseWriter, r *http.Request, v interface{}) bool {
+	return decode(w, r, v, false)
+}
+
+// DecodeOptional is Decode for endpoints whose body may be left out; an empty
+// body leaves v as it is
+func DecodeOptional(w http.ResponseWriter, r *http.Request, v interface{}) bool {
+	return decode(w, r, v, true)
+}
+
+func decode(w http.ResponseWriter, r *http.Request, v interface{}, optional bool) bool {
+	dec := json.NewDecoder(r.Body)
+	dec.DisallowUnknownFields()
+
+	err := dec.Decode(v)
+	if err == nil {
+		// Anything but whitespace after the value is refused
+		if _, trailing := dec.Token(); trailing != io.EOF {
+			err = errors.New("unexpected data after the JSON value")
+		}
+	}
+	if err == io.EOF && optional {
+		err = nil
+	}
+	if err != nil {
+		writeDecodeError(w, r, err)
+		return false
+	}
+
+	if validator, ok := v.(Validator); ok {
+		if errs := validator.Validate(); len(errs) > 0 {
+			WriteProblem(w, r, http.StatusBadRequest, "validation_failed", errs)
+			return false
+		}
+	}
+	return true
+}
+
+// writeDecodeError explains why a body couldn't be decoded, naming the field
+// where it can
+func writeDecodeError(w http.ResponseWriter, r *http.Request, err error) {
+	var tooLarge *http.MaxBytesError
+	var typeErr *json.UnmarshalTypeError
+
+	switch {
+	case errors.As(err, &tooLarge):
+		WriteProblem(w, r, http.StatusRequestEntityTooLarge, "payload_too_large", nil)
+	case errors.As(err, &typeErr) && typeErr.Field != "":
+		WriteProblem(w, r, http.StatusBadRequest, "validation_failed", Errors{{Field: typeErr.Field, Message: "must be " + article(typeErr.Type.Kind().String())}})
+	case strings.HasPrefix(err.Error(), "json: unknown field "):
+		field := strings.Trim(strings.TrimPrefix(err.Error(), "json: unknown field "), `"`)
+		WriteProblem(w, r, http.StatusBadRequest, "validation_failed", Errors{{Field: field, Message: "is not a known field"}})
+	default:
+		WriteProblem(w, r, http.StatusBadRequest, "invalid_request_body", Errors{{Message: describeSyntax(err)}})
+	}
+}
+
+// describeSyntax turns a decoding error into a message without Go's "json: " prefix
+func describeSyntax(err error) string {
+	if err == io.EOF {
+		return "body is empty"
+	}
+	if errors.Is(err, io.ErrUnexpectedEOF) {
+		return "body ends before the JSON value does"
+	}
+	return strings.TrimPrefix(err.Error(), "json: ")
+}
+
+// article names a JSON kind for field messages, e.g. "a string"
+func article(kind string) string {
+	switch kind {
+	case "slice", "array":
+		return "an array"
+	case "map", "struct":
+		return "an object"
+	case "bool":
+		return "a boolean"
+	case "string":
+		return "a string"
+	case "int", "int8", "int16", "int32", "int64", "uint", "uint8", "uint16", "uint32", "uint64":
+		return "an integer"
+	case "float32", "float64":
+		return "a number"
+	}
+	return "a " + kind
+}
+
+// WriteProblem writes a problem+json response with code as its localized
+// detail and the field errors, if any
+func WriteProblem(w http.ResponseWriter, r *http.Request, status int, code string, errs Errors) {
+	locale := i18n.FromRequest(r)
+
+	h := w.Header()
+	h.Set("Content-Type", "application/problem+json")
+	h.Set(i18n.CodeHeader, code)
+	h.Set("Content-Language", locale)
+	h.Add("Vary", "Accept-Language")
+	w.WriteHeader(status)
+
+	json.NewEncoder(w).Encode(Problem{
+		Problem: recovery.Problem{
+			Type:      "about:blank",
+			Code:      code,
+			Title:     i18n.Text(locale, i18n.StatusCode(status)),
+			Status:    status,
+			Detail:    i18n.Text(locale, code),
+			Instance:  r.URL.Path,
+			RequestID: recovery.RequestIDFromContext(r.Context()),
+		},
+		Errors: errs,
+	})
+}
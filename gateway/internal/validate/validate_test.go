@@ -0,0 +1,138 @@
+package validate
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+type createRequest struct {
+	Name string `json:"name"`
+	Port int    `json:"port"`
+}
+
+func (req *createRequest) Validate() Errors {
+	var errs Errors
+	errs.Required("name", req.Name)
+	errs.Range("port", req.Port, 1, 65535)
+	return errs
+}
+
+func decodeBody(t *testing.T, body string, optional bool) (*httptest.ResponseRecorder, *Problem, bool) {
+	t.Helper()
+	r := httptest.NewRequest(http.MethodPost, "/api/v1/targets", strings.NewReader(body))
+	w := httptest.NewRecorder()
+
+	var req createRequest
+	var ok bool
+	if optional {
+		ok = DecodeOptional(w, r, &req)
+	} else {
+		ok = Decode(w, r, &req)
+	}
+	if ok {
+		return w, nil, true
+	}
+
+	var problem Problem
+	if err := json.NewDecoder(w.Body).Decode(&problem); err != nil {
+		t.Fatalf("problem body: %v", err)
+	}
+	return w, &problem, false
+}
+
+func TestDecode(t *testing.T) {
+	tests := []struct {
+		name     string
+		body     string
+		optional bool
+		status   int
+		code     string
+		fields   []string
+	}{
+		{name: "valid", body: `{"name":"db","port":22}`},
+		{name: "field errors", body: `{"name":" ","port":0}`, status: 400, code: "validation_failed", fields: []string{"name", "port"}},
+		{name: "unknown field", body: `{"name":"db","port":22,"colour":"red"}`, status: 400, code: "validation_failed", fields: []string{"colour"}},
+		{name: "wrong type", body: `{"name":"db","port":"22"}`, status: 400, code: "validation_failed", fields: []string{"port"}},
+		{name: "syntax", body: `{"name":`, status: 400, code: "invalid_request_body", fields: []string{""}},
+		{name: "trailing data", body: `{"name":"db","port":22} {}`, status: 400, code: "invalid_request_body", fields: []string{""}},
+		{name: "empty", body: ``, status: 400, code: "invalid_request_body", fields: []string{""}},
+		{name: "empty optional", body: ``, optional: true, status: 400, code: "validation_failed", fields: []string{"name", "port"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w, problem, ok := decodeBody(t, tt.body, tt.optional)
+			if tt.status == 0 {
+				if !ok {
+					t.Fatalf("Decode() refused a valid body: %+v", problem)
+				}
+				return
+			}
+			if ok {
+				t.Fatal("Decode() accepted an invalid body")
+			}
+			if w.Code != tt.status || problem.Code != tt.code {
+				t.Errorf("got %d %s, want %d %s", w.Code, problem.Code, tt.status, tt.code)
+			}
+			if ct := w.Header().Get("Content-Type"); ct != "application/problem+json" {
+				t.Errorf("Content-Type = %q", ct)
+			}
+			if len(problem.Errors) != len(tt.fields) {
+				t.Fatalf("errors = %+v, want fields %v", problem.Errors, tt.fields)
+			}
+			for i, field := range tt.fields {
+				if problem.Errors[i].Field != field || problem.Errors[i].Message == "" {
+					t.Errorf("error %d = %+v, want field %q", i, problem.Errors[i], field)
+				}
+			}
+		})
+	}
+}
+
+func TestLimits(t *testing.T) {
+	limits := Limits{
+		Default: 32,
+		Routes:  map[string]int64{"/api/v1/auth/": 16, "/api/v1/auth/token": 64},
+	}
+
+	if got := limits.For("/api/v1/auth/token"); got != 64 {
+		t.Errorf("For(token) = %d, want the longest prefix's 64", got)
+	}
+	if got := limits.For("/api/v1/targets"); got != 32 {
+		t.Errorf("For(targets) = %d, want the default", got)
+	}
+
+	handler := limits.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req createRequest
+		if Decode(w, r, &req) {
+			w.WriteHeader(http.StatusNoContent)
+		}
+	}))
+
+	tests := []struct {
+		path   string
+		body   string
+		status int
+	}{
+		{"/api/v1/targets", `{"name":"db","port":22}`, http.StatusNoContent},
+		{"/api/v1/targets", `{"name":"` + strings.Repeat("x", 40) + `","port":22}`, http.StatusRequestEntityTooLarge},
+		{"/api/v1/auth/login", `{"name":"db","port":22}`, http.StatusRequestEntityTooLarge},
+	}
+	for _, tt := range tests {
+		// Without a length the cap applies while the body is read
+		r := httptest.NewRequest(http.MethodPost, tt.path, strings.NewReader(tt.body))
+		r.ContentLength = -1
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		if w.Code != tt.status {
+			t.Errorf("POST %s with %d bytes = %d, want %d", tt.path, len(tt.body), w.Code, tt.status)
+		}
+	}
+
+	if err := (Limits{Default: 1, Routes: map[string]int64{"/x": 0}}).Validate(); err == nil {
+		t.Error("Validate() accepted a zero limit")
+	}
+}
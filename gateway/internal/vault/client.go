@@ -3,6 +3,7 @@ package vault
 import (
 	"context"
 	"fmt"
+	"strings"
 	"time"
 
 	vault "github.com/hashicorp/vault/api"
@@ -24,9 +25,10 @@ type Config struct {
 
 // Credentials represents retrieved credentials from Vault
 type Credentials struct {
-	Username   string
-	Password   string
-	PrivateKey string
+	Username    string
+	Password    string
+	PrivateKey  string
+	Certificate string // PEM client certificate for smart card logon, with PrivateKey as its key
 }
 
 // New creates a new Vault client
@@ -114,6 +116,10 @@ func (c *Client) GetCredentials(ctx context.Context, path string) (*Credentials,
 		creds.PrivateKey = privateKey
 	}
 
+	if certificate, ok := data["certificate"].(string); ok {
+		creds.Certificate = certificate
+	}
+
 	// Validate that we got at least username and either password or private key
 	if creds.Username == "" {
 		return nil, fmt.Errorf("username not found in secret")
@@ -126,6 +132,34 @@ func (c *Client) GetCredentials(ctx context.Context, path string) (*Credentials,
 	return creds, nil
 }
 
+// PutCredentials writes credentials to Vault at the specified path, replacing
+// the secret there. Paths of a KV v2 engine ("secret/data/...") get their fields
+// nested under "data", as GetCredentials expects.
+func (c *Client) PutCredentials(ctx context.Context, path string, creds *Credentials) error {
+	data := map[string]interface{}{
+		"username": creds.Username,
+	}
+	if creds.Password != "" {
+		data["password"] = creds.Password
+	}
+	if creds.PrivateKey != "" {
+		data["private_key"] = creds.PrivateKey
+	}
+	if creds.Certificate != "" {
+		data["certificate"] = creds.Certificate
+	}
+
+	if strings.Contains(path, "/data/") {
+		data = map[string]interface{}{"data": data}
+	}
+
+	if _, err := c.client.Logical().WriteWithContext(ctx, path, data); err != nil {
+		return fmt.Errorf("failed to write secret: %w", err)
+	}
+
+	return nil
+}
+
 // HealthCheck verifies the Vault connection is healthy
 func (c *Client) HealthCheck(ctx context.Context) error {
 	health, err := c.client.Sys().HealthWithContext(ctx)
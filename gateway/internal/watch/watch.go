@@ -0,0 +1,540 @@
+// Package watch evaluates the watch rules admins define over the audit event
+// stream, such as "more than three failed logins in five minutes" or "any
+// session to a PCI target outside business hours", and carries out their
+// actions when they fire: notifying, opening an investigation or disabling the
+// user.
+package watch
+
+import (
+	"context"
+	"encoding/json"
+	"expvar"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/VanCannon/openpam/gateway/internal/events"
+	"github.com/VanCannon/openpam/gateway/internal/models"
+	"github.com/VanCannon/openpam/gateway/internal/notify"
+	"github.com/VanCannon/openpam/gateway/internal/worker"
+	"github.com/VanCannon/openpam/pkg/logger"
+	"github.com/google/uuid"
+)
+
+const (
+	// cursorName identifies the engine's position in the event log
+	cursorName = "watch"
+
+	// batchSize is how many events are read from the event log at a time
+	batchSize = 200
+)
+
+// Published at /api/v1/admin/metrics
+var alertsRaised = expvar.NewInt("watch_alerts_raised")
+
+// Config holds how often the event log is checked
+type Config struct {
+	Interval time.Duration
+}
+
+// EventSource is the subset of the event repository the engine needs
+type EventSource interface {
+	ListSince(ctx context.Context, afterID int64, limit int) ([]*models.Event, error)
+	LatestID(ctx context.Context) (int64, error)
+}
+
+// CursorStore keeps the engine's position in the event log
+type CursorStore interface {
+	Advance(ctx context.Context, name string, fn func(lastID int64) (int64, error)) (bool, error)
+}
+
+// Store is the subset of the watch repository the engine needs
+type Store interface {
+	ListEnabled(ctx context.Context) ([]*models.WatchRule, error)
+	Hit(ctx context.Context, ruleID uuid.UUID, groupKey string, eventID int64, at, since time.Time, threshold int) (int, error)
+	PruneHits(ctx context.Context, cutoff time.Time) (int64, error)
+	CreateAlert(ctx context.Context, alert *models.WatchAlert) error
+}
+
+// TargetLookup loads an event's target to match its tags
+type TargetLookup interface {
+	GetByID(ctx context.Context, id uuid.UUID) (*models.Target, error)
+}
+
+// UserStore loads and disables users
+type UserStore interface {
+	GetByID(ctx context.Context, id uuid.UUID) (*models.User, error)
+	Update(ctx context.Context, user *models.User) error
+}
+
+// InvestigationStore opens investigations
+type InvestigationStore interface {
+	Create(ctx context.Context, inv *models.Investigation) error
+	AddItem(ctx context.Context, item *models.InvestigationItem) error
+}
+
+// AuditStore records alerts in the system audit log
+type AuditStore interface {
+	CreateSimple(ctx context.Context, eventType string, userID *uuid.UUID, action string, status string, ipAddress *string, details map[string]interface{}) error
+}
+
+// Engine follows the event log and evaluates the enabled watch rules against
+// every event.
+//
+// Only events logged after the engine first ran are evaluated. The log is
+// read under a shared cursor, so each event is evaluated by one replica, and
+// the events counted towards thresholds are kept in the database, so counts
+// carry over whichever replica reads the next batch.
+type Engine struct {
+	config         Config
+	events         EventSource
+	cursors        CursorStore
+	store          Store
+	targets        TargetLookup
+	users          UserStore
+	investigations InvestigationStore
+	audit          AuditStore
+	notifier       notify.Notifier
+	logger         *logger.Logger
+
+	loop worker.Loop
+}
+
+// NewEngine creates a watch rule engine
+func NewEngine(cfg Config, events EventSource, cursors CursorStore, store Store, targets TargetLookup, users UserStore, investigations InvestigationStore, audit AuditStore, notifier notify.Notifier, log *logger.Logger) *Engine {
+	if cfg.Interval <= 0 {
+		cfg.Interval = 5 * time.Second
+	}
+
+	return &Engine{
+		config:         cfg,
+		events:         events,
+		cursors:        cursors,
+		store:          store,
+		targets:        targets,
+		users:          users,
+		investigations: investigations,
+		audit:          audit,
+		notifier:       notifier,
+		logger:         log,
+	}
+}
+
+// Start evaluates rules in the background until Stop is called
+func (e *Engine) Start() {
+	e.loop.Start(e.run)
+}
+
+// Stop stops the engine and waits for the batch being evaluated.
+// It is safe to call even if the engine was never started.
+func (e *Engine) Stop() {
+	e.loop.Stop()
+}
+
+func (e *Engine) run() {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		select {
+		case <-e.loop.Stopping():
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	ticker := time.NewTicker(e.config.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-e.loop.Stopping():
+			return
+		case <-ticker.C:
+			if err := e.evaluatePending(ctx); err != nil && ctx.Err() == nil {
+				e.logger.Error("Failed to evaluate watch rules", map[string]interface{}{
+					"error": err.Error(),
+				})
+			}
+			if _, err := e.store.PruneHits(ctx, time.Now().Add(-models.MaxWatchWindow)); err != nil && ctx.Err() == nil {
+				e.logger.Error("Failed to prune watch hits", map[string]interface{}{
+					"error": err.Error(),
+				})
+			}
+		}
+	}
+}
+
+// evaluatePending evaluates the enabled rules against new events until the
+// engine has caught up with the event log
+func (e *Engine) evaluatePending(ctx context.Context) error {
+	for ctx.Err() == nil {
+		more := false
+		_, err := e.cursors.Advance(ctx, cursorName, func(lastID int64) (int64, error) {
+			// Events logged before the engine first ran are left alone
+			if lastID == 0 {
+				return e.events.LatestID(ctx)
+			}
+
+			batch, err := e.events.ListSince(ctx, lastID, batchSize)
+			if err != nil {
+				return lastID, err
+			}
+			if len(batch) == 0 {
+				return lastID, nil
+			}
+
+			rules, err := e.store.ListEnabled(ctx)
+			if err != nil {
+				return lastID, err
+			}
+			if len(rules) > 0 {
+				for _, event := range batch {
+					if err := e.Evaluate(ctx, rules, event); err != nil {
+						return lastID, err
+					}
+				}
+			}
+
+			more = len(batch) == batchSize
+			return batch[len(batch)-1].ID, nil
+		})
+		if err != nil || !more {
+			return err
+		}
+	}
+	return ctx.Err()
+}
+
+// Fact is what rules are matched against, read from an event's payload
+type Fact struct {
+	EventID   int64
+	Type      string
+	Time      time.Time
+	UserID    *uuid.UUID
+	TargetID  *uuid.UUID
+	Status    string
+	IP        string
+	SessionID *uuid.UUID // Set for session events
+	AuditID   *uuid.UUID // Set for system audit events
+}
+
+// FactFor reads the fact of a session or system audit event. It returns nil
+// for other events, and for the engine's own alerts so rules can't trigger
+// each other in a loop.
+func FactFor(event *models.Event) (*Fact, error) {
+	fact := &Fact{EventID: event.ID, Type: event.Type, Time: event.CreatedAt}
+
+	switch {
+	case strings.HasPrefix(event.Type, models.StreamEventSessionPrefix):
+		var log models.AuditLog
+		if err := json.Unmarshal(event.Payload, &log); err != nil {
+			return nil, err
+		}
+		fact.UserID = &log.UserID
+		fact.TargetID = &log.TargetID
+		fact.Status = log.SessionStatus
+		fact.SessionID = &log.ID
+		if log.ClientIP != nil {
+			fact.IP = *log.ClientIP
+		}
+
+	case strings.HasPrefix(event.Type, models.StreamEventSystemPrefix):
+		var log models.SystemAuditLog
+		if err := json.Unmarshal(event.Payload, &log); err != nil {
+			return nil, err
+		}
+		if log.EventType == models.EventTypeWatchAlert {
+			return nil, nil
+		}
+		if log.UserID.Valid {
+			fact.UserID = &log.UserID.UUID
+		}
+		if log.ResourceType != nil && *log.ResourceType == "target" && log.ResourceID.Valid {
+			fact.TargetID = &log.ResourceID.UUID
+		}
+		fact.Status = log.Status
+		fact.AuditID = &log.ID
+		if log.IPAddress != nil {
+			fact.IP = *log.IPAddress
+		}
+
+	default:
+		return nil, nil
+	}
+
+	return fact, nil
+}
+
+// Match reports whether the fact meets every condition of the rule. target is
+// the fact's target, or nil if it has none or it couldn't be loaded.
+func Match(rule *models.WatchRule, fact *Fact, target *models.Target) bool {
+	if !events.Filter(rule.EventTypes).Match(fact.Type) {
+		return false
+	}
+	if rule.UserID != nil && (fact.UserID == nil || *fact.UserID != *rule.UserID) {
+		return false
+	}
+	if rule.Status != nil && *rule.Status != fact.Status {
+		return false
+	}
+	if rule.TargetTag != nil && (target == nil || !HasTag(target, *rule.TargetTag)) {
+		return false
+	}
+	if rule.OutsideHours != nil && rule.OutsideHours.Contains(fact.Time) {
+		return false
+	}
+	return true
+}
+
+// HasTag reports whether the target carries a tag: a compliance scope, or a
+// label given as key or key=value
+func HasTag(target *models.Target, tag string) bool {
+	key, value, err := models.ParseLabelSelector(tag)
+	if err != nil {
+		return false
+	}
+	if value == "" {
+		for _, scope := range target.ComplianceScope {
+			if scope == key {
+				return true
+			}
+		}
+	}
+	labelValue, ok := target.Labels[key]
+	return ok && (value == "" || labelValue == value)
+}
+
+// groupKey returns what the rule counts the fact's events per
+func groupKey(rule *models.WatchRule, fact *Fact) string {
+	switch rule.GroupBy {
+	case models.WatchGroupUser:
+		if fact.UserID != nil {
+			return fact.UserID.String()
+		}
+	case models.WatchGroupIP:
+		return fact.IP
+	case models.WatchGroupTarget:
+		if fact.TargetID != nil {
+			return fact.TargetID.String()
+		}
+	}
+	return ""
+}
+
+// Evaluate matches an event against the rules and fires the ones that reach
+// their threshold. Only failures to count the event are returned, so the event
+// is evaluated again; failed actions are logged and recorded with the alert.
+func (e *Engine) Evaluate(ctx context.Context, rules []*models.WatchRule, event *models.Event) error {
+	fact, err := FactFor(event)
+	if err != nil {
+		e.logger.Warn("Skipping event watch rules can't read", map[string]interface{}{
+			"event_id": event.ID,
+			"error":    err.Error(),
+		})
+		return nil
+	}
+	if fact == nil {
+		return nil
+	}
+
+	var target *models.Target
+	targetLoaded := false
+	for _, rule := range rules {
+		if rule.TargetTag != nil && !targetLoaded && fact.TargetID != nil {
+			targetLoaded = true
+			if target, err = e.targets.GetByID(ctx, *fact.TargetID); err != nil {
+				e.logger.Warn("Failed to load target for watch rules", map[string]interface{}{
+					"target_id": fact.TargetID.String(),
+					"error":     err.Error(),
+				})
+			}
+		}
+		if !Match(rule, fact, target) {
+			continue
+		}
+
+		key := groupKey(rule, fact)
+		count := 1
+		if rule.Threshold > 1 {
+			count, err = e.store.Hit(ctx, rule.ID, key, fact.EventID, fact.Time, fact.Time.Add(-rule.Window()), rule.Threshold)
+			if err != nil {
+				return err
+			}
+			if count < rule.Threshold {
+				continue
+			}
+		}
+
+		e.fire(ctx, rule, fact, key, count)
+	}
+	return nil
+}
+
+// fire carries out the rule's actions and records the alert
+func (e *Engine) fire(ctx context.Context, rule *models.WatchRule, fact *Fact, key string, count int) {
+	alert := &models.WatchAlert{
+		RuleID:     rule.ID,
+		RuleName:   rule.Name,
+		EventID:    fact.EventID,
+		EventType:  fact.Type,
+		GroupKey:   key,
+		EventCount: count,
+		UserID:     fact.UserID,
+		TargetID:   fact.TargetID,
+		Actions:    []string{},
+		Errors:     []string{},
+	}
+	failed := func(action string, err error) {
+		alert.Errors = append(alert.Errors, fmt.Sprintf("%s: %v", action, err))
+		e.logger.Error("Failed to carry out watch rule action", map[string]interface{}{
+			"rule_id": rule.ID.String(),
+			"action":  action,
+			"error":   err.Error(),
+		})
+	}
+
+	// Investigations first, so notifications can refer to them
+	actions := append([]string(nil), rule.Actions...)
+	sort.SliceStable(actions, func(i, j int) bool {
+		return actions[i] == models.WatchActionOpenInvestigation && actions[j] != models.WatchActionOpenInvestigation
+	})
+	for _, action := range actions {
+		var err error
+		switch action {
+		case models.WatchActionOpenInvestigation:
+			alert.InvestigationID, err = e.openInvestigation(ctx, rule, fact, count)
+		case models.WatchActionDisableUser:
+			err = e.disableUser(ctx, fact)
+		case models.WatchActionNotify:
+			err = e.notify(ctx, rule, fact, alert)
+		default:
+			continue
+		}
+		if err != nil {
+			failed(action, err)
+			continue
+		}
+		alert.Actions = append(alert.Actions, action)
+	}
+
+	if err := e.store.CreateAlert(ctx, alert); err != nil {
+		e.logger.Error("Failed to record watch alert", map[string]interface{}{
+			"rule_id": rule.ID.String(),
+			"error":   err.Error(),
+		})
+	}
+	alertsRaised.Add(1)
+
+	details := map[string]interface{}{
+		"rule_id":     rule.ID.String(),
+		"rule_name":   rule.Name,
+		"event_id":    fact.EventID,
+		"event_type":  fact.Type,
+		"event_count": count,
+		"actions":     alert.Actions,
+	}
+	if key != "" {
+		details["group_key"] = key
+	}
+	if len(alert.Errors) > 0 {
+		details["errors"] = alert.Errors
+	}
+	status := models.AuditStatusSuccess
+	if len(alert.Errors) > 0 {
+		status = models.AuditStatusFailure
+	}
+	if err := e.audit.CreateSimple(ctx, models.EventTypeWatchAlert, nil, "alert", status, nil, details); err != nil {
+		e.logger.Error("Failed to create system audit log", map[string]interface{}{
+			"error": err.Error(),
+		})
+	}
+
+	e.logger.Warn("Watch rule fired", map[string]interface{}{
+		"rule_id":     rule.ID.String(),
+		"rule_name":   rule.Name,
+		"event_id":    fact.EventID,
+		"event_count": count,
+	})
+}
+
+// openInvestigation opens an investigation holding the event that fired the rule
+func (e *Engine) openInvestigation(ctx context.Context, rule *models.WatchRule, fact *Fact, count int) (*uuid.UUID, error) {
+	description := fmt.Sprintf("Opened by watch rule %q after %d matching event(s), the last %s at %s.",
+		rule.Name, count, fact.Type, fact.Time.UTC().Format(time.RFC3339))
+	inv := &models.Investigation{
+		Title:       "Watch alert: " + rule.Name,
+		Description: &description,
+		Status:      models.InvestigationOpen,
+	}
+	if err := e.investigations.Create(ctx, inv); err != nil {
+		return nil, err
+	}
+
+	item := &models.InvestigationItem{InvestigationID: inv.ID}
+	switch {
+	case fact.SessionID != nil:
+		item.ItemType = models.InvestigationItemSession
+		item.AuditLogID = fact.SessionID
+	case fact.AuditID != nil:
+		item.ItemType = models.InvestigationItemSystemEvent
+		item.SystemAuditLogID = fact.AuditID
+	}
+	if item.ItemType != "" {
+		if err := e.investigations.AddItem(ctx, item); err != nil {
+			return &inv.ID, err
+		}
+	}
+	return &inv.ID, nil
+}
+
+// disableUser disables the event's user. Admins are left enabled, so a rule
+// can't lock every admin out; the alert still records the attempt.
+func (e *Engine) disableUser(ctx context.Context, fact *Fact) error {
+	if fact.UserID == nil {
+		return fmt.Errorf("the event has no user")
+	}
+	user, err := e.users.GetByID(ctx, *fact.UserID)
+	if err != nil {
+		return err
+	}
+	if user.Role == models.RoleAdmin {
+		return fmt.Errorf("admins are not disabled by watch rules")
+	}
+	if !user.Enabled {
+		return nil
+	}
+	user.Enabled = false
+	return e.users.Update(ctx, user)
+}
+
+// notify emails the rule's recipients about the alert
+func (e *Engine) notify(ctx context.Context, rule *models.WatchRule, fact *Fact, alert *models.WatchAlert) error {
+	if e.notifier == nil {
+		return notify.ErrNotConfigured
+	}
+
+	lines := []string{
+		fmt.Sprintf("Watch rule %q fired after %d matching event(s).", rule.Name, alert.EventCount),
+		"",
+		fmt.Sprintf("Last event: %s (#%d) at %s", fact.Type, fact.EventID, fact.Time.UTC().Format(time.RFC3339)),
+	}
+	if fact.UserID != nil {
+		lines = append(lines, "User: "+fact.UserID.String())
+	}
+	if fact.TargetID != nil {
+		lines = append(lines, "Target: "+fact.TargetID.String())
+	}
+	if fact.IP != "" {
+		lines = append(lines, "Client IP: "+fact.IP)
+	}
+	if alert.InvestigationID != nil {
+		lines = append(lines, "Investigation: "+alert.InvestigationID.String())
+	}
+
+	return e.notifier.Send(ctx, &notify.Message{
+		To:      rule.Recipients,
+		Subject: "OpenPAM watch alert: " + rule.Name,
+		Body:    strings.Join(lines, "\n"),
+	})
+}
@@ -0,0 +1,338 @@
+package watch
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/VanCannon/openpam/gateway/internal/models"
+	"github.com/VanCannon/openpam/gateway/internal/notify"
+	"github.com/VanCannon/openpam/pkg/logger"
+	"github.com/google/uuid"
+)
+
+// fakeStore counts hits in memory the way the repository does
+type fakeStore struct {
+	hits   map[string][]time.Time
+	alerts []*models.WatchAlert
+}
+
+func (s *fakeStore) ListEnabled(ctx context.Context) ([]*models.WatchRule, error) {
+	return nil, nil
+}
+
+func (s *fakeStore) Hit(ctx context.Context, ruleID uuid.UUID, groupKey string, eventID int64, at, since time.Time, threshold int) (int, error) {
+	key := ruleID.String() + "/" + groupKey
+	s.hits[key] = append(s.hits[key], at)
+	count := 0
+	for _, t := range s.hits[key] {
+		if t.After(since) {
+			count++
+		}
+	}
+	if count >= threshold {
+		delete(s.hits, key)
+	}
+	return count, nil
+}
+
+func (s *fakeStore) PruneHits(ctx context.Context, cutoff time.Time) (int64, error) {
+	return 0, nil
+}
+
+func (s *fakeStore) CreateAlert(ctx context.Context, alert *models.WatchAlert) error {
+	s.alerts = append(s.alerts, alert)
+	return nil
+}
+
+type fakeTargets map[uuid.UUID]*models.Target
+
+func (f fakeTargets) GetByID(ctx context.Context, id uuid.UUID) (*models.Target, error) {
+	if t, ok := f[id]; ok {
+		return t, nil
+	}
+	return nil, errors.New("target not found")
+}
+
+type fakeUsers map[uuid.UUID]*models.User
+
+func (f fakeUsers) GetByID(ctx context.Context, id uuid.UUID) (*models.User, error) {
+	if u, ok := f[id]; ok {
+		return u, nil
+	}
+	return nil, errors.New("user not found")
+}
+
+func (f fakeUsers) Update(ctx context.Context, user *models.User) error {
+	f[user.ID] = user
+	return nil
+}
+
+type fakeInvestigations struct {
+	opened []*models.Investigation
+	items  []*models.InvestigationItem
+}
+
+func (f *fakeInvestigations) Create(ctx context.Context, inv *models.Investigation) error {
+	inv.ID = uuid.New()
+	f.opened = append(f.opened, inv)
+	return nil
+}
+
+func (f *fakeInvestigations) AddItem(ctx context.Context, item *models.InvestigationItem) error {
+	f.items = append(f.items, item)
+	return nil
+}
+
+type fakeAudit struct {
+	events []map[string]interface{}
+}
+
+func (f *fakeAudit) CreateSimple(ctx context.Context, eventType string, userID *uuid.UUID, action string, status string, ipAddress *string, details map[string]interface{}) error {
+	f.events = append(f.events, details)
+	return nil
+}
+
+type fakeNotifier struct {
+	sent []*notify.Message
+}
+
+func (f *fakeNotifier) Send(ctx context.Context, msg *notify.Message) error {
+	f.sent = append(f.sent, msg)
+	return nil
+}
+
+type testEngine struct {
+	*Engine
+	store          *fakeStore
+	users          fakeUsers
+	investigations *fakeInvestigations
+	notifier       *fakeNotifier
+}
+
+func newTestEngine(targets fakeTargets, users fakeUsers) *testEngine {
+	te := &testEngine{
+		store:          &fakeStore{hits: map[string][]time.Time{}},
+		users:          users,
+		investigations: &fakeInvestigations{},
+		notifier:       &fakeNotifier{},
+	}
+	te.Engine = NewEngine(Config{}, nil, nil, te.store, targets, users, te.investigations, &fakeAudit{}, te.notifier,
+		logger.New(logger.LevelError, io.Discard))
+	return te
+}
+
+var eventIDs int64
+
+func systemEvent(t *testing.T, log models.SystemAuditLog, at time.Time) *models.Event {
+	t.Helper()
+	payload, err := json.Marshal(log)
+	if err != nil {
+		t.Fatal(err)
+	}
+	eventIDs++
+	return &models.Event{ID: eventIDs, Type: models.StreamEventSystemPrefix + log.EventType, Payload: payload, CreatedAt: at}
+}
+
+func sessionEvent(t *testing.T, log models.AuditLog, at time.Time) *models.Event {
+	t.Helper()
+	payload, err := json.Marshal(log)
+	if err != nil {
+		t.Fatal(err)
+	}
+	eventIDs++
+	return &models.Event{ID: eventIDs, Type: models.StreamEventSessionStarted, Payload: payload, CreatedAt: at}
+}
+
+func failedLogin(t *testing.T, userID uuid.UUID, at time.Time) *models.Event {
+	return systemEvent(t, models.SystemAuditLog{
+		ID:        uuid.New(),
+		EventType: models.EventTypeLoginFailed,
+		UserID:    uuid.NullUUID{UUID: userID, Valid: true},
+		Status:    models.AuditStatusFailure,
+	}, at)
+}
+
+func strPtr(s string) *string {
+	return &s
+}
+
+func TestEvaluate_FrequencyThreshold(t *testing.T) {
+	alice, bob := uuid.New(), uuid.New()
+	te := newTestEngine(fakeTargets{}, fakeUsers{})
+	rule := &models.WatchRule{
+		ID:            uuid.New(),
+		Name:          "Brute force",
+		EventTypes:    []string{"system.login_failed"},
+		Threshold:     4,
+		WindowSeconds: 300,
+		GroupBy:       models.WatchGroupUser,
+		Actions:       []string{models.WatchActionNotify},
+		Recipients:    []string{"soc@example.com"},
+	}
+	rules := []*models.WatchRule{rule}
+	ctx := context.Background()
+	start := time.Date(2026, 3, 2, 10, 0, 0, 0, time.UTC)
+
+	// Three failures each, and Alice's first has left the window by her fifth
+	for i, at := range []time.Duration{0, time.Minute, 2 * time.Minute} {
+		te.Evaluate(ctx, rules, failedLogin(t, alice, start.Add(at)))
+		te.Evaluate(ctx, rules, failedLogin(t, bob, start.Add(at+time.Duration(i)*time.Second)))
+	}
+	te.Evaluate(ctx, rules, failedLogin(t, alice, start.Add(6*time.Minute)))
+	if len(te.store.alerts) != 0 {
+		t.Fatalf("fired %d alerts below the threshold", len(te.store.alerts))
+	}
+
+	// Bob's fourth within five minutes fires, for Bob only
+	te.Evaluate(ctx, rules, failedLogin(t, bob, start.Add(4*time.Minute)))
+	if len(te.store.alerts) != 1 {
+		t.Fatalf("fired %d alerts, want 1", len(te.store.alerts))
+	}
+	alert := te.store.alerts[0]
+	if alert.GroupKey != bob.String() || alert.EventCount != 4 || *alert.UserID != bob {
+		t.Errorf("alert = %+v, want Bob's four failures", alert)
+	}
+	if len(te.notifier.sent) != 1 || te.notifier.sent[0].To[0] != "soc@example.com" {
+		t.Errorf("sent %v, want one email to the SOC", te.notifier.sent)
+	}
+
+	// Firing resets the count
+	te.Evaluate(ctx, rules, failedLogin(t, bob, start.Add(5*time.Minute)))
+	if len(te.store.alerts) != 1 {
+		t.Errorf("fired again right after firing")
+	}
+}
+
+func TestEvaluate_TaggedTargetOutsideHours(t *testing.T) {
+	pci := &models.Target{ID: uuid.New(), ComplianceScope: []string{"pci"}}
+	other := &models.Target{ID: uuid.New(), Labels: models.Labels{"env": "prod"}}
+	te := newTestEngine(fakeTargets{pci.ID: pci, other.ID: other}, fakeUsers{})
+	rules := []*models.WatchRule{{
+		ID:           uuid.New(),
+		Name:         "Off-hours PCI access",
+		EventTypes:   []string{"audit.session_*"},
+		TargetTag:    strPtr("pci"),
+		OutsideHours: &models.WorkingHours{Start: "09:00", End: "17:00", Timezone: "UTC"},
+		Threshold:    1,
+		Actions:      []string{models.WatchActionOpenInvestigation},
+	}}
+	ctx := context.Background()
+	monday := time.Date(2026, 3, 2, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name   string
+		target *models.Target
+		at     time.Time
+		fires  bool
+	}{
+		{name: "PCI target during business hours", target: pci, at: monday.Add(11 * time.Hour)},
+		{name: "Other target at night", target: other, at: monday.Add(23 * time.Hour)},
+		{name: "PCI target at night", target: pci, at: monday.Add(23 * time.Hour), fires: true},
+		{name: "PCI target on Saturday", target: pci, at: monday.AddDate(0, 0, 5).Add(11 * time.Hour), fires: true},
+	}
+
+	for _, tt := range tests {
+		before := len(te.store.alerts)
+		session := models.AuditLog{ID: uuid.New(), UserID: uuid.New(), TargetID: tt.target.ID, SessionStatus: models.SessionStatusActive}
+		if err := te.Evaluate(ctx, rules, sessionEvent(t, session, tt.at)); err != nil {
+			t.Fatalf("%s: Evaluate() error = %v", tt.name, err)
+		}
+		if fired := len(te.store.alerts) > before; fired != tt.fires {
+			t.Errorf("%s: fired = %v, want %v", tt.name, fired, tt.fires)
+		}
+	}
+
+	// Each alert opened an investigation holding the session
+	if len(te.investigations.opened) != 2 || len(te.investigations.items) != 2 {
+		t.Fatalf("opened %d investigations with %d items, want 2 and 2", len(te.investigations.opened), len(te.investigations.items))
+	}
+	if item := te.investigations.items[0]; item.ItemType != models.InvestigationItemSession || item.AuditLogID == nil {
+		t.Errorf("investigation item = %+v, want the session", item)
+	}
+	if id := te.store.alerts[0].InvestigationID; id == nil || *id != te.investigations.opened[0].ID {
+		t.Errorf("alert investigation = %v, want the one opened", id)
+	}
+}
+
+func TestEvaluate_DisableUser(t *testing.T) {
+	user := &models.User{ID: uuid.New(), Role: models.RoleUser, Enabled: true}
+	admin := &models.User{ID: uuid.New(), Role: models.RoleAdmin, Enabled: true}
+	te := newTestEngine(fakeTargets{}, fakeUsers{user.ID: user, admin.ID: admin})
+	rules := []*models.WatchRule{{
+		ID:         uuid.New(),
+		Name:       "Lock out",
+		EventTypes: []string{"system.login_failed"},
+		Threshold:  1,
+		Actions:    []string{models.WatchActionDisableUser},
+	}}
+	ctx := context.Background()
+
+	te.Evaluate(ctx, rules, failedLogin(t, user.ID, time.Now()))
+	if te.users[user.ID].Enabled {
+		t.Error("user still enabled")
+	}
+	if got := te.store.alerts[0].Actions; !reflect.DeepEqual([]string(got), []string{models.WatchActionDisableUser}) {
+		t.Errorf("actions = %v, want disable_user", got)
+	}
+
+	// Admins are never disabled; the alert records why
+	te.Evaluate(ctx, rules, failedLogin(t, admin.ID, time.Now()))
+	if !te.users[admin.ID].Enabled {
+		t.Error("admin was disabled")
+	}
+	if alert := te.store.alerts[1]; len(alert.Actions) != 0 || len(alert.Errors) != 1 {
+		t.Errorf("alert = %+v, want the action failed", alert)
+	}
+}
+
+func TestFactFor_SkipsOwnAlerts(t *testing.T) {
+	fact, err := FactFor(systemEvent(t, models.SystemAuditLog{EventType: models.EventTypeWatchAlert}, time.Now()))
+	if err != nil || fact != nil {
+		t.Errorf("FactFor(watch alert) = %v, %v, want nothing to match", fact, err)
+	}
+
+	fact, err = FactFor(&models.Event{Type: "other.event", Payload: json.RawMessage(`{}`)})
+	if err != nil || fact != nil {
+		t.Errorf("FactFor(other event) = %v, %v, want nothing to match", fact, err)
+	}
+}
+
+func TestMatch(t *testing.T) {
+	userID := uuid.New()
+	fact := &Fact{Type: "system.login_failed", UserID: &userID, Status: models.AuditStatusFailure, Time: time.Now()}
+	target := &models.Target{Labels: models.Labels{"team": "payments"}}
+	other := uuid.New()
+
+	tests := []struct {
+		name string
+		rule models.WatchRule
+		want bool
+	}{
+		{name: "Exact type", rule: models.WatchRule{EventTypes: []string{"system.login_failed"}}, want: true},
+		{name: "Type prefix", rule: models.WatchRule{EventTypes: []string{"system.*"}}, want: true},
+		{name: "Other type", rule: models.WatchRule{EventTypes: []string{"audit.session_*"}}},
+		{name: "Same user", rule: models.WatchRule{EventTypes: []string{"system.*"}, UserID: &userID}, want: true},
+		{name: "Other user", rule: models.WatchRule{EventTypes: []string{"system.*"}, UserID: &other}},
+		{name: "Status", rule: models.WatchRule{EventTypes: []string{"system.*"}, Status: strPtr("failure")}, want: true},
+		{name: "Other status", rule: models.WatchRule{EventTypes: []string{"system.*"}, Status: strPtr("success")}},
+		{name: "Label value", rule: models.WatchRule{EventTypes: []string{"system.*"}, TargetTag: strPtr("team=payments")}, want: true},
+		{name: "Other label value", rule: models.WatchRule{EventTypes: []string{"system.*"}, TargetTag: strPtr("team=billing")}},
+	}
+
+	for _, tt := range tests {
+		if got := Match(&tt.rule, fact, target); got != tt.want {
+			t.Errorf("%s: Match() = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+
+	// A tag can't match an event without a target
+	rule := &models.WatchRule{EventTypes: []string{"system.*"}, TargetTag: strPtr("team")}
+	if Match(rule, fact, nil) {
+		t.Error("tagged rule matched an event without a target")
+	}
+}
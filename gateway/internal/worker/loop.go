@@ -0,0 +1,56 @@
+// Package worker holds what the gateway's background workers share
+package worker
+
+import "sync"
+
+// Loop runs a background worker's goroutine. Start and Stop can each be
+// called any number of times and in any order: the goroutine runs at most
+// once, never after Stop, and Stop waits for it to return. The zero value is
+// ready to use.
+type Loop struct {
+	init      sync.Once
+	stop      chan struct{}
+	done      chan struct{}
+	startOnce sync.Once
+	stopOnce  sync.Once
+}
+
+func (l *Loop) channels() {
+	l.init.Do(func() {
+		l.stop = make(chan struct{})
+		l.done = make(chan struct{})
+	})
+}
+
+// Start runs run in a new goroutine unless the loop was already started or
+// stopped. run should return soon after Stopping is closed.
+func (l *Loop) Start(run func()) {
+	l.channels()
+	l.startOnce.Do(func() {
+		go func() {
+			defer close(l.done)
+			run()
+		}()
+	})
+}
+
+// Stopping returns a channel that is closed when Stop is called
+func (l *Loop) Stopping() <-chan struct{} {
+	l.channels()
+	return l.stop
+}
+
+// Stop tells the goroutine to stop and waits for it to return. It is safe to
+// call even if the loop was never started.
+func (l *Loop) Stop() {
+	l.channels()
+	l.stopOnce.Do(func() {
+		close(l.stop)
+	})
+
+	// If Start hasn't run yet, make sure it never will
+	l.startOnce.Do(func() {
+		close(l.done)
+	})
+	<-l.done
+}
@@ -0,0 +1,63 @@
+package worker
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLoop_StartStop(t *testing.T) {
+	var l Loop
+	runs := 0
+	run := func() {
+		runs++
+		<-l.Stopping()
+	}
+
+	l.Start(run)
+	l.Start(run) // Starting twice runs once
+	l.Stop()
+	l.Stop() // Stopping twice is safe
+
+	if runs != 1 {
+		t.Errorf("ran %d times, want once", runs)
+	}
+}
+
+func TestLoop_StopWithoutStart(t *testing.T) {
+	var l Loop
+
+	stopped := make(chan struct{})
+	go func() {
+		l.Stop()
+		close(stopped)
+	}()
+
+	select {
+	case <-stopped:
+	case <-time.After(time.Second):
+		t.Fatal("Stop blocked without Start")
+	}
+
+	// Once stopped, the loop never starts
+	ran := false
+	l.Start(func() { ran = true })
+	time.Sleep(10 * time.Millisecond)
+	if ran {
+		t.Error("loop started after Stop")
+	}
+}
+
+func TestLoop_StopWaits(t *testing.T) {
+	var l Loop
+	finished := false
+	l.Start(func() {
+		<-l.Stopping()
+		time.Sleep(10 * time.Millisecond)
+		finished = true
+	})
+
+	l.Stop()
+	if !finished {
+		t.Error("Stop returned before the goroutine finished")
+	}
+}
@@ -0,0 +1,98 @@
+package wsconn
+
+import (
+	"encoding/json"
+	"errors"
+	"time"
+	"unicode/utf8"
+
+	"github.com/VanCannon/openpam/gateway/internal/settings"
+	"github.com/gorilla/websocket"
+)
+
+// Close codes sent by the gateway. Standard codes are used where one fits;
+// the 4000 range is for reasons specific to proxied sessions.
+const (
+	CloseNormal            = websocket.CloseNormalClosure     // 1000: the session ended
+	CloseInternalError     = websocket.CloseInternalServerErr // 1011: the gateway failed to run the session
+	CloseServiceRestart    = websocket.CloseServiceRestart    // 1012: the gateway is restarting; reconnect
+	CloseTryAgainLater     = websocket.CloseTryAgainLater     // 1013: the client fell too far behind
+	CloseSessionLimit      = 4001                             // Idle timeout or maximum duration reached
+	CloseTargetUnreachable = 4002                             // The target stopped answering
+	CloseSessionEnded      = 4003                             // The monitored session ended
+	CloseScheduleEnded     = 4004                             // The schedule window the session was opened in ended
+	CloseHandshakeFailed   = 4005                             // The connection to the target couldn't be set up
+	CloseRecordingFailed   = 4006                             // The session must be recorded and its recording couldn't start
+)
+
+// Close reasons, the machine-readable part of a close frame
+const (
+	ReasonSessionEnded      = "session_ended"
+	ReasonInternalError     = "internal_error"
+	ReasonServiceRestart    = "service_restart"
+	ReasonSlowConsumer      = "slow_consumer"
+	ReasonSessionLimit      = "session_limit"
+	ReasonTargetUnreachable = "target_unreachable"
+	ReasonScheduleEnded     = "schedule_ended"
+	ReasonRecordingFailed   = "recording_failed"
+
+	ReasonHandshakeFailed      = "handshake_failed"
+	ReasonCertificateRejected  = "certificate_rejected"
+	ReasonAuthenticationFailed = "authentication_failed"
+)
+
+// maxCloseText is the largest close frame payload after the 2-byte code
+const maxCloseText = 123
+
+// CloseReason is the JSON text of a close frame sent by the gateway
+type CloseReason struct {
+	Reason  string `json:"reason"`
+	Status  int    `json:"status,omitempty"` // Guacamole status code of RDP handshake failures
+	Message string `json:"message,omitempty"`
+	Token   string `json:"token,omitempty"` // Reconnect token for the same path
+}
+
+// Text encodes the reason, shortening the message so the frame stays within
+// the WebSocket limit
+func (c CloseReason) Text() string {
+	for {
+		data, _ := json.Marshal(c)
+		if len(data) <= maxCloseText || c.Message == "" {
+			return string(data)
+		}
+		_, size := utf8.DecodeLastRuneInString(c.Message)
+		c.Message = c.Message[:len(c.Message)-size]
+	}
+}
+
+// CloseError ends a session with a specific close frame when used as the
+// cause of its context's cancellation
+type CloseError struct {
+	Code int
+	CloseReason
+}
+
+func (e *CloseError) Error() string {
+	if e.Message != "" {
+		return e.Reason + ": " + e.Message
+	}
+	return e.Reason
+}
+
+// CloseFor returns the close frame for a session ended by err, or false when
+// err doesn't call for one
+func CloseFor(err error) (int, string, bool) {
+	var ce *CloseError
+	switch {
+	case errors.As(err, &ce):
+		return ce.Code, ce.Text(), true
+	case settings.Limited(err):
+		return CloseSessionLimit, CloseReason{Reason: ReasonSessionLimit, Message: err.Error()}.Text(), true
+	}
+	return 0, "", false
+}
+
+// WriteClose sends a close frame on a connection that has no write pump
+func WriteClose(conn *websocket.Conn, code int, reason CloseReason) {
+	conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(code, reason.Text()), time.Now().Add(time.Second))
+}
@@ -0,0 +1,85 @@
+package wsconn
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/VanCannon/openpam/gateway/internal/settings"
+)
+
+func TestCloseReason_FitsFrame(t *testing.T) {
+	reason := CloseReason{Reason: ReasonSessionLimit, Message: strings.Repeat("é", 200)}
+	text := reason.Text()
+	if len(text) > maxCloseText {
+		t.Fatalf("len(Text()) = %d, want <= %d", len(text), maxCloseText)
+	}
+	var decoded CloseReason
+	if err := json.Unmarshal([]byte(text), &decoded); err != nil {
+		t.Fatalf("Text() is not valid JSON: %v", err)
+	}
+	if decoded.Reason != ReasonSessionLimit || !strings.HasPrefix(reason.Message, decoded.Message) {
+		t.Errorf("decoded = %+v", decoded)
+	}
+
+	// A reconnect token always fits alongside the reason
+	token := "rct_" + strings.Repeat("x", 59)
+	if text := (CloseReason{Reason: ReasonServiceRestart, Token: token}).Text(); !strings.Contains(text, token) {
+		t.Errorf("token dropped from %q", text)
+	}
+}
+
+func TestCloseFor(t *testing.T) {
+	if code, _, ok := CloseFor(settings.ErrIdleTimeout); !ok || code != CloseSessionLimit {
+		t.Errorf("CloseFor(idle timeout) = %d, %v", code, ok)
+	}
+	restart := &CloseError{Code: CloseServiceRestart, CloseReason: CloseReason{Reason: ReasonServiceRestart}}
+	if code, text, ok := CloseFor(fmt.Errorf("SSH proxy error: %w", restart)); !ok || code != CloseServiceRestart || !strings.Contains(text, ReasonServiceRestart) {
+		t.Errorf("CloseFor(wrapped restart) = %d, %q, %v", code, text, ok)
+	}
+	if _, _, ok := CloseFor(context.Canceled); ok {
+		t.Error("CloseFor(context.Canceled) should not send a close frame")
+	}
+}
+
+func TestTracker_Shutdown(t *testing.T) {
+	tracker := NewTracker()
+
+	ctx, done := tracker.Track(context.Background(), func() string { return "rct_token" })
+	untracked, untrack := tracker.Track(context.Background(), nil)
+	untrack()
+	if tracker.Count() != 1 {
+		t.Fatalf("Count() = %d, want 1", tracker.Count())
+	}
+	if untracked.Err() == nil {
+		t.Error("context should be cancelled once the session is done")
+	}
+
+	// The session closes after seeing the cancellation
+	go func() {
+		<-ctx.Done()
+		done()
+	}()
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	if err := tracker.Shutdown(shutdownCtx); err != nil {
+		t.Fatalf("Shutdown() error = %v", err)
+	}
+
+	var ce *CloseError
+	if !errors.As(context.Cause(ctx), &ce) || ce.Code != CloseServiceRestart || ce.Token != "rct_token" {
+		t.Errorf("Cause() = %v, want service restart with token", context.Cause(ctx))
+	}
+
+	// Sessions starting while draining are closed straight away
+	late, lateDone := tracker.Track(context.Background(), nil)
+	defer lateDone()
+	if !errors.As(context.Cause(late), &ce) {
+		t.Errorf("late session Cause() = %v, want service restart", context.Cause(late))
+	}
+}
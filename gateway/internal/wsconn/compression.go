@@ -0,0 +1,133 @@
+package wsconn
+
+import (
+	"bufio"
+	"compress/flate"
+	"expvar"
+	"net"
+	"net/http"
+	"strings"
+	"sync/atomic"
+
+	"github.com/gorilla/websocket"
+)
+
+var (
+	payloadBytes       = expvar.NewInt("websocket_payload_bytes")
+	wireBytes          = expvar.NewInt("websocket_wire_bytes")
+	compressedSessions = expvar.NewInt("websocket_compressed_sessions")
+)
+
+func init() {
+	expvar.Publish("websocket_compression_ratio", expvar.Func(func() interface{} {
+		return ratio(payloadBytes.Value(), wireBytes.Value())
+	}))
+}
+
+// Compression configures permessage-deflate (RFC 7692) on proxied sessions
+type Compression struct {
+	Enabled bool
+	Level   int // flate level, from 1 (fastest) to 9 (smallest)
+}
+
+// Upgrade upgrades the request to a WebSocket. Compression is negotiated when
+// it is enabled, the client offers it and hasn't turned it off for the
+// session with compress=0. The returned meter counts the bytes written.
+func Upgrade(u websocket.Upgrader, w http.ResponseWriter, r *http.Request, c Compression) (*websocket.Conn, *Meter, error) {
+	u.EnableCompression = c.Enabled && r.URL.Query().Get("compress") != "0"
+
+	meter := &Meter{Compressed: u.EnableCompression && offersDeflate(r)}
+	conn, err := u.Upgrade(&meteredWriter{ResponseWriter: w, meter: meter}, r, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if meter.Compressed {
+		level := c.Level
+		if level < flate.BestSpeed || level > flate.BestCompression {
+			level = flate.BestSpeed
+		}
+		conn.SetCompressionLevel(level)
+		compressedSessions.Add(1)
+	}
+	return conn, meter, nil
+}
+
+// offersDeflate reports whether the client offered permessage-deflate, which
+// the upgrader then always accepts
+func offersDeflate(r *http.Request) bool {
+	for _, header := range r.Header.Values("Sec-WebSocket-Extensions") {
+		for _, ext := range strings.Split(header, ",") {
+			name, _, _ := strings.Cut(ext, ";")
+			if strings.EqualFold(strings.TrimSpace(name), "permessage-deflate") {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Meter counts a connection's outbound bytes before and after compression
+type Meter struct {
+	Compressed bool // Whether compression was negotiated
+
+	payload atomic.Int64 // Message bytes handed to the connection
+	wire    atomic.Int64 // Bytes written to the network, frame headers included
+}
+
+// PayloadBytes returns the message bytes written
+func (m *Meter) PayloadBytes() int64 { return m.payload.Load() }
+
+// WireBytes returns the bytes sent over the network
+func (m *Meter) WireBytes() int64 { return m.wire.Load() }
+
+// Ratio returns the payload bytes per byte sent, or 0 before anything is sent
+func (m *Meter) Ratio() float64 {
+	return ratio(m.payload.Load(), m.wire.Load())
+}
+
+func (m *Meter) addPayload(n int) {
+	m.payload.Add(int64(n))
+	payloadBytes.Add(int64(n))
+}
+
+func ratio(payload, wire int64) float64 {
+	if wire == 0 {
+		return 0
+	}
+	return float64(payload) / float64(wire)
+}
+
+// meterOf returns the meter counting the connection's bytes, if any
+func meterOf(conn *websocket.Conn) *Meter {
+	if mc, ok := conn.UnderlyingConn().(*meteredConn); ok {
+		return mc.meter
+	}
+	return nil
+}
+
+// meteredWriter hands the upgrader a connection that counts written bytes
+type meteredWriter struct {
+	http.ResponseWriter
+	meter *Meter
+}
+
+func (w *meteredWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	conn, rw, err := http.NewResponseController(w.ResponseWriter).Hijack()
+	if err != nil {
+		return nil, nil, err
+	}
+	return &meteredConn{Conn: conn, meter: w.meter}, rw, nil
+}
+
+type meteredConn struct {
+	net.Conn
+	meter *Meter
+}
+
+func (c *meteredConn) Write(b []byte) (int, error) {
+	n, err := c.Conn.Write(b)
+	c.meter.wire.Add(int64(n))
+	wireBytes.Add(int64(n))
+	return n, err
+}
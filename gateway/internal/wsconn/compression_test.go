@@ -0,0 +1,105 @@
+package wsconn
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/VanCannon/openpam/pkg/logger"
+	"github.com/gorilla/websocket"
+)
+
+// newCompressedPair returns a pump on a connection upgraded by Upgrade, its
+// meter and the client connection
+func newCompressedPair(t *testing.T, c Compression, query string, clientDeflate bool) (*WritePump, *Meter, *websocket.Conn) {
+	t.Helper()
+
+	type upgraded struct {
+		conn  *websocket.Conn
+		meter *Meter
+	}
+	serverConn := make(chan upgraded, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, meter, err := Upgrade(websocket.Upgrader{}, w, r, c)
+		if err != nil {
+			t.Errorf("upgrade failed: %v", err)
+			return
+		}
+		serverConn <- upgraded{conn, meter}
+	}))
+	t.Cleanup(srv.Close)
+
+	dialer := websocket.Dialer{EnableCompression: clientDeflate}
+	client, _, err := dialer.Dial("ws"+strings.TrimPrefix(srv.URL, "http")+query, nil)
+	if err != nil {
+		t.Fatalf("dial failed: %v", err)
+	}
+	t.Cleanup(func() { client.Close() })
+
+	up := <-serverConn
+	pump := NewWritePump(up.conn, DefaultConfig(), logger.New(logger.LevelError, io.Discard))
+	t.Cleanup(pump.Stop)
+
+	return pump, up.meter, client
+}
+
+// roundTrip writes a large, repetitive instruction and reads it back
+func roundTrip(t *testing.T, pump *WritePump, client *websocket.Conn) {
+	t.Helper()
+
+	img := "3.img,1.1,2.14,1.0,9.image/png,1.0,1.0;" + strings.Repeat("4.blob,1.1,8.AAAAAAAA;", 200)
+	if err := pump.Write(websocket.TextMessage, []byte(img)); err != nil {
+		t.Fatalf("Write() error = %v", err)
+	}
+
+	client.SetReadDeadline(time.Now().Add(2 * time.Second))
+	_, data, err := client.ReadMessage()
+	if err != nil {
+		t.Fatalf("ReadMessage() error = %v", err)
+	}
+	if string(data) != img {
+		t.Fatalf("received %d bytes, want the %d written", len(data), len(img))
+	}
+}
+
+func TestUpgrade_Compression(t *testing.T) {
+	pump, meter, client := newCompressedPair(t, Compression{Enabled: true, Level: 6}, "", true)
+	roundTrip(t, pump, client)
+
+	if !meter.Compressed {
+		t.Fatal("compression was not negotiated")
+	}
+	if meter.PayloadBytes() == 0 || meter.Ratio() < 5 {
+		t.Errorf("payload %d bytes, wire %d bytes, ratio %.2f", meter.PayloadBytes(), meter.WireBytes(), meter.Ratio())
+	}
+}
+
+func TestUpgrade_NoCompression(t *testing.T) {
+	tests := []struct {
+		name          string
+		compression   Compression
+		query         string
+		clientDeflate bool
+	}{
+		{"disabled", Compression{}, "", true},
+		{"opted out", Compression{Enabled: true}, "?compress=0", true},
+		{"not offered", Compression{Enabled: true}, "", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pump, meter, client := newCompressedPair(t, tt.compression, tt.query, tt.clientDeflate)
+			roundTrip(t, pump, client)
+
+			if meter.Compressed {
+				t.Error("compression was negotiated")
+			}
+			if meter.Ratio() >= 1 {
+				t.Errorf("ratio = %.2f, want below 1 without compression", meter.Ratio())
+			}
+		})
+	}
+}
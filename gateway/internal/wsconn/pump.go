@@ -0,0 +1,299 @@
+package wsconn
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/VanCannon/openpam/pkg/logger"
+	"github.com/gorilla/websocket"
+)
+
+var (
+	// ErrSlowConsumer is returned when the client cannot keep up and the outbound queue overflows
+	ErrSlowConsumer = errors.New("websocket client too slow: outbound queue full")
+
+	// ErrClosed is returned when writing to a pump that has been stopped
+	ErrClosed = errors.New("websocket write pump closed")
+)
+
+// Config controls outbound WebSocket behaviour
+type Config struct {
+	// WriteTimeout is the deadline applied to every frame write
+	WriteTimeout time.Duration
+	// PingInterval is how often a ping is sent to the client (0 disables pings)
+	PingInterval time.Duration
+	// PongTimeout is how long after a missed ping interval the client is considered dead
+	PongTimeout time.Duration
+	// QueueSize is the number of pending messages before the client is considered too slow
+	QueueSize int
+	// MaxBatchBytes caps how many bytes of queued messages are coalesced into one frame
+	MaxBatchBytes int
+	// CompressionThreshold is the smallest frame compressed when compression was negotiated
+	CompressionThreshold int
+}
+
+// DefaultConfig returns the default pump configuration
+func DefaultConfig() Config {
+	return Config{
+		WriteTimeout:         10 * time.Second,
+		PingInterval:         30 * time.Second,
+		PongTimeout:          10 * time.Second,
+		QueueSize:            256,
+		MaxBatchBytes:        32 * 1024,
+		CompressionThreshold: 512,
+	}
+}
+
+type message struct {
+	messageType int
+	data        []byte
+}
+
+// WritePump serialises all writes to a WebSocket connection through a single goroutine.
+//
+// Messages are queued without blocking the producer. Messages of the same type that are
+// already waiting in the queue are coalesced into a single frame, which suits the stream
+// protocols we proxy (terminal output and Guacamole instructions). If the queue fills up
+// the client is disconnected rather than allowed to stall the session.
+type WritePump struct {
+	conn   *websocket.Conn
+	config Config
+	logger *logger.Logger
+	meter  *Meter // nil unless the connection was upgraded by Upgrade
+
+	queue chan message
+	done  chan struct{}
+
+	mu       sync.Mutex
+	err      error
+	stopOnce sync.Once
+}
+
+// NewWritePump creates a write pump for the connection and starts it.
+//
+// When pings are enabled it also arms a read deadline that each pong extends, so a
+// client that silently disappears causes the next read to fail. It must therefore be
+// called before any goroutine starts reading from the connection.
+func NewWritePump(conn *websocket.Conn, config Config, log *logger.Logger) *WritePump {
+	defaults := DefaultConfig()
+	if config.WriteTimeout <= 0 {
+		config.WriteTimeout = defaults.WriteTimeout
+	}
+	if config.PongTimeout <= 0 {
+		config.PongTimeout = defaults.PongTimeout
+	}
+	if config.QueueSize <= 0 {
+		config.QueueSize = defaults.QueueSize
+	}
+	if config.MaxBatchBytes <= 0 {
+		config.MaxBatchBytes = defaults.MaxBatchBytes
+	}
+	if config.CompressionThreshold <= 0 {
+		config.CompressionThreshold = defaults.CompressionThreshold
+	}
+
+	p := &WritePump{
+		conn:   conn,
+		config: config,
+		logger: log,
+		meter:  meterOf(conn),
+		queue:  make(chan message, config.QueueSize),
+		done:   make(chan struct{}),
+	}
+
+	if config.PingInterval > 0 {
+		readWindow := config.PingInterval + config.PongTimeout
+		conn.SetReadDeadline(time.Now().Add(readWindow))
+		conn.SetPongHandler(func(string) error {
+			return conn.SetReadDeadline(time.Now().Add(readWindow))
+		})
+	}
+
+	go p.run()
+
+	return p
+}
+
+// IsTimeout reports whether err is a read or write timeout, which on a pumped
+// connection means the client stopped answering pings
+func IsTimeout(err error) bool {
+	var netErr interface{ Timeout() bool }
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
+
+// Write queues a message for delivery. The data is copied, so callers may reuse their buffer.
+// It never blocks: if the queue is full the pump disconnects the client and returns ErrSlowConsumer.
+func (p *WritePump) Write(messageType int, data []byte) error {
+	select {
+	case <-p.done:
+		return p.Err()
+	default:
+	}
+
+	buf := make([]byte, len(data))
+	copy(buf, data)
+
+	select {
+	case p.queue <- message{messageType: messageType, data: buf}:
+		return nil
+	case <-p.done:
+		return p.Err()
+	default:
+		p.logger.Warn("WebSocket client too slow, disconnecting", map[string]interface{}{
+			"queue_size": p.config.QueueSize,
+		})
+		p.stop(ErrSlowConsumer, CloseTryAgainLater, CloseReason{Reason: ReasonSlowConsumer, Message: "client too slow"}.Text())
+		return ErrSlowConsumer
+	}
+}
+
+// Close flushes queued messages, sends a close frame and stops the pump.
+// It waits at most one write timeout for the flush to complete.
+func (p *WritePump) Close(code int, text string) {
+	closeMsg := message{
+		messageType: websocket.CloseMessage,
+		data:        websocket.FormatCloseMessage(code, text),
+	}
+
+	timer := time.NewTimer(p.config.WriteTimeout)
+	defer timer.Stop()
+
+	select {
+	case p.queue <- closeMsg:
+	case <-p.done:
+		return
+	case <-timer.C:
+		p.Stop()
+		return
+	}
+
+	select {
+	case <-p.done:
+	case <-timer.C:
+		p.Stop()
+	}
+}
+
+// Stop stops the pump immediately, discarding queued messages and closing the connection
+func (p *WritePump) Stop() {
+	p.stop(ErrClosed, 0, "")
+}
+
+// Backlog returns how full the outbound queue is, from 0 to 1. A backlog
+// that keeps growing means the client's link can't keep up.
+func (p *WritePump) Backlog() float64 {
+	return float64(len(p.queue)) / float64(cap(p.queue))
+}
+
+// Done is closed when the pump has stopped
+func (p *WritePump) Done() <-chan struct{} {
+	return p.done
+}
+
+// Err returns the reason the pump stopped, or nil while it is running
+func (p *WritePump) Err() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.err
+}
+
+// stop records the first error, optionally sends a close frame, and closes the connection
+func (p *WritePump) stop(err error, closeCode int, closeText string) {
+	p.stopOnce.Do(func() {
+		p.mu.Lock()
+		p.err = err
+		p.mu.Unlock()
+
+		close(p.done)
+
+		// WriteControl is safe to call concurrently with the pump's own writes
+		if closeCode != 0 {
+			deadline := time.Now().Add(time.Second)
+			p.conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(closeCode, closeText), deadline)
+		}
+
+		// Closing the connection unblocks any reader still waiting on the client
+		p.conn.Close()
+	})
+}
+
+// run is the single writer goroutine
+func (p *WritePump) run() {
+	var ping <-chan time.Time
+	if p.config.PingInterval > 0 {
+		ticker := time.NewTicker(p.config.PingInterval)
+		defer ticker.Stop()
+		ping = ticker.C
+	}
+
+	for {
+		select {
+		case <-p.done:
+			return
+
+		case <-ping:
+			deadline := time.Now().Add(p.config.WriteTimeout)
+			if err := p.conn.WriteControl(websocket.PingMessage, nil, deadline); err != nil {
+				p.stop(err, 0, "")
+				return
+			}
+
+		case msg := <-p.queue:
+			for {
+				next, more := p.coalesce(&msg)
+
+				if err := p.writeMessage(msg); err != nil {
+					p.stop(err, 0, "")
+					return
+				}
+
+				if msg.messageType == websocket.CloseMessage {
+					p.stop(ErrClosed, 0, "")
+					return
+				}
+
+				if !more {
+					break
+				}
+				msg = next
+			}
+		}
+	}
+}
+
+// coalesce appends already-queued messages of the same type to msg, up to MaxBatchBytes.
+// If it dequeues a message of a different type, that message is returned to be written next.
+func (p *WritePump) coalesce(msg *message) (message, bool) {
+	if msg.messageType != websocket.TextMessage && msg.messageType != websocket.BinaryMessage {
+		return message{}, false
+	}
+
+	for len(msg.data) < p.config.MaxBatchBytes {
+		select {
+		case next := <-p.queue:
+			if next.messageType != msg.messageType {
+				return next, true
+			}
+			msg.data = append(msg.data, next.data...)
+		default:
+			return message{}, false
+		}
+	}
+
+	return message{}, false
+}
+
+// writeMessage writes a single frame with the configured deadline. Small
+// frames aren't worth compressing and are sent as they are.
+func (p *WritePump) writeMessage(msg message) error {
+	p.conn.SetWriteDeadline(time.Now().Add(p.config.WriteTimeout))
+	p.conn.EnableWriteCompression(len(msg.data) >= p.config.CompressionThreshold)
+	if err := p.conn.WriteMessage(msg.messageType, msg.data); err != nil {
+		return err
+	}
+	if p.meter != nil {
+		p.meter.addPayload(len(msg.data))
+	}
+	return nil
+}
@@ -0,0 +1,177 @@
+package wsconn
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/VanCannon/openpam/pkg/logger"
+	"github.com/gorilla/websocket"
+)
+
+// newTestPair returns a server-side pump and the client connection it writes to
+func newTestPair(t *testing.T, config Config) (*WritePump, *websocket.Conn) {
+	t.Helper()
+
+	serverConn := make(chan *websocket.Conn, 1)
+	upgrader := websocket.Upgrader{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			t.Errorf("upgrade failed: %v", err)
+			return
+		}
+		serverConn <- conn
+	}))
+	t.Cleanup(srv.Close)
+
+	client, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(srv.URL, "http"), nil)
+	if err != nil {
+		t.Fatalf("dial failed: %v", err)
+	}
+	t.Cleanup(func() { client.Close() })
+
+	pump := NewWritePump(<-serverConn, config, logger.New(logger.LevelError, io.Discard))
+	t.Cleanup(pump.Stop)
+
+	return pump, client
+}
+
+func TestWritePump_DeliversInOrder(t *testing.T) {
+	pump, client := newTestPair(t, DefaultConfig())
+
+	for _, part := range []string{"4.sync,", "1.1;", "3.nop;"} {
+		if err := pump.Write(websocket.TextMessage, []byte(part)); err != nil {
+			t.Fatalf("Write() error = %v", err)
+		}
+	}
+
+	// Messages may be coalesced, so read until everything has arrived
+	var received strings.Builder
+	client.SetReadDeadline(time.Now().Add(2 * time.Second))
+	for received.Len() < len("4.sync,1.1;3.nop;") {
+		msgType, data, err := client.ReadMessage()
+		if err != nil {
+			t.Fatalf("ReadMessage() error = %v", err)
+		}
+		if msgType != websocket.TextMessage {
+			t.Fatalf("message type = %d, want text", msgType)
+		}
+		received.Write(data)
+	}
+
+	if got := received.String(); got != "4.sync,1.1;3.nop;" {
+		t.Errorf("received %q", got)
+	}
+}
+
+func TestWritePump_CopiesCallerBuffer(t *testing.T) {
+	pump, client := newTestPair(t, DefaultConfig())
+
+	buf := []byte("first")
+	if err := pump.Write(websocket.BinaryMessage, buf); err != nil {
+		t.Fatalf("Write() error = %v", err)
+	}
+	copy(buf, "XXXXX")
+
+	client.SetReadDeadline(time.Now().Add(2 * time.Second))
+	_, data, err := client.ReadMessage()
+	if err != nil {
+		t.Fatalf("ReadMessage() error = %v", err)
+	}
+	if string(data) != "first" {
+		t.Errorf("received %q, want %q", data, "first")
+	}
+}
+
+func TestWritePump_SlowConsumerDisconnected(t *testing.T) {
+	config := DefaultConfig()
+	config.QueueSize = 4
+	config.MaxBatchBytes = 1
+	config.WriteTimeout = 100 * time.Millisecond
+	pump, _ := newTestPair(t, config)
+
+	// The client never reads, so once the socket buffers fill the queue overflows
+	chunk := make([]byte, 64*1024)
+	var err error
+	for i := 0; i < 10000 && err == nil; i++ {
+		err = pump.Write(websocket.BinaryMessage, chunk)
+	}
+
+	select {
+	case <-pump.Done():
+	case <-time.After(5 * time.Second):
+		t.Fatal("pump did not stop for a slow consumer")
+	}
+
+	if err == nil {
+		t.Fatal("expected Write to fail")
+	}
+	if !errors.Is(pump.Err(), ErrSlowConsumer) && !IsTimeout(pump.Err()) {
+		t.Errorf("Err() = %v, want slow consumer or write timeout", pump.Err())
+	}
+}
+
+func TestWritePump_CloseFlushesQueue(t *testing.T) {
+	pump, client := newTestPair(t, DefaultConfig())
+
+	if err := pump.Write(websocket.TextMessage, []byte("bye")); err != nil {
+		t.Fatalf("Write() error = %v", err)
+	}
+	pump.Close(websocket.CloseNormalClosure, "done")
+
+	client.SetReadDeadline(time.Now().Add(2 * time.Second))
+	_, data, err := client.ReadMessage()
+	if err != nil {
+		t.Fatalf("ReadMessage() error = %v", err)
+	}
+	if string(data) != "bye" {
+		t.Errorf("received %q, want %q", data, "bye")
+	}
+
+	_, _, err = client.ReadMessage()
+	if !websocket.IsCloseError(err, websocket.CloseNormalClosure) {
+		t.Errorf("expected normal close, got %v", err)
+	}
+
+	if err := pump.Write(websocket.TextMessage, []byte("late")); !errors.Is(err, ErrClosed) {
+		t.Errorf("Write() after Close error = %v, want ErrClosed", err)
+	}
+}
+
+func TestWritePump_DeadClientTimesOut(t *testing.T) {
+	config := DefaultConfig()
+	config.PingInterval = 50 * time.Millisecond
+	config.PongTimeout = 50 * time.Millisecond
+
+	serverConn := make(chan *websocket.Conn, 1)
+	upgrader := websocket.Upgrader{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			t.Errorf("upgrade failed: %v", err)
+			return
+		}
+		serverConn <- conn
+	}))
+	defer srv.Close()
+
+	// The client never reads, so it never processes pings or sends pongs
+	client, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(srv.URL, "http"), nil)
+	if err != nil {
+		t.Fatalf("dial failed: %v", err)
+	}
+	defer client.Close()
+
+	conn := <-serverConn
+	pump := NewWritePump(conn, config, logger.New(logger.LevelError, io.Discard))
+	defer pump.Stop()
+
+	if _, _, err := conn.ReadMessage(); !IsTimeout(err) {
+		t.Errorf("ReadMessage() error = %v, want timeout", err)
+	}
+}
@@ -0,0 +1,103 @@
+package wsconn
+
+import (
+	"context"
+	"sync"
+)
+
+// Tracker keeps the live WebSocket sessions so a shutting-down gateway can end
+// them with a service restart close frame, offering each a reconnect token,
+// instead of dropping the connections.
+type Tracker struct {
+	mu       sync.Mutex
+	sessions map[*tracked]struct{}
+	draining bool
+	wg       sync.WaitGroup
+}
+
+type tracked struct {
+	cancel context.CancelCauseFunc
+	token  func() string
+}
+
+// NewTracker creates a session tracker
+func NewTracker() *Tracker {
+	return &Tracker{sessions: make(map[*tracked]struct{})}
+}
+
+// Track registers a session and returns its context, which is cancelled with
+// a *CloseError when the gateway shuts down. token is called at that point for
+// the reconnect token to send; it may return "". done must be called when the
+// session has ended.
+func (t *Tracker) Track(ctx context.Context, token func() string) (context.Context, func()) {
+	ctx, cancel := context.WithCancelCause(ctx)
+	s := &tracked{cancel: cancel, token: token}
+
+	t.mu.Lock()
+	draining := t.draining
+	if !draining {
+		t.sessions[s] = struct{}{}
+		t.wg.Add(1)
+	}
+	t.mu.Unlock()
+
+	if draining {
+		s.cancel(restartError(s))
+		return ctx, func() { cancel(nil) }
+	}
+
+	var once sync.Once
+	return ctx, func() {
+		once.Do(func() {
+			t.mu.Lock()
+			delete(t.sessions, s)
+			t.mu.Unlock()
+			cancel(nil)
+			t.wg.Done()
+		})
+	}
+}
+
+// Count returns the number of live sessions
+func (t *Tracker) Count() int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return len(t.sessions)
+}
+
+// Shutdown ends every session and refuses new ones, then waits until the
+// sessions have closed or ctx is done
+func (t *Tracker) Shutdown(ctx context.Context) error {
+	t.mu.Lock()
+	t.draining = true
+	sessions := make([]*tracked, 0, len(t.sessions))
+	for s := range t.sessions {
+		sessions = append(sessions, s)
+	}
+	t.mu.Unlock()
+
+	for _, s := range sessions {
+		s.cancel(restartError(s))
+	}
+
+	done := make(chan struct{})
+	go func() {
+		t.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func restartError(s *tracked) *CloseError {
+	ce := &CloseError{Code: CloseServiceRestart, CloseReason: CloseReason{Reason: ReasonServiceRestart}}
+	if s.token != nil {
+		ce.Token = s.token()
+	}
+	return ce
+}
@@ -1,23 +1,90 @@
 package main
 
 import (
-	"log"
+	"expvar"
 	"net/http"
-	"openpam/identity/internal/api"
-	"openpam/identity/internal/db"
+	"os"
+	"strings"
 
+	"github.com/VanCannon/openpam/identity/internal/api"
+	"github.com/VanCannon/openpam/identity/internal/db"
+	"github.com/VanCannon/openpam/identity/internal/ldap"
+	"github.com/VanCannon/openpam/pkg/kerberos"
+	"github.com/VanCannon/openpam/pkg/logger"
+	"github.com/VanCannon/openpam/pkg/recovery"
+	"github.com/VanCannon/openpam/pkg/servicetoken"
 	"github.com/gorilla/mux"
 )
 
 func main() {
-	log.Println("Starting Identity Service on :8082")
+	log := logger.NewService("identity", os.Getenv("LOG_LEVEL"), os.Getenv("LOG_FORMAT"))
+	db.SetLogger(log)
+	ldap.SetLogger(log)
+	api.SetLogger(log)
+	log.Info("Starting Identity Service", map[string]interface{}{
+		"port": 8082,
+	})
 
 	if err := db.InitDB(); err != nil {
-		log.Fatalf("Failed to initialize database: %v", err)
+		log.Fatal("Failed to initialize database", map[string]interface{}{
+			"error": err.Error(),
+		})
 	}
 
+	// Callers authenticate with tokens signed with the gateway's session secret
+	secret := os.Getenv("SESSION_SECRET")
+	if secret == "" {
+		log.Fatal("SESSION_SECRET must be set to the gateway's session secret")
+	}
+	// Needed when the gateway signs session tokens with an HSM or KMS key
+	var keys *servicetoken.KeySet
+	if url := os.Getenv("GATEWAY_JWKS_URL"); url != "" {
+		keys = servicetoken.NewKeySet(url)
+	}
+
+	// Bind to the directory with Kerberos when a realm is configured
+	krb := kerberos.Config{
+		Realm:    os.Getenv("KRB5_REALM"),
+		Krb5Conf: os.Getenv("KRB5_CONFIG"),
+		Keytab:   os.Getenv("KRB5_KEYTAB"),
+	}
+	if kdcs := os.Getenv("KRB5_KDC"); kdcs != "" {
+		krb.KDCs = strings.Split(kdcs, ",")
+	}
+	if krb.Enabled() {
+		if _, err := krb.Load(); err != nil {
+			log.Fatal("Invalid Kerberos configuration", map[string]interface{}{
+				"error": err.Error(),
+			})
+		}
+		ldap.Kerberos = &ldap.KerberosConfig{Config: krb, Principal: os.Getenv("KRB5_PRINCIPAL")}
+		log.Info("LDAP binds use Kerberos")
+	}
+
+	// Bulk imports are queued as orchestrator jobs
+	orchestratorURL := os.Getenv("ORCHESTRATOR_URL")
+	if orchestratorURL == "" {
+		orchestratorURL = "http://orchestrator:8090"
+	}
+	api.SetOrchestrator(api.NewOrchestrator(orchestratorURL, secret))
+
 	r := mux.NewRouter()
-	api.RegisterRoutes(r)
+	api.RegisterRoutes(r, api.NewAuth(secret, keys))
+	r.Handle("/debug/vars", expvar.Handler())
 
-	log.Fatal(http.ListenAndServe(":8082", r))
+	reporter, err := recovery.NewReporter(os.Getenv("SENTRY_DSN"), "identity", os.Getenv("SENTRY_ENVIRONMENT"), "")
+	if err != nil {
+		log.Fatal("Invalid SENTRY_DSN", map[string]interface{}{
+			"error": err.Error(),
+		})
+	}
+	handler := recovery.RequestID(recovery.Middleware("identity", func(message string, fields map[string]interface{}) {
+		log.Error(message, fields)
+	}, reporter)(r))
+
+	if err := http.ListenAndServe(":8082", handler); err != nil {
+		log.Fatal("HTTP server error", map[string]interface{}{
+			"error": err.Error(),
+		})
+	}
 }
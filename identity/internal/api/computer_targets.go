@@ -0,0 +1,235 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/VanCannon/openpam/identity/internal/db"
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+)
+
+// EventTypeComputerTargetReconciled is the system audit event of an admin
+// reconciling a target with the AD computer it was imported from
+const EventTypeComputerTargetReconciled = "ad_computer_target_reconciled"
+
+// Ways of reconciling a target with its AD computer
+const (
+	ReconcileDisableTarget = "disable_target"
+	ReconcileKeep          = "keep"
+	ReconcileRepoint       = "repoint" // Link the target to another AD computer
+)
+
+type ReconcileRequest struct {
+	Action       string `json:"action"`
+	ADComputerID string `json:"ad_computer_id"` // The computer to re-point to
+	Reason       string `json:"reason"`
+}
+
+// A sync reconciles the computer targets through these, so tests can stand in
+// for the database
+var (
+	markADComputersDeleted     = db.MarkADComputersDeleted
+	resetActiveComputerTargets = db.ResetActiveComputerTargets
+	getComputerTargets         = db.GetComputerTargets
+)
+
+// syncComputerTargets marks the AD computers a sync no longer found as
+// deleted, unless the computer search failed, and returns how many targets
+// are flagged for reconciliation. Nothing is marked when no computers were
+// found at all, which is more likely a filter or permission problem than an
+// empty directory.
+func syncComputerTargets(computers []db.ADComputer, searched bool) (int, error) {
+	if searched && len(computers) > 0 {
+		found := make([]string, 0, len(computers))
+		for _, c := range computers {
+			found = append(found, c.ID)
+		}
+		deleted, err := markADComputersDeleted(found)
+		if err != nil {
+			return 0, err
+		}
+		if deleted > 0 {
+			log.Info("AD computers deleted from the directory", map[string]interface{}{
+				"count": deleted,
+			})
+		}
+	}
+	if err := resetActiveComputerTargets(); err != nil {
+		return 0, err
+	}
+
+	flagged, err := getComputerTargets(true)
+	if err != nil {
+		return 0, err
+	}
+	if len(flagged) > 0 {
+		log.Warn("Targets need reconciling with their AD computers", map[string]interface{}{
+			"count": len(flagged),
+		})
+	}
+	return len(flagged), nil
+}
+
+// GetComputerTargets lists the targets imported from AD with the state of
+// their computer, only those flagged for reconciliation with flagged=true.
+// Flagged targets come with the active computers they could be re-pointed
+// to: those with the same name or DNS host name.
+func GetComputerTargets(w http.ResponseWriter, r *http.Request) {
+	flaggedOnly := r.URL.Query().Get("flagged") == "true"
+	links, err := db.GetComputerTargets(flaggedOnly)
+	if err != nil {
+		log.Error("Failed to get AD computer targets", map[string]interface{}{
+			"error": err.Error(),
+		})
+		http.Error(w, "Failed to get AD computer targets", http.StatusInternalServerError)
+		return
+	}
+
+	flagged := 0
+	for i := range links {
+		if !links[i].Flagged {
+			continue
+		}
+		flagged++
+		c := links[i].Computer
+		candidates, err := db.GetRepointCandidates(c.Name, c.DNSHostName, c.ID)
+		if err != nil {
+			log.Error("Failed to get re-point candidates", map[string]interface{}{
+				"target_id": links[i].TargetID,
+				"error":     err.Error(),
+			})
+			http.Error(w, "Failed to get AD computer targets", http.StatusInternalServerError)
+			return
+		}
+		links[i].Candidates = candidates
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"targets": links,
+		"total":   len(links),
+		"flagged": flagged,
+	})
+}
+
+// ReconcileComputerTarget resolves a target whose AD computer was disabled
+// or deleted: disable_target disables it, keep leaves it as it is, and
+// repoint links it to another active AD computer and points it at that
+// computer's host. Each reconciliation is recorded in the system audit log.
+func ReconcileComputerTarget(w http.ResponseWriter, r *http.Request) {
+	var req ReconcileRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	switch req.Action {
+	case ReconcileDisableTarget, ReconcileKeep, ReconcileRepoint:
+	default:
+		http.Error(w, "Unknown action", http.StatusBadRequest)
+		return
+	}
+
+	actorID := callerFromContext(r.Context()).UserID
+	if _, err := uuid.Parse(actorID); err != nil {
+		http.Error(w, "Targets must be reconciled by a user", http.StatusForbidden)
+		return
+	}
+
+	targetID := mux.Vars(r)["target_id"]
+	link, err := db.GetComputerTarget(targetID)
+	if err != nil {
+		log.Error("Failed to get AD computer target", map[string]interface{}{
+			"target_id": targetID,
+			"error":     err.Error(),
+		})
+		http.Error(w, "Failed to get AD computer target", http.StatusInternalServerError)
+		return
+	}
+	if link == nil {
+		http.Error(w, "Target not linked to an AD computer", http.StatusNotFound)
+		return
+	}
+
+	audit := &db.SystemAuditLog{
+		EventType:    EventTypeComputerTargetReconciled,
+		UserID:       actorID,
+		ResourceType: "target",
+		ResourceID:   link.TargetID,
+		ResourceName: link.TargetName,
+		Action:       req.Action,
+		IPAddress:    clientIP(r),
+		UserAgent:    r.UserAgent(),
+		Details: map[string]interface{}{
+			"ad_computer_id": link.Computer.ID,
+			"ad_computer_dn": link.Computer.DN,
+			"state":          link.State,
+		},
+	}
+	if req.Reason != "" {
+		audit.Details["reason"] = req.Reason
+	}
+
+	switch req.Action {
+	case ReconcileDisableTarget, ReconcileKeep:
+		if link.State == db.ComputerActive {
+			http.Error(w, "AD computer is active", http.StatusConflict)
+			return
+		}
+		if req.Action == ReconcileKeep {
+			err = db.KeepComputerTarget(link.TargetID, link.State, actorID)
+		} else {
+			err = db.DisableComputerTarget(link.TargetID, link.State, actorID)
+		}
+	case ReconcileRepoint:
+		if req.ADComputerID == "" || req.ADComputerID == link.Computer.ID {
+			http.Error(w, "ad_computer_id must name another AD computer", http.StatusBadRequest)
+			return
+		}
+		computer, getErr := db.GetADComputer(req.ADComputerID)
+		if getErr != nil {
+			log.Error("Failed to get AD computer", map[string]interface{}{
+				"ad_computer_id": req.ADComputerID,
+				"error":          getErr.Error(),
+			})
+			http.Error(w, "Failed to get AD computer", http.StatusInternalServerError)
+			return
+		}
+		if computer == nil {
+			http.Error(w, "AD computer not found", http.StatusNotFound)
+			return
+		}
+		if computer.DeletedAt != nil || !computer.Enabled {
+			http.Error(w, "AD computer is not active", http.StatusConflict)
+			return
+		}
+		audit.Details["new_ad_computer_id"] = computer.ID
+		audit.Details["new_ad_computer_dn"] = computer.DN
+		err = db.RepointComputerTarget(link.TargetID, computer, actorID)
+	}
+	if err != nil {
+		log.Error("Failed to reconcile AD computer target", map[string]interface{}{
+			"target_id": link.TargetID,
+			"action":    req.Action,
+			"error":     err.Error(),
+		})
+		audit.Details["error"] = err.Error()
+		recordAudit(audit, "failure")
+		http.Error(w, "Failed to reconcile target", http.StatusInternalServerError)
+		return
+	}
+	recordAudit(audit, "success")
+
+	link, err = db.GetComputerTarget(link.TargetID)
+	if err != nil {
+		log.Error("Failed to get AD computer target", map[string]interface{}{
+			"target_id": targetID,
+			"error":     err.Error(),
+		})
+		http.Error(w, "Failed to get AD computer target", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(link)
+}
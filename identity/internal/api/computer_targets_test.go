@@ -0,0 +1,89 @@
+package api
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/VanCannon/openpam/identity/internal/db"
+)
+
+// fakeComputerTargets stands in for the AD computers and their targets in
+// the database
+type fakeComputerTargets struct {
+	marked  [][]string // The found IDs of each MarkADComputersDeleted call
+	resets  int
+	flagged []db.ComputerTarget
+	err     error
+}
+
+func (f *fakeComputerTargets) install(t *testing.T) {
+	t.Helper()
+
+	mark, reset, get := markADComputersDeleted, resetActiveComputerTargets, getComputerTargets
+	t.Cleanup(func() {
+		markADComputersDeleted, resetActiveComputerTargets, getComputerTargets = mark, reset, get
+	})
+
+	markADComputersDeleted = func(found []string) (int64, error) {
+		f.marked = append(f.marked, found)
+		return 1, f.err
+	}
+	resetActiveComputerTargets = func() error {
+		f.resets++
+		return nil
+	}
+	getComputerTargets = func(flaggedOnly bool) ([]db.ComputerTarget, error) {
+		if !flaggedOnly {
+			t.Error("sync lists all targets, want only the flagged ones")
+		}
+		return f.flagged, nil
+	}
+}
+
+func TestSyncComputerTargets(t *testing.T) {
+	computers := []db.ADComputer{{ID: "c1"}, {ID: "c2"}}
+	tests := []struct {
+		name      string
+		computers []db.ADComputer
+		searched  bool
+		wantMark  [][]string
+	}{
+		{name: "search found computers", computers: computers, searched: true, wantMark: [][]string{{"c1", "c2"}}},
+		{name: "search failed", computers: nil, searched: false},
+		{name: "search found nothing", computers: []db.ADComputer{}, searched: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := &fakeComputerTargets{flagged: []db.ComputerTarget{{TargetID: "t1", Flagged: true}}}
+			f.install(t)
+
+			flagged, err := syncComputerTargets(tt.computers, tt.searched)
+			if err != nil {
+				t.Fatalf("syncComputerTargets() error = %v", err)
+			}
+			if !reflect.DeepEqual(f.marked, tt.wantMark) {
+				t.Errorf("marked computers deleted except %v, want %v", f.marked, tt.wantMark)
+			}
+			if f.resets != 1 {
+				t.Errorf("reset kept states %d times, want 1", f.resets)
+			}
+			if flagged != 1 {
+				t.Errorf("syncComputerTargets() = %d flagged, want 1", flagged)
+			}
+		})
+	}
+}
+
+func TestSyncComputerTargets_MarkFails(t *testing.T) {
+	f := &fakeComputerTargets{err: errors.New("connection reset")}
+	f.install(t)
+
+	if _, err := syncComputerTargets([]db.ADComputer{{ID: "c1"}}, true); err == nil {
+		t.Fatal("syncComputerTargets() succeeded, want the mark error")
+	}
+	if f.resets != 0 {
+		t.Errorf("reset kept states after marking failed")
+	}
+}
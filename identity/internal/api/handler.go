@@ -3,19 +3,28 @@ package api
 import (
 	"bytes"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
-	"log"
 	"net/http"
-	"openpam/identity/internal/db"
-	"openpam/identity/internal/ldap"
 	"strconv"
 	"strings"
 
+	"github.com/VanCannon/openpam/identity/internal/db"
+	"github.com/VanCannon/openpam/identity/internal/ldap"
+	"github.com/VanCannon/openpam/pkg/logger"
 	"github.com/google/uuid"
 	"github.com/gorilla/mux"
 )
 
+// log is the identity service's logger, replaced by SetLogger at startup
+var log = logger.Default()
+
+// SetLogger sets the logger the package logs with
+func SetLogger(l *logger.Logger) {
+	log = l
+}
+
 type SyncRequest struct {
 	Host           string `json:"host"`
 	Port           int    `json:"port"`
@@ -32,26 +41,64 @@ type ConfigRequest struct {
 	Port           int    `json:"port"`
 	BaseDN         string `json:"base_dn"`
 	BindDN         string `json:"bind_dn"`
-	BindPassword   string `json:"bind_password"`
+	BindPassword   string `json:"bind_password,omitempty"`
 	UserFilter     string `json:"user_filter"`
 	ComputerFilter string `json:"computer_filter"`
 	GroupFilter    string `json:"group_filter"`
+
+	// Names or DNs of the AD groups whose membership is watched. Left out,
+	// the current ones are kept.
+	PrivilegedGroups []string `json:"privileged_groups"`
+}
+
+// ConfigResponse is the AD configuration as returned to callers, without the
+// bind password
+type ConfigResponse struct {
+	ConfigRequest
+	BindPasswordSet bool `json:"bind_password_set"`
 }
 
-func RegisterRoutes(r *mux.Router) {
-	r.HandleFunc("/api/v1/identity/sync", SyncAD).Methods("POST")
-	r.HandleFunc("/api/v1/identity/config", SaveConfig).Methods("POST")
-	r.HandleFunc("/api/v1/identity/config", GetConfig).Methods("GET")
-	r.HandleFunc("/api/v1/users", GetUsers).Methods("GET")
-	r.HandleFunc("/api/v1/computers", GetComputers).Methods("GET")
-	r.HandleFunc("/api/v1/ad-users", GetADUsers).Methods("GET")
-	r.HandleFunc("/api/v1/ad-computers", GetADComputers).Methods("GET")
-	r.HandleFunc("/api/v1/ad-groups", GetADGroups).Methods("GET")
-	r.HandleFunc("/api/v1/users/import", ImportADUser).Methods("POST")
-	r.HandleFunc("/api/v1/groups/import", ImportADGroup).Methods("POST")
-	r.HandleFunc("/api/v1/computers/import", ImportADComputer).Methods("POST")
-	r.HandleFunc("/api/v1/managed-accounts", GetManagedAccounts).Methods("GET")
-	r.HandleFunc("/api/v1/identity/auth", VerifyCredentials).Methods("POST")
+// The config routes read and save the AD configuration through these, so
+// tests can stand in for the database
+var (
+	getConfig            = db.GetConfig
+	saveConfig           = db.SaveConfig
+	getPrivilegedGroups  = db.GetPrivilegedGroups
+	savePrivilegedGroups = db.SavePrivilegedGroups
+)
+
+// RegisterRoutes registers the identity API. Reads are open to admins and
+// auditors; changes, and anything exposing directory credentials, need an
+// admin. Checking user credentials is only for the gateway, which also looks
+// up AD computers to fingerprint hosts and reads the AD account reports to
+// alert on, and syncs and bulk imports can also be run by the orchestrator.
+func RegisterRoutes(r *mux.Router, auth *Auth) {
+	r.HandleFunc("/api/v1/identity/sync", auth.require(SyncAD, roleAdmin, roleService)).Methods("POST")
+	r.HandleFunc("/api/v1/identity/config", auth.require(SaveConfig, roleAdmin)).Methods("POST")
+	r.HandleFunc("/api/v1/identity/config", auth.require(GetConfig, roleAdmin)).Methods("GET")
+	r.HandleFunc("/api/v1/users", auth.require(GetUsers, roleAdmin, roleAuditor)).Methods("GET")
+	r.HandleFunc("/api/v1/computers", auth.require(GetComputers, roleAdmin, roleAuditor)).Methods("GET")
+	r.HandleFunc("/api/v1/ad-users", auth.require(GetADUsers, roleAdmin, roleAuditor)).Methods("GET")
+	r.HandleFunc("/api/v1/ad-users/{id}", auth.require(GetADUser, roleAdmin, roleAuditor)).Methods("GET")
+	r.HandleFunc("/api/v1/ad-computers", auth.require(GetADComputers, roleAdmin, roleAuditor, roleService)).Methods("GET")
+	r.HandleFunc("/api/v1/ad-computers/{id}", auth.require(GetADComputer, roleAdmin, roleAuditor)).Methods("GET")
+	r.HandleFunc("/api/v1/ad-groups", auth.require(GetADGroups, roleAdmin, roleAuditor)).Methods("GET")
+	r.HandleFunc("/api/v1/ad-reports/password-expiry", auth.require(GetPasswordExpiryReport, roleAdmin, roleAuditor, roleService)).Methods("GET")
+	r.HandleFunc("/api/v1/ad-reports/stale-accounts", auth.require(GetStaleAccountsReport, roleAdmin, roleAuditor, roleService)).Methods("GET")
+	r.HandleFunc("/api/v1/ad-computer-targets", auth.require(GetComputerTargets, roleAdmin, roleAuditor)).Methods("GET")
+	r.HandleFunc("/api/v1/ad-computer-targets/{target_id}/reconcile", auth.require(ReconcileComputerTarget, roleAdmin)).Methods("POST")
+	r.HandleFunc("/api/v1/ad-privileged-groups", auth.require(GetPrivilegedGroups, roleAdmin, roleAuditor)).Methods("GET")
+	r.HandleFunc("/api/v1/users/import", auth.require(ImportADUser, roleAdmin)).Methods("POST")
+	r.HandleFunc("/api/v1/groups/import", auth.require(ImportADGroup, roleAdmin)).Methods("POST")
+	r.HandleFunc("/api/v1/computers/import", auth.require(ImportADComputer, roleAdmin)).Methods("POST")
+	r.HandleFunc("/api/v1/ad-imports", auth.require(QueueADImport, roleAdmin)).Methods("POST")
+	r.HandleFunc("/api/v1/ad-imports/{job_id}", auth.require(GetADImport, roleAdmin, roleAuditor)).Methods("GET")
+	r.HandleFunc("/api/v1/identity/import", auth.require(RunADImport, roleService)).Methods("POST")
+	r.HandleFunc("/api/v1/managed-accounts", auth.require(GetManagedAccounts, roleAdmin, roleAuditor)).Methods("GET")
+	r.HandleFunc("/api/v1/identity/auth", auth.require(VerifyCredentials, roleService)).Methods("POST")
+	r.HandleFunc("/api/v1/ad-users/{id}/actions", auth.require(ADUserAction, roleAdmin)).Methods("POST")
+	r.HandleFunc("/api/v1/identity/permissions/{user_id}", auth.require(GetPermissions, roleAdmin, roleAuditor)).Methods("GET")
+	r.HandleFunc("/api/v1/identity/permissions/{user_id}", auth.require(SetPermissions, roleAdmin)).Methods("PUT")
 }
 
 func VerifyCredentials(w http.ResponseWriter, r *http.Request) {
@@ -68,7 +115,9 @@ func VerifyCredentials(w http.ResponseWriter, r *http.Request) {
 	// Get config from DB
 	host, port, baseDN, bindDN, bindPassword, _, _, _, err := db.GetConfig()
 	if err != nil {
-		log.Printf("Failed to get config for auth: %v", err)
+		log.Error("Failed to get config for auth", map[string]interface{}{
+			"error": err.Error(),
+		})
 		http.Error(w, "Failed to get configuration", http.StatusInternalServerError)
 		return
 	}
@@ -80,7 +129,9 @@ func VerifyCredentials(w http.ResponseWriter, r *http.Request) {
 
 	client := ldap.NewClient(host, port, baseDN, bindDN, bindPassword)
 	if err := client.Connect(); err != nil {
-		log.Printf("Failed to connect to LDAP: %v", err)
+		log.Error("Failed to connect to LDAP", map[string]interface{}{
+			"error": err.Error(),
+		})
 		http.Error(w, "Failed to connect to directory service", http.StatusInternalServerError)
 		return
 	}
@@ -89,7 +140,10 @@ func VerifyCredentials(w http.ResponseWriter, r *http.Request) {
 	// Authenticate
 	userEntry, err := client.Authenticate(creds.Username, creds.Password)
 	if err != nil {
-		log.Printf("Authentication failed for user %s: %v", creds.Username, err)
+		log.Warn("Authentication failed", map[string]interface{}{
+			"username": creds.Username,
+			"error":    err.Error(),
+		})
 		http.Error(w, "Invalid credentials", http.StatusUnauthorized)
 		return
 	}
@@ -126,34 +180,71 @@ func SaveConfig(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if err := db.SaveConfig(req.Host, req.Port, req.BaseDN, req.BindDN, req.BindPassword, req.UserFilter, req.ComputerFilter, req.GroupFilter); err != nil {
-		log.Printf("Failed to save config: %v", err)
+	// The bind password is never returned, so a blank one keeps the current
+	if req.BindPassword == "" {
+		_, _, _, _, current, _, _, _, err := getConfig()
+		if err != nil {
+			log.Error("Failed to get config", map[string]interface{}{
+				"error": err.Error(),
+			})
+			http.Error(w, "Failed to save config", http.StatusInternalServerError)
+			return
+		}
+		req.BindPassword = current
+	}
+
+	if err := saveConfig(req.Host, req.Port, req.BaseDN, req.BindDN, req.BindPassword, req.UserFilter, req.ComputerFilter, req.GroupFilter); err != nil {
+		log.Error("Failed to save config", map[string]interface{}{
+			"error": err.Error(),
+		})
 		http.Error(w, "Failed to save config", http.StatusInternalServerError)
 		return
 	}
+	if req.PrivilegedGroups != nil {
+		if err := savePrivilegedGroups(req.PrivilegedGroups); err != nil {
+			log.Error("Failed to save privileged groups", map[string]interface{}{
+				"error": err.Error(),
+			})
+			http.Error(w, "Failed to save config", http.StatusInternalServerError)
+			return
+		}
+	}
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(map[string]string{"status": "success"})
 }
 
 func GetConfig(w http.ResponseWriter, r *http.Request) {
-	host, port, baseDN, bindDN, bindPassword, userFilter, computerFilter, groupFilter, err := db.GetConfig()
+	host, port, baseDN, bindDN, bindPassword, userFilter, computerFilter, groupFilter, err := getConfig()
+	if err != nil {
+		log.Error("Failed to get config", map[string]interface{}{
+			"error": err.Error(),
+		})
+		http.Error(w, "Failed to get config", http.StatusInternalServerError)
+		return
+	}
+	privilegedGroups, err := getPrivilegedGroups()
 	if err != nil {
-		log.Printf("Failed to get config: %v", err)
+		log.Error("Failed to get privileged groups", map[string]interface{}{
+			"error": err.Error(),
+		})
 		http.Error(w, "Failed to get config", http.StatusInternalServerError)
 		return
 	}
 
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(ConfigRequest{
-		Host:           host,
-		Port:           port,
-		BaseDN:         baseDN,
-		BindDN:         bindDN,
-		BindPassword:   bindPassword,
-		UserFilter:     userFilter,
-		ComputerFilter: computerFilter,
-		GroupFilter:    groupFilter,
+	json.NewEncoder(w).Encode(ConfigResponse{
+		ConfigRequest: ConfigRequest{
+			Host:             host,
+			Port:             port,
+			BaseDN:           baseDN,
+			BindDN:           bindDN,
+			UserFilter:       userFilter,
+			ComputerFilter:   computerFilter,
+			GroupFilter:      groupFilter,
+			PrivilegedGroups: privilegedGroups,
+		},
+		BindPasswordSet: bindPassword != "",
 	})
 }
 
@@ -161,7 +252,9 @@ func SyncAD(w http.ResponseWriter, r *http.Request) {
 	// Try to get config from DB first
 	host, port, baseDN, bindDN, bindPassword, userFilter, computerFilter, groupFilter, err := db.GetConfig()
 	if err != nil {
-		log.Printf("Failed to get config for sync: %v", err)
+		log.Error("Failed to get config for sync", map[string]interface{}{
+			"error": err.Error(),
+		})
 		http.Error(w, "Failed to get config", http.StatusInternalServerError)
 		return
 	}
@@ -173,7 +266,9 @@ func SyncAD(w http.ResponseWriter, r *http.Request) {
 
 	client := ldap.NewClient(host, port, baseDN, bindDN, bindPassword)
 	if err := client.Connect(); err != nil {
-		log.Printf("Failed to connect to LDAP: %v", err)
+		log.Error("Failed to connect to LDAP", map[string]interface{}{
+			"error": err.Error(),
+		})
 		http.Error(w, "Failed to connect to LDAP", http.StatusInternalServerError)
 		return
 	}
@@ -182,11 +277,22 @@ func SyncAD(w http.ResponseWriter, r *http.Request) {
 	// Sync Users
 	ldapUsers, err := client.SearchUsers(userFilter)
 	if err != nil {
-		log.Printf("Failed to search users: %v", err)
+		log.Error("Failed to search users", map[string]interface{}{
+			"error": err.Error(),
+		})
 		http.Error(w, "Failed to search users", http.StatusInternalServerError)
 		return
 	}
 
+	// Passwords expire after the domain's maximum age unless AD computed
+	// their expiry itself
+	maxPasswordAge, err := client.MaxPasswordAge()
+	if err != nil {
+		log.Warn("Failed to read maximum password age", map[string]interface{}{
+			"error": err.Error(),
+		})
+	}
+
 	// Parse AD Users
 	var adUsers []db.ADUser
 	for _, u := range ldapUsers {
@@ -194,35 +300,9 @@ func SyncAD(w http.ResponseWriter, r *http.Request) {
 		// Generate deterministic UUID for ID
 		id := uuid.NewSHA1(uuid.NameSpaceURL, []byte("ad-user:"+username)).String()
 
-		// Parse UAC
-		uacStr := u.GetAttributeValue("userAccountControl")
-		status := "Active"
-		passwordStatus := "Normal"
-
-		if uacStr != "" {
-			uac, err := strconv.Atoi(uacStr)
-			if err == nil {
-				// Status
-				if uac&2 != 0 { // ACCOUNTDISABLE
-					status = "Disabled"
-				} else if uac&16 != 0 { // LOCKOUT
-					status = "Locked Out"
-				}
-
-				// Password Status
-				if uac&65536 != 0 { // DONT_EXPIRE_PASSWORD
-					passwordStatus = "Never Expires"
-				} else if uac&262144 != 0 { // SMARTCARD_REQUIRED
-					passwordStatus = "Smart Card Required"
-				}
-			}
-		}
-
-		// Check pwdLastSet for Password Expired
 		pwdLastSet := u.GetAttributeValue("pwdLastSet")
-		if pwdLastSet == "0" {
-			status = "Password Expired"
-		}
+		status, passwordStatus := accountStatus(u.GetAttributeValue("userAccountControl"), pwdLastSet)
+		uac, _ := strconv.Atoi(u.GetAttributeValue("userAccountControl"))
 
 		adUsers = append(adUsers, db.ADUser{
 			ID:                id,
@@ -234,13 +314,19 @@ func SyncAD(w http.ResponseWriter, r *http.Request) {
 			OU:                parseOU(u.DN),
 			Status:            status,
 			PasswordStatus:    passwordStatus,
+			PasswordLastSet:   ldap.FileTime(pwdLastSet),
+			PasswordExpiresAt: ldap.PasswordExpiresAt(uac, pwdLastSet, u.GetAttributeValue("msDS-UserPasswordExpiryTimeComputed"), maxPasswordAge),
+			LastLogonAt:       ldap.FileTime(u.GetAttributeValue("lastLogonTimestamp")),
+			WhenCreated:       ldap.GeneralizedTime(u.GetAttributeValue("whenCreated")),
 		})
 	}
 
 	// Sync Computers
-	ldapComputers, err := client.SearchComputers(computerFilter)
-	if err != nil {
-		log.Printf("Failed to search computers: %v", err)
+	ldapComputers, computersErr := client.SearchComputers(computerFilter)
+	if computersErr != nil {
+		log.Error("Failed to search computers", map[string]interface{}{
+			"error": computersErr.Error(),
+		})
 	}
 
 	// Parse AD Computers
@@ -248,6 +334,7 @@ func SyncAD(w http.ResponseWriter, r *http.Request) {
 	for _, c := range ldapComputers {
 		name := c.GetAttributeValue("name")
 		id := uuid.NewSHA1(uuid.NameSpaceURL, []byte("ad-computer:"+name)).String()
+		uac, _ := strconv.Atoi(c.GetAttributeValue("userAccountControl"))
 
 		adComputers = append(adComputers, db.ADComputer{
 			ID:                     id,
@@ -256,22 +343,39 @@ func SyncAD(w http.ResponseWriter, r *http.Request) {
 			DNSHostName:            c.GetAttributeValue("dNSHostName"),
 			OperatingSystem:        c.GetAttributeValue("operatingSystem"),
 			OperatingSystemVersion: c.GetAttributeValue("operatingSystemVersion"),
+			Enabled:                uac&ldap.UACAccountDisable == 0,
 		})
 	}
 
 	// Sync Groups
 	ldapGroups, err := client.SearchGroups(groupFilter)
 	if err != nil {
-		log.Printf("Failed to search groups: %v", err)
+		log.Error("Failed to search groups", map[string]interface{}{
+			"error": err.Error(),
+		})
+	}
+
+	// Imported users keep their AD user's ID, so members can be matched by DN
+	userIDs := make(map[string]string, len(adUsers))
+	for _, u := range adUsers {
+		userIDs[strings.ToLower(u.DN)] = u.ID
 	}
 
 	// Parse AD Groups
 	var adGroups []db.ADGroup
+	memberships := make(map[string][]string)
 	for _, g := range ldapGroups {
 		name := g.GetAttributeValue("name")
 		id := uuid.NewSHA1(uuid.NameSpaceURL, []byte("ad-group:"+name)).String()
 		members := g.GetAttributeValues("member")
 
+		memberships[id] = []string{}
+		for _, dn := range members {
+			if userID, ok := userIDs[strings.ToLower(dn)]; ok {
+				memberships[id] = append(memberships[id], userID)
+			}
+		}
+
 		adGroups = append(adGroups, db.ADGroup{
 			ID:          id,
 			DN:          g.DN,
@@ -283,24 +387,58 @@ func SyncAD(w http.ResponseWriter, r *http.Request) {
 
 	// Save to DB
 	if err := db.SaveADUsers(adUsers); err != nil {
-		log.Printf("Failed to save AD users: %v", err)
+		log.Error("Failed to save AD users", map[string]interface{}{
+			"error": err.Error(),
+		})
 		http.Error(w, "Failed to save AD users", http.StatusInternalServerError)
 		return
 	}
 
 	if err := db.SaveADComputers(adComputers); err != nil {
-		log.Printf("Failed to save AD computers: %v", err)
+		log.Error("Failed to save AD computers", map[string]interface{}{
+			"error": err.Error(),
+		})
 		http.Error(w, "Failed to save AD computers", http.StatusInternalServerError)
 		return
 	}
 
+	flagged, err := syncComputerTargets(adComputers, computersErr == nil)
+	if err != nil {
+		log.Error("Failed to reconcile AD computer targets", map[string]interface{}{
+			"error": err.Error(),
+		})
+	}
+
 	if err := db.SaveADGroups(adGroups); err != nil {
-		log.Printf("Failed to save AD groups: %v", err)
+		log.Error("Failed to save AD groups", map[string]interface{}{
+			"error": err.Error(),
+		})
 		http.Error(w, "Failed to save AD groups", http.StatusInternalServerError)
 		return
 	}
 
-	log.Printf("Synced %d users, %d computers, %d groups", len(adUsers), len(adComputers), len(adGroups))
+	// Only groups that were imported have members in OpenPAM; a failure here
+	// leaves the previous memberships in place
+	if err := db.SyncGroupMembers(memberships); err != nil {
+		log.Error("Failed to sync group members", map[string]interface{}{
+			"error": err.Error(),
+		})
+	}
+
+	// A failure here leaves the last snapshots of the privileged groups to
+	// compare the next sync with
+	privileged, err := syncPrivilegedGroups(client)
+	if err != nil {
+		log.Error("Failed to sync privileged groups", map[string]interface{}{
+			"error": err.Error(),
+		})
+	}
+
+	log.Info("Synced Active Directory", map[string]interface{}{
+		"users":     len(adUsers),
+		"computers": len(adComputers),
+		"groups":    len(adGroups),
+	})
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(map[string]interface{}{
@@ -308,9 +446,43 @@ func SyncAD(w http.ResponseWriter, r *http.Request) {
 		"users_count":     len(adUsers),
 		"computers_count": len(adComputers),
 		"groups_count":    len(adGroups),
+		"flagged_targets": flagged,
+		"privileged":      privileged,
 	})
 }
 
+// accountStatus derives the status and password status shown for an AD user
+// from its userAccountControl and pwdLastSet attributes
+func accountStatus(uacStr, pwdLastSet string) (string, string) {
+	status := "Active"
+	passwordStatus := "Normal"
+
+	if uacStr != "" {
+		uac, err := strconv.Atoi(uacStr)
+		if err == nil {
+			// Status
+			if uac&2 != 0 { // ACCOUNTDISABLE
+				status = "Disabled"
+			} else if uac&16 != 0 { // LOCKOUT
+				status = "Locked Out"
+			}
+
+			// Password Status
+			if uac&65536 != 0 { // DONT_EXPIRE_PASSWORD
+				passwordStatus = "Never Expires"
+			} else if uac&262144 != 0 { // SMARTCARD_REQUIRED
+				passwordStatus = "Smart Card Required"
+			}
+		}
+	}
+
+	// Check pwdLastSet for Password Expired
+	if pwdLastSet == "0" {
+		status = "Password Expired"
+	}
+	return status, passwordStatus
+}
+
 func parseOU(dn string) string {
 	// Extract OU from DN (e.g., "CN=User,OU=IT,DC=example,DC=com" -> "IT")
 	// This is a simplified parser
@@ -323,24 +495,99 @@ func parseOU(dn string) string {
 	return ""
 }
 
+// Page sizes of the AD listings
+const (
+	defaultPageSize = 500
+	maxPageSize     = 1000
+)
+
+// parseADFilter reads the filter and page of an AD listing from the query:
+// search, ou, status, os, limit and offset
+func parseADFilter(r *http.Request) (db.ADFilter, error) {
+	q := r.URL.Query()
+	f := db.ADFilter{
+		Search:          strings.TrimSpace(q.Get("search")),
+		OU:              q.Get("ou"),
+		Status:          q.Get("status"),
+		OperatingSystem: q.Get("os"),
+		Limit:           defaultPageSize,
+	}
+
+	if s := q.Get("limit"); s != "" {
+		limit, err := strconv.Atoi(s)
+		if err != nil || limit < 1 {
+			return f, errors.New("invalid limit")
+		}
+		if limit > maxPageSize {
+			limit = maxPageSize
+		}
+		f.Limit = limit
+	}
+	if s := q.Get("offset"); s != "" {
+		offset, err := strconv.Atoi(s)
+		if err != nil || offset < 0 {
+			return f, errors.New("invalid offset")
+		}
+		f.Offset = offset
+	}
+	return f, nil
+}
+
 func GetADUsers(w http.ResponseWriter, r *http.Request) {
-	users, err := db.GetADUsers()
+	filter, err := parseADFilter(r)
+	if err != nil {
+		http.Error(w, "Invalid query: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	users, total, err := db.GetADUsers(filter)
 	if err != nil {
-		log.Printf("Failed to get AD users: %v", err)
+		log.Error("Failed to get AD users", map[string]interface{}{
+			"error": err.Error(),
+		})
 		http.Error(w, "Failed to get AD users", http.StatusInternalServerError)
 		return
 	}
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(map[string]interface{}{
-		"users": users,
+		"users":  users,
+		"total":  total,
+		"limit":  filter.Limit,
+		"offset": filter.Offset,
 	})
 }
 
+func GetADUser(w http.ResponseWriter, r *http.Request) {
+	user, err := db.GetADUser(mux.Vars(r)["id"])
+	if err != nil {
+		log.Error("Failed to get AD user", map[string]interface{}{
+			"error": err.Error(),
+		})
+		http.Error(w, "Failed to get AD user", http.StatusInternalServerError)
+		return
+	}
+	if user == nil {
+		http.Error(w, "AD user not found", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(user)
+}
+
 func GetADComputers(w http.ResponseWriter, r *http.Request) {
-	computers, err := db.GetADComputers()
+	filter, err := parseADFilter(r)
+	if err != nil {
+		http.Error(w, "Invalid query: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	computers, total, err := db.GetADComputers(filter)
 	if err != nil {
-		log.Printf("Failed to get AD computers: %v", err)
+		log.Error("Failed to get AD computers", map[string]interface{}{
+			"error": err.Error(),
+		})
 		http.Error(w, "Failed to get AD computers", http.StatusInternalServerError)
 		return
 	}
@@ -348,13 +595,42 @@ func GetADComputers(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(map[string]interface{}{
 		"computers": computers,
+		"total":     total,
+		"limit":     filter.Limit,
+		"offset":    filter.Offset,
 	})
 }
 
+func GetADComputer(w http.ResponseWriter, r *http.Request) {
+	computer, err := db.GetADComputer(mux.Vars(r)["id"])
+	if err != nil {
+		log.Error("Failed to get AD computer", map[string]interface{}{
+			"error": err.Error(),
+		})
+		http.Error(w, "Failed to get AD computer", http.StatusInternalServerError)
+		return
+	}
+	if computer == nil {
+		http.Error(w, "AD computer not found", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(computer)
+}
+
 func GetADGroups(w http.ResponseWriter, r *http.Request) {
-	groups, err := db.GetADGroups()
+	filter, err := parseADFilter(r)
 	if err != nil {
-		log.Printf("Failed to get AD groups: %v", err)
+		http.Error(w, "Invalid query: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	groups, total, err := db.GetADGroups(filter)
+	if err != nil {
+		log.Error("Failed to get AD groups", map[string]interface{}{
+			"error": err.Error(),
+		})
 		http.Error(w, "Failed to get AD groups", http.StatusInternalServerError)
 		return
 	}
@@ -362,6 +638,9 @@ func GetADGroups(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(map[string]interface{}{
 		"groups": groups,
+		"total":  total,
+		"limit":  filter.Limit,
+		"offset": filter.Offset,
 	})
 }
 
@@ -376,72 +655,64 @@ func ImportADUser(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Get AD user details
-	adUsers, err := db.GetADUsers() // TODO: Optimize to get single user
+	targetUser, err := db.GetADUser(req.ADUserID)
 	if err != nil {
-		http.Error(w, "Failed to fetch AD users", http.StatusInternalServerError)
+		http.Error(w, "Failed to fetch AD user", http.StatusInternalServerError)
 		return
 	}
 
-	var targetUser *db.ADUser
-	for _, u := range adUsers {
-		if u.ID == req.ADUserID {
-			targetUser = &u
-			break
-		}
-	}
-
 	if targetUser == nil {
-		log.Printf("AD user not found for ID: %s", req.ADUserID)
+		log.Warn("AD user not found", map[string]interface{}{
+			"ad_user_id": req.ADUserID,
+		})
 		http.Error(w, "AD user not found", http.StatusNotFound)
 		return
 	}
 
-	// Create OpenPAM user or Managed Account
+	if err := importADUser(targetUser, req.Role); err != nil {
+		log.Error("Failed to import AD user", map[string]interface{}{
+			"ad_user_id": targetUser.ID,
+			"role":       req.Role,
+			"error":      err.Error(),
+		})
+		http.Error(w, "Failed to import user", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]string{"status": "success"})
+}
+
+// importADUser imports an AD user as an OpenPAM user with role, or as a
+// managed account for the role "managed". Users keep their AD user's ID.
+func importADUser(u *db.ADUser, role string) error {
 	// Check if email exists, fallback to UPN or dummy
-	email := targetUser.Mail
+	email := u.Mail
 	if email == "" {
-		email = targetUser.UserPrincipalName
+		email = u.UserPrincipalName
 	}
 	if email == "" {
-		email = fmt.Sprintf("%s@ad.local", targetUser.SAMAccountName)
+		email = fmt.Sprintf("%s@ad.local", u.SAMAccountName)
 	}
 
-	if req.Role == "managed" {
-		// Save to managed_accounts table
-		account := db.ManagedAccount{
-			ID:          targetUser.ID,
-			EntraID:     targetUser.SAMAccountName,
+	if role == roleManaged {
+		return db.SaveManagedAccount(db.ManagedAccount{
+			ID:          u.ID,
+			EntraID:     u.SAMAccountName,
 			Email:       email,
-			DisplayName: targetUser.DisplayName,
+			DisplayName: u.DisplayName,
 			Source:      "active_directory",
-		}
-
-		if err := db.SaveManagedAccounts([]db.ManagedAccount{account}); err != nil {
-			log.Printf("Failed to import managed account: %v", err)
-			http.Error(w, "Failed to import managed account", http.StatusInternalServerError)
-			return
-		}
-	} else {
-		// Save to users table
-		user := db.User{
-			ID:          targetUser.ID, // Use same ID
-			EntraID:     targetUser.SAMAccountName,
-			Email:       email,
-			DisplayName: targetUser.DisplayName,
-			Role:        req.Role,
-			Enabled:     true, // Default to enabled
-			Source:      "active_directory",
-		}
-
-		if err := db.SaveUsers([]db.User{user}); err != nil {
-			log.Printf("Failed to import AD user: %v", err)
-			http.Error(w, "Failed to import user", http.StatusInternalServerError)
-			return
-		}
+		})
 	}
-
-	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode(map[string]string{"status": "success"})
+	return db.SaveUser(db.User{
+		ID:          u.ID,
+		EntraID:     u.SAMAccountName,
+		Email:       email,
+		DisplayName: u.DisplayName,
+		Role:        role,
+		Enabled:     true, // Default to enabled
+		Source:      "active_directory",
+	})
 }
 
 func ImportADGroup(w http.ResponseWriter, r *http.Request) {
@@ -451,48 +722,39 @@ func ImportADGroup(w http.ResponseWriter, r *http.Request) {
 	}
 	// Debug logging
 	bodyBytes, _ := io.ReadAll(r.Body)
-	log.Printf("ImportADGroup received body: %s", string(bodyBytes))
+	log.Debug("ImportADGroup received body", map[string]interface{}{
+		"body": string(bodyBytes),
+	})
 	r.Body = io.NopCloser(bytes.NewBuffer(bodyBytes))
 
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		log.Printf("Failed to decode request body: %v", err)
+		log.Error("Failed to decode request body", map[string]interface{}{
+			"error": err.Error(),
+		})
 		http.Error(w, "Invalid request body", http.StatusBadRequest)
 		return
 	}
 
 	// Get AD group details
-	adGroups, err := db.GetADGroups() // TODO: Optimize
+	targetGroup, err := db.GetADGroup(req.ADGroupID)
 	if err != nil {
-		http.Error(w, "Failed to fetch AD groups", http.StatusInternalServerError)
+		http.Error(w, "Failed to fetch AD group", http.StatusInternalServerError)
 		return
 	}
 
-	var targetGroup *db.ADGroup
-	for _, g := range adGroups {
-		if g.ID == req.ADGroupID {
-			targetGroup = &g
-			break
-		}
-	}
-
 	if targetGroup == nil {
-		log.Printf("AD group not found for ID: %s", req.ADGroupID)
+		log.Warn("AD group not found", map[string]interface{}{
+			"ad_group_id": req.ADGroupID,
+		})
 		http.Error(w, "AD group not found", http.StatusNotFound)
 		return
 	}
 
-	// Save to groups table
-	group := db.Group{
-		ID:          targetGroup.ID,
-		Name:        targetGroup.Name,
-		DN:          targetGroup.DN,
-		Description: targetGroup.Description,
-		Role:        req.Role,
-		Source:      "active_directory",
-	}
-
-	if err := db.SaveGroups([]db.Group{group}); err != nil {
-		log.Printf("Failed to import AD group: %v", err)
+	if err := importADGroup(targetGroup, req.Role); err != nil {
+		log.Error("Failed to import AD group", map[string]interface{}{
+			"ad_group_id": targetGroup.ID,
+			"error":       err.Error(),
+		})
 		http.Error(w, "Failed to import group", http.StatusInternalServerError)
 		return
 	}
@@ -501,6 +763,18 @@ func ImportADGroup(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(map[string]string{"status": "success"})
 }
 
+// importADGroup imports an AD group, whose members get role
+func importADGroup(g *db.ADGroup, role string) error {
+	return db.SaveGroup(db.Group{
+		ID:          g.ID,
+		Name:        g.Name,
+		DN:          g.DN,
+		Description: g.Description,
+		Role:        role,
+		Source:      "active_directory",
+	})
+}
+
 func ImportADComputer(w http.ResponseWriter, r *http.Request) {
 	var req struct {
 		ADComputerID string `json:"ad_computer_id"`
@@ -513,49 +787,26 @@ func ImportADComputer(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Defaults
-	if req.Protocol == "" {
-		req.Protocol = "rdp"
-	}
-	if req.Port == 0 {
-		req.Port = 3389
-	}
-
 	// Get AD computer details
-	adComputers, err := db.GetADComputers() // TODO: Optimize
+	targetComputer, err := db.GetADComputer(req.ADComputerID)
 	if err != nil {
-		http.Error(w, "Failed to fetch AD computers", http.StatusInternalServerError)
+		http.Error(w, "Failed to fetch AD computer", http.StatusInternalServerError)
 		return
 	}
 
-	var targetComputer *db.ADComputer
-	for _, c := range adComputers {
-		if c.ID == req.ADComputerID {
-			targetComputer = &c
-			break
-		}
-	}
-
 	if targetComputer == nil {
-		log.Printf("AD computer not found for ID: %s", req.ADComputerID)
+		log.Warn("AD computer not found", map[string]interface{}{
+			"ad_computer_id": req.ADComputerID,
+		})
 		http.Error(w, "AD computer not found", http.StatusNotFound)
 		return
 	}
 
-	// Save to targets table
-	target := db.Target{
-		ID:          uuid.New().String(),
-		ZoneID:      req.ZoneID,
-		Name:        targetComputer.Name,
-		Hostname:    targetComputer.DNSHostName,
-		Protocol:    req.Protocol,
-		Port:        req.Port,
-		Description: fmt.Sprintf("Imported from AD: %s", targetComputer.DN),
-		Enabled:     true,
-	}
-
-	if err := db.SaveTargets([]db.Target{target}); err != nil {
-		log.Printf("Failed to import AD computer: %v", err)
+	if _, err := importADComputer(targetComputer, req.ZoneID, req.Protocol, req.Port); err != nil {
+		log.Error("Failed to import AD computer", map[string]interface{}{
+			"ad_computer_id": targetComputer.ID,
+			"error":          err.Error(),
+		})
 		http.Error(w, "Failed to import computer", http.StatusInternalServerError)
 		return
 	}
@@ -564,10 +815,52 @@ func ImportADComputer(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(map[string]string{"status": "success"})
 }
 
+// importADComputer imports an AD computer as a target in the zone and
+// returns the target's ID. The protocol defaults to RDP, and the port to
+// the protocol's.
+func importADComputer(c *db.ADComputer, zoneID, protocol string, port int) (string, error) {
+	if protocol == "" {
+		protocol = "rdp"
+	}
+	if port == 0 {
+		port = 3389
+		if protocol == "ssh" {
+			port = 22
+		}
+	}
+
+	target := db.Target{
+		ID:       uuid.New().String(),
+		ZoneID:   zoneID,
+		Name:     c.Name,
+		Hostname: c.DNSHostName,
+		Protocol: protocol,
+		Port:     port,
+		Labels:   map[string]string{"source": "active-directory", "ad-dn": c.DN},
+		Enabled:  true,
+	}
+	if err := db.SaveTarget(target); err != nil {
+		return "", err
+	}
+
+	// The target stays linked to the computer, to reconcile it when the
+	// computer is disabled or deleted
+	if err := db.LinkComputerTarget(target.ID, c.ID); err != nil {
+		log.Error("Failed to link target to AD computer", map[string]interface{}{
+			"target_id":      target.ID,
+			"ad_computer_id": c.ID,
+			"error":          err.Error(),
+		})
+	}
+	return target.ID, nil
+}
+
 func GetUsers(w http.ResponseWriter, r *http.Request) {
 	users, err := db.GetUsers()
 	if err != nil {
-		log.Printf("Failed to get users: %v", err)
+		log.Error("Failed to get users", map[string]interface{}{
+			"error": err.Error(),
+		})
 		http.Error(w, "Failed to get users", http.StatusInternalServerError)
 		return
 	}
@@ -581,7 +874,9 @@ func GetUsers(w http.ResponseWriter, r *http.Request) {
 func GetManagedAccounts(w http.ResponseWriter, r *http.Request) {
 	accounts, err := db.GetManagedAccounts()
 	if err != nil {
-		log.Printf("Failed to get managed accounts: %v", err)
+		log.Error("Failed to get managed accounts", map[string]interface{}{
+			"error": err.Error(),
+		})
 		http.Error(w, "Failed to get managed accounts", http.StatusInternalServerError)
 		return
 	}
@@ -595,7 +890,9 @@ func GetManagedAccounts(w http.ResponseWriter, r *http.Request) {
 func GetComputers(w http.ResponseWriter, r *http.Request) {
 	computers, err := db.GetComputers()
 	if err != nil {
-		log.Printf("Failed to get computers: %v", err)
+		log.Error("Failed to get computers", map[string]interface{}{
+			"error": err.Error(),
+		})
 		http.Error(w, "Failed to get computers", http.StatusInternalServerError)
 		return
 	}
@@ -0,0 +1,193 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/VanCannon/openpam/identity/internal/db"
+	"github.com/VanCannon/openpam/pkg/servicetoken"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/gorilla/mux"
+)
+
+const testSecret = "test-secret"
+
+// fakeConfig stands in for the AD configuration in the database
+type fakeConfig struct {
+	host, bindDN, bindPassword string
+	saves                      int
+}
+
+func (f *fakeConfig) install(t *testing.T) {
+	t.Helper()
+
+	get, save, getGroups, saveGroups := getConfig, saveConfig, getPrivilegedGroups, savePrivilegedGroups
+	t.Cleanup(func() {
+		getConfig, saveConfig, getPrivilegedGroups, savePrivilegedGroups = get, save, getGroups, saveGroups
+	})
+
+	getConfig = func() (string, int, string, string, string, string, string, string, error) {
+		return f.host, 389, "DC=corp,DC=example", f.bindDN, f.bindPassword, "", "", "", nil
+	}
+	saveConfig = func(host string, port int, baseDN, bindDN, bindPassword, userFilter, computerFilter, groupFilter string) error {
+		f.host, f.bindDN, f.bindPassword = host, bindDN, bindPassword
+		f.saves++
+		return nil
+	}
+	getPrivilegedGroups = func() ([]string, error) {
+		return []string{"Domain Admins"}, nil
+	}
+	savePrivilegedGroups = func(groups []string) error {
+		return nil
+	}
+}
+
+// userToken signs a gateway session token for a user with role
+func userToken(t *testing.T, role string) string {
+	t.Helper()
+
+	now := time.Now()
+	claims := servicetoken.Claims{
+		UserID: "4c7f7c5e-2d0b-4a7e-9b43-8d3c1e2f5a61",
+		Email:  role + "@example.com",
+		Role:   role,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ExpiresAt: jwt.NewNumericDate(now.Add(time.Hour)),
+			IssuedAt:  jwt.NewNumericDate(now),
+			Issuer:    "openpam",
+		},
+	}
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte(testSecret))
+	if err != nil {
+		t.Fatalf("failed to sign token: %v", err)
+	}
+	return token
+}
+
+func serve(t *testing.T, token, method, path, body string) *httptest.ResponseRecorder {
+	t.Helper()
+
+	r := mux.NewRouter()
+	RegisterRoutes(r, NewAuth(testSecret, nil))
+
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	req.Header.Set("Authorization", "Bearer "+token)
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestRegisterRoutes_Roles(t *testing.T) {
+	(&fakeConfig{}).install(t)
+
+	service, err := servicetoken.Issue([]byte(testSecret), "gateway")
+	if err != nil {
+		t.Fatalf("Issue() error = %v", err)
+	}
+
+	tests := []struct {
+		name   string
+		token  string
+		method string
+		path   string
+		want   int
+	}{
+		{"auditor reads the config", userToken(t, roleAuditor), http.MethodGet, "/api/v1/identity/config", http.StatusForbidden},
+		{"auditor saves the config", userToken(t, roleAuditor), http.MethodPost, "/api/v1/identity/config", http.StatusForbidden},
+		{"service saves the config", service, http.MethodPost, "/api/v1/identity/config", http.StatusForbidden},
+		{"user lists AD users", userToken(t, roleUser), http.MethodGet, "/api/v1/ad-users", http.StatusForbidden},
+		{"user checks credentials", userToken(t, roleUser), http.MethodPost, "/api/v1/identity/auth", http.StatusForbidden},
+		{"admin reads the config", userToken(t, roleAdmin), http.MethodGet, "/api/v1/identity/config", http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := serve(t, tt.token, tt.method, tt.path, `{}`)
+			if rec.Code != tt.want {
+				t.Errorf("status = %d, want %d: %s", rec.Code, tt.want, rec.Body)
+			}
+		})
+	}
+}
+
+func TestGetConfig_RedactsBindPassword(t *testing.T) {
+	(&fakeConfig{host: "dc1.corp.example", bindDN: "CN=svc,DC=corp,DC=example", bindPassword: "hunter2"}).install(t)
+
+	rec := serve(t, userToken(t, roleAdmin), http.MethodGet, "/api/v1/identity/config", "")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d: %s", rec.Code, rec.Body)
+	}
+	if strings.Contains(rec.Body.String(), "hunter2") || strings.Contains(rec.Body.String(), `"bind_password"`) {
+		t.Errorf("response exposes the bind password: %s", rec.Body)
+	}
+
+	var config ConfigResponse
+	if err := json.NewDecoder(rec.Body).Decode(&config); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	if !config.BindPasswordSet || config.Host != "dc1.corp.example" {
+		t.Errorf("config = %+v, want the host and bind_password_set", config)
+	}
+}
+
+func TestSaveConfig_BlankPasswordKeepsStored(t *testing.T) {
+	config := &fakeConfig{host: "dc1.corp.example", bindPassword: "hunter2"}
+	config.install(t)
+	admin := userToken(t, roleAdmin)
+
+	rec := serve(t, admin, http.MethodPost, "/api/v1/identity/config", `{"host":"dc2.corp.example","port":389,"bind_dn":"CN=svc,DC=corp,DC=example","bind_password":""}`)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d: %s", rec.Code, rec.Body)
+	}
+	if config.saves != 1 || config.host != "dc2.corp.example" || config.bindPassword != "hunter2" {
+		t.Errorf("saved host %q and password %q, want the new host and the stored password", config.host, config.bindPassword)
+	}
+
+	// A new password replaces it
+	serve(t, admin, http.MethodPost, "/api/v1/identity/config", `{"host":"dc2.corp.example","bind_password":"correct-horse"}`)
+	if config.bindPassword != "correct-horse" {
+		t.Errorf("saved password %q, want the new one", config.bindPassword)
+	}
+}
+
+func TestParseADFilter(t *testing.T) {
+	tests := []struct {
+		name    string
+		query   string
+		want    db.ADFilter
+		wantErr bool
+	}{
+		{name: "defaults", query: "", want: db.ADFilter{Limit: defaultPageSize}},
+		{name: "filters", query: "search=+web+&ou=Servers&status=active&os=linux", want: db.ADFilter{Search: "web", OU: "Servers", Status: "active", OperatingSystem: "linux", Limit: defaultPageSize}},
+		{name: "first page", query: "limit=50", want: db.ADFilter{Limit: 50}},
+		{name: "next page", query: "limit=50&offset=50", want: db.ADFilter{Limit: 50, Offset: 50}},
+		{name: "page past the limit", query: "limit=5000&offset=1000", want: db.ADFilter{Limit: maxPageSize, Offset: 1000}},
+		{name: "zero limit", query: "limit=0", wantErr: true},
+		{name: "limit not a number", query: "limit=all", wantErr: true},
+		{name: "negative offset", query: "offset=-1", wantErr: true},
+		{name: "offset not a number", query: "offset=next", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/api/v1/ad-computers?"+tt.query, nil)
+			got, err := parseADFilter(r)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("parseADFilter() = %+v, want an error", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseADFilter() error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("parseADFilter() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
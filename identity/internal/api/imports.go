@@ -0,0 +1,591 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/VanCannon/openpam/identity/internal/db"
+	"github.com/VanCannon/openpam/identity/internal/ldap"
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+)
+
+// JobTypeADImport is the orchestrator job type bulk imports run as
+const JobTypeADImport = "identity.ad_import"
+
+// EventTypeADBulkImport is the system audit event of a finished bulk import
+const EventTypeADBulkImport = "ad_bulk_import"
+
+// Kinds of AD object an import rule imports
+const (
+	ImportUsers     = "users"
+	ImportGroups    = "groups"
+	ImportComputers = "computers"
+)
+
+// Outcomes of importing an AD object
+const (
+	ItemImported = "imported"
+	ItemSkipped  = "skipped" // Already imported, or not importable
+	ItemFailed   = "failed"
+)
+
+// Attempts a bulk import gets. Objects imported by a failed attempt are
+// skipped by the next one.
+const importMaxAttempts = 3
+
+// progressEvery is how many objects are imported between progress reports
+const progressEvery = 25
+
+// ImportRule maps the AD objects it selects to what they are imported as.
+// Objects are selected by exactly one of IDs, Group (users only) and OU.
+type ImportRule struct {
+	Kind  string   `json:"kind"`
+	IDs   []string `json:"ids,omitempty"`
+	Group string   `json:"group,omitempty"` // By name or DN; members of nested groups are included
+	OU    string   `json:"ou,omitempty"`    // By DN; objects in OUs below it are included
+
+	Role     string `json:"role,omitempty"`     // Users and groups; "managed" imports users as managed accounts
+	ZoneID   string `json:"zone_id,omitempty"`  // Computers
+	Protocol string `json:"protocol,omitempty"` // Computers; rdp (default) or ssh
+	Port     int    `json:"port,omitempty"`     // Computers; defaults to the protocol's
+}
+
+func (r *ImportRule) validate() error {
+	selectors := 0
+	for _, set := range []bool{len(r.IDs) > 0, r.Group != "", r.OU != ""} {
+		if set {
+			selectors++
+		}
+	}
+	if selectors != 1 {
+		return errors.New("set exactly one of ids, group and ou")
+	}
+	if r.OU != "" && !strings.Contains(r.OU, "=") {
+		return errors.New("ou must be the OU's distinguished name")
+	}
+	if r.Group != "" && r.Kind != ImportUsers {
+		return errors.New("group only selects users")
+	}
+
+	switch r.Kind {
+	case ImportUsers:
+		if r.Role != roleAdmin && r.Role != roleAuditor && r.Role != roleUser && r.Role != roleManaged {
+			return errors.New("role must be admin, auditor, user or managed")
+		}
+	case ImportGroups:
+		if r.Role != roleAdmin && r.Role != roleAuditor && r.Role != roleUser {
+			return errors.New("role must be admin, auditor or user")
+		}
+	case ImportComputers:
+		if _, err := uuid.Parse(r.ZoneID); err != nil {
+			return errors.New("zone_id must be a zone ID")
+		}
+		if r.Protocol != "" && r.Protocol != "rdp" && r.Protocol != "ssh" {
+			return errors.New("protocol must be rdp or ssh")
+		}
+		if r.Port < 0 || r.Port > 65535 {
+			return errors.New("port must be from 1 to 65535")
+		}
+	default:
+		return errors.New("kind must be users, groups or computers")
+	}
+	return nil
+}
+
+type BulkImportRequest struct {
+	Rules []ImportRule `json:"rules"`
+}
+
+func (req *BulkImportRequest) validate() error {
+	if len(req.Rules) == 0 {
+		return errors.New("rules are required")
+	}
+	for i := range req.Rules {
+		if err := req.Rules[i].validate(); err != nil {
+			return fmt.Errorf("rule %d: %v", i, err)
+		}
+	}
+	return nil
+}
+
+// importJob is the payload of a bulk import job: the rules, and who asked
+// for the import from where, for its audit record
+type importJob struct {
+	BulkImportRequest
+	RequestedBy string `json:"requested_by"`
+	IPAddress   string `json:"ip_address,omitempty"`
+	UserAgent   string `json:"user_agent,omitempty"`
+}
+
+// ImportItem is the outcome of importing one AD object
+type ImportItem struct {
+	Rule     int    `json:"rule"` // Index of the rule that selected it
+	Kind     string `json:"kind"`
+	ID       string `json:"id,omitempty"`
+	Name     string `json:"name"`
+	Status   string `json:"status"`
+	Message  string `json:"message,omitempty"`
+	TargetID string `json:"target_id,omitempty"` // Computers
+}
+
+// ImportProgress counts the AD objects of a bulk import and their outcomes
+type ImportProgress struct {
+	Total    int `json:"total"`
+	Done     int `json:"done"`
+	Imported int `json:"imported"`
+	Skipped  int `json:"skipped"`
+	Failed   int `json:"failed"`
+}
+
+func (p *ImportProgress) count(status string) {
+	p.Done++
+	switch status {
+	case ItemImported:
+		p.Imported++
+	case ItemSkipped:
+		p.Skipped++
+	default:
+		p.Failed++
+	}
+}
+
+// ImportResult is the result of a bulk import job
+type ImportResult struct {
+	ImportProgress
+	Items []ImportItem `json:"items"`
+}
+
+// pendingImport is an AD object selected by a rule, or an item already
+// settled while resolving the rules
+type pendingImport struct {
+	item     ImportItem
+	rule     *ImportRule
+	user     *db.ADUser
+	group    *db.ADGroup
+	computer *db.ADComputer
+}
+
+// QueueADImport queues a bulk import of AD objects by mapping rules, such as
+// all members of a group as users with a role, or all computers in an OU as
+// RDP targets in a zone. The import runs as an orchestrator job, whose
+// progress and per-object results GetADImport returns.
+func QueueADImport(w http.ResponseWriter, r *http.Request) {
+	var req BulkImportRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if err := req.validate(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	actorID := callerFromContext(r.Context()).UserID
+	if _, err := uuid.Parse(actorID); err != nil {
+		http.Error(w, "Bulk imports must be requested by a user", http.StatusForbidden)
+		return
+	}
+
+	job, err := orchestrator.Enqueue(r.Context(), JobTypeADImport, importJob{
+		BulkImportRequest: req,
+		RequestedBy:       actorID,
+		IPAddress:         clientIP(r),
+		UserAgent:         r.UserAgent(),
+	}, importMaxAttempts)
+	if err != nil {
+		log.Error("Failed to queue AD import", map[string]interface{}{
+			"error": err.Error(),
+		})
+		http.Error(w, "Failed to queue import", http.StatusBadGateway)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	w.Write(job)
+}
+
+// GetADImport returns a bulk import job: its status, its progress while it
+// runs and its per-object results once it succeeded
+func GetADImport(w http.ResponseWriter, r *http.Request) {
+	job, err := orchestrator.Job(r.Context(), mux.Vars(r)["job_id"])
+	if err == errJobNotFound {
+		http.Error(w, "Import not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Error("Failed to get AD import", map[string]interface{}{
+			"error": err.Error(),
+		})
+		http.Error(w, "Failed to get import", http.StatusBadGateway)
+		return
+	}
+
+	var kind struct {
+		Type string `json:"type"`
+	}
+	if json.Unmarshal(job, &kind) != nil || kind.Type != JobTypeADImport {
+		http.Error(w, "Import not found", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(job)
+}
+
+// RunADImport runs a bulk import job handed over by the orchestrator. Each
+// selected object is imported unless it already was, so a retried job picks
+// up where the failed attempt stopped. Objects selected by several rules are
+// imported by the first. Failures to reach the directory or database fail
+// the attempt, while objects that fail to import are reported in the result.
+func RunADImport(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		JobID   string    `json:"job_id"`
+		Payload importJob `json:"payload"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if err := req.Payload.validate(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	ctx := r.Context()
+
+	pending, err := resolveImport(req.Payload.Rules)
+	if err != nil {
+		log.Error("Failed to resolve AD import rules", map[string]interface{}{
+			"job_id": req.JobID,
+			"error":  err.Error(),
+		})
+		http.Error(w, "Failed to resolve import rules", http.StatusInternalServerError)
+		return
+	}
+
+	result := ImportResult{Items: make([]ImportItem, 0, len(pending))}
+	result.Total = len(pending)
+	reportImportProgress(ctx, req.JobID, result.ImportProgress)
+
+	for i := range pending {
+		if ctx.Err() != nil {
+			log.Warn("AD import stopped", map[string]interface{}{
+				"job_id": req.JobID,
+				"done":   result.Done,
+				"total":  result.Total,
+			})
+			return
+		}
+
+		item, err := runImport(&pending[i])
+		if err != nil {
+			log.Error("Failed to import AD object", map[string]interface{}{
+				"job_id": req.JobID,
+				"kind":   item.Kind,
+				"id":     item.ID,
+				"error":  err.Error(),
+			})
+			http.Error(w, "Failed to import "+item.Name, http.StatusInternalServerError)
+			return
+		}
+		result.Items = append(result.Items, item)
+		result.count(item.Status)
+
+		if result.Done%progressEvery == 0 {
+			reportImportProgress(ctx, req.JobID, result.ImportProgress)
+		}
+	}
+	reportImportProgress(ctx, req.JobID, result.ImportProgress)
+
+	status := "success"
+	if result.Failed > 0 {
+		status = "failure"
+	}
+	recordAudit(&db.SystemAuditLog{
+		EventType:    EventTypeADBulkImport,
+		UserID:       req.Payload.RequestedBy,
+		ResourceType: "job",
+		ResourceID:   req.JobID,
+		ResourceName: JobTypeADImport,
+		Action:       "import",
+		IPAddress:    req.Payload.IPAddress,
+		UserAgent:    req.Payload.UserAgent,
+		Details: map[string]interface{}{
+			"rules":    req.Payload.Rules,
+			"total":    result.Total,
+			"imported": result.Imported,
+			"skipped":  result.Skipped,
+			"failed":   result.Failed,
+		},
+	}, status)
+
+	log.Info("Ran AD import", map[string]interface{}{
+		"job_id":   req.JobID,
+		"total":    result.Total,
+		"imported": result.Imported,
+		"skipped":  result.Skipped,
+		"failed":   result.Failed,
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
+}
+
+// reportImportProgress reports a bulk import's progress to the orchestrator.
+// A failure only costs the report.
+func reportImportProgress(ctx context.Context, jobID string, progress ImportProgress) {
+	if jobID == "" {
+		return
+	}
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	if err := orchestrator.ReportProgress(ctx, jobID, progress); err != nil {
+		log.Warn("Failed to report AD import progress", map[string]interface{}{
+			"job_id": jobID,
+			"error":  err.Error(),
+		})
+	}
+}
+
+// resolveImport selects the AD objects of each rule. The directory is only
+// searched for rules selecting the members of a group.
+func resolveImport(rules []ImportRule) ([]pendingImport, error) {
+	var client *ldap.Client
+	defer func() {
+		if client != nil {
+			client.Close()
+		}
+	}()
+
+	var pending []pendingImport
+	seen := make(map[string]bool)
+	add := func(p pendingImport) {
+		if p.item.ID != "" {
+			key := p.item.Kind + "/" + p.item.ID
+			if seen[key] {
+				return
+			}
+			seen[key] = true
+		}
+		pending = append(pending, p)
+	}
+
+	for i := range rules {
+		rule := &rules[i]
+		base := ImportItem{Rule: i, Kind: rule.Kind}
+		settled := func(id, name, status, message string) {
+			item := base
+			item.ID, item.Name, item.Status, item.Message = id, name, status, message
+			add(pendingImport{item: item})
+		}
+
+		switch {
+		case rule.Kind == ImportUsers && rule.Group != "":
+			if client == nil {
+				var err error
+				if client, err = connectAD(); err != nil {
+					return nil, err
+				}
+			}
+			entries, err := client.SearchPrivilegedGroups([]string{rule.Group})
+			if err != nil {
+				return nil, err
+			}
+			if len(entries) == 0 {
+				settled("", rule.Group, ItemFailed, "AD group not found")
+				continue
+			}
+			for _, e := range entries {
+				members, err := client.GroupMembers(e.DN, e.GetAttributeValues("member"))
+				if err != nil {
+					return nil, err
+				}
+				dns := make([]string, len(members))
+				for j, m := range members {
+					dns[j] = m.DN
+				}
+				users, err := db.GetADUsersByDN(dns)
+				if err != nil {
+					return nil, err
+				}
+				synced := make(map[string]bool, len(users))
+				for j := range users {
+					synced[strings.ToLower(users[j].DN)] = true
+					add(userImport(base, rule, &users[j]))
+				}
+				for _, m := range members {
+					if !synced[strings.ToLower(m.DN)] {
+						settled("", m.SAMAccountName, ItemSkipped, "not synced from AD yet")
+					}
+				}
+			}
+
+		case rule.Kind == ImportUsers && rule.OU != "":
+			users, err := db.GetADUsersInOU(rule.OU)
+			if err != nil {
+				return nil, err
+			}
+			for j := range users {
+				add(userImport(base, rule, &users[j]))
+			}
+
+		case rule.Kind == ImportUsers:
+			for _, id := range rule.IDs {
+				u, err := db.GetADUser(id)
+				if err != nil {
+					return nil, err
+				}
+				if u == nil {
+					settled(id, id, ItemFailed, "AD user not found")
+					continue
+				}
+				add(userImport(base, rule, u))
+			}
+
+		case rule.Kind == ImportGroups && rule.OU != "":
+			groups, err := db.GetADGroupsInOU(rule.OU)
+			if err != nil {
+				return nil, err
+			}
+			for j := range groups {
+				add(groupImport(base, rule, &groups[j]))
+			}
+
+		case rule.Kind == ImportGroups:
+			for _, id := range rule.IDs {
+				g, err := db.GetADGroup(id)
+				if err != nil {
+					return nil, err
+				}
+				if g == nil {
+					settled(id, id, ItemFailed, "AD group not found")
+					continue
+				}
+				add(groupImport(base, rule, g))
+			}
+
+		case rule.Kind == ImportComputers && rule.OU != "":
+			computers, err := db.GetADComputersInOU(rule.OU)
+			if err != nil {
+				return nil, err
+			}
+			for j := range computers {
+				add(computerImport(base, rule, &computers[j]))
+			}
+
+		case rule.Kind == ImportComputers:
+			for _, id := range rule.IDs {
+				c, err := db.GetADComputer(id)
+				if err != nil {
+					return nil, err
+				}
+				if c == nil {
+					settled(id, id, ItemFailed, "AD computer not found")
+					continue
+				}
+				add(computerImport(base, rule, c))
+			}
+		}
+	}
+	return pending, nil
+}
+
+func userImport(base ImportItem, rule *ImportRule, u *db.ADUser) pendingImport {
+	base.ID, base.Name = u.ID, u.SAMAccountName
+	return pendingImport{item: base, rule: rule, user: u}
+}
+
+func groupImport(base ImportItem, rule *ImportRule, g *db.ADGroup) pendingImport {
+	base.ID, base.Name = g.ID, g.Name
+	return pendingImport{item: base, rule: rule, group: g}
+}
+
+func computerImport(base ImportItem, rule *ImportRule, c *db.ADComputer) pendingImport {
+	base.ID, base.Name = c.ID, c.Name
+	return pendingImport{item: base, rule: rule, computer: c}
+}
+
+// runImport imports a selected AD object, unless it already was imported.
+// The error is that of checking whether it was; failing to import it only
+// fails the item.
+func runImport(p *pendingImport) (ImportItem, error) {
+	item := p.item
+	if item.Status != "" {
+		return item, nil
+	}
+
+	var err error
+	switch {
+	case p.user != nil:
+		imported, checkErr := db.UserImported(p.user.ID)
+		if checkErr != nil {
+			return item, checkErr
+		}
+		if imported {
+			item.Status, item.Message = ItemSkipped, "already imported"
+			return item, nil
+		}
+		err = importADUser(p.user, p.rule.Role)
+
+	case p.group != nil:
+		imported, checkErr := db.GroupImported(p.group.ID)
+		if checkErr != nil {
+			return item, checkErr
+		}
+		if imported {
+			item.Status, item.Message = ItemSkipped, "already imported"
+			return item, nil
+		}
+		err = importADGroup(p.group, p.rule.Role)
+
+	case p.computer != nil:
+		if p.computer.DeletedAt != nil {
+			item.Status, item.Message = ItemSkipped, "deleted from AD"
+			return item, nil
+		}
+		if !p.computer.Enabled {
+			item.Status, item.Message = ItemSkipped, "disabled in AD"
+			return item, nil
+		}
+		targetID, checkErr := db.ComputerImported(p.computer.ID)
+		if checkErr != nil {
+			return item, checkErr
+		}
+		if targetID != "" {
+			item.Status, item.Message, item.TargetID = ItemSkipped, "already imported", targetID
+			return item, nil
+		}
+		item.TargetID, err = importADComputer(p.computer, p.rule.ZoneID, p.rule.Protocol, p.rule.Port)
+	}
+
+	if err != nil {
+		item.Status, item.Message = ItemFailed, err.Error()
+	} else {
+		item.Status = ItemImported
+	}
+	return item, nil
+}
+
+// connectAD connects to the configured directory
+func connectAD() (*ldap.Client, error) {
+	host, port, baseDN, bindDN, bindPassword, _, _, _, err := db.GetConfig()
+	if err != nil {
+		return nil, err
+	}
+	if host == "" {
+		return nil, errors.New("AD configuration not found")
+	}
+
+	client := ldap.NewClient(host, port, baseDN, bindDN, bindPassword)
+	if err := client.Connect(); err != nil {
+		return nil, err
+	}
+	return client, nil
+}
@@ -0,0 +1,70 @@
+package api
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestImportRule_Validate(t *testing.T) {
+	zone := "6f1c2f4e-8d6a-4b8e-9a55-3f1d2c7b9e10"
+	tests := []struct {
+		name    string
+		rule    ImportRule
+		wantErr string
+	}{
+		{name: "users by ID", rule: ImportRule{Kind: ImportUsers, IDs: []string{"a"}, Role: "user"}},
+		{name: "group members as managed accounts", rule: ImportRule{Kind: ImportUsers, Group: "Domain Admins", Role: "managed"}},
+		{name: "groups in an OU", rule: ImportRule{Kind: ImportGroups, OU: "OU=Groups,DC=corp,DC=example", Role: "auditor"}},
+		{name: "computers in an OU", rule: ImportRule{Kind: ImportComputers, OU: "OU=Servers,DC=corp,DC=example", ZoneID: zone}},
+		{name: "computers over SSH", rule: ImportRule{Kind: ImportComputers, IDs: []string{"c"}, ZoneID: zone, Protocol: "ssh", Port: 2222}},
+		{name: "no selector", rule: ImportRule{Kind: ImportUsers, Role: "user"}, wantErr: "exactly one"},
+		{name: "two selectors", rule: ImportRule{Kind: ImportUsers, IDs: []string{"a"}, OU: "OU=IT,DC=corp", Role: "user"}, wantErr: "exactly one"},
+		{name: "OU by name", rule: ImportRule{Kind: ImportUsers, OU: "IT", Role: "user"}, wantErr: "distinguished name"},
+		{name: "group selecting computers", rule: ImportRule{Kind: ImportComputers, Group: "Servers", ZoneID: zone}, wantErr: "only selects users"},
+		{name: "unknown role", rule: ImportRule{Kind: ImportUsers, IDs: []string{"a"}, Role: "root"}, wantErr: "role"},
+		{name: "managed groups", rule: ImportRule{Kind: ImportGroups, IDs: []string{"g"}, Role: "managed"}, wantErr: "role"},
+		{name: "computers without a zone", rule: ImportRule{Kind: ImportComputers, IDs: []string{"c"}}, wantErr: "zone_id"},
+		{name: "unknown protocol", rule: ImportRule{Kind: ImportComputers, IDs: []string{"c"}, ZoneID: zone, Protocol: "vnc"}, wantErr: "protocol"},
+		{name: "invalid port", rule: ImportRule{Kind: ImportComputers, IDs: []string{"c"}, ZoneID: zone, Port: 70000}, wantErr: "port"},
+		{name: "unknown kind", rule: ImportRule{Kind: "printers", IDs: []string{"p"}}, wantErr: "kind"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.rule.validate()
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("validate() error = %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("validate() error = %v, want one about %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestBulkImportRequest_Validate(t *testing.T) {
+	if err := (&BulkImportRequest{}).validate(); err == nil {
+		t.Error("request without rules is valid")
+	}
+
+	req := BulkImportRequest{Rules: []ImportRule{
+		{Kind: ImportUsers, IDs: []string{"a"}, Role: "user"},
+		{Kind: ImportGroups, IDs: []string{"g"}},
+	}}
+	if err := req.validate(); err == nil || !strings.HasPrefix(err.Error(), "rule 1:") {
+		t.Errorf("validate() error = %v, want one about rule 1", err)
+	}
+}
+
+func TestImportProgress_Count(t *testing.T) {
+	var p ImportProgress
+	for _, status := range []string{ItemImported, ItemImported, ItemSkipped, ItemFailed} {
+		p.count(status)
+	}
+	if p != (ImportProgress{Done: 4, Imported: 2, Skipped: 1, Failed: 1}) {
+		t.Errorf("progress = %+v", p)
+	}
+}
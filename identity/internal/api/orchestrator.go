@@ -0,0 +1,100 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/VanCannon/openpam/pkg/servicetoken"
+)
+
+// errJobNotFound is returned for jobs the orchestrator doesn't know
+var errJobNotFound = errors.New("job not found")
+
+// Orchestrator queues jobs with the orchestrator service and reports the
+// progress of the ones run here
+type Orchestrator struct {
+	url    string
+	client *http.Client
+}
+
+// orchestrator is where bulk imports are queued; set with SetOrchestrator
+var orchestrator *Orchestrator
+
+// SetOrchestrator sets the orchestrator bulk imports are queued with
+func SetOrchestrator(o *Orchestrator) {
+	orchestrator = o
+}
+
+// NewOrchestrator creates a client of the orchestrator at baseURL, calling
+// it with service tokens signed with secret
+func NewOrchestrator(baseURL, secret string) *Orchestrator {
+	return &Orchestrator{
+		url: strings.TrimSuffix(baseURL, "/"),
+		client: &http.Client{
+			Timeout:   30 * time.Second,
+			Transport: &servicetoken.Transport{Secret: []byte(secret), Service: "identity"},
+		},
+	}
+}
+
+// Enqueue queues a job and returns it as the orchestrator describes it
+func (o *Orchestrator) Enqueue(ctx context.Context, jobType string, payload interface{}, maxAttempts int) (json.RawMessage, error) {
+	return o.call(ctx, http.MethodPost, "/api/v1/jobs", map[string]interface{}{
+		"type":         jobType,
+		"payload":      payload,
+		"max_attempts": maxAttempts,
+	})
+}
+
+// Job returns a job as the orchestrator describes it
+func (o *Orchestrator) Job(ctx context.Context, id string) (json.RawMessage, error) {
+	return o.call(ctx, http.MethodGet, "/api/v1/jobs/"+url.PathEscape(id), nil)
+}
+
+// ReportProgress stores the progress of a running job
+func (o *Orchestrator) ReportProgress(ctx context.Context, id string, progress interface{}) error {
+	_, err := o.call(ctx, http.MethodPost, "/api/v1/jobs/"+url.PathEscape(id)+"/progress", progress)
+	return err
+}
+
+func (o *Orchestrator) call(ctx context.Context, method, path string, body interface{}) (json.RawMessage, error) {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return nil, err
+		}
+		reader = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, o.url+path, reader)
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := o.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to call orchestrator: %w", err)
+	}
+	defer resp.Body.Close()
+
+	respBody, _ := io.ReadAll(io.LimitReader(resp.Body, 4<<20))
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, errJobNotFound
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return nil, fmt.Errorf("orchestrator returned %s: %s", resp.Status, bytes.TrimSpace(respBody))
+	}
+	return respBody, nil
+}
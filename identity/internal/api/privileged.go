@@ -0,0 +1,190 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/VanCannon/openpam/identity/internal/db"
+	"github.com/VanCannon/openpam/identity/internal/ldap"
+	"github.com/google/uuid"
+)
+
+// EventTypeADPrivilegedGroupChanged is the system audit event of a member
+// added to or removed from a watched AD group
+const EventTypeADPrivilegedGroupChanged = "ad_privileged_group_changed"
+
+// Actions of EventTypeADPrivilegedGroupChanged events
+const (
+	ActionMemberAdded   = "member_added"
+	ActionMemberRemoved = "member_removed"
+)
+
+// PrivilegedChange is a member added to or removed from a watched AD group
+type PrivilegedChange struct {
+	Group          string `json:"group"`
+	GroupDN        string `json:"group_dn"`
+	Action         string `json:"action"`
+	MemberDN       string `json:"member_dn"`
+	SAMAccountName string `json:"sam_account_name,omitempty"`
+	Direct         bool   `json:"direct"`
+}
+
+// PrivilegedSync is what a sync found in the watched AD groups
+type PrivilegedSync struct {
+	Groups int `json:"groups"`
+
+	// Groups snapshotted for the first time, whose members aren't reported
+	Baselined []string `json:"baselined,omitempty"`
+
+	// Watched groups that weren't found in the directory
+	Missing []string `json:"missing,omitempty"`
+
+	Changes []PrivilegedChange `json:"changes"`
+}
+
+// syncPrivilegedGroups snapshots the members of the watched AD groups,
+// including those of nested groups, and records each member added or removed
+// since the last snapshot in the system audit log. OpenPAM never changes AD
+// group membership, so every change found was made out-of-band. A group's
+// first snapshot is its baseline and raises no events.
+func syncPrivilegedGroups(client *ldap.Client) (*PrivilegedSync, error) {
+	watched, err := db.GetPrivilegedGroups()
+	if err != nil {
+		return nil, err
+	}
+	entries, err := client.SearchPrivilegedGroups(watched)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &PrivilegedSync{Changes: []PrivilegedChange{}}
+	found := make(map[string]bool, 2*len(entries))
+	for _, e := range entries {
+		name := e.GetAttributeValue("name")
+		found[strings.ToLower(name)] = true
+		found[strings.ToLower(e.DN)] = true
+
+		// A group that can't be read keeps its last snapshot, rather than
+		// reporting all of its members as removed
+		members, err := client.GroupMembers(e.DN, e.GetAttributeValues("member"))
+		if err != nil {
+			log.Error("Failed to search privileged group members", map[string]interface{}{
+				"group": e.DN,
+				"error": err.Error(),
+			})
+			continue
+		}
+		previous, err := db.GetPrivilegedGroup(e.DN)
+		if err != nil {
+			return nil, err
+		}
+
+		snapshot := &db.PrivilegedGroup{DN: e.DN, Name: name}
+		current := make([]string, 0, len(members))
+		byDN := make(map[string]db.PrivilegedMember, len(members))
+		for _, m := range members {
+			member := db.PrivilegedMember{DN: m.DN, SAMAccountName: m.SAMAccountName, Direct: m.Direct}
+			snapshot.Members = append(snapshot.Members, member)
+			current = append(current, m.DN)
+			byDN[strings.ToLower(m.DN)] = member
+		}
+
+		if previous == nil {
+			result.Baselined = append(result.Baselined, name)
+		} else {
+			var before []string
+			for _, m := range previous.Members {
+				before = append(before, m.DN)
+				if _, ok := byDN[strings.ToLower(m.DN)]; !ok {
+					byDN[strings.ToLower(m.DN)] = m
+				}
+			}
+
+			added, removed := ldap.DiffMembers(before, current)
+			for _, dn := range added {
+				result.Changes = append(result.Changes, privilegedChange(name, e.DN, ActionMemberAdded, byDN[strings.ToLower(dn)]))
+			}
+			for _, dn := range removed {
+				result.Changes = append(result.Changes, privilegedChange(name, e.DN, ActionMemberRemoved, byDN[strings.ToLower(dn)]))
+			}
+		}
+
+		if err := db.SavePrivilegedGroup(snapshot); err != nil {
+			return nil, err
+		}
+		result.Groups++
+	}
+
+	for _, g := range watched {
+		if !found[strings.ToLower(g)] {
+			result.Missing = append(result.Missing, g)
+		}
+	}
+	if len(result.Missing) > 0 {
+		log.Warn("Privileged groups not found in the directory", map[string]interface{}{
+			"groups": result.Missing,
+		})
+	}
+
+	for _, c := range result.Changes {
+		log.Warn("Privileged group membership changed", map[string]interface{}{
+			"group":  c.Group,
+			"action": c.Action,
+			"member": c.MemberDN,
+		})
+		recordAudit(&db.SystemAuditLog{
+			EventType:    EventTypeADPrivilegedGroupChanged,
+			ResourceType: "ad_group",
+			ResourceID:   uuid.NewSHA1(uuid.NameSpaceURL, []byte("ad-group:"+c.Group)).String(),
+			ResourceName: c.Group,
+			Action:       c.Action,
+			Details: map[string]interface{}{
+				"group_dn":         c.GroupDN,
+				"member_dn":        c.MemberDN,
+				"sam_account_name": c.SAMAccountName,
+				"direct":           c.Direct,
+			},
+		}, "success")
+	}
+
+	return result, nil
+}
+
+func privilegedChange(group, groupDN, action string, m db.PrivilegedMember) PrivilegedChange {
+	return PrivilegedChange{
+		Group:          group,
+		GroupDN:        groupDN,
+		Action:         action,
+		MemberDN:       m.DN,
+		SAMAccountName: m.SAMAccountName,
+		Direct:         m.Direct,
+	}
+}
+
+// GetPrivilegedGroups returns the watched AD groups and the members of each
+// as of the last sync
+func GetPrivilegedGroups(w http.ResponseWriter, r *http.Request) {
+	watched, err := db.GetPrivilegedGroups()
+	if err != nil {
+		log.Error("Failed to get privileged groups", map[string]interface{}{
+			"error": err.Error(),
+		})
+		http.Error(w, "Failed to get privileged groups", http.StatusInternalServerError)
+		return
+	}
+	groups, err := db.GetPrivilegedGroupSnapshots()
+	if err != nil {
+		log.Error("Failed to get privileged group snapshots", map[string]interface{}{
+			"error": err.Error(),
+		})
+		http.Error(w, "Failed to get privileged groups", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"watched": watched,
+		"groups":  groups,
+	})
+}
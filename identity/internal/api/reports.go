@@ -0,0 +1,87 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/VanCannon/openpam/identity/internal/db"
+)
+
+// Defaults of the days reported on
+const (
+	defaultPasswordExpiryDays = 14
+	defaultStaleDays          = 90
+	maxReportDays             = 3650
+)
+
+// reportDays reads the days query parameter of a report
+func reportDays(r *http.Request, def int) (int, error) {
+	s := r.URL.Query().Get("days")
+	if s == "" {
+		return def, nil
+	}
+	days, err := strconv.Atoi(s)
+	if err != nil || days < 1 || days > maxReportDays {
+		return 0, fmt.Errorf("days must be from 1 to %d", maxReportDays)
+	}
+	return days, nil
+}
+
+// GetPasswordExpiryReport lists the enabled AD users whose password expires
+// within the next days days (default 14), soonest first
+func GetPasswordExpiryReport(w http.ResponseWriter, r *http.Request) {
+	days, err := reportDays(r, defaultPasswordExpiryDays)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	now := time.Now()
+	users, err := db.GetADUsersPasswordExpiring(now, now.AddDate(0, 0, days))
+	if err != nil {
+		log.Error("Failed to get expiring passwords", map[string]interface{}{
+			"error": err.Error(),
+		})
+		http.Error(w, "Failed to get password expiry report", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"days":         days,
+		"generated_at": now,
+		"users":        users,
+		"total":        len(users),
+	})
+}
+
+// GetStaleAccountsReport lists the enabled AD users who haven't logged on
+// for days days (default 90), or never have and were created that long ago
+func GetStaleAccountsReport(w http.ResponseWriter, r *http.Request) {
+	days, err := reportDays(r, defaultStaleDays)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	now := time.Now()
+	users, err := db.GetStaleADUsers(now.AddDate(0, 0, -days))
+	if err != nil {
+		log.Error("Failed to get stale accounts", map[string]interface{}{
+			"error": err.Error(),
+		})
+		http.Error(w, "Failed to get stale account report", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"days":         days,
+		"generated_at": now,
+		"users":        users,
+		"total":        len(users),
+	})
+}
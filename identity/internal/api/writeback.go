@@ -0,0 +1,319 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"strconv"
+
+	"github.com/VanCannon/openpam/identity/internal/db"
+	"github.com/VanCannon/openpam/identity/internal/ldap"
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+)
+
+// Permissions that gate AD write-back. They are granted per user, on top of
+// their OpenPAM role.
+const (
+	PermissionADUnlock        = "ad_user.unlock"
+	PermissionADEnable        = "ad_user.enable" // Enabling and disabling
+	PermissionADPasswordReset = "ad_user.reset_password"
+)
+
+// EventTypeADWriteBack is the system audit event of an AD write-back action
+const EventTypeADWriteBack = "ad_writeback"
+
+// actionPermissions maps each write-back action to the permission it needs
+var actionPermissions = map[string]string{
+	ldap.ActionUnlock:             PermissionADUnlock,
+	ldap.ActionEnable:             PermissionADEnable,
+	ldap.ActionDisable:            PermissionADEnable,
+	ldap.ActionForcePasswordReset: PermissionADPasswordReset,
+}
+
+type ADUserActionRequest struct {
+	Action string `json:"action"`
+	DryRun bool   `json:"dry_run"`
+	Reason string `json:"reason"`
+}
+
+type ADUserActionResponse struct {
+	Action  string             `json:"action"`
+	DryRun  bool               `json:"dry_run"`
+	Changed bool               `json:"changed"`
+	Change  *ldap.Change       `json:"change,omitempty"`
+	Before  *ldap.AccountState `json:"before"`
+	After   *ldap.AccountState `json:"after,omitempty"`
+	Status  string             `json:"status"`
+}
+
+// ADUserAction applies a write-back action to an AD account: unlock, enable,
+// disable or force_password_reset. A dry run reports the change without
+// making it. Changes are verified by reading the account back, and every
+// attempt, allowed or not, is recorded in the system audit log.
+func ADUserAction(w http.ResponseWriter, r *http.Request) {
+	var req ADUserActionRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	permission, ok := actionPermissions[req.Action]
+	if !ok {
+		http.Error(w, "Unknown action", http.StatusBadRequest)
+		return
+	}
+
+	actorID := callerFromContext(r.Context()).UserID
+	if _, err := uuid.Parse(actorID); err != nil {
+		http.Error(w, "Write-back must be done by a user", http.StatusForbidden)
+		return
+	}
+
+	adUserID := mux.Vars(r)["id"]
+	target, err := db.GetADUser(adUserID)
+	if err != nil {
+		log.Error("Failed to get AD user", map[string]interface{}{
+			"ad_user_id": adUserID,
+			"error":      err.Error(),
+		})
+		http.Error(w, "Failed to get AD user", http.StatusInternalServerError)
+		return
+	}
+	if target == nil {
+		http.Error(w, "AD user not found", http.StatusNotFound)
+		return
+	}
+
+	audit := &db.SystemAuditLog{
+		EventType:    EventTypeADWriteBack,
+		UserID:       actorID,
+		ResourceType: "ad_user",
+		ResourceID:   target.ID,
+		ResourceName: target.SAMAccountName,
+		Action:       req.Action,
+		IPAddress:    clientIP(r),
+		UserAgent:    r.UserAgent(),
+		Details: map[string]interface{}{
+			"dn":      target.DN,
+			"dry_run": req.DryRun,
+		},
+	}
+	if req.Reason != "" {
+		audit.Details["reason"] = req.Reason
+	}
+
+	allowed, err := db.HasPermission(actorID, permission)
+	if err != nil {
+		log.Error("Failed to check permission", map[string]interface{}{
+			"permission": permission,
+			"actor_id":   actorID,
+			"error":      err.Error(),
+		})
+		http.Error(w, "Failed to check permission", http.StatusInternalServerError)
+		return
+	}
+	if !allowed {
+		audit.Details["error"] = "missing permission " + permission
+		recordAudit(audit, "failure")
+		http.Error(w, "Missing permission "+permission, http.StatusForbidden)
+		return
+	}
+
+	host, port, baseDN, bindDN, bindPassword, _, _, _, err := db.GetConfig()
+	if err != nil {
+		log.Error("Failed to get config for write-back", map[string]interface{}{
+			"error": err.Error(),
+		})
+		http.Error(w, "Failed to get config", http.StatusInternalServerError)
+		return
+	}
+	if host == "" {
+		http.Error(w, "AD configuration not found", http.StatusBadRequest)
+		return
+	}
+
+	client := ldap.NewClient(host, port, baseDN, bindDN, bindPassword)
+	if err := client.Connect(); err != nil {
+		log.Error("Failed to connect to LDAP", map[string]interface{}{
+			"error": err.Error(),
+		})
+		http.Error(w, "Failed to connect to LDAP", http.StatusInternalServerError)
+		return
+	}
+	defer client.Close()
+
+	before, err := client.ReadAccountState(target.DN)
+	if err != nil {
+		log.Error("Failed to read AD account", map[string]interface{}{
+			"dn":    target.DN,
+			"error": err.Error(),
+		})
+		http.Error(w, "Failed to read AD account", http.StatusBadGateway)
+		return
+	}
+
+	change, err := ldap.PlanAction(req.Action, before)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	resp := ADUserActionResponse{
+		Action:  req.Action,
+		DryRun:  req.DryRun,
+		Changed: change != nil && !req.DryRun,
+		Change:  change,
+		Before:  before,
+		Status:  stateStatus(before),
+	}
+	if change != nil {
+		audit.Details["attribute"] = change.Attribute
+		audit.Details["from"] = change.From
+		audit.Details["to"] = change.To
+	} else {
+		audit.Details["unchanged"] = true
+	}
+
+	if change != nil && !req.DryRun {
+		if err := client.Apply(target.DN, change); err != nil {
+			log.Error("Failed to change AD account", map[string]interface{}{
+				"action": req.Action,
+				"dn":     target.DN,
+				"error":  err.Error(),
+			})
+			audit.Details["error"] = err.Error()
+			recordAudit(audit, "failure")
+			http.Error(w, "Failed to update AD account", http.StatusBadGateway)
+			return
+		}
+
+		// Read the account back rather than trusting the write, since policies
+		// and replication can undo it
+		after, err := client.ReadAccountState(target.DN)
+		if err == nil && !ldap.Applied(req.Action, after) {
+			err = errNotApplied
+		}
+		if err != nil {
+			log.Error("Failed to verify change of AD account", map[string]interface{}{
+				"action": req.Action,
+				"dn":     target.DN,
+				"error":  err.Error(),
+			})
+			audit.Details["error"] = "verification failed: " + err.Error()
+			recordAudit(audit, "failure")
+			http.Error(w, "AD account change could not be verified", http.StatusBadGateway)
+			return
+		}
+
+		resp.After = after
+		resp.Status = stateStatus(after)
+		_, passwordStatus := accountStatus(strconv.Itoa(after.UserAccountControl), after.PwdLastSet)
+		if err := db.UpdateADUserStatus(target.ID, resp.Status, passwordStatus); err != nil {
+			log.Error("Failed to update AD user", map[string]interface{}{
+				"ad_user_id": target.ID,
+				"error":      err.Error(),
+			})
+		}
+	}
+
+	recordAudit(audit, "success")
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+var errNotApplied = errors.New("account does not show the change")
+
+// stateStatus is the status shown for an account in state
+func stateStatus(state *ldap.AccountState) string {
+	status, _ := accountStatus(strconv.Itoa(state.UserAccountControl), state.PwdLastSet)
+	if status == "Active" && state.Locked() {
+		status = "Locked Out"
+	}
+	return status
+}
+
+func recordAudit(entry *db.SystemAuditLog, status string) {
+	entry.Status = status
+	if err := db.CreateSystemAuditLog(entry); err != nil {
+		log.Error("Failed to record audit log", map[string]interface{}{
+			"event_type": entry.EventType,
+			"error":      err.Error(),
+		})
+	}
+}
+
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// GetPermissions lists the identity permissions granted to a user
+func GetPermissions(w http.ResponseWriter, r *http.Request) {
+	userID := mux.Vars(r)["user_id"]
+	permissions, err := db.GetPermissions(userID)
+	if err != nil {
+		log.Error("Failed to get permissions", map[string]interface{}{
+			"error": err.Error(),
+		})
+		http.Error(w, "Failed to get permissions", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"user_id":     userID,
+		"permissions": permissions,
+	})
+}
+
+// SetPermissions replaces the identity permissions granted to a user
+func SetPermissions(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Permissions []string `json:"permissions"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	for _, p := range req.Permissions {
+		if p != PermissionADUnlock && p != PermissionADEnable && p != PermissionADPasswordReset {
+			http.Error(w, "Unknown permission "+p, http.StatusBadRequest)
+			return
+		}
+	}
+
+	actorID := callerFromContext(r.Context()).UserID
+
+	userID := mux.Vars(r)["user_id"]
+	if _, err := uuid.Parse(userID); err != nil {
+		http.Error(w, "Invalid user ID", http.StatusBadRequest)
+		return
+	}
+	if err := db.SetPermissions(userID, req.Permissions, actorID); err != nil {
+		log.Error("Failed to set permissions", map[string]interface{}{
+			"error": err.Error(),
+		})
+		http.Error(w, "Failed to set permissions", http.StatusInternalServerError)
+		return
+	}
+
+	recordAudit(&db.SystemAuditLog{
+		EventType:    "permission_changed",
+		UserID:       actorID,
+		ResourceType: "user",
+		ResourceID:   userID,
+		Action:       "set_identity_permissions",
+		IPAddress:    clientIP(r),
+		UserAgent:    r.UserAgent(),
+		Details:      map[string]interface{}{"permissions": req.Permissions},
+	}, "success")
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"status": "success"})
+}
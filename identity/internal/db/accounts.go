@@ -0,0 +1,81 @@
+package db
+
+import (
+	"math"
+	"time"
+)
+
+// adUserColumns are the ad_users columns scanADUser reads, in order
+const adUserColumns = `id, dn, sam_account_name, user_principal_name, display_name, mail, ou, status, password_status, last_sync,
+	password_last_set, password_expires_at, last_logon_at, when_created`
+
+type scanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// scanADUser reads an AD user selected with adUserColumns, and computes its
+// days until the password expires and since its last logon as of now
+func scanADUser(row scanner, now time.Time) (*ADUser, error) {
+	var u ADUser
+	if err := row.Scan(&u.ID, &u.DN, &u.SAMAccountName, &u.UserPrincipalName, &u.DisplayName, &u.Mail, &u.OU, &u.Status, &u.PasswordStatus, &u.LastSync,
+		&u.PasswordLastSet, &u.PasswordExpiresAt, &u.LastLogonAt, &u.WhenCreated); err != nil {
+		return nil, err
+	}
+
+	if u.PasswordExpiresAt != nil {
+		days := wholeDays(u.PasswordExpiresAt.Sub(now))
+		u.PasswordExpiresInDays = &days
+	}
+	if u.LastLogonAt != nil {
+		days := wholeDays(now.Sub(*u.LastLogonAt))
+		u.DaysSinceLastLogon = &days
+	}
+	return &u, nil
+}
+
+// wholeDays rounds d down to whole days
+func wholeDays(d time.Duration) int {
+	return int(math.Floor(d.Hours() / 24))
+}
+
+func queryADUsers(query string, args ...interface{}) ([]ADUser, error) {
+	rows, err := DB.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	now := time.Now()
+	users := []ADUser{}
+	for rows.Next() {
+		u, err := scanADUser(rows, now)
+		if err != nil {
+			return nil, err
+		}
+		users = append(users, *u)
+	}
+	return users, rows.Err()
+}
+
+// GetADUsersPasswordExpiring returns the enabled AD users whose password
+// expires from now until before, soonest first
+func GetADUsersPasswordExpiring(now, before time.Time) ([]ADUser, error) {
+	return queryADUsers(`
+		SELECT `+adUserColumns+`
+		FROM ad_users
+		WHERE status <> 'Disabled' AND password_expires_at >= $1 AND password_expires_at < $2
+		ORDER BY password_expires_at, lower(sam_account_name)
+	`, now.UTC(), before.UTC())
+}
+
+// GetStaleADUsers returns the enabled AD users who haven't logged on since
+// cutoff, or never have and were created before it, longest inactive first
+func GetStaleADUsers(cutoff time.Time) ([]ADUser, error) {
+	return queryADUsers(`
+		SELECT `+adUserColumns+`
+		FROM ad_users
+		WHERE status <> 'Disabled'
+		  AND (last_logon_at < $1 OR (last_logon_at IS NULL AND when_created < $1))
+		ORDER BY COALESCE(last_logon_at, when_created), lower(sam_account_name)
+	`, cutoff.UTC())
+}
@@ -0,0 +1,240 @@
+package db
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// States of the AD computer a target was imported from
+const (
+	ComputerActive   = "active"
+	ComputerDisabled = "disabled"
+	ComputerDeleted  = "deleted" // No longer found by a sync
+)
+
+// ComputerTarget links a target to the AD computer it was imported from.
+// It is flagged while the computer isn't active, unless an admin kept the
+// target with the computer in that state.
+type ComputerTarget struct {
+	TargetID       string       `json:"target_id"`
+	TargetName     string       `json:"target_name"`
+	TargetHostname string       `json:"target_hostname"`
+	TargetEnabled  bool         `json:"target_enabled"`
+	Computer       ADComputer   `json:"ad_computer"`
+	State          string       `json:"state"`
+	Flagged        bool         `json:"flagged"`
+	KeptState      string       `json:"kept_state,omitempty"`
+	ReviewedBy     string       `json:"reviewed_by,omitempty"`
+	ReviewedAt     *time.Time   `json:"reviewed_at,omitempty"`
+	LinkedAt       time.Time    `json:"linked_at"`
+	Candidates     []ADComputer `json:"candidates,omitempty"` // Active computers the target could be re-pointed to
+}
+
+// computerState is the state of an AD computer
+func computerState(enabled bool, deletedAt *time.Time) string {
+	switch {
+	case deletedAt != nil:
+		return ComputerDeleted
+	case !enabled:
+		return ComputerDisabled
+	default:
+		return ComputerActive
+	}
+}
+
+const computerTargetQuery = `
+	SELECT l.target_id, t.name, t.hostname, t.enabled,
+	       c.id, c.dn, c.name, c.dns_host_name, c.operating_system, c.operating_system_version, c.last_sync, c.enabled, c.deleted_at,
+	       COALESCE(l.kept_state, ''), COALESCE(l.reviewed_by, ''), l.reviewed_at, l.linked_at
+	FROM ad_computer_targets l
+	JOIN targets t ON t.id::text = l.target_id AND t.deleted_at IS NULL
+	JOIN ad_computers c ON c.id = l.ad_computer_id
+`
+
+func scanComputerTarget(row scanner) (*ComputerTarget, error) {
+	var l ComputerTarget
+	c := &l.Computer
+	err := row.Scan(&l.TargetID, &l.TargetName, &l.TargetHostname, &l.TargetEnabled,
+		&c.ID, &c.DN, &c.Name, &c.DNSHostName, &c.OperatingSystem, &c.OperatingSystemVersion, &c.LastSync, &c.Enabled, &c.DeletedAt,
+		&l.KeptState, &l.ReviewedBy, &l.ReviewedAt, &l.LinkedAt)
+	if err != nil {
+		return nil, err
+	}
+	l.State = computerState(c.Enabled, c.DeletedAt)
+	l.Flagged = computerTargetFlagged(l.State, l.KeptState)
+	return &l, nil
+}
+
+// computerTargetFlagged reports whether a target needs reconciling with its
+// AD computer in state, having been kept with it in keptState
+func computerTargetFlagged(state, keptState string) bool {
+	return state != ComputerActive && state != keptState
+}
+
+// GetComputerTargets returns the links of the targets imported from AD, only
+// the flagged ones if flaggedOnly is set
+func GetComputerTargets(flaggedOnly bool) ([]ComputerTarget, error) {
+	rows, err := DB.Query(computerTargetQuery + ` ORDER BY lower(t.name), l.target_id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	links := []ComputerTarget{}
+	for rows.Next() {
+		l, err := scanComputerTarget(rows)
+		if err != nil {
+			return nil, err
+		}
+		if flaggedOnly && !l.Flagged {
+			continue
+		}
+		links = append(links, *l)
+	}
+	return links, rows.Err()
+}
+
+// GetComputerTarget returns the link of a target, or nil if it wasn't
+// imported from AD
+func GetComputerTarget(targetID string) (*ComputerTarget, error) {
+	l, err := scanComputerTarget(DB.QueryRow(computerTargetQuery+` WHERE l.target_id = $1`, targetID))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return l, err
+}
+
+// LinkComputerTarget links a target to the AD computer it was imported from
+func LinkComputerTarget(targetID, computerID string) error {
+	_, err := DB.Exec(`
+		INSERT INTO ad_computer_targets (target_id, ad_computer_id)
+		VALUES ($1, $2)
+		ON CONFLICT (target_id) DO UPDATE SET
+		ad_computer_id = EXCLUDED.ad_computer_id,
+		kept_state = NULL,
+		reviewed_by = NULL,
+		reviewed_at = NULL,
+		linked_at = CURRENT_TIMESTAMP
+	`, targetID, computerID)
+	return err
+}
+
+// GetRepointCandidates returns the active AD computers, other than excludeID,
+// named like name or with the DNS host name dnsHostName
+func GetRepointCandidates(name, dnsHostName, excludeID string) ([]ADComputer, error) {
+	rows, err := DB.Query(`
+		SELECT id, dn, name, dns_host_name, operating_system, operating_system_version, last_sync, enabled, deleted_at
+		FROM ad_computers
+		WHERE id <> $3 AND enabled AND deleted_at IS NULL
+		AND (lower(name) = lower($1) OR ($2 <> '' AND lower(dns_host_name) = lower($2)))
+		ORDER BY lower(name), id
+	`, name, dnsHostName, excludeID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	computers := []ADComputer{}
+	for rows.Next() {
+		var c ADComputer
+		if err := rows.Scan(&c.ID, &c.DN, &c.Name, &c.DNSHostName, &c.OperatingSystem, &c.OperatingSystemVersion, &c.LastSync, &c.Enabled, &c.DeletedAt); err != nil {
+			return nil, err
+		}
+		computers = append(computers, c)
+	}
+	return computers, rows.Err()
+}
+
+// KeepComputerTarget keeps a target with its AD computer in state, so the
+// link is flagged again only if the computer's state changes
+func KeepComputerTarget(targetID, state, reviewedBy string) error {
+	_, err := DB.Exec(`
+		UPDATE ad_computer_targets
+		SET kept_state = $2, reviewed_by = $3, reviewed_at = CURRENT_TIMESTAMP
+		WHERE target_id = $1
+	`, targetID, state, reviewedBy)
+	return err
+}
+
+// DisableComputerTarget disables a target, and keeps it disabled with its AD
+// computer in state
+func DisableComputerTarget(targetID, state, reviewedBy string) error {
+	tx, err := DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`
+		UPDATE targets SET enabled = false, version = version + 1, updated_at = CURRENT_TIMESTAMP, updated_by = $2::uuid
+		WHERE id::text = $1 AND deleted_at IS NULL
+	`, targetID, reviewedBy); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`
+		UPDATE ad_computer_targets
+		SET kept_state = $2, reviewed_by = $3, reviewed_at = CURRENT_TIMESTAMP
+		WHERE target_id = $1
+	`, targetID, state, reviewedBy); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// RepointComputerTarget links a target to another AD computer, and points
+// the target at the computer's host name and DN
+func RepointComputerTarget(targetID string, computer *ADComputer, reviewedBy string) error {
+	tx, err := DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`
+		UPDATE targets SET
+		hostname = COALESCE(NULLIF($2, ''), hostname),
+		labels = COALESCE(labels, '{}'::jsonb) || jsonb_build_object('ad-dn', $3::text),
+		version = version + 1,
+		updated_at = CURRENT_TIMESTAMP,
+		updated_by = $4::uuid
+		WHERE id::text = $1 AND deleted_at IS NULL
+	`, targetID, computer.DNSHostName, computer.DN, reviewedBy); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`
+		UPDATE ad_computer_targets
+		SET ad_computer_id = $2, kept_state = NULL, reviewed_by = $3, reviewed_at = CURRENT_TIMESTAMP
+		WHERE target_id = $1
+	`, targetID, computer.ID, reviewedBy); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// MarkADComputersDeleted marks the AD computers a sync no longer found as
+// deleted, and returns how many were newly marked
+func MarkADComputersDeleted(found []string) (int64, error) {
+	res, err := DB.Exec(`
+		UPDATE ad_computers SET deleted_at = CURRENT_TIMESTAMP
+		WHERE deleted_at IS NULL AND NOT (id = ANY($1))
+	`, pq.StringArray(found))
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+// ResetActiveComputerTargets forgets which state the targets of active AD
+// computers were kept with, so they are flagged again if the computer is
+// disabled or deleted later
+func ResetActiveComputerTargets() error {
+	_, err := DB.Exec(`
+		UPDATE ad_computer_targets l SET kept_state = NULL
+		FROM ad_computers c
+		WHERE c.id = l.ad_computer_id AND c.enabled AND c.deleted_at IS NULL
+		AND l.kept_state IS NOT NULL
+	`)
+	return err
+}
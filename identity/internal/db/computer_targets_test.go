@@ -0,0 +1,55 @@
+package db
+
+import (
+	"testing"
+	"time"
+)
+
+func TestComputerState(t *testing.T) {
+	deletedAt := time.Now()
+	tests := []struct {
+		name      string
+		enabled   bool
+		deletedAt *time.Time
+		want      string
+	}{
+		{name: "enabled", enabled: true, want: ComputerActive},
+		{name: "disabled", enabled: false, want: ComputerDisabled},
+		{name: "deleted while enabled", enabled: true, deletedAt: &deletedAt, want: ComputerDeleted},
+		{name: "deleted while disabled", enabled: false, deletedAt: &deletedAt, want: ComputerDeleted},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := computerState(tt.enabled, tt.deletedAt); got != tt.want {
+				t.Errorf("computerState() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestComputerTargetFlagged(t *testing.T) {
+	tests := []struct {
+		name      string
+		state     string
+		keptState string
+		want      bool
+	}{
+		{name: "active", state: ComputerActive},
+		{name: "disabled", state: ComputerDisabled, want: true},
+		{name: "deleted", state: ComputerDeleted, want: true},
+		{name: "kept disabled", state: ComputerDisabled, keptState: ComputerDisabled},
+		{name: "kept deleted", state: ComputerDeleted, keptState: ComputerDeleted},
+		{name: "deleted after being kept disabled", state: ComputerDeleted, keptState: ComputerDisabled, want: true},
+		{name: "disabled after being kept deleted", state: ComputerDisabled, keptState: ComputerDeleted, want: true},
+		{name: "active again after being kept disabled", state: ComputerActive, keptState: ComputerDisabled},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := computerTargetFlagged(tt.state, tt.keptState); got != tt.want {
+				t.Errorf("computerTargetFlagged(%q, %q) = %v, want %v", tt.state, tt.keptState, got, tt.want)
+			}
+		})
+	}
+}
@@ -2,15 +2,27 @@ package db
 
 import (
 	"database/sql"
+	"encoding/json"
 	"fmt"
-	"log"
 	"os"
+	"strings"
+	"time"
 
-	_ "github.com/lib/pq"
+	"github.com/VanCannon/openpam/pkg/logger"
+	"github.com/VanCannon/openpam/pkg/types"
+	"github.com/lib/pq"
 )
 
 var DB *sql.DB
 
+// log is the identity service's logger, replaced by SetLogger at startup
+var log = logger.Default()
+
+// SetLogger sets the logger the package logs with
+func SetLogger(l *logger.Logger) {
+	log = l
+}
+
 func InitDB() error {
 	host := os.Getenv("DB_HOST")
 	port := os.Getenv("DB_PORT")
@@ -31,21 +43,12 @@ func InitDB() error {
 		return fmt.Errorf("failed to ping database: %v", err)
 	}
 
-	log.Println("Connected to database")
+	log.Info("Connected to database")
 	return createTables()
 }
 
-type User struct {
-	ID          string `json:"id"`
-	EntraID     string `json:"entra_id"`
-	Email       string `json:"email"`
-	DisplayName string `json:"display_name"`
-	Role        string `json:"role"`
-	Enabled     bool   `json:"enabled"`
-	Source      string `json:"source"`
-	CreatedAt   string `json:"created_at"`
-	LastLoginAt string `json:"last_login_at,omitempty"`
-}
+// User is an OpenPAM user, in the shared representation
+type User = types.User
 
 type ManagedAccount struct {
 	ID          string `json:"id"`
@@ -76,6 +79,15 @@ type ADUser struct {
 	Status            string `json:"status"`          // Active, Disabled, Locked Out, Password Expired
 	PasswordStatus    string `json:"password_status"` // Never Expires, Cannot Change, Smart Card Required
 	LastSync          string `json:"last_sync"`
+
+	PasswordLastSet   *time.Time `json:"password_last_set"`
+	PasswordExpiresAt *time.Time `json:"password_expires_at"` // Nil if it never expires
+	LastLogonAt       *time.Time `json:"last_logon_at"`       // lastLogonTimestamp, which AD updates every 9 to 14 days
+	WhenCreated       *time.Time `json:"when_created"`
+
+	// Computed when read, in whole days
+	PasswordExpiresInDays *int `json:"password_expires_in_days"`
+	DaysSinceLastLogon    *int `json:"days_since_last_logon"`
 }
 
 type ADComputer struct {
@@ -86,6 +98,9 @@ type ADComputer struct {
 	OperatingSystem        string `json:"operating_system"`
 	OperatingSystemVersion string `json:"operating_system_version"`
 	LastSync               string `json:"last_sync"`
+
+	Enabled   bool       `json:"enabled"`
+	DeletedAt *time.Time `json:"deleted_at,omitempty"` // When a sync no longer found it
 }
 
 type ADGroup struct {
@@ -107,18 +122,8 @@ type Group struct {
 	CreatedAt   string `json:"created_at"`
 }
 
-type Target struct {
-	ID          string `json:"id"`
-	ZoneID      string `json:"zone_id"`
-	Name        string `json:"name"`
-	Hostname    string `json:"hostname"`
-	Protocol    string `json:"protocol"`
-	Port        int    `json:"port"`
-	Description string `json:"description"`
-	Enabled     bool   `json:"enabled"`
-	CreatedAt   string `json:"created_at"`
-	UpdatedAt   string `json:"updated_at"`
-}
+// Target is an OpenPAM target, in the shared representation
+type Target = types.Target
 
 func createTables() error {
 	query := `
@@ -207,6 +212,38 @@ func createTables() error {
 		source TEXT DEFAULT 'active_directory',
 		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
 	);
+
+	CREATE TABLE IF NOT EXISTS identity_permissions (
+		user_id TEXT NOT NULL,
+		permission TEXT NOT NULL,
+		granted_by TEXT,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		PRIMARY KEY (user_id, permission)
+	);
+
+	CREATE TABLE IF NOT EXISTS ad_computer_targets (
+		target_id TEXT PRIMARY KEY,
+		ad_computer_id TEXT NOT NULL,
+		kept_state TEXT,
+		reviewed_by TEXT,
+		reviewed_at TIMESTAMP,
+		linked_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+	);
+
+	CREATE TABLE IF NOT EXISTS ad_privileged_groups (
+		dn TEXT PRIMARY KEY,
+		name TEXT NOT NULL,
+		snapshot_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+	);
+
+	CREATE TABLE IF NOT EXISTS ad_privileged_members (
+		group_dn TEXT NOT NULL REFERENCES ad_privileged_groups(dn) ON DELETE CASCADE,
+		member_dn TEXT NOT NULL,
+		sam_account_name TEXT,
+		direct BOOLEAN NOT NULL DEFAULT TRUE,
+		first_seen TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+		PRIMARY KEY (group_dn, member_dn)
+	);
 	`
 	_, err := DB.Exec(query)
 	if err != nil {
@@ -218,6 +255,9 @@ func createTables() error {
 	_, _ = DB.Exec(`ALTER TABLE ad_config ADD COLUMN IF NOT EXISTS computer_filter TEXT NOT NULL DEFAULT '(objectClass=computer)'`)
 	_, _ = DB.Exec(`ALTER TABLE ad_config ADD COLUMN IF NOT EXISTS group_filter TEXT NOT NULL DEFAULT '(objectClass=group)'`)
 
+	// Migration: NULL watches the default privileged groups
+	_, _ = DB.Exec(`ALTER TABLE ad_config ADD COLUMN IF NOT EXISTS privileged_groups TEXT[]`)
+
 	// Migration: Add source column to users table if it doesn't exist
 	_, _ = DB.Exec(`ALTER TABLE users ADD COLUMN IF NOT EXISTS source TEXT DEFAULT 'local'`)
 
@@ -230,6 +270,34 @@ func createTables() error {
 	_, _ = DB.Exec(`ALTER TABLE groups ADD COLUMN IF NOT EXISTS role TEXT DEFAULT 'user'`)
 	_, _ = DB.Exec(`ALTER TABLE groups ADD COLUMN IF NOT EXISTS source TEXT DEFAULT 'active_directory'`)
 
+	// Indexes for filtering the AD listings
+	_, _ = DB.Exec(`CREATE INDEX IF NOT EXISTS idx_ad_users_ou ON ad_users(ou)`)
+	_, _ = DB.Exec(`CREATE INDEX IF NOT EXISTS idx_ad_users_status ON ad_users(status)`)
+	_, _ = DB.Exec(`CREATE INDEX IF NOT EXISTS idx_ad_users_sam_account_name ON ad_users(lower(sam_account_name))`)
+
+	// Migration: Add the password and logon times of AD users, in UTC
+	_, _ = DB.Exec(`ALTER TABLE ad_users ADD COLUMN IF NOT EXISTS password_last_set TIMESTAMP`)
+	_, _ = DB.Exec(`ALTER TABLE ad_users ADD COLUMN IF NOT EXISTS password_expires_at TIMESTAMP`)
+	_, _ = DB.Exec(`ALTER TABLE ad_users ADD COLUMN IF NOT EXISTS last_logon_at TIMESTAMP`)
+	_, _ = DB.Exec(`ALTER TABLE ad_users ADD COLUMN IF NOT EXISTS when_created TIMESTAMP`)
+	_, _ = DB.Exec(`CREATE INDEX IF NOT EXISTS idx_ad_users_password_expires_at ON ad_users(password_expires_at)`)
+
+	// Migration: Add whether AD computers are enabled, and when they were
+	// deleted from the directory
+	_, _ = DB.Exec(`ALTER TABLE ad_computers ADD COLUMN IF NOT EXISTS enabled BOOLEAN NOT NULL DEFAULT TRUE`)
+	_, _ = DB.Exec(`ALTER TABLE ad_computers ADD COLUMN IF NOT EXISTS deleted_at TIMESTAMP`)
+
+	// Migration: Link the targets imported before links were kept to their
+	// AD computers by the DN they were labelled with
+	_, _ = DB.Exec(`
+		INSERT INTO ad_computer_targets (target_id, ad_computer_id)
+		SELECT t.id::text, c.id
+		FROM targets t
+		JOIN ad_computers c ON lower(c.dn) = lower(t.labels->>'ad-dn')
+		WHERE t.labels->>'source' = 'active-directory'
+		ON CONFLICT (target_id) DO NOTHING
+	`)
+
 	return nil
 }
 
@@ -276,8 +344,9 @@ func GetConfig() (string, int, string, string, string, string, string, string, e
 
 func SaveADUsers(users []ADUser) error {
 	stmt, err := DB.Prepare(`
-		INSERT INTO ad_users (id, dn, sam_account_name, user_principal_name, display_name, mail, ou, status, password_status, last_sync)
-		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, CURRENT_TIMESTAMP)
+		INSERT INTO ad_users (id, dn, sam_account_name, user_principal_name, display_name, mail, ou, status, password_status,
+			password_last_set, password_expires_at, last_logon_at, when_created, last_sync)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, CURRENT_TIMESTAMP)
 		ON CONFLICT (id) DO UPDATE SET
 		dn = EXCLUDED.dn,
 		sam_account_name = EXCLUDED.sam_account_name,
@@ -287,6 +356,10 @@ func SaveADUsers(users []ADUser) error {
 		ou = EXCLUDED.ou,
 		status = EXCLUDED.status,
 		password_status = EXCLUDED.password_status,
+		password_last_set = EXCLUDED.password_last_set,
+		password_expires_at = EXCLUDED.password_expires_at,
+		last_logon_at = EXCLUDED.last_logon_at,
+		when_created = EXCLUDED.when_created,
 		last_sync = CURRENT_TIMESTAMP
 	`)
 	if err != nil {
@@ -295,9 +368,13 @@ func SaveADUsers(users []ADUser) error {
 	defer stmt.Close()
 
 	for _, u := range users {
-		_, err := stmt.Exec(u.ID, u.DN, u.SAMAccountName, u.UserPrincipalName, u.DisplayName, u.Mail, u.OU, u.Status, u.PasswordStatus)
+		_, err := stmt.Exec(u.ID, u.DN, u.SAMAccountName, u.UserPrincipalName, u.DisplayName, u.Mail, u.OU, u.Status, u.PasswordStatus,
+			u.PasswordLastSet, u.PasswordExpiresAt, u.LastLogonAt, u.WhenCreated)
 		if err != nil {
-			log.Printf("Failed to save AD user %s: %v", u.SAMAccountName, err)
+			log.Error("Failed to save AD user", map[string]interface{}{
+				"username": u.SAMAccountName,
+				"error":    err.Error(),
+			})
 		}
 	}
 	return nil
@@ -305,14 +382,16 @@ func SaveADUsers(users []ADUser) error {
 
 func SaveADComputers(computers []ADComputer) error {
 	stmt, err := DB.Prepare(`
-		INSERT INTO ad_computers (id, dn, name, dns_host_name, operating_system, operating_system_version, last_sync)
-		VALUES ($1, $2, $3, $4, $5, $6, CURRENT_TIMESTAMP)
+		INSERT INTO ad_computers (id, dn, name, dns_host_name, operating_system, operating_system_version, enabled, last_sync)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, CURRENT_TIMESTAMP)
 		ON CONFLICT (id) DO UPDATE SET
 		dn = EXCLUDED.dn,
 		name = EXCLUDED.name,
 		dns_host_name = EXCLUDED.dns_host_name,
 		operating_system = EXCLUDED.operating_system,
 		operating_system_version = EXCLUDED.operating_system_version,
+		enabled = EXCLUDED.enabled,
+		deleted_at = NULL,
 		last_sync = CURRENT_TIMESTAMP
 	`)
 	if err != nil {
@@ -321,68 +400,174 @@ func SaveADComputers(computers []ADComputer) error {
 	defer stmt.Close()
 
 	for _, c := range computers {
-		_, err := stmt.Exec(c.ID, c.DN, c.Name, c.DNSHostName, c.OperatingSystem, c.OperatingSystemVersion)
+		_, err := stmt.Exec(c.ID, c.DN, c.Name, c.DNSHostName, c.OperatingSystem, c.OperatingSystemVersion, c.Enabled)
 		if err != nil {
-			log.Printf("Failed to save AD computer %s: %v", c.Name, err)
+			log.Error("Failed to save AD computer", map[string]interface{}{
+				"computer": c.Name,
+				"error":    err.Error(),
+			})
 		}
 	}
 	return nil
 }
 
-func GetADUsers() ([]ADUser, error) {
-	rows, err := DB.Query(`SELECT id, dn, sam_account_name, user_principal_name, display_name, mail, ou, status, password_status, last_sync FROM ad_users`)
-	if err != nil {
-		return nil, err
+// ADFilter narrows and pages the synced AD users, computers and groups.
+// Fields that don't apply to a listing are ignored.
+type ADFilter struct {
+	Search          string // Case-insensitive substring of the names
+	OU              string // Users only
+	Status          string // Users only
+	OperatingSystem string // Computers only; case-insensitive substring
+	Limit           int
+	Offset          int
+}
+
+// conditions builds a WHERE clause from column conditions, numbering their
+// arguments after any already in args
+type conditions struct {
+	clauses []string
+	args    []interface{}
+}
+
+func (c *conditions) add(clause string, arg interface{}) {
+	c.args = append(c.args, arg)
+	c.clauses = append(c.clauses, strings.ReplaceAll(clause, "?", fmt.Sprintf("$%d", len(c.args))))
+}
+
+func (c *conditions) where() string {
+	if len(c.clauses) == 0 {
+		return ""
 	}
-	defer rows.Close()
+	return " WHERE " + strings.Join(c.clauses, " AND ")
+}
 
-	var users []ADUser
-	for rows.Next() {
-		var u ADUser
-		if err := rows.Scan(&u.ID, &u.DN, &u.SAMAccountName, &u.UserPrincipalName, &u.DisplayName, &u.Mail, &u.OU, &u.Status, &u.PasswordStatus, &u.LastSync); err != nil {
-			return nil, err
-		}
-		users = append(users, u)
+// page appends LIMIT and OFFSET to a query
+func (c *conditions) page(query string, f ADFilter) string {
+	c.args = append(c.args, f.Limit, f.Offset)
+	return fmt.Sprintf("%s LIMIT $%d OFFSET $%d", query, len(c.args)-1, len(c.args))
+}
+
+// likePattern matches s anywhere in a value, with LIKE wildcards in s escaped
+func likePattern(s string) string {
+	s = strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(s)
+	return "%" + s + "%"
+}
+
+// GetADUsers returns a page of the AD users matching f, ordered by account
+// name, and how many match in all
+func GetADUsers(f ADFilter) ([]ADUser, int, error) {
+	var c conditions
+	if f.Search != "" {
+		c.add(`(sam_account_name ILIKE ? OR display_name ILIKE ? OR user_principal_name ILIKE ? OR mail ILIKE ?)`, likePattern(f.Search))
 	}
-	return users, nil
+	if f.OU != "" {
+		c.add(`ou = ?`, f.OU)
+	}
+	if f.Status != "" {
+		c.add(`status = ?`, f.Status)
+	}
+
+	var total int
+	if err := DB.QueryRow(`SELECT COUNT(*) FROM ad_users`+c.where(), c.args...).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+
+	query := c.page(`SELECT `+adUserColumns+` FROM ad_users`+c.where()+` ORDER BY lower(sam_account_name), id`, f)
+	users, err := queryADUsers(query, c.args...)
+	if err != nil {
+		return nil, 0, err
+	}
+	return users, total, nil
 }
 
-func GetADComputers() ([]ADComputer, error) {
-	rows, err := DB.Query(`SELECT id, dn, name, dns_host_name, operating_system, operating_system_version, last_sync FROM ad_computers`)
+// GetADUser returns an AD user, or nil if there is none with the ID
+func GetADUser(id string) (*ADUser, error) {
+	u, err := scanADUser(DB.QueryRow(`SELECT `+adUserColumns+` FROM ad_users WHERE id = $1`, id), time.Now())
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
 	if err != nil {
 		return nil, err
 	}
+	return u, nil
+}
+
+// GetADComputers returns a page of the AD computers matching f, ordered by
+// name, and how many match in all
+func GetADComputers(f ADFilter) ([]ADComputer, int, error) {
+	var c conditions
+	if f.Search != "" {
+		c.add(`(name ILIKE ? OR dns_host_name ILIKE ?)`, likePattern(f.Search))
+	}
+	if f.OperatingSystem != "" {
+		c.add(`operating_system ILIKE ?`, likePattern(f.OperatingSystem))
+	}
+
+	var total int
+	if err := DB.QueryRow(`SELECT COUNT(*) FROM ad_computers`+c.where(), c.args...).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+
+	query := c.page(`SELECT id, dn, name, dns_host_name, operating_system, operating_system_version, last_sync, enabled, deleted_at FROM ad_computers`+c.where()+` ORDER BY lower(name), id`, f)
+	rows, err := DB.Query(query, c.args...)
+	if err != nil {
+		return nil, 0, err
+	}
 	defer rows.Close()
 
-	var computers []ADComputer
+	computers := []ADComputer{}
 	for rows.Next() {
 		var c ADComputer
-		if err := rows.Scan(&c.ID, &c.DN, &c.Name, &c.DNSHostName, &c.OperatingSystem, &c.OperatingSystemVersion, &c.LastSync); err != nil {
-			return nil, err
+		if err := rows.Scan(&c.ID, &c.DN, &c.Name, &c.DNSHostName, &c.OperatingSystem, &c.OperatingSystemVersion, &c.LastSync, &c.Enabled, &c.DeletedAt); err != nil {
+			return nil, 0, err
 		}
 		computers = append(computers, c)
 	}
-	return computers, nil
+	return computers, total, rows.Err()
+}
+
+// GetADComputer returns an AD computer, or nil if there is none with the ID
+func GetADComputer(id string) (*ADComputer, error) {
+	var c ADComputer
+	err := DB.QueryRow(`
+		SELECT id, dn, name, dns_host_name, operating_system, operating_system_version, last_sync, enabled, deleted_at
+		FROM ad_computers WHERE id = $1
+	`, id).Scan(&c.ID, &c.DN, &c.Name, &c.DNSHostName, &c.OperatingSystem, &c.OperatingSystemVersion, &c.LastSync, &c.Enabled, &c.DeletedAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &c, nil
 }
 
 // Keep existing SaveUsers/GetUsers/SaveComputers/GetComputers for OpenPAM users/computers
 // But we might want to clean up SaveComputers if we are moving to ad_computers exclusively for sync
 // For now, let's keep them but maybe SyncAD will write to AD tables instead.
 
+const saveUserQuery = `
+	INSERT INTO users (id, entra_id, email, display_name, role, enabled, source)
+	VALUES ($1, $2, $3, $4, $5, $6, $7)
+	ON CONFLICT (id) DO UPDATE SET
+	entra_id = EXCLUDED.entra_id,
+	email = EXCLUDED.email,
+	display_name = EXCLUDED.display_name,
+	source = EXCLUDED.source
+`
+
+// SaveUser saves one user, returning the error SaveUsers would only log
+func SaveUser(u User) error {
+	_, err := DB.Exec(saveUserQuery, u.ID, u.EntraID, u.Email, u.DisplayName, u.Role, u.Enabled, u.Source)
+	return err
+}
+
 func SaveUsers(users []User) error {
 	// ... (existing implementation)
 	// We don't use a transaction here so that a failure in one record (e.g. duplicate email)
 	// doesn't rollback the entire batch. We want partial success.
 
-	stmt, err := DB.Prepare(`
-		INSERT INTO users (id, entra_id, email, display_name, role, enabled, source)
-		VALUES ($1, $2, $3, $4, $5, $6, $7)
-		ON CONFLICT (id) DO UPDATE SET
-		entra_id = EXCLUDED.entra_id,
-		email = EXCLUDED.email,
-		display_name = EXCLUDED.display_name,
-		source = EXCLUDED.source
-	`)
+	stmt, err := DB.Prepare(saveUserQuery)
 	if err != nil {
 		return err
 	}
@@ -391,7 +576,11 @@ func SaveUsers(users []User) error {
 	for _, u := range users {
 		_, err := stmt.Exec(u.ID, u.EntraID, u.Email, u.DisplayName, u.Role, u.Enabled, u.Source)
 		if err != nil {
-			log.Printf("Failed to save user %s (%s): %v", u.Email, u.ID, err)
+			log.Error("Failed to save user", map[string]interface{}{
+				"email":   u.Email,
+				"user_id": u.ID,
+				"error":   err.Error(),
+			})
 			// Continue with other users
 		}
 	}
@@ -399,16 +588,25 @@ func SaveUsers(users []User) error {
 	return nil
 }
 
+const saveManagedAccountQuery = `
+	INSERT INTO managed_accounts (id, entra_id, email, display_name, source)
+	VALUES ($1, $2, $3, $4, $5)
+	ON CONFLICT (id) DO UPDATE SET
+	entra_id = EXCLUDED.entra_id,
+	email = EXCLUDED.email,
+	display_name = EXCLUDED.display_name,
+	source = EXCLUDED.source
+`
+
+// SaveManagedAccount saves one managed account, returning the error
+// SaveManagedAccounts would only log
+func SaveManagedAccount(a ManagedAccount) error {
+	_, err := DB.Exec(saveManagedAccountQuery, a.ID, a.EntraID, a.Email, a.DisplayName, a.Source)
+	return err
+}
+
 func SaveManagedAccounts(accounts []ManagedAccount) error {
-	stmt, err := DB.Prepare(`
-		INSERT INTO managed_accounts (id, entra_id, email, display_name, source)
-		VALUES ($1, $2, $3, $4, $5)
-		ON CONFLICT (id) DO UPDATE SET
-		entra_id = EXCLUDED.entra_id,
-		email = EXCLUDED.email,
-		display_name = EXCLUDED.display_name,
-		source = EXCLUDED.source
-	`)
+	stmt, err := DB.Prepare(saveManagedAccountQuery)
 	if err != nil {
 		return err
 	}
@@ -417,7 +615,11 @@ func SaveManagedAccounts(accounts []ManagedAccount) error {
 	for _, a := range accounts {
 		_, err := stmt.Exec(a.ID, a.EntraID, a.Email, a.DisplayName, a.Source)
 		if err != nil {
-			log.Printf("Failed to save managed account %s (%s): %v", a.Email, a.ID, err)
+			log.Error("Failed to save managed account", map[string]interface{}{
+				"email":      a.Email,
+				"account_id": a.ID,
+				"error":      err.Error(),
+			})
 		}
 	}
 	return nil
@@ -466,13 +668,9 @@ func GetUsers() ([]User, error) {
 	var users []User
 	for rows.Next() {
 		var u User
-		var lastLoginAt sql.NullString
-		if err := rows.Scan(&u.ID, &u.Email, &u.DisplayName, &u.Role, &u.Enabled, &u.Source, &u.CreatedAt, &lastLoginAt); err != nil {
+		if err := rows.Scan(&u.ID, &u.Email, &u.DisplayName, &u.Role, &u.Enabled, &u.Source, &u.CreatedAt, &u.LastLoginAt); err != nil {
 			return nil, err
 		}
-		if lastLoginAt.Valid {
-			u.LastLoginAt = lastLoginAt.String
-		}
 		users = append(users, u)
 	}
 	return users, nil
@@ -534,41 +732,81 @@ func SaveADGroups(groups []ADGroup) error {
 	for _, g := range groups {
 		_, err := stmt.Exec(g.ID, g.DN, g.Name, g.Description, g.MemberCount)
 		if err != nil {
-			log.Printf("Failed to save AD group %s: %v", g.Name, err)
+			log.Error("Failed to save AD group", map[string]interface{}{
+				"group": g.Name,
+				"error": err.Error(),
+			})
 		}
 	}
 	return nil
 }
 
-func GetADGroups() ([]ADGroup, error) {
-	rows, err := DB.Query(`SELECT id, dn, name, description, member_count, last_sync FROM ad_groups`)
+// GetADGroups returns a page of the AD groups matching f, ordered by name,
+// and how many match in all
+func GetADGroups(f ADFilter) ([]ADGroup, int, error) {
+	var c conditions
+	if f.Search != "" {
+		c.add(`(name ILIKE ? OR description ILIKE ?)`, likePattern(f.Search))
+	}
+
+	var total int
+	if err := DB.QueryRow(`SELECT COUNT(*) FROM ad_groups`+c.where(), c.args...).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+
+	query := c.page(`SELECT id, dn, name, description, member_count, last_sync FROM ad_groups`+c.where()+` ORDER BY lower(name), id`, f)
+	rows, err := DB.Query(query, c.args...)
 	if err != nil {
-		return nil, err
+		return nil, 0, err
 	}
 	defer rows.Close()
 
-	var groups []ADGroup
+	groups := []ADGroup{}
 	for rows.Next() {
 		var g ADGroup
 		if err := rows.Scan(&g.ID, &g.DN, &g.Name, &g.Description, &g.MemberCount, &g.LastSync); err != nil {
-			return nil, err
+			return nil, 0, err
 		}
 		groups = append(groups, g)
 	}
-	return groups, nil
+	return groups, total, rows.Err()
+}
+
+// GetADGroup returns an AD group, or nil if there is none with the ID
+func GetADGroup(id string) (*ADGroup, error) {
+	var g ADGroup
+	err := DB.QueryRow(`
+		SELECT id, dn, name, description, member_count, last_sync
+		FROM ad_groups WHERE id = $1
+	`, id).Scan(&g.ID, &g.DN, &g.Name, &g.Description, &g.MemberCount, &g.LastSync)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &g, nil
+}
+
+const saveGroupQuery = `
+	INSERT INTO groups (id, name, dn, description, role, source)
+	VALUES ($1, $2, $3, $4, $5, $6)
+	ON CONFLICT (id) DO UPDATE SET
+	name = EXCLUDED.name,
+	dn = EXCLUDED.dn,
+	description = EXCLUDED.description,
+	role = EXCLUDED.role,
+	source = EXCLUDED.source
+`
+
+// SaveGroup saves one group, returning the error SaveGroups would only log
+func SaveGroup(g Group) error {
+	_, err := DB.Exec(saveGroupQuery, g.ID, g.Name, g.DN, g.Description, g.Role, g.Source)
+	return err
 }
 
 func SaveGroups(groups []Group) error {
-	stmt, err := DB.Prepare(`
-		INSERT INTO groups (id, name, dn, description, role, source)
-		VALUES ($1, $2, $3, $4, $5, $6)
-		ON CONFLICT (id) DO UPDATE SET
-		name = EXCLUDED.name,
-		dn = EXCLUDED.dn,
-		description = EXCLUDED.description,
-		role = EXCLUDED.role,
-		source = EXCLUDED.source
-	`)
+	stmt, err := DB.Prepare(saveGroupQuery)
 	if err != nil {
 		return err
 	}
@@ -577,7 +815,10 @@ func SaveGroups(groups []Group) error {
 	for _, g := range groups {
 		_, err := stmt.Exec(g.ID, g.Name, g.DN, g.Description, g.Role, g.Source)
 		if err != nil {
-			log.Printf("Failed to save group %s: %v", g.Name, err)
+			log.Error("Failed to save group", map[string]interface{}{
+				"group": g.Name,
+				"error": err.Error(),
+			})
 		}
 	}
 	return nil
@@ -606,29 +847,79 @@ func DeleteGroup(id string) error {
 	return err
 }
 
+// SyncGroupMembers replaces the synced members of imported AD groups with
+// the given users, keyed by group ID. Members added in OpenPAM are kept, and
+// users who haven't been imported are skipped.
+func SyncGroupMembers(members map[string][]string) error {
+	tx, err := DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for groupID, userIDs := range members {
+		if _, err := tx.Exec(`
+			DELETE FROM group_members
+			WHERE group_id = $1 AND source = 'active_directory' AND NOT (user_id::text = ANY($2))
+		`, groupID, pq.StringArray(userIDs)); err != nil {
+			return err
+		}
+		if _, err := tx.Exec(`
+			INSERT INTO group_members (group_id, user_id, source)
+			SELECT g.id, u.id::uuid, 'active_directory'
+			FROM groups g
+			JOIN users u ON u.id::text = ANY($2)
+			WHERE g.id = $1 AND g.source = 'active_directory'
+			ON CONFLICT (group_id, user_id) DO NOTHING
+		`, groupID, pq.StringArray(userIDs)); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+const saveTargetQuery = `
+	INSERT INTO targets (id, zone_id, name, hostname, protocol, port, labels, enabled, created_at, updated_at)
+	VALUES ($1, $2, $3, $4, $5, $6, $7, $8, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP)
+	ON CONFLICT (id) DO UPDATE SET
+	zone_id = EXCLUDED.zone_id,
+	name = EXCLUDED.name,
+	hostname = EXCLUDED.hostname,
+	protocol = EXCLUDED.protocol,
+	port = EXCLUDED.port,
+	labels = targets.labels || EXCLUDED.labels,
+	enabled = EXCLUDED.enabled,
+	updated_at = CURRENT_TIMESTAMP
+`
+
+// SaveTarget saves one target, returning the error SaveTargets would only log
+func SaveTarget(t Target) error {
+	labels, err := json.Marshal(t.Labels)
+	if err != nil {
+		return err
+	}
+	_, err = DB.Exec(saveTargetQuery, t.ID, t.ZoneID, t.Name, t.Hostname, t.Protocol, t.Port, labels, t.Enabled)
+	return err
+}
+
 func SaveTargets(targets []Target) error {
-	stmt, err := DB.Prepare(`
-		INSERT INTO targets (id, zone_id, name, hostname, protocol, port, description, enabled, created_at, updated_at)
-		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP)
-		ON CONFLICT (id) DO UPDATE SET
-		zone_id = EXCLUDED.zone_id,
-		name = EXCLUDED.name,
-		hostname = EXCLUDED.hostname,
-		protocol = EXCLUDED.protocol,
-		port = EXCLUDED.port,
-		description = EXCLUDED.description,
-		enabled = EXCLUDED.enabled,
-		updated_at = CURRENT_TIMESTAMP
-	`)
+	stmt, err := DB.Prepare(saveTargetQuery)
 	if err != nil {
 		return err
 	}
 	defer stmt.Close()
 
 	for _, t := range targets {
-		_, err := stmt.Exec(t.ID, t.ZoneID, t.Name, t.Hostname, t.Protocol, t.Port, t.Description, t.Enabled)
+		labels, err := json.Marshal(t.Labels)
+		if err != nil {
+			return err
+		}
+		_, err = stmt.Exec(t.ID, t.ZoneID, t.Name, t.Hostname, t.Protocol, t.Port, labels, t.Enabled)
 		if err != nil {
-			log.Printf("Failed to save target %s: %v", t.Name, err)
+			log.Error("Failed to save target", map[string]interface{}{
+				"target": t.Name,
+				"error":  err.Error(),
+			})
 		}
 	}
 	return nil
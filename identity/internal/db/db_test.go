@@ -0,0 +1,58 @@
+package db
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestLikePattern(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{in: "web", want: "%web%"},
+		{in: "", want: "%%"},
+		{in: "100%", want: `%100\%%`},
+		{in: "svc_sql", want: `%svc\_sql%`},
+		{in: `CORP\admin`, want: `%CORP\\admin%`},
+		{in: `\%_`, want: `%\\\%\_%`},
+	}
+
+	for _, tt := range tests {
+		if got := likePattern(tt.in); got != tt.want {
+			t.Errorf("likePattern(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestConditions(t *testing.T) {
+	var c conditions
+	if got := c.where(); got != "" {
+		t.Errorf("where() without conditions = %q, want none", got)
+	}
+
+	c.add(`(name ILIKE ? OR dns_host_name ILIKE ?)`, "%web%")
+	c.add(`operating_system ILIKE ?`, "%linux%")
+	wantWhere := ` WHERE (name ILIKE $1 OR dns_host_name ILIKE $1) AND operating_system ILIKE $2`
+	if got := c.where(); got != wantWhere {
+		t.Errorf("where() = %q, want %q", got, wantWhere)
+	}
+
+	query := c.page(`SELECT id FROM ad_computers`+c.where(), ADFilter{Limit: 50, Offset: 100})
+	if want := `SELECT id FROM ad_computers` + wantWhere + ` LIMIT $3 OFFSET $4`; query != want {
+		t.Errorf("page() = %q, want %q", query, want)
+	}
+	if want := []interface{}{"%web%", "%linux%", 50, 100}; !reflect.DeepEqual(c.args, want) {
+		t.Errorf("args = %v, want %v", c.args, want)
+	}
+}
+
+func TestConditions_PageWithoutFilter(t *testing.T) {
+	var c conditions
+	query := c.page(`SELECT id FROM ad_groups`+c.where(), ADFilter{Limit: 500})
+	if want := `SELECT id FROM ad_groups LIMIT $1 OFFSET $2`; query != want {
+		t.Errorf("page() = %q, want %q", query, want)
+	}
+	if want := []interface{}{500, 0}; !reflect.DeepEqual(c.args, want) {
+		t.Errorf("args = %v, want %v", c.args, want)
+	}
+}
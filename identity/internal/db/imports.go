@@ -0,0 +1,106 @@
+package db
+
+import (
+	"database/sql"
+	"strings"
+
+	"github.com/lib/pq"
+)
+
+// inOU matches the dn column of objects in the OU with the DN given as the
+// query's first argument, or in any OU below it
+const inOU = `right(lower(dn), length($1) + 1) = ',' || lower($1)`
+
+// GetADUsersByDN returns the AD users with the given DNs, ordered by account
+// name. DNs that don't belong to a synced user are left out.
+func GetADUsersByDN(dns []string) ([]ADUser, error) {
+	lower := make([]string, len(dns))
+	for i, dn := range dns {
+		lower[i] = strings.ToLower(dn)
+	}
+	return queryADUsers(`SELECT `+adUserColumns+` FROM ad_users WHERE lower(dn) = ANY($1) ORDER BY lower(sam_account_name), id`, pq.StringArray(lower))
+}
+
+// GetADUsersInOU returns the AD users in the OU at ou or below it, ordered by
+// account name
+func GetADUsersInOU(ou string) ([]ADUser, error) {
+	return queryADUsers(`SELECT `+adUserColumns+` FROM ad_users WHERE `+inOU+` ORDER BY lower(sam_account_name), id`, ou)
+}
+
+// GetADGroupsInOU returns the AD groups in the OU at ou or below it, ordered
+// by name
+func GetADGroupsInOU(ou string) ([]ADGroup, error) {
+	rows, err := DB.Query(`SELECT id, dn, name, description, member_count, last_sync FROM ad_groups WHERE `+inOU+` ORDER BY lower(name), id`, ou)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	groups := []ADGroup{}
+	for rows.Next() {
+		var g ADGroup
+		if err := rows.Scan(&g.ID, &g.DN, &g.Name, &g.Description, &g.MemberCount, &g.LastSync); err != nil {
+			return nil, err
+		}
+		groups = append(groups, g)
+	}
+	return groups, rows.Err()
+}
+
+// GetADComputersInOU returns the AD computers in the OU at ou or below it,
+// ordered by name
+func GetADComputersInOU(ou string) ([]ADComputer, error) {
+	rows, err := DB.Query(`
+		SELECT id, dn, name, dns_host_name, operating_system, operating_system_version, last_sync, enabled, deleted_at
+		FROM ad_computers WHERE `+inOU+` ORDER BY lower(name), id
+	`, ou)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	computers := []ADComputer{}
+	for rows.Next() {
+		var c ADComputer
+		if err := rows.Scan(&c.ID, &c.DN, &c.Name, &c.DNSHostName, &c.OperatingSystem, &c.OperatingSystemVersion, &c.LastSync, &c.Enabled, &c.DeletedAt); err != nil {
+			return nil, err
+		}
+		computers = append(computers, c)
+	}
+	return computers, rows.Err()
+}
+
+// UserImported reports whether an AD user was imported, as a user or as a
+// managed account
+func UserImported(id string) (bool, error) {
+	var imported bool
+	err := DB.QueryRow(`
+		SELECT EXISTS (SELECT 1 FROM users WHERE id::text = $1)
+		    OR EXISTS (SELECT 1 FROM managed_accounts WHERE id::text = $1)
+	`, id).Scan(&imported)
+	return imported, err
+}
+
+// GroupImported reports whether an AD group was imported
+func GroupImported(id string) (bool, error) {
+	var imported bool
+	err := DB.QueryRow(`SELECT EXISTS (SELECT 1 FROM groups WHERE id::text = $1)`, id).Scan(&imported)
+	return imported, err
+}
+
+// ComputerImported returns the target an AD computer was imported as, or ""
+// if it wasn't or the target was deleted
+func ComputerImported(computerID string) (string, error) {
+	var targetID string
+	err := DB.QueryRow(`
+		SELECT l.target_id FROM ad_computer_targets l
+		JOIN targets t ON t.id::text = l.target_id AND t.deleted_at IS NULL
+		WHERE l.ad_computer_id = $1
+		ORDER BY l.linked_at
+		LIMIT 1
+	`, computerID).Scan(&targetID)
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+	return targetID, err
+}
@@ -0,0 +1,176 @@
+package db
+
+import (
+	"database/sql"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// DefaultPrivilegedGroups are the AD groups whose membership is watched when
+// none are configured: the built-in groups that can take over the domain
+var DefaultPrivilegedGroups = []string{
+	"Domain Admins",
+	"Enterprise Admins",
+	"Schema Admins",
+	"Administrators",
+	"Account Operators",
+	"Backup Operators",
+	"Server Operators",
+}
+
+// PrivilegedGroup is the last snapshot of a watched AD group's members
+type PrivilegedGroup struct {
+	DN         string             `json:"dn"`
+	Name       string             `json:"name"`
+	SnapshotAt time.Time          `json:"snapshot_at"`
+	Members    []PrivilegedMember `json:"members"`
+}
+
+// PrivilegedMember is a user in a watched AD group, and since when
+type PrivilegedMember struct {
+	DN             string    `json:"dn"`
+	SAMAccountName string    `json:"sam_account_name"`
+	Direct         bool      `json:"direct"`
+	FirstSeen      time.Time `json:"first_seen"`
+}
+
+// GetPrivilegedGroups returns the names or DNs of the AD groups to watch
+func GetPrivilegedGroups() ([]string, error) {
+	var groups pq.StringArray
+	err := DB.QueryRow(`SELECT privileged_groups FROM ad_config ORDER BY id DESC LIMIT 1`).Scan(&groups)
+	if err == sql.ErrNoRows || (err == nil && groups == nil) {
+		return DefaultPrivilegedGroups, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return groups, nil
+}
+
+// SavePrivilegedGroups sets the AD groups to watch. nil watches the default
+// ones, and an empty list none.
+func SavePrivilegedGroups(groups []string) error {
+	_, err := DB.Exec(`UPDATE ad_config SET privileged_groups = $1, updated_at = CURRENT_TIMESTAMP`, pq.StringArray(groups))
+	return err
+}
+
+// GetPrivilegedGroup returns the last snapshot of the group at dn, or nil if
+// it was never taken
+func GetPrivilegedGroup(dn string) (*PrivilegedGroup, error) {
+	g := PrivilegedGroup{DN: dn}
+	err := DB.QueryRow(`SELECT name, snapshot_at FROM ad_privileged_groups WHERE dn = $1`, dn).Scan(&g.Name, &g.SnapshotAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if g.Members, err = privilegedMembers(dn); err != nil {
+		return nil, err
+	}
+	return &g, nil
+}
+
+// GetPrivilegedGroupSnapshots returns the last snapshot of every watched
+// group, ordered by name
+func GetPrivilegedGroupSnapshots() ([]PrivilegedGroup, error) {
+	rows, err := DB.Query(`SELECT dn, name, snapshot_at FROM ad_privileged_groups ORDER BY lower(name), dn`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	groups := []PrivilegedGroup{}
+	for rows.Next() {
+		var g PrivilegedGroup
+		if err := rows.Scan(&g.DN, &g.Name, &g.SnapshotAt); err != nil {
+			return nil, err
+		}
+		groups = append(groups, g)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	for i := range groups {
+		if groups[i].Members, err = privilegedMembers(groups[i].DN); err != nil {
+			return nil, err
+		}
+	}
+	return groups, nil
+}
+
+func privilegedMembers(groupDN string) ([]PrivilegedMember, error) {
+	rows, err := DB.Query(`
+		SELECT member_dn, COALESCE(sam_account_name, ''), direct, first_seen
+		FROM ad_privileged_members
+		WHERE group_dn = $1
+		ORDER BY lower(member_dn)
+	`, groupDN)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	members := []PrivilegedMember{}
+	for rows.Next() {
+		var m PrivilegedMember
+		if err := rows.Scan(&m.DN, &m.SAMAccountName, &m.Direct, &m.FirstSeen); err != nil {
+			return nil, err
+		}
+		members = append(members, m)
+	}
+	return members, rows.Err()
+}
+
+// SavePrivilegedGroup replaces the snapshot of a watched group's members.
+// Members already in it keep when they were first seen.
+func SavePrivilegedGroup(g *PrivilegedGroup) error {
+	tx, err := DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`
+		INSERT INTO ad_privileged_groups (dn, name, snapshot_at)
+		VALUES ($1, $2, CURRENT_TIMESTAMP)
+		ON CONFLICT (dn) DO UPDATE SET name = EXCLUDED.name, snapshot_at = CURRENT_TIMESTAMP
+	`, g.DN, g.Name); err != nil {
+		return err
+	}
+
+	dns := make([]string, 0, len(g.Members))
+	for _, m := range g.Members {
+		dns = append(dns, strings.ToLower(m.DN))
+	}
+	if _, err := tx.Exec(`
+		DELETE FROM ad_privileged_members
+		WHERE group_dn = $1 AND NOT (lower(member_dn) = ANY($2))
+	`, g.DN, pq.StringArray(dns)); err != nil {
+		return err
+	}
+
+	for _, m := range g.Members {
+		if _, err := tx.Exec(`
+			UPDATE ad_privileged_members
+			SET sam_account_name = $3, direct = $4
+			WHERE group_dn = $1 AND lower(member_dn) = lower($2)
+		`, g.DN, m.DN, m.SAMAccountName, m.Direct); err != nil {
+			return err
+		}
+		if _, err := tx.Exec(`
+			INSERT INTO ad_privileged_members (group_dn, member_dn, sam_account_name, direct)
+			SELECT $1, $2, $3, $4
+			WHERE NOT EXISTS (
+				SELECT 1 FROM ad_privileged_members WHERE group_dn = $1 AND lower(member_dn) = lower($2)
+			)
+		`, g.DN, m.DN, m.SAMAccountName, m.Direct); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,142 @@
+package db
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+)
+
+// eventChannel is the notification channel the gateway streams events from
+const eventChannel = "openpam_events"
+
+// SystemAuditLog is a system audit log entry, as the gateway stores it
+type SystemAuditLog struct {
+	ID           string                 `json:"id"`
+	Timestamp    time.Time              `json:"timestamp"`
+	EventType    string                 `json:"event_type"`
+	UserID       string                 `json:"user_id,omitempty"`
+	ResourceType string                 `json:"resource_type,omitempty"`
+	ResourceID   string                 `json:"resource_id,omitempty"`
+	ResourceName string                 `json:"resource_name,omitempty"`
+	Action       string                 `json:"action"`
+	Status       string                 `json:"status"`
+	IPAddress    string                 `json:"ip_address,omitempty"`
+	UserAgent    string                 `json:"user_agent,omitempty"`
+	Details      map[string]interface{} `json:"details,omitempty"`
+	CreatedAt    time.Time              `json:"created_at"`
+}
+
+func UpdateADUserStatus(id, status, passwordStatus string) error {
+	_, err := DB.Exec(`UPDATE ad_users SET status = $2, password_status = $3, last_sync = CURRENT_TIMESTAMP WHERE id = $1`, id, status, passwordStatus)
+	return err
+}
+
+func HasPermission(userID, permission string) (bool, error) {
+	var exists bool
+	err := DB.QueryRow(`SELECT EXISTS (SELECT 1 FROM identity_permissions WHERE user_id = $1 AND permission = $2)`, userID, permission).Scan(&exists)
+	return exists, err
+}
+
+func GetPermissions(userID string) ([]string, error) {
+	rows, err := DB.Query(`SELECT permission FROM identity_permissions WHERE user_id = $1 ORDER BY permission`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	permissions := []string{}
+	for rows.Next() {
+		var p string
+		if err := rows.Scan(&p); err != nil {
+			return nil, err
+		}
+		permissions = append(permissions, p)
+	}
+	return permissions, rows.Err()
+}
+
+// SetPermissions replaces the permissions granted to a user
+func SetPermissions(userID string, permissions []string, grantedBy string) error {
+	tx, err := DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`DELETE FROM identity_permissions WHERE user_id = $1 AND NOT (permission = ANY($2))`, userID, pq.StringArray(permissions)); err != nil {
+		return err
+	}
+	for _, p := range permissions {
+		if _, err := tx.Exec(`
+			INSERT INTO identity_permissions (user_id, permission, granted_by)
+			VALUES ($1, $2, $3)
+			ON CONFLICT (user_id, permission) DO NOTHING
+		`, userID, p, grantedBy); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// CreateSystemAuditLog records a system audit log entry, and the matching
+// "system." event the gateway streams to SIEM and webhook subscribers
+func CreateSystemAuditLog(entry *SystemAuditLog) error {
+	entry.ID = uuid.New().String()
+	entry.Timestamp = time.Now()
+	entry.CreatedAt = entry.Timestamp
+
+	var details *string
+	if entry.Details != nil {
+		b, err := json.Marshal(entry.Details)
+		if err != nil {
+			return fmt.Errorf("failed to marshal audit details: %v", err)
+		}
+		s := string(b)
+		details = &s
+	}
+
+	tx, err := DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(`
+		INSERT INTO system_audit_logs (
+			id, timestamp, event_type, user_id, resource_type, resource_id, resource_name,
+			action, status, ip_address, user_agent, details, created_at
+		)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13)
+	`, entry.ID, entry.Timestamp, entry.EventType, nullString(entry.UserID), nullString(entry.ResourceType),
+		nullString(entry.ResourceID), nullString(entry.ResourceName), entry.Action, entry.Status,
+		nullString(entry.IPAddress), nullString(entry.UserAgent), details, entry.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to create system audit log: %v", err)
+	}
+
+	payload, err := json.Marshal(entry)
+	if err != nil {
+		return fmt.Errorf("failed to marshal event payload: %v", err)
+	}
+	var eventID int64
+	if err := tx.QueryRow(`INSERT INTO events (type, payload, created_at) VALUES ($1, $2, $3) RETURNING id`,
+		"system."+entry.EventType, string(payload), entry.CreatedAt).Scan(&eventID); err != nil {
+		return fmt.Errorf("failed to append event: %v", err)
+	}
+	if _, err := tx.Exec(`SELECT pg_notify($1, $2)`, eventChannel, strconv.FormatInt(eventID, 10)); err != nil {
+		return fmt.Errorf("failed to notify event: %v", err)
+	}
+
+	return tx.Commit()
+}
+
+func nullString(s string) interface{} {
+	if s == "" {
+		return nil
+	}
+	return s
+}
@@ -0,0 +1,109 @@
+package ldap
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-ldap/ldap/v3"
+)
+
+// fileTimeEpoch is the Unix time of 1601-01-01, where AD timestamps start
+const fileTimeEpoch = -11644473600
+
+// FileTime parses an AD timestamp such as pwdLastSet or lastLogonTimestamp:
+// 100-nanosecond intervals since 1601-01-01 UTC. It returns nil for 0 and the
+// largest value, which AD uses for "never".
+func FileTime(s string) *time.Time {
+	n, err := strconv.ParseInt(s, 10, 64)
+	if err != nil || n <= 0 || n == math.MaxInt64 {
+		return nil
+	}
+	t := time.Unix(fileTimeEpoch+n/1e7, (n%1e7)*100).UTC()
+	return &t
+}
+
+// GeneralizedTime parses an LDAP GeneralizedTime such as whenCreated, which
+// AD writes as 20240131120000.0Z
+func GeneralizedTime(s string) *time.Time {
+	s, _, _ = strings.Cut(strings.TrimSuffix(s, "Z"), ".")
+	t, err := time.ParseInLocation("20060102150405", s, time.UTC)
+	if err != nil {
+		return nil
+	}
+	return &t
+}
+
+// PasswordExpiresAt returns when an account's password expires. AD computes
+// msDS-UserPasswordExpiryTimeComputed with fine-grained password policies
+// taken into account; without it, the password expires maxAge after
+// pwdLastSet. It returns nil for passwords that never expire, accounts that
+// log on with a smart card, and passwords to be changed at next logon.
+func PasswordExpiresAt(uac int, pwdLastSet, computed string, maxAge time.Duration) *time.Time {
+	if uac&(UACDontExpirePassword|UACSmartcardRequired) != 0 || pwdLastSet == "0" {
+		return nil
+	}
+	if computed != "" {
+		return FileTime(computed)
+	}
+
+	set := FileTime(pwdLastSet)
+	if set == nil || maxAge <= 0 {
+		return nil
+	}
+	expires := set.Add(maxAge)
+	return &expires
+}
+
+// DomainDN returns the domain naming context of dn: its DC components, such
+// as DC=corp,DC=example for OU=Staff,DC=corp,DC=example
+func DomainDN(dn string) string {
+	parsed, err := ldap.ParseDN(dn)
+	if err != nil {
+		return ""
+	}
+
+	var parts []string
+	for _, rdn := range parsed.RDNs {
+		for _, attr := range rdn.Attributes {
+			if strings.EqualFold(attr.Type, "DC") {
+				parts = append(parts, "DC="+attr.Value)
+			}
+		}
+	}
+	return strings.Join(parts, ",")
+}
+
+// MaxPasswordAge reads the domain's maximum password age, maxPwdAge, from
+// the domain the base DN is in. It returns 0 when passwords never expire.
+func (c *Client) MaxPasswordAge() (time.Duration, error) {
+	domain := DomainDN(c.BaseDN)
+	if domain == "" {
+		return 0, fmt.Errorf("no domain in base DN %s", c.BaseDN)
+	}
+
+	searchRequest := ldap.NewSearchRequest(
+		domain,
+		ldap.ScopeBaseObject, ldap.NeverDerefAliases, 1, 0, false,
+		"(objectClass=*)",
+		[]string{"maxPwdAge"},
+		nil,
+	)
+
+	sr, err := c.Conn.Search(searchRequest)
+	if err != nil {
+		return 0, fmt.Errorf("failed to read maxPwdAge: %v", err)
+	}
+	if len(sr.Entries) == 0 {
+		return 0, nil
+	}
+
+	// A negative number of 100-nanosecond intervals; the smallest means never
+	n, err := strconv.ParseInt(sr.Entries[0].GetAttributeValue("maxPwdAge"), 10, 64)
+	if err != nil || n >= 0 || n == math.MinInt64 {
+		return 0, nil
+	}
+	return time.Duration(-n) * 100, nil
+}
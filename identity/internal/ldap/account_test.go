@@ -0,0 +1,70 @@
+package ldap
+
+import (
+	"testing"
+	"time"
+)
+
+func TestFileTime(t *testing.T) {
+	if got := FileTime("133500000000000000"); got == nil || !got.Equal(time.Date(2024, 1, 17, 21, 20, 0, 0, time.UTC)) {
+		t.Errorf("FileTime() = %v, want 2024-01-17 21:20 UTC", got)
+	}
+	for _, never := range []string{"", "0", "9223372036854775807", "-1"} {
+		if got := FileTime(never); got != nil {
+			t.Errorf("FileTime(%q) = %v, want nil", never, got)
+		}
+	}
+}
+
+func TestGeneralizedTime(t *testing.T) {
+	if got := GeneralizedTime("20240131120500.0Z"); got == nil || !got.Equal(time.Date(2024, 1, 31, 12, 5, 0, 0, time.UTC)) {
+		t.Errorf("GeneralizedTime() = %v, want 2024-01-31 12:05 UTC", got)
+	}
+	if got := GeneralizedTime("yesterday"); got != nil {
+		t.Errorf("GeneralizedTime(yesterday) = %v, want nil", got)
+	}
+}
+
+func TestPasswordExpiresAt(t *testing.T) {
+	set := "133500000000000000"
+	maxAge := 42 * 24 * time.Hour
+	expires := time.Date(2024, 2, 28, 21, 20, 0, 0, time.UTC)
+
+	tests := []struct {
+		name       string
+		uac        int
+		pwdLastSet string
+		computed   string
+		maxAge     time.Duration
+		want       *time.Time
+	}{
+		{"domain policy", 0x200, set, "", maxAge, &expires},
+		{"computed", 0x200, set, "133530000000000000", maxAge, FileTime("133530000000000000")},
+		{"computed never", 0x200, set, "9223372036854775807", maxAge, nil},
+		{"no policy", 0x200, set, "", 0, nil},
+		{"never expires", 0x200 | UACDontExpirePassword, set, "", maxAge, nil},
+		{"smart card", 0x200 | UACSmartcardRequired, set, "", maxAge, nil},
+		{"must change", 0x200, "0", "", maxAge, nil},
+	}
+
+	for _, tt := range tests {
+		got := PasswordExpiresAt(tt.uac, tt.pwdLastSet, tt.computed, tt.maxAge)
+		if (got == nil) != (tt.want == nil) || (got != nil && !got.Equal(*tt.want)) {
+			t.Errorf("%s: PasswordExpiresAt() = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestDomainDN(t *testing.T) {
+	tests := map[string]string{
+		"OU=Staff,DC=corp,DC=example": "DC=corp,DC=example",
+		"dc=corp,dc=example":          "DC=corp,DC=example",
+		"OU=Staff":                    "",
+		"not a dn":                    "",
+	}
+	for dn, want := range tests {
+		if got := DomainDN(dn); got != want {
+			t.Errorf("DomainDN(%q) = %q, want %q", dn, got, want)
+		}
+	}
+}
@@ -3,11 +3,19 @@ package ldap
 import (
 	"crypto/tls"
 	"fmt"
-	"log"
 
+	"github.com/VanCannon/openpam/pkg/logger"
 	"github.com/go-ldap/ldap/v3"
 )
 
+// log is the identity service's logger, replaced by SetLogger at startup
+var log = logger.Default()
+
+// SetLogger sets the logger the package logs with
+func SetLogger(l *logger.Logger) {
+	log = l
+}
+
 type Client struct {
 	Host         string
 	Port         int
@@ -29,7 +37,9 @@ func NewClient(host string, port int, baseDN, bindDN, bindPassword string) *Clie
 
 func (c *Client) Connect() error {
 	address := fmt.Sprintf("%s:%d", c.Host, c.Port)
-	log.Printf("Connecting to LDAP at %s", address)
+	log.Info("Connecting to LDAP", map[string]interface{}{
+		"address": address,
+	})
 
 	// Try StartTLS first, fall back to plain if needed (or configure via struct)
 	// For simplicity, assuming standard LDAP or LDAPS based on port
@@ -43,7 +53,9 @@ func (c *Client) Connect() error {
 		if err == nil {
 			// Try StartTLS
 			if err = l.StartTLS(&tls.Config{InsecureSkipVerify: true}); err != nil {
-				log.Printf("Failed to StartTLS: %v", err)
+				log.Warn("Failed to StartTLS", map[string]interface{}{
+					"error": err.Error(),
+				})
 				// Continue anyway, maybe server allows plain auth (though unlikely given the error)
 				// But in this case, we know it failed, so we should probably return error if StartTLS fails
 				// However, for broad compatibility, let's log and proceed, or maybe return error?
@@ -60,12 +72,21 @@ func (c *Client) Connect() error {
 
 	// Redundant StartTLS block removed
 
+	if Kerberos != nil {
+		if err := c.kerberosBind(l); err != nil {
+			l.Close()
+			return err
+		}
+		c.Conn = l
+		return nil
+	}
+
 	// Bind
 	err = l.Bind(c.BindDN, c.BindPassword)
 	if err != nil {
 		// Check for Strong Auth Required (LDAP Result Code 8)
 		if ldapErr, ok := err.(*ldap.Error); ok && ldapErr.ResultCode == 8 {
-			log.Println("Simple Bind failed (Strong Auth Required), attempting NTLM Bind...")
+			log.Info("Simple Bind failed (Strong Auth Required), attempting NTLM Bind...")
 			// NTLM Bind requires DOMAIN\User or User@Domain
 			// We'll try to use the BindDN as is, assuming the user provided it in a compatible format
 			// If it's a DN, NTLM might fail or we might need to parse it, but let's try direct first
@@ -114,7 +135,8 @@ func (c *Client) SearchUsers(filter string) ([]*ldap.Entry, error) {
 		c.BaseDN,
 		ldap.ScopeWholeSubtree, ldap.NeverDerefAliases, 0, 0, false,
 		filter,
-		[]string{"sAMAccountName", "mail", "displayName", "memberOf", "userPrincipalName", "userAccountControl", "distinguishedName", "pwdLastSet"},
+		[]string{"sAMAccountName", "mail", "displayName", "memberOf", "userPrincipalName", "userAccountControl", "distinguishedName", "pwdLastSet",
+			"lastLogonTimestamp", "whenCreated", "msDS-UserPasswordExpiryTimeComputed"},
 		nil,
 	)
 
@@ -131,7 +153,7 @@ func (c *Client) SearchComputers(filter string) ([]*ldap.Entry, error) {
 		c.BaseDN,
 		ldap.ScopeWholeSubtree, ldap.NeverDerefAliases, 0, 0, false,
 		filter,
-		[]string{"name", "dNSHostName", "operatingSystem", "operatingSystemVersion", "distinguishedName"},
+		[]string{"name", "dNSHostName", "operatingSystem", "operatingSystemVersion", "distinguishedName", "userAccountControl"},
 		nil,
 	)
 
@@ -165,27 +187,52 @@ func (c *Client) Authenticate(username, password string) (*ldap.Entry, error) {
 	// Ideally, we should use a separate connection for the user bind to avoid messing up the main connection
 	// But for now, we can try to find the user first, then attempt a bind with their DN
 
-	log.Printf("Authenticating user: %s", username)
+	log.Info("Authenticating user", map[string]interface{}{
+		"username": username,
+	})
 
 	// Find the user to get their DN
 	// Search by sAMAccountName, userPrincipalName, or mail
 	filter := fmt.Sprintf("(&(objectClass=user)(|(sAMAccountName=%s)(userPrincipalName=%s)(mail=%s)))", username, username, username)
 
-	log.Printf("Searching for user with filter: %s", filter)
+	log.Debug("Searching for user", map[string]interface{}{
+		"filter": filter,
+	})
 	users, err := c.SearchUsers(filter)
 	if err != nil {
-		log.Printf("Search failed: %v", err)
+		log.Error("Search failed", map[string]interface{}{
+			"error": err.Error(),
+		})
 		return nil, fmt.Errorf("failed to search for user: %v", err)
 	}
 
 	if len(users) == 0 {
-		log.Printf("User not found: %s", username)
+		log.Warn("User not found", map[string]interface{}{
+			"username": username,
+		})
 		return nil, fmt.Errorf("user not found")
 	}
 
 	userEntry := users[0]
 	userDN := userEntry.DN
-	log.Printf("Found user DN: %s", userDN)
+	log.Debug("Found user DN", map[string]interface{}{
+		"dn": userDN,
+	})
+
+	// With Kerberos the password is checked by the KDC instead of a bind
+	if Kerberos != nil {
+		if err := kerberosAuthenticate(userEntry, password); err != nil {
+			log.Warn("Kerberos login failed", map[string]interface{}{
+				"dn":    userDN,
+				"error": err.Error(),
+			})
+			return nil, fmt.Errorf("authentication failed: %v", err)
+		}
+		log.Info("Successfully authenticated user", map[string]interface{}{
+			"username": username,
+		})
+		return userEntry, nil
+	}
 
 	// 2. Attempt to bind as the user
 	// Create a new connection for this authentication attempt
@@ -202,19 +249,28 @@ func (c *Client) Authenticate(username, password string) (*ldap.Entry, error) {
 	}
 
 	if err != nil {
-		log.Printf("Failed to connect for auth bind: %v", err)
+		log.Error("Failed to connect for auth bind", map[string]interface{}{
+			"error": err.Error(),
+		})
 		return nil, fmt.Errorf("failed to connect for auth: %v", err)
 	}
 	defer l.Close()
 
 	// Attempt Bind
-	log.Printf("Attempting Bind with DN: %s", userDN)
+	log.Debug("Attempting Bind", map[string]interface{}{
+		"dn": userDN,
+	})
 	err = l.Bind(userDN, password)
 	if err != nil {
-		log.Printf("Bind failed for %s: %v", userDN, err)
+		log.Warn("Bind failed", map[string]interface{}{
+			"dn":    userDN,
+			"error": err.Error(),
+		})
 		return nil, fmt.Errorf("authentication failed: %v", err)
 	}
 
-	log.Printf("Successfully authenticated user: %s", username)
+	log.Info("Successfully authenticated user", map[string]interface{}{
+		"username": username,
+	})
 	return userEntry, nil
 }
@@ -0,0 +1,66 @@
+package ldap
+
+import (
+	"fmt"
+
+	"github.com/VanCannon/openpam/pkg/kerberos"
+	"github.com/go-ldap/ldap/v3"
+	"github.com/go-ldap/ldap/v3/gssapi"
+	"github.com/jcmturner/gokrb5/v8/client"
+)
+
+// KerberosConfig makes binds use SPNEGO (SASL GSSAPI) with Kerberos tickets
+// rather than simple or NTLM binds
+type KerberosConfig struct {
+	kerberos.Config
+	Principal string // Principal the service binds as; defaults to the bind DN
+}
+
+// Kerberos is set when the directory is bound to with Kerberos
+var Kerberos *KerberosConfig
+
+// kerberosBind binds l as the service principal, with its keytab when one is
+// configured and otherwise with the bind password
+func (c *Client) kerberosBind(l *ldap.Conn) error {
+	principal := Kerberos.Principal
+	if principal == "" {
+		principal = c.BindDN
+	}
+
+	var cl *client.Client
+	var err error
+	if Kerberos.Keytab != "" {
+		cl, err = Kerberos.LoginKeytab(principal)
+	} else {
+		cl, err = Kerberos.Login(principal, c.BindPassword)
+	}
+	if err != nil {
+		return err
+	}
+	krb := &gssapi.Client{Client: cl}
+	defer krb.Close()
+
+	log.Info("Binding to LDAP with Kerberos", map[string]interface{}{
+		"principal": principal,
+	})
+	if err := l.GSSAPIBind(krb, "ldap/"+c.Host, ""); err != nil {
+		return fmt.Errorf("failed to bind with Kerberos: %v", err)
+	}
+	return nil
+}
+
+// kerberosAuthenticate checks a user's password by obtaining a ticket for
+// them. UPN suffixes need not match the realm, so the account name is used.
+func kerberosAuthenticate(user *ldap.Entry, password string) error {
+	principal := user.GetAttributeValue("sAMAccountName")
+	if principal == "" {
+		principal = user.GetAttributeValue("userPrincipalName")
+	}
+
+	cl, err := Kerberos.Login(principal, password)
+	if err != nil {
+		return err
+	}
+	cl.Destroy()
+	return nil
+}
@@ -0,0 +1,98 @@
+package ldap
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/go-ldap/ldap/v3"
+)
+
+// matchingRuleInChain is AD's LDAP_MATCHING_RULE_IN_CHAIN, which follows
+// nested group membership
+const matchingRuleInChain = "1.2.840.113556.1.4.1941"
+
+// Member is a user in a group, either itself or through a nested group
+type Member struct {
+	DN             string `json:"dn"`
+	SAMAccountName string `json:"sam_account_name"`
+	Direct         bool   `json:"direct"`
+}
+
+// SearchPrivilegedGroups finds the groups given by name, or by distinguished
+// name for entries containing "="
+func (c *Client) SearchPrivilegedGroups(groups []string) ([]*ldap.Entry, error) {
+	if len(groups) == 0 {
+		return nil, nil
+	}
+
+	var filter strings.Builder
+	filter.WriteString("(&(objectClass=group)(|")
+	for _, g := range groups {
+		if strings.Contains(g, "=") {
+			filter.WriteString("(distinguishedName=" + ldap.EscapeFilter(g) + ")")
+		} else {
+			filter.WriteString("(name=" + ldap.EscapeFilter(g) + ")")
+		}
+	}
+	filter.WriteString("))")
+
+	return c.SearchGroups(filter.String())
+}
+
+// GroupMembers returns the users in the group at dn, including those in
+// nested groups. direct are the group's own member values, which tell the
+// users who are members themselves.
+func (c *Client) GroupMembers(dn string, direct []string) ([]Member, error) {
+	searchRequest := ldap.NewSearchRequest(
+		c.BaseDN,
+		ldap.ScopeWholeSubtree, ldap.NeverDerefAliases, 0, 0, false,
+		fmt.Sprintf("(&(objectCategory=person)(objectClass=user)(memberOf:%s:=%s))", matchingRuleInChain, ldap.EscapeFilter(dn)),
+		[]string{"sAMAccountName"},
+		nil,
+	)
+
+	sr, err := c.Conn.SearchWithPaging(searchRequest, 500)
+	if err != nil {
+		return nil, fmt.Errorf("failed to search members of %s: %v", dn, err)
+	}
+
+	isDirect := make(map[string]bool, len(direct))
+	for _, m := range direct {
+		isDirect[strings.ToLower(m)] = true
+	}
+
+	members := make([]Member, 0, len(sr.Entries))
+	for _, e := range sr.Entries {
+		members = append(members, Member{
+			DN:             e.DN,
+			SAMAccountName: e.GetAttributeValue("sAMAccountName"),
+			Direct:         isDirect[strings.ToLower(e.DN)],
+		})
+	}
+	return members, nil
+}
+
+// DiffMembers compares a group's members with an earlier snapshot of them.
+// DNs are compared case-insensitively, as AD does.
+func DiffMembers(previous, current []string) (added, removed []string) {
+	before := make(map[string]bool, len(previous))
+	for _, dn := range previous {
+		before[strings.ToLower(dn)] = true
+	}
+	now := make(map[string]bool, len(current))
+	for _, dn := range current {
+		now[strings.ToLower(dn)] = true
+	}
+
+	for _, dn := range current {
+		if !before[strings.ToLower(dn)] {
+			added = append(added, dn)
+		}
+	}
+	for _, dn := range previous {
+		if !now[strings.ToLower(dn)] {
+			removed = append(removed, dn)
+		}
+	}
+	return added, removed
+}
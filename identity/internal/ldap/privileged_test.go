@@ -0,0 +1,32 @@
+package ldap
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestDiffMembers(t *testing.T) {
+	alice := "CN=Alice,OU=Admins,DC=corp,DC=example"
+	bob := "CN=Bob,OU=Admins,DC=corp,DC=example"
+	eve := "CN=Eve,OU=Staff,DC=corp,DC=example"
+
+	tests := []struct {
+		name              string
+		previous, current []string
+		added, removed    []string
+	}{
+		{"unchanged", []string{alice, bob}, []string{bob, alice}, nil, nil},
+		{"added", []string{alice}, []string{alice, eve}, []string{eve}, nil},
+		{"removed", []string{alice, bob}, []string{alice}, nil, []string{bob}},
+		{"replaced", []string{bob}, []string{eve}, []string{eve}, []string{bob}},
+		{"case only", []string{alice}, []string{"cn=alice,ou=admins,dc=corp,dc=example"}, nil, nil},
+		{"emptied", []string{alice}, nil, nil, []string{alice}},
+	}
+
+	for _, tt := range tests {
+		added, removed := DiffMembers(tt.previous, tt.current)
+		if !reflect.DeepEqual(added, tt.added) || !reflect.DeepEqual(removed, tt.removed) {
+			t.Errorf("%s: DiffMembers() = +%v -%v, want +%v -%v", tt.name, added, removed, tt.added, tt.removed)
+		}
+	}
+}
@@ -0,0 +1,143 @@
+package ldap
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/go-ldap/ldap/v3"
+)
+
+// userAccountControl flags
+const (
+	UACAccountDisable     = 0x2
+	UACLockout            = 0x10
+	UACDontExpirePassword = 0x10000
+	UACSmartcardRequired  = 0x40000
+)
+
+// Write-back actions
+const (
+	ActionUnlock             = "unlock"
+	ActionEnable             = "enable"
+	ActionDisable            = "disable"
+	ActionForcePasswordReset = "force_password_reset"
+)
+
+// AccountState is the part of an AD account the write-back actions change
+type AccountState struct {
+	DN                 string `json:"dn"`
+	UserAccountControl int    `json:"user_account_control"`
+	LockoutTime        string `json:"lockout_time"`
+	PwdLastSet         string `json:"pwd_last_set"`
+}
+
+// Disabled reports whether the account is disabled
+func (s *AccountState) Disabled() bool {
+	return s.UserAccountControl&UACAccountDisable != 0
+}
+
+// Locked reports whether the account is locked out. AD doesn't keep the
+// LOCKOUT flag of userAccountControl up to date; lockoutTime is what counts.
+func (s *AccountState) Locked() bool {
+	return s.LockoutTime != "" && s.LockoutTime != "0"
+}
+
+// MustChangePassword reports whether the user has to change their password
+// at next logon
+func (s *AccountState) MustChangePassword() bool {
+	return s.PwdLastSet == "0"
+}
+
+// ReadAccountState reads the current state of the account at dn
+func (c *Client) ReadAccountState(dn string) (*AccountState, error) {
+	searchRequest := ldap.NewSearchRequest(
+		dn,
+		ldap.ScopeBaseObject, ldap.NeverDerefAliases, 1, 0, false,
+		"(objectClass=user)",
+		[]string{"userAccountControl", "lockoutTime", "pwdLastSet"},
+		nil,
+	)
+
+	sr, err := c.Conn.Search(searchRequest)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read account: %v", err)
+	}
+	if len(sr.Entries) == 0 {
+		return nil, fmt.Errorf("account not found: %s", dn)
+	}
+
+	entry := sr.Entries[0]
+	uac, err := strconv.Atoi(entry.GetAttributeValue("userAccountControl"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid userAccountControl for %s: %v", dn, err)
+	}
+
+	return &AccountState{
+		DN:                 entry.DN,
+		UserAccountControl: uac,
+		LockoutTime:        entry.GetAttributeValue("lockoutTime"),
+		PwdLastSet:         entry.GetAttributeValue("pwdLastSet"),
+	}, nil
+}
+
+// Change is one attribute a write-back action sets
+type Change struct {
+	Attribute string `json:"attribute"`
+	From      string `json:"from"`
+	To        string `json:"to"`
+}
+
+// PlanAction returns the change that applies action to an account in state,
+// or nil if the account is already as the action would leave it
+func PlanAction(action string, state *AccountState) (*Change, error) {
+	switch action {
+	case ActionUnlock:
+		if !state.Locked() {
+			return nil, nil
+		}
+		return &Change{Attribute: "lockoutTime", From: state.LockoutTime, To: "0"}, nil
+	case ActionEnable, ActionDisable:
+		uac := state.UserAccountControl &^ UACAccountDisable
+		if action == ActionDisable {
+			uac |= UACAccountDisable
+		}
+		if uac == state.UserAccountControl {
+			return nil, nil
+		}
+		return &Change{Attribute: "userAccountControl", From: strconv.Itoa(state.UserAccountControl), To: strconv.Itoa(uac)}, nil
+	case ActionForcePasswordReset:
+		if state.MustChangePassword() {
+			return nil, nil
+		}
+		return &Change{Attribute: "pwdLastSet", From: state.PwdLastSet, To: "0"}, nil
+	default:
+		return nil, fmt.Errorf("unknown action: %s", action)
+	}
+}
+
+// Applied reports whether state shows the effect of action
+func Applied(action string, state *AccountState) bool {
+	switch action {
+	case ActionUnlock:
+		return !state.Locked()
+	case ActionEnable:
+		return !state.Disabled()
+	case ActionDisable:
+		return state.Disabled()
+	case ActionForcePasswordReset:
+		return state.MustChangePassword()
+	default:
+		return false
+	}
+}
+
+// Apply writes change to the account at dn
+func (c *Client) Apply(dn string, change *Change) error {
+	modifyRequest := ldap.NewModifyRequest(dn, nil)
+	modifyRequest.Replace(change.Attribute, []string{change.To})
+
+	if err := c.Conn.Modify(modifyRequest); err != nil {
+		return fmt.Errorf("failed to modify %s: %v", change.Attribute, err)
+	}
+	return nil
+}
@@ -0,0 +1,42 @@
+package ldap
+
+import "testing"
+
+func TestPlanAction(t *testing.T) {
+	active := &AccountState{UserAccountControl: 0x200, LockoutTime: "0", PwdLastSet: "133500000000000000"}
+	locked := &AccountState{UserAccountControl: 0x200, LockoutTime: "133500000000000000", PwdLastSet: "133500000000000000"}
+	disabled := &AccountState{UserAccountControl: 0x202, PwdLastSet: "0"}
+
+	tests := []struct {
+		action string
+		state  *AccountState
+		want   *Change
+	}{
+		{ActionUnlock, locked, &Change{Attribute: "lockoutTime", From: "133500000000000000", To: "0"}},
+		{ActionUnlock, active, nil},
+		{ActionDisable, active, &Change{Attribute: "userAccountControl", From: "512", To: "514"}},
+		{ActionDisable, disabled, nil},
+		{ActionEnable, disabled, &Change{Attribute: "userAccountControl", From: "514", To: "512"}},
+		{ActionEnable, active, nil},
+		{ActionForcePasswordReset, active, &Change{Attribute: "pwdLastSet", From: "133500000000000000", To: "0"}},
+		{ActionForcePasswordReset, disabled, nil},
+	}
+
+	for _, tt := range tests {
+		got, err := PlanAction(tt.action, tt.state)
+		if err != nil {
+			t.Fatalf("PlanAction(%s) error = %v", tt.action, err)
+		}
+		if (got == nil) != (tt.want == nil) || (got != nil && *got != *tt.want) {
+			t.Errorf("PlanAction(%s, %+v) = %+v, want %+v", tt.action, tt.state, got, tt.want)
+		}
+		// An account needing no change already shows the action's effect
+		if got == nil && !Applied(tt.action, tt.state) {
+			t.Errorf("Applied(%s, %+v) = false for an unchanged account", tt.action, tt.state)
+		}
+	}
+
+	if _, err := PlanAction("delete", active); err == nil {
+		t.Error("PlanAction accepted an unknown action")
+	}
+}
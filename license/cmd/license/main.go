@@ -2,6 +2,7 @@ package main
 
 import (
 	"context"
+	"expvar"
 	"fmt"
 	"net/http"
 	"os"
@@ -15,7 +16,8 @@ import (
 	"github.com/VanCannon/openpam/license/internal/events"
 	"github.com/VanCannon/openpam/license/internal/handlers"
 	"github.com/VanCannon/openpam/license/internal/license"
-	"github.com/VanCannon/openpam/license/pkg/logger"
+	"github.com/VanCannon/openpam/pkg/logger"
+	"github.com/VanCannon/openpam/pkg/recovery"
 )
 
 func main() {
@@ -27,7 +29,7 @@ func main() {
 	}
 
 	// Initialize logger
-	log := logger.New(cfg.Logging.Level, cfg.Logging.Format)
+	log := logger.NewService("license", cfg.Logging.Level, cfg.Logging.Format)
 	log.Info("Starting License Agent", map[string]interface{}{
 		"port": cfg.Server.Port,
 	})
@@ -42,7 +44,7 @@ func main() {
 	defer db.Close()
 
 	// Initialize service
-	svc := license.NewService(db.DB(), log)
+	svc := license.NewService(db.DB(), log, cfg.Counting.EphemeralTargets)
 
 	// Initialize NATS publisher
 	publisher, err := events.NewPublisher(cfg.NATS.URL, log)
@@ -53,6 +55,27 @@ func main() {
 	}
 	defer publisher.Close()
 
+	// Start usage snapshots and license alerts
+	if err := svc.EnsureTelemetrySchema(); err != nil {
+		log.Fatal("Failed to prepare telemetry tables", map[string]interface{}{
+			"error": err.Error(),
+		})
+	}
+
+	telemetry := license.NewTelemetry(
+		svc,
+		publisher,
+		log,
+		cfg.Telemetry.GetSnapshotInterval(),
+		cfg.Telemetry.GetUsageThresholds(),
+		cfg.Telemetry.GetExpiryDays(),
+	)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	go telemetry.Start(ctx)
+
 	// Initialize NATS subscriber
 	subscriber, err := events.NewSubscriber(cfg.NATS.URL, svc, log)
 	if err != nil {
@@ -84,14 +107,26 @@ func main() {
 	mux.HandleFunc("/health", handler.Health)
 	mux.HandleFunc("/api/v1/license/validate", handler.ValidateLicense)
 	mux.HandleFunc("/api/v1/license/usage", handler.GetUsageStats)
+	mux.HandleFunc("/api/v1/license/usage-history", handler.GetUsageHistory)
 	mux.HandleFunc("/api/v1/license/feature", handler.CheckFeature)
 	mux.HandleFunc("/api/v1/license", handler.GetLicense)
 
+	mux.Handle("/debug/vars", expvar.Handler())
+
+	reporter, err := recovery.NewReporter(os.Getenv("SENTRY_DSN"), "license", os.Getenv("SENTRY_ENVIRONMENT"), "")
+	if err != nil {
+		log.Fatal("Invalid SENTRY_DSN", map[string]interface{}{
+			"error": err.Error(),
+		})
+	}
+
 	// Create HTTP server
 	addr := fmt.Sprintf("%s:%d", cfg.Server.Host, cfg.Server.Port)
 	server := &http.Server{
 		Addr:         addr,
-		Handler:      mux,
+		Handler:      recovery.RequestID(recovery.Middleware("license", func(message string, fields map[string]interface{}) {
+			log.Error(message, fields)
+		}, reporter)(mux)),
 		ReadTimeout:  15 * time.Second,
 		WriteTimeout: 15 * time.Second,
 		IdleTimeout:  60 * time.Second,
@@ -116,6 +151,10 @@ func main() {
 
 	log.Info("Shutting down server...", nil)
 
+	// Stop telemetry
+	telemetry.Stop()
+	cancel()
+
 	// Deregister from Consul
 	if consulClient != nil {
 		if err := consulClient.Agent().ServiceDeregister(cfg.Consul.ServiceID); err != nil {
@@ -126,10 +165,10 @@ func main() {
 	}
 
 	// Graceful shutdown
-	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
-	defer cancel()
+	shutdownCtx, shutdownCancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer shutdownCancel()
 
-	if err := server.Shutdown(ctx); err != nil {
+	if err := server.Shutdown(shutdownCtx); err != nil {
 		log.Error("Server forced to shutdown", map[string]interface{}{
 			"error": err.Error(),
 		})
@@ -3,16 +3,19 @@ package config
 import (
 	"fmt"
 	"os"
+	"time"
 
 	"gopkg.in/yaml.v3"
 )
 
 type Config struct {
-	Server   ServerConfig   `yaml:"server"`
-	Database DatabaseConfig `yaml:"database"`
-	NATS     NATSConfig     `yaml:"nats"`
-	Consul   ConsulConfig   `yaml:"consul"`
-	Logging  LoggingConfig  `yaml:"logging"`
+	Server    ServerConfig    `yaml:"server"`
+	Database  DatabaseConfig  `yaml:"database"`
+	NATS      NATSConfig      `yaml:"nats"`
+	Consul    ConsulConfig    `yaml:"consul"`
+	Logging   LoggingConfig   `yaml:"logging"`
+	Counting  CountingConfig  `yaml:"counting"`
+	Telemetry TelemetryConfig `yaml:"telemetry"`
 }
 
 type ServerConfig struct {
@@ -44,6 +47,22 @@ type ConsulConfig struct {
 	DeregisterCriticalServiceAfter string `yaml:"deregister_critical_service_after"`
 }
 
+// CountingConfig controls which resources count towards license limits
+type CountingConfig struct {
+	// EphemeralTargets includes short-lived automation targets in the MaxTargets count
+	EphemeralTargets bool `yaml:"ephemeral_targets"`
+}
+
+// TelemetryConfig controls usage snapshots and license alerts
+type TelemetryConfig struct {
+	// SnapshotInterval is how often usage is sampled; each day keeps its peak
+	SnapshotInterval string `yaml:"snapshot_interval"`
+	// UsageThresholds are percentages of a limit that trigger an alert
+	UsageThresholds []int `yaml:"usage_thresholds"`
+	// ExpiryDays are the days before expiry that trigger an alert
+	ExpiryDays []int `yaml:"expiry_days"`
+}
+
 type LoggingConfig struct {
 	Level  string `yaml:"level"`
 	Format string `yaml:"format"`
@@ -83,3 +102,25 @@ func (c *DatabaseConfig) ConnectionString() string {
 		c.Host, c.Port, c.User, c.Password, c.Name, c.SSLMode,
 	)
 }
+
+func (c *TelemetryConfig) GetSnapshotInterval() time.Duration {
+	d, err := time.ParseDuration(c.SnapshotInterval)
+	if err != nil || d <= 0 {
+		return 1 * time.Hour
+	}
+	return d
+}
+
+func (c *TelemetryConfig) GetUsageThresholds() []int {
+	if len(c.UsageThresholds) == 0 {
+		return []int{80, 95}
+	}
+	return c.UsageThresholds
+}
+
+func (c *TelemetryConfig) GetExpiryDays() []int {
+	if len(c.ExpiryDays) == 0 {
+		return []int{30, 7, 1}
+	}
+	return c.ExpiryDays
+}
@@ -6,7 +6,8 @@ import (
 	"time"
 
 	"github.com/nats-io/nats.go"
-	"github.com/VanCannon/openpam/license/pkg/logger"
+	"github.com/VanCannon/openpam/license/internal/license"
+	"github.com/VanCannon/openpam/pkg/logger"
 )
 
 type Publisher struct {
@@ -52,9 +53,20 @@ type UsageThresholdEvent struct {
 	Current    int       `json:"current"`
 	Limit      int       `json:"limit"`
 	Percentage float64   `json:"percentage"`
+	Threshold  int       `json:"threshold,omitempty"`
 	Timestamp  time.Time `json:"timestamp"`
 }
 
+type LicenseExpiringEvent struct {
+	Type          string    `json:"type"`
+	LicenseID     string    `json:"license_id"`
+	IssuedTo      string    `json:"issued_to"`
+	ExpiresAt     time.Time `json:"expires_at"`
+	DaysRemaining int       `json:"days_remaining"`
+	Threshold     int       `json:"threshold"`
+	Timestamp     time.Time `json:"timestamp"`
+}
+
 type FeatureAccessEvent struct {
 	Type      string    `json:"type"`
 	Feature   string    `json:"feature"`
@@ -100,6 +112,49 @@ func (p *Publisher) PublishUsageThreshold(event *UsageThresholdEvent) error {
 	return nil
 }
 
+func (p *Publisher) PublishLicenseExpiring(event *LicenseExpiringEvent) error {
+	event.Timestamp = time.Now()
+	data, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("failed to marshal event: %w", err)
+	}
+
+	if err := p.nc.Publish("openpam.license.expiring", data); err != nil {
+		return fmt.Errorf("failed to publish event: %w", err)
+	}
+
+	p.logger.Warn("Published license expiring event", map[string]interface{}{
+		"license_id":     event.LicenseID,
+		"days_remaining": event.DaysRemaining,
+	})
+
+	return nil
+}
+
+// NotifyUsageThreshold implements license.Notifier
+func (p *Publisher) NotifyUsageThreshold(resource string, current, limit, threshold int) error {
+	return p.PublishUsageThreshold(&UsageThresholdEvent{
+		Type:       "usage_threshold",
+		Resource:   resource,
+		Current:    current,
+		Limit:      limit,
+		Percentage: float64(current) * 100 / float64(limit),
+		Threshold:  threshold,
+	})
+}
+
+// NotifyExpiring implements license.Notifier
+func (p *Publisher) NotifyExpiring(l *license.License, daysRemaining, threshold int) error {
+	return p.PublishLicenseExpiring(&LicenseExpiringEvent{
+		Type:          "license_expiring",
+		LicenseID:     l.ID,
+		IssuedTo:      l.IssuedTo,
+		ExpiresAt:     *l.ExpiresAt,
+		DaysRemaining: daysRemaining,
+		Threshold:     threshold,
+	})
+}
+
 func (p *Publisher) PublishFeatureAccess(event *FeatureAccessEvent) error {
 	event.Timestamp = time.Now()
 	data, err := json.Marshal(event)
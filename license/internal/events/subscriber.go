@@ -6,7 +6,7 @@ import (
 
 	"github.com/nats-io/nats.go"
 	"github.com/VanCannon/openpam/license/internal/license"
-	"github.com/VanCannon/openpam/license/pkg/logger"
+	"github.com/VanCannon/openpam/pkg/logger"
 )
 
 type Subscriber struct {
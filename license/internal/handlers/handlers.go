@@ -3,9 +3,10 @@ package handlers
 import (
 	"encoding/json"
 	"net/http"
+	"strconv"
 
 	"github.com/VanCannon/openpam/license/internal/license"
-	"github.com/VanCannon/openpam/license/pkg/logger"
+	"github.com/VanCannon/openpam/pkg/logger"
 )
 
 type Handler struct {
@@ -76,6 +77,37 @@ func (h *Handler) GetUsageStats(w http.ResponseWriter, r *http.Request) {
 	h.jsonResponse(w, stats, http.StatusOK)
 }
 
+func (h *Handler) GetUsageHistory(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		h.errorResponse(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	days := 30
+	if d := r.URL.Query().Get("days"); d != "" {
+		parsed, err := strconv.Atoi(d)
+		if err != nil || parsed < 1 || parsed > 366 {
+			h.errorResponse(w, "days must be between 1 and 366", http.StatusBadRequest)
+			return
+		}
+		days = parsed
+	}
+
+	history, err := h.service.GetUsageHistory(days)
+	if err != nil {
+		h.logger.Error("Failed to get usage history", map[string]interface{}{
+			"error": err.Error(),
+		})
+		h.errorResponse(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	h.jsonResponse(w, map[string]interface{}{
+		"days":      days,
+		"snapshots": history,
+	}, http.StatusOK)
+}
+
 func (h *Handler) CheckFeature(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
 		h.errorResponse(w, "Method not allowed", http.StatusMethodNotAllowed)
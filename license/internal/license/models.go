@@ -44,6 +44,18 @@ type UsageStats struct {
 	Timestamp       time.Time `json:"timestamp"`
 }
 
+// UsageSnapshot is a day's peak usage, recorded with the limits in force that day
+type UsageSnapshot struct {
+	Date        time.Time `json:"date"`
+	Users       int       `json:"users"`
+	Targets     int       `json:"targets"`
+	Sessions    int       `json:"sessions"`
+	MaxUsers    *int      `json:"max_users,omitempty"`
+	MaxTargets  *int      `json:"max_targets,omitempty"`
+	MaxSessions *int      `json:"max_sessions,omitempty"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
 type FeatureCheckRequest struct {
 	Feature string `json:"feature"`
 }
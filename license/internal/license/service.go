@@ -6,18 +6,22 @@ import (
 	"fmt"
 	"time"
 
-	"github.com/VanCannon/openpam/license/pkg/logger"
+	"github.com/VanCannon/openpam/pkg/logger"
 )
 
 type Service struct {
 	db     *sql.DB
 	logger *logger.Logger
+
+	// countEphemeralTargets includes ephemeral targets in the MaxTargets count
+	countEphemeralTargets bool
 }
 
-func NewService(db *sql.DB, log *logger.Logger) *Service {
+func NewService(db *sql.DB, log *logger.Logger, countEphemeralTargets bool) *Service {
 	return &Service{
-		db:     db,
-		logger: log,
+		db:                    db,
+		logger:                log,
+		countEphemeralTargets: countEphemeralTargets,
 	}
 }
 
@@ -174,8 +178,11 @@ func (s *Service) GetUsageStats() (*UsageStats, error) {
 		return nil, fmt.Errorf("failed to count users: %w", err)
 	}
 
-	// Count targets
-	err = s.db.QueryRow("SELECT COUNT(*) FROM targets WHERE status = 'active'").Scan(&stats.CurrentTargets)
+	// Count targets. Deleted targets never count, ephemeral ones only if configured to.
+	err = s.db.QueryRow(
+		"SELECT COUNT(*) FROM targets WHERE enabled = true AND deleted_at IS NULL AND (ephemeral = false OR $1)",
+		s.countEphemeralTargets,
+	).Scan(&stats.CurrentTargets)
 	if err != nil {
 		return nil, fmt.Errorf("failed to count targets: %w", err)
 	}
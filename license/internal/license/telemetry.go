@@ -0,0 +1,353 @@
+package license
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"math"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/VanCannon/openpam/pkg/logger"
+)
+
+// telemetrySchema creates the tables the telemetry job writes to. Snapshots
+// hold one row per day with the peak counts seen that day; alerts remember
+// which notifications were already sent so each fires once.
+const telemetrySchema = `
+CREATE TABLE IF NOT EXISTS license_usage_snapshots (
+    snapshot_date DATE PRIMARY KEY,
+    users INTEGER NOT NULL DEFAULT 0,
+    targets INTEGER NOT NULL DEFAULT 0,
+    sessions INTEGER NOT NULL DEFAULT 0,
+    max_users INTEGER,
+    max_targets INTEGER,
+    max_sessions INTEGER,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+);
+
+CREATE TABLE IF NOT EXISTS license_alerts (
+    license_id UUID NOT NULL,
+    alert_key VARCHAR(100) NOT NULL,
+    sent_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    PRIMARY KEY (license_id, alert_key)
+);
+`
+
+// Notifier delivers license alerts to the notification subsystem
+type Notifier interface {
+	NotifyUsageThreshold(resource string, current, limit, threshold int) error
+	NotifyExpiring(license *License, daysRemaining, threshold int) error
+}
+
+// EnsureTelemetrySchema creates the telemetry tables if they don't exist
+func (s *Service) EnsureTelemetrySchema() error {
+	if _, err := s.db.Exec(telemetrySchema); err != nil {
+		return fmt.Errorf("failed to create telemetry tables: %w", err)
+	}
+	return nil
+}
+
+// RecordUsageSnapshot records usage for the day of now, keeping the day's peak
+// counts. license may be nil when no license is active.
+func (s *Service) RecordUsageSnapshot(now time.Time, stats *UsageStats, license *License) error {
+	var maxUsers, maxTargets, maxSessions *int
+	if license != nil {
+		maxUsers, maxTargets, maxSessions = license.MaxUsers, license.MaxTargets, license.MaxSessions
+	}
+
+	query := `
+		INSERT INTO license_usage_snapshots (snapshot_date, users, targets, sessions,
+		                                     max_users, max_targets, max_sessions, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		ON CONFLICT (snapshot_date) DO UPDATE SET
+			users = GREATEST(license_usage_snapshots.users, EXCLUDED.users),
+			targets = GREATEST(license_usage_snapshots.targets, EXCLUDED.targets),
+			sessions = GREATEST(license_usage_snapshots.sessions, EXCLUDED.sessions),
+			max_users = EXCLUDED.max_users,
+			max_targets = EXCLUDED.max_targets,
+			max_sessions = EXCLUDED.max_sessions,
+			updated_at = EXCLUDED.updated_at
+	`
+
+	_, err := s.db.Exec(query, now.UTC().Format("2006-01-02"),
+		stats.CurrentUsers, stats.CurrentTargets, stats.CurrentSessions,
+		maxUsers, maxTargets, maxSessions, now)
+	if err != nil {
+		return fmt.Errorf("failed to record usage snapshot: %w", err)
+	}
+	return nil
+}
+
+// GetUsageHistory returns the daily snapshots of the last days days, oldest first
+func (s *Service) GetUsageHistory(days int) ([]UsageSnapshot, error) {
+	query := `
+		SELECT snapshot_date, users, targets, sessions, max_users, max_targets, max_sessions, updated_at
+		FROM license_usage_snapshots
+		WHERE snapshot_date > CURRENT_DATE - $1::int
+		ORDER BY snapshot_date ASC
+	`
+
+	rows, err := s.db.Query(query, days)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get usage history: %w", err)
+	}
+	defer rows.Close()
+
+	history := make([]UsageSnapshot, 0)
+	for rows.Next() {
+		var snapshot UsageSnapshot
+		var maxUsers, maxTargets, maxSessions sql.NullInt64
+
+		if err := rows.Scan(&snapshot.Date, &snapshot.Users, &snapshot.Targets, &snapshot.Sessions,
+			&maxUsers, &maxTargets, &maxSessions, &snapshot.UpdatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan usage snapshot: %w", err)
+		}
+
+		if maxUsers.Valid {
+			val := int(maxUsers.Int64)
+			snapshot.MaxUsers = &val
+		}
+		if maxTargets.Valid {
+			val := int(maxTargets.Int64)
+			snapshot.MaxTargets = &val
+		}
+		if maxSessions.Valid {
+			val := int(maxSessions.Int64)
+			snapshot.MaxSessions = &val
+		}
+
+		history = append(history, snapshot)
+	}
+
+	return history, rows.Err()
+}
+
+// alertSent reports whether an alert was already sent for a license
+func (s *Service) alertSent(licenseID, key string) (bool, error) {
+	var exists bool
+	err := s.db.QueryRow(
+		"SELECT EXISTS (SELECT 1 FROM license_alerts WHERE license_id = $1 AND alert_key = $2)",
+		licenseID, key,
+	).Scan(&exists)
+	return exists, err
+}
+
+// markAlertSent remembers that an alert was sent for a license
+func (s *Service) markAlertSent(licenseID, key string) error {
+	_, err := s.db.Exec(
+		"INSERT INTO license_alerts (license_id, alert_key) VALUES ($1, $2) ON CONFLICT DO NOTHING",
+		licenseID, key,
+	)
+	return err
+}
+
+// clearAlert forgets an alert, so it fires again the next time it applies
+func (s *Service) clearAlert(licenseID, key string) error {
+	_, err := s.db.Exec("DELETE FROM license_alerts WHERE license_id = $1 AND alert_key = $2", licenseID, key)
+	return err
+}
+
+// alertStore remembers which alerts were sent for a license
+type alertStore interface {
+	alertSent(licenseID, key string) (bool, error)
+	markAlertSent(licenseID, key string) error
+	clearAlert(licenseID, key string) error
+}
+
+// Telemetry periodically snapshots usage and alerts when usage nears the
+// license limits or the license nears expiry
+type Telemetry struct {
+	service         *Service
+	alerts          alertStore
+	notifier        Notifier
+	logger          *logger.Logger
+	interval        time.Duration
+	usageThresholds []int // percentages of a limit, ascending
+	expiryDays      []int // days before expiry, descending
+	stopChan        chan struct{}
+	stopOnce        sync.Once
+}
+
+func NewTelemetry(service *Service, notifier Notifier, logger *logger.Logger, interval time.Duration, usageThresholds, expiryDays []int) *Telemetry {
+	usage := append([]int(nil), usageThresholds...)
+	sort.Ints(usage)
+	expiry := append([]int(nil), expiryDays...)
+	sort.Sort(sort.Reverse(sort.IntSlice(expiry)))
+
+	return &Telemetry{
+		service:         service,
+		alerts:          service,
+		notifier:        notifier,
+		logger:          logger,
+		interval:        interval,
+		usageThresholds: usage,
+		expiryDays:      expiry,
+		stopChan:        make(chan struct{}),
+	}
+}
+
+func (t *Telemetry) Start(ctx context.Context) {
+	ticker := time.NewTicker(t.interval)
+	defer ticker.Stop()
+
+	t.logger.Info("License telemetry started", map[string]interface{}{
+		"interval":         t.interval.String(),
+		"usage_thresholds": t.usageThresholds,
+		"expiry_days":      t.expiryDays,
+	})
+
+	// Run immediately on start
+	t.run(time.Now())
+
+	for {
+		select {
+		case <-ticker.C:
+			t.run(time.Now())
+		case <-t.stopChan:
+			t.logger.Info("License telemetry stopped", nil)
+			return
+		case <-ctx.Done():
+			t.logger.Info("License telemetry context cancelled", nil)
+			return
+		}
+	}
+}
+
+func (t *Telemetry) Stop() {
+	t.stopOnce.Do(func() {
+		close(t.stopChan)
+	})
+}
+
+func (t *Telemetry) run(now time.Time) {
+	stats, err := t.service.GetUsageStats()
+	if err != nil {
+		t.logger.Error("Failed to get usage stats", map[string]interface{}{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	license, err := t.service.GetActiveLicense()
+	if err != nil && err != sql.ErrNoRows {
+		t.logger.Error("Failed to get active license", map[string]interface{}{
+			"error": err.Error(),
+		})
+		return
+	}
+	if err == sql.ErrNoRows {
+		license = nil
+	}
+
+	if err := t.service.RecordUsageSnapshot(now, stats, license); err != nil {
+		t.logger.Error("Failed to record usage snapshot", map[string]interface{}{
+			"error": err.Error(),
+		})
+	}
+
+	if license == nil {
+		return
+	}
+
+	t.checkUsage(license, "users", stats.CurrentUsers, license.MaxUsers)
+	t.checkUsage(license, "targets", stats.CurrentTargets, license.MaxTargets)
+	t.checkUsage(license, "sessions", stats.CurrentSessions, license.MaxSessions)
+	t.checkExpiry(license, now)
+}
+
+// checkUsage alerts once for the highest usage threshold crossed. Thresholds
+// usage has dropped back under are cleared so they alert again if crossed.
+func (t *Telemetry) checkUsage(license *License, resource string, current int, limit *int) {
+	if limit == nil || *limit <= 0 {
+		return
+	}
+	percent := float64(current) * 100 / float64(*limit)
+
+	crossed := 0
+	for _, threshold := range t.usageThresholds {
+		key := fmt.Sprintf("usage:%s:%d", resource, threshold)
+		if percent < float64(threshold) {
+			if err := t.alerts.clearAlert(license.ID, key); err != nil {
+				t.logAlertError(key, err)
+			}
+			continue
+		}
+		crossed = threshold
+	}
+	if crossed == 0 {
+		return
+	}
+
+	t.alertOnce(license, fmt.Sprintf("usage:%s:%d", resource, crossed), func() error {
+		return t.notifier.NotifyUsageThreshold(resource, current, *limit, crossed)
+	}, func(threshold int) bool { return percent >= float64(threshold) }, t.usageThresholds, "usage:"+resource)
+}
+
+// checkExpiry alerts once for the closest expiry threshold reached. Keys
+// include the expiry date, so renewing the license starts over.
+func (t *Telemetry) checkExpiry(license *License, now time.Time) {
+	if license.ExpiresAt == nil {
+		return
+	}
+	days := int(math.Ceil(license.ExpiresAt.Sub(now).Hours() / 24))
+	if days <= 0 {
+		return
+	}
+
+	crossed := 0
+	for _, threshold := range t.expiryDays {
+		if days <= threshold {
+			crossed = threshold
+		}
+	}
+	if crossed == 0 {
+		return
+	}
+
+	prefix := "expiry:" + license.ExpiresAt.UTC().Format("2006-01-02")
+	t.alertOnce(license, fmt.Sprintf("%s:%d", prefix, crossed), func() error {
+		return t.notifier.NotifyExpiring(license, days, crossed)
+	}, func(threshold int) bool { return days <= threshold }, t.expiryDays, prefix)
+}
+
+// alertOnce sends an alert unless it was sent before, then marks every
+// threshold that applies as sent so passing several at once alerts only once
+func (t *Telemetry) alertOnce(license *License, key string, send func() error, applies func(int) bool, thresholds []int, prefix string) {
+	sent, err := t.alerts.alertSent(license.ID, key)
+	if err != nil {
+		t.logAlertError(key, err)
+		return
+	}
+	if sent {
+		return
+	}
+
+	if err := send(); err != nil {
+		t.logAlertError(key, err)
+		return
+	}
+
+	for _, threshold := range thresholds {
+		if !applies(threshold) {
+			continue
+		}
+		if err := t.alerts.markAlertSent(license.ID, fmt.Sprintf("%s:%d", prefix, threshold)); err != nil {
+			t.logAlertError(key, err)
+		}
+	}
+
+	t.logger.Info("Sent license alert", map[string]interface{}{
+		"license_id": license.ID,
+		"alert":      key,
+	})
+}
+
+func (t *Telemetry) logAlertError(key string, err error) {
+	t.logger.Error("Failed to process license alert", map[string]interface{}{
+		"alert": key,
+		"error": err.Error(),
+	})
+}
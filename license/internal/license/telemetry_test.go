@@ -0,0 +1,231 @@
+package license
+
+import (
+	"fmt"
+	"io"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/VanCannon/openpam/pkg/logger"
+)
+
+// memoryAlerts keeps sent alerts in memory
+type memoryAlerts map[string]bool
+
+func (m memoryAlerts) alertSent(licenseID, key string) (bool, error) {
+	return m[licenseID+"/"+key], nil
+}
+
+func (m memoryAlerts) markAlertSent(licenseID, key string) error {
+	m[licenseID+"/"+key] = true
+	return nil
+}
+
+func (m memoryAlerts) clearAlert(licenseID, key string) error {
+	delete(m, licenseID+"/"+key)
+	return nil
+}
+
+func (m memoryAlerts) keys() []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// recordingNotifier records the alerts it is asked to deliver
+type recordingNotifier struct {
+	sent []string
+	err  error
+}
+
+func (n *recordingNotifier) NotifyUsageThreshold(resource string, current, limit, threshold int) error {
+	if n.err != nil {
+		return n.err
+	}
+	n.sent = append(n.sent, fmt.Sprintf("usage:%s:%d", resource, threshold))
+	return nil
+}
+
+func (n *recordingNotifier) NotifyExpiring(license *License, daysRemaining, threshold int) error {
+	if n.err != nil {
+		return n.err
+	}
+	n.sent = append(n.sent, fmt.Sprintf("expiry:%d", threshold))
+	return nil
+}
+
+func newTestTelemetry(alerts alertStore, notifier Notifier) *Telemetry {
+	t := NewTelemetry(nil, notifier, logger.New(logger.LevelError, io.Discard), time.Hour, []int{90, 80, 100}, []int{7, 30, 1})
+	t.alerts = alerts
+	return t
+}
+
+func intPtr(v int) *int {
+	return &v
+}
+
+func TestNewTelemetry_SortsThresholds(t *testing.T) {
+	tel := newTestTelemetry(memoryAlerts{}, &recordingNotifier{})
+
+	if want := []int{80, 90, 100}; !reflect.DeepEqual(tel.usageThresholds, want) {
+		t.Errorf("usage thresholds = %v, want %v", tel.usageThresholds, want)
+	}
+	if want := []int{30, 7, 1}; !reflect.DeepEqual(tel.expiryDays, want) {
+		t.Errorf("expiry days = %v, want %v", tel.expiryDays, want)
+	}
+}
+
+func TestCheckUsage(t *testing.T) {
+	license := &License{ID: "lic"}
+	alerts := memoryAlerts{}
+	notifier := &recordingNotifier{}
+	tel := newTestTelemetry(alerts, notifier)
+
+	steps := []struct {
+		name    string
+		current int
+		sent    []string
+		marked  []string
+	}{
+		{name: "Under every threshold", current: 70},
+		{
+			name:    "Jumping past two thresholds alerts once for the highest",
+			current: 95,
+			sent:    []string{"usage:users:90"},
+			marked:  []string{"lic/usage:users:80", "lic/usage:users:90"},
+		},
+		{
+			name:    "Staying above them doesn't alert again",
+			current: 92,
+			marked:  []string{"lic/usage:users:80", "lic/usage:users:90"},
+		},
+		{
+			name:    "Dropping back clears the thresholds left",
+			current: 85,
+			marked:  []string{"lic/usage:users:80"},
+		},
+		{
+			name:    "Crossing a cleared threshold alerts again",
+			current: 91,
+			sent:    []string{"usage:users:90"},
+			marked:  []string{"lic/usage:users:80", "lic/usage:users:90"},
+		},
+		{
+			name:    "Reaching the limit",
+			current: 100,
+			sent:    []string{"usage:users:100"},
+			marked:  []string{"lic/usage:users:100", "lic/usage:users:80", "lic/usage:users:90"},
+		},
+		{name: "Dropping under all of them clears everything", current: 10},
+	}
+
+	for _, step := range steps {
+		notifier.sent = nil
+		tel.checkUsage(license, "users", step.current, intPtr(100))
+
+		if !reflect.DeepEqual(notifier.sent, step.sent) {
+			t.Errorf("%s: sent %v, want %v", step.name, notifier.sent, step.sent)
+		}
+		if got := alerts.keys(); !reflect.DeepEqual(got, append([]string{}, step.marked...)) {
+			t.Errorf("%s: marked %v, want %v", step.name, got, step.marked)
+		}
+	}
+}
+
+func TestCheckUsage_NoLimit(t *testing.T) {
+	notifier := &recordingNotifier{}
+	tel := newTestTelemetry(memoryAlerts{}, notifier)
+
+	tel.checkUsage(&License{ID: "lic"}, "users", 1000, nil)
+	tel.checkUsage(&License{ID: "lic"}, "users", 1000, intPtr(0))
+
+	if len(notifier.sent) != 0 {
+		t.Errorf("sent %v without a limit", notifier.sent)
+	}
+}
+
+func TestCheckUsage_FailedSendIsRetried(t *testing.T) {
+	alerts := memoryAlerts{}
+	notifier := &recordingNotifier{err: fmt.Errorf("smtp down")}
+	tel := newTestTelemetry(alerts, notifier)
+
+	tel.checkUsage(&License{ID: "lic"}, "users", 95, intPtr(100))
+	if len(alerts) != 0 {
+		t.Fatalf("marked %v after the alert failed", alerts.keys())
+	}
+
+	notifier.err = nil
+	tel.checkUsage(&License{ID: "lic"}, "users", 95, intPtr(100))
+	if want := []string{"usage:users:90"}; !reflect.DeepEqual(notifier.sent, want) {
+		t.Errorf("sent %v after retrying, want %v", notifier.sent, want)
+	}
+}
+
+func TestCheckExpiry(t *testing.T) {
+	now := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+	expires := now.Add(5 * 24 * time.Hour)
+	license := &License{ID: "lic", ExpiresAt: &expires}
+	alerts := memoryAlerts{}
+	notifier := &recordingNotifier{}
+	tel := newTestTelemetry(alerts, notifier)
+
+	// Five days out is past both the 30 and 7 day thresholds: one alert
+	tel.checkExpiry(license, now)
+	if want := []string{"expiry:7"}; !reflect.DeepEqual(notifier.sent, want) {
+		t.Fatalf("sent %v, want %v", notifier.sent, want)
+	}
+	if want := []string{"lic/expiry:2025-06-06:30", "lic/expiry:2025-06-06:7"}; !reflect.DeepEqual(alerts.keys(), want) {
+		t.Errorf("marked %v, want %v", alerts.keys(), want)
+	}
+
+	// The next day still only has the 7 day threshold
+	notifier.sent = nil
+	tel.checkExpiry(license, now.Add(24*time.Hour))
+	if len(notifier.sent) != 0 {
+		t.Errorf("sent %v again", notifier.sent)
+	}
+
+	// The last day reaches the 1 day threshold
+	tel.checkExpiry(license, expires.Add(-time.Hour))
+	if want := []string{"expiry:1"}; !reflect.DeepEqual(notifier.sent, want) {
+		t.Errorf("sent %v on the last day, want %v", notifier.sent, want)
+	}
+
+	// A renewed license has its own keys, so its thresholds alert again
+	notifier.sent = nil
+	renewed := expires.AddDate(0, 0, 20)
+	tel.checkExpiry(&License{ID: "lic", ExpiresAt: &renewed}, now)
+	if want := []string{"expiry:30"}; !reflect.DeepEqual(notifier.sent, want) {
+		t.Errorf("sent %v after renewal, want %v", notifier.sent, want)
+	}
+}
+
+func TestCheckExpiry_NoAlert(t *testing.T) {
+	now := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+	far := now.AddDate(0, 3, 0)
+	past := now.Add(-time.Hour)
+
+	for name, license := range map[string]*License{
+		"No expiry":       {ID: "lic"},
+		"Far from it":     {ID: "lic", ExpiresAt: &far},
+		"Already expired": {ID: "lic", ExpiresAt: &past},
+	} {
+		notifier := &recordingNotifier{}
+		tel := newTestTelemetry(memoryAlerts{}, notifier)
+		tel.checkExpiry(license, now)
+		if len(notifier.sent) != 0 {
+			t.Errorf("%s: sent %v", name, notifier.sent)
+		}
+	}
+}
+
+func TestTelemetry_StopTwice(t *testing.T) {
+	tel := newTestTelemetry(memoryAlerts{}, &recordingNotifier{})
+	tel.Stop()
+	tel.Stop()
+}
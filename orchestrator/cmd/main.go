@@ -1,19 +1,179 @@
 package main
 
 import (
-	"log"
+	"context"
+	"expvar"
 	"net/http"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
 
-	"openpam/orchestrator/internal/api"
-
+	"github.com/VanCannon/openpam/orchestrator/internal/api"
+	"github.com/VanCannon/openpam/orchestrator/internal/db"
+	"github.com/VanCannon/openpam/orchestrator/internal/jobs"
+	"github.com/VanCannon/openpam/pkg/logger"
+	"github.com/VanCannon/openpam/pkg/recovery"
+	"github.com/VanCannon/openpam/pkg/servicetoken"
 	"github.com/gorilla/mux"
 )
 
 func main() {
-	log.Println("Starting Orchestrator Service on :8090")
+	log := logger.NewService("orchestrator", getEnv("LOG_LEVEL", "INFO"), getEnv("LOG_FORMAT", "json"))
+	log.Info("Starting Orchestrator Service", map[string]interface{}{
+		"port": 8090,
+	})
+
+	if err := db.InitDB(log); err != nil {
+		log.Fatal("Failed to initialize database", map[string]interface{}{
+			"error": err.Error(),
+		})
+	}
+
+	// Job types other subsystems run; the queue only accepts registered types
+	registry := jobs.NewRegistry()
+	registerJobTypes(registry, log)
+
+	store := jobs.NewStore(db.DB)
+	pool := jobs.NewPool(store, registry, jobs.PoolConfig{
+		Workers:      getEnvInt("JOB_WORKERS", 4),
+		PollInterval: getEnvDuration("JOB_POLL_INTERVAL", 2*time.Second),
+		Lease:        getEnvDuration("JOB_LEASE", 2*time.Minute),
+		MaxAttempts:  getEnvInt("JOB_MAX_ATTEMPTS", 5),
+		BackoffBase:  getEnvDuration("JOB_BACKOFF_BASE", 10*time.Second),
+		BackoffMax:   getEnvDuration("JOB_BACKOFF_MAX", time.Hour),
+	}, log)
+	pool.Start()
 
 	r := mux.NewRouter()
 	api.RegisterRoutes(r)
+	api.RegisterJobRoutes(r, api.NewJobsHandler(store, registry, pool, log))
+	r.Handle("/debug/vars", expvar.Handler())
+
+	reporter, err := recovery.NewReporter(os.Getenv("SENTRY_DSN"), "orchestrator", os.Getenv("SENTRY_ENVIRONMENT"), "")
+	if err != nil {
+		log.Fatal("Invalid SENTRY_DSN", map[string]interface{}{
+			"error": err.Error(),
+		})
+	}
+	handler := recovery.RequestID(recovery.Middleware("orchestrator", func(message string, fields map[string]interface{}) {
+		log.Error(message, fields)
+	}, reporter)(r))
+
+	server := &http.Server{Addr: ":8090", Handler: handler}
+	go func() {
+		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			log.Fatal("HTTP server error", map[string]interface{}{
+				"error": err.Error(),
+			})
+		}
+	}()
+
+	// Wait for interrupt signal
+	quit := make(chan os.Signal, 1)
+	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
+	<-quit
+
+	log.Info("Shutting down orchestrator...")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	if err := server.Shutdown(ctx); err != nil {
+		log.Error("Server forced to shutdown", map[string]interface{}{
+			"error": err.Error(),
+		})
+	}
+
+	// Jobs still running go back to the queue for the next replica to pick up
+	pool.Stop()
+
+	log.Info("Orchestrator stopped")
+}
+
+// registerJobTypes registers the job types run by other services. The AD sync
+// and bulk AD import are built in; JOB_FORWARD adds more as comma-separated type=url pairs, for
+// example credential.rotate=http://automation:8084/api/v1/jobs/rotate.
+func registerJobTypes(registry *jobs.Registry, log *logger.Logger) {
+	// Jobs call services with a service token signed with the gateway's
+	// session secret
+	secret := os.Getenv("SESSION_SECRET")
+	if secret == "" {
+		log.Warn("SESSION_SECRET is not set; services will reject forwarded jobs")
+	}
+	client := &http.Client{
+		Timeout:   30 * time.Minute,
+		Transport: &servicetoken.Transport{Secret: []byte(secret), Service: "orchestrator"},
+	}
+
+	identityServiceURL := getEnv("IDENTITY_SERVICE_URL", "http://identity:8082/api/v1/identity/sync")
+	identityImportURL := getEnv("IDENTITY_IMPORT_URL", "http://identity:8082/api/v1/identity/import")
+	for _, t := range []jobs.Type{
+		{
+			Name:        "identity.ad_sync",
+			Description: "Synchronize users, groups and computers from Active Directory",
+			Handler:     jobs.Forward(identityServiceURL, client),
+		},
+		{
+			Name:        "identity.ad_import",
+			Description: "Import Active Directory users, groups and computers in bulk by mapping rules",
+			Handler:     jobs.Forward(identityImportURL, client),
+		},
+	} {
+		if err := registry.Register(t); err != nil {
+			log.Fatal("Failed to register job type", map[string]interface{}{
+				"type":  t.Name,
+				"error": err.Error(),
+			})
+		}
+	}
+
+	for _, entry := range strings.Split(os.Getenv("JOB_FORWARD"), ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		name, url, ok := strings.Cut(entry, "=")
+		if !ok || name == "" || url == "" {
+			log.Fatal("Invalid JOB_FORWARD entry: expected type=url", map[string]interface{}{
+				"entry": entry,
+			})
+		}
+		if err := registry.Register(jobs.Type{
+			Name:        strings.TrimSpace(name),
+			Description: "Forwarded to " + strings.TrimSpace(url),
+			Handler:     jobs.Forward(strings.TrimSpace(url), client),
+		}); err != nil {
+			log.Fatal("Failed to register job type", map[string]interface{}{
+				"type":  strings.TrimSpace(name),
+				"error": err.Error(),
+			})
+		}
+	}
+}
+
+func getEnv(key, defaultValue string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return defaultValue
+}
+
+func getEnvInt(key string, defaultValue int) int {
+	if value := os.Getenv(key); value != "" {
+		if n, err := strconv.Atoi(value); err == nil {
+			return n
+		}
+	}
+	return defaultValue
+}
 
-	log.Fatal(http.ListenAndServe(":8090", r))
+func getEnvDuration(key string, defaultValue time.Duration) time.Duration {
+	if value := os.Getenv(key); value != "" {
+		if d, err := time.ParseDuration(value); err == nil {
+			return d
+		}
+	}
+	return defaultValue
 }
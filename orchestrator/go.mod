@@ -1,5 +1,14 @@
-module openpam/orchestrator
+module github.com/VanCannon/openpam/orchestrator
 
 go 1.22.0
 
-require github.com/gorilla/mux v1.8.1
+require (
+	github.com/VanCannon/openpam/pkg v0.0.0
+	github.com/google/uuid v1.6.0
+	github.com/gorilla/mux v1.8.1
+	github.com/lib/pq v1.10.9
+)
+
+require github.com/golang-jwt/jwt/v5 v5.2.0 // indirect
+
+replace github.com/VanCannon/openpam/pkg => ../pkg
@@ -23,8 +23,21 @@ func TriggerADSync(w http.ResponseWriter, r *http.Request) {
 		identityServiceURL = "http://identity:8082/api/v1/identity/sync"
 	}
 
-	// Forward request
-	resp, err := http.Post(identityServiceURL, "application/json", r.Body)
+	// Forward request, with the caller's credentials so the Identity Service
+	// can check they may sync
+	req, err := http.NewRequestWithContext(r.Context(), http.MethodPost, identityServiceURL, r.Body)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to call Identity Service: %v", err), http.StatusInternalServerError)
+		return
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for _, header := range []string{"Authorization", "Cookie"} {
+		if value := r.Header.Get(header); value != "" {
+			req.Header.Set(header, value)
+		}
+	}
+
+	resp, err := http.DefaultClient.Do(req)
 	if err != nil {
 		http.Error(w, fmt.Sprintf("Failed to call Identity Service: %v", err), http.StatusInternalServerError)
 		return
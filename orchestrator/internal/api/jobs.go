@@ -0,0 +1,214 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/VanCannon/openpam/orchestrator/internal/jobs"
+	"github.com/VanCannon/openpam/pkg/logger"
+	"github.com/gorilla/mux"
+)
+
+// JobsHandler serves the job queue API
+type JobsHandler struct {
+	store    *jobs.Store
+	registry *jobs.Registry
+	pool     *jobs.Pool
+	logger   *logger.Logger
+}
+
+func NewJobsHandler(store *jobs.Store, registry *jobs.Registry, pool *jobs.Pool, log *logger.Logger) *JobsHandler {
+	return &JobsHandler{
+		store:    store,
+		registry: registry,
+		pool:     pool,
+		logger:   log,
+	}
+}
+
+func RegisterJobRoutes(r *mux.Router, h *JobsHandler) {
+	r.HandleFunc("/api/v1/jobs", h.ListJobs).Methods("GET")
+	r.HandleFunc("/api/v1/jobs", h.EnqueueJob).Methods("POST")
+	r.HandleFunc("/api/v1/jobs/types", h.ListJobTypes).Methods("GET")
+	r.HandleFunc("/api/v1/jobs/{id}", h.GetJob).Methods("GET")
+	r.HandleFunc("/api/v1/jobs/{id}/cancel", h.CancelJob).Methods("POST")
+	r.HandleFunc("/api/v1/jobs/{id}/retry", h.RetryJob).Methods("POST")
+	r.HandleFunc("/api/v1/jobs/{id}/progress", h.ReportProgress).Methods("POST")
+}
+
+func (h *JobsHandler) EnqueueJob(w http.ResponseWriter, r *http.Request) {
+	var req jobs.EnqueueRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if _, ok := h.registry.Get(req.Type); !ok {
+		writeError(w, "Unknown job type: "+req.Type, http.StatusBadRequest)
+		return
+	}
+	if len(req.Payload) > 0 && !json.Valid(req.Payload) {
+		writeError(w, "payload must be JSON", http.StatusBadRequest)
+		return
+	}
+	if req.MaxAttempts < 0 {
+		writeError(w, "max_attempts cannot be negative", http.StatusBadRequest)
+		return
+	}
+	if req.MaxAttempts == 0 {
+		req.MaxAttempts = h.pool.MaxAttempts(req.Type)
+	}
+
+	job, err := h.store.Enqueue(r.Context(), &req)
+	if err != nil {
+		h.logger.Error("Failed to enqueue job", map[string]interface{}{
+			"type":  req.Type,
+			"error": err.Error(),
+		})
+		writeError(w, "Failed to enqueue job", http.StatusInternalServerError)
+		return
+	}
+
+	h.logger.Info("Job enqueued", map[string]interface{}{
+		"job_id": job.ID,
+		"type":   job.Type,
+	})
+	writeJSON(w, job, http.StatusCreated)
+}
+
+func (h *JobsHandler) ListJobs(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	filter := jobs.ListFilter{
+		Status: query.Get("status"),
+		Type:   query.Get("type"),
+		Limit:  50,
+	}
+
+	if limit := query.Get("limit"); limit != "" {
+		n, err := strconv.Atoi(limit)
+		if err != nil || n < 1 || n > 500 {
+			writeError(w, "limit must be between 1 and 500", http.StatusBadRequest)
+			return
+		}
+		filter.Limit = n
+	}
+	if offset := query.Get("offset"); offset != "" {
+		n, err := strconv.Atoi(offset)
+		if err != nil || n < 0 {
+			writeError(w, "offset must be a non-negative number", http.StatusBadRequest)
+			return
+		}
+		filter.Offset = n
+	}
+
+	list, err := h.store.List(r.Context(), filter)
+	if err != nil {
+		h.logger.Error("Failed to list jobs", map[string]interface{}{
+			"error": err.Error(),
+		})
+		writeError(w, "Failed to list jobs", http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, map[string]interface{}{
+		"jobs":   list,
+		"count":  len(list),
+		"limit":  filter.Limit,
+		"offset": filter.Offset,
+	}, http.StatusOK)
+}
+
+func (h *JobsHandler) ListJobTypes(w http.ResponseWriter, r *http.Request) {
+	types := h.registry.List()
+	for i := range types {
+		types[i].MaxAttempts = h.pool.MaxAttempts(types[i].Name)
+	}
+	writeJSON(w, map[string]interface{}{
+		"types": types,
+	}, http.StatusOK)
+}
+
+func (h *JobsHandler) GetJob(w http.ResponseWriter, r *http.Request) {
+	job, err := h.store.Get(r.Context(), mux.Vars(r)["id"])
+	if err != nil {
+		h.writeJobError(w, err)
+		return
+	}
+	writeJSON(w, job, http.StatusOK)
+}
+
+// CancelJob cancels a queued job at once, or asks the worker running it to stop
+func (h *JobsHandler) CancelJob(w http.ResponseWriter, r *http.Request) {
+	job, err := h.store.Cancel(r.Context(), mux.Vars(r)["id"])
+	if err != nil {
+		h.writeJobError(w, err)
+		return
+	}
+
+	h.logger.Info("Job cancellation requested", map[string]interface{}{
+		"job_id": job.ID,
+		"status": job.Status,
+	})
+
+	// A running job stops at its worker's next lease renewal
+	status := http.StatusOK
+	if job.Status == jobs.StatusRunning {
+		status = http.StatusAccepted
+	}
+	writeJSON(w, job, status)
+}
+
+// RetryJob queues a dead or cancelled job again
+func (h *JobsHandler) RetryJob(w http.ResponseWriter, r *http.Request) {
+	job, err := h.store.Requeue(r.Context(), mux.Vars(r)["id"])
+	if err != nil {
+		h.writeJobError(w, err)
+		return
+	}
+
+	h.logger.Info("Job requeued", map[string]interface{}{
+		"job_id": job.ID,
+	})
+	writeJSON(w, job, http.StatusOK)
+}
+
+// ReportProgress stores the progress of a running job. Subsystems running
+// forwarded jobs report it as a JSON object of their choosing.
+func (h *JobsHandler) ReportProgress(w http.ResponseWriter, r *http.Request) {
+	var progress json.RawMessage
+	if err := json.NewDecoder(r.Body).Decode(&progress); err != nil || len(progress) == 0 || progress[0] != '{' {
+		writeError(w, "progress must be a JSON object", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.store.ReportProgress(r.Context(), mux.Vars(r)["id"], progress); err != nil {
+		h.writeJobError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *JobsHandler) writeJobError(w http.ResponseWriter, err error) {
+	switch err {
+	case jobs.ErrNotFound:
+		writeError(w, "Job not found", http.StatusNotFound)
+	case jobs.ErrNotCancellable, jobs.ErrNotRetryable, jobs.ErrNotRunning:
+		writeError(w, err.Error(), http.StatusConflict)
+	default:
+		h.logger.Error("Job request failed", map[string]interface{}{
+			"error": err.Error(),
+		})
+		writeError(w, "Internal server error", http.StatusInternalServerError)
+	}
+}
+
+func writeJSON(w http.ResponseWriter, data interface{}, status int) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(data)
+}
+
+func writeError(w http.ResponseWriter, message string, status int) {
+	writeJSON(w, map[string]string{"error": message}, status)
+}
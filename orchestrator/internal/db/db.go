@@ -0,0 +1,82 @@
+package db
+
+import (
+	"database/sql"
+	"fmt"
+	"os"
+
+	"github.com/VanCannon/openpam/pkg/logger"
+	_ "github.com/lib/pq"
+)
+
+var DB *sql.DB
+
+// InitDB connects to the database and creates the tables the service needs
+func InitDB(log *logger.Logger) error {
+	host := os.Getenv("POSTGRES_HOST")
+	port := os.Getenv("POSTGRES_PORT")
+	user := os.Getenv("POSTGRES_USER")
+	password := os.Getenv("POSTGRES_PASSWORD")
+	dbname := os.Getenv("POSTGRES_DB")
+
+	psqlInfo := fmt.Sprintf("host=%s port=%s user=%s password=%s dbname=%s sslmode=disable",
+		host, port, user, password, dbname)
+
+	var err error
+	DB, err = sql.Open("postgres", psqlInfo)
+	if err != nil {
+		return fmt.Errorf("failed to open database: %v", err)
+	}
+
+	if err = DB.Ping(); err != nil {
+		return fmt.Errorf("failed to ping database: %v", err)
+	}
+
+	log.Info("Connected to database")
+	return createTables()
+}
+
+func createTables() error {
+	query := `
+	CREATE TABLE IF NOT EXISTS orchestrator_jobs (
+		id UUID PRIMARY KEY,
+		type TEXT NOT NULL,
+		payload JSONB NOT NULL DEFAULT '{}',
+		status TEXT NOT NULL DEFAULT 'queued',
+		priority INTEGER NOT NULL DEFAULT 0,
+		attempts INTEGER NOT NULL DEFAULT 0,
+		max_attempts INTEGER NOT NULL,
+		run_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+		locked_by TEXT,
+		locked_until TIMESTAMP WITH TIME ZONE,
+		cancel_requested BOOLEAN NOT NULL DEFAULT FALSE,
+		last_error TEXT,
+		result JSONB,
+		progress JSONB,
+		created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+		updated_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+		started_at TIMESTAMP WITH TIME ZONE,
+		finished_at TIMESTAMP WITH TIME ZONE
+	);
+
+	-- Workers claim the next runnable job from here
+	CREATE INDEX IF NOT EXISTS idx_orchestrator_jobs_runnable
+		ON orchestrator_jobs (priority DESC, run_at) WHERE status = 'queued';
+	-- Leases of crashed workers are reclaimed from here
+	CREATE INDEX IF NOT EXISTS idx_orchestrator_jobs_leases
+		ON orchestrator_jobs (locked_until) WHERE status = 'running';
+	CREATE INDEX IF NOT EXISTS idx_orchestrator_jobs_type
+		ON orchestrator_jobs (type, created_at DESC);
+	CREATE INDEX IF NOT EXISTS idx_orchestrator_jobs_status
+		ON orchestrator_jobs (status, created_at DESC);
+
+	-- Added after the table was first created
+	ALTER TABLE orchestrator_jobs ADD COLUMN IF NOT EXISTS progress JSONB;
+	`
+	_, err := DB.Exec(query)
+	if err != nil {
+		return fmt.Errorf("failed to create tables: %v", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,64 @@
+package jobs
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+// maxResultBytes bounds the response body kept as a job's result
+const maxResultBytes = 1 << 20
+
+// Forward returns a handler that hands jobs to the subsystem that runs them by
+// POSTing them to url. A 2xx response completes the job, with a JSON response
+// body kept as its result. Other 4xx responses fail it permanently, since
+// retrying the same request won't help; anything else is retried.
+func Forward(url string, client *http.Client) HandlerFunc {
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	return func(ctx context.Context, job *Job) (json.RawMessage, error) {
+		body, err := json.Marshal(map[string]interface{}{
+			"job_id":  job.ID,
+			"type":    job.Type,
+			"attempt": job.Attempts,
+			"payload": job.Payload,
+		})
+		if err != nil {
+			return nil, Permanent(fmt.Errorf("failed to encode job: %w", err))
+		}
+
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+		if err != nil {
+			return nil, Permanent(fmt.Errorf("failed to build request: %w", err))
+		}
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("X-OpenPAM-Job-ID", job.ID)
+
+		resp, err := client.Do(req)
+		if err != nil {
+			return nil, fmt.Errorf("failed to call %s: %w", url, err)
+		}
+		defer resp.Body.Close()
+
+		respBody, _ := io.ReadAll(io.LimitReader(resp.Body, maxResultBytes))
+
+		if resp.StatusCode < 200 || resp.StatusCode > 299 {
+			err := fmt.Errorf("%s returned %d: %s", url, resp.StatusCode, bytes.TrimSpace(respBody))
+			if resp.StatusCode >= 400 && resp.StatusCode < 500 &&
+				resp.StatusCode != http.StatusRequestTimeout && resp.StatusCode != http.StatusTooManyRequests {
+				return nil, Permanent(err)
+			}
+			return nil, err
+		}
+
+		if json.Valid(respBody) {
+			return respBody, nil
+		}
+		return nil, nil
+	}
+}
@@ -0,0 +1,156 @@
+// Package jobs is the orchestrator's job execution core. Jobs are queued in
+// PostgreSQL and claimed by a pool of workers with SELECT ... FOR UPDATE SKIP
+// LOCKED, so any number of orchestrator replicas can share one queue. Failed
+// jobs are retried with exponential backoff; jobs that run out of attempts
+// are moved to the dead-letter state, where they stay until retried by hand.
+package jobs
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/rand"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Job statuses
+const (
+	StatusQueued    = "queued"
+	StatusRunning   = "running"
+	StatusSucceeded = "succeeded"
+	StatusDead      = "dead" // Out of attempts, or failed permanently
+	StatusCancelled = "cancelled"
+)
+
+var (
+	ErrNotFound       = errors.New("job not found")
+	ErrUnknownType    = errors.New("unknown job type")
+	ErrNotCancellable = errors.New("job has already finished")
+	ErrNotRetryable   = errors.New("only dead or cancelled jobs can be retried")
+	ErrLeaseLost      = errors.New("job lease lost")
+	ErrNotRunning     = errors.New("job is not running")
+)
+
+// Job is a unit of work in the queue
+type Job struct {
+	ID              string          `json:"id"`
+	Type            string          `json:"type"`
+	Payload         json.RawMessage `json:"payload"`
+	Status          string          `json:"status"`
+	Priority        int             `json:"priority"`
+	Attempts        int             `json:"attempts"`
+	MaxAttempts     int             `json:"max_attempts"`
+	RunAt           time.Time       `json:"run_at"`
+	LockedBy        string          `json:"locked_by,omitempty"`
+	LockedUntil     *time.Time      `json:"locked_until,omitempty"`
+	CancelRequested bool            `json:"cancel_requested"`
+	LastError       string          `json:"last_error,omitempty"`
+	Result          json.RawMessage `json:"result,omitempty"`
+	Progress        json.RawMessage `json:"progress,omitempty"` // As last reported by the subsystem running it
+	CreatedAt       time.Time       `json:"created_at"`
+	UpdatedAt       time.Time       `json:"updated_at"`
+	StartedAt       *time.Time      `json:"started_at,omitempty"`
+	FinishedAt      *time.Time      `json:"finished_at,omitempty"`
+}
+
+// HandlerFunc runs a job. The context is cancelled when the job is cancelled,
+// its timeout passes or the orchestrator shuts down. The result, if any, is
+// stored with the job.
+type HandlerFunc func(ctx context.Context, job *Job) (json.RawMessage, error)
+
+// Type is a kind of job a subsystem knows how to run
+type Type struct {
+	Name        string        `json:"name"`
+	Description string        `json:"description,omitempty"`
+	MaxAttempts int           `json:"max_attempts,omitempty"` // 0 uses the pool default
+	Timeout     time.Duration `json:"-"`                      // Per attempt; 0 means none
+	Handler     HandlerFunc   `json:"-"`
+}
+
+// Registry holds the job types workers can run
+type Registry struct {
+	mu    sync.RWMutex
+	types map[string]Type
+}
+
+func NewRegistry() *Registry {
+	return &Registry{types: make(map[string]Type)}
+}
+
+// Register adds a job type. Each type can only be registered once.
+func (r *Registry) Register(t Type) error {
+	if t.Name == "" || t.Handler == nil {
+		return fmt.Errorf("job type needs a name and a handler")
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, exists := r.types[t.Name]; exists {
+		return fmt.Errorf("job type %s is already registered", t.Name)
+	}
+	r.types[t.Name] = t
+	return nil
+}
+
+// Get returns a registered job type
+func (r *Registry) Get(name string) (Type, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	t, ok := r.types[name]
+	return t, ok
+}
+
+// List returns the registered job types sorted by name
+func (r *Registry) List() []Type {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	types := make([]Type, 0, len(r.types))
+	for _, t := range r.types {
+		types = append(types, t)
+	}
+	sort.Slice(types, func(i, j int) bool { return types[i].Name < types[j].Name })
+	return types
+}
+
+// permanentError marks a failure that retrying can't fix
+type permanentError struct {
+	err error
+}
+
+func (e *permanentError) Error() string { return e.err.Error() }
+func (e *permanentError) Unwrap() error { return e.err }
+
+// Permanent wraps an error so the job goes straight to the dead-letter state
+// instead of being retried
+func Permanent(err error) error {
+	return &permanentError{err: err}
+}
+
+// IsPermanent reports whether an error was marked as permanent
+func IsPermanent(err error) bool {
+	var p *permanentError
+	return errors.As(err, &p)
+}
+
+// Backoff returns how long to wait before the next attempt after the given
+// number of attempts: base doubled per attempt, capped at max, with the upper
+// half randomized so failing jobs don't retry in lockstep
+func Backoff(attempts int, base, max time.Duration) time.Duration {
+	d := base
+	for i := 1; i < attempts && d < max; i++ {
+		d *= 2
+	}
+	if d > max {
+		d = max
+	}
+	if d <= 1 {
+		return d
+	}
+	return d/2 + time.Duration(rand.Int63n(int64(d/2)))
+}
@@ -0,0 +1,344 @@
+package jobs
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/VanCannon/openpam/pkg/logger"
+)
+
+func TestBackoff_Bounds(t *testing.T) {
+	base, max := time.Second, time.Minute
+
+	tests := []struct {
+		attempts int
+		full     time.Duration // Delay before the upper half is randomized
+	}{
+		{attempts: 0, full: time.Second},
+		{attempts: 1, full: time.Second},
+		{attempts: 2, full: 2 * time.Second},
+		{attempts: 3, full: 4 * time.Second},
+		{attempts: 6, full: 32 * time.Second},
+		{attempts: 7, full: time.Minute},
+		{attempts: 50, full: time.Minute},
+	}
+
+	for _, tt := range tests {
+		for i := 0; i < 100; i++ {
+			d := Backoff(tt.attempts, base, max)
+			if d < tt.full/2 || d >= tt.full {
+				t.Fatalf("Backoff(%d) = %v, want in [%v, %v)", tt.attempts, d, tt.full/2, tt.full)
+			}
+		}
+	}
+}
+
+func TestBackoff_Jitter(t *testing.T) {
+	seen := map[time.Duration]bool{}
+	for i := 0; i < 50; i++ {
+		seen[Backoff(3, time.Second, time.Minute)] = true
+	}
+	if len(seen) < 2 {
+		t.Errorf("Backoff returned the same delay %d times in a row", 50)
+	}
+}
+
+func TestBackoff_Tiny(t *testing.T) {
+	if d := Backoff(3, 0, 0); d != 0 {
+		t.Errorf("Backoff with no base = %v, want 0", d)
+	}
+	if d := Backoff(1, time.Nanosecond, time.Nanosecond); d != time.Nanosecond {
+		t.Errorf("Backoff of a nanosecond = %v, want 1ns", d)
+	}
+}
+
+func TestPermanent(t *testing.T) {
+	cause := errors.New("bad payload")
+	err := fmt.Errorf("running job: %w", Permanent(cause))
+
+	if !IsPermanent(err) {
+		t.Error("wrapped permanent error not recognized")
+	}
+	if !errors.Is(err, cause) {
+		t.Error("permanent error doesn't unwrap to its cause")
+	}
+	if IsPermanent(cause) {
+		t.Error("plain error reported as permanent")
+	}
+}
+
+func TestSafeRun(t *testing.T) {
+	result, err := safeRun(context.Background(), func(ctx context.Context, job *Job) (json.RawMessage, error) {
+		return json.RawMessage(`{"ok":true}`), nil
+	}, &Job{})
+	if err != nil || string(result) != `{"ok":true}` {
+		t.Errorf("safeRun() = %s, %v", result, err)
+	}
+
+	_, err = safeRun(context.Background(), func(ctx context.Context, job *Job) (json.RawMessage, error) {
+		panic("boom")
+	}, &Job{})
+	if !IsPermanent(err) || !strings.Contains(err.Error(), "boom") {
+		t.Errorf("safeRun() of a panicking handler error = %v, want a permanent error", err)
+	}
+}
+
+func TestRegistry(t *testing.T) {
+	r := NewRegistry()
+	noop := func(ctx context.Context, job *Job) (json.RawMessage, error) { return nil, nil }
+
+	for _, name := range []string{"b.second", "a.first"} {
+		if err := r.Register(Type{Name: name, Handler: noop}); err != nil {
+			t.Fatalf("Register(%s) error = %v", name, err)
+		}
+	}
+	if err := r.Register(Type{Name: "a.first", Handler: noop}); err == nil {
+		t.Error("registering a type twice succeeded")
+	}
+	if err := r.Register(Type{Name: "c.third"}); err == nil {
+		t.Error("registering a type without a handler succeeded")
+	}
+	if err := r.Register(Type{Handler: noop}); err == nil {
+		t.Error("registering a type without a name succeeded")
+	}
+
+	if _, ok := r.Get("a.first"); !ok {
+		t.Error("Get() didn't find a registered type")
+	}
+	if _, ok := r.Get("c.third"); ok {
+		t.Error("Get() found a type that failed to register")
+	}
+
+	types := r.List()
+	if len(types) != 2 || types[0].Name != "a.first" || types[1].Name != "b.second" {
+		t.Errorf("List() = %v, want a.first then b.second", types)
+	}
+}
+
+// fakeQueue records the outcomes workers settle jobs with
+type fakeQueue struct {
+	mu       sync.Mutex
+	outcomes []string
+	runAt    time.Time
+	extend   func() (bool, error)
+}
+
+func (q *fakeQueue) record(outcome string) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.outcomes = append(q.outcomes, outcome)
+	return nil
+}
+
+func (q *fakeQueue) Claim(ctx context.Context, workerID string, lease time.Duration) (*Job, error) {
+	return nil, nil
+}
+
+func (q *fakeQueue) Extend(ctx context.Context, id, workerID string, lease time.Duration) (bool, error) {
+	if q.extend == nil {
+		return false, nil
+	}
+	return q.extend()
+}
+
+func (q *fakeQueue) Complete(ctx context.Context, id, workerID string, result json.RawMessage) error {
+	return q.record("complete:" + string(result))
+}
+
+func (q *fakeQueue) Retry(ctx context.Context, id, workerID, lastError string, runAt time.Time) error {
+	q.mu.Lock()
+	q.runAt = runAt
+	q.mu.Unlock()
+	return q.record("retry:" + lastError)
+}
+
+func (q *fakeQueue) Bury(ctx context.Context, id, workerID, lastError string) error {
+	return q.record("bury:" + lastError)
+}
+
+func (q *fakeQueue) MarkCancelled(ctx context.Context, id, workerID string) error {
+	return q.record("cancelled")
+}
+
+func (q *fakeQueue) Release(ctx context.Context, id, workerID string) error {
+	return q.record("release")
+}
+
+func (q *fakeQueue) ReclaimExpired(ctx context.Context) (int64, error) {
+	return 0, nil
+}
+
+// newTestPool returns a pool running jobs of type "test" with handler
+func newTestPool(handler HandlerFunc, timeout time.Duration) (*Pool, *fakeQueue) {
+	registry := NewRegistry()
+	registry.Register(Type{Name: "test", Handler: handler, Timeout: timeout})
+
+	pool := NewPool(nil, registry, PoolConfig{
+		Lease:       30 * time.Millisecond,
+		BackoffBase: time.Minute,
+		BackoffMax:  time.Hour,
+	}, logger.New(logger.LevelError, io.Discard))
+	q := &fakeQueue{}
+	pool.store = q
+	return pool, q
+}
+
+// waitForCancel blocks until the job's context is done
+func waitForCancel(ctx context.Context, job *Job) (json.RawMessage, error) {
+	<-ctx.Done()
+	return nil, ctx.Err()
+}
+
+func TestPoolRun_Outcomes(t *testing.T) {
+	failing := func(ctx context.Context, job *Job) (json.RawMessage, error) {
+		return nil, errors.New("target unreachable")
+	}
+
+	tests := []struct {
+		name     string
+		job      Job
+		handler  HandlerFunc
+		timeout  time.Duration
+		extend   func() (bool, error)
+		shutdown bool
+		want     []string
+	}{
+		{
+			name: "Success stores the result",
+			job:  Job{Type: "test", Attempts: 1, MaxAttempts: 3},
+			handler: func(ctx context.Context, job *Job) (json.RawMessage, error) {
+				return json.RawMessage(`{"synced":3}`), nil
+			},
+			want: []string{`complete:{"synced":3}`},
+		},
+		{
+			name:    "Failure with attempts left is retried",
+			job:     Job{Type: "test", Attempts: 1, MaxAttempts: 3},
+			handler: failing,
+			want:    []string{"retry:target unreachable"},
+		},
+		{
+			name:    "Failure on the last attempt is buried",
+			job:     Job{Type: "test", Attempts: 3, MaxAttempts: 3},
+			handler: failing,
+			want:    []string{"bury:target unreachable"},
+		},
+		{
+			name: "Permanent failure is buried at once",
+			job:  Job{Type: "test", Attempts: 1, MaxAttempts: 3},
+			handler: func(ctx context.Context, job *Job) (json.RawMessage, error) {
+				return nil, Permanent(errors.New("bad payload"))
+			},
+			want: []string{"bury:bad payload"},
+		},
+		{
+			name: "Panic is buried at once",
+			job:  Job{Type: "test", Attempts: 1, MaxAttempts: 3},
+			handler: func(ctx context.Context, job *Job) (json.RawMessage, error) {
+				panic("nil map")
+			},
+			want: []string{"bury:handler panicked: nil map"},
+		},
+		{
+			name: "Unknown type is buried",
+			job:  Job{Type: "missing", Attempts: 1, MaxAttempts: 3},
+			want: []string{"bury:" + ErrUnknownType.Error()},
+		},
+		{
+			name:    "Timeout counts as a failed attempt",
+			job:     Job{Type: "test", Attempts: 1, MaxAttempts: 3},
+			handler: waitForCancel,
+			timeout: 10 * time.Millisecond,
+			want:    []string{"retry:" + context.DeadlineExceeded.Error()},
+		},
+		{
+			name:    "Cancel request stops the job",
+			job:     Job{Type: "test", Attempts: 1, MaxAttempts: 3},
+			handler: waitForCancel,
+			extend:  func() (bool, error) { return true, nil },
+			want:    []string{"cancelled"},
+		},
+		{
+			name:    "Lost lease leaves the job to its new owner",
+			job:     Job{Type: "test", Attempts: 1, MaxAttempts: 3},
+			handler: waitForCancel,
+			extend:  func() (bool, error) { return false, ErrLeaseLost },
+		},
+		{
+			name:     "Shutdown releases the job without using an attempt",
+			job:      Job{Type: "test", Attempts: 3, MaxAttempts: 3},
+			handler:  waitForCancel,
+			shutdown: true,
+			want:     []string{"release"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := tt.handler
+			if handler == nil {
+				handler = failing
+			}
+			pool, q := newTestPool(handler, tt.timeout)
+			q.extend = tt.extend
+			if tt.shutdown {
+				time.AfterFunc(10*time.Millisecond, pool.cancel)
+			}
+
+			done := make(chan struct{})
+			go func() {
+				defer close(done)
+				pool.run("worker", &tt.job)
+			}()
+			select {
+			case <-done:
+			case <-time.After(5 * time.Second):
+				t.Fatal("job never finished")
+			}
+
+			if fmt.Sprint(q.outcomes) != fmt.Sprint(tt.want) {
+				t.Errorf("outcomes = %v, want %v", q.outcomes, tt.want)
+			}
+		})
+	}
+}
+
+func TestPoolRun_RetryBacksOff(t *testing.T) {
+	pool, q := newTestPool(func(ctx context.Context, job *Job) (json.RawMessage, error) {
+		return nil, errors.New("try again")
+	}, 0)
+
+	before := time.Now()
+	pool.run("worker", &Job{Type: "test", Attempts: 2, MaxAttempts: 5})
+
+	// Second attempt: base doubled once, upper half randomized
+	if wait := q.runAt.Sub(before); wait < time.Minute || wait > 2*time.Minute+time.Second {
+		t.Errorf("retry in %v, want between 1m and 2m", wait)
+	}
+}
+
+func TestPool_MaxAttempts(t *testing.T) {
+	registry := NewRegistry()
+	noop := func(ctx context.Context, job *Job) (json.RawMessage, error) { return nil, nil }
+	registry.Register(Type{Name: "custom", Handler: noop, MaxAttempts: 9})
+	registry.Register(Type{Name: "default", Handler: noop})
+
+	pool := NewPool(nil, registry, PoolConfig{}, logger.New(logger.LevelError, io.Discard))
+
+	if got := pool.MaxAttempts("custom"); got != 9 {
+		t.Errorf("MaxAttempts(custom) = %d, want 9", got)
+	}
+	if got := pool.MaxAttempts("default"); got != 5 {
+		t.Errorf("MaxAttempts(default) = %d, want the pool default 5", got)
+	}
+	if got := pool.MaxAttempts("unknown"); got != 5 {
+		t.Errorf("MaxAttempts(unknown) = %d, want the pool default 5", got)
+	}
+}
@@ -0,0 +1,281 @@
+package jobs
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/VanCannon/openpam/pkg/logger"
+)
+
+// PoolConfig configures a worker pool
+type PoolConfig struct {
+	Workers      int           // Jobs run concurrently
+	PollInterval time.Duration // How often idle workers look for work
+	Lease        time.Duration // How long a claimed job is held without renewal
+	MaxAttempts  int           // Default attempts for job types that don't set theirs
+	BackoffBase  time.Duration // Wait before the first retry; doubled per attempt
+	BackoffMax   time.Duration // Longest wait between retries
+}
+
+// queue is the part of the store workers use to claim jobs and record how
+// they went
+type queue interface {
+	Claim(ctx context.Context, workerID string, lease time.Duration) (*Job, error)
+	Extend(ctx context.Context, id, workerID string, lease time.Duration) (cancelRequested bool, err error)
+	Complete(ctx context.Context, id, workerID string, result json.RawMessage) error
+	Retry(ctx context.Context, id, workerID, lastError string, runAt time.Time) error
+	Bury(ctx context.Context, id, workerID, lastError string) error
+	MarkCancelled(ctx context.Context, id, workerID string) error
+	Release(ctx context.Context, id, workerID string) error
+	ReclaimExpired(ctx context.Context) (int64, error)
+}
+
+// Pool runs queued jobs on a fixed number of workers. Running jobs keep their
+// lease renewed; if this process dies, the lease runs out and another
+// replica's pool reclaims the job.
+type Pool struct {
+	store    queue
+	registry *Registry
+	config   PoolConfig
+	logger   *logger.Logger
+	workerID string
+
+	ctx       context.Context
+	cancel    context.CancelFunc
+	wg        sync.WaitGroup
+	startOnce sync.Once
+	stopOnce  sync.Once
+}
+
+func NewPool(store *Store, registry *Registry, config PoolConfig, log *logger.Logger) *Pool {
+	if config.Workers <= 0 {
+		config.Workers = 1
+	}
+	if config.PollInterval <= 0 {
+		config.PollInterval = 2 * time.Second
+	}
+	if config.Lease <= 0 {
+		config.Lease = 2 * time.Minute
+	}
+	if config.MaxAttempts <= 0 {
+		config.MaxAttempts = 5
+	}
+
+	hostname, _ := os.Hostname()
+	ctx, cancel := context.WithCancel(context.Background())
+
+	return &Pool{
+		store:    store,
+		registry: registry,
+		config:   config,
+		logger:   log,
+		workerID: fmt.Sprintf("%s-%d", hostname, os.Getpid()),
+		ctx:      ctx,
+		cancel:   cancel,
+	}
+}
+
+// MaxAttempts returns the attempts a job of the given type gets by default
+func (p *Pool) MaxAttempts(jobType string) int {
+	if t, ok := p.registry.Get(jobType); ok && t.MaxAttempts > 0 {
+		return t.MaxAttempts
+	}
+	return p.config.MaxAttempts
+}
+
+// Start starts the workers and the reclaimer of expired leases
+func (p *Pool) Start() {
+	p.startOnce.Do(func() {
+		p.logger.Info("Job workers started", map[string]interface{}{
+			"workers":   p.config.Workers,
+			"worker_id": p.workerID,
+		})
+
+		for i := 0; i < p.config.Workers; i++ {
+			p.wg.Add(1)
+			go p.work(fmt.Sprintf("%s/%d", p.workerID, i))
+		}
+
+		p.wg.Add(1)
+		go p.reclaim()
+	})
+}
+
+// Stop stops the workers and waits for them. Jobs still running are
+// interrupted and returned to the queue without losing an attempt.
+func (p *Pool) Stop() {
+	p.stopOnce.Do(func() {
+		p.cancel()
+	})
+	p.wg.Wait()
+}
+
+func (p *Pool) work(workerID string) {
+	defer p.wg.Done()
+
+	for {
+		job, err := p.store.Claim(p.ctx, workerID, p.config.Lease)
+		if err != nil && p.ctx.Err() == nil {
+			p.logger.Error("Failed to claim job", map[string]interface{}{
+				"error": err.Error(),
+			})
+		}
+
+		if job != nil {
+			p.run(workerID, job)
+			continue
+		}
+
+		select {
+		case <-p.ctx.Done():
+			return
+		case <-time.After(p.config.PollInterval):
+		}
+	}
+}
+
+// reclaim returns the jobs of workers that stopped renewing their lease
+func (p *Pool) reclaim() {
+	defer p.wg.Done()
+
+	ticker := time.NewTicker(p.config.Lease / 2)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-p.ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		reclaimed, err := p.store.ReclaimExpired(p.ctx)
+		if err != nil {
+			if p.ctx.Err() == nil {
+				p.logger.Error("Failed to reclaim expired jobs", map[string]interface{}{
+					"error": err.Error(),
+				})
+			}
+			continue
+		}
+		if reclaimed > 0 {
+			p.logger.Warn("Reclaimed jobs with expired leases", map[string]interface{}{
+				"count": reclaimed,
+			})
+		}
+	}
+}
+
+func (p *Pool) run(workerID string, job *Job) {
+	fields := map[string]interface{}{
+		"job_id":  job.ID,
+		"type":    job.Type,
+		"attempt": job.Attempts,
+	}
+
+	// Jobs are settled even while shutting down, so they don't wait for a lease to expire
+	settle := context.Background()
+
+	jobType, ok := p.registry.Get(job.Type)
+	if !ok {
+		p.logger.Error("No handler for job type", fields)
+		p.settle(p.store.Bury(settle, job.ID, workerID, ErrUnknownType.Error()), fields)
+		return
+	}
+
+	ctx, cancel := context.WithCancel(p.ctx)
+	defer cancel()
+	if jobType.Timeout > 0 {
+		ctx, cancel = context.WithTimeout(ctx, jobType.Timeout)
+		defer cancel()
+	}
+
+	// Renew the lease while the job runs, and stop the job if it was cancelled
+	var cancelled, lost atomic.Bool
+	heartbeatDone := make(chan struct{})
+	go func() {
+		defer close(heartbeatDone)
+		ticker := time.NewTicker(p.config.Lease / 3)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+
+			cancelRequested, err := p.store.Extend(settle, job.ID, workerID, p.config.Lease)
+			switch {
+			case err == ErrLeaseLost:
+				lost.Store(true)
+				cancel()
+				return
+			case err != nil:
+				p.logger.Warn("Failed to renew job lease", map[string]interface{}{
+					"job_id": job.ID,
+					"error":  err.Error(),
+				})
+			case cancelRequested:
+				cancelled.Store(true)
+				cancel()
+				return
+			}
+		}
+	}()
+
+	p.logger.Info("Running job", fields)
+	started := time.Now()
+	result, err := safeRun(ctx, jobType.Handler, job)
+	cancel()
+	<-heartbeatDone
+	fields["duration_ms"] = time.Since(started).Milliseconds()
+
+	switch {
+	case lost.Load():
+		p.logger.Warn("Job lease lost while running", fields)
+	case cancelled.Load():
+		p.logger.Info("Job cancelled", fields)
+		p.settle(p.store.MarkCancelled(settle, job.ID, workerID), fields)
+	case err == nil:
+		p.logger.Info("Job succeeded", fields)
+		p.settle(p.store.Complete(settle, job.ID, workerID, result), fields)
+	case p.ctx.Err() != nil:
+		p.logger.Info("Job interrupted by shutdown", fields)
+		p.settle(p.store.Release(settle, job.ID, workerID), fields)
+	case IsPermanent(err) || job.Attempts >= job.MaxAttempts:
+		fields["error"] = err.Error()
+		p.logger.Error("Job failed, moved to dead letters", fields)
+		p.settle(p.store.Bury(settle, job.ID, workerID, err.Error()), fields)
+	default:
+		delay := Backoff(job.Attempts, p.config.BackoffBase, p.config.BackoffMax)
+		fields["error"] = err.Error()
+		fields["retry_in"] = delay.String()
+		p.logger.Warn("Job failed, will retry", fields)
+		p.settle(p.store.Retry(settle, job.ID, workerID, err.Error(), time.Now().Add(delay)), fields)
+	}
+}
+
+// settle logs a failure to record a job's outcome. The lease then runs out
+// and the job is reclaimed.
+func (p *Pool) settle(err error, fields map[string]interface{}) {
+	if err == nil {
+		return
+	}
+	fields["error"] = err.Error()
+	p.logger.Error("Failed to record job outcome", fields)
+}
+
+// safeRun runs a handler, turning a panic into a permanent failure
+func safeRun(ctx context.Context, handler HandlerFunc, job *Job) (result json.RawMessage, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = Permanent(fmt.Errorf("handler panicked: %v", r))
+		}
+	}()
+	return handler(ctx, job)
+}
@@ -0,0 +1,351 @@
+package jobs
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const jobColumns = `id, type, payload, status, priority, attempts, max_attempts, run_at,
+	locked_by, locked_until, cancel_requested, last_error, result, progress,
+	created_at, updated_at, started_at, finished_at`
+
+// Store is the PostgreSQL job queue
+type Store struct {
+	db *sql.DB
+}
+
+func NewStore(db *sql.DB) *Store {
+	return &Store{db: db}
+}
+
+// EnqueueRequest describes a job to queue
+type EnqueueRequest struct {
+	Type        string          `json:"type"`
+	Payload     json.RawMessage `json:"payload"`
+	Priority    int             `json:"priority"`
+	RunAt       *time.Time      `json:"run_at,omitempty"` // Defaults to now
+	MaxAttempts int             `json:"max_attempts"`
+}
+
+// Enqueue adds a job to the queue
+func (s *Store) Enqueue(ctx context.Context, req *EnqueueRequest) (*Job, error) {
+	payload := req.Payload
+	if len(payload) == 0 {
+		payload = json.RawMessage(`{}`)
+	}
+	runAt := time.Now()
+	if req.RunAt != nil {
+		runAt = *req.RunAt
+	}
+
+	query := `
+		INSERT INTO orchestrator_jobs (id, type, payload, priority, max_attempts, run_at)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		RETURNING ` + jobColumns
+
+	return scanJob(s.db.QueryRowContext(ctx, query,
+		uuid.New().String(), req.Type, []byte(payload), req.Priority, req.MaxAttempts, runAt))
+}
+
+// Claim locks the next runnable job for a worker until the lease runs out,
+// counting an attempt. It returns nil when no job is runnable. SKIP LOCKED
+// lets concurrent workers claim different jobs without waiting on each other.
+func (s *Store) Claim(ctx context.Context, workerID string, lease time.Duration) (*Job, error) {
+	query := `
+		UPDATE orchestrator_jobs
+		SET status = 'running', attempts = attempts + 1, locked_by = $1,
+		    locked_until = NOW() + make_interval(secs => $2), progress = NULL,
+		    started_at = COALESCE(started_at, NOW()), updated_at = NOW()
+		WHERE id = (
+			SELECT id FROM orchestrator_jobs
+			WHERE status = 'queued' AND run_at <= NOW()
+			ORDER BY priority DESC, run_at
+			LIMIT 1
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING ` + jobColumns
+
+	job, err := scanJob(s.db.QueryRowContext(ctx, query, workerID, lease.Seconds()))
+	if err == ErrNotFound {
+		return nil, nil
+	}
+	return job, err
+}
+
+// Extend renews a worker's lease on a running job and reports whether the
+// job's cancellation was requested. It returns ErrLeaseLost if the worker no
+// longer holds the job.
+func (s *Store) Extend(ctx context.Context, id, workerID string, lease time.Duration) (cancelRequested bool, err error) {
+	query := `
+		UPDATE orchestrator_jobs
+		SET locked_until = NOW() + make_interval(secs => $3), updated_at = NOW()
+		WHERE id = $1 AND locked_by = $2 AND status = 'running'
+		RETURNING cancel_requested
+	`
+
+	err = s.db.QueryRowContext(ctx, query, id, workerID, lease.Seconds()).Scan(&cancelRequested)
+	if err == sql.ErrNoRows {
+		return false, ErrLeaseLost
+	}
+	return cancelRequested, err
+}
+
+// ReportProgress stores the progress of a running job, as reported by the
+// subsystem running it. It returns ErrNotRunning if the job isn't running.
+func (s *Store) ReportProgress(ctx context.Context, id string, progress json.RawMessage) error {
+	if _, err := uuid.Parse(id); err != nil {
+		return ErrNotFound
+	}
+	result, err := s.db.ExecContext(ctx, `
+		UPDATE orchestrator_jobs SET progress = $2, updated_at = NOW()
+		WHERE id = $1 AND status = 'running'
+	`, id, []byte(progress))
+	if err != nil {
+		return fmt.Errorf("failed to report job progress: %w", err)
+	}
+	if rows, _ := result.RowsAffected(); rows == 0 {
+		if _, err := s.Get(ctx, id); err != nil {
+			return err
+		}
+		return ErrNotRunning
+	}
+	return nil
+}
+
+// Complete marks a running job as succeeded
+func (s *Store) Complete(ctx context.Context, id, workerID string, result json.RawMessage) error {
+	var stored interface{}
+	if len(result) > 0 {
+		stored = []byte(result)
+	}
+	return s.finish(ctx, id, workerID, `
+		UPDATE orchestrator_jobs
+		SET status = 'succeeded', result = $3, last_error = NULL, locked_by = NULL, locked_until = NULL,
+		    finished_at = NOW(), updated_at = NOW()
+		WHERE id = $1 AND locked_by = $2 AND status = 'running'
+	`, stored)
+}
+
+// Retry puts a failed job back in the queue to run again at runAt
+func (s *Store) Retry(ctx context.Context, id, workerID, lastError string, runAt time.Time) error {
+	return s.finish(ctx, id, workerID, `
+		UPDATE orchestrator_jobs
+		SET status = 'queued', last_error = $3, run_at = $4, locked_by = NULL, locked_until = NULL,
+		    updated_at = NOW()
+		WHERE id = $1 AND locked_by = $2 AND status = 'running'
+	`, lastError, runAt)
+}
+
+// Bury moves a failed job to the dead-letter state
+func (s *Store) Bury(ctx context.Context, id, workerID, lastError string) error {
+	return s.finish(ctx, id, workerID, `
+		UPDATE orchestrator_jobs
+		SET status = 'dead', last_error = $3, locked_by = NULL, locked_until = NULL,
+		    finished_at = NOW(), updated_at = NOW()
+		WHERE id = $1 AND locked_by = $2 AND status = 'running'
+	`, lastError)
+}
+
+// MarkCancelled records that a running job stopped because it was cancelled
+func (s *Store) MarkCancelled(ctx context.Context, id, workerID string) error {
+	return s.finish(ctx, id, workerID, `
+		UPDATE orchestrator_jobs
+		SET status = 'cancelled', locked_by = NULL, locked_until = NULL,
+		    finished_at = NOW(), updated_at = NOW()
+		WHERE id = $1 AND locked_by = $2 AND status = 'running'
+	`)
+}
+
+// Release puts a job interrupted by shutdown back in the queue without
+// counting the attempt
+func (s *Store) Release(ctx context.Context, id, workerID string) error {
+	return s.finish(ctx, id, workerID, `
+		UPDATE orchestrator_jobs
+		SET status = 'queued', attempts = GREATEST(attempts - 1, 0), run_at = NOW(),
+		    locked_by = NULL, locked_until = NULL, updated_at = NOW()
+		WHERE id = $1 AND locked_by = $2 AND status = 'running'
+	`)
+}
+
+// finish runs an update of a job held by a worker
+func (s *Store) finish(ctx context.Context, id, workerID, query string, args ...interface{}) error {
+	result, err := s.db.ExecContext(ctx, query, append([]interface{}{id, workerID}, args...)...)
+	if err != nil {
+		return fmt.Errorf("failed to update job: %w", err)
+	}
+	if rows, _ := result.RowsAffected(); rows == 0 {
+		return ErrLeaseLost
+	}
+	return nil
+}
+
+// ReclaimExpired returns jobs whose worker stopped renewing its lease to the
+// queue, or to the dead-letter state if they are out of attempts. Jobs whose
+// cancellation was requested are cancelled instead. It returns how many jobs
+// were reclaimed.
+func (s *Store) ReclaimExpired(ctx context.Context) (int64, error) {
+	query := `
+		UPDATE orchestrator_jobs
+		SET status = CASE WHEN cancel_requested THEN 'cancelled'
+		                  WHEN attempts >= max_attempts THEN 'dead'
+		                  ELSE 'queued' END,
+		    finished_at = CASE WHEN cancel_requested OR attempts >= max_attempts THEN NOW() ELSE NULL END,
+		    last_error = 'worker ' || COALESCE(locked_by, '') || ' stopped responding',
+		    locked_by = NULL, locked_until = NULL, updated_at = NOW()
+		WHERE status = 'running' AND locked_until < NOW()
+	`
+
+	result, err := s.db.ExecContext(ctx, query)
+	if err != nil {
+		return 0, fmt.Errorf("failed to reclaim expired jobs: %w", err)
+	}
+	return result.RowsAffected()
+}
+
+// Cancel cancels a job. A queued job is cancelled at once; a running job has
+// its cancellation requested, and its worker stops it at the next lease renewal.
+func (s *Store) Cancel(ctx context.Context, id string) (*Job, error) {
+	if _, err := uuid.Parse(id); err != nil {
+		return nil, ErrNotFound
+	}
+	query := `
+		UPDATE orchestrator_jobs
+		SET status = CASE WHEN status = 'queued' THEN 'cancelled' ELSE status END,
+		    finished_at = CASE WHEN status = 'queued' THEN NOW() ELSE finished_at END,
+		    cancel_requested = TRUE, updated_at = NOW()
+		WHERE id = $1 AND status IN ('queued', 'running')
+		RETURNING ` + jobColumns
+
+	job, err := scanJob(s.db.QueryRowContext(ctx, query, id))
+	if err == ErrNotFound {
+		if _, getErr := s.Get(ctx, id); getErr != nil {
+			return nil, getErr
+		}
+		return nil, ErrNotCancellable
+	}
+	return job, err
+}
+
+// Requeue runs a dead or cancelled job again with a fresh set of attempts
+func (s *Store) Requeue(ctx context.Context, id string) (*Job, error) {
+	if _, err := uuid.Parse(id); err != nil {
+		return nil, ErrNotFound
+	}
+	query := `
+		UPDATE orchestrator_jobs
+		SET status = 'queued', attempts = 0, run_at = NOW(), cancel_requested = FALSE,
+		    finished_at = NULL, updated_at = NOW()
+		WHERE id = $1 AND status IN ('dead', 'cancelled')
+		RETURNING ` + jobColumns
+
+	job, err := scanJob(s.db.QueryRowContext(ctx, query, id))
+	if err == ErrNotFound {
+		if _, getErr := s.Get(ctx, id); getErr != nil {
+			return nil, getErr
+		}
+		return nil, ErrNotRetryable
+	}
+	return job, err
+}
+
+// Get returns a job by ID
+func (s *Store) Get(ctx context.Context, id string) (*Job, error) {
+	if _, err := uuid.Parse(id); err != nil {
+		return nil, ErrNotFound
+	}
+	query := `SELECT ` + jobColumns + ` FROM orchestrator_jobs WHERE id = $1`
+	return scanJob(s.db.QueryRowContext(ctx, query, id))
+}
+
+// ListFilter narrows a job listing
+type ListFilter struct {
+	Status string
+	Type   string
+	Limit  int
+	Offset int
+}
+
+// List returns jobs matching the filter, newest first
+func (s *Store) List(ctx context.Context, filter ListFilter) ([]*Job, error) {
+	var conditions []string
+	var args []interface{}
+	if filter.Status != "" {
+		args = append(args, filter.Status)
+		conditions = append(conditions, fmt.Sprintf("status = $%d", len(args)))
+	}
+	if filter.Type != "" {
+		args = append(args, filter.Type)
+		conditions = append(conditions, fmt.Sprintf("type = $%d", len(args)))
+	}
+
+	query := `SELECT ` + jobColumns + ` FROM orchestrator_jobs`
+	if len(conditions) > 0 {
+		query += ` WHERE ` + strings.Join(conditions, " AND ")
+	}
+	args = append(args, filter.Limit, filter.Offset)
+	query += fmt.Sprintf(` ORDER BY created_at DESC LIMIT $%d OFFSET $%d`, len(args)-1, len(args))
+
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list jobs: %w", err)
+	}
+	defer rows.Close()
+
+	jobs := make([]*Job, 0)
+	for rows.Next() {
+		job, err := scanJob(rows)
+		if err != nil {
+			return nil, err
+		}
+		jobs = append(jobs, job)
+	}
+	return jobs, rows.Err()
+}
+
+type scanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanJob(row scanner) (*Job, error) {
+	var job Job
+	var payload, result, progress []byte
+	var lockedBy, lastError sql.NullString
+	var lockedUntil, startedAt, finishedAt sql.NullTime
+
+	err := row.Scan(&job.ID, &job.Type, &payload, &job.Status, &job.Priority, &job.Attempts, &job.MaxAttempts, &job.RunAt,
+		&lockedBy, &lockedUntil, &job.CancelRequested, &lastError, &result, &progress,
+		&job.CreatedAt, &job.UpdatedAt, &startedAt, &finishedAt)
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to scan job: %w", err)
+	}
+
+	job.Payload = payload
+	if len(result) > 0 {
+		job.Result = result
+	}
+	if len(progress) > 0 {
+		job.Progress = progress
+	}
+	job.LockedBy = lockedBy.String
+	job.LastError = lastError.String
+	if lockedUntil.Valid {
+		job.LockedUntil = &lockedUntil.Time
+	}
+	if startedAt.Valid {
+		job.StartedAt = &startedAt.Time
+	}
+	if finishedAt.Valid {
+		job.FinishedAt = &finishedAt.Time
+	}
+
+	return &job, nil
+}
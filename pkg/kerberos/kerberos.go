@@ -0,0 +1,112 @@
+// Package kerberos obtains Kerberos tickets for OpenPAM services, with a
+// keytab or a password, so they can authenticate to Active Directory with
+// SPNEGO instead of simple or NTLM binds.
+package kerberos
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/jcmturner/gokrb5/v8/client"
+	"github.com/jcmturner/gokrb5/v8/config"
+	"github.com/jcmturner/gokrb5/v8/keytab"
+)
+
+// Config locates the realm's KDCs and the keytab services log in with
+type Config struct {
+	Realm    string   // Default realm, for principals given without one
+	KDCs     []string // host[:port] of the realm's KDCs; found through DNS when empty
+	Krb5Conf string   // Path to a krb5.conf, used instead of Realm and KDCs
+	Keytab   string   // Path to the keytab of the service's principal
+}
+
+// Enabled reports whether a realm is configured
+func (c *Config) Enabled() bool {
+	return c != nil && (c.Realm != "" || c.Krb5Conf != "")
+}
+
+// Load returns the krb5 configuration, read from Krb5Conf or built from
+// Realm and KDCs
+func (c *Config) Load() (*config.Config, error) {
+	if c.Krb5Conf != "" {
+		conf, err := config.Load(c.Krb5Conf)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load %s: %w", c.Krb5Conf, err)
+		}
+		return conf, nil
+	}
+	if c.Realm == "" {
+		return nil, errors.New("no Kerberos realm configured")
+	}
+
+	realm := strings.ToUpper(c.Realm)
+	var b strings.Builder
+	fmt.Fprintf(&b, "[libdefaults]\n  default_realm = %s\n  dns_lookup_kdc = %t\n", realm, len(c.KDCs) == 0)
+	fmt.Fprintf(&b, "[realms]\n  %s = {\n", realm)
+	for _, kdc := range c.KDCs {
+		if !strings.Contains(kdc, ":") {
+			kdc += ":88"
+		}
+		fmt.Fprintf(&b, "    kdc = %s\n", kdc)
+	}
+	b.WriteString("  }\n")
+
+	conf, err := config.NewFromString(b.String())
+	if err != nil {
+		return nil, fmt.Errorf("failed to build krb5 config: %w", err)
+	}
+	return conf, nil
+}
+
+// Login obtains a ticket-granting ticket for principal with its password
+func (c *Config) Login(principal, password string) (*client.Client, error) {
+	if password == "" {
+		return nil, errors.New("no password given")
+	}
+	conf, err := c.Load()
+	if err != nil {
+		return nil, err
+	}
+
+	user, realm := c.SplitPrincipal(principal)
+	// Active Directory does not support FAST pre-authentication
+	return login(client.NewWithPassword(user, realm, password, conf, client.DisablePAFXFAST(true)))
+}
+
+// LoginKeytab obtains a ticket-granting ticket for principal with the keytab
+func (c *Config) LoginKeytab(principal string) (*client.Client, error) {
+	if c.Keytab == "" {
+		return nil, errors.New("no keytab configured")
+	}
+	conf, err := c.Load()
+	if err != nil {
+		return nil, err
+	}
+	kt, err := keytab.Load(c.Keytab)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load keytab %s: %w", c.Keytab, err)
+	}
+
+	user, realm := c.SplitPrincipal(principal)
+	return login(client.NewWithKeytab(user, realm, kt, conf, client.DisablePAFXFAST(true)))
+}
+
+func login(cl *client.Client) (*client.Client, error) {
+	if err := cl.Login(); err != nil {
+		return nil, fmt.Errorf("failed to log in as %s@%s: %w", cl.Credentials.UserName(), cl.Credentials.Domain(), err)
+	}
+	return cl, nil
+}
+
+// SplitPrincipal splits user@REALM or DOMAIN\user into the user and its
+// realm, which defaults to the configured one
+func (c *Config) SplitPrincipal(principal string) (user, realm string) {
+	realm = c.Realm
+	if i := strings.LastIndex(principal, "@"); i >= 0 {
+		principal, realm = principal[:i], principal[i+1:]
+	} else if i := strings.Index(principal, `\`); i >= 0 {
+		principal = principal[i+1:]
+	}
+	return principal, strings.ToUpper(realm)
+}
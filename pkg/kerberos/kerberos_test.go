@@ -0,0 +1,54 @@
+package kerberos
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestLoad(t *testing.T) {
+	c := &Config{Realm: "corp.example.com", KDCs: []string{"dc1.corp.example.com", "dc2.corp.example.com:8888"}}
+
+	conf, err := c.Load()
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if conf.LibDefaults.DefaultRealm != "CORP.EXAMPLE.COM" || conf.LibDefaults.DNSLookupKDC {
+		t.Errorf("libdefaults = %+v", conf.LibDefaults)
+	}
+	if len(conf.Realms) != 1 || !reflect.DeepEqual(conf.Realms[0].KDC, []string{"dc1.corp.example.com:88", "dc2.corp.example.com:8888"}) {
+		t.Errorf("realms = %+v", conf.Realms)
+	}
+
+	if _, err := (&Config{}).Load(); err == nil {
+		t.Error("Load() without a realm succeeded")
+	}
+}
+
+func TestSplitPrincipal(t *testing.T) {
+	c := &Config{Realm: "corp.example.com"}
+
+	tests := []struct {
+		principal, user, realm string
+	}{
+		{"svc-openpam@OTHER.EXAMPLE.COM", "svc-openpam", "OTHER.EXAMPLE.COM"},
+		{`CORP\svc-openpam`, "svc-openpam", "CORP.EXAMPLE.COM"},
+		{"svc-openpam", "svc-openpam", "CORP.EXAMPLE.COM"},
+	}
+	for _, tt := range tests {
+		user, realm := c.SplitPrincipal(tt.principal)
+		if user != tt.user || realm != tt.realm {
+			t.Errorf("SplitPrincipal(%q) = %q, %q, want %q, %q", tt.principal, user, realm, tt.user, tt.realm)
+		}
+	}
+}
+
+func TestLogin_MissingCredentials(t *testing.T) {
+	c := &Config{Realm: "corp.example.com"}
+
+	if _, err := c.Login("user", ""); err == nil {
+		t.Error("Login() without a password succeeded")
+	}
+	if _, err := c.LoginKeytab("svc-openpam"); err == nil {
+		t.Error("LoginKeytab() without a keytab succeeded")
+	}
+}
@@ -0,0 +1,319 @@
+// Package logger is the structured logger shared by the OpenPAM services.
+// Entries carry a level, a message and fields, written as text or JSON.
+package logger
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Level represents the log level
+type Level int
+
+const (
+	LevelDebug Level = iota
+	LevelInfo
+	LevelWarn
+	LevelError
+)
+
+// String returns the string representation of the log level
+func (l Level) String() string {
+	switch l {
+	case LevelDebug:
+		return "DEBUG"
+	case LevelInfo:
+		return "INFO"
+	case LevelWarn:
+		return "WARN"
+	case LevelError:
+		return "ERROR"
+	default:
+		return "UNKNOWN"
+	}
+}
+
+// ParseLevel parses a level name such as "info" or "WARN"
+func ParseLevel(s string) (Level, error) {
+	for level := LevelDebug; level <= LevelError; level++ {
+		if strings.EqualFold(s, level.String()) {
+			return level, nil
+		}
+	}
+	return LevelInfo, fmt.Errorf("invalid log level: %s", s)
+}
+
+// Format is how entries are written
+type Format string
+
+const (
+	FormatText Format = "text" // [time] LEVEL: message | key=value ...
+	FormatJSON Format = "json" // One JSON object per line
+)
+
+// Options configures a logger
+type Options struct {
+	Level   Level
+	Format  Format    // FormatText unless set to FormatJSON
+	Service string    // Added to every entry as "service" when set
+	Output  io.Writer // Defaults to stdout
+}
+
+// Logger provides structured logging
+type Logger struct {
+	level   Level
+	format  Format
+	service string
+
+	mu  sync.Mutex // Serializes writes to out
+	out io.Writer
+
+	hooksMu sync.RWMutex
+	hooks   []hook
+}
+
+// Entry is a logged message as passed to hooks
+type Entry struct {
+	Time    time.Time
+	Level   Level
+	Message string
+	Fields  map[string]interface{}
+}
+
+type hook struct {
+	level Level
+	fn    func(Entry)
+}
+
+// New creates a new text logger instance
+func New(level Level, out io.Writer) *Logger {
+	return NewWithOptions(Options{Level: level, Output: out})
+}
+
+// NewWithOptions creates a new logger instance
+func NewWithOptions(opts Options) *Logger {
+	if opts.Output == nil {
+		opts.Output = os.Stdout
+	}
+	if opts.Format != FormatJSON {
+		opts.Format = FormatText
+	}
+
+	return &Logger{
+		level:   opts.Level,
+		format:  opts.Format,
+		service: opts.Service,
+		out:     opts.Output,
+	}
+}
+
+// NewService creates the logger of a service from its configured level and
+// format names. Unknown levels fall back to INFO and unknown formats to text.
+func NewService(service, level, format string) *Logger {
+	lvl, err := ParseLevel(level)
+	if err != nil {
+		lvl = LevelInfo
+	}
+	return NewWithOptions(Options{
+		Level:   lvl,
+		Format:  Format(strings.ToLower(format)),
+		Service: service,
+	})
+}
+
+// Default creates a default logger with INFO level
+func Default() *Logger {
+	return New(LevelInfo, os.Stdout)
+}
+
+// AddHook calls fn with every message logged at level or above, whatever the
+// logger's own level. fn runs synchronously and must not log.
+func (l *Logger) AddHook(level Level, fn func(Entry)) {
+	l.hooksMu.Lock()
+	defer l.hooksMu.Unlock()
+	l.hooks = append(l.hooks, hook{level: level, fn: fn})
+}
+
+// log writes a log message with the given level
+func (l *Logger) log(level Level, msg string, fields map[string]interface{}) {
+	now := time.Now()
+
+	l.hooksMu.RLock()
+	for _, h := range l.hooks {
+		if level >= h.level {
+			h.fn(Entry{Time: now, Level: level, Message: msg, Fields: fields})
+		}
+	}
+	l.hooksMu.RUnlock()
+
+	if level < l.level {
+		return
+	}
+
+	var line []byte
+	if l.format == FormatJSON {
+		line = l.formatJSON(now, level, msg, fields)
+	} else {
+		line = l.formatText(now, level, msg, fields)
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.out.Write(line)
+}
+
+// formatText formats an entry as text, with fields in key order
+func (l *Logger) formatText(now time.Time, level Level, msg string, fields map[string]interface{}) []byte {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "[%s] %s: %s", now.Format(time.RFC3339), level.String(), msg)
+
+	if l.service != "" || len(fields) > 0 {
+		sb.WriteString(" |")
+		if l.service != "" {
+			fmt.Fprintf(&sb, " service=%s", l.service)
+		}
+		for _, k := range sortedKeys(fields) {
+			fmt.Fprintf(&sb, " %s=%v", k, fields[k])
+		}
+	}
+
+	sb.WriteString("\n")
+	return []byte(sb.String())
+}
+
+// formatJSON formats an entry as a JSON object. Fields can't replace the
+// timestamp, level, message or service.
+func (l *Logger) formatJSON(now time.Time, level Level, msg string, fields map[string]interface{}) []byte {
+	entry := make(map[string]interface{}, len(fields)+4)
+	for k, v := range fields {
+		if err, ok := v.(error); ok {
+			v = err.Error()
+		}
+		entry[k] = v
+	}
+	entry["timestamp"] = now.UTC().Format(time.RFC3339)
+	entry["level"] = level.String()
+	entry["message"] = msg
+	if l.service != "" {
+		entry["service"] = l.service
+	}
+
+	data, err := json.Marshal(entry)
+	if err != nil {
+		data, _ = json.Marshal(map[string]interface{}{
+			"timestamp": entry["timestamp"],
+			"level":     entry["level"],
+			"message":   msg,
+			"service":   l.service,
+			"log_error": fmt.Sprintf("failed to encode fields: %v", err),
+		})
+	}
+	return append(data, '\n')
+}
+
+func sortedKeys(fields map[string]interface{}) []string {
+	keys := make([]string, 0, len(fields))
+	for k := range fields {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// Debug logs a debug message
+func (l *Logger) Debug(msg string, fields ...map[string]interface{}) {
+	l.log(LevelDebug, msg, mergeFields(fields...))
+}
+
+// Info logs an info message
+func (l *Logger) Info(msg string, fields ...map[string]interface{}) {
+	l.log(LevelInfo, msg, mergeFields(fields...))
+}
+
+// Warn logs a warning message
+func (l *Logger) Warn(msg string, fields ...map[string]interface{}) {
+	l.log(LevelWarn, msg, mergeFields(fields...))
+}
+
+// Error logs an error message
+func (l *Logger) Error(msg string, fields ...map[string]interface{}) {
+	l.log(LevelError, msg, mergeFields(fields...))
+}
+
+// Fatal logs an error message and exits
+func (l *Logger) Fatal(msg string, fields ...map[string]interface{}) {
+	l.log(LevelError, msg, mergeFields(fields...))
+	os.Exit(1)
+}
+
+// WithFields returns a logger with additional fields
+func (l *Logger) WithFields(fields map[string]interface{}) *ContextLogger {
+	return &ContextLogger{
+		logger: l,
+		fields: fields,
+	}
+}
+
+// ContextLogger is a logger with pre-set fields
+type ContextLogger struct {
+	logger *Logger
+	fields map[string]interface{}
+}
+
+// Debug logs a debug message with context fields
+func (c *ContextLogger) Debug(msg string, fields ...map[string]interface{}) {
+	c.logger.log(LevelDebug, msg, mergeFields(c.fields, mergeFields(fields...)))
+}
+
+// Info logs an info message with context fields
+func (c *ContextLogger) Info(msg string, fields ...map[string]interface{}) {
+	c.logger.log(LevelInfo, msg, mergeFields(c.fields, mergeFields(fields...)))
+}
+
+// Warn logs a warning message with context fields
+func (c *ContextLogger) Warn(msg string, fields ...map[string]interface{}) {
+	c.logger.log(LevelWarn, msg, mergeFields(c.fields, mergeFields(fields...)))
+}
+
+// Error logs an error message with context fields
+func (c *ContextLogger) Error(msg string, fields ...map[string]interface{}) {
+	c.logger.log(LevelError, msg, mergeFields(c.fields, mergeFields(fields...)))
+}
+
+// mergeFields merges multiple field maps into one
+func mergeFields(fields ...map[string]interface{}) map[string]interface{} {
+	result := make(map[string]interface{})
+	for _, f := range fields {
+		if f != nil {
+			for k, v := range f {
+				result[k] = v
+			}
+		}
+	}
+	return result
+}
+
+// contextKey is a custom type for context keys
+type contextKey string
+
+const loggerKey contextKey = "logger"
+
+// WithContext adds a logger to the context
+func WithContext(ctx context.Context, logger *Logger) context.Context {
+	return context.WithValue(ctx, loggerKey, logger)
+}
+
+// FromContext retrieves the logger from the context
+func FromContext(ctx context.Context) *Logger {
+	if logger, ok := ctx.Value(loggerKey).(*Logger); ok {
+		return logger
+	}
+	return Default()
+}
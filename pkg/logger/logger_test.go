@@ -0,0 +1,93 @@
+package logger
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestLogger_Text(t *testing.T) {
+	var buf bytes.Buffer
+	log := New(LevelInfo, &buf)
+
+	log.Debug("hidden")
+	log.Info("Session started", map[string]interface{}{"user": "alice", "target": "db01"})
+
+	out := buf.String()
+	if strings.Contains(out, "hidden") {
+		t.Errorf("debug message logged at INFO: %q", out)
+	}
+	if !strings.Contains(out, "INFO: Session started | target=db01 user=alice\n") {
+		t.Errorf("output = %q", out)
+	}
+}
+
+func TestLogger_JSON(t *testing.T) {
+	var buf bytes.Buffer
+	log := NewWithOptions(Options{Level: LevelDebug, Format: FormatJSON, Service: "license", Output: &buf})
+
+	log.WithFields(map[string]interface{}{"request_id": "abc"}).Warn("Check failed", map[string]interface{}{
+		"error":   errors.New("timeout"),
+		"service": "spoofed",
+	})
+
+	var entry map[string]interface{}
+	if err := json.Unmarshal(buf.Bytes(), &entry); err != nil {
+		t.Fatalf("output %q is not JSON: %v", buf.String(), err)
+	}
+	for k, want := range map[string]string{
+		"level":      "WARN",
+		"message":    "Check failed",
+		"service":    "license",
+		"request_id": "abc",
+		"error":      "timeout",
+	} {
+		if entry[k] != want {
+			t.Errorf("%s = %v, want %q", k, entry[k], want)
+		}
+	}
+}
+
+func TestNewService(t *testing.T) {
+	var buf bytes.Buffer
+	log := NewService("scheduling", "bogus", "JSON")
+	log.out = &buf
+
+	log.Debug("hidden")
+	log.Info("ready")
+
+	if !strings.HasPrefix(buf.String(), "{") || strings.Contains(buf.String(), "hidden") {
+		t.Errorf("output = %q, want JSON at INFO", buf.String())
+	}
+}
+
+func TestLogger_Hooks(t *testing.T) {
+	var buf bytes.Buffer
+	log := New(LevelError, &buf)
+
+	var got []Entry
+	log.AddHook(LevelWarn, func(e Entry) { got = append(got, e) })
+
+	log.Info("ignored")
+	log.Warn("slow query", map[string]interface{}{"ms": 900})
+
+	if len(got) != 1 || got[0].Message != "slow query" || got[0].Fields["ms"] != 900 {
+		t.Errorf("hook entries = %+v", got)
+	}
+	if buf.Len() != 0 {
+		t.Errorf("WARN written at ERROR level: %q", buf.String())
+	}
+}
+
+func TestParseLevel(t *testing.T) {
+	for s, want := range map[string]Level{"debug": LevelDebug, "INFO": LevelInfo, "Warn": LevelWarn, "error": LevelError} {
+		if got, err := ParseLevel(s); err != nil || got != want {
+			t.Errorf("ParseLevel(%q) = %v, %v", s, got, err)
+		}
+	}
+	if _, err := ParseLevel("verbose"); err == nil {
+		t.Error("ParseLevel(verbose) succeeded")
+	}
+}
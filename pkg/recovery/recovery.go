@@ -0,0 +1,168 @@
+// Package recovery turns handler panics into problem+json responses, logs
+// them with their stack and request ID, and reports them to a
+// Sentry-compatible endpoint.
+package recovery
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"expvar"
+	"fmt"
+	"net"
+	"net/http"
+	"runtime"
+	"runtime/debug"
+)
+
+// RequestIDHeader carries the request ID between services and back to clients
+const RequestIDHeader = "X-Request-ID"
+
+// panics counts recovered panics; it is published at /debug/vars style
+// endpoints through expvar
+var panics = expvar.NewInt("http_panics_recovered")
+
+type contextKey struct{}
+
+// ErrorFunc logs an error with structured fields
+type ErrorFunc func(message string, fields map[string]interface{})
+
+// RequestID returns a middleware that gives every request an ID, keeping a
+// well-formed one sent by the caller, and echoes it in the response
+func RequestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(RequestIDHeader)
+		if !validRequestID(id) {
+			id = newID()
+		}
+		w.Header().Set(RequestIDHeader, id)
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), contextKey{}, id)))
+	})
+}
+
+// RequestIDFromContext returns the request's ID, or "" outside a request
+func RequestIDFromContext(ctx context.Context) string {
+	id, _ := ctx.Value(contextKey{}).(string)
+	return id
+}
+
+// validRequestID accepts short IDs of letters, digits, '-', '_' and '.', so a
+// caller can't inject anything into logs or headers
+func validRequestID(id string) bool {
+	if id == "" || len(id) > 128 {
+		return false
+	}
+	for _, c := range id {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '-' || c == '_' || c == '.') {
+			return false
+		}
+	}
+	return true
+}
+
+func newID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// Problem is an RFC 7807 problem details response
+type Problem struct {
+	Type      string `json:"type"`
+	Code      string `json:"code,omitempty"` // Stable code of the message, for clients
+	Title     string `json:"title"`
+	Status    int    `json:"status"`
+	Detail    string `json:"detail,omitempty"`
+	Instance  string `json:"instance,omitempty"`
+	RequestID string `json:"request_id,omitempty"`
+}
+
+// writer tracks whether the response was started, so a panic after the
+// handler began writing doesn't append a second response
+type writer struct {
+	http.ResponseWriter
+	started bool
+}
+
+func (w *writer) WriteHeader(status int) {
+	w.started = true
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *writer) Write(b []byte) (int, error) {
+	w.started = true
+	return w.ResponseWriter.Write(b)
+}
+
+// Hijack hands the connection to WebSocket handlers
+func (w *writer) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	h, ok := w.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, fmt.Errorf("response writer does not support hijacking")
+	}
+	w.started = true
+	return h.Hijack()
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer
+func (w *writer) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// Middleware returns a middleware that recovers from panics in next. The
+// panic is logged with its stack, counted, reported when reporter is set, and
+// answered with a 500 problem+json response.
+func Middleware(service string, logError ErrorFunc, reporter *Reporter) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			rw := &writer{ResponseWriter: w}
+			defer func() {
+				p := recover()
+				if p == nil {
+					return
+				}
+				// The handler chose to abort the response
+				if p == http.ErrAbortHandler {
+					panic(p)
+				}
+
+				panics.Add(1)
+				requestID := RequestIDFromContext(r.Context())
+				stack := debug.Stack()
+				pcs := make([]uintptr, 64)
+				pcs = pcs[:runtime.Callers(3, pcs)]
+
+				logError("Panic recovered", map[string]interface{}{
+					"service":    service,
+					"panic":      fmt.Sprint(p),
+					"method":     r.Method,
+					"path":       r.URL.Path,
+					"request_id": requestID,
+					"stack":      string(stack),
+				})
+				if reporter != nil {
+					reporter.Report(p, pcs, r, requestID)
+				}
+
+				if rw.started {
+					return
+				}
+				rw.Header().Set("Content-Type", "application/problem+json")
+				rw.WriteHeader(http.StatusInternalServerError)
+				json.NewEncoder(rw).Encode(Problem{
+					Type:      "about:blank",
+					Code:      "internal_error",
+					Title:     http.StatusText(http.StatusInternalServerError),
+					Status:    http.StatusInternalServerError,
+					Detail:    "The server encountered an unexpected error. Quote the request ID when reporting it.",
+					Instance:  r.URL.Path,
+					RequestID: requestID,
+				})
+			}()
+
+			next.ServeHTTP(rw, r)
+		})
+	}
+}
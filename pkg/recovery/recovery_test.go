@@ -0,0 +1,129 @@
+package recovery
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestMiddleware(t *testing.T) {
+	var logged map[string]interface{}
+	handler := RequestID(Middleware("test", func(message string, fields map[string]interface{}) {
+		logged = fields
+	}, nil)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		panic("boom")
+	})))
+
+	before := panics.Value()
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/targets", nil)
+	req.Header.Set(RequestIDHeader, "abc-123")
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusInternalServerError {
+		t.Fatalf("status = %d, want 500", rec.Code)
+	}
+	if ct := rec.Header().Get("Content-Type"); ct != "application/problem+json" {
+		t.Errorf("content type = %q", ct)
+	}
+	var p Problem
+	if err := json.NewDecoder(rec.Body).Decode(&p); err != nil {
+		t.Fatal(err)
+	}
+	if p.Status != 500 || p.RequestID != "abc-123" || p.Instance != "/api/v1/targets" {
+		t.Errorf("problem = %+v", p)
+	}
+	if panics.Value() != before+1 {
+		t.Errorf("panic counter not incremented")
+	}
+	if logged["request_id"] != "abc-123" || logged["panic"] != "boom" || !strings.Contains(logged["stack"].(string), "recovery") {
+		t.Errorf("logged fields = %v", logged)
+	}
+}
+
+func TestMiddlewareStartedResponse(t *testing.T) {
+	handler := Middleware("test", func(string, map[string]interface{}) {}, nil)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusAccepted)
+		panic("late")
+	}))
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+	if rec.Code != http.StatusAccepted || rec.Body.Len() != 0 {
+		t.Errorf("started response was rewritten: %d %q", rec.Code, rec.Body.String())
+	}
+}
+
+func TestRequestID(t *testing.T) {
+	var seen string
+	handler := RequestID(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seen = RequestIDFromContext(r.Context())
+	}))
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set(RequestIDHeader, "bad id\r\ninjected")
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if len(seen) != 32 || rec.Header().Get(RequestIDHeader) != seen {
+		t.Errorf("invalid ID was not replaced: %q", seen)
+	}
+}
+
+func TestReporter(t *testing.T) {
+	var mu sync.Mutex
+	var path, auth string
+	var body map[string]interface{}
+	done := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		path, auth = r.URL.Path, r.Header.Get("X-Sentry-Auth")
+		data, _ := io.ReadAll(r.Body)
+		json.Unmarshal(data, &body)
+		close(done)
+	}))
+	defer srv.Close()
+
+	if _, err := NewReporter("not a dsn", "test", "", ""); err == nil {
+		t.Error("expected invalid DSN to be rejected")
+	}
+	if rep, err := NewReporter("", "test", "", ""); rep != nil || err != nil {
+		t.Error("expected empty DSN to disable reporting")
+	}
+
+	dsn := strings.Replace(srv.URL, "http://", "http://pubkey@", 1) + "/sentry/42"
+	rep, err := NewReporter(dsn, "test", "staging", "1.2.3")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/targets?token=secret", nil)
+	req.Header.Set("Authorization", "Bearer secret")
+	rep.Report("boom", nil, req, "abc-123")
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("report not sent")
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if path != "/sentry/api/42/store/" || !strings.Contains(auth, "sentry_key=pubkey") {
+		t.Errorf("path = %q, auth = %q", path, auth)
+	}
+	if body["environment"] != "staging" || body["release"] != "1.2.3" {
+		t.Errorf("event = %v", body)
+	}
+	if tags := body["tags"].(map[string]interface{}); tags["request_id"] != "abc-123" {
+		t.Errorf("tags = %v", tags)
+	}
+	data, _ := json.Marshal(body)
+	if strings.Contains(string(data), "secret") {
+		t.Errorf("event leaked request secrets: %s", data)
+	}
+}
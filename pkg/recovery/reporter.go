@@ -0,0 +1,172 @@
+package recovery
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"runtime"
+	"strings"
+	"time"
+)
+
+// Reporter sends panics to a Sentry-compatible endpoint, such as Sentry or
+// GlitchTip, using the store API
+type Reporter struct {
+	endpoint    string
+	auth        string
+	service     string
+	environment string
+	release     string
+	client      *http.Client
+	inflight    chan struct{} // Bounds concurrent reports; excess reports are dropped
+}
+
+// NewReporter creates a reporter from a DSN of the form
+// https://<key>@<host>/<project>. It returns nil when dsn is empty.
+func NewReporter(dsn, service, environment, release string) (*Reporter, error) {
+	if dsn == "" {
+		return nil, nil
+	}
+
+	u, err := url.Parse(dsn)
+	if err != nil || u.User == nil || u.User.Username() == "" || u.Host == "" {
+		return nil, fmt.Errorf("invalid DSN: must be https://<key>@<host>/<project>")
+	}
+	path := strings.TrimSuffix(u.Path, "/")
+	i := strings.LastIndex(path, "/")
+	project := path[i+1:]
+	if project == "" {
+		return nil, fmt.Errorf("invalid DSN: missing project ID")
+	}
+
+	auth := "Sentry sentry_version=7, sentry_client=openpam/1.0, sentry_key=" + u.User.Username()
+	if secret, ok := u.User.Password(); ok {
+		auth += ", sentry_secret=" + secret
+	}
+
+	return &Reporter{
+		endpoint:    fmt.Sprintf("%s://%s%s/api/%s/store/", u.Scheme, u.Host, path[:i], project),
+		auth:        auth,
+		service:     service,
+		environment: environment,
+		release:     release,
+		client:      &http.Client{Timeout: 5 * time.Second},
+		inflight:    make(chan struct{}, 4),
+	}, nil
+}
+
+// frame is a Sentry stack frame
+type frame struct {
+	Function string `json:"function"`
+	Filename string `json:"filename"`
+	Lineno   int    `json:"lineno"`
+}
+
+// event is the subset of the Sentry event payload the reporter fills in
+type event struct {
+	EventID     string            `json:"event_id"`
+	Timestamp   string            `json:"timestamp"`
+	Level       string            `json:"level"`
+	Platform    string            `json:"platform"`
+	Logger      string            `json:"logger"`
+	ServerName  string            `json:"server_name,omitempty"`
+	Release     string            `json:"release,omitempty"`
+	Environment string            `json:"environment,omitempty"`
+	Tags        map[string]string `json:"tags"`
+	Request     map[string]string `json:"request"`
+	Exception   struct {
+		Values []exception `json:"values"`
+	} `json:"exception"`
+}
+
+type exception struct {
+	Type       string `json:"type"`
+	Value      string `json:"value"`
+	Stacktrace struct {
+		Frames []frame `json:"frames"`
+	} `json:"stacktrace"`
+}
+
+// Report sends a panic in the background. Only the method, path and user
+// agent of the request are sent; headers, query and body may hold secrets.
+func (rep *Reporter) Report(p interface{}, pcs []uintptr, r *http.Request, requestID string) {
+	ev := event{
+		EventID:     newID(),
+		Timestamp:   time.Now().UTC().Format(time.RFC3339),
+		Level:       "fatal",
+		Platform:    "go",
+		Logger:      rep.service,
+		Release:     rep.release,
+		Environment: rep.environment,
+		Tags: map[string]string{
+			"service":    rep.service,
+			"request_id": requestID,
+		},
+		Request: map[string]string{
+			"method": r.Method,
+			"url":    r.URL.Path,
+		},
+	}
+	ev.ServerName, _ = os.Hostname()
+	if ua := r.UserAgent(); ua != "" {
+		ev.Request["user_agent"] = ua
+	}
+
+	exc := exception{Type: "panic", Value: fmt.Sprint(p)}
+	if err, ok := p.(error); ok {
+		exc.Type = fmt.Sprintf("%T", err)
+	}
+	frames := runtime.CallersFrames(pcs)
+	for {
+		f, more := frames.Next()
+		exc.Stacktrace.Frames = append(exc.Stacktrace.Frames, frame{Function: f.Function, Filename: f.File, Lineno: f.Line})
+		if !more {
+			break
+		}
+	}
+	// Sentry lists frames oldest first
+	for i, j := 0, len(exc.Stacktrace.Frames)-1; i < j; i, j = i+1, j-1 {
+		exc.Stacktrace.Frames[i], exc.Stacktrace.Frames[j] = exc.Stacktrace.Frames[j], exc.Stacktrace.Frames[i]
+	}
+	ev.Exception.Values = []exception{exc}
+
+	select {
+	case rep.inflight <- struct{}{}:
+	default:
+		return
+	}
+	go func() {
+		defer func() { <-rep.inflight }()
+		rep.send(&ev)
+	}()
+}
+
+func (rep *Reporter) send(ev *event) error {
+	data, err := json.Marshal(ev)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, rep.endpoint, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Sentry-Auth", rep.auth)
+
+	resp, err := rep.client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("error report rejected: %s", resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,136 @@
+package servicetoken
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func TestIssueVerify(t *testing.T) {
+	secret := []byte("test-secret")
+
+	token, err := Issue(secret, "orchestrator")
+	if err != nil {
+		t.Fatalf("Issue() error = %v", err)
+	}
+
+	claims, err := Verify(secret, token)
+	if err != nil {
+		t.Fatalf("Verify() error = %v", err)
+	}
+	if !claims.IsService() || claims.Subject != "orchestrator" {
+		t.Errorf("claims = %+v", claims)
+	}
+
+	if _, err := Verify([]byte("other-secret"), token); err == nil {
+		t.Error("token verified with the wrong secret")
+	}
+
+	// Session tokens issued by the gateway are accepted too
+	session, _ := jwt.NewWithClaims(jwt.SigningMethodHS256, Claims{
+		UserID: "c0ffee00-0000-0000-0000-000000000000",
+		Role:   "admin",
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    "openpam",
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour)),
+		},
+	}).SignedString(secret)
+	claims, err = Verify(secret, session)
+	if err != nil || claims.IsService() || claims.Role != "admin" {
+		t.Errorf("Verify(session) = %+v, %v", claims, err)
+	}
+
+	expired, _ := jwt.NewWithClaims(jwt.SigningMethodHS256, Claims{
+		Role: RoleService,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    "openpam",
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(-time.Minute)),
+		},
+	}).SignedString(secret)
+	if _, err := Verify(secret, expired); err == nil {
+		t.Error("expired token verified")
+	}
+}
+
+func TestTransport(t *testing.T) {
+	secret := []byte("test-secret")
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token, err := FromRequest(r)
+		if err != nil {
+			t.Errorf("FromRequest() error = %v", err)
+			return
+		}
+		if claims, err := Verify(secret, token); err != nil || claims.Subject != "gateway" {
+			t.Errorf("Verify() = %+v, %v", claims, err)
+		}
+	}))
+	defer srv.Close()
+
+	client := &http.Client{Transport: &Transport{Secret: secret, Service: "gateway"}}
+	resp, err := client.Get(srv.URL)
+	if err != nil {
+		t.Fatalf("Get() error = %v", err)
+	}
+	resp.Body.Close()
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	if _, err := FromRequest(req); !errors.Is(err, ErrNoToken) {
+		t.Errorf("FromRequest() without a token = %v", err)
+	}
+}
+
+func TestVerifyWithKeys(t *testing.T) {
+	secret := []byte("test-secret")
+	pub, priv, _ := ed25519.GenerateKey(rand.Reader)
+	jwk, err := NewJWK("", "EdDSA", pub)
+	if err != nil {
+		t.Fatalf("NewJWK() error = %v", err)
+	}
+	jwk.Kid = jwk.Thumbprint()
+
+	fetches := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fetches++
+		json.NewEncoder(w).Encode(JWKSet{Keys: []JWK{jwk}})
+	}))
+	defer srv.Close()
+	keys := NewKeySet(srv.URL)
+
+	token := jwt.NewWithClaims(jwt.SigningMethodEdDSA, Claims{
+		Role: "admin",
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    "openpam",
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour)),
+		},
+	})
+	token.Header["kid"] = jwk.Kid
+	signed, _ := token.SignedString(priv)
+
+	if _, err := Verify(secret, signed); err == nil {
+		t.Error("Verify() accepted a public key token without a key set")
+	}
+	claims, err := VerifyWithKeys(secret, keys, signed)
+	if err != nil || claims.Role != "admin" {
+		t.Fatalf("VerifyWithKeys() = %+v, %v", claims, err)
+	}
+
+	// Unknown keys refetch at most once a minute
+	token.Header["kid"] = "rotated"
+	other, _ := token.SignedString(priv)
+	for i := 0; i < 3; i++ {
+		if _, err := VerifyWithKeys(secret, keys, other); err == nil {
+			t.Error("VerifyWithKeys() accepted an unknown key")
+		}
+	}
+	if fetches != 1 {
+		t.Errorf("fetched the key set %d times, want 1", fetches)
+	}
+}
@@ -0,0 +1,151 @@
+package types
+
+import (
+	"encoding"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// Kinds of JSON value
+const (
+	kindString = "string"
+	kindNumber = "number"
+	kindBool   = "bool"
+	kindObject = "object"
+	kindArray  = "array"
+)
+
+var (
+	jsonMarshaler = reflect.TypeOf((*json.Marshaler)(nil)).Elem()
+	textMarshaler = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+)
+
+// field is the JSON shape of a struct field
+type field struct {
+	kind     string
+	nullable bool
+}
+
+// CheckContract reports how the JSON encoding of payload, a service's model,
+// drifts from canonical, one of the types in this package. Every field of
+// canonical must be encoded under the same name as the same kind of value,
+// and may only be null if canonical allows it. Extra payload fields are fine.
+func CheckContract(payload, canonical interface{}) error {
+	got := jsonFields(reflect.TypeOf(payload))
+	want := jsonFields(reflect.TypeOf(canonical))
+
+	var drift []string
+	for name, w := range want {
+		g, ok := got[name]
+		switch {
+		case !ok:
+			drift = append(drift, fmt.Sprintf("%s is missing", name))
+		case g.kind != w.kind:
+			drift = append(drift, fmt.Sprintf("%s encodes as %s, want %s", name, g.kind, w.kind))
+		case g.nullable && !w.nullable:
+			drift = append(drift, fmt.Sprintf("%s may be null", name))
+		}
+	}
+	if len(drift) == 0 {
+		return nil
+	}
+
+	sort.Strings(drift)
+	return fmt.Errorf("%s drifts from %s: %s", reflect.TypeOf(payload), reflect.TypeOf(canonical), strings.Join(drift, "; "))
+}
+
+// jsonFields returns the fields of struct type t by JSON name
+func jsonFields(t reflect.Type) map[string]field {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	fields := make(map[string]field)
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag := f.Tag.Get("json")
+		if tag == "-" || (!f.IsExported() && !f.Anonymous) {
+			continue
+		}
+		name, _, _ := strings.Cut(tag, ",")
+
+		// Untagged embedded structs are flattened into their parent
+		if f.Anonymous && name == "" && f.Type.Kind() == reflect.Struct {
+			for k, v := range jsonFields(f.Type) {
+				fields[k] = v
+			}
+			continue
+		}
+
+		if name == "" {
+			name = f.Name
+		}
+		fields[name] = shape(f.Type)
+	}
+	return fields
+}
+
+// shape returns the kind of JSON value a Go type encodes to
+func shape(t reflect.Type) field {
+	var f field
+	for t.Kind() == reflect.Ptr {
+		f.nullable = true
+		t = t.Elem()
+	}
+
+	switch {
+	case t.Implements(jsonMarshaler) || reflect.PtrTo(t).Implements(jsonMarshaler):
+		f.kind = marshaledKind(t)
+	case t.Implements(textMarshaler) || reflect.PtrTo(t).Implements(textMarshaler):
+		f.kind = kindString
+	default:
+		switch t.Kind() {
+		case reflect.String:
+			f.kind = kindString
+		case reflect.Bool:
+			f.kind = kindBool
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+			reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+			reflect.Float32, reflect.Float64:
+			f.kind = kindNumber
+		case reflect.Struct:
+			f.kind = kindObject
+		case reflect.Map:
+			f.kind = kindObject
+			f.nullable = true // A nil map encodes as null
+		case reflect.Slice, reflect.Array:
+			f.kind = kindArray
+			f.nullable = f.nullable || t.Kind() == reflect.Slice
+		default:
+			f.kind = t.Kind().String()
+		}
+	}
+	return f
+}
+
+// marshaledKind encodes the zero value of a type with its own MarshalJSON
+// to see what kind of value it produces
+func marshaledKind(t reflect.Type) string {
+	data, err := json.Marshal(reflect.New(t).Interface())
+	if err != nil || len(data) == 0 {
+		return "unknown"
+	}
+	switch data[0] {
+	case '"':
+		return kindString
+	case '{':
+		return kindObject
+	case '[':
+		return kindArray
+	case 't', 'f':
+		return kindBool
+	case 'n':
+		// null for the zero value; most such types encode objects
+		return kindObject
+	default:
+		return kindNumber
+	}
+}
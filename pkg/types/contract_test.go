@@ -0,0 +1,65 @@
+package types
+
+import (
+	"database/sql"
+	"strings"
+	"testing"
+	"time"
+)
+
+type id [2]byte
+
+func (i id) MarshalText() ([]byte, error) { return []byte("id"), nil }
+
+func TestCheckContract(t *testing.T) {
+	type base struct {
+		ID string `json:"id"`
+	}
+	type matching struct {
+		base
+		ZoneID      id                `json:"zone_id"`
+		Name        string            `json:"name"`
+		Hostname    string            `json:"hostname"`
+		Protocol    string            `json:"protocol"`
+		Port        int64             `json:"port"`
+		Enabled     bool              `json:"enabled"`
+		CreatedAt   time.Time         `json:"created_at"`
+		UpdatedAt   time.Time         `json:"updated_at"`
+		OwnerTeam   string            `json:"owner_team"`
+		Environment string            `json:"environment"`
+		Scope       []string          `json:"compliance_scope"`
+		Labels      map[string]string `json:"labels"`
+		Notes       string            `json:"connection_notes"`
+		Description string            `json:"description"` // Extra fields are allowed
+		secret      string
+	}
+	if err := CheckContract(matching{}, Target{}); err != nil {
+		t.Errorf("CheckContract() error = %v", err)
+	}
+
+	type drifted struct {
+		ID          string       `json:"id"`
+		EntraID     string       `json:"entra_id"`
+		Email       *string      `json:"email"`
+		DisplayName string       `json:"name"`
+		Role        string       `json:"role"`
+		Enabled     string       `json:"enabled"`
+		Source      string       `json:"source"`
+		CreatedAt   time.Time    `json:"created_at"`
+		LastLoginAt sql.NullTime `json:"last_login_at,omitempty"`
+	}
+	err := CheckContract(&drifted{}, User{})
+	if err == nil {
+		t.Fatal("CheckContract() succeeded for a drifted payload")
+	}
+	for _, want := range []string{
+		"display_name is missing",
+		"email may be null",
+		"enabled encodes as string, want bool",
+		"last_login_at encodes as object, want string",
+	} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("error %q doesn't report %q", err, want)
+		}
+	}
+}
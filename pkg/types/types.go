@@ -0,0 +1,86 @@
+// Package types holds the domain types the OpenPAM services exchange, in
+// their canonical JSON form. Services may keep richer models of their own but
+// their API payloads must stay compatible with these; see CheckContract.
+package types
+
+import "time"
+
+// Schedule statuses
+const (
+	ScheduleStatusPending   = "pending"
+	ScheduleStatusActive    = "active"
+	ScheduleStatusExpired   = "expired"
+	ScheduleStatusCancelled = "cancelled"
+)
+
+// Schedule approval statuses
+const (
+	ApprovalStatusPending  = "pending"
+	ApprovalStatusApproved = "approved"
+	ApprovalStatusRejected = "rejected"
+)
+
+// User is a user allowed to log in to OpenPAM
+type User struct {
+	ID          string     `json:"id"`
+	EntraID     string     `json:"entra_id"`
+	Email       string     `json:"email"`
+	DisplayName string     `json:"display_name,omitempty"`
+	Role        string     `json:"role"`
+	Enabled     bool       `json:"enabled"`
+	Source      string     `json:"source"`
+	CreatedAt   time.Time  `json:"created_at"`
+	LastLoginAt *time.Time `json:"last_login_at,omitempty"`
+}
+
+// Target is a server or system users connect to
+type Target struct {
+	ID        string    `json:"id"`
+	ZoneID    string    `json:"zone_id"`
+	Name      string    `json:"name"`
+	Hostname  string    `json:"hostname"`
+	Protocol  string    `json:"protocol"`
+	Port      int       `json:"port"`
+	Enabled   bool      `json:"enabled"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+
+	// Ownership and connection instructions
+	OwnerTeam       string            `json:"owner_team,omitempty"`
+	Environment     string            `json:"environment,omitempty"`
+	ComplianceScope []string          `json:"compliance_scope,omitempty"`
+	Labels          map[string]string `json:"labels,omitempty"`
+	ConnectionNotes string            `json:"connection_notes,omitempty"` // Markdown
+}
+
+// Schedule is a window in which a user may connect to a target
+type Schedule struct {
+	ID              string                 `json:"id"`
+	UserID          string                 `json:"user_id"`
+	TargetID        string                 `json:"target_id"`
+	StartTime       time.Time              `json:"start_time"`
+	EndTime         time.Time              `json:"end_time"`
+	RecurrenceRule  *string                `json:"recurrence_rule,omitempty"`
+	Timezone        string                 `json:"timezone"`
+	Status          string                 `json:"status"`
+	ApprovalStatus  string                 `json:"approval_status"`
+	RejectionReason *string                `json:"rejection_reason,omitempty"`
+	ApprovedBy      *string                `json:"approved_by,omitempty"`
+	ApprovedAt      *time.Time             `json:"approved_at,omitempty"`
+	CreatedBy       *string                `json:"created_by,omitempty"`
+	CreatedAt       time.Time              `json:"created_at"`
+	UpdatedAt       time.Time              `json:"updated_at"`
+	Metadata        map[string]interface{} `json:"metadata,omitempty"`
+}
+
+// In converts the schedule's times to loc for display
+func (s *Schedule) In(loc *time.Location) {
+	s.StartTime = s.StartTime.In(loc)
+	s.EndTime = s.EndTime.In(loc)
+	s.CreatedAt = s.CreatedAt.In(loc)
+	s.UpdatedAt = s.UpdatedAt.In(loc)
+	if s.ApprovedAt != nil {
+		approvedAt := s.ApprovedAt.In(loc)
+		s.ApprovedAt = &approvedAt
+	}
+}
@@ -1,19 +1,28 @@
 package main
 
 import (
-	"log"
 	"net/http"
+	"os"
 
-	"openpam/scheduling/internal/api"
+	"github.com/VanCannon/openpam/pkg/logger"
+	"github.com/VanCannon/openpam/scheduling/internal/api"
 
 	"github.com/gorilla/mux"
 )
 
 func main() {
-	log.Println("Starting Scheduling Service on :8081")
+	log := logger.NewService("scheduling", os.Getenv("LOG_LEVEL"), os.Getenv("LOG_FORMAT"))
+	api.SetLogger(log)
+	log.Info("Starting Scheduling Service", map[string]interface{}{
+		"port": 8081,
+	})
 
 	r := mux.NewRouter()
 	api.RegisterRoutes(r)
 
-	log.Fatal(http.ListenAndServe(":8081", r))
+	if err := http.ListenAndServe(":8081", r); err != nil {
+		log.Fatal("Server failed", map[string]interface{}{
+			"error": err.Error(),
+		})
+	}
 }
@@ -2,6 +2,7 @@ package main
 
 import (
 	"context"
+	"expvar"
 	"fmt"
 	"net/http"
 	"os"
@@ -16,7 +17,8 @@ import (
 	"github.com/VanCannon/openpam/scheduling/internal/events"
 	"github.com/VanCannon/openpam/scheduling/internal/handlers"
 	"github.com/VanCannon/openpam/scheduling/internal/schedule"
-	"github.com/VanCannon/openpam/scheduling/pkg/logger"
+	"github.com/VanCannon/openpam/pkg/logger"
+	"github.com/VanCannon/openpam/pkg/recovery"
 )
 
 func main() {
@@ -28,7 +30,7 @@ func main() {
 	}
 
 	// Initialize logger
-	log := logger.New(cfg.Logging.Level, cfg.Logging.Format)
+	log := logger.NewService("scheduling", cfg.Logging.Level, cfg.Logging.Format)
 	log.Info("Starting Scheduling Agent", map[string]interface{}{
 		"port": cfg.Server.Port,
 	})
@@ -105,11 +107,22 @@ func main() {
 	})
 	mux.HandleFunc("/api/v1/schedule/check", handler.CheckAccess)
 
+	mux.Handle("/debug/vars", expvar.Handler())
+
+	reporter, err := recovery.NewReporter(os.Getenv("SENTRY_DSN"), "scheduling", os.Getenv("SENTRY_ENVIRONMENT"), "")
+	if err != nil {
+		log.Fatal("Invalid SENTRY_DSN", map[string]interface{}{
+			"error": err.Error(),
+		})
+	}
+
 	// Create HTTP server
 	addr := fmt.Sprintf("%s:%d", cfg.Server.Host, cfg.Server.Port)
 	server := &http.Server{
 		Addr:         addr,
-		Handler:      mux,
+		Handler:      recovery.RequestID(recovery.Middleware("scheduling", func(message string, fields map[string]interface{}) {
+			log.Error(message, fields)
+		}, reporter)(mux)),
 		ReadTimeout:  15 * time.Second,
 		WriteTimeout: 15 * time.Second,
 		IdleTimeout:  60 * time.Second,
@@ -1,4 +1,4 @@
-module openpam/scheduling
+module github.com/VanCannon/openpam/scheduling
 
 go 1.21
 
@@ -12,6 +12,7 @@ require (
 )
 
 require (
+	github.com/VanCannon/openpam/pkg v0.0.0
 	github.com/armon/go-metrics v0.4.1 // indirect
 	github.com/fatih/color v1.14.1 // indirect
 	github.com/hashicorp/go-cleanhttp v0.5.2 // indirect
@@ -27,7 +28,9 @@ require (
 	github.com/mitchellh/mapstructure v1.5.0 // indirect
 	github.com/nats-io/nkeys v0.4.5 // indirect
 	github.com/nats-io/nuid v1.0.1 // indirect
-	golang.org/x/crypto v0.6.0 // indirect
+	golang.org/x/crypto v0.16.0 // indirect
 	golang.org/x/exp v0.0.0-20230321023759-10a507213a29 // indirect
-	golang.org/x/sys v0.10.0 // indirect
+	golang.org/x/sys v0.15.0 // indirect
 )
+
+replace github.com/VanCannon/openpam/pkg => ../pkg
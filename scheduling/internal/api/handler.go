@@ -2,12 +2,20 @@ package api
 
 import (
 	"encoding/json"
-	"log"
 	"net/http"
 
+	"github.com/VanCannon/openpam/pkg/logger"
 	"github.com/gorilla/mux"
 )
 
+// log is the scheduling service's logger, replaced by SetLogger at startup
+var log = logger.Default()
+
+// SetLogger sets the logger the package logs with
+func SetLogger(l *logger.Logger) {
+	log = l
+}
+
 type ScheduleRequest struct {
 	JobType  string `json:"job_type"` // e.g., "ad_sync"
 	Interval string `json:"interval"` // e.g., "daily", "0 0 * * *"
@@ -26,7 +34,10 @@ func CreateSchedule(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// TODO: Register job with a scheduler library (e.g., robfig/cron)
-	log.Printf("Scheduled job '%s' with interval '%s'", req.JobType, req.Interval)
+	log.Info("Scheduled job", map[string]interface{}{
+		"job_type": req.JobType,
+		"interval": req.Interval,
+	})
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(map[string]string{"status": "schedule_created"})
@@ -7,7 +7,7 @@ import (
 
 	_ "github.com/lib/pq"
 	"github.com/VanCannon/openpam/scheduling/internal/config"
-	"github.com/VanCannon/openpam/scheduling/pkg/logger"
+	"github.com/VanCannon/openpam/pkg/logger"
 )
 
 type Database struct {
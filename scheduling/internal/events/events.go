@@ -7,7 +7,7 @@ import (
 
 	"github.com/nats-io/nats.go"
 	"github.com/VanCannon/openpam/scheduling/internal/schedule"
-	"github.com/VanCannon/openpam/scheduling/pkg/logger"
+	"github.com/VanCannon/openpam/pkg/logger"
 )
 
 type Publisher struct {
@@ -2,11 +2,13 @@ package handlers
 
 import (
 	"encoding/json"
+	"errors"
 	"net/http"
 	"strings"
+	"time"
 
+	"github.com/VanCannon/openpam/pkg/logger"
 	"github.com/VanCannon/openpam/scheduling/internal/schedule"
-	"github.com/VanCannon/openpam/scheduling/pkg/logger"
 )
 
 type Handler struct {
@@ -45,7 +47,16 @@ func (h *Handler) CreateSchedule(w http.ResponseWriter, r *http.Request) {
 	// TODO: Extract createdBy from auth context
 	createdBy := r.Header.Get("X-User-ID")
 
+	loc, ok := h.displayLocation(w, r)
+	if !ok {
+		return
+	}
+
 	result, err := h.service.CreateSchedule(&req, createdBy)
+	if errors.Is(err, schedule.ErrInvalidTimezone) {
+		h.errorResponse(w, "Invalid timezone", http.StatusBadRequest)
+		return
+	}
 	if err != nil {
 		h.logger.Error("Failed to create schedule", map[string]interface{}{
 			"error": err.Error(),
@@ -54,6 +65,7 @@ func (h *Handler) CreateSchedule(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	result.In(loc)
 	h.jsonResponse(w, result, http.StatusCreated)
 }
 
@@ -65,6 +77,11 @@ func (h *Handler) GetSchedule(w http.ResponseWriter, r *http.Request) {
 
 	id := strings.TrimPrefix(r.URL.Path, "/api/v1/schedules/")
 
+	loc, ok := h.displayLocation(w, r)
+	if !ok {
+		return
+	}
+
 	result, err := h.service.GetSchedule(id)
 	if err != nil {
 		h.logger.Error("Failed to get schedule", map[string]interface{}{
@@ -75,6 +92,7 @@ func (h *Handler) GetSchedule(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	result.In(loc)
 	h.jsonResponse(w, result, http.StatusOK)
 }
 
@@ -131,6 +149,11 @@ func (h *Handler) ListSchedules(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	loc, ok := h.displayLocation(w, r)
+	if !ok {
+		return
+	}
+
 	var req schedule.ListSchedulesRequest
 
 	if userID := r.URL.Query().Get("user_id"); userID != "" {
@@ -154,6 +177,9 @@ func (h *Handler) ListSchedules(w http.ResponseWriter, r *http.Request) {
 		h.errorResponse(w, "Internal server error", http.StatusInternalServerError)
 		return
 	}
+	for _, s := range result {
+		s.In(loc)
+	}
 
 	h.jsonResponse(w, result, http.StatusOK)
 }
@@ -187,6 +213,21 @@ func (h *Handler) CheckAccess(w http.ResponseWriter, r *http.Request) {
 	h.jsonResponse(w, result, http.StatusOK)
 }
 
+// displayLocation resolves the timezone times are returned in from the tz
+// query parameter, UTC by default
+func (h *Handler) displayLocation(w http.ResponseWriter, r *http.Request) (*time.Location, bool) {
+	tz := r.URL.Query().Get("tz")
+	if tz == "" {
+		return time.UTC, true
+	}
+	loc, err := time.LoadLocation(tz)
+	if err != nil {
+		h.errorResponse(w, "Invalid tz", http.StatusBadRequest)
+		return nil, false
+	}
+	return loc, true
+}
+
 func (h *Handler) jsonResponse(w http.ResponseWriter, data interface{}, status int) {
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(status)
@@ -3,6 +3,8 @@ package schedule
 import (
 	"fmt"
 	"time"
+
+	"github.com/VanCannon/openpam/pkg/types"
 )
 
 // ApproveSchedule approves a pending schedule request
@@ -14,7 +16,7 @@ func (s *Service) ApproveSchedule(scheduleID, approvedBy string, modifyStartTime
 	}
 
 	// Verify schedule is pending approval
-	if schedule.ApprovalStatus != "pending" {
+	if schedule.ApprovalStatus != types.ApprovalStatusPending {
 		return nil, fmt.Errorf("schedule %s is not pending approval (current status: %s)", scheduleID, schedule.ApprovalStatus)
 	}
 
@@ -22,14 +24,14 @@ func (s *Service) ApproveSchedule(scheduleID, approvedBy string, modifyStartTime
 	startTime := schedule.StartTime
 	endTime := schedule.EndTime
 	if modifyStartTime != nil {
-		startTime = *modifyStartTime
+		startTime = modifyStartTime.UTC()
 	}
 	if modifyEndTime != nil {
-		endTime = *modifyEndTime
+		endTime = modifyEndTime.UTC()
 	}
 
 	// Update schedule
-	now := time.Now()
+	now := time.Now().UTC()
 	query := `
 		UPDATE schedules
 		SET approval_status = 'approved',
@@ -66,12 +68,12 @@ func (s *Service) RejectSchedule(scheduleID, rejectedBy, reason string) error {
 	}
 
 	// Verify schedule is pending approval
-	if schedule.ApprovalStatus != "pending" {
+	if schedule.ApprovalStatus != types.ApprovalStatusPending {
 		return fmt.Errorf("schedule %s is not pending approval (current status: %s)", scheduleID, schedule.ApprovalStatus)
 	}
 
 	// Update schedule
-	now := time.Now()
+	now := time.Now().UTC()
 	query := `
 		UPDATE schedules
 		SET approval_status = 'rejected',
@@ -2,26 +2,12 @@ package schedule
 
 import (
 	"time"
+
+	"github.com/VanCannon/openpam/pkg/types"
 )
 
-type Schedule struct {
-	ID              string                 `json:"id"`
-	UserID          string                 `json:"user_id"`
-	TargetID        string                 `json:"target_id"`
-	StartTime       time.Time              `json:"start_time"`
-	EndTime         time.Time              `json:"end_time"`
-	RecurrenceRule  *string                `json:"recurrence_rule,omitempty"`
-	Timezone        string                 `json:"timezone"`
-	Status          string                 `json:"status"`
-	ApprovalStatus  string                 `json:"approval_status"`
-	RejectionReason *string                `json:"rejection_reason,omitempty"`
-	ApprovedBy      *string                `json:"approved_by,omitempty"`
-	ApprovedAt      *time.Time             `json:"approved_at,omitempty"`
-	CreatedBy       *string                `json:"created_by,omitempty"`
-	CreatedAt       time.Time              `json:"created_at"`
-	UpdatedAt       time.Time              `json:"updated_at"`
-	Metadata        map[string]interface{} `json:"metadata,omitempty"`
-}
+// Schedule is the shared schedule representation
+type Schedule = types.Schedule
 
 type CreateScheduleRequest struct {
 	UserID         string                 `json:"user_id"`
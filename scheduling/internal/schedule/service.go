@@ -3,13 +3,18 @@ package schedule
 import (
 	"database/sql"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"time"
 
 	"github.com/google/uuid"
-	"github.com/VanCannon/openpam/scheduling/pkg/logger"
+	"github.com/VanCannon/openpam/pkg/logger"
+	"github.com/VanCannon/openpam/pkg/types"
 )
 
+// ErrInvalidTimezone is returned for a timezone missing from the tz database
+var ErrInvalidTimezone = errors.New("invalid timezone")
+
 type Service struct {
 	db     *sql.DB
 	logger *logger.Logger
@@ -23,18 +28,27 @@ func NewService(db *sql.DB, log *logger.Logger) *Service {
 }
 
 func (s *Service) CreateSchedule(req *CreateScheduleRequest, createdBy string) (*Schedule, error) {
+	// Times are stored in UTC; the timezone says where recurring windows repeat
+	if req.Timezone == "" {
+		req.Timezone = "UTC"
+	}
+	if _, err := time.LoadLocation(req.Timezone); err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidTimezone, req.Timezone)
+	}
+
+	now := time.Now().UTC()
 	schedule := &Schedule{
 		ID:             uuid.New().String(),
 		UserID:         req.UserID,
 		TargetID:       req.TargetID,
-		StartTime:      req.StartTime,
-		EndTime:        req.EndTime,
+		StartTime:      req.StartTime.UTC(),
+		EndTime:        req.EndTime.UTC(),
 		RecurrenceRule: req.RecurrenceRule,
 		Timezone:       req.Timezone,
-		Status:         "pending",
-		ApprovalStatus: "pending", // All new schedules start as pending approval
-		CreatedAt:      time.Now(),
-		UpdatedAt:      time.Now(),
+		Status:         types.ScheduleStatusPending,
+		ApprovalStatus: types.ApprovalStatusPending, // All new schedules start as pending approval
+		CreatedAt:      now,
+		UpdatedAt:      now,
 		Metadata:       req.Metadata,
 	}
 
@@ -125,10 +139,10 @@ func (s *Service) UpdateSchedule(id string, req *UpdateScheduleRequest) (*Schedu
 	}
 
 	if req.StartTime != nil {
-		schedule.StartTime = *req.StartTime
+		schedule.StartTime = req.StartTime.UTC()
 	}
 	if req.EndTime != nil {
-		schedule.EndTime = *req.EndTime
+		schedule.EndTime = req.EndTime.UTC()
 	}
 	if req.RecurrenceRule != nil {
 		schedule.RecurrenceRule = req.RecurrenceRule
@@ -140,7 +154,7 @@ func (s *Service) UpdateSchedule(id string, req *UpdateScheduleRequest) (*Schedu
 		schedule.Metadata = req.Metadata
 	}
 
-	schedule.UpdatedAt = time.Now()
+	schedule.UpdatedAt = time.Now().UTC()
 
 	metadataJSON, _ := json.Marshal(schedule.Metadata)
 
@@ -288,7 +302,7 @@ func (s *Service) ListSchedules(req *ListSchedulesRequest) ([]*Schedule, error)
 }
 
 func (s *Service) CheckAccess(userID, targetID string) (*ScheduleCheckResponse, error) {
-	now := time.Now()
+	now := time.Now().UTC()
 
 	query := `
 		SELECT id, user_id, target_id, start_time, end_time, recurrence_rule,
@@ -340,7 +354,7 @@ func (s *Service) CheckAccess(userID, targetID string) (*ScheduleCheckResponse,
 }
 
 func (s *Service) GetUpcomingSchedules(window time.Duration) ([]*Schedule, error) {
-	now := time.Now()
+	now := time.Now().UTC()
 	future := now.Add(window)
 
 	query := `
@@ -390,7 +404,7 @@ func (s *Service) GetUpcomingSchedules(window time.Duration) ([]*Schedule, error
 }
 
 func (s *Service) UpdateScheduleStatuses() error {
-	now := time.Now()
+	now := time.Now().UTC()
 
 	// Activate pending schedules that have started AND are approved
 	activateQuery := `
@@ -13,6 +13,12 @@ export default function AuditLogsPage() {
   const [auditLogs, setAuditLogs] = useState<SystemAuditLog[]>([])
   const [loadingLogs, setLoadingLogs] = useState(true)
   const [filter, setFilter] = useState<string>('all')
+  // Set when opened from an elevation, to review what was done with it
+  const [elevationId, setElevationId] = useState<string | null>(null)
+
+  useEffect(() => {
+    setElevationId(new URLSearchParams(window.location.search).get('elevation_id'))
+  }, [])
 
   useEffect(() => {
     if (!loading && (!user || user.role.toLowerCase() !== 'admin')) {
@@ -24,12 +30,12 @@ export default function AuditLogsPage() {
     if (user) {
       loadAuditLogs()
     }
-  }, [user, filter])
+  }, [user, filter, elevationId])
 
   const loadAuditLogs = async () => {
     try {
       setLoadingLogs(true)
-      const params = filter !== 'all' ? { event_type: filter } : {}
+      const params = elevationId ? { elevation_id: elevationId } : filter !== 'all' ? { event_type: filter } : {}
       const response = await api.listSystemAuditLogs(params)
       setAuditLogs(response.logs || [])
     } catch (error) {
@@ -95,7 +101,9 @@ export default function AuditLogsPage() {
         <div className="mb-6 flex justify-between items-center">
           <div>
             <h1 className="text-2xl font-bold text-gray-900">Audit Logs</h1>
-            <p className="text-sm text-gray-600 mt-1">System events and activity logs</p>
+            <p className="text-sm text-gray-600 mt-1">
+              {elevationId ? `Events recorded under role elevation ${elevationId}` : 'System events and activity logs'}
+            </p>
           </div>
 
           <div className="flex gap-2">
@@ -150,6 +158,9 @@ export default function AuditLogsPage() {
                       </td>
                       <td className="px-6 py-4 whitespace-nowrap">
                         {getEventTypeBadge(log.event_type)}
+                        {log.elevation_id && (
+                          <span className="ml-2 px-2 py-1 text-xs font-semibold rounded bg-purple-100 text-purple-800">Elevated</span>
+                        )}
                       </td>
                       <td className="px-6 py-4 whitespace-nowrap text-sm text-gray-500">
                         {log.user_id || '-'}
@@ -18,6 +18,7 @@ export default function CredentialsPage() {
   const [showModal, setShowModal] = useState(false)
   const [selectedTargetId, setSelectedTargetId] = useState('')
   const [editingId, setEditingId] = useState<string | null>(null)
+  const [editingVersion, setEditingVersion] = useState<number | null>(null)
   const [formData, setFormData] = useState({
     target_id: '',
     username: '',
@@ -72,6 +73,7 @@ export default function CredentialsPage() {
 
   const handleEdit = (cred: Credential) => {
     setEditingId(cred.id)
+    setEditingVersion(cred.version)
     setFormData({
       target_id: cred.target_id,
       username: cred.username,
@@ -96,7 +98,7 @@ export default function CredentialsPage() {
     e.preventDefault()
     try {
       if (editingId) {
-        await api.updateCredential(editingId, formData)
+        await api.updateCredential(editingId, { ...formData, version: editingVersion ?? undefined })
       } else {
         await api.createCredential(formData)
       }
@@ -188,7 +190,12 @@ export default function CredentialsPage() {
                     {credentials.map((cred) => (
                       <tr key={cred.id}>
                         <td className="px-6 py-4 whitespace-nowrap text-sm font-medium text-gray-900">{cred.username}</td>
-                        <td className="px-6 py-4 text-sm text-gray-500">{cred.description || '-'}</td>
+                        <td className="px-6 py-4 text-sm text-gray-500">
+                          {cred.description || '-'}
+                          {cred.quarantined_at && (
+                            <span className="ml-2 px-2 py-0.5 text-xs rounded bg-red-100 text-red-800">Quarantined</span>
+                          )}
+                        </td>
                         <td className="px-6 py-4 whitespace-nowrap text-sm space-x-3">
                           <button
                             onClick={() => handleEdit(cred)}
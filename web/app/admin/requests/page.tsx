@@ -74,7 +74,7 @@ export default function ScheduleRequestsPage() {
 
         try {
             setProcessing(true)
-            const body: any = { schedule_id: selectedSchedule.id }
+            const body: any = { schedule_id: selectedSchedule.id, version: selectedSchedule.version }
             if (modifyStartTime) body.start_time = new Date(modifyStartTime).toISOString()
             if (modifyEndTime) body.end_time = new Date(modifyEndTime).toISOString()
 
@@ -92,7 +92,8 @@ export default function ScheduleRequestsPage() {
                 fetchSchedules()
             } else {
                 const error = await response.json()
-                alert(error.message || 'Failed to approve schedule')
+                alert(error.message || error.error || 'Failed to approve schedule')
+                if (response.status === 409) fetchSchedules()
             }
         } catch (error) {
             console.error('Failed to approve schedule:', error)
@@ -113,7 +114,8 @@ export default function ScheduleRequestsPage() {
                 credentials: 'include',
                 body: JSON.stringify({
                     schedule_id: selectedSchedule.id,
-                    reason: rejectionReason
+                    reason: rejectionReason,
+                    version: selectedSchedule.version
                 })
             })
 
@@ -123,7 +125,8 @@ export default function ScheduleRequestsPage() {
                 fetchSchedules()
             } else {
                 const error = await response.json()
-                alert(error.message || 'Failed to reject schedule')
+                alert(error.message || error.error || 'Failed to reject schedule')
+                if (response.status === 409) fetchSchedules()
             }
         } catch (error) {
             console.error('Failed to reject schedule:', error)
@@ -2,7 +2,7 @@
 
 import { useAuth } from '@/lib/auth-context'
 import { api } from '@/lib/api'
-import { Target, Zone } from '@/types'
+import { Fingerprint, Target, Zone } from '@/types'
 import { useRouter } from 'next/navigation'
 import { useEffect, useState } from 'react'
 import Link from 'next/link'
@@ -21,8 +21,10 @@ export default function TargetsPage() {
     hostname: '',
     protocol: 'ssh' as 'ssh' | 'rdp',
     port: 22,
-    description: '',
+    connection_notes: '',
   })
+  const [fingerprint, setFingerprint] = useState<Fingerprint | null>(null)
+  const [probing, setProbing] = useState(false)
 
   useEffect(() => {
     if (!loading && (!user || user.role.toLowerCase() !== 'admin')) {
@@ -58,12 +60,33 @@ export default function TargetsPage() {
     }
   }
 
+  // Fingerprint the host and fill in the protocol and port it suggests
+  const handleDetect = async () => {
+    if (!formData.hostname) return
+    try {
+      setProbing(true)
+      const fp = await api.probeHost(formData.hostname)
+      setFingerprint(fp)
+      if (fp.suggested_protocol && fp.suggested_port) {
+        setFormData({ ...formData, protocol: fp.suggested_protocol, port: fp.suggested_port })
+      }
+    } catch (error) {
+      console.error('Failed to fingerprint host:', error)
+      alert('Failed to fingerprint host')
+    } finally {
+      setProbing(false)
+    }
+  }
+
   const handleSubmit = async (e: React.FormEvent) => {
     e.preventDefault()
     try {
-      await api.createTarget(formData)
+      // Label the target with the detected OS family
+      const labels = fingerprint?.os_family ? { os: fingerprint.os_family } : undefined
+      await api.createTarget({ ...formData, labels })
       setShowModal(false)
-      setFormData({ zone_id: '', name: '', hostname: '', protocol: 'ssh', port: 22, description: '' })
+      setFingerprint(null)
+      setFormData({ zone_id: '', name: '', hostname: '', protocol: 'ssh', port: 22, connection_notes: '' })
       loadTargets()
     } catch (error) {
       console.error('Failed to create target:', error)
@@ -98,7 +121,7 @@ export default function TargetsPage() {
             <p className="text-sm text-gray-600 mt-1">Manage SSH and RDP targets</p>
           </div>
           <button
-            onClick={() => setShowModal(true)}
+            onClick={() => { setFingerprint(null); setShowModal(true) }}
             className="px-4 py-2 bg-blue-600 text-white rounded-md hover:bg-blue-700"
           >
             Create Target
@@ -188,13 +211,36 @@ export default function TargetsPage() {
                 </div>
                 <div>
                   <label className="block text-sm font-medium text-gray-700 mb-1">Hostname</label>
-                  <input
-                    type="text"
-                    required
-                    value={formData.hostname}
-                    onChange={(e) => setFormData({ ...formData, hostname: e.target.value })}
-                    className="w-full px-3 py-2 border border-gray-300 rounded-md"
-                  />
+                  <div className="flex gap-2">
+                    <input
+                      type="text"
+                      required
+                      value={formData.hostname}
+                      onChange={(e) => {
+                        setFormData({ ...formData, hostname: e.target.value })
+                        setFingerprint(null)
+                      }}
+                      className="w-full px-3 py-2 border border-gray-300 rounded-md"
+                    />
+                    <button
+                      type="button"
+                      onClick={handleDetect}
+                      disabled={!formData.hostname || probing}
+                      className="px-3 py-2 text-sm border border-gray-300 rounded-md hover:bg-gray-50 disabled:opacity-50"
+                    >
+                      {probing ? 'Detecting...' : 'Detect'}
+                    </button>
+                  </div>
+                  {fingerprint && (
+                    <p className="mt-1 text-xs text-gray-500">
+                      {fingerprint.services.length === 0
+                        ? 'No open ports found'
+                        : fingerprint.services
+                          .map((s) => `${s.port}${s.protocol ? ` ${s.protocol.toUpperCase()}` : ''}${s.product ? ` (${s.product} ${s.version ?? ''})` : ''}`)
+                          .join(', ')}
+                      {fingerprint.os && ` · ${fingerprint.os}${fingerprint.os_version ? ` ${fingerprint.os_version}` : ''}`}
+                    </p>
+                  )}
                 </div>
                 <div>
                   <label className="block text-sm font-medium text-gray-700 mb-1">Protocol</label>
@@ -224,10 +270,10 @@ export default function TargetsPage() {
                   />
                 </div>
                 <div>
-                  <label className="block text-sm font-medium text-gray-700 mb-1">Description</label>
+                  <label className="block text-sm font-medium text-gray-700 mb-1">Connection Notes</label>
                   <textarea
-                    value={formData.description}
-                    onChange={(e) => setFormData({ ...formData, description: e.target.value })}
+                    value={formData.connection_notes}
+                    onChange={(e) => setFormData({ ...formData, connection_notes: e.target.value })}
                     className="w-full px-3 py-2 border border-gray-300 rounded-md"
                     rows={3}
                   />
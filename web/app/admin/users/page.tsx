@@ -12,6 +12,7 @@ interface User {
   enabled: boolean
   role: string
   source: string
+  version: number
   created_at?: string
   last_login_at?: string
 }
@@ -88,36 +89,43 @@ export default function UsersManagementPage() {
     }
   }
 
-  const handleUpdateRole = async (userId: string, newRole: string) => {
+  const handleUpdateRole = async (userId: string, version: number, newRole: string) => {
     try {
       // TODO: Replace with actual API call
       const response = await fetch(`/api/v1/users/${userId}/role`, {
         method: 'PUT',
         headers: { 'Content-Type': 'application/json' },
         credentials: 'include',
-        body: JSON.stringify({ role: newRole })
+        body: JSON.stringify({ role: newRole, version })
       })
 
       if (response.ok) {
         fetchUsers()
         setShowEditModal(false)
+      } else if (response.status === 409) {
+        alert('This user was changed by someone else. The list has been refreshed.')
+        fetchUsers()
+        setShowEditModal(false)
       }
     } catch (error) {
       console.error('Failed to update user role:', error)
     }
   }
 
-  const handleToggleEnabled = async (userId: string, enabled: boolean) => {
+  const handleToggleEnabled = async (userId: string, version: number, enabled: boolean) => {
     try {
       const response = await fetch(`/api/v1/users/${userId}/enabled`, {
         method: 'PUT',
         headers: { 'Content-Type': 'application/json' },
         credentials: 'include',
-        body: JSON.stringify({ enabled })
+        body: JSON.stringify({ enabled, version })
       })
 
       if (response.ok) {
         fetchUsers()
+      } else if (response.status === 409) {
+        alert('This user was changed by someone else. The list has been refreshed.')
+        fetchUsers()
       }
     } catch (error) {
       console.error('Failed to update user status:', error)
@@ -272,7 +280,7 @@ export default function UsersManagementPage() {
                       </td>
                       <td className="px-6 py-4 whitespace-nowrap">
                         <button
-                          onClick={() => handleToggleEnabled(u.id, !u.enabled)}
+                          onClick={() => handleToggleEnabled(u.id, u.version, !u.enabled)}
                           className={`px-2 inline-flex text-xs leading-5 font-semibold rounded-full ${u.enabled
                             ? 'bg-green-100 text-green-800 dark:bg-green-900 dark:text-green-200'
                             : 'bg-red-100 text-red-800 dark:bg-red-900 dark:text-red-200'
@@ -414,7 +422,7 @@ export default function UsersManagementPage() {
               {['admin', 'user', 'auditor'].map((role) => (
                 <button
                   key={role}
-                  onClick={() => handleUpdateRole(selectedUser.id, role)}
+                  onClick={() => handleUpdateRole(selectedUser.id, selectedUser.version, role)}
                   className={`w-full px-4 py-3 rounded-lg text-left transition-colors ${selectedUser.role === role
                     ? 'bg-indigo-600 text-white'
                     : 'bg-gray-100 dark:bg-gray-700 text-gray-900 dark:text-white hover:bg-gray-200 dark:hover:bg-gray-600'
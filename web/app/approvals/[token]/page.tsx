@@ -0,0 +1,191 @@
+'use client'
+
+import { useEffect, useState, Suspense } from 'react'
+import { useParams, useSearchParams } from 'next/navigation'
+import { api } from '@/lib/api'
+import { ApprovalLink } from '@/types/schedule'
+
+// Errors from the gateway are JSON bodies; fall back to the raw text otherwise
+function parseError(error: unknown): { message: string; stepUpRequired: boolean } {
+    const text = error instanceof Error ? error.message : String(error)
+    try {
+        const body = JSON.parse(text)
+        return { message: body.message || text, stepUpRequired: !!body.step_up_required }
+    } catch {
+        return { message: text, stepUpRequired: false }
+    }
+}
+
+function ApprovalContent() {
+    const params = useParams<{ token: string }>()
+    const searchParams = useSearchParams()
+    const token = params.token
+    const [link, setLink] = useState<ApprovalLink | null>(null)
+    const [loading, setLoading] = useState(true)
+    const [error, setError] = useState('')
+    const [decision, setDecision] = useState<'approve' | 'reject'>(
+        searchParams.get('action') === 'reject' ? 'reject' : 'approve'
+    )
+    const [reason, setReason] = useState('')
+    const [processing, setProcessing] = useState(false)
+    const [result, setResult] = useState('')
+
+    useEffect(() => {
+        // Opening the page never decides anything, so link scanners can't approve requests
+        api.getApproval(token)
+            .then(setLink)
+            .catch((err) => setError(parseError(err).message))
+            .finally(() => setLoading(false))
+    }, [token])
+
+    const signIn = () => {
+        // Come back to this link once signed in
+        sessionStorage.setItem('openpam_return_to', window.location.pathname + window.location.search)
+        api.login()
+    }
+
+    const handleDecide = async () => {
+        try {
+            setProcessing(true)
+            setError('')
+            const response = await api.decideApproval(token, decision, decision === 'reject' ? reason : undefined)
+            setResult(response.message)
+        } catch (err) {
+            const { message, stepUpRequired } = parseError(err)
+            if (stepUpRequired) {
+                signIn()
+                return
+            }
+            setError(message)
+        } finally {
+            setProcessing(false)
+        }
+    }
+
+    const formatDate = (dateString: string) => new Date(dateString).toLocaleString()
+
+    if (loading) {
+        return (
+            <div className="flex min-h-screen items-center justify-center">
+                <div className="animate-spin rounded-full h-12 w-12 border-b-2 border-indigo-600"></div>
+            </div>
+        )
+    }
+
+    return (
+        <div className="min-h-screen bg-gray-50 dark:bg-gray-900 flex items-center justify-center px-4">
+            <div className="bg-white dark:bg-gray-800 shadow-md rounded-lg p-6 max-w-md w-full">
+                <h1 className="text-xl font-bold text-gray-900 dark:text-white mb-4">
+                    Access Request
+                </h1>
+
+                {error && (
+                    <div className="mb-4 p-3 rounded-lg bg-red-50 text-red-800 dark:bg-red-900 dark:text-red-200 text-sm">
+                        {error}
+                    </div>
+                )}
+
+                {result && (
+                    <div className="p-3 rounded-lg bg-green-50 text-green-800 dark:bg-green-900 dark:text-green-200 text-sm">
+                        {result}
+                    </div>
+                )}
+
+                {link && !result && (
+                    <>
+                        <dl className="mb-4 space-y-2 text-sm">
+                            <div>
+                                <dt className="text-gray-500 dark:text-gray-400">Requested by</dt>
+                                <dd className="text-gray-900 dark:text-white">
+                                    {link.requester ? `${link.requester.display_name} (${link.requester.email})` : link.schedule.user_id}
+                                </dd>
+                            </div>
+                            <div>
+                                <dt className="text-gray-500 dark:text-gray-400">Target</dt>
+                                <dd className="text-gray-900 dark:text-white">
+                                    {link.target ? `${link.target.name} (${link.target.hostname}, ${link.target.protocol.toUpperCase()})` : link.schedule.target_id}
+                                </dd>
+                            </div>
+                            <div>
+                                <dt className="text-gray-500 dark:text-gray-400">Time</dt>
+                                <dd className="text-gray-900 dark:text-white">
+                                    {formatDate(link.schedule.start_time)} to {formatDate(link.schedule.end_time)}
+                                </dd>
+                            </div>
+                            <div>
+                                <dt className="text-gray-500 dark:text-gray-400">Link</dt>
+                                <dd className="text-gray-900 dark:text-white">
+                                    Sent by {link.channel} to {link.approver?.email}, expires {formatDate(link.expires_at)}
+                                </dd>
+                            </div>
+                        </dl>
+
+                        {link.schedule.approval_status !== 'pending' ? (
+                            <p className="text-sm text-gray-700 dark:text-gray-300">
+                                This request has already been {link.schedule.approval_status}.
+                            </p>
+                        ) : (
+                            <>
+                                <div className="flex space-x-3 mb-4">
+                                    <button
+                                        onClick={() => setDecision('approve')}
+                                        className={`flex-1 px-4 py-2 rounded-lg ${decision === 'approve' ? 'bg-green-600 text-white' : 'text-gray-700 dark:text-gray-300 hover:bg-gray-100 dark:hover:bg-gray-700'}`}
+                                    >
+                                        Approve
+                                    </button>
+                                    <button
+                                        onClick={() => setDecision('reject')}
+                                        className={`flex-1 px-4 py-2 rounded-lg ${decision === 'reject' ? 'bg-red-600 text-white' : 'text-gray-700 dark:text-gray-300 hover:bg-gray-100 dark:hover:bg-gray-700'}`}
+                                    >
+                                        Reject
+                                    </button>
+                                </div>
+
+                                {decision === 'reject' && (
+                                    <div className="mb-4">
+                                        <label className="block text-sm font-medium text-gray-700 dark:text-gray-300 mb-1">
+                                            Reason for Rejection
+                                        </label>
+                                        <textarea
+                                            value={reason}
+                                            onChange={(e) => setReason(e.target.value)}
+                                            placeholder="Please provide a reason..."
+                                            rows={4}
+                                            className="w-full px-3 py-2 border border-gray-300 dark:border-gray-600 rounded-lg bg-white dark:bg-gray-700 text-gray-900 dark:text-white"
+                                        />
+                                    </div>
+                                )}
+
+                                {link.step_up_required && (
+                                    <p className="mb-4 text-xs text-gray-500 dark:text-gray-400">
+                                        You will be asked to sign in as {link.approver?.email} to confirm.
+                                    </p>
+                                )}
+
+                                <button
+                                    onClick={handleDecide}
+                                    disabled={processing || (decision === 'reject' && !reason.trim())}
+                                    className={`w-full px-4 py-2 text-white rounded-lg disabled:opacity-50 ${decision === 'approve' ? 'bg-green-600 hover:bg-green-700' : 'bg-red-600 hover:bg-red-700'}`}
+                                >
+                                    {processing ? 'Submitting...' : decision === 'approve' ? 'Confirm Approval' : 'Confirm Rejection'}
+                                </button>
+                            </>
+                        )}
+                    </>
+                )}
+            </div>
+        </div>
+    )
+}
+
+export default function ApprovalPage() {
+    return (
+        <Suspense fallback={
+            <div className="flex min-h-screen items-center justify-center">
+                <div className="animate-spin rounded-full h-12 w-12 border-b-2 border-indigo-600"></div>
+            </div>
+        }>
+            <ApprovalContent />
+        </Suspense>
+    )
+}
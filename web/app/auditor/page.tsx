@@ -5,7 +5,7 @@ import { useAuth } from '@/lib/auth-context'
 import { useRouter } from 'next/navigation'
 import { AuditLog, User, Target, Credential } from '@/types'
 import Header from '@/components/header'
-import { api } from '@/lib/api'
+import { api, CLOSE_SERVICE_RESTART, parseCloseReason, withReconnectToken } from '@/lib/api'
 import type { Terminal as XTerm } from '@xterm/xterm'
 import type { FitAddon } from '@xterm/addon-fit'
 import '@xterm/xterm/css/xterm.css'
@@ -51,8 +51,9 @@ export default function AuditorPage() {
     useEffect(() => {
         if (user && (user.role === 'auditor' || user.role === 'admin')) {
             fetchSessions()
-            const interval = setInterval(fetchSessions, 5000) // Refresh every 5 seconds
-            return () => clearInterval(interval)
+            // Refresh when a session starts or ends instead of polling
+            const source = api.streamEvents(['audit.*'], () => fetchSessions())
+            return () => source.close()
         }
     }, [user, filter])
 
@@ -331,11 +332,15 @@ export default function AuditorPage() {
         }
     }
 
-    const connectLiveMonitor = async (term: XTerm, sessionId: string) => {
+    const connectLiveMonitor = async (term: XTerm, sessionId: string, reconnectToken?: string) => {
         const wsUrl = process.env.NEXT_PUBLIC_WS_URL || 'ws://localhost:8080'
         const token = localStorage.getItem('openpam_token')
 
-        const ws = new WebSocket(`${wsUrl}/api/ws/monitor/${sessionId}`)
+        let url = `${wsUrl}/api/ws/monitor/${sessionId}`
+        if (reconnectToken) {
+            url = withReconnectToken(url, reconnectToken)
+        }
+        const ws = new WebSocket(url)
         wsRef.current = ws
 
         ws.onopen = () => {
@@ -363,8 +368,19 @@ export default function AuditorPage() {
             term.write('\r\n\r\n[Connection error]\r\n')
         }
 
-        ws.onclose = () => {
+        ws.onclose = (event) => {
             console.log('Live monitor disconnected')
+            const reason = parseCloseReason(event)
+            if (event.code === CLOSE_SERVICE_RESTART && reason?.token && wsRef.current === ws) {
+                const resumeToken = reason.token
+                term.write('\r\n\r\n[Gateway restarting, reconnecting...]\r\n')
+                setTimeout(() => {
+                    if (wsRef.current === ws) {
+                        connectLiveMonitor(term, sessionId, resumeToken)
+                    }
+                }, 2000)
+                return
+            }
             term.write('\r\n\r\n[Session ended]\r\n')
         }
     }
@@ -40,8 +40,10 @@ function AuthCallbackContent() {
         // Update auth context
         await setToken(finalToken)
 
-        // Redirect to dashboard
-        router.push('/dashboard')
+        // Return to the page that asked for a sign-in, such as an approval link
+        const returnTo = sessionStorage.getItem('openpam_return_to')
+        sessionStorage.removeItem('openpam_return_to')
+        router.push(returnTo?.startsWith('/') && !returnTo.startsWith('//') ? returnTo : '/dashboard')
       } else {
         console.error('No token found in callback')
         router.push('/login')
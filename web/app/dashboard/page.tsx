@@ -137,8 +137,11 @@ export default function DashboardPage() {
                   </span>
                 </div>
                 <p className="text-sm text-gray-600 mb-2">{target.hostname}:{target.port}</p>
-                {target.description && (
-                  <p className="text-sm text-gray-500">{target.description}</p>
+                {target.environment && (
+                  <p className="text-xs text-gray-500 mb-1">{target.environment}{target.owner_team && ` · ${target.owner_team}`}</p>
+                )}
+                {target.connection_notes && (
+                  <p className="text-sm text-gray-500 whitespace-pre-wrap">{target.connection_notes}</p>
                 )}
               </div>
             ))}
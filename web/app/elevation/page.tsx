@@ -0,0 +1,278 @@
+'use client'
+
+import { useEffect, useState } from 'react'
+import { useAuth } from '@/lib/auth-context'
+import { useRouter } from 'next/navigation'
+import { RoleElevation } from '@/types'
+import Header from '@/components/header'
+import { api } from '@/lib/api'
+
+export default function ElevationPage() {
+    const { user, loading, refreshUser } = useAuth()
+    const router = useRouter()
+    const [elevations, setElevations] = useState<RoleElevation[]>([])
+    const [loadingElevations, setLoadingElevations] = useState(true)
+    const [role, setRole] = useState<'admin' | 'auditor'>('admin')
+    const [hours, setHours] = useState(1)
+    const [justification, setJustification] = useState('')
+    const [requesting, setRequesting] = useState(false)
+    const [rejecting, setRejecting] = useState<RoleElevation | null>(null)
+    const [rejectionReason, setRejectionReason] = useState('')
+    const [processing, setProcessing] = useState(false)
+
+    // Admins decide requests; their own role is what they hold without an elevation
+    const isAdmin = user?.role.toLowerCase() === 'admin'
+    const isStandingAdmin = isAdmin && !user?.elevation
+
+    useEffect(() => {
+        if (!loading && !user) {
+            router.push('/login')
+        }
+    }, [user, loading, router])
+
+    useEffect(() => {
+        if (user) {
+            fetchElevations()
+        }
+    }, [user])
+
+    const fetchElevations = async () => {
+        try {
+            setLoadingElevations(true)
+            const data = await api.listElevations()
+            setElevations(data.elevations || [])
+        } catch (error) {
+            console.error('Failed to fetch elevations:', error)
+        } finally {
+            setLoadingElevations(false)
+        }
+    }
+
+    const handleRequest = async (e: React.FormEvent) => {
+        e.preventDefault()
+        try {
+            setRequesting(true)
+            await api.requestElevation(role, hours, justification)
+            setJustification('')
+            await refreshUser()
+            fetchElevations()
+        } catch (error) {
+            alert(error instanceof Error ? error.message : 'Failed to request elevation')
+        } finally {
+            setRequesting(false)
+        }
+    }
+
+    const handleDecide = async (elevation: RoleElevation, decision: 'approve' | 'reject') => {
+        try {
+            setProcessing(true)
+            await api.decideElevation(elevation.id, decision, decision === 'reject' ? rejectionReason : undefined)
+            setRejecting(null)
+            setRejectionReason('')
+            fetchElevations()
+        } catch (error) {
+            alert(error instanceof Error ? error.message : 'Failed to decide elevation')
+        } finally {
+            setProcessing(false)
+        }
+    }
+
+    const handleRevoke = async (elevation: RoleElevation) => {
+        if (!confirm('End this elevation now?')) return
+        try {
+            await api.revokeElevation(elevation.id)
+            await refreshUser()
+            fetchElevations()
+        } catch (error) {
+            alert(error instanceof Error ? error.message : 'Failed to revoke elevation')
+        }
+    }
+
+    const formatDate = (dateString?: string) => dateString ? new Date(dateString).toLocaleString() : '-'
+
+    const getStatusBadge = (status: RoleElevation['status']) => {
+        const colors: Record<RoleElevation['status'], string> = {
+            pending: 'bg-yellow-100 text-yellow-800',
+            active: 'bg-green-100 text-green-800',
+            rejected: 'bg-red-100 text-red-800',
+            expired: 'bg-gray-100 text-gray-800',
+            revoked: 'bg-gray-100 text-gray-800',
+        }
+        return <span className={`px-2 py-1 text-xs font-semibold rounded-full capitalize ${colors[status]}`}>{status}</span>
+    }
+
+    if (loading || !user) {
+        return (
+            <div className="flex min-h-screen items-center justify-center">
+                <div className="animate-spin rounded-full h-12 w-12 border-b-2 border-indigo-600"></div>
+            </div>
+        )
+    }
+
+    const hasOpen = elevations.some(e => e.user_id === user.id && (e.status === 'pending' || e.status === 'active'))
+
+    return (
+        <div className="min-h-screen bg-gray-50">
+            <Header />
+
+            <main className="max-w-7xl mx-auto py-6 sm:px-6 lg:px-8">
+                <div className="px-4 py-6 sm:px-0">
+                    <h1 className="text-3xl font-bold text-gray-900 mb-6">Role Elevation</h1>
+
+                    {!isStandingAdmin && !hasOpen && (
+                        <form onSubmit={handleRequest} className="bg-white shadow-md rounded-lg p-6 mb-6 space-y-4">
+                            <h2 className="text-lg font-semibold text-gray-900">Request a temporary role</h2>
+                            <div className="flex space-x-4">
+                                <div>
+                                    <label className="block text-sm font-medium text-gray-700 mb-1">Role</label>
+                                    <select
+                                        value={role}
+                                        onChange={(e) => setRole(e.target.value as 'admin' | 'auditor')}
+                                        className="px-3 py-2 border border-gray-300 rounded-lg"
+                                    >
+                                        <option value="admin">Admin</option>
+                                        {user.role.toLowerCase() === 'user' && <option value="auditor">Auditor</option>}
+                                    </select>
+                                </div>
+                                <div>
+                                    <label className="block text-sm font-medium text-gray-700 mb-1">Hours</label>
+                                    <input
+                                        type="number"
+                                        min={1}
+                                        value={hours}
+                                        onChange={(e) => setHours(parseInt(e.target.value) || 1)}
+                                        className="w-24 px-3 py-2 border border-gray-300 rounded-lg"
+                                    />
+                                </div>
+                            </div>
+                            <div>
+                                <label className="block text-sm font-medium text-gray-700 mb-1">Justification</label>
+                                <textarea
+                                    value={justification}
+                                    onChange={(e) => setJustification(e.target.value)}
+                                    placeholder="Why do you need this role? Include a ticket number if there is one."
+                                    rows={3}
+                                    className="w-full px-3 py-2 border border-gray-300 rounded-lg"
+                                />
+                            </div>
+                            <button
+                                type="submit"
+                                disabled={requesting || !justification.trim()}
+                                className="px-4 py-2 bg-blue-600 text-white rounded-lg hover:bg-blue-700 disabled:opacity-50"
+                            >
+                                {requesting ? 'Requesting...' : 'Request Elevation'}
+                            </button>
+                        </form>
+                    )}
+
+                    <div className="bg-white shadow-md rounded-lg overflow-hidden">
+                        {loadingElevations ? (
+                            <div className="p-6 text-center text-gray-500">Loading...</div>
+                        ) : elevations.length === 0 ? (
+                            <div className="p-6 text-center text-gray-500">No role elevations</div>
+                        ) : (
+                            <table className="min-w-full divide-y divide-gray-200">
+                                <thead className="bg-gray-50">
+                                    <tr>
+                                        <th className="px-6 py-3 text-left text-xs font-medium text-gray-500 uppercase">User</th>
+                                        <th className="px-6 py-3 text-left text-xs font-medium text-gray-500 uppercase">Role</th>
+                                        <th className="px-6 py-3 text-left text-xs font-medium text-gray-500 uppercase">Justification</th>
+                                        <th className="px-6 py-3 text-left text-xs font-medium text-gray-500 uppercase">Status</th>
+                                        <th className="px-6 py-3 text-left text-xs font-medium text-gray-500 uppercase">Expires</th>
+                                        <th className="px-6 py-3 text-right text-xs font-medium text-gray-500 uppercase">Actions</th>
+                                    </tr>
+                                </thead>
+                                <tbody className="bg-white divide-y divide-gray-200">
+                                    {elevations.map((elevation) => (
+                                        <tr key={elevation.id}>
+                                            <td className="px-6 py-4 text-sm text-gray-900">{elevation.user_email}</td>
+                                            <td className="px-6 py-4 text-sm text-gray-900 capitalize">
+                                                {elevation.role} ({elevation.duration_hours}h)
+                                            </td>
+                                            <td className="px-6 py-4 text-sm text-gray-700">
+                                                {elevation.justification}
+                                                {elevation.rejection_reason && (
+                                                    <div className="text-xs text-red-600 mt-1">Rejected: {elevation.rejection_reason}</div>
+                                                )}
+                                            </td>
+                                            <td className="px-6 py-4">{getStatusBadge(elevation.status)}</td>
+                                            <td className="px-6 py-4 text-sm text-gray-500">{formatDate(elevation.expires_at)}</td>
+                                            <td className="px-6 py-4 text-right text-sm space-x-2 whitespace-nowrap">
+                                                {elevation.status === 'pending' && isStandingAdmin && elevation.user_id !== user.id && (
+                                                    <>
+                                                        <button
+                                                            onClick={() => handleDecide(elevation, 'approve')}
+                                                            disabled={processing}
+                                                            className="text-green-600 hover:text-green-800"
+                                                        >
+                                                            Approve
+                                                        </button>
+                                                        <button
+                                                            onClick={() => setRejecting(elevation)}
+                                                            className="text-red-600 hover:text-red-800"
+                                                        >
+                                                            Reject
+                                                        </button>
+                                                    </>
+                                                )}
+                                                {(elevation.status === 'pending' || elevation.status === 'active') && (elevation.user_id === user.id || isAdmin) && (
+                                                    <button
+                                                        onClick={() => handleRevoke(elevation)}
+                                                        className="text-gray-600 hover:text-gray-900"
+                                                    >
+                                                        {elevation.status === 'pending' ? 'Withdraw' : 'End'}
+                                                    </button>
+                                                )}
+                                                {isAdmin && elevation.status !== 'pending' && elevation.status !== 'rejected' && (
+                                                    <a
+                                                        href={`/admin/audit?elevation_id=${elevation.id}`}
+                                                        className="text-blue-600 hover:text-blue-800"
+                                                    >
+                                                        Activity
+                                                    </a>
+                                                )}
+                                            </td>
+                                        </tr>
+                                    ))}
+                                </tbody>
+                            </table>
+                        )}
+                    </div>
+                </div>
+            </main>
+
+            {rejecting && (
+                <div className="fixed inset-0 bg-black bg-opacity-50 flex items-center justify-center z-50">
+                    <div className="bg-white rounded-lg p-6 max-w-md w-full mx-4">
+                        <h2 className="text-xl font-bold text-gray-900 mb-4">Reject Elevation</h2>
+                        <div className="mb-4">
+                            <label className="block text-sm font-medium text-gray-700 mb-1">Reason for Rejection</label>
+                            <textarea
+                                value={rejectionReason}
+                                onChange={(e) => setRejectionReason(e.target.value)}
+                                placeholder="Please provide a reason..."
+                                rows={4}
+                                className="w-full px-3 py-2 border border-gray-300 rounded-lg"
+                            />
+                        </div>
+                        <div className="flex justify-end space-x-3">
+                            <button
+                                onClick={() => setRejecting(null)}
+                                className="px-4 py-2 text-gray-700 hover:bg-gray-100 rounded-lg"
+                            >
+                                Cancel
+                            </button>
+                            <button
+                                onClick={() => handleDecide(rejecting, 'reject')}
+                                disabled={processing || !rejectionReason.trim()}
+                                className="px-4 py-2 bg-red-600 text-white rounded-lg hover:bg-red-700 disabled:opacity-50"
+                            >
+                                {processing ? 'Rejecting...' : 'Reject'}
+                            </button>
+                        </div>
+                    </div>
+                </div>
+            )}
+        </div>
+    )
+}
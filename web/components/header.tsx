@@ -3,11 +3,36 @@
 import { useAuth } from '@/lib/auth-context'
 import { useRouter, usePathname } from 'next/navigation'
 import Link from 'next/link'
+import { useEffect, useState } from 'react'
+import { api } from '@/lib/api'
+import { Capabilities } from '@/types'
+
+const bannerStyles = {
+    info: 'bg-blue-50 text-blue-800 border-blue-200',
+    warning: 'bg-yellow-50 text-yellow-800 border-yellow-200',
+    error: 'bg-red-50 text-red-800 border-red-200',
+}
 
 export default function Header() {
     const { user, logout } = useAuth()
     const router = useRouter()
     const pathname = usePathname()
+    const [redacted, setRedacted] = useState(api.isRedacted())
+    const [capabilities, setCapabilities] = useState<Capabilities | null>(null)
+
+    useEffect(() => {
+        if (!user) return
+        api.getCapabilities()
+            .then(setCapabilities)
+            .catch(() => setCapabilities(null))
+    }, [user])
+
+    const toggleRedacted = () => {
+        api.setRedacted(!redacted)
+        setRedacted(!redacted)
+        // Reload so every list is fetched again in the new mode
+        window.location.reload()
+    }
 
     const handleLogout = async () => {
         await logout()
@@ -18,7 +43,10 @@ export default function Header() {
 
     const isActive = (path: string) => pathname === path
 
+    const banner = capabilities?.banner
+
     return (
+        <>
         <nav className="bg-white shadow-sm">
             <div className="max-w-7xl mx-auto px-4 sm:px-6 lg:px-8">
                 <div className="flex justify-between h-16">
@@ -30,6 +58,11 @@ export default function Header() {
                     <div className="flex items-center space-x-4">
                         <span className="text-sm text-gray-700">{user.display_name}</span>
                         <span className="text-xs text-gray-500 bg-gray-100 px-2 py-1 rounded capitalize">{user.role}</span>
+                        {user.elevation?.expires_at && (
+                            <span className="text-xs text-purple-800 bg-purple-100 px-2 py-1 rounded">
+                                Elevated until {new Date(user.elevation.expires_at).toLocaleTimeString([], { hour: '2-digit', minute: '2-digit' })}
+                            </span>
+                        )}
 
                         <Link
                             href="/dashboard"
@@ -52,6 +85,13 @@ export default function Header() {
                             My Sessions
                         </Link>
 
+                        <Link
+                            href="/elevation"
+                            className={`text-sm ${isActive('/elevation') ? 'text-gray-900 font-medium' : 'text-blue-600 hover:text-blue-800'}`}
+                        >
+                            Elevation
+                        </Link>
+
                         {user.role.toLowerCase() === 'admin' && (
                             <>
                                 <Link
@@ -78,6 +118,16 @@ export default function Header() {
                             </Link>
                         )}
 
+                        {user.role.toLowerCase() === 'admin' && (
+                            <button
+                                onClick={toggleRedacted}
+                                title="Pseudonymize emails, names, hostnames and IPs for screen sharing"
+                                className={`text-xs px-2 py-1 rounded ${redacted ? 'bg-orange-100 text-orange-800' : 'text-gray-600 hover:text-gray-900'}`}
+                            >
+                                {redacted ? 'Redacted View On' : 'Redacted View'}
+                            </button>
+                        )}
+
                         <button
                             onClick={handleLogout}
                             className="text-sm text-gray-600 hover:text-gray-900"
@@ -88,5 +138,11 @@ export default function Header() {
                 </div>
             </div>
         </nav>
+        {banner && (
+            <div className={`border-b px-4 py-2 text-sm text-center ${bannerStyles[banner.level]}`}>
+                {banner.message}
+            </div>
+        )}
+        </>
     )
 }
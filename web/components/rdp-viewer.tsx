@@ -5,6 +5,7 @@ import { useEffect, useRef, useState } from 'react'
 import Guacamole from 'guacamole-common-js'
 
 import { BinaryWebSocketTunnel } from '../utils/BinaryWebSocketTunnel'
+import type { SessionNotice } from '../types'
 
 interface RdpViewerProps {
   wsUrl: string
@@ -18,6 +19,7 @@ export default function RdpViewer({ wsUrl, onClose }: RdpViewerProps) {
   const isUnmounting = useRef(false)
   const [connectionStatus, setConnectionStatus] = useState<'connecting' | 'connected' | 'disconnected' | 'error'>('connecting')
   const [error, setError] = useState<string>('')
+  const [notice, setNotice] = useState<SessionNotice | null>(null)
 
 
 
@@ -48,6 +50,7 @@ export default function RdpViewer({ wsUrl, onClose }: RdpViewerProps) {
         // Create WebSocket tunnel using our custom BinaryWebSocketTunnel
         tunnel = new BinaryWebSocketTunnel(cleanUrl)
         tunnelRef.current = tunnel // Store direct reference before passing to Guacamole
+        tunnel.onnotice = setNotice
 
         // Create Guacamole client
         client = new Guacamole.Client(tunnel)
@@ -239,6 +242,14 @@ export default function RdpViewer({ wsUrl, onClose }: RdpViewerProps) {
           </button>
         )}
       </div>
+      {notice && (
+        <div className="flex items-center justify-between px-4 py-1 bg-yellow-900 text-yellow-100 text-sm">
+          <span>{notice.message}</span>
+          <button onClick={() => setNotice(null)} className="text-yellow-300 hover:text-white px-2">
+            Dismiss
+          </button>
+        </div>
+      )}
       <div className="flex-1 relative bg-black">
         <div ref={displayRef} className="absolute inset-0" />
         {connectionStatus === 'connecting' && (
@@ -4,6 +4,7 @@ import { useEffect, useRef, useState } from 'react'
 import type { Terminal as XTerm } from '@xterm/xterm'
 import type { FitAddon } from '@xterm/addon-fit'
 import '@xterm/xterm/css/xterm.css'
+import { CLOSE_SERVICE_RESTART, parseCloseReason, withReconnectToken } from '@/lib/api'
 
 interface TerminalProps {
   wsUrl: string
@@ -17,6 +18,12 @@ export default function TerminalClient({ wsUrl, onClose }: TerminalProps) {
   const fitAddonRef = useRef<FitAddon | null>(null)
   const [connectionStatus, setConnectionStatus] = useState<'connecting' | 'connected' | 'disconnected' | 'error'>('connecting')
   const [error, setError] = useState<string>('')
+  // Replaced with a reconnect URL when the gateway restarts
+  const [url, setUrl] = useState(wsUrl)
+
+  useEffect(() => {
+    setUrl(wsUrl)
+  }, [wsUrl])
 
   useEffect(() => {
     if (!terminalRef.current) return
@@ -198,7 +205,7 @@ export default function TerminalClient({ wsUrl, onClose }: TerminalProps) {
         term._captureKeyHandler = captureKeyHandler
 
         // Connect WebSocket
-        const ws = new WebSocket(wsUrl)
+        const ws = new WebSocket(url)
         wsRef.current = ws
 
         ws.onopen = () => {
@@ -231,6 +238,8 @@ export default function TerminalClient({ wsUrl, onClose }: TerminalProps) {
                 setError(msg.message)
                 setConnectionStatus('error')
                 term.writeln(`\r\n\x1b[31mError: ${msg.message}\x1b[0m\r\n`)
+              } else if (msg.type === 'notice') {
+                term.writeln(`\r\n\x1b[33m[OpenPAM] ${msg.notice.message}\x1b[0m`)
               }
             } catch {
               term.write(event.data)
@@ -254,9 +263,20 @@ export default function TerminalClient({ wsUrl, onClose }: TerminalProps) {
           setError('Connection error')
         }
 
-        ws.onclose = () => {
+        ws.onclose = (event) => {
           if (isDisposed.current) return
+          const reason = parseCloseReason(event)
+          if (event.code === CLOSE_SERVICE_RESTART && reason?.token) {
+            const token = reason.token
+            setConnectionStatus('connecting')
+            term.writeln('\r\n\x1b[33mGateway restarting. Reconnecting...\x1b[0m\r\n')
+            setTimeout(() => setUrl(withReconnectToken(wsUrl, token)), 2000)
+            return
+          }
           setConnectionStatus('disconnected')
+          if (reason?.message) {
+            term.writeln(`\r\n\x1b[33m${reason.message}\x1b[0m`)
+          }
           term.writeln('\r\n\x1b[33mSession ended. Redirecting to dashboard...\x1b[0m\r\n')
           // Redirect to dashboard after 2 seconds
           setTimeout(() => {
@@ -295,7 +315,7 @@ export default function TerminalClient({ wsUrl, onClose }: TerminalProps) {
         xtermRef.current.dispose()
       }
     }
-  }, [wsUrl, onClose])
+  }, [url, wsUrl, onClose])
 
   return (
     <div className="flex flex-col h-full bg-[#1e1e1e] relative">
@@ -1,18 +1,38 @@
-import { User, Zone, Target, Credential, AuditLog, SystemAuditLog, ListResponse } from '@/types'
+import { User, Zone, Target, Fingerprint, Credential, AuditLog, SystemAuditLog, RoleElevation, Capabilities, ListResponse } from '@/types'
+import { ApprovalLink } from '@/types/schedule'
 
 const API_URL = process.env.NEXT_PUBLIC_API_URL || 'http://localhost:8080'
 
 class ApiClient {
   private baseUrl: string
   private token: string | null = null
+  private redacted = false
 
   constructor(baseUrl: string) {
     this.baseUrl = baseUrl
     if (typeof window !== 'undefined') {
       this.token = localStorage.getItem('openpam_token')
+      this.redacted = sessionStorage.getItem('openpam_redact') === 'true'
     }
   }
 
+  // Redacted view: the gateway pseudonymizes emails, names, hostnames and IPs
+  // in responses, for showing real data on screen shares. Kept per browser tab.
+  setRedacted(redacted: boolean) {
+    this.redacted = redacted
+    if (typeof window !== 'undefined') {
+      if (redacted) {
+        sessionStorage.setItem('openpam_redact', 'true')
+      } else {
+        sessionStorage.removeItem('openpam_redact')
+      }
+    }
+  }
+
+  isRedacted(): boolean {
+    return this.redacted
+  }
+
   setToken(token: string | null) {
     this.token = token
     if (typeof window !== 'undefined') {
@@ -42,6 +62,9 @@ class ApiClient {
     if (this.token) {
       headers['Authorization'] = `Bearer ${this.token}`
     }
+    if (this.redacted) {
+      headers['X-OpenPAM-Redact'] = 'true'
+    }
 
     try {
       const response = await fetch(`${this.baseUrl}${path}`, {
@@ -92,6 +115,11 @@ class ApiClient {
     return this.request<User>('/api/v1/auth/me')
   }
 
+  // What the gateway allows under the current license
+  async getCapabilities(): Promise<Capabilities> {
+    return this.request<Capabilities>('/api/v1/capabilities')
+  }
+
   // Users
   async listUsers(): Promise<ListResponse<User>> {
     return this.request<ListResponse<User>>('/api/v1/users')
@@ -152,6 +180,13 @@ class ApiClient {
     })
   }
 
+  async probeHost(host: string, ports?: number[]): Promise<Fingerprint> {
+    return this.request<Fingerprint>('/api/v1/fingerprints', {
+      method: 'POST',
+      body: JSON.stringify({ host, ports }),
+    })
+  }
+
   async updateTarget(id: string, target: Partial<Target>): Promise<Target> {
     return this.request<Target>(`/api/v1/targets?id=${id}`, {
       method: 'PUT',
@@ -231,10 +266,11 @@ class ApiClient {
   }
 
   // System Audit Logs
-  async listSystemAuditLogs(params?: { event_type?: string; user_id?: string; limit?: number; offset?: number }): Promise<ListResponse<SystemAuditLog>> {
+  async listSystemAuditLogs(params?: { event_type?: string; user_id?: string; elevation_id?: string; limit?: number; offset?: number }): Promise<ListResponse<SystemAuditLog>> {
     const query = new URLSearchParams()
     if (params?.event_type) query.set('event_type', params.event_type)
     if (params?.user_id) query.set('user_id', params.user_id)
+    if (params?.elevation_id) query.set('elevation_id', params.elevation_id)
     if (params?.limit) query.set('limit', params.limit.toString())
     if (params?.offset) query.set('offset', params.offset.toString())
 
@@ -246,6 +282,73 @@ class ApiClient {
     return this.request<SystemAuditLog>(`/api/v1/system-audit-logs/${id}`)
   }
 
+  // Role elevation
+  async listElevations(params?: { status?: string; user_id?: string }): Promise<{ elevations: RoleElevation[]; count: number }> {
+    const query = new URLSearchParams()
+    if (params?.status) query.set('status', params.status)
+    if (params?.user_id) query.set('user_id', params.user_id)
+
+    const queryString = query.toString()
+    return this.request(`/api/v1/elevations${queryString ? '?' + queryString : ''}`)
+  }
+
+  async requestElevation(role: string, hours: number, justification: string): Promise<RoleElevation> {
+    return this.request<RoleElevation>('/api/v1/elevations', {
+      method: 'POST',
+      body: JSON.stringify({ role, hours, justification }),
+    })
+  }
+
+  async decideElevation(id: string, decision: 'approve' | 'reject', reason?: string): Promise<RoleElevation> {
+    return this.request<RoleElevation>(`/api/v1/elevations/${id}/${decision}`, {
+      method: 'POST',
+      body: JSON.stringify(reason ? { reason } : {}),
+    })
+  }
+
+  async revokeElevation(id: string): Promise<RoleElevation> {
+    return this.request<RoleElevation>(`/api/v1/elevations/${id}/revoke`, { method: 'POST' })
+  }
+
+  // Approval links, opened from the email or chat message sent to an approver
+  async getApproval(token: string): Promise<ApprovalLink> {
+    return this.request<ApprovalLink>(`/api/v1/approvals/${encodeURIComponent(token)}`)
+  }
+
+  async decideApproval(token: string, decision: 'approve' | 'reject', reason?: string): Promise<{ success: boolean; message: string; decision: string }> {
+    return this.request(`/api/v1/approvals/${encodeURIComponent(token)}/${decision}`, {
+      method: 'POST',
+      body: JSON.stringify(reason ? { reason } : {}),
+    })
+  }
+
+  // Live event stream (Server-Sent Events). EventSource reconnects on its own and
+  // resumes from the last event it received.
+  streamEvents(types: string[], onEvent: (type: string, data: unknown) => void): EventSource {
+    const query = new URLSearchParams()
+    if (types.length > 0) query.set('types', types.join(','))
+    // EventSource can't send headers, so the token goes in the query like for WebSockets
+    if (this.token) query.set('token', this.token)
+
+    const source = new EventSource(`${this.baseUrl}/api/v1/events/stream?${query.toString()}`, {
+      withCredentials: true,
+    })
+
+    const handler = (e: MessageEvent) => onEvent(e.type, JSON.parse(e.data))
+    for (const type of types) {
+      if (type.endsWith('*')) continue
+      source.addEventListener(type, handler as EventListener)
+    }
+    // Wildcard subscriptions can't be registered by name, so forward every session status
+    if (types.some(t => t.startsWith('audit.'))) {
+      for (const status of ['started', 'completed', 'failed', 'terminated']) {
+        source.addEventListener(`audit.session_${status}`, handler as EventListener)
+      }
+    }
+
+    return source
+  }
+
   // WebSocket URL for connections
   getWebSocketUrl(protocol: string, targetId: string, credentialId: string): string {
     const wsUrl = process.env.NEXT_PUBLIC_WS_URL || 'ws://localhost:8080'
@@ -264,3 +367,27 @@ class ApiClient {
 }
 
 export const api = new ApiClient(API_URL)
+
+// Close frame reason sent by the gateway when it ends a WebSocket
+export interface CloseReason {
+  reason: string
+  message?: string
+  token?: string // Reconnect token for the same path
+}
+
+export const CLOSE_SERVICE_RESTART = 1012
+
+export function parseCloseReason(event: CloseEvent): CloseReason | null {
+  try {
+    return JSON.parse(event.reason) as CloseReason
+  } catch {
+    return null
+  }
+}
+
+// Replaces the auth token in a WebSocket URL with a reconnect token
+export function withReconnectToken(url: string, token: string): string {
+  const u = new URL(url)
+  u.searchParams.set('token', token)
+  return u.toString()
+}
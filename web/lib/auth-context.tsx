@@ -10,6 +10,7 @@ interface AuthContextType {
   login: () => void
   logout: () => Promise<void>
   setToken: (token: string) => Promise<void>
+  refreshUser: () => Promise<void> // Reloads the user, e.g. after their role elevation changed
 }
 
 const AuthContext = createContext<AuthContextType | undefined>(undefined)
@@ -65,7 +66,7 @@ export function AuthProvider({ children }: { children: React.ReactNode }) {
   }
 
   return (
-    <AuthContext.Provider value={{ user, loading, login, logout, setToken }}>
+    <AuthContext.Provider value={{ user, loading, login, logout, setToken, refreshUser: checkAuth }}>
       {children}
     </AuthContext.Provider>
   )
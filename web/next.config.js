@@ -50,10 +50,18 @@ const nextConfig = {
         source: '/api/v1/ad-users',
         destination: 'http://localhost:8082/api/v1/ad-users',
       },
+      {
+        source: '/api/v1/ad-users/:path*',
+        destination: 'http://localhost:8082/api/v1/ad-users/:path*',
+      },
       {
         source: '/api/v1/ad-computers',
         destination: 'http://localhost:8082/api/v1/ad-computers',
       },
+      {
+        source: '/api/v1/ad-computers/:path*',
+        destination: 'http://localhost:8082/api/v1/ad-computers/:path*',
+      },
       {
         source: '/api/v1/ad-groups',
         destination: 'http://localhost:8082/api/v1/ad-groups',
@@ -3,16 +3,38 @@ export interface User {
   email: string
   display_name: string
   role: string
+  base_role?: string          // The user's own role while elevated
+  elevation?: RoleElevation   // Set while the user holds an elevated role
   enabled: boolean
+  version: number
   created_at: string
   updated_at: string
 }
 
+export interface RoleElevation {
+  id: string
+  user_id: string
+  user_email?: string
+  role: 'admin' | 'auditor'
+  justification: string
+  duration_hours: number
+  status: 'pending' | 'active' | 'rejected' | 'expired' | 'revoked'
+  decided_by?: string
+  decided_at?: string
+  rejection_reason?: string
+  starts_at?: string
+  expires_at?: string
+  ended_by?: string
+  ended_at?: string
+  created_at: string
+}
+
 export interface Zone {
   id: string
   name: string
   type: 'hub' | 'satellite'
   description?: string
+  version: number
   created_at: string
   updated_at: string
 }
@@ -24,17 +46,47 @@ export interface Target {
   hostname: string
   protocol: 'ssh' | 'rdp'
   port: number
-  description?: string
+  owner_team?: string
+  environment?: string
+  compliance_scope?: string[]
+  labels?: Record<string, string>
+  connection_notes?: string
   enabled: boolean
+  version: number
   created_at: string
   updated_at: string
 }
 
+export interface ProbedService {
+  port: number
+  protocol?: 'ssh' | 'rdp'
+  banner?: string
+  product?: string
+  version?: string
+  security?: 'rdp' | 'tls' | 'credssp'
+}
+
+export interface Fingerprint {
+  host: string
+  services: ProbedService[]
+  os?: string
+  os_version?: string
+  os_family?: 'linux' | 'windows' | 'bsd'
+  os_source?: 'active_directory' | 'ssh_banner' | 'rdp' | 'ports'
+  suggested_protocol?: 'ssh' | 'rdp'
+  suggested_port?: number
+  probed_at: string
+}
+
 export interface Credential {
   id: string
   target_id: string
   username: string
   description?: string
+  version: number
+  auth_failures?: number
+  last_auth_failure_at?: string
+  quarantined_at?: string
 }
 
 export interface AuditLog {
@@ -53,6 +105,8 @@ export interface AuditLog {
   client_ip?: string
   error_message?: string
   recording_path?: string
+  recording_state?: 'started' | 'failed' | 'disabled' | 'not_started'
+  recording_error?: string
   protocol: string
   created_at: string
 }
@@ -71,9 +125,45 @@ export interface SystemAuditLog {
   ip_address?: string
   user_agent?: string
   details?: Record<string, any>
+  elevation_id?: string  // Set when the actor held an elevated role
   created_at: string
 }
 
+export interface LicenseStatus {
+  mode: 'unenforced' | 'active' | 'grace' | 'read_only'
+  license_type?: string
+  issued_to?: string
+  expires_at?: string
+  grace_ends_at?: string
+  days_remaining?: number  // Until expiry, or until read-only once expired
+  checked_at?: string
+}
+
+export interface Banner {
+  level: 'info' | 'warning' | 'error'
+  message: string
+}
+
+export interface Capabilities {
+  license: LicenseStatus
+  read_only: boolean
+  new_sessions: boolean
+  new_users: boolean
+  blocked_protocols: string[]
+  banner?: Banner
+}
+
+// Sent by the gateway over a session's WebSocket: a JSON text message
+// {"type": "notice", "notice": ...} for SSH, an openpam-notice instruction for RDP
+export interface SessionNotice {
+  type: 'time_remaining' | 'idle_warning' | 'access_extended' | 'monitor_joined' | 'clipboard_blocked'
+  message: string
+  ends_at?: string
+  reason?: 'schedule' | 'max_duration'  // What ends the session, for time_remaining
+  by?: string  // Who joined, for monitor_joined
+  time: string
+}
+
 export interface ApiResponse<T> {
   data?: T
   error?: string
@@ -16,4 +16,16 @@ export interface Schedule {
     created_at: string
     updated_at: string
     metadata?: Record<string, any>
+    version: number
+}
+
+export interface ApprovalLink {
+    success: boolean
+    schedule: Schedule
+    channel: 'web' | 'email' | 'slack'
+    expires_at: string
+    step_up_required: boolean
+    approver?: { email: string; display_name: string }
+    requester?: { email: string; display_name: string }
+    target?: { name: string; hostname: string; protocol: string }
 }
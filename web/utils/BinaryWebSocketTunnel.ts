@@ -1,10 +1,15 @@
 import Guacamole from 'guacamole-common-js';
+import type { SessionNotice } from '../types';
+
+// The instruction the gateway sends session notices in
+const NOTICE_OPCODE = "openpam-notice";
 
 export class BinaryWebSocketTunnel extends Guacamole.Tunnel {
     private socket: WebSocket | null = null;
     private decoder: TextDecoder;
     private tunnelUrl: string;
     private parser: Guacamole.Parser;
+    onnotice: ((notice: SessionNotice) => void) | null = null;
 
     constructor(tunnelUrl: string) {
         super();
@@ -15,6 +20,14 @@ export class BinaryWebSocketTunnel extends Guacamole.Tunnel {
 
         this.parser.oninstruction = (opcode, args) => {
             // console.log("Tunnel instruction:", opcode, args);
+            if (opcode === NOTICE_OPCODE) {
+                try {
+                    this.onnotice?.(JSON.parse(args[0]));
+                } catch {
+                    // Ignore malformed notices
+                }
+                return;
+            }
             if (this.oninstruction) {
                 this.oninstruction(opcode, args);
             }